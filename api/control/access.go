@@ -0,0 +1,45 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+func (c *Control) handleListAccessRequests(w http.ResponseWriter, r *http.Request) {
+	respond(w, c.instance.Router().ExportAccessRequests())
+}
+
+func (c *Control) handleApproveAccessRequest(w http.ResponseWriter, r *http.Request) {
+	c.decideAccessRequest(w, r, true)
+}
+
+func (c *Control) handleDismissAccessRequest(w http.ResponseWriter, r *http.Request) {
+	c.decideAccessRequest(w, r, false)
+}
+
+func (c *Control) decideAccessRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	routerIP, err := netip.ParseAddr(r.PathValue("router"))
+	if err != nil {
+		http.Error(w, "invalid router: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	service := r.PathValue("service")
+
+	if approve {
+		err = c.instance.Router().ApproveAccessRequest(routerIP, service)
+	} else {
+		err = c.instance.Router().DismissAccessRequest(routerIP, service)
+	}
+	switch {
+	case errors.Is(err, router.ErrAccessRequestNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,34 @@
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessRequestsAPI(t *testing.T) {
+	t.Parallel()
+
+	c := newTestControl(t)
+
+	// List requests.
+	w := httptest.NewRecorder()
+	c.handleListAccessRequests(w, httptest.NewRequest(http.MethodGet, Path+"/access/requests", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+
+	// Decide requests.
+	decide := func(handler http.HandlerFunc, router string) int {
+		r := httptest.NewRequest(http.MethodPost, Path+"/access/requests/"+router+"/ssh/approve", nil)
+		r.SetPathValue("router", router)
+		r.SetPathValue("service", "ssh")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, decide(c.handleApproveAccessRequest, "invalid"))
+	assert.Equal(t, http.StatusNotFound, decide(c.handleApproveAccessRequest, "fd12:3456::1"))
+	assert.Equal(t, http.StatusNotFound, decide(c.handleDismissAccessRequest, "fd12:3456::1"))
+}
@@ -0,0 +1,508 @@
+package control
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/storage"
+)
+
+// Local applications register with the API and receive a token. With the
+// token, they use the app endpoints, which are limited to their namespace:
+// Their stream services and groups are prefixed with the name of the app and
+// they may only open streams to the routers allowed by their outbound policy,
+// which only the admin API can change. This way, multiple apps can share a
+// router without getting in each other's way.
+// Note that the admin API itself is not authenticated: App tokens separate
+// apps, but do not isolate them from processes that can reach the admin API.
+// Restrict access to the API listeners accordingly.
+
+const (
+	// appTokenSecretSize is the size of the secret part of app tokens.
+	appTokenSecretSize = 32
+	// maxApps limits the amount of registered apps.
+	maxApps = 64
+)
+
+// App errors.
+var (
+	ErrInvalidAppName = errors.New("app name must be 1-32 lowercase letters, digits or dashes")
+	ErrAppExists      = errors.New("app already exists")
+	ErrAppNotFound    = errors.New("app not found")
+	ErrAppLimit       = errors.New("too many apps")
+
+	ErrAppOutboundDenied = m.NewError(m.CodePolicyDenied, "router is not allowed by the outbound policy of the app")
+)
+
+var appNameRegex = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// App is a local application registered with the API.
+type App struct {
+	Name string `json:"name"`
+	// Namespace prefixes the stream services and groups of the app,
+	// separated by a dot.
+	Namespace string    `json:"namespace"`
+	Created   time.Time `json:"created"`
+	Outbound  AppPolicy `json:"outbound"`
+}
+
+// AppPolicy is the outbound policy of an app.
+type AppPolicy struct {
+	// Friends allows the app to open streams to friends.
+	Friends bool `json:"friends,omitempty"`
+	// Routers holds further routers the app may open streams to.
+	Routers []netip.Addr `json:"routers,omitempty"`
+}
+
+// AppRegisterRequest registers a new app.
+type AppRegisterRequest struct {
+	Name     string     `json:"name"`
+	Outbound *AppPolicy `json:"outbound,omitempty"`
+}
+
+// AppRegistration is the result of registering an app. The token is only
+// returned once.
+type AppRegistration struct {
+	App
+	Token string `json:"token"`
+}
+
+// AppEvent is an event of an app.
+type AppEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Group message fields.
+	Group     string     `json:"group,omitempty"`
+	Publisher netip.Addr `json:"publisher,omitempty"`
+	Data      []byte     `json:"data,omitempty"`
+
+	// Denied stream fields.
+	Router  netip.Addr `json:"router,omitempty"`
+	Service string     `json:"service,omitempty"`
+
+	app string
+}
+
+// appSession is an authenticated app with the context of its requests and
+// streams, which is canceled when the app is deleted.
+type appSession struct {
+	*storage.StoredApp
+	ctx context.Context
+}
+
+// appCtx is the context of the requests and streams of an app.
+type appCtx struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// App event types.
+const (
+	AppEventTypeGroup  = "group"
+	AppEventTypeDenied = "denied"
+)
+
+func (c *Control) registerAppRoutes() {
+	api := c.instance.API()
+
+	// Management of apps.
+	api.HandleFunc("GET "+Path+"/apps", c.handleListApps)
+	api.HandleFunc("POST "+Path+"/apps", c.handleRegisterApp)
+	api.HandleFunc("DELETE "+Path+"/apps/{name}", c.handleDeleteApp)
+	api.HandleFunc("PUT "+Path+"/apps/{name}/outbound", c.handleSetAppPolicy)
+
+	// Endpoints for apps.
+	api.HandleFunc("GET "+Path+"/app", c.appHandler(c.handleAppInfo))
+	api.HandleFunc("GET "+Path+"/app/events", c.appHandler(c.handleAppEvents))
+	api.HandleFunc("GET "+Path+"/app/streams/connect/{router}/{service}", c.appHandler(c.handleAppConnectStream))
+	api.HandleFunc("GET "+Path+"/app/streams/accept/{service}", c.appHandler(c.handleAppAcceptStream))
+	api.HandleFunc("POST "+Path+"/app/groups/{group}/join", c.appHandler(c.handleAppGroup(c.handleJoinGroup)))
+	api.HandleFunc("POST "+Path+"/app/groups/{group}/leave", c.appHandler(c.handleAppGroup(c.handleLeaveGroup)))
+	api.HandleFunc("POST "+Path+"/app/groups/{group}/publish", c.appHandler(c.handleAppGroup(c.handlePublishToGroup)))
+	api.HandleFunc("GET "+Path+"/app/groups/{group}/messages", c.appHandler(c.handleAppGroup(c.handleWatchGroup)))
+}
+
+func (c *Control) handleListApps(w http.ResponseWriter, r *http.Request) {
+	stored, err := c.instance.Storage().QueryApps()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	apps := make([]App, 0, len(stored))
+	for _, app := range stored {
+		apps = append(apps, makeApp(&app))
+	}
+	respond(w, apps)
+}
+
+func (c *Control) handleRegisterApp(w http.ResponseWriter, r *http.Request) {
+	var req AppRegisterRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reg, err := c.RegisterApp(req.Name, req.Outbound)
+	if err != nil {
+		respondAppError(w, err)
+		return
+	}
+	respond(w, reg)
+}
+
+func (c *Control) handleDeleteApp(w http.ResponseWriter, r *http.Request) {
+	if err := c.DeleteApp(r.PathValue("name")); err != nil {
+		respondAppError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegisterApp registers a new app and returns its token.
+// Apps may open streams to friends, if no outbound policy is given.
+func (c *Control) RegisterApp(name string, outbound *AppPolicy) (*AppRegistration, error) {
+	if !appNameRegex.MatchString(name) {
+		return nil, ErrInvalidAppName
+	}
+	if outbound == nil {
+		outbound = &AppPolicy{Friends: true}
+	}
+
+	c.appsLock.Lock()
+	defer c.appsLock.Unlock()
+
+	// Check for existing apps.
+	apps, err := c.instance.Storage().QueryApps()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case slices.ContainsFunc(apps, func(app storage.StoredApp) bool { return app.Name == name }):
+		return nil, ErrAppExists
+	case len(apps) >= maxApps:
+		return nil, ErrAppLimit
+	}
+
+	// Create token.
+	secret := make([]byte, appTokenSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	token := name + "." + base64.RawURLEncoding.EncodeToString(secret)
+	hash := blake3.Sum256([]byte(token))
+
+	// Save app.
+	app := &storage.StoredApp{
+		Name:            name,
+		TokenHash:       hash[:],
+		Created:         time.Now().UTC(),
+		OutboundFriends: outbound.Friends,
+		OutboundRouters: outbound.Routers,
+	}
+	if err := c.instance.Storage().SaveApp(app); err != nil {
+		return nil, err
+	}
+
+	return &AppRegistration{
+		App:   makeApp(app),
+		Token: token,
+	}, nil
+}
+
+// SetAppPolicy sets the outbound policy of the app with the given name.
+func (c *Control) SetAppPolicy(name string, policy AppPolicy) (*App, error) {
+	c.appsLock.Lock()
+	defer c.appsLock.Unlock()
+
+	app, err := c.instance.Storage().GetApp(name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrAppNotFound
+		}
+		return nil, err
+	}
+	updated := *app
+	updated.OutboundFriends = policy.Friends
+	updated.OutboundRouters = policy.Routers
+	if err := c.instance.Storage().SaveApp(&updated); err != nil {
+		return nil, err
+	}
+	info := makeApp(&updated)
+	return &info, nil
+}
+
+// DeleteApp deletes the app with the given name and stops its requests,
+// streams, stream listeners and group memberships.
+func (c *Control) DeleteApp(name string) error {
+	c.appsLock.Lock()
+	defer c.appsLock.Unlock()
+
+	if _, err := c.instance.Storage().GetApp(name); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrAppNotFound
+		}
+		return err
+	}
+	if err := c.instance.Storage().DeleteApp(name); err != nil {
+		return err
+	}
+
+	// Stop requests and streams.
+	if session, ok := c.appCtxs[name]; ok {
+		session.cancel()
+		delete(c.appCtxs, name)
+	}
+
+	// Clean up namespace.
+	c.streamListenersLock.Lock()
+	for service, l := range c.streamListeners {
+		if l.app == name {
+			_ = l.listener.Close()
+			delete(c.streamListeners, service)
+		}
+	}
+	c.streamListenersLock.Unlock()
+	prefix := appNamespace(name)
+	groupPing := c.instance.Router().GroupPing
+	for _, group := range groupPing.Groups() {
+		if strings.HasPrefix(group, prefix) {
+			_ = groupPing.Leave(group)
+		}
+	}
+
+	return nil
+}
+
+// inAppNamespace returns whether the given stream service or group is in the
+// namespace of a registered app.
+func (c *Control) inAppNamespace(name string) bool {
+	appName, _, ok := strings.Cut(name, ".")
+	if !ok {
+		return false
+	}
+	_, err := c.instance.Storage().GetApp(appName)
+	return err == nil
+}
+
+// authenticateApp returns the app of the token in the Authorization header.
+func (c *Control) authenticateApp(r *http.Request) (*appSession, bool) {
+	c.appsLock.Lock()
+	defer c.appsLock.Unlock()
+
+	app, ok := c.checkAppToken(r)
+	if !ok {
+		return nil, false
+	}
+
+	// Get the context of the app while holding the lock, so that it is
+	// canceled if the app is deleted.
+	session, ok := c.appCtxs[app.Name]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		session = appCtx{ctx: ctx, cancel: cancel}
+		c.appCtxs[app.Name] = session
+	}
+	return &appSession{StoredApp: app, ctx: session.ctx}, true
+}
+
+// checkAppToken returns the app of the token in the Authorization header.
+func (c *Control) checkAppToken(r *http.Request) (*storage.StoredApp, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, false
+	}
+	name, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, false
+	}
+	app, err := c.instance.Storage().GetApp(name)
+	if err != nil {
+		return nil, false
+	}
+	hash := blake3.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(hash[:], app.TokenHash) != 1 {
+		return nil, false
+	}
+	return app, true
+}
+
+// appHandler wraps handlers of app endpoints and authenticates the app.
+// Requests are canceled when the app is deleted.
+func (c *Control) appHandler(handler func(http.ResponseWriter, *http.Request, *appSession)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app, ok := c.authenticateApp(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid app token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		defer context.AfterFunc(app.ctx, cancel)()
+		handler(w, r.WithContext(ctx), app)
+	}
+}
+
+func (c *Control) handleAppInfo(w http.ResponseWriter, r *http.Request, app *appSession) {
+	respond(w, makeApp(app.StoredApp))
+}
+
+func (c *Control) handleSetAppPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy AppPolicy
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&policy); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app, err := c.SetAppPolicy(r.PathValue("name"), policy)
+	if err != nil {
+		respondAppError(w, err)
+		return
+	}
+	respond(w, app)
+}
+
+func (c *Control) handleAppConnectStream(w http.ResponseWriter, r *http.Request, app *appSession) {
+	dst, ok := c.streamRouter(r.PathValue("router"))
+	if !ok {
+		http.Error(w, "router is neither an IP nor a friend name", http.StatusBadRequest)
+		return
+	}
+
+	// Check outbound policy of the app.
+	_, isFriend := c.instance.Config().GetFriendByIP(dst)
+	if !(app.OutboundFriends && isFriend) && !slices.Contains(app.OutboundRouters, dst) {
+		c.appEvents.Submit(&AppEvent{
+			Type:    AppEventTypeDenied,
+			Time:    time.Now(),
+			Router:  dst,
+			Service: r.PathValue("service"),
+			app:     app.Name,
+		})
+		httpError(w, ErrAppOutboundDenied, http.StatusForbidden)
+		return
+	}
+
+	c.connectStream(w, r, app.ctx)
+}
+
+func (c *Control) handleAppAcceptStream(w http.ResponseWriter, r *http.Request, app *appSession) {
+	c.acceptStream(w, r, appNamespace(app.Name)+r.PathValue("service"), app.Name, app.ctx)
+}
+
+// handleAppGroup moves the group of the request into the namespace of the app.
+func (c *Control) handleAppGroup(handler http.HandlerFunc) func(http.ResponseWriter, *http.Request, *appSession) {
+	return func(w http.ResponseWriter, r *http.Request, app *appSession) {
+		r.SetPathValue("group", appNamespace(app.Name)+r.PathValue("group"))
+		handler(w, r)
+	}
+}
+
+func (c *Control) handleAppEvents(w http.ResponseWriter, r *http.Request, app *appSession) {
+	prefix := appNamespace(app.Name)
+
+	// Subscribe to events.
+	groupSub := c.instance.Router().GroupPing.Events.Subscribe("control api app "+app.Name, 100)
+	defer groupSub.Cancel()
+	appSub := c.appEvents.Subscribe("control api app "+app.Name, 100)
+	defer appSub.Cancel()
+
+	// Stream events until the client disconnects.
+	send, err := stream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for {
+		var event *AppEvent
+		select {
+		case msg := <-groupSub.Events():
+			group, ok := strings.CutPrefix(msg.Group, prefix)
+			if !ok {
+				continue
+			}
+			event = &AppEvent{
+				Type:      AppEventTypeGroup,
+				Time:      msg.Time,
+				Group:     group,
+				Publisher: msg.Publisher,
+				Data:      msg.Data,
+			}
+		case e := <-appSub.Events():
+			if e.app != app.Name {
+				continue
+			}
+			event = e
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := send(event); err != nil {
+			return
+		}
+	}
+}
+
+// streamRouter returns the router with the given IP or friend name.
+func (c *Control) streamRouter(name string) (netip.Addr, bool) {
+	if dst, err := netip.ParseAddr(name); err == nil {
+		return dst, true
+	}
+	friend, ok := c.instance.Config().GetFriendByName(name)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	return friend.IP, true
+}
+
+func newAppEventMgr() *mgr.EventMgr[*AppEvent] {
+	return mgr.NewEventMgr[*AppEvent]("app events", nil)
+}
+
+// appNamespace returns the prefix of the stream services and groups of the
+// given app.
+func appNamespace(name string) string {
+	return name + "."
+}
+
+func makeApp(app *storage.StoredApp) App {
+	return App{
+		Name:      app.Name,
+		Namespace: app.Name,
+		Created:   app.Created,
+		Outbound: AppPolicy{
+			Friends: app.OutboundFriends,
+			Routers: app.OutboundRouters,
+		},
+	}
+}
+
+func respondAppError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidAppName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrAppNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrAppExists),
+		errors.Is(err, ErrAppLimit):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,180 @@
+package control
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/api/netstack"
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/ha"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/router"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
+	"github.com/mycoria/mycoria/switchr"
+	"github.com/mycoria/mycoria/tun"
+)
+
+type testInstance struct {
+	instance
+	config   *config.Config
+	identity *m.Address
+	builder  *frame.Builder
+	storage  storage.Storage
+	router   *router.Router
+	peering  *peering.Peering
+	watchdog *mgr.Watchdog
+}
+
+func (i *testInstance) Config() *config.Config        { return i.config }
+func (i *testInstance) Identity() *m.Address          { return i.identity }
+func (i *testInstance) FrameBuilder() *frame.Builder  { return i.builder }
+func (i *testInstance) Storage() storage.Storage      { return i.storage }
+func (i *testInstance) Router() *router.Router        { return i.router }
+func (i *testInstance) Version() string               { return "test" }
+func (i *testInstance) RoutingTable() *m.RoutingTable { return i.router.Table() }
+func (i *testInstance) Peering() *peering.Peering     { return i.peering }
+func (i *testInstance) Watchdog() *mgr.Watchdog       { return i.watchdog }
+func (i *testInstance) NetStack() *netstack.NetStack  { return nil }
+func (i *testInstance) HA() *ha.HA                    { return nil }
+func (i *testInstance) State() *state.State           { return nil }
+func (i *testInstance) TunDevice() *tun.Device        { return nil }
+func (i *testInstance) Switch() *switchr.Switch       { return nil }
+
+func newTestControl(t *testing.T) *Control {
+	t.Helper()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	inst := &testInstance{
+		config:   config.MakeTestConfig(config.Store{}),
+		identity: identity,
+		builder:  frame.NewFrameBuilder(),
+		storage:  storage.NewMemStorage(),
+	}
+	inst.router, err = router.New(inst, router.Config{})
+	require.NoError(t, err)
+	inst.peering = peering.New(inst, nil, nil)
+	inst.watchdog = mgr.NewWatchdog(time.Minute, nil)
+	return &Control{
+		instance:        inst,
+		streamListeners: make(map[string]*apiListener),
+		appCtxs:         make(map[string]appCtx),
+		appEvents:       newAppEventMgr(),
+	}
+}
+
+func TestAppRegistration(t *testing.T) {
+	t.Parallel()
+
+	c := newTestControl(t)
+
+	// Register apps.
+	_, err := c.RegisterApp("Chat", nil)
+	require.ErrorIs(t, err, ErrInvalidAppName)
+	reg, err := c.RegisterApp("chat", nil)
+	require.NoError(t, err)
+	assert.True(t, reg.Outbound.Friends, "apps may reach friends by default")
+	_, err = c.RegisterApp("chat", nil)
+	require.ErrorIs(t, err, ErrAppExists)
+	other, err := c.RegisterApp("other", &AppPolicy{})
+	require.NoError(t, err)
+
+	// Only valid tokens are accepted.
+	handler := c.appHandler(func(w http.ResponseWriter, r *http.Request, app *appSession) {
+		_, _ = w.Write([]byte(app.Name))
+	})
+	request := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, Path+"/app", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	resp := request(reg.Token)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "chat", resp.Body.String())
+	resp = request(other.Token)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "other", resp.Body.String())
+	for _, token := range []string{
+		"",
+		"chat",
+		"chat.invalid",
+		"other." + reg.Token[len("chat."):],
+		"unknown." + reg.Token[len("chat."):],
+	} {
+		resp := request(token)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, token)
+		assert.Equal(t, "Bearer", resp.Header().Get("WWW-Authenticate"), token)
+	}
+
+	// Outbound policies are changed via the admin API.
+	router := netip.MustParseAddr("fd12:3456::a")
+	app, err := c.SetAppPolicy("other", AppPolicy{Routers: []netip.Addr{router}})
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{router}, app.Outbound.Routers)
+	assert.False(t, app.Outbound.Friends)
+	_, err = c.SetAppPolicy("unknown", AppPolicy{})
+	require.ErrorIs(t, err, ErrAppNotFound)
+
+	// Names in app namespaces are reserved.
+	assert.True(t, c.inAppNamespace("chat.lobby"))
+	assert.False(t, c.inAppNamespace("chat"))
+	assert.False(t, c.inAppNamespace("unknown.lobby"))
+}
+
+func TestDeleteApp(t *testing.T) {
+	t.Parallel()
+
+	c := newTestControl(t)
+	reg, err := c.RegisterApp("chat", nil)
+	require.NoError(t, err)
+
+	// Start a request that runs until it is canceled.
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	handler := c.appHandler(c.handleAppGroup(func(w http.ResponseWriter, r *http.Request) {
+		c.handleJoinGroup(w, r)
+		close(started)
+		<-r.Context().Done()
+	}))
+	go func() {
+		defer close(finished)
+		r := httptest.NewRequest(http.MethodPost, Path+"/app/groups/lobby/join", nil)
+		r.SetPathValue("group", "lobby")
+		r.Header.Set("Authorization", "Bearer "+reg.Token)
+		handler(httptest.NewRecorder(), r)
+	}()
+	<-started
+	assert.True(t, c.instance.Router().GroupPing.IsMember("chat.lobby"), "group must be in the app namespace")
+
+	// Add a stream listener of the app.
+	listener, err := c.instance.Router().Streams.Listen("chat.files", nil)
+	require.NoError(t, err)
+	c.streamListeners["chat.files"] = &apiListener{listener: listener, app: "chat"}
+
+	// Deleting the app stops everything of the app.
+	require.NoError(t, c.DeleteApp("chat"))
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("request of deleted app was not canceled")
+	}
+	assert.False(t, c.instance.Router().GroupPing.IsMember("chat.lobby"))
+	assert.True(t, listener.Closed())
+	assert.Empty(t, c.streamListeners)
+	require.ErrorIs(t, c.DeleteApp("chat"), ErrAppNotFound)
+}
@@ -0,0 +1,106 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// Blackhole drops all traffic to and from the routers in a prefix.
+type Blackhole struct {
+	Prefix netip.Prefix           `json:"prefix"`
+	Action router.BlackholeAction `json:"action,omitempty"`
+	Reason string                 `json:"reason,omitempty"`
+	// Duration defines how long the blackhole is active when adding it, eg.
+	// "1h". Empty means that the blackhole does not expire.
+	Duration string    `json:"duration,omitempty"`
+	Created  time.Time `json:"created,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Dropped  uint64    `json:"dropped,omitempty"`
+}
+
+func (c *Control) handleListBlackholes(w http.ResponseWriter, r *http.Request) {
+	blackholes := c.instance.Router().GetBlackholes()
+	list := make([]Blackhole, 0, len(blackholes))
+	for _, blackhole := range blackholes {
+		list = append(list, makeBlackhole(blackhole))
+	}
+	respond(w, list)
+}
+
+func (c *Control) handleAddBlackhole(w http.ResponseWriter, r *http.Request) {
+	// Parse request.
+	var req Blackhole
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil {
+			http.Error(w, "invalid duration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Add blackhole.
+	blackhole, err := c.instance.Router().AddBlackhole(req.Prefix, req.Action, req.Reason, duration)
+	switch {
+	case errors.Is(err, router.ErrInvalidBlackhole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respond(w, makeBlackhole(*blackhole))
+}
+
+func (c *Control) handleRemoveBlackhole(w http.ResponseWriter, r *http.Request) {
+	prefix, err := ParseBlackholePrefix(r.PathValue("prefix"))
+	if err != nil {
+		http.Error(w, "invalid prefix: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.instance.Router().RemoveBlackhole(prefix)
+	switch {
+	case errors.Is(err, router.ErrBlackholeNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ParseBlackholePrefix parses a prefix or a single IP for a blackhole.
+func ParseBlackholePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(ip, ip.BitLen()), nil
+	}
+	return netip.ParsePrefix(s)
+}
+
+func makeBlackhole(blackhole router.Blackhole) Blackhole {
+	return Blackhole{
+		Prefix:  blackhole.Prefix,
+		Action:  blackhole.Action,
+		Reason:  blackhole.Reason,
+		Created: blackhole.Created,
+		Expires: blackhole.Expires,
+		Dropped: blackhole.Dropped,
+	}
+}
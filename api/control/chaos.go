@@ -0,0 +1,134 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/peering"
+)
+
+// LinkChaos is the fault injection on the link to a peer.
+// Fault injection is only available in development mode.
+type LinkChaos struct {
+	Peer netip.Addr `json:"peer"`
+	// Loss, Duplicate and Reorder are probabilities from 0 to 1.
+	Loss      float64 `json:"loss,omitempty"`
+	Duplicate float64 `json:"duplicate,omitempty"`
+	Reorder   float64 `json:"reorder,omitempty"`
+	// Latency is added to every frame, eg. "50ms".
+	Latency string `json:"latency,omitempty"`
+	// Jitter is a random additional latency of up to the given duration.
+	Jitter string `json:"jitter,omitempty"`
+}
+
+func (c *Control) handleListChaos(w http.ResponseWriter, r *http.Request) {
+	if !c.instance.Config().DevMode() {
+		http.Error(w, peering.ErrChaosRequiresDevMode.Error(), http.StatusNotFound)
+		return
+	}
+
+	chaos := c.instance.Peering().ExportLinkChaos()
+	list := make([]LinkChaos, 0, len(chaos))
+	for _, lc := range chaos {
+		list = append(list, makeLinkChaos(lc))
+	}
+	respond(w, list)
+}
+
+func (c *Control) handleSetChaos(w http.ResponseWriter, r *http.Request) {
+	if !c.instance.Config().DevMode() {
+		http.Error(w, peering.ErrChaosRequiresDevMode.Error(), http.StatusNotFound)
+		return
+	}
+	peer, err := netip.ParseAddr(r.PathValue("peer"))
+	if err != nil {
+		http.Error(w, "invalid peer: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parse request.
+	var req LinkChaos
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg := peering.ChaosConfig{
+		Loss:      req.Loss,
+		Duplicate: req.Duplicate,
+		Reorder:   req.Reorder,
+	}
+	if req.Latency != "" {
+		cfg.Latency, err = time.ParseDuration(req.Latency)
+		if err != nil {
+			http.Error(w, "invalid latency: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Jitter != "" {
+		cfg.Jitter, err = time.ParseDuration(req.Jitter)
+		if err != nil {
+			http.Error(w, "invalid jitter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := cfg.Check(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Enable fault injection.
+	err = c.instance.Peering().SetLinkChaos(peer, cfg)
+	if err != nil {
+		respondChaosError(w, err)
+		return
+	}
+	respond(w, makeLinkChaos(peering.LinkChaos{Peer: peer, Config: cfg}))
+}
+
+func (c *Control) handleClearChaos(w http.ResponseWriter, r *http.Request) {
+	if !c.instance.Config().DevMode() {
+		http.Error(w, peering.ErrChaosRequiresDevMode.Error(), http.StatusNotFound)
+		return
+	}
+	peer, err := netip.ParseAddr(r.PathValue("peer"))
+	if err != nil {
+		http.Error(w, "invalid peer: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.instance.Peering().ClearLinkChaos(peer)
+	if err != nil {
+		respondChaosError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondChaosError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, peering.ErrLinkNotFound),
+		errors.Is(err, peering.ErrChaosRequiresDevMode):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func makeLinkChaos(lc peering.LinkChaos) LinkChaos {
+	chaos := LinkChaos{
+		Peer:      lc.Peer,
+		Loss:      lc.Config.Loss,
+		Duplicate: lc.Config.Duplicate,
+		Reorder:   lc.Config.Reorder,
+	}
+	if lc.Config.Latency > 0 {
+		chaos.Latency = lc.Config.Latency.String()
+	}
+	if lc.Config.Jitter > 0 {
+		chaos.Jitter = lc.Config.Jitter.String()
+	}
+	return chaos
+}
@@ -0,0 +1,66 @@
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaos(t *testing.T) {
+	t.Parallel()
+
+	c := newTestControl(t)
+	listChaos := func() *httptest.ResponseRecorder {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		c.handleListChaos(w, httptest.NewRequest(http.MethodGet, Path+"/chaos", nil))
+		return w
+	}
+	setChaos := func(peer, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodPut, Path+"/chaos/"+peer, strings.NewReader(body))
+		r.SetPathValue("peer", peer)
+		w := httptest.NewRecorder()
+		c.handleSetChaos(w, r)
+		return w
+	}
+	clearChaos := func(peer string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodDelete, Path+"/chaos/"+peer, nil)
+		r.SetPathValue("peer", peer)
+		w := httptest.NewRecorder()
+		c.handleClearChaos(w, r)
+		return w
+	}
+
+	// Only available in development mode.
+	assert.Equal(t, http.StatusNotFound, listChaos().Code)
+	assert.Equal(t, http.StatusNotFound, setChaos("fd12:3456::1", `{"loss":0.1}`).Code)
+	assert.Equal(t, http.StatusNotFound, clearChaos("fd12:3456::1").Code)
+	c.instance.Config().SetDevMode(true)
+
+	w := listChaos()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var chaos []LinkChaos
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &chaos))
+	assert.Empty(t, chaos)
+
+	// Invalid requests.
+	assert.Equal(t, http.StatusBadRequest, setChaos("invalid", `{"loss":0.1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, setChaos("fd12:3456::1", `{"loss":`).Code)
+	assert.Equal(t, http.StatusBadRequest, setChaos("fd12:3456::1", `{"loss":10}`).Code)
+	assert.Equal(t, http.StatusBadRequest, setChaos("fd12:3456::1", `{"latency":"fast"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, setChaos("fd12:3456::1", `{"jitter":"1h"}`).Code)
+
+	// Unknown links.
+	assert.Equal(t, http.StatusNotFound, setChaos("fd12:3456::1", `{"loss":0.1,"latency":"50ms"}`).Code)
+	assert.Equal(t, http.StatusNotFound, clearChaos("fd12:3456::1").Code)
+}
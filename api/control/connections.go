@@ -0,0 +1,123 @@
+package control
+
+import (
+	"cmp"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// defaultConnectionsMaxAge defines how long inactive connections are listed
+// by default.
+const defaultConnectionsMaxAge = 1 * time.Hour
+
+// Connection is a tracked connection.
+type Connection struct {
+	LocalIP    netip.Addr `json:"localIP"`
+	RemoteIP   netip.Addr `json:"remoteIP"`
+	Protocol   uint8      `json:"protocol"`
+	LocalPort  uint16     `json:"localPort,omitempty"`
+	RemotePort uint16     `json:"remotePort,omitempty"`
+
+	Inbound   bool      `json:"inbound,omitempty"`
+	Status    string    `json:"status"`
+	TCPState  string    `json:"tcpState,omitempty"`
+	Active    bool      `json:"active,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+
+	DataIn  uint64 `json:"dataIn"`
+	DataOut uint64 `json:"dataOut"`
+}
+
+// Connections is the list of tracked connections.
+type Connections struct {
+	Time        time.Time    `json:"time"`
+	Connections []Connection `json:"connections"`
+	ListInfo
+}
+
+// connectionSorting holds the sort keys of connections.
+var connectionSorting = map[string]func(a, b Connection) int{
+	"remote":    func(a, b Connection) int { return a.RemoteIP.Compare(b.RemoteIP) },
+	"firstSeen": func(a, b Connection) int { return a.FirstSeen.Compare(b.FirstSeen) },
+	"lastSeen":  func(a, b Connection) int { return a.LastSeen.Compare(b.LastSeen) },
+	"dataIn":    func(a, b Connection) int { return cmp.Compare(a.DataIn, b.DataIn) },
+	"dataOut":   func(a, b Connection) int { return cmp.Compare(a.DataOut, b.DataOut) },
+}
+
+func (c *Control) handleConnections(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r, []string{filterRemote, filterPrefix, filterStatus, filterSince}, connectionSorting)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only export connections that can match.
+	now := time.Now()
+	maxAge := defaultConnectionsMaxAge
+	if !q.since.IsZero() {
+		maxAge = now.Sub(q.since)
+	}
+
+	respond(w, makeConnections(c.instance.Router().ExportConnections(maxAge), q, now))
+}
+
+// makeConnections returns the connections matching the query.
+// The remote and prefix filters match the remote IP. The status filter
+// matches the connection status, "active" or "inactive", "inbound" or
+// "outbound" and the TCP state. The since filter matches the last activity.
+// Connections are sorted by last activity, newest first, by default.
+func makeConnections(conns []router.ExportedConnection, q *listQuery, now time.Time) *Connections {
+	list := make([]Connection, 0, len(conns))
+	for _, conn := range conns {
+		if !q.matchAddr(conn.RemoteIP) || !q.matchSince(conn.LastSeen) {
+			continue
+		}
+		connection := Connection{
+			LocalIP:    conn.LocalIP,
+			RemoteIP:   conn.RemoteIP,
+			Protocol:   conn.Protocol,
+			LocalPort:  conn.LocalPort,
+			RemotePort: conn.RemotePort,
+			Inbound:    conn.Inbound,
+			Status:     conn.StatusName,
+			TCPState:   conn.TCPState,
+			Active:     conn.Active,
+			FirstSeen:  conn.FirstSeen,
+			LastSeen:   conn.LastSeen,
+			DataIn:     conn.DataIn,
+			DataOut:    conn.DataOut,
+		}
+		if !q.matchStatus(connection.statuses()...) {
+			continue
+		}
+		list = append(list, connection)
+	}
+
+	connections := &Connections{Time: now}
+	connections.Connections, connections.ListInfo = paginate(q, list, connectionSorting)
+	return connections
+}
+
+// statuses returns the statuses the connection can be filtered by.
+func (conn Connection) statuses() []string {
+	statuses := make([]string, 0, 4)
+	statuses = append(statuses, conn.Status)
+	if conn.Active {
+		statuses = append(statuses, "active")
+	} else {
+		statuses = append(statuses, "inactive")
+	}
+	if conn.Inbound {
+		statuses = append(statuses, "inbound")
+	} else {
+		statuses = append(statuses, "outbound")
+	}
+	if conn.TCPState != "" {
+		statuses = append(statuses, conn.TCPState)
+	}
+	return statuses
+}
@@ -0,0 +1,228 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/api/dns"
+	"github.com/mycoria/mycoria/api/httpapi"
+	"github.com/mycoria/mycoria/api/netstack"
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/ha"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/router"
+	"github.com/mycoria/mycoria/storage"
+	"github.com/mycoria/mycoria/updater"
+)
+
+// Path is the base path of the control API.
+const Path = "/control/v1"
+
+const (
+	defaultWatchInterval  = 5 * time.Second
+	minWatchInterval      = 1 * time.Second
+	tableWatchInterval    = 1 * time.Second
+	pinWriteTimeout       = 10 * time.Second
+	mtuProbeWriteTimeout  = 15 * time.Second
+	pathProbeWriteTimeout = 20 * time.Second
+	updateWriteTimeout    = 11 * time.Minute
+	transferTimeout       = 5 * time.Minute
+)
+
+// Control is a programmatic control API that is served alongside the dashboard.
+// All responses are JSON. Watch endpoints stream newline delimited JSON.
+// Status, event and table watches are also served as a Connect and gRPC
+// service, which is defined in controlpb/control.proto.
+type Control struct {
+	instance instance
+	mgr      *mgr.Manager
+
+	streamListeners     map[string]*apiListener
+	streamListenersLock sync.Mutex
+
+	appsLock  sync.Mutex
+	appCtxs   map[string]appCtx
+	appEvents *mgr.EventMgr[*AppEvent]
+}
+
+// instance is an interface subset of inst.Ance.
+type instance interface {
+	Version() string
+	Config() *config.Config
+	Identity() *m.Address
+	API() *httpapi.API
+	Router() *router.Router
+	Peering() *peering.Peering
+	Storage() storage.Storage
+	DNS() *dns.Server
+	NetStack() *netstack.NetStack
+	HA() *ha.HA
+	Watchdog() *mgr.Watchdog
+	Updater() *updater.Updater
+}
+
+// New adds a control API to the given instance.
+func New(instance instance) (*Control, error) {
+	c := &Control{
+		instance:        instance,
+		streamListeners: make(map[string]*apiListener),
+		appCtxs:         make(map[string]appCtx),
+		appEvents:       newAppEventMgr(),
+	}
+	c.registerRoutes()
+
+	return c, nil
+}
+
+// Start starts the control API.
+func (c *Control) Start(mgr *mgr.Manager) error {
+	c.mgr = mgr
+	c.appEvents.SetManager(mgr)
+	return nil
+}
+
+// Stop stops the control API.
+func (c *Control) Stop(mgr *mgr.Manager) error {
+	c.closeStreamListeners()
+	return nil
+}
+
+func (c *Control) registerRoutes() {
+	api := c.instance.API()
+
+	api.HandleStatusFunc("GET "+Path+"/status", c.handleStatus)
+	api.HandleStatusFunc("GET "+Path+"/peers", c.handlePeers)
+	api.HandleFunc("GET "+Path+"/events", c.handleEvents)
+	api.HandleFunc("GET "+Path+"/connections", c.handleConnections)
+	api.HandleStatusFunc("GET "+Path+"/table", c.handleTable)
+	api.HandleFunc("GET "+Path+"/table/snapshot", c.handleTableSnapshot)
+	api.HandleFunc("GET "+Path+"/loops", c.handleLoops)
+	api.HandleFunc("GET "+Path+"/decisions", c.handleRoutingDecisions)
+	api.HandleFunc("GET "+Path+"/mtu", c.handlePathMTUs)
+	api.HandleFunc("POST "+Path+"/mtu/{dst}/probe", c.handleProbePathMTU)
+	api.HandleFunc("POST "+Path+"/probe/{dst}", c.handleProbePaths)
+	api.HandleFunc("GET "+Path+"/resources", c.handleResources)
+	api.HandleFunc("GET "+Path+"/stats/frames", c.handleFrameStats)
+	api.HandleFunc("GET "+Path+"/update", c.handleUpdateStatus)
+	api.HandleFunc("POST "+Path+"/update/check", c.handleUpdateCheck)
+	api.HandleFunc("POST "+Path+"/update/install", c.handleUpdateInstall)
+	api.HandleFunc("GET "+Path+"/markers", c.handleMarkerTable)
+	api.HandleFunc("GET "+Path+"/services/usage", c.handleServiceUsage)
+	api.HandleFunc("GET "+Path+"/services/denied", c.handleDeniedAttempts)
+	api.HandleFunc("POST "+Path+"/policy/check", c.handlePolicyCheck)
+	api.HandleFunc("GET "+Path+"/access/requests", c.handleListAccessRequests)
+	api.HandleFunc("POST "+Path+"/access/requests/{router}/{service}/approve", c.handleApproveAccessRequest)
+	api.HandleFunc("POST "+Path+"/access/requests/{router}/{service}/dismiss", c.handleDismissAccessRequest)
+	api.HandleFunc("GET "+Path+"/prompts", c.handleListPrompts)
+	api.HandleFunc("POST "+Path+"/prompts/{router}/allow", c.handleAllowPrompt)
+	api.HandleFunc("POST "+Path+"/prompts/{router}/deny", c.handleDenyPrompt)
+	api.HandleFunc("GET "+Path+"/transfers", c.handleListTransfers)
+	api.HandleFunc("POST "+Path+"/transfers", c.handleOfferTransfer)
+	api.HandleFunc("POST "+Path+"/transfers/{id}/accept", c.handleAcceptTransfer)
+	api.HandleFunc("POST "+Path+"/transfers/{id}/decline", c.handleDeclineTransfer)
+	api.HandleFunc("GET "+Path+"/transfers/{id}/data", c.handleTakeTransferData)
+	api.HandleFunc("GET "+Path+"/groups", c.handleListGroups)
+	api.HandleFunc("POST "+Path+"/groups/{group}/join", c.handleJoinGroup)
+	api.HandleFunc("POST "+Path+"/groups/{group}/leave", c.handleLeaveGroup)
+	api.HandleFunc("POST "+Path+"/groups/{group}/publish", c.handlePublishToGroup)
+	api.HandleFunc("GET "+Path+"/groups/{group}/messages", c.handleWatchGroup)
+	api.HandleFunc("GET "+Path+"/streams/connect/{router}/{service}", c.handleConnectStream)
+	api.HandleFunc("GET "+Path+"/streams/accept/{service}", c.handleAcceptStream)
+	api.HandleFunc("GET "+Path+"/pins", c.handleListPins)
+	api.HandleFunc("POST "+Path+"/pins", c.handlePin)
+	api.HandleFunc("DELETE "+Path+"/pins/{dst}", c.handleUnpin)
+	api.HandleFunc("GET "+Path+"/blackholes", c.handleListBlackholes)
+	api.HandleFunc("POST "+Path+"/blackholes", c.handleAddBlackhole)
+	api.HandleFunc("DELETE "+Path+"/blackholes/{prefix...}", c.handleRemoveBlackhole)
+	api.HandleFunc("GET "+Path+"/friends", c.handleListFriends)
+	api.HandleFunc("POST "+Path+"/friends", c.handleAddFriend)
+	api.HandleFunc("DELETE "+Path+"/friends/{name}", c.handleRemoveFriend)
+	api.HandleFunc("GET "+Path+"/links/history", c.handleLinkHistory)
+	api.HandleFunc("GET "+Path+"/chaos", c.handleListChaos)
+	api.HandleFunc("PUT "+Path+"/chaos/{peer}", c.handleSetChaos)
+	api.HandleFunc("DELETE "+Path+"/chaos/{peer}", c.handleClearChaos)
+	api.HandleFunc("GET "+Path+"/routers/{ip}", c.handleRouter)
+	api.HandleFunc("GET "+Path+"/mappings", c.handleListMappings)
+	api.HandleFunc("POST "+Path+"/mappings", c.handleSetMapping)
+	api.HandleFunc("POST "+Path+"/mappings/import", c.handleImportMappings)
+	api.HandleFunc("POST "+Path+"/mappings/{domain}/approve", c.handleApproveMapping)
+	api.HandleFunc("POST "+Path+"/mappings/{domain}/rename", c.handleRenameMapping)
+	api.HandleFunc("DELETE "+Path+"/mappings/{domain}", c.handleDeleteMapping)
+	api.HandleFunc("GET "+Path+"/log/levels", c.handleLogLevels)
+	api.HandleFunc("PUT "+Path+"/log/levels/{module}", c.handleSetLogLevel)
+	api.HandleFunc("DELETE "+Path+"/log/levels/{module}", c.handleResetLogLevel)
+
+	c.registerAppRoutes()
+
+	// Control service, generated from controlpb/control.proto.
+	api.Handle(c.rpcHandler())
+}
+
+// ErrorCodeHeader holds the error code of a failed request, if the error has
+// one. See m.ErrorCode for the codes.
+const ErrorCodeHeader = "Mycoria-Error-Code"
+
+// httpError replies with the error message and the error code, if the error
+// has one.
+func httpError(w http.ResponseWriter, err error, status int) {
+	if code := m.ErrorCodeOf(err); code != "" {
+		w.Header().Set(ErrorCodeHeader, string(code))
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// stream prepares the response for streaming newline delimited JSON and
+// returns a function to write a message.
+func stream(w http.ResponseWriter) (send func(msg any) error, err error) {
+	// Disable write timeout of the http server.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("disable write deadline: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	return func(msg any) error {
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}, nil
+}
+
+// respond writes the given message as JSON.
+func respond(w http.ResponseWriter, msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal response: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(data)
+}
+
+// parseWatch returns whether the request asks to watch and the interval.
+func parseWatch(r *http.Request) (watch bool, interval time.Duration, err error) {
+	switch value := r.URL.Query().Get("watch"); value {
+	case "", "false":
+		return false, 0, nil
+	case "true":
+		return true, defaultWatchInterval, nil
+	default:
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return false, 0, fmt.Errorf("invalid watch interval: %w", err)
+		}
+		return true, max(interval, minWatchInterval), nil
+	}
+}
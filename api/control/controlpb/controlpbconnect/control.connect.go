@@ -0,0 +1,204 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: api/control/controlpb/control.proto
+
+package controlpbconnect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	controlpb "github.com/mycoria/mycoria/api/control/controlpb"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// ControlServiceName is the fully-qualified name of the ControlService service.
+	ControlServiceName = "mycoria.control.v1.ControlService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// ControlServiceGetStatusProcedure is the fully-qualified name of the ControlService's GetStatus
+	// RPC.
+	ControlServiceGetStatusProcedure = "/mycoria.control.v1.ControlService/GetStatus"
+	// ControlServiceWatchStatusProcedure is the fully-qualified name of the ControlService's
+	// WatchStatus RPC.
+	ControlServiceWatchStatusProcedure = "/mycoria.control.v1.ControlService/WatchStatus"
+	// ControlServiceWatchEventsProcedure is the fully-qualified name of the ControlService's
+	// WatchEvents RPC.
+	ControlServiceWatchEventsProcedure = "/mycoria.control.v1.ControlService/WatchEvents"
+	// ControlServiceWatchTableProcedure is the fully-qualified name of the ControlService's WatchTable
+	// RPC.
+	ControlServiceWatchTableProcedure = "/mycoria.control.v1.ControlService/WatchTable"
+)
+
+// ControlServiceClient is a client for the mycoria.control.v1.ControlService service.
+type ControlServiceClient interface {
+	// GetStatus returns the current status of the router.
+	GetStatus(context.Context, *connect.Request[controlpb.GetStatusRequest]) (*connect.Response[controlpb.Status], error)
+	// WatchStatus streams the status of the router in an interval.
+	WatchStatus(context.Context, *connect.Request[controlpb.WatchStatusRequest]) (*connect.ServerStreamForClient[controlpb.Status], error)
+	// WatchEvents streams router events until the client disconnects.
+	WatchEvents(context.Context, *connect.Request[controlpb.WatchEventsRequest]) (*connect.ServerStreamForClient[controlpb.Event], error)
+	// WatchTable streams the routing table whenever it changes.
+	WatchTable(context.Context, *connect.Request[controlpb.WatchTableRequest]) (*connect.ServerStreamForClient[controlpb.Table], error)
+}
+
+// NewControlServiceClient constructs a client for the mycoria.control.v1.ControlService service. By
+// default, it uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses,
+// and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the
+// connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewControlServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) ControlServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	controlServiceMethods := controlpb.File_api_control_controlpb_control_proto.Services().ByName("ControlService").Methods()
+	return &controlServiceClient{
+		getStatus: connect.NewClient[controlpb.GetStatusRequest, controlpb.Status](
+			httpClient,
+			baseURL+ControlServiceGetStatusProcedure,
+			connect.WithSchema(controlServiceMethods.ByName("GetStatus")),
+			connect.WithClientOptions(opts...),
+		),
+		watchStatus: connect.NewClient[controlpb.WatchStatusRequest, controlpb.Status](
+			httpClient,
+			baseURL+ControlServiceWatchStatusProcedure,
+			connect.WithSchema(controlServiceMethods.ByName("WatchStatus")),
+			connect.WithClientOptions(opts...),
+		),
+		watchEvents: connect.NewClient[controlpb.WatchEventsRequest, controlpb.Event](
+			httpClient,
+			baseURL+ControlServiceWatchEventsProcedure,
+			connect.WithSchema(controlServiceMethods.ByName("WatchEvents")),
+			connect.WithClientOptions(opts...),
+		),
+		watchTable: connect.NewClient[controlpb.WatchTableRequest, controlpb.Table](
+			httpClient,
+			baseURL+ControlServiceWatchTableProcedure,
+			connect.WithSchema(controlServiceMethods.ByName("WatchTable")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// controlServiceClient implements ControlServiceClient.
+type controlServiceClient struct {
+	getStatus   *connect.Client[controlpb.GetStatusRequest, controlpb.Status]
+	watchStatus *connect.Client[controlpb.WatchStatusRequest, controlpb.Status]
+	watchEvents *connect.Client[controlpb.WatchEventsRequest, controlpb.Event]
+	watchTable  *connect.Client[controlpb.WatchTableRequest, controlpb.Table]
+}
+
+// GetStatus calls mycoria.control.v1.ControlService.GetStatus.
+func (c *controlServiceClient) GetStatus(ctx context.Context, req *connect.Request[controlpb.GetStatusRequest]) (*connect.Response[controlpb.Status], error) {
+	return c.getStatus.CallUnary(ctx, req)
+}
+
+// WatchStatus calls mycoria.control.v1.ControlService.WatchStatus.
+func (c *controlServiceClient) WatchStatus(ctx context.Context, req *connect.Request[controlpb.WatchStatusRequest]) (*connect.ServerStreamForClient[controlpb.Status], error) {
+	return c.watchStatus.CallServerStream(ctx, req)
+}
+
+// WatchEvents calls mycoria.control.v1.ControlService.WatchEvents.
+func (c *controlServiceClient) WatchEvents(ctx context.Context, req *connect.Request[controlpb.WatchEventsRequest]) (*connect.ServerStreamForClient[controlpb.Event], error) {
+	return c.watchEvents.CallServerStream(ctx, req)
+}
+
+// WatchTable calls mycoria.control.v1.ControlService.WatchTable.
+func (c *controlServiceClient) WatchTable(ctx context.Context, req *connect.Request[controlpb.WatchTableRequest]) (*connect.ServerStreamForClient[controlpb.Table], error) {
+	return c.watchTable.CallServerStream(ctx, req)
+}
+
+// ControlServiceHandler is an implementation of the mycoria.control.v1.ControlService service.
+type ControlServiceHandler interface {
+	// GetStatus returns the current status of the router.
+	GetStatus(context.Context, *connect.Request[controlpb.GetStatusRequest]) (*connect.Response[controlpb.Status], error)
+	// WatchStatus streams the status of the router in an interval.
+	WatchStatus(context.Context, *connect.Request[controlpb.WatchStatusRequest], *connect.ServerStream[controlpb.Status]) error
+	// WatchEvents streams router events until the client disconnects.
+	WatchEvents(context.Context, *connect.Request[controlpb.WatchEventsRequest], *connect.ServerStream[controlpb.Event]) error
+	// WatchTable streams the routing table whenever it changes.
+	WatchTable(context.Context, *connect.Request[controlpb.WatchTableRequest], *connect.ServerStream[controlpb.Table]) error
+}
+
+// NewControlServiceHandler builds an HTTP handler from the service implementation. It returns the
+// path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewControlServiceHandler(svc ControlServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	controlServiceMethods := controlpb.File_api_control_controlpb_control_proto.Services().ByName("ControlService").Methods()
+	controlServiceGetStatusHandler := connect.NewUnaryHandler(
+		ControlServiceGetStatusProcedure,
+		svc.GetStatus,
+		connect.WithSchema(controlServiceMethods.ByName("GetStatus")),
+		connect.WithHandlerOptions(opts...),
+	)
+	controlServiceWatchStatusHandler := connect.NewServerStreamHandler(
+		ControlServiceWatchStatusProcedure,
+		svc.WatchStatus,
+		connect.WithSchema(controlServiceMethods.ByName("WatchStatus")),
+		connect.WithHandlerOptions(opts...),
+	)
+	controlServiceWatchEventsHandler := connect.NewServerStreamHandler(
+		ControlServiceWatchEventsProcedure,
+		svc.WatchEvents,
+		connect.WithSchema(controlServiceMethods.ByName("WatchEvents")),
+		connect.WithHandlerOptions(opts...),
+	)
+	controlServiceWatchTableHandler := connect.NewServerStreamHandler(
+		ControlServiceWatchTableProcedure,
+		svc.WatchTable,
+		connect.WithSchema(controlServiceMethods.ByName("WatchTable")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/mycoria.control.v1.ControlService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ControlServiceGetStatusProcedure:
+			controlServiceGetStatusHandler.ServeHTTP(w, r)
+		case ControlServiceWatchStatusProcedure:
+			controlServiceWatchStatusHandler.ServeHTTP(w, r)
+		case ControlServiceWatchEventsProcedure:
+			controlServiceWatchEventsHandler.ServeHTTP(w, r)
+		case ControlServiceWatchTableProcedure:
+			controlServiceWatchTableHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedControlServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedControlServiceHandler struct{}
+
+func (UnimplementedControlServiceHandler) GetStatus(context.Context, *connect.Request[controlpb.GetStatusRequest]) (*connect.Response[controlpb.Status], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("mycoria.control.v1.ControlService.GetStatus is not implemented"))
+}
+
+func (UnimplementedControlServiceHandler) WatchStatus(context.Context, *connect.Request[controlpb.WatchStatusRequest], *connect.ServerStream[controlpb.Status]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("mycoria.control.v1.ControlService.WatchStatus is not implemented"))
+}
+
+func (UnimplementedControlServiceHandler) WatchEvents(context.Context, *connect.Request[controlpb.WatchEventsRequest], *connect.ServerStream[controlpb.Event]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("mycoria.control.v1.ControlService.WatchEvents is not implemented"))
+}
+
+func (UnimplementedControlServiceHandler) WatchTable(context.Context, *connect.Request[controlpb.WatchTableRequest], *connect.ServerStream[controlpb.Table]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("mycoria.control.v1.ControlService.WatchTable is not implemented"))
+}
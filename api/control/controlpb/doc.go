@@ -0,0 +1,5 @@
+// Package controlpb holds the protobuf messages of the control service.
+// The service handler and client are in controlpbconnect.
+package controlpb
+
+//go:generate protoc --proto_path=../../.. --go_out=../../.. --go_opt=paths=source_relative --connect-go_out=../../.. --connect-go_opt=paths=source_relative api/control/controlpb/control.proto
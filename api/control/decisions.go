@@ -0,0 +1,62 @@
+package control
+
+import (
+	"cmp"
+	"net/http"
+	"time"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// RoutingDecisions holds sampled routing decisions.
+type RoutingDecisions struct {
+	Time time.Time `json:"time"`
+	// Sampling is the N of one in N routed frames that are recorded.
+	// Zero means disabled.
+	Sampling  int                      `json:"sampling"`
+	Decisions []router.RoutingDecision `json:"decisions"`
+	ListInfo
+}
+
+// decisionSorting holds the sort keys of routing decisions.
+var decisionSorting = map[string]func(a, b router.RoutingDecision) int{
+	"time":  func(a, b router.RoutingDecision) int { return a.Time.Compare(b.Time) },
+	"dst":   func(a, b router.RoutingDecision) int { return a.Dst.Compare(b.Dst) },
+	"hops":  func(a, b router.RoutingDecision) int { return cmp.Compare(a.Hops, b.Hops) },
+	"delay": func(a, b router.RoutingDecision) int { return cmp.Compare(a.Delay, b.Delay) },
+}
+
+func (c *Control) handleRoutingDecisions(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r, []string{filterRemote, filterPrefix, filterStatus, filterSince}, decisionSorting)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	decisions := makeRoutingDecisions(c.instance.Router().RoutingDecisions(), q)
+	decisions.Sampling = c.instance.Config().RoutingDecisionSampling
+	respond(w, decisions)
+}
+
+// makeRoutingDecisions returns the routing decisions matching the query.
+// The remote and prefix filters match the source, destination, previous and
+// next hop. The status filter matches the reason and "error".
+func makeRoutingDecisions(all []router.RoutingDecision, q *listQuery) *RoutingDecisions {
+	matching := make([]router.RoutingDecision, 0, len(all))
+	for _, decision := range all {
+		statuses := []string{string(decision.Reason)}
+		if decision.Err != "" {
+			statuses = append(statuses, "error")
+		}
+		if !q.matchAddr(decision.Src, decision.Dst, decision.From, decision.NextHop) ||
+			!q.matchStatus(statuses...) ||
+			!q.matchSince(decision.Time) {
+			continue
+		}
+		matching = append(matching, decision)
+	}
+
+	decisions := &RoutingDecisions{Time: time.Now()}
+	decisions.Decisions, decisions.ListInfo = paginate(q, matching, decisionSorting)
+	return decisions
+}
@@ -0,0 +1,48 @@
+package control
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+)
+
+const (
+	defaultTopTalkers = 20
+	maxTopTalkers     = 1000
+)
+
+// FrameStats holds the traffic statistics of frames received from other
+// routers, per message type and per remote router.
+type FrameStats struct {
+	Time  time.Time `json:"time"`
+	Since time.Time `json:"since"`
+
+	Types      []frame.TypeStats   `json:"types"`
+	TopTalkers []frame.TalkerStats `json:"topTalkers"`
+	// Untracked counts frames of remote routers that were not tracked, as
+	// the tracking limit was reached.
+	Untracked uint64 `json:"untracked,omitempty"`
+}
+
+func (c *Control) handleFrameStats(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTopTalkers
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxTopTalkers {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats := c.instance.Router().FrameStats()
+	respond(w, &FrameStats{
+		Time:       time.Now(),
+		Since:      stats.Since(),
+		Types:      stats.Types(),
+		TopTalkers: stats.TopTalkers(limit),
+		Untracked:  stats.Untracked(),
+	})
+}
@@ -0,0 +1,104 @@
+package control
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+// Friend is a router that is resolvable at <name>.myco and may access
+// services shared with friends.
+type Friend struct {
+	Name string     `json:"name"`
+	IP   netip.Addr `json:"ip"`
+	// Key optionally pins the hex encoded public key of the friend.
+	Key string `json:"key,omitempty"`
+}
+
+func (c *Control) handleListFriends(w http.ResponseWriter, r *http.Request) {
+	friends := c.instance.Config().GetFriends()
+	list := make([]Friend, 0, len(friends))
+	for _, friend := range friends {
+		list = append(list, makeFriend(friend))
+	}
+	respond(w, list)
+}
+
+func (c *Control) handleAddFriend(w http.ResponseWriter, r *http.Request) {
+	// Parse request.
+	var req Friend
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	friend := config.Friend{
+		Name: req.Name,
+		IP:   req.IP,
+	}
+	if req.Key != "" {
+		var err error
+		friend.Address, err = config.ParseFriendKey(req.IP, req.Key)
+		if err != nil {
+			http.Error(w, "invalid key: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Add friend.
+	err := c.instance.Router().AddFriend(friend)
+	switch {
+	case errors.Is(err, config.ErrFriendExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !c.saveConfig(w) {
+		return
+	}
+	respond(w, makeFriend(friend))
+}
+
+func (c *Control) handleRemoveFriend(w http.ResponseWriter, r *http.Request) {
+	err := c.instance.Router().RemoveFriend(r.PathValue("name"))
+	switch {
+	case errors.Is(err, config.ErrFriendNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !c.saveConfig(w) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveConfig persists changes of the running config to the config file, if
+// the config was loaded from a file. It reports the error and returns false
+// if saving failed.
+func (c *Control) saveConfig(w http.ResponseWriter) (ok bool) {
+	err := c.instance.Config().Save()
+	if err != nil && !errors.Is(err, config.ErrNoConfigFile) {
+		http.Error(w, "changed running config, but failed to save config: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func makeFriend(friend config.Friend) Friend {
+	f := Friend{
+		Name: friend.Name,
+		IP:   friend.IP,
+	}
+	if friend.Address != nil {
+		f.Key = hex.EncodeToString(friend.Address.PublicKey)
+	}
+	return f
+}
@@ -0,0 +1,71 @@
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFriends(t *testing.T) {
+	t.Parallel()
+
+	c := newTestControl(t)
+	list := func() []Friend {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		c.handleListFriends(w, httptest.NewRequest(http.MethodGet, Path+"/friends", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var friends []Friend
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &friends))
+		return friends
+	}
+	add := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		c.handleAddFriend(w, httptest.NewRequest(http.MethodPost, Path+"/friends", strings.NewReader(body)))
+		return w
+	}
+	remove := func(name string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodDelete, Path+"/friends/"+name, nil)
+		r.SetPathValue("name", name)
+		w := httptest.NewRecorder()
+		c.handleRemoveFriend(w, r)
+		return w
+	}
+	assert.Empty(t, list())
+
+	// Add friend.
+	w := add(`{"name":"nas","ip":"fd12:3456::f"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	nas := Friend{Name: "nas", IP: netip.MustParseAddr("fd12:3456::f")}
+	assert.Equal(t, []Friend{nas}, list())
+	friend, ok := c.instance.Config().GetFriendByName("nas")
+	require.True(t, ok, "friend must be added to the running config")
+	assert.Equal(t, nas.IP, friend.IP)
+
+	// Invalid and duplicate friends.
+	assert.Equal(t, http.StatusBadRequest, add(`{"name":"nas.myco","ip":"fd12:3456::e"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, add(`{"name":"phone","ip":"fd80::1"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, add(`{"name":"phone","ip":"fd12:3456::e","key":"invalid"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, add(`{"name":`).Code)
+	assert.Equal(t, http.StatusConflict, add(`{"name":"nas","ip":"fd12:3456::e"}`).Code)
+	assert.Equal(t, http.StatusConflict, add(`{"name":"phone","ip":"fd12:3456::f"}`).Code)
+	assert.Equal(t, []Friend{nas}, list())
+
+	// Remove friend.
+	assert.Equal(t, http.StatusNoContent, remove("nas").Code)
+	assert.Equal(t, http.StatusNotFound, remove("nas").Code)
+	assert.Empty(t, list())
+	_, ok = c.instance.Config().GetFriendByName("nas")
+	assert.False(t, ok, "friend must be removed from the running config")
+}
@@ -0,0 +1,126 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// Group is a group the router is a member of.
+type Group struct {
+	Name string `json:"name"`
+	// Configured is set if the group is joined in the config.
+	Configured bool `json:"configured,omitempty"`
+	// Members is the amount of known other members.
+	Members int `json:"members"`
+}
+
+// GroupPublishRequest publishes a message to a group.
+type GroupPublishRequest struct {
+	Data []byte `json:"data"`
+}
+
+// GroupPublishResult is the result of publishing a message to a group.
+type GroupPublishResult struct {
+	// Members is the amount of members the message was sent to.
+	Members int `json:"members"`
+}
+
+func (c *Control) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	groupPing := c.instance.Router().GroupPing
+	configured := c.instance.Config().Router.Groups
+
+	groups := []Group{}
+	for _, name := range groupPing.Groups() {
+		members, err := groupPing.Members(name)
+		if err != nil {
+			http.Error(w, "failed to get members: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		groups = append(groups, Group{
+			Name:       name,
+			Configured: slices.Contains(configured, name),
+			Members:    len(members),
+		})
+	}
+	respond(w, groups)
+}
+
+func (c *Control) handleJoinGroup(w http.ResponseWriter, r *http.Request) {
+	if err := c.instance.Router().GroupPing.Join(r.PathValue("group")); err != nil {
+		respondGroupError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Control) handleLeaveGroup(w http.ResponseWriter, r *http.Request) {
+	if err := c.instance.Router().GroupPing.Leave(r.PathValue("group")); err != nil {
+		respondGroupError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Control) handlePublishToGroup(w http.ResponseWriter, r *http.Request) {
+	var req GroupPublishRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	members, err := c.instance.Router().GroupPing.Publish(r.PathValue("group"), req.Data)
+	if err != nil {
+		respondGroupError(w, err)
+		return
+	}
+	respond(w, &GroupPublishResult{Members: members})
+}
+
+func (c *Control) handleWatchGroup(w http.ResponseWriter, r *http.Request) {
+	group := r.PathValue("group")
+	if !c.instance.Router().GroupPing.IsMember(group) {
+		http.Error(w, "not a member of the group", http.StatusNotFound)
+		return
+	}
+
+	// Subscribe to messages.
+	sub := c.instance.Router().GroupPing.Events.Subscribe("control api", 100)
+	defer sub.Cancel()
+
+	// Stream messages until the client disconnects.
+	send, err := stream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for {
+		select {
+		case msg := <-sub.Events():
+			if msg.Group != group {
+				continue
+			}
+			if err := send(msg); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func respondGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, router.ErrGroupInvalid),
+		errors.Is(err, router.ErrGroupTooBig):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, router.ErrGroupConfigured),
+		errors.Is(err, router.ErrGroupLimit):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		httpError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,602 @@
+package control
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mycoria/mycoria/api/netstack"
+	"github.com/mycoria/mycoria/ha"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/peering"
+)
+
+// Status is the current status of the router.
+type Status struct {
+	Version  string        `json:"version"`
+	Router   netip.Addr    `json:"router"`
+	Started  time.Time     `json:"started"`
+	Uptime   time.Duration `json:"uptime"`
+	Stub     bool          `json:"stub"`
+	Peers    []Peer        `json:"peers"`
+	Routes   int           `json:"routes"`
+	Friends  int           `json:"friends"`
+	DevMode  bool          `json:"devMode,omitempty"`
+	Universe string        `json:"universe,omitempty"`
+
+	// PeerFailures holds the failing connections to configured peers.
+	PeerFailures []peering.ConnectFailure `json:"peerFailures,omitempty"`
+
+	StatusText string `json:"statusText,omitempty"`
+	Contact    string `json:"contact,omitempty"`
+
+	// ClockSkew is the estimated offset of the local clock to the clocks of
+	// the peers. It is positive if the local clock is behind.
+	ClockSkew time.Duration `json:"clockSkew,omitempty"`
+
+	// NATIPv4 and NATIPv6 are the NAT types detected from the underlay
+	// addresses of this router, as seen by the peers.
+	NATIPv4 string `json:"natIPv4,omitempty"`
+	NATIPv6 string `json:"natIPv6,omitempty"`
+
+	// Crashes is the amount of recovered panics since start.
+	Crashes uint64 `json:"crashes,omitempty"`
+
+	// APIPackets holds the packet counters of the local API network stack.
+	APIPackets *netstack.InboundStats `json:"apiPackets,omitempty"`
+
+	// HA holds the high availability status, if configured.
+	HA *ha.Status `json:"ha,omitempty"`
+}
+
+// Peer is a connected peer.
+type Peer struct {
+	Router     netip.Addr    `json:"router"`
+	PeeringURL string        `json:"peeringURL,omitempty"`
+	Outgoing   bool          `json:"outgoing"`
+	Lite       bool          `json:"lite,omitempty"`
+	Uptime     time.Duration `json:"uptime"`
+	Latency    uint16        `json:"latency"` // In milliseconds.
+	BytesIn    uint64        `json:"bytesIn"`
+	BytesOut   uint64        `json:"bytesOut"`
+	ClockSkew  time.Duration `json:"clockSkew,omitempty"` // Positive if the peer is ahead.
+	// ObservedAddr is the underlay address of this router, as seen by the peer.
+	ObservedAddr string `json:"observedAddr,omitempty"`
+	// Capabilities are the protocol features the peer supports.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// GeoLocated is the country of the underlay address of the peer, if geo
+	// marker verification is enabled.
+	GeoLocated string `json:"geoLocated,omitempty"`
+	// GeoMismatch describes how far the geo marker is off from GeoLocated.
+	GeoMismatch string `json:"geoMismatch,omitempty"`
+	// GeoFlagged is set when the geo marker is off by a region or more.
+	GeoFlagged bool `json:"geoFlagged,omitempty"`
+}
+
+// Event is a router event.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	Router       netip.Addr  `json:"router"`
+	State        string      `json:"state,omitempty"`        // Peering events.
+	Ports        int         `json:"ports,omitempty"`        // Scan events.
+	BlockedUntil *time.Time  `json:"blockedUntil,omitempty"` // Scan events.
+	ReportedBy   *netip.Addr `json:"reportedBy,omitempty"`   // Scan events.
+
+	Module   string        `json:"module,omitempty"`   // Incident events.
+	Worker   string        `json:"worker,omitempty"`   // Incident events.
+	Stuck    time.Duration `json:"stuck,omitempty"`    // Incident events.
+	Recovery string        `json:"recovery,omitempty"` // Incident events.
+
+	Service  string `json:"service,omitempty"`  // Denied and inbound events.
+	Country  string `json:"country,omitempty"`  // Denied events.
+	Attempts int    `json:"attempts,omitempty"` // Denied events.
+	Routers  int    `json:"routers,omitempty"`  // Denied events.
+
+	Code m.ErrorCode `json:"code,omitempty"` // Error events.
+	Dst  *netip.Addr `json:"dst,omitempty"`  // Error events.
+
+	Port uint16 `json:"port,omitempty"` // Inbound events.
+}
+
+// Event types.
+const (
+	EventTypePeering  = "peering"
+	EventTypeScan     = "scan"
+	EventTypeIncident = "incident"
+	EventTypeDenied   = "denied"
+	EventTypeError    = "error"
+	EventTypeInbound  = "inbound"
+)
+
+// Route is a routing table entry.
+type Route struct {
+	Dst     netip.Addr `json:"dst"`
+	Prefix  string     `json:"prefix,omitempty"`
+	NextHop netip.Addr `json:"nextHop"`
+	Hops    uint8      `json:"hops"`
+	Delay   uint16     `json:"delay"` // In milliseconds.
+	Stub    bool       `json:"stub,omitempty"`
+	Source  string     `json:"source"`
+	Expires time.Time  `json:"expires"`
+	Learned time.Time  `json:"learned,omitempty"`
+	Age     int64      `json:"age"` // In seconds.
+
+	// Alternatives is the amount of other routes to the same destination.
+	Alternatives int `json:"alternatives,omitempty"`
+
+	// Implausible is set when the delays of the path are too low for the
+	// geo markers on the path.
+	Implausible bool `json:"implausible,omitempty"`
+}
+
+// Table is a snapshot of the routing table.
+type Table struct {
+	Time   time.Time `json:"time"`
+	Routes []Route   `json:"routes"`
+	ListInfo
+
+	// HoldDowns lists the routers whose routes are currently not re-learned
+	// from announcements older than their withdrawal.
+	HoldDowns []HoldDown `json:"holdDowns,omitempty"`
+}
+
+// HoldDown is a router that is held down after it was withdrawn.
+type HoldDown struct {
+	Router    netip.Addr `json:"router"`
+	Withdrawn time.Time  `json:"withdrawn"`
+	Until     time.Time  `json:"until"`
+}
+
+// routeSorting holds the sort keys of routes.
+var routeSorting = map[string]func(a, b Route) int{
+	"dst":     func(a, b Route) int { return a.Dst.Compare(b.Dst) },
+	"nextHop": func(a, b Route) int { return a.NextHop.Compare(b.NextHop) },
+	"hops":    func(a, b Route) int { return cmp.Compare(a.Hops, b.Hops) },
+	"delay":   func(a, b Route) int { return cmp.Compare(a.Delay, b.Delay) },
+	"expires": func(a, b Route) int { return a.Expires.Compare(b.Expires) },
+	"age":     func(a, b Route) int { return cmp.Compare(a.Age, b.Age) },
+}
+
+// Peers is the list of connected peers.
+type Peers struct {
+	Time  time.Time `json:"time"`
+	Peers []Peer    `json:"peers"`
+	ListInfo
+}
+
+// peerSorting holds the sort keys of peers.
+var peerSorting = map[string]func(a, b Peer) int{
+	"router":   func(a, b Peer) int { return a.Router.Compare(b.Router) },
+	"uptime":   func(a, b Peer) int { return cmp.Compare(a.Uptime, b.Uptime) },
+	"latency":  func(a, b Peer) int { return cmp.Compare(a.Latency, b.Latency) },
+	"bytesIn":  func(a, b Peer) int { return cmp.Compare(a.BytesIn, b.BytesIn) },
+	"bytesOut": func(a, b Peer) int { return cmp.Compare(a.BytesOut, b.BytesOut) },
+}
+
+func (c *Control) handleStatus(w http.ResponseWriter, r *http.Request) {
+	watch, interval, err := parseWatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !watch {
+		respond(w, c.getStatus())
+		return
+	}
+
+	// Stream status in interval.
+	send, err := stream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.watchStatus(r.Context(), interval, func(status *Status) error {
+		return send(status)
+	})
+}
+
+// watchStatus calls send with the status in the given interval, until the
+// context is canceled or send fails.
+func (c *Control) watchStatus(ctx context.Context, interval time.Duration, send func(*Status) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := send(c.getStatus()); err != nil {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Control) getStatus() *Status {
+	cfg := c.instance.Config()
+	status := &Status{
+		Version:  c.instance.Version(),
+		Router:   c.instance.Identity().IP,
+		Started:  cfg.Started(),
+		Uptime:   cfg.Uptime(),
+		Stub:     c.instance.Peering().IsStub(),
+		Routes:   c.instance.Router().Table().Size(),
+		Friends:  len(cfg.GetFriends()),
+		DevMode:  cfg.DevMode(),
+		Universe: cfg.Router.Universe,
+
+		StatusText: cfg.Router.Status,
+		Contact:    cfg.Router.Contact,
+	}
+	status.ClockSkew, _ = c.instance.Peering().ClockSkew()
+	status.Crashes = mgr.CrashCount()
+	natIPv4, natIPv6 := c.instance.Peering().NATTypes()
+	status.NATIPv4, status.NATIPv6 = string(natIPv4), string(natIPv6)
+	if ns := c.instance.NetStack(); ns != nil {
+		apiPackets := ns.InboundStats()
+		status.APIPackets = &apiPackets
+	}
+	if h := c.instance.HA(); h != nil {
+		haStatus := h.Status()
+		status.HA = &haStatus
+	}
+
+	// Add peers.
+	status.PeerFailures = c.instance.Peering().ConnectFailures()
+	status.Peers = c.getPeers()
+
+	return status
+}
+
+func (c *Control) getPeers() []Peer {
+	links := c.instance.Peering().GetLinks()
+	geoVerifications := c.instance.Peering().GeoVerifications()
+	peers := make([]Peer, 0, len(links))
+	for _, link := range links {
+		peer := Peer{
+			Router:    link.Peer(),
+			Outgoing:  link.Outgoing(),
+			Lite:      link.Lite(),
+			Uptime:    link.Uptime(),
+			Latency:   link.Latency(),
+			BytesIn:   link.BytesIn(),
+			BytesOut:  link.BytesOut(),
+			ClockSkew: link.ClockSkew(),
+		}
+		if u := link.PeeringURL(); u != nil {
+			peer.PeeringURL = u.String()
+		}
+		if observed := link.ObservedAddr(); observed.IsValid() {
+			peer.ObservedAddr = observed.String()
+		}
+		if capabilities := link.Capabilities(); capabilities.Known() {
+			peer.Capabilities = capabilities.Names()
+		}
+		if geo, ok := geoVerifications[link.Peer()]; ok {
+			peer.GeoLocated = geo.Located
+			peer.GeoMismatch = geo.Mismatch.String()
+			peer.GeoFlagged = geo.Flagged()
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func (c *Control) handlePeers(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r, []string{filterRemote, filterPrefix, filterStatus, filterSince}, peerSorting)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Filter peers.
+	now := time.Now()
+	peers := slices.DeleteFunc(c.getPeers(), func(peer Peer) bool {
+		return !q.matchAddr(peer.Router) ||
+			!q.matchStatus(peer.statuses()...) ||
+			!q.matchSince(now.Add(-peer.Uptime))
+	})
+
+	list := &Peers{Time: now}
+	list.Peers, list.ListInfo = paginate(q, peers, peerSorting)
+	respond(w, list)
+}
+
+// statuses returns the statuses the peer can be filtered by.
+func (peer Peer) statuses() []string {
+	statuses := make([]string, 0, 3)
+	if peer.Outgoing {
+		statuses = append(statuses, "outgoing")
+	} else {
+		statuses = append(statuses, "incoming")
+	}
+	if peer.Lite {
+		statuses = append(statuses, "lite")
+	}
+	if peer.GeoFlagged {
+		statuses = append(statuses, "flagged")
+	}
+	return statuses
+}
+
+// handleEvents streams router events.
+// The remote and prefix filters match the router of the event, the status
+// filter matches the peering state. The type parameter takes a comma
+// separated list of event types. Offset and limit apply to the stream.
+func (c *Control) handleEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery[Event](r, []string{filterRemote, filterPrefix, filterStatus}, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var types []string
+	if value := r.URL.Query().Get("type"); value != "" {
+		types = strings.Split(value, ",")
+	}
+
+	// Stream events until the client disconnects.
+	send, err := stream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.watchEvents(r.Context(), func(event Event) bool {
+		if !matchEvent(q, types, event) {
+			return true
+		}
+		if q.offset > 0 {
+			q.offset--
+			return true
+		}
+
+		if err := send(event); err != nil {
+			return false
+		}
+		if q.limit > 0 {
+			q.limit--
+			return q.limit > 0
+		}
+		return true
+	})
+}
+
+// matchEvent returns whether the event matches the query and is of one of the
+// given types. All types match if none are given.
+func matchEvent(q *listQuery, types []string, event Event) bool {
+	return q.matchAddr(event.Router) &&
+		q.matchStatus(event.State) &&
+		(len(types) == 0 || slices.Contains(types, event.Type))
+}
+
+// watchEvents calls send with every router event, until the context is
+// canceled or send returns false.
+func (c *Control) watchEvents(ctx context.Context, send func(Event) bool) {
+	// Subscribe to events.
+	peeringSub := c.instance.Peering().PeeringEvents.Subscribe("control api", 100)
+	defer peeringSub.Cancel()
+	scanSub := c.instance.Router().ScanEvents.Subscribe("control api", 100)
+	defer scanSub.Cancel()
+	incidentSub := c.instance.Watchdog().Incidents.Subscribe("control api", 100)
+	defer incidentSub.Cancel()
+	deniedSub := c.instance.Router().DeniedEvents.Subscribe("control api", 100)
+	defer deniedSub.Cancel()
+	errorSub := c.instance.Router().ErrorEvents.Subscribe("control api", 100)
+	defer errorSub.Cancel()
+	inboundSub := c.instance.Router().InboundEvents.Subscribe("control api", 100)
+	defer inboundSub.Cancel()
+
+	for {
+		var event Event
+		select {
+		case e := <-peeringSub.Events():
+			event = Event{
+				Type:   EventTypePeering,
+				Time:   time.Now(),
+				Router: e.Peer,
+				State:  string(e.State),
+			}
+		case e := <-scanSub.Events():
+			event = Event{
+				Type:         EventTypeScan,
+				Time:         time.Now(),
+				Router:       e.Router,
+				Ports:        e.Ports,
+				BlockedUntil: &e.BlockedUntil,
+			}
+			if e.ReportedBy.IsValid() {
+				event.ReportedBy = &e.ReportedBy
+			}
+		case e := <-incidentSub.Events():
+			event = Event{
+				Type:     EventTypeIncident,
+				Time:     e.Time,
+				Router:   c.instance.Identity().IP,
+				Module:   e.ModuleName,
+				Worker:   e.Worker,
+				Stuck:    e.Stuck,
+				Recovery: e.Recovery,
+			}
+		case e := <-deniedSub.Events():
+			event = Event{
+				Type:     EventTypeDenied,
+				Time:     time.Now(),
+				Router:   c.instance.Identity().IP,
+				Service:  e.Service,
+				Country:  e.Country,
+				Attempts: e.Attempts,
+				Routers:  e.Routers,
+			}
+		case e := <-errorSub.Events():
+			event = Event{
+				Type:   EventTypeError,
+				Time:   time.Now(),
+				Router: e.Router,
+				Code:   e.Code,
+			}
+			if e.Dst.IsValid() {
+				event.Dst = &e.Dst
+			}
+		case e := <-inboundSub.Events():
+			event = Event{
+				Type:    EventTypeInbound,
+				Time:    time.Now(),
+				Router:  e.Router,
+				Service: e.Service,
+				Port:    e.Port,
+			}
+		case <-ctx.Done():
+			return
+		}
+
+		if !send(event) {
+			return
+		}
+	}
+}
+
+func (c *Control) handleTableSnapshot(w http.ResponseWriter, r *http.Request) {
+	respond(w, c.instance.Router().Table().Snapshot())
+}
+
+func (c *Control) handleTable(w http.ResponseWriter, r *http.Request) {
+	watch, _, err := parseWatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q, err := parseListQuery(r, []string{filterRemote, filterPrefix, filterStatus}, routeSorting)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !watch {
+		tbl := c.instance.Router().Table()
+		respond(w, makeTable(tbl.Export(), tbl.HoldDowns(), q))
+		return
+	}
+
+	// Stream table whenever it changes.
+	send, err := stream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.watchTable(r.Context(), q, func(table *Table) error {
+		return send(table)
+	})
+}
+
+// watchTable calls send with the routing table matching the query and then
+// again whenever it changes, until the context is canceled or send fails.
+func (c *Control) watchTable(ctx context.Context, q *listQuery, send func(*Table) error) {
+	tbl := c.instance.Router().Table()
+	entries := tbl.Export()
+	holdDowns := tbl.HoldDowns()
+	if err := send(makeTable(entries, holdDowns, q)); err != nil {
+		return
+	}
+	ticker := time.NewTicker(tableWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		// Check for changes, ignoring refreshed expiry.
+		current := tbl.Export()
+		currentHoldDowns := tbl.HoldDowns()
+		if slices.EqualFunc(entries, current, func(a, b m.RoutingTableEntry) bool {
+			return a.RouteEquals(&b) && a.NextHop == b.NextHop && a.Path.TotalDelay == b.Path.TotalDelay
+		}) && slices.Equal(holdDowns, currentHoldDowns) {
+			continue
+		}
+		entries = current
+		holdDowns = currentHoldDowns
+
+		if err := send(makeTable(entries, holdDowns, q)); err != nil {
+			return
+		}
+	}
+}
+
+// makeTable returns the routes and hold-downs matching the query.
+// The remote and prefix filters match the destination and the next hop.
+// The status filter matches the route source, "stub" and "implausible".
+// Hold-downs are only filtered by remote and prefix.
+func makeTable(entries []m.RoutingTableEntry, holdDowns []m.RouteHoldDown, q *listQuery) *Table {
+	table := &Table{
+		Time: time.Now(),
+	}
+
+	// Count routes per destination before filtering.
+	counts := make(map[netip.Addr]int, len(entries))
+	for _, rte := range entries {
+		counts[rte.DstIP]++
+	}
+
+	routes := make([]Route, 0, len(entries))
+	for _, rte := range entries {
+		if !q.matchAddr(rte.DstIP, rte.NextHop) {
+			continue
+		}
+		route := Route{
+			Dst:     rte.DstIP,
+			NextHop: rte.NextHop,
+			Hops:    rte.Path.TotalHops,
+			Delay:   rte.Path.TotalDelay,
+			Stub:    rte.Stub,
+			Source:  rte.Source.String(),
+			Expires: rte.Expires,
+			Learned: rte.Learned,
+
+			Implausible:  rte.Implausible,
+			Alternatives: counts[rte.DstIP] - 1,
+		}
+		if rte.RoutingPrefix.IsValid() {
+			route.Prefix = rte.RoutingPrefix.String()
+		}
+		if !rte.Learned.IsZero() {
+			route.Age = int64(table.Time.Sub(rte.Learned).Seconds())
+		}
+		if !q.matchStatus(route.statuses()...) {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	table.Routes, table.ListInfo = paginate(q, routes, routeSorting)
+
+	for _, hd := range holdDowns {
+		if q.matchAddr(hd.Router) {
+			table.HoldDowns = append(table.HoldDowns, HoldDown{
+				Router:    hd.Router,
+				Withdrawn: hd.Withdrawn,
+				Until:     hd.Until,
+			})
+		}
+	}
+	return table
+}
+
+// statuses returns the statuses the route can be filtered by.
+func (route Route) statuses() []string {
+	statuses := make([]string, 0, 3)
+	statuses = append(statuses, route.Source)
+	if route.Stub {
+		statuses = append(statuses, "stub")
+	}
+	if route.Implausible {
+		statuses = append(statuses, "implausible")
+	}
+	return statuses
+}
@@ -0,0 +1,175 @@
+package control
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/storage"
+)
+
+const defaultLinkHistoryPeriod = 30 * 24 * time.Hour
+
+// LinkHistory is the link session history of one or all peers.
+// The list info applies to the sessions.
+type LinkHistory struct {
+	Since    time.Time            `json:"since"`
+	Peers    []LinkHistorySummary `json:"peers"`
+	Sessions []LinkSession        `json:"sessions"`
+	ListInfo
+}
+
+// linkSessionSorting holds the sort keys of link sessions.
+var linkSessionSorting = map[string]func(a, b LinkSession) int{
+	"peer":      func(a, b LinkSession) int { return a.Peer.Compare(b.Peer) },
+	"connected": func(a, b LinkSession) int { return a.Connected.Compare(b.Connected) },
+	"bytesIn":   func(a, b LinkSession) int { return cmp.Compare(a.BytesIn, b.BytesIn) },
+	"bytesOut":  func(a, b LinkSession) int { return cmp.Compare(a.BytesOut, b.BytesOut) },
+}
+
+// LinkHistorySummary summarizes the link sessions with a peer.
+type LinkHistorySummary struct {
+	Peer         netip.Addr `json:"peer"`
+	Sessions     int        `json:"sessions"`
+	Uptime       string     `json:"uptime"`
+	Availability float64    `json:"availability"`         // Share of the period, from 0 to 1.
+	AvgLatency   uint16     `json:"avgLatency,omitempty"` // In milliseconds, one direction.
+	BytesIn      uint64     `json:"bytesIn"`
+	BytesOut     uint64     `json:"bytesOut"`
+	Longest      string     `json:"longest"`
+	LastReason   string     `json:"lastReason,omitempty"`
+	LastSeen     time.Time  `json:"lastSeen"`
+}
+
+// LinkSession is a single link session with a peer.
+type LinkSession struct {
+	Peer         netip.Addr `json:"peer"`
+	PeeringURL   string     `json:"peeringURL,omitempty"`
+	Outgoing     bool       `json:"outgoing"`
+	Connected    time.Time  `json:"connected"`
+	Disconnected *time.Time `json:"disconnected,omitempty"`
+	Active       bool       `json:"active,omitempty"`
+	Duration     string     `json:"duration"`
+	Reason       string     `json:"reason,omitempty"`
+	AvgLatency   uint16     `json:"avgLatency,omitempty"` // In milliseconds, one direction.
+	BytesIn      uint64     `json:"bytesIn"`
+	BytesOut     uint64     `json:"bytesOut"`
+}
+
+func (c *Control) handleLinkHistory(w http.ResponseWriter, r *http.Request) {
+	// Parse query.
+	var peer netip.Addr
+	if value := r.URL.Query().Get("peer"); value != "" {
+		var err error
+		peer, err = netip.ParseAddr(value)
+		if err != nil {
+			http.Error(w, "invalid peer: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	since, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q, err := parseListQuery(r, []string{filterRemote, filterPrefix, filterStatus}, linkSessionSorting)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !peer.IsValid() {
+		peer = q.remote
+	}
+
+	// Get sessions.
+	sessions, err := c.instance.Peering().GetLinkHistory(peer, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Filter sessions.
+	sessions = slices.DeleteFunc(sessions, func(session storage.StoredLinkSession) bool {
+		status := "closed"
+		if session.Active {
+			status = "active"
+		}
+		return !q.matchAddr(session.Peer) || !q.matchStatus(status)
+	})
+
+	history := makeLinkHistory(sessions, since)
+	history.Sessions, history.ListInfo = paginate(q, history.Sessions, linkSessionSorting)
+	respond(w, history)
+}
+
+// parseSince parses the given value either as a duration into the past or as
+// an RFC 3339 timestamp.
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now().Add(-defaultLinkHistoryPeriod), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("invalid since: must be a duration or RFC 3339 time")
+	}
+	return since, nil
+}
+
+func makeLinkHistory(sessions []storage.StoredLinkSession, since time.Time) LinkHistory {
+	history := LinkHistory{
+		Since:    since,
+		Peers:    make([]LinkHistorySummary, 0, 8),
+		Sessions: make([]LinkSession, 0, len(sessions)),
+	}
+
+	// Group sessions by peer.
+	byPeer := make(map[netip.Addr][]storage.StoredLinkSession)
+	for _, session := range sessions {
+		byPeer[session.Peer] = append(byPeer[session.Peer], session)
+
+		ls := LinkSession{
+			Peer:       session.Peer,
+			PeeringURL: session.PeeringURL,
+			Outgoing:   session.Outgoing,
+			Connected:  session.Connected,
+			Active:     session.Active,
+			Duration:   session.Duration().Round(time.Second).String(),
+			Reason:     session.Reason,
+			AvgLatency: session.AvgLatency,
+			BytesIn:    session.BytesIn,
+			BytesOut:   session.BytesOut,
+		}
+		if !session.Active {
+			ls.Disconnected = &session.Disconnected
+		}
+		history.Sessions = append(history.Sessions, ls)
+	}
+
+	// Summarize per peer.
+	for peer, peerSessions := range byPeer {
+		summary := storage.SummarizeLinkSessions(peer, peerSessions, since)
+		history.Peers = append(history.Peers, LinkHistorySummary{
+			Peer:         summary.Peer,
+			Sessions:     summary.Sessions,
+			Uptime:       summary.Uptime.Round(time.Second).String(),
+			Availability: summary.Availability,
+			AvgLatency:   summary.AvgLatency,
+			BytesIn:      summary.BytesIn,
+			BytesOut:     summary.BytesOut,
+			Longest:      summary.Longest.Round(time.Second).String(),
+			LastReason:   summary.LastReason,
+			LastSeen:     summary.LastSeen,
+		})
+	}
+	slices.SortFunc(history.Peers, func(a, b LinkHistorySummary) int {
+		return a.Peer.Compare(b.Peer)
+	})
+
+	return history
+}
@@ -0,0 +1,170 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxListLimit is the maximum amount of entries returned per page.
+const maxListLimit = 10000
+
+// List filters.
+const (
+	filterRemote = "remote"
+	filterPrefix = "prefix"
+	filterStatus = "status"
+	filterSince  = "since"
+)
+
+// ListInfo describes which part of a list is returned.
+type ListInfo struct {
+	// Total is the amount of entries matching the filters.
+	Total  int `json:"total"`
+	Offset int `json:"offset,omitempty"`
+	Limit  int `json:"limit,omitempty"`
+}
+
+// listQuery holds the pagination, sorting and filter parameters of a list
+// request.
+type listQuery struct {
+	offset int
+	limit  int
+	sort   string
+	desc   bool
+
+	remote netip.Addr
+	prefix netip.Prefix
+	status string
+	since  time.Time
+}
+
+// parseListQuery parses the pagination, sorting and filter parameters of the
+// request. Only the given filters and sort keys are accepted, in order to not
+// silently return unfiltered results.
+//
+// Parameters:
+//   - offset: skip this many entries
+//   - limit: return at most this many entries, 0 returns all
+//   - sort: sort by this key, prefix with "-" for descending order
+//   - remote: only entries concerning this router
+//   - prefix: only entries concerning routers in this prefix
+//   - status: only entries with this status
+//   - since: only entries since this time, as a duration into the past or
+//     RFC 3339 time
+func parseListQuery[T any](r *http.Request, filters []string, sorting map[string]func(a, b T) int) (*listQuery, error) {
+	q := &listQuery{}
+	query := r.URL.Query()
+
+	// Pagination.
+	var err error
+	q.offset, err = queryInt(r, "offset", 0)
+	if err != nil || q.offset < 0 {
+		return nil, errors.New("invalid offset")
+	}
+	q.limit, err = queryInt(r, "limit", 0)
+	if err != nil || q.limit < 0 || q.limit > maxListLimit {
+		return nil, fmt.Errorf("invalid limit: must be between 0 and %d", maxListLimit)
+	}
+
+	// Sorting.
+	if value := query.Get("sort"); value != "" {
+		q.sort, q.desc = strings.CutPrefix(value, "-")
+		if _, ok := sorting[q.sort]; !ok {
+			keys := make([]string, 0, len(sorting))
+			for key := range sorting {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			return nil, fmt.Errorf("invalid sort: must be one of %s", strings.Join(keys, ", "))
+		}
+	}
+
+	// Filters.
+	for _, filter := range []string{filterRemote, filterPrefix, filterStatus, filterSince} {
+		value := query.Get(filter)
+		if value == "" {
+			continue
+		}
+		if !slices.Contains(filters, filter) {
+			return nil, fmt.Errorf("filter %s is not supported", filter)
+		}
+
+		switch filter {
+		case filterRemote:
+			q.remote, err = netip.ParseAddr(value)
+		case filterPrefix:
+			q.prefix, err = netip.ParsePrefix(value)
+			q.prefix = q.prefix.Masked()
+		case filterStatus:
+			q.status = value
+		case filterSince:
+			q.since, err = parseSince(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", filter, err)
+		}
+	}
+
+	return q, nil
+}
+
+// matchAddr returns whether any of the given routers match the remote and
+// prefix filters.
+func (q *listQuery) matchAddr(routers ...netip.Addr) bool {
+	if q.remote.IsValid() && !slices.Contains(routers, q.remote) {
+		return false
+	}
+	if q.prefix.IsValid() && !slices.ContainsFunc(routers, q.prefix.Contains) {
+		return false
+	}
+	return true
+}
+
+// matchStatus returns whether any of the given statuses match the status
+// filter.
+func (q *listQuery) matchStatus(statuses ...string) bool {
+	if q.status == "" {
+		return true
+	}
+	return slices.ContainsFunc(statuses, func(status string) bool {
+		return strings.EqualFold(status, q.status)
+	})
+}
+
+// matchSince returns whether the given time matches the since filter.
+func (q *listQuery) matchSince(t time.Time) bool {
+	return q.since.IsZero() || !t.Before(q.since)
+}
+
+// paginate sorts the matching entries as requested and returns the requested
+// page.
+func paginate[T any](q *listQuery, entries []T, sorting map[string]func(a, b T) int) ([]T, ListInfo) {
+	if cmp, ok := sorting[q.sort]; ok {
+		slices.SortStableFunc(entries, func(a, b T) int {
+			if q.desc {
+				return cmp(b, a)
+			}
+			return cmp(a, b)
+		})
+	}
+
+	info := ListInfo{
+		Total:  len(entries),
+		Offset: q.offset,
+		Limit:  q.limit,
+	}
+	start := min(q.offset, len(entries))
+	end := len(entries)
+	if q.limit > 0 {
+		end = min(start+q.limit, end)
+	}
+	return entries[start:end], info
+}
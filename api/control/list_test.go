@@ -0,0 +1,215 @@
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/router"
+)
+
+func TestParseListQuery(t *testing.T) {
+	t.Parallel()
+
+	parse := func(query string, filters ...string) (*listQuery, error) {
+		r := httptest.NewRequest(http.MethodGet, Path+"/connections?"+query, nil)
+		return parseListQuery(r, filters, connectionSorting)
+	}
+
+	// Valid queries.
+	q, err := parse("offset=10&limit=5&sort=-lastSeen&remote=fd12:3456::1&prefix=fd00::1/8&status=active&since=1h",
+		filterRemote, filterPrefix, filterStatus, filterSince)
+	require.NoError(t, err)
+	assert.Equal(t, 10, q.offset)
+	assert.Equal(t, 5, q.limit)
+	assert.Equal(t, "lastSeen", q.sort)
+	assert.True(t, q.desc)
+	assert.Equal(t, netip.MustParseAddr("fd12:3456::1"), q.remote)
+	assert.Equal(t, netip.MustParsePrefix("fd00::/8"), q.prefix, "prefix must be masked")
+	assert.Equal(t, "active", q.status)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), q.since, time.Minute)
+
+	// Invalid queries.
+	for _, query := range []string{
+		"offset=-1",
+		"limit=x",
+		"limit=10001",
+		"sort=unknown",
+		"remote=invalid",
+		"prefix=invalid",
+		"since=yesterday",
+	} {
+		_, err := parse(query, filterRemote, filterPrefix, filterSince)
+		assert.Error(t, err, query)
+	}
+
+	// Unsupported filters are rejected instead of returning unfiltered results.
+	_, err = parse("status=active", filterRemote)
+	assert.Error(t, err)
+}
+
+func TestPaginate(t *testing.T) {
+	t.Parallel()
+
+	sorting := map[string]func(a, b int) int{
+		"value": func(a, b int) int { return a - b },
+	}
+	q := &listQuery{offset: 1, limit: 2, sort: "value", desc: true}
+	page, info := paginate(q, []int{3, 1, 4, 5, 2}, sorting)
+	assert.Equal(t, []int{4, 3}, page)
+	assert.Equal(t, ListInfo{Total: 5, Offset: 1, Limit: 2}, info)
+
+	// Offsets beyond the end return an empty page.
+	q = &listQuery{offset: 10}
+	page, info = paginate(q, []int{1, 2}, sorting)
+	assert.Empty(t, page)
+	assert.Equal(t, 2, info.Total)
+}
+
+func TestListConnections(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	remote := netip.MustParseAddr("fd12:3456::1")
+	conns := []router.ExportedConnection{
+		{RemoteIP: remote, Protocol: 6, StatusName: "allowed", TCPState: "established", Active: true, LastSeen: now},
+		{RemoteIP: remote, Protocol: 17, StatusName: "allowed", LastSeen: now.Add(-time.Hour)},
+		{RemoteIP: netip.MustParseAddr("fd12:3456::2"), Protocol: 6, Inbound: true, StatusName: "denied", LastSeen: now.Add(-time.Minute)},
+	}
+
+	// Filter by remote, status and since.
+	list := makeConnections(conns, &listQuery{remote: remote}, now)
+	assert.Equal(t, 2, list.Total)
+	list = makeConnections(conns, &listQuery{status: "active"}, now)
+	require.Len(t, list.Connections, 1)
+	assert.Equal(t, "established", list.Connections[0].TCPState)
+	list = makeConnections(conns, &listQuery{status: "inbound"}, now)
+	require.Len(t, list.Connections, 1)
+	assert.Equal(t, "denied", list.Connections[0].Status)
+	list = makeConnections(conns, &listQuery{since: now.Add(-10 * time.Minute)}, now)
+	assert.Equal(t, 2, list.Total)
+
+	// Sort and paginate.
+	list = makeConnections(conns, &listQuery{sort: "lastSeen", limit: 1}, now)
+	assert.Equal(t, ListInfo{Total: 3, Limit: 1}, list.ListInfo)
+	require.Len(t, list.Connections, 1)
+	assert.Equal(t, uint8(17), list.Connections[0].Protocol)
+
+	// Handler.
+	c := newTestControl(t)
+	w := httptest.NewRecorder()
+	c.handleConnections(w, httptest.NewRequest(http.MethodGet, Path+"/connections?limit=10", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	resp := &Connections{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+	assert.Equal(t, 10, resp.Limit)
+	assert.Empty(t, resp.Connections)
+	w = httptest.NewRecorder()
+	c.handleConnections(w, httptest.NewRequest(http.MethodGet, Path+"/connections?sort=unknown", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListRoutingDecisions(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	peer := netip.MustParseAddr("fd12:3456::1")
+	decisions := []router.RoutingDecision{
+		{Time: now.Add(-time.Hour), Dst: netip.MustParseAddr("fd12:3456::2"), NextHop: peer, Reason: router.RoutingReasonDestination},
+		{Time: now, Dst: netip.MustParseAddr("fd12:3456::3"), NextHop: peer, Reason: router.RoutingReasonNearest, Hops: 3},
+		{Time: now, Dst: netip.MustParseAddr("fd12:3456::4"), Reason: router.RoutingReasonNoRoute, Err: "no route"},
+	}
+
+	assert.Equal(t, 2, makeRoutingDecisions(decisions, &listQuery{remote: peer}).Total)
+	assert.Equal(t, 1, makeRoutingDecisions(decisions, &listQuery{status: "error"}).Total)
+	assert.Equal(t, 1, makeRoutingDecisions(decisions, &listQuery{status: "nearest"}).Total)
+	assert.Equal(t, 2, makeRoutingDecisions(decisions, &listQuery{since: now.Add(-time.Minute)}).Total)
+	list := makeRoutingDecisions(decisions, &listQuery{sort: "hops", desc: true, limit: 1})
+	require.Len(t, list.Decisions, 1)
+	assert.Equal(t, uint8(3), list.Decisions[0].Hops)
+	assert.Equal(t, 3, list.Total)
+
+	// Handler.
+	c := newTestControl(t)
+	w := httptest.NewRecorder()
+	c.handleRoutingDecisions(w, httptest.NewRequest(http.MethodGet, Path+"/decisions?status=error", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	c.handleRoutingDecisions(w, httptest.NewRequest(http.MethodGet, Path+"/decisions?limit=-1", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListTable(t *testing.T) {
+	t.Parallel()
+
+	dst := netip.MustParseAddr("fd12:3456::1")
+	other := netip.MustParseAddr("fd12:3456::2")
+	peerA := netip.MustParseAddr("fd12:3456::a")
+	peerB := netip.MustParseAddr("fd12:3456::b")
+	entries := []m.RoutingTableEntry{
+		{DstIP: dst, NextHop: peerA, Source: m.RouteSourceGossip},
+		{DstIP: dst, NextHop: peerB, Source: m.RouteSourceGossip},
+		{DstIP: other, NextHop: peerA, Source: m.RouteSourcePeer},
+	}
+
+	// Alternatives count all routes to the destination, regardless of filters.
+	table := makeTable(entries, nil, &listQuery{remote: peerB})
+	require.Len(t, table.Routes, 1)
+	assert.Equal(t, 1, table.Routes[0].Alternatives)
+	assert.Equal(t, uint32(1), makeTableMsg(table).GetRoutes()[0].GetAlternatives())
+	table = makeTable(entries, nil, &listQuery{remote: other})
+	require.Len(t, table.Routes, 1)
+	assert.Zero(t, table.Routes[0].Alternatives)
+
+	// Handler.
+	c := newTestControl(t)
+	_, err := c.instance.Router().Table().AddRoute(m.RoutingTableEntry{
+		DstIP:   dst,
+		NextHop: dst,
+		Source:  m.RouteSourcePeer,
+		Expires: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	c.handleTable(w, httptest.NewRequest(http.MethodGet, Path+"/table", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	resp := &Table{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+	require.Len(t, resp.Routes, 1)
+	assert.Equal(t, dst, resp.Routes[0].Dst)
+	assert.Zero(t, resp.Routes[0].Alternatives)
+	assert.NotContains(t, w.Body.String(), `"alternatives"`, "zero alternatives must be omitted")
+}
+
+func TestListDeniedAttempts(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	attempts := []router.DeniedAttempts{
+		{Service: "ssh", Attempts: 10, LastSeen: now, Notified: true},
+		{Service: "wiki", Attempts: 2, LastSeen: now.Add(-time.Hour)},
+	}
+
+	assert.Equal(t, 1, makeDeniedAttempts(slices.Clone(attempts), &listQuery{status: "notified"}).Total)
+	assert.Equal(t, 1, makeDeniedAttempts(slices.Clone(attempts), &listQuery{since: now.Add(-time.Minute)}).Total)
+	list := makeDeniedAttempts(slices.Clone(attempts), &listQuery{sort: "attempts", limit: 1})
+	require.Len(t, list.Attempts, 1)
+	assert.Equal(t, "wiki", list.Attempts[0].Service)
+
+	// Handler.
+	c := newTestControl(t)
+	w := httptest.NewRecorder()
+	c.handleDeniedAttempts(w, httptest.NewRequest(http.MethodGet, Path+"/services/denied?sort=-lastSeen", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	c.handleDeniedAttempts(w, httptest.NewRequest(http.MethodGet, Path+"/services/denied?remote=fd12:3456::1", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "remote filter is not supported")
+}
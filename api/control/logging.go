@@ -0,0 +1,77 @@
+package control
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// LogLevelDefault is the module name used to change the default log level.
+const LogLevelDefault = "default"
+
+// LogLevels holds the current log levels.
+type LogLevels struct {
+	Default string `json:"default"`
+	// Modules holds the log levels of modules that differ from the default.
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+// SetLogLevel is a request to change a log level.
+type SetLogLevel struct {
+	Level string `json:"level"`
+}
+
+func (c *Control) handleLogLevels(w http.ResponseWriter, r *http.Request) {
+	respond(w, makeLogLevels())
+}
+
+func (c *Control) handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	// Parse request.
+	var req SetLogLevel
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		http.Error(w, "invalid log level: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Set level.
+	module := strings.ToLower(r.PathValue("module"))
+	if module == LogLevelDefault {
+		mgr.SetDefaultLogLevel(level)
+	} else {
+		mgr.SetModuleLogLevel(module, level)
+	}
+	slog.Info("changed log level", "module", module, "level", level)
+
+	respond(w, makeLogLevels())
+}
+
+func (c *Control) handleResetLogLevel(w http.ResponseWriter, r *http.Request) {
+	module := strings.ToLower(r.PathValue("module"))
+	if _, ok := mgr.ModuleLogLevels()[module]; !ok {
+		http.Error(w, "module has no log level", http.StatusNotFound)
+		return
+	}
+	mgr.ResetModuleLogLevel(module)
+	slog.Info("reset log level", "module", module)
+
+	respond(w, makeLogLevels())
+}
+
+func makeLogLevels() LogLevels {
+	levels := LogLevels{
+		Default: mgr.DefaultLogLevel().String(),
+		Modules: make(map[string]string),
+	}
+	for module, level := range mgr.ModuleLogLevels() {
+		levels.Modules[module] = level.String()
+	}
+	return levels
+}
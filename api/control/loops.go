@@ -0,0 +1,49 @@
+package control
+
+import (
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// Loops holds routing loop suspicion statistics per destination.
+type Loops struct {
+	Time         time.Time       `json:"time"`
+	Destinations []LoopSuspicion `json:"destinations"`
+}
+
+// LoopSuspicion holds the expired frames to a destination.
+type LoopSuspicion struct {
+	Dst          netip.Addr `json:"dst"`
+	Expired      uint64     `json:"expired"`  // Dropped by this router.
+	Reported     uint64     `json:"reported"` // Reported by other routers.
+	LastReporter netip.Addr `json:"lastReporter,omitempty"`
+	FirstSeen    time.Time  `json:"firstSeen"`
+	LastSeen     time.Time  `json:"lastSeen"`
+	LastProbe    *time.Time `json:"lastProbe,omitempty"`
+	Looping      bool       `json:"looping,omitempty"` // Confirmed by the last probe.
+}
+
+func (c *Control) handleLoops(w http.ResponseWriter, r *http.Request) {
+	stats := c.instance.Router().LoopStats()
+	loops := &Loops{
+		Time:         time.Now(),
+		Destinations: make([]LoopSuspicion, 0, len(stats)),
+	}
+	for _, stat := range stats {
+		loop := LoopSuspicion{
+			Dst:          stat.Dst,
+			Expired:      stat.Expired,
+			Reported:     stat.Reported,
+			LastReporter: stat.LastReporter,
+			FirstSeen:    stat.FirstSeen,
+			LastSeen:     stat.LastSeen,
+			Looping:      stat.Looping,
+		}
+		if !stat.LastProbe.IsZero() {
+			loop.LastProbe = &stat.LastProbe
+		}
+		loops.Destinations = append(loops.Destinations, loop)
+	}
+	respond(w, loops)
+}
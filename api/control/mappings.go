@@ -0,0 +1,159 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/api/dns"
+)
+
+// MappingRequest changes a domain mapping.
+type MappingRequest struct {
+	Domain string     `json:"domain,omitempty"`
+	Router netip.Addr `json:"router,omitempty"`
+}
+
+// dnsServer returns the DNS server or responds with an error.
+func (c *Control) dnsServer(w http.ResponseWriter) *dns.Server {
+	srv := c.instance.DNS()
+	if srv == nil {
+		http.Error(w, "dns server is disabled", http.StatusServiceUnavailable)
+	}
+	return srv
+}
+
+func (c *Control) handleListMappings(w http.ResponseWriter, r *http.Request) {
+	srv := c.dnsServer(w)
+	if srv == nil {
+		return
+	}
+
+	mappings, err := srv.Mappings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Only show conflicts, if requested.
+	if r.URL.Query().Get("conflicts") == "true" {
+		conflicts := mappings[:0]
+		for _, mapping := range mappings {
+			if mapping.Conflict() {
+				conflicts = append(conflicts, mapping)
+			}
+		}
+		mappings = conflicts
+	}
+	respond(w, mappings)
+}
+
+func (c *Control) handleSetMapping(w http.ResponseWriter, r *http.Request) {
+	srv := c.dnsServer(w)
+	if srv == nil {
+		return
+	}
+
+	var req MappingRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := srv.SetMapping(req.Domain, req.Router); err != nil {
+		respondMappingError(w, err)
+		return
+	}
+
+	mapping, err := srv.GetMapping(req.Domain)
+	if err != nil {
+		respondMappingError(w, err)
+		return
+	}
+	respond(w, mapping)
+}
+
+func (c *Control) handleApproveMapping(w http.ResponseWriter, r *http.Request) {
+	srv := c.dnsServer(w)
+	if srv == nil {
+		return
+	}
+
+	// The router is optional.
+	var req MappingRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	mapping, err := srv.ApproveMapping(r.PathValue("domain"), req.Router)
+	if err != nil {
+		respondMappingError(w, err)
+		return
+	}
+	respond(w, mapping)
+}
+
+func (c *Control) handleRenameMapping(w http.ResponseWriter, r *http.Request) {
+	srv := c.dnsServer(w)
+	if srv == nil {
+		return
+	}
+
+	var req MappingRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mapping, err := srv.RenameMapping(r.PathValue("domain"), req.Domain)
+	if err != nil {
+		respondMappingError(w, err)
+		return
+	}
+	respond(w, mapping)
+}
+
+func (c *Control) handleDeleteMapping(w http.ResponseWriter, r *http.Request) {
+	srv := c.dnsServer(w)
+	if srv == nil {
+		return
+	}
+
+	if err := srv.DeleteMapping(r.PathValue("domain")); err != nil {
+		respondMappingError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Control) handleImportMappings(w http.ResponseWriter, r *http.Request) {
+	srv := c.dnsServer(w)
+	if srv == nil {
+		return
+	}
+
+	var mappings []dns.Mapping
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000_000)).Decode(&mappings); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	respond(w, srv.ImportMappings(mappings, r.URL.Query().Get("overwrite") == "true"))
+}
+
+func respondMappingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, dns.ErrMappingNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, dns.ErrDomainInUse),
+		errors.Is(err, dns.ErrNoMappingConflict),
+		errors.Is(err, dns.ErrAmbiguousMapping):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, dns.ErrInvalidDomain),
+		errors.Is(err, dns.ErrInvalidRouter):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
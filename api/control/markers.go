@@ -0,0 +1,33 @@
+package control
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// MarkerTable describes the active country geo marker table.
+type MarkerTable struct {
+	Version        uint64     `json:"version"`
+	BuiltinVersion uint64     `json:"builtinVersion"`
+	Signer         netip.Addr `json:"signer,omitempty"`
+	Countries      int        `json:"countries"`
+
+	// Table holds the full table, if requested.
+	Table *m.MarkerTable `json:"table,omitempty"`
+}
+
+func (c *Control) handleMarkerTable(w http.ResponseWriter, r *http.Request) {
+	table := m.ActiveMarkerTable()
+	info := &MarkerTable{
+		Version:        table.Version,
+		BuiltinVersion: m.BuiltinMarkerTableVersion,
+		Signer:         table.Signer,
+		Countries:      len(table.Countries),
+	}
+	if r.URL.Query().Get("full") == "true" {
+		info.Table = table
+	}
+	respond(w, info)
+}
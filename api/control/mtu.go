@@ -0,0 +1,49 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// PathMTUs holds the effective path MTUs to destinations.
+type PathMTUs struct {
+	Time time.Time `json:"time"`
+	// MSSClamping is set if TCP MSS is clamped to the path MTU.
+	MSSClamping  bool             `json:"mssClamping"`
+	Destinations []router.PathMTU `json:"destinations"`
+}
+
+func (c *Control) handlePathMTUs(w http.ResponseWriter, r *http.Request) {
+	respond(w, &PathMTUs{
+		Time:         time.Now(),
+		MSSClamping:  !c.instance.Config().System.DisableMSSClamping,
+		Destinations: c.instance.Router().PathMTUs(),
+	})
+}
+
+func (c *Control) handleProbePathMTU(w http.ResponseWriter, r *http.Request) {
+	dst, err := netip.ParseAddr(r.PathValue("dst"))
+	if err != nil {
+		http.Error(w, "invalid destination: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Extend write deadline to wait for the probes.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(mtuProbeWriteTimeout))
+
+	pmtu, err := c.instance.Router().ProbePathMTU(dst)
+	switch {
+	case errors.Is(err, router.ErrPathMTUProbeFailed):
+		httpError(w, err, http.StatusGatewayTimeout)
+		return
+	case err != nil:
+		httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	respond(w, pmtu)
+}
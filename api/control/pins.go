@@ -0,0 +1,83 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// PinnedRoute is a manually pinned route.
+type PinnedRoute struct {
+	Dst     netip.Addr   `json:"dst"`
+	Via     []netip.Addr `json:"via"`
+	Hops    uint8        `json:"hops,omitempty"`
+	Latency uint16       `json:"latency,omitempty"` // In milliseconds, measured by the probe.
+	Pinned  time.Time    `json:"pinned,omitempty"`
+}
+
+func (c *Control) handleListPins(w http.ResponseWriter, r *http.Request) {
+	pins := c.instance.Router().GetPinnedRoutes()
+	list := make([]PinnedRoute, 0, len(pins))
+	for _, pin := range pins {
+		list = append(list, makePinnedRoute(pin))
+	}
+	respond(w, list)
+}
+
+func (c *Control) handlePin(w http.ResponseWriter, r *http.Request) {
+	// Parse request.
+	var req PinnedRoute
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Extend write deadline to wait for the probe.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(pinWriteTimeout))
+
+	// Pin route.
+	pin, err := c.instance.Router().PinRoute(req.Dst, req.Via)
+	switch {
+	case errors.Is(err, router.ErrPinProbeFailed):
+		httpError(w, err, http.StatusGatewayTimeout)
+		return
+	case err != nil:
+		httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	respond(w, makePinnedRoute(*pin))
+}
+
+func (c *Control) handleUnpin(w http.ResponseWriter, r *http.Request) {
+	dst, err := netip.ParseAddr(r.PathValue("dst"))
+	if err != nil {
+		http.Error(w, "invalid destination: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.instance.Router().UnpinRoute(dst)
+	switch {
+	case errors.Is(err, router.ErrRouteNotPinned):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func makePinnedRoute(pin router.PinnedRoute) PinnedRoute {
+	return PinnedRoute{
+		Dst:     pin.Dst,
+		Via:     pin.Via,
+		Hops:    pin.Path.TotalHops,
+		Latency: uint16(min(pin.Latency.Milliseconds(), 0xFFFF)),
+		Pinned:  pin.Pinned,
+	}
+}
@@ -0,0 +1,88 @@
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PolicyCheck is a hypothetical connection to evaluate the policy for.
+type PolicyCheck struct {
+	// Router is the remote router IP or a friend name.
+	Router string `json:"router"`
+	// Protocol is "tcp", "udp", "icmp6" or a protocol number.
+	Protocol string `json:"protocol"`
+	// Port is the local port for inbound and the remote port for outbound
+	// connections.
+	Port    uint16 `json:"port,omitempty"`
+	Inbound bool   `json:"inbound"`
+}
+
+// PolicyResult is the result of a policy dry-run.
+type PolicyResult struct {
+	Router  netip.Addr `json:"router"`
+	Allowed bool       `json:"allowed"`
+	Status  string     `json:"status"`
+	Rule    string     `json:"rule"`
+	Service string     `json:"service,omitempty"`
+
+	GuestExpires  *time.Time `json:"guestExpires,omitempty"`
+	AccessRequest bool       `json:"accessRequest,omitempty"`
+}
+
+func (c *Control) handlePolicyCheck(w http.ResponseWriter, r *http.Request) {
+	// Parse request.
+	var req PolicyCheck
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	remote, err := netip.ParseAddr(req.Router)
+	if err != nil {
+		friend, ok := c.instance.Config().GetFriendByName(req.Router)
+		if !ok {
+			http.Error(w, "router is neither an IP nor a friend name", http.StatusBadRequest)
+			return
+		}
+		remote = friend.IP
+	}
+	protocol, ok := parseProtocol(req.Protocol)
+	if !ok {
+		http.Error(w, "invalid protocol", http.StatusBadRequest)
+		return
+	}
+
+	// Evaluate policy.
+	eval := c.instance.Router().EvaluatePolicy(req.Inbound, remote, protocol, req.Port)
+	result := PolicyResult{
+		Router:        remote,
+		Allowed:       eval.Allowed,
+		Status:        eval.Status,
+		Rule:          string(eval.Rule),
+		Service:       eval.Service,
+		AccessRequest: eval.AccessRequest,
+	}
+	if !eval.GuestExpires.IsZero() {
+		result.GuestExpires = &eval.GuestExpires
+	}
+	respond(w, result)
+}
+
+func parseProtocol(protocol string) (uint8, bool) {
+	switch strings.ToLower(protocol) {
+	case "tcp":
+		return 6, true
+	case "udp":
+		return 17, true
+	case "icmp6", "icmpv6", "ping6":
+		return 58, true
+	}
+	num, err := strconv.ParseUint(protocol, 10, 8)
+	if err != nil {
+		return 0, false
+	}
+	return uint8(num), true
+}
@@ -0,0 +1,70 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// PathProbes holds the results of probing the paths to a destination.
+type PathProbes struct {
+	Time  time.Time          `json:"time"`
+	Dst   netip.Addr         `json:"dst"`
+	Paths []router.PathProbe `json:"paths"`
+}
+
+func (c *Control) handleProbePaths(w http.ResponseWriter, r *http.Request) {
+	// Parse request.
+	dst, err := netip.ParseAddr(r.PathValue("dst"))
+	if err != nil {
+		http.Error(w, "invalid destination: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	paths, err := queryInt(r, "paths", router.DefaultPathProbePaths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	count, err := queryInt(r, "count", router.DefaultPathProbeCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Extend write deadline to wait for the probes.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(pathProbeWriteTimeout))
+
+	probes, err := c.instance.Router().ProbePaths(dst, paths, count)
+	switch {
+	case errors.Is(err, router.ErrNoPathsToProbe):
+		httpError(w, err, http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, err, http.StatusBadRequest)
+		return
+	}
+	respond(w, &PathProbes{
+		Time:  time.Now(),
+		Dst:   dst,
+		Paths: probes,
+	})
+}
+
+// queryInt returns the integer query parameter with the given name or the
+// default, if it is not set.
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("invalid " + name)
+	}
+	return n, nil
+}
@@ -0,0 +1,44 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+func (c *Control) handleListPrompts(w http.ResponseWriter, r *http.Request) {
+	respond(w, c.instance.Router().ExportOutboundPrompts())
+}
+
+func (c *Control) handleAllowPrompt(w http.ResponseWriter, r *http.Request) {
+	c.decidePrompt(w, r, true)
+}
+
+func (c *Control) handleDenyPrompt(w http.ResponseWriter, r *http.Request) {
+	c.decidePrompt(w, r, false)
+}
+
+func (c *Control) decidePrompt(w http.ResponseWriter, r *http.Request, allow bool) {
+	routerIP, err := netip.ParseAddr(r.PathValue("router"))
+	if err != nil {
+		http.Error(w, "invalid router: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if allow {
+		err = c.instance.Router().AllowOutbound(routerIP)
+	} else {
+		err = c.instance.Router().DenyOutbound(routerIP)
+	}
+	switch {
+	case errors.Is(err, router.ErrOutboundPromptNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,81 @@
+package control
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+// Resources holds the resource limits and the current usage.
+// Zero limits mean that there is no limit or that it is unknown.
+type Resources struct {
+	Time time.Time `json:"time"`
+
+	MemoryLimit uint64  `json:"memoryLimit,omitempty"` // In bytes.
+	MemoryUsed  uint64  `json:"memoryUsed"`            // In bytes, as obtained from the OS.
+	CPULimit    float64 `json:"cpuLimit,omitempty"`
+	FDLimit     uint64  `json:"fdLimit,omitempty"`
+	FDsOpen     int     `json:"fdsOpen,omitempty"`
+	Goroutines  int     `json:"goroutines"`
+
+	QueueSize int `json:"queueSize"`
+	Routes    int `json:"routes"`
+	MaxRoutes int `json:"maxRoutes,omitempty"`
+	Peers     int `json:"peers"`
+	MaxPeers  int `json:"maxPeers,omitempty"`
+
+	Connections        int    `json:"connections"`
+	MaxConnections     int    `json:"maxConnections,omitempty"`
+	ConnectionsEvicted uint64 `json:"connectionsEvicted,omitempty"`
+
+	MaxAnnounceHops int `json:"maxAnnounceHops"`
+	// AnnouncesDropped counts announcements dropped for exceeding the hop limit.
+	AnnouncesDropped uint64 `json:"announcesDropped,omitempty"`
+	// AnnouncesStopped counts announcements not forwarded, as they reached
+	// the hop limit.
+	AnnouncesStopped uint64 `json:"announcesStopped,omitempty"`
+
+	// SigsVerified counts verified signatures of announcements.
+	SigsVerified uint64 `json:"sigsVerified"`
+	// SigCacheHits counts signatures that did not need to be verified again.
+	SigCacheHits uint64 `json:"sigCacheHits"`
+}
+
+func (c *Control) handleResources(w http.ResponseWriter, r *http.Request) {
+	cfg := c.instance.Config()
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	connStats := c.instance.Router().ConnTableStats()
+	announceStats := c.instance.Router().AnnouncePing.Stats()
+	respond(w, &Resources{
+		Time: time.Now(),
+
+		MemoryLimit: cfg.Resources.MemoryLimit,
+		MemoryUsed:  memStats.Sys,
+		CPULimit:    cfg.Resources.CPULimit,
+		FDLimit:     cfg.Resources.FDLimit,
+		FDsOpen:     config.OpenFDs(),
+		Goroutines:  runtime.NumGoroutine(),
+
+		QueueSize: cfg.Limits.QueueSize,
+		Routes:    c.instance.Router().Table().Size(),
+		MaxRoutes: cfg.Limits.MaxRoutes,
+		Peers:     len(c.instance.Peering().GetLinks()),
+		MaxPeers:  cfg.Limits.MaxPeers,
+
+		Connections:        connStats.Entries,
+		MaxConnections:     connStats.Max,
+		ConnectionsEvicted: connStats.Evicted,
+
+		MaxAnnounceHops:  announceStats.MaxHops,
+		AnnouncesDropped: announceStats.Dropped,
+		AnnouncesStopped: announceStats.Stopped,
+
+		SigsVerified: announceStats.Sigs.Verified,
+		SigCacheHits: announceStats.Sigs.Hits,
+	})
+}
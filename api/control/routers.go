@@ -0,0 +1,73 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/storage"
+)
+
+// RouterDetails is the known information about another router.
+// The version, the operator details, the listeners and the capabilities are
+// taken from the announcements of the router, which must be signed by it.
+type RouterDetails struct {
+	Router    netip.Addr `json:"router"`
+	Peer      bool       `json:"peer"`
+	Version   string     `json:"version,omitempty"`
+	Universe  string     `json:"universe,omitempty"`
+	Offline   bool       `json:"offline,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+
+	// StatusText, Contact and Operator are set by the operator of the router.
+	StatusText string          `json:"statusText,omitempty"`
+	Contact    string          `json:"contact,omitempty"`
+	Operator   *m.OperatorInfo `json:"operator,omitempty"`
+
+	Listeners    []string             `json:"listeners,omitempty"`
+	IANA         []string             `json:"iana,omitempty"`
+	Reachability *m.ReachabilityHints `json:"reachability,omitempty"`
+	// Capabilities are the protocol features the router supports.
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+func (c *Control) handleRouter(w http.ResponseWriter, r *http.Request) {
+	ip, err := netip.ParseAddr(r.PathValue("ip"))
+	if err != nil {
+		http.Error(w, "invalid router: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stored, err := c.instance.Storage().GetRouter(ip)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "router unknown", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	details := RouterDetails{
+		Router:    ip,
+		Peer:      c.instance.Peering().GetLink(ip) != nil,
+		Universe:  stored.Universe,
+		Offline:   stored.Offline,
+		UpdatedAt: stored.UpdatedAt,
+	}
+	if info := stored.PublicInfo; info != nil {
+		details.Version = info.Version
+		details.StatusText = info.Status
+		details.Contact = info.Contact
+		details.Operator = info.Operator
+		details.Listeners = info.Listeners
+		details.IANA = info.IANA
+		details.Reachability = info.Reachability
+		if info.Capabilities.Known() {
+			details.Capabilities = info.Capabilities.Names()
+		}
+	}
+	respond(w, details)
+}
@@ -0,0 +1,53 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestRouterDetails(t *testing.T) {
+	t.Parallel()
+
+	c := newTestControl(t)
+	get := func(ip string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, Path+"/routers/"+ip, nil)
+		r.SetPathValue("ip", ip)
+		w := httptest.NewRecorder()
+		c.handleRouter(w, r)
+		return w
+	}
+	router, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, get("invalid").Code)
+	assert.Equal(t, http.StatusNotFound, get(router.IP.String()).Code)
+
+	// Details are taken from the announced info.
+	require.NoError(t, c.instance.Storage().SaveRouter(&storage.StoredRouter{
+		Address: &router.PublicAddress,
+		PublicInfo: &m.RouterInfo{
+			Version:  "1.2.3",
+			Contact:  "mailto:ops@example.com",
+			Operator: &m.OperatorInfo{Name: "Example"},
+		},
+	}))
+	w := get(router.IP.String())
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var details RouterDetails
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, router.IP, details.Router)
+	assert.False(t, details.Peer)
+	assert.Equal(t, "1.2.3", details.Version)
+	assert.Equal(t, "mailto:ops@example.com", details.Contact)
+	assert.Equal(t, &m.OperatorInfo{Name: "Example"}, details.Operator)
+}
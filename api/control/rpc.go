@@ -0,0 +1,263 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/mycoria/mycoria/api/control/controlpb"
+	"github.com/mycoria/mycoria/api/control/controlpb/controlpbconnect"
+	"github.com/mycoria/mycoria/peering"
+)
+
+// rpcService implements the control service defined in controlpb.
+// It serves the Connect, gRPC and gRPC-Web protocols and mirrors the status,
+// events and table endpoints of the HTTP control API.
+type rpcService struct {
+	c *Control
+}
+
+var _ controlpbconnect.ControlServiceHandler = &rpcService{}
+
+// rpcHandler returns the path and handler of the control service.
+func (c *Control) rpcHandler() (string, http.Handler) {
+	path, handler := controlpbconnect.NewControlServiceHandler(&rpcService{c: c})
+	return path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Disable write timeout of the http server for streams.
+		if r.URL.Path != controlpbconnect.ControlServiceGetStatusProcedure {
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+				http.Error(w, fmt.Sprintf("disable write deadline: %s", err), http.StatusInternalServerError)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// GetStatus returns the current status of the router.
+func (s *rpcService) GetStatus(
+	ctx context.Context,
+	req *connect.Request[controlpb.GetStatusRequest],
+) (*connect.Response[controlpb.Status], error) {
+	return connect.NewResponse(makeStatusMsg(s.c.getStatus())), nil
+}
+
+// WatchStatus streams the status of the router in an interval.
+func (s *rpcService) WatchStatus(
+	ctx context.Context,
+	req *connect.Request[controlpb.WatchStatusRequest],
+	stream *connect.ServerStream[controlpb.Status],
+) error {
+	interval := defaultWatchInterval
+	if req.Msg.GetInterval() != nil {
+		if err := req.Msg.GetInterval().CheckValid(); err != nil {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid interval: %w", err))
+		}
+		interval = max(req.Msg.GetInterval().AsDuration(), minWatchInterval)
+	}
+
+	var sendErr error
+	s.c.watchStatus(ctx, interval, func(status *Status) error {
+		sendErr = stream.Send(makeStatusMsg(status))
+		return sendErr
+	})
+	return sendErr
+}
+
+// WatchEvents streams router events until the client disconnects.
+func (s *rpcService) WatchEvents(
+	ctx context.Context,
+	req *connect.Request[controlpb.WatchEventsRequest],
+	stream *connect.ServerStream[controlpb.Event],
+) error {
+	q, err := makeRPCListQuery(req.Msg.GetRemote(), req.Msg.GetPrefix(), req.Msg.GetStatus())
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	s.c.watchEvents(ctx, func(event Event) bool {
+		if !matchEvent(q, req.Msg.GetTypes(), event) {
+			return true
+		}
+		sendErr = stream.Send(makeEventMsg(event))
+		return sendErr == nil
+	})
+	return sendErr
+}
+
+// WatchTable streams the routing table whenever it changes.
+func (s *rpcService) WatchTable(
+	ctx context.Context,
+	req *connect.Request[controlpb.WatchTableRequest],
+	stream *connect.ServerStream[controlpb.Table],
+) error {
+	q, err := makeRPCListQuery(req.Msg.GetRemote(), req.Msg.GetPrefix(), req.Msg.GetStatus())
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	s.c.watchTable(ctx, q, func(table *Table) error {
+		sendErr = stream.Send(makeTableMsg(table))
+		return sendErr
+	})
+	return sendErr
+}
+
+// makeRPCListQuery returns a list query with the given filters.
+func makeRPCListQuery(remote, prefix, status string) (*listQuery, error) {
+	q := &listQuery{
+		status: status,
+	}
+	if remote != "" {
+		var err error
+		q.remote, err = netip.ParseAddr(remote)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid remote: %w", err))
+		}
+	}
+	if prefix != "" {
+		p, err := netip.ParsePrefix(prefix)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid prefix: %w", err))
+		}
+		q.prefix = p.Masked()
+	}
+	return q, nil
+}
+
+func makeStatusMsg(status *Status) *controlpb.Status {
+	msg := &controlpb.Status{
+		Version:      status.Version,
+		Router:       status.Router.String(),
+		Started:      timestamppb.New(status.Started),
+		Uptime:       durationpb.New(status.Uptime),
+		Stub:         status.Stub,
+		Peers:        make([]*controlpb.Peer, 0, len(status.Peers)),
+		Routes:       int64(status.Routes),
+		Friends:      int64(status.Friends),
+		DevMode:      status.DevMode,
+		Universe:     status.Universe,
+		PeerFailures: make([]*controlpb.ConnectFailure, 0, len(status.PeerFailures)),
+		StatusText:   status.StatusText,
+		Contact:      status.Contact,
+		ClockSkew:    durationpb.New(status.ClockSkew),
+		NatIpv4:      status.NATIPv4,
+		NatIpv6:      status.NATIPv6,
+		Crashes:      status.Crashes,
+	}
+	for _, peer := range status.Peers {
+		msg.Peers = append(msg.Peers, makePeerMsg(peer))
+	}
+	for _, failure := range status.PeerFailures {
+		msg.PeerFailures = append(msg.PeerFailures, makeConnectFailureMsg(failure))
+	}
+	return msg
+}
+
+func makePeerMsg(peer Peer) *controlpb.Peer {
+	return &controlpb.Peer{
+		Router:       peer.Router.String(),
+		PeeringUrl:   peer.PeeringURL,
+		Outgoing:     peer.Outgoing,
+		Lite:         peer.Lite,
+		Uptime:       durationpb.New(peer.Uptime),
+		LatencyMs:    uint32(peer.Latency),
+		BytesIn:      peer.BytesIn,
+		BytesOut:     peer.BytesOut,
+		ClockSkew:    durationpb.New(peer.ClockSkew),
+		ObservedAddr: peer.ObservedAddr,
+		Capabilities: peer.Capabilities,
+		GeoLocated:   peer.GeoLocated,
+		GeoMismatch:  peer.GeoMismatch,
+		GeoFlagged:   peer.GeoFlagged,
+	}
+}
+
+func makeConnectFailureMsg(failure peering.ConnectFailure) *controlpb.ConnectFailure {
+	return &controlpb.ConnectFailure{
+		PeeringUrl: failure.PeeringURL,
+		Reason:     string(failure.Reason),
+		Hint:       failure.Hint,
+		Error:      failure.Error,
+		Code:       string(failure.Code),
+		Since:      timestamppb.New(failure.Since),
+		Last:       timestamppb.New(failure.Last),
+		Attempts:   int64(failure.Attempts),
+	}
+}
+
+func makeEventMsg(event Event) *controlpb.Event {
+	msg := &controlpb.Event{
+		Type:     event.Type,
+		Time:     timestamppb.New(event.Time),
+		Router:   event.Router.String(),
+		State:    event.State,
+		Ports:    int64(event.Ports),
+		Module:   event.Module,
+		Worker:   event.Worker,
+		Recovery: event.Recovery,
+		Service:  event.Service,
+		Country:  event.Country,
+		Attempts: int64(event.Attempts),
+		Routers:  int64(event.Routers),
+		Code:     string(event.Code),
+		Port:     uint32(event.Port),
+	}
+	if event.BlockedUntil != nil {
+		msg.BlockedUntil = timestamppb.New(*event.BlockedUntil)
+	}
+	if event.Stuck != 0 {
+		msg.Stuck = durationpb.New(event.Stuck)
+	}
+	if event.Dst != nil {
+		msg.Dst = event.Dst.String()
+	}
+	if event.ReportedBy != nil {
+		msg.ReportedBy = event.ReportedBy.String()
+	}
+	return msg
+}
+
+func makeTableMsg(table *Table) *controlpb.Table {
+	msg := &controlpb.Table{
+		Time:      timestamppb.New(table.Time),
+		Routes:    make([]*controlpb.Route, 0, len(table.Routes)),
+		HoldDowns: make([]*controlpb.HoldDown, 0, len(table.HoldDowns)),
+	}
+	for _, route := range table.Routes {
+		routeMsg := &controlpb.Route{
+			Dst:         route.Dst.String(),
+			Prefix:      route.Prefix,
+			NextHop:     route.NextHop.String(),
+			Hops:        uint32(route.Hops),
+			DelayMs:     uint32(route.Delay),
+			Stub:        route.Stub,
+			Source:      route.Source,
+			Expires:     timestamppb.New(route.Expires),
+			Implausible: route.Implausible,
+		}
+		if !route.Learned.IsZero() {
+			routeMsg.Learned = timestamppb.New(route.Learned)
+		}
+		if route.Alternatives > 0 {
+			routeMsg.Alternatives = uint32(route.Alternatives) //nolint:gosec // Limited by routes per destination.
+		}
+		msg.Routes = append(msg.Routes, routeMsg)
+	}
+	for _, hd := range table.HoldDowns {
+		msg.HoldDowns = append(msg.HoldDowns, &controlpb.HoldDown{
+			Router:    hd.Router.String(),
+			Withdrawn: timestamppb.New(hd.Withdrawn),
+			Until:     timestamppb.New(hd.Until),
+		})
+	}
+	return msg
+}
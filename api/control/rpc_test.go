@@ -0,0 +1,128 @@
+package control
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/mycoria/mycoria/api/control/controlpb"
+	"github.com/mycoria/mycoria/api/control/controlpb/controlpbconnect"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/router"
+)
+
+func TestRPCService(t *testing.T) {
+	t.Parallel()
+
+	c := newTestControl(t)
+	mux := http.NewServeMux()
+	mux.Handle(c.rpcHandler())
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Status is served via all protocols.
+	for _, opts := range [][]connect.ClientOption{
+		nil,
+		{connect.WithGRPC()},
+		{connect.WithGRPCWeb()},
+	} {
+		client := controlpbconnect.NewControlServiceClient(srv.Client(), srv.URL, opts...)
+		resp, err := client.GetStatus(ctx, connect.NewRequest(&controlpb.GetStatusRequest{}))
+		require.NoError(t, err)
+		assert.Equal(t, "test", resp.Msg.GetVersion())
+		assert.Equal(t, c.instance.Identity().IP.String(), resp.Msg.GetRouter())
+	}
+	client := controlpbconnect.NewControlServiceClient(srv.Client(), srv.URL, connect.WithGRPC())
+
+	// Watch status.
+	started := time.Now()
+	status, err := client.WatchStatus(ctx, connect.NewRequest(&controlpb.WatchStatusRequest{
+		Interval: durationpb.New(time.Millisecond),
+	}))
+	require.NoError(t, err)
+	for range 2 {
+		require.True(t, status.Receive(), status.Err())
+		assert.Equal(t, "test", status.Msg().GetVersion())
+	}
+	assert.GreaterOrEqual(t, time.Since(started), minWatchInterval, "interval must be raised to the minimum")
+	require.NoError(t, status.Close())
+
+	// Watch table.
+	peer, _, err := m.GenerateRoutableAddress(ctx, []netip.Prefix{
+		m.MustPrefix([]byte{m.BaseNet, m.TypeRoutingAddress | m.ContinentEurope}, 12),
+	})
+	require.NoError(t, err)
+	_, err = c.instance.Router().Table().AddRoute(m.RoutingTableEntry{
+		DstIP:   peer.IP,
+		NextHop: peer.IP,
+		Source:  m.RouteSourcePeer,
+		Expires: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	table, err := client.WatchTable(ctx, connect.NewRequest(&controlpb.WatchTableRequest{
+		Remote: peer.IP.String(),
+	}))
+	require.NoError(t, err)
+	require.True(t, table.Receive(), table.Err())
+	require.Len(t, table.Msg().GetRoutes(), 1)
+	assert.Equal(t, peer.IP.String(), table.Msg().GetRoutes()[0].GetDst())
+	assert.Equal(t, m.RouteSourcePeer.String(), table.Msg().GetRoutes()[0].GetSource())
+	require.NoError(t, table.Close())
+
+	// Invalid filters are rejected.
+	table, err = client.WatchTable(ctx, connect.NewRequest(&controlpb.WatchTableRequest{
+		Prefix: "invalid",
+	}))
+	require.NoError(t, err)
+	assert.False(t, table.Receive())
+	assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(table.Err()))
+
+	// Watch events.
+	submitCtx, stopSubmit := context.WithCancel(ctx)
+	defer stopSubmit()
+	go func() {
+		// Submit until received, as the stream subscribes asynchronously.
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			c.instance.Peering().PeeringEvents.Submit(&peering.EventPeering{
+				Peer:  peer.IP,
+				State: peering.EventStateUp,
+			})
+			c.instance.Router().ScanEvents.Submit(&router.EventScan{
+				Router: peer.IP,
+				Ports:  10,
+			})
+
+			select {
+			case <-ticker.C:
+			case <-submitCtx.Done():
+				return
+			}
+		}
+	}()
+	events, err := client.WatchEvents(ctx, connect.NewRequest(&controlpb.WatchEventsRequest{
+		Types: []string{EventTypeScan},
+	}))
+	require.NoError(t, err)
+	require.True(t, events.Receive(), events.Err())
+	stopSubmit()
+	assert.Equal(t, EventTypeScan, events.Msg().GetType(), "other event types must be filtered")
+	assert.Equal(t, peer.IP.String(), events.Msg().GetRouter())
+	assert.Equal(t, int64(10), events.Msg().GetPorts())
+	require.NoError(t, events.Close())
+}
@@ -0,0 +1,73 @@
+package control
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// ServiceUsage holds the usage statistics of all configured services.
+type ServiceUsage struct {
+	Time     time.Time             `json:"time"`
+	Services []router.ServiceUsage `json:"services"`
+}
+
+func (c *Control) handleServiceUsage(w http.ResponseWriter, r *http.Request) {
+	usage := &ServiceUsage{
+		Time:     time.Now(),
+		Services: c.instance.Router().ServiceUsage(),
+	}
+	// Only include history, if requested.
+	if r.URL.Query().Get("history") != "true" {
+		for i := range usage.Services {
+			usage.Services[i].History = nil
+		}
+	}
+	respond(w, usage)
+}
+
+// DeniedAttempts holds the denied attempts to services with denied
+// notifications enabled, aggregated by service and country.
+type DeniedAttempts struct {
+	Time     time.Time               `json:"time"`
+	Attempts []router.DeniedAttempts `json:"attempts"`
+	ListInfo
+}
+
+// deniedSorting holds the sort keys of denied attempts.
+var deniedSorting = map[string]func(a, b router.DeniedAttempts) int{
+	"service":  func(a, b router.DeniedAttempts) int { return cmp.Compare(a.Service, b.Service) },
+	"attempts": func(a, b router.DeniedAttempts) int { return cmp.Compare(a.Attempts, b.Attempts) },
+	"routers":  func(a, b router.DeniedAttempts) int { return cmp.Compare(a.Routers, b.Routers) },
+	"lastSeen": func(a, b router.DeniedAttempts) int { return a.LastSeen.Compare(b.LastSeen) },
+}
+
+func (c *Control) handleDeniedAttempts(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r, []string{filterStatus, filterSince}, deniedSorting)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, makeDeniedAttempts(c.instance.Router().ExportDeniedAttempts(), q))
+}
+
+// makeDeniedAttempts returns the denied attempts matching the query.
+// The status filter matches "notified". The since filter matches the last
+// attempt.
+func makeDeniedAttempts(all []router.DeniedAttempts, q *listQuery) *DeniedAttempts {
+	matching := slices.DeleteFunc(all, func(attempts router.DeniedAttempts) bool {
+		var statuses []string
+		if attempts.Notified {
+			statuses = append(statuses, "notified")
+		}
+		return !q.matchStatus(statuses...) || !q.matchSince(attempts.LastSeen)
+	})
+
+	denied := &DeniedAttempts{Time: time.Now()}
+	denied.Attempts, denied.ListInfo = paginate(q, matching, deniedSorting)
+	return denied
+}
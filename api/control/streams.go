@@ -0,0 +1,220 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/streams"
+)
+
+// StreamUpgrade is the value of the Upgrade header for stream requests.
+// After the "101 Switching Protocols" response, the connection carries the
+// raw stream.
+const StreamUpgrade = "mycoria-stream"
+
+// StreamRouterHeader holds the IP of the other router in stream responses.
+const StreamRouterHeader = "Mycoria-Router"
+
+// apiListener is a stream listener created via the API.
+// It is kept until the API stops or the router restarts, so that streams may
+// wait to be accepted between requests.
+type apiListener struct {
+	listener *streams.Listener
+	public   bool
+	// app is the name of the app that created the listener, if any.
+	app string
+}
+
+func (c *Control) handleConnectStream(w http.ResponseWriter, r *http.Request) {
+	c.connectStream(w, r, context.Background())
+}
+
+// connectStream opens a stream and upgrades the request to it.
+// The stream is closed when stop is canceled.
+func (c *Control) connectStream(w http.ResponseWriter, r *http.Request, stop context.Context) {
+	if !prepareStreamUpgrade(w, r) {
+		return
+	}
+	dst, ok := c.streamRouter(r.PathValue("router"))
+	if !ok {
+		http.Error(w, "router is neither an IP nor a friend name", http.StatusBadRequest)
+		return
+	}
+
+	s, err := c.instance.Router().Streams.Open(r.Context(), dst, r.PathValue("service"))
+	if err != nil {
+		respondStreamError(w, err)
+		return
+	}
+	c.upgradeStream(w, s, stop)
+}
+
+func (c *Control) handleAcceptStream(w http.ResponseWriter, r *http.Request) {
+	service := r.PathValue("service")
+	if c.inAppNamespace(service) {
+		http.Error(w, "service is in the namespace of an app", http.StatusForbidden)
+		return
+	}
+	c.acceptStream(w, r, service, "", context.Background())
+}
+
+// acceptStream accepts a stream of the given service on behalf of the given
+// app and upgrades the request to it. The stream is closed when stop is
+// canceled.
+func (c *Control) acceptStream(w http.ResponseWriter, r *http.Request, service, app string, stop context.Context) {
+	if !prepareStreamUpgrade(w, r) {
+		return
+	}
+	public, _ := strconv.ParseBool(r.URL.Query().Get("public"))
+
+	// Get or create listener.
+	c.streamListenersLock.Lock()
+	l, ok := c.streamListeners[service]
+	if ok && l.listener.Closed() {
+		// Listeners are closed when the router is restarted.
+		delete(c.streamListeners, service)
+		ok = false
+	}
+	if !ok {
+		var allow func(netip.Addr) bool
+		if !public {
+			allow = func(ip netip.Addr) bool {
+				_, isFriend := c.instance.Config().GetFriendByIP(ip)
+				return isFriend
+			}
+		}
+		listener, err := c.instance.Router().Streams.Listen(service, allow)
+		if err != nil {
+			c.streamListenersLock.Unlock()
+			respondStreamError(w, err)
+			return
+		}
+		l = &apiListener{listener: listener, public: public, app: app}
+		c.streamListeners[service] = l
+	}
+	c.streamListenersLock.Unlock()
+	switch {
+	case l.app != app:
+		http.Error(w, "service is already listening for someone else", http.StatusConflict)
+		return
+	case l.public != public:
+		http.Error(w, "service is already listening with different visibility", http.StatusConflict)
+		return
+	}
+
+	s, err := l.listener.AcceptStream(r.Context())
+	if err != nil {
+		respondStreamError(w, err)
+		return
+	}
+	c.upgradeStream(w, s, stop)
+}
+
+// upgradeStream takes over the connection of the request and pipes it to
+// the given stream until either side closes or stop is canceled.
+func (c *Control) upgradeStream(w http.ResponseWriter, s *streams.Stream, stop context.Context) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		_ = s.Close()
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		_ = s.Close()
+		http.Error(w, "failed to upgrade connection: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	// Write response.
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Upgrade: "+StreamUpgrade+"\r\n"+
+		StreamRouterHeader+": "+s.Router().String()+"\r\n\r\n")
+	if err != nil {
+		_ = s.Close()
+		_ = conn.Close()
+		return
+	}
+
+	// Pipe data in both directions.
+	stopAfter := context.AfterFunc(stop, func() {
+		_ = conn.Close()
+		_ = s.Close()
+	})
+	sent := make(chan struct{})
+	c.mgr.Go("api to stream", func(w *mgr.WorkerCtx) error {
+		defer close(sent)
+		// Read buffered data first.
+		_, _ = io.Copy(s, buf.Reader)
+		_ = s.CloseWrite()
+		return nil
+	})
+	c.mgr.Go("stream to api", func(w *mgr.WorkerCtx) error {
+		_, err := io.Copy(conn, s)
+		if err != nil {
+			// Stream failed, stop sending too.
+			_ = conn.Close()
+		} else if tcpConn, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = tcpConn.CloseWrite()
+		}
+		<-sent
+		stopAfter()
+		_ = conn.Close()
+		_ = s.Close()
+		return nil
+	})
+}
+
+// prepareStreamUpgrade checks if the request upgrades to a stream and
+// disables the write timeout of the http server, as opening and accepting
+// streams may take a while.
+func prepareStreamUpgrade(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Upgrade") != StreamUpgrade {
+		http.Error(w, "request must upgrade to "+StreamUpgrade, http.StatusUpgradeRequired)
+		return false
+	}
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "failed to disable write deadline: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// closeStreamListeners closes all listeners created via the API.
+func (c *Control) closeStreamListeners() {
+	c.streamListenersLock.Lock()
+	defer c.streamListenersLock.Unlock()
+
+	for service, l := range c.streamListeners {
+		_ = l.listener.Close()
+		delete(c.streamListeners, service)
+	}
+}
+
+func respondStreamError(w http.ResponseWriter, err error) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, streams.ErrInvalidService):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, streams.ErrServiceInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, streams.ErrTooManyStreams),
+		errors.Is(err, streams.ErrListenerClosed):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, streams.ErrStreamReset):
+		httpError(w, err, http.StatusBadGateway)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		httpError(w, err, http.StatusGatewayTimeout)
+	default:
+		httpError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,115 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+// TransferRequest offers a message or file to a friend.
+type TransferRequest struct {
+	// Router is the IP or name of a friend.
+	Router string              `json:"router"`
+	Kind   router.TransferKind `json:"kind"`
+	// Name is the file name.
+	Name string `json:"name,omitempty"`
+	Data []byte `json:"data"`
+}
+
+// TransferData is the data of a received transfer.
+type TransferData struct {
+	Transfer router.Transfer `json:"transfer"`
+	Data     []byte          `json:"data"`
+}
+
+func (c *Control) handleListTransfers(w http.ResponseWriter, r *http.Request) {
+	respond(w, c.instance.Router().TransferPing.Export())
+}
+
+func (c *Control) handleOfferTransfer(w http.ResponseWriter, r *http.Request) {
+	// Extend deadlines to read large files.
+	extendTransferDeadlines(w)
+
+	// Parse request. Data is base64 encoded.
+	var req TransferRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, router.MaxTransferSize/3*4+10_000)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	dst, err := netip.ParseAddr(req.Router)
+	if err != nil {
+		friend, ok := c.instance.Config().GetFriendByName(req.Router)
+		if !ok {
+			http.Error(w, "router is neither an IP nor a friend name", http.StatusBadRequest)
+			return
+		}
+		dst = friend.IP
+	}
+
+	transfer, err := c.instance.Router().TransferPing.Offer(dst, req.Kind, req.Name, req.Data)
+	if err != nil {
+		respondTransferError(w, err)
+		return
+	}
+	respond(w, transfer)
+}
+
+func (c *Control) handleAcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	if err := c.instance.Router().TransferPing.Accept(r.PathValue("id")); err != nil {
+		respondTransferError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Control) handleDeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	if err := c.instance.Router().TransferPing.Decline(r.PathValue("id")); err != nil {
+		respondTransferError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Control) handleTakeTransferData(w http.ResponseWriter, r *http.Request) {
+	// Extend deadline to write large files.
+	extendTransferDeadlines(w)
+
+	transfer, data, err := c.instance.Router().TransferPing.TakeData(r.PathValue("id"))
+	if err != nil {
+		respondTransferError(w, err)
+		return
+	}
+	respond(w, &TransferData{
+		Transfer: transfer,
+		Data:     data,
+	})
+}
+
+// extendTransferDeadlines extends the read and write deadlines of the
+// connection, as transferred files are too large for the default timeouts.
+func extendTransferDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(transferTimeout)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
+
+func respondTransferError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, router.ErrTransferNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, router.ErrTransferState),
+		errors.Is(err, router.ErrTransferLimit):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, router.ErrTransferNotFriend),
+		errors.Is(err, router.ErrTransferTooBig),
+		errors.Is(err, router.ErrTransferInvalidName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		httpError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,49 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mycoria/mycoria/updater"
+)
+
+func (c *Control) handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	respond(w, c.instance.Updater().Status())
+}
+
+func (c *Control) handleUpdateCheck(w http.ResponseWriter, r *http.Request) {
+	status, err := c.instance.Updater().Check(r.Context())
+	if err != nil {
+		respondUpdateError(w, err)
+		return
+	}
+	respond(w, status)
+}
+
+func (c *Control) handleUpdateInstall(w http.ResponseWriter, r *http.Request) {
+	// Extend write deadline to wait for the download.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(updateWriteTimeout))
+
+	status, err := c.instance.Updater().Install(r.Context())
+	if err != nil {
+		respondUpdateError(w, err)
+		return
+	}
+	respond(w, status)
+}
+
+func respondUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, updater.ErrDisabled):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, updater.ErrNoUpdate),
+		errors.Is(err, updater.ErrInstalled),
+		errors.Is(err, updater.ErrUnknownVersion),
+		errors.Is(err, updater.ErrNoBinary):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,201 @@
+package dns
+
+import (
+	"container/list"
+	"errors"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mycoria/mycoria/storage"
+)
+
+// MappingCache is an in-memory LRU cache in front of a domain mapping storage.
+// Writes go through the cache and invalidate the affected entry.
+type MappingCache struct {
+	storage storage.DomainMappingStorage
+	ttl     time.Duration
+	size    int
+
+	entries map[string]*list.Element
+	lru     *list.List
+	lock    sync.Mutex
+	// generation is increased on every invalidation, so that mappings read
+	// from the storage before a concurrent write are not cached.
+	generation uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+var _ storage.DomainMappingStorage = &MappingCache{}
+
+type mappingCacheEntry struct {
+	domain  string
+	router  netip.Addr // Invalid if domain has no mapping.
+	expires time.Time
+}
+
+// MappingCacheStats holds statistics of the mapping cache.
+type MappingCacheStats struct {
+	Entries   int
+	Size      int
+	TTL       time.Duration
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// HitRate returns the percentage of lookups answered from the cache.
+func (s MappingCacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) * 100 / float64(total)
+}
+
+// NewMappingCache returns a new mapping cache in front of the given storage.
+// If size is zero or negative, caching is disabled and all requests go
+// directly to the storage.
+func NewMappingCache(mappings storage.DomainMappingStorage, ttl time.Duration, size int) *MappingCache {
+	return &MappingCache{
+		storage: mappings,
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// GetMapping returns the router the given domain is mapped to.
+// Both existing and missing mappings are cached.
+func (mc *MappingCache) GetMapping(domain string) (router netip.Addr, err error) {
+	if mc.size <= 0 {
+		return mc.storage.GetMapping(domain)
+	}
+
+	// Check cache.
+	entry, generation, ok := mc.get(domain)
+	if ok {
+		mc.hits.Add(1)
+		if !entry.router.IsValid() {
+			return netip.Addr{}, storage.ErrNotFound
+		}
+		return entry.router, nil
+	}
+	mc.misses.Add(1)
+
+	// Get from storage and cache result.
+	router, err = mc.storage.GetMapping(domain)
+	switch {
+	case err == nil:
+		mc.set(domain, router, generation)
+	case errors.Is(err, storage.ErrNotFound):
+		mc.set(domain, netip.Addr{}, generation)
+	}
+	return router, err
+}
+
+// QueryMappings queries the storage for mappings. It is not cached.
+func (mc *MappingCache) QueryMappings(search string) ([]storage.StoredMapping, error) {
+	return mc.storage.QueryMappings(search)
+}
+
+// SaveMapping saves the mapping to the storage and invalidates the cache entry.
+func (mc *MappingCache) SaveMapping(domain string, router netip.Addr) error {
+	defer mc.invalidate(domain)
+	return mc.storage.SaveMapping(domain, router)
+}
+
+// DeleteMapping deletes the mapping from the storage and invalidates the cache entry.
+func (mc *MappingCache) DeleteMapping(domain string) error {
+	defer mc.invalidate(domain)
+	return mc.storage.DeleteMapping(domain)
+}
+
+// Stats returns the cache statistics.
+func (mc *MappingCache) Stats() MappingCacheStats {
+	mc.lock.Lock()
+	entries := mc.lru.Len()
+	mc.lock.Unlock()
+
+	return MappingCacheStats{
+		Entries:   entries,
+		Size:      mc.size,
+		TTL:       mc.ttl,
+		Hits:      mc.hits.Load(),
+		Misses:    mc.misses.Load(),
+		Evictions: mc.evictions.Load(),
+	}
+}
+
+// get returns the cached entry of the domain. It also returns the current
+// generation, which must be passed to set when filling the cache.
+func (mc *MappingCache) get(domain string) (entry *mappingCacheEntry, generation uint64, ok bool) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	elem, ok := mc.entries[domain]
+	if !ok {
+		return nil, mc.generation, false
+	}
+	entry = elem.Value.(*mappingCacheEntry) //nolint:forcetypeassert // Only entries are in the list.
+
+	// Remove expired entry.
+	if time.Now().After(entry.expires) {
+		mc.lru.Remove(elem)
+		delete(mc.entries, domain)
+		return nil, mc.generation, false
+	}
+
+	mc.lru.MoveToFront(elem)
+	return entry, mc.generation, true
+}
+
+// set caches the mapping, unless the cache was invalidated since the given
+// generation, as the mapping might be stale.
+func (mc *MappingCache) set(domain string, router netip.Addr, generation uint64) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	if generation != mc.generation {
+		return
+	}
+
+	entry := &mappingCacheEntry{
+		domain:  domain,
+		router:  router,
+		expires: time.Now().Add(mc.ttl),
+	}
+
+	// Update existing entry.
+	if elem, ok := mc.entries[domain]; ok {
+		elem.Value = entry
+		mc.lru.MoveToFront(elem)
+		return
+	}
+
+	// Evict least recently used entries.
+	for mc.lru.Len() >= mc.size {
+		oldest := mc.lru.Back()
+		mc.lru.Remove(oldest)
+		delete(mc.entries, oldest.Value.(*mappingCacheEntry).domain) //nolint:forcetypeassert // Only entries are in the list.
+		mc.evictions.Add(1)
+	}
+
+	mc.entries[domain] = mc.lru.PushFront(entry)
+}
+
+func (mc *MappingCache) invalidate(domain string) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	mc.generation++
+	if elem, ok := mc.entries[domain]; ok {
+		mc.lru.Remove(elem)
+		delete(mc.entries, domain)
+	}
+}
@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestMappingCache(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemStorage()
+	cache := NewMappingCache(store, time.Minute, 2)
+	routerA := netip.MustParseAddr("fd00::a")
+	routerB := netip.MustParseAddr("fd00::b")
+
+	// Missing mappings are cached too.
+	if _, err := cache.GetMapping("a.example"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := cache.GetMapping("a.example"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected cached not found, got %v", err)
+	}
+
+	// Saving invalidates the cached entry.
+	if err := cache.SaveMapping("a.example", routerA); err != nil {
+		t.Fatal(err)
+	}
+	if router, err := cache.GetMapping("a.example"); err != nil || router != routerA {
+		t.Fatalf("expected %s, got %s (%v)", routerA, router, err)
+	}
+
+	// Fill cache over its size to evict the least recently used entry.
+	if err := cache.SaveMapping("b.example", routerB); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = cache.GetMapping("b.example")
+	_, _ = cache.GetMapping("c.example")
+
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("expected 2 entries and 1 eviction, got %+v", stats)
+	}
+	if stats.Hits != 1 || stats.Misses != 4 {
+		t.Errorf("expected 1 hit and 4 misses, got %+v", stats)
+	}
+
+	// Deleting invalidates the cached entry.
+	if err := cache.DeleteMapping("b.example"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.GetMapping("b.example"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
+
+// racingMappingStorage saves a mapping while a lookup is in progress.
+type racingMappingStorage struct {
+	storage.DomainMappingStorage
+
+	onGet func()
+}
+
+func (s *racingMappingStorage) GetMapping(domain string) (netip.Addr, error) {
+	router, err := s.DomainMappingStorage.GetMapping(domain)
+	if s.onGet != nil {
+		onGet := s.onGet
+		s.onGet = nil
+		onGet()
+	}
+	return router, err
+}
+
+func TestMappingCacheConcurrentWrite(t *testing.T) {
+	t.Parallel()
+
+	store := &racingMappingStorage{DomainMappingStorage: storage.NewMemStorage()}
+	cache := NewMappingCache(store, time.Minute, 10)
+	routerA := netip.MustParseAddr("fd00::a")
+	routerB := netip.MustParseAddr("fd00::b")
+	if err := cache.SaveMapping("a.example", routerA); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mapping changes after the lookup read it from the storage.
+	store.onGet = func() {
+		if err := cache.SaveMapping("a.example", routerB); err != nil {
+			t.Error(err)
+		}
+	}
+	if router, err := cache.GetMapping("a.example"); err != nil || router != routerA {
+		t.Fatalf("expected %s, got %s (%v)", routerA, router, err)
+	}
+
+	// The stale mapping must not be cached.
+	if router, err := cache.GetMapping("a.example"); err != nil || router != routerB {
+		t.Fatalf("expected %s, got %s (%v)", routerB, router, err)
+	}
+}
@@ -1,11 +1,13 @@
 package dns
 
 import (
+	"fmt"
 	"net"
 	"net/netip"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
@@ -26,10 +28,32 @@ type Server struct {
 
 	dnsServer     *dns.Server
 	dnsServerBind net.PacketConn
-	replyLock     sync.Mutex
+	extraServers  []*dns.Server
 
 	apiNames       []string
 	forbiddenNames []string
+
+	limiter   *clientLimiter
+	responses *responseCache
+
+	meshResolver atomic.Pointer[MeshResolver]
+	mesh         *meshCache
+
+	rateLimited  atomic.Uint64
+	floodRefused atomic.Uint64
+	cacheHits    atomic.Uint64
+}
+
+// Stats holds statistics of the DNS server.
+type Stats struct {
+	// RateLimited is the amount of dropped queries of clients that exceeded
+	// the query rate limit.
+	RateLimited uint64
+	// FloodRefused is the amount of refused queries for unknown names of
+	// clients that exceeded the miss rate limit.
+	FloodRefused uint64
+	// CacheHits is the amount of queries answered from the response cache.
+	CacheHits uint64
 }
 
 // instance is an interface subset of inst.Ance.
@@ -38,6 +62,7 @@ type instance interface {
 	Config() *config.Config
 	Identity() *m.Address
 	State() *state.State
+	Storage() storage.Storage
 	TunDevice() *tun.Device
 }
 
@@ -47,7 +72,7 @@ func New(instance instance, ln net.PacketConn, mappings storage.DomainMappingSto
 	srv := &Server{
 		instance:      instance,
 		mappings:      mappings,
-		dnsServerBind: ln,
+		dnsServerBind: &netstackPacketConn{PacketConn: ln},
 		apiNames: []string{
 			"router.myco", // Main UI domain.
 			"open.myco",   // For TOFU Names.
@@ -56,9 +81,15 @@ func New(instance instance, ln net.PacketConn, mappings storage.DomainMappingSto
 			"wpad.myco", // Windows proxy auto detect.
 			"myco.myco", // Queried by Windows for unknown reason.
 		},
+		limiter: newClientLimiter(
+			instance.Config().DNSRateLimit.Queries,
+			instance.Config().DNSRateLimit.Misses,
+		),
+		responses: newResponseCache(instance.Config().DNSCache.Size),
+		mesh:      newMeshCache(instance.Config().DNSCache.Size),
 	}
 	srv.dnsServer = &dns.Server{
-		PacketConn:   ln,
+		PacketConn:   srv.dnsServerBind,
 		Handler:      srv,
 		ReadTimeout:  time.Second,
 		WriteTimeout: time.Second,
@@ -71,8 +102,15 @@ func New(instance instance, ln net.PacketConn, mappings storage.DomainMappingSto
 func (srv *Server) Start(m *mgr.Manager) error {
 	srv.mgr = m
 
-	// Start DNS server worker.
-	m.Go("dns server", srv.dnsServerWorker)
+	// Start DNS server workers.
+	m.Go("dns server", func(w *mgr.WorkerCtx) error {
+		return srv.dnsServerWorker(w, srv.dnsServer)
+	})
+	for _, extra := range srv.extraServers {
+		m.Go("dns server on "+extra.PacketConn.LocalAddr().String(), func(w *mgr.WorkerCtx) error {
+			return srv.dnsServerWorker(w, extra)
+		})
+	}
 
 	// Advertise DNS server via RA.
 	err := srv.SendRouterAdvertisement(srv.instance.Identity().IP)
@@ -91,12 +129,28 @@ func (srv *Server) Stop(m *mgr.Manager) error {
 	if err := srv.dnsServer.Shutdown(); err != nil {
 		m.Error("failed to stop dns server", "err", err)
 	}
+	for _, extra := range srv.extraServers {
+		if err := extra.Shutdown(); err != nil {
+			m.Error("failed to stop dns server", "addr", extra.PacketConn.LocalAddr(), "err", err)
+		}
+	}
 	return nil
 }
 
-func (srv *Server) dnsServerWorker(w *mgr.WorkerCtx) error {
+// AddListener adds a listener on another address to the DNS server.
+// Must be called before Start.
+func (srv *Server) AddListener(ln net.PacketConn) {
+	srv.extraServers = append(srv.extraServers, &dns.Server{
+		PacketConn:   ln,
+		Handler:      srv,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	})
+}
+
+func (srv *Server) dnsServerWorker(w *mgr.WorkerCtx, dnsServer *dns.Server) error {
 	// Start serving.
-	err := srv.dnsServer.ActivateAndServe()
+	err := dnsServer.ActivateAndServe()
 	if err != nil {
 		return err
 	}
@@ -104,6 +158,15 @@ func (srv *Server) dnsServerWorker(w *mgr.WorkerCtx) error {
 	return nil
 }
 
+// Stats returns statistics of the DNS server.
+func (srv *Server) Stats() Stats {
+	return Stats{
+		RateLimited:  srv.rateLimited.Load(),
+		FloodRefused: srv.floodRefused.Load(),
+		CacheHits:    srv.cacheHits.Load(),
+	}
+}
+
 // ServeDNS implements the DNS server handler.
 func (srv *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	_ = srv.mgr.Do("request", func(wkr *mgr.WorkerCtx) error {
@@ -113,9 +176,21 @@ func (srv *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 }
 
 func (srv *Server) handleRequest(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) == 0 {
+		return
+	}
 	q := r.Question[0]
 	queryName := strings.ToLower(q.Name)
 
+	// Check rate limit.
+	client := remoteIP(w)
+	now := time.Now()
+	if !srv.limiter.allowQuery(client, now) {
+		// Drop query without reply, so that floods are not amplified.
+		srv.rateLimited.Add(1)
+		return
+	}
+
 	// Check TLD.
 	if !strings.HasSuffix(queryName, config.DefaultTLDBetweenDots) {
 		// Ignore all queries outside of .myco
@@ -129,6 +204,14 @@ func (srv *Server) handleRequest(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dn
 	switch q.Qtype {
 	case dns.TypeA, dns.TypeAAAA, dns.TypeSVCB, dns.TypeHTTPS, dns.TypeANY:
 		// Handle A, AAAA, SVCB, HTTPS and ANY.
+	case dns.TypeSRV:
+		// SRV records are synthesized for the domain of the service.
+		_, _, domain, ok := splitSRVName(mycoName)
+		if !ok {
+			srv.replyNotFound(wkr, w, r)
+			return
+		}
+		mycoName = domain
 	default:
 		// Ignore other types.
 		srv.replyNotFound(wkr, w, r)
@@ -156,12 +239,42 @@ func (srv *Server) handleRequest(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dn
 		)
 	}()
 
+	// Reply from cache.
+	if reply, ok := srv.responses.get(r, now); ok {
+		srv.cacheHits.Add(1)
+		srv.replyMsg(wkr, w, reply)
+		return
+	}
+
 	// Lookup and reply.
-	resolveToIP, source := srv.Lookup(mycoName)
+	// Domain mappings are skipped for clients that query too many unknown
+	// names, eg. in a random subdomain flood.
+	withMappings := srv.limiter.allowMiss(client, now)
+	resolveToIP, source := srv.lookup(mycoName, withMappings)
+	if source == SourceNone && withMappings {
+		// Ask other routers, if enabled.
+		if router, answerer := srv.resolveMesh(wkr.Ctx(), mycoName); router.IsValid() {
+			resolveToIP, source = router, SourceMesh
+			wkr.Debug(
+				"resolved name over mesh",
+				"name", mycoName,
+				"router", router,
+				"answerer", answerer,
+			)
+		}
+	}
+	if source == SourceNone {
+		if !withMappings {
+			srv.floodRefused.Add(1)
+			srv.replyMsg(wkr, w, new(dns.Msg).SetRcode(r, dns.RcodeRefused))
+			return
+		}
+		srv.limiter.recordMiss(client, now)
+	}
 	switch source {
 	case SourceInternal, SourceResolveConfig,
-		SourceFriend, SourceMapping:
-		srv.reply(wkr, w, r, resolveToIP, source)
+		SourceFriend, SourceMapping, SourceMesh:
+		srv.reply(wkr, w, r, mycoName, resolveToIP, source)
 
 	case SourceNone, SourceForbidden:
 		srv.replyNotFound(wkr, w, r)
@@ -173,6 +286,10 @@ func (srv *Server) handleRequest(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dn
 
 // Lookup looks up a name.
 func (srv *Server) Lookup(domain string) (netip.Addr, Source) {
+	return srv.lookup(domain, true)
+}
+
+func (srv *Server) lookup(domain string, withMappings bool) (netip.Addr, Source) {
 	// Source 0: Internal API
 	if slices.Contains[[]string, string](srv.apiNames, domain) {
 		return config.DefaultAPIAddress, SourceInternal
@@ -192,14 +309,14 @@ func (srv *Server) Lookup(domain string) (netip.Addr, Source) {
 	// Source 3: config.friends
 	friendName, cut := strings.CutSuffix(domain, config.DefaultDotTLD)
 	if cut {
-		friend, ok := srv.instance.Config().FriendsByName[friendName]
+		friend, ok := srv.instance.Config().GetFriendByName(friendName)
 		if ok {
 			return friend.IP, SourceFriend
 		}
 	}
 
 	// Source 4: domain mappings
-	if srv.mappings != nil {
+	if srv.mappings != nil && withMappings {
 		resolveToIP, err := srv.mappings.GetMapping(domain)
 		if err == nil {
 			// TODO: How should we handle a database failure here?
@@ -210,32 +327,45 @@ func (srv *Server) Lookup(domain string) (netip.Addr, Source) {
 	return netip.Addr{}, SourceNone
 }
 
-func (srv *Server) reply(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dns.Msg, ip netip.Addr, source Source) {
+func (srv *Server) reply(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dns.Msg, domain string, ip netip.Addr, source Source) {
 	reply := new(dns.Msg)
 
 	// Create answers.
 	q := r.Question[0]
-	aaaa, err := dns.NewRR(q.Name + " 1 IN AAAA " + ip.String())
+	name := q.Name
+	if q.Qtype == dns.TypeSRV {
+		// Address records are for the target of the SRV records.
+		name = dns.Fqdn(domain)
+	}
+	aaaa, err := dns.NewRR(name + " 1 IN AAAA " + ip.String())
 	if err != nil {
 		wkr.Error(
 			"failed to create AAAA answer record",
-			"name", q.Name,
+			"name", name,
 			"answer", ip.String(),
 			"err", err,
 		)
 		return
 	}
-	svcb, err := dns.NewRR(q.Name + " 1 IN SVCB 1 . ipv6hint=" + ip.String())
+	svcb, err := dns.NewRR(name + " 1 IN SVCB 1 . ipv6hint=" + ip.String())
 	if err != nil {
 		wkr.Error(
 			"failed to create SVCB answer record",
-			"name", q.Name,
+			"name", name,
 			"answer", ip.String(),
 			"err", err,
 		)
 		return
 	}
 
+	// Synthesize records of advertised services, so that clients find the
+	// correct port.
+	var services []dns.RR
+	switch q.Qtype {
+	case dns.TypeSRV, dns.TypeHTTPS, dns.TypeANY:
+		services = srv.serviceRecords(wkr, q, domain, ip)
+	}
+
 	// Assign answers to sections.
 	switch q.Qtype {
 	case dns.TypeAAAA:
@@ -246,8 +376,16 @@ func (srv *Server) reply(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dns.Msg, i
 		reply.Answer = []dns.RR{svcb}
 		reply.Extra = []dns.RR{aaaa}
 
+	case dns.TypeHTTPS:
+		reply.Answer = services
+		reply.Extra = []dns.RR{aaaa, svcb}
+
+	case dns.TypeSRV:
+		reply.Answer = services
+		reply.Extra = []dns.RR{aaaa}
+
 	case dns.TypeANY:
-		reply.Answer = []dns.RR{aaaa, svcb}
+		reply.Answer = append([]dns.RR{aaaa, svcb}, services...)
 
 	default:
 		reply.Extra = []dns.RR{aaaa, svcb}
@@ -259,42 +397,58 @@ func (srv *Server) reply(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dns.Msg, i
 		reply.Extra = append(reply.Extra, infoTxt)
 	}
 
-	// Finalize and reply.
+	// Finalize, cache and reply.
 	reply.SetRcode(r, dns.RcodeSuccess)
+	srv.responses.add(r, reply, time.Now())
 	srv.replyMsg(wkr, w, reply)
 }
 
+// remoteIP returns the IP address of the client.
+func remoteIP(w dns.ResponseWriter) netip.Addr {
+	if addr, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		ip, _ := netip.AddrFromSlice(addr.IP)
+		return ip.Unmap()
+	}
+	if addrPort, err := netip.ParseAddrPort(w.RemoteAddr().String()); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	return netip.Addr{}
+}
+
 func (srv *Server) replyNotFound(wkr *mgr.WorkerCtx, w dns.ResponseWriter, r *dns.Msg) {
 	srv.replyMsg(wkr, w, new(dns.Msg).SetRcode(r, dns.RcodeNameError))
 }
 
 func (srv *Server) replyMsg(wkr *mgr.WorkerCtx, w dns.ResponseWriter, reply *dns.Msg) {
-	// The gVisor netstack hangs at
-	//   tcpip/adapters/gonet.(*UDPConn).WriteTo+0x6b0
-	//   tcpip/adapters/gonet/gonet.go:680
-	// This breaks DNS resolution and leads to massive goroutine leak.
-	// This is an attempt to workaround this and stabilize responses.
-	// TODO: Evaluate other options
-	srv.replyLock.Lock()
-	defer srv.replyLock.Unlock()
-	err := srv.dnsServer.PacketConn.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	err := w.WriteMsg(reply)
 	if err != nil {
 		wkr.Error(
-			"failed to set write deadline for dns response",
+			"failed to write dns response",
 			"name", reply.Question[0].Name,
 			"rcode", reply.Rcode,
 			"err", err,
 		)
-		return
 	}
+}
 
-	err = w.WriteMsg(reply)
-	if err != nil {
-		wkr.Error(
-			"failed to write dns response",
-			"name", reply.Question[0].Name,
-			"rcode", reply.Rcode,
-			"err", err,
-		)
+// netstackPacketConn wraps the packet conn of the API netstack.
+type netstackPacketConn struct {
+	net.PacketConn
+	writeLock sync.Mutex
+}
+
+// WriteTo sets a write deadline before writing.
+func (c *netstackPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	// The gVisor netstack hangs at
+	//   tcpip/adapters/gonet.(*UDPConn).WriteTo+0x6b0
+	//   tcpip/adapters/gonet/gonet.go:680
+	// This breaks DNS resolution and leads to massive goroutine leak.
+	// This is an attempt to workaround this and stabilize responses.
+	// TODO: Evaluate other options
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if err := c.SetWriteDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		return 0, fmt.Errorf("set write deadline: %w", err)
 	}
+	return c.PacketConn.WriteTo(p, addr)
 }
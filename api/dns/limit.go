@@ -0,0 +1,121 @@
+package dns
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxLimitedClients limits the amount of tracked clients.
+	maxLimitedClients = 1024
+	// limitedClientTTL defines how long idle clients are tracked.
+	limitedClientTTL = 1 * time.Minute
+)
+
+// clientLimiter rate limits DNS queries per client. Queries for unknown names
+// are limited separately, as random subdomain floods cannot be cached and
+// would otherwise flush the mapping cache.
+type clientLimiter struct {
+	queryRate int
+	missRate  int
+
+	clients map[netip.Addr]*limitedClient
+	lock    sync.Mutex
+}
+
+type limitedClient struct {
+	queries  *rate.Limiter
+	misses   *rate.Limiter
+	lastSeen time.Time
+}
+
+// newClientLimiter returns a new client limiter. If queryRate is zero,
+// queries are not limited.
+func newClientLimiter(queryRate, missRate int) *clientLimiter {
+	return &clientLimiter{
+		queryRate: queryRate,
+		missRate:  missRate,
+		clients:   make(map[netip.Addr]*limitedClient),
+	}
+}
+
+func (cl *clientLimiter) enabled() bool {
+	return cl.queryRate > 0
+}
+
+// client returns the limits of the given client.
+// Must be called with the lock held.
+func (cl *clientLimiter) client(ip netip.Addr, now time.Time) *limitedClient {
+	client, ok := cl.clients[ip]
+	if !ok {
+		// Make room for new client.
+		if len(cl.clients) >= maxLimitedClients {
+			cl.clean(now)
+		}
+		if len(cl.clients) >= maxLimitedClients {
+			// Fall back to a shared limit for all new clients.
+			ip = netip.IPv6Unspecified()
+			if client, ok = cl.clients[ip]; ok {
+				client.lastSeen = now
+				return client
+			}
+		}
+
+		client = &limitedClient{
+			queries: rate.NewLimiter(rate.Limit(cl.queryRate), cl.queryRate*2),
+			misses:  rate.NewLimiter(rate.Limit(cl.missRate), cl.missRate*2),
+		}
+		cl.clients[ip] = client
+	}
+	client.lastSeen = now
+	return client
+}
+
+// allowQuery returns whether the client may send another query.
+func (cl *clientLimiter) allowQuery(ip netip.Addr, now time.Time) bool {
+	if !cl.enabled() {
+		return true
+	}
+
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	return cl.client(ip, now).queries.AllowN(now, 1)
+}
+
+// allowMiss returns whether the client may query another unknown name.
+func (cl *clientLimiter) allowMiss(ip netip.Addr, now time.Time) bool {
+	if !cl.enabled() {
+		return true
+	}
+
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	return cl.client(ip, now).misses.TokensAt(now) >= 1
+}
+
+// recordMiss records a query for an unknown name of the client.
+func (cl *clientLimiter) recordMiss(ip netip.Addr, now time.Time) {
+	if !cl.enabled() {
+		return
+	}
+
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	cl.client(ip, now).misses.AllowN(now, 1)
+}
+
+// clean removes idle clients.
+// Must be called with the lock held.
+func (cl *clientLimiter) clean(now time.Time) {
+	for ip, client := range cl.clients {
+		if now.Sub(client.lastSeen) > limitedClientTTL {
+			delete(cl.clients, ip)
+		}
+	}
+}
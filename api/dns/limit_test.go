@@ -0,0 +1,93 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestClientLimiter(t *testing.T) {
+	t.Parallel()
+
+	cl := newClientLimiter(10, 1)
+	clientA := netip.MustParseAddr("fd00::a")
+	clientB := netip.MustParseAddr("fd00::b")
+	now := time.Now()
+
+	// Burst is twice the rate.
+	for i := range 20 {
+		if !cl.allowQuery(clientA, now) {
+			t.Fatalf("query %d must be allowed", i)
+		}
+	}
+	if cl.allowQuery(clientA, now) {
+		t.Fatal("query must be limited")
+	}
+	if !cl.allowQuery(clientB, now) {
+		t.Fatal("other client must not be limited")
+	}
+	if !cl.allowQuery(clientA, now.Add(time.Second)) {
+		t.Fatal("query must be allowed again")
+	}
+
+	// Misses are limited separately.
+	cl.recordMiss(clientA, now)
+	if !cl.allowMiss(clientA, now) {
+		t.Fatal("miss must be allowed")
+	}
+	cl.recordMiss(clientA, now)
+	if cl.allowMiss(clientA, now) {
+		t.Fatal("miss must be limited")
+	}
+
+	// Disabled limiter allows everything.
+	disabled := newClientLimiter(0, 0)
+	for range 100 {
+		if !disabled.allowQuery(clientA, now) {
+			t.Fatal("disabled limiter must allow queries")
+		}
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	t.Parallel()
+
+	rc := newResponseCache(1)
+	now := time.Now()
+
+	request := new(dns.Msg).SetQuestion("a.myco.", dns.TypeAAAA)
+	reply := new(dns.Msg).SetRcode(request, dns.RcodeSuccess)
+	aaaa, err := dns.NewRR("a.myco. 1 IN AAAA fd00::a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply.Answer = []dns.RR{aaaa}
+	rc.add(request, reply, now)
+
+	// Cached response is adapted to the request.
+	request2 := new(dns.Msg).SetQuestion("A.myco.", dns.TypeAAAA)
+	cached, ok := rc.get(request2, now)
+	switch {
+	case !ok:
+		t.Fatal("response must be cached")
+	case cached.Id != request2.Id:
+		t.Fatal("cached response must have the request ID")
+	case cached.Answer[0].Header().Name != "A.myco.":
+		t.Fatalf("cached answer must have the queried name, got %s", cached.Answer[0].Header().Name)
+	}
+
+	// Other types, full cache and expiry.
+	if _, ok := rc.get(new(dns.Msg).SetQuestion("a.myco.", dns.TypeSVCB), now); ok {
+		t.Fatal("other type must not be cached")
+	}
+	request3 := new(dns.Msg).SetQuestion("b.myco.", dns.TypeAAAA)
+	rc.add(request3, new(dns.Msg).SetRcode(request3, dns.RcodeSuccess), now)
+	if _, ok := rc.get(request3, now); ok {
+		t.Fatal("full cache must not add entries")
+	}
+	if _, ok := rc.get(request, now.Add(responseCacheTTL+time.Second)); ok {
+		t.Fatal("expired response must not be returned")
+	}
+}
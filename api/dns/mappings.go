@@ -0,0 +1,264 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/storage"
+)
+
+// Mapping errors.
+var (
+	ErrMappingNotFound    = errors.New("mapping not found")
+	ErrInvalidDomain      = errors.New("invalid domain")
+	ErrInvalidRouter      = errors.New("invalid router address")
+	ErrDomainInUse        = errors.New("domain is already in use")
+	ErrNoMappingConflict  = errors.New("mapping has no conflict")
+	ErrAmbiguousMapping   = errors.New("domain is advertised by multiple routers, please specify the router")
+	ErrMappingWouldChange = errors.New("domain is already mapped to another router")
+)
+
+const (
+	// conflictMaxAge defines how recently a router must have been updated for
+	// its advertised domains to be considered for conflicts.
+	conflictMaxAge = 24 * time.Hour
+	// maxAdvertisingRouters limits the amount of routers checked for
+	// advertised domains.
+	maxAdvertisingRouters = 10_000
+)
+
+// Mapping is a domain mapping that was trusted on first use (TOFU), together
+// with conflict information.
+type Mapping struct {
+	Domain  string     `json:"domain"`
+	Router  netip.Addr `json:"router"`
+	Created time.Time  `json:"created,omitempty"`
+
+	// AdvertisedBy holds other routers that currently advertise the domain as
+	// a public service. This usually means that the owner of the domain
+	// changed its router key, but could also be an impersonation attempt.
+	AdvertisedBy []netip.Addr `json:"advertisedBy,omitempty"`
+}
+
+// Conflict returns whether the domain is advertised by another router than
+// the mapped one.
+func (mapping Mapping) Conflict() bool {
+	return len(mapping.AdvertisedBy) > 0
+}
+
+// Mappings returns all domain mappings with conflict information.
+func (srv *Server) Mappings() ([]Mapping, error) {
+	stored, err := srv.mappings.QueryMappings("")
+	if err != nil {
+		return nil, err
+	}
+
+	advertised, err := srv.advertisedDomains()
+	if err != nil {
+		return nil, fmt.Errorf("query advertised domains: %w", err)
+	}
+
+	mappings := make([]Mapping, 0, len(stored))
+	for _, mapping := range stored {
+		mappings = append(mappings, Mapping{
+			Domain:  mapping.Domain,
+			Router:  mapping.Router,
+			Created: mapping.Created,
+			AdvertisedBy: slices.DeleteFunc(slices.Clone(advertised[mapping.Domain]), func(ip netip.Addr) bool {
+				return ip == mapping.Router
+			}),
+		})
+	}
+	return mappings, nil
+}
+
+// GetMapping returns the mapping of the given domain.
+func (srv *Server) GetMapping(domain string) (Mapping, error) {
+	cleaned, ok := config.CleanDomain(domain)
+	if !ok {
+		return Mapping{}, ErrInvalidDomain
+	}
+	mappings, err := srv.Mappings()
+	if err != nil {
+		return Mapping{}, err
+	}
+	for _, mapping := range mappings {
+		if mapping.Domain == cleaned {
+			return mapping, nil
+		}
+	}
+	return Mapping{}, ErrMappingNotFound
+}
+
+// advertisedDomains returns the routers that recently advertised public
+// service domains, by domain.
+func (srv *Server) advertisedDomains() (map[string][]netip.Addr, error) {
+	universe := srv.instance.Config().Router.Universe
+	newerThan := time.Now().Add(-conflictMaxAge)
+
+	q := storage.NewRouterQuery(
+		func(a *storage.StoredRouter) bool {
+			return a.Address != nil &&
+				a.PublicInfo != nil &&
+				len(a.PublicInfo.PublicServices) > 0 &&
+				a.Universe == universe &&
+				a.UpdatedAt.After(newerThan)
+		},
+		nil,
+		maxAdvertisingRouters,
+	)
+	if err := srv.instance.Storage().QueryRouters(q); err != nil {
+		return nil, err
+	}
+
+	advertised := make(map[string][]netip.Addr)
+	for _, router := range q.Result() {
+		for _, svc := range router.PublicInfo.PublicServices {
+			if domain, ok := config.CleanDomain(svc.Domain); ok {
+				advertised[domain] = append(advertised[domain], router.Address.IP)
+			}
+		}
+	}
+	return advertised, nil
+}
+
+// checkMappingDomain cleans the given domain and checks that it may be used
+// for a mapping.
+func (srv *Server) checkMappingDomain(domain string) (cleaned string, err error) {
+	cleaned, ok := config.CleanDomain(domain)
+	if !ok {
+		return "", ErrInvalidDomain
+	}
+
+	switch _, source := srv.Lookup(cleaned); source {
+	case SourceNone, SourceMapping:
+		return cleaned, nil
+	case SourceForbidden:
+		return "", fmt.Errorf("%w: domain can have dangerous side-effects", ErrInvalidDomain)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrDomainInUse, source)
+	}
+}
+
+// SetMapping maps the given domain to the given router.
+func (srv *Server) SetMapping(domain string, router netip.Addr) error {
+	cleaned, err := srv.checkMappingDomain(domain)
+	if err != nil {
+		return err
+	}
+	if !m.RoutingAddressPrefix.Contains(router) {
+		return ErrInvalidRouter
+	}
+	return srv.mappings.SaveMapping(cleaned, router)
+}
+
+// ApproveMapping resolves a conflict by mapping the domain to the router that
+// now advertises it. If router is invalid, the domain must be advertised by
+// exactly one other router.
+func (srv *Server) ApproveMapping(domain string, router netip.Addr) (Mapping, error) {
+	mapping, err := srv.GetMapping(domain)
+	if err != nil {
+		return Mapping{}, err
+	}
+
+	switch {
+	case !mapping.Conflict():
+		return Mapping{}, ErrNoMappingConflict
+	case !router.IsValid() && len(mapping.AdvertisedBy) > 1:
+		return Mapping{}, ErrAmbiguousMapping
+	case !router.IsValid():
+		router = mapping.AdvertisedBy[0]
+	case !slices.Contains(mapping.AdvertisedBy, router):
+		return Mapping{}, fmt.Errorf("%w: domain is not advertised by %s", ErrInvalidRouter, router)
+	}
+
+	if err := srv.mappings.SaveMapping(mapping.Domain, router); err != nil {
+		return Mapping{}, err
+	}
+	return srv.GetMapping(mapping.Domain)
+}
+
+// RenameMapping moves the mapping of the given domain to a new domain.
+func (srv *Server) RenameMapping(domain, newDomain string) (Mapping, error) {
+	mapping, err := srv.GetMapping(domain)
+	if err != nil {
+		return Mapping{}, err
+	}
+	cleaned, err := srv.checkMappingDomain(newDomain)
+	if err != nil {
+		return Mapping{}, err
+	}
+	if _, err := srv.mappings.GetMapping(cleaned); err == nil {
+		return Mapping{}, fmt.Errorf("%w: %s is already mapped", ErrDomainInUse, cleaned)
+	}
+
+	if err := srv.mappings.SaveMapping(cleaned, mapping.Router); err != nil {
+		return Mapping{}, err
+	}
+	if err := srv.mappings.DeleteMapping(mapping.Domain); err != nil {
+		return Mapping{}, err
+	}
+	return srv.GetMapping(cleaned)
+}
+
+// DeleteMapping deletes the mapping of the given domain.
+func (srv *Server) DeleteMapping(domain string) error {
+	cleaned, ok := config.CleanDomain(domain)
+	if !ok {
+		return ErrInvalidDomain
+	}
+	if _, err := srv.mappings.GetMapping(cleaned); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrMappingNotFound
+		}
+		return err
+	}
+	return srv.mappings.DeleteMapping(cleaned)
+}
+
+// MappingImportResult holds the result of a mapping import.
+type MappingImportResult struct {
+	Imported  int      `json:"imported"`
+	Unchanged int      `json:"unchanged"`
+	Skipped   int      `json:"skipped"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// ImportMappings imports the given mappings, eg. from an export of another
+// router. Existing mappings to other routers are only replaced if overwrite
+// is set, as they were trusted on first use.
+func (srv *Server) ImportMappings(mappings []Mapping, overwrite bool) MappingImportResult {
+	var result MappingImportResult
+	for _, mapping := range mappings {
+		cleaned, err := srv.checkMappingDomain(mapping.Domain)
+		if err == nil && !m.RoutingAddressPrefix.Contains(mapping.Router) {
+			err = ErrInvalidRouter
+		}
+		if err == nil {
+			existing, getErr := srv.mappings.GetMapping(cleaned)
+			switch {
+			case getErr == nil && existing == mapping.Router:
+				result.Unchanged++
+				continue
+			case getErr == nil && !overwrite:
+				err = ErrMappingWouldChange
+			}
+		}
+		if err == nil {
+			err = srv.mappings.SaveMapping(cleaned, mapping.Router)
+		}
+
+		if err != nil {
+			result.Skipped++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", mapping.Domain, err))
+			continue
+		}
+		result.Imported++
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
+	"github.com/mycoria/mycoria/tun"
+)
+
+type testInstance struct {
+	config  *config.Config
+	storage storage.Storage
+}
+
+func (i *testInstance) Version() string          { return "" }
+func (i *testInstance) Config() *config.Config   { return i.config }
+func (i *testInstance) Identity() *m.Address     { return nil }
+func (i *testInstance) State() *state.State      { return nil }
+func (i *testInstance) Storage() storage.Storage { return i.storage }
+func (i *testInstance) TunDevice() *tun.Device   { return nil }
+
+func TestMappingManagement(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemStorage()
+	srv, err := New(&testInstance{
+		config: config.MakeTestConfig(config.Store{
+			FriendConfigs: []config.FriendConfig{{
+				Name: "friend",
+				IP:   "fd12:3456::f",
+			}},
+		}),
+		storage: store,
+	}, nil, NewMappingCache(store, time.Minute, 10))
+	require.NoError(t, err)
+
+	routerA := &m.PublicAddress{IP: netip.MustParseAddr("fd12:3456::a")}
+	routerB := &m.PublicAddress{IP: netip.MustParseAddr("fd12:3456::b")}
+
+	// Reserved and invalid domains cannot be mapped.
+	require.ErrorIs(t, srv.SetMapping("router.myco", routerA.IP), ErrDomainInUse)
+	require.ErrorIs(t, srv.SetMapping("friend.myco", routerA.IP), ErrDomainInUse)
+	require.ErrorIs(t, srv.SetMapping("example.com", routerA.IP), ErrInvalidDomain)
+	require.ErrorIs(t, srv.SetMapping("test.myco", netip.MustParseAddr("fd80::1")), ErrInvalidRouter)
+
+	// Map domain to router A.
+	require.NoError(t, srv.SetMapping("Test.myco", routerA.IP))
+	mapping, err := srv.GetMapping("test.myco")
+	require.NoError(t, err)
+	assert.Equal(t, routerA.IP, mapping.Router)
+	assert.False(t, mapping.Conflict())
+	_, err = srv.ApproveMapping("test.myco", netip.Addr{})
+	require.ErrorIs(t, err, ErrNoMappingConflict)
+
+	// Router B now advertises the domain.
+	require.NoError(t, store.SaveRouter(&storage.StoredRouter{
+		Address: routerB,
+		PublicInfo: &m.RouterInfo{
+			PublicServices: []m.RouterService{{Domain: "test.myco"}},
+		},
+		UpdatedAt: time.Now(),
+	}))
+	mapping, err = srv.GetMapping("test.myco")
+	require.NoError(t, err)
+	assert.True(t, mapping.Conflict())
+	assert.Equal(t, []netip.Addr{routerB.IP}, mapping.AdvertisedBy)
+
+	// Approve the new router.
+	mapping, err = srv.ApproveMapping("test.myco", netip.Addr{})
+	require.NoError(t, err)
+	assert.Equal(t, routerB.IP, mapping.Router)
+	assert.False(t, mapping.Conflict())
+
+	// Rename.
+	mapping, err = srv.RenameMapping("test.myco", "renamed.myco")
+	require.NoError(t, err)
+	assert.Equal(t, "renamed.myco", mapping.Domain)
+	_, err = srv.GetMapping("test.myco")
+	require.ErrorIs(t, err, ErrMappingNotFound)
+
+	// Export and import.
+	exported, err := srv.Mappings()
+	require.NoError(t, err)
+	require.Len(t, exported, 1)
+	result := srv.ImportMappings(append(exported,
+		Mapping{Domain: "new.myco", Router: routerA.IP},
+		Mapping{Domain: "router.myco", Router: routerA.IP},
+		Mapping{Domain: "renamed.myco", Router: routerA.IP},
+	), false)
+	assert.Equal(t, 1, result.Imported)
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Len(t, result.Errors, 2)
+
+	// Overwrite replaces existing mappings.
+	result = srv.ImportMappings([]Mapping{{Domain: "renamed.myco", Router: routerA.IP}}, true)
+	assert.Equal(t, 1, result.Imported)
+	mapping, err = srv.GetMapping("renamed.myco")
+	require.NoError(t, err)
+	assert.Equal(t, routerA.IP, mapping.Router)
+
+	// Delete.
+	require.NoError(t, srv.DeleteMapping("renamed.myco"))
+	require.ErrorIs(t, srv.DeleteMapping("renamed.myco"), ErrMappingNotFound)
+}
@@ -0,0 +1,164 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+const (
+	// meshMissTTL defines how long names that could not be resolved over the
+	// mesh are cached, so that repeated queries do not flood other routers.
+	meshMissTTL = 1 * time.Minute
+	// maxMeshMisses limits the amount of cached misses. Misses are cached
+	// separately, so that they are cached even if the DNS cache is disabled.
+	maxMeshMisses = 1000
+)
+
+// MeshResolver resolves a name by asking other routers. It returns the router
+// the domain belongs to and the router that answered.
+type MeshResolver func(ctx context.Context, domain string) (router, answerer netip.Addr, err error)
+
+// SetMeshResolver sets the function used to resolve unknown names over the
+// mesh. It is only used if the mesh resolver is enabled in the config.
+func (srv *Server) SetMeshResolver(fn MeshResolver) {
+	srv.meshResolver.Store(&fn)
+}
+
+// meshCache caches names resolved over the mesh, including misses.
+// Concurrent lookups of the same name, eg. for A and AAAA records, share
+// a single mesh lookup.
+type meshCache struct {
+	size int
+
+	entries  map[string]*meshCacheEntry
+	misses   map[string]time.Time
+	inFlight map[string]chan struct{}
+	lock     sync.Mutex
+}
+
+type meshCacheEntry struct {
+	router   netip.Addr
+	answerer netip.Addr
+	expires  time.Time
+}
+
+func newMeshCache(size int) *meshCache {
+	return &meshCache{
+		size:     size,
+		entries:  make(map[string]*meshCacheEntry),
+		misses:   make(map[string]time.Time),
+		inFlight: make(map[string]chan struct{}),
+	}
+}
+
+// resolveMesh resolves the given domain over the mesh.
+// Returns an invalid address if the name could not be resolved.
+func (srv *Server) resolveMesh(ctx context.Context, domain string) (router, answerer netip.Addr) {
+	cfg := srv.instance.Config().DNSResolver
+	fn := srv.meshResolver.Load()
+	if !cfg.Mesh || fn == nil {
+		return netip.Addr{}, netip.Addr{}
+	}
+	domain, ok := config.CleanDomain(domain)
+	if !ok {
+		return netip.Addr{}, netip.Addr{}
+	}
+	mc := srv.mesh
+
+	for {
+		// Check cache and wait for other lookups of the same name.
+		now := time.Now()
+		mc.lock.Lock()
+		entry, ok := mc.entries[domain]
+		if ok && now.After(entry.expires) {
+			delete(mc.entries, domain)
+			ok = false
+		}
+		if ok {
+			mc.lock.Unlock()
+			return entry.router, entry.answerer
+		}
+		if expires, ok := mc.misses[domain]; ok {
+			if now.Before(expires) {
+				mc.lock.Unlock()
+				return netip.Addr{}, netip.Addr{}
+			}
+			delete(mc.misses, domain)
+		}
+		done, ok := mc.inFlight[domain]
+		if !ok {
+			mc.inFlight[domain] = make(chan struct{})
+			mc.lock.Unlock()
+			break
+		}
+		mc.lock.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return netip.Addr{}, netip.Addr{}
+		}
+	}
+
+	// Ask the mesh.
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	router, answerer, err := (*fn)(ctx, domain)
+	now := time.Now()
+
+	// Cache result and wake up waiting lookups.
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	close(mc.inFlight[domain])
+	delete(mc.inFlight, domain)
+	if err != nil {
+		mc.addMiss(domain, now)
+		return netip.Addr{}, netip.Addr{}
+	}
+	mc.add(domain, &meshCacheEntry{
+		router:   router,
+		answerer: answerer,
+		expires:  now.Add(cfg.CacheTTL),
+	}, now)
+
+	return router, answerer
+}
+
+// addMiss adds the domain to the cached misses, if there is room.
+// Must be called with the lock held.
+func (mc *meshCache) addMiss(domain string, now time.Time) {
+	if len(mc.misses) >= maxMeshMisses {
+		for key, expires := range mc.misses {
+			if now.After(expires) {
+				delete(mc.misses, key)
+			}
+		}
+		if len(mc.misses) >= maxMeshMisses {
+			return
+		}
+	}
+	mc.misses[domain] = now.Add(meshMissTTL)
+}
+
+// add adds the entry to the cache, if there is room.
+// Must be called with the lock held.
+func (mc *meshCache) add(domain string, entry *meshCacheEntry, now time.Time) {
+	if mc.size <= 0 {
+		return
+	}
+	if len(mc.entries) >= mc.size {
+		for key, entry := range mc.entries {
+			if now.After(entry.expires) {
+				delete(mc.entries, key)
+			}
+		}
+		if len(mc.entries) >= mc.size {
+			return
+		}
+	}
+	mc.entries[domain] = entry
+}
@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestMeshResolver(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemStorage()
+	srv, err := New(&testInstance{
+		config: config.MakeTestConfig(config.Store{
+			System: config.System{DNSResolver: config.DNSResolverMesh},
+		}),
+		storage: store,
+	}, nil, NewMappingCache(store, time.Minute, 10))
+	require.NoError(t, err)
+
+	router := netip.MustParseAddr("fd12:3456::a")
+	answerer := netip.MustParseAddr("fd12:3456::b")
+	var lookups atomic.Int32
+	srv.SetMeshResolver(func(_ context.Context, domain string) (netip.Addr, netip.Addr, error) {
+		lookups.Add(1)
+		if domain != "wiki.de.myco" {
+			return netip.Addr{}, netip.Addr{}, errors.New("not found")
+		}
+		return router, answerer, nil
+	})
+
+	// Resolved names are cached.
+	resolved, by := srv.resolveMesh(context.Background(), "Wiki.de.myco.")
+	assert.Equal(t, router, resolved)
+	assert.Equal(t, answerer, by)
+	resolved, _ = srv.resolveMesh(context.Background(), "wiki.de.myco")
+	assert.Equal(t, router, resolved)
+	assert.Equal(t, int32(1), lookups.Load())
+
+	// Misses are cached too.
+	resolved, _ = srv.resolveMesh(context.Background(), "unknown.de.myco")
+	assert.False(t, resolved.IsValid())
+	_, _ = srv.resolveMesh(context.Background(), "unknown.de.myco")
+	assert.Equal(t, int32(2), lookups.Load())
+
+	// Invalid names are not looked up.
+	resolved, _ = srv.resolveMesh(context.Background(), "example.com")
+	assert.False(t, resolved.IsValid())
+	assert.Equal(t, int32(2), lookups.Load())
+}
+
+func TestMeshResolverDisabled(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemStorage()
+	srv, err := New(&testInstance{
+		config:  config.MakeTestConfig(config.Store{}),
+		storage: store,
+	}, nil, NewMappingCache(store, time.Minute, 10))
+	require.NoError(t, err)
+	srv.SetMeshResolver(func(context.Context, string) (netip.Addr, netip.Addr, error) {
+		t.Fatal("mesh resolver must not be used")
+		return netip.Addr{}, netip.Addr{}, nil
+	})
+
+	resolved, _ := srv.resolveMesh(context.Background(), "wiki.de.myco")
+	assert.False(t, resolved.IsValid())
+}
+
+func TestMeshResolverMissesWithoutCache(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemStorage()
+	srv, err := New(&testInstance{
+		config: config.MakeTestConfig(config.Store{
+			System: config.System{DNSResolver: config.DNSResolverMesh},
+		}),
+		storage: store,
+	}, nil, NewMappingCache(store, time.Minute, 10))
+	require.NoError(t, err)
+	srv.mesh = newMeshCache(0)
+
+	var lookups atomic.Int32
+	srv.SetMeshResolver(func(context.Context, string) (netip.Addr, netip.Addr, error) {
+		lookups.Add(1)
+		return netip.Addr{}, netip.Addr{}, errors.New("not found")
+	})
+
+	// Misses are cached even if the cache is disabled.
+	for range 3 {
+		resolved, _ := srv.resolveMesh(context.Background(), "unknown.de.myco")
+		assert.False(t, resolved.IsValid())
+	}
+	assert.Equal(t, int32(1), lookups.Load())
+}
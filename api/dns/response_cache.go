@@ -0,0 +1,101 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// responseCacheTTL defines how long responses are cached. It is kept short,
+// as answers depend on the config and on domain mappings.
+const responseCacheTTL = 10 * time.Second
+
+// responseCache caches positive responses by name and type.
+type responseCache struct {
+	size    int
+	entries map[responseCacheKey]*responseCacheEntry
+	lock    sync.Mutex
+}
+
+type responseCacheKey struct {
+	name  string
+	qtype uint16
+}
+
+type responseCacheEntry struct {
+	reply   *dns.Msg
+	expires time.Time
+}
+
+// newResponseCache returns a new response cache. If size is zero or
+// negative, caching is disabled.
+func newResponseCache(size int) *responseCache {
+	return &responseCache{
+		size:    size,
+		entries: make(map[responseCacheKey]*responseCacheEntry),
+	}
+}
+
+// get returns a copy of the cached response to the given request.
+func (rc *responseCache) get(r *dns.Msg, now time.Time) (*dns.Msg, bool) {
+	if rc.size <= 0 {
+		return nil, false
+	}
+	q := r.Question[0]
+	key := responseCacheKey{name: strings.ToLower(q.Name), qtype: q.Qtype}
+
+	rc.lock.Lock()
+	entry, ok := rc.entries[key]
+	if ok && now.After(entry.expires) {
+		delete(rc.entries, key)
+		ok = false
+	}
+	rc.lock.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	// Adapt copy to request.
+	reply := entry.reply.Copy()
+	for _, rr := range reply.Answer {
+		rr.Header().Name = q.Name
+	}
+	for _, rr := range reply.Extra {
+		if strings.EqualFold(rr.Header().Name, q.Name) {
+			rr.Header().Name = q.Name
+		}
+	}
+	reply.SetRcode(r, reply.Rcode)
+	return reply, true
+}
+
+// add caches the response to the given request.
+func (rc *responseCache) add(r, reply *dns.Msg, now time.Time) {
+	if rc.size <= 0 {
+		return
+	}
+	q := r.Question[0]
+	key := responseCacheKey{name: strings.ToLower(q.Name), qtype: q.Qtype}
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	// Make room for new entry.
+	if len(rc.entries) >= rc.size {
+		for key, entry := range rc.entries {
+			if now.After(entry.expires) {
+				delete(rc.entries, key)
+			}
+		}
+		if len(rc.entries) >= rc.size {
+			return
+		}
+	}
+
+	rc.entries[key] = &responseCacheEntry{
+		reply:   reply.Copy(),
+		expires: now.Add(responseCacheTTL),
+	}
+}
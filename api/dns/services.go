@@ -0,0 +1,173 @@
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// serviceEndpoint describes how to reach a service, as derived from the
+// scheme and port of its URL.
+type serviceEndpoint struct {
+	// service is the service label of SRV records, eg. "https".
+	service string
+	// protocol is the protocol label of SRV records, "tcp" or "udp".
+	protocol string
+	port     uint16
+	// alpn holds the supported ALPN protocols of https services.
+	alpn []string
+}
+
+// parseServiceEndpoint returns the endpoint of the service.
+// Services with an unsupported scheme or an invalid URL have no endpoint.
+func parseServiceEndpoint(svc m.RouterService) (endpoint serviceEndpoint, ok bool) {
+	u, err := url.Parse(svc.URL)
+	if err != nil {
+		return serviceEndpoint{}, false
+	}
+	switch u.Scheme {
+	case "http":
+		endpoint = serviceEndpoint{service: "http", protocol: "tcp", port: 80}
+	case "https":
+		endpoint = serviceEndpoint{service: "https", protocol: "tcp", port: 443, alpn: []string{"h2", "http/1.1"}}
+	case "tcp", "udp":
+		// There is no well-known service label, so use the service name.
+		name := strings.ToLower(svc.Name)
+		if !isServiceLabel(name) {
+			return serviceEndpoint{}, false
+		}
+		endpoint = serviceEndpoint{service: name, protocol: u.Scheme}
+	default:
+		return serviceEndpoint{}, false
+	}
+
+	if u.Port() != "" {
+		port, err := strconv.ParseUint(u.Port(), 10, 16)
+		if err != nil {
+			return serviceEndpoint{}, false
+		}
+		endpoint.port = uint16(port)
+	}
+	if endpoint.port == 0 {
+		return serviceEndpoint{}, false
+	}
+	return endpoint, true
+}
+
+// isServiceLabel returns whether the name is a valid service name for SRV
+// records according to RFC 6335.
+func isServiceLabel(name string) bool {
+	if len(name) == 0 || len(name) > 15 ||
+		strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-") ||
+		strings.Contains(name, "--") {
+		return false
+	}
+	hasLetter := false
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z':
+			hasLetter = true
+		case c >= '0' && c <= '9', c == '-':
+		default:
+			return false
+		}
+	}
+	return hasLetter
+}
+
+// splitSRVName splits an SRV query name like "_https._tcp.wiki.myco" into
+// its service and protocol labels and the domain.
+func splitSRVName(name string) (service, protocol, domain string, ok bool) {
+	labels := strings.SplitN(name, ".", 3)
+	if len(labels) != 3 {
+		return "", "", "", false
+	}
+	service, ok = strings.CutPrefix(labels[0], "_")
+	if !ok {
+		return "", "", "", false
+	}
+	protocol, ok = strings.CutPrefix(labels[1], "_")
+	if !ok || (protocol != "tcp" && protocol != "udp") {
+		return "", "", "", false
+	}
+	return service, protocol, labels[2], true
+}
+
+// lookupServices returns the endpoints of the services the router advertises
+// for the domain.
+func (srv *Server) lookupServices(domain string, router netip.Addr) []serviceEndpoint {
+	var services []m.RouterService
+	if identity := srv.instance.Identity(); identity != nil && identity.IP == router {
+		services = srv.instance.Config().GetRouterInfo().PublicServices
+	} else if stored, err := srv.instance.Storage().GetRouter(router); err == nil &&
+		stored != nil && stored.PublicInfo != nil {
+		services = stored.PublicInfo.PublicServices
+	}
+
+	var endpoints []serviceEndpoint
+	for _, svc := range services {
+		if cleaned, ok := config.CleanDomain(svc.Domain); !ok || cleaned != domain {
+			continue
+		}
+		if endpoint, ok := parseServiceEndpoint(svc); ok {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// serviceRecords returns the synthesized SRV and HTTPS records for the query.
+func (srv *Server) serviceRecords(wkr *mgr.WorkerCtx, q dns.Question, domain string, ip netip.Addr) []dns.RR {
+	var service, protocol string
+	if q.Qtype == dns.TypeSRV {
+		service, protocol, _, _ = splitSRVName(strings.ToLower(q.Name))
+	}
+
+	var (
+		records  []dns.RR
+		priority int
+	)
+	for _, endpoint := range srv.lookupServices(domain, ip) {
+		var record string
+		switch {
+		case q.Qtype == dns.TypeSRV:
+			if endpoint.service != service || endpoint.protocol != protocol {
+				continue
+			}
+			record = fmt.Sprintf("%s 1 IN SRV 0 0 %d %s", q.Name, endpoint.port, dns.Fqdn(domain))
+
+		case endpoint.alpn != nil:
+			// HTTPS and ANY queries.
+			priority++
+			record = fmt.Sprintf("%s 1 IN HTTPS %d . alpn=%s", q.Name, priority, strings.Join(endpoint.alpn, ","))
+			if endpoint.port != 443 {
+				record += fmt.Sprintf(" port=%d", endpoint.port)
+			}
+			record += " ipv6hint=" + ip.String()
+
+		default:
+			continue
+		}
+
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			wkr.Error(
+				"failed to create service record",
+				"name", q.Name,
+				"record", record,
+				"err", err,
+			)
+			continue
+		}
+		records = append(records, rr)
+	}
+	return records
+}
@@ -0,0 +1,98 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestServiceEndpoints(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		svc      m.RouterService
+		endpoint serviceEndpoint
+		ok       bool
+	}{
+		{
+			svc:      m.RouterService{URL: "https://wiki.myco"},
+			endpoint: serviceEndpoint{service: "https", protocol: "tcp", port: 443, alpn: []string{"h2", "http/1.1"}},
+			ok:       true,
+		},
+		{
+			svc:      m.RouterService{URL: "http://wiki.myco:8080/"},
+			endpoint: serviceEndpoint{service: "http", protocol: "tcp", port: 8080},
+			ok:       true,
+		},
+		{
+			svc:      m.RouterService{Name: "Minecraft", URL: "tcp://game.myco:25565"},
+			endpoint: serviceEndpoint{service: "minecraft", protocol: "tcp", port: 25565},
+			ok:       true,
+		},
+		{svc: m.RouterService{Name: "My Game", URL: "udp://game.myco:1234"}},
+		{svc: m.RouterService{Name: "game", URL: "tcp://game.myco"}},
+		{svc: m.RouterService{URL: "ping6://router.myco"}},
+	} {
+		endpoint, ok := parseServiceEndpoint(tc.svc)
+		assert.Equal(t, tc.ok, ok, tc.svc.URL)
+		assert.Equal(t, tc.endpoint, endpoint, tc.svc.URL)
+	}
+
+	service, protocol, domain, ok := splitSRVName("_https._tcp.wiki.myco")
+	assert.True(t, ok)
+	assert.Equal(t, "https", service)
+	assert.Equal(t, "tcp", protocol)
+	assert.Equal(t, "wiki.myco", domain)
+	_, _, _, ok = splitSRVName("_https._sctp.wiki.myco")
+	assert.False(t, ok)
+	_, _, _, ok = splitSRVName("www.wiki.myco")
+	assert.False(t, ok)
+}
+
+func TestServiceRecords(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemStorage()
+	srv, err := New(&testInstance{
+		config:  config.MakeTestConfig(config.Store{}),
+		storage: store,
+	}, nil, NewMappingCache(store, time.Minute, 10))
+	require.NoError(t, err)
+
+	router := netip.MustParseAddr("fd12:3456::a")
+	require.NoError(t, store.SaveRouter(&storage.StoredRouter{
+		Address: &m.PublicAddress{IP: router},
+		PublicInfo: &m.RouterInfo{
+			PublicServices: []m.RouterService{
+				{Name: "wiki", Domain: "wiki.myco", URL: "https://wiki.myco:8443"},
+				{Name: "wiki-plain", Domain: "wiki.myco", URL: "http://wiki.myco:8080"},
+				{Name: "other", Domain: "other.myco", URL: "https://other.myco"},
+			},
+		},
+	}))
+
+	// HTTPS records carry ALPN and port.
+	records := srv.serviceRecords(nil, dns.Question{Name: "wiki.myco.", Qtype: dns.TypeHTTPS}, "wiki.myco", router)
+	require.Len(t, records, 1)
+	assert.Equal(t, "wiki.myco.\t1\tIN\tHTTPS\t1 . alpn=\"h2,http/1.1\" port=\"8443\" ipv6hint=\"fd12:3456::a\"", records[0].String())
+
+	// SRV records point to the service domain.
+	records = srv.serviceRecords(nil, dns.Question{Name: "_http._tcp.wiki.myco.", Qtype: dns.TypeSRV}, "wiki.myco", router)
+	require.Len(t, records, 1)
+	srvRecord, ok := records[0].(*dns.SRV)
+	require.True(t, ok)
+	assert.Equal(t, uint16(8080), srvRecord.Port)
+	assert.Equal(t, "wiki.myco.", srvRecord.Target)
+
+	// Unknown services and routers have no records.
+	assert.Empty(t, srv.serviceRecords(nil, dns.Question{Name: "_ssh._tcp.wiki.myco.", Qtype: dns.TypeSRV}, "wiki.myco", router))
+	assert.Empty(t, srv.serviceRecords(nil, dns.Question{Name: "wiki.myco.", Qtype: dns.TypeHTTPS}, "wiki.myco", netip.MustParseAddr("fd12:3456::b")))
+}
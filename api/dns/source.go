@@ -11,4 +11,5 @@ const (
 	SourceForbidden     Source = "forbidden"
 	SourceFriend        Source = "friend"
 	SourceMapping       Source = "mapping"
+	SourceMesh          Source = "mesh"
 )
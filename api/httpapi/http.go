@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -10,6 +11,9 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
@@ -23,8 +27,10 @@ type API struct {
 
 	httpServer         *http.Server
 	httpServerListener net.Listener
+	listeners          []*scopedListener
 
-	handlers *http.ServeMux
+	handlers       *http.ServeMux
+	statusHandlers *http.ServeMux
 }
 
 // instance is an interface subset of inst.Ance.
@@ -36,17 +42,22 @@ type instance interface {
 }
 
 // New returns a new HTTP API.
+// The given listener has the admin scope and may be nil, if other listeners
+// are added with AddListener.
 func New(instance instance, ln net.Listener) (*API, error) {
 	// Create HTTP server.
 	api := &API{
 		instance:           instance,
 		httpServerListener: ln,
 		handlers:           http.NewServeMux(),
+		statusHandlers:     http.NewServeMux(),
 	}
 	api.httpServer = &http.Server{
-		Handler:      api,
+		// Also accept HTTP/2 without TLS, which gRPC clients require.
+		Handler:      h2c.NewHandler(api, &http2.Server{}),
 		ReadTimeout:  time.Second,
 		WriteTimeout: time.Second,
+		ConnContext:  api.connContext,
 	}
 
 	return api, nil
@@ -55,7 +66,20 @@ func New(instance instance, ln net.Listener) (*API, error) {
 // Start starts the API.
 func (api *API) Start(m *mgr.Manager) error {
 	api.mgr = m
-	m.Go("http server", api.httpServerWorker)
+
+	// Configure server before serving, as it is shared by all listeners.
+	api.httpServer.ErrorLog = slog.NewLogLogger(slog.Default().With("manager", m.Name()).Handler(), slog.LevelWarn)
+
+	if api.httpServerListener != nil {
+		m.Go("http server", func(w *mgr.WorkerCtx) error {
+			return api.httpServerWorker(w, api.httpServerListener)
+		})
+	}
+	for _, ln := range api.listeners {
+		m.Go("http server on "+ln.Addr().String(), func(w *mgr.WorkerCtx) error {
+			return api.httpServerWorker(w, ln)
+		})
+	}
 
 	return nil
 }
@@ -78,12 +102,9 @@ func (api *API) HandleFunc(pattern string, handler func(http.ResponseWriter, *ht
 	api.handlers.HandleFunc(pattern, handler)
 }
 
-func (api *API) httpServerWorker(w *mgr.WorkerCtx) error {
-	// Configure server.
-	api.httpServer.ErrorLog = slog.NewLogLogger(w.Logger().Handler(), slog.LevelWarn)
-
+func (api *API) httpServerWorker(w *mgr.WorkerCtx, ln net.Listener) error {
 	// Start serving.
-	err := api.httpServer.Serve(api.httpServerListener)
+	err := api.httpServer.Serve(ln)
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -99,8 +120,8 @@ func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (api *API) handleRequest(wkr *mgr.WorkerCtx, w http.ResponseWriter, r *http.Request) {
-	// Set retrievable request context.
-	r = r.WithContext(wkr.AddToCtx(wkr.Ctx()))
+	// Set retrievable request context and keep the scope of the listener.
+	r = r.WithContext(context.WithValue(wkr.AddToCtx(wkr.Ctx()), scopeContextKey{}, RequestScope(r)))
 
 	// Capture status code for logging.
 	statusCodeWriter := NewStatusCodeWriter(w, r)
@@ -244,6 +265,15 @@ func (api *API) handleRequest(wkr *mgr.WorkerCtx, w http.ResponseWriter, r *http
 		}
 	}
 
-	// Handle with registered handler.
-	api.handlers.ServeHTTP(statusCodeWriter, r)
+	// Handle with registered handler of the scope.
+	handlers := api.handlersFor(r)
+	if handlers != api.handlers {
+		if _, pattern := handlers.Handler(r); pattern == "" {
+			if _, adminPattern := api.handlers.Handler(r); adminPattern != "" {
+				http.Error(statusCodeWriter, "Not available on this listener.", http.StatusForbidden)
+				return
+			}
+		}
+	}
+	handlers.ServeHTTP(statusCodeWriter, r)
 }
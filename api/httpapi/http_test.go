@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestHTTP2WithoutTLS(t *testing.T) {
+	t.Parallel()
+
+	statusLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	api, err := New(nil, nil)
+	require.NoError(t, err)
+	api.AddListener(statusLn, config.APIScopeStatus)
+	api.HandleStatusFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto + " " + string(RequestScope(r))))
+	})
+	api.HandleFunc("GET /config", func(w http.ResponseWriter, r *http.Request) {})
+
+	m := mgr.New("test")
+	require.NoError(t, api.Start(m))
+	t.Cleanup(func() {
+		_ = api.Stop(m)
+	})
+
+	// Connect with HTTP/2 prior knowledge, like gRPC clients do.
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+	get := func(path string) (int, string) {
+		resp, err := client.Get("http://" + statusLn.Addr().String() + path) //nolint:noctx
+		require.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// The scope of the listener is kept.
+	status, body := get("/status")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "HTTP/2.0 "+string(config.APIScopeStatus), body)
+	status, _ = get("/config")
+	assert.Equal(t, http.StatusForbidden, status, "admin handlers must be forbidden")
+}
@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+// scopedListener is an API listener with a scope.
+type scopedListener struct {
+	net.Listener
+	scope config.APIScope
+}
+
+type scopeContextKey struct{}
+
+// AddListener adds a listener with the given scope to the API.
+// Must be called before Start.
+func (api *API) AddListener(ln net.Listener, scope config.APIScope) {
+	api.listeners = append(api.listeners, &scopedListener{
+		Listener: ln,
+		scope:    scope,
+	})
+}
+
+// HandleStatusFunc registers the handler function for the given pattern and
+// makes it available on listeners with the status scope. The handler must
+// not change anything and must not expose sensitive data.
+func (api *API) HandleStatusFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	api.handlers.HandleFunc(pattern, handler)
+	api.statusHandlers.HandleFunc(pattern, handler)
+}
+
+// RequestScope returns the scope of the listener the request was received on.
+func RequestScope(r *http.Request) config.APIScope {
+	scope, ok := r.Context().Value(scopeContextKey{}).(config.APIScope)
+	if !ok {
+		return config.APIScopeAdmin
+	}
+	return scope
+}
+
+// connContext adds the scope of the listener to the connection context.
+func (api *API) connContext(ctx context.Context, conn net.Conn) context.Context {
+	if scoped, ok := conn.(*scopedConn); ok {
+		return context.WithValue(ctx, scopeContextKey{}, scoped.scope)
+	}
+	return ctx
+}
+
+// scopedConn is a connection accepted by a scoped listener.
+type scopedConn struct {
+	net.Conn
+	scope config.APIScope
+}
+
+// Accept implements net.Listener.
+func (sl *scopedListener) Accept() (net.Conn, error) {
+	conn, err := sl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &scopedConn{Conn: conn, scope: sl.scope}, nil
+}
+
+// handlersFor returns the handlers available in the scope of the request.
+func (api *API) handlersFor(r *http.Request) *http.ServeMux {
+	if RequestScope(r) == config.APIScopeStatus {
+		return api.statusHandlers
+	}
+	return api.handlers
+}
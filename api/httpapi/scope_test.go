@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestListenerScopes(t *testing.T) {
+	t.Parallel()
+
+	adminLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	statusLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	api, err := New(nil, adminLn)
+	require.NoError(t, err)
+	api.AddListener(statusLn, config.APIScopeStatus)
+	api.HandleStatusFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(RequestScope(r)))
+	})
+	api.HandleFunc("GET /config", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(RequestScope(r)))
+	})
+
+	m := mgr.New("test")
+	require.NoError(t, api.Start(m))
+	t.Cleanup(func() {
+		_ = api.Stop(m)
+	})
+
+	get := func(ln net.Listener, path string) int {
+		resp, err := http.Get("http://" + ln.Addr().String() + path) //nolint:noctx
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, get(adminLn, "/status"))
+	assert.Equal(t, http.StatusOK, get(adminLn, "/config"))
+	assert.Equal(t, http.StatusOK, get(statusLn, "/status"))
+	assert.Equal(t, http.StatusForbidden, get(statusLn, "/config"), "admin handlers must be forbidden")
+	assert.Equal(t, http.StatusNotFound, get(statusLn, "/unknown"))
+}
@@ -42,6 +42,12 @@ func (scw *StatusCodeWriter) WriteHeader(code int) {
 	scw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap returns the original http.ResponseWriter, so that an
+// http.ResponseController can access its methods.
+func (scw *StatusCodeWriter) Unwrap() http.ResponseWriter {
+	return scw.ResponseWriter
+}
+
 // Hijack wraps the original Hijack method, if available.
 func (scw *StatusCodeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hijacker, ok := scw.ResponseWriter.(http.Hijacker)
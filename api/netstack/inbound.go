@@ -0,0 +1,215 @@
+package netstack
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// priorityQueueSize is the amount of packets that may wait for the
+	// network stack in the priority queue.
+	priorityQueueSize = 256
+	// bulkQueueSize is the amount of packets that may wait for the network
+	// stack in the bulk queue.
+	bulkQueueSize = 128
+
+	dnsPort = 53
+	apiPort = 80
+)
+
+// DNS packets are handled with priority up to this budget.
+const (
+	dnsBudgetRate  = 100 // Packets per second.
+	dnsBudgetBurst = 200 // Packets.
+)
+
+// PacketInfo holds the upper layer information of a submitted packet, as
+// parsed by the router.
+type PacketInfo struct {
+	Src      netip.Addr
+	Protocol uint8
+	SrcPort  uint16
+	DstPort  uint16
+	TCPFlags uint8
+}
+
+// InboundStats holds the packet counters of the inbound queues.
+type InboundStats struct {
+	Submitted       uint64 `json:"submitted"`
+	Dropped         uint64 `json:"dropped"`
+	DroppedPriority uint64 `json:"droppedPriority"`
+}
+
+type inboundCounters struct {
+	submitted       atomic.Uint64
+	dropped         atomic.Uint64
+	droppedPriority atomic.Uint64
+}
+
+// SubmitPacket is the send bridge to the API network stack.
+// Packets are queued and handed to the network stack by a worker. If the
+// queue is full, the packet is dropped and false is returned.
+// DNS queries and packets of established API connections are prioritized, so
+// that a flood of other packets cannot starve them.
+func (ns *NetStack) SubmitPacket(packet []byte, info PacketInfo) (accepted bool) {
+	ns.inbound.submitted.Add(1)
+	if ns.isPriorityPacket(info) {
+		select {
+		case ns.priorityQueue <- packet:
+			return true
+		default:
+			ns.inbound.droppedPriority.Add(1)
+			return false
+		}
+	}
+
+	select {
+	case ns.bulkQueue <- packet:
+		return true
+	default:
+		ns.inbound.dropped.Add(1)
+		return false
+	}
+}
+
+// InboundStats returns the packet counters of the inbound queues.
+func (ns *NetStack) InboundStats() InboundStats {
+	return InboundStats{
+		Submitted:       ns.inbound.submitted.Load(),
+		Dropped:         ns.inbound.dropped.Load(),
+		DroppedPriority: ns.inbound.droppedPriority.Load(),
+	}
+}
+
+// handleInboundPackets hands queued packets to the network stack.
+// The priority queue is always drained first.
+func (ns *NetStack) handleInboundPackets(w *mgr.WorkerCtx) error {
+	for {
+		var packet []byte
+		select {
+		case packet = <-ns.priorityQueue:
+		default:
+			select {
+			case packet = <-ns.priorityQueue:
+			case packet = <-ns.bulkQueue:
+			case <-w.Done():
+				return nil
+			}
+		}
+
+		// Note: The packet data is copied into the packet buffer.
+		ns.stackIO.InjectInbound(
+			ipv6.ProtocolNumber,
+			stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: buffer.MakeWithData(packet)}),
+		)
+
+		// TODO: Can we return the pooled buffer?
+	}
+}
+
+// isPriorityPacket returns whether the packet is a DNS packet or belongs to
+// an established API connection. Connection attempts are not prioritized,
+// as they are the primary tool for flooding.
+// DNS packets above the DNS budget are handled as bulk packets, as they are
+// easy to flood.
+func (ns *NetStack) isPriorityPacket(info PacketInfo) bool {
+	switch info.Protocol {
+	case uint8(header.UDPProtocolNumber):
+		return info.DstPort == dnsPort && ns.withinDNSBudget()
+
+	case uint8(header.TCPProtocolNumber):
+		switch info.DstPort {
+		case dnsPort:
+			return ns.withinDNSBudget()
+		case apiPort:
+			// Only packets of accepted connections are prioritized, as any
+			// other packet could claim to belong to a connection.
+			return info.TCPFlags&uint8(header.TCPFlagSyn) == 0 &&
+				ns.apiConns.has(netip.AddrPortFrom(info.Src, info.SrcPort))
+		}
+	}
+	return false
+}
+
+// withinDNSBudget reports whether a DNS packet may be handled with priority.
+func (ns *NetStack) withinDNSBudget() bool {
+	return ns.dnsBudget == nil || ns.dnsBudget.Allow()
+}
+
+// connTracker tracks the remote addresses of accepted connections.
+type connTracker struct {
+	conns map[netip.AddrPort]struct{}
+	lock  sync.RWMutex
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{
+		conns: make(map[netip.AddrPort]struct{}),
+	}
+}
+
+func (ct *connTracker) add(remote netip.AddrPort) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+
+	ct.conns[remote] = struct{}{}
+}
+
+func (ct *connTracker) remove(remote netip.AddrPort) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+
+	delete(ct.conns, remote)
+}
+
+func (ct *connTracker) has(remote netip.AddrPort) bool {
+	ct.lock.RLock()
+	defer ct.lock.RUnlock()
+
+	_, ok := ct.conns[remote]
+	return ok
+}
+
+// trackingListener records the remote addresses of accepted connections
+// until they are closed.
+type trackingListener struct {
+	net.Listener
+	tracker *connTracker
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return conn, nil
+	}
+	remote := addr.AddrPort()
+	l.tracker.add(remote)
+	return &trackedConn{Conn: conn, tracker: l.tracker, remote: remote}, nil
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	remote  netip.AddrPort
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.remove(c.remote)
+	})
+	return c.Conn.Close()
+}
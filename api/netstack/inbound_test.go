@@ -0,0 +1,92 @@
+package netstack
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestIsPriorityPacket(t *testing.T) {
+	t.Parallel()
+
+	udp := uint8(header.UDPProtocolNumber)
+	tcp := uint8(header.TCPProtocolNumber)
+	syn := uint8(header.TCPFlagSyn)
+	ack := uint8(header.TCPFlagAck)
+	client := netip.MustParseAddr("fd00::1")
+
+	ns := &NetStack{apiConns: newConnTracker()}
+	assert.True(t, ns.isPriorityPacket(PacketInfo{Protocol: udp, DstPort: dnsPort}), "dns query")
+	assert.False(t, ns.isPriorityPacket(PacketInfo{Protocol: udp, DstPort: 1234}), "other udp")
+	assert.True(t, ns.isPriorityPacket(PacketInfo{Protocol: tcp, DstPort: dnsPort, TCPFlags: syn}), "dns over tcp")
+	apiPacket := PacketInfo{Src: client, Protocol: tcp, SrcPort: 1234, DstPort: apiPort, TCPFlags: ack}
+	assert.False(t, ns.isPriorityPacket(apiPacket), "unknown api connection")
+	ns.apiConns.add(netip.AddrPortFrom(client, 1234))
+	assert.True(t, ns.isPriorityPacket(apiPacket), "established api connection")
+	apiPacket.TCPFlags = syn
+	assert.False(t, ns.isPriorityPacket(apiPacket), "api connection attempt")
+	assert.False(t, ns.isPriorityPacket(PacketInfo{Protocol: tcp, DstPort: 1234, TCPFlags: ack}), "other tcp")
+	assert.False(t, ns.isPriorityPacket(PacketInfo{}), "no upper layer info")
+}
+
+func TestDNSBudget(t *testing.T) {
+	t.Parallel()
+
+	ns := &NetStack{
+		priorityQueue: make(chan []byte, dnsBudgetBurst+1),
+		bulkQueue:     make(chan []byte, 1),
+		dnsBudget:     rate.NewLimiter(0, dnsBudgetBurst),
+		apiConns:      newConnTracker(),
+	}
+	dnsQuery := PacketInfo{Protocol: uint8(header.UDPProtocolNumber), DstPort: dnsPort}
+	for range dnsBudgetBurst {
+		assert.True(t, ns.SubmitPacket(nil, dnsQuery))
+	}
+
+	// DNS packets above the budget go to the bulk queue.
+	assert.True(t, ns.SubmitPacket(nil, dnsQuery))
+	assert.Len(t, ns.priorityQueue, dnsBudgetBurst)
+	assert.Len(t, ns.bulkQueue, 1)
+	assert.False(t, ns.SubmitPacket(nil, dnsQuery), "full bulk queue must drop")
+	assert.Equal(t, InboundStats{Submitted: dnsBudgetBurst + 2, Dropped: 1}, ns.InboundStats())
+}
+
+func TestSubmitPacketDrops(t *testing.T) {
+	t.Parallel()
+
+	ns := &NetStack{
+		priorityQueue: make(chan []byte, 1),
+		bulkQueue:     make(chan []byte, 1),
+	}
+	packet := make([]byte, header.IPv6MinimumSize)
+	assert.True(t, ns.SubmitPacket(packet, PacketInfo{}))
+	assert.False(t, ns.SubmitPacket(packet, PacketInfo{}), "full queue must drop")
+	assert.Equal(t, InboundStats{Submitted: 2, Dropped: 1}, ns.InboundStats())
+}
+
+func TestTrackingListener(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tracker := newConnTracker()
+	tl := &trackingListener{Listener: ln, tracker: tracker}
+	defer tl.Close() //nolint:errcheck
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+	conn, err := tl.Accept()
+	require.NoError(t, err)
+
+	// Accepted connections are tracked until closed.
+	remote := netip.MustParseAddrPort(client.LocalAddr().String())
+	assert.True(t, tracker.has(remote))
+	require.NoError(t, conn.Close())
+	assert.False(t, tracker.has(remote))
+}
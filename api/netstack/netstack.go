@@ -5,7 +5,7 @@ import (
 	"net"
 	"net/netip"
 
-	"gvisor.dev/gvisor/pkg/buffer"
+	"golang.org/x/time/rate"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -38,6 +38,14 @@ type NetStack struct {
 
 	stack   *stack.Stack
 	stackIO *channel.Endpoint
+
+	priorityQueue chan []byte
+	bulkQueue     chan []byte
+	inbound       inboundCounters
+	// dnsBudget limits the DNS packets that are handled with priority.
+	dnsBudget *rate.Limiter
+	// apiConns tracks the accepted API connections.
+	apiConns *connTracker
 }
 
 // instance is an interface subset of inst.Ance.
@@ -58,6 +66,11 @@ func New(instance instance, tunDevice *tun.Device) (*NetStack, error) {
 		nicID:     1,
 		tunDevice: tunDevice,
 		address:   apiAddress,
+
+		priorityQueue: make(chan []byte, priorityQueueSize),
+		bulkQueue:     make(chan []byte, bulkQueueSize),
+		dnsBudget:     rate.NewLimiter(dnsBudgetRate, dnsBudgetBurst),
+		apiConns:      newConnTracker(),
 	}
 
 	// Create network stack.
@@ -71,6 +84,9 @@ func New(instance instance, tunDevice *tun.Device) (*NetStack, error) {
 	if tErr != nil {
 		return nil, fmt.Errorf("failed to enable TCP SACK: %v", tErr)
 	}
+	// Rate limit ICMP messages, including echo replies, as per RFC 4443.
+	ns.stack.SetICMPLimit(m.ICMPRateLimit)
+	ns.stack.SetICMPBurst(m.ICMPRateBurst)
 	// Create API endpoint to communicate with stack.
 	ns.stackIO = channel.New(128, uint32(instance.Config().TunMTU()), "")
 	// Add API endpoint to stack.
@@ -95,6 +111,7 @@ func New(instance instance, tunDevice *tun.Device) (*NetStack, error) {
 
 // Start starts the API stack.
 func (ns *NetStack) Start(m *mgr.Manager) error {
+	m.Go("inbound packet handler", ns.handleInboundPackets)
 	m.Go("response packet handler", ns.handleResponsePackets)
 
 	return nil
@@ -116,6 +133,10 @@ func (ns *NetStack) ListenTCP(port uint16) (net.Listener, error) {
 		return nil, fmt.Errorf("failed to listen with TCP on netstack: %w", err)
 	}
 
+	// Track API connections for prioritizing their packets.
+	if port == apiPort {
+		return &trackingListener{Listener: ln, tracker: ns.apiConns}, nil
+	}
 	return ln, nil
 }
 
@@ -139,19 +160,6 @@ func (ns *NetStack) ListenUDP(port uint16) (net.PacketConn, error) {
 	return packetConn, nil
 }
 
-// SubmitPacket is the send bridge to the API network stack.
-func (ns *NetStack) SubmitPacket(packet []byte) {
-	// DEBUG:
-	// fmt.Printf("in:\n%s", hex.Dump(packet))
-
-	ns.stackIO.InjectInbound(
-		ipv6.ProtocolNumber,
-		stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: buffer.MakeWithData(packet)}),
-	)
-
-	// TODO: Can we return the pooled buffer?
-}
-
 // WriteNotify is the recv bridge to the API network stack.
 func (ns *NetStack) handleResponsePackets(w *mgr.WorkerCtx) error {
 	for {
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	rootCmd.AddCommand(addressCmd)
+	addressCmd.AddCommand(addressInspectCmd)
+	addressCmd.AddCommand(addressEstimateCmd)
+
+	addressEstimateCmd.Flags().DurationVar(&addressEstimateMeasure, "measure", 2*time.Second, "set how long to measure the key generation rate")
+}
+
+var (
+	addressCmd = &cobra.Command{
+		Use:   "address",
+		Short: "Inspect Mycoria addresses",
+		Long:  "Inspect Mycoria addresses. Routable addresses carry a geo marker of continent, region and country in their first bits, which is used for routing. As addresses are derived from the router key, generating an address within a country needs many tries.",
+	}
+	addressInspectCmd = &cobra.Command{
+		Use:   "inspect [ip]",
+		Short: "Decode the type, geo marker and switch label of an address",
+		Args:  cobra.ExactArgs(1),
+		RunE:  addressInspect,
+	}
+	addressEstimateCmd = &cobra.Command{
+		Use:   "estimate [2-letter country code; US needs state: US-DC; or \"privacy\"]",
+		Short: "Estimate how long generating an address takes on this machine",
+		Args:  cobra.ExactArgs(1),
+		RunE:  addressEstimate,
+	}
+
+	addressEstimateMeasure time.Duration
+)
+
+func addressInspect(cmd *cobra.Command, args []string) error {
+	ip, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	info := m.InspectAddress(ip)
+
+	fmt.Printf("address:   %s\n", info.IP.StringExpanded())
+	fmt.Printf("type:      %s\n", info.Type)
+	if info.Type == m.TypeInvalid {
+		fmt.Printf("hint:      Mycoria addresses are within %s\n", m.BaseNetPrefix)
+		return nil
+	}
+	if info.Continent != "" {
+		fmt.Printf("continent: %s\n", info.Continent)
+	}
+	if info.Region != "" {
+		fmt.Printf("region:    %s\n", info.RegionDescription)
+	}
+	switch {
+	case info.Country != "":
+		fmt.Printf("country:   %s (%s)\n", info.Country, info.CountryPrefix)
+	case info.Type == m.TypeGeoMarked:
+		fmt.Println("country:   none, region is not assigned to a country")
+	}
+	if info.RoutingPrefix.IsValid() {
+		fmt.Printf("routing:   %s\n", info.RoutingPrefix)
+	} else {
+		fmt.Println("routing:   not routable")
+	}
+	if info.SwitchLabel != 0 {
+		fmt.Printf("label:     %d\n", info.SwitchLabel)
+	} else {
+		fmt.Println("label:     none, a random label is used")
+	}
+	return nil
+}
+
+func addressEstimate(cmd *cobra.Command, args []string) error {
+	// Get prefix.
+	var prefix netip.Prefix
+	switch code := strings.ToUpper(args[0]); code {
+	case "PRIVACY":
+		prefix = m.PrivacyAddressPrefix
+	case "US":
+		return errors.New("invalid country code: in case of the US, please specify the state like US-DC")
+	default:
+		var err error
+		prefix, err = m.GetCountryPrefix(code)
+		if err != nil {
+			return fmt.Errorf("invalid country code %q: %w", code, err)
+		}
+	}
+
+	fmt.Printf("measuring key generation rate for %s...\n", addressEstimateMeasure)
+	est, err := m.EstimateAddressGeneration(cmd.Context(), prefix, addressEstimateMeasure)
+	if err != nil {
+		return fmt.Errorf("failed to estimate: %w", err)
+	}
+
+	fmt.Printf("prefix:    %s\n", est.Prefix)
+	fmt.Printf("tries:     %.0f on average\n", est.ExpectedTries)
+	fmt.Printf("rate:      %.0f tries/s\n", est.TriesPerSecond)
+	fmt.Printf("cores:     %d\n", est.Workers)
+	fmt.Printf("expected:  %s\n", formatEstimate(est.Expected))
+	fmt.Printf("likely:    %s (90%% of generations)\n", formatEstimate(est.Likely))
+	return nil
+}
+
+func formatEstimate(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return "less than a second"
+	case d < time.Minute:
+		return d.Round(time.Second).String()
+	default:
+		return d.Round(time.Minute).String()
+	}
+}
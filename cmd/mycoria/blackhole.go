@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+	"github.com/mycoria/mycoria/router"
+)
+
+func init() {
+	routeCmd.AddCommand(routeBlackholeCmd)
+	routeCmd.AddCommand(routeUnblackholeCmd)
+	routeCmd.AddCommand(routeBlackholesCmd)
+
+	routeBlackholeCmd.Flags().StringVar(&blackholeAction, "action", string(router.BlackholeDrop), "how to answer traffic: drop, prohibited or unreachable")
+	routeBlackholeCmd.Flags().StringVar(&blackholeReason, "reason", "", "note why the blackhole was added")
+	routeBlackholeCmd.Flags().DurationVar(&blackholeDuration, "for", 0, "remove the blackhole after the given duration, eg. 1h")
+}
+
+var (
+	routeBlackholeCmd = &cobra.Command{
+		Use:   "blackhole [ip or prefix]",
+		Short: "Drop all traffic to and from the routers in a prefix",
+		Long:  "Drop all traffic to and from the given router or the routers in the given prefix immediately, eg. when a remote router is attacking a local service. With the \"prohibited\" or \"unreachable\" action, traffic is answered with the respective ICMP error. The most specific blackhole applies. Blackholes are lost on restart.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  routeBlackhole,
+	}
+	routeUnblackholeCmd = &cobra.Command{
+		Use:   "unblackhole [ip or prefix]",
+		Short: "Remove the blackhole of a prefix",
+		Args:  cobra.ExactArgs(1),
+		RunE:  routeUnblackhole,
+	}
+	routeBlackholesCmd = &cobra.Command{
+		Use:   "blackholes",
+		Short: "List all blackholes",
+		Args:  cobra.NoArgs,
+		RunE:  routeBlackholes,
+	}
+
+	blackholeAction   string
+	blackholeReason   string
+	blackholeDuration time.Duration
+)
+
+func routeBlackhole(cmd *cobra.Command, args []string) error {
+	prefix, err := control.ParseBlackholePrefix(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid prefix: %w", err)
+	}
+	req := control.Blackhole{
+		Prefix: prefix,
+		Action: router.BlackholeAction(blackholeAction),
+		Reason: blackholeReason,
+	}
+	if blackholeDuration > 0 {
+		req.Duration = blackholeDuration.String()
+	}
+
+	var blackhole control.Blackhole
+	if err := controlRequest(http.MethodPost, "/blackholes", req, &blackhole); err != nil {
+		return fmt.Errorf("failed to add blackhole: %w", err)
+	}
+
+	fmt.Printf("blackholed %s (%s)", blackhole.Prefix, blackhole.Action)
+	if !blackhole.Expires.IsZero() {
+		fmt.Printf(" until %s", blackhole.Expires.Format(time.DateTime))
+	}
+	fmt.Println()
+	return nil
+}
+
+func routeUnblackhole(cmd *cobra.Command, args []string) error {
+	prefix, err := control.ParseBlackholePrefix(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid prefix: %w", err)
+	}
+
+	if err := controlRequest(http.MethodDelete, "/blackholes/"+prefix.String(), nil, nil); err != nil {
+		return fmt.Errorf("failed to remove blackhole: %w", err)
+	}
+
+	fmt.Printf("removed blackhole of %s\n", prefix)
+	return nil
+}
+
+func routeBlackholes(cmd *cobra.Command, args []string) error {
+	var blackholes []control.Blackhole
+	if err := controlRequest(http.MethodGet, "/blackholes", nil, &blackholes); err != nil {
+		return fmt.Errorf("failed to get blackholes: %w", err)
+	}
+
+	if len(blackholes) == 0 {
+		fmt.Println("no blackholes")
+		return nil
+	}
+	for _, blackhole := range blackholes {
+		fmt.Printf("%s action=%s dropped=%d", blackhole.Prefix, blackhole.Action, blackhole.Dropped)
+		if !blackhole.Expires.IsZero() {
+			fmt.Printf(" expires in %s", time.Until(blackhole.Expires).Round(time.Second))
+		}
+		if blackhole.Reason != "" {
+			fmt.Printf(" reason=%q", blackhole.Reason)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	rootCmd.AddCommand(debugCmd)
+	debugCmd.AddCommand(debugTableCmd)
+	debugTableCmd.AddCommand(debugTableExportCmd)
+
+	debugTableExportCmd.Flags().StringVar(&debugTableFormat, "format", "json", "snapshot format: json or cbor")
+	debugTableExportCmd.Flags().StringVar(&debugTableOut, "out", "", "write the snapshot to this file instead of stdout")
+}
+
+var (
+	debugCmd = &cobra.Command{
+		Use:   "debug",
+		Short: "Debugging tools for developers",
+	}
+	debugTableCmd = &cobra.Command{
+		Use:   "table",
+		Short: "Debug the routing table of the running router",
+	}
+	debugTableExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export a snapshot of the full routing table",
+		Long:  "Export a machine-readable snapshot of the full routing table of the running router, including timestamps and metrics. Snapshots can be loaded into the simulation with sim.LoadTableSnapshot and Network.AddRouterFromSnapshot in order to reproduce route selection offline.",
+		Args:  cobra.NoArgs,
+		RunE:  debugTableExport,
+	}
+
+	debugTableFormat string
+	debugTableOut    string
+)
+
+func debugTableExport(cmd *cobra.Command, args []string) error {
+	var snap m.TableSnapshot
+	if err := controlRequest(http.MethodGet, "/table/snapshot", nil, &snap); err != nil {
+		return fmt.Errorf("failed to get routing table snapshot: %w", err)
+	}
+
+	// Encode snapshot.
+	var (
+		data []byte
+		err  error
+	)
+	switch debugTableFormat {
+	case "json":
+		data, err = json.MarshalIndent(&snap, "", "  ")
+		data = append(data, '\n')
+	case "cbor":
+		data, err = cbor.Marshal(&snap)
+	default:
+		return fmt.Errorf("unknown format %q", debugTableFormat)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	// Write snapshot.
+	if debugTableOut == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(debugTableOut, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	fmt.Printf("exported %d routes to %d destinations to %s\n", snap.Metrics.Routes, snap.Metrics.Destinations, debugTableOut)
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+func init() {
+	debugCmd.AddCommand(debugConfinementCmd)
+
+	debugConfinementCmd.Flags().StringVar(&debugConfinementFormat, "format", "report", "output format: report, json, apparmor or selinux")
+	debugConfinementCmd.Flags().StringVar(&debugConfinementExecutable, "executable", "", "path of the router binary (default: this binary)")
+}
+
+var (
+	debugConfinementCmd = &cobra.Command{
+		Use:   "confinement",
+		Short: "Report the operations the router needs under AppArmor or SELinux",
+		Long:  "Report all filesystem, network and netlink operations the router needs with the given config, or generate a matching AppArmor profile or SELinux policy module. Optional operations may be denied, which only disables the feature.",
+		Args:  cobra.NoArgs,
+		RunE:  debugConfinement,
+	}
+
+	debugConfinementFormat     string
+	debugConfinementExecutable string
+)
+
+func debugConfinement(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	executable := debugConfinementExecutable
+	if executable == "" {
+		executable, err = os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find executable: %w", err)
+		}
+	}
+	rules := c.Confinement(executable)
+
+	switch debugConfinementFormat {
+	case "report":
+		printConfinementReport(rules)
+	case "json":
+		data, err := json.MarshalIndent(rules, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "apparmor":
+		fmt.Print(apparmorProfile(executable, rules))
+	case "selinux":
+		fmt.Print(selinuxPolicy(executable, rules))
+	default:
+		return fmt.Errorf("unknown format %q", debugConfinementFormat)
+	}
+	return nil
+}
+
+func printConfinementReport(rules []config.ConfinementRule) {
+	for _, kind := range []config.ConfinementKind{
+		config.ConfinementFile,
+		config.ConfinementCapability,
+		config.ConfinementNetlink,
+		config.ConfinementNetwork,
+	} {
+		fmt.Printf("%s:\n", kind)
+		for _, rule := range rules {
+			if rule.Kind != kind {
+				continue
+			}
+			required := "required"
+			if rule.Optional {
+				required = "optional"
+			}
+			fmt.Printf("  %-8s %-50s %-18s %s\n", required, rule.Target, rule.Access, rule.Reason)
+		}
+	}
+}
+
+// apparmorProfile returns an AppArmor profile for the router.
+func apparmorProfile(executable string, rules []config.ConfinementRule) string {
+	var (
+		b       strings.Builder
+		lines   []string
+		network []string
+	)
+	addLine := func(list *[]string, line string) {
+		if !slices.Contains(*list, line) {
+			*list = append(*list, line)
+		}
+	}
+
+	// Files: merge access, so that "rw" wins over "r".
+	fileAccess := make(map[string]string)
+	var files []string
+	for _, rule := range rules {
+		if rule.Kind != config.ConfinementFile {
+			continue
+		}
+		if _, ok := fileAccess[rule.Target]; !ok {
+			files = append(files, rule.Target)
+		}
+		if len(rule.Access) > len(fileAccess[rule.Target]) {
+			fileAccess[rule.Target] = rule.Access
+		}
+	}
+	for _, path := range files {
+		access := fileAccess[path]
+		switch {
+		case path == executable:
+			addLine(&lines, fmt.Sprintf("%s m%s,", path, access))
+		case strings.HasSuffix(path, "/"):
+			addLine(&lines, fmt.Sprintf("%s r,", path))
+			addLine(&lines, fmt.Sprintf("%s** %s,", path, access))
+		default:
+			addLine(&lines, fmt.Sprintf("%s %s,", path, access))
+		}
+	}
+
+	// Capabilities and network.
+	for _, rule := range rules {
+		switch rule.Kind {
+		case config.ConfinementCapability:
+			addLine(&network, fmt.Sprintf("capability %s,", rule.Target))
+		case config.ConfinementNetlink:
+			addLine(&network, "network netlink raw,")
+		case config.ConfinementNetwork:
+			switch {
+			case strings.HasPrefix(rule.Target, "tcp"):
+				addLine(&network, "network inet stream,")
+				addLine(&network, "network inet6 stream,")
+			case strings.HasPrefix(rule.Target, "udp"):
+				addLine(&network, "network inet dgram,")
+				addLine(&network, "network inet6 dgram,")
+			case strings.HasSuffix(rule.Access, "seqpacket"):
+				addLine(&network, "network unix seqpacket,")
+			default:
+				addLine(&network, "network unix stream,")
+			}
+		}
+	}
+
+	b.WriteString("# AppArmor profile for mycoria, generated by \"mycoria debug confinement --format apparmor\".\n")
+	b.WriteString("# Install to /etc/apparmor.d/mycoria and load with \"apparmor_parser -r /etc/apparmor.d/mycoria\".\n")
+	b.WriteString("abi <abi/3.0>,\n\n#include <tunables/global>\n\n")
+	fmt.Fprintf(&b, "profile mycoria %s {\n", executable)
+	b.WriteString("  #include <abstractions/base>\n  #include <abstractions/nameservice>\n\n")
+	for _, line := range network {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	b.WriteString("\n")
+	for _, line := range lines {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// selinuxPolicy returns an SELinux policy module in the reference policy
+// format for the router.
+func selinuxPolicy(executable string, rules []config.ConfinementRule) string {
+	var (
+		te    []string
+		fc    []string
+		notes []string
+	)
+	add := func(list *[]string, line string) {
+		if !slices.Contains(*list, line) {
+			*list = append(*list, line)
+		}
+	}
+
+	// writable returns whether the path is labeled as writable by another rule.
+	writable := func(path string) bool {
+		return slices.ContainsFunc(rules, func(rule config.ConfinementRule) bool {
+			return rule.Kind == config.ConfinementFile && rule.Access == "rw" && rule.Target != executable &&
+				(rule.Target == path || (strings.HasSuffix(rule.Target, "/") && strings.HasPrefix(path, rule.Target)))
+		})
+	}
+
+	add(&fc, fmt.Sprintf("%s -- gen_context(system_u:object_r:mycoria_exec_t,s0)", executable))
+	for _, rule := range rules {
+		switch rule.Kind {
+		case config.ConfinementCapability:
+			add(&te, fmt.Sprintf("allow mycoria_t self:capability %s;", rule.Target))
+
+		case config.ConfinementNetlink:
+			switch rule.Target {
+			case "route":
+				add(&te, "allow mycoria_t self:netlink_route_socket create_netlink_socket_perms;")
+			case "sock_diag":
+				add(&te, "allow mycoria_t self:netlink_tcpdiag_socket { create_netlink_socket_perms nlmsg_read };")
+			}
+
+		case config.ConfinementNetwork:
+			switch {
+			case strings.HasPrefix(rule.Target, "tcp") && rule.Access == "bind":
+				add(&te, "allow mycoria_t self:tcp_socket create_stream_socket_perms;")
+				add(&te, "corenet_tcp_bind_generic_node(mycoria_t)")
+				add(&te, "corenet_tcp_bind_all_ports(mycoria_t)")
+			case strings.HasPrefix(rule.Target, "tcp"):
+				add(&te, "allow mycoria_t self:tcp_socket create_stream_socket_perms;")
+				add(&te, "corenet_tcp_connect_all_ports(mycoria_t)")
+			case strings.HasPrefix(rule.Target, "udp"):
+				add(&te, "allow mycoria_t self:udp_socket create_socket_perms;")
+				add(&te, "corenet_udp_bind_generic_node(mycoria_t)")
+				add(&te, "corenet_udp_bind_all_ports(mycoria_t)")
+			default:
+				add(&te, "allow mycoria_t self:unix_stream_socket create_stream_socket_perms;")
+				add(&notes, fmt.Sprintf("allow connecting to %s, eg. with \"allow mycoria_t <helper type>:unix_stream_socket connectto;\"", rule.Target))
+			}
+
+		case config.ConfinementFile:
+			switch {
+			case rule.Target == "/dev/net/tun":
+				add(&te, "corenet_rw_tun_tap_dev(mycoria_t)")
+				add(&te, "allow mycoria_t self:tun_socket create_socket_perms;")
+			case strings.HasPrefix(rule.Target, "/proc/sys/net/"):
+				add(&te, "kernel_read_net_sysctls(mycoria_t)")
+			case strings.HasPrefix(rule.Target, "/proc/"):
+				add(&te, "kernel_read_system_state(mycoria_t)")
+				add(&te, "kernel_read_network_state(mycoria_t)")
+			case strings.HasPrefix(rule.Target, "/sys/fs/cgroup"):
+				add(&te, "fs_read_cgroup_files(mycoria_t)")
+			case strings.HasPrefix(rule.Target, "/etc/"):
+				add(&te, "sysnet_read_config(mycoria_t)")
+				add(&te, "files_read_etc_files(mycoria_t)")
+			case rule.Target == executable:
+				if rule.Access == "rw" {
+					add(&te, "allow mycoria_t mycoria_exec_t:file { manage_file_perms };")
+				}
+			case strings.HasSuffix(rule.Target, "/"):
+				add(&fc, fmt.Sprintf("%s(/.*)? gen_context(system_u:object_r:mycoria_var_lib_t,s0)", strings.TrimSuffix(rule.Target, "/")))
+				add(&te, "manage_dirs_pattern(mycoria_t, mycoria_var_lib_t, mycoria_var_lib_t)")
+				add(&te, "manage_files_pattern(mycoria_t, mycoria_var_lib_t, mycoria_var_lib_t)")
+			case rule.Access == "rw":
+				add(&fc, fmt.Sprintf("%s -- gen_context(system_u:object_r:mycoria_var_lib_t,s0)", rule.Target))
+				add(&te, "manage_files_pattern(mycoria_t, mycoria_var_lib_t, mycoria_var_lib_t)")
+			case !writable(rule.Target):
+				add(&notes, fmt.Sprintf("allow reading %s (%s)", rule.Target, rule.Reason))
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# SELinux policy module for mycoria, generated by \"mycoria debug confinement --format selinux\".\n")
+	b.WriteString("# Save the parts to mycoria.te and mycoria.fc, then build and install with\n")
+	b.WriteString("# \"make -f /usr/share/selinux/devel/Makefile mycoria.pp && semodule -i mycoria.pp\".\n\n")
+	b.WriteString("### mycoria.te\n\npolicy_module(mycoria, 1.0)\n\n")
+	b.WriteString("type mycoria_t;\ntype mycoria_exec_t;\ninit_daemon_domain(mycoria_t, mycoria_exec_t)\n\n")
+	b.WriteString("type mycoria_var_lib_t;\nfiles_type(mycoria_var_lib_t)\n\n")
+	for _, line := range te {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	if len(notes) > 0 {
+		b.WriteString("\n# Adapt to the labels of your system:\n")
+		for _, note := range notes {
+			fmt.Fprintf(&b, "# - %s\n", note)
+		}
+	}
+	b.WriteString("\n### mycoria.fc\n\n")
+	for _, line := range fc {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	return b.String()
+}
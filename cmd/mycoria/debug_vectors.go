@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/vectors"
+)
+
+func init() {
+	debugCmd.AddCommand(debugVectorsCmd)
+
+	debugVectorsCmd.Flags().StringVar(&debugVectorsOut, "out", "", "write the vectors to this file instead of stdout")
+	debugVectorsCmd.Flags().BoolVar(&debugVectorsCheck, "check", false, "only check if the generated vectors match the published golden vectors")
+}
+
+var (
+	debugVectorsCmd = &cobra.Command{
+		Use:   "vectors",
+		Short: "Generate golden test vectors",
+		Long:  "Generate the golden test vectors: signed announce frames with nested attachments, peering handshakes and sealed frames, including all keys. The vectors are deterministic and are published in vectors/golden.json. Only available in development mode.",
+		Args:  cobra.NoArgs,
+		RunE:  debugVectors,
+	}
+
+	debugVectorsOut   string
+	debugVectorsCheck bool
+)
+
+func debugVectors(cmd *cobra.Command, args []string) error {
+	if !*devMode {
+		return errors.New("only available in development mode (--devmode)")
+	}
+
+	set, err := vectors.Generate()
+	if err != nil {
+		return fmt.Errorf("failed to generate vectors: %w", err)
+	}
+	data, err := set.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal vectors: %w", err)
+	}
+
+	// Compare with golden vectors.
+	if debugVectorsCheck {
+		golden, err := vectors.Golden()
+		if err != nil {
+			return fmt.Errorf("failed to load golden vectors: %w", err)
+		}
+		goldenData, err := golden.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal golden vectors: %w", err)
+		}
+		if string(data) != string(goldenData) {
+			return errors.New("generated vectors do not match the golden vectors")
+		}
+		fmt.Println("generated vectors match the golden vectors")
+		return nil
+	}
+
+	// Output vectors.
+	if debugVectorsOut == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(debugVectorsOut, data, 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to write vectors: %w", err)
+	}
+	fmt.Printf("vectors written to %s\n", debugVectorsOut)
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+func init() {
+	rootCmd.AddCommand(friendCmd)
+	friendCmd.AddCommand(friendAddCmd)
+	friendCmd.AddCommand(friendRemoveCmd)
+	friendCmd.AddCommand(friendListCmd)
+}
+
+var (
+	friendCmd = &cobra.Command{
+		Use:   "friend",
+		Short: "Manage friends",
+		Long:  "Manage friends in the config file. A running router applies the changes within a few seconds.",
+	}
+	friendAddCmd = &cobra.Command{
+		Use:   "add [name] [router IP]",
+		Short: "Add a friend, reachable at [name].myco",
+		Args:  cobra.ExactArgs(2),
+		RunE:  friendAdd,
+	}
+	friendRemoveCmd = &cobra.Command{
+		Use:   "remove [name]",
+		Short: "Remove a friend",
+		Args:  cobra.ExactArgs(1),
+		RunE:  friendRemove,
+	}
+	friendListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List all friends",
+		Args:  cobra.NoArgs,
+		RunE:  friendList,
+	}
+)
+
+func friendAdd(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	ip, err := netip.ParseAddr(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid router IP: %w", err)
+	}
+	if err := c.AddFriend(config.Friend{Name: args[0], IP: ip}); err != nil {
+		return fmt.Errorf("failed to add friend: %w", err)
+	}
+	if err := c.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("added friend %s%s at %s\n", args[0], config.DefaultDotTLD, ip)
+	return nil
+}
+
+func friendRemove(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := c.RemoveFriend(args[0]); err != nil {
+		return fmt.Errorf("failed to remove friend: %w", err)
+	}
+	if err := c.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("removed friend %s\n", args[0])
+	return nil
+}
+
+func friendList(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	for _, friend := range c.GetFriends() {
+		fmt.Printf("%s%s %s\n", friend.Name, config.DefaultDotTLD, friend.IP)
+	}
+	return nil
+}
@@ -79,14 +79,6 @@ func generate(cmd *cobra.Command, args []string) error {
 }
 
 func makeDefaultConfig(id *m.Address) config.Store {
-	// Find state path.
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		homeDir = os.TempDir()
-	}
-	_ = os.Mkdir(filepath.Join(homeDir, ".mycoria"), 0o0750)
-	statePath := filepath.Join(homeDir, ".mycoria", "state.json")
-
 	// Get public IPs.
 	var iana []string
 	addrs, err := net.InterfaceAddrs()
@@ -111,7 +103,7 @@ func makeDefaultConfig(id *m.Address) config.Store {
 			Bootstrap:   []string{"tcp://bootstrap.mycoria.org:47369"},
 		},
 		System: config.System{
-			StatePath: statePath,
+			StatePath: defaultStatePath(),
 		},
 		ServiceConfigs: []config.ServiceConfig{{
 			Name:   "ping",
@@ -121,6 +113,17 @@ func makeDefaultConfig(id *m.Address) config.Store {
 	}
 }
 
+// defaultStatePath returns the default path of the state file in the home
+// directory of the user.
+func defaultStatePath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = os.TempDir()
+	}
+	_ = os.Mkdir(filepath.Join(homeDir, ".mycoria"), 0o0750)
+	return filepath.Join(homeDir, ".mycoria", "state.json")
+}
+
 type reallyFreeGeoIPResponse struct {
 	CountryCode string `json:"country_code"`
 	RegionCode  string `json:"region_code"`
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+	"github.com/mycoria/mycoria/router"
+)
+
+func init() {
+	rootCmd.AddCommand(groupCmd)
+	groupCmd.AddCommand(groupListCmd)
+	groupCmd.AddCommand(groupJoinCmd)
+	groupCmd.AddCommand(groupLeaveCmd)
+	groupCmd.AddCommand(groupPublishCmd)
+	groupCmd.AddCommand(groupWatchCmd)
+}
+
+var (
+	groupCmd = &cobra.Command{
+		Use:   "group",
+		Short: "Publish and receive messages in groups",
+		Long:  "Publish and receive messages in groups. Routers announce the groups they are a member of and messages published to a group are delivered to all its members. Group names and memberships are public.",
+	}
+	groupListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List joined groups",
+		Args:  cobra.NoArgs,
+		RunE:  groupList,
+	}
+	groupJoinCmd = &cobra.Command{
+		Use:   "join [group]",
+		Short: "Join a group until the next restart",
+		Long:  "Join a group until the next restart. Add the group to router.groups in the config to join it permanently.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  groupJoin,
+	}
+	groupLeaveCmd = &cobra.Command{
+		Use:   "leave [group]",
+		Short: "Leave a group",
+		Args:  cobra.ExactArgs(1),
+		RunE:  groupLeave,
+	}
+	groupPublishCmd = &cobra.Command{
+		Use:   "publish [group] [message]",
+		Short: "Publish a message to a group",
+		Args:  cobra.ExactArgs(2),
+		RunE:  groupPublish,
+	}
+	groupWatchCmd = &cobra.Command{
+		Use:   "watch [group]",
+		Short: "Print messages published to a group",
+		Args:  cobra.ExactArgs(1),
+		RunE:  groupWatch,
+	}
+)
+
+func groupList(cmd *cobra.Command, args []string) error {
+	var groups []control.Group
+	if err := controlRequest(http.MethodGet, "/groups", nil, &groups); err != nil {
+		return fmt.Errorf("failed to get groups: %w", err)
+	}
+
+	for _, group := range groups {
+		fmt.Printf("%s: %d other members", group.Name, group.Members)
+		if group.Configured {
+			fmt.Print(" (config)")
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func groupJoin(cmd *cobra.Command, args []string) error {
+	if err := controlRequest(http.MethodPost, "/groups/"+args[0]+"/join", nil, nil); err != nil {
+		return fmt.Errorf("failed to join group: %w", err)
+	}
+	fmt.Println("joined, other routers learn about it with the next announcement")
+	return nil
+}
+
+func groupLeave(cmd *cobra.Command, args []string) error {
+	if err := controlRequest(http.MethodPost, "/groups/"+args[0]+"/leave", nil, nil); err != nil {
+		return fmt.Errorf("failed to leave group: %w", err)
+	}
+	fmt.Println("left")
+	return nil
+}
+
+func groupPublish(cmd *cobra.Command, args []string) error {
+	var result control.GroupPublishResult
+	req := control.GroupPublishRequest{Data: []byte(args[1])}
+	if err := controlRequest(http.MethodPost, "/groups/"+args[0]+"/publish", req, &result); err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+	fmt.Printf("published to %d members\n", result.Members)
+	return nil
+}
+
+func groupWatch(cmd *cobra.Command, args []string) error {
+	apiAddr, err := controlAddress()
+	if err != nil {
+		return err
+	}
+	resp, err := http.Get("http://" + apiAddr.String() + control.Path + "/groups/" + args[0] + "/messages") //nolint:noctx
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1000))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	// Print messages until the router stops.
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg router.GroupMessage
+		if err := dec.Decode(&msg); err != nil {
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+		fmt.Printf("%s %s: %s\n", msg.Time.Local().Format(time.DateTime), msg.Publisher, msg.Data)
+	}
+}
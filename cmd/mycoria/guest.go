@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	rootCmd.AddCommand(guestTokenCmd)
+	guestTokenCmd.Flags().StringVar(&guestTokenFor, "for", "", "only allow the given router to use the token")
+	guestTokenCmd.Flags().DurationVar(&guestTokenValid, "valid", 24*time.Hour, "set how long the token is valid")
+}
+
+var (
+	guestTokenCmd = &cobra.Command{
+		Use:   "guest-token [service name]",
+		Short: "Create a guest token granting temporary access to a service",
+		Long:  "Create a guest token granting temporary access to a service. The guest redeems the token in their dashboard.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  guestToken,
+	}
+
+	guestTokenFor   string
+	guestTokenValid time.Duration
+)
+
+func guestToken(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	identity, err := c.Identity()
+	if err != nil {
+		return fmt.Errorf("failed to load identity: %w", err)
+	}
+
+	// Check service.
+	svc, ok := c.GetService(args[0])
+	switch {
+	case !ok:
+		return fmt.Errorf("service %q not found in config", args[0])
+	case svc.Public:
+		return errors.New("service is public, no guest token required")
+	}
+
+	// Parse guest.
+	var guest netip.Addr
+	if guestTokenFor != "" {
+		guest, err = netip.ParseAddr(guestTokenFor)
+		if err != nil || !m.RoutingAddressPrefix.Contains(guest) {
+			return errors.New("--for must be a valid mycoria router address")
+		}
+	}
+
+	// Mint and print token.
+	token, err := m.MintGuestToken(identity, svc.Name, guest, guestTokenValid)
+	if err != nil {
+		return fmt.Errorf("failed to create guest token: %w", err)
+	}
+	fmt.Println(token)
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/ha"
+)
+
+func init() {
+	rootCmd.AddCommand(haWitnessCmd)
+
+	haWitnessCmd.Flags().StringVar(&haWitnessListen, "listen", ":7474", "listen on this TCP address")
+}
+
+var (
+	haWitnessCmd = &cobra.Command{
+		Use:   "ha-witness",
+		Short: "Run a witness for high availability pairs",
+		Long:  "Run a witness that arbitrates which router of a high availability pair may be active. Add its address to system.ha.witnesses of both routers. A witness can serve any number of pairs and does not need a config.",
+		Args:  cobra.NoArgs,
+		RunE:  runHAWitness,
+	}
+
+	haWitnessListen string
+)
+
+func runHAWitness(cmd *cobra.Command, args []string) error {
+	ln, err := net.Listen("tcp", haWitnessListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	slog.Info("ha witness ready", "listen", ln.Addr())
+	return ha.NewWitness().Serve(ctx, ln)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	rootCmd.AddCommand(inviteCmd)
+	inviteCmd.Flags().StringVar(&inviteName, "name", "", "suggest a friend name for this router")
+	inviteCmd.Flags().DurationVar(&inviteValid, "valid", 7*24*time.Hour, "set how long the invite is valid")
+	inviteCmd.Flags().StringSliceVar(&inviteURLs, "url", nil, "add a peering URL this router is reachable at")
+
+	inviteCmd.AddCommand(inviteAcceptCmd)
+	inviteAcceptCmd.Flags().StringVar(&inviteName, "name", "", "set the friend name, overriding the suggested name")
+	inviteAcceptCmd.Flags().BoolVar(&invitePeer, "peer", false, "also connect directly to the router")
+}
+
+var (
+	inviteCmd = &cobra.Command{
+		Use:   "invite",
+		Short: "Create an invite for adding this router as a friend",
+		Long:  "Create a signed invite containing the identity and peering URLs of this router. The invited router accepts it with \"mycoria invite accept\".",
+		Args:  cobra.NoArgs,
+		RunE:  invite,
+	}
+	inviteAcceptCmd = &cobra.Command{
+		Use:   "accept [invite]",
+		Short: "Accept an invite and add the inviting router as a friend",
+		Args:  cobra.ExactArgs(1),
+		RunE:  inviteAccept,
+	}
+
+	inviteName  string
+	inviteValid time.Duration
+	inviteURLs  []string
+	invitePeer  bool
+)
+
+func invite(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	identity, err := c.Identity()
+	if err != nil {
+		return fmt.Errorf("failed to load identity: %w", err)
+	}
+
+	// Check name.
+	if inviteName != "" {
+		if err := config.CheckFriendName(inviteName); err != nil {
+			return fmt.Errorf("invalid name: %w", err)
+		}
+	}
+
+	// Collect reachable peering URLs.
+	peeringURLs := make([]string, 0, len(inviteURLs))
+	for _, u := range inviteURLs {
+		if _, err := m.ParsePeeringURL(u); err != nil {
+			return fmt.Errorf("invalid peering URL %q: %w", u, err)
+		}
+		peeringURLs = append(peeringURLs, u)
+	}
+	for _, u := range c.InvitePeeringURLs() {
+		if !slices.Contains(peeringURLs, u) {
+			peeringURLs = append(peeringURLs, u)
+		}
+	}
+
+	// Mint and print invite.
+	code, err := m.MintInvite(identity, inviteName, peeringURLs, inviteValid)
+	if err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
+	fmt.Println(code)
+
+	return nil
+}
+
+func inviteAccept(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Parse and verify invite.
+	inv, err := m.ParseInvite(args[0])
+	if err != nil {
+		return err
+	}
+	name := inviteName
+	if name == "" {
+		name = inv.Name
+	}
+	if name == "" {
+		return errors.New("invite does not suggest a name, please set one with --name")
+	}
+
+	// Add friend with pinned key.
+	err = c.AddFriend(config.Friend{
+		Name:    name,
+		IP:      inv.Router.IP,
+		Address: &inv.Router,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add friend: %w", err)
+	}
+
+	// Add peering URLs.
+	var addedPeering bool
+	if invitePeer {
+		if len(inv.PeeringURLs) == 0 {
+			return errors.New("invite does not contain any peering URLs")
+		}
+		for _, u := range inv.PeeringURLs {
+			if _, err := m.ParsePeeringURL(u); err != nil {
+				continue
+			}
+			if !slices.Contains(c.Router.Connect, u) {
+				c.Router.Connect = append(c.Router.Connect, u)
+				addedPeering = true
+			}
+		}
+	}
+
+	if err := c.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("added friend %s%s at %s\n", name, config.DefaultDotTLD, inv.Router.IP)
+	if addedPeering {
+		fmt.Println("added peering URLs to router.connect, restart the router to connect")
+	}
+	return nil
+}
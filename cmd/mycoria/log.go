@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+)
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+	logCmd.AddCommand(logLevelsCmd)
+	logCmd.AddCommand(logSetCmd)
+	logCmd.AddCommand(logResetCmd)
+}
+
+var (
+	logCmd = &cobra.Command{
+		Use:   "log",
+		Short: "Manage logging of the running router",
+	}
+	logLevelsCmd = &cobra.Command{
+		Use:   "levels",
+		Short: "Show the current log levels",
+		Args:  cobra.NoArgs,
+		RunE:  logLevels,
+	}
+	logSetCmd = &cobra.Command{
+		Use:   "set [module] [level]",
+		Short: "Set the log level of a module, eg. \"router debug\"",
+		Long:  "Set the log level of a module, eg. \"router debug\". Modules are matched by their package or type name, eg. \"router\", \"peering\", \"dns\" or \"switch\". Use \"default\" as the module to set the log level of all other modules. Changes are lost on restart.",
+		Args:  cobra.ExactArgs(2),
+		RunE:  logSet,
+	}
+	logResetCmd = &cobra.Command{
+		Use:   "reset [module]",
+		Short: "Reset the log level of a module to the default",
+		Args:  cobra.ExactArgs(1),
+		RunE:  logReset,
+	}
+)
+
+func logLevels(cmd *cobra.Command, args []string) error {
+	var levels control.LogLevels
+	if err := controlRequest(http.MethodGet, "/log/levels", nil, &levels); err != nil {
+		return fmt.Errorf("failed to get log levels: %w", err)
+	}
+	printLogLevels(levels)
+	return nil
+}
+
+func logSet(cmd *cobra.Command, args []string) error {
+	var levels control.LogLevels
+	err := controlRequest(http.MethodPut, "/log/levels/"+url.PathEscape(args[0]), control.SetLogLevel{
+		Level: args[1],
+	}, &levels)
+	if err != nil {
+		return fmt.Errorf("failed to set log level: %w", err)
+	}
+	printLogLevels(levels)
+	return nil
+}
+
+func logReset(cmd *cobra.Command, args []string) error {
+	var levels control.LogLevels
+	if err := controlRequest(http.MethodDelete, "/log/levels/"+url.PathEscape(args[0]), nil, &levels); err != nil {
+		return fmt.Errorf("failed to reset log level: %w", err)
+	}
+	printLogLevels(levels)
+	return nil
+}
+
+func printLogLevels(levels control.LogLevels) {
+	fmt.Printf("%s: %s\n", control.LogLevelDefault, levels.Default)
+	modules := make([]string, 0, len(levels.Modules))
+	for module := range levels.Modules {
+		modules = append(modules, module)
+	}
+	slices.Sort(modules)
+	for _, module := range modules {
+		fmt.Printf("%s: %s\n", module, levels.Modules[module])
+	}
+}
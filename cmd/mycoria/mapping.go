@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+	"github.com/mycoria/mycoria/api/dns"
+)
+
+func init() {
+	rootCmd.AddCommand(mappingCmd)
+	mappingCmd.AddCommand(mappingListCmd)
+	mappingCmd.AddCommand(mappingSetCmd)
+	mappingCmd.AddCommand(mappingApproveCmd)
+	mappingCmd.AddCommand(mappingRenameCmd)
+	mappingCmd.AddCommand(mappingDeleteCmd)
+	mappingCmd.AddCommand(mappingExportCmd)
+	mappingCmd.AddCommand(mappingImportCmd)
+
+	mappingListCmd.Flags().BoolVar(&mappingConflictsOnly, "conflicts", false, "only list mappings with conflicts")
+	mappingImportCmd.Flags().BoolVar(&mappingImportOverwrite, "overwrite", false, "replace existing mappings to other routers")
+}
+
+var (
+	mappingCmd = &cobra.Command{
+		Use:   "mapping",
+		Short: "Manage domain mappings of the running router",
+		Long:  "Manage domain mappings of the running router. Domains are mapped to a router when they are first opened and are trusted from then on. A mapping has a conflict when the domain is now advertised by another router, eg. because its owner changed the router key.",
+	}
+	mappingListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List all domain mappings",
+		Args:  cobra.NoArgs,
+		RunE:  mappingList,
+	}
+	mappingSetCmd = &cobra.Command{
+		Use:   "set [domain] [router]",
+		Short: "Map a domain to a router",
+		Args:  cobra.ExactArgs(2),
+		RunE:  mappingSet,
+	}
+	mappingApproveCmd = &cobra.Command{
+		Use:   "approve [domain] [router]",
+		Short: "Resolve a conflict by mapping the domain to the router that now advertises it",
+		Long:  "Resolve a conflict by mapping the domain to the router that now advertises it. The router is only required if multiple routers advertise the domain.",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  mappingApprove,
+	}
+	mappingRenameCmd = &cobra.Command{
+		Use:   "rename [domain] [new domain]",
+		Short: "Rename a domain mapping",
+		Args:  cobra.ExactArgs(2),
+		RunE:  mappingRename,
+	}
+	mappingDeleteCmd = &cobra.Command{
+		Use:   "delete [domain]",
+		Short: "Delete a domain mapping",
+		Args:  cobra.ExactArgs(1),
+		RunE:  mappingDelete,
+	}
+	mappingExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export all domain mappings as JSON to stdout",
+		Args:  cobra.NoArgs,
+		RunE:  mappingExport,
+	}
+	mappingImportCmd = &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import domain mappings from an export",
+		Long:  "Import domain mappings from an export. Reads from stdin if no file is given. Existing mappings to other routers are skipped, unless --overwrite is set.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  mappingImport,
+	}
+
+	mappingConflictsOnly   bool
+	mappingImportOverwrite bool
+)
+
+func mappingList(cmd *cobra.Command, args []string) error {
+	path := "/mappings"
+	if mappingConflictsOnly {
+		path += "?conflicts=true"
+	}
+	var mappings []dns.Mapping
+	if err := controlRequest(http.MethodGet, path, nil, &mappings); err != nil {
+		return fmt.Errorf("failed to get mappings: %w", err)
+	}
+
+	for _, mapping := range mappings {
+		fmt.Printf("%s %s", mapping.Domain, mapping.Router)
+		if mapping.Conflict() {
+			advertisedBy := make([]string, 0, len(mapping.AdvertisedBy))
+			for _, ip := range mapping.AdvertisedBy {
+				advertisedBy = append(advertisedBy, ip.String())
+			}
+			fmt.Printf(" [conflict: advertised by %s]", strings.Join(advertisedBy, ","))
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func mappingSet(cmd *cobra.Command, args []string) error {
+	router, err := netip.ParseAddr(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid router: %w", err)
+	}
+
+	var mapping dns.Mapping
+	err = controlRequest(http.MethodPost, "/mappings", control.MappingRequest{
+		Domain: args[0],
+		Router: router,
+	}, &mapping)
+	if err != nil {
+		return fmt.Errorf("failed to set mapping: %w", err)
+	}
+
+	fmt.Printf("mapped %s to %s\n", mapping.Domain, mapping.Router)
+	return nil
+}
+
+func mappingApprove(cmd *cobra.Command, args []string) error {
+	var req control.MappingRequest
+	if len(args) == 2 {
+		router, err := netip.ParseAddr(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid router: %w", err)
+		}
+		req.Router = router
+	}
+
+	var mapping dns.Mapping
+	if err := controlRequest(http.MethodPost, "/mappings/"+url.PathEscape(args[0])+"/approve", req, &mapping); err != nil {
+		return fmt.Errorf("failed to approve mapping: %w", err)
+	}
+
+	fmt.Printf("mapped %s to %s\n", mapping.Domain, mapping.Router)
+	return nil
+}
+
+func mappingRename(cmd *cobra.Command, args []string) error {
+	var mapping dns.Mapping
+	err := controlRequest(http.MethodPost, "/mappings/"+url.PathEscape(args[0])+"/rename", control.MappingRequest{
+		Domain: args[1],
+	}, &mapping)
+	if err != nil {
+		return fmt.Errorf("failed to rename mapping: %w", err)
+	}
+
+	fmt.Printf("renamed %s to %s\n", args[0], mapping.Domain)
+	return nil
+}
+
+func mappingDelete(cmd *cobra.Command, args []string) error {
+	if err := controlRequest(http.MethodDelete, "/mappings/"+url.PathEscape(args[0]), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete mapping: %w", err)
+	}
+
+	fmt.Printf("deleted mapping of %s\n", args[0])
+	return nil
+}
+
+func mappingExport(cmd *cobra.Command, args []string) error {
+	var mappings []dns.Mapping
+	if err := controlRequest(http.MethodGet, "/mappings", nil, &mappings); err != nil {
+		return fmt.Errorf("failed to get mappings: %w", err)
+	}
+
+	// Conflicts are specific to the current state of the network.
+	for i := range mappings {
+		mappings[i].AdvertisedBy = nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(mappings)
+}
+
+func mappingImport(cmd *cobra.Command, args []string) error {
+	// Read mappings.
+	in := os.Stdin
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close() //nolint:errcheck
+		in = f
+	}
+	var mappings []dns.Mapping
+	if err := json.NewDecoder(in).Decode(&mappings); err != nil {
+		return fmt.Errorf("failed to parse mappings: %w", err)
+	}
+
+	// Import.
+	path := "/mappings/import"
+	if mappingImportOverwrite {
+		path += "?overwrite=true"
+	}
+	var result dns.MappingImportResult
+	if err := controlRequest(http.MethodPost, path, mappings, &result); err != nil {
+		return fmt.Errorf("failed to import mappings: %w", err)
+	}
+
+	for _, msg := range result.Errors {
+		fmt.Printf("skipped %s\n", msg)
+	}
+	fmt.Printf("imported=%d unchanged=%d skipped=%d\n", result.Imported, result.Unchanged, result.Skipped)
+	return nil
+}
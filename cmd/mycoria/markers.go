@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	rootCmd.AddCommand(markersCmd)
+	markersCmd.AddCommand(markersExportCmd)
+	markersCmd.AddCommand(markersSignCmd)
+
+	markersSignCmd.Flags().StringVar(&markersSignOut, "out", "", "write the signed table to this file instead of the state directory")
+}
+
+var (
+	markersCmd = &cobra.Command{
+		Use:   "markers",
+		Short: "Show the active country geo marker table of the running router",
+		Long:  "Show the active country geo marker table of the running router. Updated tables signed by a router listed in router.markerTableSigners are loaded from the state directory on start, so that the address plan can be updated without upgrading.",
+		Args:  cobra.NoArgs,
+		RunE:  markers,
+	}
+	markersExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export the active country geo marker table as JSON to stdout",
+		Args:  cobra.NoArgs,
+		RunE:  markersExport,
+	}
+	markersSignCmd = &cobra.Command{
+		Use:   "sign [file]",
+		Short: "Sign a country geo marker table with the identity of this router",
+		Long:  "Sign a country geo marker table in the JSON format of \"mycoria markers export\" with the identity of this router. The version must be increased for routers to load the table. The signed table is written to the state directory, unless --out is set.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  markersSign,
+	}
+
+	markersSignOut string
+)
+
+func markers(cmd *cobra.Command, args []string) error {
+	var table control.MarkerTable
+	if err := controlRequest(http.MethodGet, "/markers", nil, &table); err != nil {
+		return fmt.Errorf("failed to get marker table: %w", err)
+	}
+
+	fmt.Printf("version:   %d\n", table.Version)
+	fmt.Printf("builtin:   %d\n", table.BuiltinVersion)
+	if table.Signer.IsValid() {
+		fmt.Printf("signer:    %s\n", table.Signer)
+	}
+	fmt.Printf("countries: %d\n", table.Countries)
+	return nil
+}
+
+func markersExport(cmd *cobra.Command, args []string) error {
+	var table control.MarkerTable
+	if err := controlRequest(http.MethodGet, "/markers?full=true", nil, &table); err != nil {
+		return fmt.Errorf("failed to get marker table: %w", err)
+	}
+	if table.Table == nil {
+		return errors.New("router did not return the table")
+	}
+	table.Table.Signer = netip.Addr{} // Set when signing.
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(table.Table)
+}
+
+func markersSign(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	identity, err := c.Identity()
+	if err != nil {
+		return fmt.Errorf("failed to load identity: %w", err)
+	}
+
+	// Read and check table.
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var unchecked m.MarkerTable
+	if err := json.Unmarshal(data, &unchecked); err != nil {
+		return fmt.Errorf("failed to parse table: %w", err)
+	}
+	table, err := m.NewMarkerTable(unchecked.Version, unchecked.Countries)
+	if err != nil {
+		return err
+	}
+	if table.Version <= m.BuiltinMarkerTableVersion {
+		fmt.Printf("warning: version %d is not newer than the builtin table (%d) and will be ignored\n", table.Version, m.BuiltinMarkerTableVersion)
+	}
+
+	// Sign and write.
+	signed, err := m.SignMarkerTable(identity, table)
+	if err != nil {
+		return err
+	}
+	out := markersSignOut
+	if out == "" {
+		out = c.MarkerTablePath()
+		if out == "" {
+			return errors.New("no state path configured, please set --out")
+		}
+	}
+	if err := os.WriteFile(out, signed, 0o644); err != nil { //nolint:gosec // Table is public.
+		return fmt.Errorf("failed to write signed table: %w", err)
+	}
+
+	fmt.Printf("signed table version %d with %d countries as %s\n", table.Version, len(table.Countries), identity.IP)
+	fmt.Printf("written to %s\n", out)
+	fmt.Println("routers load the table on start, if they trust this router in router.markerTableSigners")
+	return nil
+}
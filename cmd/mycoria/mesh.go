@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	rootCmd.AddCommand(meshCmd)
+
+	meshCmd.AddCommand(meshInitCmd)
+	meshInitCmd.Flags().StringVar(&meshCountry, "country", "", "set the country code of the generated addresses; omit to ask reallyfreegeoip.org")
+	meshInitCmd.Flags().StringVar(&meshOut, "out", "mesh.yaml", "set the file to write the bundle to")
+	meshInitCmd.Flags().BoolVar(&meshForce, "force", false, "overwrite an existing file")
+
+	meshCmd.AddCommand(meshJoinCmd)
+	meshJoinCmd.Flags().StringVar(&meshStatePath, "state", "", "set the state path; defaults to ~/.mycoria/state.json")
+	meshJoinCmd.Flags().BoolVar(&meshForce, "force", false, "overwrite an existing file")
+}
+
+var (
+	meshCmd = &cobra.Command{
+		Use:   "mesh",
+		Short: "Set up a private mesh",
+		Long:  "Set up a private mesh of a few routers in their own universe, eg. for a lab. Create a bundle with \"mycoria mesh init\", copy it to all routers and create their configs with \"mycoria mesh join\". The bundle holds the private keys of all routers and must be kept secret.",
+	}
+	meshInitCmd = &cobra.Command{
+		Use:   "init [universe] [name=peering URL]...",
+		Short: "Create a mesh bundle with a new universe and identities for all routers",
+		Long:  "Create a mesh bundle with a new universe, a random universe secret and an identity for every router. Routers are defined by their name and the peering URL they are reachable at, eg. \"lab1=tcp://192.0.2.1:47369\".",
+		Args:  cobra.MinimumNArgs(3),
+		RunE:  meshInit,
+	}
+	meshJoinCmd = &cobra.Command{
+		Use:   "join [bundle] [name]",
+		Short: "Create the config of a router from a mesh bundle",
+		Long:  "Create the config of the named router from a mesh bundle and write it to the config file. The router bootstraps to all other routers of the mesh and has them as friends.",
+		Args:  cobra.ExactArgs(2),
+		RunE:  meshJoin,
+	}
+
+	meshCountry   string
+	meshOut       string
+	meshStatePath string
+	meshForce     bool
+)
+
+func meshInit(cmd *cobra.Command, args []string) error {
+	if err := checkMeshOutput(meshOut); err != nil {
+		return err
+	}
+
+	// Get country prefix.
+	geoMark := meshCountry
+	if geoMark == "" {
+		geoIPMark, err := getGeoMarkFromGeoIP()
+		if err != nil {
+			return fmt.Errorf("failed to auto-detect country code, please set with --country: %w", err)
+		}
+		geoMark = geoIPMark
+	}
+	prefix, err := m.GetCountryPrefix(geoMark)
+	if err != nil {
+		return fmt.Errorf("invalid country code %q: %w", geoMark, err)
+	}
+
+	// Create bundle.
+	secret, err := config.NewMeshUniverseSecret()
+	if err != nil {
+		return fmt.Errorf("failed to generate universe secret: %w", err)
+	}
+	bundle := &config.MeshBundle{
+		Universe:       args[0],
+		UniverseSecret: secret,
+	}
+	for _, def := range args[1:] {
+		name, peeringURL, ok := strings.Cut(def, "=")
+		if !ok {
+			return fmt.Errorf("invalid router definition %q: must be in the format name=peeringURL", def)
+		}
+		addr, _, err := m.GenerateRoutableAddress(cmd.Context(), []netip.Prefix{prefix})
+		if err != nil {
+			return fmt.Errorf("failed to generate address: %w", err)
+		}
+		bundle.Nodes = append(bundle.Nodes, config.MeshNode{
+			Name:       name,
+			PeeringURL: peeringURL,
+			Address:    addr.Store(),
+		})
+	}
+	if err := bundle.Check(); err != nil {
+		return fmt.Errorf("invalid mesh: %w", err)
+	}
+
+	if err := bundle.SaveTo(meshOut); err != nil {
+		return fmt.Errorf("failed to save mesh bundle: %w", err)
+	}
+
+	fmt.Printf("created mesh bundle for universe %s at %s\n", bundle.Universe, meshOut)
+	for _, node := range bundle.Nodes {
+		fmt.Printf("  %s: mycoria mesh join --config <config file> %s %s\n", node.Name, meshOut, node.Name)
+	}
+	return nil
+}
+
+func meshJoin(cmd *cobra.Command, args []string) error {
+	if *configFile == "" {
+		return errors.New("please set the config file to write to with --config")
+	}
+	if err := checkMeshOutput(*configFile); err != nil {
+		return err
+	}
+
+	bundle, err := config.LoadMeshBundle(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load mesh bundle: %w", err)
+	}
+	store, err := bundle.NodeConfig(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to create config: %w", err)
+	}
+	store.System.StatePath = meshStatePath
+	if store.System.StatePath == "" {
+		store.System.StatePath = defaultStatePath()
+	}
+
+	// Check if the config is valid before writing it.
+	if _, err := store.Parse(); err != nil {
+		return fmt.Errorf("failed to check config: %w", err)
+	}
+	if err := store.SaveTo(*configFile); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("joined mesh %s as %s, config written to %s\n", bundle.Universe, args[1], *configFile)
+	return nil
+}
+
+// checkMeshOutput checks if the given file may be written to.
+func checkMeshOutput(filename string) error {
+	_, err := os.Stat(filename)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to check %s: %w", filename, err)
+	case !meshForce:
+		return fmt.Errorf("%s already exists, use --force to overwrite", filename)
+	default:
+		return nil
+	}
+}
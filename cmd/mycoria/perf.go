@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/perf"
+)
+
+func init() {
+	rootCmd.AddCommand(perfCmd)
+	perfCmd.Flags().Uint16Var(&perfPort, "port", config.DefaultPerfPort, "set the port of the responder")
+	perfCmd.Flags().DurationVar(&perfTime, "time", 10*time.Second, "set how long to test each direction")
+}
+
+var (
+	perfCmd = &cobra.Command{
+		Use:   "perf [router IP or domain]",
+		Short: "Measure throughput, latency and loss to another router",
+		Long:  "Measure throughput, latency and loss to another router over the mesh. The other router must run the throughput test responder by defining a service with a perf:// URL, which must allow access for this router.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPerf,
+	}
+
+	perfPort uint16
+	perfTime time.Duration
+)
+
+func runPerf(cmd *cobra.Command, args []string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	// Resolve destination.
+	dst, err := netip.ParseAddr(args[0])
+	if err != nil {
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip6", args[0])
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", args[0], err)
+		}
+		if len(ips) == 0 {
+			return errors.New("destination has no IPv6 address")
+		}
+		dst = ips[0]
+	}
+
+	// Run test.
+	fmt.Printf("testing %s for %s in each direction...\n", dst, perfTime)
+	result, err := perf.Run(ctx, netip.AddrPortFrom(dst, perfPort), perfTime)
+	if err != nil {
+		return fmt.Errorf("throughput test failed: %w", err)
+	}
+
+	// Print results.
+	fmt.Printf("idle:  %s\n", formatLatency(result.Idle))
+	fmt.Printf("up:    %s, %s\n", formatThroughput(result.Up), formatLatency(result.Up.Latency))
+	fmt.Printf("down:  %s, %s\n", formatThroughput(result.Down), formatLatency(result.Down.Latency))
+	return nil
+}
+
+func formatThroughput(d perf.Direction) string {
+	bps := d.BitsPerSecond()
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.2f Gbit/s", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.2f Mbit/s", bps/1e6)
+	default:
+		return fmt.Sprintf("%.2f kbit/s", bps/1e3)
+	}
+}
+
+func formatLatency(l perf.Latency) string {
+	if l.Received == 0 {
+		return fmt.Sprintf("no probes answered (%d sent)", l.Sent)
+	}
+	return fmt.Sprintf(
+		"latency min/avg/max %s/%s/%s, loss %.1f%%",
+		l.Min.Round(100*time.Microsecond),
+		l.Avg.Round(100*time.Microsecond),
+		l.Max.Round(100*time.Microsecond),
+		l.Loss()*100,
+	)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+)
+
+func init() {
+	rootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyCheckCmd)
+}
+
+var (
+	policyCmd = &cobra.Command{
+		Use:   "policy",
+		Short: "Test the traffic policy of the running router",
+	}
+	policyCheckCmd = &cobra.Command{
+		Use:   "check [in|out] [router IP or friend] [tcp|udp|icmp6|protocol number] [port]",
+		Short: "Show how the policy would handle a connection, without affecting any state",
+		Long:  "Show how the policy would handle a connection, without affecting any state. For incoming connections, the port is the local port, for outgoing connections the remote port. The port may be omitted for protocols without ports.",
+		Args:  cobra.RangeArgs(3, 4),
+		RunE:  policyCheck,
+	}
+)
+
+func policyCheck(cmd *cobra.Command, args []string) error {
+	// Parse arguments.
+	req := control.PolicyCheck{
+		Router:   args[1],
+		Protocol: args[2],
+	}
+	switch args[0] {
+	case "in":
+		req.Inbound = true
+	case "out":
+	default:
+		return errors.New(`direction must be "in" or "out"`)
+	}
+	if len(args) == 4 {
+		port, err := strconv.ParseUint(args[3], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port: %w", err)
+		}
+		req.Port = uint16(port)
+	}
+
+	// Evaluate policy.
+	var result control.PolicyResult
+	if err := controlRequest(http.MethodPost, "/policy/check", req, &result); err != nil {
+		return fmt.Errorf("failed to check policy: %w", err)
+	}
+
+	fmt.Printf("router:   %s\n", result.Router)
+	fmt.Printf("status:   %s\n", result.Status)
+	fmt.Printf("rule:     %s\n", result.Rule)
+	if result.Service != "" {
+		fmt.Printf("service:  %s\n", result.Service)
+	}
+	if result.GuestExpires != nil {
+		fmt.Printf("expires:  %s\n", result.GuestExpires.Format("02.01.06 15:04:05 MST"))
+	}
+	if result.AccessRequest {
+		fmt.Println("request:  an access request would be recorded")
+	}
+	return nil
+}
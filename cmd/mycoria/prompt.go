@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/router"
+)
+
+func init() {
+	rootCmd.AddCommand(promptCmd)
+	promptCmd.AddCommand(promptListCmd)
+	promptCmd.AddCommand(promptAllowCmd)
+	promptCmd.AddCommand(promptDenyCmd)
+}
+
+var (
+	promptCmd = &cobra.Command{
+		Use:   "prompt",
+		Short: "Decide on outgoing connections held by the running router",
+		Long:  "Decide on outgoing connections held by the running router. With router.promptOutbound enabled, new outgoing connections to routers that are not friends are held until they are allowed or denied. Decisions are kept until the next restart.",
+	}
+	promptListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List routers waiting for a decision",
+		Args:  cobra.NoArgs,
+		RunE:  promptList,
+	}
+	promptAllowCmd = &cobra.Command{
+		Use:   "allow [router]",
+		Short: "Allow outgoing connections to a router",
+		Args:  cobra.ExactArgs(1),
+		RunE:  promptAllow,
+	}
+	promptDenyCmd = &cobra.Command{
+		Use:   "deny [router]",
+		Short: "Deny outgoing connections to a router",
+		Args:  cobra.ExactArgs(1),
+		RunE:  promptDeny,
+	}
+)
+
+func promptList(cmd *cobra.Command, args []string) error {
+	var prompts []router.OutboundPrompt
+	if err := controlRequest(http.MethodGet, "/prompts", nil, &prompts); err != nil {
+		return fmt.Errorf("failed to get prompts: %w", err)
+	}
+
+	for _, prompt := range prompts {
+		fmt.Printf(
+			"%s %s/%d connections=%d",
+			prompt.Router, prompt.ProtocolName(), prompt.Port, prompt.Connections,
+		)
+		if prompt.TimedOut {
+			fmt.Print(" [timed out]")
+		} else {
+			fmt.Printf(" [expires %s]", prompt.Expires.Format("15:04:05"))
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func promptAllow(cmd *cobra.Command, args []string) error {
+	if err := promptDecide(args[0], "allow"); err != nil {
+		return err
+	}
+	fmt.Printf("allowed outgoing connections to %s\n", args[0])
+	return nil
+}
+
+func promptDeny(cmd *cobra.Command, args []string) error {
+	if err := promptDecide(args[0], "deny"); err != nil {
+		return err
+	}
+	fmt.Printf("denied outgoing connections to %s\n", args[0])
+	return nil
+}
+
+func promptDecide(routerArg, action string) error {
+	routerIP, err := netip.ParseAddr(routerArg)
+	if err != nil {
+		return fmt.Errorf("invalid router: %w", err)
+	}
+	if err := controlRequest(http.MethodPost, "/prompts/"+routerIP.String()+"/"+action, nil, nil); err != nil {
+		return fmt.Errorf("failed to %s router: %w", action, err)
+	}
+	return nil
+}
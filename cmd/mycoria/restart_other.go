@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// restartProcess replaces the current process with the given executable,
+// keeping the arguments and environment.
+func restartProcess(executable string) error {
+	if err := syscall.Exec(executable, os.Args, os.Environ()); err != nil { //nolint:gosec // Own executable.
+		return fmt.Errorf("failed to restart: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// restartProcess exits with an error, so that the service manager restarts
+// the router, as replacing the process is not supported on Windows.
+func restartProcess(executable string) error {
+	return errors.New("stopped to complete update, please restart")
+}
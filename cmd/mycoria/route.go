@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/router"
+)
+
+func init() {
+	rootCmd.AddCommand(routeCmd)
+	routeCmd.AddCommand(routePinCmd)
+	routeCmd.AddCommand(routeUnpinCmd)
+	routeCmd.AddCommand(routePinsCmd)
+	routeCmd.AddCommand(routeLoopsCmd)
+	routeCmd.AddCommand(routeDecisionsCmd)
+	routeCmd.AddCommand(routeMTUCmd)
+	routeCmd.AddCommand(routeProbeMTUCmd)
+	routeCmd.AddCommand(routeProbeCmd)
+	routeProbeCmd.Flags().IntVar(&routeProbePaths, "paths", router.DefaultPathProbePaths, "amount of paths to probe")
+	routeProbeCmd.Flags().IntVar(&routeProbeCount, "count", router.DefaultPathProbeCount, "amount of probes per path")
+}
+
+var (
+	routeCmd = &cobra.Command{
+		Use:   "route",
+		Short: "Manage routes of the running router",
+	}
+	routePinCmd = &cobra.Command{
+		Use:   "pin [dst] via [hop1,hop2,...]",
+		Short: "Pin the route to a destination through the given relays",
+		Long:  "Pin the route to a destination through the given relays, overriding automatic route selection. The first relay must be a peer. The route is checked with a probe before it is pinned. Pinned routes are lost on restart.",
+		Args:  cobra.ExactArgs(3),
+		RunE:  routePin,
+	}
+	routeUnpinCmd = &cobra.Command{
+		Use:   "unpin [dst]",
+		Short: "Remove the pinned route to a destination",
+		Args:  cobra.ExactArgs(1),
+		RunE:  routeUnpin,
+	}
+	routePinsCmd = &cobra.Command{
+		Use:   "pins",
+		Short: "List all pinned routes",
+		Args:  cobra.NoArgs,
+		RunE:  routePins,
+	}
+	routeLoopsCmd = &cobra.Command{
+		Use:   "loops",
+		Short: "List destinations with frames that expired in a suspected routing loop",
+		Args:  cobra.NoArgs,
+		RunE:  routeLoops,
+	}
+	routeDecisionsCmd = &cobra.Command{
+		Use:   "decisions",
+		Short: "List sampled routing decisions",
+		Long:  "List sampled routing decisions, newest first. One in N routed frames is recorded with the chosen route and why it was chosen, see router.routingDecisionSampling in the config.",
+		Args:  cobra.NoArgs,
+		RunE:  routeDecisions,
+	}
+	routeMTUCmd = &cobra.Command{
+		Use:   "mtu",
+		Short: "List the effective path MTU to destinations",
+		Long:  "List the effective path MTU to all destinations with a session. The MTU announced by a destination is lowered when ICMPv6 packet too big messages are received from it or when measured with probes.",
+		Args:  cobra.NoArgs,
+		RunE:  routeMTU,
+	}
+	routeProbeMTUCmd = &cobra.Command{
+		Use:   "probe-mtu [dst]",
+		Short: "Measure the path MTU to a destination with probes",
+		Args:  cobra.ExactArgs(1),
+		RunE:  routeProbeMTU,
+	}
+	routeProbeCmd = &cobra.Command{
+		Use:   "probe [dst]",
+		Short: "Probe the paths to a destination",
+		Long:  "Probe the best known paths to a destination with pings and show the measured round trip times and loss per path. No user traffic is sent, so this can be used by monitoring systems to check connectivity to critical services before it is needed.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  routeProbe,
+	}
+
+	routeProbePaths int
+	routeProbeCount int
+)
+
+func routePin(cmd *cobra.Command, args []string) error {
+	// Parse arguments.
+	dst, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	if args[1] != "via" {
+		return errors.New("expected \"via\" after the destination")
+	}
+	var via []netip.Addr
+	for _, hop := range strings.Split(args[2], ",") {
+		ip, err := netip.ParseAddr(strings.TrimSpace(hop))
+		if err != nil {
+			return fmt.Errorf("invalid relay %q: %w", hop, err)
+		}
+		via = append(via, ip)
+	}
+
+	// Pin route.
+	var pin control.PinnedRoute
+	err = controlRequest(http.MethodPost, "/pins", control.PinnedRoute{
+		Dst: dst,
+		Via: via,
+	}, &pin)
+	if err != nil {
+		return fmt.Errorf("failed to pin route: %w", err)
+	}
+
+	fmt.Printf("pinned route to %s via %d relays (probe took %dms)\n", pin.Dst, len(pin.Via), pin.Latency)
+	return nil
+}
+
+func routeUnpin(cmd *cobra.Command, args []string) error {
+	dst, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+
+	if err := controlRequest(http.MethodDelete, "/pins/"+dst.String(), nil, nil); err != nil {
+		return fmt.Errorf("failed to unpin route: %w", err)
+	}
+
+	fmt.Printf("unpinned route to %s\n", dst)
+	return nil
+}
+
+func routePins(cmd *cobra.Command, args []string) error {
+	var pins []control.PinnedRoute
+	if err := controlRequest(http.MethodGet, "/pins", nil, &pins); err != nil {
+		return fmt.Errorf("failed to get pinned routes: %w", err)
+	}
+
+	for _, pin := range pins {
+		via := make([]string, 0, len(pin.Via))
+		for _, hop := range pin.Via {
+			via = append(via, hop.String())
+		}
+		fmt.Printf("%s via %s\n", pin.Dst, strings.Join(via, ","))
+	}
+	return nil
+}
+
+func routeLoops(cmd *cobra.Command, args []string) error {
+	var loops control.Loops
+	if err := controlRequest(http.MethodGet, "/loops", nil, &loops); err != nil {
+		return fmt.Errorf("failed to get loop statistics: %w", err)
+	}
+
+	if len(loops.Destinations) == 0 {
+		fmt.Println("no expired frames seen")
+		return nil
+	}
+	for _, loop := range loops.Destinations {
+		fmt.Printf(
+			"%s expired=%d reported=%d last=%s ago",
+			loop.Dst,
+			loop.Expired,
+			loop.Reported,
+			time.Since(loop.LastSeen).Round(time.Second),
+		)
+		if loop.LastReporter.IsValid() {
+			fmt.Printf(" by %s", loop.LastReporter)
+		}
+		if loop.Looping {
+			fmt.Print(" [looping]")
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func routeDecisions(cmd *cobra.Command, args []string) error {
+	var decisions control.RoutingDecisions
+	if err := controlRequest(http.MethodGet, "/decisions", nil, &decisions); err != nil {
+		return fmt.Errorf("failed to get routing decisions: %w", err)
+	}
+
+	switch {
+	case decisions.Sampling == 0:
+		fmt.Println("routing decision sampling is disabled")
+		return nil
+	case len(decisions.Decisions) == 0:
+		fmt.Printf("no routing decisions sampled yet (1 in %d frames)\n", decisions.Sampling)
+		return nil
+	}
+	for _, d := range decisions.Decisions {
+		fmt.Printf(
+			"%s %s -> %s %s",
+			d.Time.Local().Format(time.TimeOnly),
+			d.Src,
+			d.Dst,
+			d.Reason,
+		)
+		if d.Route.IsValid() {
+			fmt.Printf(
+				" via %s to %s (%s, hops=%d delay=%dms candidates=%d)",
+				d.NextHop,
+				d.Route,
+				d.Source,
+				d.Hops,
+				d.Delay,
+				d.Candidates,
+			)
+		} else if d.NextHop.IsValid() {
+			fmt.Printf(" via %s", d.NextHop)
+		}
+		if d.From.IsValid() {
+			fmt.Printf(" from %s", d.From)
+		}
+		if d.Err != "" {
+			fmt.Printf(" [%s]", d.Err)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func routeMTU(cmd *cobra.Command, args []string) error {
+	var mtus control.PathMTUs
+	if err := controlRequest(http.MethodGet, "/mtu", nil, &mtus); err != nil {
+		return fmt.Errorf("failed to get path mtus: %w", err)
+	}
+
+	if !mtus.MSSClamping {
+		fmt.Println("tcp mss clamping is disabled")
+	}
+	if len(mtus.Destinations) == 0 {
+		fmt.Println("no destinations with known mtu")
+		return nil
+	}
+	for _, pmtu := range mtus.Destinations {
+		fmt.Printf("%s mtu=%d (%s", pmtu.Dst, pmtu.MTU, pmtu.Source)
+		if pmtu.Source != router.PathMTUSourceAnnounced {
+			fmt.Printf(", announced=%d, %s ago", pmtu.Announced, time.Since(pmtu.Updated).Round(time.Second))
+		}
+		fmt.Println(")")
+	}
+	return nil
+}
+
+func routeProbeMTU(cmd *cobra.Command, args []string) error {
+	dst, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+
+	var pmtu router.PathMTU
+	if err := controlRequest(http.MethodPost, "/mtu/"+dst.String()+"/probe", nil, &pmtu); err != nil {
+		return fmt.Errorf("failed to probe path mtu: %w", err)
+	}
+
+	fmt.Printf("path mtu to %s is %d (announced %d)\n", pmtu.Dst, pmtu.MTU, pmtu.Announced)
+	return nil
+}
+
+func routeProbe(cmd *cobra.Command, args []string) error {
+	dst, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+
+	var probes control.PathProbes
+	path := fmt.Sprintf("/probe/%s?paths=%d&count=%d", dst, routeProbePaths, routeProbeCount)
+	if err := controlRequestWithTimeout(http.MethodPost, path, nil, &probes, 30*time.Second); err != nil {
+		return fmt.Errorf("failed to probe paths: %w", err)
+	}
+
+	for _, probe := range probes.Paths {
+		via := make([]string, 0, len(probe.Via))
+		for _, hop := range probe.Via {
+			via = append(via, hop.String())
+		}
+		fmt.Printf("via %s (%s, %dms announced)\n", strings.Join(via, " > "), probe.Source, probe.Delay)
+		fmt.Printf("  %d/%d received, %.0f%% loss", probe.Received, probe.Sent, probe.Loss*100)
+		if probe.Received > 0 {
+			fmt.Printf(", rtt min/avg/max %s/%s/%s",
+				probe.MinRTT.Round(time.Microsecond*100),
+				probe.AvgRTT.Round(time.Microsecond*100),
+				probe.MaxRTT.Round(time.Microsecond*100),
+			)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// controlRequest sends a request to the control API of the running router.
+// If body is set, it is sent as JSON. If result is set, the JSON response is
+// parsed into it.
+func controlRequest(method, path string, body, result any) error {
+	return controlRequestWithTimeout(method, path, body, result, 15*time.Second)
+}
+
+// controlRequestWithTimeout is like controlRequest, but with a custom timeout
+// for requests that take longer.
+func controlRequestWithTimeout(method, path string, body, result any, timeout time.Duration) error {
+	apiAddr, err := controlAddress()
+	if err != nil {
+		return err
+	}
+
+	// Build request.
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://"+apiAddr.String()+control.Path+path, reqBody) //nolint:noctx
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// Send request.
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	// Check response.
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1000))
+		return m.WithCode(
+			m.ErrorCode(resp.Header.Get(control.ErrorCodeHeader)),
+			fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg))),
+		)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// controlAddress returns the address of the control API of the running router.
+func controlAddress() (netip.AddrPort, error) {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if c.APIListen.IsValid() {
+		return c.APIListen, nil
+	}
+	return netip.AddrPortFrom(config.DefaultAPIAddress, 80), nil
+}
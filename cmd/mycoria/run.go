@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"os"
 	"os/signal"
 	"runtime"
@@ -18,6 +19,7 @@ import (
 
 	"github.com/mycoria/mycoria"
 	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/mgr"
 )
 
 func init() {
@@ -52,6 +54,11 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	// Setup logging.
+	// Levels are filtered by the level handler, so that modules can have
+	// their own log level.
+	mgr.SetDefaultLogLevel(level)
+	mgr.SetModuleLogLevels(c.LogLevels)
+	allLevels := slog.Level(math.MinInt)
 	// Define output.
 	logOutput := os.Stdout
 	// Create handler depending on OS.
@@ -62,29 +69,35 @@ func run(cmd *cobra.Command, args []string) error {
 			colorable.NewColorable(logOutput),
 			&tint.Options{
 				AddSource:  true,
-				Level:      level,
+				Level:      allLevels,
 				TimeFormat: time.DateTime,
 			},
 		)
 	case "linux":
 		logHandler = tint.NewHandler(logOutput, &tint.Options{
 			AddSource:  true,
-			Level:      level,
+			Level:      allLevels,
 			TimeFormat: time.DateTime,
 			NoColor:    !isatty.IsTerminal(logOutput.Fd()),
 		})
 	default:
 		logHandler = tint.NewHandler(os.Stdout, &tint.Options{
 			AddSource:  true,
-			Level:      level,
+			Level:      allLevels,
 			TimeFormat: time.DateTime,
 			NoColor:    true,
 		})
 	}
 	// Set as default logger.
-	slog.SetDefault(slog.New(logHandler))
+	slog.SetDefault(slog.New(mgr.NewLevelHandler(logHandler)))
 	slog.SetLogLoggerLevel(level)
 
+	// Remember executable for restarts, before an update replaces it.
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
 	// Setup up everything.
 	myco, err := mycoria.New(Version, c)
 	if err != nil {
@@ -95,7 +108,8 @@ func run(cmd *cobra.Command, args []string) error {
 	slog.Info(
 		"starting mycoria",
 		"version", Version,
-		"id", c.Router.Address.IP,
+		"id", myco.Identity().IP,
+		"invisible", c.Router.Invisible,
 	)
 
 	// Finalize and start all workers.
@@ -156,6 +170,14 @@ signalLoop:
 			}
 			break signalLoop
 
+		case <-myco.Updater().RestartRequested():
+			slog.Warn("restarting to complete update")
+			if !myco.Stop() {
+				slog.Error("failed to stop mycoria")
+				os.Exit(1)
+			}
+			return restartProcess(executable)
+
 		case <-myco.Done():
 			break signalLoop
 		}
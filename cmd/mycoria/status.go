@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+	"github.com/mycoria/mycoria/m"
+)
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringVar(&statusPeer, "peer", "", "show the announced status of the given router")
+	statusCmd.Flags().BoolVar(&statusResources, "resources", false, "show resource limits and usage")
+	statusCmd.Flags().BoolVar(&statusFrames, "frames", false, "show traffic per frame type and top talkers")
+}
+
+var (
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show the status of the running router or another router",
+		Args:  cobra.NoArgs,
+		RunE:  status,
+	}
+
+	statusPeer      string
+	statusResources bool
+	statusFrames    bool
+)
+
+func status(cmd *cobra.Command, args []string) error {
+	if statusPeer != "" {
+		return statusOfRouter(statusPeer)
+	}
+	if statusResources {
+		return statusOfResources()
+	}
+	if statusFrames {
+		return statusOfFrames()
+	}
+
+	var s control.Status
+	if err := controlRequest(http.MethodGet, "/status", nil, &s); err != nil {
+		return fmt.Errorf("failed to get status: %w", err)
+	}
+
+	fmt.Printf("router:   %s\n", s.Router)
+	fmt.Printf("version:  %s\n", s.Version)
+	fmt.Printf("uptime:   %s\n", s.Uptime.Round(time.Second))
+	fmt.Printf("peers:    %d\n", len(s.Peers))
+	for _, failure := range s.PeerFailures {
+		fmt.Printf("failing:  %s (%s) for %s: %s\n",
+			failure.PeeringURL, failure.Reason, time.Since(failure.Since).Round(time.Second), failure.Error)
+		if failure.Hint != "" {
+			fmt.Printf("          %s\n", failure.Hint)
+		}
+	}
+	fmt.Printf("routes:   %d\n", s.Routes)
+	if s.HA != nil {
+		peerRole := "not responding"
+		if s.HA.PeerRole != "" {
+			peerRole = string(s.HA.PeerRole)
+		}
+		fmt.Printf("ha:       %s since %s (term %d), other router %s\n",
+			s.HA.Role, s.HA.Since.Round(time.Second).Format(time.DateTime), s.HA.Term, peerRole)
+		if !s.HA.WitnessOK && s.HA.PeerRole == "" {
+			fmt.Printf("ha:       witnesses do not grant the lease, cannot become active\n")
+		}
+	}
+	if s.ClockSkew.Abs() > m.ClockSkewTolerance {
+		fmt.Printf("clock:    %s off compared to peers, check the system time\n", s.ClockSkew.Abs())
+	}
+	if s.NATIPv4 != "" && s.NATIPv4 != "unknown" {
+		fmt.Printf("nat ipv4: %s\n", s.NATIPv4)
+	}
+	if s.NATIPv6 != "" && s.NATIPv6 != "unknown" {
+		fmt.Printf("nat ipv6: %s\n", s.NATIPv6)
+	}
+	var geoFlagged int
+	for _, peer := range s.Peers {
+		if peer.GeoFlagged {
+			geoFlagged++
+		}
+	}
+	if geoFlagged > 0 {
+		fmt.Printf("geo:      %d peers with geo markers not matching their location\n", geoFlagged)
+	}
+	if s.APIPackets != nil && s.APIPackets.Dropped+s.APIPackets.DroppedPriority > 0 {
+		fmt.Printf("api:      dropped %d of %d packets (%d prioritized), the local API is overloaded\n",
+			s.APIPackets.Dropped+s.APIPackets.DroppedPriority, s.APIPackets.Submitted, s.APIPackets.DroppedPriority)
+	}
+	if s.Crashes > 0 {
+		fmt.Printf("crashes:  %d recovered, check the crash reports\n", s.Crashes)
+	}
+	if s.StatusText != "" {
+		fmt.Printf("status:   %s\n", s.StatusText)
+	}
+	if s.Contact != "" {
+		fmt.Printf("contact:  %s\n", s.Contact)
+	}
+	return nil
+}
+
+func statusOfRouter(value string) error {
+	ip, err := netip.ParseAddr(value)
+	if err != nil {
+		return fmt.Errorf("invalid router: %w", err)
+	}
+
+	var details control.RouterDetails
+	if err := controlRequest(http.MethodGet, "/routers/"+ip.String(), nil, &details); err != nil {
+		return fmt.Errorf("failed to get router: %w", err)
+	}
+
+	fmt.Printf("router:   %s\n", details.Router)
+	if details.Version != "" {
+		fmt.Printf("version:  %s\n", details.Version)
+	}
+	fmt.Printf("peer:     %v\n", details.Peer)
+	if details.Offline {
+		fmt.Println("offline:  true")
+	}
+	fmt.Printf("updated:  %s ago\n", time.Since(details.UpdatedAt).Round(time.Second))
+	if details.StatusText != "" {
+		fmt.Printf("status:   %s\n", details.StatusText)
+	}
+	if details.Contact != "" {
+		fmt.Printf("contact:  %s\n", details.Contact)
+	}
+	return nil
+}
+
+func statusOfResources() error {
+	var res control.Resources
+	if err := controlRequest(http.MethodGet, "/resources", nil, &res); err != nil {
+		return fmt.Errorf("failed to get resources: %w", err)
+	}
+
+	fmt.Printf("memory:     %s of %s\n", formatMiB(res.MemoryUsed), formatLimit(res.MemoryLimit > 0, formatMiB(res.MemoryLimit)))
+	fmt.Printf("cpus:       %s\n", formatLimit(res.CPULimit > 0, fmt.Sprintf("%.2f", res.CPULimit)))
+	fmt.Printf("fds:        %d of %s\n", res.FDsOpen, formatLimit(res.FDLimit > 0, fmt.Sprint(res.FDLimit)))
+	fmt.Printf("goroutines: %d\n", res.Goroutines)
+	fmt.Printf("queue size: %d\n", res.QueueSize)
+	fmt.Printf("routes:     %d of %s\n", res.Routes, formatLimit(res.MaxRoutes > 0, fmt.Sprint(res.MaxRoutes)))
+	fmt.Printf("peers:      %d of %s\n", res.Peers, formatLimit(res.MaxPeers > 0, fmt.Sprint(res.MaxPeers)))
+	fmt.Printf("conns:      %d of %s\n", res.Connections, formatLimit(res.MaxConnections > 0, fmt.Sprint(res.MaxConnections)))
+	if res.ConnectionsEvicted > 0 {
+		fmt.Printf("evicted:    %d connections, as the table was full\n", res.ConnectionsEvicted)
+	}
+	fmt.Printf("announces:  max %d hops", res.MaxAnnounceHops)
+	if res.AnnouncesDropped > 0 || res.AnnouncesStopped > 0 {
+		fmt.Printf(", %d dropped and %d stopped at limit", res.AnnouncesDropped, res.AnnouncesStopped)
+	}
+	fmt.Println()
+	return nil
+}
+
+func statusOfFrames() error {
+	var stats control.FrameStats
+	if err := controlRequest(http.MethodGet, "/stats/frames", nil, &stats); err != nil {
+		return fmt.Errorf("failed to get frame stats: %w", err)
+	}
+
+	fmt.Printf("since %s (%s)\n\n", stats.Since.Format(time.RFC3339), time.Since(stats.Since).Round(time.Second))
+	fmt.Printf("%-24s %12s %12s %12s %12s\n", "type", "relayed", "bytes", "terminated", "bytes")
+	for _, t := range stats.Types {
+		fmt.Printf("%-24s %12d %12s %12d %12s\n",
+			t.Name, t.RelayedFrames, formatBytes(t.RelayedBytes), t.TerminatedFrames, formatBytes(t.TerminatedBytes))
+	}
+
+	fmt.Println()
+	fmt.Printf("%-39s %12s %12s %12s %12s\n", "router", "relayed", "bytes", "terminated", "bytes")
+	for _, t := range stats.TopTalkers {
+		fmt.Printf("%-39s %12d %12s %12d %12s\n",
+			t.Router, t.RelayedFrames, formatBytes(t.RelayedBytes), t.TerminatedFrames, formatBytes(t.TerminatedBytes))
+	}
+	if stats.Untracked > 0 {
+		fmt.Printf("\n%d frames of further routers were not tracked\n", stats.Untracked)
+	}
+	return nil
+}
+
+func formatBytes(bytes uint64) string {
+	const units = "KMGTPE"
+	if bytes < 1024 {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	value, unit := float64(bytes)/1024, 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f%ciB", value, units[unit])
+}
+
+func formatMiB(bytes uint64) string {
+	return fmt.Sprintf("%dMiB", bytes>>20)
+}
+
+func formatLimit(limited bool, limit string) string {
+	if !limited {
+		return "unlimited"
+	}
+	return limit
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+)
+
+func init() {
+	rootCmd.AddCommand(streamCmd)
+	streamCmd.AddCommand(streamConnectCmd)
+	streamCmd.AddCommand(streamListenCmd)
+
+	streamListenCmd.Flags().BoolVar(&streamPublic, "public", false, "accept streams from all routers, instead of only friends")
+}
+
+var (
+	streamCmd = &cobra.Command{
+		Use:   "stream",
+		Short: "Connect stdin and stdout to a stream to another router",
+		Long:  "Connect stdin and stdout to a stream to another router. Streams are reliable connections between routers that are identified by a service name and do not use the tun interface.",
+	}
+	streamConnectCmd = &cobra.Command{
+		Use:   "connect [router] [service]",
+		Short: "Open a stream to a service on another router",
+		Args:  cobra.ExactArgs(2),
+		RunE:  streamConnect,
+	}
+	streamListenCmd = &cobra.Command{
+		Use:   "listen [service]",
+		Short: "Accept a stream to a service from another router",
+		Long:  "Accept a stream to a service from another router. Only friends may open streams, unless --public is set.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  streamListen,
+	}
+
+	streamPublic bool
+)
+
+func streamConnect(cmd *cobra.Command, args []string) error {
+	return streamRequest("/streams/connect/" + args[0] + "/" + args[1])
+}
+
+func streamListen(cmd *cobra.Command, args []string) error {
+	path := "/streams/accept/" + args[0]
+	if streamPublic {
+		path += "?public=true"
+	}
+	return streamRequest(path)
+}
+
+// streamRequest upgrades a control API request to a stream and connects it
+// to stdin and stdout.
+func streamRequest(path string) error {
+	apiAddr, err := controlAddress()
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("tcp", apiAddr.String())
+	if err != nil {
+		return err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// Send upgrade request.
+	req, err := http.NewRequest(http.MethodGet, "http://"+apiAddr.String()+control.Path+path, nil) //nolint:noctx
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", control.StreamUpgrade)
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// Check response.
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1000))
+		_ = resp.Body.Close()
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	fmt.Fprintf(os.Stderr, "connected to %s\n", resp.Header.Get(control.StreamRouterHeader))
+
+	// Pipe stdin to stream and stream to stdout.
+	go func() {
+		_, _ = io.Copy(conn, os.Stdin)
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			_ = tcpConn.CloseWrite()
+		}
+	}()
+	_, err = io.Copy(os.Stdout, reader)
+	return err
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+	"github.com/mycoria/mycoria/router"
+)
+
+func init() {
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.AddCommand(msgCmd)
+	rootCmd.AddCommand(transferCmd)
+	transferCmd.AddCommand(transferListCmd)
+	transferCmd.AddCommand(transferAcceptCmd)
+	transferCmd.AddCommand(transferDeclineCmd)
+
+	transferAcceptCmd.Flags().StringVarP(&transferOutput, "output", "o", "", "write a received file to the given path instead of the offered name")
+}
+
+var (
+	sendCmd = &cobra.Command{
+		Use:   "send [friend] [file]",
+		Short: "Send a file to a friend",
+		Long:  "Send a file to a friend. The friend must accept the file with \"mycoria transfer accept\" before it is sent. Both routers must have each other as friends.",
+		Args:  cobra.ExactArgs(2),
+		RunE:  send,
+	}
+	msgCmd = &cobra.Command{
+		Use:   "msg [friend] [text]",
+		Short: "Send a message to a friend",
+		Long:  "Send a message to a friend. The friend must accept the message with \"mycoria transfer accept\" to read it. Both routers must have each other as friends.",
+		Args:  cobra.ExactArgs(2),
+		RunE:  msg,
+	}
+	transferCmd = &cobra.Command{
+		Use:   "transfer",
+		Short: "Manage messages and files from and to friends",
+	}
+	transferListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List incoming and outgoing transfers",
+		Args:  cobra.NoArgs,
+		RunE:  transferList,
+	}
+	transferAcceptCmd = &cobra.Command{
+		Use:   "accept [id]",
+		Short: "Accept and receive a message or file",
+		Long:  "Accept and receive a message or file. Messages are printed, files are written to the current directory.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  transferAccept,
+	}
+	transferDeclineCmd = &cobra.Command{
+		Use:   "decline [id]",
+		Short: "Decline a message or file",
+		Args:  cobra.ExactArgs(1),
+		RunE:  transferDecline,
+	}
+
+	transferOutput string
+)
+
+// transferPollInterval defines how often the status of a transfer is checked
+// while waiting for it.
+const transferPollInterval = 500 * time.Millisecond
+
+func send(cmd *cobra.Command, args []string) error {
+	info, err := os.Stat(args[1])
+	if err != nil {
+		return err
+	}
+	if info.Size() > router.MaxTransferSize {
+		return fmt.Errorf("file is too big, maximum is %d bytes", router.MaxTransferSize)
+	}
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+
+	return offerTransfer(control.TransferRequest{
+		Router: args[0],
+		Kind:   router.TransferKindFile,
+		Name:   filepath.Base(args[1]),
+		Data:   data,
+	})
+}
+
+func msg(cmd *cobra.Command, args []string) error {
+	return offerTransfer(control.TransferRequest{
+		Router: args[0],
+		Kind:   router.TransferKindMessage,
+		Data:   []byte(args[1]),
+	})
+}
+
+func offerTransfer(req control.TransferRequest) error {
+	var transfer router.Transfer
+	if err := controlRequest(http.MethodPost, "/transfers", req, &transfer); err != nil {
+		return fmt.Errorf("failed to offer %s: %w", req.Kind, err)
+	}
+	fmt.Printf("offered %s to %s, waiting for it to be accepted...\n", transfer.Kind, transferPeer(transfer))
+	fmt.Println("you may exit, the offer stays open for an hour")
+
+	transfer, err := waitForTransfer(transfer.ID)
+	if err != nil {
+		return err
+	}
+	switch transfer.Status { //nolint:exhaustive
+	case router.TransferComplete:
+		fmt.Printf("%s received by %s\n", transfer.Kind, transferPeer(transfer))
+		return nil
+	case router.TransferDeclined:
+		return fmt.Errorf("%s was declined by %s", transfer.Kind, transferPeer(transfer))
+	default:
+		return fmt.Errorf("transfer failed: %s", sanitizeRemoteText(transfer.Err))
+	}
+}
+
+func transferList(cmd *cobra.Command, args []string) error {
+	var transfers []router.Transfer
+	if err := controlRequest(http.MethodGet, "/transfers", nil, &transfers); err != nil {
+		return fmt.Errorf("failed to get transfers: %w", err)
+	}
+
+	for _, transfer := range transfers {
+		direction := "to"
+		if transfer.Incoming {
+			direction = "from"
+		}
+		fmt.Printf(
+			"%s %s %s %s %s %d/%d bytes %s",
+			transfer.ID, transfer.Kind, direction, transferPeer(transfer),
+			sanitizeRemoteText(transfer.Name), transfer.Done, transfer.Size, transfer.Status,
+		)
+		if transfer.Err != "" {
+			fmt.Printf(" (%s)", sanitizeRemoteText(transfer.Err))
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func transferAccept(cmd *cobra.Command, args []string) (err error) {
+	transfer, err := getTransfer(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Create the file before accepting, so that the received data is not
+	// taken from the router if the file cannot be written.
+	// Never overwrite existing files with the offered name.
+	var (
+		file *os.File
+		path string
+	)
+	if transfer.Kind == router.TransferKindFile {
+		path = transferOutput
+		flags := os.O_WRONLY | os.O_CREATE
+		if path == "" {
+			path = filepath.Base(transfer.Name)
+			flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		}
+		file, err = os.OpenFile(path, flags, 0o644) //nolint:gosec // Path is chosen by the user or cleaned.
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		defer func() {
+			closeErr := file.Close()
+			switch {
+			case err != nil && flags&os.O_EXCL != 0:
+				// Remove the file created for the failed transfer.
+				_ = os.Remove(path)
+			case err == nil && closeErr != nil:
+				err = fmt.Errorf("failed to write file: %w", closeErr)
+			}
+		}()
+	}
+
+	if err := controlRequest(http.MethodPost, "/transfers/"+args[0]+"/accept", nil, nil); err != nil {
+		return fmt.Errorf("failed to accept transfer: %w", err)
+	}
+
+	// Wait for transfer to complete.
+	transfer, err = waitForTransfer(args[0])
+	if err != nil {
+		return err
+	}
+	if transfer.Status != router.TransferComplete {
+		return fmt.Errorf("transfer failed: %s", sanitizeRemoteText(transfer.Err))
+	}
+
+	// Get data.
+	var received control.TransferData
+	if err := controlRequest(http.MethodGet, "/transfers/"+args[0]+"/data", nil, &received); err != nil {
+		return fmt.Errorf("failed to get received data: %w", err)
+	}
+	if received.Transfer.Kind == router.TransferKindMessage {
+		fmt.Printf("message from %s:\n%s\n", transferPeer(received.Transfer), sanitizeRemoteText(string(received.Data)))
+		return nil
+	}
+
+	// Write file.
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if _, err := file.Write(received.Data); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	fmt.Printf("received %s from %s (%d bytes)\n", sanitizeRemoteText(path), transferPeer(received.Transfer), len(received.Data))
+	return nil
+}
+
+func transferDecline(cmd *cobra.Command, args []string) error {
+	if err := controlRequest(http.MethodPost, "/transfers/"+args[0]+"/decline", nil, nil); err != nil {
+		return fmt.Errorf("failed to decline transfer: %w", err)
+	}
+	fmt.Println("declined")
+	return nil
+}
+
+// getTransfer returns the transfer with the given ID.
+func getTransfer(id string) (router.Transfer, error) {
+	var transfers []router.Transfer
+	if err := controlRequest(http.MethodGet, "/transfers", nil, &transfers); err != nil {
+		return router.Transfer{}, fmt.Errorf("failed to get transfers: %w", err)
+	}
+	for _, transfer := range transfers {
+		if transfer.ID == id {
+			return transfer, nil
+		}
+	}
+	return router.Transfer{}, errors.New("transfer not found or expired")
+}
+
+// waitForTransfer polls the transfer with the given ID until its status is final.
+func waitForTransfer(id string) (router.Transfer, error) {
+	ticker := time.NewTicker(transferPollInterval)
+	defer ticker.Stop()
+
+	for {
+		transfer, err := getTransfer(id)
+		if err != nil {
+			return router.Transfer{}, err
+		}
+		if transfer.Status.Final() {
+			return transfer, nil
+		}
+		<-ticker.C
+	}
+}
+
+// sanitizeRemoteText removes control characters, except for line breaks and
+// tabs, from text supplied by remote routers, so that it cannot manipulate
+// the terminal.
+func sanitizeRemoteText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return unicode.ReplacementChar
+		}
+		return r
+	}, text)
+}
+
+func transferPeer(transfer router.Transfer) string {
+	if transfer.Friend != "" {
+		return transfer.Friend
+	}
+	return transfer.Router.String()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/tun"
+)
+
+func init() {
+	rootCmd.AddCommand(tunHelperCmd)
+
+	tunHelperCmd.Flags().StringVar(&tunHelperSocket, "socket", "/run/mycoria/tun.sock", "listen on this unix socket")
+	tunHelperCmd.Flags().StringVar(&tunHelperUser, "user", "mycoria", "allow this user to use the helper")
+}
+
+var (
+	tunHelperCmd = &cobra.Command{
+		Use:   "tun-helper",
+		Short: "Run the privileged tun helper for a router running without privileges",
+		Long:  "Run the privileged tun helper, which creates and configures the tun device and passes it to the router. Set system.tunHelper to the socket path and run the router as the given user without root or CAP_NET_ADMIN. Only supported on Linux.",
+		Args:  cobra.NoArgs,
+		RunE:  runTunHelper,
+	}
+
+	tunHelperSocket string
+	tunHelperUser   string
+)
+
+func runTunHelper(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Get user of the router.
+	u, err := user.Lookup(tunHelperUser)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("invalid user id %q: %w", u.Uid, err)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid group id %q: %w", u.Gid, err)
+	}
+
+	helper, err := tun.NewHelper(c, tunHelperSocket, uid, gid)
+	if err != nil {
+		return fmt.Errorf("failed to start tun helper: %w", err)
+	}
+	defer helper.Close() //nolint:errcheck
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	slog.Info("tun helper ready", "socket", tunHelperSocket, "user", tunHelperUser)
+	return helper.Serve(ctx)
+}
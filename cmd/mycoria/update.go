@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/updater"
+)
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.AddCommand(updateCheckCmd)
+	updateCmd.AddCommand(updateInstallCmd)
+	updateCmd.AddCommand(updateHashCmd)
+	updateCmd.AddCommand(updateSignCmd)
+
+	updateSignCmd.Flags().StringVar(&updateSignOut, "out", "", "write the signed manifest to this file (required)")
+	_ = updateSignCmd.MarkFlagRequired("out")
+}
+
+var (
+	updateCmd = &cobra.Command{
+		Use:   "update",
+		Short: "Show the software update status of the running router",
+		Long:  "Show the software update status of the running router. Updates are checked in the signed release manifest at system.updateManifestURL and are only trusted if signed by a router in system.updateSigners.",
+		Args:  cobra.NoArgs,
+		RunE:  update,
+	}
+	updateCheckCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Check for a software update now",
+		Args:  cobra.NoArgs,
+		RunE:  updateCheck,
+	}
+	updateInstallCmd = &cobra.Command{
+		Use:   "install",
+		Short: "Download, verify and install a software update and restart the router",
+		Args:  cobra.NoArgs,
+		RunE:  updateInstall,
+	}
+	updateHashCmd = &cobra.Command{
+		Use:   "hash [file]",
+		Short: "Print the size and hash of a release binary for the release manifest",
+		Args:  cobra.ExactArgs(1),
+		RunE:  updateHash,
+	}
+	updateSignCmd = &cobra.Command{
+		Use:   "sign [file]",
+		Short: "Sign a release manifest with the identity of this router",
+		Long:  "Sign a release manifest in JSON format with the identity of this router. Binary URLs may be relative to the manifest URL. Use \"mycoria update hash\" to get the size and hash of binaries.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  updateSign,
+	}
+
+	updateSignOut string
+)
+
+func update(cmd *cobra.Command, args []string) error {
+	var status updater.Status
+	if err := controlRequest(http.MethodGet, "/update", nil, &status); err != nil {
+		return fmt.Errorf("failed to get update status: %w", err)
+	}
+	printUpdateStatus(status)
+	return nil
+}
+
+func updateCheck(cmd *cobra.Command, args []string) error {
+	var status updater.Status
+	if err := controlRequest(http.MethodPost, "/update/check", nil, &status); err != nil {
+		return fmt.Errorf("failed to check for update: %w", err)
+	}
+	printUpdateStatus(status)
+	return nil
+}
+
+func updateInstall(cmd *cobra.Command, args []string) error {
+	var status updater.Status
+	if err := controlRequestWithTimeout(http.MethodPost, "/update/install", nil, &status, 11*time.Minute); err != nil {
+		return fmt.Errorf("failed to install update: %w", err)
+	}
+	fmt.Printf("installed %s, the router is restarting\n", status.Installed)
+	return nil
+}
+
+func printUpdateStatus(status updater.Status) {
+	if !status.Enabled {
+		fmt.Println("updates are not configured, see system.updateManifestURL")
+		return
+	}
+
+	fmt.Printf("current:   %s\n", status.Current)
+	if status.Latest != "" {
+		fmt.Printf("latest:    %s", status.Latest)
+		if !status.Released.IsZero() {
+			fmt.Printf(" (released %s)", status.Released.Format(time.DateOnly))
+		}
+		fmt.Println()
+	}
+	switch {
+	case status.Installed != "":
+		fmt.Printf("installed: %s, waiting for restart\n", status.Installed)
+	case status.Available:
+		fmt.Println("update available")
+	}
+	if !status.Checked.IsZero() {
+		fmt.Printf("checked:   %s ago\n", time.Since(status.Checked).Round(time.Second))
+	}
+	if status.Err != "" {
+		fmt.Printf("error:     %s\n", status.Err)
+	}
+	if status.Available && status.Notes != "" {
+		fmt.Printf("\n%s\n", status.Notes)
+	}
+}
+
+func updateHash(cmd *cobra.Command, args []string) error {
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
+	hash := updater.BinaryHash.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("size: %d\n", size)
+	fmt.Printf("hash: %s\n", hex.EncodeToString(hash.Sum(nil)))
+	return nil
+}
+
+func updateSign(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	identity, err := c.Identity()
+	if err != nil {
+		return fmt.Errorf("failed to load identity: %w", err)
+	}
+
+	// Read manifest.
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var mf updater.Manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if len(mf.Binaries) == 0 {
+		return errors.New("manifest has no binaries")
+	}
+	if mf.Released.IsZero() {
+		mf.Released = time.Now().UTC().Truncate(time.Second)
+	}
+
+	// Sign and write.
+	signed, err := updater.SignManifest(identity, &mf)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(updateSignOut, signed, 0o644); err != nil { //nolint:gosec // Manifest is public.
+		return fmt.Errorf("failed to write signed manifest: %w", err)
+	}
+
+	fmt.Printf("signed release manifest for %s with %d binaries as %s\n", mf.Version, len(mf.Binaries), identity.IP)
+	fmt.Printf("written to %s\n", updateSignOut)
+	fmt.Println("routers only trust the manifest, if this router is in system.updateSigners")
+	return nil
+}
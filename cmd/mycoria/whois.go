@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mycoria/mycoria/api/control"
+)
+
+// operatorVerificationPath is where operators list their router IPs on the
+// host of their operator URL, one per line.
+const operatorVerificationPath = "/.well-known/mycoria-routers"
+
+func init() {
+	rootCmd.AddCommand(whoisCmd)
+}
+
+var whoisCmd = &cobra.Command{
+	Use:   "whois [router IP]",
+	Short: "Show the operator contact details of a router",
+	Long:  "Show the operator contact details of a router, as announced by the router. The operator URL is verified by checking that its host lists the router at " + operatorVerificationPath + ".",
+	Args:  cobra.ExactArgs(1),
+	RunE:  whois,
+}
+
+func whois(cmd *cobra.Command, args []string) error {
+	ip, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid router: %w", err)
+	}
+
+	var details control.RouterDetails
+	if err := controlRequest(http.MethodGet, "/routers/"+ip.String(), nil, &details); err != nil {
+		return fmt.Errorf("failed to get router: %w", err)
+	}
+
+	fmt.Printf("router:   %s\n", details.Router)
+	fmt.Printf("updated:  %s ago\n", time.Since(details.UpdatedAt).Round(time.Second))
+	if details.StatusText != "" {
+		fmt.Printf("status:   %s\n", details.StatusText)
+	}
+	if details.Contact != "" {
+		fmt.Printf("contact:  %s\n", details.Contact)
+	}
+	if len(details.Capabilities) > 0 {
+		fmt.Printf("features: %s\n", strings.Join(details.Capabilities, ", "))
+	}
+
+	op := details.Operator
+	if op.IsEmpty() {
+		fmt.Println("operator: no contact details announced")
+		return nil
+	}
+	if op.Name != "" {
+		fmt.Printf("operator: %s\n", op.Name)
+	}
+	if op.Email != "" {
+		fmt.Printf("email:    %s\n", op.Email)
+	}
+	if op.Matrix != "" {
+		fmt.Printf("matrix:   %s\n", op.Matrix)
+	}
+	if op.Abuse != "" {
+		fmt.Printf("abuse:    %s\n", op.Abuse)
+	}
+	if op.URL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := verifyOperatorURL(ctx, op.URL, ip); err != nil {
+			fmt.Printf("url:      %s (not verified: %s)\n", op.URL, err)
+		} else {
+			fmt.Printf("url:      %s (verified)\n", op.URL)
+		}
+	}
+	return nil
+}
+
+// verifyOperatorURL checks if the host of the operator URL lists the router.
+func verifyOperatorURL(ctx context.Context, operatorURL string, router netip.Addr) error {
+	u, err := url.Parse(operatorURL)
+	if err != nil {
+		return err
+	}
+	verifyURL := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   operatorVerificationPath,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, verifyURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", verifyURL.String(), resp.Status)
+	}
+
+	// Check if the router is listed.
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1_000_000))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if ip, err := netip.ParseAddr(line); err == nil && ip == router {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("router is not listed")
+}
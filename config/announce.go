@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// AnnounceLevel defines what the router announces about itself to a peer.
+type AnnounceLevel string
+
+// Announce levels.
+const (
+	// AnnounceFull announces the router with all router info, eg. services
+	// and listeners, to the whole network.
+	AnnounceFull AnnounceLevel = "full"
+	// AnnounceMinimal announces the router to the whole network, but without
+	// router info, so that it is reachable without revealing its services,
+	// listeners or operator.
+	AnnounceMinimal AnnounceLevel = "minimal"
+	// AnnouncePeer announces the router with all router info to the peer
+	// only and asks it to not forward the announcement.
+	AnnouncePeer AnnounceLevel = "peer"
+	// AnnounceNone does not announce the router. The peer still routes to
+	// the router directly.
+	AnnounceNone AnnounceLevel = "none"
+)
+
+// Announce peer selectors.
+const (
+	AnnouncePeersAll     = "all"
+	AnnouncePeersFriends = "friends"
+	AnnouncePeersLite    = "lite"
+)
+
+// AnnounceRule defines what the router announces about itself to the
+// selected peers.
+type AnnounceRule struct {
+	// Peers is one of the announce peer selectors.
+	// Empty if IP is set.
+	Peers string
+	// IP selects a single peer.
+	IP netip.Addr
+
+	Level AnnounceLevel
+}
+
+func parseAnnounceRule(rule AnnounceRuleConfig) (AnnounceRule, error) {
+	parsed := AnnounceRule{
+		Level: AnnounceLevel(rule.Announce),
+	}
+
+	switch rule.Peers {
+	case AnnouncePeersAll, AnnouncePeersFriends, AnnouncePeersLite:
+		parsed.Peers = rule.Peers
+	default:
+		ip, err := netip.ParseAddr(rule.Peers)
+		if err != nil || !m.BaseNetPrefix.Contains(ip) {
+			return AnnounceRule{}, fmt.Errorf(`peers must be "all", "friends", "lite" or a router IP, not %q`, rule.Peers)
+		}
+		parsed.IP = ip
+	}
+
+	switch parsed.Level {
+	case AnnounceFull, AnnounceMinimal, AnnouncePeer, AnnounceNone:
+	default:
+		return AnnounceRule{}, fmt.Errorf(`announce must be "full", "minimal", "peer" or "none", not %q`, rule.Announce)
+	}
+
+	return parsed, nil
+}
+
+// AnnounceLevelFor returns what the router announces about itself to the
+// given peer. The first matching rule of the announce policy applies.
+// Without a matching rule, the full announcement is sent.
+// Invisible routers never announce themselves.
+func (c *Config) AnnounceLevelFor(peer netip.Addr, lite bool) AnnounceLevel {
+	if c.Router.Invisible {
+		return AnnounceNone
+	}
+
+	for _, rule := range c.AnnouncePolicy {
+		switch {
+		case rule.IP.IsValid():
+			if rule.IP == peer {
+				return rule.Level
+			}
+		case rule.Peers == AnnouncePeersAll:
+			return rule.Level
+		case rule.Peers == AnnouncePeersLite:
+			if lite {
+				return rule.Level
+			}
+		case rule.Peers == AnnouncePeersFriends:
+			if _, ok := c.GetFriendByIP(peer); ok {
+				return rule.Level
+			}
+		}
+	}
+	return AnnounceFull
+}
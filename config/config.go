@@ -3,14 +3,19 @@ package config
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/netip"
 	"net/url"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/net/idna"
 
@@ -21,27 +26,239 @@ import (
 type Config struct {
 	Store
 
-	APIListen netip.AddrPort
+	APIListen    netip.AddrPort
+	APIListeners []APIListener
 
-	Friends       []Friend
-	FriendsByName map[string]Friend
-	FriendsByIP   map[netip.Addr]Friend
+	ScanDetection   ScanDetection
+	DNSCache        DNSCache
+	DNSRateLimit    DNSRateLimit
+	DNSResolver     DNSResolver
+	OutboundPrompts OutboundPrompts
+
+	// LogLevels holds the log levels of modules.
+	LogLevels map[string]slog.Level
+
+	// Notifications holds the notification settings.
+	// Disabled if nil.
+	Notifications *Notifications
+
+	// RoutingDecisionSampling defines that one in N routed frames is
+	// recorded. Zero means disabled.
+	RoutingDecisionSampling int
+
+	// MaxAnnounceHops defines how many routers an announcement may pass.
+	MaxAnnounceHops int
+
+	// DiscoveryStrategies holds the route discovery strategies to use, in
+	// order. Empty if disabled.
+	DiscoveryStrategies []string
+
+	// AnnouncePolicy holds the rules for what the router announces about
+	// itself to which peers.
+	AnnouncePolicy []AnnounceRule
+
+	// MarkerTableSigners holds the routers trusted to sign marker tables.
+	MarkerTableSigners []netip.Addr
+
+	// Updates holds the software update settings.
+	Updates Updates
+
+	// HA holds the high availability settings. Disabled if nil.
+	HA *HA
+
+	// IsolateSchedule limits isolation to certain times, if set.
+	IsolateSchedule *m.Schedule
+
+	// Resources holds the detected resource limits.
+	Resources Resources
+	// Limits holds the limits derived from the available resources.
+	Limits Limits
+
+	// PerfPort is the port of the throughput test responder.
+	// It is enabled by a service with a perf:// URL. Zero means disabled.
+	PerfPort uint16
+
+	friends       []Friend
+	friendsByName map[string]Friend
+	friendsByIP   map[netip.Addr]Friend
+	friendsLock   sync.RWMutex
+
+	// peerWeights holds the route preference weights of peers.
+	peerWeights map[netip.Addr]int
+	// relayBudget holds the bandwidth budget for relayed frames.
+	// Disabled if nil.
+	relayBudget *RelayBudget
+	// reloadLock protects the router settings that are applied on reload.
+	reloadLock sync.RWMutex
 
 	Services []Service
 	Resolve  map[string]netip.Addr
 
-	inPolicy map[string]map[netip.Addr]struct{}
+	inPolicy     map[string]map[netip.Addr]struct{}
+	inPolicyLock sync.RWMutex
 
 	tunMTU atomic.Int32
 
+	filename    string
+	fileModTime time.Time
+	fileLock    sync.Mutex
+
 	devMode atomic.Bool
+	clock   atomic.Pointer[m.Clock]
 	started time.Time
 }
 
+// MarkerTablePath returns the path of the signed country geo marker table
+// next to the state file. Returns an empty string if there is no state file.
+func (c *Config) MarkerTablePath() string {
+	if c.System.StatePath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.System.StatePath), MarkerTableFilename)
+}
+
+// ErrInvisibleIdentity is returned when the configured identity is requested
+// for an invisible router.
+var ErrInvisibleIdentity = errors.New("router is invisible and runs with a privacy address instead of the configured identity")
+
+// Identity loads the configured router identity.
+// Invisible routers run with an ephemeral privacy address, so anything signed
+// with the configured identity would not match the running router.
+func (c *Config) Identity() (*m.Address, error) {
+	if c.Router.Invisible {
+		return nil, ErrInvisibleIdentity
+	}
+	return m.AddressFromStorage(c.Router.Address)
+}
+
+// ScanDetection holds the scan detection settings.
+type ScanDetection struct {
+	// Threshold is the number of denied connections to different ports
+	// within Window after which a router is blocked. Zero disables detection.
+	Threshold     int
+	Window        time.Duration
+	BlockDuration time.Duration
+	// Share defines whether blocks are shared with friends and blocks
+	// reported by friends are applied.
+	Share bool
+}
+
+// OutboundPrompts holds the settings for prompting for outgoing connections.
+type OutboundPrompts struct {
+	Enabled bool
+	Timeout time.Duration
+	// TimeoutAllow defines whether connections are allowed when no decision
+	// was made in time.
+	TimeoutAllow bool
+}
+
+// DNSCache holds the DNS mapping cache settings.
+type DNSCache struct {
+	TTL time.Duration
+	// Size is the maximum amount of cached mappings. Zero disables the cache.
+	Size int
+}
+
+// APIService is a service that can be exposed on an API listener.
+type APIService string
+
+// API services.
+const (
+	APIServiceHTTP APIService = "http"
+	APIServiceDNS  APIService = "dns"
+)
+
+// APIScope defines which parts of the API are available on a listener.
+type APIScope string
+
+// API scopes.
+const (
+	// APIScopeStatus only allows viewing the status of the router.
+	APIScopeStatus APIScope = "status"
+	// APIScopeAdmin allows full access, including changing the config.
+	APIScopeAdmin APIScope = "admin"
+)
+
+// APIListener is an additional listener for the API or the DNS server.
+type APIListener struct {
+	Addr    netip.AddrPort
+	Service APIService
+	Scope   APIScope
+}
+
+// Notifications holds the settings for notifications about events.
+type Notifications struct {
+	// Events holds the events to notify about.
+	Events  []string
+	Desktop bool
+	Webhook *url.URL
+	Ntfy    *url.URL
+	Alerts  []Alert
+}
+
+// Alert is an alert rule.
+type Alert struct {
+	Name string
+	// Unreachable is the address of the monitored router.
+	Unreachable netip.Addr
+	// UnreachableFriend is the name of the monitored friend.
+	// Resolved when evaluated, as friends may change at runtime.
+	UnreachableFriend string
+	PeersBelow        int
+	For               time.Duration
+}
+
+// Enabled returns whether notifications are sent for the given event.
+func (n *Notifications) Enabled(event string) bool {
+	return n != nil && slices.Contains(n.Events, event)
+}
+
+// HA holds the settings of an active-standby high availability pair.
+type HA struct {
+	Listen    netip.AddrPort
+	Peer      netip.AddrPort
+	Priority  uint8
+	Witnesses []string
+}
+
+// DNSRateLimit holds the per client DNS query rate limits.
+type DNSRateLimit struct {
+	// Queries is the amount of queries per second a client may send.
+	// Zero disables the rate limit.
+	Queries int
+	// Misses is the amount of queries per second for unknown names a client
+	// may send.
+	Misses int
+}
+
+// DNSResolver holds the DNS resolver settings.
+type DNSResolver struct {
+	// Mesh defines whether unknown names are resolved by asking other routers.
+	Mesh bool
+	// Timeout defines how long to wait for answers of other routers.
+	Timeout time.Duration
+	// CacheTTL defines how long names resolved over the mesh are cached.
+	CacheTTL time.Duration
+}
+
+// Updates holds the software update settings.
+type Updates struct {
+	// ManifestURL is the URL of the signed release manifest.
+	// Updates are disabled if nil.
+	ManifestURL *url.URL
+	// Signers holds the routers trusted to sign release manifests.
+	Signers       []netip.Addr
+	CheckInterval time.Duration
+	AutoUpdate    bool
+}
+
 // Friend is a trusted router in the network.
 type Friend struct {
 	Name string
 	IP   netip.Addr
+
+	// Address holds the pinned address of the friend, if known.
+	Address *m.PublicAddress
 }
 
 // Service defines an endpoint other routers can send traffic to.
@@ -55,7 +272,15 @@ type Service struct { //nolint:maligned
 	Friends bool
 	For     []netip.Addr
 
-	Advertise bool
+	AccessRequests bool
+	NotifyDenied   bool
+	Hidden         bool
+	Advertise      bool
+
+	// Schedule limits when the service is reachable, if set.
+	Schedule *m.Schedule
+
+	policyKeys []string
 }
 
 var (
@@ -104,6 +329,9 @@ func (s Store) parse(test bool) (*Config, error) { //nolint:maintidx // Function
 	if c.System.TunMTU != 0 {
 		c.SetTunMTU(c.System.TunMTU)
 	}
+	if !test && c.System.TunHelper != "" && !filepath.IsAbs(c.System.TunHelper) {
+		return nil, errors.New("system.tunHelper must be an absolute path")
+	}
 	if !test && c.System.StatePath != "" && !filepath.IsAbs(c.System.StatePath) {
 		return nil, errors.New("system.statePath must be an absolute path")
 	}
@@ -114,6 +342,308 @@ func (s Store) parse(test bool) (*Config, error) { //nolint:maintidx // Function
 			return nil, errors.New("system.apiListen ist not a valid IP and port")
 		}
 	}
+	if c.System.HA != nil {
+		var err error
+		c.HA, err = parseHA(c.System.HA)
+		if err != nil {
+			return nil, fmt.Errorf("system.ha: %w", err)
+		}
+		if c.Router.Invisible {
+			return nil, errors.New("system.ha: cannot be used with router.invisible, as the routers must share the same address")
+		}
+	}
+	if c.System.Notifications != nil {
+		var err error
+		c.Notifications, err = parseNotifications(c.System.Notifications)
+		if err != nil {
+			return nil, fmt.Errorf("system.notifications: %w", err)
+		}
+	}
+	for _, lc := range c.System.APIListeners {
+		ln, err := parseAPIListener(lc)
+		if err != nil {
+			return nil, fmt.Errorf("system.apiListeners: %w", err)
+		}
+		c.APIListeners = append(c.APIListeners, ln)
+	}
+
+	// Detect resources and derive limits.
+	// Tests use the defaults, so that they do not depend on the host.
+	if !test {
+		c.Resources = DetectResources()
+	}
+	c.Limits = c.Resources.DeriveLimits()
+
+	// Parse DNS cache settings.
+	c.DNSCache = DNSCache{
+		TTL:  DefaultDNSCacheTTL,
+		Size: DefaultDNSCacheSize,
+	}
+	if c.System.DNSCacheTTL != "" {
+		ttl, err := time.ParseDuration(c.System.DNSCacheTTL)
+		if err != nil || ttl <= 0 {
+			return nil, errors.New("system.dnsCacheTTL is not a valid positive duration")
+		}
+		c.DNSCache.TTL = ttl
+	}
+	switch {
+	case c.System.DNSCacheSize < 0:
+		c.DNSCache.Size = 0
+	case c.System.DNSCacheSize > 0:
+		c.DNSCache.Size = c.System.DNSCacheSize
+	}
+
+	// Parse DNS rate limit.
+	queryRate := DefaultDNSRateLimit
+	switch {
+	case c.System.DNSRateLimit < 0:
+		queryRate = 0
+	case c.System.DNSRateLimit > 0:
+		queryRate = c.System.DNSRateLimit
+	}
+	c.DNSRateLimit = DNSRateLimit{
+		Queries: queryRate,
+		Misses:  max(queryRate/10, 1),
+	}
+
+	// Parse DNS resolver settings.
+	c.DNSResolver = DNSResolver{
+		Timeout:  DefaultDNSMeshTimeout,
+		CacheTTL: DefaultDNSMeshCacheTTL,
+	}
+	switch c.System.DNSResolver {
+	case "", DNSResolverLocal:
+	case DNSResolverMesh:
+		c.DNSResolver.Mesh = true
+	default:
+		return nil, fmt.Errorf("system.dnsResolver %q is invalid, must be %q or %q",
+			c.System.DNSResolver, DNSResolverLocal, DNSResolverMesh)
+	}
+
+	// Parse module log levels.
+	if len(c.System.LogLevels) > 0 {
+		c.LogLevels = make(map[string]slog.Level, len(c.System.LogLevels))
+		for module, levelName := range c.System.LogLevels {
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(levelName)); err != nil {
+				return nil, fmt.Errorf("system.logLevels: invalid log level %q for %s", levelName, module)
+			}
+			c.LogLevels[strings.ToLower(module)] = level
+		}
+	}
+
+	// Parse scan detection settings.
+	c.ScanDetection = ScanDetection{
+		Threshold:     DefaultScanThreshold,
+		Window:        DefaultScanWindow,
+		BlockDuration: DefaultScanBlockDuration,
+		Share:         c.Router.ShareScanBlocks,
+	}
+	switch {
+	case c.Router.ScanThreshold < 0:
+		c.ScanDetection.Threshold = 0
+	case c.Router.ScanThreshold > 0:
+		c.ScanDetection.Threshold = c.Router.ScanThreshold
+	}
+	if c.Router.ScanWindow != "" {
+		window, err := time.ParseDuration(c.Router.ScanWindow)
+		if err != nil || window <= 0 {
+			return nil, errors.New("router.scanWindow is not a valid duration")
+		}
+		c.ScanDetection.Window = window
+	}
+	if c.Router.ScanBlockDuration != "" {
+		blockDuration, err := time.ParseDuration(c.Router.ScanBlockDuration)
+		if err != nil || blockDuration <= 0 {
+			return nil, errors.New("router.scanBlockDuration is not a valid duration")
+		}
+		c.ScanDetection.BlockDuration = blockDuration
+	}
+
+	// Parse outbound prompt settings.
+	c.OutboundPrompts = OutboundPrompts{
+		Enabled: c.Router.PromptOutbound,
+		Timeout: DefaultPromptTimeout,
+	}
+	if c.Router.PromptTimeout != "" {
+		timeout, err := time.ParseDuration(c.Router.PromptTimeout)
+		if err != nil || timeout <= 0 {
+			return nil, errors.New("router.promptTimeout is not a valid duration")
+		}
+		c.OutboundPrompts.Timeout = timeout
+	}
+	switch c.Router.PromptTimeoutAction {
+	case "", "deny":
+	case "allow":
+		c.OutboundPrompts.TimeoutAllow = true
+	default:
+		return nil, errors.New(`router.promptTimeoutAction must be "deny" or "allow"`)
+	}
+
+	// Check routing table settings.
+	// Zero uses the default of the routing table.
+	if rpd := c.Router.RoutesPerDestination; rpd != 0 && (rpd < 1 || rpd > MaxRoutesPerDestination) {
+		return nil, fmt.Errorf("router.routesPerDestination must be between 1 and %d, or 0 for the default", MaxRoutesPerDestination)
+	}
+	switch {
+	case c.Router.MaxAnnounceHops == 0:
+		c.MaxAnnounceHops = DefaultMaxAnnounceHops
+	case c.Router.MaxAnnounceHops < 1 || c.Router.MaxAnnounceHops > MaxAnnounceHops:
+		return nil, fmt.Errorf("router.maxAnnounceHops must be between 1 and %d", MaxAnnounceHops)
+	default:
+		c.MaxAnnounceHops = c.Router.MaxAnnounceHops
+	}
+	switch {
+	case len(c.Router.Discovery) == 0:
+		c.DiscoveryStrategies = DefaultDiscoveryStrategies
+	case slices.Equal(c.Router.Discovery, []string{DiscoveryNone}):
+		c.DiscoveryStrategies = nil
+	default:
+		for _, strategy := range c.Router.Discovery {
+			switch {
+			case !slices.Contains(DefaultDiscoveryStrategies, strategy):
+				return nil, fmt.Errorf("router.discovery: unknown strategy %q, must be one of %s or %s",
+					strategy, strings.Join(DefaultDiscoveryStrategies, ", "), DiscoveryNone)
+			case slices.Contains(c.DiscoveryStrategies, strategy):
+				return nil, fmt.Errorf("router.discovery: strategy %q is listed more than once", strategy)
+			}
+			c.DiscoveryStrategies = append(c.DiscoveryStrategies, strategy)
+		}
+	}
+	for _, peer := range c.Router.Peers {
+		ip, err := netip.ParseAddr(peer.IP)
+		if err != nil || !m.BaseNetPrefix.Contains(ip) {
+			return nil, fmt.Errorf("router.peers: %q is not a valid router IP", peer.IP)
+		}
+		if peer.Weight < -MaxPeerWeight || peer.Weight > MaxPeerWeight {
+			return nil, fmt.Errorf("router.peers: weight of %s must be between %d and %d", ip, -MaxPeerWeight, MaxPeerWeight)
+		}
+		if _, ok := c.peerWeights[ip]; ok {
+			return nil, fmt.Errorf("router.peers: %s is listed more than once", ip)
+		}
+		if c.peerWeights == nil {
+			c.peerWeights = make(map[netip.Addr]int, len(c.Router.Peers))
+		}
+		c.peerWeights[ip] = peer.Weight
+	}
+	for i, rule := range c.Router.AnnouncePolicy {
+		parsed, err := parseAnnounceRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("router.announcePolicy[%d]: %w", i, err)
+		}
+		c.AnnouncePolicy = append(c.AnnouncePolicy, parsed)
+	}
+	switch {
+	case c.Router.RoutingDecisionSampling < 0:
+		c.RoutingDecisionSampling = 0
+	case c.Router.RoutingDecisionSampling > 0:
+		c.RoutingDecisionSampling = c.Router.RoutingDecisionSampling
+	default:
+		c.RoutingDecisionSampling = DefaultRoutingDecisionSampling
+	}
+
+	// Parse relay budget.
+	if c.Router.RelayBudget != nil {
+		var err error
+		c.relayBudget, err = parseRelayBudget(c.Router.RelayBudget)
+		if err != nil {
+			return nil, fmt.Errorf("router.relayBudget: %w", err)
+		}
+	}
+
+	// Check geo verification settings.
+	if c.Router.GeoMismatchPenalty < 0 || c.Router.GeoMismatchPenalty > 10000 {
+		return nil, errors.New("router.geoMismatchPenalty must be between 0 and 10000")
+	}
+	if c.Router.GeoMismatchPenalty > 0 && c.Router.GeoIPDatabase == "" {
+		return nil, errors.New("router.geoMismatchPenalty requires router.geoipDatabase")
+	}
+
+	// Parse marker table signers.
+	for _, signer := range c.Router.MarkerTableSigners {
+		ip, err := netip.ParseAddr(signer)
+		if err != nil || !m.BaseNetPrefix.Contains(ip) {
+			return nil, fmt.Errorf("router.markerTableSigners: %q is not a valid router IP", signer)
+		}
+		c.MarkerTableSigners = append(c.MarkerTableSigners, ip)
+	}
+
+	// Parse update settings.
+	c.Updates = Updates{
+		CheckInterval: DefaultUpdateCheckInterval,
+		AutoUpdate:    c.System.AutoUpdate,
+	}
+	for _, signer := range c.System.UpdateSigners {
+		ip, err := netip.ParseAddr(signer)
+		if err != nil || !m.BaseNetPrefix.Contains(ip) {
+			return nil, fmt.Errorf("system.updateSigners: %q is not a valid router IP", signer)
+		}
+		c.Updates.Signers = append(c.Updates.Signers, ip)
+	}
+	if c.System.UpdateManifestURL != "" {
+		u, err := ParseUpdateURL(c.System.UpdateManifestURL)
+		if err != nil {
+			return nil, fmt.Errorf("system.updateManifestURL: %w", err)
+		}
+		if len(c.Updates.Signers) == 0 {
+			return nil, errors.New("system.updateManifestURL requires system.updateSigners")
+		}
+		c.Updates.ManifestURL = u
+	}
+	if c.System.UpdateCheckInterval != "" {
+		interval, err := time.ParseDuration(c.System.UpdateCheckInterval)
+		if err != nil || interval < MinUpdateCheckInterval {
+			return nil, fmt.Errorf("system.updateCheckInterval must be a duration of at least %s", MinUpdateCheckInterval)
+		}
+		c.Updates.CheckInterval = interval
+	}
+	if c.Updates.AutoUpdate && c.Updates.ManifestURL == nil {
+		return nil, errors.New("system.autoUpdate requires system.updateManifestURL")
+	}
+
+	// Parse isolation schedule.
+	if c.Router.IsolateSchedule != "" {
+		if !c.Router.Isolate {
+			return nil, errors.New("router.isolateSchedule requires router.isolate")
+		}
+		schedule, err := m.ParseSchedule(c.Router.IsolateSchedule)
+		if err != nil {
+			return nil, fmt.Errorf("router.isolateSchedule: %w", err)
+		}
+		c.IsolateSchedule = schedule
+	}
+
+	// Check router status.
+	if utf8.RuneCountInString(c.Router.Status) > m.MaxRouterStatusLength {
+		return nil, fmt.Errorf("router.status must not be longer than %d characters", m.MaxRouterStatusLength)
+	}
+	if c.Router.Contact != "" {
+		if utf8.RuneCountInString(c.Router.Contact) > m.MaxRouterContactLength {
+			return nil, fmt.Errorf("router.contact must not be longer than %d characters", m.MaxRouterContactLength)
+		}
+		if u, err := url.Parse(c.Router.Contact); err != nil || u.Scheme == "" {
+			return nil, errors.New("router.contact must be a URI, eg. mailto:ops@example.com")
+		}
+	}
+
+	if c.Router.Operator != nil {
+		if err := c.Router.Operator.Check(); err != nil {
+			return nil, fmt.Errorf("router.operator is invalid: %w", err)
+		}
+	}
+
+	// Check groups.
+	if len(c.Router.Groups) > m.MaxRouterGroups {
+		return nil, fmt.Errorf("router.groups must not have more than %d groups", m.MaxRouterGroups)
+	}
+	for i, group := range c.Router.Groups {
+		if err := m.CheckGroupName(group); err != nil {
+			return nil, fmt.Errorf("router.groups: %q is invalid: %w", group, err)
+		}
+		if slices.Contains(c.Router.Groups[:i], group) {
+			return nil, fmt.Errorf("router.groups: %q is duplicated", group)
+		}
+	}
 
 	// Check if there is any way to connect.
 	if !test {
@@ -129,48 +659,59 @@ Configure at least one of these settings:
 
 	// Check peering URLs.
 	for i, peeringURL := range c.Router.Listen {
-		if _, err := m.ParsePeeringURL(peeringURL); err != nil {
+		u, err := m.ParsePeeringURL(peeringURL)
+		if err != nil {
 			return nil, fmt.Errorf("router.listen.#%d is invalid: %w", i+1, err)
 		}
+		if _, err := u.Schedule(); err != nil {
+			return nil, fmt.Errorf("router.listen.#%d has an invalid schedule: %w", i+1, err)
+		}
 	}
 	for i, peeringURL := range c.Router.Connect {
-		if _, err := m.ParsePeeringURL(peeringURL); err != nil {
+		u, err := m.ParsePeeringURL(peeringURL)
+		if err != nil {
 			return nil, fmt.Errorf("router.connect.#%d is invalid: %w", i+1, err)
 		}
+		if _, err := u.Schedule(); err != nil {
+			return nil, fmt.Errorf("router.connect.#%d has an invalid schedule: %w", i+1, err)
+		}
 	}
 	for i, peeringURL := range c.Router.Bootstrap {
-		if _, err := m.ParsePeeringURL(peeringURL); err != nil {
+		u, err := m.ParsePeeringURL(peeringURL)
+		if err != nil {
 			return nil, fmt.Errorf("router.bootstrap.#%d is invalid: %w", i+1, err)
 		}
+		if _, err := u.Schedule(); err != nil {
+			return nil, fmt.Errorf("router.bootstrap.#%d has an invalid schedule: %w", i+1, err)
+		}
 	}
 
 	// Parse friends.
-	c.Friends = make([]Friend, 0, len(c.FriendConfigs))
-	c.FriendsByName = make(map[string]Friend, len(c.FriendConfigs))
-	c.FriendsByIP = make(map[netip.Addr]Friend, len(c.FriendConfigs))
+	c.friends = make([]Friend, 0, len(c.FriendConfigs))
+	c.friendsByName = make(map[string]Friend, len(c.FriendConfigs))
+	c.friendsByIP = make(map[netip.Addr]Friend, len(c.FriendConfigs))
 	for i, friendConfig := range c.FriendConfigs {
 		ip, err := netip.ParseAddr(friendConfig.IP)
 		if err != nil {
 			return nil, fmt.Errorf("IP address of friend %s (#%d) is invalid: %w", friendConfig.Name, i+1, err)
 		}
-		switch m.GetAddressType(ip) { //nolint:exhaustive
-		case m.TypeGeoMarked,
-			m.TypeRoaming,
-			m.TypeOrganization,
-			m.TypeAnycast,
-			m.TypeExperiment:
-			// Address in accepted range.
-		default:
-			return nil, fmt.Errorf("IP address of friend %s (#%d) is invalid: must be in acceptable routable range", friendConfig.Name, i+1)
+		if err := checkFriendIP(ip); err != nil {
+			return nil, fmt.Errorf("IP address of friend %s (#%d) is invalid: %w", friendConfig.Name, i+1, err)
 		}
 
 		friend := Friend{
 			Name: friendConfig.Name,
 			IP:   ip,
 		}
-		c.Friends = append(c.Friends, friend)
-		c.FriendsByName[friend.Name] = friend
-		c.FriendsByIP[friend.IP] = friend
+		if friendConfig.Key != "" {
+			friend.Address, err = ParseFriendKey(ip, friendConfig.Key)
+			if err != nil {
+				return nil, fmt.Errorf("key of friend %s (#%d) is invalid: %w", friendConfig.Name, i+1, err)
+			}
+		}
+		c.friends = append(c.friends, friend)
+		c.friendsByName[friend.Name] = friend
+		c.friendsByIP[friend.IP] = friend
 	}
 
 	// Parse services.
@@ -182,7 +723,7 @@ Configure at least one of these settings:
 		}
 
 		// Check if anyone is allowed to access.
-		if !svc.Public && !svc.Friends && len(svc.For) == 0 {
+		if !svc.Public && !svc.Friends && len(svc.For) == 0 && !svc.AccessRequests {
 			return nil, fmt.Errorf(`service %s (#%d): nobody is allowed to access service`, svc.Name, i+1)
 		}
 
@@ -190,7 +731,7 @@ Configure at least one of these settings:
 		forIPs := make([]netip.Addr, 0, len(svc.For))
 		for j, forIP := range svc.For {
 			// Check if entry is friend name.
-			friend, ok := c.FriendsByName[forIP]
+			friend, ok := c.friendsByName[forIP]
 			if ok {
 				forIPs = append(forIPs, friend.IP)
 				continue
@@ -225,23 +766,60 @@ Configure at least one of these settings:
 			}
 		}
 
+		// Parse schedule.
+		var schedule *m.Schedule
+		if svc.Schedule != "" {
+			schedule, err = m.ParseSchedule(svc.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf(`service %s (#%d): %w`, svc.Name, i+1, err)
+			}
+		}
+
 		// Create and add service.
 		service := Service{
-			Name:        svc.Name,
-			Description: svc.Description,
-			Domain:      svcDomain,
-			URL:         svc.URL,
-			Public:      svc.Public,
-			Friends:     svc.Friends,
-			For:         forIPs,
-			Advertise:   svc.Advertise,
+			Name:           svc.Name,
+			Description:    svc.Description,
+			Domain:         svcDomain,
+			URL:            svc.URL,
+			Public:         svc.Public,
+			Friends:        svc.Friends,
+			For:            forIPs,
+			AccessRequests: svc.AccessRequests,
+			NotifyDenied:   svc.NotifyDenied,
+			Hidden:         svc.Hidden,
+			Advertise:      svc.Advertise,
+			Schedule:       schedule,
+			policyKeys:     policyKeys,
 		}
 		c.Services = append(c.Services, service)
 
+		// Enable throughput test responder.
+		if u, err := url.Parse(svc.URL); err == nil && u.Scheme == "perf" {
+			if c.PerfPort != 0 {
+				return nil, fmt.Errorf(`service %s (#%d): only one perf service may be defined`, svc.Name, i+1)
+			}
+			c.PerfPort = DefaultPerfPort
+			if port, err := strconv.ParseUint(u.Port(), 10, 16); err == nil {
+				c.PerfPort = uint16(port)
+			}
+		}
+
 		// Add service to in policy.
 		if service.Public && (service.Friends || len(service.For) > 0) {
 			return nil, fmt.Errorf(`service %s (#%d): public service may not also define friends or "for"`, svc.Name, i+1)
 		}
+		if service.Public && service.AccessRequests {
+			return nil, fmt.Errorf(`service %s (#%d): public service may not also enable access requests`, svc.Name, i+1)
+		}
+		if service.Public && service.NotifyDenied {
+			return nil, fmt.Errorf(`service %s (#%d): public service may not also enable denied notifications`, svc.Name, i+1)
+		}
+		if service.Hidden && service.AccessRequests {
+			return nil, fmt.Errorf(`service %s (#%d): hidden service may not also enable access requests`, svc.Name, i+1)
+		}
+		if service.Hidden && service.Advertise {
+			return nil, fmt.Errorf(`service %s (#%d): hidden service may not be advertised`, svc.Name, i+1)
+		}
 		for _, policyKey := range policyKeys {
 			if err := c.addInPolicyKey(policyKey, service.Public, service.Friends, service.For); err != nil {
 				return nil, fmt.Errorf(`service %s (#%d): create service policy: %w`, svc.Name, i+1, err)
@@ -324,9 +902,9 @@ func (c *Config) addInPolicyKey(policyKey string, public bool, friends bool, for
 	}
 
 	// Add IP based policy.
-	ipPolicy := make(map[netip.Addr]struct{}, len(c.Friends)+len(forIPs))
+	ipPolicy := make(map[netip.Addr]struct{}, len(c.friends)+len(forIPs))
 	if friends {
-		for _, friend := range c.Friends {
+		for _, friend := range c.friends {
 			ipPolicy[friend.IP] = struct{}{}
 		}
 	}
@@ -340,8 +918,11 @@ func (c *Config) addInPolicyKey(policyKey string, public bool, friends bool, for
 
 // CheckInboundTrafficPolicy checks if the given inbound traffic is allowed.
 func (c *Config) CheckInboundTrafficPolicy(protocol uint8, dstPort uint16, src netip.Addr) (allowed bool) {
+	c.inPolicyLock.RLock()
+	defer c.inPolicyLock.RUnlock()
+
 	// Check protocol/port.
-	servicePolicy, ok := c.inPolicy[makePolicyKey(protocol, dstPort)]
+	servicePolicy, ok := c.inPolicy[MakePolicyKey(protocol, dstPort)]
 	if !ok {
 		return false
 	}
@@ -356,10 +937,121 @@ func (c *Config) CheckInboundTrafficPolicy(protocol uint8, dstPort uint16, src n
 	return ok
 }
 
-func makePolicyKey(protocol uint8, dstPort uint16) string {
+// PolicyKeys returns the policy keys of the service.
+func (svc Service) PolicyKeys() []string {
+	return slices.Clone(svc.policyKeys)
+}
+
+// GetServices returns all services.
+// The returned slice must not be modified.
+func (c *Config) GetServices() []Service {
+	c.inPolicyLock.RLock()
+	defer c.inPolicyLock.RUnlock()
+
+	return c.Services
+}
+
+// GetService returns the service with the given name.
+func (c *Config) GetService(name string) (svc Service, ok bool) {
+	c.inPolicyLock.RLock()
+	defer c.inPolicyLock.RUnlock()
+
+	for _, svc := range c.Services {
+		if svc.Name == name {
+			return svc, true
+		}
+	}
+
+	return Service{}, false
+}
+
+// GetServiceByPolicy returns the service that handles the given protocol and port.
+func (c *Config) GetServiceByPolicy(protocol uint8, dstPort uint16) (svc Service, ok bool) {
+	c.inPolicyLock.RLock()
+	defer c.inPolicyLock.RUnlock()
+
+	policyKey := MakePolicyKey(protocol, dstPort)
+	for _, svc := range c.Services {
+		if slices.Contains[[]string, string](svc.policyKeys, policyKey) {
+			return svc, true
+		}
+	}
+
+	return Service{}, false
+}
+
+// AllowServiceAccess adds the given router to the allowed IPs of the service
+// with the given name. The change is applied to the running config only and
+// is reflected in the config store, but is not saved to disk.
+func (c *Config) AllowServiceAccess(serviceName string, src netip.Addr) error {
+	c.inPolicyLock.Lock()
+	defer c.inPolicyLock.Unlock()
+
+	// Find service.
+	index := slices.IndexFunc[[]Service, Service](c.Services, func(svc Service) bool {
+		return svc.Name == serviceName
+	})
+	if index < 0 {
+		return fmt.Errorf("service %s not found", serviceName)
+	}
+	svc := c.Services[index]
+
+	// Check if service is public or IP is already allowed.
+	if svc.Public {
+		return fmt.Errorf("service %s is public", serviceName)
+	}
+	if slices.Contains[[]netip.Addr, netip.Addr](svc.For, src) {
+		return nil
+	}
+
+	// Add IP to policy.
+	for _, policyKey := range svc.policyKeys {
+		ipPolicy, ok := c.inPolicy[policyKey]
+		if !ok || ipPolicy == nil {
+			continue
+		}
+		ipPolicy[src] = struct{}{}
+	}
+
+	// Add IP to service and config store.
+	// The slices are replaced instead of modified, so that services returned
+	// by GetServices are never changed.
+	services := slices.Clone(c.Services)
+	svc.For = append(slices.Clip[[]netip.Addr](svc.For), src)
+	services[index] = svc
+	c.Services = services
+	if index < len(c.ServiceConfigs) && c.ServiceConfigs[index].Name == serviceName {
+		serviceConfigs := slices.Clone(c.ServiceConfigs)
+		serviceConfigs[index].For = append(slices.Clip[[]string](serviceConfigs[index].For), src.String())
+		c.ServiceConfigs = serviceConfigs
+	}
+
+	return nil
+}
+
+// MakePolicyKey returns the policy key for the given protocol and port, eg.
+// "6-80" for TCP port 80. Services are identified by their policy keys.
+func MakePolicyKey(protocol uint8, dstPort uint16) string {
 	return strconv.FormatInt(int64(protocol), 10) + "-" + strconv.FormatInt(int64(dstPort), 10)
 }
 
+// ParsePolicyKey returns the protocol and port of the given policy key.
+func ParsePolicyKey(policyKey string) (protocol uint8, dstPort uint16, ok bool) {
+	protocolValue, portValue, ok := strings.Cut(policyKey, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	protocolNum, err := strconv.ParseUint(protocolValue, 10, 8)
+	if err != nil {
+		return 0, 0, false
+	}
+	portNum, err := strconv.ParseUint(portValue, 10, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint8(protocolNum), uint16(portNum), true
+}
+
 func getInfoFromURL(svcURL string) (policyKeys []string, domain string, err error) {
 	u, err := url.Parse(svcURL)
 	if err != nil {
@@ -387,7 +1079,10 @@ func getInfoFromURL(svcURL string) (policyKeys []string, domain string, err erro
 		protocols = []uint8{6, 17} // TCP + UDP
 		port = 443
 	case "udp":
-		protocols = []uint8{6}
+		protocols = []uint8{17}
+	case "perf":
+		protocols = []uint8{6, 17} // TCP + UDP
+		port = DefaultPerfPort
 	case "icmp6", "ping6":
 		protocols = []uint8{58}
 		port = 0
@@ -414,21 +1109,85 @@ func getInfoFromURL(svcURL string) (policyKeys []string, domain string, err erro
 
 	policyKeys = make([]string, 0, len(protocols))
 	for _, protocol := range protocols {
-		policyKeys = append(policyKeys, makePolicyKey(protocol, uint16(port)))
+		policyKeys = append(policyKeys, MakePolicyKey(protocol, uint16(port)))
 	}
 
 	return policyKeys, domain, nil
 }
 
+// publicListeners returns the listeners without local peering URL parameters.
+func (c *Config) publicListeners() []string {
+	if len(c.Router.Listen) == 0 {
+		return nil
+	}
+
+	listeners := make([]string, 0, len(c.Router.Listen))
+	for _, listener := range c.Router.Listen {
+		u, err := m.ParsePeeringURL(listener)
+		switch {
+		case err != nil:
+			// Listeners are checked when parsing the config.
+		case u.IsLocal():
+			// Local listeners cannot be reached by others.
+		case u.Public() != u:
+			listeners = append(listeners, u.Public().String())
+		default:
+			listeners = append(listeners, listener)
+		}
+	}
+	return listeners
+}
+
+// InvitePeeringURLs returns the peering URLs other routers can use to connect
+// to this router, combining the public listeners with the IANA hosts.
+func (c *Config) InvitePeeringURLs() []string {
+	listeners, _ := m.ParsePeeringURLs(c.Router.Listen)
+	peeringURLs := make([]string, 0, len(listeners)*len(c.Router.IANA))
+	for _, listener := range listeners {
+		if listener.IsLocal() {
+			continue
+		}
+		for _, iana := range c.Router.IANA {
+			u := listener.Public().FormatWith(iana)
+			if !slices.Contains(peeringURLs, u) {
+				peeringURLs = append(peeringURLs, u)
+			}
+		}
+	}
+	return peeringURLs
+}
+
+// AdvertisesDomain returns whether the domain belongs to a public service
+// that is advertised by this router.
+func (c *Config) AdvertisesDomain(domain string) bool {
+	c.inPolicyLock.RLock()
+	defer c.inPolicyLock.RUnlock()
+
+	for _, svc := range c.Services {
+		if cleaned, ok := CleanDomain(svc.Domain); ok &&
+			cleaned == domain && svc.Public && svc.Advertise {
+			return true
+		}
+	}
+	return false
+}
+
 // GetRouterInfo retruns a new router info derived from config.
 func (c *Config) GetRouterInfo() *m.RouterInfo {
 	// Create router info.
 	info := &m.RouterInfo{
-		Listeners: c.Router.Listen,
+		Listeners: c.publicListeners(),
 		IANA:      c.Router.IANA,
+		Status:    c.Router.Status,
+		Contact:   c.Router.Contact,
+	}
+	if !c.Router.Operator.IsEmpty() {
+		info.Operator = c.Router.Operator
 	}
 
 	// Collect public services.
+	c.inPolicyLock.RLock()
+	defer c.inPolicyLock.RUnlock()
 	srv := make([]m.RouterService, 0, len(c.Services))
 	for _, service := range c.Services {
 		if service.Public && service.Advertise {
@@ -456,6 +1215,25 @@ func (c *Config) SetDevMode(mode bool) {
 	c.devMode.Store(mode)
 }
 
+// Clock returns the clock to be used by time-dependent subsystems.
+func (c *Config) Clock() m.Clock {
+	if clock := c.clock.Load(); clock != nil {
+		return *clock
+	}
+	return m.SystemClock
+}
+
+// SetClock sets the clock to be used by time-dependent subsystems.
+// Only available in development mode, as it is intended for testing.
+// Must be set before the instance is created.
+func (c *Config) SetClock(clock m.Clock) error {
+	if !c.DevMode() {
+		return errors.New("custom clock requires development mode")
+	}
+	c.clock.Store(&clock)
+	return nil
+}
+
 // Started returns the time when the router was started.
 // Measured by when the config was created.
 func (c *Config) Started() time.Time {
@@ -467,3 +1245,192 @@ func (c *Config) Started() time.Time {
 func (c *Config) Uptime() time.Duration {
 	return time.Since(c.started)
 }
+
+// ParseUpdateURL parses and checks the URL of a release manifest or binary.
+// HTTPS is required, except for URLs with a router IP as host, which are
+// fetched over Mycoria and are protected by its encryption.
+func ParseUpdateURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return u, CheckUpdateURL(u)
+}
+
+// CheckUpdateURL checks if the given URL may be used for updates.
+// See ParseUpdateURL.
+func CheckUpdateURL(u *url.URL) error {
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		ip, err := netip.ParseAddr(u.Hostname())
+		if err != nil || !m.BaseNetPrefix.Contains(ip) {
+			return errors.New("http is only allowed with a router IP as host, use https")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+}
+
+// parseAPIListener parses and checks an additional API listener.
+func parseAPIListener(lc APIListenerConfig) (APIListener, error) {
+	addr, err := netip.ParseAddrPort(lc.Listen)
+	if err != nil {
+		return APIListener{}, fmt.Errorf("%q is not a valid IP and port", lc.Listen)
+	}
+	ln := APIListener{
+		Addr:    addr,
+		Service: APIService(lc.Service),
+		Scope:   APIScope(lc.Scope),
+	}
+
+	switch ln.Service {
+	case "":
+		ln.Service = APIServiceHTTP
+	case APIServiceHTTP, APIServiceDNS:
+	default:
+		return APIListener{}, fmt.Errorf("unknown service %q on %s", lc.Service, lc.Listen)
+	}
+	switch ln.Scope {
+	case "":
+		ln.Scope = APIScopeStatus
+	case APIScopeStatus, APIScopeAdmin:
+		if ln.Service == APIServiceDNS {
+			return APIListener{}, fmt.Errorf("scope is not supported by dns on %s", lc.Listen)
+		}
+	default:
+		return APIListener{}, fmt.Errorf("unknown scope %q on %s", lc.Scope, lc.Listen)
+	}
+	return ln, nil
+}
+
+// parseNotifications parses and checks the notification settings.
+func parseNotifications(nc *NotificationsConfig) (*Notifications, error) {
+	n := &Notifications{
+		Events:  nc.Events,
+		Desktop: nc.Desktop,
+	}
+	if len(n.Events) == 0 {
+		n.Events = []string{NotifyEventNewInbound, NotifyEventDenied, NotifyEventPeerDown}
+	}
+	for _, event := range n.Events {
+		switch event {
+		case NotifyEventNewInbound, NotifyEventDenied, NotifyEventPeerDown:
+		default:
+			return nil, fmt.Errorf("unknown event %q", event)
+		}
+	}
+
+	var err error
+	if nc.Webhook != "" {
+		n.Webhook, err = parseNotificationURL(nc.Webhook)
+		if err != nil {
+			return nil, fmt.Errorf("webhook: %w", err)
+		}
+	}
+	if nc.Ntfy != "" {
+		n.Ntfy, err = parseNotificationURL(nc.Ntfy)
+		if err != nil {
+			return nil, fmt.Errorf("ntfy: %w", err)
+		}
+	}
+	if !n.Desktop && n.Webhook == nil && n.Ntfy == nil {
+		return nil, errors.New("no notification target configured")
+	}
+
+	names := make(map[string]struct{}, len(nc.Alerts))
+	for i, ac := range nc.Alerts {
+		alert, err := parseAlert(ac)
+		if err != nil {
+			return nil, fmt.Errorf("alerts[%d]: %w", i, err)
+		}
+		if _, ok := names[alert.Name]; ok {
+			return nil, fmt.Errorf("alerts[%d]: duplicate name %q", i, alert.Name)
+		}
+		names[alert.Name] = struct{}{}
+		n.Alerts = append(n.Alerts, alert)
+	}
+
+	return n, nil
+}
+
+func parseAlert(ac AlertConfig) (Alert, error) {
+	alert := Alert{
+		Name:       ac.Name,
+		PeersBelow: ac.PeersBelow,
+		For:        DefaultAlertFor,
+	}
+	if alert.Name == "" {
+		return Alert{}, errors.New("name must be set")
+	}
+
+	switch {
+	case ac.Unreachable != "" && ac.PeersBelow != 0:
+		return Alert{}, errors.New("only one condition may be set")
+	case ac.Unreachable != "":
+		if ip, err := netip.ParseAddr(ac.Unreachable); err == nil {
+			alert.Unreachable = ip
+		} else if err := CheckFriendName(ac.Unreachable); err == nil {
+			alert.UnreachableFriend = ac.Unreachable
+		} else {
+			return Alert{}, fmt.Errorf("unreachable: %q is neither an address nor a friend name", ac.Unreachable)
+		}
+	case ac.PeersBelow < 0:
+		return Alert{}, errors.New("peersBelow must not be negative")
+	case ac.PeersBelow == 0:
+		return Alert{}, errors.New("no condition set")
+	}
+
+	if ac.For != "" {
+		d, err := time.ParseDuration(ac.For)
+		if err != nil {
+			return Alert{}, fmt.Errorf("for: %w", err)
+		}
+		if d < 0 {
+			return Alert{}, errors.New("for must not be negative")
+		}
+		alert.For = d
+	}
+
+	return alert, nil
+}
+
+func parseNotificationURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not a valid http(s) URL", rawURL)
+	}
+	return u, nil
+}
+
+// parseHA parses and checks the high availability settings.
+func parseHA(hc *HAConfig) (*HA, error) {
+	listen, err := netip.ParseAddrPort(hc.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("listen %q is not a valid IP and port", hc.Listen)
+	}
+	peer, err := netip.ParseAddrPort(hc.Peer)
+	if err != nil {
+		return nil, fmt.Errorf("peer %q is not a valid IP and port", hc.Peer)
+	}
+	if hc.Priority < 1 || hc.Priority > 255 {
+		return nil, errors.New("priority must be between 1 and 255")
+	}
+	for _, witness := range hc.Witnesses {
+		if _, _, err := net.SplitHostPort(witness); err != nil {
+			return nil, fmt.Errorf("witness %q is not a valid host and port", witness)
+		}
+	}
+
+	return &HA{
+		Listen:    listen,
+		Peer:      peer,
+		Priority:  uint8(hc.Priority),
+		Witnesses: hc.Witnesses,
+	}, nil
+}
@@ -27,9 +27,43 @@ type Router struct { //nolint:maligned
 
 	// Isolate constrains outgoing traffic to friends.
 	Isolate bool `json:"isolate,omitempty" yaml:"isolate,omitempty"`
+	// IsolateSchedule limits isolation to the given times, eg.
+	// "daily 22:00-06:00". See Service.Schedule for the format.
+	IsolateSchedule string `json:"isolateSchedule,omitempty" yaml:"isolateSchedule,omitempty"`
+
+	// PromptOutbound holds new outgoing connections to routers that are not
+	// friends until they are allowed or denied in the dashboard or via the API.
+	// Decisions are kept until the next restart. Add routers as friends to
+	// allow them permanently.
+	PromptOutbound bool `json:"promptOutbound,omitempty" yaml:"promptOutbound,omitempty"`
+	// PromptTimeout defines how long to wait for a decision. Defaults to 1m.
+	PromptTimeout string `json:"promptTimeout,omitempty" yaml:"promptTimeout,omitempty"`
+	// PromptTimeoutAction defines what happens when no decision was made in
+	// time: "deny" or "allow". The router is asked again after an hour.
+	// Defaults to "deny".
+	PromptTimeoutAction string `json:"promptTimeoutAction,omitempty" yaml:"promptTimeoutAction,omitempty"`
 
 	// Listen holds the peering URLs to listen on.
 	// URLs must have an IP address as host.
+	// Routers on the same host may peer over a UNIX socket, eg.
+	// "unix:///run/mycoria/peering.sock". These are never shared with others.
+	// The "bind" query parameter binds the listener to a network interface
+	// (by name) or local IP address, eg. "tcp://[::]:47369?bind=eth1".
+	// The "sockets" query parameter opens multiple listening sockets with
+	// SO_REUSEPORT (Linux only) to spread incoming connections over multiple
+	// accept loops, eg. "tcp://[::]:47369?sockets=auto" for one per CPU.
+	// TCP connections may be tuned with the "nodelay", "keepalive",
+	// "usertimeout", "rcvbuf", "sndbuf" and "congestion" query parameters,
+	// which are also supported on connect peering URLs,
+	// eg. "tcp://[::]:47369?keepalive=30s&usertimeout=2m&congestion=bbr".
+	// The "fec" query parameter adds forward error correction to frames sent
+	// on a link for lossy underlays, eg. "fec=8:2" sends two parity records
+	// for every eight frames. It is also supported on connect peering URLs.
+	// The "schedule" query parameter limits when a peering URL is used, eg.
+	// "tcp://[::]:47369?schedule=daily+22:00-06:00" to only relay at night.
+	// Use "%3B" to separate multiple entries, see Service.Schedule for the
+	// format. Links outside of the schedule are drained and closed. It is
+	// also supported on connect peering URLs.
 	Listen []string `json:"listen,omitempty" yaml:"listen,omitempty"`
 
 	// IANA holds a list of domains or IPs assigne by IANA through which the router can be reached.
@@ -39,6 +73,20 @@ type Router struct { //nolint:maligned
 	// tries to always hold a connection to.
 	Connect []string `json:"connect,omitempty" yaml:"connect,omitempty"`
 
+	// ConnectFrom binds all outgoing peering connections to the given network
+	// interface (by name) or local IP address. This is useful on multi-homed
+	// hosts where the default route is not the desired peering path.
+	// Peering URLs may override this with the "bind" query parameter.
+	// Binding to an interface is only supported on Linux.
+	ConnectFrom string `json:"connectFrom,omitempty" yaml:"connectFrom,omitempty"`
+
+	// Bonding allows multiple parallel links to the same peer, eg. over two
+	// ISPs. Frames are spread across the links by weight and fail over to the
+	// remaining links when one drops. Both routers must enable bonding.
+	// Set the weight of a link with the "weight" query parameter of the
+	// peering URL, eg. "tcp://192.0.2.1:47369?bind=eth1&weight=3".
+	Bonding bool `json:"bonding,omitempty" yaml:"bonding,omitempty"`
+
 	// AutoConnect specifies whether the router should automatically peer with
 	// other routers (based on live usage data) to improve network flow.
 	AutoConnect bool `json:"autoConnect,omitempty" yaml:"autoConnect,omitempty"`
@@ -52,6 +100,26 @@ type Router struct { //nolint:maligned
 	// Bootstrap holds peering URLs that the router uses to bootstrap to the network.
 	Bootstrap []string `json:"bootstrap,omitempty" yaml:"bootstrap,omitempty"`
 
+	// Status is a short status text that is announced to other routers and
+	// shown on their dashboards, eg. "maintenance Sunday 02:00 UTC".
+	// Maximum length is 200 characters.
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+
+	// Contact is a contact URI of the operator that is announced to other
+	// routers, eg. "mailto:ops@example.com".
+	Contact string `json:"contact,omitempty" yaml:"contact,omitempty"`
+
+	// Operator holds contact details of the operator (name, email, matrix,
+	// url, abuse) that are announced to other routers and shown with
+	// "mycoria whois". To verify the url, serve the router IPs, one per line,
+	// at "/.well-known/mycoria-routers" of its host.
+	Operator *m.OperatorInfo `json:"operator,omitempty" yaml:"operator,omitempty"`
+
+	// Groups holds the names of groups to join. Messages published to a
+	// group are delivered to all of its members. Group memberships are
+	// announced to other routers. See "mycoria group".
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+
 	// Stub runs the router in stub mode. It will not relay router announcements
 	// and will appear as a dead end to other routers.
 	// Forces the router to announce itself as a stub router.
@@ -64,12 +132,152 @@ type Router struct { //nolint:maligned
 	// Behavior will slightly change over time and also depends on other routers
 	// playing along - do not use for workarounds.
 	Lite bool `json:"lite,omitempty" yaml:"lite,omitempty"`
+
+	// Invisible runs the router in invisible mode. It never announces itself
+	// and does not relay announcements of others, so that it is not listed
+	// anywhere in the network. It uses a new privacy address on every start
+	// instead of the configured address.
+	// Use this for clients that only use services of others.
+	Invisible bool `json:"invisible,omitempty" yaml:"invisible,omitempty"`
+
+	// ScanThreshold defines after how many denied connections to different
+	// ports within the scan window a router is considered to be scanning and
+	// is blocked temporarily.
+	// Set to -1 to disable scan detection. Defaults to 10.
+	ScanThreshold int `json:"scanThreshold,omitempty" yaml:"scanThreshold,omitempty"`
+
+	// ScanWindow defines the time window in which denied connections are
+	// counted for scan detection. Defaults to 1m.
+	ScanWindow string `json:"scanWindow,omitempty" yaml:"scanWindow,omitempty"`
+
+	// ScanBlockDuration defines how long detected scanners are blocked.
+	// Defaults to 1h.
+	ScanBlockDuration string `json:"scanBlockDuration,omitempty" yaml:"scanBlockDuration,omitempty"`
+
+	// ShareScanBlocks reports detected scanners to friends and blocks
+	// scanners reported by friends, so that a scanner is blocked by all
+	// friends after it was detected by one of them.
+	// Friends need to enable this too.
+	ShareScanBlocks bool `json:"shareScanBlocks,omitempty" yaml:"shareScanBlocks,omitempty"`
+
+	// TTLExpiryNotifications enables sending a rate limited error to the
+	// source of frames that are dropped because their TTL expired while being
+	// relayed. This makes routing loops visible to the affected routers.
+	// Expired frames are always counted, see "mycoria route loops".
+	TTLExpiryNotifications bool `json:"ttlExpiryNotifications,omitempty" yaml:"ttlExpiryNotifications,omitempty"`
+
+	// RoutesPerDestination defines how many routes the routing table keeps per
+	// destination. Well connected relays may hold more routes for more path
+	// diversity. Defaults to 3, maximum is 16.
+	RoutesPerDestination int `json:"routesPerDestination,omitempty" yaml:"routesPerDestination,omitempty"`
+
+	// MaxAnnounceHops defines how many routers an announcement may pass,
+	// which should be larger than the diameter of the network. Every router
+	// adds its address and signature to forwarded announcements. Longer
+	// announcements are dropped and announcements at the limit are not
+	// forwarded anymore. Defaults to 32, maximum is 64.
+	MaxAnnounceHops int `json:"maxAnnounceHops,omitempty" yaml:"maxAnnounceHops,omitempty"`
+
+	// Discovery defines the strategies used to discover routes to
+	// destinations that are only reachable via the nearest known router,
+	// tried in the given order: "nearest" asks the known routers nearest to
+	// the destination, "recursive" follows the answers of well connected
+	// routers toward the destination and "friends" asks friends.
+	// Set to "none" to disable. Defaults to all, in this order.
+	Discovery []string `json:"discovery,omitempty" yaml:"discovery,omitempty"`
+
+	// RelayBudget limits the bandwidth used to relay frames of other routers,
+	// so that running a relay on a home connection does not degrade the
+	// traffic of this router. Frames of this router are always sent before
+	// relayed frames. Disabled if not set.
+	// Changed limits are applied without a restart. Enabling the budget only
+	// applies to new links.
+	RelayBudget *RelayBudgetConfig `json:"relayBudget,omitempty" yaml:"relayBudget,omitempty"`
+
+	// Peers holds route preferences for specific peers.
+	// Changes are applied to the running router without a restart.
+	Peers []PeerConfig `json:"peers,omitempty" yaml:"peers,omitempty"`
+
+	// AnnouncePolicy controls what the router announces about itself to
+	// which peers, eg. to not reveal anything to lite peers and to announce
+	// the full router info to friends only. Rules are checked in order and
+	// the first matching rule applies. Without a matching rule, the full
+	// announcement is sent. Only the own announcements are affected.
+	AnnouncePolicy []AnnounceRuleConfig `json:"announcePolicy,omitempty" yaml:"announcePolicy,omitempty"`
+
+	// RoutingDecisionSampling defines that one in N routed frames is recorded
+	// with the reason for the chosen route, see "mycoria route decisions".
+	// Set to -1 to disable. Defaults to 1000.
+	RoutingDecisionSampling int `json:"routingDecisionSampling,omitempty" yaml:"routingDecisionSampling,omitempty"`
+
+	// GeoIPDatabase is the path to a local MaxMind DB country database, eg.
+	// "/var/lib/GeoIP/GeoLite2-Country.mmdb". If set, the geo markers of peers
+	// are verified against the location of their underlay IP address when
+	// peering and large mismatches are flagged. No external services are used.
+	GeoIPDatabase string `json:"geoipDatabase,omitempty" yaml:"geoipDatabase,omitempty"`
+
+	// GeoMismatchPenalty defines the delay in milliseconds that is added to
+	// routes through peers flagged for a large geo marker mismatch, so that
+	// other routes are preferred. Zero only flags mismatches. Maximum is 10000.
+	GeoMismatchPenalty int `json:"geoMismatchPenalty,omitempty" yaml:"geoMismatchPenalty,omitempty"`
+
+	// MarkerTableSigners holds the IPs of routers that are trusted to sign
+	// updates of the country geo marker table. A signed table is loaded from
+	// "markers.cbor" next to the state file on start, if it is newer than the
+	// compiled in table. See "mycoria markers sign".
+	MarkerTableSigners []string `json:"markerTableSigners,omitempty" yaml:"markerTableSigners,omitempty"`
+}
+
+// PeerConfig holds the route preference for a peer.
+type PeerConfig struct {
+	IP string `json:"ip,omitempty" yaml:"ip,omitempty"`
+	// Weight biases route selection toward (positive) or away from (negative)
+	// routes through the peer as next hop. It is counted in hops, eg. a route
+	// through a peer with weight 2 is preferred over a route with up to two
+	// hops less through another peer, eg. to prefer a cheap fiber peer over a
+	// metered LTE peer. Routes to the peer itself are not affected.
+	// Must be between -8 and 8.
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// RelayBudgetConfig configures the bandwidth budget for relayed frames.
+// Bandwidths are given in bits or bytes per second, eg. "20Mbit" or "2.5MB".
+type RelayBudgetConfig struct {
+	// Upload is the upload bandwidth of the connection of the router.
+	// Relayed frames may use the share that is not kept for this router.
+	Upload string `json:"upload,omitempty" yaml:"upload,omitempty"`
+	// OwnShare is the share of the upload bandwidth in percent that is kept
+	// for the traffic of this router. Must be between 1 and 99.
+	// Defaults to 50.
+	OwnShare int `json:"ownShare,omitempty" yaml:"ownShare,omitempty"`
+	// PerPeer limits the bandwidth of relayed frames sent to a single peer.
+	PerPeer string `json:"perPeer,omitempty" yaml:"perPeer,omitempty"`
+}
+
+// AnnounceRuleConfig defines what the router announces about itself to some
+// peers.
+type AnnounceRuleConfig struct {
+	// Peers selects the peers: "all", "friends", "lite" or a router IP.
+	Peers string `json:"peers,omitempty" yaml:"peers,omitempty"`
+	// Announce defines what is announced:
+	// "full" announces the router with all router info, eg. services and
+	// listeners, to the whole network.
+	// "minimal" announces the router to the whole network without any router
+	// info, so that it is reachable, but does not reveal anything else.
+	// "peer" announces the router with all router info to the peer only and
+	// asks it to not forward the announcement. Peers that do not support
+	// this are not announced to.
+	// "none" does not announce the router at all. The peer still routes to
+	// the router directly.
+	Announce string `json:"announce,omitempty" yaml:"announce,omitempty"`
 }
 
 // FriendConfig is a trusted router in the network.
 type FriendConfig struct {
 	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 	IP   string `json:"ip,omitempty"   yaml:"ip,omitempty"`
+	// Key optionally pins the hex encoded public key of the friend.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
 }
 
 // ServiceConfig defines an endpoint other routers can send traffic to.
@@ -84,7 +292,39 @@ type ServiceConfig struct { //nolint:maligned
 	Friends bool     `json:"friends,omitempty" yaml:"friends,omitempty"`
 	For     []string `json:"for,omitempty"     yaml:"for,omitempty"`
 
+	// AccessRequests records denied access attempts as access requests, which
+	// may then be approved in the dashboard or via the control API.
+	AccessRequests bool `json:"accessRequests,omitempty" yaml:"accessRequests,omitempty"`
+
+	// NotifyDenied notifies the operator via the dashboard and the control API
+	// when access to the service is denied repeatedly. Attempts are aggregated
+	// by the country of the remote routers, which are not reported.
+	NotifyDenied bool `json:"notifyDenied,omitempty" yaml:"notifyDenied,omitempty"`
+
+	// Hidden silently drops all traffic to the service, unless the remote
+	// router first announced itself with a knock ping.
+	Hidden bool `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+
 	Advertise bool `json:"advertise,omitempty" yaml:"advertise,omitempty"`
+
+	// Schedule limits when the service is reachable, eg.
+	// "weekdays 09:00-17:00; sat 10:00-14:00". Times are in local time.
+	// Days are "daily", "weekdays", "weekends" or day names like "mon",
+	// separated by "," or as range like "mon-thu". Time ranges that end before
+	// they start continue on the next day.
+	Schedule string `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+}
+
+// APIListenerConfig is an additional listener for the API or the DNS server.
+type APIListenerConfig struct {
+	// Listen is the IP and port to listen on, eg. "192.168.1.1:80".
+	Listen string `json:"listen,omitempty" yaml:"listen,omitempty"`
+	// Service is "http" for the API and dashboard or "dns" for the DNS server.
+	// Defaults to "http".
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+	// Scope is "status" for read-only status pages or "admin" for full access.
+	// Only applies to "http". Defaults to "status".
+	Scope string `json:"scope,omitempty" yaml:"scope,omitempty"`
 }
 
 // System defines all configuration regarding the system.
@@ -92,11 +332,139 @@ type System struct { //nolint:maligned
 	TunName    string `json:"tunName,omitempty"    yaml:"tunName,omitempty"`
 	TunMTU     int    `json:"tunMTU,omitempty"     yaml:"tunMTU,omitempty"`
 	DisableTun bool   `json:"disableTun,omitempty" yaml:"disableTun,omitempty"`
+	// TunHelper is the socket path of the privileged tun helper, which
+	// creates and configures the tun device, so that the router can run
+	// without root or CAP_NET_ADMIN. Only supported on Linux.
+	TunHelper string `json:"tunHelper,omitempty" yaml:"tunHelper,omitempty"`
 
 	APIListen string `json:"apiListen,omitempty" yaml:"apiListen,omitempty"`
 	StatePath string `json:"statePath,omitempty" yaml:"statePath,omitempty"`
 
+	// APIListeners exposes the API or the DNS server on additional addresses,
+	// eg. on the LAN address of a router appliance. The API is only exposed
+	// with the status scope, unless admin is configured explicitly.
+	APIListeners []APIListenerConfig `json:"apiListeners,omitempty" yaml:"apiListeners,omitempty"`
+
+	// DNSCacheTTL defines how long domain mappings are cached, eg. "10m".
+	DNSCacheTTL string `json:"dnsCacheTTL,omitempty" yaml:"dnsCacheTTL,omitempty"`
+	// DNSCacheSize defines how many domain mappings are cached.
+	// A negative value disables the cache.
+	DNSCacheSize int `json:"dnsCacheSize,omitempty" yaml:"dnsCacheSize,omitempty"`
+	// DNSRateLimit defines how many DNS queries per second a client may send.
+	// A tenth of that is allowed for unknown names, which limits random
+	// subdomain floods. A negative value disables the rate limit.
+	DNSRateLimit int `json:"dnsRateLimit,omitempty" yaml:"dnsRateLimit,omitempty"`
+	// DNSResolver defines how names are resolved: "local" only uses the
+	// config, friends and domain mappings. "mesh" additionally asks routers in
+	// the region of unknown names and friends. The region is taken from a
+	// country code label, eg. "wiki.de.myco". Defaults to "local".
+	DNSResolver string `json:"dnsResolver,omitempty" yaml:"dnsResolver,omitempty"`
+
+	// LogLevels sets the log levels of modules, eg. "router: debug", so that
+	// a single module can be investigated without global debug logging.
+	// Modules are matched by their package or type name, eg. "router",
+	// "peering", "dns" or "switch". Others use the global log level.
+	LogLevels map[string]string `json:"logLevels,omitempty" yaml:"logLevels,omitempty"`
+
 	DisableChromiumWorkaround bool `json:"disableChromiumWorkaround,omitempty" yaml:"disableChromiumWorkaround,omitempty"`
+
+	// DisableMSSClamping disables lowering the maximum segment size of TCP
+	// connections to the path MTU of the destination.
+	DisableMSSClamping bool `json:"disableMSSClamping,omitempty" yaml:"disableMSSClamping,omitempty"`
+
+	// WatchdogRecovery enables restarting the data plane (peering, switch and
+	// router), when one of its workers is stuck. Stuck workers are always
+	// reported, even if recovery is disabled.
+	WatchdogRecovery bool `json:"watchdogRecovery,omitempty" yaml:"watchdogRecovery,omitempty"`
+
+	// DiscoverServices proposes listening sockets of the host as services in
+	// the dashboard. Proposed services must still be added to the config.
+	// Only supported on Linux.
+	DiscoverServices bool `json:"discoverServices,omitempty" yaml:"discoverServices,omitempty"`
+
+	// UpdateManifestURL is the URL of the signed release manifest that is
+	// checked for updates. HTTPS is required, except for URLs with a router
+	// IP as host, which are fetched over Mycoria. Disabled if empty.
+	UpdateManifestURL string `json:"updateManifestURL,omitempty" yaml:"updateManifestURL,omitempty"`
+	// UpdateSigners holds the IPs of routers that are trusted to sign release
+	// manifests. See "mycoria update sign".
+	UpdateSigners []string `json:"updateSigners,omitempty" yaml:"updateSigners,omitempty"`
+	// UpdateCheckInterval defines how often to check for updates.
+	// Defaults to 24h.
+	UpdateCheckInterval string `json:"updateCheckInterval,omitempty" yaml:"updateCheckInterval,omitempty"`
+	// AutoUpdate installs updates when they are found and restarts the
+	// router. Otherwise, updates are only reported and may be installed via
+	// the API.
+	AutoUpdate bool `json:"autoUpdate,omitempty" yaml:"autoUpdate,omitempty"`
+
+	// HA runs this router as part of an active-standby pair of two routers
+	// that share the same identity. Disabled if not set.
+	HA *HAConfig `json:"ha,omitempty" yaml:"ha,omitempty"`
+
+	// Notifications sends notifications about selected events to the
+	// desktop or to a webhook. Disabled if not set.
+	Notifications *NotificationsConfig `json:"notifications,omitempty" yaml:"notifications,omitempty"`
+}
+
+// NotificationsConfig configures notifications about events.
+type NotificationsConfig struct {
+	// Events selects the events to notify about: "new-inbound" for the first
+	// connection of a router since start, "denied" for repeatedly denied
+	// access to services with notifyDenied and "peer-down" for lost peers.
+	// Defaults to all events.
+	Events []string `json:"events,omitempty" yaml:"events,omitempty"`
+	// Desktop shows desktop notifications via DBus, using notify-send.
+	// Only supported on Linux and only if the router runs in the desktop
+	// session of the user.
+	Desktop bool `json:"desktop,omitempty" yaml:"desktop,omitempty"`
+	// Webhook is a URL notifications are posted to as JSON.
+	Webhook string `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	// Ntfy is the URL of an ntfy topic notifications are published to,
+	// eg. "https://ntfy.sh/my-router".
+	Ntfy string `json:"ntfy,omitempty" yaml:"ntfy,omitempty"`
+
+	// Alerts are rules that are evaluated continuously. Notifications are
+	// sent when an alert starts and when it is resolved, independent of the
+	// selected events.
+	Alerts []AlertConfig `json:"alerts,omitempty" yaml:"alerts,omitempty"`
+}
+
+// AlertConfig is an alert rule. Exactly one condition must be set.
+type AlertConfig struct {
+	// Name identifies the alert in notifications.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Unreachable alerts if the router, given as friend name or address,
+	// is neither a peer nor has a route in the routing table.
+	Unreachable string `json:"unreachable,omitempty" yaml:"unreachable,omitempty"`
+	// PeersBelow alerts if there are fewer peers than defined.
+	// Set to 1 to alert when the last peer link drops.
+	PeersBelow int `json:"peersBelow,omitempty" yaml:"peersBelow,omitempty"`
+
+	// For defines how long the condition must hold before alerting.
+	// Firing alerts are resolved when the condition was cleared for the same
+	// duration, but at least for 1m. Defaults to 1m.
+	For string `json:"for,omitempty" yaml:"for,omitempty"`
+}
+
+// HAConfig configures an active-standby high availability pair.
+// Both routers must have the same address, but a different priority.
+type HAConfig struct {
+	// Listen is the IP and port to exchange heartbeats and state with the
+	// other router on, eg. on a direct link.
+	Listen string `json:"listen,omitempty" yaml:"listen,omitempty"`
+	// Peer is the IP and port the other router listens on.
+	Peer string `json:"peer,omitempty" yaml:"peer,omitempty"`
+	// Priority decides which router becomes active, if both start at the
+	// same time. Must be between 1 and 255.
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// Witnesses are the endpoints ("host:port") of witnesses started with
+	// "mycoria ha-witness". A majority of them must grant a lease for the
+	// router to become or stay active, and they only grant it to one router
+	// of the pair at a time. This protects against both routers being
+	// active, when only the link between them fails. Run them on hosts both
+	// routers reach over different paths.
+	Witnesses []string `json:"witnesses,omitempty" yaml:"witnesses,omitempty"`
 }
 
 // Clone returns a full copy the store.
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestAllowServiceAccess(t *testing.T) {
+	t.Parallel()
+
+	c := MakeTestConfig(Store{
+		ServiceConfigs: []ServiceConfig{
+			{Name: "web", URL: "http://:80", Public: true},
+			{Name: "ssh", URL: "tcp://:22", Friends: true},
+		},
+	})
+	remote := netip.MustParseAddr("fd12:3456::1")
+	services := c.GetServices()
+	serviceConfigs := c.ServiceConfigs
+
+	// Allow access.
+	require.NoError(t, c.AllowServiceAccess("ssh", remote))
+	require.NoError(t, c.AllowServiceAccess("ssh", remote))
+	assert.True(t, c.CheckInboundTrafficPolicy(6, 22, remote))
+	svc, ok := c.GetService("ssh")
+	require.True(t, ok)
+	assert.Equal(t, []netip.Addr{remote}, svc.For)
+	assert.Equal(t, []string{remote.String()}, c.ServiceConfigs[1].For)
+
+	// Previously returned services are not modified.
+	assert.Empty(t, services[1].For)
+	assert.Empty(t, serviceConfigs[1].For)
+
+	// Public and unknown services.
+	require.Error(t, c.AllowServiceAccess("web", remote))
+	require.Error(t, c.AllowServiceAccess("unknown", remote))
+}
+
+func TestSetClock(t *testing.T) {
+	t.Parallel()
+
+	c := MakeTestConfig(Store{})
+	assert.Equal(t, m.SystemClock, c.Clock())
+
+	// A custom clock requires development mode.
+	clock := m.NewVirtualClock(time.Now())
+	require.Error(t, c.SetClock(clock))
+	assert.Equal(t, m.SystemClock, c.Clock())
+	c.SetDevMode(true)
+	require.NoError(t, c.SetClock(clock))
+	assert.Same(t, clock, c.Clock())
+}
+
+func TestPeerWeights(t *testing.T) {
+	t.Parallel()
+
+	fiber := netip.MustParseAddr("fd12:3456::1")
+	metered := netip.MustParseAddr("fd12:3456::2")
+	c := MakeTestConfig(Store{
+		Router: Router{Peers: []PeerConfig{
+			{IP: fiber.String(), Weight: 2},
+			{IP: metered.String(), Weight: -2},
+		}},
+	})
+	assert.Equal(t, map[netip.Addr]int{fiber: 2, metered: -2}, c.GetPeerWeights())
+	assert.Equal(t, -2, c.GetPeerWeight(metered))
+
+	// Duplicate peers are rejected.
+	_, err := Store{Router: Router{Peers: []PeerConfig{
+		{IP: fiber.String(), Weight: 2},
+		{IP: fiber.String(), Weight: -2},
+	}}}.parse(true)
+	require.Error(t, err)
+
+	// Changed weights are applied.
+	changed := MakeTestConfig(Store{
+		Router: Router{Peers: []PeerConfig{
+			{IP: fiber.String(), Weight: 1},
+		}},
+	})
+	assert.False(t, c.SyncPeerWeights(c))
+	assert.True(t, c.SyncPeerWeights(changed))
+	assert.Equal(t, map[netip.Addr]int{fiber: 1}, c.GetPeerWeights())
+	assert.Equal(t, changed.Router.Peers, c.Router.Peers)
+	assert.Zero(t, c.GetPeerWeight(metered))
+}
+
+func TestSyncRelayBudget(t *testing.T) {
+	t.Parallel()
+
+	c := MakeTestConfig(Store{})
+	assert.Nil(t, c.GetRelayBudget())
+
+	changed := MakeTestConfig(Store{
+		Router: Router{RelayBudget: &RelayBudgetConfig{PerPeer: "8Mbit"}},
+	})
+	c.SyncRelayBudget(changed)
+	assert.Equal(t, &RelayBudget{PerPeer: 1_000_000}, c.GetRelayBudget())
+	assert.Equal(t, changed.Router.RelayBudget, c.Router.RelayBudget)
+}
+
+func TestSyncStub(t *testing.T) {
+	t.Parallel()
+
+	c := MakeTestConfig(Store{})
+	assert.False(t, c.IsStub())
+
+	changed := MakeTestConfig(Store{Router: Router{Stub: true}})
+	assert.True(t, c.SyncStub(changed))
+	assert.True(t, c.IsStub())
+	assert.False(t, c.SyncStub(changed), "unchanged setting must not be reported")
+}
+
+func TestRoutesPerDestination(t *testing.T) {
+	t.Parallel()
+
+	for rpd, ok := range map[int]bool{
+		-1:                          false,
+		0:                           true,
+		1:                           true,
+		MaxRoutesPerDestination:     true,
+		MaxRoutesPerDestination + 1: false,
+	} {
+		_, err := Store{Router: Router{RoutesPerDestination: rpd}}.parse(true)
+		if ok {
+			assert.NoError(t, err, rpd)
+		} else {
+			assert.ErrorContains(t, err, "between 1 and 16, or 0 for the default", rpd)
+		}
+	}
+}
+
+func TestGetInfoFromURL(t *testing.T) {
+	t.Parallel()
+
+	for svcURL, expected := range map[string][]string{
+		"tcp://:22":             {MakePolicyKey(6, 22)},
+		"udp://:27015":          {MakePolicyKey(17, 27015)},
+		"http://example.myco":   {MakePolicyKey(6, 80), MakePolicyKey(17, 80)},
+		"https://:8443":         {MakePolicyKey(6, 8443), MakePolicyKey(17, 8443)},
+		"icmp6://example.myco/": {MakePolicyKey(58, 0)},
+	} {
+		policyKeys, _, err := getInfoFromURL(svcURL)
+		require.NoError(t, err, svcURL)
+		assert.Equal(t, expected, policyKeys, svcURL)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	t.Parallel()
+
+	addr, _, err := m.GenerateRoutableAddress(context.Background(), []netip.Prefix{m.MustPrefix([]byte{m.BaseNet, m.TypeRoutingAddress | m.ContinentEurope}, 12)})
+	require.NoError(t, err)
+
+	c := MakeTestConfig(Store{Router: Router{Address: addr.Store()}})
+	identity, err := c.Identity()
+	require.NoError(t, err)
+	assert.Equal(t, addr.IP, identity.IP)
+
+	// Invisible routers do not run with the configured identity.
+	c = MakeTestConfig(Store{Router: Router{Address: addr.Store(), Invisible: true}})
+	_, err = c.Identity()
+	assert.ErrorIs(t, err, ErrInvisibleIdentity)
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ConfinementKind is the kind of a confinement rule.
+type ConfinementKind string
+
+// Confinement rule kinds.
+const (
+	ConfinementFile       ConfinementKind = "file"
+	ConfinementCapability ConfinementKind = "capability"
+	ConfinementNetlink    ConfinementKind = "netlink"
+	ConfinementNetwork    ConfinementKind = "network"
+)
+
+// ConfinementRule is an operation the router needs to be allowed by system
+// confinement, such as AppArmor or SELinux.
+type ConfinementRule struct {
+	Kind ConfinementKind `json:"kind"`
+	// Target is the path, capability, netlink family or network endpoint.
+	Target string `json:"target"`
+	// Access is "r" or "rw" for files, and "bind" or "connect" for network
+	// endpoints, which use the "tcp" or "udp" protocol. For unix sockets, the
+	// socket type is added, eg. "connect seqpacket".
+	Access string `json:"access,omitempty"`
+	Reason string `json:"reason"`
+	// Optional rules may be denied, which only disables the feature.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Confinement returns all operations the router needs with this config on
+// Linux. The executable is the path of the router binary.
+func (c *Config) Confinement(executable string) []ConfinementRule {
+	var rules []ConfinementRule
+	add := func(kind ConfinementKind, target, access, reason string, optional bool) {
+		rules = append(rules, ConfinementRule{
+			Kind:     kind,
+			Target:   target,
+			Access:   access,
+			Reason:   reason,
+			Optional: optional,
+		})
+	}
+
+	// Files.
+	if executable != "" {
+		add(ConfinementFile, executable, "r", "run router", false)
+		if c.System.UpdateManifestURL != "" {
+			add(ConfinementFile, executable, "rw", "install software updates", true)
+		}
+	}
+	if c.filename != "" {
+		filename := c.filename
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+		add(ConfinementFile, filename, "r", "load config", false)
+		add(ConfinementFile, filename, "rw", "save config changes from the dashboard", true)
+	}
+	if c.System.StatePath != "" {
+		stateDir := filepath.Dir(c.System.StatePath)
+		add(ConfinementFile, c.System.StatePath, "rw", "save router state", false)
+		add(ConfinementFile, filepath.Join(stateDir, MarkerTableFilename), "r", "load geo marker table", true)
+		add(ConfinementFile, filepath.Join(stateDir, "crashes")+"/", "rw", "write crash reports", true)
+		add(ConfinementFile, stateDir+"/", "rw", "save onboarding status", true)
+	}
+	if c.Router.GeoIPDatabase != "" {
+		add(ConfinementFile, c.Router.GeoIPDatabase, "r", "verify geo markers of peers", true)
+	}
+	add(ConfinementFile, "/etc/resolv.conf", "r", "resolve domains of peering URLs", true)
+	add(ConfinementFile, "/etc/hosts", "r", "resolve domains of peering URLs", true)
+	add(ConfinementFile, "/proc/self/fd/", "r", "monitor open file descriptors", true)
+	add(ConfinementFile, "/proc/self/cgroup", "r", "detect resource limits", true)
+	add(ConfinementFile, "/sys/fs/cgroup/", "r", "detect resource limits", true)
+
+	// Tun device.
+	switch {
+	case c.System.DisableTun:
+	case c.System.TunHelper != "":
+		add(ConfinementFile, c.System.TunHelper, "rw", "get tun device from tun helper", false)
+		add(ConfinementNetwork, c.System.TunHelper, "connect seqpacket", "get tun device from tun helper", false)
+	default:
+		add(ConfinementCapability, "net_admin", "", "configure tun device", false)
+		add(ConfinementFile, "/dev/net/tun", "rw", "create tun device", false)
+		add(ConfinementNetlink, "route", "", "configure tun device", false)
+		add(ConfinementFile, "/proc/sys/net/ipv6/conf/all/disable_ipv6", "r", "check if IPv6 is enabled", true)
+		add(ConfinementFile, "/proc/net/if_inet6", "r", "check if IPv6 is enabled", true)
+	}
+	if c.System.DiscoverServices {
+		add(ConfinementNetlink, "sock_diag", "", "discover services", true)
+	}
+
+	// Network.
+	privilegedPorts := false
+	peeringURLs, _ := m.ParsePeeringURLs(c.Router.Listen)
+	for _, u := range peeringURLs {
+		switch u.Protocol {
+		case "unix":
+			add(ConfinementFile, u.Path, "rw", "listen for peers", false)
+			add(ConfinementNetwork, u.Path, "bind stream", "listen for peers", false)
+		default:
+			add(ConfinementNetwork, fmt.Sprintf("tcp :%d", u.Port), "bind", "listen for peers", false)
+			privilegedPorts = privilegedPorts || u.Port < 1024
+		}
+	}
+	add(ConfinementNetwork, "tcp", "connect", "connect to peers", false)
+	if c.APIListen.IsValid() {
+		add(ConfinementNetwork, "tcp "+c.APIListen.String(), "bind", "serve API", false)
+		privilegedPorts = privilegedPorts || c.APIListen.Port() < 1024
+	}
+	for _, ln := range c.APIListeners {
+		proto := "tcp"
+		if ln.Service == APIServiceDNS {
+			proto = "udp"
+		}
+		add(ConfinementNetwork, proto+" "+ln.Addr.String(), "bind", "serve API on additional address", false)
+		privilegedPorts = privilegedPorts || ln.Addr.Port() < 1024
+	}
+	if c.HA != nil {
+		add(ConfinementNetwork, "udp "+c.HA.Listen.String(), "bind", "exchange high availability heartbeats", false)
+		add(ConfinementNetwork, "tcp "+c.HA.Listen.String(), "bind", "receive replicated state", false)
+		add(ConfinementNetwork, "udp "+c.HA.Peer.String(), "connect", "send high availability heartbeats", false)
+		privilegedPorts = privilegedPorts || c.HA.Listen.Port() < 1024
+	}
+	if privilegedPorts {
+		add(ConfinementCapability, "net_bind_service", "", "listen on ports below 1024", false)
+	}
+	if c.System.UpdateManifestURL != "" {
+		add(ConfinementNetwork, "tcp :443", "connect", "check for software updates", true)
+	}
+
+	return rules
+}
@@ -1,6 +1,9 @@
 package config
 
-import "net/netip"
+import (
+	"net/netip"
+	"time"
+)
 
 // DefaultPortNumber is the default port number used by Mycoria.
 const DefaultPortNumber = 47369 // M(1+3), Y(2+5), C(3), O(1+5), R(1+8); 0xB909
@@ -16,3 +19,96 @@ var DefaultDotTLD = ".myco"
 
 // DefaultTLDBetweenDots is the default TLD that Mycoria uses, but between dots.
 var DefaultTLDBetweenDots = ".myco."
+
+// Default scan detection settings.
+const (
+	DefaultScanThreshold     = 10
+	DefaultScanWindow        = 1 * time.Minute
+	DefaultScanBlockDuration = 1 * time.Hour
+)
+
+// DefaultPromptTimeout is the default time to wait for a decision on a new
+// outgoing connection.
+const DefaultPromptTimeout = 1 * time.Minute
+
+// Default DNS mapping cache settings.
+const (
+	DefaultDNSCacheTTL  = 10 * time.Minute
+	DefaultDNSCacheSize = 1024
+)
+
+// DefaultDNSRateLimit is the default amount of DNS queries per second a
+// client may send. Clients may send a tenth of that for unknown names.
+const DefaultDNSRateLimit = 100
+
+// DNS resolver modes.
+const (
+	DNSResolverLocal = "local"
+	DNSResolverMesh  = "mesh"
+)
+
+// Default mesh resolver settings.
+const (
+	// DefaultDNSMeshTimeout defines how long to wait for answers of other
+	// routers when resolving a name over the mesh.
+	DefaultDNSMeshTimeout = 2 * time.Second
+	// DefaultDNSMeshCacheTTL defines how long names resolved over the mesh
+	// are cached.
+	DefaultDNSMeshCacheTTL = 10 * time.Minute
+)
+
+// Notification events.
+const (
+	NotifyEventNewInbound = "new-inbound"
+	NotifyEventDenied     = "denied"
+	NotifyEventPeerDown   = "peer-down"
+
+	// Alert events are sent for configured alerts and cannot be selected.
+	NotifyEventAlert         = "alert"
+	NotifyEventAlertResolved = "alert-resolved"
+)
+
+// DefaultAlertFor defines how long the condition of an alert must hold by
+// default before alerting.
+const DefaultAlertFor = time.Minute
+
+// DefaultRoutingDecisionSampling defines that one in N routed frames is
+// recorded by default.
+const DefaultRoutingDecisionSampling = 1000
+
+// MarkerTableFilename is the filename of the signed country geo marker table
+// in the state directory.
+const MarkerTableFilename = "markers.cbor"
+
+// Default software update settings.
+const (
+	DefaultUpdateCheckInterval = 24 * time.Hour
+	MinUpdateCheckInterval     = 1 * time.Hour
+)
+
+// DefaultPerfPort is the default port of the throughput test responder.
+const DefaultPerfPort = 5201
+
+// MaxRoutesPerDestination is the maximum amount of routes per destination.
+const MaxRoutesPerDestination = 16
+
+// Announcement hop limits.
+const (
+	DefaultMaxAnnounceHops = 32
+	MaxAnnounceHops        = 64
+)
+
+// Route discovery strategies.
+const (
+	DiscoveryNearest   = "nearest"
+	DiscoveryRecursive = "recursive"
+	DiscoveryFriends   = "friends"
+	DiscoveryNone      = "none"
+)
+
+// DefaultDiscoveryStrategies are the route discovery strategies used by
+// default, in order.
+var DefaultDiscoveryStrategies = []string{DiscoveryNearest, DiscoveryRecursive, DiscoveryFriends}
+
+// MaxPeerWeight is the maximum absolute route preference weight of a peer.
+const MaxPeerWeight = 8
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// Friend errors.
+var (
+	ErrFriendExists   = errors.New("friend already exists")
+	ErrFriendNotFound = errors.New("friend not found")
+)
+
+// GetFriends returns a copy of all friends.
+func (c *Config) GetFriends() []Friend {
+	c.friendsLock.RLock()
+	defer c.friendsLock.RUnlock()
+
+	return slices.Clone[[]Friend](c.friends)
+}
+
+// GetFriendByName returns the friend with the given name.
+func (c *Config) GetFriendByName(name string) (friend Friend, ok bool) {
+	c.friendsLock.RLock()
+	defer c.friendsLock.RUnlock()
+
+	friend, ok = c.friendsByName[name]
+	return
+}
+
+// GetFriendByIP returns the friend with the given IP.
+func (c *Config) GetFriendByIP(ip netip.Addr) (friend Friend, ok bool) {
+	c.friendsLock.RLock()
+	defer c.friendsLock.RUnlock()
+
+	friend, ok = c.friendsByIP[ip]
+	return
+}
+
+// AddFriend adds a friend to the running config. The friend is immediately
+// resolvable via DNS and allowed to access services shared with friends.
+// The change is reflected in the config store, but is not saved to disk.
+// If the friend's address is set, its key is pinned.
+func (c *Config) AddFriend(friend Friend) error {
+	name, ip := friend.Name, friend.IP
+
+	// Check friend.
+	if err := CheckFriendName(name); err != nil {
+		return err
+	}
+	if err := checkFriendIP(ip); err != nil {
+		return err
+	}
+	friendConfig := FriendConfig{
+		Name: name,
+		IP:   ip.String(),
+	}
+	if friend.Address != nil {
+		if friend.Address.IP != ip {
+			return errors.New("pinned address does not match IP")
+		}
+		if friend.Address.Hash != m.AddressDigestAlg || friend.Address.Type != friendKeyType {
+			return errors.New("pinned address uses unsupported key type")
+		}
+		if err := friend.Address.VerifyAddress(); err != nil {
+			return err
+		}
+		friendConfig.Key = hex.EncodeToString(friend.Address.PublicKey)
+	}
+
+	c.friendsLock.Lock()
+	defer c.friendsLock.Unlock()
+
+	// Check for duplicates.
+	if _, ok := c.friendsByName[name]; ok {
+		return ErrFriendExists
+	}
+	if existing, ok := c.friendsByIP[ip]; ok {
+		return fmt.Errorf("%w: IP is already used by %s", ErrFriendExists, existing.Name)
+	}
+
+	// Add friend.
+	c.friends = append(slices.Clip[[]Friend](c.friends), friend)
+	c.friendsByName[friend.Name] = friend
+	c.friendsByIP[friend.IP] = friend
+	c.FriendConfigs = append(slices.Clip[[]FriendConfig](c.FriendConfigs), friendConfig)
+
+	// Allow friend to access friend services.
+	c.inPolicyLock.Lock()
+	defer c.inPolicyLock.Unlock()
+
+	for _, svc := range c.Services {
+		if !svc.Friends {
+			continue
+		}
+		for _, policyKey := range svc.policyKeys {
+			if ipPolicy := c.inPolicy[policyKey]; ipPolicy != nil {
+				ipPolicy[ip] = struct{}{}
+			}
+		}
+	}
+
+	return nil
+}
+
+// RemoveFriend removes the friend with the given name from the running config.
+// The friend immediately loses access to services shared with friends, unless
+// the service explicitly allows the friend's IP.
+// The change is reflected in the config store, but is not saved to disk.
+func (c *Config) RemoveFriend(name string) error {
+	c.friendsLock.Lock()
+	defer c.friendsLock.Unlock()
+
+	// Remove friend.
+	friend, ok := c.friendsByName[name]
+	if !ok {
+		return ErrFriendNotFound
+	}
+	c.friends = slices.DeleteFunc[[]Friend](slices.Clone[[]Friend](c.friends), func(f Friend) bool {
+		return f.Name == name
+	})
+	delete(c.friendsByName, friend.Name)
+	delete(c.friendsByIP, friend.IP)
+	c.FriendConfigs = slices.DeleteFunc[[]FriendConfig](slices.Clone[[]FriendConfig](c.FriendConfigs), func(fc FriendConfig) bool {
+		return fc.Name == name
+	})
+
+	// Revoke access to friend services.
+	c.inPolicyLock.Lock()
+	defer c.inPolicyLock.Unlock()
+
+	for _, svc := range c.Services {
+		if !svc.Friends || slices.Contains[[]netip.Addr, netip.Addr](svc.For, friend.IP) {
+			continue
+		}
+		for _, policyKey := range svc.policyKeys {
+			if ipPolicy := c.inPolicy[policyKey]; ipPolicy != nil {
+				delete(ipPolicy, friend.IP)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SyncFriends adds and removes friends of the running config to match the
+// given friends. It returns the number of added and removed friends.
+func (c *Config) SyncFriends(friends []Friend) (added, removed int, err error) {
+	// Remove friends that are missing or changed.
+	for _, existing := range c.GetFriends() {
+		if !slices.ContainsFunc[[]Friend, Friend](friends, existing.Equal) {
+			if err := c.RemoveFriend(existing.Name); err != nil {
+				return added, removed, fmt.Errorf("remove friend %s: %w", existing.Name, err)
+			}
+			removed++
+		}
+	}
+
+	// Add new friends.
+	for _, friend := range friends {
+		if _, ok := c.GetFriendByName(friend.Name); ok {
+			continue
+		}
+		if err := c.AddFriend(friend); err != nil {
+			return added, removed, fmt.Errorf("add friend %s: %w", friend.Name, err)
+		}
+		added++
+	}
+
+	return added, removed, nil
+}
+
+// Equal returns whether the given friend is the same, including the pinned key.
+func (f Friend) Equal(other Friend) bool {
+	switch {
+	case f.Name != other.Name || f.IP != other.IP:
+		return false
+	case f.Address == nil || other.Address == nil:
+		return f.Address == other.Address
+	default:
+		return f.Address.PublicKey.Equal(other.Address.PublicKey)
+	}
+}
+
+// CheckFriendName checks if the given name is valid for a new friend.
+// Friends are resolvable at <name>.myco, so the name must be a valid lowercase
+// domain label.
+func CheckFriendName(name string) error {
+	if name == "" {
+		return errors.New("friend name must not be empty")
+	}
+	if strings.Contains(name, ".") {
+		return errors.New("friend name must not contain dots")
+	}
+	cleaned, valid := CleanDomain(name + DefaultDotTLD)
+	if !valid || cleaned != name+DefaultDotTLD {
+		return errors.New("friend name must be a valid lowercase domain label")
+	}
+	return nil
+}
+
+// friendKeyType is the only supported key type for pinned friend keys.
+const friendKeyType = "Ed25519"
+
+// ParseFriendKey parses the hex encoded public key of the friend with the
+// given IP and returns the pinned address.
+func ParseFriendKey(ip netip.Addr, key string) (*m.PublicAddress, error) {
+	pubKey, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(pubKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid key size: %d (should be %d)", len(pubKey), ed25519.PublicKeySize)
+	}
+
+	addr := &m.PublicAddress{
+		IP:        ip,
+		Hash:      m.AddressDigestAlg,
+		Type:      friendKeyType,
+		PublicKey: pubKey,
+	}
+	if err := addr.VerifyAddress(); err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+func checkFriendIP(ip netip.Addr) error {
+	switch m.GetAddressType(ip) { //nolint:exhaustive
+	case m.TypeGeoMarked,
+		m.TypeRoaming,
+		m.TypeOrganization,
+		m.TypeAnycast,
+		m.TypeExperiment:
+		// Address in accepted range.
+		return nil
+	default:
+		return errors.New("must be in acceptable routable range")
+	}
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// meshSecretSize defines the size of generated universe secrets.
+const meshSecretSize = 32
+
+// MeshBundle holds everything needed to set up a private mesh of a few
+// routers, eg. for a lab: The universe, its secret and the identities and
+// peering URLs of all nodes. Every node creates its config from the same
+// bundle, so the resulting configs only depend on the bundle.
+// The bundle holds the private keys of all nodes and must be kept secret.
+type MeshBundle struct {
+	Universe       string     `json:"universe"       yaml:"universe"`
+	UniverseSecret string     `json:"universeSecret" yaml:"universeSecret"`
+	Nodes          []MeshNode `json:"nodes"          yaml:"nodes"`
+}
+
+// MeshNode is a router of a mesh bundle.
+type MeshNode struct {
+	// Name is used as the friend name on the other nodes.
+	Name string `json:"name" yaml:"name"`
+	// PeeringURL is the URL the node listens on and the other nodes connect
+	// to, eg. "tcp://192.0.2.1:47369".
+	PeeringURL string           `json:"peeringURL" yaml:"peeringURL"`
+	Address    m.AddressStorage `json:"address"    yaml:"address"`
+}
+
+// NewMeshUniverseSecret returns a new random universe secret.
+func NewMeshUniverseSecret() (string, error) {
+	secret := make([]byte, meshSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Check checks if the bundle is valid.
+func (b *MeshBundle) Check() error {
+	switch {
+	case b.Universe == "":
+		return errors.New("universe must not be empty")
+	case b.UniverseSecret == "":
+		return errors.New("universe secret must not be empty")
+	case len(b.Nodes) < 2:
+		return errors.New("mesh needs at least two nodes")
+	}
+
+	names := make(map[string]struct{}, len(b.Nodes))
+	ips := make(map[netip.Addr]struct{}, len(b.Nodes))
+	for _, node := range b.Nodes {
+		if err := CheckFriendName(node.Name); err != nil {
+			return fmt.Errorf("node %q: %w", node.Name, err)
+		}
+		if _, ok := names[node.Name]; ok {
+			return fmt.Errorf("node %q is defined multiple times", node.Name)
+		}
+		names[node.Name] = struct{}{}
+
+		if _, err := m.ParsePeeringURL(node.PeeringURL); err != nil {
+			return fmt.Errorf("node %q: invalid peering URL %q: %w", node.Name, node.PeeringURL, err)
+		}
+		addr, err := m.AddressFromStorage(node.Address)
+		if err != nil {
+			return fmt.Errorf("node %q: invalid address: %w", node.Name, err)
+		}
+		if _, ok := ips[addr.IP]; ok {
+			return fmt.Errorf("node %q: address %s is used multiple times", node.Name, addr.IP)
+		}
+		ips[addr.IP] = struct{}{}
+	}
+
+	return nil
+}
+
+// NodeConfig returns the config store for the node with the given name.
+// The node listens on the port of its peering URL, bootstraps to all other
+// nodes and has them as friends with pinned keys.
+func (b *MeshBundle) NodeConfig(name string) (*Store, error) {
+	if err := b.Check(); err != nil {
+		return nil, err
+	}
+
+	store := &Store{
+		Router: Router{
+			Universe:       b.Universe,
+			UniverseSecret: b.UniverseSecret,
+			AutoConnect:    true,
+		},
+		ServiceConfigs: []ServiceConfig{{
+			Name:   "ping",
+			URL:    "icmp6:",
+			Public: true,
+		}},
+	}
+	var found bool
+	for _, node := range b.Nodes {
+		// Errors were checked above.
+		peeringURL, _ := m.ParsePeeringURL(node.PeeringURL)
+		addr, _ := m.AddressFromStorage(node.Address)
+
+		if node.Name == name {
+			found = true
+			store.Router.Address = node.Address
+			store.Router.Listen = []string{meshListenURL(peeringURL)}
+			continue
+		}
+
+		store.Router.Bootstrap = append(store.Router.Bootstrap, node.PeeringURL)
+		store.FriendConfigs = append(store.FriendConfigs, FriendConfig{
+			Name: node.Name,
+			IP:   addr.IP.String(),
+			Key:  hex.EncodeToString(addr.PublicKey),
+		})
+	}
+	if !found {
+		return nil, fmt.Errorf("node %q is not part of the mesh", name)
+	}
+
+	return store, nil
+}
+
+// meshListenURL returns the URL to listen on for the given peering URL:
+// The protocol and port on all interfaces.
+func meshListenURL(u *m.PeeringURL) string {
+	if u.IsLocal() {
+		return u.String()
+	}
+	return fmt.Sprintf("%s:%d", u.Protocol, u.Port)
+}
+
+// LoadMeshBundle loads a mesh bundle from the given file.
+func LoadMeshBundle(filename string) (*MeshBundle, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read mesh bundle at %s: %w", filename, err)
+	}
+
+	b := &MeshBundle{}
+	switch {
+	case strings.HasSuffix(filename, ".json"):
+		err = json.Unmarshal(data, b)
+	case strings.HasSuffix(filename, ".yml"):
+		fallthrough
+	case strings.HasSuffix(filename, ".yaml"):
+		err = yaml.Unmarshal(data, b)
+	default:
+		return nil, errors.New("unknown mesh bundle file type")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", filename, err)
+	}
+
+	if err := b.Check(); err != nil {
+		return nil, fmt.Errorf("invalid mesh bundle: %w", err)
+	}
+	return b, nil
+}
+
+// SaveTo writes the mesh bundle to the given file.
+func (b *MeshBundle) SaveTo(filename string) error {
+	return writeFile(filename, b)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func makeTestMeshBundle(t *testing.T) *MeshBundle {
+	t.Helper()
+
+	secret, err := NewMeshUniverseSecret()
+	require.NoError(t, err)
+	b := &MeshBundle{
+		Universe:       "lab",
+		UniverseSecret: secret,
+	}
+	for _, node := range []struct{ name, url string }{
+		{"alpha", "tcp://192.0.2.1:47369"},
+		{"bravo", "tcp://192.0.2.2:47370"},
+		{"charlie", "tcp://192.0.2.3:47369"},
+	} {
+		addr, _, err := m.GenerateRoutableAddress(context.Background(), []netip.Prefix{m.MustPrefix([]byte{m.BaseNet, m.TypeRoutingAddress | m.ContinentEurope}, 12)})
+		require.NoError(t, err)
+		b.Nodes = append(b.Nodes, MeshNode{
+			Name:       node.name,
+			PeeringURL: node.url,
+			Address:    addr.Store(),
+		})
+	}
+	return b
+}
+
+func TestMeshBundleCheck(t *testing.T) {
+	t.Parallel()
+
+	base := makeTestMeshBundle(t)
+	require.NoError(t, base.Check())
+
+	for name, modify := range map[string]func(b *MeshBundle){
+		"no universe":       func(b *MeshBundle) { b.Universe = "" },
+		"no secret":         func(b *MeshBundle) { b.UniverseSecret = "" },
+		"single node":       func(b *MeshBundle) { b.Nodes = b.Nodes[:1] },
+		"invalid name":      func(b *MeshBundle) { b.Nodes[0].Name = "" },
+		"duplicate name":    func(b *MeshBundle) { b.Nodes[1].Name = b.Nodes[0].Name },
+		"invalid peering":   func(b *MeshBundle) { b.Nodes[0].PeeringURL = "invalid" },
+		"invalid address":   func(b *MeshBundle) { b.Nodes[0].Address.PrivateKey = "invalid" },
+		"duplicate address": func(b *MeshBundle) { b.Nodes[1].Address = b.Nodes[0].Address },
+	} {
+		b := *base
+		b.Nodes = slices.Clone(base.Nodes)
+		modify(&b)
+		assert.Error(t, b.Check(), name)
+	}
+}
+
+func TestMeshBundleNodeConfig(t *testing.T) {
+	t.Parallel()
+
+	b := makeTestMeshBundle(t)
+	store, err := b.NodeConfig("bravo")
+	require.NoError(t, err)
+
+	// The node listens on its own port and connects to all other nodes.
+	assert.Equal(t, b.Nodes[1].Address, store.Router.Address)
+	assert.Equal(t, []string{"tcp:47370"}, store.Router.Listen)
+	assert.Equal(t, []string{b.Nodes[0].PeeringURL, b.Nodes[2].PeeringURL}, store.Router.Bootstrap)
+	assert.Equal(t, b.Universe, store.Router.Universe)
+	assert.Equal(t, b.UniverseSecret, store.Router.UniverseSecret)
+
+	// All other nodes are friends with pinned keys.
+	require.Len(t, store.FriendConfigs, 2)
+	assert.Equal(t, "alpha", store.FriendConfigs[0].Name)
+	assert.Equal(t, "charlie", store.FriendConfigs[1].Name)
+	for _, friend := range store.FriendConfigs {
+		assert.NotEmpty(t, friend.Key, friend.Name)
+	}
+
+	// The resulting config must be valid.
+	_, err = store.Parse()
+	require.NoError(t, err)
+
+	_, err = b.NodeConfig("delta")
+	require.Error(t, err)
+}
+
+func TestLoadMeshBundle(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	b := makeTestMeshBundle(t)
+
+	for _, filename := range []string{"mesh.yaml", "mesh.json"} {
+		path := filepath.Join(dir, filename)
+
+		// Existing files are restricted, as the bundle holds private keys.
+		require.NoError(t, os.WriteFile(path, nil, 0o644)) //nolint:gosec
+		require.NoError(t, b.SaveTo(path))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), filename)
+
+		loaded, err := LoadMeshBundle(path)
+		require.NoError(t, err, filename)
+		assert.Equal(t, b, loaded, filename)
+	}
+
+	// Invalid bundles are rejected.
+	invalid := makeTestMeshBundle(t)
+	invalid.Nodes = invalid.Nodes[:1]
+	path := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, invalid.SaveTo(path))
+	_, err := LoadMeshBundle(path)
+	require.Error(t, err)
+
+	// Unknown file types are rejected.
+	require.Error(t, b.SaveTo(filepath.Join(dir, "mesh.txt")))
+	_, err = LoadMeshBundle(filepath.Join(dir, "mesh.txt"))
+	require.Error(t, err)
+}
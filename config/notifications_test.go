@@ -0,0 +1,93 @@
+package config
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNotifications(t *testing.T) {
+	t.Parallel()
+
+	// All events are enabled by default.
+	n, err := parseNotifications(&NotificationsConfig{Desktop: true})
+	require.NoError(t, err)
+	assert.True(t, n.Enabled(NotifyEventNewInbound))
+	assert.True(t, n.Enabled(NotifyEventDenied))
+	assert.True(t, n.Enabled(NotifyEventPeerDown))
+
+	// Selected events only.
+	n, err = parseNotifications(&NotificationsConfig{
+		Events:  []string{NotifyEventPeerDown},
+		Webhook: "https://example.com/hook",
+		Ntfy:    "http://ntfy.example.com/topic",
+	})
+	require.NoError(t, err)
+	assert.False(t, n.Enabled(NotifyEventNewInbound))
+	assert.True(t, n.Enabled(NotifyEventPeerDown))
+	assert.Equal(t, "example.com", n.Webhook.Host)
+	assert.Equal(t, "/topic", n.Ntfy.Path)
+
+	// Disabled notifications have no events.
+	var disabled *Notifications
+	assert.False(t, disabled.Enabled(NotifyEventPeerDown))
+
+	// Invalid settings.
+	for _, nc := range []*NotificationsConfig{
+		{},
+		{Events: []string{"unknown"}, Desktop: true},
+		{Events: []string{NotifyEventAlert}, Desktop: true},
+		{Webhook: "ftp://example.com/hook"},
+		{Webhook: "https:///hook"},
+		{Ntfy: "ntfy.sh/topic"},
+	} {
+		_, err := parseNotifications(nc)
+		assert.Error(t, err, "%+v", nc)
+	}
+}
+
+func TestParseAlerts(t *testing.T) {
+	t.Parallel()
+
+	n, err := parseNotifications(&NotificationsConfig{
+		Desktop: true,
+		Alerts: []AlertConfig{
+			{Name: "nas", Unreachable: "nas", For: "5m"},
+			{Name: "router", Unreachable: "fd12:3456::a"},
+			{Name: "uplink", PeersBelow: 1, For: "0s"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, n.Alerts, 3)
+	assert.Equal(t, "nas", n.Alerts[0].UnreachableFriend)
+	assert.Equal(t, 5*time.Minute, n.Alerts[0].For)
+	assert.Equal(t, netip.MustParseAddr("fd12:3456::a"), n.Alerts[1].Unreachable)
+	assert.Equal(t, DefaultAlertFor, n.Alerts[1].For)
+	assert.Equal(t, 1, n.Alerts[2].PeersBelow)
+	assert.Equal(t, time.Duration(0), n.Alerts[2].For)
+
+	// Invalid alerts.
+	for _, ac := range []AlertConfig{
+		{Unreachable: "nas"},
+		{Name: "none"},
+		{Name: "both", Unreachable: "nas", PeersBelow: 1},
+		{Name: "negative", PeersBelow: -1},
+		{Name: "domain", Unreachable: "nas.myco"},
+		{Name: "duration", PeersBelow: 1, For: "soon"},
+		{Name: "past", PeersBelow: 1, For: "-1m"},
+	} {
+		_, err := parseAlert(ac)
+		assert.Error(t, err, "%+v", ac)
+	}
+	_, err = parseNotifications(&NotificationsConfig{
+		Desktop: true,
+		Alerts: []AlertConfig{
+			{Name: "uplink", PeersBelow: 1},
+			{Name: "uplink", PeersBelow: 2},
+		},
+	})
+	assert.Error(t, err, "alert names must be unique")
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultRelayBudgetOwnShare is the default share of the upload bandwidth in
+// percent that is kept for the traffic of this router.
+const DefaultRelayBudgetOwnShare = 50
+
+// RelayBudget holds the bandwidth budget for relayed frames.
+type RelayBudget struct {
+	// Total is the bandwidth in bytes per second that all relayed frames may
+	// use together. Zero means unlimited.
+	Total uint64
+	// PerPeer is the bandwidth in bytes per second that relayed frames sent
+	// to a single peer may use. Zero means unlimited.
+	PerPeer uint64
+}
+
+// parseRelayBudget parses and checks the relay budget settings.
+func parseRelayBudget(rc *RelayBudgetConfig) (*RelayBudget, error) {
+	budget := &RelayBudget{}
+
+	if rc.Upload != "" {
+		upload, err := ParseBandwidth(rc.Upload)
+		if err != nil {
+			return nil, fmt.Errorf("upload: %w", err)
+		}
+		ownShare := rc.OwnShare
+		switch {
+		case ownShare == 0:
+			ownShare = DefaultRelayBudgetOwnShare
+		case ownShare < 1 || ownShare > 99:
+			return nil, errors.New("ownShare must be between 1 and 99")
+		}
+		budget.Total = upload * uint64(100-ownShare) / 100
+	} else if rc.OwnShare != 0 {
+		return nil, errors.New("ownShare requires upload")
+	}
+
+	if rc.PerPeer != "" {
+		perPeer, err := ParseBandwidth(rc.PerPeer)
+		if err != nil {
+			return nil, fmt.Errorf("perPeer: %w", err)
+		}
+		budget.PerPeer = perPeer
+	}
+
+	if budget.Total == 0 && budget.PerPeer == 0 {
+		return nil, errors.New("upload or perPeer must be set")
+	}
+	return budget, nil
+}
+
+// bandwidthUnits holds the supported bandwidth units and their size in bytes.
+var bandwidthUnits = map[string]float64{
+	"bit":  1.0 / 8,
+	"kbit": 1e3 / 8,
+	"mbit": 1e6 / 8,
+	"gbit": 1e9 / 8,
+	"b":    1,
+	"kb":   1e3,
+	"mb":   1e6,
+	"gb":   1e9,
+	"kib":  1 << 10,
+	"mib":  1 << 20,
+	"gib":  1 << 30,
+}
+
+// ParseBandwidth parses a bandwidth in bits or bytes per second, eg.
+// "20Mbit", "2.5MB" or "512KiB/s", and returns it in bytes per second.
+func ParseBandwidth(s string) (uint64, error) {
+	value := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/s")
+	unitStart := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if unitStart <= 0 {
+		return 0, fmt.Errorf("bandwidth %q must be a number with a unit, eg. \"20Mbit\" or \"2.5MB\"", s)
+	}
+
+	unit, ok := bandwidthUnits[strings.TrimSpace(value[unitStart:])]
+	if !ok {
+		return 0, fmt.Errorf("bandwidth %q has an unknown unit", s)
+	}
+	num, err := strconv.ParseFloat(value[:unitStart], 64)
+	if err != nil {
+		return 0, fmt.Errorf("bandwidth %q is not a valid number", s)
+	}
+	bandwidth := num * unit
+	if bandwidth < 1 || bandwidth > math.MaxInt64 {
+		return 0, fmt.Errorf("bandwidth %q is out of range", s)
+	}
+	return uint64(bandwidth), nil
+}
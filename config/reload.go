@@ -0,0 +1,83 @@
+package config
+
+import (
+	"maps"
+	"net/netip"
+)
+
+// GetPeerWeights returns a copy of the route preference weights of peers.
+func (c *Config) GetPeerWeights() map[netip.Addr]int {
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+
+	return maps.Clone(c.peerWeights)
+}
+
+// GetPeerWeight returns the route preference weight of the given peer.
+func (c *Config) GetPeerWeight(peer netip.Addr) int {
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+
+	return c.peerWeights[peer]
+}
+
+// SyncPeerWeights replaces the route preference weights of peers of the
+// running config with the ones of the given config.
+// It returns whether the weights changed.
+func (c *Config) SyncPeerWeights(changed *Config) bool {
+	weights := changed.GetPeerWeights()
+
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+
+	if maps.Equal(c.peerWeights, weights) {
+		return false
+	}
+	c.peerWeights = weights
+	c.Router.Peers = changed.Router.Peers
+	return true
+}
+
+// IsStub returns whether the router is configured as a stub router.
+func (c *Config) IsStub() bool {
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+
+	return c.Router.Stub
+}
+
+// SyncStub replaces the stub setting of the running config with the one of
+// the given config. It returns whether the setting changed.
+func (c *Config) SyncStub(changed *Config) bool {
+	stub := changed.IsStub()
+
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+
+	if c.Router.Stub == stub {
+		return false
+	}
+	c.Router.Stub = stub
+	return true
+}
+
+// GetRelayBudget returns the bandwidth budget for relayed frames.
+// Returns nil if relayed frames are not limited.
+func (c *Config) GetRelayBudget() *RelayBudget {
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+
+	return c.relayBudget
+}
+
+// SyncRelayBudget replaces the bandwidth budget for relayed frames of the
+// running config with the one of the given config.
+func (c *Config) SyncRelayBudget(changed *Config) {
+	budget := changed.GetRelayBudget()
+
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+
+	c.relayBudget = budget
+	c.Router.RelayBudget = changed.Router.RelayBudget
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"runtime"
+)
+
+// Resources holds the resource limits of the system or container.
+// Zero values mean that there is no limit or that it is unknown.
+type Resources struct {
+	// MemoryLimit is the usable memory in bytes. It is the lower of the cgroup
+	// memory limit and the physical memory.
+	MemoryLimit uint64
+	// CPULimit is the amount of CPUs that may be used, as defined by the cgroup
+	// CPU quota.
+	CPULimit float64
+	// FDLimit is the maximum amount of open file descriptors.
+	FDLimit uint64
+}
+
+// Limits holds limits that are derived from the available resources.
+type Limits struct {
+	// QueueSize is the size of frame queues.
+	QueueSize int
+	// MaxRoutes is the maximum amount of routing table entries.
+	// Zero means unlimited.
+	MaxRoutes int
+	// MaxPeers is the maximum amount of connected peers.
+	// Zero means unlimited.
+	MaxPeers int
+	// MaxConnections is the maximum amount of tracked connections.
+	MaxConnections int
+}
+
+// Default and minimum limits.
+const (
+	DefaultQueueSize      = 1000
+	MinQueueSize          = 100
+	MinMaxRoutes          = 1000
+	MinMaxPeers           = 8
+	DefaultMaxConnections = 65536
+	MinMaxConnections     = 1000
+)
+
+const (
+	// queueSlotMemory is the memory budgeted per frame queue slot.
+	// Frames are queued in many places, eg. per link, so this is generous.
+	queueSlotMemory = 256 << 10 // 256KiB
+	// routeMemory is the memory budgeted per routing table entry, including
+	// the switch path and the lookup overhead.
+	routeMemory = 8 << 10 // 8KiB
+	// peerMemory is the memory budgeted per peer, including the link queues.
+	peerMemory = 4 << 20 // 4MiB
+	// connMemory is the memory budgeted per tracked connection.
+	connMemory = 2 << 10 // 2KiB
+	// reservedFDs is the amount of file descriptors reserved for anything
+	// else than peering links.
+	reservedFDs = 64
+	// fdsPerPeer is the amount of file descriptors budgeted per peer, as links
+	// may be bonded and connections are made while old ones are closed.
+	fdsPerPeer = 2
+)
+
+// DeriveLimits derives safe limits from the given resources.
+func (res Resources) DeriveLimits() Limits {
+	limits := Limits{
+		QueueSize:      DefaultQueueSize,
+		MaxConnections: DefaultMaxConnections,
+	}
+
+	// Derive limits from memory.
+	if res.MemoryLimit > 0 {
+		limits.QueueSize = clampLimit(int(res.MemoryLimit/queueSlotMemory), MinQueueSize, DefaultQueueSize)
+		limits.MaxRoutes = max(int(res.MemoryLimit/routeMemory), MinMaxRoutes)
+		limits.MaxPeers = max(int(res.MemoryLimit/peerMemory), MinMaxPeers)
+		limits.MaxConnections = clampLimit(int(res.MemoryLimit/connMemory), MinMaxConnections, DefaultMaxConnections)
+	}
+
+	// Derive peer limit from file descriptors.
+	if res.FDLimit > 0 {
+		fdPeers := MinMaxPeers
+		if res.FDLimit > reservedFDs {
+			fdPeers = max(int((res.FDLimit-reservedFDs)/fdsPerPeer), MinMaxPeers)
+		}
+		if limits.MaxPeers == 0 || fdPeers < limits.MaxPeers {
+			limits.MaxPeers = fdPeers
+		}
+	}
+
+	return limits
+}
+
+// MaxProcs returns the amount of threads to use for executing go code
+// according to the CPU limit.
+func (res Resources) MaxProcs() int {
+	if res.CPULimit <= 0 {
+		return runtime.NumCPU()
+	}
+	return clampLimit(int(res.CPULimit+0.99), 1, runtime.NumCPU())
+}
+
+func clampLimit(value, lower, upper int) int {
+	return min(max(value, lower), upper)
+}
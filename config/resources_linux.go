@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+
+	// cgroupV1Unlimited is the threshold above which cgroup v1 memory limits
+	// are regarded as unlimited. The actual value depends on the page size.
+	cgroupV1Unlimited = 1 << 60
+)
+
+// DetectResources detects the resource limits of the system or container.
+func DetectResources() Resources {
+	var res Resources
+
+	// Get memory limit.
+	res.MemoryLimit = cgroupMemoryLimit()
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err == nil {
+		physical := uint64(info.Totalram) * uint64(info.Unit) //nolint:unconvert // Type differs per platform.
+		if res.MemoryLimit == 0 || physical < res.MemoryLimit {
+			res.MemoryLimit = physical
+		}
+	}
+
+	// Get CPU limit.
+	res.CPULimit = cgroupCPULimit()
+
+	// Get file descriptor limit.
+	var rlimit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit); err == nil &&
+		rlimit.Cur != unix.RLIM_INFINITY {
+		res.FDLimit = rlimit.Cur
+	}
+
+	return res
+}
+
+// OpenFDs returns the amount of open file descriptors of the process.
+func OpenFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+// cgroupMemoryLimit returns the cgroup memory limit, or zero if there is none.
+func cgroupMemoryLimit() uint64 {
+	// cgroup v2
+	if value, ok := readCgroupV2File("memory.max"); ok {
+		if value == "max" {
+			return 0
+		}
+		limit, _ := strconv.ParseUint(value, 10, 64)
+		return limit
+	}
+
+	// cgroup v1
+	if data, err := os.ReadFile(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes")); err == nil {
+		limit, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if limit < cgroupV1Unlimited {
+			return limit
+		}
+	}
+
+	return 0
+}
+
+// cgroupCPULimit returns the cgroup CPU limit, or zero if there is none.
+func cgroupCPULimit() float64 {
+	// cgroup v2: "<quota> <period>" or "max <period>"
+	if value, ok := readCgroupV2File("cpu.max"); ok {
+		quotaValue, periodValue, _ := strings.Cut(value, " ")
+		return cpuQuota(quotaValue, periodValue)
+	}
+
+	// cgroup v1
+	quotaData, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0
+	}
+	periodData, err := os.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0
+	}
+	return cpuQuota(strings.TrimSpace(string(quotaData)), strings.TrimSpace(string(periodData)))
+}
+
+func cpuQuota(quotaValue, periodValue string) float64 {
+	quota, err := strconv.ParseInt(quotaValue, 10, 64)
+	if err != nil || quota <= 0 {
+		return 0
+	}
+	period, err := strconv.ParseInt(periodValue, 10, 64)
+	if err != nil || period <= 0 {
+		return 0
+	}
+	return float64(quota) / float64(period)
+}
+
+// readCgroupV2File reads the given file of the cgroup v2 of the process.
+func readCgroupV2File(name string) (value string, ok bool) {
+	for _, dir := range []string{cgroupV2Path(), ""} {
+		data, err := os.ReadFile(filepath.Join(cgroupRoot, dir, name))
+		if err == nil {
+			return strings.TrimSpace(string(data)), true
+		}
+	}
+	return "", false
+}
+
+// cgroupV2Path returns the path of the cgroup v2 of the process, relative to
+// the cgroup root.
+func cgroupV2Path() string {
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path
+		}
+	}
+	return ""
+}
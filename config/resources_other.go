@@ -0,0 +1,15 @@
+//go:build !linux
+
+package config
+
+// DetectResources detects the resource limits of the system or container.
+// Detection is not supported on this platform.
+func DetectResources() Resources {
+	return Resources{}
+}
+
+// OpenFDs returns the amount of open file descriptors of the process.
+// It is not supported on this platform and always returns zero.
+func OpenFDs() int {
+	return 0
+}
@@ -5,19 +5,43 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// ErrNoConfigFile is returned when saving a config that was not loaded from a file.
+var ErrNoConfigFile = errors.New("config was not loaded from a file")
+
 // LoadConfig loads the config from the given file.
 func LoadConfig(filename string) (*Config, error) {
+	store, modTime, err := loadStore(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := store.Parse()
+	if err != nil {
+		return nil, err
+	}
+	c.filename = filename
+	c.fileModTime = modTime
+	return c, nil
+}
+
+func loadStore(filename string) (store *Store, modTime time.Time, err error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("read config file at %s: %w", filename, err)
+	}
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("read config file at %s: %w", filename, err)
+		return nil, time.Time{}, fmt.Errorf("read config file at %s: %w", filename, err)
 	}
 
-	store := &Store{}
+	store = &Store{}
 	switch {
 	case strings.HasSuffix(filename, ".json"):
 		err = json.Unmarshal(data, store)
@@ -26,37 +50,223 @@ func LoadConfig(filename string) (*Config, error) {
 	case strings.HasSuffix(filename, ".yaml"):
 		err = yaml.Unmarshal(data, store)
 	default:
-		return nil, errors.New("unknown config file type")
+		return nil, time.Time{}, errors.New("unknown config file type")
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unmarshal %s: %w", filename, err)
+	}
+
+	return store, info.ModTime(), nil
+}
+
+// Save writes the config store back to the file it was loaded from.
+func (c *Config) Save() error {
+	if c.filename == "" {
+		return ErrNoConfigFile
+	}
+
+	c.fileLock.Lock()
+	defer c.fileLock.Unlock()
+
+	// Lock all runtime changeable parts of the store.
+	c.friendsLock.RLock()
+	defer c.friendsLock.RUnlock()
+	c.inPolicyLock.RLock()
+	defer c.inPolicyLock.RUnlock()
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+
+	if err := writeFile(c.filename, c.Store); err != nil {
+		return err
+	}
+	if info, err := os.Stat(c.filename); err == nil {
+		c.fileModTime = info.ModTime()
+	}
+	return nil
+}
+
+// ReloadResult holds the changes applied by Reload.
+type ReloadResult struct {
+	AddedFriends       int
+	RemovedFriends     int
+	PeerWeightsChanged bool
+	StubChanged        bool
+}
+
+// Reload checks if the config file changed and applies any changes to the
+// friends, peer weights, relay budget and stub setting to the running config.
+// Other changes require a restart.
+func (c *Config) Reload() (result ReloadResult, err error) {
+	if c.filename == "" {
+		return ReloadResult{}, nil
+	}
+
+	c.fileLock.Lock()
+	defer c.fileLock.Unlock()
+
+	// Check if file changed.
+	info, err := os.Stat(c.filename)
+	if err != nil {
+		return ReloadResult{}, fmt.Errorf("read config file at %s: %w", c.filename, err)
 	}
+	if !info.ModTime().After(c.fileModTime) {
+		return ReloadResult{}, nil
+	}
+
+	// Load and parse changed config.
+	store, modTime, err := loadStore(c.filename)
+	if err != nil {
+		return ReloadResult{}, err
+	}
+	c.fileModTime = modTime
+	changed, err := store.Parse()
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal %s: %w", filename, err)
+		return ReloadResult{}, err
 	}
 
-	return store.Parse()
+	result.PeerWeightsChanged = c.SyncPeerWeights(changed)
+	c.SyncRelayBudget(changed)
+	result.StubChanged = c.SyncStub(changed)
+	result.AddedFriends, result.RemovedFriends, err = c.SyncFriends(changed.GetFriends())
+	return result, err
 }
 
 // SaveTo write the config to the given file.
 func (c *Config) SaveTo(filename string) error {
+	return writeFile(filename, c)
+}
+
+// SaveTo writes the config store to the given file.
+func (s *Store) SaveTo(filename string) error {
+	return writeFile(filename, s)
+}
+
+// writeFile writes the given value to the file in the format defined by the
+// file extension. Configs may hold private keys and secrets, so the file is
+// only readable by the owner. The file is replaced atomically, so that it is
+// never left partially written. Comments of an existing YAML file are kept.
+func writeFile(filename string, v any) error {
+	// Replace the target of symlinks, not the symlink itself.
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+
 	var (
 		data []byte
 		err  error
 	)
 	switch {
 	case strings.HasSuffix(filename, ".json"):
-		data, err = json.MarshalIndent(c, "", "  ")
+		data, err = json.MarshalIndent(v, "", "  ")
 	case strings.HasSuffix(filename, ".yml"):
 		fallthrough
 	case strings.HasSuffix(filename, ".yaml"):
-		data, err = yaml.Marshal(c)
+		data, err = marshalYAMLWithComments(filename, v)
 	default:
-		return errors.New("unknown config file type")
+		return errors.New("unknown file type")
 	}
 	if err != nil {
 		return fmt.Errorf("marshal: %w", err)
 	}
 
-	if err := os.WriteFile(filename, data, 0o0600); err != nil {
-		return fmt.Errorf("write config to %s: %w", filename, err)
+	// Write to a temporary file next to the target and replace the target.
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file for %s: %w", filename, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // Fails after successful rename.
+	if err := tmp.Chmod(0o0600); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("restrict permissions of %s: %w", tmp.Name(), err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write to %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write to %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write to %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("replace %s: %w", filename, err)
 	}
 	return nil
 }
+
+// marshalYAMLWithComments marshals the value to YAML and keeps the comments
+// of the existing file, if there is one.
+func marshalYAMLWithComments(filename string, v any) ([]byte, error) {
+	updated := &yaml.Node{}
+	if err := updated.Encode(v); err != nil {
+		return nil, err
+	}
+
+	// Copy comments from the existing file.
+	if existingData, err := os.ReadFile(filename); err == nil {
+		existing := &yaml.Node{}
+		if err := yaml.Unmarshal(existingData, existing); err == nil {
+			if existing.Kind == yaml.DocumentNode && len(existing.Content) > 0 {
+				existing = existing.Content[0]
+			}
+			copyYAMLComments(updated, existing)
+		}
+	}
+
+	return yaml.Marshal(updated)
+}
+
+// copyYAMLComments copies the comments of the existing node to the matching
+// parts of the updated node. Mapping values are matched by key and sequence
+// items by their name, eg. of friends and services, or else by position.
+func copyYAMLComments(updated, existing *yaml.Node) {
+	if updated.Kind != existing.Kind {
+		return
+	}
+	updated.HeadComment = existing.HeadComment
+	updated.LineComment = existing.LineComment
+	updated.FootComment = existing.FootComment
+
+	switch updated.Kind { //nolint:exhaustive
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			for j := 0; j+1 < len(existing.Content); j += 2 {
+				if updated.Content[i].Value == existing.Content[j].Value {
+					copyYAMLComments(updated.Content[i], existing.Content[j])
+					copyYAMLComments(updated.Content[i+1], existing.Content[j+1])
+					break
+				}
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range updated.Content {
+			name := yamlItemName(item)
+			switch {
+			case name != "":
+				for _, existingItem := range existing.Content {
+					if yamlItemName(existingItem) == name {
+						copyYAMLComments(item, existingItem)
+						break
+					}
+				}
+			case i < len(existing.Content):
+				copyYAMLComments(item, existing.Content[i])
+			}
+		}
+	}
+}
+
+// yamlItemName returns the value of the name key of a mapping node.
+func yamlItemName(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "name" {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigWithComments = `# Mycoria config.
+router:
+    # Do not relay.
+    stub: true # Client only.
+friends:
+    # The file server.
+    - name: nas
+      ip: fd12:3456::f # Basement.
+    # The laptop.
+    - name: laptop
+      ip: fd12:3456::1
+`
+
+func TestSave(t *testing.T) {
+	t.Parallel()
+
+	// Create config file with comments and a symlink to it.
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(testConfigWithComments), 0o0644))
+	link := filepath.Join(dir, "link.yaml")
+	require.NoError(t, os.Symlink(filename, link))
+
+	c := MakeTestConfig(Store{
+		Router: Router{Stub: true},
+		FriendConfigs: []FriendConfig{
+			{Name: "nas", IP: "fd12:3456::f"},
+			{Name: "laptop", IP: "fd12:3456::1"},
+		},
+	})
+	c.filename = link
+
+	// Remove the first friend and add another one.
+	require.NoError(t, c.RemoveFriend("nas"))
+	require.NoError(t, c.AddFriend(Friend{Name: "phone", IP: netip.MustParseAddr("fd12:3456::2")}))
+	require.NoError(t, c.Save())
+
+	// Comments are kept and follow their friend.
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, `# Mycoria config.
+router:
+    # Do not relay.
+    stub: true # Client only.
+friends:
+    # The laptop.
+    - name: laptop
+      ip: fd12:3456::1
+    - name: phone
+      ip: fd12:3456::2
+`, string(data))
+
+	// The symlink is kept and the file is only readable by the owner.
+	info, err := os.Lstat(link)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+	info, err = os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o0600), info.Mode().Perm())
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// The saved config can be loaded again.
+	loaded, _, err := loadStore(filename)
+	require.NoError(t, err)
+	assert.Equal(t, c.FriendConfigs, loaded.FriendConfigs)
+}
+
+func TestSaveWithoutFile(t *testing.T) {
+	t.Parallel()
+
+	require.ErrorIs(t, MakeTestConfig(Store{}).Save(), ErrNoConfigFile)
+}
@@ -12,24 +12,20 @@
   const getStoredTheme = () => localStorage.getItem('theme')
   const setStoredTheme = theme => localStorage.setItem('theme', theme)
 
-  // Get theme from storage or browser / OS preference.
+  // Get theme from storage or follow browser / OS preference.
   const getPreferredTheme = () => {
     const storedTheme = getStoredTheme()
     if (storedTheme) {
       return storedTheme
     }
 
-    return 'dark'
-    // TODO: Auto-use light mode if support is better.
-    // return window.matchMedia('(prefers-color-scheme: dark)').matches ? 'dark' : 'light'
+    return 'auto'
   }
 
   // Set bootstrap theme.
   const setTheme = theme => {
     if (theme === 'auto') {
-      document.documentElement.setAttribute('data-bs-theme', 'dark')
-      // TODO: Auto-use light mode if support is better.
-      // document.documentElement.setAttribute('data-bs-theme', (window.matchMedia('(prefers-color-scheme: dark)').matches ? 'dark' : 'light'))
+      document.documentElement.setAttribute('data-bs-theme', (window.matchMedia('(prefers-color-scheme: dark)').matches ? 'dark' : 'light'))
     } else {
       document.documentElement.setAttribute('data-bs-theme', theme)
     }
@@ -10,7 +10,9 @@ import (
 	"net/netip"
 	"os"
 	"path"
+	"slices"
 	"strings"
+	"sync/atomic"
 	txtTemplate "text/template"
 	"time"
 
@@ -25,13 +27,15 @@ import (
 	"github.com/mycoria/mycoria/router"
 	"github.com/mycoria/mycoria/state"
 	"github.com/mycoria/mycoria/storage"
+	"github.com/mycoria/mycoria/tun"
+	"github.com/mycoria/mycoria/updater"
 )
 
 var (
 	//go:embed assets
 	assetsFS embed.FS
 
-	//go:embed views
+	//go:embed views locales
 	templateFS embed.FS
 )
 
@@ -45,7 +49,11 @@ type Dashboard struct {
 
 	tokenSecret []byte
 
-	htmlTemplates map[string]*template.Template
+	onboarded atomic.Bool
+
+	languages     []string
+	catalogs      map[string]catalog
+	htmlTemplates map[string]map[string]*template.Template
 	txtTemplates  *txtTemplate.Template
 }
 
@@ -55,11 +63,14 @@ type instance interface {
 	Config() *config.Config
 	Identity() *m.Address
 	Storage() storage.Storage
+	Mappings() *dns.MappingCache
 	State() *state.State
 	API() *httpapi.API
 	DNS() *dns.Server
 	Router() *router.Router
 	Peering() *peering.Peering
+	TunDevice() *tun.Device
+	Updater() *updater.Updater
 }
 
 // New adds a dashboard to the given instance.
@@ -70,6 +81,7 @@ func New(instance instance) (*Dashboard, error) {
 		assetsEtag:  fmt.Sprintf(`"%x"`, instance.Config().Started().UnixNano()),
 	}
 	d.registerRoutes()
+	d.initOnboarding()
 
 	// Generate token secret.
 	d.tokenSecret = make([]byte, tokenSecretSize)
@@ -99,7 +111,7 @@ func (d *Dashboard) Stop(mgr *mgr.Manager) error {
 }
 
 func (d *Dashboard) registerRoutes() {
-	d.instance.API().HandleFunc("/assets/", d.serveAssets)
+	d.instance.API().HandleStatusFunc("/assets/", d.serveAssets)
 
 	d.registerViews()
 }
@@ -116,39 +128,69 @@ func (d *Dashboard) serveAssets(w http.ResponseWriter, r *http.Request) {
 }
 
 func (d *Dashboard) loadTemplates(baseFS fs.FS) error {
-	// Load html templates.
-	includeTemplates, err := template.New("").Funcs(gtf.GtfFuncMap).ParseFS(baseFS, "views/include/*.html")
+	// Load translations.
+	catalogs, err := loadCatalogs(baseFS)
+	if err != nil {
+		return fmt.Errorf("load translations: %w", err)
+	}
+	catalogs[defaultLanguage] = nil
+	languages := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		languages = append(languages, lang)
+	}
+	slices.Sort(languages)
+
+	// Load html templates for every language.
+	htmlTemplates := make(map[string]map[string]*template.Template, len(catalogs))
+	for lang, c := range catalogs {
+		htmlTemplates[lang], err = loadHTMLTemplates(baseFS, c)
+		if err != nil {
+			return fmt.Errorf("load %s templates: %w", lang, err)
+		}
+	}
+
+	// Load txt templates.
+	txtTemplates, err := txtTemplate.New("").Funcs(gtf.GtfFuncMap).ParseFS(baseFS, "views/*.txt")
+	if err != nil {
+		return fmt.Errorf("load txt templates: %w", err)
+	}
+
+	d.languages = languages
+	d.catalogs = catalogs
+	d.htmlTemplates = htmlTemplates
+	d.txtTemplates = txtTemplates
+	return nil
+}
+
+func loadHTMLTemplates(baseFS fs.FS, c catalog) (map[string]*template.Template, error) {
+	funcs := template.FuncMap{
+		"t": translateFunc(c),
+	}
+	includeTemplates, err := template.New("").Funcs(gtf.GtfFuncMap).Funcs(funcs).ParseFS(baseFS, "views/include/*.html")
 	if err != nil {
-		return fmt.Errorf("load include templates: %w", err)
+		return nil, fmt.Errorf("load include templates: %w", err)
 	}
 	// Parse every page template together with the includes.
 	views, err := fs.ReadDir(baseFS, "views")
 	if err != nil {
-		return fmt.Errorf("load page names: %w", err)
+		return nil, fmt.Errorf("load page names: %w", err)
 	}
-	d.htmlTemplates = make(map[string]*template.Template)
+	htmlTemplates := make(map[string]*template.Template)
 	for _, view := range views {
 		if view.IsDir() || !strings.HasSuffix(view.Name(), ".html") {
 			continue
 		}
 		cloned, err := includeTemplates.Clone()
 		if err != nil {
-			return fmt.Errorf("clone include templates: %w", err)
+			return nil, fmt.Errorf("clone include templates: %w", err)
 		}
 		pageTmpl, err := cloned.ParseFS(baseFS, path.Join("views", view.Name()))
 		if err != nil {
-			return fmt.Errorf("parse page %s template: %w", view.Name(), err)
+			return nil, fmt.Errorf("parse page %s template: %w", view.Name(), err)
 		}
-		d.htmlTemplates[view.Name()] = pageTmpl
+		htmlTemplates[view.Name()] = pageTmpl
 	}
-
-	// Load txt templates.
-	d.txtTemplates, err = txtTemplate.New("").Funcs(gtf.GtfFuncMap).ParseFS(baseFS, "views/*.txt")
-	if err != nil {
-		return fmt.Errorf("load txt templates: %w", err)
-	}
-
-	return nil
+	return htmlTemplates, nil
 }
 
 type renderingData struct {
@@ -159,7 +201,12 @@ type renderingData struct {
 	Hostname  string
 	Started   time.Time
 	Uptime    time.Duration
-	Page      any
+	DevMode   bool
+	// StatusOnly is set if the request was received on a listener with the
+	// status scope, which only serves status pages.
+	StatusOnly bool
+	Lang       string
+	Page       any
 }
 
 var (
@@ -181,7 +228,10 @@ func (d *Dashboard) render(w http.ResponseWriter, r *http.Request, templateName
 		Hostname:  hostname,
 		Started:   d.instance.Config().Started(),
 		Uptime:    d.instance.Config().Uptime(),
+		DevMode:   d.instance.Config().DevMode(),
 		Page:      data,
+
+		StatusOnly: httpapi.RequestScope(r) == config.APIScopeStatus,
 	}
 
 	// Reload templates in dev mode.
@@ -216,7 +266,10 @@ func (d *Dashboard) render(w http.ResponseWriter, r *http.Request, templateName
 		fallthrough
 	default:
 		templateName += ".html"
-		tmpl, ok := d.htmlTemplates[templateName]
+		renderData.Lang = negotiateLanguage(r, d.languages)
+		w.Header().Set("Content-Language", renderData.Lang)
+		w.Header().Add("Vary", "Accept-Language")
+		tmpl, ok := d.htmlTemplates[renderData.Lang][templateName]
 		if ok {
 			err = tmpl.ExecuteTemplate(w, templateName, renderData)
 		} else {
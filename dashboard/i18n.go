@@ -0,0 +1,122 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Translations
+//
+// Dashboard strings are written in English in the templates and wrapped with
+// the "t" template function, eg. {{ t "Routing Table" }}. The English string
+// is the key for the translation catalogs in locales/<lang>.json. Missing
+// translations fall back to English, so catalogs may be incomplete.
+//
+// Plain text views are meant for scripts and stay in English.
+
+// defaultLanguage is the language the templates are written in.
+const defaultLanguage = "en"
+
+// catalog maps English strings to their translation.
+type catalog map[string]string
+
+// loadCatalogs loads the translation catalogs from locales/*.json.
+func loadCatalogs(baseFS fs.FS) (map[string]catalog, error) {
+	files, err := fs.Glob(baseFS, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	catalogs := make(map[string]catalog, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(baseFS, file)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+		var c catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		catalogs[strings.TrimSuffix(path.Base(file), ".json")] = c
+	}
+	return catalogs, nil
+}
+
+// translator translates the given string and formats the arguments into it.
+type translator func(s string, args ...any) string
+
+// translateFunc returns the translator for the given catalog.
+// It is also used as the "t" template function.
+func translateFunc(c catalog) translator {
+	return func(s string, args ...any) string {
+		if translated, ok := c[s]; ok && translated != "" {
+			s = translated
+		}
+		if len(args) > 0 {
+			return fmt.Sprintf(s, args...)
+		}
+		return s
+	}
+}
+
+// translator returns the translator for the language of the request.
+// Use it for strings that are created in Go code.
+func (d *Dashboard) translator(r *http.Request) translator {
+	return translateFunc(d.catalogs[negotiateLanguage(r, d.languages)])
+}
+
+// negotiateLanguage returns the best matching available language for the
+// Accept-Language header of the request.
+func negotiateLanguage(r *http.Request, available []string) string {
+	type langPref struct {
+		lang string
+		q    float64
+	}
+
+	// Parse header, eg. "de-AT,de;q=0.9,en;q=0.8".
+	var prefs []langPref
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		pref := langPref{q: 1}
+		if qValue, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(qValue, 64)
+			if err != nil || q <= 0 {
+				continue
+			}
+			pref.q = q
+		}
+		// Only match on the primary language.
+		pref.lang, _, _ = strings.Cut(strings.ToLower(tag), "-")
+		prefs = append(prefs, pref)
+	}
+	slices.SortStableFunc(prefs, func(a, b langPref) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	// Return first available language.
+	for _, pref := range prefs {
+		if pref.lang == "*" {
+			break
+		}
+		if slices.Contains(available, pref.lang) {
+			return pref.lang
+		}
+	}
+	return defaultLanguage
+}
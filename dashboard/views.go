@@ -6,30 +6,49 @@ import (
 	"net/netip"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"time"
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/mycoria/mycoria/api/dns"
+	"github.com/mycoria/mycoria/geoip"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/peering"
 	"github.com/mycoria/mycoria/router"
 	"github.com/mycoria/mycoria/storage"
+	"github.com/mycoria/mycoria/updater"
 )
 
 func (d *Dashboard) registerViews() {
 	api := d.instance.API()
 
-	api.HandleFunc("GET /{$}", d.overviewPage)
-	api.HandleFunc("GET /overview", d.overviewPage)
+	api.HandleStatusFunc("GET /{$}", d.overviewPage)
+	api.HandleStatusFunc("GET /overview", d.overviewPage)
 	api.HandleFunc("POST /{$}", d.overviewManage)
 	api.HandleFunc("POST /overview", d.overviewManage)
 
 	api.HandleFunc("GET /discover", d.discoverPage)
-	api.HandleFunc("GET /table", d.tablePage)
+	api.HandleStatusFunc("GET /table", d.tablePage)
+	api.HandleStatusFunc("GET /links", d.linksPage)
+	api.HandleStatusFunc("GET /traffic", d.trafficPage)
 	api.HandleFunc("GET /info", d.infoPage)
 
 	api.HandleFunc("GET /mappings", d.mappingsPage)
 	api.HandleFunc("POST /mappings", d.mappingsManage)
+	api.HandleFunc("GET /mappings/export", d.mappingsExport)
+
+	api.HandleFunc("GET /friends", d.friendsPage)
+	api.HandleFunc("POST /friends", d.friendsManage)
+
+	api.HandleFunc("GET /access", d.accessPage)
+	api.HandleFunc("POST /access", d.accessManage)
+
+	api.HandleFunc("GET /onboarding", d.onboardingPage)
+	api.HandleFunc("POST /onboarding", d.onboardingManage)
+
+	api.HandleFunc("GET /chaos", d.chaosPage)
+	api.HandleFunc("POST /chaos", d.chaosManage)
 
 	api.HandleFunc("GET /open", d.mappingManualOpen)
 	api.HandleFunc("GET /open/{domain}/{router}/", d.mappingOpenPage)
@@ -37,6 +56,11 @@ func (d *Dashboard) registerViews() {
 }
 
 func (d *Dashboard) overviewPage(w http.ResponseWriter, r *http.Request) {
+	// Start with onboarding on new routers.
+	if d.redirectToOnboarding(w, r) {
+		return
+	}
+
 	// Create request token.
 	rToken, err := d.CreateRequestToken(
 		"manage overview",
@@ -50,20 +74,53 @@ func (d *Dashboard) overviewPage(w http.ResponseWriter, r *http.Request) {
 	memStats := new(runtime.MemStats)
 	runtime.ReadMemStats(memStats)
 
+	// Get announced info of peers.
+	links := d.instance.Peering().GetLinks()
+	peerInfos := make(map[netip.Addr]*m.RouterInfo, len(links))
+	for _, link := range links {
+		stored, err := d.instance.Storage().GetRouter(link.Peer())
+		if err == nil && stored.PublicInfo != nil {
+			peerInfos[link.Peer()] = stored.PublicInfo
+		}
+	}
+
+	// Get services with repeated denied attempts.
+	denied := d.instance.Router().ExportDeniedAttempts()
+	denied = slices.DeleteFunc(denied, func(attempts router.DeniedAttempts) bool {
+		return !attempts.Notified
+	})
+
+	conns := d.instance.Router().ExportConnections(3 * time.Minute)
+	activeConns, recentConns := router.CountConnections(conns)
+
 	d.render(w, r, "overview", struct {
 		*RequestToken
 		NumCPU       int
 		NumGoroutine int
 		MemStats     *runtime.MemStats
 		Peerings     []peering.Link
+		PeerInfos    map[netip.Addr]*m.RouterInfo
+		PeerGeo      map[netip.Addr]geoip.Verification
 		Connections  []router.ExportedConnection
+		Denied       []router.DeniedAttempts
+		PeerFailures []peering.ConnectFailure
+
+		ActiveConnections int
+		RecentConnections int
 	}{
 		RequestToken: rToken,
 		NumCPU:       runtime.NumCPU(),
 		NumGoroutine: runtime.NumGoroutine(),
 		MemStats:     memStats,
-		Peerings:     d.instance.Peering().GetLinks(),
-		Connections:  d.instance.Router().ExportConnections(3 * time.Minute),
+		Peerings:     links,
+		PeerInfos:    peerInfos,
+		PeerGeo:      d.instance.Peering().GeoVerifications(),
+		Connections:  conns,
+		Denied:       denied,
+		PeerFailures: d.instance.Peering().ConnectFailures(),
+
+		ActiveConnections: activeConns,
+		RecentConnections: recentConns,
 	})
 }
 
@@ -136,13 +193,15 @@ func (d *Dashboard) discoverPage(w http.ResponseWriter, r *http.Request) {
 
 func (d *Dashboard) tablePage(w http.ResponseWriter, r *http.Request) {
 	d.render(w, r, "table", struct {
-		Table string
-		Stub  bool
-		Lite  bool
+		Table     string
+		HoldDowns int
+		Stub      bool
+		Lite      bool
 	}{
-		Table: d.instance.Router().Table().Format(),
-		Stub:  d.instance.Config().Router.Stub,
-		Lite:  d.instance.Config().Router.Lite,
+		Table:     d.instance.Router().Table().Format(),
+		HoldDowns: len(d.instance.Router().Table().HoldDowns()),
+		Stub:      d.instance.Config().IsStub(),
+		Lite:      d.instance.Config().Router.Lite,
 	})
 }
 
@@ -174,6 +233,12 @@ func (d *Dashboard) infoPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var dnsStats *dns.Stats
+	if dnsServer := d.instance.DNS(); dnsServer != nil {
+		stats := dnsServer.Stats()
+		dnsStats = &stats
+	}
+
 	d.render(w, r, "info", struct {
 		BuildInfo     *debug.BuildInfo
 		BuildSettings map[string]string
@@ -181,6 +246,9 @@ func (d *Dashboard) infoPage(w http.ResponseWriter, r *http.Request) {
 		NumGoroutine  int
 		MemStats      *runtime.MemStats
 		ConfigStore   string
+		DNSCache      dns.MappingCacheStats
+		DNSServer     *dns.Stats
+		Update        updater.Status
 	}{
 		BuildInfo:     buildInfo,
 		BuildSettings: buildSettings,
@@ -188,5 +256,8 @@ func (d *Dashboard) infoPage(w http.ResponseWriter, r *http.Request) {
 		NumGoroutine:  runtime.NumGoroutine(),
 		MemStats:      memStats,
 		ConfigStore:   string(configStoreYaml),
+		DNSCache:      d.instance.Mappings().Stats(),
+		DNSServer:     dnsStats,
+		Update:        d.instance.Updater().Status(),
 	})
 }
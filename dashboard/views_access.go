@@ -0,0 +1,284 @@
+package dashboard
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/listeners"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/router"
+)
+
+func (d *Dashboard) accessPage(w http.ResponseWriter, r *http.Request) {
+	d.renderAccessPage(w, r, accessPageData{})
+}
+
+func (d *Dashboard) renderAccessPage(w http.ResponseWriter, r *http.Request, data accessPageData) {
+	// Create request token.
+	rToken, err := d.CreateRequestToken(
+		"manage access requests",
+	)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create request token: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Add page data.
+	data.RequestToken = rToken
+	data.AccessRequests = d.instance.Router().ExportAccessRequests()
+	data.GuestAccess = d.instance.Router().AccessPing.ExportGuestAccess()
+	data.Services = d.instance.Config().GetServices()
+	data.ServiceUsage = d.instance.Router().ServiceUsage()
+	data.DeniedAttempts = d.instance.Router().ExportDeniedAttempts()
+	data.BlockedScanners = d.instance.Router().ExportBlockedScanners()
+	if prompts := d.instance.Config().OutboundPrompts; prompts.Enabled {
+		data.PromptOutbound = true
+		data.PromptTimeoutAllow = prompts.TimeoutAllow
+		data.OutboundPrompts = d.instance.Router().ExportOutboundPrompts()
+	}
+	if d.instance.Config().System.DiscoverServices {
+		d.addDiscoveredServices(&data)
+	}
+
+	d.render(w, r, "access", data)
+}
+
+func (d *Dashboard) addDiscoveredServices(data *accessPageData) {
+	discovered, err := listeners.Discover()
+	if err != nil {
+		data.DiscoveryError = err.Error()
+		return
+	}
+
+	// Skip peering listeners.
+	var ownPorts []uint16
+	for _, listen := range d.instance.Config().Router.Listen {
+		if u, err := url.Parse(listen); err == nil {
+			if port, err := strconv.ParseUint(u.Port(), 10, 16); err == nil {
+				ownPorts = append(ownPorts, uint16(port))
+			}
+		}
+	}
+
+	data.ProposedServices = listeners.Propose(discovered, d.instance.Identity().IP, d.instance.Config(), ownPorts)
+	if len(data.ProposedServices) == 0 {
+		return
+	}
+	services := make([]config.ServiceConfig, 0, len(data.ProposedServices))
+	for _, proposal := range data.ProposedServices {
+		services = append(services, proposal.Service)
+	}
+	snippet, err := yaml.Marshal(config.Store{ServiceConfigs: services})
+	if err != nil {
+		data.DiscoveryError = err.Error()
+		return
+	}
+	data.ProposedConfig = string(snippet)
+}
+
+type accessPageData struct {
+	*RequestToken
+	AccessRequests  []router.AccessRequest
+	GuestAccess     []router.GuestAccess
+	Services        []config.Service
+	ServiceUsage    []router.ServiceUsage
+	DeniedAttempts  []router.DeniedAttempts
+	BlockedScanners []router.BlockedScanner
+
+	PromptOutbound     bool
+	PromptTimeoutAllow bool
+	OutboundPrompts    []router.OutboundPrompt
+
+	ProposedServices []listeners.Proposal
+	ProposedConfig   string
+	DiscoveryError   string
+
+	GuestToken    string
+	RedeemExpires time.Time
+	Knocked       string
+}
+
+func (d *Dashboard) accessManage(w http.ResponseWriter, r *http.Request) {
+	// Parse from data.
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse form data: %s.", err), http.StatusInternalServerError)
+		return
+	}
+	nonce := r.Form.Get("nonce")
+	token := r.Form.Get("token")
+
+	// Check if request token matches.
+	if !d.CheckRequestToken(
+		nonce,
+		token,
+		"manage access requests",
+	) {
+		http.Error(w, "Token mismatch.", http.StatusBadRequest)
+		return
+	}
+
+	// Handle guest token actions.
+	switch r.Form.Get("action") {
+	case "mint-guest-token":
+		d.accessMintGuestToken(w, r)
+		return
+	case "redeem-guest-token":
+		d.accessRedeemGuestToken(w, r)
+		return
+	case "knock":
+		d.accessKnock(w, r)
+		return
+	case "allow-outbound", "deny-outbound":
+		d.accessDecideOutbound(w, r)
+		return
+	case "unblock":
+		routerIP, err := netip.ParseAddr(r.Form.Get("router"))
+		if err != nil {
+			http.Error(w, "Invalid router.", http.StatusBadRequest)
+			return
+		}
+		d.instance.Router().UnblockScanner(routerIP)
+		d.accessPage(w, r)
+		return
+	}
+
+	// Get router and service.
+	routerIP, err := netip.ParseAddr(r.Form.Get("router"))
+	if err != nil {
+		http.Error(w, "Invalid router.", http.StatusBadRequest)
+		return
+	}
+	service := r.Form.Get("service")
+	if service == "" {
+		http.Error(w, "Service missing.", http.StatusBadRequest)
+		return
+	}
+
+	// Execute manage action
+	switch r.Form.Get("action") {
+	case "approve":
+		err := d.instance.Router().ApproveAccessRequest(routerIP, service)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to approve access request: %s", err), http.StatusInternalServerError)
+			return
+		}
+	case "dismiss":
+		err := d.instance.Router().DismissAccessRequest(routerIP, service)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to dismiss access request: %s", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Unknown action.", http.StatusBadRequest)
+		return
+	}
+
+	d.accessPage(w, r)
+}
+
+func (d *Dashboard) accessDecideOutbound(w http.ResponseWriter, r *http.Request) {
+	routerIP, err := netip.ParseAddr(r.Form.Get("router"))
+	if err != nil {
+		http.Error(w, "Invalid router.", http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("action") == "allow-outbound" {
+		err = d.instance.Router().AllowOutbound(routerIP)
+	} else {
+		err = d.instance.Router().DenyOutbound(routerIP)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to decide on outgoing connections: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	d.accessPage(w, r)
+}
+
+func (d *Dashboard) accessMintGuestToken(w http.ResponseWriter, r *http.Request) {
+	// Get parameters.
+	service := r.Form.Get("service")
+	if _, ok := d.instance.Config().GetService(service); !ok {
+		http.Error(w, "Unknown service.", http.StatusBadRequest)
+		return
+	}
+	validFor, err := time.ParseDuration(r.Form.Get("valid"))
+	if err != nil {
+		http.Error(w, "Invalid validity duration.", http.StatusBadRequest)
+		return
+	}
+	var guest netip.Addr
+	if guestParam := r.Form.Get("guest"); guestParam != "" {
+		guest, err = netip.ParseAddr(guestParam)
+		if err != nil || !m.RoutingAddressPrefix.Contains(guest) {
+			http.Error(w, "Invalid guest router.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Mint token.
+	token, err := m.MintGuestToken(d.instance.Identity(), service, guest, validFor)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to mint guest token: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	d.renderAccessPage(w, r, accessPageData{
+		GuestToken: token,
+	})
+}
+
+func (d *Dashboard) accessRedeemGuestToken(w http.ResponseWriter, r *http.Request) {
+	// Redeem token at issuer.
+	expires, err := d.instance.Router().AccessPing.Redeem(r.Form.Get("guest-token"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to redeem guest token: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	d.renderAccessPage(w, r, accessPageData{
+		RedeemExpires: expires,
+	})
+}
+
+func (d *Dashboard) accessKnock(w http.ResponseWriter, r *http.Request) {
+	// Get parameters.
+	routerIP, err := netip.ParseAddr(r.Form.Get("router"))
+	if err != nil || !m.RoutingAddressPrefix.Contains(routerIP) {
+		http.Error(w, "Invalid router.", http.StatusBadRequest)
+		return
+	}
+	var protocol uint8
+	switch r.Form.Get("protocol") {
+	case "tcp":
+		protocol = 6
+	case "udp":
+		protocol = 17
+	default:
+		http.Error(w, "Invalid protocol.", http.StatusBadRequest)
+		return
+	}
+	port, err := strconv.ParseUint(r.Form.Get("port"), 10, 16)
+	if err != nil {
+		http.Error(w, "Invalid port.", http.StatusBadRequest)
+		return
+	}
+
+	// Send knock.
+	if err := d.instance.Router().KnockPing.Send(routerIP, protocol, uint16(port)); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to knock: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	d.renderAccessPage(w, r, accessPageData{
+		Knocked: fmt.Sprintf("%s:%d at %s", r.Form.Get("protocol"), port, routerIP),
+	})
+}
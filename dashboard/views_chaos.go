@@ -0,0 +1,137 @@
+package dashboard
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/mycoria/mycoria/peering"
+)
+
+func (d *Dashboard) chaosPage(w http.ResponseWriter, r *http.Request) {
+	// Only available in dev mode.
+	if !d.instance.Config().DevMode() {
+		http.Error(w, "Fault injection is only available in development mode.", http.StatusNotFound)
+		return
+	}
+
+	// Create request token.
+	rToken, err := d.CreateRequestToken(
+		"manage chaos",
+	)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create request token: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	d.render(w, r, "chaos", struct {
+		*RequestToken
+		Peerings []peering.Link
+		Chaos    []peering.LinkChaos
+	}{
+		RequestToken: rToken,
+		Peerings:     d.instance.Peering().GetLinks(),
+		Chaos:        d.instance.Peering().ExportLinkChaos(),
+	})
+}
+
+func (d *Dashboard) chaosManage(w http.ResponseWriter, r *http.Request) {
+	// Only available in dev mode.
+	if !d.instance.Config().DevMode() {
+		http.Error(w, "Fault injection is only available in development mode.", http.StatusNotFound)
+		return
+	}
+
+	// Parse from data.
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse form data: %s.", err), http.StatusInternalServerError)
+		return
+	}
+	nonce := r.Form.Get("nonce")
+	token := r.Form.Get("token")
+
+	// Check if request token matches.
+	if !d.CheckRequestToken(
+		nonce,
+		token,
+		"manage chaos",
+	) {
+		http.Error(w, "Token mismatch.", http.StatusBadRequest)
+		return
+	}
+
+	// Get peer.
+	peer, err := netip.ParseAddr(r.Form.Get("peer"))
+	if err != nil {
+		http.Error(w, "Invalid peer.", http.StatusBadRequest)
+		return
+	}
+
+	// Execute manage action
+	switch r.Form.Get("action") {
+	case "set":
+		cfg, err := parseChaosForm(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid fault injection settings: %s.", err), http.StatusBadRequest)
+			return
+		}
+		if err := d.instance.Peering().SetLinkChaos(peer, cfg); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to enable fault injection: %s", err), http.StatusInternalServerError)
+			return
+		}
+	case "clear":
+		if err := d.instance.Peering().ClearLinkChaos(peer); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to disable fault injection: %s", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Unknown action.", http.StatusBadRequest)
+		return
+	}
+
+	d.chaosPage(w, r)
+}
+
+func parseChaosForm(r *http.Request) (cfg peering.ChaosConfig, err error) {
+	parsePercent := func(name string) (float64, error) {
+		value := r.Form.Get(name)
+		if value == "" {
+			return 0, nil
+		}
+		percent, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s", name)
+		}
+		return percent / 100, nil
+	}
+	parseDuration := func(name string) (time.Duration, error) {
+		value := r.Form.Get(name)
+		if value == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s", name)
+		}
+		return d, nil
+	}
+
+	if cfg.Loss, err = parsePercent("loss"); err != nil {
+		return cfg, err
+	}
+	if cfg.Duplicate, err = parsePercent("duplicate"); err != nil {
+		return cfg, err
+	}
+	if cfg.Reorder, err = parsePercent("reorder"); err != nil {
+		return cfg, err
+	}
+	if cfg.Latency, err = parseDuration("latency"); err != nil {
+		return cfg, err
+	}
+	if cfg.Jitter, err = parseDuration("jitter"); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
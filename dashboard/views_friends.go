@@ -0,0 +1,87 @@
+package dashboard
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+func (d *Dashboard) friendsPage(w http.ResponseWriter, r *http.Request) {
+	d.renderFriendsPage(w, r, "")
+}
+
+func (d *Dashboard) renderFriendsPage(w http.ResponseWriter, r *http.Request, saveError string) {
+	// Create request token.
+	rToken, err := d.CreateRequestToken(
+		"manage friends",
+	)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create request token: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	d.render(w, r, "friends", struct {
+		*RequestToken
+		Friends   []config.Friend
+		SaveError string
+	}{
+		RequestToken: rToken,
+		Friends:      d.instance.Config().GetFriends(),
+		SaveError:    saveError,
+	})
+}
+
+func (d *Dashboard) friendsManage(w http.ResponseWriter, r *http.Request) {
+	// Parse from data.
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse form data: %s.", err), http.StatusInternalServerError)
+		return
+	}
+	nonce := r.Form.Get("nonce")
+	token := r.Form.Get("token")
+
+	// Check if request token matches.
+	if !d.CheckRequestToken(
+		nonce,
+		token,
+		"manage friends",
+	) {
+		http.Error(w, "Token mismatch.", http.StatusBadRequest)
+		return
+	}
+
+	// Execute manage action
+	name := strings.TrimSpace(r.Form.Get("name"))
+	switch r.Form.Get("action") {
+	case "add":
+		ip, err := netip.ParseAddr(strings.TrimSpace(r.Form.Get("ip")))
+		if err != nil {
+			http.Error(w, "Invalid IP address.", http.StatusBadRequest)
+			return
+		}
+		if err := d.instance.Router().AddFriend(config.Friend{Name: name, IP: ip}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to add friend: %s.", err), http.StatusBadRequest)
+			return
+		}
+	case "remove":
+		if err := d.instance.Router().RemoveFriend(name); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to remove friend: %s.", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Unknown action.", http.StatusBadRequest)
+		return
+	}
+
+	// Persist change to config file.
+	var saveError string
+	if err := d.instance.Config().Save(); err != nil && !errors.Is(err, config.ErrNoConfigFile) {
+		saveError = err.Error()
+	}
+
+	d.renderFriendsPage(w, r, saveError)
+}
@@ -0,0 +1,81 @@
+package dashboard
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mycoria/mycoria/storage"
+)
+
+func (d *Dashboard) linksPage(w http.ResponseWriter, r *http.Request) {
+	// Parse query.
+	data := linksPageData{
+		Days:        30,
+		DaysOptions: []int{1, 7, 30, 90},
+	}
+	if value := r.URL.Query().Get("days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			http.Error(w, "Invalid days.", http.StatusBadRequest)
+			return
+		}
+		data.Days = days
+	}
+	if value := r.URL.Query().Get("peer"); value != "" {
+		peer, err := netip.ParseAddr(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid peer: %s.", err), http.StatusBadRequest)
+			return
+		}
+		data.Peer = peer
+	}
+	since := time.Now().Add(-time.Duration(data.Days) * 24 * time.Hour)
+
+	// Get sessions of all peers, as the summary always lists all peers.
+	sessions, err := d.instance.Peering().GetLinkHistory(netip.Addr{}, since)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get link history: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Summarize per peer and select sessions of the selected peer.
+	byPeer := make(map[netip.Addr][]storage.StoredLinkSession)
+	for _, session := range sessions {
+		byPeer[session.Peer] = append(byPeer[session.Peer], session)
+	}
+	for peer, peerSessions := range byPeer {
+		summary := storage.SummarizeLinkSessions(peer, peerSessions, since)
+		data.Summaries = append(data.Summaries, linkSummary{
+			LinkSessionSummary:  summary,
+			AvailabilityPercent: summary.Availability * 100,
+		})
+	}
+	slices.SortFunc(data.Summaries, func(a, b linkSummary) int {
+		return a.Peer.Compare(b.Peer)
+	})
+	if data.Peer.IsValid() {
+		data.Sessions = byPeer[data.Peer]
+		// Show the newest sessions first.
+		slices.Reverse(data.Sessions)
+	}
+
+	d.render(w, r, "links", data)
+}
+
+type linksPageData struct {
+	Days        int
+	DaysOptions []int
+	Peer        netip.Addr
+
+	Summaries []linkSummary
+	Sessions  []storage.StoredLinkSession
+}
+
+type linkSummary struct {
+	storage.LinkSessionSummary
+	AvailabilityPercent float64
+}
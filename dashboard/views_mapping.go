@@ -1,7 +1,9 @@
 package dashboard
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/netip"
 	"strings"
@@ -11,12 +13,28 @@ import (
 	"github.com/mycoria/mycoria/api/dns"
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/m"
-	"github.com/mycoria/mycoria/storage"
 )
 
+type mappingsPageData struct {
+	*RequestToken
+
+	Mappings []dns.Mapping
+	Notice   string
+	Errors   []string
+}
+
 func (d *Dashboard) mappingsPage(w http.ResponseWriter, r *http.Request) {
+	d.renderMappingsPage(w, r, "")
+}
+
+func (d *Dashboard) renderMappingsPage(w http.ResponseWriter, r *http.Request, notice string, errs ...string) {
+	if d.instance.DNS() == nil {
+		http.Error(w, "DNS server is disabled.", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Get mappings.
-	mappings, err := d.instance.Storage().QueryMappings("")
+	mappings, err := d.instance.DNS().Mappings()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to get mappings: %s", err), http.StatusInternalServerError)
 		return
@@ -42,18 +60,24 @@ func (d *Dashboard) mappingsPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	d.render(w, r, "mappings", struct {
-		*RequestToken
-		Mappings []storage.StoredMapping
-	}{
+	d.render(w, r, "mappings", mappingsPageData{
 		RequestToken: rToken,
 		Mappings:     mappings,
+		Notice:       notice,
+		Errors:       errs,
 	})
 }
 
 func (d *Dashboard) mappingsManage(w http.ResponseWriter, r *http.Request) {
 	// Parse from data.
-	if err := r.ParseForm(); err != nil {
+	// The import form uploads a file.
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = r.ParseMultipartForm(maxMappingImportSize)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to parse form data: %s.", err), http.StatusInternalServerError)
 		return
 	}
@@ -70,25 +94,61 @@ func (d *Dashboard) mappingsManage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	srv := d.instance.DNS()
+	if srv == nil {
+		http.Error(w, "DNS server is disabled.", http.StatusServiceUnavailable)
+		return
+	}
+	tr := d.translator(r)
+
+	// Import does not operate on a single domain.
+	if r.Form.Get("action") == "import" {
+		d.mappingsImport(w, r, srv)
+		return
+	}
+
 	// Get domain.
-	domain := r.Form.Get("domain")
+	domain := toPunycode(r.Form.Get("domain"))
 	if domain == "" {
 		http.Error(w, "Domain missing.", http.StatusBadRequest)
 		return
 	}
-	punyDomain, err := idna.ToASCII(domain)
-	if err == nil {
-		domain = punyDomain
-	}
 
 	// Execute manage action
 	switch r.Form.Get("action") {
 	case "delete":
-		err := d.instance.Storage().DeleteMapping(domain)
+		err := srv.DeleteMapping(domain)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to delete %s: %s", domain, err), http.StatusInternalServerError)
 			return
 		}
+
+	case "approve":
+		var router netip.Addr
+		if routerIP := r.Form.Get("router"); routerIP != "" {
+			router, err = netip.ParseAddr(routerIP)
+			if err != nil {
+				d.renderMappingsPage(w, r, "", tr("Invalid router address: %s", err))
+				return
+			}
+		}
+		mapping, err := srv.ApproveMapping(domain, router)
+		if err != nil {
+			d.renderMappingsPage(w, r, "", tr("Failed to approve %s: %s", domain, err))
+			return
+		}
+		d.renderMappingsPage(w, r, tr("%s is now mapped to %s.", mapping.Domain, mapping.Router))
+		return
+
+	case "rename":
+		mapping, err := srv.RenameMapping(domain, toPunycode(r.Form.Get("new-domain")))
+		if err != nil {
+			d.renderMappingsPage(w, r, "", tr("Failed to rename %s: %s", domain, err))
+			return
+		}
+		d.renderMappingsPage(w, r, tr("Renamed %s to %s.", domain, mapping.Domain))
+		return
+
 	default:
 		http.Error(w, "Unknown action.", http.StatusBadRequest)
 		return
@@ -97,6 +157,66 @@ func (d *Dashboard) mappingsManage(w http.ResponseWriter, r *http.Request) {
 	d.mappingsPage(w, r)
 }
 
+// maxMappingImportSize is the maximum size of an uploaded mapping export.
+const maxMappingImportSize = 10_000_000
+
+func (d *Dashboard) mappingsImport(w http.ResponseWriter, r *http.Request, srv *dns.Server) {
+	tr := d.translator(r)
+
+	// Read uploaded export.
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		d.renderMappingsPage(w, r, "", tr("Failed to read uploaded file: %s", err))
+		return
+	}
+	defer file.Close() //nolint:errcheck
+	var mappings []dns.Mapping
+	if err := json.NewDecoder(io.LimitReader(file, maxMappingImportSize)).Decode(&mappings); err != nil {
+		d.renderMappingsPage(w, r, "", tr("Failed to parse uploaded file: %s", err))
+		return
+	}
+
+	// Import and report.
+	result := srv.ImportMappings(mappings, r.Form.Get("overwrite") == "on")
+	notice := tr("Imported %d mappings, %d unchanged, %d skipped.", result.Imported, result.Unchanged, result.Skipped)
+	d.renderMappingsPage(w, r, notice, result.Errors...)
+}
+
+func (d *Dashboard) mappingsExport(w http.ResponseWriter, r *http.Request) {
+	if d.instance.DNS() == nil {
+		http.Error(w, "DNS server is disabled.", http.StatusServiceUnavailable)
+		return
+	}
+
+	mappings, err := d.instance.DNS().Mappings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get mappings: %s", err), http.StatusInternalServerError)
+		return
+	}
+	// Conflicts are specific to the current state of the network.
+	for i := range mappings {
+		mappings[i].AdvertisedBy = nil
+	}
+
+	data, err := json.MarshalIndent(mappings, "", "  ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to export mappings: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="mycoria-mappings.json"`)
+	_, _ = w.Write(data)
+}
+
+// toPunycode converts the given (IDN) domain to punycode, if possible.
+func toPunycode(domain string) string {
+	punyDomain, err := idna.ToASCII(domain)
+	if err == nil {
+		return punyDomain
+	}
+	return domain
+}
+
 type openMappingData struct {
 	*RequestToken
 
@@ -232,7 +352,7 @@ func (d *Dashboard) mappingOpenSet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save new mapping.
-	err = d.instance.Storage().SaveMapping(cleanedDomain, routerIP)
+	err = d.instance.Mappings().SaveMapping(cleanedDomain, routerIP)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to save domain mapping: %s", err), http.StatusBadRequest)
 		return
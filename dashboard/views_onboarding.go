@@ -0,0 +1,397 @@
+package dashboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/tun"
+)
+
+const (
+	// onboardingMarkerName is the name of the file in the state directory
+	// that records that onboarding was completed.
+	onboardingMarkerName = "onboarded"
+
+	onboardingPingTimeout = 3 * time.Second
+	onboardingDNSTimeout  = 2 * time.Second
+	onboardingInviteValid = 7 * 24 * time.Hour
+)
+
+// Onboarding steps.
+const (
+	onboardingStepIdentity     = "identity"
+	onboardingStepConnectivity = "connectivity"
+	onboardingStepFriends      = "friends"
+	onboardingStepHealth       = "health"
+)
+
+var onboardingSteps = []string{
+	onboardingStepIdentity,
+	onboardingStepConnectivity,
+	onboardingStepFriends,
+	onboardingStepHealth,
+}
+
+// initOnboarding checks if onboarding was already completed.
+// Routers that already have friends are not new and skip onboarding.
+func (d *Dashboard) initOnboarding() {
+	if len(d.instance.Config().GetFriends()) > 0 {
+		d.onboarded.Store(true)
+		return
+	}
+	if marker := d.onboardingMarkerPath(); marker != "" {
+		if _, err := os.Stat(marker); err == nil {
+			d.onboarded.Store(true)
+		}
+	}
+}
+
+// onboardingMarkerPath returns the path of the onboarding marker file.
+// Returns an empty string if no state is persisted.
+func (d *Dashboard) onboardingMarkerPath() string {
+	statePath := d.instance.Config().System.StatePath
+	if statePath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(statePath), onboardingMarkerName)
+}
+
+// completeOnboarding marks onboarding as completed.
+func (d *Dashboard) completeOnboarding() error {
+	d.onboarded.Store(true)
+
+	marker := d.onboardingMarkerPath()
+	if marker == "" {
+		return nil
+	}
+	return os.WriteFile(marker, []byte(time.Now().Format(time.RFC3339)+"\n"), 0o0600) //nolint:gosec
+}
+
+// redirectToOnboarding redirects browsers to the onboarding wizard, if
+// onboarding was not completed yet. Returns whether the request was handled.
+func (d *Dashboard) redirectToOnboarding(w http.ResponseWriter, r *http.Request) bool {
+	if d.onboarded.Load() || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	http.Redirect(w, r, "/onboarding", http.StatusSeeOther)
+	return true
+}
+
+type onboardingPageData struct {
+	*RequestToken
+
+	Step     string
+	Steps    []string
+	StepNum  int
+	NextStep string
+	PrevStep string
+
+	// Identity
+	RouterIP  netip.Addr
+	Universe  string
+	APIDomain string
+	TLD       string
+
+	// Connectivity
+	Peers       []onboardingPeerCheck
+	Listeners   []string
+	Connect     []string
+	Bootstrap   []string
+	PeeringHint string
+
+	// Friends
+	Friends    []config.Friend
+	Invite     string
+	InviteName string
+	Added      string
+	Error      string
+	SaveError  string
+
+	// Health
+	Checks []onboardingCheck
+}
+
+// onboardingPeerCheck holds the result of a connectivity test to a peer.
+type onboardingPeerCheck struct {
+	Peer    netip.Addr
+	OK      bool
+	Latency time.Duration
+	Error   string
+}
+
+// onboardingCheck holds the result of a health check.
+type onboardingCheck struct {
+	Name   string
+	OK     bool
+	Result string
+	Fix    string
+}
+
+func (d *Dashboard) onboardingPage(w http.ResponseWriter, r *http.Request) {
+	d.renderOnboardingPage(w, r, r.URL.Query().Get("step"), onboardingPageData{})
+}
+
+func (d *Dashboard) renderOnboardingPage(w http.ResponseWriter, r *http.Request, step string, data onboardingPageData) {
+	// Create request token.
+	rToken, err := d.CreateRequestToken(
+		"manage onboarding",
+	)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create request token: %s", err), http.StatusInternalServerError)
+		return
+	}
+	data.RequestToken = rToken
+
+	// Find step.
+	data.Steps = onboardingSteps
+	data.Step = onboardingStepIdentity
+	for i, s := range onboardingSteps {
+		if s != step {
+			continue
+		}
+		data.Step = s
+		data.StepNum = i
+		if i > 0 {
+			data.PrevStep = onboardingSteps[i-1]
+		}
+	}
+	if data.StepNum+1 < len(onboardingSteps) {
+		data.NextStep = onboardingSteps[data.StepNum+1]
+	}
+
+	// Add step data.
+	c := d.instance.Config()
+	tr := d.translator(r)
+	switch data.Step {
+	case onboardingStepIdentity:
+		data.RouterIP = d.instance.Identity().IP
+		data.Universe = c.Router.Universe
+		data.APIDomain = "router" + config.DefaultDotTLD
+		data.TLD = config.DefaultDotTLD
+
+	case onboardingStepConnectivity:
+		data.Peers = d.checkPeers(r.Context(), tr)
+		data.Listeners = c.Router.Listen
+		data.Connect = c.Router.Connect
+		data.Bootstrap = c.Router.Bootstrap
+		if len(data.Peers) == 0 {
+			if len(data.Connect) == 0 && len(data.Bootstrap) == 0 && !c.Router.AutoConnect {
+				data.PeeringHint = tr("No peering URLs are configured. Add a router to connect to in router.connect or router.bootstrap of your config and restart Mycoria.")
+			} else {
+				data.PeeringHint = tr("No peers are connected. Check your internet connection and make sure that outgoing TCP connections to the configured peering URLs are not blocked by a firewall.")
+			}
+		}
+
+	case onboardingStepFriends:
+		data.Friends = c.GetFriends()
+
+	case onboardingStepHealth:
+		data.Checks = d.checkHealth(r.Context(), tr)
+	}
+
+	d.render(w, r, "onboarding", data)
+}
+
+func (d *Dashboard) onboardingManage(w http.ResponseWriter, r *http.Request) {
+	// Parse from data.
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse form data: %s.", err), http.StatusInternalServerError)
+		return
+	}
+	nonce := r.Form.Get("nonce")
+	token := r.Form.Get("token")
+
+	// Check if request token matches.
+	if !d.CheckRequestToken(
+		nonce,
+		token,
+		"manage onboarding",
+	) {
+		http.Error(w, "Token mismatch.", http.StatusBadRequest)
+		return
+	}
+
+	// Execute manage action
+	tr := d.translator(r)
+	var data onboardingPageData
+	switch r.Form.Get("action") {
+	case "create-invite":
+		data.InviteName = strings.TrimSpace(r.Form.Get("name"))
+		if data.InviteName != "" {
+			if err := config.CheckFriendName(data.InviteName); err != nil {
+				data.Error = tr("Invalid name: %s.", err)
+				break
+			}
+		}
+		code, err := m.MintInvite(
+			d.instance.Identity(),
+			data.InviteName,
+			d.instance.Config().InvitePeeringURLs(),
+			onboardingInviteValid,
+		)
+		if err != nil {
+			data.Error = tr("Failed to create invite: %s.", err)
+			break
+		}
+		data.Invite = code
+
+	case "accept-invite":
+		inv, err := m.ParseInvite(r.Form.Get("invite"))
+		if err != nil {
+			data.Error = tr("Invalid invite: %s.", err)
+			break
+		}
+		name := strings.TrimSpace(r.Form.Get("name"))
+		if name == "" {
+			name = inv.Name
+		}
+		if name == "" {
+			data.Error = tr("The invite does not suggest a name, please enter one.")
+			break
+		}
+		err = d.instance.Router().AddFriend(config.Friend{
+			Name:    name,
+			IP:      inv.Router.IP,
+			Address: &inv.Router,
+		})
+		if err != nil {
+			data.Error = tr("Failed to add friend: %s.", err)
+			break
+		}
+		data.Added = name + config.DefaultDotTLD
+
+		// Persist change to config file.
+		if err := d.instance.Config().Save(); err != nil && !errors.Is(err, config.ErrNoConfigFile) {
+			data.SaveError = err.Error()
+		}
+
+	case "finish":
+		if err := d.completeOnboarding(); err != nil {
+			d.mgr.Warn(
+				"failed to save onboarding marker",
+				"err", err,
+			)
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+
+	default:
+		http.Error(w, "Unknown action.", http.StatusBadRequest)
+		return
+	}
+
+	d.renderOnboardingPage(w, r, onboardingStepFriends, data)
+}
+
+// checkPeers pings all connected peers in parallel.
+func (d *Dashboard) checkPeers(ctx context.Context, tr translator) []onboardingPeerCheck {
+	links := d.instance.Peering().GetLinks()
+	checks := make([]onboardingPeerCheck, len(links))
+
+	var wg sync.WaitGroup
+	for i, link := range links {
+		checks[i].Peer = link.Peer()
+
+		wg.Add(1)
+		go func(check *onboardingPeerCheck) {
+			defer wg.Done()
+
+			started := time.Now()
+			notify, _, err := d.instance.Router().PingPong.Send(check.Peer, true, 0)
+			if err != nil {
+				check.Error = err.Error()
+				return
+			}
+			select {
+			case <-notify:
+				check.OK = true
+				check.Latency = time.Since(started).Round(time.Millisecond)
+			case <-time.After(onboardingPingTimeout):
+				check.Error = tr("no response")
+			case <-ctx.Done():
+				check.Error = tr("canceled")
+			}
+		}(&checks[i])
+	}
+	wg.Wait()
+
+	return checks
+}
+
+// checkHealth checks if the tun device and DNS are working and suggests fixes.
+func (d *Dashboard) checkHealth(ctx context.Context, tr translator) []onboardingCheck {
+	c := d.instance.Config()
+	checks := make([]onboardingCheck, 0, 2)
+
+	// Check tun device.
+	tunName := c.System.TunName
+	if tunName == "" {
+		tunName = tun.DefaultTunName
+	}
+	tunCheck := onboardingCheck{Name: tr("Network Interface")}
+	switch iface, err := net.InterfaceByName(tunName); {
+	case c.System.DisableTun:
+		tunCheck.Result = tr("The network interface is disabled.")
+		tunCheck.Fix = tr("Remove system.disableTun from your config and restart Mycoria to access the network from this device.")
+	case d.instance.TunDevice() == nil || err != nil:
+		tunCheck.Result = tr("The network interface %s was not found.", tunName)
+		tunCheck.Fix = tr("Check the Mycoria logs for errors when creating the interface. Mycoria needs to run as root or administrator.")
+	case iface.Flags&net.FlagUp == 0:
+		tunCheck.Result = tr("The network interface %s is down.", tunName)
+		tunCheck.Fix = tr("Restart Mycoria. If the problem persists, check if another program manages the interface.")
+	default:
+		tunCheck.OK = true
+		tunCheck.Result = tr("The network interface %s is up.", tunName)
+	}
+	checks = append(checks, tunCheck)
+
+	// Check if the system resolves .myco domains using our DNS server.
+	apiDomain := "router" + config.DefaultDotTLD
+	dnsCheck := onboardingCheck{Name: tr("DNS")}
+	lookupCtx, cancel := context.WithTimeout(ctx, onboardingDNSTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(lookupCtx, "ip6", apiDomain)
+	switch {
+	case err != nil:
+		dnsCheck.Result = tr("%s could not be resolved: %s", apiDomain, err)
+		dnsCheck.Fix = dnsFixHint(tr, tunName)
+	case len(ips) == 0 || ips[0].Unmap() != config.DefaultAPIAddress:
+		dnsCheck.Result = tr("%s resolves to the wrong address: %s", apiDomain, ips)
+		dnsCheck.Fix = dnsFixHint(tr, tunName)
+	default:
+		dnsCheck.OK = true
+		dnsCheck.Result = tr("%s domains are resolved by Mycoria.", config.DefaultDotTLD)
+	}
+	checks = append(checks, dnsCheck)
+
+	return checks
+}
+
+func dnsFixHint(tr translator, tunName string) string {
+	switch runtime.GOOS {
+	case "linux":
+		return tr(
+			"Configure your system to resolve .myco domains with %s, eg. with systemd-resolved: resolvectl dns %s %s && resolvectl domain %s ~myco",
+			config.DefaultAPIAddress, tunName, config.DefaultAPIAddress, tunName,
+		)
+	case "windows":
+		return tr(
+			"Make sure that DNS server %s of the %s interface is not overridden by a VPN or by secure DNS in your browser.",
+			config.DefaultAPIAddress, tunName,
+		)
+	default:
+		return tr("Configure your system to resolve .myco domains with %s.", config.DefaultAPIAddress)
+	}
+}
@@ -0,0 +1,31 @@
+package dashboard
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+)
+
+// trafficTopTalkers defines how many remote routers are shown.
+const trafficTopTalkers = 50
+
+func (d *Dashboard) trafficPage(w http.ResponseWriter, r *http.Request) {
+	stats := d.instance.Router().FrameStats()
+	d.render(w, r, "traffic", trafficPageData{
+		Since:      stats.Since(),
+		Duration:   time.Since(stats.Since()),
+		Types:      stats.Types(),
+		TopTalkers: stats.TopTalkers(trafficTopTalkers),
+		Untracked:  stats.Untracked(),
+	})
+}
+
+type trafficPageData struct {
+	Since    time.Time
+	Duration time.Duration
+
+	Types      []frame.TypeStats
+	TopTalkers []frame.TalkerStats
+	Untracked  uint64
+}
@@ -0,0 +1,477 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// retryInterval defines how long to wait before discovering a route to
+	// the same destination again.
+	retryInterval = 1 * time.Minute
+	// discoveryTimeout limits how long a single discovery may take.
+	discoveryTimeout = 20 * time.Second
+	// queryTimeout defines how long to wait for the answer to a route query.
+	queryTimeout = 3 * time.Second
+	// probeTimeout defines how long to wait for the response to a probe of
+	// a discovered path.
+	probeTimeout = 5 * time.Second
+	// maxQueries limits the amount of route queries per discovery.
+	maxQueries = 12
+	// maxProbes limits the amount of discovered paths that are probed.
+	maxProbes = 3
+	// discoveryWorkers defines how many discoveries run at the same time.
+	discoveryWorkers = 2
+	// discoveryQueueSize defines how many discoveries may be pending.
+	discoveryQueueSize = 64
+)
+
+// Discovery errors.
+var (
+	ErrNoRouteFound    = m.NewError(m.CodeNoRoute, "no route found")
+	ErrQueryLimit      = errors.New("route query limit reached")
+	ErrQueryNotCapable = errors.New("router does not answer route queries")
+	ErrNoPathToRouter  = m.NewError(m.CodeNoRoute, "no path to queried router")
+)
+
+// Discovery discovers routes to destinations that are not in the routing
+// table. Without a route, frames are sent toward the nearest known router,
+// which may take a long detour or end at a stub. Discovery asks other
+// routers for their routes to the destination, probes the found paths and
+// adds working paths as discovered routes.
+//
+// Which routers are asked is decided by the configured strategies, which are
+// tried in order until a route is found.
+//
+// Discovered routes expire, as they are not refreshed by gossip. Routes in
+// active use are probed and refreshed before they expire.
+type Discovery struct {
+	mgr      *mgr.Manager
+	instance instance
+	network  Network
+	clock    m.Clock
+
+	strategies []Strategy
+	queue      chan netip.Addr
+	attempts   map[netip.Addr]time.Time
+	lock       sync.Mutex
+
+	// lastAttempt is the most recent attempt, which is checked before taking
+	// the lock, as frames to the same destination are usually sent in bursts.
+	lastAttempt atomic.Pointer[attempt]
+}
+
+type attempt struct {
+	dst netip.Addr
+	at  time.Time
+}
+
+// instance is an interface subset of inst.Ance.
+type instance interface {
+	Config() *config.Config
+	Identity() *m.Address
+	RoutingTable() *m.RoutingTable
+}
+
+// Network is used to query other routers and to probe paths.
+// It is implemented by the router.
+type Network interface {
+	// QueryRoute asks the router at the end of the given path for its best
+	// route to the destination. It returns the path of the route, starting
+	// with the queried router, and whether it ends at the destination.
+	QueryRoute(ctx context.Context, dst netip.Addr, via *m.SwitchPath) (path *m.SwitchPath, exact bool, err error)
+	// ProbePath sends a ping to the destination via the given path and
+	// waits for the response.
+	ProbePath(ctx context.Context, dst netip.Addr, path *m.SwitchPath) error
+	// RemoteCapabilities returns the protocol features the given router
+	// supports, if known.
+	RemoteCapabilities(ip netip.Addr) m.Capabilities
+	// ActiveRemotes returns the remote IPs of all connections with traffic
+	// since the given time.
+	ActiveRemotes(since time.Time) map[netip.Addr]struct{}
+}
+
+// Strategy finds paths to a destination by asking other routers.
+type Strategy interface {
+	// Name returns the name the strategy is selected by in the config.
+	Name() string
+	// Discover returns possible paths to the destination of the query.
+	// The paths are probed before they are used.
+	Discover(ctx context.Context, q *Query) ([]*m.SwitchPath, error)
+}
+
+// New returns a new route discovery module using the strategies selected in
+// the config.
+func New(instance instance, network Network) (*Discovery, error) {
+	d := &Discovery{
+		instance: instance,
+		network:  network,
+		clock:    instance.Config().Clock(),
+		queue:    make(chan netip.Addr, discoveryQueueSize),
+		attempts: make(map[netip.Addr]time.Time),
+	}
+
+	for _, name := range instance.Config().DiscoveryStrategies {
+		strategy, err := newStrategy(name)
+		if err != nil {
+			return nil, err
+		}
+		d.strategies = append(d.strategies, strategy)
+	}
+
+	return d, nil
+}
+
+// newStrategy returns the built-in strategy with the given name.
+func newStrategy(name string) (Strategy, error) {
+	switch name {
+	case config.DiscoveryNearest:
+		return &NearestStrategy{}, nil
+	case config.DiscoveryRecursive:
+		return &RecursiveStrategy{}, nil
+	case config.DiscoveryFriends:
+		return &FriendsStrategy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown discovery strategy %q", name)
+	}
+}
+
+// AddStrategy adds a strategy, which is tried after the configured ones.
+// It must be called before the module is started.
+func (d *Discovery) AddStrategy(strategy Strategy) {
+	d.strategies = append(d.strategies, strategy)
+}
+
+// Strategies returns the names of the used strategies, in order.
+func (d *Discovery) Strategies() []string {
+	names := make([]string, 0, len(d.strategies))
+	for _, strategy := range d.strategies {
+		names = append(names, strategy.Name())
+	}
+	return names
+}
+
+// Start starts the route discovery.
+func (d *Discovery) Start(mgr *mgr.Manager) error {
+	d.mgr = mgr
+
+	if len(d.strategies) > 0 {
+		for range discoveryWorkers {
+			mgr.Go("discover routes", d.discoveryWorker)
+		}
+	}
+	mgr.Go("refresh discovered routes", d.refreshWorker)
+
+	return nil
+}
+
+// Stop stops the route discovery.
+func (d *Discovery) Stop(mgr *mgr.Manager) error {
+	return nil
+}
+
+// Trigger queues a discovery of a route to the given destination, unless
+// there was an attempt recently. It does not block and may be called on the
+// hot path.
+func (d *Discovery) Trigger(dst netip.Addr) {
+	if len(d.strategies) == 0 {
+		return
+	}
+	now := d.clock.Now()
+	if last := d.lastAttempt.Load(); last != nil && last.dst == dst && now.Sub(last.at) < retryInterval {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if last, ok := d.attempts[dst]; ok && now.Sub(last) < retryInterval {
+		return
+	}
+
+	select {
+	case d.queue <- dst:
+		d.attempts[dst] = now
+		d.lastAttempt.Store(&attempt{dst: dst, at: now})
+	default:
+		// Queue is full, try again with the next trigger.
+	}
+}
+
+func (d *Discovery) discoveryWorker(w *mgr.WorkerCtx) error {
+	ticker := d.clock.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case dst := <-d.queue:
+			ctx, cancel := context.WithTimeout(w.Ctx(), discoveryTimeout)
+			rte, err := d.Discover(ctx, dst)
+			cancel()
+			if err != nil {
+				w.Debug(
+					"failed to discover route",
+					"dst", dst,
+					"err", err,
+				)
+				continue
+			}
+			w.Info(
+				"discovered route",
+				"dst", dst,
+				"nexthop", rte.NextHop,
+				"hops", rte.Path.TotalHops,
+			)
+
+		case <-ticker.C():
+			d.cleanAttempts()
+
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+func (d *Discovery) cleanAttempts() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := d.clock.Now()
+	for dst, last := range d.attempts {
+		if now.Sub(last) >= retryInterval {
+			delete(d.attempts, dst)
+		}
+	}
+}
+
+// Discover discovers a route to the given destination using the strategies
+// in order and adds the first working path to the routing table.
+func (d *Discovery) Discover(ctx context.Context, dst netip.Addr) (*m.RoutingTableEntry, error) {
+	if !m.RoutingAddressPrefix.Contains(dst) {
+		return nil, fmt.Errorf("dst %s is not routable", dst)
+	}
+	table := d.instance.RoutingTable()
+	if rte, isDestination := table.LookupNearestRoute(dst); isDestination {
+		// Already have a route.
+		return rte, nil
+	}
+
+	q := &Query{
+		Dst: dst,
+		d:   d,
+	}
+	var errs []error
+	for _, strategy := range d.strategies {
+		paths, err := strategy.Discover(ctx, q)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", strategy.Name(), err))
+		}
+		if len(paths) == 0 {
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		rte, err := d.addWorkingPath(ctx, dst, paths)
+		if err == nil {
+			return rte, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", strategy.Name(), err))
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %w", ErrNoRouteFound, errors.Join(errs...))
+	}
+	return nil, ErrNoRouteFound
+}
+
+// addWorkingPath probes the given paths, best first, and adds the first one
+// that works to the routing table.
+func (d *Discovery) addWorkingPath(ctx context.Context, dst netip.Addr, paths []*m.SwitchPath) (*m.RoutingTableEntry, error) {
+	slices.SortStableFunc(paths, func(a, b *m.SwitchPath) int {
+		if a.TotalHops != b.TotalHops {
+			return int(a.TotalHops) - int(b.TotalHops)
+		}
+		return int(a.TotalDelay) - int(b.TotalDelay)
+	})
+
+	var lastErr error
+	for i, path := range paths {
+		if i >= maxProbes {
+			break
+		}
+
+		// Check if the path works.
+		probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		err := d.network.ProbePath(probeCtx, dst, path)
+		cancel()
+		if err != nil {
+			lastErr = fmt.Errorf("probe: %w", err)
+			continue
+		}
+
+		// Add route.
+		now := d.clock.Now()
+		rte := m.RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: path.Hops[1].Router,
+			Path:    *path,
+			Source:  m.RouteSourceDiscovered,
+			Expires: now.Add(discoveredRouteTTL),
+			// The probe proves that the destination is reachable now.
+			Announced: now,
+		}
+		added, err := d.instance.RoutingTable().AddRoute(rte)
+		switch {
+		case err != nil:
+			lastErr = fmt.Errorf("add route: %w", err)
+		case !added:
+			lastErr = errors.New("route was not added to routing table")
+		default:
+			return &rte, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+// Query is a discovery of a route to a destination.
+// It is passed to the strategies and limits the amount of route queries.
+type Query struct {
+	// Dst is the destination to discover a route to.
+	Dst netip.Addr
+
+	d       *Discovery
+	queries int
+	lock    sync.Mutex
+}
+
+// Self returns the IP of this router.
+func (q *Query) Self() netip.Addr {
+	return q.d.instance.Identity().IP
+}
+
+// Table returns the routing table.
+func (q *Query) Table() *m.RoutingTable {
+	return q.d.instance.RoutingTable()
+}
+
+// Friends returns the configured friends.
+func (q *Query) Friends() []config.Friend {
+	return q.d.instance.Config().GetFriends()
+}
+
+// PathTo returns the best known path to the given router.
+func (q *Query) PathTo(router netip.Addr) (*m.SwitchPath, error) {
+	rte, isDestination := q.Table().LookupNearestRoute(router)
+	if !isDestination || len(rte.Path.Hops) < 2 {
+		return nil, ErrNoPathToRouter
+	}
+	path := rte.Path
+	return &path, nil
+}
+
+// Ask asks the router at the end of the given path for its best route to the
+// destination. It returns the full path from this router, and whether it
+// ends at the destination.
+func (q *Query) Ask(ctx context.Context, via *m.SwitchPath) (path *m.SwitchPath, exact bool, err error) {
+	if len(via.Hops) < 2 {
+		return nil, false, ErrNoPathToRouter
+	}
+	router := via.Hops[len(via.Hops)-1].Router
+
+	// Skip routers that are known to not answer route queries.
+	if caps := q.d.network.RemoteCapabilities(router); caps.Known() && !caps.Has(m.CapRouteQuery) {
+		return nil, false, ErrQueryNotCapable
+	}
+
+	// Check query limit.
+	q.lock.Lock()
+	if q.queries >= maxQueries {
+		q.lock.Unlock()
+		return nil, false, ErrQueryLimit
+	}
+	q.queries++
+	q.lock.Unlock()
+
+	// Query router.
+	queryCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	answer, exact, err := q.d.network.QueryRoute(queryCtx, q.Dst, via)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Join the paths.
+	path, err = JoinPaths(via, answer)
+	if err != nil {
+		return nil, false, err
+	}
+	return path, exact, nil
+}
+
+// AskAll asks all routers at the end of the given paths at the same time and
+// returns the full paths of the answers that end at the destination.
+func (q *Query) AskAll(ctx context.Context, vias []*m.SwitchPath) []*m.SwitchPath {
+	var (
+		wg    sync.WaitGroup
+		lock  sync.Mutex
+		found []*m.SwitchPath
+	)
+	for _, via := range vias {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			path, exact, err := q.Ask(ctx, via)
+			if err == nil && exact {
+				lock.Lock()
+				defer lock.Unlock()
+				found = append(found, path)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return found
+}
+
+// JoinPaths joins the path to a router with a path starting at that router.
+func JoinPaths(via, from *m.SwitchPath) (*m.SwitchPath, error) {
+	if len(via.Hops) < 2 || len(from.Hops) < 2 {
+		return nil, errors.New("incomplete switch path")
+	}
+	last := via.Hops[len(via.Hops)-1]
+	first := from.Hops[0]
+	if last.Router != first.Router {
+		return nil, errors.New("paths do not connect")
+	}
+
+	hops := make([]m.SwitchHop, 0, len(via.Hops)+len(from.Hops)-1)
+	hops = append(hops, via.Hops[:len(via.Hops)-1]...)
+	hops = append(hops, m.SwitchHop{
+		Router:       first.Router,
+		Delay:        first.Delay,
+		ForwardLabel: first.ForwardLabel,
+		ReturnLabel:  last.ReturnLabel,
+	})
+	hops = append(hops, from.Hops[1:]...)
+
+	path := &m.SwitchPath{Hops: hops}
+	if path.HasLoop() {
+		return nil, errors.New("joined path contains a router more than once")
+	}
+	path.CalculateTotals()
+	return path, nil
+}
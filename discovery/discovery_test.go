@@ -0,0 +1,310 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+var (
+	self = netip.MustParseAddr("fd00::1")
+	peer = netip.MustParseAddr("fd00::2")
+	far  = netip.MustParseAddr("fd00::a00")
+	near = netip.MustParseAddr("fd00::f0")
+	dst  = netip.MustParseAddr("fd00::ff")
+)
+
+type testInstance struct {
+	cfg   *config.Config
+	table *m.RoutingTable
+}
+
+func (i *testInstance) Config() *config.Config { return i.cfg }
+func (i *testInstance) Identity() *m.Address {
+	return &m.Address{PublicAddress: m.PublicAddress{IP: self}}
+}
+func (i *testInstance) RoutingTable() *m.RoutingTable { return i.table }
+
+// testNetwork answers route queries with the configured answers.
+type testNetwork struct {
+	answers map[netip.Addr][]netip.Addr
+	active  map[netip.Addr]struct{}
+
+	queried []netip.Addr
+	probed  []*m.SwitchPath
+	lock    sync.Mutex
+}
+
+func (n *testNetwork) QueryRoute(_ context.Context, dst netip.Addr, via *m.SwitchPath) (*m.SwitchPath, bool, error) {
+	router := via.Hops[len(via.Hops)-1].Router
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.queried = append(n.queried, router)
+
+	routers, ok := n.answers[router]
+	if !ok {
+		return nil, false, errors.New("no route")
+	}
+	path := makePath(append([]netip.Addr{router}, routers...)...)
+	return path, routers[len(routers)-1] == dst, nil
+}
+
+func (n *testNetwork) ProbePath(_ context.Context, dst netip.Addr, path *m.SwitchPath) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.probed = append(n.probed, path)
+
+	if path.Hops[len(path.Hops)-1].Router != dst {
+		return errors.New("wrong destination")
+	}
+	return nil
+}
+
+func (n *testNetwork) RemoteCapabilities(netip.Addr) m.Capabilities {
+	return m.LocalCapabilities
+}
+
+func (n *testNetwork) ActiveRemotes(time.Time) map[netip.Addr]struct{} {
+	return n.active
+}
+
+func newTestDiscovery(t *testing.T, network *testNetwork, strategies ...string) *Discovery {
+	t.Helper()
+
+	clock := m.NewVirtualClock(time.Now())
+	inst := &testInstance{
+		cfg: &config.Config{DiscoveryStrategies: strategies},
+		table: m.NewRoutingTable(m.RoutingTableConfig{
+			RoutablePrefixes: m.GetRoutablePrefixesFor(self, netip.Prefix{}),
+			RouterIP:         self,
+			Clock:            clock,
+		}),
+	}
+	d, err := New(inst, network)
+	require.NoError(t, err)
+	d.clock = clock
+	return d
+}
+
+// makePath returns a switch path via the given routers with unique labels.
+func makePath(routers ...netip.Addr) *m.SwitchPath {
+	path := &m.SwitchPath{Hops: make([]m.SwitchHop, 0, len(routers))}
+	for i, router := range routers {
+		hop := m.SwitchHop{Router: router, Delay: 10}
+		label := m.SwitchLabel(router.As16()[15])
+		if i < len(routers)-1 {
+			hop.ForwardLabel = label + 1
+		}
+		if i > 0 {
+			hop.ReturnLabel = label + 2
+		}
+		path.Hops = append(path.Hops, hop)
+	}
+	path.CalculateTotals()
+	return path
+}
+
+func addRoute(t *testing.T, d *Discovery, routers ...netip.Addr) {
+	t.Helper()
+
+	source := m.RouteSourceGossip
+	if len(routers) == 2 {
+		source = m.RouteSourcePeer
+	}
+	added, err := d.instance.RoutingTable().AddRoute(m.RoutingTableEntry{
+		DstIP:   routers[len(routers)-1],
+		NextHop: routers[1],
+		Path:    *makePath(routers...),
+		Source:  source,
+		Expires: d.clock.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.True(t, added)
+}
+
+func TestJoinPaths(t *testing.T) {
+	t.Parallel()
+
+	via := makePath(self, peer, far)
+	from := makePath(far, near, dst)
+	path, err := JoinPaths(via, from)
+	require.NoError(t, err)
+	require.Len(t, path.Hops, 5)
+	assert.Equal(t, uint8(4), path.TotalHops)
+	joined := path.Hops[2]
+	assert.Equal(t, far, joined.Router)
+	assert.Equal(t, via.Hops[2].ReturnLabel, joined.ReturnLabel, "return label must be taken from the path to the router")
+	assert.Equal(t, from.Hops[0].ForwardLabel, joined.ForwardLabel, "forward label must be taken from the path of the router")
+
+	_, err = JoinPaths(via, makePath(near, dst))
+	require.Error(t, err, "paths that do not connect must be rejected")
+	_, err = JoinPaths(via, makePath(far, peer, dst))
+	require.Error(t, err, "joined paths with loops must be rejected")
+}
+
+func TestNearestStrategy(t *testing.T) {
+	t.Parallel()
+
+	network := &testNetwork{
+		answers: map[netip.Addr][]netip.Addr{
+			near: {dst},
+		},
+	}
+	d := newTestDiscovery(t, network, config.DiscoveryNearest)
+	addRoute(t, d, self, peer)
+	addRoute(t, d, self, peer, near)
+
+	rte, err := d.Discover(context.Background(), dst)
+	require.NoError(t, err)
+	assert.Equal(t, m.RouteSourceDiscovered, rte.Source)
+	assert.Equal(t, peer, rte.NextHop)
+	require.Len(t, network.probed, 1)
+
+	// The route must be used.
+	found, isDestination := d.instance.RoutingTable().LookupNearestRoute(dst)
+	require.True(t, isDestination)
+	assert.Equal(t, m.RouteSourceDiscovered, found.Source)
+	assert.Equal(t, []netip.Addr{self, peer, near, dst}, hopRouters(&found.Path))
+
+	// Known routes are not discovered again.
+	_, err = d.Discover(context.Background(), dst)
+	require.NoError(t, err)
+	assert.Len(t, network.probed, 1)
+}
+
+func TestRecursiveStrategy(t *testing.T) {
+	t.Parallel()
+
+	network := &testNetwork{
+		answers: map[netip.Addr][]netip.Addr{
+			far:  {near},
+			near: {dst},
+		},
+	}
+	d := newTestDiscovery(t, network, config.DiscoveryRecursive)
+	addRoute(t, d, self, peer)
+	addRoute(t, d, self, peer, far)
+
+	rte, err := d.Discover(context.Background(), dst)
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{self, peer, far, near, dst}, hopRouters(&rte.Path))
+	// The peer is nearer to the destination, but has no route.
+	assert.Equal(t, []netip.Addr{peer, far, near}, network.queried)
+}
+
+func TestStrategyOrder(t *testing.T) {
+	t.Parallel()
+
+	// The first strategy finds nothing, as the friend is not configured.
+	network := &testNetwork{
+		answers: map[netip.Addr][]netip.Addr{
+			far: {dst},
+		},
+	}
+	d := newTestDiscovery(t, network, config.DiscoveryFriends, config.DiscoveryNearest)
+	assert.Equal(t, []string{config.DiscoveryFriends, config.DiscoveryNearest}, d.Strategies())
+	addRoute(t, d, self, peer)
+	addRoute(t, d, self, peer, far)
+
+	_, err := d.Discover(context.Background(), dst)
+	require.NoError(t, err)
+
+	// Without any working strategy, discovery fails.
+	d = newTestDiscovery(t, &testNetwork{}, config.DiscoveryNearest)
+	addRoute(t, d, self, peer)
+	_, err = d.Discover(context.Background(), dst)
+	require.ErrorIs(t, err, ErrNoRouteFound)
+
+	// Unknown strategies are rejected.
+	_, err = New(&testInstance{cfg: &config.Config{DiscoveryStrategies: []string{"magic"}}}, &testNetwork{})
+	require.Error(t, err)
+}
+
+func TestTrigger(t *testing.T) {
+	t.Parallel()
+
+	d := newTestDiscovery(t, &testNetwork{}, config.DiscoveryNearest)
+	d.Trigger(dst)
+	d.Trigger(dst)
+	require.Len(t, d.queue, 1, "repeated triggers must be ignored")
+	last := d.lastAttempt.Load()
+	require.NotNil(t, last)
+	assert.Equal(t, dst, last.dst)
+
+	// Triggers for other destinations are not affected by the last attempt.
+	other := netip.MustParseAddr("fd00::1")
+	d.Trigger(other)
+	d.Trigger(dst)
+	d.Trigger(other)
+	require.Len(t, d.queue, 2)
+	assert.Equal(t, other, d.lastAttempt.Load().dst)
+
+	// Retry after the interval.
+	d.clock.(*m.VirtualClock).Advance(retryInterval) //nolint:forcetypeassert
+	d.Trigger(dst)
+	assert.Len(t, d.queue, 3)
+
+	// Disabled discovery does not queue anything.
+	d = newTestDiscovery(t, &testNetwork{})
+	d.Trigger(dst)
+	assert.Empty(t, d.queue)
+}
+
+func TestRoutesToRefresh(t *testing.T) {
+	t.Parallel()
+
+	network := &testNetwork{
+		active: make(map[netip.Addr]struct{}),
+	}
+	d := newTestDiscovery(t, network)
+	clock := d.clock.(*m.VirtualClock) //nolint:forcetypeassert
+
+	// Add discovered routes to an active and an idle destination.
+	active := netip.MustParseAddr("fd00::a")
+	idle := netip.MustParseAddr("fd00::b")
+	for _, dst := range []netip.Addr{active, idle} {
+		added, err := d.instance.RoutingTable().AddRoute(m.RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: peer,
+			Path:    *makePath(self, peer, dst),
+			Source:  m.RouteSourceDiscovered,
+			Expires: clock.Now().Add(10 * time.Minute),
+		})
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+	network.active[idle] = struct{}{}
+
+	// Routes that do not expire soon must not be refreshed.
+	assert.Empty(t, d.routesToRefresh())
+
+	// Only the route to the destination with recent traffic must be refreshed.
+	clock.Advance(8 * time.Minute)
+	network.active = map[netip.Addr]struct{}{active: {}}
+	refresh := d.routesToRefresh()
+	require.Len(t, refresh, 1)
+	assert.Equal(t, active, refresh[0].DstIP)
+
+	// Refreshing must postpone the expiry.
+	assert.Equal(t, 1, d.instance.RoutingTable().RefreshRoute(active, peer))
+	assert.Empty(t, d.routesToRefresh())
+	assert.Len(t, d.instance.RoutingTable().ExpiringRoutes(m.RouteSourceDiscovered, clock.Now().Add(5*time.Minute)), 1)
+}
+
+func hopRouters(path *m.SwitchPath) []netip.Addr {
+	routers := make([]netip.Addr, 0, len(path.Hops))
+	for _, hop := range path.Hops {
+		routers = append(routers, hop.Router)
+	}
+	return routers
+}
@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// discoveredRouteTTL defines how long discovered routes are kept.
+	discoveredRouteTTL = 10 * time.Minute
+
+	// routeRefreshInterval defines how often discovered routes are checked
+	// for upcoming expiry.
+	routeRefreshInterval = 1 * time.Minute
+	// routeRefreshWindow defines how long before their expiry discovered
+	// routes are probed. It must be longer than the interval, so that every
+	// route gets at least one chance.
+	routeRefreshWindow = 3 * time.Minute
+	// routeRefreshActivityWindow defines how recently traffic must have
+	// flowed to a destination for its discovered routes to be refreshed.
+	routeRefreshActivityWindow = 5 * time.Minute
+	// maxRouteRefreshProbes limits the amount of probes per run.
+	maxRouteRefreshProbes = 10
+)
+
+// Discovered routes expire, as they are not refreshed by gossip. In order to
+// not lose the path in the middle of a session, routes that are in active
+// use are probed shortly before they expire and are refreshed when the
+// destination answers via the route. Unused routes are left to expire.
+
+// refreshWorker regularly refreshes discovered routes that are in use.
+func (d *Discovery) refreshWorker(w *mgr.WorkerCtx) error {
+	ticker := d.clock.NewTicker(routeRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			d.refreshDiscoveredRoutes(w)
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+// refreshDiscoveredRoutes probes all discovered routes that expire soon and
+// were used recently.
+func (d *Discovery) refreshDiscoveredRoutes(w *mgr.WorkerCtx) {
+	expiring := d.routesToRefresh()
+
+	for i, rte := range expiring {
+		if i >= maxRouteRefreshProbes {
+			w.Debug(
+				"too many discovered routes to refresh, skipping some",
+				"skipped", len(expiring)-i,
+			)
+			return
+		}
+		if !d.refreshRoute(w, rte) {
+			return
+		}
+	}
+}
+
+// routesToRefresh returns the discovered routes that expire soon and whose
+// destination had traffic recently.
+func (d *Discovery) routesToRefresh() []m.RoutingTableEntry {
+	now := d.clock.Now()
+	expiring := d.instance.RoutingTable().ExpiringRoutes(m.RouteSourceDiscovered, now.Add(routeRefreshWindow))
+	if len(expiring) == 0 {
+		return nil
+	}
+
+	active := d.network.ActiveRemotes(now.Add(-routeRefreshActivityWindow))
+	refresh := expiring[:0]
+	for _, rte := range expiring {
+		if _, ok := active[rte.DstIP]; ok && rte.Expires.After(now) {
+			refresh = append(refresh, rte)
+		}
+	}
+	return refresh
+}
+
+// refreshRoute probes the route and refreshes it if the destination answers.
+// Returns false if the worker is done.
+func (d *Discovery) refreshRoute(w *mgr.WorkerCtx, rte m.RoutingTableEntry) (ok bool) {
+	ctx, cancel := context.WithTimeout(w.Ctx(), probeTimeout)
+	defer cancel()
+
+	if err := d.network.ProbePath(ctx, rte.DstIP, &rte.Path); err != nil {
+		if w.IsDone() {
+			return false
+		}
+		w.Debug(
+			"route refresh probe failed, letting route expire",
+			"dst", rte.DstIP,
+			"nexthop", rte.NextHop,
+			"err", err,
+		)
+		return true
+	}
+
+	refreshed := d.instance.RoutingTable().RefreshRoute(rte.DstIP, rte.NextHop)
+	w.Debug(
+		"refreshed discovered route",
+		"dst", rte.DstIP,
+		"nexthop", rte.NextHop,
+		"refreshed", refreshed,
+	)
+	return true
+}
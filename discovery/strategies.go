@@ -0,0 +1,140 @@
+package discovery
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+const (
+	// nearestQueries defines how many of the nearest routers are asked.
+	nearestQueries = 4
+	// recursiveStarts defines at how many routers recursive queries start.
+	recursiveStarts = 2
+	// maxRecursion limits how many routers are asked in a row.
+	maxRecursion = 4
+)
+
+// NearestStrategy asks the known routers nearest to the destination at the
+// same time. Addresses are geo marked, so these routers are likely in the
+// same region and know a route to the destination.
+type NearestStrategy struct{}
+
+// Name returns the name of the strategy.
+func (s *NearestStrategy) Name() string {
+	return config.DiscoveryNearest
+}
+
+// Discover returns possible paths to the destination of the query.
+func (s *NearestStrategy) Discover(ctx context.Context, q *Query) ([]*m.SwitchPath, error) {
+	vias := nearestRouters(q, nearestQueries, false)
+	if len(vias) == 0 {
+		return nil, ErrNoPathToRouter
+	}
+	return q.AskAll(ctx, vias), nil
+}
+
+// RecursiveStrategy follows the answers of well connected routers toward the
+// destination: Routers without a route to the destination answer with a
+// route to the nearest router they know, which is asked next, until a router
+// has a route to the destination itself. Stub routers are not asked first,
+// as they are poorly connected.
+type RecursiveStrategy struct{}
+
+// Name returns the name of the strategy.
+func (s *RecursiveStrategy) Name() string {
+	return config.DiscoveryRecursive
+}
+
+// Discover returns possible paths to the destination of the query.
+func (s *RecursiveStrategy) Discover(ctx context.Context, q *Query) ([]*m.SwitchPath, error) {
+	starts := nearestRouters(q, recursiveStarts, true)
+	if len(starts) == 0 {
+		return nil, ErrNoPathToRouter
+	}
+
+	var lastErr error
+	for _, via := range starts {
+		current := via.Hops[len(via.Hops)-1].Router
+		for range maxRecursion {
+			path, exact, err := q.Ask(ctx, via)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if exact {
+				return []*m.SwitchPath{path}, nil
+			}
+
+			// Only continue if the answer gets nearer to the destination.
+			next := path.Hops[len(path.Hops)-1].Router
+			if !m.IPDistance(next, q.Dst).Less(m.IPDistance(current, q.Dst)) {
+				break
+			}
+			via, current = path, next
+		}
+	}
+
+	return nil, lastErr
+}
+
+// FriendsStrategy asks all friends at the same time. Friends are trusted to
+// answer and their addresses are pinned, so they can be reached even when
+// little is known about the network.
+type FriendsStrategy struct{}
+
+// Name returns the name of the strategy.
+func (s *FriendsStrategy) Name() string {
+	return config.DiscoveryFriends
+}
+
+// Discover returns possible paths to the destination of the query.
+func (s *FriendsStrategy) Discover(ctx context.Context, q *Query) ([]*m.SwitchPath, error) {
+	var vias []*m.SwitchPath
+	for _, friend := range q.Friends() {
+		if friend.IP == q.Dst {
+			continue
+		}
+		if path, err := q.PathTo(friend.IP); err == nil {
+			vias = append(vias, path)
+		}
+	}
+	if len(vias) == 0 {
+		return nil, ErrNoPathToRouter
+	}
+	return q.AskAll(ctx, vias), nil
+}
+
+// nearestRouters returns the paths to the given amount of known routers
+// nearest to the destination of the query.
+func nearestRouters(q *Query, amount int, skipStubs bool) []*m.SwitchPath {
+	// Start with the nearest entry, as it is not included in the possible
+	// paths. Routes to the same router are returned best first, so get more
+	// to have enough distinct routers.
+	var entries []*m.RoutingTableEntry
+	if nearest, _ := q.Table().LookupNearest(q.Dst); nearest != nil {
+		entries = append(entries, nearest)
+	}
+	entries = append(entries, q.Table().LookupPossiblePaths(q.Dst, amount*m.DefaultRoutesPerDestination, m.AddrDistance{}, false, nil)...)
+
+	seen := make(map[netip.Addr]struct{}, amount)
+	vias := make([]*m.SwitchPath, 0, amount)
+	for _, rte := range entries {
+		if _, ok := seen[rte.DstIP]; ok {
+			continue
+		}
+		seen[rte.DstIP] = struct{}{}
+		if skipStubs && rte.Stub {
+			continue
+		}
+
+		path := rte.Path
+		vias = append(vias, &path)
+		if len(vias) >= amount {
+			break
+		}
+	}
+	return vias
+}
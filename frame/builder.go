@@ -1,6 +1,9 @@
 package frame
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
 )
@@ -19,6 +22,14 @@ type Builder struct {
 	// Margins
 	offset   atomic.Int32
 	overhead atomic.Int32
+
+	// Margins requirements, combined into the margins above.
+	marginsLock sync.Mutex
+	baseMargins frameMargins
+	margins     map[string]frameMargins
+
+	// nonces, if set, replaces the random source of frame nonces.
+	nonces io.Reader
 }
 
 const (
@@ -30,22 +41,24 @@ const (
 )
 
 // NewFrameBuilder returns a new frame builder.
+// Slices are pooled as array pointers, so that returning them to the pool does
+// not allocate.
 func NewFrameBuilder() *Builder {
 	b := &Builder{
 		fiveHBytePool: sync.Pool{
-			New: func() any { return make([]byte, fiveHByteSize) },
+			New: func() any { return new([fiveHByteSize]byte) },
 		},
 		fifteenHBytePool: sync.Pool{
-			New: func() any { return make([]byte, fifteenHByteSize) },
+			New: func() any { return new([fifteenHByteSize]byte) },
 		},
 		fiveKBytePool: sync.Pool{
-			New: func() any { return make([]byte, fiveKByteSize) },
+			New: func() any { return new([fiveKByteSize]byte) },
 		},
 		nineKBytePool: sync.Pool{
-			New: func() any { return make([]byte, nineKByteSize) },
+			New: func() any { return new([nineKByteSize]byte) },
 		},
 		sixtyFiveKBytePool: sync.Pool{
-			New: func() any { return make([]byte, sixtyFiveKByteSize) },
+			New: func() any { return new([sixtyFiveKByteSize]byte) },
 		},
 	}
 	// Set pools with self-reference.
@@ -55,20 +68,30 @@ func NewFrameBuilder() *Builder {
 	return b
 }
 
+// NewDeterministicFrameBuilder returns a new frame builder that reads frame
+// nonces from the given source instead of crypto/rand, so that frames can be
+// reproduced byte for byte, eg. for test vectors.
+// It must never be used for live traffic.
+func NewDeterministicFrameBuilder(nonces io.Reader) *Builder {
+	b := NewFrameBuilder()
+	b.nonces = nonces
+	return b
+}
+
 // GetPooledSlice returns a slice from the pool (or creates one) that has
 // at least the specified size.
 func (b *Builder) GetPooledSlice(minSize int) (pooledSlice []byte) {
 	switch {
 	case minSize <= fiveHByteSize:
-		return b.fiveHBytePool.Get().([]byte) //nolint:forcetypeassert
+		return b.fiveHBytePool.Get().(*[fiveHByteSize]byte)[:] //nolint:forcetypeassert
 	case minSize <= fifteenHByteSize:
-		return b.fifteenHBytePool.Get().([]byte) //nolint:forcetypeassert
+		return b.fifteenHBytePool.Get().(*[fifteenHByteSize]byte)[:] //nolint:forcetypeassert
 	case minSize <= fiveKByteSize:
-		return b.fiveKBytePool.Get().([]byte) //nolint:forcetypeassert
+		return b.fiveKBytePool.Get().(*[fiveKByteSize]byte)[:] //nolint:forcetypeassert
 	case minSize <= nineKByteSize:
-		return b.nineKBytePool.Get().([]byte) //nolint:forcetypeassert
+		return b.nineKBytePool.Get().(*[nineKByteSize]byte)[:] //nolint:forcetypeassert
 	case minSize <= sixtyFiveKByteSize:
-		return b.sixtyFiveKBytePool.Get().([]byte) //nolint:forcetypeassert
+		return b.sixtyFiveKBytePool.Get().(*[sixtyFiveKByteSize]byte)[:] //nolint:forcetypeassert
 	default:
 		// Required min size cannot be satisfied.
 		return nil
@@ -78,8 +101,6 @@ func (b *Builder) GetPooledSlice(minSize int) (pooledSlice []byte) {
 // ReturnPooledSlice returns the give pooled slice to the pool.
 // The provided slice must not be used anymore in any way.
 func (b *Builder) ReturnPooledSlice(pooledSlice []byte) {
-	//nolint:forcetypeassert
-
 	// Revert slice back to original size.
 	pooledSlice = pooledSlice[0:cap(pooledSlice)]
 	// Reset slice to zero.
@@ -87,32 +108,94 @@ func (b *Builder) ReturnPooledSlice(pooledSlice []byte) {
 	// Put slice back into correct pool.
 	switch len(pooledSlice) {
 	case fiveHByteSize:
-		b.fiveHBytePool.Put(pooledSlice) //nolint:staticcheck
+		b.fiveHBytePool.Put((*[fiveHByteSize]byte)(pooledSlice))
 	case fifteenHByteSize:
-		b.fifteenHBytePool.Put(pooledSlice) //nolint:staticcheck
+		b.fifteenHBytePool.Put((*[fifteenHByteSize]byte)(pooledSlice))
 	case fiveKByteSize:
-		b.fiveKBytePool.Put(pooledSlice) //nolint:staticcheck
+		b.fiveKBytePool.Put((*[fiveKByteSize]byte)(pooledSlice))
 	case nineKByteSize:
-		b.nineKBytePool.Put(pooledSlice) //nolint:staticcheck
+		b.nineKBytePool.Put((*[nineKByteSize]byte)(pooledSlice))
 	case sixtyFiveKByteSize:
-		b.sixtyFiveKBytePool.Put(pooledSlice) //nolint:staticcheck
+		b.sixtyFiveKBytePool.Put((*[sixtyFiveKByteSize]byte)(pooledSlice))
 	default:
 		// Provided slice does not match any pools.
 	}
 }
 
+// MaxFrameMargin is the maximum offset or overhead a frame can be built with.
+const MaxFrameMargin = 100
+
+type frameMargins struct {
+	offset   int
+	overhead int
+}
+
 // FrameMargins returns the currently required margins for frames.
+// These are the largest margins of all registered requirements.
 func (b *Builder) FrameMargins() (offset, overhead int) {
 	return int(b.offset.Load()), int(b.overhead.Load())
 }
 
-// SetFrameMargins sets new required margins for new frames.
+// SetFrameMargins sets the base margins for new frames.
 // Values must be between 0 and 100 (inclusive).
 func (b *Builder) SetFrameMargins(offset, overhead int) {
-	if offset >= 0 && offset <= 100 {
-		b.offset.Store(int32(offset))
+	b.marginsLock.Lock()
+	defer b.marginsLock.Unlock()
+
+	if offset >= 0 && offset <= MaxFrameMargin {
+		b.baseMargins.offset = offset
+	}
+	if overhead >= 0 && overhead <= MaxFrameMargin {
+		b.baseMargins.overhead = overhead
 	}
-	if overhead >= 0 && overhead <= 100 {
-		b.overhead.Store(int32(overhead))
+	b.updateMargins()
+}
+
+// RegisterFrameMargins registers the margin requirements of a user of the
+// builder, eg. a transport that needs space for its own headers. New frames
+// are built with enough space for all registered requirements, so that they
+// can be sent without copying. Registering again with the same name replaces
+// the previous requirements.
+// Margins should be registered before any frames are built, as existing frames
+// are not resized.
+func (b *Builder) RegisterFrameMargins(name string, offset, overhead int) error {
+	switch {
+	case name == "":
+		return errors.New("missing name")
+	case offset < 0 || offset > MaxFrameMargin:
+		return fmt.Errorf("offset %d out of range (0-%d)", offset, MaxFrameMargin)
+	case overhead < 0 || overhead > MaxFrameMargin:
+		return fmt.Errorf("overhead %d out of range (0-%d)", overhead, MaxFrameMargin)
+	}
+
+	b.marginsLock.Lock()
+	defer b.marginsLock.Unlock()
+
+	if b.margins == nil {
+		b.margins = make(map[string]frameMargins)
+	}
+	b.margins[name] = frameMargins{offset: offset, overhead: overhead}
+	b.updateMargins()
+	return nil
+}
+
+// UnregisterFrameMargins removes the margin requirements with the given name.
+func (b *Builder) UnregisterFrameMargins(name string) {
+	b.marginsLock.Lock()
+	defer b.marginsLock.Unlock()
+
+	delete(b.margins, name)
+	b.updateMargins()
+}
+
+// updateMargins combines all margin requirements.
+// The margins lock must be held.
+func (b *Builder) updateMargins() {
+	combined := b.baseMargins
+	for _, margins := range b.margins {
+		combined.offset = max(combined.offset, margins.offset)
+		combined.overhead = max(combined.overhead, margins.overhead)
 	}
+	b.offset.Store(int32(combined.offset))
+	b.overhead.Store(int32(combined.overhead))
 }
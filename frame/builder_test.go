@@ -0,0 +1,56 @@
+package frame
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilderMargins(t *testing.T) {
+	t.Parallel()
+
+	b := NewFrameBuilder()
+	b.SetFrameMargins(12, 16)
+	checkMargins := func(offset, overhead int) {
+		t.Helper()
+
+		gotOffset, gotOverhead := b.FrameMargins()
+		assert.Equal(t, offset, gotOffset, "offset should match")
+		assert.Equal(t, overhead, gotOverhead, "overhead should match")
+	}
+	checkMargins(12, 16)
+
+	// The largest requirements win.
+	assert.NoError(t, b.RegisterFrameMargins("a", 20, 0))
+	assert.NoError(t, b.RegisterFrameMargins("b", 4, 30))
+	checkMargins(20, 30)
+
+	// Invalid requirements are rejected.
+	assert.Error(t, b.RegisterFrameMargins("", 1, 1))
+	assert.Error(t, b.RegisterFrameMargins("c", MaxFrameMargin+1, 0))
+	assert.Error(t, b.RegisterFrameMargins("c", 0, -1))
+	checkMargins(20, 30)
+
+	// Replace and remove requirements.
+	assert.NoError(t, b.RegisterFrameMargins("a", 14, 0))
+	checkMargins(14, 30)
+	b.UnregisterFrameMargins("b")
+	checkMargins(14, 16)
+	b.UnregisterFrameMargins("a")
+	checkMargins(12, 16)
+
+	// Frames are built with the margins.
+	assert.NoError(t, b.RegisterFrameMargins("a", 40, 40))
+	f, err := b.NewFrameV1(
+		netip.IPv6LinkLocalAllNodes(),
+		netip.IPv6LinkLocalAllRouters(),
+		NetworkTraffic,
+		nil,
+		testData,
+		nil,
+	)
+	assert.NoError(t, err)
+	_, err = f.FrameDataWithMargins(40, 40)
+	assert.NoError(t, err)
+}
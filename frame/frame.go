@@ -5,6 +5,7 @@ import (
 	"net/netip"
 	"time"
 
+	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/state"
 )
 
@@ -19,6 +20,8 @@ var (
 	ErrIncorrectLength         = errors.New("incorrect length")
 	ErrUnsupportedFrameVersion = errors.New("unsupported frame version")
 	ErrVerificationFailed      = errors.New("verification failed")
+	ErrDecryptionFailed        = errors.New("decryption failed")
+	ErrMessageTooBig           = m.NewError(m.CodeMTUExceeded, "message data too big")
 )
 
 // Frame is a common interface to different frame versions.
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"net/netip"
 	"time"
 
@@ -195,7 +196,12 @@ func (f *FrameV1) initHeader(src, dst netip.Addr, msgType MessageType) error {
 	// Message Type
 	f.SetMessageType(msgType)
 	// Random Nonce [3]byte
-	_, err := rand.Read(f.data[5:8])
+	var err error
+	if f.builder.nonces != nil {
+		_, err = io.ReadFull(f.builder.nonces, f.data[5:8])
+	} else {
+		_, err = rand.Read(f.data[5:8])
+	}
 	if err != nil {
 		return err
 	}
@@ -239,7 +245,7 @@ func (f *FrameV1) setData(switchBlock, message, appendix []byte) error {
 	case len(message) == 0:
 		return errors.New("message data may not be empty")
 	case len(message) > frameV1MessageLimit:
-		return errors.New("message data too big")
+		return ErrMessageTooBig
 	default:
 		m.PutUint16(f.data[f.messageIndex:f.messageIndex+frameV1MessageLengthSize], uint16(len(message)))
 		messageEndIndex := f.messageIndex + frameV1MessageLengthSize + len(message)
@@ -574,7 +580,7 @@ func (f *FrameV1) Clone() Frame {
 	c.psDataOffset = f.psDataOffset
 
 	// Copy pooled slice to new pooled slice.
-	c.pooledSlice = f.builder.GetPooledSlice(len(c.pooledSlice))
+	c.pooledSlice = f.builder.GetPooledSlice(len(f.pooledSlice))
 	copy(c.pooledSlice, f.pooledSlice)
 
 	// Recreate correct data slice.
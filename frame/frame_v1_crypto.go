@@ -91,7 +91,7 @@ func (f *FrameV1) Unseal(s *state.Session) error {
 
 		// Decrypt.
 		if err := f.decryptFrame(c); err != nil {
-			return fmt.Errorf("decrypt: %w", err)
+			return fmt.Errorf("%w: %w", ErrDecryptionFailed, err)
 		}
 		return s.Encryption().Check(seqNum, msgClass == MessageClassPriorityEncrypted)
 
@@ -137,6 +137,12 @@ func (f *FrameV1) putFieldsIntoCryptoState() (done func()) {
 	// Save current values.
 	ttl := f.TTL()
 	flowC := f.FlowControl()
+	// The switch block is changed by every switch on the way.
+	var switchBlock []byte
+	if block := f.SwitchBlock(); len(block) > 0 {
+		switchBlock = bytes.Clone(block)
+		clear(block)
+	}
 	// Set values to zero for cryptographic operations.
 	f.SetTTL(0)
 	f.SetFlowControl(0)
@@ -144,6 +150,9 @@ func (f *FrameV1) putFieldsIntoCryptoState() (done func()) {
 	return func() {
 		f.SetTTL(ttl)
 		f.SetFlowControl(flowC)
+		if switchBlock != nil {
+			copy(f.SwitchBlock(), switchBlock)
+		}
 	}
 }
 
@@ -3,6 +3,7 @@ package frame
 import (
 	"context"
 	"net/netip"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -159,6 +160,8 @@ func TestFrameV1(t *testing.T) {
 		if err := f.Seal(s2); err != nil { // Seal for s2.
 			t.Fatalf("failed to seal %s: %s", msgType, err)
 		}
+		// Simulate switching, which changes the switch block on the way.
+		slices.Reverse(f.SwitchBlock())
 		if err := f.Unseal(s1); err != nil { // Unseal from s1.
 			t.Fatalf("failed to unseal %s: %s", msgType, err)
 		}
@@ -171,6 +174,44 @@ func TestFrameV1(t *testing.T) {
 	f2.ReturnToPool()
 }
 
+func BenchmarkFrameV1Relay(b *testing.B) {
+	// Build frame.
+	builder := NewFrameBuilder()
+	builder.SetFrameMargins(12, 16)
+	f, err := builder.NewFrameV1(
+		netip.IPv6LinkLocalAllNodes(),
+		netip.IPv6LinkLocalAllRouters(),
+		NetworkTraffic,
+		[]byte{1, 2, 3, 0, 0, 0},
+		testData,
+		nil,
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	raw := slices.Clone(f.pooledSlice)
+	offset, size := f.psDataOffset, len(f.data)
+
+	// Simulate what a relay does with a received frame.
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pooledSlice := builder.GetPooledSlice(len(raw))
+		copy(pooledSlice, raw)
+
+		relayed, err := builder.ParseFrame(pooledSlice[offset:offset+size], pooledSlice, offset)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = relayed.SrcIP()
+		_ = relayed.SwitchBlock()
+		_ = relayed.MessageType().IsPriority()
+		relayed.ReduceTTL(1)
+		relayed.SetFlowFlag(FlowControlFlagHoldFlow)
+		relayed.ReturnToPool()
+	}
+}
+
 func TestKeyRollover(t *testing.T) { //nolint:paralleltest // Key iteration must be done exlusively.
 	// Setup.
 	b := NewFrameBuilder()
@@ -0,0 +1,229 @@
+package frame
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxStatsRemotes limits the amount of remote routers tracked, as they are
+	// chosen by others.
+	maxStatsRemotes = 10_000
+	// statsRemoteTTL defines after how long without frames a remote router may
+	// be removed to make room for others.
+	statsRemoteTTL = time.Hour
+)
+
+// Stats counts frames and bytes per message type and per remote router,
+// separately for relayed frames and frames terminated at this router.
+// Counters are atomics, as they are updated for every frame.
+type Stats struct {
+	since time.Time
+	types [256]statsCounters
+
+	remotes     map[netip.Addr]*statsCounters
+	remotesLock sync.RWMutex
+	// untracked counts frames of remote routers that were not tracked, as the
+	// limit was reached.
+	untracked atomic.Uint64
+}
+
+type statsCounters struct {
+	relayedFrames    atomic.Uint64
+	relayedBytes     atomic.Uint64
+	terminatedFrames atomic.Uint64
+	terminatedBytes  atomic.Uint64
+
+	// lastSeen is when the last frame was recorded in unix seconds.
+	lastSeen atomic.Int64
+}
+
+// TrafficCounters holds frame and byte counters.
+type TrafficCounters struct {
+	RelayedFrames    uint64 `json:"relayedFrames"`
+	RelayedBytes     uint64 `json:"relayedBytes"`
+	TerminatedFrames uint64 `json:"terminatedFrames"`
+	TerminatedBytes  uint64 `json:"terminatedBytes"`
+}
+
+// TypeStats holds the counters of a message type.
+type TypeStats struct {
+	MessageType MessageType `json:"messageType"`
+	Name        string      `json:"name"`
+	TrafficCounters
+}
+
+// TalkerStats holds the counters of a remote router.
+type TalkerStats struct {
+	Router netip.Addr `json:"router"`
+	TrafficCounters
+}
+
+// NewStats returns new frame statistics.
+func NewStats(now time.Time) *Stats {
+	return &Stats{
+		since:   now,
+		remotes: make(map[netip.Addr]*statsCounters),
+	}
+}
+
+// Size returns the size of the frame in bytes.
+func Size(f Frame) int {
+	data, err := f.FrameDataWithMargins(0, 0)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// Record records a frame of the given message type. Relayed frames were
+// forwarded to another router, all others were terminated at this router.
+func (s *Stats) Record(msgType MessageType, size int, relayed bool) {
+	s.types[msgType].add(size, relayed)
+}
+
+// RecordRemote records a frame from the given remote router.
+// Only frames with a verified source may be recorded, as the remote routers
+// are tracked until they expire.
+func (s *Stats) RecordRemote(remote netip.Addr, size int, relayed bool, now time.Time) {
+	// Get counters of remote router.
+	s.remotesLock.RLock()
+	counters, ok := s.remotes[remote]
+	s.remotesLock.RUnlock()
+	if !ok {
+		s.remotesLock.Lock()
+		counters, ok = s.remotes[remote]
+		if !ok && len(s.remotes) >= maxStatsRemotes {
+			s.pruneLocked(now)
+		}
+		if !ok && len(s.remotes) < maxStatsRemotes {
+			counters = &statsCounters{}
+			s.remotes[remote] = counters
+			ok = true
+		}
+		s.remotesLock.Unlock()
+	}
+	if !ok {
+		s.untracked.Add(1)
+		return
+	}
+	counters.add(size, relayed)
+	counters.lastSeen.Store(now.Unix())
+}
+
+// pruneLocked removes remote routers that did not send any frames for
+// statsRemoteTTL. Must be called with the lock held.
+func (s *Stats) pruneLocked(now time.Time) {
+	expired := now.Add(-statsRemoteTTL).Unix()
+	for remote, counters := range s.remotes {
+		if counters.lastSeen.Load() < expired {
+			delete(s.remotes, remote)
+		}
+	}
+}
+
+func (c *statsCounters) add(size int, relayed bool) {
+	if relayed {
+		c.relayedFrames.Add(1)
+		c.relayedBytes.Add(uint64(size))
+	} else {
+		c.terminatedFrames.Add(1)
+		c.terminatedBytes.Add(uint64(size))
+	}
+}
+
+func (c *statsCounters) export() TrafficCounters {
+	return TrafficCounters{
+		RelayedFrames:    c.relayedFrames.Load(),
+		RelayedBytes:     c.relayedBytes.Load(),
+		TerminatedFrames: c.terminatedFrames.Load(),
+		TerminatedBytes:  c.terminatedBytes.Load(),
+	}
+}
+
+// Frames returns the total amount of frames.
+func (tc TrafficCounters) Frames() uint64 {
+	return tc.RelayedFrames + tc.TerminatedFrames
+}
+
+// Bytes returns the total amount of bytes.
+func (tc TrafficCounters) Bytes() uint64 {
+	return tc.RelayedBytes + tc.TerminatedBytes
+}
+
+// Since returns when counting started.
+func (s *Stats) Since() time.Time {
+	return s.since
+}
+
+// Untracked returns the amount of frames of remote routers that were not
+// tracked, as the limit was reached.
+func (s *Stats) Untracked() uint64 {
+	return s.untracked.Load()
+}
+
+// Types returns the counters of all seen message types, most bytes first.
+func (s *Stats) Types() []TypeStats {
+	var types []TypeStats
+	for i := range s.types {
+		counters := s.types[i].export()
+		if counters.Frames() == 0 {
+			continue
+		}
+		types = append(types, TypeStats{
+			MessageType:     MessageType(i),
+			Name:            MessageType(i).String(),
+			TrafficCounters: counters,
+		})
+	}
+	slices.SortStableFunc(types, func(a, b TypeStats) int {
+		return compareTraffic(a.TrafficCounters, b.TrafficCounters)
+	})
+	return types
+}
+
+// TopTalkers returns the counters of the remote routers with the most bytes,
+// up to the given limit.
+func (s *Stats) TopTalkers(limit int) []TalkerStats {
+	s.remotesLock.RLock()
+	talkers := make([]TalkerStats, 0, len(s.remotes))
+	for remote, counters := range s.remotes {
+		talkers = append(talkers, TalkerStats{
+			Router:          remote,
+			TrafficCounters: counters.export(),
+		})
+	}
+	s.remotesLock.RUnlock()
+
+	slices.SortFunc(talkers, func(a, b TalkerStats) int {
+		if diff := compareTraffic(a.TrafficCounters, b.TrafficCounters); diff != 0 {
+			return diff
+		}
+		return a.Router.Compare(b.Router)
+	})
+	if len(talkers) > limit {
+		talkers = talkers[:limit]
+	}
+	return talkers
+}
+
+// compareTraffic sorts by most bytes, then most frames.
+func compareTraffic(a, b TrafficCounters) int {
+	switch {
+	case a.Bytes() != b.Bytes():
+		if a.Bytes() > b.Bytes() {
+			return -1
+		}
+		return 1
+	case a.Frames() != b.Frames():
+		if a.Frames() > b.Frames() {
+			return -1
+		}
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,92 @@
+package frame
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	s := NewStats(now)
+	a := netip.MustParseAddr("fd00::a")
+	b := netip.MustParseAddr("fd00::b")
+
+	record := func(msgType MessageType, remote netip.Addr, size int, relayed bool) {
+		s.Record(msgType, size, relayed)
+		s.RecordRemote(remote, size, relayed, now)
+	}
+	record(NetworkTraffic, a, 1000, true)
+	record(NetworkTraffic, a, 500, false)
+	record(RouterPing, b, 100, false)
+	record(RouterHopPing, b, 200, true)
+	record(RouterHopPing, b, 200, true)
+
+	// Check message types.
+	types := s.Types()
+	require.Len(t, types, 3)
+	assert.Equal(t, NetworkTraffic, types[0].MessageType)
+	assert.Equal(t, "NetworkTraffic", types[0].Name)
+	assert.Equal(t, TrafficCounters{
+		RelayedFrames:    1,
+		RelayedBytes:     1000,
+		TerminatedFrames: 1,
+		TerminatedBytes:  500,
+	}, types[0].TrafficCounters)
+	assert.Equal(t, RouterHopPing, types[1].MessageType)
+	assert.Equal(t, uint64(2), types[1].RelayedFrames)
+	assert.Equal(t, RouterPing, types[2].MessageType)
+
+	// Check top talkers.
+	talkers := s.TopTalkers(10)
+	require.Len(t, talkers, 2)
+	assert.Equal(t, a, talkers[0].Router)
+	assert.Equal(t, uint64(1500), talkers[0].Bytes())
+	assert.Equal(t, b, talkers[1].Router)
+	assert.Equal(t, uint64(3), talkers[1].Frames())
+	assert.Len(t, s.TopTalkers(1), 1)
+}
+
+func TestStatsRemoteLimit(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	s := NewStats(now)
+	remote := func(i int) netip.Addr {
+		addr := netip.MustParseAddr("fd00::").As16()
+		addr[13] = byte(i >> 16)
+		addr[14] = byte(i >> 8)
+		addr[15] = byte(i)
+		return netip.AddrFrom16(addr)
+	}
+	for i := range maxStatsRemotes + 10 {
+		s.Record(SessionData, 10, false)
+		s.RecordRemote(remote(i), 10, false, now)
+	}
+
+	assert.Equal(t, uint64(10), s.Untracked())
+	assert.Len(t, s.TopTalkers(maxStatsRemotes*2), maxStatsRemotes)
+	// Message types are still counted completely.
+	assert.Equal(t, uint64(maxStatsRemotes+10), s.Types()[0].TerminatedFrames)
+
+	// Remote routers that are still active are kept.
+	later := now.Add(statsRemoteTTL / 2)
+	s.RecordRemote(remote(0), 10, false, later)
+	s.RecordRemote(remote(maxStatsRemotes+20), 10, false, later)
+	assert.Equal(t, uint64(11), s.Untracked())
+
+	// Expired remote routers make room for new ones.
+	later = now.Add(statsRemoteTTL + time.Minute)
+	s.RecordRemote(remote(maxStatsRemotes+20), 10, false, later)
+	assert.Equal(t, uint64(11), s.Untracked())
+	talkers := s.TopTalkers(maxStatsRemotes * 2)
+	require.Len(t, talkers, 2)
+	assert.Equal(t, remote(0), talkers[0].Router)
+	assert.Equal(t, uint64(2), talkers[0].Frames())
+	assert.Equal(t, remote(maxStatsRemotes+20), talkers[1].Router)
+}
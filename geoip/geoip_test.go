@@ -0,0 +1,241 @@
+package geoip
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestDB(t *testing.T) {
+	t.Parallel()
+
+	db, err := Load(buildTestDB(t, map[string]string{
+		"192.0.2.0/24":    "DE",
+		"198.51.100.0/24": "US",
+		"2001:db8::/32":   "JP",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "Test-Country", db.DatabaseType)
+
+	tests := []struct {
+		ip      string
+		country string
+	}{
+		{"192.0.2.1", "DE"},
+		{"::ffff:192.0.2.200", "DE"},
+		{"198.51.100.7", "US"},
+		{"2001:db8::1", "JP"},
+		{"203.0.113.1", ""},
+		{"2001:db9::1", ""},
+	}
+	for _, test := range tests {
+		country, err := db.Country(netip.MustParseAddr(test.ip))
+		if test.country == "" {
+			assert.ErrorIs(t, err, ErrNotFound, test.ip)
+			continue
+		}
+		require.NoError(t, err, test.ip)
+		assert.Equal(t, test.country, country, test.ip)
+	}
+
+	// Invalid databases.
+	_, err = Load([]byte("not a database"))
+	require.ErrorIs(t, err, ErrInvalidFormat)
+}
+
+func TestVerifier(t *testing.T) {
+	t.Parallel()
+
+	db, err := Load(buildTestDB(t, map[string]string{
+		"192.0.2.0/24":    "DE",
+		"198.51.100.0/24": "US",
+		"203.0.113.0/24":  "AT",
+	}))
+	require.NoError(t, err)
+	v := NewVerifier(db)
+
+	germany := routerIn(t, "DE")
+	austria := routerIn(t, "AT")
+	newYork := routerIn(t, "US-NY")
+	canada := routerIn(t, "CA")
+
+	tests := []struct {
+		router   netip.Addr
+		underlay string
+		mismatch Mismatch
+	}{
+		{germany, "192.0.2.1", MismatchNone},
+		{austria, "192.0.2.1", MismatchRegion},
+		{newYork, "198.51.100.1", MismatchNone},
+		{canada, "198.51.100.1", MismatchCountry},
+		{germany, "198.51.100.1", MismatchContinent},
+	}
+	for _, test := range tests {
+		result, ok, err := v.Verify(test.router, netip.MustParseAddr(test.underlay))
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, test.mismatch, result.Mismatch, "%s via %s", result.Claimed, test.underlay)
+	}
+
+	// Last result per router is kept.
+	assert.True(t, v.Flagged(germany))
+	assert.True(t, v.Flagged(austria))
+	assert.False(t, v.Flagged(canada))
+	assert.Len(t, v.Results(), 4)
+	v.Forget(germany)
+	assert.False(t, v.Flagged(germany))
+
+	// Unknown locations and routers without geo marker are not verified.
+	_, ok, err := v.Verify(germany, netip.MustParseAddr("10.0.0.1"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, ok, err = v.Verify(netip.MustParseAddr("fd80::1"), netip.MustParseAddr("192.0.2.1"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func routerIn(t *testing.T, country string) netip.Addr {
+	t.Helper()
+
+	prefix, err := m.GetCountryPrefix(country)
+	require.NoError(t, err)
+	return prefix.Addr().Next()
+}
+
+// buildTestDB builds a MaxMind DB with 24 bit records, mapping the given
+// prefixes to countries.
+func buildTestDB(t *testing.T, countries map[string]string) []byte {
+	t.Helper()
+
+	type node struct {
+		children [2]*node
+		data     int
+	}
+	newNode := func() *node { return &node{data: -1} }
+
+	// Write data section and build tree.
+	var data bytes.Buffer
+	root := newNode()
+	for prefixString, country := range countries {
+		prefix := netip.MustParsePrefix(prefixString)
+		ip := prefix.Addr().As16()
+		bits := prefix.Bits()
+		if prefix.Addr().Is4() {
+			// Map IPv4 to ::/96.
+			ip = [16]byte{}
+			copy(ip[12:], prefix.Addr().AsSlice())
+			bits += 96
+		}
+
+		n := root
+		for i := range bits {
+			bit := (ip[i/8] >> (7 - i%8)) & 1
+			if n.children[bit] == nil {
+				n.children[bit] = newNode()
+			}
+			n = n.children[bit]
+		}
+		n.data = data.Len()
+		writeMap(&data, 1)
+		writeString(&data, "country")
+		writeMap(&data, 1)
+		writeString(&data, "iso_code")
+		writeString(&data, country)
+	}
+
+	// Number nodes.
+	var nodes []*node
+	index := make(map[*node]int)
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n.data >= 0 {
+			return
+		}
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+
+	// Write search tree.
+	var db bytes.Buffer
+	for _, n := range nodes {
+		for _, child := range n.children {
+			record := len(nodes)
+			switch {
+			case child == nil:
+			case child.data >= 0:
+				record = len(nodes) + dataSectionSeparator + child.data
+			default:
+				record = index[child]
+			}
+			db.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	db.Write(make([]byte, dataSectionSeparator))
+	db.Write(data.Bytes())
+
+	// Write metadata.
+	db.Write(metadataMarker)
+	writeMap(&db, 4)
+	writeString(&db, "node_count")
+	writeUint(&db, typeUint32, uint32(len(nodes)))
+	writeString(&db, "record_size")
+	writeUint(&db, typeUint16, 24)
+	writeString(&db, "ip_version")
+	writeUint(&db, typeUint16, 6)
+	writeString(&db, "database_type")
+	writeString(&db, "Test-Country")
+
+	return db.Bytes()
+}
+
+func writeMap(buf *bytes.Buffer, size int) {
+	buf.WriteByte(typeMap<<5 | byte(size))
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteByte(typeString<<5 | byte(len(s)))
+	buf.WriteString(s)
+}
+
+func writeUint(buf *bytes.Buffer, dataType byte, v uint32) {
+	buf.WriteByte(dataType<<5 | 4)
+	buf.Write([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+func TestDecodeSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		size   int
+		header []byte
+	}{
+		{28, []byte{typeString<<5 | 28}},
+		{29, []byte{typeString<<5 | 29, 0}},
+		{284, []byte{typeString<<5 | 29, 255}},
+		{285, []byte{typeString<<5 | 30, 0, 0}},
+		{300, []byte{typeString<<5 | 30, 0, 15}},
+		{65820, []byte{typeString<<5 | 30, 255, 255}},
+		{65821, []byte{typeString<<5 | 31, 0, 0, 0}},
+		{66000, []byte{typeString<<5 | 31, 0, 0, 179}},
+		{131357, []byte{typeString<<5 | 31, 1, 0, 0}},
+	}
+	for _, test := range tests {
+		d := &decoder{data: append(bytes.Clone(test.header), bytes.Repeat([]byte{'x'}, test.size)...)}
+		decoded, next, err := d.decode(0, 0)
+		require.NoError(t, err, test.size)
+		require.IsType(t, "", decoded, test.size)
+		assert.Len(t, decoded, test.size)
+		assert.Equal(t, uint(len(d.data)), next, test.size)
+	}
+}
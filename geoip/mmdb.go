@@ -0,0 +1,393 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// Errors.
+var (
+	ErrNotFound      = errors.New("address not found in database")
+	ErrInvalidFormat = errors.New("invalid database format")
+)
+
+// metadataMarker marks the start of the metadata section of a MaxMind DB.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	// maxMetadataSize is the maximum size of the metadata section.
+	maxMetadataSize = 128 * 1024
+	// dataSectionSeparator is the size of the null bytes between the search
+	// tree and the data section.
+	dataSectionSeparator = 16
+	// maxPointerDepth limits how deep pointers are followed while decoding.
+	maxPointerDepth = 32
+)
+
+// DB is a read-only MaxMind DB (mmdb), eg. a GeoLite2 or GeoIP2 country
+// database. The database is fully loaded into memory and never queries any
+// external services.
+// Only the parts of the format needed for country lookups are implemented.
+type DB struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+
+	// ipv4Start is the node at which IPv4 lookups start in IPv6 databases.
+	ipv4Start uint
+
+	// DatabaseType is the type of the database, eg. "GeoLite2-Country".
+	DatabaseType string
+}
+
+// Open loads the MaxMind DB at the given path.
+func Open(path string) (*DB, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Load(content)
+}
+
+// Load parses the given MaxMind DB.
+func Load(content []byte) (*DB, error) {
+	// Find metadata at the end of the file.
+	searchFrom := max(len(content)-maxMetadataSize, 0)
+	markerIndex := bytes.LastIndex(content[searchFrom:], metadataMarker)
+	if markerIndex < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidFormat)
+	}
+	metadataStart := searchFrom + markerIndex + len(metadataMarker)
+	metadata, _, err := (&decoder{data: content[metadataStart:]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode metadata: %w", ErrInvalidFormat, err)
+	}
+	meta, ok := metadata.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidFormat)
+	}
+
+	// Parse metadata.
+	db := &DB{}
+	db.nodeCount, _ = metaUint(meta, "node_count")
+	db.recordSize, _ = metaUint(meta, "record_size")
+	db.ipVersion, _ = metaUint(meta, "ip_version")
+	db.DatabaseType, _ = meta["database_type"].(string)
+	switch {
+	case db.nodeCount == 0:
+		return nil, fmt.Errorf("%w: missing node count", ErrInvalidFormat)
+	case db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidFormat, db.recordSize)
+	case db.ipVersion != 4 && db.ipVersion != 6:
+		return nil, fmt.Errorf("%w: unsupported ip version %d", ErrInvalidFormat, db.ipVersion)
+	}
+
+	// Split into search tree and data section.
+	treeSize := db.nodeCount * db.recordSize / 4
+	dataStart := treeSize + dataSectionSeparator
+	dataEnd := uint(searchFrom + markerIndex)
+	if dataStart > dataEnd {
+		return nil, fmt.Errorf("%w: search tree exceeds file", ErrInvalidFormat)
+	}
+	db.tree = content[:treeSize]
+	db.data = content[dataStart:dataEnd]
+
+	// Find start of IPv4 subtree (::/96) in IPv6 databases.
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.readNode(node, 0)
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+// lookup returns the data of the given IP.
+func (db *DB) lookup(ip netip.Addr) (any, error) {
+	// Get start node and address bits.
+	var (
+		node    uint
+		ipBytes []byte
+	)
+	switch {
+	case ip.Is4() || ip.Is4In6():
+		ipv4 := ip.Unmap().As4()
+		ipBytes = ipv4[:]
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	case db.ipVersion == 4:
+		return nil, ErrNotFound
+	default:
+		ipv6 := ip.As16()
+		ipBytes = ipv6[:]
+	}
+
+	// Walk the search tree.
+	for i := 0; i < len(ipBytes)*8 && node < db.nodeCount; i++ {
+		bit := uint(ipBytes[i/8]>>(7-i%8)) & 1
+		node = db.readNode(node, bit)
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, ErrNotFound
+	case node < db.nodeCount:
+		return nil, fmt.Errorf("%w: search tree too deep", ErrInvalidFormat)
+	}
+
+	// Decode data.
+	offset := node - db.nodeCount - dataSectionSeparator
+	value, _, err := (&decoder{data: db.data}).decode(offset, 0)
+	return value, err
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of the node.
+func (db *DB) readNode(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		offset := node*6 + bit*3
+		b := db.tree[offset : offset+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7 : node*7+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default: // 32
+		offset := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.tree[offset : offset+4]))
+	}
+}
+
+// Country returns the ISO 3166-1 country code of the given IP.
+// The registered country is used if the location is not known.
+func (db *DB) Country(ip netip.Addr) (string, error) {
+	value, err := db.lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	record, ok := value.(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("%w: record is not a map", ErrInvalidFormat)
+	}
+
+	for _, key := range []string{"country", "registered_country"} {
+		country, ok := record[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		if isoCode, ok := country["iso_code"].(string); ok && isoCode != "" {
+			return isoCode, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func metaUint(meta map[string]any, key string) (uint, bool) {
+	value, ok := meta[key].(uint64)
+	if !ok || value > math.MaxUint32 {
+		return 0, false
+	}
+	return uint(value), true
+}
+
+// Data section types.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// decoder decodes values of the MaxMind DB data section format.
+type decoder struct {
+	data []byte
+}
+
+var errUnexpectedEnd = errors.New("unexpected end of data")
+
+// decode decodes the value at the given offset and returns the offset after
+// the value.
+func (d *decoder) decode(offset uint, depth int) (value any, next uint, err error) {
+	if depth > maxPointerDepth {
+		return nil, 0, errors.New("too many nested values")
+	}
+	if offset >= uint(len(d.data)) {
+		return nil, 0, errUnexpectedEnd
+	}
+
+	// Read control byte.
+	ctrl := d.data[offset]
+	offset++
+	dataType := uint(ctrl >> 5)
+	if dataType == typeExtended {
+		if offset >= uint(len(d.data)) {
+			return nil, 0, errUnexpectedEnd
+		}
+		dataType = 7 + uint(d.data[offset])
+		offset++
+	}
+
+	// Pointers encode their size differently.
+	if dataType == typePointer {
+		pointer, next, err := d.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	// Read size.
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		sizeBytes := size - 28
+		b, err := d.read(offset, sizeBytes)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += sizeBytes
+		switch sizeBytes {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	switch dataType {
+	case typeMap:
+		m := make(map[string]any, size)
+		for range size {
+			key, keyNext, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			m[keyString], offset, err = d.decode(keyNext, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+
+	case typeArray:
+		a := make([]any, 0, min(size, 1024))
+		for range size {
+			var element any
+			element, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, element)
+		}
+		return a, offset, nil
+
+	case typeBool:
+		return size != 0, offset, nil
+
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	// All other types are stored in the following bytes.
+	b, err := d.read(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch dataType {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return bytes.Clone(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	case typeUint128:
+		// Not needed, return raw bytes.
+		return bytes.Clone(b), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown data type %d", dataType)
+	}
+}
+
+// decodePointer decodes a pointer and returns the offset it points to.
+func (d *decoder) decodePointer(ctrl byte, offset uint) (pointer, next uint, err error) {
+	pointerSize := uint((ctrl>>3)&0x3) + 1
+	b, err := d.read(offset, pointerSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	prefix := uint(ctrl & 0x7)
+	switch pointerSize {
+	case 1:
+		pointer = prefix<<8 | uint(b[0])
+	case 2:
+		pointer = (prefix<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		pointer = (prefix<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + pointerSize, nil
+}
+
+func (d *decoder) read(offset, size uint) ([]byte, error) {
+	if offset+size > uint(len(d.data)) {
+		return nil, errUnexpectedEnd
+	}
+	return d.data[offset : offset+size], nil
+}
@@ -0,0 +1,191 @@
+package geoip
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// Locator returns the country of an IP address.
+type Locator interface {
+	Country(ip netip.Addr) (string, error)
+}
+
+// Mismatch describes how far a claimed geo marker is off from the location of
+// the underlay address.
+type Mismatch uint8
+
+// Mismatch levels.
+const (
+	MismatchNone Mismatch = iota
+	MismatchCountry
+	MismatchRegion
+	MismatchContinent
+)
+
+// String returns the name of the mismatch level.
+func (mm Mismatch) String() string {
+	switch mm {
+	case MismatchNone:
+		return "none"
+	case MismatchCountry:
+		return "country"
+	case MismatchRegion:
+		return "region"
+	case MismatchContinent:
+		return "continent"
+	default:
+		return "unknown"
+	}
+}
+
+// Large returns whether the mismatch is larger than a neighboring country.
+// Small mismatches are common, as GeoIP databases are not always accurate
+// and routers may be located near borders.
+func (mm Mismatch) Large() bool {
+	return mm >= MismatchRegion
+}
+
+// Verification is the result of verifying the geo marker of a router.
+type Verification struct {
+	Router   netip.Addr `json:"router"`
+	Underlay netip.Addr `json:"underlay"`
+
+	// Claimed is the country of the geo marker of the router.
+	Claimed string `json:"claimed"`
+	// Located is the country of the underlay address.
+	Located string `json:"located"`
+
+	Mismatch Mismatch  `json:"mismatch"`
+	Checked  time.Time `json:"checked"`
+}
+
+// Flagged returns whether the router was flagged for a large mismatch.
+func (v Verification) Flagged() bool {
+	return v.Mismatch.Large()
+}
+
+// Verifier verifies the claimed geo markers of routers against the location
+// of their underlay addresses and remembers the results.
+type Verifier struct {
+	locator Locator
+
+	results     map[netip.Addr]Verification
+	resultsLock sync.RWMutex
+}
+
+// NewVerifier returns a new verifier using the given locator.
+func NewVerifier(locator Locator) *Verifier {
+	return &Verifier{
+		locator: locator,
+		results: make(map[netip.Addr]Verification),
+	}
+}
+
+// Verify verifies the geo marker of the router against the location of the
+// given underlay address. Routers without a geo marker and underlay addresses
+// that cannot be located are not verified and return ok=false.
+func (v *Verifier) Verify(router, underlay netip.Addr) (result Verification, ok bool, err error) {
+	claimed, err := m.LookupCountryMarker(router)
+	if err != nil {
+		// Router has no geo marker.
+		return Verification{}, false, nil
+	}
+	located, err := v.locator.Country(underlay.Unmap())
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return Verification{}, false, nil
+	case err != nil:
+		return Verification{}, false, err
+	}
+
+	result = Verification{
+		Router:   router,
+		Underlay: underlay,
+		Claimed:  claimed.Country,
+		Located:  located,
+		Mismatch: Compare(claimed, located),
+		Checked:  time.Now(),
+	}
+
+	v.resultsLock.Lock()
+	defer v.resultsLock.Unlock()
+
+	v.results[router] = result
+	return result, true, nil
+}
+
+// Compare returns the mismatch between the claimed geo marker and the given
+// country code.
+func Compare(claimed *m.CountryMarkerLookup, located string) Mismatch {
+	// Geo markers of US states have the state code appended.
+	claimedCountry, _, _ := strings.Cut(claimed.Country, "-")
+	if claimedCountry == located {
+		return MismatchNone
+	}
+
+	// US states span multiple regions, so use any state to compare the
+	// continent only.
+	markerCode := located
+	regionKnown := true
+	if located == "US" {
+		markerCode = "US-NY"
+		regionKnown = false
+	}
+
+	// Get region and continent of the located country.
+	prefix, err := m.GetCountryPrefix(markerCode)
+	if err != nil {
+		// Country has no geo marker, only compare country.
+		return MismatchCountry
+	}
+	locatedMarker, err := m.LookupCountryMarker(prefix.Addr())
+	if err != nil {
+		return MismatchCountry
+	}
+
+	switch {
+	case claimed.Continent != locatedMarker.Continent:
+		return MismatchContinent
+	case regionKnown && claimed.Region != locatedMarker.Region:
+		return MismatchRegion
+	default:
+		return MismatchCountry
+	}
+}
+
+// Flagged returns whether the given router was flagged for a large mismatch.
+func (v *Verifier) Flagged(router netip.Addr) bool {
+	v.resultsLock.RLock()
+	defer v.resultsLock.RUnlock()
+
+	return v.results[router].Flagged()
+}
+
+// Forget removes the verification result of the given router.
+func (v *Verifier) Forget(router netip.Addr) {
+	v.resultsLock.Lock()
+	defer v.resultsLock.Unlock()
+
+	delete(v.results, router)
+}
+
+// Results returns all verification results, sorted by router.
+func (v *Verifier) Results() []Verification {
+	v.resultsLock.RLock()
+	defer v.resultsLock.RUnlock()
+
+	results := make([]Verification, 0, len(v.results))
+	for _, result := range v.results {
+		results = append(results, result)
+	}
+	slices.SortFunc(results, func(a, b Verification) int {
+		return a.Router.Compare(b.Router)
+	})
+	return results
+}
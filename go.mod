@@ -14,6 +14,8 @@ go 1.22.0
 require gvisor.dev/gvisor v0.0.0-20240628004447-03c52c5252a6
 
 require (
+	connectrpc.com/connect v1.18.1
+	filippo.io/edwards25519 v1.0.0-beta.2
 	github.com/brianvoe/gofakeit v3.18.0+incompatible
 	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/leekchan/gtf v0.0.0-20190214083521-5fba33c5b00b
@@ -34,8 +36,10 @@ require (
 	golang.org/x/exp v0.0.0-20240613232115-7f521ea00fb8
 	golang.org/x/net v0.26.0
 	golang.org/x/sys v0.21.0
+	golang.org/x/time v0.5.0
 	golang.zx2c4.com/wireguard v0.0.0-20231211153847-12269c276173
 	golang.zx2c4.com/wireguard/windows v0.5.3
+	google.golang.org/protobuf v1.36.5
 	gopkg.in/yaml.v2 v2.4.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -52,7 +56,6 @@ require (
 	golang.org/x/mod v0.18.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
-	golang.org/x/time v0.5.0 // indirect
 	golang.org/x/tools v0.22.0 // indirect
 	golang.zx2c4.com/wintun v0.0.0-20230126152724-0fa3db229ce2 // indirect
 )
@@ -0,0 +1,394 @@
+package ha
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/storage"
+)
+
+const (
+	// heartbeatInterval defines how often heartbeats are sent.
+	heartbeatInterval = 1 * time.Second
+	// deadInterval defines after how long without heartbeats the other router
+	// is considered dead.
+	deadInterval = 3 * heartbeatInterval
+	// witnessInterval defines how often the witness lease is renewed.
+	witnessInterval = 2 * time.Second
+	// witnessTimeout defines how long to wait for a witness to respond.
+	witnessTimeout = 1 * time.Second
+	// maxHeartbeatSize limits the size of heartbeat messages.
+	maxHeartbeatSize = 1024
+)
+
+// HA manages the role of the router in an active-standby pair of two routers
+// that share the same identity. Only the active router runs the data plane
+// and has the router address on the tun device.
+type HA struct {
+	instance instance
+	mgr      *mgr.Manager
+	cfg      *config.HA
+	key      []byte
+	encKey   []byte
+	// node randomly identifies this router of the pair at the witnesses.
+	node uint64
+
+	// setActive starts or stops the data plane.
+	setActive func(active bool) error
+
+	conn net.PacketConn
+	ln   net.Listener
+
+	lock    sync.Mutex
+	role    Role
+	term    uint64
+	since   time.Time
+	started time.Time
+
+	peerRole     Role
+	peerPriority uint8
+	peerTerm     uint64
+	peerSeen     time.Time
+	peerMsgTime  int64
+	// peerSnapshotTime is tracked separately, as snapshots take longer to
+	// transfer than heartbeats.
+	peerSnapshotTime int64
+
+	// leaseExpires is when the lease granted by the witnesses expires.
+	leaseExpires time.Time
+
+	replicated        time.Time
+	replicatedRouters int
+	lastMsgTime       int64
+}
+
+// instance is an interface subset of inst.Ance.
+type instance interface {
+	Config() *config.Config
+	Identity() *m.Address
+	Storage() storage.Storage
+}
+
+// Status is the high availability status of the router.
+type Status struct {
+	Role     Role      `json:"role"`
+	Term     uint64    `json:"term"`
+	Priority uint8     `json:"priority"`
+	Since    time.Time `json:"since"`
+
+	// PeerRole is empty if the other router is not responding.
+	PeerRole     Role      `json:"peerRole,omitempty"`
+	PeerPriority uint8     `json:"peerPriority,omitempty"`
+	PeerSeen     time.Time `json:"peerSeen,omitempty"`
+
+	// WitnessOK is set if the router holds the lease of the witnesses, or no
+	// witnesses are configured.
+	WitnessOK bool `json:"witnessOK"`
+
+	// Replicated is when state was last sent to or received from the other
+	// router.
+	Replicated        time.Time `json:"replicated,omitempty"`
+	ReplicatedRouters int       `json:"replicatedRouters,omitempty"`
+}
+
+// New returns a new high availability manager.
+// The given function is called to start or stop the data plane.
+func New(instance instance, setActive func(active bool) error) (*HA, error) {
+	cfg := instance.Config().HA
+	if cfg == nil {
+		return nil, errors.New("high availability is not configured")
+	}
+
+	var node [8]byte
+	if _, err := rand.Read(node[:]); err != nil {
+		return nil, fmt.Errorf("generate node ID: %w", err)
+	}
+	ha := &HA{
+		instance:  instance,
+		cfg:       cfg,
+		key:       deriveMACKey(instance.Identity()),
+		encKey:    deriveEncKey(instance.Identity()),
+		node:      binary.BigEndian.Uint64(node[:]),
+		setActive: setActive,
+		role:      RoleStandby,
+	}
+
+	// Listen for heartbeats and state.
+	var err error
+	ha.conn, err = net.ListenPacket("udp", cfg.Listen.String())
+	if err != nil {
+		return nil, fmt.Errorf("listen for heartbeats: %w", err)
+	}
+	ha.ln, err = net.Listen("tcp", cfg.Listen.String())
+	if err != nil {
+		_ = ha.conn.Close()
+		return nil, fmt.Errorf("listen for state replication: %w", err)
+	}
+
+	return ha, nil
+}
+
+// Start starts the high availability manager.
+// The router starts on standby, as the data plane is not started with the
+// other modules.
+func (ha *HA) Start(mgr *mgr.Manager) error {
+	ha.mgr = mgr
+
+	ha.lock.Lock()
+	ha.started = time.Now()
+	ha.since = ha.started
+	ha.lock.Unlock()
+
+	if len(ha.cfg.Witnesses) == 0 {
+		mgr.Warn("no witnesses configured, both routers may become active if the link between them fails")
+	}
+
+	mgr.Go("heartbeat", ha.heartbeatWorker)
+	mgr.Go("receive heartbeats", ha.receiveWorker)
+	mgr.Go("check witnesses", ha.witnessWorker)
+	mgr.Go("replicate state", ha.replicationWorker)
+	mgr.Go("receive state", ha.receiveStateWorker)
+	return nil
+}
+
+// Stop stops the high availability manager.
+func (ha *HA) Stop(mgr *mgr.Manager) error {
+	// Tell the other router to take over now.
+	if err := ha.releaseLease(mgr.Ctx()); err != nil {
+		mgr.Warn("failed to release witness lease", "err", err)
+	}
+	if err := ha.sendHeartbeat(true); err != nil {
+		mgr.Warn("failed to send leaving heartbeat", "err", err)
+	}
+
+	if err := ha.conn.Close(); err != nil {
+		mgr.Warn("failed to close heartbeat listener", "err", err)
+	}
+	if err := ha.ln.Close(); err != nil {
+		mgr.Warn("failed to close state listener", "err", err)
+	}
+	return nil
+}
+
+// Status returns the current high availability status.
+func (ha *HA) Status() Status {
+	ha.lock.Lock()
+	defer ha.lock.Unlock()
+
+	status := Status{
+		Role:              ha.role,
+		Term:              ha.term,
+		Priority:          ha.cfg.Priority,
+		Since:             ha.since,
+		PeerSeen:          ha.peerSeen,
+		WitnessOK:         ha.witnessOK(time.Now()),
+		Replicated:        ha.replicated,
+		ReplicatedRouters: ha.replicatedRouters,
+	}
+	if ha.peerAlive(time.Now()) {
+		status.PeerRole = ha.peerRole
+		status.PeerPriority = ha.peerPriority
+	}
+	return status
+}
+
+// IsActive returns whether the router is the active router of the pair.
+func (ha *HA) IsActive() bool {
+	ha.lock.Lock()
+	defer ha.lock.Unlock()
+
+	return ha.role == RoleActive
+}
+
+// peerAlive returns whether the other router sent a heartbeat recently.
+// Must be called with the lock held.
+func (ha *HA) peerAlive(now time.Time) bool {
+	return !ha.peerSeen.IsZero() && now.Sub(ha.peerSeen) < deadInterval
+}
+
+// witnessOK returns whether the router holds the lease of the witnesses, or
+// no witnesses are configured.
+// Must be called with the lock held.
+func (ha *HA) witnessOK(now time.Time) bool {
+	return len(ha.cfg.Witnesses) == 0 || now.Before(ha.leaseExpires)
+}
+
+// roleState returns the current state to decide the role with.
+// Must be called with the lock held.
+func (ha *HA) roleState(now time.Time) roleState {
+	return roleState{
+		Role:         ha.role,
+		Priority:     ha.cfg.Priority,
+		Term:         ha.term,
+		PeerAlive:    ha.peerAlive(now),
+		PeerRole:     ha.peerRole,
+		PeerPriority: ha.peerPriority,
+		PeerTerm:     ha.peerTerm,
+		WitnessOK:    ha.witnessOK(now),
+		Starting:     now.Sub(ha.started) < deadInterval,
+	}
+}
+
+// wantsLease returns whether the router is active or would become active,
+// if it held the lease of the witnesses.
+func (ha *HA) wantsLease(now time.Time) bool {
+	ha.lock.Lock()
+	state := ha.roleState(now)
+	ha.lock.Unlock()
+
+	state.WitnessOK = true
+	role, _ := nextRole(state)
+	return role == RoleActive
+}
+
+func (ha *HA) heartbeatWorker(w *mgr.WorkerCtx) error {
+	// Enter standby.
+	// This waits until the other modules of the group are started.
+	if err := ha.setActive(false); err != nil {
+		return fmt.Errorf("enter standby: %w", err)
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		ha.updateRole(w)
+		if err := ha.sendHeartbeat(false); err != nil {
+			w.Debug("failed to send heartbeat", "err", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+// updateRole decides the role of the router and applies changes.
+func (ha *HA) updateRole(w *mgr.WorkerCtx) {
+	now := time.Now()
+
+	ha.lock.Lock()
+	state := ha.roleState(now)
+	ha.lock.Unlock()
+
+	role, reason := nextRole(state)
+	if role == state.Role {
+		return
+	}
+
+	// Apply new role.
+	if err := ha.setActive(role == RoleActive); err != nil {
+		if errors.Is(err, mgr.ErrGroupStopping) {
+			// The router is shutting down.
+			return
+		}
+		w.Error("failed to change role", "role", role, "err", err)
+		if role == RoleActive {
+			// Make sure the data plane is stopped again.
+			if err := ha.setActive(false); err != nil {
+				w.Error("failed to return to standby", "err", err)
+			}
+		}
+		return
+	}
+
+	ha.lock.Lock()
+	defer ha.lock.Unlock()
+
+	ha.role = role
+	ha.since = now
+	if role == RoleActive {
+		ha.term = max(ha.term, ha.peerTerm) + 1
+	}
+	w.Warn("changed role", "role", role, "term", ha.term, "reason", reason)
+}
+
+// sendHeartbeat sends a heartbeat to the other router.
+func (ha *HA) sendHeartbeat(leaving bool) error {
+	ha.lock.Lock()
+	msg := &message{
+		Type:     msgTypeHeartbeat,
+		Time:     ha.nextMsgTime(),
+		Role:     ha.role,
+		Priority: ha.cfg.Priority,
+		Term:     ha.term,
+		Leaving:  leaving,
+	}
+	ha.lock.Unlock()
+
+	data, err := sealMessage(ha.key, msg)
+	if err != nil {
+		return err
+	}
+	_, err = ha.conn.WriteTo(data, net.UDPAddrFromAddrPort(ha.cfg.Peer))
+	return err
+}
+
+// nextMsgTime returns a strictly increasing message time.
+// Must be called with the lock held.
+func (ha *HA) nextMsgTime() int64 {
+	ha.lastMsgTime = max(time.Now().UnixNano(), ha.lastMsgTime+1)
+	return ha.lastMsgTime
+}
+
+func (ha *HA) receiveWorker(w *mgr.WorkerCtx) error {
+	buf := make([]byte, maxHeartbeatSize)
+	for {
+		n, addr, err := ha.conn.ReadFrom(buf)
+		if err != nil {
+			if w.IsDone() {
+				return nil
+			}
+			return fmt.Errorf("read heartbeat: %w", err)
+		}
+
+		// Check source.
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok || udpAddr.AddrPort().Addr().Unmap() != ha.cfg.Peer.Addr().Unmap() {
+			w.Debug("ignoring heartbeat from unexpected source", "src", addr)
+			continue
+		}
+
+		if err := ha.handleHeartbeat(w, buf[:n]); err != nil {
+			w.Warn("invalid heartbeat", "src", addr, "err", err)
+		}
+	}
+}
+
+func (ha *HA) handleHeartbeat(w *mgr.WorkerCtx, data []byte) error {
+	ha.lock.Lock()
+	defer ha.lock.Unlock()
+
+	msg, err := openMessage(ha.key, data, ha.peerMsgTime, time.Now())
+	if err != nil {
+		return err
+	}
+	if msg.Type != msgTypeHeartbeat {
+		return fmt.Errorf("%w: unexpected type %q", ErrInvalidMessage, msg.Type)
+	}
+	if msg.Priority == ha.cfg.Priority {
+		w.Warn("both routers have the same priority, configure different priorities", "priority", msg.Priority)
+	}
+
+	ha.peerMsgTime = msg.Time
+	ha.peerRole = msg.Role
+	ha.peerPriority = msg.Priority
+	ha.peerTerm = msg.Term
+	if msg.Leaving {
+		// Consider the other router dead immediately.
+		ha.peerSeen = time.Time{}
+	} else {
+		ha.peerSeen = time.Now()
+	}
+	return nil
+}
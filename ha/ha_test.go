@@ -0,0 +1,344 @@
+package ha
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestNextRole(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		state roleState
+		want  Role
+	}{
+		{
+			name:  "standby waits for heartbeats after start",
+			state: roleState{Role: RoleStandby, Priority: 2, WitnessOK: true, Starting: true},
+			want:  RoleStandby,
+		},
+		{
+			name:  "standby takes over from dead router",
+			state: roleState{Role: RoleStandby, Priority: 1, WitnessOK: true},
+			want:  RoleActive,
+		},
+		{
+			name:  "standby without witness stays on standby",
+			state: roleState{Role: RoleStandby, Priority: 2},
+			want:  RoleStandby,
+		},
+		{
+			name: "standby does not preempt active router",
+			state: roleState{
+				Role: RoleStandby, Priority: 2, WitnessOK: true,
+				PeerAlive: true, PeerRole: RoleActive, PeerPriority: 1,
+			},
+			want: RoleStandby,
+		},
+		{
+			name: "higher priority wins when both on standby",
+			state: roleState{
+				Role: RoleStandby, Priority: 2, WitnessOK: true,
+				PeerAlive: true, PeerRole: RoleStandby, PeerPriority: 1,
+			},
+			want: RoleActive,
+		},
+		{
+			name: "lower priority waits when both on standby",
+			state: roleState{
+				Role: RoleStandby, Priority: 1, WitnessOK: true,
+				PeerAlive: true, PeerRole: RoleStandby, PeerPriority: 2,
+			},
+			want: RoleStandby,
+		},
+		{
+			name:  "active steps down without witness",
+			state: roleState{Role: RoleActive, Priority: 2},
+			want:  RoleStandby,
+		},
+		{
+			name: "active with higher term stays active",
+			state: roleState{
+				Role: RoleActive, Priority: 1, Term: 3, WitnessOK: true,
+				PeerAlive: true, PeerRole: RoleActive, PeerPriority: 2, PeerTerm: 2,
+			},
+			want: RoleActive,
+		},
+		{
+			name: "active with lower term steps down",
+			state: roleState{
+				Role: RoleActive, Priority: 2, Term: 2, WitnessOK: true,
+				PeerAlive: true, PeerRole: RoleActive, PeerPriority: 1, PeerTerm: 3,
+			},
+			want: RoleStandby,
+		},
+		{
+			name: "priority breaks term tie",
+			state: roleState{
+				Role: RoleActive, Priority: 1, Term: 2, WitnessOK: true,
+				PeerAlive: true, PeerRole: RoleActive, PeerPriority: 2, PeerTerm: 2,
+			},
+			want: RoleStandby,
+		},
+	}
+	for _, tc := range tests {
+		role, _ := nextRole(tc.state)
+		assert.Equal(t, tc.want, role, tc.name)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	other, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	key := deriveMACKey(identity)
+
+	now := time.Now()
+	data, err := sealMessage(key, &message{
+		Type:     msgTypeHeartbeat,
+		Time:     now.UnixNano(),
+		Role:     RoleActive,
+		Priority: 7,
+	})
+	require.NoError(t, err)
+
+	// Valid message.
+	msg, err := openMessage(key, data, 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, RoleActive, msg.Role)
+	assert.Equal(t, uint8(7), msg.Priority)
+
+	// Replayed message.
+	_, err = openMessage(key, data, msg.Time, now)
+	assert.True(t, errors.Is(err, ErrStaleMessage), "replay must be rejected")
+
+	// Old message.
+	_, err = openMessage(key, data, 0, now.Add(time.Minute))
+	assert.True(t, errors.Is(err, ErrStaleMessage), "old message must be rejected")
+
+	// Different identity.
+	_, err = openMessage(deriveMACKey(other), data, 0, now)
+	assert.True(t, errors.Is(err, ErrInvalidMAC), "message of other identity must be rejected")
+
+	// Tampered message.
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-40] ^= 0x01
+	_, err = openMessage(key, tampered, 0, now)
+	assert.Error(t, err, "tampered message must be rejected")
+}
+
+func TestApplySnapshot(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewMemStorage()
+	routers := make([]*storage.StoredRouter, 0, 3)
+	for range 3 {
+		addr, _, err := m.GeneratePrivacyAddress(context.Background())
+		require.NoError(t, err)
+		routers = append(routers, &storage.StoredRouter{
+			Address:   &addr.PublicAddress,
+			UpdatedAt: time.Now(),
+		})
+	}
+	// Entries without address are skipped.
+	routers = append(routers, &storage.StoredRouter{}, nil)
+
+	applied, err := applySnapshot(store, routers)
+	require.NoError(t, err)
+	assert.Equal(t, 3, applied)
+	for _, r := range routers[:3] {
+		stored, err := store.GetRouter(r.Address.IP)
+		require.NoError(t, err)
+		assert.Equal(t, r.Address.IP, stored.Address.IP)
+	}
+}
+
+func TestWitness(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	request := func(node uint64, sent time.Time, release bool) *witnessRequest {
+		t.Helper()
+
+		req := &witnessRequest{
+			Address: identity.PublicAddress,
+			Node:    node,
+			Time:    sent.UnixNano(),
+			Release: release,
+		}
+		require.NoError(t, req.sign(identity))
+		return req
+	}
+	wt := NewWitness()
+	now := time.Now()
+
+	// The first router gets the lease and may renew it.
+	assert.True(t, wt.handle(request(1, now, false), now).Granted)
+	now = now.Add(time.Second)
+	assert.True(t, wt.handle(request(1, now, false), now).Granted)
+
+	// The other router does not get the lease until it expires.
+	now = now.Add(time.Second)
+	assert.False(t, wt.handle(request(2, now, false), now).Granted)
+	now = now.Add(leaseTTL)
+	assert.True(t, wt.handle(request(2, now, false), now).Granted)
+
+	// Released leases are free immediately.
+	now = now.Add(time.Second)
+	assert.False(t, wt.handle(request(1, now, false), now).Granted)
+	wt.handle(request(2, now, true), now)
+	now = now.Add(time.Second)
+	assert.True(t, wt.handle(request(1, now, false), now).Granted)
+
+	// Replayed and forged requests are rejected.
+	replayed := request(2, now, false)
+	now = now.Add(leaseTTL)
+	assert.True(t, wt.handle(replayed, now).Granted)
+	assert.NotEmpty(t, wt.handle(replayed, now).Err)
+	forged := request(1, now.Add(time.Second), false)
+	forged.Node = 3
+	assert.NotEmpty(t, wt.handle(forged, now).Err)
+	assert.NotEmpty(t, wt.handle(request(1, now.Add(-time.Hour), false), now).Err, "stale request must be rejected")
+}
+
+type testInstance struct {
+	config   *config.Config
+	identity *m.Address
+	storage  storage.Storage
+}
+
+func (i *testInstance) Config() *config.Config   { return i.config }
+func (i *testInstance) Identity() *m.Address     { return i.identity }
+func (i *testInstance) Storage() storage.Storage { return i.storage }
+
+func TestWitnessLease(t *testing.T) {
+	t.Parallel()
+
+	// Start witness.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = NewWitness().Serve(ctx, ln)
+	}()
+
+	// Create both routers of the pair.
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	cfg := &config.HA{Witnesses: []string{ln.Addr().String()}}
+	newHA := func(node uint64) *HA {
+		return &HA{
+			instance: &testInstance{identity: identity},
+			cfg:      cfg,
+			node:     node,
+		}
+	}
+	a, b := newHA(1), newHA(2)
+
+	// Only one router gets the lease.
+	expires, err := a.requestLease(ctx, false)
+	require.NoError(t, err)
+	assert.True(t, expires.After(time.Now()))
+	a.leaseExpires = expires
+	assert.True(t, a.witnessOK(time.Now()))
+	expires, err = b.requestLease(ctx, false)
+	require.NoError(t, err)
+	assert.True(t, expires.IsZero(), "lease must not be granted to both routers")
+
+	// The other router gets the lease when it is released.
+	require.NoError(t, a.releaseLease(ctx))
+	assert.False(t, a.witnessOK(time.Now()))
+	expires, err = b.requestLease(ctx, false)
+	require.NoError(t, err)
+	assert.False(t, expires.IsZero())
+
+	// Unreachable witnesses do not grant the lease.
+	b.cfg = &config.HA{Witnesses: []string{ln.Addr().String(), "127.0.0.1:1", "127.0.0.1:2"}}
+	expires, err = b.requestLease(ctx, false)
+	require.Error(t, err)
+	assert.True(t, expires.IsZero(), "lease requires a majority of witnesses")
+}
+
+func TestExportRouters(t *testing.T) {
+	t.Parallel()
+
+	// Add more routers than fit into a snapshot.
+	store := storage.NewMemStorage()
+	total := maxReplicatedRouters + 5
+	prefix := netip.MustParsePrefix("fd00::/64").Addr().As16()
+	for i := range total {
+		ip := prefix
+		ip[14], ip[15] = byte(i>>8), byte(i)
+		require.NoError(t, store.SaveRouter(&storage.StoredRouter{
+			Address: &m.PublicAddress{IP: netip.AddrFrom16(ip)},
+		}))
+	}
+
+	// All routers must be sent with the following snapshots.
+	sent := make(map[netip.Addr]struct{})
+	var since time.Time
+	for range 3 {
+		routers, next, err := exportRouters(store, since)
+		require.NoError(t, err)
+		for _, r := range routers {
+			sent[r.Address.IP] = struct{}{}
+		}
+		if next.IsZero() {
+			break
+		}
+		since = next
+	}
+	assert.Len(t, sent, total)
+}
+
+func TestReplicateTickets(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	router := netip.MustParseAddr("fd00::1")
+	tickets := []storage.StoredResumptionTicket{{
+		Router:  router,
+		Secret:  []byte("secret"),
+		Expires: time.Now().Add(time.Hour).Round(0),
+	}}
+
+	// Tickets must be encrypted.
+	sealed, err := sealTickets(deriveEncKey(identity), tickets)
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	// Tickets are saved by the other router.
+	store := storage.NewMemStorage()
+	ha := &HA{
+		instance: &testInstance{identity: identity, storage: store},
+		encKey:   deriveEncKey(identity),
+	}
+	require.NoError(t, ha.applyTickets(sealed))
+	ticket, err := store.GetResumptionTicket(router)
+	require.NoError(t, err)
+	assert.Equal(t, tickets[0].Secret, ticket.Secret)
+
+	// Tickets of other identities are rejected.
+	other, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	_, err = openTickets(deriveEncKey(other), sealed)
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
@@ -0,0 +1,166 @@
+package ha
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/zeebo/blake3"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/storage"
+)
+
+const (
+	macKeyContext = "mycoria ha message authentication"
+	encKeyContext = "mycoria ha state encryption"
+)
+
+// maxMessageAge defines how old messages may be. It also defines how far the
+// clocks of the two routers may be apart.
+const maxMessageAge = 30 * time.Second
+
+// Message errors.
+var (
+	ErrInvalidMessage = errors.New("invalid message")
+	ErrInvalidMAC     = errors.New("message authentication failed")
+	ErrStaleMessage   = errors.New("message is stale or replayed")
+)
+
+// Message types.
+const (
+	msgTypeHeartbeat = "heartbeat"
+	msgTypeSnapshot  = "snapshot"
+)
+
+// message is exchanged between the two routers of the pair.
+type message struct {
+	Type string `cbor:"t,omitempty"`
+	// Time is the time the message was sent in unix nanoseconds.
+	// It must increase with every message, which prevents replays.
+	Time int64 `cbor:"c,omitempty"`
+
+	// Heartbeat.
+	Role     Role   `cbor:"r,omitempty"`
+	Priority uint8  `cbor:"p,omitempty"`
+	Term     uint64 `cbor:"e,omitempty"`
+	// Leaving is set when the router shuts down, so that the other router
+	// takes over immediately.
+	Leaving bool `cbor:"l,omitempty"`
+
+	// Snapshot.
+	Routers []*storage.StoredRouter `cbor:"s,omitempty"`
+	// Tickets holds the encrypted session resumption tickets, so that the
+	// other router can resume the encrypted sessions after a failover.
+	Tickets []byte `cbor:"k,omitempty"`
+}
+
+// envelope authenticates a message.
+type envelope struct {
+	Message []byte `cbor:"m,omitempty"`
+	MAC     []byte `cbor:"a,omitempty"`
+}
+
+// deriveMACKey derives the key to authenticate messages from the private key
+// of the shared identity, so that no additional secret must be configured.
+func deriveMACKey(identity *m.Address) []byte {
+	key := make([]byte, 32)
+	blake3.DeriveKey(macKeyContext, identity.PrivateKey, key)
+	return key
+}
+
+// deriveEncKey derives the key to encrypt secrets in messages from the private
+// key of the shared identity.
+func deriveEncKey(identity *m.Address) []byte {
+	key := make([]byte, chacha20poly1305.KeySize)
+	blake3.DeriveKey(encKeyContext, identity.PrivateKey, key)
+	return key
+}
+
+// sealTickets serializes and encrypts the resumption tickets.
+func sealTickets(key []byte, tickets []storage.StoredResumptionTicket) ([]byte, error) {
+	data, err := cbor.Marshal(tickets)
+	if err != nil {
+		return nil, fmt.Errorf("marshal tickets: %w", err)
+	}
+	c, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, c.NonceSize(), c.NonceSize()+len(data)+c.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return c.Seal(nonce, nonce, data, nil), nil
+}
+
+// openTickets decrypts and parses the resumption tickets.
+func openTickets(key []byte, data []byte) ([]storage.StoredResumptionTicket, error) {
+	c, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < c.NonceSize() {
+		return nil, ErrInvalidMessage
+	}
+	plain, err := c.Open(nil, data[:c.NonceSize()], data[c.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decrypt tickets: %w", ErrInvalidMessage, err)
+	}
+	var tickets []storage.StoredResumptionTicket
+	if err := cbor.Unmarshal(plain, &tickets); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+	return tickets, nil
+}
+
+// sealMessage serializes and authenticates the message.
+func sealMessage(key []byte, msg *message) ([]byte, error) {
+	data, err := cbor.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal message: %w", err)
+	}
+	return cbor.Marshal(&envelope{
+		Message: data,
+		MAC:     messageMAC(key, data),
+	})
+}
+
+// openMessage verifies and parses the message.
+// Messages must be newer than the given time of the last message.
+func openMessage(key []byte, data []byte, lastTime int64, now time.Time) (*message, error) {
+	env := &envelope{}
+	if err := cbor.Unmarshal(data, env); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+	if subtle.ConstantTimeCompare(messageMAC(key, env.Message), env.MAC) != 1 {
+		return nil, ErrInvalidMAC
+	}
+
+	msg := &message{}
+	if err := cbor.Unmarshal(env.Message, msg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+	sent := time.Unix(0, msg.Time)
+	switch {
+	case msg.Time <= lastTime:
+		return nil, ErrStaleMessage
+	case now.Sub(sent).Abs() > maxMessageAge:
+		return nil, fmt.Errorf("%w: clocks are %s apart", ErrStaleMessage, now.Sub(sent).Round(time.Second))
+	}
+	return msg, nil
+}
+
+func messageMAC(key, data []byte) []byte {
+	h, err := blake3.NewKeyed(key)
+	if err != nil {
+		// Only fails with an invalid key size.
+		panic(err)
+	}
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
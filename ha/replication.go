@@ -0,0 +1,259 @@
+package ha
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/storage"
+)
+
+const (
+	// replicationInterval defines how often the active router sends its
+	// state to the standby router.
+	replicationInterval = 1 * time.Minute
+	// replicationTimeout defines how long sending the state may take.
+	replicationTimeout = 30 * time.Second
+	// maxReplicatedRouters limits the amount of routers in a snapshot.
+	// More routers are sent with the next snapshots.
+	maxReplicatedRouters = 10_000
+	// maxReplicatedTickets limits the amount of resumption tickets in a
+	// snapshot. The tickets that expire last are sent.
+	maxReplicatedTickets = 10_000
+	// maxSnapshotSize limits the size of snapshots.
+	maxSnapshotSize = 64 << 20 // 64 MiB
+)
+
+// replicationWorker sends the known routers and their announced info to the
+// standby router, so that it can take over without relearning the network.
+// Encryption sessions themselves are not replicated, but their resumption
+// tickets are, so that sessions are resumed after a failover instead of
+// requiring a new key exchange. Tickets that changed since the last snapshot
+// do not match anymore, in which case the routers fall back to a key exchange.
+func (ha *HA) replicationWorker(w *mgr.WorkerCtx) error {
+	ticker := time.NewTicker(replicationInterval)
+	defer ticker.Stop()
+
+	var lastSent time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.Done():
+			return nil
+		}
+
+		ha.lock.Lock()
+		replicate := ha.role == RoleActive && ha.peerAlive(time.Now()) && ha.peerRole == RoleStandby
+		ha.lock.Unlock()
+		if !replicate {
+			// Send full state when the other router is back.
+			lastSent = time.Time{}
+			continue
+		}
+
+		started := time.Now()
+		sent, next, err := ha.sendSnapshot(lastSent)
+		if err != nil {
+			w.Warn("failed to replicate state", "err", err)
+			continue
+		}
+		if next.IsZero() {
+			// Overlap a little, as routers may be updated while exporting.
+			next = started.Add(-time.Second)
+		}
+		lastSent = next
+		w.Debug("replicated state", "routers", sent, "time", time.Since(started))
+	}
+}
+
+// sendSnapshot sends the routers updated since the given time to the other
+// router and returns how many were sent. If there were more routers than fit
+// into a snapshot, the oldest are sent and the time to continue from with
+// the next snapshot is returned.
+func (ha *HA) sendSnapshot(since time.Time) (sent int, next time.Time, err error) {
+	routers, next, err := exportRouters(ha.instance.Storage(), since)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	// Export resumption tickets.
+	tickets, err := ha.instance.Storage().QueryResumptionTickets()
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("export resumption tickets: %w", err)
+	}
+	if len(tickets) > maxReplicatedTickets {
+		tickets = tickets[:maxReplicatedTickets]
+	}
+	sealedTickets, err := sealTickets(ha.encKey, tickets)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	ha.lock.Lock()
+	msg := &message{
+		Type:    msgTypeSnapshot,
+		Time:    ha.nextMsgTime(),
+		Routers: routers,
+		Tickets: sealedTickets,
+	}
+	ha.lock.Unlock()
+	data, err := sealMessage(ha.key, msg)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	// Send to other router.
+	conn, err := net.DialTimeout("tcp", ha.cfg.Peer.String(), replicationTimeout)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer conn.Close() //nolint:errcheck
+	if err := conn.SetDeadline(time.Now().Add(replicationTimeout)); err != nil {
+		return 0, time.Time{}, err
+	}
+	if _, err := conn.Write(data); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	ha.lock.Lock()
+	ha.replicated = time.Now()
+	ha.replicatedRouters = len(msg.Routers)
+	ha.lock.Unlock()
+	return len(msg.Routers), next, nil
+}
+
+// exportRouters returns the routers updated since the given time, oldest
+// first. If there are more routers than fit into a snapshot, the update time
+// of the last exported router is returned, in order to continue from there.
+func exportRouters(store storage.Storage, since time.Time) (routers []*storage.StoredRouter, next time.Time, err error) {
+	q := storage.NewRouterQuery(
+		func(r *storage.StoredRouter) bool {
+			return r.Address != nil && r.UpdatedAt.After(since)
+		},
+		func(a, b *storage.StoredRouter) int {
+			return a.UpdatedAt.Compare(b.UpdatedAt)
+		},
+		maxReplicatedRouters,
+	)
+	if err := store.QueryRouters(q); err != nil {
+		return nil, time.Time{}, fmt.Errorf("export routers: %w", err)
+	}
+	routers = q.Result()
+	if len(routers) >= maxReplicatedRouters {
+		// Routers with the same update time as the last one may not fit, so
+		// continue just before it and send some twice, unless all have the
+		// same update time.
+		next = routers[len(routers)-1].UpdatedAt
+		if routers[0].UpdatedAt.Before(next) {
+			next = next.Add(-time.Nanosecond)
+		}
+	}
+	return routers, next, nil
+}
+
+func (ha *HA) receiveStateWorker(w *mgr.WorkerCtx) error {
+	for {
+		conn, err := ha.ln.Accept()
+		if err != nil {
+			if w.IsDone() {
+				return nil
+			}
+			return fmt.Errorf("accept state connection: %w", err)
+		}
+
+		applied, err := ha.receiveSnapshot(conn)
+		if err != nil {
+			w.Warn("failed to receive replicated state", "src", conn.RemoteAddr(), "err", err)
+			continue
+		}
+		w.Debug("received replicated state", "routers", applied)
+	}
+}
+
+// receiveSnapshot receives a snapshot from the other router and applies it.
+// Returns the amount of updated routers.
+func (ha *HA) receiveSnapshot(conn net.Conn) (int, error) {
+	defer conn.Close() //nolint:errcheck
+
+	// Check source.
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || tcpAddr.AddrPort().Addr().Unmap() != ha.cfg.Peer.Addr().Unmap() {
+		return 0, errors.New("unexpected source")
+	}
+
+	// Read and verify snapshot.
+	if err := conn.SetDeadline(time.Now().Add(replicationTimeout)); err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, maxSnapshotSize+1))
+	switch {
+	case err != nil:
+		return 0, err
+	case len(data) > maxSnapshotSize:
+		return 0, errors.New("snapshot too big")
+	}
+
+	ha.lock.Lock()
+	msg, err := openMessage(ha.key, data, ha.peerSnapshotTime, time.Now())
+	switch {
+	case err != nil:
+		ha.lock.Unlock()
+		return 0, err
+	case msg.Type != msgTypeSnapshot:
+		ha.lock.Unlock()
+		return 0, fmt.Errorf("%w: unexpected type %q", ErrInvalidMessage, msg.Type)
+	case ha.role == RoleActive:
+		// Never overwrite the state of the active router.
+		ha.lock.Unlock()
+		return 0, errors.New("ignoring state, as this router is active")
+	}
+	ha.peerSnapshotTime = msg.Time
+	ha.lock.Unlock()
+
+	applied, err := applySnapshot(ha.instance.Storage(), msg.Routers)
+	if err == nil && len(msg.Tickets) > 0 {
+		err = ha.applyTickets(msg.Tickets)
+	}
+
+	ha.lock.Lock()
+	defer ha.lock.Unlock()
+	ha.replicated = time.Now()
+	ha.replicatedRouters = applied
+	return applied, err
+}
+
+// applyTickets decrypts and saves the replicated resumption tickets.
+func (ha *HA) applyTickets(sealed []byte) error {
+	tickets, err := openTickets(ha.encKey, sealed)
+	if err != nil {
+		return err
+	}
+	for _, ticket := range tickets {
+		if !ticket.Router.IsValid() || len(ticket.Secret) == 0 {
+			continue
+		}
+		if err := ha.instance.Storage().SaveResumptionTicket(&ticket); err != nil {
+			return fmt.Errorf("save resumption ticket: %w", err)
+		}
+	}
+	return nil
+}
+
+// applySnapshot saves the replicated routers and returns how many were saved.
+// The state of the standby router is only changed by replication, so the
+// replicated routers are always newer.
+func applySnapshot(store storage.Storage, routers []*storage.StoredRouter) (applied int, err error) {
+	for _, r := range routers {
+		if r == nil || r.Address == nil {
+			continue
+		}
+		if err := store.SaveRouter(r); err != nil {
+			return applied, fmt.Errorf("save router: %w", err)
+		}
+		applied++
+	}
+	return applied, nil
+}
@@ -0,0 +1,75 @@
+package ha
+
+// Role is the role of a router in the pair.
+type Role string
+
+// Roles.
+const (
+	RoleStandby Role = "standby"
+	RoleActive  Role = "active"
+)
+
+// roleState holds everything that is needed to decide the role of a router.
+type roleState struct {
+	Role     Role
+	Priority uint8
+	Term     uint64
+
+	// PeerAlive is set if a heartbeat of the other router was received
+	// recently. The other fields of the peer are only valid if it is alive.
+	PeerAlive    bool
+	PeerRole     Role
+	PeerPriority uint8
+	PeerTerm     uint64
+
+	// WitnessOK is set if the router holds the lease of the witnesses, or no
+	// witnesses are configured.
+	WitnessOK bool
+	// Starting is set while the router waits for heartbeats after start.
+	Starting bool
+}
+
+// nextRole decides the role of the router and returns the reason for a
+// change of the role.
+//
+// The router only becomes active if it holds the witness lease and the other
+// router is not active. If both are active, which can only happen without
+// witnesses, eg. after the link between them was restored, the one with the higher term, then the higher priority stays
+// active. An active router is never preempted by a router with a higher
+// priority, as this would interrupt traffic for no reason.
+func nextRole(s roleState) (role Role, reason string) {
+	switch s.Role {
+	case RoleActive:
+		switch {
+		case !s.WitnessOK:
+			return RoleStandby, "lost witness lease"
+		case s.PeerAlive && s.PeerRole == RoleActive && !wins(s):
+			return RoleStandby, "other router is also active and takes precedence"
+		}
+		return RoleActive, ""
+
+	default:
+		switch {
+		case !s.WitnessOK:
+			return RoleStandby, ""
+		case !s.PeerAlive && s.Starting:
+			return RoleStandby, ""
+		case !s.PeerAlive:
+			return RoleActive, "other router is not responding"
+		case s.PeerRole == RoleActive:
+			return RoleStandby, ""
+		case s.Priority > s.PeerPriority:
+			return RoleActive, "both routers are on standby and this one has a higher priority"
+		}
+		return RoleStandby, ""
+	}
+}
+
+// wins returns whether this router takes precedence over the other router,
+// when both are active.
+func wins(s roleState) bool {
+	if s.Term != s.PeerTerm {
+		return s.Term > s.PeerTerm
+	}
+	return s.Priority > s.PeerPriority
+}
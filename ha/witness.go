@@ -0,0 +1,347 @@
+package ha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// Witnesses arbitrate which router of a pair may be active.
+//
+// A router must hold a lease of a majority of the witnesses to become or stay
+// active. A witness only grants the lease of a pair to one router at a time,
+// until the lease expires or is released. Requests are signed with the shared
+// identity, so that only the routers of the pair can acquire its lease.
+//
+// The router considers the lease to expire leaseTTL after it sent the
+// request, which is always before the witness does. This way, the other
+// router can only acquire the lease after the router stopped being active.
+
+const (
+	// leaseTTL defines how long a lease granted by a witness is valid.
+	leaseTTL = 2 * deadInterval
+	// maxWitnessMsgSize limits the size of witness requests and responses.
+	maxWitnessMsgSize = 1024
+	// maxWitnessPairs limits the amount of pairs a witness tracks.
+	maxWitnessPairs = 10_000
+)
+
+const witnessSigContext = "mycoria ha witness lease"
+
+// witnessRequest requests, renews or releases the lease of a pair.
+type witnessRequest struct {
+	// Address is the shared identity of the pair.
+	Address m.PublicAddress `cbor:"a,omitempty"`
+	// Node identifies the router of the pair.
+	Node uint64 `cbor:"n,omitempty"`
+	// Time is the time the request was sent in unix nanoseconds.
+	// It must increase with every request of the router, which prevents
+	// replays.
+	Time int64 `cbor:"c,omitempty"`
+	// Release releases the lease, if held by the node.
+	Release bool `cbor:"r,omitempty"`
+
+	Signature []byte `cbor:"s,omitempty"`
+}
+
+// witnessResponse is the answer of the witness.
+type witnessResponse struct {
+	Granted bool   `cbor:"g,omitempty"`
+	Err     string `cbor:"e,omitempty"`
+}
+
+// signedData returns the data that is signed.
+func (req *witnessRequest) signedData() ([]byte, error) {
+	unsigned := *req
+	unsigned.Signature = nil
+	return cbor.Marshal(&unsigned)
+}
+
+// sign signs the request with the shared identity.
+func (req *witnessRequest) sign(identity *m.Address) error {
+	data, err := req.signedData()
+	if err != nil {
+		return err
+	}
+	req.Signature, err = identity.SignWithContext(data, []byte(witnessSigContext))
+	return err
+}
+
+// verify verifies that the request was signed by the owner of the address.
+func (req *witnessRequest) verify() error {
+	if err := req.Address.VerifyAddress(); err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	data, err := req.signedData()
+	if err != nil {
+		return err
+	}
+	if err := req.Address.VerifySigWithContext(data, req.Signature, []byte(witnessSigContext)); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return nil
+}
+
+// witnessLease is the lease of a pair held by the witness.
+type witnessLease struct {
+	node    uint64
+	expires time.Time
+}
+
+// witnessNode identifies a router of a pair.
+type witnessNode struct {
+	pair netip.Addr
+	node uint64
+}
+
+// Witness grants leases for the active role to routers of high availability
+// pairs. It keeps all state in memory, as leases are short lived.
+type Witness struct {
+	lock   sync.Mutex
+	leases map[netip.Addr]*witnessLease
+	// lastTimes holds the time of the last request of every router, as the
+	// clocks of the routers of a pair may differ.
+	lastTimes map[witnessNode]int64
+}
+
+// NewWitness returns a new witness.
+func NewWitness() *Witness {
+	return &Witness{
+		leases:    make(map[netip.Addr]*witnessLease),
+		lastTimes: make(map[witnessNode]int64),
+	}
+}
+
+// Serve answers lease requests on the given listener until the context is
+// canceled.
+func (wt *Witness) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+		go wt.serveConn(conn)
+	}
+}
+
+func (wt *Witness) serveConn(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	if err := conn.SetDeadline(time.Now().Add(witnessTimeout)); err != nil {
+		return
+	}
+	req := &witnessRequest{}
+	if err := cbor.NewDecoder(io.LimitReader(conn, maxWitnessMsgSize)).Decode(req); err != nil {
+		return
+	}
+	resp := wt.handle(req, time.Now())
+	_ = cbor.NewEncoder(conn).Encode(resp)
+}
+
+// handle handles a lease request and returns the response.
+func (wt *Witness) handle(req *witnessRequest, now time.Time) *witnessResponse {
+	if err := req.verify(); err != nil {
+		return &witnessResponse{Err: err.Error()}
+	}
+	if sent := time.Unix(0, req.Time); now.Sub(sent).Abs() > maxMessageAge {
+		return &witnessResponse{Err: "request is stale or clocks are too far apart"}
+	}
+
+	wt.lock.Lock()
+	defer wt.lock.Unlock()
+
+	// Check for replays.
+	id := witnessNode{pair: req.Address.IP, node: req.Node}
+	lastTime, seen := wt.lastTimes[id]
+	switch {
+	case seen && req.Time <= lastTime:
+		return &witnessResponse{Err: "request is stale or replayed"}
+	case !seen && len(wt.lastTimes) >= 2*maxWitnessPairs:
+		wt.pruneLocked(now)
+		if len(wt.lastTimes) >= 2*maxWitnessPairs {
+			return &witnessResponse{Err: "too many pairs"}
+		}
+	}
+	wt.lastTimes[id] = req.Time
+
+	lease, ok := wt.leases[req.Address.IP]
+	if !ok {
+		lease = &witnessLease{}
+		wt.leases[req.Address.IP] = lease
+	}
+
+	// Release lease.
+	if req.Release {
+		if lease.node == req.Node {
+			lease.expires = time.Time{}
+		}
+		return &witnessResponse{}
+	}
+
+	// Grant lease, if it is free or already held by the node.
+	if lease.node != req.Node && now.Before(lease.expires) {
+		return &witnessResponse{}
+	}
+	lease.node = req.Node
+	lease.expires = now.Add(leaseTTL)
+	return &witnessResponse{Granted: true}
+}
+
+// pruneLocked removes routers that were not seen for a while and pairs
+// without a valid lease. Must be called with the lock held.
+func (wt *Witness) pruneLocked(now time.Time) {
+	for id, lastTime := range wt.lastTimes {
+		// Older requests are rejected anyway.
+		if now.Sub(time.Unix(0, lastTime)) > maxMessageAge {
+			delete(wt.lastTimes, id)
+		}
+	}
+	for ip, lease := range wt.leases {
+		if now.After(lease.expires) {
+			delete(wt.leases, ip)
+		}
+	}
+}
+
+// requestLease requests, renews or releases the lease at all witnesses and
+// returns until when the lease is held. The lease is only held if a majority
+// of the witnesses granted it.
+func (ha *HA) requestLease(ctx context.Context, release bool) (expires time.Time, err error) {
+	sent := time.Now()
+	ha.lock.Lock()
+	req := &witnessRequest{
+		Address: ha.instance.Identity().PublicAddress,
+		Node:    ha.node,
+		Time:    ha.nextMsgTime(),
+		Release: release,
+	}
+	ha.lock.Unlock()
+	if err := req.sign(ha.instance.Identity()); err != nil {
+		return time.Time{}, fmt.Errorf("sign lease request: %w", err)
+	}
+
+	// Ask all witnesses in parallel.
+	var (
+		wg      sync.WaitGroup
+		granted int
+		errs    []error
+		lock    sync.Mutex
+	)
+	for _, witness := range ha.cfg.Witnesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := askWitness(ctx, witness, req)
+
+			lock.Lock()
+			defer lock.Unlock()
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("%s: %w", witness, err))
+			case resp.Err != "":
+				errs = append(errs, fmt.Errorf("%s: %s", witness, resp.Err))
+			case resp.Granted:
+				granted++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if release || granted <= len(ha.cfg.Witnesses)/2 {
+		return time.Time{}, errors.Join(errs...)
+	}
+	return sent.Add(leaseTTL), nil
+}
+
+// askWitness sends the lease request to the witness and returns its response.
+func askWitness(ctx context.Context, witness string, req *witnessRequest) (*witnessResponse, error) {
+	dialer := &net.Dialer{Timeout: witnessTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", witness)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	if err := conn.SetDeadline(time.Now().Add(witnessTimeout)); err != nil {
+		return nil, err
+	}
+	if err := cbor.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	resp := &witnessResponse{}
+	if err := cbor.NewDecoder(io.LimitReader(conn, maxWitnessMsgSize)).Decode(resp); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return resp, nil
+}
+
+func (ha *HA) witnessWorker(w *mgr.WorkerCtx) error {
+	if len(ha.cfg.Witnesses) == 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(witnessInterval)
+	defer ticker.Stop()
+
+	for {
+		// Only acquire the lease if the router is or wants to become active,
+		// so that the other router can acquire it otherwise.
+		if ha.wantsLease(time.Now()) {
+			expires, err := ha.requestLease(w.Ctx(), false)
+
+			ha.lock.Lock()
+			held := time.Now().Before(ha.leaseExpires)
+			switch {
+			case err == nil && !expires.IsZero():
+				if !held && ha.role == RoleActive {
+					w.Info("witness lease renewed again")
+				}
+				ha.leaseExpires = expires
+			case held && ha.role == RoleActive:
+				w.Warn("failed to renew witness lease", "witnesses", ha.cfg.Witnesses, "err", err)
+			default:
+				w.Debug("witness lease not granted", "err", err)
+			}
+			ha.lock.Unlock()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+// releaseLease releases the lease at the witnesses, so that the other router
+// can take over immediately.
+func (ha *HA) releaseLease(ctx context.Context) error {
+	ha.lock.Lock()
+	held := time.Now().Before(ha.leaseExpires)
+	ha.leaseExpires = time.Time{}
+	ha.lock.Unlock()
+
+	if !held {
+		return nil
+	}
+	_, err := ha.requestLease(ctx, true)
+	return err
+}
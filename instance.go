@@ -1,26 +1,41 @@
 package mycoria
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/mycoria/mycoria/api/control"
 	"github.com/mycoria/mycoria/api/dns"
 	"github.com/mycoria/mycoria/api/httpapi"
 	"github.com/mycoria/mycoria/api/netstack"
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/dashboard"
+	"github.com/mycoria/mycoria/discovery"
 	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/ha"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/notify"
 	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/perf"
 	"github.com/mycoria/mycoria/router"
 	"github.com/mycoria/mycoria/state"
 	"github.com/mycoria/mycoria/storage"
+	"github.com/mycoria/mycoria/streams"
 	"github.com/mycoria/mycoria/switchr"
 	"github.com/mycoria/mycoria/tun"
+	"github.com/mycoria/mycoria/updater"
 )
 
 // Instance is an instance of a mycoria router.
@@ -33,24 +48,84 @@ type Instance struct {
 	frameBuilder *frame.Builder
 
 	storage   storage.Storage
+	mappings  *dns.MappingCache
 	state     *state.State
 	tunDevice *tun.Device
 	netstack  *netstack.NetStack
 	api       *httpapi.API
 	dns       *dns.Server
+	ha        *ha.HA
 
-	peering *peering.Peering
-	switchr *switchr.Switch
-	router  *router.Router
+	peering   *peering.Peering
+	switchr   *switchr.Switch
+	router    *router.Router
+	discovery *discovery.Discovery
+
+	updater  *updater.Updater
+	notifier *notify.Notifier
+
+	watchdog     *mgr.Watchdog
+	lastRecovery time.Time
+}
+
+// listenAPIListeners exposes the API and the DNS server on the additional
+// configured addresses.
+func (i *Instance) listenAPIListeners() error {
+	for _, apiLn := range i.config.APIListeners {
+		switch apiLn.Service {
+		case config.APIServiceHTTP:
+			ln, err := net.Listen("tcp", apiLn.Addr.String())
+			if err != nil {
+				return fmt.Errorf("listen on %s for API: %w", apiLn.Addr, err)
+			}
+			i.api.AddListener(ln, apiLn.Scope)
+			slog.Info("exposing api", "addr", apiLn.Addr, "scope", apiLn.Scope)
+
+		case config.APIServiceDNS:
+			if i.dns == nil {
+				return fmt.Errorf("cannot listen on %s for DNS: DNS server requires the tun device", apiLn.Addr)
+			}
+			conn, err := net.ListenPacket("udp", apiLn.Addr.String())
+			if err != nil {
+				return fmt.Errorf("listen on %s for DNS: %w", apiLn.Addr, err)
+			}
+			i.dns.AddListener(conn)
+			slog.Info("exposing dns server", "addr", apiLn.Addr)
+		}
+	}
+	return nil
 }
 
+// minRecoveryInterval defines the minimum interval between data plane restarts
+// triggered by the watchdog, so that a persistent problem does not cause a
+// restart loop.
+const minRecoveryInterval = 10 * time.Minute
+
 // New returns a new mycoria router instance.
 func New(version string, c *config.Config) (*Instance, error) {
-	identity, err := m.AddressFromStorage(c.Router.Address)
-	if err != nil {
-		return nil, fmt.Errorf("load identity: %w", err)
+	var (
+		identity *m.Address
+		err      error
+	)
+	if c.Router.Invisible {
+		// Use a new privacy address, so that the router cannot be recognized.
+		identity, _, err = m.GeneratePrivacyAddress(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("generate privacy address: %w", err)
+		}
+	} else {
+		identity, err = m.AddressFromStorage(c.Router.Address)
+		if err != nil {
+			return nil, fmt.Errorf("load identity: %w", err)
+		}
 	}
 
+	// Adapt runtime to available resources.
+	applyResourceLimits(c)
+
+	// Load updated country geo markers before anything uses them.
+	loadMarkerTable(c)
+
 	// Create instance to pass it to modules.
 	instance := &Instance{
 		version:  version,
@@ -72,10 +147,14 @@ func New(version string, c *config.Config) (*Instance, error) {
 		if err != nil {
 			return nil, fmt.Errorf("load state: %w", err)
 		}
+
+		// Write crash reports next to the state file.
+		mgr.SetCrashReportDir(filepath.Join(filepath.Dir(c.System.StatePath), "crashes"))
 	default:
 		return nil, errors.New("unknown state file type")
 	}
 	instance.state = state.New(instance, instance.storage)
+	instance.mappings = dns.NewMappingCache(instance.storage, c.DNSCache.TTL, c.DNSCache.Size)
 
 	// Listen for API, if custom.
 	var apiListener net.Listener
@@ -116,15 +195,21 @@ func New(version string, c *config.Config) (*Instance, error) {
 		if err != nil {
 			return nil, fmt.Errorf("listen on API netstack: %w", err)
 		}
-		instance.dns, err = dns.New(instance, packetConn, instance.storage)
+		instance.dns, err = dns.New(instance, packetConn, instance.mappings)
 		if err != nil {
 			return nil, fmt.Errorf("create local http API: %w", err)
 		}
 	}
 
 	// Create API server and dashboard, if there is a listener.
-	var dash *dashboard.Dashboard
-	if apiListener != nil {
+	var (
+		dash *dashboard.Dashboard
+		ctrl *control.Control
+	)
+	hasHTTPListeners := slices.ContainsFunc(c.APIListeners, func(ln config.APIListener) bool {
+		return ln.Service == config.APIServiceHTTP
+	})
+	if apiListener != nil || hasHTTPListeners {
 		slog.Info("creating api and dashboard")
 
 		// Create API server.
@@ -137,6 +222,24 @@ func New(version string, c *config.Config) (*Instance, error) {
 		if err != nil {
 			return nil, fmt.Errorf("create dashboard: %w", err)
 		}
+		// Create control API.
+		ctrl, err = control.New(instance)
+		if err != nil {
+			return nil, fmt.Errorf("create control API: %w", err)
+		}
+	}
+
+	// Listen on additional API addresses.
+	if err := instance.listenAPIListeners(); err != nil {
+		return nil, err
+	}
+
+	// Create high availability manager.
+	if c.HA != nil {
+		instance.ha, err = ha.New(instance, instance.setHAActive)
+		if err != nil {
+			return nil, fmt.Errorf("create high availability manager: %w", err)
+		}
 	}
 
 	// Create router.
@@ -145,14 +248,62 @@ func New(version string, c *config.Config) (*Instance, error) {
 		return nil, fmt.Errorf("create router: %w", err)
 	}
 
+	// Create route discovery.
+	instance.discovery, err = discovery.New(instance, instance.router)
+	if err != nil {
+		return nil, fmt.Errorf("create route discovery: %w", err)
+	}
+	instance.router.SetRouteMissHandler(instance.discovery.Trigger)
+
+	// Resolve unknown names over the mesh.
+	if instance.dns != nil {
+		instance.dns.SetMeshResolver(func(ctx context.Context, domain string) (router, answerer netip.Addr, err error) {
+			answer, err := instance.router.LookupName(ctx, domain)
+			if err != nil {
+				return netip.Addr{}, netip.Addr{}, err
+			}
+			return answer.Router, answer.Answerer.IP, nil
+		})
+	}
+
 	// Create switch.
-	instance.switchr = switchr.New(instance, instance.router.Input())
+	instance.switchr = switchr.New(instance, instance.router.Input(), instance.router.PriorityInput())
 
 	// Create peering.
-	instance.peering = peering.New(instance, instance.switchr.Input())
+	instance.peering = peering.New(instance, instance.switchr.Input(), instance.switchr.PriorityInput())
+
+	// Restore connectivity when the tun device was recovered.
+	if instance.tunDevice != nil {
+		instance.tunDevice.SetRecoveryHandler(func() {
+			instance.peering.TriggerPeering()
+			instance.router.TriggerAnnounce()
+		})
+	}
 
 	// Add protocols.
-	instance.peering.AddProtocol("tcp", peering.ProtocolTCP)
+	if err := instance.peering.AddProtocol("tcp", peering.ProtocolTCP); err != nil {
+		return nil, fmt.Errorf("add protocol: %w", err)
+	}
+	if err := instance.peering.AddProtocol("unix", peering.ProtocolUnix); err != nil {
+		return nil, fmt.Errorf("add protocol: %w", err)
+	}
+
+	// Create throughput test responder.
+	var perfResponder *perf.Responder
+	if c.PerfPort != 0 && instance.tunDevice != nil {
+		perfResponder = perf.New(instance)
+	}
+
+	// Create updater.
+	instance.updater = updater.New(instance)
+
+	// Create notifier.
+	if c.Notifications != nil {
+		instance.notifier = notify.New(instance)
+	}
+
+	// Create watchdog.
+	instance.watchdog = mgr.NewWatchdog(mgr.DefaultWatchdogTimeout, instance.recoverFromIncident)
 
 	// Add all modules to instance group.
 	instance.Group = mgr.NewGroup(
@@ -163,17 +314,146 @@ func New(version string, c *config.Config) (*Instance, error) {
 		instance.netstack,
 		instance.api,
 		instance.dns,
+		instance.ha,
 
 		instance.peering,
 		instance.switchr,
 		instance.router,
+		instance.discovery,
 
 		dash,
+		ctrl,
+		perfResponder,
+		instance.updater,
+		instance.notifier,
+
+		instance.watchdog,
 	)
+	instance.watchdog.Watch(instance.Group)
+
+	// With high availability, the data plane is started by the high
+	// availability manager when the router becomes active.
+	if instance.ha != nil {
+		if err := instance.Group.SkipModules(instance.peering, instance.switchr, instance.router, instance.discovery); err != nil {
+			return nil, fmt.Errorf("defer data plane start: %w", err)
+		}
+	}
 
 	return instance, nil
 }
 
+// setHAActive starts or stops the data plane and the router address, when the
+// router becomes the active or standby router of the high availability pair.
+func (i *Instance) setHAActive(active bool) error {
+	if active {
+		if i.tunDevice != nil {
+			if err := i.tunDevice.SetPrimaryAddress(true); err != nil {
+				return fmt.Errorf("add router address: %w", err)
+			}
+		}
+		if err := i.Group.StartModules(i.peering, i.switchr, i.router, i.discovery); err != nil {
+			return fmt.Errorf("start data plane: %w", err)
+		}
+		return nil
+	}
+
+	if err := i.Group.StopModules(i.peering, i.switchr, i.router, i.discovery); err != nil {
+		return fmt.Errorf("stop data plane: %w", err)
+	}
+	if i.tunDevice != nil {
+		if err := i.tunDevice.SetPrimaryAddress(false); err != nil {
+			return fmt.Errorf("remove router address: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyResourceLimits logs the detected resource limits and adapts the go
+// runtime to them, unless configured via the environment.
+func applyResourceLimits(c *config.Config) {
+	slog.Info(
+		"detected resources",
+		"memory", c.Resources.MemoryLimit,
+		"cpus", c.Resources.CPULimit,
+		"fds", c.Resources.FDLimit,
+		"queueSize", c.Limits.QueueSize,
+		"maxRoutes", c.Limits.MaxRoutes,
+		"maxPeers", c.Limits.MaxPeers,
+		"maxConnections", c.Limits.MaxConnections,
+	)
+
+	// Set soft memory limit, so that the GC works harder before the OOM killer
+	// steps in. Leave some room for non-heap memory.
+	if c.Resources.MemoryLimit > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(int64(c.Resources.MemoryLimit / 10 * 9))
+	}
+
+	// Only use as many threads as CPUs are available.
+	if c.Resources.CPULimit > 0 && os.Getenv("GOMAXPROCS") == "" {
+		runtime.GOMAXPROCS(c.Resources.MaxProcs())
+	}
+}
+
+// loadMarkerTable loads the signed country geo marker table from the state
+// directory, if available. A missing or invalid table only leaves the compiled
+// in table active, as the address plan is not needed to start the router.
+func loadMarkerTable(c *config.Config) {
+	path := c.MarkerTablePath()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return
+	case err != nil:
+		slog.Warn("failed to read marker table", "path", path, "err", err)
+		return
+	case len(c.MarkerTableSigners) == 0:
+		slog.Warn("ignoring marker table, as no signers are configured in router.markerTableSigners", "path", path)
+		return
+	}
+
+	table, err := m.ParseSignedMarkerTable(data, c.MarkerTableSigners)
+	if err != nil {
+		slog.Warn("failed to load marker table", "path", path, "err", err)
+		return
+	}
+	if err := m.SetMarkerTable(table); err != nil {
+		slog.Info("ignoring marker table", "path", path, "err", err)
+		return
+	}
+	slog.Info(
+		"loaded marker table",
+		"version", table.Version,
+		"signer", table.Signer,
+		"countries", len(table.Countries),
+	)
+}
+
+// recoverFromIncident restarts the data plane, if a worker of the data plane is
+// stuck and recovery is enabled.
+// It is only called by the watchdog worker.
+func (i *Instance) recoverFromIncident(incident *mgr.Incident) string {
+	switch {
+	case !i.config.System.WatchdogRecovery:
+		return ""
+	case incident.Module != i.peering &&
+		incident.Module != i.switchr &&
+		incident.Module != i.router:
+		// Only the data plane can be restarted safely.
+		return ""
+	case time.Since(i.lastRecovery) < minRecoveryInterval:
+		return ""
+	}
+	i.lastRecovery = time.Now()
+
+	if err := i.Group.RestartModules(i.peering, i.switchr, i.router, i.discovery); err != nil {
+		return "failed to restart data plane: " + err.Error()
+	}
+	return "restarted data plane"
+}
+
 // Version returns the version.
 func (i *Instance) Version() string {
 	return i.version
@@ -201,6 +481,12 @@ func (i *Instance) Storage() storage.Storage {
 	return i.storage
 }
 
+// Mappings returns the cached domain mapping storage.
+// All access to domain mappings should go through it.
+func (i *Instance) Mappings() *dns.MappingCache {
+	return i.mappings
+}
+
 // State returns the state manager.
 func (i *Instance) State() *state.State {
 	return i.state
@@ -226,6 +512,12 @@ func (i *Instance) DNS() *dns.Server {
 	return i.dns
 }
 
+// HA returns the high availability manager.
+// Returns nil if high availability is not configured.
+func (i *Instance) HA() *ha.HA {
+	return i.ha
+}
+
 /////
 
 // Peering returns the peering manager.
@@ -243,6 +535,27 @@ func (i *Instance) Router() *router.Router {
 	return i.router
 }
 
+// Discovery returns the route discovery.
+func (i *Instance) Discovery() *discovery.Discovery {
+	return i.discovery
+}
+
+// Streams returns the stream multiplexer, which opens and accepts streams
+// to and from other routers.
+func (i *Instance) Streams() *streams.Mux {
+	return i.router.Streams
+}
+
+// Updater returns the software updater.
+func (i *Instance) Updater() *updater.Updater {
+	return i.updater
+}
+
+// Watchdog returns the watchdog.
+func (i *Instance) Watchdog() *mgr.Watchdog {
+	return i.watchdog
+}
+
 // RoutingTable returns the routing table.
 func (i *Instance) RoutingTable() *m.RoutingTable {
 	return i.router.Table()
@@ -0,0 +1,109 @@
+// Package listeners discovers listening sockets on the host and proposes them
+// as services, so that existing servers can be exposed to friends easily.
+package listeners
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+// ErrNotSupported is returned on platforms that do not support discovery.
+var ErrNotSupported = errors.New("listening socket discovery is not supported on this platform")
+
+// Listener is a listening socket on the host.
+type Listener struct {
+	Protocol uint8
+	IP       netip.Addr
+	Port     uint16
+	UID      uint32
+}
+
+// Discover returns the listening sockets of the host.
+func Discover() ([]Listener, error) {
+	listeners, err := discover()
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return nil, fmt.Errorf("%w (allow netlink sock_diag in the AppArmor or SELinux profile, see \"mycoria debug confinement\")", err)
+	case err != nil:
+		return nil, err
+	}
+
+	// Sort and remove duplicates.
+	slices.SortFunc(listeners, func(a, b Listener) int {
+		if diff := int(a.Port) - int(b.Port); diff != 0 {
+			return diff
+		}
+		if diff := int(a.Protocol) - int(b.Protocol); diff != 0 {
+			return diff
+		}
+		return a.IP.Compare(b.IP)
+	})
+	return slices.Compact(listeners), nil
+}
+
+// Proposal is a proposed service for a listening socket.
+type Proposal struct {
+	Listener Listener
+	Service  config.ServiceConfig
+}
+
+// wellKnownPorts holds names and URL schemes of common services.
+var wellKnownPorts = map[uint16]struct {
+	name   string
+	scheme string
+}{
+	22:   {"ssh", "tcp"},
+	80:   {"web", "http"},
+	443:  {"web-secure", "https"},
+	3000: {"web-app", "http"},
+	5432: {"postgres", "tcp"},
+	6379: {"redis", "tcp"},
+	8000: {"web-app", "http"},
+	8080: {"web-app", "http"},
+	8443: {"web-app-secure", "https"},
+}
+
+// Propose returns service proposals for listeners that are reachable through
+// Mycoria, ie. listen on all IPv6 addresses or on the router IP. Listeners
+// that are already covered by a service or are used by the router itself are
+// skipped. Proposed services are only accessible by friends.
+func Propose(listeners []Listener, routerIP netip.Addr, cfg *config.Config, ownPorts []uint16) []Proposal {
+	proposals := make([]Proposal, 0, len(listeners))
+	for _, l := range listeners {
+		switch {
+		case l.IP != netip.IPv6Unspecified() && l.IP != routerIP:
+			// Not reachable via Mycoria.
+			continue
+		case slices.Contains(ownPorts, l.Port):
+			continue
+		}
+		if _, ok := cfg.GetServiceByPolicy(l.Protocol, l.Port); ok {
+			continue
+		}
+
+		// Derive name and URL.
+		port := strconv.FormatUint(uint64(l.Port), 10)
+		name, scheme := "port-"+port, "tcp"
+		if l.Protocol == 17 {
+			name, scheme = "udp-port-"+port, "udp"
+		}
+		if known, ok := wellKnownPorts[l.Port]; ok && l.Protocol == 6 {
+			name, scheme = known.name, known.scheme
+		}
+		proposals = append(proposals, Proposal{
+			Listener: l,
+			Service: config.ServiceConfig{
+				Name:    name,
+				URL:     scheme + "://[" + routerIP.String() + "]:" + port,
+				Friends: true,
+			},
+		})
+	}
+	return proposals
+}
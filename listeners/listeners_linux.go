@@ -0,0 +1,38 @@
+package listeners
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// tcpListen is the TCP_LISTEN socket state.
+const tcpListen = 10
+
+func discover() ([]Listener, error) {
+	var listeners []Listener
+	for _, family := range []uint8{unix.AF_INET6, unix.AF_INET} {
+		sockets, err := netlink.SocketDiagTCP(family)
+		if err != nil {
+			return nil, fmt.Errorf("query sockets via inet_diag: %w", err)
+		}
+		for _, socket := range sockets {
+			if socket.State != tcpListen {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(socket.ID.Source)
+			if !ok {
+				continue
+			}
+			listeners = append(listeners, Listener{
+				Protocol: 6,
+				IP:       ip.Unmap(),
+				Port:     socket.ID.SourcePort,
+				UID:      socket.UID,
+			})
+		}
+	}
+	return listeners, nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package listeners
+
+func discover() ([]Listener, error) {
+	return nil, ErrNotSupported
+}
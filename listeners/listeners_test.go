@@ -0,0 +1,59 @@
+package listeners
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+func TestPropose(t *testing.T) {
+	t.Parallel()
+
+	routerIP := netip.MustParseAddr("fd12:3456::1")
+	cfg := &config.Config{}
+	discovered := []Listener{
+		{Protocol: 6, IP: netip.IPv6Unspecified(), Port: 22},
+		{Protocol: 6, IP: routerIP, Port: 4000},
+		{Protocol: 6, IP: netip.IPv6Loopback(), Port: 5432},                // Local only.
+		{Protocol: 6, IP: netip.IPv4Unspecified(), Port: 80},               // IPv4 only.
+		{Protocol: 6, IP: netip.IPv6Unspecified(), Port: 47369},            // Peering.
+		{Protocol: 6, IP: netip.MustParseAddr("fd12:3456::2"), Port: 8080}, // Other IP.
+	}
+
+	proposals := Propose(discovered, routerIP, cfg, []uint16{47369})
+	require.Len(t, proposals, 2)
+	assert.Equal(t, "ssh", proposals[0].Service.Name)
+	assert.Equal(t, "tcp://[fd12:3456::1]:22", proposals[0].Service.URL)
+	assert.Equal(t, "port-4000", proposals[1].Service.Name)
+	for _, proposal := range proposals {
+		assert.True(t, proposal.Service.Friends)
+		assert.False(t, proposal.Service.Public, "must never be public")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp6", "[::]:0")
+	if err != nil {
+		t.Skipf("cannot listen on IPv6: %s", err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	port := uint16(ln.Addr().(*net.TCPAddr).Port) //nolint:forcetypeassert
+
+	discovered, err := Discover()
+	if err != nil {
+		t.Skipf("discovery not available: %s", err)
+	}
+	assert.True(t, slices.ContainsFunc(discovered, func(l Listener) bool {
+		return l.Protocol == 6 && l.IP == netip.IPv6Unspecified() && l.Port == port
+	}), "listener must be discovered")
+}
@@ -0,0 +1,132 @@
+package m
+
+import (
+	"context"
+	"math"
+	"net/netip"
+	"runtime"
+	"time"
+)
+
+// AddressInfo describes the parts of an address.
+type AddressInfo struct {
+	IP   netip.Addr
+	Type AddressType
+
+	// RoutingPrefix is the prefix the address is routed by.
+	// It is invalid for addresses that are not routable.
+	RoutingPrefix netip.Prefix
+
+	// Continent and Region are decoded from geo marked addresses.
+	Continent         string
+	Region            string
+	RegionDescription string
+
+	// Country and CountryPrefix are set if the address matches a country
+	// geo marker of the active marker table.
+	Country       string
+	CountryPrefix netip.Prefix
+
+	// SwitchLabel is the switch label that the router with this address uses
+	// for its peers. It is zero if none can be derived.
+	SwitchLabel SwitchLabel
+}
+
+// InspectAddress decodes the parts of the given address.
+func InspectAddress(ip netip.Addr) *AddressInfo {
+	info := &AddressInfo{
+		IP:   ip,
+		Type: GetAddressType(ip),
+	}
+
+	// Decode geo marker.
+	if info.Type == TypeGeoMarked {
+		marker := ip.As16()[1]
+		for code, continentMarker := range continentCodeToMarker {
+			if marker&ContinentMask == continentMarker {
+				info.Continent = code
+			}
+		}
+		for code, regionMarker := range regionCodeToMarker {
+			if marker&0x0F == regionMarker {
+				info.Region = code
+				info.RegionDescription = regionCodeToDescription[code]
+			}
+		}
+		if cml, err := LookupCountryMarker(ip); err == nil {
+			info.Country = cml.Country
+			info.CountryPrefix = cml.Prefix
+		}
+	}
+
+	// Get routing prefix.
+	switch {
+	case info.CountryPrefix.IsValid():
+		info.RoutingPrefix = info.CountryPrefix
+	case info.Type.RoutingPrefixLength() > 0:
+		info.RoutingPrefix, _ = ip.Prefix(info.Type.RoutingPrefixLength())
+	}
+
+	if label, ok := DeriveSwitchLabelFromIP(ip); ok {
+		info.SwitchLabel = label
+	}
+
+	return info
+}
+
+// AddressGenerationEstimate estimates how long it takes to generate an
+// address within a prefix on this machine.
+type AddressGenerationEstimate struct {
+	Prefix netip.Prefix
+
+	// ExpectedTries is the average amount of keys that need to be generated.
+	ExpectedTries float64
+	// Workers is the amount of CPU cores used for generating.
+	Workers int
+	// TriesPerSecond is the measured rate of all workers.
+	TriesPerSecond float64
+
+	// Expected is the average duration.
+	Expected time.Duration
+	// Likely is the duration after which 90% of generations are done.
+	Likely time.Duration
+}
+
+// EstimateAddressGeneration measures the key generation rate for the given
+// duration and estimates how long it takes to generate an address within the
+// given prefix.
+func EstimateAddressGeneration(ctx context.Context, prefix netip.Prefix, measure time.Duration) (*AddressGenerationEstimate, error) {
+	// Measure rate of a single core.
+	var tries int
+	start := time.Now()
+	for time.Since(start) < measure || tries == 0 {
+		if _, err := tryToGenerateAddress(nil); err != nil {
+			return nil, err
+		}
+		tries++
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	rate := float64(tries) / time.Since(start).Seconds()
+
+	// Addresses are digests, so every try has the same chance to match.
+	est := &AddressGenerationEstimate{
+		Prefix:        prefix,
+		ExpectedTries: math.Pow(2, float64(prefix.Bits())),
+		Workers:       1,
+	}
+
+	// Use the same amount of workers as the address generation.
+	maxTries := int(est.ExpectedTries) / 2 * 100
+	if prefix != PrivacyAddressPrefix && maxTries >= 10000 && runtime.NumCPU() >= 2 {
+		est.Workers = runtime.NumCPU()
+	}
+	est.TriesPerSecond = rate * float64(est.Workers)
+
+	// Calculate durations.
+	est.Expected = time.Duration(est.ExpectedTries / est.TriesPerSecond * float64(time.Second))
+	est.Likely = time.Duration(math.Log(10) * est.ExpectedTries / est.TriesPerSecond * float64(time.Second))
+
+	return est, nil
+}
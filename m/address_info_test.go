@@ -0,0 +1,52 @@
+package m
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectAddress(t *testing.T) {
+	t.Parallel()
+
+	// Geo marked address of a country.
+	info := InspectAddress(netip.MustParseAddr("fd1f:0:1234::5"))
+	assert.Equal(t, TypeGeoMarked, info.Type)
+	assert.Equal(t, "EU", info.Continent)
+	assert.Equal(t, "CS", info.Region)
+	assert.Equal(t, "AT", info.Country)
+	assert.Equal(t, prefixTestData["AT"], info.CountryPrefix)
+	assert.Equal(t, info.CountryPrefix, info.RoutingPrefix)
+	assert.Equal(t, SwitchLabel(5), info.SwitchLabel)
+
+	// Privacy address.
+	info = InspectAddress(netip.MustParseAddr("fd80::1234"))
+	assert.Equal(t, TypePrivacy, info.Type)
+	assert.Empty(t, info.Continent)
+	assert.False(t, info.RoutingPrefix.IsValid())
+	assert.Equal(t, SwitchLabel(0x1234), info.SwitchLabel)
+
+	// Special address.
+	info = InspectAddress(netip.MustParseAddr("fd01:abcd::80"))
+	assert.Equal(t, TypeOrganization, info.Type)
+	assert.Equal(t, netip.MustParsePrefix("fd01:abcd::/32"), info.RoutingPrefix)
+	assert.Zero(t, info.SwitchLabel)
+
+	// Invalid address.
+	info = InspectAddress(netip.MustParseAddr("192.0.2.1"))
+	assert.Equal(t, TypeInvalid, info.Type)
+}
+
+func TestEstimateAddressGeneration(t *testing.T) {
+	t.Parallel()
+
+	est, err := EstimateAddressGeneration(context.Background(), prefixTestData["AT"], 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.InDelta(t, 1<<18, est.ExpectedTries, 0)
+	assert.Positive(t, est.TriesPerSecond)
+	assert.Greater(t, est.Likely, est.Expected)
+}
@@ -0,0 +1,114 @@
+package m
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// Capabilities is a bitmap of optional protocol features a router supports.
+// It is exchanged during peering and announced in the router info, so that
+// new features can be rolled out incrementally: Code checks the capabilities
+// of the remote router instead of parsing its version.
+//
+// Every new feature that changes the protocol gets a new bit, eg. a new frame
+// version or key exchange. Bits must never be reused or reassigned. Unknown
+// bits of newer routers are kept, but ignored.
+type Capabilities uint64
+
+// Capabilities.
+const (
+	// CapFEC signals that the router can receive forward error correction.
+	CapFEC Capabilities = 1 << iota
+	// CapObservedAddr signals that the router reports the observed underlay
+	// address during peering.
+	CapObservedAddr
+	// CapReachability signals that the router announces reachability hints.
+	CapReachability
+	// CapGroups signals that the router handles group messages.
+	CapGroups
+	// CapTransfers signals that the router handles file transfers.
+	CapTransfers
+	// CapStreams signals that the router handles streams.
+	CapStreams
+	// CapPathMTUProbes signals that the router answers padded path MTU probes.
+	CapPathMTUProbes
+	// CapPeerAnnounce signals that the router does not forward announcements
+	// that are meant for itself only.
+	CapPeerAnnounce
+	// CapSessionResumption signals that the router keeps resumption tickets
+	// and resumes encrypted sessions with them.
+	CapSessionResumption
+	// CapRouteQuery signals that the router answers route queries, which are
+	// used to discover routes.
+	CapRouteQuery
+	// CapNameQuery signals that the router answers name queries, which are
+	// used to look up names over the mesh.
+	CapNameQuery
+)
+
+// LocalCapabilities holds the capabilities of this router.
+const LocalCapabilities = CapFEC |
+	CapObservedAddr |
+	CapReachability |
+	CapGroups |
+	CapTransfers |
+	CapStreams |
+	CapPathMTUProbes |
+	CapPeerAnnounce |
+	CapSessionResumption |
+	CapRouteQuery |
+	CapNameQuery
+
+var capabilityNames = map[Capabilities]string{
+	CapFEC:               "fec",
+	CapObservedAddr:      "observed-addr",
+	CapReachability:      "reachability",
+	CapGroups:            "groups",
+	CapTransfers:         "transfers",
+	CapStreams:           "streams",
+	CapPathMTUProbes:     "path-mtu-probes",
+	CapPeerAnnounce:      "peer-announce",
+	CapSessionResumption: "session-resumption",
+	CapRouteQuery:        "route-query",
+	CapNameQuery:         "name-query",
+}
+
+// Has returns whether all of the given capabilities are set.
+func (c Capabilities) Has(capabilities Capabilities) bool {
+	return c&capabilities == capabilities
+}
+
+// Known returns whether any capabilities are set. Routers that do not
+// announce capabilities predate them and their support of features is unknown.
+func (c Capabilities) Known() bool {
+	return c != 0
+}
+
+// Common returns the capabilities supported by both.
+func (c Capabilities) Common(other Capabilities) Capabilities {
+	return c & other
+}
+
+// Names returns the names of the set capabilities. Unknown capabilities are
+// named by their bit, eg. "bit-42".
+func (c Capabilities) Names() []string {
+	names := make([]string, 0, bits.OnesCount64(uint64(c)))
+	for remaining := c; remaining != 0; remaining &= remaining - 1 {
+		bit := Capabilities(1) << bits.TrailingZeros64(uint64(remaining))
+		if name, ok := capabilityNames[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("bit-%d", bits.TrailingZeros64(uint64(bit))))
+		}
+	}
+	return names
+}
+
+// String returns the names of the set capabilities, separated by commas.
+func (c Capabilities) String() string {
+	if c == 0 {
+		return "none"
+	}
+	return strings.Join(c.Names(), ",")
+}
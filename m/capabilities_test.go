@@ -0,0 +1,24 @@
+package m
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	t.Parallel()
+
+	c := CapFEC | CapTransfers
+	assert.True(t, c.Has(CapFEC))
+	assert.True(t, c.Has(CapFEC|CapTransfers))
+	assert.False(t, c.Has(CapFEC|CapGroups))
+	assert.True(t, c.Known())
+	assert.False(t, Capabilities(0).Known())
+	assert.Equal(t, CapTransfers, c.Common(CapTransfers|CapStreams))
+
+	assert.Equal(t, "fec,transfers", c.String())
+	assert.Equal(t, "none", Capabilities(0).String())
+	assert.Equal(t, []string{"groups", "bit-42"}, (CapGroups | 1<<42).Names())
+	assert.True(t, LocalCapabilities.Has(CapPathMTUProbes))
+}
@@ -0,0 +1,186 @@
+package m
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock skew thresholds between routers.
+const (
+	// ClockSkewTolerance is the clock skew that is tolerated without
+	// adjusting time based checks or warning about it.
+	ClockSkewTolerance = 30 * time.Second
+	// ClockSkewCritical is the clock skew at which time based checks of other
+	// routers may fail.
+	ClockSkewCritical = 10 * time.Minute
+)
+
+// Clock provides the current time and timers.
+// It is used by time-dependent subsystems, so that the system clock can be
+// replaced by a virtual clock in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current time
+	// on the returned channel.
+	After(d time.Duration) <-chan time.Time
+
+	// NewTicker returns a new ticker that ticks with the given period.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is a ticker of a Clock.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// SystemClock is the clock of the system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// VirtualClock is a clock that only moves forward when advanced.
+// It is intended for tests that need to fast-forward time.
+type VirtualClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*virtualTimer
+}
+
+type virtualTimer struct {
+	clock  *VirtualClock
+	next   time.Time
+	period time.Duration // Zero for one-shot timers.
+	c      chan time.Time
+}
+
+var _ Clock = &VirtualClock{}
+
+// NewVirtualClock returns a new virtual clock starting at the given time.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{
+		now: start,
+	}
+}
+
+// Now returns the current virtual time.
+func (vc *VirtualClock) Now() time.Time {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	return vc.now
+}
+
+// After waits for the virtual duration to elapse and then sends the current
+// virtual time on the returned channel.
+func (vc *VirtualClock) After(d time.Duration) <-chan time.Time {
+	return vc.addTimer(d, 0).c
+}
+
+// NewTicker returns a new ticker that ticks with the given virtual period.
+func (vc *VirtualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return vc.addTimer(d, d)
+}
+
+func (vc *VirtualClock) addTimer(d, period time.Duration) *virtualTimer {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	t := &virtualTimer{
+		clock:  vc,
+		next:   vc.now.Add(d),
+		period: period,
+		c:      make(chan time.Time, 1),
+	}
+	vc.timers = append(vc.timers, t)
+	vc.fireDue()
+	return t
+}
+
+// Advance moves the virtual clock forward by the given duration and fires all
+// timers and tickers that become due, in order.
+// Like with the system clock, ticks are dropped when the receiver is not
+// keeping up.
+func (vc *VirtualClock) Advance(d time.Duration) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	until := vc.now.Add(d)
+	for {
+		// Find next due timer.
+		var next *virtualTimer
+		for _, t := range vc.timers {
+			if !t.next.After(until) && (next == nil || t.next.Before(next.next)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		// Move time forward to the timer and fire it.
+		vc.now = next.next
+		vc.fireDue()
+	}
+	vc.now = until
+}
+
+// fireDue fires all timers that are due at the current time.
+// Must be called with the lock held.
+func (vc *VirtualClock) fireDue() {
+	vc.timers = slices.DeleteFunc(vc.timers, func(t *virtualTimer) bool {
+		if t.next.After(vc.now) {
+			return false
+		}
+
+		// Send tick, but drop it if the receiver is not keeping up.
+		select {
+		case t.c <- vc.now:
+		default:
+		}
+
+		// Reschedule tickers, remove one-shot timers.
+		if t.period > 0 {
+			t.next = t.next.Add(t.period)
+			return false
+		}
+		return true
+	})
+}
+
+// C returns the channel on which the ticks are delivered.
+func (t *virtualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop turns off the ticker.
+func (t *virtualTimer) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	t.clock.timers = slices.DeleteFunc(t.clock.timers, func(other *virtualTimer) bool {
+		return other == t
+	})
+}
@@ -14,3 +14,12 @@ var (
 	// RouterAddress is the address used to send multicast messages to other routers.
 	RouterAddress = netip.MustParseAddr("fd00::4")
 )
+
+// ICMP rate limits for messages the router itself generates, as recommended by
+// RFC 4443, Section 2.4 (f). They are shared by the router and the netstack.
+const (
+	// ICMPRateLimit is the maximum rate of ICMP messages per second.
+	ICMPRateLimit = 100
+	// ICMPRateBurst is the maximum amount of ICMP messages sent at once.
+	ICMPRateBurst = 50
+)
@@ -0,0 +1,127 @@
+package m
+
+import "errors"
+
+// ErrorCode is a stable, machine readable identifier of an error condition.
+// Codes are surfaced through the API, error pings and peering errors, so that
+// clients can translate and react to errors without matching error messages.
+type ErrorCode string
+
+// Error codes.
+const (
+	// CodeNoRoute is used when there is no route to the destination.
+	CodeNoRoute ErrorCode = "no-route"
+	// CodePolicyDenied is used when a connection was denied by policy.
+	CodePolicyDenied ErrorCode = "policy-denied"
+	// CodeRejected is used when a connection was rejected for technical or
+	// operational reasons.
+	CodeRejected ErrorCode = "rejected"
+	// CodeMTUExceeded is used when data does not fit into a frame or the
+	// path MTU.
+	CodeMTUExceeded ErrorCode = "mtu-exceeded"
+	// CodeTTLExpired is used when a frame was dropped by a relay, because its
+	// TTL expired. This indicates a routing loop.
+	CodeTTLExpired ErrorCode = "ttl-expired"
+	// CodeNoEncryptionKeys is used when a router has no encryption session
+	// for a received frame.
+	CodeNoEncryptionKeys ErrorCode = "no-encryption-keys"
+
+	// CodeUniverseMismatch is used when a peering handshake failed, because
+	// the routers are in different universes.
+	CodeUniverseMismatch ErrorCode = "handshake-universe-mismatch"
+	// CodeVersionMismatch is used when a peering handshake failed, because
+	// the routers run incompatible versions.
+	CodeVersionMismatch ErrorCode = "handshake-version-mismatch"
+	// CodePeeringDenied is used when the remote router denied peering.
+	CodePeeringDenied ErrorCode = "peering-denied"
+	// CodePeerLimit is used when the maximum amount of peers is reached.
+	CodePeerLimit ErrorCode = "peer-limit"
+)
+
+// Known returns whether the code is one of the defined error codes.
+// Codes received from other routers must be checked before they are used.
+func (c ErrorCode) Known() bool {
+	switch c {
+	case CodeNoRoute,
+		CodePolicyDenied,
+		CodeRejected,
+		CodeMTUExceeded,
+		CodeTTLExpired,
+		CodeNoEncryptionKeys,
+		CodeUniverseMismatch,
+		CodeVersionMismatch,
+		CodePeeringDenied,
+		CodePeerLimit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Error is an error with an error code.
+// Use it for sentinel errors that clients may need to react to.
+type Error struct {
+	Code ErrorCode
+	Msg  string
+}
+
+// NewError returns a new error with the given code and message.
+func NewError(code ErrorCode, msg string) *Error {
+	return &Error{
+		Code: code,
+		Msg:  msg,
+	}
+}
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// ErrorCode returns the error code.
+func (e *Error) ErrorCode() ErrorCode {
+	return e.Code
+}
+
+// codedError adds an error code to an existing error.
+type codedError struct {
+	code ErrorCode
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+func (e *codedError) ErrorCode() ErrorCode {
+	return e.code
+}
+
+// WithCode returns the error with the given code added. The code takes
+// precedence over codes of wrapped errors.
+// Returns the error unchanged if it is nil or the code is empty.
+func WithCode(code ErrorCode, err error) error {
+	if err == nil || code == "" {
+		return err
+	}
+	return &codedError{
+		code: code,
+		err:  err,
+	}
+}
+
+// ErrorCodeOf returns the code of the first error in the chain that has one.
+// Returns an empty code if there is none.
+func ErrorCodeOf(err error) ErrorCode {
+	var coded interface {
+		ErrorCode() ErrorCode
+	}
+	if errors.As(err, &coded) {
+		return coded.ErrorCode()
+	}
+	return ""
+}
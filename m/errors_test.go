@@ -0,0 +1,37 @@
+package m
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodes(t *testing.T) {
+	t.Parallel()
+
+	errTest := NewError(CodeNoRoute, "no route")
+	wrapped := fmt.Errorf("send: %w", errTest)
+	assert.Equal(t, CodeNoRoute, ErrorCodeOf(wrapped))
+	assert.ErrorIs(t, wrapped, errTest)
+	assert.Equal(t, "send: no route", wrapped.Error())
+
+	// Added codes take precedence over codes of wrapped errors.
+	coded := WithCode(CodeMTUExceeded, wrapped)
+	assert.Equal(t, CodeMTUExceeded, ErrorCodeOf(coded))
+	assert.ErrorIs(t, coded, errTest, "wrapped errors must still match")
+	assert.Equal(t, wrapped.Error(), coded.Error())
+
+	// Errors without code.
+	assert.Empty(t, ErrorCodeOf(errors.New("plain")))
+	assert.Empty(t, ErrorCodeOf(nil))
+	assert.NoError(t, WithCode(CodeNoRoute, nil))
+	plain := errors.New("plain")
+	assert.Equal(t, plain, WithCode("", plain))
+
+	// Codes from other routers must be known.
+	assert.True(t, CodeUniverseMismatch.Known())
+	assert.False(t, ErrorCode("made-up").Known())
+	assert.False(t, ErrorCode("").Known())
+}
@@ -0,0 +1,106 @@
+package m
+
+import "net/netip"
+
+// minContinentDelays holds the minimum plausible one-way delays in
+// milliseconds between continents. The values are deliberately low, about
+// half of what is commonly measured between the closest major cities, so that
+// only paths that are physically impossible are considered implausible.
+// Neighboring continents are not listed, as they may be very close at their
+// borders.
+var minContinentDelays = map[[2]string]uint16{
+	{"EU", "NA"}: 25,
+	{"EU", "SA"}: 40,
+	{"EU", "EA"}: 35,
+	{"EU", "OC"}: 70,
+	{"AF", "NA"}: 35,
+	{"AF", "EA"}: 40,
+	{"AF", "OC"}: 50,
+	{"NA", "WA"}: 45,
+	{"NA", "EA"}: 40,
+	{"NA", "OC"}: 50,
+	{"SA", "WA"}: 50,
+	{"SA", "EA"}: 80,
+	{"SA", "OC"}: 60,
+	{"AF", "SA"}: 25,
+	{"OC", "WA"}: 40,
+}
+
+// MinGeoDelay returns the minimum plausible one-way delay in milliseconds
+// between the given IPs, based on their geo markers.
+// Returns zero if there is no known minimum.
+func MinGeoDelay(a, b netip.Addr) uint16 {
+	aMarker, err := LookupCountryMarker(a)
+	if err != nil {
+		return 0
+	}
+	bMarker, err := LookupCountryMarker(b)
+	if err != nil {
+		return 0
+	}
+	return MinContinentDelay(aMarker.Continent, bMarker.Continent)
+}
+
+// MinContinentDelay returns the minimum plausible one-way delay in
+// milliseconds between the given continents.
+// Returns zero if there is no known minimum.
+func MinContinentDelay(a, b string) uint16 {
+	if delay, ok := minContinentDelays[[2]string{a, b}]; ok {
+		return delay
+	}
+	return minContinentDelays[[2]string{b, a}]
+}
+
+// ImplausibleDelay describes a part of a switch path with a total delay that
+// is physically impossible for the geo markers of its ends.
+type ImplausibleDelay struct {
+	From     netip.Addr
+	To       netip.Addr
+	Delay    uint
+	MinDelay uint16
+}
+
+// CheckGeoDelays checks all router pairs of the path for delays that are too
+// low for the distance between their geo markers. This protects route
+// selection from routers with misconfigured or spoofed geo markers.
+// Returns the first implausible part of the path found, or nil.
+func (sp *SwitchPath) CheckGeoDelays() *ImplausibleDelay {
+	// Look up continents of all hops.
+	continents := make([]string, len(sp.Hops))
+	var found int
+	for i, hop := range sp.Hops {
+		if marker, err := LookupCountryMarker(hop.Router); err == nil {
+			continents[i] = marker.Continent
+			found++
+		}
+	}
+	if found < 2 {
+		return nil
+	}
+
+	// Check all pairs of hops with geo markers.
+	// The delay of a hop is the delay to the next hop.
+	for i := range sp.Hops {
+		if continents[i] == "" {
+			continue
+		}
+		var delay uint
+		for j := i + 1; j < len(sp.Hops); j++ {
+			delay += max(uint(sp.Hops[j-1].Delay), MinHopDelay)
+			if continents[j] == "" {
+				continue
+			}
+			minDelay := MinContinentDelay(continents[i], continents[j])
+			if delay < uint(minDelay) {
+				return &ImplausibleDelay{
+					From:     sp.Hops[i].Router,
+					To:       sp.Hops[j].Router,
+					Delay:    delay,
+					MinDelay: minDelay,
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package m
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckGeoDelays(t *testing.T) {
+	t.Parallel()
+
+	routerIn := func(country string) netip.Addr {
+		prefix, err := GetCountryPrefix(country)
+		require.NoError(t, err)
+		return makeRandomAddress(prefix)
+	}
+	germany := routerIn("DE")
+	austria := routerIn("AT")
+	newYork := routerIn("US-NY")
+	japan := routerIn("JP")
+	noMarker := makeRandomAddress(netip.MustParsePrefix("fd80::/16"))
+
+	assert.Equal(t, uint16(25), MinGeoDelay(germany, newYork))
+	assert.Equal(t, MinGeoDelay(germany, newYork), MinGeoDelay(newYork, germany))
+	assert.Zero(t, MinGeoDelay(germany, austria))
+	assert.Zero(t, MinGeoDelay(germany, noMarker))
+
+	makePath := func(delays []uint16, routers ...netip.Addr) *SwitchPath {
+		sp := &SwitchPath{}
+		for i, router := range routers {
+			hop := SwitchHop{Router: router}
+			if i < len(delays) {
+				hop.Delay = delays[i]
+			}
+			sp.Hops = append(sp.Hops, hop)
+		}
+		return sp
+	}
+
+	// Plausible paths.
+	assert.Nil(t, makePath([]uint16{2}, germany, austria).CheckGeoDelays())
+	assert.Nil(t, makePath([]uint16{40}, germany, newYork).CheckGeoDelays())
+	assert.Nil(t, makePath([]uint16{3, 3}, germany, noMarker, noMarker).CheckGeoDelays())
+	assert.Nil(t, makePath([]uint16{20, 30, 60}, germany, austria, newYork, japan).CheckGeoDelays())
+
+	// Direct link between continents that is too fast.
+	implausible := makePath([]uint16{3}, germany, newYork).CheckGeoDelays()
+	require.NotNil(t, implausible)
+	assert.Equal(t, germany, implausible.From)
+	assert.Equal(t, newYork, implausible.To)
+	assert.Equal(t, uint(MinHopDelay), implausible.Delay)
+	assert.Equal(t, uint16(25), implausible.MinDelay)
+
+	// Too fast over multiple hops, with a router without geo marker between.
+	implausible = makePath([]uint16{30, 5, 5}, newYork, germany, noMarker, japan).CheckGeoDelays()
+	require.NotNil(t, implausible)
+	assert.Equal(t, germany, implausible.From)
+	assert.Equal(t, japan, implausible.To)
+	assert.Equal(t, uint(10), implausible.Delay)
+}
@@ -1,6 +1,7 @@
 package m
 
 import (
+	"fmt"
 	"net/netip"
 	"slices"
 )
@@ -16,18 +17,17 @@ type CountryMarkerLookup struct {
 
 type countryMarkerLookupTable []CountryMarkerLookup
 
-var countryMarkerLookup countryMarkerLookupTable
-
-func init() {
-	countryMarkerLookup = make([]CountryMarkerLookup, 0, len(countryGeoMarkers))
-	for cc, cgm := range countryGeoMarkers {
-		baseIP := cgm.BaseIP()
-		prefix, err := baseIP.Prefix(int(16 + cgm.CountryMarkerBits))
+// makeCountryMarkerLookup builds the lookup table for the given countries,
+// sorted by base IP.
+func makeCountryMarkerLookup(countries map[string]CountryGeoMarking) (countryMarkerLookupTable, error) {
+	lookup := make(countryMarkerLookupTable, 0, len(countries))
+	for cc, cgm := range countries {
+		prefix, err := cgm.Prefix()
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("country %s: %w", cc, err)
 		}
-		countryMarkerLookup = append(countryMarkerLookup, CountryMarkerLookup{
-			BaseIP:    baseIP,
+		lookup = append(lookup, CountryMarkerLookup{
+			BaseIP:    prefix.Addr(),
 			Prefix:    prefix,
 			Continent: cgm.ContinentCode,
 			Region:    cgm.RegionCode,
@@ -35,15 +35,17 @@ func init() {
 		})
 	}
 	slices.SortFunc[countryMarkerLookupTable, CountryMarkerLookup](
-		countryMarkerLookup,
+		lookup,
 		func(a CountryMarkerLookup, b CountryMarkerLookup) int {
 			return a.BaseIP.Compare(b.BaseIP)
 		},
 	)
+	return lookup, nil
 }
 
 // LookupCountryMarker return the country geo marker information of the given IP.
 func LookupCountryMarker(ip netip.Addr) (*CountryMarkerLookup, error) {
+	countryMarkerLookup := getMarkerTable().lookup
 	index, ok := slices.BinarySearchFunc[countryMarkerLookupTable, CountryMarkerLookup, netip.Addr](
 		countryMarkerLookup,
 		ip,
@@ -83,7 +83,7 @@ var (
 // GetCountryPrefix returns a prefix with a country geo marker for the given country code.
 // The US country code requires the US state code to appended, splitted by a dash.
 func GetCountryPrefix(countryCode string) (prefix netip.Prefix, err error) {
-	cgm, ok := countryGeoMarkers[countryCode]
+	cgm, ok := getMarkerTable().Countries[countryCode]
 	if !ok {
 		return netip.Prefix{}, ErrNotFound
 	}
@@ -93,11 +93,11 @@ func GetCountryPrefix(countryCode string) (prefix netip.Prefix, err error) {
 
 // CountryGeoMarking defines the geo marker for a country.
 type CountryGeoMarking struct {
-	ContinentCode string
-	RegionCode    string
+	ContinentCode string `cbor:"c,omitempty" json:"continent"`
+	RegionCode    string `cbor:"r,omitempty" json:"region"`
 
-	CountryMarker     uint8
-	CountryMarkerBits uint8
+	CountryMarker     uint8 `cbor:"m,omitempty" json:"marker,omitempty"`
+	CountryMarkerBits uint8 `cbor:"b,omitempty" json:"markerBits,omitempty"`
 }
 
 // Prefix returns the prefix of the country marker.
@@ -17,6 +17,7 @@ var prefixTestData = map[string]netip.Prefix{
 func TestGeoMarkerCreation(t *testing.T) {
 	t.Parallel()
 
+	countryMarkerLookup := getMarkerTable().lookup
 	for cc, testPrefix := range prefixTestData {
 		// Test 1: prefix generation
 		prefix, err := GetCountryPrefix(cc)
@@ -0,0 +1,180 @@
+package m
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// BuiltinMarkerTableVersion is the version of the compiled in country geo
+// marker table. Increase it with every change to the country geo markers.
+const BuiltinMarkerTableVersion = 1
+
+var markerTableSigningContext = []byte("marker table")
+
+// Marker table errors.
+var (
+	ErrMarkerTableInvalid   = errors.New("invalid marker table")
+	ErrMarkerTableUntrusted = errors.New("marker table is not signed by a trusted router")
+	ErrMarkerTableOutdated  = errors.New("marker table is not newer than the active table")
+)
+
+// MarkerTable holds the country geo markers of the address plan.
+// It is the single source for all country marker lookups.
+type MarkerTable struct {
+	Version   uint64                       `cbor:"v,omitempty" json:"version"`
+	Countries map[string]CountryGeoMarking `cbor:"c,omitempty" json:"countries"`
+
+	// Signer is the router that signed the table.
+	// It is not set for the compiled in table.
+	Signer netip.Addr `cbor:"-" json:"signer,omitempty"`
+
+	lookup countryMarkerLookupTable
+}
+
+// signedMarkerTable is the serialized and signed form of a marker table.
+type signedMarkerTable struct {
+	Table  []byte        `cbor:"t,omitempty"`
+	Signer PublicAddress `cbor:"r,omitempty"`
+	Sig    []byte        `cbor:"s,omitempty"`
+}
+
+var activeMarkerTable atomic.Pointer[MarkerTable]
+
+func init() {
+	table, err := NewMarkerTable(BuiltinMarkerTableVersion, countryGeoMarkers)
+	if err != nil {
+		panic(fmt.Sprintf("invalid builtin marker table: %s", err))
+	}
+	activeMarkerTable.Store(table)
+}
+
+// getMarkerTable returns the active marker table.
+func getMarkerTable() *MarkerTable {
+	return activeMarkerTable.Load()
+}
+
+// ActiveMarkerTable returns the active marker table.
+// The returned table must not be modified.
+func ActiveMarkerTable() *MarkerTable {
+	return getMarkerTable()
+}
+
+// SetMarkerTable sets the given table as the active marker table.
+// Only tables that are newer than the compiled in table are accepted, so that
+// an outdated table does not override the table of an upgraded binary.
+func SetMarkerTable(table *MarkerTable) error {
+	if table.Version <= BuiltinMarkerTableVersion {
+		return fmt.Errorf("%w: version %d, builtin is %d", ErrMarkerTableOutdated, table.Version, BuiltinMarkerTableVersion)
+	}
+	activeMarkerTable.Store(table)
+	return nil
+}
+
+// NewMarkerTable checks the given country geo markers and returns a new
+// marker table.
+func NewMarkerTable(version uint64, countries map[string]CountryGeoMarking) (*MarkerTable, error) {
+	if version == 0 {
+		return nil, fmt.Errorf("%w: version missing", ErrMarkerTableInvalid)
+	}
+	if len(countries) == 0 {
+		return nil, fmt.Errorf("%w: no countries", ErrMarkerTableInvalid)
+	}
+
+	// Check countries.
+	for cc, cgm := range countries {
+		_, continentOK := continentCodeToMarker[cgm.ContinentCode]
+		_, regionOK := regionCodeToMarker[cgm.RegionCode]
+		switch {
+		case cc == "" || len(cc) > 8:
+			return nil, fmt.Errorf("%w: invalid country code %q", ErrMarkerTableInvalid, cc)
+		case !continentOK:
+			return nil, fmt.Errorf("%w: country %s has unknown continent %q", ErrMarkerTableInvalid, cc, cgm.ContinentCode)
+		case !regionOK:
+			return nil, fmt.Errorf("%w: country %s has unknown region %q", ErrMarkerTableInvalid, cc, cgm.RegionCode)
+		case cgm.CountryMarkerBits > 8:
+			return nil, fmt.Errorf("%w: country %s has too many marker bits", ErrMarkerTableInvalid, cc)
+		case cgm.CountryMarkerBits < 8 && cgm.CountryMarker >= 1<<cgm.CountryMarkerBits:
+			return nil, fmt.Errorf("%w: country %s has a marker that exceeds its bits", ErrMarkerTableInvalid, cc)
+		}
+	}
+
+	// Build lookup table and check for overlapping markers.
+	lookup, err := makeCountryMarkerLookup(countries)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMarkerTableInvalid, err)
+	}
+	for i := 1; i < len(lookup); i++ {
+		if lookup[i-1].Prefix.Overlaps(lookup[i].Prefix) {
+			return nil, fmt.Errorf(
+				"%w: markers of %s and %s overlap",
+				ErrMarkerTableInvalid, lookup[i-1].Country, lookup[i].Country,
+			)
+		}
+	}
+
+	return &MarkerTable{
+		Version:   version,
+		Countries: countries,
+		lookup:    lookup,
+	}, nil
+}
+
+// Builtin returns whether the table is the compiled in table.
+func (table *MarkerTable) Builtin() bool {
+	return !table.Signer.IsValid()
+}
+
+// SignMarkerTable signs the marker table with the given router address.
+func SignMarkerTable(signer *Address, table *MarkerTable) ([]byte, error) {
+	tableData, err := cbor.Marshal(table)
+	if err != nil {
+		return nil, fmt.Errorf("marshal marker table: %w", err)
+	}
+	sig, err := signer.SignWithContext(tableData, markerTableSigningContext)
+	if err != nil {
+		return nil, fmt.Errorf("sign marker table: %w", err)
+	}
+	return cbor.Marshal(&signedMarkerTable{
+		Table:  tableData,
+		Signer: signer.PublicAddress,
+		Sig:    sig,
+	})
+}
+
+// ParseSignedMarkerTable parses the given signed marker table and verifies
+// that it is signed by one of the trusted routers.
+func ParseSignedMarkerTable(data []byte, trusted []netip.Addr) (*MarkerTable, error) {
+	// Unpack.
+	signed := &signedMarkerTable{}
+	if err := cbor.Unmarshal(data, signed); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMarkerTableInvalid, err)
+	}
+
+	// Verify signer and signature.
+	if !slices.Contains(trusted, signed.Signer.IP) {
+		return nil, fmt.Errorf("%w: signed by %s", ErrMarkerTableUntrusted, signed.Signer.IP)
+	}
+	if err := signed.Signer.VerifyAddress(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMarkerTableInvalid, err)
+	}
+	if err := signed.Signer.VerifySigWithContext(signed.Table, signed.Sig, markerTableSigningContext); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMarkerTableInvalid, err)
+	}
+
+	// Unpack and check table.
+	unchecked := &MarkerTable{}
+	if err := cbor.Unmarshal(signed.Table, unchecked); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMarkerTableInvalid, err)
+	}
+	table, err := NewMarkerTable(unchecked.Version, unchecked.Countries)
+	if err != nil {
+		return nil, err
+	}
+	table.Signer = signed.Signer.IP
+	return table, nil
+}
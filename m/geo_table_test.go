@@ -0,0 +1,69 @@
+package m
+
+import (
+	"context"
+	"maps"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkerTable(t *testing.T) {
+	t.Parallel()
+
+	signer, _, err := GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	other, _, err := GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+
+	// Update table by moving Austria to its own region.
+	countries := maps.Clone(countryGeoMarkers)
+	countries["AT"] = CountryGeoMarking{"EU", "CS", 0, 0}
+	_, err = NewMarkerTable(2, countries)
+	require.ErrorIs(t, err, ErrMarkerTableInvalid, "Austria must overlap with other countries in CS")
+	for cc, cgm := range countries {
+		if cc != "AT" && cgm.ContinentCode == "EU" && cgm.RegionCode == "CS" {
+			delete(countries, cc)
+		}
+	}
+	table, err := NewMarkerTable(2, countries)
+	require.NoError(t, err)
+
+	// Sign and parse.
+	signed, err := SignMarkerTable(signer, table)
+	require.NoError(t, err)
+	parsed, err := ParseSignedMarkerTable(signed, []netip.Addr{signer.IP})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), parsed.Version)
+	assert.Equal(t, signer.IP, parsed.Signer)
+	assert.Equal(t, countries, parsed.Countries)
+	assert.False(t, parsed.Builtin())
+
+	// Untrusted signer.
+	_, err = ParseSignedMarkerTable(signed, []netip.Addr{other.IP})
+	require.ErrorIs(t, err, ErrMarkerTableUntrusted)
+
+	// Forged signature.
+	forgedSigner := *signer
+	forgedSigner.PrivateKey = other.PrivateKey
+	forged, err := SignMarkerTable(&forgedSigner, table)
+	require.NoError(t, err)
+	_, err = ParseSignedMarkerTable(forged, []netip.Addr{signer.IP})
+	require.ErrorIs(t, err, ErrMarkerTableInvalid)
+
+	// Invalid markers.
+	_, err = NewMarkerTable(2, map[string]CountryGeoMarking{"XX": {"XX", "CS", 0, 0}})
+	require.ErrorIs(t, err, ErrMarkerTableInvalid)
+	_, err = NewMarkerTable(2, map[string]CountryGeoMarking{"XX": {"EU", "CS", 4, 2}})
+	require.ErrorIs(t, err, ErrMarkerTableInvalid)
+
+	// Outdated tables are not activated.
+	builtin := ActiveMarkerTable()
+	assert.True(t, builtin.Builtin())
+	outdated, err := NewMarkerTable(BuiltinMarkerTableVersion, countryGeoMarkers)
+	require.NoError(t, err)
+	require.ErrorIs(t, SetMarkerTable(outdated), ErrMarkerTableOutdated)
+	assert.Same(t, builtin, ActiveMarkerTable())
+}
@@ -0,0 +1,145 @@
+package m
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// GuestTokenPrefix is the prefix of encoded guest tokens.
+const GuestTokenPrefix = "myco-guest:"
+
+var guestTokenSigningContext = []byte("guest token")
+
+// Guest token errors.
+var (
+	ErrGuestTokenInvalid = errors.New("invalid guest token")
+	ErrGuestTokenExpired = errors.New("guest token expired")
+)
+
+// GuestToken grants a router temporary access to a service of the issuing router.
+type GuestToken struct {
+	Issuer  netip.Addr `cbor:"i,omitempty" json:"issuer,omitempty"`
+	Service string     `cbor:"s,omitempty" json:"service,omitempty"`
+	Guest   netip.Addr `cbor:"g,omitempty" json:"guest,omitempty"` // Optional.
+	Expires int64      `cbor:"e,omitempty" json:"expires,omitempty"`
+}
+
+// signedGuestToken is the serialized and signed form of a guest token.
+type signedGuestToken struct {
+	Token []byte `cbor:"t,omitempty"`
+	Sig   []byte `cbor:"s,omitempty"`
+}
+
+// MintGuestToken creates a new guest token for the given service, signed by
+// the given issuer. If guest is valid, only this router may use the token.
+func MintGuestToken(issuer *Address, service string, guest netip.Addr, validFor time.Duration) (string, error) {
+	if service == "" {
+		return "", errors.New("service missing")
+	}
+	if validFor <= 0 {
+		return "", errors.New("validity must be positive")
+	}
+
+	// Create and marshal token.
+	token := GuestToken{
+		Issuer:  issuer.IP,
+		Service: service,
+		Guest:   guest,
+		Expires: time.Now().Add(validFor).Unix(),
+	}
+	tokenData, err := cbor.Marshal(&token)
+	if err != nil {
+		return "", fmt.Errorf("marshal token: %w", err)
+	}
+
+	// Sign token.
+	sig, err := issuer.SignWithContext(tokenData, guestTokenSigningContext)
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+
+	// Pack and encode.
+	signed, err := cbor.Marshal(&signedGuestToken{
+		Token: tokenData,
+		Sig:   sig,
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal signed token: %w", err)
+	}
+	return GuestTokenPrefix + base64.RawURLEncoding.EncodeToString(signed), nil
+}
+
+// ParseGuestToken parses the given guest token without verifying it.
+func ParseGuestToken(encoded string) (*GuestToken, error) {
+	token, _, err := parseGuestToken(encoded)
+	return token, err
+}
+
+// VerifyGuestToken parses the given guest token and verifies that it was
+// issued by the given router and has not expired at the given time.
+func VerifyGuestToken(encoded string, issuer *PublicAddress, now time.Time) (*GuestToken, error) {
+	token, signed, err := parseGuestToken(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check issuer and signature.
+	if token.Issuer != issuer.IP {
+		return nil, fmt.Errorf("%w: issued by other router", ErrGuestTokenInvalid)
+	}
+	if err := issuer.VerifySigWithContext(signed.Token, signed.Sig, guestTokenSigningContext); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGuestTokenInvalid, err)
+	}
+
+	// Check expiry.
+	if token.ExpiresAt().Before(now) {
+		return nil, ErrGuestTokenExpired
+	}
+
+	return token, nil
+}
+
+func parseGuestToken(encoded string) (*GuestToken, *signedGuestToken, error) {
+	// Decode.
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(encoded), GuestTokenPrefix)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: missing prefix", ErrGuestTokenInvalid)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrGuestTokenInvalid, err)
+	}
+
+	// Unpack.
+	signed := &signedGuestToken{}
+	if err := cbor.Unmarshal(data, signed); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrGuestTokenInvalid, err)
+	}
+	token := &GuestToken{}
+	if err := cbor.Unmarshal(signed.Token, token); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrGuestTokenInvalid, err)
+	}
+
+	// Check required fields.
+	switch {
+	case !token.Issuer.IsValid():
+		return nil, nil, fmt.Errorf("%w: issuer missing", ErrGuestTokenInvalid)
+	case token.Service == "":
+		return nil, nil, fmt.Errorf("%w: service missing", ErrGuestTokenInvalid)
+	case token.Expires == 0:
+		return nil, nil, fmt.Errorf("%w: expiry missing", ErrGuestTokenInvalid)
+	}
+
+	return token, signed, nil
+}
+
+// ExpiresAt returns the expiry time of the token.
+func (t *GuestToken) ExpiresAt() time.Time {
+	return time.Unix(t.Expires, 0)
+}
@@ -0,0 +1,60 @@
+package m
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestGuestToken(t *testing.T) {
+	t.Parallel()
+
+	issuer, _, err := GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest := netip.MustParseAddr("fd12::1")
+
+	// Mint and verify.
+	encoded, err := MintGuestToken(issuer, "dev", guest, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := VerifyGuestToken(encoded, &issuer.PublicAddress, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Service != "dev" || token.Guest != guest || token.Issuer != issuer.IP {
+		t.Errorf("unexpected token contents: %+v", token)
+	}
+
+	// Verify after expiry.
+	if _, err := VerifyGuestToken(encoded, &issuer.PublicAddress, time.Now().Add(2*time.Hour)); !errors.Is(err, ErrGuestTokenExpired) {
+		t.Errorf("token must be expired, got %v", err)
+	}
+
+	// Verify with wrong issuer.
+	if _, err := VerifyGuestToken(encoded, &other.PublicAddress, time.Now()); !errors.Is(err, ErrGuestTokenInvalid) {
+		t.Errorf("token must not verify with other issuer, got %v", err)
+	}
+
+	// Verify forged token.
+	forged, err := MintGuestToken(other, "dev", netip.Addr{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyGuestToken(forged, &issuer.PublicAddress, time.Now()); !errors.Is(err, ErrGuestTokenInvalid) {
+		t.Errorf("forged token must not verify, got %v", err)
+	}
+
+	// Verify garbage.
+	if _, err := ParseGuestToken(GuestTokenPrefix + "AAAA"); !errors.Is(err, ErrGuestTokenInvalid) {
+		t.Errorf("garbage token must not parse, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package m
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// InvitePrefix is the prefix of encoded invites.
+const InvitePrefix = "myco-invite:"
+
+var inviteSigningContext = []byte("invite")
+
+// Invite errors.
+var (
+	ErrInviteInvalid = errors.New("invalid invite")
+	ErrInviteExpired = errors.New("invite expired")
+)
+
+// Invite holds everything needed to add a router as a friend.
+// It is self-signed by the inviting router, whose address is bound to its key.
+type Invite struct {
+	Router      PublicAddress `cbor:"r,omitempty" json:"router,omitempty"`
+	Name        string        `cbor:"n,omitempty" json:"name,omitempty"` // Suggested friend name.
+	PeeringURLs []string      `cbor:"u,omitempty" json:"peeringURLs,omitempty"`
+	Expires     int64         `cbor:"e,omitempty" json:"expires,omitempty"`
+}
+
+// signedInvite is the serialized and signed form of an invite.
+type signedInvite struct {
+	Invite []byte `cbor:"i,omitempty"`
+	Sig    []byte `cbor:"s,omitempty"`
+}
+
+// MintInvite creates a new invite to the given router, signed by it.
+// The name is suggested to the invited router as the friend name.
+func MintInvite(router *Address, name string, peeringURLs []string, validFor time.Duration) (string, error) {
+	if validFor <= 0 {
+		return "", errors.New("validity must be positive")
+	}
+
+	// Create and marshal invite.
+	invite := Invite{
+		Router:      router.PublicAddress,
+		Name:        name,
+		PeeringURLs: peeringURLs,
+		Expires:     time.Now().Add(validFor).Unix(),
+	}
+	inviteData, err := cbor.Marshal(&invite)
+	if err != nil {
+		return "", fmt.Errorf("marshal invite: %w", err)
+	}
+
+	// Sign invite.
+	sig, err := router.SignWithContext(inviteData, inviteSigningContext)
+	if err != nil {
+		return "", fmt.Errorf("sign invite: %w", err)
+	}
+
+	// Pack and encode.
+	signed, err := cbor.Marshal(&signedInvite{
+		Invite: inviteData,
+		Sig:    sig,
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal signed invite: %w", err)
+	}
+	return InvitePrefix + base64.RawURLEncoding.EncodeToString(signed), nil
+}
+
+// ParseInvite parses the given invite and verifies that the signature matches
+// the address of the inviting router and that it has not yet expired.
+func ParseInvite(encoded string) (*Invite, error) {
+	// Decode.
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(encoded), InvitePrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing prefix", ErrInviteInvalid)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInviteInvalid, err)
+	}
+
+	// Unpack.
+	signed := &signedInvite{}
+	if err := cbor.Unmarshal(data, signed); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInviteInvalid, err)
+	}
+	invite := &Invite{}
+	if err := cbor.Unmarshal(signed.Invite, invite); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInviteInvalid, err)
+	}
+
+	// Verify address and signature.
+	if err := invite.Router.VerifyAddress(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInviteInvalid, err)
+	}
+	if err := invite.Router.VerifySigWithContext(signed.Invite, signed.Sig, inviteSigningContext); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInviteInvalid, err)
+	}
+
+	// Check expiry.
+	if invite.Expires == 0 {
+		return nil, fmt.Errorf("%w: expiry missing", ErrInviteInvalid)
+	}
+	if invite.ExpiresAt().Before(time.Now()) {
+		return nil, ErrInviteExpired
+	}
+
+	return invite, nil
+}
+
+// ExpiresAt returns the expiry time of the invite.
+func (i *Invite) ExpiresAt() time.Time {
+	return time.Unix(i.Expires, 0)
+}
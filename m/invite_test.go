@@ -0,0 +1,50 @@
+package m
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInvite(t *testing.T) {
+	t.Parallel()
+
+	router, _, err := GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := GeneratePrivacyAddress(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mint and parse.
+	encoded, err := MintInvite(router, "alice", []string{"tcp://192.0.2.1:47369"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invite, err := ParseInvite(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invite.Router.IP != router.IP || invite.Name != "alice" || len(invite.PeeringURLs) != 1 {
+		t.Errorf("unexpected invite contents: %+v", invite)
+	}
+
+	// Parse invite with swapped key.
+	forgedRouter := *router
+	forgedRouter.PrivateKey = other.PrivateKey
+	forged, err := MintInvite(&forgedRouter, "alice", nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseInvite(forged); !errors.Is(err, ErrInviteInvalid) {
+		t.Errorf("forged invite must not parse, got %v", err)
+	}
+
+	// Parse garbage.
+	if _, err := ParseInvite(InvitePrefix + "AAAA"); !errors.Is(err, ErrInviteInvalid) {
+		t.Errorf("garbage invite must not parse, got %v", err)
+	}
+}
@@ -11,6 +11,63 @@ import (
 	"golang.org/x/exp/slices"
 )
 
+// Peering URL query parameters that only apply to the local router.
+// They are removed before peering URLs are shared with others.
+const (
+	// PeeringURLParamBind binds the socket to a network interface (by name) or
+	// to a local IP address.
+	PeeringURLParamBind = "bind"
+	// PeeringURLParamSockets sets the amount of listening sockets that share
+	// the same address using SO_REUSEPORT. Use "auto" for one per CPU.
+	PeeringURLParamSockets = "sockets"
+	// PeeringURLParamWeight sets the weight of the link within a bond of
+	// multiple links to the same peer (1-100, defaults to 1).
+	PeeringURLParamWeight = "weight"
+	// PeeringURLParamFEC enables forward error correction for frames sent on
+	// the link in the format "<data>:<parity>", eg. "8:2" sends two parity
+	// records for every eight frames.
+	PeeringURLParamFEC = "fec"
+	// PeeringURLParamSchedule limits when the peering URL is used, eg.
+	// "daily+22:00-06:00". See Schedule for the format. Links outside of the
+	// schedule are drained and closed.
+	PeeringURLParamSchedule = "schedule"
+
+	// TCP tuning parameters.
+
+	// PeeringURLParamNoDelay sets TCP_NODELAY ("true" or "false").
+	PeeringURLParamNoDelay = "nodelay"
+	// PeeringURLParamKeepAlive enables TCP keep-alive with the given interval
+	// (eg. "30s"). Use "0" to disable keep-alive.
+	PeeringURLParamKeepAlive = "keepalive"
+	// PeeringURLParamUserTimeout sets TCP_USER_TIMEOUT (eg. "2m"). Linux only.
+	PeeringURLParamUserTimeout = "usertimeout"
+	// PeeringURLParamReadBuffer sets the socket receive buffer size in bytes.
+	PeeringURLParamReadBuffer = "rcvbuf"
+	// PeeringURLParamWriteBuffer sets the socket send buffer size in bytes.
+	PeeringURLParamWriteBuffer = "sndbuf"
+	// PeeringURLParamCongestion sets the TCP congestion control algorithm
+	// (eg. "bbr"). Linux only.
+	PeeringURLParamCongestion = "congestion"
+)
+
+var localPeeringURLParams = []string{
+	PeeringURLParamBind,
+	PeeringURLParamSockets,
+	PeeringURLParamWeight,
+	PeeringURLParamFEC,
+	PeeringURLParamSchedule,
+	PeeringURLParamNoDelay,
+	PeeringURLParamKeepAlive,
+	PeeringURLParamUserTimeout,
+	PeeringURLParamReadBuffer,
+	PeeringURLParamWriteBuffer,
+	PeeringURLParamCongestion,
+}
+
+// PeeringProtocolUnix is the protocol of peering URLs that use UNIX sockets
+// for peering on the same host, eg. "unix:///run/mycoria/peering.sock".
+const PeeringProtocolUnix = "unix"
+
 // PeeringURL represents a peering point that others can connect to.
 type PeeringURL struct {
 	Protocol string
@@ -63,6 +120,17 @@ func ParsePeeringURL(definition string) (*PeeringURL, error) {
 		return nil, errors.New("missing scheme/protocol")
 	}
 
+	// UNIX sockets only have a path.
+	if p.Protocol == PeeringProtocolUnix {
+		switch {
+		case u.Host != "":
+			return nil, errors.New("unix socket must not have a host")
+		case u.Path == "" || u.Path == "/":
+			return nil, errors.New("missing unix socket path")
+		}
+		return p, nil
+	}
+
 	// Parse port.
 	portData := u.Port()
 	if portData == "" && u.Opaque != "" {
@@ -110,6 +178,10 @@ func ParsePeeringURL(definition string) (*PeeringURL, error) {
 // String returns the definition form of the peering URL.
 func (p *PeeringURL) String() string {
 	switch {
+	case p.Protocol == PeeringProtocolUnix && p.Option != "":
+		return fmt.Sprintf("%s://%s#%s", p.Protocol, p.Path, p.Option)
+	case p.Protocol == PeeringProtocolUnix:
+		return fmt.Sprintf("%s://%s", p.Protocol, p.Path)
 	case p.Option != "":
 		return fmt.Sprintf("%s://%s:%d%s#%s", p.Protocol, p.Domain, p.Port, p.Path, p.Option)
 	case p.Domain != "":
@@ -119,8 +191,83 @@ func (p *PeeringURL) String() string {
 	}
 }
 
+// IsLocal returns whether the peering URL can only be reached from the same
+// host, such as UNIX sockets. These are never shared with others.
+func (p *PeeringURL) IsLocal() bool {
+	return p.Protocol == PeeringProtocolUnix
+}
+
+// SocketPath returns the path of a UNIX socket, without query parameters.
+func (p *PeeringURL) SocketPath() string {
+	path, _, _ := strings.Cut(p.Path, "?")
+	return path
+}
+
+// Param returns the value of the given query parameter of the peering URL.
+func (p *PeeringURL) Param(key string) string {
+	_, query, ok := strings.Cut(p.Path, "?")
+	if !ok {
+		return ""
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return ""
+	}
+	return values.Get(key)
+}
+
+// Schedule returns the schedule of the peering URL.
+// Returns nil if the peering URL is not limited by a schedule.
+func (p *PeeringURL) Schedule() (*Schedule, error) {
+	spec := p.Param(PeeringURLParamSchedule)
+	if spec == "" {
+		return nil, nil //nolint:nilnil // No schedule is not an error.
+	}
+	return ParseSchedule(spec)
+}
+
+// Public returns the peering URL without any local query parameters.
+// If there are none, the peering URL itself is returned.
+func (p *PeeringURL) Public() *PeeringURL {
+	path, query, ok := strings.Cut(p.Path, "?")
+	if !ok {
+		return p
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return p
+	}
+
+	// Remove local parameters.
+	var removed bool
+	for _, key := range localPeeringURLParams {
+		if values.Has(key) {
+			values.Del(key)
+			removed = true
+		}
+	}
+	if !removed {
+		return p
+	}
+
+	// Rebuild path.
+	public := *p
+	public.Path = path
+	if len(values) > 0 {
+		public.Path += "?" + values.Encode()
+	}
+	if public.Path == "/" {
+		public.Path = ""
+	}
+	return &public
+}
+
 // FormatWith formats the peering URL with the given host.
+// Local peering URLs have no host and are returned as is.
 func (p *PeeringURL) FormatWith(host string) string {
+	if p.IsLocal() {
+		return p.String()
+	}
 	if host == "" {
 		host = p.Domain
 	}
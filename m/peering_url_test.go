@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func parseT(t *testing.T, definition string) *PeeringURL {
@@ -138,6 +139,45 @@ func TestPeeringURLParsing(t *testing.T) {
 	assert.Equal(t, "http://example.com:80/test?key=value",
 		parseT(t, "http://example.com:80/test?key=value").String(), "should match")
 
+	// test local parameters
+
+	bindURL := parseT(t, "tcp://192.0.2.1:47369?bind=eth1")
+	assert.Equal(t, "eth1", bindURL.Param(PeeringURLParamBind), "should match")
+	assert.Equal(t, "tcp://192.0.2.1:47369", bindURL.Public().String(), "should match")
+	assert.Equal(t, "tcp://192.0.2.1:47369/?bind=eth1", bindURL.String(), "should not be modified")
+	assert.Equal(t, "http://example.com:80/test?key=value",
+		parseT(t, "http://example.com:80/test?bind=eth1&key=value").Public().String(), "should match")
+	plainURL := parseT(t, "tcp:47369")
+	assert.Same(t, plainURL, plainURL.Public(), "should match")
+	assert.Equal(t, "", plainURL.Param(PeeringURLParamBind), "should match")
+
+	// test schedule
+
+	scheduledURL := parseT(t, "tcp://192.0.2.1:47369?schedule=daily+22:00-06:00%3B+sat")
+	schedule, err := scheduledURL.Schedule()
+	require.NoError(t, err, "should parse")
+	assert.Equal(t, "daily 22:00-06:00; sat", schedule.String(), "should match")
+	assert.Equal(t, "tcp://192.0.2.1:47369", scheduledURL.Public().String(), "should match")
+	schedule, err = plainURL.Schedule()
+	require.NoError(t, err, "should not fail")
+	assert.Nil(t, schedule, "should have no schedule")
+	_, err = parseT(t, "tcp://192.0.2.1:47369?schedule=sometimes").Schedule()
+	require.Error(t, err, "should fail")
+
+	// test unix sockets
+
+	unixURL := parseT(t, "unix:///run/mycoria/peering.sock?fec=8:2")
+	assert.True(t, unixURL.IsLocal(), "should be local")
+	assert.Equal(t, "/run/mycoria/peering.sock", unixURL.SocketPath(), "should match")
+	assert.Equal(t, "8:2", unixURL.Param(PeeringURLParamFEC), "should match")
+	assert.Equal(t, "unix:///run/mycoria/peering.sock", unixURL.Public().String(), "should match")
+	assert.Equal(t, unixURL.String(), unixURL.FormatWith("192.0.2.1"), "should ignore host")
+	assert.Equal(t, "unix:///tmp/test.sock",
+		parseT(t, "unix:/tmp/test.sock").String(), "should match")
+	assert.False(t, plainURL.IsLocal(), "should not be local")
+	assert.NotEqual(t, parseTError("unix://"), nil, "should fail")
+	assert.NotEqual(t, parseTError("unix://example.com/test.sock"), nil, "should fail")
+
 	// test invalid
 
 	assert.NotEqual(t, parseTError("tcp"), nil, "should fail")
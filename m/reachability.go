@@ -0,0 +1,97 @@
+package m
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// MaxObservedAddresses limits the amount of observed addresses in
+// reachability hints.
+const MaxObservedAddresses = 4
+
+// ReachabilityHints describe how the listeners of a router can be reached,
+// so that connecting routers try the address family most likely to work
+// first, instead of trying the IANA hosts in config order.
+type ReachabilityHints struct {
+	// PublicIPv4 is set if the router has a public IPv4 address.
+	PublicIPv4 bool `cbor:"4,omitempty" json:"publicIPv4,omitempty" yaml:"publicIPv4,omitempty"`
+	// PublicIPv6 is set if the router has a public IPv6 address.
+	PublicIPv6 bool `cbor:"6,omitempty" json:"publicIPv6,omitempty" yaml:"publicIPv6,omitempty"`
+	// BehindNAT is set if the router only has private IPv4 addresses, so
+	// that incoming IPv4 connections depend on port forwarding.
+	BehindNAT bool `cbor:"n,omitempty" json:"behindNAT,omitempty" yaml:"behindNAT,omitempty"`
+	// Observed holds the external addresses of the router as observed by
+	// its peers.
+	Observed []netip.Addr `cbor:"o,omitempty" json:"observed,omitempty" yaml:"observed,omitempty"`
+}
+
+// IsEmpty returns whether no hints are set.
+func (h *ReachabilityHints) IsEmpty() bool {
+	return h == nil || (!h.PublicIPv4 && !h.PublicIPv6 && !h.BehindNAT && len(h.Observed) == 0)
+}
+
+// Clean removes observed addresses that are not public and limits them to
+// MaxObservedAddresses. It must be called on received hints before they are
+// used.
+func (h *ReachabilityHints) Clean() {
+	h.Observed = slices.DeleteFunc(h.Observed, func(ip netip.Addr) bool {
+		return !IsPublicIP(ip)
+	})
+	if len(h.Observed) > MaxObservedAddresses {
+		h.Observed = h.Observed[:MaxObservedAddresses]
+	}
+}
+
+// OrderHosts returns the hosts to try when connecting to the router, ordered
+// by how likely a connection succeeds. Observed addresses are added after
+// the given hosts. canIPv4 and canIPv6 define which address families the
+// connecting router can use. Hosts of unusable address families are removed.
+// The order of equally likely hosts is kept. Hints may be nil.
+func (h *ReachabilityHints) OrderHosts(hosts []string, canIPv4, canIPv6 bool) []string {
+	ordered := slices.Clone(hosts)
+	if h != nil {
+		for _, ip := range h.Observed {
+			if !slices.Contains(ordered, ip.String()) {
+				ordered = append(ordered, ip.String())
+			}
+		}
+	}
+
+	// Rank hosts, lower is better.
+	rank := func(host string) int {
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			// Domains may resolve to any address family.
+			return 1
+		}
+		ip = ip.Unmap()
+		switch {
+		case ip.Is4() && !canIPv4, ip.Is6() && !canIPv6:
+			return -1
+		case h == nil:
+			return 1
+		case ip.Is4() && h.PublicIPv4 && !h.BehindNAT:
+			return 0
+		case ip.Is6() && h.PublicIPv6:
+			return 0
+		default:
+			return 2
+		}
+	}
+	ordered = slices.DeleteFunc(ordered, func(host string) bool {
+		return rank(host) < 0
+	})
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		return rank(a) - rank(b)
+	})
+	return ordered
+}
+
+// SharedAddressSpace is used by carrier-grade NATs.
+var SharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublicIP returns whether the given IP is a public unicast address.
+func IsPublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !SharedAddressSpace.Contains(ip)
+}
@@ -0,0 +1,62 @@
+package m
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReachabilityHintsOrderHosts(t *testing.T) {
+	t.Parallel()
+
+	hosts := []string{"192.0.2.1", "example.com", "2001:db8::1"}
+
+	// Without hints, only unusable families are removed.
+	var hints *ReachabilityHints
+	assert.Equal(t, hosts, hints.OrderHosts(hosts, true, true))
+	assert.Equal(t, []string{"192.0.2.1", "example.com"}, hints.OrderHosts(hosts, true, false))
+
+	// IPv6 must be preferred when IPv4 is behind a NAT.
+	hints = &ReachabilityHints{
+		PublicIPv4: true,
+		PublicIPv6: true,
+		BehindNAT:  true,
+		Observed:   []netip.Addr{netip.MustParseAddr("198.51.100.1"), netip.MustParseAddr("192.0.2.1")},
+	}
+	assert.Equal(t,
+		[]string{"2001:db8::1", "example.com", "192.0.2.1", "198.51.100.1"},
+		hints.OrderHosts(hosts, true, true),
+	)
+
+	// Public IPv4 without NAT must be tried first, in the given order.
+	hints = &ReachabilityHints{PublicIPv4: true}
+	assert.Equal(t,
+		[]string{"192.0.2.1", "example.com", "2001:db8::1"},
+		hints.OrderHosts(hosts, true, true),
+	)
+	assert.Equal(t, []string{"example.com", "2001:db8::1"}, hints.OrderHosts(hosts, false, true))
+}
+
+func TestReachabilityHintsClean(t *testing.T) {
+	t.Parallel()
+
+	hints := &ReachabilityHints{
+		Observed: []netip.Addr{
+			netip.MustParseAddr("10.0.0.1"),
+			netip.MustParseAddr("fd00::1"),
+			netip.MustParseAddr("100.64.0.1"),
+			netip.MustParseAddr("127.0.0.1"),
+			netip.MustParseAddr("192.0.2.1"),
+			netip.MustParseAddr("192.0.2.2"),
+			netip.MustParseAddr("192.0.2.3"),
+			netip.MustParseAddr("192.0.2.4"),
+			netip.MustParseAddr("192.0.2.5"),
+		},
+	}
+	hints.Clean()
+	assert.Len(t, hints.Observed, MaxObservedAddresses)
+	assert.Equal(t, netip.MustParseAddr("192.0.2.1"), hints.Observed[0])
+	assert.False(t, hints.IsEmpty())
+	assert.True(t, (&ReachabilityHints{}).IsEmpty())
+}
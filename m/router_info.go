@@ -1,13 +1,53 @@
 package m
 
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum lengths of operator provided router info texts.
+const (
+	MaxRouterStatusLength  = 200
+	MaxRouterContactLength = 200
+)
+
+// Limits of groups a router is a member of.
+const (
+	MaxGroupNameLength = 64
+	MaxRouterGroups    = 16
+)
+
 // RouterInfo holds information about a router.
 type RouterInfo struct {
 	Version string `cbor:"v,omitempty" json:"version,omitempty" yaml:"version,omitempty"`
 
+	// Status is a short status text set by the operator, eg. to announce
+	// maintenance windows to peering partners.
+	Status string `cbor:"st,omitempty" json:"status,omitempty" yaml:"status,omitempty"`
+	// Contact is a contact URI of the operator, eg. "mailto:ops@example.com".
+	Contact string `cbor:"ct,omitempty" json:"contact,omitempty" yaml:"contact,omitempty"`
+	// Operator holds contact details of the operator.
+	Operator *OperatorInfo `cbor:"op,omitempty" json:"operator,omitempty" yaml:"operator,omitempty"`
+
 	Listeners []string `cbor:"l,omitempty" json:"listeners,omitempty" yaml:"listeners,omitempty"`
 	IANA      []string `cbor:"i,omitempty" json:"iana,omitempty"      yaml:"iana,omitempty"`
+	// Reachability holds hints on how the listeners can be reached.
+	Reachability *ReachabilityHints `cbor:"r,omitempty" json:"reachability,omitempty" yaml:"reachability,omitempty"`
 
 	PublicServices []RouterService `cbor:"srv,omitempty" json:"publicServices,omitempty" yaml:"publicServices,omitempty"`
+
+	// Groups holds the names of the groups the router is a member of.
+	Groups []string `cbor:"g,omitempty" json:"groups,omitempty" yaml:"groups,omitempty"`
+
+	// Capabilities holds the protocol features the router supports.
+	Capabilities Capabilities `cbor:"cap,omitempty" json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
 }
 
 // RouterService describes a service offered by a router.
@@ -17,3 +57,107 @@ type RouterService struct {
 	Domain      string `cbor:"dns,omitempty" json:"domain,omitempty"      yaml:"domain,omitempty"`
 	URL         string `cbor:"url,omitempty" json:"url,omitempty"         yaml:"url,omitempty"`
 }
+
+// OperatorInfo holds contact details of a router operator, so that operators
+// can reach each other, eg. when debugging path problems.
+type OperatorInfo struct {
+	Name   string `cbor:"n,omitempty" json:"name,omitempty"   yaml:"name,omitempty"`
+	Email  string `cbor:"e,omitempty" json:"email,omitempty"  yaml:"email,omitempty"`
+	Matrix string `cbor:"m,omitempty" json:"matrix,omitempty" yaml:"matrix,omitempty"`
+	URL    string `cbor:"u,omitempty" json:"url,omitempty"    yaml:"url,omitempty"`
+	// Abuse is the email address to report abuse to.
+	Abuse string `cbor:"a,omitempty" json:"abuse,omitempty" yaml:"abuse,omitempty"`
+}
+
+// IsEmpty returns whether no contact details are set.
+func (op *OperatorInfo) IsEmpty() bool {
+	return op == nil || *op == OperatorInfo{}
+}
+
+// Check checks if the contact details are well formed.
+func (op *OperatorInfo) Check() error {
+	if op.Email != "" {
+		if _, err := mail.ParseAddress(op.Email); err != nil {
+			return fmt.Errorf("invalid email: %w", err)
+		}
+	}
+	if op.Abuse != "" {
+		if _, err := mail.ParseAddress(op.Abuse); err != nil {
+			return fmt.Errorf("invalid abuse email: %w", err)
+		}
+	}
+	if op.Matrix != "" && !matrixIDRegex.MatchString(op.Matrix) {
+		return errors.New("invalid matrix ID: must be in the format @user:server")
+	}
+	if op.URL != "" {
+		u, err := url.Parse(op.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.New("invalid url: must be a http(s) URL")
+		}
+	}
+	for _, field := range []string{op.Name, op.Email, op.Matrix, op.URL, op.Abuse} {
+		if utf8.RuneCountInString(field) > MaxRouterContactLength {
+			return fmt.Errorf("operator info must not be longer than %d characters", MaxRouterContactLength)
+		}
+	}
+	return nil
+}
+
+var matrixIDRegex = regexp.MustCompile(`^@[^:\s]+:[^\s]+$`)
+
+// Clean removes control characters from the operator provided texts and
+// truncates them to their maximum length. It must be called on received
+// router infos before they are displayed.
+func (info *RouterInfo) Clean() {
+	info.Status = cleanInfoText(info.Status, MaxRouterStatusLength)
+	info.Contact = cleanInfoText(info.Contact, MaxRouterContactLength)
+	if op := info.Operator; op != nil {
+		op.Name = cleanInfoText(op.Name, MaxRouterContactLength)
+		op.Email = cleanInfoText(op.Email, MaxRouterContactLength)
+		op.Matrix = cleanInfoText(op.Matrix, MaxRouterContactLength)
+		op.URL = cleanInfoText(op.URL, MaxRouterContactLength)
+		op.Abuse = cleanInfoText(op.Abuse, MaxRouterContactLength)
+		if op.IsEmpty() {
+			info.Operator = nil
+		}
+	}
+	if info.Reachability != nil {
+		info.Reachability.Clean()
+		if info.Reachability.IsEmpty() {
+			info.Reachability = nil
+		}
+	}
+	info.Groups = slices.DeleteFunc(info.Groups, func(group string) bool {
+		return CheckGroupName(group) != nil
+	})
+	if len(info.Groups) > MaxRouterGroups {
+		info.Groups = info.Groups[:MaxRouterGroups]
+	}
+}
+
+// CheckGroupName checks if the given group name is valid.
+// Group names consist of letters, digits, "-", "_" and ".".
+func CheckGroupName(name string) error {
+	if name == "" || len(name) > MaxGroupNameLength {
+		return fmt.Errorf("group name must be between 1 and %d characters", MaxGroupNameLength)
+	}
+	if !groupNameRegex.MatchString(name) {
+		return errors.New(`group name may only contain letters, digits, "-", "_" and "."`)
+	}
+	return nil
+}
+
+var groupNameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+func cleanInfoText(text string, maxLength int) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+	if runes := []rune(text); len(runes) > maxLength {
+		text = string(runes[:maxLength])
+	}
+	return strings.TrimSpace(text)
+}
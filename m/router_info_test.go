@@ -0,0 +1,63 @@
+package m
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterInfoClean(t *testing.T) {
+	t.Parallel()
+
+	info := &RouterInfo{
+		Status:  " maintenance\x1b[31m Sunday\n02:00 UTC ",
+		Contact: strings.Repeat("ä", MaxRouterContactLength+10),
+	}
+	info.Clean()
+	assert.Equal(t, "maintenance[31m Sunday02:00 UTC", info.Status, "control characters must be removed")
+	assert.Equal(t, strings.Repeat("ä", MaxRouterContactLength), info.Contact, "contact must be truncated")
+}
+
+func TestOperatorInfoCheck(t *testing.T) {
+	t.Parallel()
+
+	valid := &OperatorInfo{
+		Name:   "Example Ops",
+		Email:  "ops@example.com",
+		Matrix: "@ops:example.com",
+		URL:    "https://example.com/mycoria",
+		Abuse:  "abuse@example.com",
+	}
+	assert.NoError(t, valid.Check())
+	assert.False(t, valid.IsEmpty())
+	assert.True(t, (&OperatorInfo{}).IsEmpty())
+
+	assert.Error(t, (&OperatorInfo{Email: "ops"}).Check(), "invalid email")
+	assert.Error(t, (&OperatorInfo{Matrix: "ops@example.com"}).Check(), "invalid matrix ID")
+	assert.Error(t, (&OperatorInfo{URL: "ftp://example.com"}).Check(), "invalid url")
+
+	// Empty operator info must be removed when cleaning.
+	info := &RouterInfo{Operator: &OperatorInfo{Name: "\x00"}}
+	info.Clean()
+	assert.Nil(t, info.Operator)
+}
+
+func TestRouterInfoGroups(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, CheckGroupName("presence.v1"))
+	assert.Error(t, CheckGroupName(""), "empty name")
+	assert.Error(t, CheckGroupName("with space"), "invalid character")
+	assert.Error(t, CheckGroupName(strings.Repeat("a", MaxGroupNameLength+1)), "too long")
+
+	// Invalid groups must be removed and groups must be limited.
+	info := &RouterInfo{Groups: []string{"ok", "not ok"}}
+	for range MaxRouterGroups {
+		info.Groups = append(info.Groups, "more")
+	}
+	info.Clean()
+	assert.Len(t, info.Groups, MaxRouterGroups)
+	assert.Equal(t, "ok", info.Groups[0])
+	assert.NotContains(t, info.Groups, "not ok")
+}
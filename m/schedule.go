@@ -0,0 +1,151 @@
+package m
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule defines recurring weekly time ranges.
+//
+// A schedule consists of entries separated by ";". Each entry has days and
+// an optional time range, eg. "weekdays 09:00-17:00; sat 10:00-14:00".
+// Days are "daily", "weekdays", "weekends", or day names ("mon", "tue", ...)
+// separated by "," or as range, eg. "mon-thu". Ranges that end before they
+// start continue on the next day, eg. "fri 22:00-02:00".
+// Times are interpreted in the location of the checked time.
+type Schedule struct {
+	spec    string
+	entries []scheduleEntry
+}
+
+type scheduleEntry struct {
+	days  [7]bool
+	start int // Minutes since midnight.
+	end   int // Minutes since midnight, may be 24:00.
+}
+
+// ErrInvalidSchedule is returned when a schedule cannot be parsed.
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseSchedule parses the given schedule.
+func ParseSchedule(spec string) (*Schedule, error) {
+	s := &Schedule{spec: strings.TrimSpace(spec)}
+	for _, entrySpec := range strings.Split(s.spec, ";") {
+		entry, err := parseScheduleEntry(strings.ToLower(strings.TrimSpace(entrySpec)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidSchedule, strings.TrimSpace(entrySpec), err)
+		}
+		s.entries = append(s.entries, entry)
+	}
+	return s, nil
+}
+
+func parseScheduleEntry(spec string) (entry scheduleEntry, err error) {
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		entry.end = 24 * 60
+	case 2:
+		startSpec, endSpec, ok := strings.Cut(fields[1], "-")
+		if !ok {
+			return entry, errors.New("time range must be like 09:00-17:00")
+		}
+		if entry.start, err = parseScheduleTime(startSpec); err != nil {
+			return entry, err
+		}
+		if entry.end, err = parseScheduleTime(endSpec); err != nil {
+			return entry, err
+		}
+		if entry.start == entry.end {
+			return entry, errors.New("time range is empty")
+		}
+	default:
+		return entry, errors.New("entry must consist of days and an optional time range")
+	}
+
+	// Parse days.
+	switch fields[0] {
+	case "daily":
+		entry.days = [7]bool{true, true, true, true, true, true, true}
+	case "weekdays":
+		entry.days = [7]bool{false, true, true, true, true, true, false}
+	case "weekends":
+		entry.days = [7]bool{true, false, false, false, false, false, true}
+	default:
+		for _, daySpec := range strings.Split(fields[0], ",") {
+			fromSpec, toSpec, isRange := strings.Cut(daySpec, "-")
+			from, ok := scheduleDays[fromSpec]
+			if !ok {
+				return entry, fmt.Errorf("unknown day %q", fromSpec)
+			}
+			to := from
+			if isRange {
+				to, ok = scheduleDays[toSpec]
+				if !ok {
+					return entry, fmt.Errorf("unknown day %q", toSpec)
+				}
+			}
+			for day := from; ; day = (day + 1) % 7 {
+				entry.days[day] = true
+				if day == to {
+					break
+				}
+			}
+		}
+	}
+
+	return entry, nil
+}
+
+func parseScheduleTime(spec string) (int, error) {
+	if spec == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", spec)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", spec)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active returns whether the schedule is active at the given time.
+func (s *Schedule) Active(t time.Time) bool {
+	day := t.Weekday()
+	prevDay := (day + 6) % 7
+	minute := t.Hour()*60 + t.Minute()
+
+	for _, entry := range s.entries {
+		if entry.start < entry.end {
+			if entry.days[day] && minute >= entry.start && minute < entry.end {
+				return true
+			}
+			continue
+		}
+
+		// Range continues on the next day.
+		if entry.days[day] && minute >= entry.start {
+			return true
+		}
+		if entry.days[prevDay] && minute < entry.end {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the schedule as defined.
+func (s *Schedule) String() string {
+	return s.spec
+}
@@ -0,0 +1,56 @@
+package m
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	t.Parallel()
+
+	// 2024-01-01 is a Monday.
+	at := func(day int, clock string) time.Time {
+		ts, err := time.Parse("2006-01-02 15:04", fmt.Sprintf("2024-01-%02d %s", day, clock))
+		require.NoError(t, err)
+		return ts
+	}
+	mon, fri, sat, sun := 1, 5, 6, 7
+
+	s, err := ParseSchedule("weekdays 09:00-17:00; sat 10:00-14:00")
+	require.NoError(t, err)
+	assert.True(t, s.Active(at(mon, "09:00")))
+	assert.True(t, s.Active(at(fri, "16:59")))
+	assert.False(t, s.Active(at(fri, "17:00")))
+	assert.False(t, s.Active(at(mon, "08:59")))
+	assert.True(t, s.Active(at(sat, "12:00")))
+	assert.False(t, s.Active(at(sun, "12:00")))
+
+	// Ranges continue on the next day.
+	s, err = ParseSchedule("fri-sat 22:00-02:00")
+	require.NoError(t, err)
+	assert.True(t, s.Active(at(fri, "23:00")))
+	assert.True(t, s.Active(at(sat, "01:59")))
+	assert.False(t, s.Active(at(fri, "01:00")), "thursday night is not scheduled")
+	assert.True(t, s.Active(at(sun, "01:00")))
+	assert.False(t, s.Active(at(sun, "02:00")))
+
+	// Day lists and ranges over the week end.
+	_, err = ParseSchedule("mon,wed sat-sun")
+	require.Error(t, err, "two day fields")
+	s, err = ParseSchedule("sat-mon")
+	require.NoError(t, err)
+	assert.True(t, s.Active(at(sun, "00:00")))
+	assert.True(t, s.Active(at(mon, "23:59")))
+	assert.False(t, s.Active(at(fri, "12:00")))
+	assert.Equal(t, "sat-mon", s.String())
+
+	// Invalid schedules.
+	for _, spec := range []string{"", "someday", "mon 9-17", "mon 25:00-26:00", "mon 10:00-10:00", "mon 10:00"} {
+		_, err := ParseSchedule(spec)
+		require.ErrorIs(t, err, ErrInvalidSchedule, spec)
+	}
+}
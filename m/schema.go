@@ -0,0 +1,62 @@
+package m
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Control messages, such as the peering handshake, ping headers and
+// announcements, are CBOR maps with short keys. In order to never break
+// existing routers when adding fields, these rules apply:
+//
+//   - New fields are optional (omitempty) and use a new key.
+//   - Routers ignore fields they do not know.
+//   - Keys are never reused or change their type or meaning.
+//   - Incompatible changes increase the schema version of the message.
+//     Routers refuse messages with a schema version newer than they support.
+//   - A missing schema version is version 1, as sent by routers before
+//     schema versioning was introduced.
+//
+// Optional features are better signaled with Capabilities, as they do not
+// need a new schema version.
+
+// Schema versions of the control messages.
+const (
+	SchemaVersionPeering  uint8 = 1
+	SchemaVersionPing     uint8 = 1
+	SchemaVersionAnnounce uint8 = 1
+)
+
+// ErrUnsupportedSchema is returned when a control message has a schema version
+// that is not supported.
+var ErrUnsupportedSchema = errors.New("unsupported message schema version")
+
+var controlMsgDecMode = func() cbor.DecMode {
+	decMode, err := cbor.DecOptions{
+		// Ignore fields of newer routers.
+		ExtraReturnErrors: cbor.ExtraDecErrorNone,
+		// Keys are short and must match exactly.
+		FieldNameMatching: cbor.FieldNameMatchingCaseSensitive,
+	}.DecMode()
+	if err != nil {
+		panic(fmt.Sprintf("invalid control message decoding options: %s", err))
+	}
+	return decMode
+}()
+
+// UnmarshalControlMsg decodes a control message into v.
+// Unknown fields are ignored.
+func UnmarshalControlMsg(data []byte, v any) error {
+	return controlMsgDecMode.Unmarshal(data, v)
+}
+
+// CheckSchemaVersion checks if the schema version of a received control
+// message is supported. A missing version (0) is treated as version 1.
+func CheckSchemaVersion(version, supported uint8) error {
+	if version > supported {
+		return fmt.Errorf("%w: %d (supported up to %d)", ErrUnsupportedSchema, version, supported)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package m
+
+import (
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, CheckSchemaVersion(0, 1), "missing version should be version 1")
+	assert.NoError(t, CheckSchemaVersion(1, 1))
+	assert.ErrorIs(t, CheckSchemaVersion(2, 1), ErrUnsupportedSchema)
+}
+
+func TestUnmarshalControlMsg(t *testing.T) {
+	t.Parallel()
+
+	type oldMsg struct {
+		Name string `cbor:"n,omitempty"`
+	}
+	type newMsg struct {
+		SchemaVersion uint8        `cbor:"sv,omitempty"`
+		Name          string       `cbor:"n,omitempty"`
+		Capabilities  Capabilities `cbor:"cap,omitempty"`
+		Metrics       []int        `cbor:"met,omitempty"`
+	}
+
+	// New messages must decode on old routers.
+	data, err := cbor.Marshal(&newMsg{
+		SchemaVersion: 1,
+		Name:          "test",
+		Capabilities:  CapFEC | 1<<42,
+		Metrics:       []int{1, 2, 3},
+	})
+	require.NoError(t, err)
+	old := &oldMsg{}
+	require.NoError(t, UnmarshalControlMsg(data, old))
+	assert.Equal(t, "test", old.Name)
+
+	// Old messages must decode on new routers.
+	data, err = cbor.Marshal(old)
+	require.NoError(t, err)
+	msg := &newMsg{}
+	require.NoError(t, UnmarshalControlMsg(data, msg))
+	assert.Equal(t, &newMsg{Name: "test"}, msg)
+	assert.NoError(t, CheckSchemaVersion(msg.SchemaVersion, 1))
+
+	// Keys must match exactly.
+	data, err = cbor.Marshal(map[string]any{"N": "other"})
+	require.NoError(t, err)
+	old = &oldMsg{}
+	require.NoError(t, UnmarshalControlMsg(data, old))
+	assert.Empty(t, old.Name)
+}
@@ -0,0 +1,235 @@
+package m
+
+import (
+	"container/list"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// Signature verifier defaults.
+const (
+	DefaultSigCacheSize = 4096
+	DefaultSigCacheTTL  = 10 * time.Minute
+)
+
+// ErrInvalidSignature is returned when a signature is invalid.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// SigCheck is a signature to be verified.
+type SigCheck struct {
+	PublicKey ed25519.PublicKey
+	Data      []byte
+	Sig       []byte
+	// Context is the signing context. If empty, plain Ed25519 is used.
+	Context []byte
+}
+
+// SigBatchError is returned when a signature of a batch is invalid.
+type SigBatchError struct {
+	// Index is the index of the first invalid signature in the batch.
+	Index int
+}
+
+func (e *SigBatchError) Error() string {
+	return fmt.Sprintf("%s at index %d", ErrInvalidSignature, e.Index)
+}
+
+// Unwrap returns ErrInvalidSignature.
+func (e *SigBatchError) Unwrap() error {
+	return ErrInvalidSignature
+}
+
+// SigVerifier verifies Ed25519 signatures and caches successful verifications
+// by public key and hash of the signed data, so that the same signature is
+// only verified once. This happens a lot with announcements, which arrive
+// over multiple peers and share the signatures of the first hops.
+//
+// Batches are checked against the cache first, so that only new signatures
+// are verified. This reduces CPU spikes when hundreds of announcements arrive
+// at once, eg. after reconnecting. Ed25519 batch verification is not used, as
+// it checks the cofactored equation and may accept signatures that single
+// verification rejects. Routers must always agree on whether a signature is
+// valid.
+//
+// Failed verifications are never cached, so that invalid signatures cannot
+// block valid ones. A nil verifier verifies without caching.
+type SigVerifier struct {
+	ttl  time.Duration
+	size int
+
+	entries map[sigCacheKey]*list.Element
+	lru     *list.List
+	lock    sync.Mutex
+
+	hits     atomic.Uint64
+	verified atomic.Uint64
+	failed   atomic.Uint64
+}
+
+type sigCacheKey [32]byte
+
+type sigCacheEntry struct {
+	key     sigCacheKey
+	expires time.Time
+}
+
+// SigVerifierStats holds statistics of the signature verifier.
+type SigVerifierStats struct {
+	Entries int
+	Size    int
+	// Hits counts signatures that were found in the cache.
+	Hits uint64
+	// Verified counts signatures that were verified.
+	Verified uint64
+	// Failed counts invalid signatures.
+	Failed uint64
+}
+
+// NewSigVerifier returns a new signature verifier.
+// If size is zero or negative, caching is disabled.
+func NewSigVerifier(size int, ttl time.Duration) *SigVerifier {
+	return &SigVerifier{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[sigCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Verify verifies the given signature.
+func (v *SigVerifier) Verify(check SigCheck) error {
+	if v.cached(check) {
+		return nil
+	}
+	return v.verify(check)
+}
+
+// VerifyBatch verifies all given signatures. If any signature is invalid, a
+// *SigBatchError is returned.
+func (v *SigVerifier) VerifyBatch(checks []SigCheck) error {
+	for i, check := range checks {
+		if err := v.Verify(check); err != nil {
+			return &SigBatchError{Index: i}
+		}
+	}
+	return nil
+}
+
+// Stats returns the verifier statistics.
+func (v *SigVerifier) Stats() SigVerifierStats {
+	if v == nil {
+		return SigVerifierStats{}
+	}
+
+	v.lock.Lock()
+	entries := v.lru.Len()
+	v.lock.Unlock()
+
+	return SigVerifierStats{
+		Entries:  entries,
+		Size:     v.size,
+		Hits:     v.hits.Load(),
+		Verified: v.verified.Load(),
+		Failed:   v.failed.Load(),
+	}
+}
+
+// verify verifies the signature and caches the result, if valid.
+func (v *SigVerifier) verify(check SigCheck) error {
+	err := ed25519.VerifyWithOptions(
+		check.PublicKey, check.Data, check.Sig,
+		&ed25519.Options{Context: string(check.Context)},
+	)
+	if v == nil {
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	v.verified.Add(1)
+	if err != nil {
+		v.failed.Add(1)
+		return ErrInvalidSignature
+	}
+	v.set(makeSigCacheKey(check))
+	return nil
+}
+
+// cached returns whether the signature was already successfully verified.
+func (v *SigVerifier) cached(check SigCheck) bool {
+	if v == nil || v.size <= 0 {
+		return false
+	}
+	key := makeSigCacheKey(check)
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	elem, ok := v.entries[key]
+	if !ok {
+		return false
+	}
+	entry := elem.Value.(*sigCacheEntry) //nolint:forcetypeassert // Only entries are in the list.
+
+	// Remove expired entry.
+	if time.Now().After(entry.expires) {
+		v.lru.Remove(elem)
+		delete(v.entries, key)
+		return false
+	}
+
+	v.lru.MoveToFront(elem)
+	v.hits.Add(1)
+	return true
+}
+
+func (v *SigVerifier) set(key sigCacheKey) {
+	if v == nil || v.size <= 0 {
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	entry := &sigCacheEntry{
+		key:     key,
+		expires: time.Now().Add(v.ttl),
+	}
+
+	// Update existing entry.
+	if elem, ok := v.entries[key]; ok {
+		elem.Value = entry
+		v.lru.MoveToFront(elem)
+		return
+	}
+
+	// Evict least recently used entries.
+	for v.lru.Len() >= v.size {
+		oldest := v.lru.Back()
+		v.lru.Remove(oldest)
+		delete(v.entries, oldest.Value.(*sigCacheEntry).key) //nolint:forcetypeassert // Only entries are in the list.
+	}
+
+	v.entries[key] = v.lru.PushFront(entry)
+}
+
+// makeSigCacheKey derives the cache key from all parts of the signature
+// check. Variable length parts are length prefixed.
+func makeSigCacheKey(check SigCheck) (key sigCacheKey) {
+	h := blake3.New()
+	var lenBuf [8]byte
+	for _, part := range [][]byte{check.PublicKey, check.Context, check.Data, check.Sig} {
+		PutUint64(lenBuf[:], uint64(len(part)))
+		_, _ = h.Write(lenBuf[:])
+		_, _ = h.Write(part)
+	}
+	copy(key[:], h.Sum(nil))
+	return key
+}
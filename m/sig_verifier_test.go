@@ -0,0 +1,178 @@
+package m
+
+import (
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"testing"
+	"time"
+
+	"filippo.io/edwards25519"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigVerifier(t *testing.T) {
+	t.Parallel()
+
+	addr, _, err := GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	sigContext := []byte("test context")
+	makeCheck := func(i int) SigCheck {
+		t.Helper()
+
+		data := []byte(fmt.Sprintf("message %d", i))
+		sig, err := addr.SignWithContext(data, sigContext)
+		require.NoError(t, err)
+		return SigCheck{
+			PublicKey: addr.PublicKey,
+			Data:      data,
+			Sig:       sig,
+			Context:   sigContext,
+		}
+	}
+
+	v := NewSigVerifier(10, time.Minute)
+
+	// Valid signatures are verified once.
+	check := makeCheck(0)
+	require.NoError(t, v.Verify(check))
+	require.NoError(t, v.Verify(check))
+	stats := v.Stats()
+	assert.Equal(t, uint64(1), stats.Verified)
+	assert.Equal(t, uint64(1), stats.Hits)
+
+	// Invalid signatures are never cached.
+	invalid := makeCheck(1)
+	invalid.Context = []byte("other context")
+	assert.ErrorIs(t, v.Verify(invalid), ErrInvalidSignature)
+	assert.ErrorIs(t, v.Verify(invalid), ErrInvalidSignature)
+	require.NoError(t, v.Verify(makeCheck(1)))
+	stats = v.Stats()
+	assert.Equal(t, uint64(4), stats.Verified)
+	assert.Equal(t, uint64(2), stats.Failed)
+	assert.Equal(t, 2, stats.Entries)
+
+	// Batches report the first invalid signature.
+	checks := make([]SigCheck, 20)
+	for i := range checks {
+		checks[i] = makeCheck(i)
+	}
+	require.NoError(t, v.VerifyBatch(checks))
+	assert.Equal(t, 10, v.Stats().Entries, "cache should be limited")
+
+	checks[7].Sig = checks[8].Sig
+	checks[13].Sig = checks[14].Sig
+	var batchErr *SigBatchError
+	err = v.VerifyBatch(checks)
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 7, batchErr.Index)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Batches may mix keys and contexts.
+	other, _, err := GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	checks = checks[:6]
+	for i := range checks {
+		checks[i] = makeCheck(100 + i)
+	}
+	checks[2].PublicKey = other.PublicKey
+	checks[2].Sig = other.Sign(checks[2].Data)
+	checks[2].Context = nil
+	checks[4].PublicKey = other.PublicKey
+	checks[4].Sig, err = other.SignWithContext(checks[4].Data, []byte("other context"))
+	checks[4].Context = []byte("other context")
+	require.NoError(t, err)
+	require.NoError(t, v.VerifyBatch(checks))
+
+	// Batch verification must fail with any invalid part.
+	for _, modify := range []func(check *SigCheck){
+		func(check *SigCheck) { check.Data = []byte("modified") },
+		func(check *SigCheck) { check.Context = []byte("modified") },
+		func(check *SigCheck) { check.PublicKey = addr.PublicKey },
+		func(check *SigCheck) { check.Sig = checks[3].Sig },
+		func(check *SigCheck) { check.Sig = check.Sig[:63] },
+	} {
+		modified := append([]SigCheck(nil), checks...)
+		modify(&modified[4])
+		err = NewSigVerifier(0, 0).VerifyBatch(modified)
+		require.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 4, batchErr.Index)
+	}
+
+	// Verifying without verifier works, but without caching.
+	var noVerifier *SigVerifier
+	require.NoError(t, noVerifier.Verify(check))
+	require.NoError(t, noVerifier.VerifyBatch(checks))
+	checks[3].Sig = checks[1].Sig
+	err = noVerifier.VerifyBatch(checks)
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 3, batchErr.Index)
+	assert.Equal(t, SigVerifierStats{}, noVerifier.Stats())
+}
+
+func TestSigVerifierSmallOrder(t *testing.T) {
+	t.Parallel()
+
+	addr, _, err := GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	data := []byte("message")
+
+	// Sign with a small order component in R: The owner of the key can create
+	// signatures that satisfy the cofactored equation, but not the
+	// cofactorless one of single verification.
+	torsion, err := new(edwards25519.Point).SetBytes(
+		[]byte("\xc7\x17\x6a\x70\x3d\x4d\xd8\x4f\xba\x3c\x0b\x76\x0d\x10\x67\x0f" +
+			"\x2a\x20\x53\xfa\x2c\x39\xcc\xc6\x4e\xc7\xfd\x77\x92\xac\x03\x7a"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 0, torsion.Equal(edwards25519.NewIdentityPoint()))
+	require.Equal(t, 1, new(edwards25519.Point).MultByCofactor(torsion).Equal(edwards25519.NewIdentityPoint()))
+	seedHash := sha512.Sum512(addr.PrivateKey.Seed())
+	a := edwards25519.NewScalar().SetBytesWithClamping(seedHash[:32])
+	nonceHash := sha512.Sum512(data)
+	r := edwards25519.NewScalar().SetUniformBytes(nonceHash[:])
+	rPoint := new(edwards25519.Point).Add(new(edwards25519.Point).ScalarBaseMult(r), torsion)
+	kHash := sha512.New()
+	_, _ = kHash.Write(rPoint.Bytes())
+	_, _ = kHash.Write(addr.PublicKey)
+	_, _ = kHash.Write(data)
+	k := edwards25519.NewScalar().SetUniformBytes(kHash.Sum(nil))
+	check := SigCheck{
+		PublicKey: addr.PublicKey,
+		Data:      data,
+		Sig:       append(rPoint.Bytes(), edwards25519.NewScalar().MultiplyAdd(k, a, r).Bytes()...),
+	}
+
+	// Neither single nor batch verification may accept or cache it.
+	v := NewSigVerifier(10, time.Minute)
+	assert.ErrorIs(t, v.VerifyBatch([]SigCheck{check, check, check, check}), ErrInvalidSignature)
+	assert.ErrorIs(t, v.Verify(check), ErrInvalidSignature)
+	assert.Equal(t, 0, v.Stats().Entries)
+}
+
+func BenchmarkSigVerifier(b *testing.B) {
+	addr, _, err := GeneratePrivacyAddress(context.Background())
+	require.NoError(b, err)
+	checks := make([]SigCheck, 100)
+	for i := range checks {
+		data := []byte(fmt.Sprintf("message %d", i))
+		checks[i] = SigCheck{
+			PublicKey: addr.PublicKey,
+			Data:      data,
+			Sig:       addr.Sign(data),
+		}
+	}
+
+	b.Run("Uncached", func(b *testing.B) {
+		for range b.N {
+			_ = NewSigVerifier(0, 0).VerifyBatch(checks)
+		}
+	})
+	b.Run("Cached", func(b *testing.B) {
+		v := NewSigVerifier(DefaultSigCacheSize, DefaultSigCacheTTL)
+		for range b.N {
+			_ = v.VerifyBatch(checks)
+		}
+	})
+}
@@ -45,14 +45,24 @@ type SwitchLabel uint16
 
 // NextRotateSwitchBlock extracts the next switch label and rotates the block
 // so it can be reversed by the destination.
+// It is called for every relayed frame and must not allocate.
 func NextRotateSwitchBlock(block []byte, returnLabel SwitchLabel) (nextHop SwitchLabel, err error) {
 	// Read next hop varint switch label.
-	next, bytesRead := binary.Uvarint(block)
-	if bytesRead <= 0 {
-		if bytesRead == 0 {
-			return 0, ErrBufTooSmall
+	// Routable switch labels fit into a single byte, so take a shortcut.
+	var (
+		next      uint64
+		bytesRead int
+	)
+	if len(block) > 0 && block[0] <= MaxRoutableSwitchLabel {
+		next, bytesRead = uint64(block[0]), 1
+	} else {
+		next, bytesRead = binary.Uvarint(block)
+		if bytesRead <= 0 {
+			if bytesRead == 0 {
+				return 0, ErrBufTooSmall
+			}
+			return 0, ErrValueTooBig
 		}
-		return 0, ErrValueTooBig
 	}
 
 	// Move data to front, clear the rest.
@@ -60,38 +70,39 @@ func NextRotateSwitchBlock(block []byte, returnLabel SwitchLabel) (nextHop Switc
 	clear(block[n:])
 
 	// Search for the second zero, this is where the return label needs to be put.
+	// Blocks are only a few bytes long, where a plain loop is faster than a
+	// vectorized search.
 	var (
 		seenFirstZero    = next == 0      // If the next hop is zero, this counts as a seen zero.
 		returnLabelStart = len(block) - 1 // Default is last byte.
 	)
-blockScan:
-	for i := 0; i < len(block); i++ {
-		switch {
-		case block[i] != 0:
-			// continue
-		case !seenFirstZero:
-			seenFirstZero = true
-		default:
+	for i, b := range block {
+		if b != 0 {
+			continue
+		}
+		if seenFirstZero {
 			returnLabelStart = i
-			break blockScan
+			break
 		}
+		seenFirstZero = true
 	}
 
 	// Add return label at correct position and reverse it.
-	labelSlot := block[returnLabelStart : returnLabelStart+returnLabel.EncodedSize()]
-	binary.PutUvarint(labelSlot, uint64(returnLabel))
-	slices.Reverse[[]byte, byte](labelSlot)
-
-	if returnLabel > 0 {
-		for i := 0; i < len(labelSlot); i++ {
-			if labelSlot[i] == 0 {
-				panic(returnLabel)
-			}
+	// Encoded non-zero labels never contain a zero byte.
+	size := returnLabel.EncodedSize()
+	if returnLabelStart+size > len(block) {
+		return 0, ErrBufTooSmall
+	}
+	if size == 1 {
+		block[returnLabelStart] = byte(returnLabel)
+	} else {
+		var encoded [binary.MaxVarintLen16]byte
+		binary.PutUvarint(encoded[:], uint64(returnLabel))
+		for i := range size {
+			block[returnLabelStart+i] = encoded[size-1-i]
 		}
 	}
 
-	// fmt.Printf("new block: %+v\n", block)
-
 	return SwitchLabel(next), nil
 }
 
@@ -223,6 +234,18 @@ func (sp *SwitchPath) CalculateBlockSize() (int, error) {
 	// size -= 1
 }
 
+// HasLoop returns whether a router is in the switch path more than once.
+func (sp *SwitchPath) HasLoop() bool {
+	for i, hop := range sp.Hops {
+		for _, other := range sp.Hops[i+1:] {
+			if hop.Router == other.Router {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // CalculateTotals calculates the total values of the switch path.
 func (sp *SwitchPath) CalculateTotals() {
 	// Calculate the total actual hops.
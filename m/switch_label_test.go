@@ -281,3 +281,49 @@ func testDeriveLabel(t *testing.T, ip string, expectedLabel SwitchLabel) {
 		assert.Equalf(t, expectedLabel, label, "derived label does not match expected label for %s", addr)
 	}
 }
+
+func TestSwitchPathHasLoop(t *testing.T) {
+	t.Parallel()
+
+	a := netip.MustParseAddr("fd00::a")
+	b := netip.MustParseAddr("fd00::b")
+	c := netip.MustParseAddr("fd00::c")
+
+	sp := SwitchPath{Hops: []SwitchHop{{Router: a}, {Router: b}, {Router: c}}}
+	assert.False(t, sp.HasLoop(), "distinct routers must not loop")
+
+	sp.Hops = append(sp.Hops, SwitchHop{Router: b})
+	assert.True(t, sp.HasLoop(), "repeated router must loop")
+}
+
+func BenchmarkNextRotateSwitchBlock(b *testing.B) {
+	sp := &SwitchPath{
+		Hops: []SwitchHop{
+			{ForwardLabel: 67, ReturnLabel: 0},
+			{ForwardLabel: 1, ReturnLabel: 3},
+			{ForwardLabel: 123, ReturnLabel: 3},
+			{ForwardLabel: 15, ReturnLabel: 128},
+			{ForwardLabel: 0, ReturnLabel: 16383},
+		},
+	}
+	if err := sp.BuildBlocks(); err != nil {
+		b.Fatal(err)
+	}
+	block := slices.Clone(sp.ForwardBlock)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Traverse the full path.
+		for j := 0; ; j++ {
+			nextHop, err := NextRotateSwitchBlock(block, sp.Hops[j].ReturnLabel)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if nextHop == 0 {
+				break
+			}
+		}
+		copy(block, sp.ForwardBlock)
+	}
+}
@@ -18,6 +18,16 @@ type RoutingTable struct {
 
 	cfg     RoutingTableConfig
 	entries []*RoutingTableEntry
+
+	// holdDowns holds the withdrawal time of routers that are held down.
+	holdDowns map[netip.Addr]holdDown
+}
+
+type holdDown struct {
+	withdrawn time.Time
+	until     time.Time
+	// returned is set when the router announced itself after the withdrawal.
+	returned bool
 }
 
 // RoutingTableConfig holds the configuration for a routing table.
@@ -28,8 +38,33 @@ type RoutingTableConfig struct {
 
 	// RouterIP is ip address of router of the routing table.
 	RouterIP netip.Addr
+
+	// Clock is used for entry expiry. Defaults to the system clock.
+	Clock Clock
+
+	// MaxEntries limits the total amount of entries. When the table is full,
+	// only existing entries are replaced. Routes to peers are always added.
+	// Zero means unlimited.
+	MaxEntries int
+
+	// NextHopWeights biases route selection toward (positive) or away from
+	// (negative) routes through the given next hops. Weights are counted in
+	// hops and do not apply to routes to the next hop itself.
+	NextHopWeights map[netip.Addr]int
+
+	// HoldDown defines how long routes to and via a withdrawn router are not
+	// re-learned from announcements older than the withdrawal.
+	// Defaults to DefaultRouteHoldDown. Negative disables hold-down.
+	HoldDown time.Duration
 }
 
+// DefaultRouteHoldDown is the default hold-down duration of withdrawn routers.
+const DefaultRouteHoldDown = 2 * time.Minute
+
+// ErrRouteHeldDown is returned when a route is not added, because it includes
+// a router that is held down and the announcement is older than the withdrawal.
+var ErrRouteHeldDown = errors.New("route is held down")
+
 // RoutablePrefix configures how routing entries of a defined base prefix should be handled.
 type RoutablePrefix struct {
 	// BasePrefix is the prefix for which these settings should apply.
@@ -45,8 +80,16 @@ type RoutablePrefix struct {
 	// EntriesPerPrefix defines how many routing entries to keep per
 	// identical routing prefix.
 	EntriesPerPrefix int
+
+	// RoutesPerDestination defines how many routes to keep per destination.
+	// Defaults to DefaultRoutesPerDestination.
+	// Routes from direct peers are always kept.
+	RoutesPerDestination int
 }
 
+// DefaultRoutesPerDestination is the default amount of routes kept per destination.
+const DefaultRoutesPerDestination = 3
+
 // RoutingTableEntry represents an entry in the routing table.
 // All fields must be treated as constants.
 type RoutingTableEntry struct {
@@ -59,6 +102,20 @@ type RoutingTableEntry struct {
 
 	Source  RouteSource
 	Expires time.Time
+	// Learned is when the route was first added to the table.
+	// It is set by the routing table.
+	Learned time.Time
+	// Announced is when the route was announced by the destination.
+	// It is used to check if the route is newer than a withdrawal.
+	Announced time.Time
+
+	// DelayPenalty is added to the total delay of the path in order to
+	// de-prioritize the route, eg. when a router on the path is suspicious.
+	// In milliseconds.
+	DelayPenalty uint16
+	// Implausible is set when the path has delays that are too low for the
+	// distance between the geo markers on the path.
+	Implausible bool
 }
 
 // RouteSource is the source of a route.
@@ -86,8 +143,9 @@ const (
 func NewRoutingTable(cfg RoutingTableConfig) *RoutingTable {
 	// Create new table with initial sizes.
 	rt := &RoutingTable{
-		cfg:     cfg,
-		entries: make([]*RoutingTableEntry, 0, 128),
+		cfg:       cfg,
+		entries:   make([]*RoutingTableEntry, 0, 128),
+		holdDowns: make(map[netip.Addr]holdDown),
 	}
 
 	// Apply defaults.
@@ -97,6 +155,12 @@ func NewRoutingTable(cfg RoutingTableConfig) *RoutingTable {
 			RoutingBits: ContinentPrefixBits,
 		}}
 	}
+	if rt.cfg.Clock == nil {
+		rt.cfg.Clock = SystemClock
+	}
+	if rt.cfg.HoldDown == 0 {
+		rt.cfg.HoldDown = DefaultRouteHoldDown
+	}
 
 	return rt
 }
@@ -111,7 +175,7 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 
 	// Apply defaults from routable prefix.
 	if rp.EntryTTL > 0 && entry.Source != RouteSourcePeer {
-		ttlExpiry := time.Now().Add(rp.EntryTTL)
+		ttlExpiry := rt.cfg.Clock.Now().Add(rp.EntryTTL)
 		if entry.Expires.IsZero() || ttlExpiry.Before(entry.Expires) {
 			entry.Expires = ttlExpiry
 		}
@@ -141,18 +205,21 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 		return false, errors.New("routing prefix is invalid/missing")
 	case entry.Source != RouteSourcePeer && len(entry.Path.Hops) < 2:
 		return false, errors.New("missing or incomplete switch path")
+	case entry.Path.HasLoop():
+		return false, errors.New("switch path contains a router more than once")
 	}
 
 	// Check expiry. Be graceful with routers that have time lag.
 	if entry.Source != RouteSourcePeer {
+		now := rt.cfg.Clock.Now()
 		switch {
 		case entry.Expires.IsZero():
 			return false, errors.New("missing expiration")
-		case time.Since(entry.Expires) > time.Hour:
+		case now.Sub(entry.Expires) > time.Hour:
 			return false, errors.New("already expired")
-		case time.Until(entry.Expires) < 10*time.Minute:
+		case entry.Expires.Sub(now) < 10*time.Minute:
 			// Raise expire to at least 10 minutes.
-			entry.Expires = time.Now().Add(10 * time.Minute)
+			entry.Expires = now.Add(10 * time.Minute)
 		}
 	}
 
@@ -162,11 +229,24 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 		return false, fmt.Errorf("failed to build switch blocks: %w", err)
 	}
 	entry.Path.CalculateTotals()
+	if entry.DelayPenalty > 0 {
+		entry.Path.TotalDelay = uint16(min(
+			uint(entry.Path.TotalDelay)+uint(entry.DelayPenalty),
+			65534, // Leave spare for "max" searches.
+		))
+	}
 
 	// Lock table for inserting new route.
 	rt.lock.Lock()
 	defer rt.lock.Unlock()
 
+	// Do not re-learn withdrawn routes from stale announcements.
+	if entry.Source != RouteSourcePeer && rt.isHeldDown(&entry) {
+		return false, ErrRouteHeldDown
+	}
+	rt.markReturned(&entry)
+	entry.Learned = rt.cfg.Clock.Now()
+
 	// Get destination section.
 	start, end := rt.getDstSection(entry.DstIP)
 	if start >= end {
@@ -178,7 +258,8 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 	// Check if we have this exact route already.
 	for i := start; i < end; i++ {
 		if rt.entries[i].RouteEquals(&entry) {
-			// Replace entry.
+			// Replace entry, but keep when it was first learned.
+			entry.Learned = rt.entries[i].Learned
 			rt.entries[i] = &entry
 			// Sort section.
 			slices.SortFunc[[]*RoutingTableEntry, *RoutingTableEntry](
@@ -192,8 +273,9 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 
 	// We have a new route for a known destination.
 
-	// If we don't have 3 routes to this destination yet, add it.
-	if end-start < 3 || entry.Source == RouteSourcePeer {
+	// If we don't have enough routes to this destination yet, add it.
+	maxRoutes := rp.routesPerDestination()
+	if (end-start < maxRoutes && !rt.isFull()) || entry.Source == RouteSourcePeer {
 		// Get insert index.
 		insertIndex, _ := slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, *RoutingTableEntry](
 			rt.entries,
@@ -207,10 +289,10 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 		return true, nil
 	}
 
-	// Check if the entry is good enough to make it into the top 3.
-	if rt.stdSort(&entry, rt.entries[start+2]) < 0 {
-		// Replace third entry.
-		rt.entries[start+2] = &entry
+	// Check if the entry is good enough to make it into the top routes.
+	if rt.stdSort(&entry, rt.entries[start+maxRoutes-1]) < 0 {
+		// Replace last entry.
+		rt.entries[start+maxRoutes-1] = &entry
 		// Sort section.
 		slices.SortFunc[[]*RoutingTableEntry, *RoutingTableEntry](
 			rt.entries[start:end],
@@ -225,6 +307,11 @@ func (rt *RoutingTable) AddRoute(entry RoutingTableEntry) (added bool, err error
 }
 
 func (rt *RoutingTable) addNewDestination(entry RoutingTableEntry, rp RoutablePrefix) (added bool, err error) { //nolint:unparam // Makes usage easier.
+	// Check if the table is full.
+	if entry.Source != RouteSourcePeer && rt.isFull() {
+		return false, nil
+	}
+
 	// Gossip routes are limited per prefix, check the limit.
 	if entry.Source == RouteSourceGossip {
 		// Get prefix section.
@@ -250,6 +337,116 @@ func (rt *RoutingTable) addNewDestination(entry RoutingTableEntry, rp RoutablePr
 	return true, nil
 }
 
+// isHeldDown returns whether the route includes a router that is held down.
+// Routes to a held down router are only added if they were announced after
+// the router was withdrawn. Routes without an announcement time cannot be
+// compared and are accepted. Routes via a held down router are rejected until
+// the router returned, as their announcement time is from the clock of the
+// destination, not the one of the withdrawn router.
+// Must be called with the lock held.
+func (rt *RoutingTable) isHeldDown(entry *RoutingTableEntry) bool {
+	if len(rt.holdDowns) == 0 {
+		return false
+	}
+
+	now := rt.cfg.Clock.Now()
+	hd, ok := rt.holdDowns[entry.DstIP]
+	if ok && now.Before(hd.until) &&
+		!entry.Announced.IsZero() && !entry.Announced.After(hd.withdrawn) {
+		return true
+	}
+	// The first hop is this router and the last hop the destination.
+	if len(entry.Path.Hops) > 2 {
+		for _, hop := range entry.Path.Hops[1 : len(entry.Path.Hops)-1] {
+			if hd, ok := rt.holdDowns[hop.Router]; ok && now.Before(hd.until) && !hd.returned {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markReturned marks the destination of the route as returned, if it is held
+// down and the route shows that it is back: It is a direct peer or announced
+// itself after the withdrawal. Routes via the router are accepted again.
+// Must be called with the lock held.
+func (rt *RoutingTable) markReturned(entry *RoutingTableEntry) {
+	hd, ok := rt.holdDowns[entry.DstIP]
+	if ok && !hd.returned &&
+		(entry.Source == RouteSourcePeer || entry.Announced.After(hd.withdrawn)) {
+		hd.returned = true
+		rt.holdDowns[entry.DstIP] = hd
+	}
+}
+
+// HoldDown holds down the given router after it was withdrawn at the given
+// time: For the configured hold-down duration, routes to the router are only
+// added if they were announced after the withdrawal, and routes via the router
+// only after it returned. This prevents re-learning withdrawn routes from
+// slow peers replaying stale gossip.
+// Routes from direct peers are not affected.
+func (rt *RoutingTable) HoldDown(router netip.Addr, withdrawn time.Time) {
+	if rt.cfg.HoldDown < 0 {
+		return
+	}
+
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	// Only ever move the withdrawal time forward.
+	var returned bool
+	if hd, ok := rt.holdDowns[router]; ok && !withdrawn.After(hd.withdrawn) {
+		withdrawn = hd.withdrawn
+		returned = hd.returned
+	}
+	rt.holdDowns[router] = holdDown{
+		withdrawn: withdrawn,
+		until:     rt.cfg.Clock.Now().Add(rt.cfg.HoldDown),
+		returned:  returned,
+	}
+}
+
+// RouteHoldDown describes a router that is held down.
+type RouteHoldDown struct {
+	Router    netip.Addr
+	Withdrawn time.Time
+	Until     time.Time
+}
+
+// HoldDowns returns the routers that are currently held down.
+func (rt *RoutingTable) HoldDowns() []RouteHoldDown {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	return rt.exportHoldDowns()
+}
+
+// exportHoldDowns returns the active hold-downs, sorted by router.
+// Must be called with the lock held.
+func (rt *RoutingTable) exportHoldDowns() []RouteHoldDown {
+	now := rt.cfg.Clock.Now()
+	holdDowns := make([]RouteHoldDown, 0, len(rt.holdDowns))
+	for router, hd := range rt.holdDowns {
+		if now.Before(hd.until) {
+			holdDowns = append(holdDowns, RouteHoldDown{
+				Router:    router,
+				Withdrawn: hd.withdrawn,
+				Until:     hd.until,
+			})
+		}
+	}
+	slices.SortFunc(holdDowns, func(a, b RouteHoldDown) int {
+		return a.Router.Compare(b.Router)
+	})
+	return holdDowns
+}
+
+// isFull returns whether the table reached the maximum amount of entries.
+// Must be called with the lock held.
+func (rt *RoutingTable) isFull() bool {
+	return rt.cfg.MaxEntries > 0 && len(rt.entries) >= rt.cfg.MaxEntries
+}
+
 func (rt *RoutingTable) getDstSection(dst netip.Addr) (startIndex, endIndex int) {
 	// Find start index.
 	startIndex, _ = slices.BinarySearchFunc[[]*RoutingTableEntry, *RoutingTableEntry, *RoutingTableEntry](
@@ -310,6 +507,35 @@ func (rt *RoutingTable) getPrefixSection(prefix netip.Prefix) (startIndex, endIn
 	return
 }
 
+// CountRoutes returns the amount of routes to the given destination.
+func (rt *RoutingTable) CountRoutes(dst netip.Addr) int {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	start, end := rt.getDstSection(dst)
+	return max(end-start, 0)
+}
+
+// Size returns the total amount of entries in the routing table.
+func (rt *RoutingTable) Size() int {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	return len(rt.entries)
+}
+
+// Export returns a copy of all routing table entries.
+func (rt *RoutingTable) Export() []RoutingTableEntry {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	export := make([]RoutingTableEntry, 0, len(rt.entries))
+	for _, rte := range rt.entries {
+		export = append(export, *rte)
+	}
+	return export
+}
+
 // LookupNearest returns the best matching table entry for the given destination.
 func (rt *RoutingTable) LookupNearest(dst netip.Addr) (rte *RoutingTableEntry, isDestination bool) {
 	rt.lock.RLock()
@@ -551,6 +777,65 @@ func (rt *RoutingTable) RemoveNextHop(ip netip.Addr) (removed int) {
 	return
 }
 
+// RemoveTransit removes all routes via the given next hop, except the route
+// to the next hop itself.
+func (rt *RoutingTable) RemoveTransit(nextHop netip.Addr) (removed int) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	rt.entries = slices.DeleteFunc[[]*RoutingTableEntry, *RoutingTableEntry](
+		rt.entries,
+		func(rte *RoutingTableEntry) bool {
+			if rte.NextHop == nextHop && rte.DstIP != nextHop {
+				removed++
+				return true
+			}
+			return false
+		},
+	)
+
+	return
+}
+
+// RemoveRoute removes the route to the given destination via the given next
+// hop from the routing table.
+func (rt *RoutingTable) RemoveRoute(dst, nextHop netip.Addr) (removed int) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	rt.entries = slices.DeleteFunc[[]*RoutingTableEntry, *RoutingTableEntry](
+		rt.entries,
+		func(rte *RoutingTableEntry) bool {
+			if rte.DstIP == dst && rte.NextHop == nextHop {
+				removed++
+				return true
+			}
+			return false
+		},
+	)
+
+	return
+}
+
+// RemoveSource removes all routes with the given source from the routing table.
+func (rt *RoutingTable) RemoveSource(source RouteSource) (removed int) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	rt.entries = slices.DeleteFunc[[]*RoutingTableEntry, *RoutingTableEntry](
+		rt.entries,
+		func(rte *RoutingTableEntry) bool {
+			if rte.Source == source {
+				removed++
+				return true
+			}
+			return false
+		},
+	)
+
+	return
+}
+
 // RemoveDisconnected removes all routes with the given disconnected peerings.
 // If disconnected is empty, all routes including the router are removed.
 func (rt *RoutingTable) RemoveDisconnected(router netip.Addr, disconnected []netip.Addr) (removed int) {
@@ -618,15 +903,70 @@ func (rt *RoutingTable) RemoveDisconnected(router netip.Addr, disconnected []net
 	return removed
 }
 
+// ExpiringRoutes returns copies of all routes with the given source that
+// expire before the given time.
+func (rt *RoutingTable) ExpiringRoutes(source RouteSource, before time.Time) []RoutingTableEntry {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	var expiring []RoutingTableEntry
+	for _, rte := range rt.entries {
+		if rte.Source == source && rte.Expires.Before(before) {
+			expiring = append(expiring, *rte)
+		}
+	}
+	return expiring
+}
+
+// RefreshRoute resets the expiry of the (non-peer) routes to the given
+// destination via the given next hop, as if they were just added.
+func (rt *RoutingTable) RefreshRoute(dst, nextHop netip.Addr) (refreshed int) {
+	rp, ok := rt.getRoutablePrefixConfig(dst)
+	if !ok {
+		return 0
+	}
+
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	// Apply the same expiry as when adding the route.
+	now := rt.cfg.Clock.Now()
+	expires := now.Add(10 * time.Minute)
+	if rp.EntryTTL > 0 {
+		expires = now.Add(max(rp.EntryTTL, 10*time.Minute))
+	}
+
+	for i, rte := range rt.entries {
+		if rte.DstIP == dst && rte.NextHop == nextHop &&
+			rte.Source != RouteSourcePeer && rte.Expires.Before(expires) {
+			// Entries are treated as constants, replace with updated copy.
+			updated := *rte
+			updated.Expires = expires
+			rt.entries[i] = &updated
+			refreshed++
+		}
+	}
+
+	return refreshed
+}
+
 // Clean cleans the routing table from unneeded entries:
 // - Removes expired routes.
 // - Removes excess routes of identical routing prefixes.
+// - Removes finished hold-downs.
 func (rt *RoutingTable) Clean() {
 	rt.lock.Lock()
 	defer rt.lock.Unlock()
 
+	// Remove finished hold-downs.
+	now := rt.cfg.Clock.Now()
+	for router, hd := range rt.holdDowns {
+		if !now.Before(hd.until) {
+			delete(rt.holdDowns, router)
+		}
+	}
+
 	// Removes expired (non-peer) routes.
-	now := time.Now()
 	rt.entries = slices.DeleteFunc[[]*RoutingTableEntry, *RoutingTableEntry](
 		rt.entries,
 		func(rte *RoutingTableEntry) bool {
@@ -712,9 +1052,9 @@ func (rt *RoutingTable) stdSort(a, b *RoutingTableEntry) int {
 		// Sort by destination IP.
 		return a.DstIP.Compare(b.DstIP)
 
-	case a.Path.TotalHops != b.Path.TotalHops:
-		// Sort by hop distance to dst.
-		return int(a.Path.TotalHops) - int(b.Path.TotalHops)
+	case rt.weightedHops(a) != rt.weightedHops(b):
+		// Sort by hop distance to dst, biased by next hop weights.
+		return rt.weightedHops(a) - rt.weightedHops(b)
 
 	case a.Path.TotalDelay != b.Path.TotalDelay:
 		// Sort by latency to dst.
@@ -735,6 +1075,24 @@ func (rt *RoutingTable) stdSort(a, b *RoutingTableEntry) int {
 	return 0
 }
 
+// SetNextHopWeights replaces the next hop weights and re-sorts the routes.
+func (rt *RoutingTable) SetNextHopWeights(weights map[netip.Addr]int) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	rt.cfg.NextHopWeights = weights
+	rt.sortForRouting()
+}
+
+// weightedHops returns the hop distance of the route, biased by the weight
+// of its next hop.
+func (rt *RoutingTable) weightedHops(rte *RoutingTableEntry) int {
+	if rte.NextHop == rte.DstIP {
+		return int(rte.Path.TotalHops)
+	}
+	return int(rte.Path.TotalHops) - rt.cfg.NextHopWeights[rte.NextHop]
+}
+
 // RouteEquals returns whether the routes match.
 func (a *RoutingTableEntry) RouteEquals(b *RoutingTableEntry) bool {
 	// Check metadata.
@@ -775,6 +1133,8 @@ func (rt *RoutingTable) Format() string {
 	var (
 		b        = &strings.Builder{}
 		previous *RoutingTableEntry
+		lastDst  netip.Addr
+		now      = rt.cfg.Clock.Now()
 	)
 	for i, rte := range rt.entries {
 		if previous == nil || rte.RoutingPrefix != previous.RoutingPrefix {
@@ -782,6 +1142,22 @@ func (rt *RoutingTable) Format() string {
 			fmt.Fprintln(b, formatPrefix(rte.RoutingPrefix))
 		}
 
+		// Show amount of alternative routes on the first route of a destination.
+		alt := ""
+		if rte.DstIP != lastDst {
+			lastDst = rte.DstIP
+			var routes int
+			for _, next := range rt.entries[i:] {
+				if next.DstIP != rte.DstIP {
+					break
+				}
+				routes++
+			}
+			if routes > 1 {
+				alt = fmt.Sprintf(" alt=%d", routes-1)
+			}
+		}
+
 		cc := "?"
 		if cml, _ := LookupCountryMarker(rte.DstIP); cml != nil {
 			cc = cml.Country
@@ -790,15 +1166,19 @@ func (rt *RoutingTable) Format() string {
 		if rte.Stub {
 			stub = " stub"
 		}
+		if rte.Implausible {
+			stub += " implausible"
+		}
 
 		switch {
 		case rte.Source == RouteSourcePeer:
-			fmt.Fprintf(b, "  %d: %s   %s cc=%s hops=%d lat=%dms%s\n", i+1,
-				rte.Source, rte.DstIP.StringExpanded(), cc, rte.Path.TotalHops, rte.Path.TotalDelay, stub,
+			fmt.Fprintf(b, "  %d: %s   %s cc=%s hops=%d lat=%dms age=%s%s%s\n", i+1,
+				rte.Source, rte.DstIP.StringExpanded(), cc, rte.Path.TotalHops, rte.Path.TotalDelay,
+				formatAge(now, rte.Learned), stub, alt,
 			)
 		default:
 			fmt.Fprintf(b,
-				"  %d: %s %s cc=%s hops=%d lat=%dms next=%x via=%s%s\n", i+1,
+				"  %d: %s %s cc=%s hops=%d lat=%dms next=%x via=%s age=%s exp=%s%s%s\n", i+1,
 				rte.Source,
 				rte.DstIP.StringExpanded(),
 				cc,
@@ -806,7 +1186,22 @@ func (rt *RoutingTable) Format() string {
 				rte.Path.TotalDelay,
 				rte.Path.Hops[0].ForwardLabel,
 				formatRelays(rte.Path.Hops),
+				formatAge(now, rte.Learned),
+				formatAge(rte.Expires, now),
 				stub,
+				alt,
+			)
+		}
+	}
+
+	// List held down routers.
+	if holdDowns := rt.exportHoldDowns(); len(holdDowns) > 0 {
+		fmt.Fprintln(b, "held down")
+		for _, hd := range holdDowns {
+			fmt.Fprintf(b, "  %s withdrawn=%s left=%s\n",
+				hd.Router.StringExpanded(),
+				hd.Withdrawn.Format(time.TimeOnly),
+				formatAge(hd.Until, now),
 			)
 		}
 	}
@@ -814,6 +1209,14 @@ func (rt *RoutingTable) Format() string {
 	return b.String()
 }
 
+// formatAge formats the duration between the given times in seconds.
+func formatAge(now, since time.Time) string {
+	if since.IsZero() {
+		return "?"
+	}
+	return now.Sub(since).Round(time.Second).String()
+}
+
 func formatPrefix(prefix netip.Prefix) string {
 	var info string
 	switch GetAddressType(prefix.Addr()) {
@@ -871,6 +1274,13 @@ func formatRelays(hops []SwitchHop) string {
 	return strings.Join(parts, ",")
 }
 
+func (rp RoutablePrefix) routesPerDestination() int {
+	if rp.RoutesPerDestination > 0 {
+		return rp.RoutesPerDestination
+	}
+	return DefaultRoutesPerDestination
+}
+
 func (rt *RoutingTable) getRoutablePrefixConfig(ip netip.Addr) (rp RoutablePrefix, ok bool) {
 	for _, rp = range rt.cfg.RoutablePrefixes {
 		if rp.BasePrefix.Contains(ip) {
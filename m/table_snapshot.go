@@ -0,0 +1,237 @@
+package m
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// TableSnapshotVersion is the current version of the routing table snapshot format.
+const TableSnapshotVersion = 1
+
+// TableSnapshot is a machine-readable snapshot of a routing table.
+// It is used to reproduce route selection offline, eg. from snapshots
+// provided by users.
+type TableSnapshot struct {
+	Version int        `cbor:"v,omitempty" json:"version"`
+	Router  netip.Addr `cbor:"r,omitempty" json:"router"`
+	Created time.Time  `cbor:"c,omitempty" json:"created"`
+
+	Prefixes []TableSnapshotPrefix `cbor:"p,omitempty" json:"prefixes,omitempty"`
+	// NextHopWeights holds the configured route preference weights.
+	NextHopWeights map[netip.Addr]int `cbor:"w,omitempty" json:"nextHopWeights,omitempty"`
+
+	Routes  []TableSnapshotRoute `cbor:"e,omitempty" json:"routes,omitempty"`
+	Metrics TableSnapshotMetrics `cbor:"m,omitempty" json:"metrics"`
+}
+
+// TableSnapshotPrefix is the config of a routable prefix of a table snapshot.
+type TableSnapshotPrefix struct {
+	BasePrefix           netip.Prefix  `cbor:"b,omitempty" json:"basePrefix"`
+	RoutingBits          int           `cbor:"r,omitempty" json:"routingBits,omitempty"`
+	EntryTTL             time.Duration `cbor:"t,omitempty" json:"entryTTL,omitempty"`
+	EntriesPerPrefix     int           `cbor:"e,omitempty" json:"entriesPerPrefix,omitempty"`
+	RoutesPerDestination int           `cbor:"d,omitempty" json:"routesPerDestination,omitempty"`
+}
+
+// TableSnapshotRoute is a route of a table snapshot.
+type TableSnapshotRoute struct {
+	DstIP         netip.Addr   `cbor:"d,omitempty" json:"dst"`
+	RoutingPrefix netip.Prefix `cbor:"p,omitempty" json:"routingPrefix"`
+	NextHop       netip.Addr   `cbor:"n,omitempty" json:"nextHop"`
+	Path          SwitchPath   `cbor:"h,omitempty" json:"path"`
+	Stub          bool         `cbor:"s,omitempty" json:"stub,omitempty"`
+	Source        string       `cbor:"o,omitempty" json:"source"`
+	Expires       time.Time    `cbor:"x,omitempty" json:"expires,omitempty"`
+	DelayPenalty  uint16       `cbor:"y,omitempty" json:"delayPenalty,omitempty"`
+	Implausible   bool         `cbor:"i,omitempty" json:"implausible,omitempty"`
+	Learned       time.Time    `cbor:"l,omitempty" json:"learned,omitempty"`
+	Announced     time.Time    `cbor:"a,omitempty" json:"announced,omitempty"`
+}
+
+// TableSnapshotMetrics holds metrics of a table snapshot.
+type TableSnapshotMetrics struct {
+	Routes       int            `cbor:"r,omitempty" json:"routes"`
+	Destinations int            `cbor:"d,omitempty" json:"destinations"`
+	NextHops     int            `cbor:"n,omitempty" json:"nextHops"`
+	Sources      map[string]int `cbor:"s,omitempty" json:"sources,omitempty"`
+	// AvgDelay is the average total delay of all routes in milliseconds.
+	AvgDelay int `cbor:"a,omitempty" json:"avgDelay"`
+	// AvgHops is the average amount of hops of all routes.
+	AvgHops float64 `cbor:"h,omitempty" json:"avgHops"`
+}
+
+// Snapshot returns a snapshot of the routing table.
+func (rt *RoutingTable) Snapshot() *TableSnapshot {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	snap := &TableSnapshot{
+		Version:  TableSnapshotVersion,
+		Router:   rt.cfg.RouterIP,
+		Created:  rt.cfg.Clock.Now(),
+		Prefixes: make([]TableSnapshotPrefix, 0, len(rt.cfg.RoutablePrefixes)),
+		Routes:   make([]TableSnapshotRoute, 0, len(rt.entries)),
+
+		NextHopWeights: rt.cfg.NextHopWeights,
+	}
+	for _, rp := range rt.cfg.RoutablePrefixes {
+		snap.Prefixes = append(snap.Prefixes, TableSnapshotPrefix{
+			BasePrefix:           rp.BasePrefix,
+			RoutingBits:          rp.RoutingBits,
+			EntryTTL:             rp.EntryTTL,
+			EntriesPerPrefix:     rp.EntriesPerPrefix,
+			RoutesPerDestination: rp.RoutesPerDestination,
+		})
+	}
+	for _, rte := range rt.entries {
+		snap.Routes = append(snap.Routes, TableSnapshotRoute{
+			DstIP:         rte.DstIP,
+			RoutingPrefix: rte.RoutingPrefix,
+			NextHop:       rte.NextHop,
+			Path:          rte.Path,
+			Stub:          rte.Stub,
+			Source:        rte.Source.String(),
+			Expires:       rte.Expires,
+			DelayPenalty:  rte.DelayPenalty,
+			Implausible:   rte.Implausible,
+			Learned:       rte.Learned,
+			Announced:     rte.Announced,
+		})
+	}
+	snap.Metrics = snap.calculateMetrics()
+
+	return snap
+}
+
+func (snap *TableSnapshot) calculateMetrics() TableSnapshotMetrics {
+	metrics := TableSnapshotMetrics{
+		Routes:  len(snap.Routes),
+		Sources: make(map[string]int),
+	}
+	dsts := make(map[netip.Addr]struct{})
+	nextHops := make(map[netip.Addr]struct{})
+	var totalDelay, totalHops int
+	for _, route := range snap.Routes {
+		dsts[route.DstIP] = struct{}{}
+		nextHops[route.NextHop] = struct{}{}
+		metrics.Sources[route.Source]++
+		totalDelay += int(route.Path.TotalDelay)
+		totalHops += int(route.Path.TotalHops)
+	}
+	metrics.Destinations = len(dsts)
+	metrics.NextHops = len(nextHops)
+	if len(snap.Routes) > 0 {
+		metrics.AvgDelay = totalDelay / len(snap.Routes)
+		metrics.AvgHops = float64(totalHops) / float64(len(snap.Routes))
+	}
+	return metrics
+}
+
+// ParseTableSnapshot parses a table snapshot in the JSON or CBOR format.
+func ParseTableSnapshot(data []byte) (*TableSnapshot, error) {
+	snap := &TableSnapshot{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, snap); err != nil {
+			return nil, fmt.Errorf("parse json snapshot: %w", err)
+		}
+	} else if err := cbor.Unmarshal(data, snap); err != nil {
+		return nil, fmt.Errorf("parse cbor snapshot: %w", err)
+	}
+
+	switch {
+	case snap.Version == 0:
+		return nil, errors.New("missing snapshot version")
+	case snap.Version > TableSnapshotVersion:
+		return nil, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	case !snap.Router.IsValid():
+		return nil, errors.New("missing router IP")
+	}
+	return snap, nil
+}
+
+// NewRoutingTableFromSnapshot returns a routing table with the config and
+// routes of the snapshot. Routes are restored as they were and are not
+// checked like added routes.
+// If no clock is given, a virtual clock at the creation time of the snapshot
+// is used. Otherwise, route expiry is shifted to the current time of the clock.
+func NewRoutingTableFromSnapshot(snap *TableSnapshot, clock Clock) (*RoutingTable, error) {
+	var shift time.Duration
+	if clock == nil {
+		clock = NewVirtualClock(snap.Created)
+	} else {
+		shift = clock.Now().Sub(snap.Created)
+	}
+
+	cfg := RoutingTableConfig{
+		RoutablePrefixes: make([]RoutablePrefix, 0, len(snap.Prefixes)),
+		RouterIP:         snap.Router,
+		Clock:            clock,
+		NextHopWeights:   snap.NextHopWeights,
+	}
+	for _, p := range snap.Prefixes {
+		cfg.RoutablePrefixes = append(cfg.RoutablePrefixes, RoutablePrefix{
+			BasePrefix:           p.BasePrefix,
+			RoutingBits:          p.RoutingBits,
+			EntryTTL:             p.EntryTTL,
+			EntriesPerPrefix:     p.EntriesPerPrefix,
+			RoutesPerDestination: p.RoutesPerDestination,
+		})
+	}
+	rt := NewRoutingTable(cfg)
+
+	for i, route := range snap.Routes {
+		source, err := parseRouteSource(route.Source)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		switch {
+		case !route.DstIP.IsValid():
+			return nil, fmt.Errorf("route %d: dst ip is invalid/missing", i)
+		case !route.NextHop.IsValid():
+			return nil, fmt.Errorf("route %d: next hop is invalid/missing", i)
+		case !route.RoutingPrefix.IsValid():
+			return nil, fmt.Errorf("route %d: routing prefix is invalid/missing", i)
+		}
+
+		rte := &RoutingTableEntry{
+			DstIP:         route.DstIP,
+			RoutingPrefix: route.RoutingPrefix,
+			NextHop:       route.NextHop,
+			Path:          route.Path,
+			Stub:          route.Stub,
+			Source:        source,
+			DelayPenalty:  route.DelayPenalty,
+			Implausible:   route.Implausible,
+			Announced:     route.Announced,
+		}
+		if !route.Expires.IsZero() {
+			rte.Expires = route.Expires.Add(shift)
+		}
+		if !route.Learned.IsZero() {
+			rte.Learned = route.Learned.Add(shift)
+		}
+		rt.entries = append(rt.entries, rte)
+	}
+	rt.sortForRouting()
+
+	return rt, nil
+}
+
+func parseRouteSource(s string) (RouteSource, error) {
+	switch s {
+	case RouteSourcePeer.String():
+		return RouteSourcePeer, nil
+	case RouteSourceGossip.String():
+		return RouteSourceGossip, nil
+	case RouteSourceDiscovered.String():
+		return RouteSourceDiscovered, nil
+	default:
+		return RouteSourceUnknown, fmt.Errorf("unknown route source %q", s)
+	}
+}
@@ -0,0 +1,84 @@
+package m
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableSnapshot(t *testing.T) {
+	t.Parallel()
+
+	clock := NewVirtualClock(time.Now())
+	weighted := makeRandomAddress(RoutingAddressPrefix)
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
+		RouterIP:         myIP,
+		Clock:            clock,
+		NextHopWeights:   map[netip.Addr]int{weighted: 2},
+	})
+	for i := range 20 {
+		ip := makeRandomAddress(RoutingAddressPrefix)
+		nextHop := ip
+		if i%2 == 0 {
+			nextHop = weighted
+		}
+		_, err := tbl.AddRoute(RoutingTableEntry{
+			DstIP:   ip,
+			NextHop: nextHop,
+			Path:    makeRandomSwitchPath(ip, 1, 3),
+			Source:  RouteSourceGossip,
+			Expires: clock.Now().Add(1 * time.Hour),
+		})
+		require.NoError(t, err)
+	}
+	snap := tbl.Snapshot()
+	assert.Equal(t, tbl.Size(), snap.Metrics.Routes)
+	assert.Equal(t, tbl.Size(), snap.Metrics.Sources["gossip"])
+
+	// Round trip through both formats.
+	jsonData, err := json.Marshal(snap)
+	require.NoError(t, err)
+	cborData, err := cbor.Marshal(snap)
+	require.NoError(t, err)
+	for _, data := range [][]byte{jsonData, cborData} {
+		parsed, err := ParseTableSnapshot(data)
+		require.NoError(t, err)
+		assert.Equal(t, snap.Metrics, parsed.Metrics)
+		assert.Equal(t, snap.NextHopWeights, parsed.NextHopWeights)
+
+		// Restore the table and compare lookups.
+		restored, err := NewRoutingTableFromSnapshot(parsed, nil)
+		require.NoError(t, err)
+		assert.True(t, parsed.Created.Equal(restored.cfg.Clock.Now()))
+		for range 100 {
+			dst := makeRandomAddress(RoutingAddressPrefix)
+			want, _ := tbl.LookupNearestRoute(dst)
+			got, _ := restored.LookupNearestRoute(dst)
+			require.NotNil(t, got)
+			assert.Equal(t, want.DstIP, got.DstIP)
+			assert.Equal(t, want.NextHop, got.NextHop)
+			assert.Equal(t, want.Path.TotalDelay, got.Path.TotalDelay)
+		}
+	}
+
+	// Expiry is shifted to the given clock.
+	later := NewVirtualClock(snap.Created.Add(24 * time.Hour))
+	restored, err := NewRoutingTableFromSnapshot(snap, later)
+	require.NoError(t, err)
+	for i, rte := range restored.Export() {
+		assert.True(t, rte.Expires.After(later.Now()), "route %d must not be expired", i)
+	}
+
+	// Reject unsupported versions.
+	snap.Version = TableSnapshotVersion + 1
+	data, err := json.Marshal(snap)
+	require.NoError(t, err)
+	_, err = ParseTableSnapshot(data)
+	assert.Error(t, err)
+}
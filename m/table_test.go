@@ -9,6 +9,7 @@ import (
 
 	"github.com/brianvoe/gofakeit"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -235,6 +236,326 @@ func TestTable(t *testing.T) { //nolint:maintidx
 	}
 }
 
+func TestTableMaxEntries(t *testing.T) {
+	t.Parallel()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
+		RouterIP:         myIP,
+		MaxEntries:       10,
+	})
+
+	// Fill table.
+	addRoute := func(ip netip.Addr, source RouteSource) (bool, error) {
+		return tbl.AddRoute(RoutingTableEntry{
+			DstIP:   ip,
+			NextHop: ip,
+			Path:    makeRandomSwitchPath(ip, 1, 3),
+			Source:  source,
+			Expires: time.Now().Add(1 * time.Hour),
+		})
+	}
+	for range 10 {
+		added, err := addRoute(makeRandomAddress(RoutingAddressPrefix), RouteSourceDiscovered)
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+	assert.Equal(t, 10, tbl.Size())
+
+	// New destinations must be rejected when full.
+	added, err := addRoute(makeRandomAddress(RoutingAddressPrefix), RouteSourceDiscovered)
+	require.NoError(t, err)
+	assert.False(t, added, "table is full")
+
+	// Peers must always be added.
+	added, err = addRoute(makeRandomAddress(myPrefix), RouteSourcePeer)
+	require.NoError(t, err)
+	assert.True(t, added, "peers must be added to full table")
+	assert.Equal(t, 11, tbl.Size())
+}
+
+func TestTableDelayPenalty(t *testing.T) {
+	t.Parallel()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
+		RouterIP:         myIP,
+	})
+
+	// Add two routes to the same destination, penalizing the faster one.
+	dst := makeRandomAddress(RoutingAddressPrefix)
+	addRoute := func(nextHop netip.Addr, delay, penalty uint16) {
+		t.Helper()
+
+		added, err := tbl.AddRoute(RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: nextHop,
+			Path: SwitchPath{Hops: []SwitchHop{
+				{Router: myIP, Delay: delay, ForwardLabel: 1},
+				{Router: nextHop, Delay: delay, ForwardLabel: 2, ReturnLabel: 1},
+				{Router: dst, ReturnLabel: 2},
+			}},
+			Source:       RouteSourceGossip,
+			Expires:      time.Now().Add(1 * time.Hour),
+			DelayPenalty: penalty,
+		})
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+	fast := makeRandomAddress(RoutingAddressPrefix)
+	slow := makeRandomAddress(RoutingAddressPrefix)
+	addRoute(fast, 10, 100)
+	addRoute(slow, 20, 0)
+
+	// The penalty must survive recalculating the totals.
+	rte, _ := tbl.LookupNearestRoute(dst)
+	require.NotNil(t, rte)
+	assert.Equal(t, slow, rte.NextHop, "penalized route must not be preferred")
+	assert.Equal(t, uint16(20+20+MinHopDelay), rte.Path.TotalDelay)
+}
+
+func TestTableNextHopWeights(t *testing.T) {
+	t.Parallel()
+
+	fiber := makeRandomAddress(myPrefix)
+	metered := makeRandomAddress(myPrefix)
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
+		RouterIP:         myIP,
+		NextHopWeights: map[netip.Addr]int{
+			fiber:   1,
+			metered: -1,
+		},
+	})
+	addRoute := func(dst netip.Addr, path ...netip.Addr) {
+		t.Helper()
+
+		hops := make([]SwitchHop, 0, len(path)+2)
+		hops = append(hops, SwitchHop{Router: myIP, Delay: 10, ForwardLabel: 1})
+		for i, relay := range path {
+			hops = append(hops, SwitchHop{Router: relay, Delay: 10, ForwardLabel: SwitchLabel(i + 2), ReturnLabel: SwitchLabel(i + 1)})
+		}
+		hops = append(hops, SwitchHop{Router: dst, ReturnLabel: SwitchLabel(len(path) + 1)})
+		source := RouteSourceGossip
+		nextHop := dst
+		if len(path) > 0 {
+			nextHop = path[0]
+		} else {
+			source = RouteSourcePeer
+		}
+		added, err := tbl.AddRoute(RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: nextHop,
+			Path:    SwitchPath{Hops: hops},
+			Source:  source,
+			Expires: time.Now().Add(1 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+
+	// The route through the preferred peer wins, even with one more hop.
+	dst := makeRandomAddress(RoutingAddressPrefix)
+	addRoute(dst, metered)
+	addRoute(dst, fiber, makeRandomAddress(RoutingAddressPrefix))
+	rte, _ := tbl.LookupNearestRoute(dst)
+	require.NotNil(t, rte)
+	assert.Equal(t, fiber, rte.NextHop, "route through preferred peer must be used")
+
+	// The negative weight does not apply to the direct route to the peer.
+	addRoute(metered)
+	addRoute(metered, fiber)
+	rte, _ = tbl.LookupNearestRoute(metered)
+	require.NotNil(t, rte)
+	assert.Equal(t, metered, rte.NextHop, "direct route to peer must be used")
+
+	// Changed weights apply to existing routes.
+	tbl.SetNextHopWeights(nil)
+	rte, _ = tbl.LookupNearestRoute(dst)
+	require.NotNil(t, rte)
+	assert.Equal(t, metered, rte.NextHop, "shorter route must be used without weights")
+}
+
+func TestTableRemoveTransit(t *testing.T) {
+	t.Parallel()
+
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
+		RouterIP:         myIP,
+	})
+	addRoute := func(dst netip.Addr, path ...netip.Addr) {
+		t.Helper()
+
+		hops := make([]SwitchHop, 0, len(path)+2)
+		hops = append(hops, SwitchHop{Router: myIP, Delay: 10, ForwardLabel: 1})
+		for i, relay := range path {
+			hops = append(hops, SwitchHop{Router: relay, Delay: 10, ForwardLabel: SwitchLabel(i + 2), ReturnLabel: SwitchLabel(i + 1)})
+		}
+		hops = append(hops, SwitchHop{Router: dst, ReturnLabel: SwitchLabel(len(path) + 1)})
+		source := RouteSourceGossip
+		nextHop := dst
+		if len(path) > 0 {
+			nextHop = path[0]
+		} else {
+			source = RouteSourcePeer
+		}
+		added, err := tbl.AddRoute(RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: nextHop,
+			Path:    SwitchPath{Hops: hops},
+			Source:  source,
+			Expires: time.Now().Add(1 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+
+	draining := makeRandomAddress(myPrefix)
+	other := makeRandomAddress(myPrefix)
+	dst := makeRandomAddress(RoutingAddressPrefix)
+	addRoute(draining)
+	addRoute(other)
+	addRoute(dst, draining)
+	addRoute(dst, other)
+	addRoute(other, draining)
+
+	// Only routes to other routers via the draining peer are removed.
+	assert.Equal(t, 2, tbl.RemoveTransit(draining))
+	assert.Equal(t, 1, tbl.CountRoutes(draining), "route to the peer itself must be kept")
+	assert.Equal(t, 1, tbl.CountRoutes(other))
+	rte, _ := tbl.LookupNearestRoute(dst)
+	require.NotNil(t, rte)
+	assert.Equal(t, other, rte.NextHop)
+}
+
+func TestTableHoldDown(t *testing.T) {
+	t.Parallel()
+
+	clock := NewVirtualClock(time.Now())
+	tbl := NewRoutingTable(RoutingTableConfig{
+		RoutablePrefixes: GetRoutablePrefixesFor(myIP, myPrefix),
+		RouterIP:         myIP,
+		Clock:            clock,
+	})
+
+	dst := makeRandomAddress(RoutingAddressPrefix)
+	relay := makeRandomAddress(RoutingAddressPrefix)
+	peer := makeRandomAddress(myPrefix)
+	addRoute := func(announced time.Time) (bool, error) {
+		return tbl.AddRoute(RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: peer,
+			Path: SwitchPath{Hops: []SwitchHop{
+				{Router: myIP, Delay: 10, ForwardLabel: 1},
+				{Router: peer, Delay: 10, ForwardLabel: 2, ReturnLabel: 1},
+				{Router: relay, Delay: 10, ForwardLabel: 3, ReturnLabel: 2},
+				{Router: dst, ReturnLabel: 3},
+			}},
+			Source:    RouteSourceGossip,
+			Expires:   clock.Now().Add(1 * time.Hour),
+			Announced: announced,
+		})
+	}
+
+	// Add route and check age.
+	announced := clock.Now()
+	added, err := addRoute(announced)
+	require.NoError(t, err)
+	require.True(t, added)
+	clock.Advance(time.Minute)
+	added, err = addRoute(clock.Now())
+	require.NoError(t, err)
+	require.True(t, added)
+	routes := tbl.Export()
+	require.Len(t, routes, 1)
+	assert.Equal(t, announced, routes[0].Learned, "learned time must be kept when replacing route")
+
+	// Withdraw the destination.
+	withdrawn := clock.Now()
+	assert.Equal(t, 1, tbl.RemoveDisconnected(dst, nil))
+	tbl.HoldDown(dst, withdrawn)
+	require.Len(t, tbl.HoldDowns(), 1)
+
+	// Stale announcements must be rejected.
+	_, err = addRoute(announced)
+	require.ErrorIs(t, err, ErrRouteHeldDown)
+	_, err = addRoute(withdrawn)
+	require.ErrorIs(t, err, ErrRouteHeldDown)
+	assert.Contains(t, tbl.Format(), dst.StringExpanded())
+
+	// Routes without announcement time cannot be compared.
+	added, err = addRoute(time.Time{})
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	// Fresh announcements must be accepted.
+	added, err = addRoute(withdrawn.Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	// Withdraw the relay, which has a clock that is ahead.
+	clock.Advance(time.Minute)
+	assert.Equal(t, 1, tbl.RemoveDisconnected(relay, nil))
+	relayWithdrawn := clock.Now().Add(time.Hour)
+	tbl.HoldDown(relay, relayWithdrawn)
+	_, err = addRoute(clock.Now())
+	require.ErrorIs(t, err, ErrRouteHeldDown, "routes via held down relays must be rejected")
+	_, err = addRoute(relayWithdrawn.Add(time.Second))
+	require.ErrorIs(t, err, ErrRouteHeldDown, "announcement time of the destination must not be compared to the relay")
+
+	// Routes via the relay are accepted once it announced itself again.
+	addRelayRoute := func(announced time.Time) (bool, error) {
+		return tbl.AddRoute(RoutingTableEntry{
+			DstIP:   relay,
+			NextHop: peer,
+			Path: SwitchPath{Hops: []SwitchHop{
+				{Router: myIP, Delay: 10, ForwardLabel: 1},
+				{Router: peer, Delay: 10, ForwardLabel: 2, ReturnLabel: 1},
+				{Router: relay, ReturnLabel: 2},
+			}},
+			Source:    RouteSourceGossip,
+			Expires:   clock.Now().Add(1 * time.Hour),
+			Announced: announced,
+		})
+	}
+	_, err = addRelayRoute(clock.Now())
+	require.ErrorIs(t, err, ErrRouteHeldDown)
+	_, err = addRoute(clock.Now())
+	require.ErrorIs(t, err, ErrRouteHeldDown, "stale announcements of the relay must not lift the hold-down")
+	added, err = addRelayRoute(relayWithdrawn.Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, added)
+	added, err = addRoute(clock.Now())
+	require.NoError(t, err)
+	assert.True(t, added)
+	tbl.HoldDown(relay, relayWithdrawn.Add(time.Minute))
+	_, err = addRoute(clock.Now())
+	require.ErrorIs(t, err, ErrRouteHeldDown, "a new withdrawal must hold down the relay again")
+
+	// Routes from peers are never held down.
+	tbl.HoldDown(peer, clock.Now())
+	added, err = tbl.AddRoute(RoutingTableEntry{
+		DstIP:   peer,
+		NextHop: peer,
+		Path: SwitchPath{Hops: []SwitchHop{
+			{Router: myIP, Delay: 10, ForwardLabel: 1},
+			{Router: peer, ReturnLabel: 1},
+		}},
+		Source: RouteSourcePeer,
+	})
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	// Hold-downs finish after the hold-down duration.
+	clock.Advance(DefaultRouteHoldDown)
+	assert.Empty(t, tbl.HoldDowns())
+	added, err = addRoute(announced)
+	require.NoError(t, err)
+	assert.True(t, added)
+	tbl.Clean()
+	assert.Empty(t, tbl.holdDowns)
+}
+
 func makeRandomAddress(prefix netip.Prefix) netip.Addr {
 	// Get random bytes.
 	var buf [16]byte
@@ -0,0 +1,233 @@
+package mgr
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxCrashReports defines how many crash reports are kept in the crash
+	// report directory. Older reports are deleted.
+	maxCrashReports = 10
+	// maxRecentEvents defines how many recent events are added to a crash
+	// report.
+	maxRecentEvents = 20
+
+	crashReportPrefix = "crash-"
+	crashReportSuffix = ".txt"
+)
+
+// ErrPanic is returned when a worker panicked.
+var ErrPanic = errors.New("panic")
+
+var (
+	crashReportDir atomic.Pointer[string]
+	crashCnt       atomic.Uint64
+
+	recentEvents     []recentEvent
+	recentEventsNext int
+	recentEventsLock sync.Mutex
+)
+
+type recentEvent struct {
+	time   time.Time
+	module string
+	event  string
+}
+
+// SetCrashReportDir sets the directory to write crash reports to.
+// Crash reports are only written if a directory is set.
+func SetCrashReportDir(dir string) {
+	crashReportDir.Store(&dir)
+}
+
+// CrashCount returns the amount of panics since start.
+func CrashCount() uint64 {
+	return crashCnt.Load()
+}
+
+// Guard executes the given function and recovers from a panic, which is
+// reported like a panic of the worker. Use it for operations that can safely
+// be skipped, eg. handling a single frame, so that a bad input does not kill
+// the worker.
+func (w *WorkerCtx) Guard(fn func() error) (err error) {
+	defer func() {
+		if panicVal := recover(); panicVal != nil {
+			var panicInfo string
+			panicInfo, err = w.handlePanic(panicVal)
+			w.Error(
+				"recovered from panic",
+				"err", err,
+				"file", panicInfo,
+			)
+		}
+	}()
+
+	return fn()
+}
+
+// handlePanic reports the given panic and returns it as an error, together
+// with the location of the panic in the code.
+func (w *WorkerCtx) handlePanic(panicVal any) (panicInfo string, err error) {
+	err = fmt.Errorf("%w: %s", ErrPanic, panicVal)
+	crashCnt.Add(1)
+
+	// Print panic to stderr.
+	stackTrace := string(debug.Stack())
+	fmt.Fprintf(
+		os.Stderr,
+		"===== PANIC =====\n%s\n\n%s=====  END  =====\n",
+		panicVal,
+		stackTrace,
+	)
+
+	// Find the line in the stack trace that refers to where the panic occurred.
+	stackLines := strings.Split(stackTrace, "\n")
+	foundPanic := false
+	for i, line := range stackLines {
+		if !foundPanic {
+			if strings.Contains(line, "panic(") {
+				foundPanic = true
+			}
+		} else {
+			if strings.Contains(line, "mycoria") {
+				if i+1 < len(stackLines) {
+					panicInfo = strings.SplitN(strings.TrimSpace(stackLines[i+1]), " ", 2)[0]
+				}
+				break
+			}
+		}
+	}
+
+	// Write crash report.
+	if path, writeErr := writeCrashReport(w.module, w.name, fmt.Sprint(panicVal), stackTrace); writeErr != nil {
+		w.Warn(
+			"failed to write crash report",
+			"err", writeErr,
+		)
+		// Stop trying when not permitted, eg. by AppArmor or SELinux.
+		// The panic is still printed to stderr.
+		if errors.Is(writeErr, os.ErrPermission) {
+			SetCrashReportDir("")
+			w.Warn("crash reports are disabled, as writing them is not permitted")
+		}
+	} else if path != "" {
+		w.Info(
+			"crash report written",
+			"path", path,
+		)
+	}
+
+	return panicInfo, err
+}
+
+// writeCrashReport writes a crash report to the crash report directory, if
+// set. Addresses are redacted, so that reports can be shared.
+func writeCrashReport(module, worker, panicMsg, stackTrace string) (path string, err error) {
+	dir := crashReportDir.Load()
+	if dir == nil || *dir == "" {
+		return "", nil
+	}
+
+	// Build report.
+	now := time.Now()
+	var report strings.Builder
+	fmt.Fprintf(&report, "time:   %s\n", now.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&report, "module: %s\n", module)
+	fmt.Fprintf(&report, "worker: %s\n", worker)
+	fmt.Fprintf(&report, "panic:  %s\n", redactAddresses(panicMsg))
+	fmt.Fprintf(&report, "\nstack:\n%s\n", redactAddresses(stackTrace))
+	fmt.Fprintf(&report, "recent events:\n")
+	for _, e := range getRecentEvents() {
+		fmt.Fprintf(&report, "%s %s: %s\n", e.time.UTC().Format(time.RFC3339), e.module, e.event)
+	}
+
+	// Write report.
+	if err := os.MkdirAll(*dir, 0o0750); err != nil {
+		return "", fmt.Errorf("create crash report dir: %w", err)
+	}
+	path = filepath.Join(
+		*dir,
+		crashReportPrefix+now.UTC().Format("20060102-150405.000000000")+crashReportSuffix,
+	)
+	if err := os.WriteFile(path, []byte(report.String()), 0o0640); err != nil {
+		return "", fmt.Errorf("write crash report: %w", err)
+	}
+
+	// Remove old reports.
+	removeOldCrashReports(*dir)
+
+	return path, nil
+}
+
+func removeOldCrashReports(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	// Reports are named by time and entries are sorted by name.
+	var reports []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), crashReportPrefix) &&
+			strings.HasSuffix(entry.Name(), crashReportSuffix) {
+			reports = append(reports, entry.Name())
+		}
+	}
+	for len(reports) > maxCrashReports {
+		_ = os.Remove(filepath.Join(dir, reports[0]))
+		reports = reports[1:]
+	}
+}
+
+var addressCandidate = regexp.MustCompile(`[0-9a-fA-F:.]{7,}`)
+
+// redactAddresses replaces all IP addresses in the given text.
+func redactAddresses(text string) string {
+	return addressCandidate.ReplaceAllStringFunc(text, func(s string) string {
+		trimmed := strings.Trim(s, ":.")
+		if _, err := netip.ParseAddr(trimmed); err == nil {
+			return strings.Replace(s, trimmed, "[redacted]", 1)
+		}
+		if ap, err := netip.ParseAddrPort(trimmed); err == nil {
+			return strings.Replace(s, ap.Addr().String(), "[redacted]", 1)
+		}
+		return s
+	})
+}
+
+// recordEvent records a submitted event for crash reports.
+func recordEvent(module, event string) {
+	recentEventsLock.Lock()
+	defer recentEventsLock.Unlock()
+
+	e := recentEvent{
+		time:   time.Now(),
+		module: module,
+		event:  event,
+	}
+	if len(recentEvents) < maxRecentEvents {
+		recentEvents = append(recentEvents, e)
+		return
+	}
+	recentEvents[recentEventsNext] = e
+	recentEventsNext = (recentEventsNext + 1) % maxRecentEvents
+}
+
+// getRecentEvents returns the recent events, oldest first.
+func getRecentEvents() []recentEvent {
+	recentEventsLock.Lock()
+	defer recentEventsLock.Unlock()
+
+	return slices.Concat(recentEvents[recentEventsNext:], recentEvents[:recentEventsNext])
+}
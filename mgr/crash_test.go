@@ -0,0 +1,99 @@
+package mgr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGuard is not parallel, as it changes the global crash report settings.
+func TestGuard(t *testing.T) {
+	dir := t.TempDir()
+	SetCrashReportDir(dir)
+	defer SetCrashReportDir("")
+
+	// Panics are recovered and returned as error.
+	crashes := CrashCount()
+	recordEvent("test", "before panic")
+	err := New("test").Do("guarded", func(w *WorkerCtx) error {
+		return w.Guard(func() error {
+			panic("failed to reach fd12:3456::1")
+		})
+	})
+	require.ErrorIs(t, err, ErrPanic)
+	assert.Equal(t, crashes+1, CrashCount())
+
+	// A redacted crash report is written.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	report, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "module: test\n")
+	assert.Contains(t, string(report), "worker: guarded\n")
+	assert.Contains(t, string(report), "panic:  failed to reach [redacted]\n")
+	assert.Contains(t, string(report), "test: before panic\n")
+	assert.NotContains(t, string(report), "fd12:3456::1")
+
+	// Errors are passed through.
+	err = New("test").Do("guarded", func(w *WorkerCtx) error {
+		return w.Guard(func() error {
+			return os.ErrNotExist
+		})
+	})
+	require.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, crashes+1, CrashCount())
+}
+
+func TestRemoveOldCrashReports(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for i := range maxCrashReports + 5 {
+		name := fmt.Sprintf("%s%02d%s", crashReportPrefix, i, crashReportSuffix)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o0600))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.txt"), nil, 0o0600))
+	removeOldCrashReports(dir)
+
+	// Only the newest reports and other files are kept.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, maxCrashReports+1)
+	assert.Equal(t, fmt.Sprintf("%s%02d%s", crashReportPrefix, 5, crashReportSuffix), entries[0].Name())
+	assert.Equal(t, "other.txt", entries[maxCrashReports].Name())
+}
+
+func TestRedactAddresses(t *testing.T) {
+	t.Parallel()
+
+	for text, redacted := range map[string]string{
+		"dial fd12:3456::1: refused":       "dial [redacted]: refused",
+		"from 192.0.2.1:47369 failed":      "from [redacted]:47369 failed",
+		"peer [fd12:3456::1]:47369 closed": "peer [[redacted]]:47369 closed",
+		"at ::1.":                          "at ::1.",
+		"main.go:123 +0x1a4":               "main.go:123 +0x1a4",
+		"goroutine 1234567 [running]":      "goroutine 1234567 [running]",
+	} {
+		assert.Equal(t, redacted, redactAddresses(text), text)
+	}
+}
+
+// TestRecentEvents is not parallel, as it changes the global recent events.
+func TestRecentEvents(t *testing.T) {
+	for i := range maxRecentEvents + 5 {
+		recordEvent("test", fmt.Sprint(i))
+	}
+
+	// Only the most recent events are kept, oldest first.
+	events := getRecentEvents()
+	require.Len(t, events, maxRecentEvents)
+	for i, e := range events {
+		assert.Equal(t, "test", e.module)
+		assert.Equal(t, fmt.Sprint(i+5), e.event)
+	}
+}
@@ -45,6 +45,16 @@ func NewEventMgr[T any](eventName string, mgr *Manager) *EventMgr[T] {
 	}
 }
 
+// SetManager sets the manager used for logging and executing callbacks.
+// Modules that may be restarted create their event managers once and set the
+// new manager on start, so that subscriptions survive restarts.
+func (em *EventMgr[T]) SetManager(mgr *Manager) {
+	em.lock.Lock()
+	defer em.lock.Unlock()
+
+	em.mgr = mgr
+}
+
 // Subscribe subscribes to events.
 // The received events are shared among all subscribers and callbacks.
 // Be sure to apply proper concurrency safeguards, if applicable.
@@ -81,6 +91,13 @@ func (em *EventMgr[T]) Submit(event T) {
 	em.lock.Lock()
 	defer em.lock.Unlock()
 
+	// Record event for crash reports.
+	if em.mgr != nil {
+		recordEvent(em.mgr.name, em.name)
+	} else {
+		recordEvent("", em.name)
+	}
+
 	var anyCanceled bool
 
 	// Send to subscriptions.
@@ -0,0 +1,157 @@
+package mgr
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Log levels can be set per module, so that a single subsystem can be
+// investigated without the volume of global debug logging. A module is
+// matched by its full name, its package or its type name, eg. "dns",
+// "switch" or "switchr.Switch". Managers created with New are matched by
+// their name.
+
+var (
+	defaultLogLevel    slog.LevelVar
+	moduleLogLevels    atomic.Pointer[map[string]slog.Level]
+	hasModuleLogLevels atomic.Bool
+	logLevelsLock      sync.Mutex
+)
+
+// DefaultLogLevel returns the log level used for modules without their own
+// log level.
+func DefaultLogLevel() slog.Level {
+	return defaultLogLevel.Level()
+}
+
+// SetDefaultLogLevel sets the log level used for modules without their own
+// log level.
+func SetDefaultLogLevel(level slog.Level) {
+	defaultLogLevel.Set(level)
+}
+
+// ModuleLogLevels returns a copy of all module log levels.
+func ModuleLogLevels() map[string]slog.Level {
+	levels := moduleLogLevels.Load()
+	if levels == nil {
+		return make(map[string]slog.Level)
+	}
+	return maps.Clone(*levels)
+}
+
+// SetModuleLogLevel sets the log level of the given module.
+func SetModuleLogLevel(module string, level slog.Level) {
+	updateModuleLogLevels(func(levels map[string]slog.Level) {
+		levels[strings.ToLower(module)] = level
+	})
+}
+
+// ResetModuleLogLevel removes the log level of the given module, so that the
+// default log level is used again.
+func ResetModuleLogLevel(module string) {
+	updateModuleLogLevels(func(levels map[string]slog.Level) {
+		delete(levels, strings.ToLower(module))
+	})
+}
+
+// SetModuleLogLevels replaces all module log levels.
+func SetModuleLogLevels(levels map[string]slog.Level) {
+	updateModuleLogLevels(func(current map[string]slog.Level) {
+		clear(current)
+		for module, level := range levels {
+			current[strings.ToLower(module)] = level
+		}
+	})
+}
+
+func updateModuleLogLevels(fn func(levels map[string]slog.Level)) {
+	logLevelsLock.Lock()
+	defer logLevelsLock.Unlock()
+
+	levels := ModuleLogLevels()
+	fn(levels)
+	moduleLogLevels.Store(&levels)
+	hasModuleLogLevels.Store(len(levels) > 0)
+}
+
+// LevelHandler is a slog.Handler that filters log records by the default log
+// level and the log levels of modules. The module of a logger is taken from
+// the "module" or "manager" attribute added by managers.
+type LevelHandler struct {
+	handler slog.Handler
+
+	// names holds the names the module of the logger is matched by.
+	names []string
+}
+
+var _ slog.Handler = &LevelHandler{}
+
+// NewLevelHandler returns a new level handler that passes enabled records on
+// to the given handler. The given handler should accept all levels.
+func NewLevelHandler(handler slog.Handler) *LevelHandler {
+	return &LevelHandler{handler: handler}
+}
+
+// Enabled reports whether the handler handles records at the given level.
+func (h *LevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level() && h.handler.Enabled(ctx, level)
+}
+
+func (h *LevelHandler) level() slog.Level {
+	// Skip loading the map when no module log levels are set.
+	if len(h.names) == 0 || !hasModuleLogLevels.Load() {
+		return defaultLogLevel.Level()
+	}
+
+	levels := moduleLogLevels.Load()
+	if levels != nil {
+		for _, name := range h.names {
+			if level, ok := (*levels)[name]; ok {
+				return level
+			}
+		}
+	}
+	return defaultLogLevel.Level()
+}
+
+// Handle handles the record.
+func (h *LevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new handler with the given attributes.
+func (h *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	names := h.names
+	for _, attr := range attrs {
+		if attr.Key == "module" || attr.Key == "manager" {
+			names = logModuleNames(attr.Value.String())
+		}
+	}
+	return &LevelHandler{
+		handler: h.handler.WithAttrs(attrs),
+		names:   names,
+	}
+}
+
+// WithGroup returns a new handler with the given group.
+func (h *LevelHandler) WithGroup(name string) slog.Handler {
+	return &LevelHandler{
+		handler: h.handler.WithGroup(name),
+		names:   h.names,
+	}
+}
+
+// logModuleNames returns the names a module is matched by, most specific
+// first.
+func logModuleNames(module string) []string {
+	module = strings.ToLower(module)
+	pkg, typeName, ok := strings.Cut(module, ".")
+	if !ok {
+		return []string{module}
+	}
+	return []string{module, typeName, pkg}
+}
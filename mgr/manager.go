@@ -3,6 +3,7 @@ package mgr
 import (
 	"context"
 	"log/slog"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -17,6 +18,9 @@ type Manager struct {
 
 	workerCnt   atomic.Int32
 	workersDone chan struct{}
+
+	workers     map[*WorkerCtx]struct{}
+	workersLock sync.Mutex
 }
 
 // New returns a new manager.
@@ -34,6 +38,7 @@ func newManager(ctx context.Context, name string, logNameKey string) *Manager {
 		name:        name,
 		logger:      slog.Default().With(logNameKey, name),
 		workersDone: make(chan struct{}),
+		workers:     make(map[*WorkerCtx]struct{}),
 	}
 	m.ctx, m.cancelCtx = context.WithCancel(ctx)
 	return m
@@ -162,3 +167,32 @@ func (m *Manager) workerDone() {
 		}
 	}
 }
+
+func (m *Manager) addWorker(w *WorkerCtx) {
+	m.workersLock.Lock()
+	defer m.workersLock.Unlock()
+
+	m.workers[w] = struct{}{}
+}
+
+func (m *Manager) removeWorker(w *WorkerCtx) {
+	m.workersLock.Lock()
+	defer m.workersLock.Unlock()
+
+	delete(m.workers, w)
+}
+
+// StuckWorkers returns all workers that have been busy for longer than the
+// given timeout.
+func (m *Manager) StuckWorkers(timeout time.Duration) []*WorkerCtx {
+	m.workersLock.Lock()
+	defer m.workersLock.Unlock()
+
+	var stuck []*WorkerCtx
+	for w := range m.workers {
+		if w.BusyFor() > timeout {
+			stuck = append(stuck, w)
+		}
+	}
+	return stuck
+}
@@ -5,13 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 )
 
+// ErrGroupStopping is returned when modules are started or stopped
+// individually while the group is stopping.
+var ErrGroupStopping = errors.New("module group is stopping")
+
 // Group describes a group of modules.
 type Group struct {
-	modules []*groupModule
+	modules     []*groupModule
+	modulesLock sync.Mutex
+	// stopping is set while and after the group is stopped, so that modules
+	// are not started or stopped individually anymore.
+	stopping bool
 
 	ctx       context.Context
 	cancelCtx context.CancelFunc
@@ -21,6 +30,9 @@ type Group struct {
 type groupModule struct {
 	module Module
 	mgr    *Manager
+
+	// stopped is set for modules that were stopped or skipped individually.
+	stopped bool
 }
 
 // Module is an manage-able instance of some component.
@@ -63,44 +75,51 @@ func NewGroup(modules ...Module) *Group {
 // Start starts all modules in the group in the defined order.
 // If a module fails to start, itself and all previous modules
 // will be stopped in the reverse order.
+// Modules must not start or stop modules of the group in their Start
+// function, but may do so from their workers.
 func (g *Group) Start() error {
 	g.initGroupContext()
 
+	g.modulesLock.Lock()
+	g.stopping = false
 	for i, m := range g.modules {
+		if m.stopped {
+			continue
+		}
 		err := m.module.Start(m.mgr)
 		if err != nil {
+			g.stopping = true
+			g.modulesLock.Unlock()
 			g.stopFrom(i)
 			return fmt.Errorf("failed to start %s: %w", makeModuleName(m.module), err)
 		}
 		m.mgr.Info("started")
 	}
+	g.modulesLock.Unlock()
 	return nil
 }
 
 // Stop stops all modules in the group in the reverse order.
 func (g *Group) Stop() (ok bool) {
+	g.modulesLock.Lock()
+	g.stopping = true
+	g.modulesLock.Unlock()
+
 	return g.stopFrom(len(g.modules) - 1)
 }
 
+// stopFrom stops the modules from the given index in the reverse order.
+// Must be called after stopping was set. The modules lock is not held while
+// stopping, so that workers of stopping modules that try to start or stop
+// modules get ErrGroupStopping instead of blocking.
 func (g *Group) stopFrom(index int) (ok bool) {
 	ok = true
 	for i := index; i >= 0; i-- {
-		m := g.modules[i]
-		err := m.module.Stop(m.mgr)
-		if err != nil {
-			m.mgr.Error("failed to stop", "err", err)
-			ok = false
+		if g.modules[i].stopped {
+			continue
 		}
-		m.mgr.Cancel()
-		if m.mgr.WaitForWorkers(0) {
-			m.mgr.Info("stopped")
-		} else {
+		if !g.modules[i].stop() {
 			ok = false
-			m.mgr.Error(
-				"failed to stop",
-				"err", "timed out",
-				"workerCnt", m.mgr.workerCnt.Load(),
-			)
 		}
 	}
 
@@ -108,6 +127,153 @@ func (g *Group) stopFrom(index int) (ok bool) {
 	return
 }
 
+func (m *groupModule) stop() (ok bool) {
+	ok = true
+	err := m.module.Stop(m.mgr)
+	if err != nil {
+		m.mgr.Error("failed to stop", "err", err)
+		ok = false
+	}
+	m.mgr.Cancel()
+	if m.mgr.WaitForWorkers(0) {
+		m.mgr.Info("stopped")
+	} else {
+		ok = false
+		m.mgr.Error(
+			"failed to stop",
+			"err", "timed out",
+			"workerCnt", m.mgr.workerCnt.Load(),
+		)
+	}
+	return ok
+}
+
+// RestartModules stops the given modules of the group in the reverse order
+// and starts them again in the defined order, each with a new manager.
+// The modules themselves, and thus their state, are kept.
+// Workers that do not stop in time are abandoned.
+// Modules that were stopped individually are not restarted.
+func (g *Group) RestartModules(modules ...Module) error {
+	g.modulesLock.Lock()
+	defer g.modulesLock.Unlock()
+
+	if g.stopping {
+		return ErrGroupStopping
+	}
+	restart, err := g.findModules(modules)
+	if err != nil {
+		return err
+	}
+	restart = slices.DeleteFunc(restart, func(m *groupModule) bool {
+		return m.stopped
+	})
+
+	// Stop modules in reverse order.
+	for i := len(restart) - 1; i >= 0; i-- {
+		restart[i].stop()
+	}
+
+	// Start modules again with new managers.
+	return g.startModules(restart, "restart")
+}
+
+// SkipModules marks the given modules as stopped, so that they are not started
+// with the group. They may be started later with StartModules.
+// Must be called before the group is started.
+func (g *Group) SkipModules(modules ...Module) error {
+	g.modulesLock.Lock()
+	defer g.modulesLock.Unlock()
+
+	skip, err := g.findModules(modules)
+	if err != nil {
+		return err
+	}
+	for _, m := range skip {
+		m.stopped = true
+	}
+	return nil
+}
+
+// StopModules stops the given modules of the group in the reverse order.
+// They stay stopped until started with StartModules or until the group is
+// stopped. Modules that are already stopped are ignored.
+func (g *Group) StopModules(modules ...Module) error {
+	g.modulesLock.Lock()
+	defer g.modulesLock.Unlock()
+
+	if g.stopping {
+		return ErrGroupStopping
+	}
+	stop, err := g.findModules(modules)
+	if err != nil {
+		return err
+	}
+
+	// Stop modules in reverse order.
+	for i := len(stop) - 1; i >= 0; i-- {
+		if stop[i].stopped {
+			continue
+		}
+		stop[i].stop()
+		stop[i].stopped = true
+	}
+	return nil
+}
+
+// StartModules starts the given stopped modules of the group in the defined
+// order, each with a new manager. Modules that are running are ignored.
+func (g *Group) StartModules(modules ...Module) error {
+	g.modulesLock.Lock()
+	defer g.modulesLock.Unlock()
+
+	if g.stopping {
+		return ErrGroupStopping
+	}
+	start, err := g.findModules(modules)
+	if err != nil {
+		return err
+	}
+	start = slices.DeleteFunc(start, func(m *groupModule) bool {
+		return !m.stopped
+	})
+	return g.startModules(start, "start")
+}
+
+// findModules returns the given modules in the defined order.
+// Must be called with the modules lock held.
+func (g *Group) findModules(modules []Module) ([]*groupModule, error) {
+	found := make([]*groupModule, 0, len(modules))
+	for _, m := range g.modules {
+		if slices.Contains(modules, m.module) {
+			found = append(found, m)
+		}
+	}
+	if len(found) != len(modules) {
+		return nil, errors.New("not all modules are part of the group")
+	}
+	return found, nil
+}
+
+// startModules starts the given modules with new managers.
+// The action is used for errors and logging, eg. "restart".
+// Must be called with the modules lock held.
+func (g *Group) startModules(modules []*groupModule, action string) error {
+	g.ctxLock.Lock()
+	ctx := g.ctx
+	g.ctxLock.Unlock()
+
+	for _, m := range modules {
+		m.mgr = newManager(ctx, makeModuleName(m.module), "module")
+		m.stopped = false
+		if err := m.module.Start(m.mgr); err != nil {
+			m.stopped = true
+			return fmt.Errorf("failed to %s %s: %w", action, makeModuleName(m.module), err)
+		}
+		m.mgr.Info(action + "ed")
+	}
+	return nil
+}
+
 func (g *Group) initGroupContext() {
 	g.ctxLock.Lock()
 	defer g.ctxLock.Unlock()
@@ -0,0 +1,99 @@
+package mgr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type restartTestModule struct {
+	mgr    *Manager
+	Events *EventMgr[int]
+}
+
+func (m *restartTestModule) Start(mgr *Manager) error {
+	m.mgr = mgr
+	m.Events.SetManager(mgr)
+	return nil
+}
+
+func (m *restartTestModule) Stop(mgr *Manager) error {
+	return nil
+}
+
+func TestRestartModules(t *testing.T) {
+	t.Parallel()
+
+	module := &restartTestModule{
+		Events: NewEventMgr[int]("test", nil),
+	}
+	g := NewGroup(module)
+	require.NoError(t, g.Start())
+	defer g.Stop()
+	firstMgr := module.mgr
+
+	// Subscriptions must survive restarts.
+	sub := module.Events.Subscribe("test", 10)
+	require.NoError(t, g.RestartModules(module))
+	assert.NotSame(t, firstMgr, module.mgr, "restarted modules must get a new manager")
+	module.Events.Submit(1)
+	select {
+	case event := <-sub.Events():
+		assert.Equal(t, 1, event)
+	case <-time.After(time.Second):
+		t.Fatal("subscription was lost on restart")
+	}
+
+	// Callbacks must be executed by the new, running manager.
+	executed := make(chan error, 1)
+	module.Events.AddCallback("test", func(w *WorkerCtx, _ int) (bool, error) {
+		executed <- w.Ctx().Err()
+		return true, nil
+	})
+	module.Events.Submit(2)
+	assert.NoError(t, <-executed)
+}
+
+type stopTestModule struct {
+	stop func() error
+}
+
+func (m *stopTestModule) Start(mgr *Manager) error { return nil }
+
+func (m *stopTestModule) Stop(mgr *Manager) error {
+	if m.stop != nil {
+		return m.stop()
+	}
+	return nil
+}
+
+func TestStartModulesWhileStopping(t *testing.T) {
+	t.Parallel()
+
+	// The first module tries to start the second module when it is stopped,
+	// like a worker that changes the role of the router during shutdown.
+	first := &stopTestModule{}
+	second := &stopTestModule{}
+	g := NewGroup(first, second)
+	require.NoError(t, g.SkipModules(second))
+	require.NoError(t, g.Start())
+
+	errs := make(chan error, 1)
+	first.stop = func() error {
+		errs <- g.StartModules(second)
+		return nil
+	}
+	stopped := make(chan bool)
+	go func() {
+		stopped <- g.Stop()
+	}()
+	select {
+	case ok := <-stopped:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("stopping the group blocked")
+	}
+	assert.ErrorIs(t, <-errs, ErrGroupStopping)
+}
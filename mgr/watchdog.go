@@ -0,0 +1,171 @@
+package mgr
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWatchdogTimeout is the default duration after which a busy worker
+	// is considered stuck.
+	DefaultWatchdogTimeout = time.Minute
+
+	watchdogInterval = 10 * time.Second
+)
+
+// Watchdog detects stuck workers of a group. A worker is stuck when it
+// marked itself as busy and did not become idle within the timeout.
+// Every stuck operation is reported once as an incident.
+type Watchdog struct {
+	group   *Group
+	timeout time.Duration
+	recover RecoverFunc
+
+	// reported holds the stuck workers that were already reported.
+	reported     map[*WorkerCtx]time.Duration
+	reportedLock sync.Mutex
+
+	Incidents *EventMgr[*Incident]
+}
+
+// Incident describes a stuck worker detected by the watchdog.
+type Incident struct {
+	Time   time.Time
+	Module Module
+	// ModuleName is the name of the module the worker belongs to.
+	ModuleName string
+	// Worker is the name of the stuck worker.
+	Worker string
+	// Stuck is how long the worker has been busy.
+	Stuck time.Duration
+	// Recovery describes what was done to recover, if anything.
+	Recovery string
+}
+
+// RecoverFunc is called for every incident and may try to recover, eg. by
+// restarting modules. It returns a description of what was done, or an empty
+// string if nothing was done.
+type RecoverFunc func(incident *Incident) (recovery string)
+
+// NewWatchdog returns a new watchdog. The recover function is optional.
+// The watchdog must be added to a group with Watch and is started as a module.
+func NewWatchdog(timeout time.Duration, recover RecoverFunc) *Watchdog {
+	if timeout <= 0 {
+		timeout = DefaultWatchdogTimeout
+	}
+	return &Watchdog{
+		timeout:  timeout,
+		recover:  recover,
+		reported: make(map[*WorkerCtx]time.Duration),
+
+		Incidents: NewEventMgr[*Incident]("incidents", nil),
+	}
+}
+
+// Watch sets the group to watch. It must be called before the watchdog is
+// started.
+func (wd *Watchdog) Watch(group *Group) {
+	wd.group = group
+}
+
+// Start starts the watchdog.
+func (wd *Watchdog) Start(mgr *Manager) error {
+	wd.Incidents.SetManager(mgr)
+	mgr.Go("watchdog", wd.worker)
+	return nil
+}
+
+// Stop stops the watchdog.
+func (wd *Watchdog) Stop(mgr *Manager) error {
+	return nil
+}
+
+func (wd *Watchdog) worker(w *WorkerCtx) error {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, incident := range wd.check() {
+				wd.report(w, incident)
+			}
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+// check returns an incident for every newly stuck worker.
+func (wd *Watchdog) check() []*Incident {
+	if wd.group == nil {
+		return nil
+	}
+
+	// Collect stuck workers of all modules.
+	type stuckWorker struct {
+		module *groupModule
+		worker *WorkerCtx
+	}
+	var stuck []stuckWorker
+	func() {
+		wd.group.modulesLock.Lock()
+		defer wd.group.modulesLock.Unlock()
+
+		for _, m := range wd.group.modules {
+			for _, w := range m.mgr.StuckWorkers(wd.timeout) {
+				stuck = append(stuck, stuckWorker{module: m, worker: w})
+			}
+		}
+	}()
+
+	wd.reportedLock.Lock()
+	defer wd.reportedLock.Unlock()
+
+	// Create incidents for workers that were not reported yet.
+	// A worker that is still busy for longer than when it was reported is
+	// still stuck on the same operation.
+	var incidents []*Incident
+	stillStuck := make(map[*WorkerCtx]time.Duration, len(stuck))
+	for _, s := range stuck {
+		busyFor := s.worker.BusyFor()
+		stillStuck[s.worker] = busyFor
+		if reportedAt, ok := wd.reported[s.worker]; ok && busyFor >= reportedAt {
+			continue
+		}
+		incidents = append(incidents, &Incident{
+			Time:       time.Now(),
+			Module:     s.module.module,
+			ModuleName: makeModuleName(s.module.module),
+			Worker:     s.worker.Name(),
+			Stuck:      busyFor,
+		})
+	}
+	wd.reported = stillStuck
+
+	return incidents
+}
+
+func (wd *Watchdog) report(w *WorkerCtx, incident *Incident) {
+	w.Error(
+		"worker is stuck",
+		"module", incident.ModuleName,
+		"stuckWorker", incident.Worker,
+		"stuck", incident.Stuck.Round(time.Second),
+	)
+
+	// Try to recover.
+	if wd.recover != nil {
+		incident.Recovery = wd.recover(incident)
+		if incident.Recovery != "" {
+			w.Warn(
+				"recovered from stuck worker",
+				"module", incident.ModuleName,
+				"stuckWorker", incident.Worker,
+				"recovery", incident.Recovery,
+			)
+		}
+	}
+
+	wd.Incidents.Submit(incident)
+}
@@ -3,11 +3,8 @@ package mgr
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log/slog"
-	"os"
-	"runtime/debug"
-	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,10 +17,16 @@ var WorkerCtxContextKey = workerContextKey{}
 // WorkerCtx provides workers with the necessary environment for flow control
 // and logging.
 type WorkerCtx struct {
+	name      string
+	module    string
 	ctx       context.Context
 	cancelCtx context.CancelFunc
 
 	logger *slog.Logger
+
+	// busySince holds the unix nano timestamp of when the worker started its
+	// current operation. It is zero when the worker is idle.
+	busySince atomic.Int64
 }
 
 // AddToCtx adds the WorkerCtx to the given context.
@@ -62,6 +65,33 @@ func (w *WorkerCtx) IsDone() bool {
 	return w.ctx.Err() != nil
 }
 
+// Name returns the worker name.
+func (w *WorkerCtx) Name() string {
+	return w.name
+}
+
+// Busy marks the worker as busy with an operation that is expected to finish
+// quickly, eg. handling a frame. The watchdog reports the worker as stuck, if
+// it does not call Idle in time.
+func (w *WorkerCtx) Busy() {
+	w.busySince.Store(time.Now().UnixNano())
+}
+
+// Idle marks the worker as idle, eg. when waiting for new work.
+func (w *WorkerCtx) Idle() {
+	w.busySince.Store(0)
+}
+
+// BusyFor returns for how long the worker has been busy with its current
+// operation. It returns zero if the worker is idle.
+func (w *WorkerCtx) BusyFor() time.Duration {
+	since := w.busySince.Load()
+	if since == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, since))
+}
+
 // Logger returns the logger used by the worker context.
 func (w *WorkerCtx) Logger() *slog.Logger {
 	return w.logger
@@ -125,8 +155,12 @@ func (m *Manager) manageWorker(name string, fn func(w *WorkerCtx) error) {
 	defer m.workerDone()
 
 	w := &WorkerCtx{
+		name:   name,
+		module: m.name,
 		logger: m.logger.With("worker", name),
 	}
+	m.addWorker(w)
+	defer m.removeWorker(w)
 
 	backoff := time.Second
 	failCnt := 0
@@ -208,8 +242,12 @@ func (m *Manager) Do(name string, fn func(w *WorkerCtx) error) error {
 
 	// Create context.
 	w := &WorkerCtx{
+		name:   name,
+		module: m.name,
 		logger: m.logger.With("worker", name),
 	}
+	m.addWorker(w)
+	defer m.removeWorker(w)
 
 	// Run worker.
 	panicInfo, err := m.runWorker(w, fn)
@@ -244,39 +282,12 @@ func (m *Manager) runWorker(w *WorkerCtx, fn func(w *WorkerCtx) error) (panicInf
 	// Create worker context that is canceled when worker finished or dies.
 	w.ctx, w.cancelCtx = context.WithCancel(m.Ctx())
 	defer w.Cancel()
+	defer w.Idle()
 
 	// Recover from panic.
 	defer func() {
-		panicVal := recover()
-		if panicVal != nil {
-			err = fmt.Errorf("panic: %s", panicVal)
-
-			// Print panic to stderr.
-			stackTrace := string(debug.Stack())
-			fmt.Fprintf(
-				os.Stderr,
-				"===== PANIC =====\n%s\n\n%s=====  END  =====\n",
-				panicVal,
-				stackTrace,
-			)
-
-			// Find the line in the stack trace that refers to where the panic occurred.
-			stackLines := strings.Split(stackTrace, "\n")
-			foundPanic := false
-			for i, line := range stackLines {
-				if !foundPanic {
-					if strings.Contains(line, "panic(") {
-						foundPanic = true
-					}
-				} else {
-					if strings.Contains(line, "mycoria") {
-						if i+1 < len(stackLines) {
-							panicInfo = strings.SplitN(strings.TrimSpace(stackLines[i+1]), " ", 2)[0]
-						}
-						break
-					}
-				}
-			}
+		if panicVal := recover(); panicVal != nil {
+			panicInfo, err = w.handlePanic(panicVal)
 		}
 	}()
 
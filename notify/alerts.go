@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+const (
+	// alertCheckInterval defines how often alert rules are evaluated.
+	alertCheckInterval = 10 * time.Second
+	// minAlertResolveDelay defines how long the condition of a firing alert
+	// must be cleared at least before the alert is resolved, so that flapping
+	// conditions do not send a notification on every check.
+	minAlertResolveDelay = time.Minute
+)
+
+// alertState holds the evaluation state of an alert rule.
+type alertState struct {
+	alert *config.Alert
+	// since is when the condition started to hold. Zero if it does not hold.
+	since time.Time
+	// clearedSince is when the condition of a firing alert was cleared.
+	clearedSince time.Time
+	firing       bool
+}
+
+// alerts is a small rules engine that tracks how long the conditions of the
+// configured alerts hold.
+type alerts struct {
+	states []*alertState
+}
+
+func newAlerts(cfg []config.Alert) *alerts {
+	a := &alerts{
+		states: make([]*alertState, 0, len(cfg)),
+	}
+	for i := range cfg {
+		a.states = append(a.states, &alertState{alert: &cfg[i]})
+	}
+	return a
+}
+
+// evaluate checks all alerts with the given condition check and returns
+// notifications for alerts that started or were resolved.
+// The check returns whether the condition holds and a description of it.
+// Alerts only change their state if allow permits sending the notification,
+// so that rate limited changes are retried on the next evaluation.
+func (a *alerts) evaluate(now time.Time, check func(alert *config.Alert) (holds bool, desc string), allow func() bool) []*Notification {
+	var notifications []*Notification
+	for _, state := range a.states {
+		holds, desc := check(state.alert)
+		switch {
+		case holds:
+			state.clearedSince = time.Time{}
+			if state.since.IsZero() {
+				state.since = now
+			}
+			if !state.firing && now.Sub(state.since) >= state.alert.For && allow() {
+				state.firing = true
+				notifications = append(notifications, &Notification{
+					Event:   config.NotifyEventAlert,
+					Title:   "Alert: " + state.alert.Name,
+					Message: fmt.Sprintf("%s for %s.", desc, now.Sub(state.since).Round(time.Second)),
+					Alert:   state.alert.Name,
+				})
+			}
+
+		case state.firing:
+			if state.clearedSince.IsZero() {
+				state.clearedSince = now
+			}
+			if now.Sub(state.clearedSince) >= max(state.alert.For, minAlertResolveDelay) && allow() {
+				notifications = append(notifications, &Notification{
+					Event:   config.NotifyEventAlertResolved,
+					Title:   "Resolved: " + state.alert.Name,
+					Message: fmt.Sprintf("The alert was resolved after %s.", state.clearedSince.Sub(state.since).Round(time.Second)),
+					Alert:   state.alert.Name,
+				})
+				*state = alertState{alert: state.alert}
+			}
+
+		default:
+			state.since = time.Time{}
+		}
+	}
+	return notifications
+}
+
+// checkAlert checks whether the condition of the alert holds.
+func (n *Notifier) checkAlert(alert *config.Alert) (holds bool, desc string) {
+	return checkAlert(n.instance.Config(), alert, n.instance.Peering().LinkCnt, n.reachable)
+}
+
+// checkAlert checks whether the condition of the alert holds, using the given
+// peer count and reachability checks.
+func checkAlert(cfg *config.Config, alert *config.Alert, peers func() int, reachable func(netip.Addr) bool) (holds bool, desc string) {
+	switch {
+	case alert.PeersBelow > 0:
+		cnt := peers()
+		return cnt < alert.PeersBelow, fmt.Sprintf("Only %d of %d required peers connected", cnt, alert.PeersBelow)
+
+	case alert.UnreachableFriend != "":
+		friend, ok := cfg.GetFriendByName(alert.UnreachableFriend)
+		if !ok {
+			// The friend was removed.
+			return false, ""
+		}
+		return !reachable(friend.IP), fmt.Sprintf("Friend %s (%s) unreachable", friend.Name, friend.IP)
+
+	case alert.Unreachable.IsValid():
+		return !reachable(alert.Unreachable), fmt.Sprintf("Router %s unreachable", alert.Unreachable)
+
+	default:
+		return false, ""
+	}
+}
+
+// reachable returns whether the router is a peer or has a route.
+func (n *Notifier) reachable(ip netip.Addr) bool {
+	return n.instance.Peering().GetLink(ip) != nil ||
+		n.instance.Router().Table().CountRoutes(ip) > 0
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+func TestAlerts(t *testing.T) {
+	t.Parallel()
+
+	a := newAlerts([]config.Alert{
+		{Name: "uplink", PeersBelow: 1, For: time.Minute},
+		{Name: "instant", PeersBelow: 2},
+	})
+	holds := false
+	check := func(alert *config.Alert) (bool, string) {
+		return holds, "Condition holds"
+	}
+	allow := func() bool { return true }
+	start := time.Now()
+
+	// Nothing happens while the condition does not hold.
+	assert.Empty(t, a.evaluate(start, check, allow))
+
+	// Alerts without duration start immediately.
+	holds = true
+	notifications := a.evaluate(start, check, allow)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "instant", notifications[0].Alert)
+	assert.Equal(t, config.NotifyEventAlert, notifications[0].Event)
+
+	// Alerts start when the condition held long enough, and only once.
+	assert.Empty(t, a.evaluate(start.Add(30*time.Second), check, allow))
+	notifications = a.evaluate(start.Add(time.Minute), check, allow)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "uplink", notifications[0].Alert)
+	assert.Equal(t, "Condition holds for 1m0s.", notifications[0].Message)
+	assert.Empty(t, a.evaluate(start.Add(2*time.Minute), check, allow))
+
+	// Flapping conditions do not resolve alerts.
+	holds = false
+	assert.Empty(t, a.evaluate(start.Add(3*time.Minute), check, allow))
+	holds = true
+	assert.Empty(t, a.evaluate(start.Add(3*time.Minute+10*time.Second), check, allow))
+
+	// Alerts are resolved when the condition stays cleared.
+	holds = false
+	assert.Empty(t, a.evaluate(start.Add(4*time.Minute), check, allow))
+	notifications = a.evaluate(start.Add(5*time.Minute), check, allow)
+	require.Len(t, notifications, 2)
+	for _, n := range notifications {
+		assert.Equal(t, config.NotifyEventAlertResolved, n.Event)
+		assert.Equal(t, "The alert was resolved after 4m0s.", n.Message)
+	}
+	assert.Empty(t, a.evaluate(start.Add(6*time.Minute), check, allow))
+
+	// Rate limited alerts are retried.
+	holds = true
+	assert.Empty(t, a.evaluate(start.Add(7*time.Minute), check, func() bool { return false }))
+	notifications = a.evaluate(start.Add(7*time.Minute+10*time.Second), check, allow)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "instant", notifications[0].Alert)
+}
+
+func TestCheckAlert(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.MakeTestConfig(config.Store{
+		FriendConfigs: []config.FriendConfig{{
+			Name: "nas",
+			IP:   "fd12:3456::f",
+		}},
+	})
+	var (
+		peers       int
+		reachableIP netip.Addr
+	)
+	check := func(alert config.Alert) bool {
+		holds, _ := checkAlert(cfg, &alert, func() int { return peers }, func(ip netip.Addr) bool {
+			return ip == reachableIP
+		})
+		return holds
+	}
+
+	// Peer count.
+	assert.True(t, check(config.Alert{PeersBelow: 1}))
+	peers = 1
+	assert.False(t, check(config.Alert{PeersBelow: 1}))
+	assert.True(t, check(config.Alert{PeersBelow: 2}))
+
+	// Reachability of friends and routers.
+	friendIP := netip.MustParseAddr("fd12:3456::f")
+	assert.True(t, check(config.Alert{UnreachableFriend: "nas"}))
+	assert.True(t, check(config.Alert{Unreachable: friendIP}))
+	reachableIP = friendIP
+	assert.False(t, check(config.Alert{UnreachableFriend: "nas"}))
+	assert.False(t, check(config.Alert{Unreachable: friendIP}))
+
+	// Removed friends do not alert.
+	assert.False(t, check(config.Alert{UnreachableFriend: "removed"}))
+}
@@ -0,0 +1,23 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// sendDesktop shows the notification on the desktop. notify-send delivers it
+// to the notification daemon of the desktop session via DBus.
+func sendDesktop(ctx context.Context, notification *Notification) error {
+	cmd := exec.CommandContext(ctx, "notify-send", //nolint:gosec // Arguments are not interpreted by a shell.
+		"--app-name=Mycoria",
+		"--",
+		notification.Title,
+		notification.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify-send: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+// sendDesktop shows the notification on the desktop.
+// Only supported on Linux.
+func sendDesktop(ctx context.Context, notification *Notification) error {
+	return errors.New("desktop notifications are only supported on Linux")
+}
@@ -0,0 +1,249 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/ha"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/router"
+)
+
+const (
+	// sendTimeout defines how long sending a notification may take.
+	sendTimeout = 10 * time.Second
+	// notificationRate limits how many notifications are sent per minute,
+	// so that flapping links do not flood the targets.
+	notificationRate = 10
+)
+
+// Notification is a notification about an event.
+type Notification struct {
+	// Event is the notification event, see config.NotifyEvent*.
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	// Router is the router the event is about.
+	Router string `json:"router,omitempty"`
+	// Alert is the name of the alert, for alert events.
+	Alert string `json:"alert,omitempty"`
+}
+
+// Notifier sends notifications about selected events to the desktop, a
+// webhook or an ntfy topic.
+type Notifier struct {
+	instance instance
+	mgr      *mgr.Manager
+	client   *http.Client
+	limiter  *rate.Limiter
+}
+
+// instance is an interface subset of inst.Ance.
+type instance interface {
+	Config() *config.Config
+	HA() *ha.HA
+	Peering() *peering.Peering
+	Router() *router.Router
+}
+
+// New returns a new notifier.
+func New(instance instance) *Notifier {
+	return &Notifier{
+		instance: instance,
+		client:   &http.Client{Timeout: sendTimeout},
+		limiter:  rate.NewLimiter(rate.Every(time.Minute/notificationRate), notificationRate),
+	}
+}
+
+// Start starts the notifier.
+func (n *Notifier) Start(mgr *mgr.Manager) error {
+	n.mgr = mgr
+	n.mgr.Go("notify", n.notifyWorker)
+	return nil
+}
+
+// Stop stops the notifier.
+func (n *Notifier) Stop(mgr *mgr.Manager) error {
+	return nil
+}
+
+func (n *Notifier) notifyWorker(w *mgr.WorkerCtx) error {
+	cfg := n.instance.Config().Notifications
+
+	// Only subscribe to events that are enabled.
+	var (
+		inbound <-chan *router.EventInbound
+		denied  <-chan *router.EventDenied
+		peers   <-chan *peering.EventPeering
+	)
+	if cfg.Enabled(config.NotifyEventNewInbound) {
+		sub := n.instance.Router().InboundEvents.Subscribe("notifications", 100)
+		defer sub.Cancel()
+		inbound = sub.Events()
+	}
+	if cfg.Enabled(config.NotifyEventDenied) {
+		sub := n.instance.Router().DeniedEvents.Subscribe("notifications", 100)
+		defer sub.Cancel()
+		denied = sub.Events()
+	}
+	if cfg.Enabled(config.NotifyEventPeerDown) {
+		sub := n.instance.Peering().PeeringEvents.Subscribe("notifications", 100)
+		defer sub.Cancel()
+		peers = sub.Events()
+	}
+
+	// Evaluate alerts, if configured.
+	alerts := newAlerts(cfg.Alerts)
+	var alertTicks <-chan time.Time
+	if len(cfg.Alerts) > 0 {
+		alertTicker := time.NewTicker(alertCheckInterval)
+		defer alertTicker.Stop()
+		alertTicks = alertTicker.C
+	}
+
+	for {
+		var notification *Notification
+		select {
+		case e := <-inbound:
+			notification = inboundNotification(e)
+		case e := <-denied:
+			notification = deniedNotification(e)
+		case e := <-peers:
+			notification = peerNotification(e)
+		case now := <-alertTicks:
+			// Peers and routes are only maintained by the active router.
+			if h := n.instance.HA(); h != nil && !h.IsActive() {
+				continue
+			}
+			for _, notification := range alerts.evaluate(now, n.checkAlert, n.limiter.Allow) {
+				notification.Time = now
+				if err := n.sendToTargets(w.Ctx(), notification); err != nil {
+					w.Warn("failed to send alert", "alert", notification.Alert, "err", err)
+				}
+			}
+		case <-w.Done():
+			return nil
+		}
+		if notification == nil {
+			continue
+		}
+
+		if !n.limiter.Allow() {
+			w.Debug("dropped notification, rate limit reached", "event", notification.Event, "router", notification.Router)
+			continue
+		}
+		notification.Time = time.Now()
+		if err := n.sendToTargets(w.Ctx(), notification); err != nil {
+			w.Warn("failed to send notification", "event", notification.Event, "err", err)
+		}
+	}
+}
+
+func inboundNotification(e *router.EventInbound) *Notification {
+	msg := fmt.Sprintf("Router %s connected to port %d for the first time.", e.Router, e.Port)
+	if e.Service != "" {
+		msg = fmt.Sprintf("Router %s connected to the service %s for the first time.", e.Router, e.Service)
+	}
+	return &Notification{
+		Event:   config.NotifyEventNewInbound,
+		Title:   "New inbound connection",
+		Message: msg,
+		Router:  e.Router.String(),
+	}
+}
+
+func deniedNotification(e *router.EventDenied) *Notification {
+	from := ""
+	if e.Country != "" {
+		from = " from " + e.Country
+	}
+	return &Notification{
+		Event: config.NotifyEventDenied,
+		Title: "Access denied repeatedly",
+		Message: fmt.Sprintf(
+			"Access to the service %s was denied %d times to %d routers%s since %s.",
+			e.Service, e.Attempts, e.Routers, from, e.Since.Format(time.Kitchen),
+		),
+	}
+}
+
+func peerNotification(e *peering.EventPeering) *Notification {
+	if e.State != peering.EventStateDown {
+		return nil
+	}
+	return &Notification{
+		Event:   config.NotifyEventPeerDown,
+		Title:   "Peer lost",
+		Message: fmt.Sprintf("The link to the peer %s was lost.", e.Peer),
+		Router:  e.Peer.String(),
+	}
+}
+
+// sendToTargets sends the notification to all configured targets.
+func (n *Notifier) sendToTargets(ctx context.Context, notification *Notification) error {
+	cfg := n.instance.Config().Notifications
+
+	var firstErr error
+	addErr := func(target string, err error) {
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", target, err)
+		}
+	}
+	if cfg.Desktop {
+		addErr("desktop", sendDesktop(ctx, notification))
+	}
+	if cfg.Webhook != nil {
+		addErr("webhook", n.sendWebhook(ctx, cfg.Webhook.String(), notification))
+	}
+	if cfg.Ntfy != nil {
+		addErr("ntfy", n.sendNtfy(ctx, cfg.Ntfy.String(), notification))
+	}
+	return firstErr
+}
+
+// sendWebhook posts the notification as JSON.
+func (n *Notifier) sendWebhook(ctx context.Context, webhookURL string, notification *Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return n.do(req)
+}
+
+// sendNtfy publishes the notification to an ntfy topic.
+func (n *Notifier) sendNtfy(ctx context.Context, topicURL string, notification *Notification) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, topicURL, bytes.NewReader([]byte(notification.Message)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", notification.Title)
+	req.Header.Set("Tags", "mycoria,"+notification.Event)
+	return n.do(req)
+}
+
+func (n *Notifier) do(req *http.Request) error {
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/ha"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/router"
+)
+
+type testInstance struct {
+	cfg *config.Config
+}
+
+func (i *testInstance) Config() *config.Config    { return i.cfg }
+func (i *testInstance) HA() *ha.HA                { return nil }
+func (i *testInstance) Peering() *peering.Peering { return nil }
+func (i *testInstance) Router() *router.Router    { return nil }
+
+func TestNotifications(t *testing.T) {
+	t.Parallel()
+
+	peer := netip.MustParseAddr("fd00::1")
+	assert.Nil(t, peerNotification(&peering.EventPeering{Peer: peer, State: peering.EventStateUp}), "only lost peers must be notified")
+	n := peerNotification(&peering.EventPeering{Peer: peer, State: peering.EventStateDown})
+	require.NotNil(t, n)
+	assert.Equal(t, config.NotifyEventPeerDown, n.Event)
+	assert.Equal(t, peer.String(), n.Router)
+
+	n = inboundNotification(&router.EventInbound{Router: peer, Service: "wiki", Protocol: 6, Port: 80})
+	assert.Contains(t, n.Message, "wiki")
+}
+
+func TestSendToTargets(t *testing.T) {
+	t.Parallel()
+
+	// Record requests of both targets.
+	var (
+		received = make(map[string]*http.Request)
+		bodies   = make(map[string][]byte)
+		lock     sync.Mutex
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		received[r.URL.Path] = r
+		bodies[r.URL.Path] = body
+	}))
+	defer srv.Close()
+
+	webhook, err := url.Parse(srv.URL + "/webhook")
+	require.NoError(t, err)
+	ntfy, err := url.Parse(srv.URL + "/topic")
+	require.NoError(t, err)
+	n := New(&testInstance{cfg: &config.Config{
+		Notifications: &config.Notifications{
+			Webhook: webhook,
+			Ntfy:    ntfy,
+		},
+	}})
+
+	notification := &Notification{
+		Event:   config.NotifyEventPeerDown,
+		Title:   "Peer lost",
+		Message: "The link to the peer fd00::1 was lost.",
+		Router:  "fd00::1",
+	}
+	require.NoError(t, n.sendToTargets(context.Background(), notification))
+	lock.Lock()
+
+	// Check webhook.
+	require.Contains(t, received, "/webhook")
+	assert.Equal(t, "application/json", received["/webhook"].Header.Get("Content-Type"))
+	sent := &Notification{}
+	require.NoError(t, json.Unmarshal(bodies["/webhook"], sent))
+	assert.Equal(t, notification, sent)
+
+	// Check ntfy.
+	require.Contains(t, received, "/topic")
+	assert.Equal(t, notification.Title, received["/topic"].Header.Get("Title"))
+	assert.Equal(t, notification.Message, string(bodies["/topic"]))
+	lock.Unlock()
+
+	// Errors of targets must be reported.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	webhook, err = url.Parse(failing.URL)
+	require.NoError(t, err)
+	n.instance.Config().Notifications.Webhook = webhook
+	require.Error(t, n.sendToTargets(context.Background(), notification))
+}
@@ -0,0 +1,109 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ErrBindToInterfaceUnsupported is returned when binding to a network
+// interface is not supported on the current platform.
+var ErrBindToInterfaceUnsupported = errors.New("binding to an interface is not supported on this platform, bind to an IP address instead")
+
+// socketBinding defines where a socket is bound to.
+// Either an IP address or an interface name is set.
+type socketBinding struct {
+	ip    netip.Addr
+	iface string
+}
+
+// parseSocketBinding parses a bind value, which is either an IP address or
+// the name of a network interface.
+func parseSocketBinding(value string) socketBinding {
+	if ip, err := netip.ParseAddr(value); err == nil {
+		return socketBinding{ip: ip.Unmap()}
+	}
+	return socketBinding{iface: value}
+}
+
+// outgoingBinding returns the binding for an outgoing connection to the given
+// peering URL. The bind parameter of the peering URL takes precedence over
+// router.connectFrom.
+func (p *Peering) outgoingBinding(peeringURL *m.PeeringURL) (socketBinding, bool) {
+	if bind := peeringURL.Param(m.PeeringURLParamBind); bind != "" {
+		return parseSocketBinding(bind), true
+	}
+	if bind := p.instance.Config().Router.ConnectFrom; bind != "" {
+		return parseSocketBinding(bind), true
+	}
+	return socketBinding{}, false
+}
+
+// applyToDialer configures the dialer to use the binding.
+func (b socketBinding) applyToDialer(dialer *net.Dialer, network string) error {
+	if b.ip.IsValid() {
+		switch network {
+		case "tcp":
+			dialer.LocalAddr = &net.TCPAddr{IP: b.ip.AsSlice()}
+		case "udp":
+			dialer.LocalAddr = &net.UDPAddr{IP: b.ip.AsSlice()}
+		default:
+			return fmt.Errorf("binding to an IP is not supported for %s", network)
+		}
+		return nil
+	}
+
+	control, err := bindToInterface(b.iface)
+	if err != nil {
+		return err
+	}
+	dialer.Control = control
+	return nil
+}
+
+// applyToListenConfig configures the listen config to use the binding.
+// Binding to an IP address must be done via the listen address.
+func (b socketBinding) applyToListenConfig(lc *net.ListenConfig) error {
+	if b.iface == "" {
+		return nil
+	}
+
+	control, err := bindToInterface(b.iface)
+	if err != nil {
+		return err
+	}
+	lc.Control = chainSocketControl(lc.Control, control)
+	return nil
+}
+
+// String returns the IP address or interface name.
+func (b socketBinding) String() string {
+	if b.ip.IsValid() {
+		return b.ip.String()
+	}
+	return b.iface
+}
+
+// socketControl is the control function type of net.Dialer and net.ListenConfig.
+type socketControl func(network, address string, c syscall.RawConn) error
+
+// chainSocketControl returns a control function that runs both given control
+// functions. Either may be nil.
+func chainSocketControl(a, b socketControl) socketControl {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if err := a(network, address, c); err != nil {
+			return err
+		}
+		return b(network, address, c)
+	}
+}
@@ -0,0 +1,20 @@
+package peering
+
+import (
+	"syscall"
+)
+
+// bindToInterface returns a socket control function that binds the socket to
+// the given network interface using SO_BINDTODEVICE.
+func bindToInterface(iface string) (socketControl, error) {
+	return func(network, address string, c syscall.RawConn) error {
+		var bindErr error
+		err := c.Control(func(fd uintptr) {
+			bindErr = syscall.BindToDevice(int(fd), iface)
+		})
+		if err != nil {
+			return err
+		}
+		return bindErr
+	}, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package peering
+
+// bindToInterface is not supported on this platform.
+func bindToInterface(iface string) (socketControl, error) {
+	return nil, ErrBindToInterfaceUnsupported
+}
@@ -0,0 +1,38 @@
+package peering
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketBinding(t *testing.T) {
+	t.Parallel()
+
+	// Bind to IP.
+	binding := parseSocketBinding("::ffff:127.0.0.1")
+	assert.Equal(t, netip.MustParseAddr("127.0.0.1"), binding.ip)
+	assert.Empty(t, binding.iface)
+
+	dialer := &net.Dialer{}
+	require.NoError(t, binding.applyToDialer(dialer, "tcp"))
+	assert.Equal(t, "127.0.0.1:0", dialer.LocalAddr.String())
+
+	// Connect with binding.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close() //nolint:errcheck
+	conn, err := dialer.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	assert.Equal(t, "127.0.0.1", conn.LocalAddr().(*net.TCPAddr).IP.String()) //nolint:forcetypeassert
+
+	// Bind to interface.
+	binding = parseSocketBinding("eth1")
+	assert.False(t, binding.ip.IsValid())
+	assert.Equal(t, "eth1", binding.iface)
+}
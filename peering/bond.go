@@ -0,0 +1,409 @@
+package peering
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+)
+
+const (
+	defaultBondWeight = 1
+	maxBondWeight     = 100
+)
+
+// LinkBond bonds multiple links to the same peer into a single link.
+// Regular frames are spread across the member links by weight, priority frames
+// use the member with the lowest latency. When a member link closes, the
+// remaining members immediately take over.
+// All members share the switch label of the bond.
+type LinkBond struct {
+	peer    netip.Addr
+	started time.Time
+
+	switchLabel atomic.Uint32
+
+	lock    sync.RWMutex
+	members []*bondMember
+	// lastReason holds the close reason of the last removed member.
+	lastReason string
+}
+
+// bondMember is a link in a bond.
+// It uses smooth weighted round-robin for scheduling.
+type bondMember struct {
+	link    Link
+	weight  int
+	current int
+}
+
+var _ Link = &LinkBond{}
+
+// newLinkBond returns a new bond with the given link as the first member.
+// The bond takes over the switch label of the link.
+func newLinkBond(first Link) *LinkBond {
+	bond := &LinkBond{
+		peer:    first.Peer(),
+		started: first.Started(),
+	}
+	bond.switchLabel.Store(uint32(first.SwitchLabel()))
+	bond.members = []*bondMember{newBondMember(first)}
+	return bond
+}
+
+func newBondMember(link Link) *bondMember {
+	weight := defaultBondWeight
+	if u := link.PeeringURL(); u != nil {
+		if w, err := parseBondWeight(u.Param(m.PeeringURLParamWeight)); err == nil {
+			weight = w
+		}
+	}
+	return &bondMember{
+		link:   link,
+		weight: weight,
+	}
+}
+
+// parseBondWeight parses the weight parameter of a peering URL.
+func parseBondWeight(value string) (int, error) {
+	if value == "" {
+		return defaultBondWeight, nil
+	}
+	w, err := strconv.Atoi(value)
+	if err != nil || w < 1 || w > maxBondWeight {
+		return 0, fmt.Errorf("invalid weight %q: must be between 1 and %d", value, maxBondWeight)
+	}
+	return w, nil
+}
+
+// add adds a link to the bond and assigns the switch label of the bond.
+func (bond *LinkBond) add(link Link) {
+	bond.lock.Lock()
+	defer bond.lock.Unlock()
+
+	link.SetSwitchLabel(bond.SwitchLabel())
+	bond.members = append(bond.members, newBondMember(link))
+}
+
+// remove removes a link from the bond and reports whether it was a member.
+func (bond *LinkBond) remove(link Link) bool {
+	bond.lock.Lock()
+	defer bond.lock.Unlock()
+
+	for i, member := range bond.members {
+		if member.link == link {
+			bond.members = slices.Delete(bond.members, i, i+1)
+			bond.lastReason = link.CloseReason()
+			return true
+		}
+	}
+	return false
+}
+
+// Members returns the member links of the bond.
+func (bond *LinkBond) Members() []Link {
+	bond.lock.RLock()
+	defer bond.lock.RUnlock()
+
+	links := make([]Link, 0, len(bond.members))
+	for _, member := range bond.members {
+		links = append(links, member.link)
+	}
+	return links
+}
+
+// LinkMembers returns the member links of a bond, or the link itself if it is
+// not a bond. Fault injection wrappers of bonds are skipped.
+func LinkMembers(link Link) []Link {
+	if bond, ok := unwrapChaos(link).(*LinkBond); ok {
+		return bond.Members()
+	}
+	return []Link{link}
+}
+
+// primary returns the first member that is not closing.
+// Falls back to the first member, if all are closing.
+func (bond *LinkBond) primary() Link {
+	bond.lock.RLock()
+	defer bond.lock.RUnlock()
+
+	for _, member := range bond.members {
+		if !member.link.IsClosing() {
+			return member.link
+		}
+	}
+	if len(bond.members) > 0 {
+		return bond.members[0].link
+	}
+	return nil
+}
+
+// next returns the next member to send a regular frame with.
+func (bond *LinkBond) next() Link {
+	bond.lock.Lock()
+	defer bond.lock.Unlock()
+
+	var (
+		total    int
+		selected *bondMember
+	)
+	for _, member := range bond.members {
+		if member.link.IsClosing() {
+			continue
+		}
+		member.current += member.weight
+		total += member.weight
+		if selected == nil || member.current > selected.current {
+			selected = member
+		}
+	}
+	if selected == nil {
+		return nil
+	}
+	selected.current -= total
+	return selected.link
+}
+
+// fastest returns the member with the lowest latency.
+func (bond *LinkBond) fastest() Link {
+	bond.lock.RLock()
+	defer bond.lock.RUnlock()
+
+	var selected Link
+	for _, member := range bond.members {
+		if member.link.IsClosing() {
+			continue
+		}
+		if selected == nil || member.link.Latency() < selected.Latency() {
+			selected = member.link
+		}
+	}
+	return selected
+}
+
+// String returns a human readable summary.
+func (bond *LinkBond) String() string {
+	return fmt.Sprintf("bond to %s with %d links", bond.peer, len(bond.Members()))
+}
+
+// Peer returns the ID of the connected peer.
+func (bond *LinkBond) Peer() netip.Addr {
+	return bond.peer
+}
+
+// SwitchLabel returns the switch label of the bond.
+func (bond *LinkBond) SwitchLabel() m.SwitchLabel {
+	return m.SwitchLabel(bond.switchLabel.Load())
+}
+
+// SetSwitchLabel sets a new switch label for the bond and all members.
+// It must only be used by the peering manager, which tracks the labels.
+func (bond *LinkBond) SetSwitchLabel(label m.SwitchLabel) {
+	bond.lock.RLock()
+	defer bond.lock.RUnlock()
+
+	bond.switchLabel.Store(uint32(label))
+	for _, member := range bond.members {
+		member.link.SetSwitchLabel(label)
+	}
+}
+
+// GeoMark returns geo location of the peer, based on the router address.
+func (bond *LinkBond) GeoMark() string {
+	if link := bond.primary(); link != nil {
+		return link.GeoMark()
+	}
+	return ""
+}
+
+// PeeringURL returns the peering URL of the primary member.
+func (bond *LinkBond) PeeringURL() *m.PeeringURL {
+	if link := bond.primary(); link != nil {
+		return link.PeeringURL()
+	}
+	return nil
+}
+
+// Outgoing returns whether the primary member was initiated by this router.
+func (bond *LinkBond) Outgoing() bool {
+	if link := bond.primary(); link != nil {
+		return link.Outgoing()
+	}
+	return false
+}
+
+// Lite returns whether the connected router is in lite mode.
+func (bond *LinkBond) Lite() bool {
+	if link := bond.primary(); link != nil {
+		return link.Lite()
+	}
+	return false
+}
+
+// SendPriority sends a priority frame via the member with the lowest latency.
+func (bond *LinkBond) SendPriority(f frame.Frame) error {
+	link := bond.fastest()
+	if link == nil {
+		return nil
+	}
+	return link.SendPriority(f)
+}
+
+// Send sends a frame via the next member by weight.
+func (bond *LinkBond) Send(f frame.Frame) error {
+	link := bond.next()
+	if link == nil {
+		return nil
+	}
+	return link.Send(f)
+}
+
+// LocalAddr returns the local net.Addr of the primary member.
+func (bond *LinkBond) LocalAddr() net.Addr {
+	if link := bond.primary(); link != nil {
+		return link.LocalAddr()
+	}
+	return nil
+}
+
+// RemoteAddr returns the remote net.Addr of the primary member.
+func (bond *LinkBond) RemoteAddr() net.Addr {
+	if link := bond.primary(); link != nil {
+		return link.RemoteAddr()
+	}
+	return nil
+}
+
+// Started returns when the first link of the bond was created.
+func (bond *LinkBond) Started() time.Time {
+	return bond.started
+}
+
+// Uptime returns how long the bond has been up.
+func (bond *LinkBond) Uptime() time.Duration {
+	return time.Since(bond.started)
+}
+
+// Latency returns the lowest latency of all members in milliseconds.
+func (bond *LinkBond) Latency() uint16 {
+	if link := bond.fastest(); link != nil {
+		return link.Latency()
+	}
+	return 0
+}
+
+// AddMeasuredLatency adds the given latency to all members, as it is not
+// known which member the measurement was taken on.
+func (bond *LinkBond) AddMeasuredLatency(latency time.Duration) {
+	for _, link := range bond.Members() {
+		link.AddMeasuredLatency(latency)
+	}
+}
+
+// AvgLatency returns the average of the average latencies of all members in
+// milliseconds.
+func (bond *LinkBond) AvgLatency() uint16 {
+	members := bond.Members()
+	if len(members) == 0 {
+		return 0
+	}
+	var total int
+	for _, link := range members {
+		total += int(link.AvgLatency())
+	}
+	return uint16(total / len(members))
+}
+
+// ClockSkew returns the clock skew of the peer, as estimated by the primary
+// member.
+func (bond *LinkBond) ClockSkew() time.Duration {
+	if link := bond.primary(); link != nil {
+		return link.ClockSkew()
+	}
+	return 0
+}
+
+// ObservedAddr returns the underlay address of this router, as seen by the
+// peer on the primary member.
+func (bond *LinkBond) ObservedAddr() netip.AddrPort {
+	if link := bond.primary(); link != nil {
+		return link.ObservedAddr()
+	}
+	return netip.AddrPort{}
+}
+
+// Capabilities returns the protocol features the peer supports, as reported
+// on the primary member.
+func (bond *LinkBond) Capabilities() m.Capabilities {
+	if link := bond.primary(); link != nil {
+		return link.Capabilities()
+	}
+	return 0
+}
+
+// BytesIn returns the total amount of bytes received via all members.
+func (bond *LinkBond) BytesIn() (total uint64) {
+	for _, link := range bond.Members() {
+		total += link.BytesIn()
+	}
+	return total
+}
+
+// BytesOut returns the total amount of bytes sent via all members.
+func (bond *LinkBond) BytesOut() (total uint64) {
+	for _, link := range bond.Members() {
+		total += link.BytesOut()
+	}
+	return total
+}
+
+// FlowControlIndicator returns the highest pressure of all members, as
+// regular frames are spread across all of them.
+func (bond *LinkBond) FlowControlIndicator() frame.FlowControlFlag {
+	indicator := frame.FlowControlFlagIncreaseFlow
+	for _, link := range bond.Members() {
+		switch link.FlowControlIndicator() {
+		case frame.FlowControlFlagDecreaseFlow:
+			return frame.FlowControlFlagDecreaseFlow
+		case frame.FlowControlFlagHoldFlow:
+			indicator = frame.FlowControlFlagHoldFlow
+		}
+	}
+	return indicator
+}
+
+// IsClosing returns whether all members are closing or have closed.
+func (bond *LinkBond) IsClosing() bool {
+	for _, link := range bond.Members() {
+		if !link.IsClosing() {
+			return false
+		}
+	}
+	return true
+}
+
+// CloseReason returns the close reason of the last removed member.
+func (bond *LinkBond) CloseReason() string {
+	bond.lock.RLock()
+	defer bond.lock.RUnlock()
+
+	return bond.lastReason
+}
+
+// Close closes all members with the given reason.
+// The log function is only called once.
+func (bond *LinkBond) Close(reason string, log func()) {
+	if log != nil && !bond.IsClosing() {
+		log()
+	}
+	for _, link := range bond.Members() {
+		link.Close(reason, nil)
+	}
+}
@@ -0,0 +1,118 @@
+package peering
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestLinkBond(t *testing.T) {
+	t.Parallel()
+
+	p := New(getTestInstance(t, config.MakeTestConfig(config.Store{})), nil, nil)
+	p.mgr = mgr.New("peering")
+
+	// Add second link to the same peer.
+	linkA := addTestLink(t, p)
+	linkB := &LinkBase{
+		peer:    linkA.Peer(),
+		peering: p,
+	}
+	linkB.peeringURL, _ = m.ParsePeeringURL("tcp://127.0.0.1:47369/?weight=3")
+	require.NoError(t, linkB.assignSwitchLabel())
+	require.NoError(t, p.AddLink(linkB))
+
+	// Links must be bonded with a shared label.
+	bond, ok := p.GetLink(linkA.Peer()).(*LinkBond)
+	require.True(t, ok, "link must be a bond")
+	assert.Len(t, bond.Members(), 2)
+	assert.Equal(t, linkA.SwitchLabel(), linkB.SwitchLabel())
+	assert.Equal(t, Link(bond), p.GetLinkByLabel(linkA.SwitchLabel()))
+
+	// Regular frames must be spread by weight.
+	counts := make(map[Link]int)
+	for range 40 {
+		counts[bond.next()]++
+	}
+	assert.Equal(t, 10, counts[linkA])
+	assert.Equal(t, 30, counts[linkB])
+
+	// Closing members must be skipped.
+	linkB.closing.Store(true)
+	assert.Equal(t, Link(linkA), bond.next())
+	assert.False(t, bond.IsClosing())
+
+	// Removing a member must unwrap the remaining link.
+	linkB.closeReason = "closed by remote"
+	p.RemoveLink(linkB)
+	assert.Equal(t, Link(linkA), p.GetLink(linkA.Peer()))
+	assert.Equal(t, Link(linkA), p.GetLinkByLabel(linkA.SwitchLabel()))
+	assert.Equal(t, "closed by remote", bond.CloseReason())
+
+	// Removing the last link must remove the peer.
+	p.RemoveLink(linkA)
+	assert.Nil(t, p.GetLink(linkA.Peer()))
+	assert.Empty(t, p.linksByLabel)
+}
+
+func TestLinkBondChaos(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.MakeTestConfig(config.Store{})
+	cfg.SetDevMode(true)
+	p := New(getTestInstance(t, cfg), nil, nil)
+	p.mgr = mgr.New("peering")
+
+	// Enable fault injection on a single link.
+	linkA := addTestLink(t, p)
+	require.NoError(t, p.SetLinkChaos(linkA.Peer(), ChaosConfig{Loss: 0.1}))
+	assert.Equal(t, []Link{linkA}, LinkMembers(linkA))
+
+	// Bond another link and keep fault injection on the bond.
+	linkB := &LinkBase{
+		peer:    linkA.Peer(),
+		peering: p,
+	}
+	require.NoError(t, linkB.assignSwitchLabel())
+	require.NoError(t, p.AddLink(linkB))
+	cl, ok := p.GetLink(linkA.Peer()).(*ChaosLink)
+	require.True(t, ok, "fault injection must be kept")
+	_, ok = cl.Link.(*LinkBond)
+	require.True(t, ok, "link must be a bond")
+	assert.Equal(t, []Link{linkA, linkB}, LinkMembers(cl))
+	assert.Equal(t, 0.1, cl.Config().Loss)
+
+	// Removing a member must unwrap the remaining link, but keep fault injection.
+	p.RemoveLink(linkA)
+	cl, ok = p.GetLink(linkA.Peer()).(*ChaosLink)
+	require.True(t, ok, "fault injection must be kept")
+	assert.Equal(t, Link(linkB), cl.Link)
+	assert.Equal(t, Link(cl), p.GetLinkByLabel(linkB.SwitchLabel()))
+
+	// Removing the inner link must remove the peer.
+	p.RemoveLink(linkB)
+	assert.Nil(t, p.GetLink(linkA.Peer()))
+	assert.Empty(t, p.linksByLabel)
+}
+
+func TestParseBondWeight(t *testing.T) {
+	t.Parallel()
+
+	w, err := parseBondWeight("")
+	require.NoError(t, err)
+	assert.Equal(t, defaultBondWeight, w)
+
+	w, err = parseBondWeight("5")
+	require.NoError(t, err)
+	assert.Equal(t, 5, w)
+
+	for _, value := range []string{"0", "-1", "101", "x"} {
+		_, err = parseBondWeight(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,250 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+)
+
+// Chaos errors.
+var (
+	ErrChaosRequiresDevMode = errors.New("fault injection requires development mode")
+	ErrLinkNotFound         = errors.New("link not found")
+)
+
+// ChaosConfig configures fault injection on a link.
+// All probabilities are in the range of 0 to 1.
+type ChaosConfig struct {
+	// Loss is the probability of a frame being dropped.
+	Loss float64
+	// Duplicate is the probability of a frame being sent twice.
+	Duplicate float64
+	// Reorder is the probability of a frame being held back, so that
+	// following frames overtake it.
+	Reorder float64
+
+	// Latency is added to every frame.
+	Latency time.Duration
+	// Jitter is a random additional latency of up to the given duration.
+	Jitter time.Duration
+}
+
+// Check checks if the chaos config is valid.
+func (cfg ChaosConfig) Check() error {
+	switch {
+	case cfg.Loss < 0 || cfg.Loss > 1:
+		return errors.New("loss must be between 0 and 1")
+	case cfg.Duplicate < 0 || cfg.Duplicate > 1:
+		return errors.New("duplicate must be between 0 and 1")
+	case cfg.Reorder < 0 || cfg.Reorder > 1:
+		return errors.New("reorder must be between 0 and 1")
+	case cfg.Latency < 0 || cfg.Latency > 10*time.Second:
+		return errors.New("latency must be between 0 and 10s")
+	case cfg.Jitter < 0 || cfg.Jitter > 10*time.Second:
+		return errors.New("jitter must be between 0 and 10s")
+	}
+	return nil
+}
+
+// String returns a human readable summary.
+func (cfg ChaosConfig) String() string {
+	return fmt.Sprintf(
+		"loss=%.0f%% duplicate=%.0f%% reorder=%.0f%% latency=%s jitter=%s",
+		cfg.Loss*100, cfg.Duplicate*100, cfg.Reorder*100, cfg.Latency, cfg.Jitter,
+	)
+}
+
+// ChaosLink wraps a link and injects faults into outgoing frames.
+// It is only available in development mode and is intended for reproducing
+// behavior on bad networks.
+type ChaosLink struct {
+	Link
+
+	cfg  ChaosConfig
+	lock sync.RWMutex
+}
+
+// Config returns the current chaos config.
+func (cl *ChaosLink) Config() ChaosConfig {
+	cl.lock.RLock()
+	defer cl.lock.RUnlock()
+
+	return cl.cfg
+}
+
+// unwrapChaos returns the link wrapped by a chaos link, or the link itself.
+func unwrapChaos(link Link) Link {
+	if cl, ok := link.(*ChaosLink); ok {
+		return cl.Link
+	}
+	return link
+}
+
+// rewrapChaos wraps the link with the chaos config of the given previous
+// link, if it had fault injection enabled.
+func rewrapChaos(previous, link Link) Link {
+	if cl, ok := previous.(*ChaosLink); ok {
+		return &ChaosLink{
+			Link: link,
+			cfg:  cl.Config(),
+		}
+	}
+	return link
+}
+
+// SendPriority sends a priority frame to the peer.
+func (cl *ChaosLink) SendPriority(f frame.Frame) error {
+	cl.inject(f, cl.Link.SendPriority)
+	return nil
+}
+
+// Send sends a frame to the peer.
+func (cl *ChaosLink) Send(f frame.Frame) error {
+	cl.inject(f, cl.Link.Send)
+	return nil
+}
+
+func (cl *ChaosLink) inject(f frame.Frame, send func(frame.Frame) error) {
+	cfg := cl.Config()
+
+	// Drop frame.
+	if cfg.Loss > 0 && rand.Float64() < cfg.Loss { //nolint:gosec // Not used for security.
+		f.ReturnToPool()
+		return
+	}
+
+	// Duplicate frame.
+	if cfg.Duplicate > 0 && rand.Float64() < cfg.Duplicate { //nolint:gosec // Not used for security.
+		cl.sendDelayed(f.Clone(), cfg, send)
+	}
+
+	cl.sendDelayed(f, cfg, send)
+}
+
+func (cl *ChaosLink) sendDelayed(f frame.Frame, cfg ChaosConfig, send func(frame.Frame) error) {
+	// Calculate delay.
+	delay := cfg.Latency
+	if cfg.Jitter > 0 {
+		delay += rand.N(cfg.Jitter) //nolint:gosec // Not used for security.
+	}
+	if cfg.Reorder > 0 && rand.Float64() < cfg.Reorder { //nolint:gosec // Not used for security.
+		// Hold back frame long enough for following frames to overtake it.
+		delay += max(2*cfg.Jitter, 10*time.Millisecond)
+	}
+
+	// Send frame.
+	if delay <= 0 {
+		_ = send(f)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		if cl.IsClosing() {
+			f.ReturnToPool()
+			return
+		}
+		_ = send(f)
+	})
+}
+
+// SetLinkChaos enables fault injection with the given config on the link to
+// the given peer. Only available in development mode.
+func (p *Peering) SetLinkChaos(peer netip.Addr, cfg ChaosConfig) error {
+	if !p.instance.Config().DevMode() {
+		return ErrChaosRequiresDevMode
+	}
+	if err := cfg.Check(); err != nil {
+		return err
+	}
+
+	p.linksLock.Lock()
+	defer p.linksLock.Unlock()
+
+	link, ok := p.links[peer]
+	if !ok {
+		return ErrLinkNotFound
+	}
+
+	// Update existing chaos link.
+	if cl, ok := link.(*ChaosLink); ok {
+		cl.lock.Lock()
+		defer cl.lock.Unlock()
+
+		cl.cfg = cfg
+		return nil
+	}
+
+	// Wrap link.
+	cl := &ChaosLink{
+		Link: link,
+		cfg:  cfg,
+	}
+	p.links[peer] = cl
+	p.linksByLabel[link.SwitchLabel()] = cl
+
+	p.mgr.Warn(
+		"fault injection enabled on link",
+		"router", peer,
+		"chaos", cfg.String(),
+	)
+	return nil
+}
+
+// ClearLinkChaos disables fault injection on the link to the given peer.
+func (p *Peering) ClearLinkChaos(peer netip.Addr) error {
+	p.linksLock.Lock()
+	defer p.linksLock.Unlock()
+
+	link, ok := p.links[peer]
+	if !ok {
+		return ErrLinkNotFound
+	}
+	cl, ok := link.(*ChaosLink)
+	if !ok {
+		return nil
+	}
+
+	// Unwrap link.
+	p.links[peer] = cl.Link
+	p.linksByLabel[cl.SwitchLabel()] = cl.Link
+
+	p.mgr.Info(
+		"fault injection disabled on link",
+		"router", peer,
+	)
+	return nil
+}
+
+// LinkChaos is a link with fault injection enabled.
+type LinkChaos struct {
+	Peer   netip.Addr
+	Config ChaosConfig
+}
+
+// ExportLinkChaos returns all links with fault injection enabled.
+func (p *Peering) ExportLinkChaos() []LinkChaos {
+	p.linksLock.RLock()
+	defer p.linksLock.RUnlock()
+
+	var export []LinkChaos
+	for peer, link := range p.links {
+		if cl, ok := link.(*ChaosLink); ok {
+			export = append(export, LinkChaos{
+				Peer:   peer,
+				Config: cl.Config(),
+			})
+		}
+	}
+
+	// Sort.
+	slices.SortFunc[[]LinkChaos, LinkChaos](export, func(a, b LinkChaos) int {
+		return a.Peer.Compare(b.Peer)
+	})
+
+	return export
+}
@@ -0,0 +1,56 @@
+package peering
+
+import (
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ClockSkew estimates how far the local clock is behind the clocks of the
+// connected peers. It returns the median clock skew of all peers, which is
+// positive if the local clock is behind.
+func (p *Peering) ClockSkew() (skew time.Duration, peers int) {
+	links := p.GetLinks()
+	if len(links) == 0 {
+		return 0, 0
+	}
+
+	skews := make([]time.Duration, 0, len(links))
+	for _, link := range links {
+		skews = append(skews, link.ClockSkew())
+	}
+	slices.Sort(skews)
+	return skews[len(skews)/2], len(skews)
+}
+
+// checkClockSkew warns when the clock of the peer of a new link is off, or
+// when the local clock appears to be off compared to all peers.
+// Signatures and announcements of routers with a skewed clock may be rejected
+// by others, which is hard to debug on devices without a real time clock.
+func (p *Peering) checkClockSkew(link Link) {
+	if link.ClockSkew().Abs() > m.ClockSkewTolerance {
+		p.mgr.Warn(
+			"clock skew with peer detected",
+			"router", link.Peer(),
+			"skew", link.ClockSkew(),
+		)
+	}
+
+	// Check if the local clock is off.
+	skew, peers := p.ClockSkew()
+	switch {
+	case skew.Abs() > m.ClockSkewCritical:
+		p.mgr.Error(
+			"local clock is off compared to peers, time based checks of other routers will fail: please check the system time and NTP",
+			"skew", skew,
+			"peers", peers,
+		)
+	case skew.Abs() > m.ClockSkewTolerance:
+		p.mgr.Warn(
+			"local clock is off compared to peers: please check the system time and NTP",
+			"skew", skew,
+			"peers", peers,
+		)
+	}
+}
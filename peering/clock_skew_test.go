@@ -0,0 +1,62 @@
+package peering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestClockSkew(t *testing.T) {
+	t.Parallel()
+
+	p := New(getTestInstance(t, config.MakeTestConfig(config.Store{})), nil, nil)
+	p.mgr = mgr.New("peering")
+
+	skew, peers := p.ClockSkew()
+	assert.Zero(t, skew)
+	assert.Zero(t, peers)
+
+	// A single peer with a skewed clock must not dominate the estimate.
+	for _, skew := range []time.Duration{time.Second, 2 * time.Second, time.Hour} {
+		link := addTestLink(t, p)
+		link.clockSkew = skew
+		p.checkClockSkew(link)
+	}
+	skew, peers = p.ClockSkew()
+	assert.Equal(t, 2*time.Second, skew)
+	assert.Equal(t, 3, peers)
+}
+
+func TestPeeringClockSkew(t *testing.T) {
+	t.Parallel()
+
+	// The local clock of B is an hour behind.
+	cA := config.MakeTestConfig(config.Store{})
+	cB := config.MakeTestConfig(config.Store{})
+	cB.SetDevMode(true)
+	require.NoError(t, cB.SetClock(m.NewVirtualClock(time.Now().Add(-time.Hour))))
+
+	peeringA := New(getTestInstance(t, cA), nil, nil)
+	peeringB := New(getTestInstance(t, cB), nil, nil)
+	stateA, msgFromA, err := peeringA.createPeeringRequest(true, nil)
+	require.NoError(t, err)
+	stateB, msgFromB, err := peeringB.createPeeringRequest(false, nil)
+	require.NoError(t, err)
+	for msgFromA != nil || msgFromB != nil {
+		newMsgFromA, err := stateA.handle(msgFromB)
+		require.NoError(t, err)
+		newMsgFromB, err := stateB.handle(msgFromA)
+		require.NoError(t, err)
+		msgFromA, msgFromB = newMsgFromA, newMsgFromB
+	}
+
+	// The skew is measured with the configured clock.
+	assert.Zero(t, stateA.clockSkew, "A must see the clock of B in sync")
+	assert.Equal(t, time.Hour, stateB.clockSkew, "B must see the clock of A ahead")
+}
@@ -0,0 +1,158 @@
+package peering
+
+import (
+	"cmp"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ConnectFailureReason describes why connecting to a configured peer failed.
+type ConnectFailureReason string
+
+// Connect failure reasons.
+const (
+	ConnectFailureConfig    ConnectFailureReason = "config"
+	ConnectFailureDNS       ConnectFailureReason = "dns"
+	ConnectFailureNetwork   ConnectFailureReason = "network"
+	ConnectFailureHandshake ConnectFailureReason = "handshake"
+	ConnectFailureVersion   ConnectFailureReason = "version"
+	ConnectFailureUniverse  ConnectFailureReason = "universe"
+	ConnectFailureDenied    ConnectFailureReason = "denied"
+	ConnectFailureLimit     ConnectFailureReason = "limit"
+)
+
+// Hint returns a remediation hint for the failure reason.
+func (reason ConnectFailureReason) Hint() string {
+	switch reason {
+	case ConnectFailureConfig:
+		return "Check the peering URL in router.connect."
+	case ConnectFailureDNS:
+		return "The domain of the peering URL could not be resolved. Check the domain and the DNS settings of this host."
+	case ConnectFailureNetwork:
+		return "The remote router is not reachable. Check the address and port, that the remote router is running and that no firewall blocks the connection."
+	case ConnectFailureHandshake:
+		return "Connected, but the peering handshake failed. Check that the peering URL points to a Mycoria peering listener."
+	case ConnectFailureVersion:
+		return "The remote router runs an incompatible version. Update both routers."
+	case ConnectFailureUniverse:
+		return "The remote router is in another universe. Both routers must use the same router.universe and router.universeSecret."
+	case ConnectFailureDenied:
+		return "The remote router denied peering. Ask its operator to allow peering with this router."
+	case ConnectFailureLimit:
+		return "This router has reached its maximum amount of peers."
+	default:
+		return ""
+	}
+}
+
+// ConnectFailure describes a failing connection to a configured peer.
+type ConnectFailure struct {
+	PeeringURL string               `json:"peeringURL"`
+	Reason     ConnectFailureReason `json:"reason"`
+	Hint       string               `json:"hint,omitempty"`
+	Error      string               `json:"error"`
+	Code       m.ErrorCode          `json:"code,omitempty"`
+
+	// Since is when the connection first failed after the last success.
+	Since time.Time `json:"since"`
+	// Last is when the connection last failed.
+	Last     time.Time `json:"last"`
+	Attempts int       `json:"attempts"`
+}
+
+// classifyConnectError returns the failure reason of a connect error.
+func classifyConnectError(err error) ConnectFailureReason {
+	var (
+		dnsErr *net.DNSError
+		opErr  *net.OpError
+	)
+	switch {
+	case errors.Is(err, ErrUniverseMismatch):
+		return ConnectFailureUniverse
+	case errors.Is(err, ErrRemoteDeniedPeering):
+		// Use the error code of the remote router, if it sent one.
+		switch m.ErrorCodeOf(err) {
+		case m.CodeUniverseMismatch:
+			return ConnectFailureUniverse
+		case m.CodeVersionMismatch:
+			return ConnectFailureVersion
+		}
+		// Older routers only send the error text.
+		switch msg := err.Error(); {
+		case strings.Contains(msg, ErrUniverseMismatch.Error()):
+			return ConnectFailureUniverse
+		case strings.Contains(msg, ErrUnsupportedVersion.Error()):
+			return ConnectFailureVersion
+		}
+		return ConnectFailureDenied
+	case errors.Is(err, ErrUnsupportedVersion):
+		return ConnectFailureVersion
+	case errors.Is(err, ErrTooManyPeers):
+		return ConnectFailureLimit
+	case errors.As(err, &dnsErr):
+		return ConnectFailureDNS
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ConnectFailureNetwork
+	default:
+		return ConnectFailureHandshake
+	}
+}
+
+// recordConnectFailure records a failed connection to a configured peer.
+func (p *Peering) recordConnectFailure(peeringURL string, reason ConnectFailureReason, err error) {
+	now := time.Now()
+
+	p.connectFailuresLock.Lock()
+	defer p.connectFailuresLock.Unlock()
+
+	failure, ok := p.connectFailures[peeringURL]
+	if !ok {
+		failure = &ConnectFailure{
+			PeeringURL: peeringURL,
+			Since:      now,
+		}
+		p.connectFailures[peeringURL] = failure
+	}
+	failure.Reason = reason
+	failure.Hint = reason.Hint()
+	failure.Error = err.Error()
+	failure.Code = m.ErrorCodeOf(err)
+	failure.Last = now
+	failure.Attempts++
+}
+
+// clearConnectFailure removes the failure of a configured peer after
+// connecting successfully.
+func (p *Peering) clearConnectFailure(peeringURL string) {
+	p.connectFailuresLock.Lock()
+	defer p.connectFailuresLock.Unlock()
+
+	delete(p.connectFailures, peeringURL)
+}
+
+// ConnectFailures returns the failing connections to configured peers.
+func (p *Peering) ConnectFailures() []ConnectFailure {
+	configured := p.instance.Config().Router.Connect
+
+	p.connectFailuresLock.Lock()
+	defer p.connectFailuresLock.Unlock()
+
+	failures := make([]ConnectFailure, 0, len(p.connectFailures))
+	for peeringURL, failure := range p.connectFailures {
+		// Forget peers that were removed from the config.
+		if !slices.Contains(configured, peeringURL) {
+			delete(p.connectFailures, peeringURL)
+			continue
+		}
+		failures = append(failures, *failure)
+	}
+	slices.SortFunc(failures, func(a, b ConnectFailure) int {
+		return cmp.Compare(a.PeeringURL, b.PeeringURL)
+	})
+	return failures
+}
@@ -0,0 +1,81 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestClassifyConnectError(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, ConnectFailureNetwork, classifyConnectError(
+		fmt.Errorf("connect to [::1]:47369: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+	))
+	assert.Equal(t, ConnectFailureDNS, classifyConnectError(
+		&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.com"}},
+	))
+	assert.Equal(t, ConnectFailureUniverse, classifyConnectError(
+		fmt.Errorf("%w: %s", ErrRemoteDeniedPeering, ErrUniverseMismatch),
+	))
+	assert.Equal(t, ConnectFailureDenied, classifyConnectError(
+		fmt.Errorf("%w: %s", ErrRemoteDeniedPeering, ErrTooManyPeers),
+	))
+	assert.Equal(t, ConnectFailureVersion, classifyConnectError(
+		m.WithCode(m.CodeVersionMismatch, fmt.Errorf("%w: %s", ErrRemoteDeniedPeering, "schema too old")),
+	), "error code of the remote router must be used")
+	assert.Equal(t, ConnectFailureDenied, classifyConnectError(
+		m.WithCode(remoteErrCode("made-up"), fmt.Errorf("%w: %s", ErrRemoteDeniedPeering, "denied")),
+	), "unknown error codes of the remote router must be ignored")
+	assert.Equal(t, ConnectFailureLimit, classifyConnectError(ErrTooManyPeers))
+	assert.Equal(t, ConnectFailureHandshake, classifyConnectError(errors.New("read peering msg 1: EOF")))
+}
+
+func TestUniverseMismatchDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	cA := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Universe: "test",
+			Connect:  []string{"tcp://[fd00::1]:47369"},
+		},
+	})
+	cB := config.MakeTestConfig(config.Store{})
+	peeringA := New(getTestInstance(t, cA), nil, nil)
+	peeringB := New(getTestInstance(t, cB), nil, nil)
+
+	// Both routers detect the mismatch.
+	stateA, msgFromA, err := peeringA.createPeeringRequest(true, nil)
+	require.NoError(t, err)
+	stateB, msgFromB, err := peeringB.createPeeringRequest(false, nil)
+	require.NoError(t, err)
+	respFromB, err := stateB.handle(msgFromA)
+	require.ErrorIs(t, err, ErrUniverseMismatch, "B must detect universe mismatch")
+	require.NotNil(t, respFromB, "B must send an error response")
+	_, err = stateA.handle(msgFromB)
+	require.ErrorIs(t, err, ErrUniverseMismatch, "A must detect universe mismatch")
+
+	// Record and check failure.
+	reason := classifyConnectError(err)
+	assert.Equal(t, ConnectFailureUniverse, reason)
+	assert.Equal(t, m.CodeUniverseMismatch, m.ErrorCodeOf(err))
+	peeringA.recordConnectFailure(cA.Router.Connect[0], reason, err)
+	peeringA.recordConnectFailure(cA.Router.Connect[0], reason, err)
+	peeringA.recordConnectFailure("tcp://[fd00::2]:47369", reason, err)
+	failures := peeringA.ConnectFailures()
+	require.Len(t, failures, 1, "only configured peers must be reported")
+	assert.Equal(t, 2, failures[0].Attempts)
+	assert.NotEmpty(t, failures[0].Hint)
+	assert.Equal(t, m.CodeUniverseMismatch, failures[0].Code)
+
+	// Success clears failure.
+	peeringA.clearConnectFailure(cA.Router.Connect[0])
+	assert.Empty(t, peeringA.ConnectFailures())
+}
@@ -13,6 +13,12 @@ type EventState string
 
 // Peering Event States.
 const (
-	EventStateUp   = "up"
-	EventStateDown = "down"
+	EventStateUp        = "up"
+	EventStateDown      = "down"
+	EventStateRelabeled = "relabeled"
+	EventStateBonded    = "bonded"
+	EventStateUnbonded  = "unbonded"
+	// EventStateDraining signifies that the link to the peer is draining, as
+	// it is outside of its peering schedule.
+	EventStateDraining = "draining"
 )
@@ -0,0 +1,464 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// Forward Error Correction (FEC)
+//
+// FEC protects link frames with Reed-Solomon parity records. Link frames are
+// grouped by their sequence number into groups of n, and the sender sends p
+// parity records after each complete group. The receiver can recover up to p
+// link frames of a group that were lost or damaged, without waiting for a
+// retransmit.
+//
+// Link frames are sent unchanged. Parity records are distinguished by their
+// version byte and are only sent after link encryption is set up.
+//
+// Parity Record:
+// --- 8B
+// - Length (uint16)
+// - Version (uint8) [always fecParityVersion]
+// - Parity Index (uint8)
+// - Group (uint32) [sequence number of the first link frame of the group]
+// --- ~B
+// - Parity Shard []byte
+
+const (
+	fecParityVersion    = 0xFE
+	fecParityHeaderSize = 8
+
+	maxFECDataShards   = 64
+	maxFECParityShards = 16
+)
+
+// FEC errors.
+var (
+	ErrFECOutOfSync = errors.New("fec parity record out of sync")
+	ErrFECInvalid   = errors.New("invalid fec parity record")
+)
+
+// FECParams defines the size of FEC groups.
+type FECParams struct {
+	Data   uint8 `cbor:"d" json:"d"`
+	Parity uint8 `cbor:"p" json:"p"`
+}
+
+// parseFECParams parses the fec parameter of a peering URL in the format
+// "<data>:<parity>", eg. "8:2". It returns nil if the value is empty.
+func parseFECParams(value string) (*FECParams, error) {
+	if value == "" {
+		return nil, nil //nolint:nilnil // FEC is not enabled.
+	}
+
+	dataValue, parityValue, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid fec %q: must be <data>:<parity>", value)
+	}
+	data, err := strconv.ParseUint(dataValue, 10, 8)
+	if err != nil || data < 1 || data > maxFECDataShards {
+		return nil, fmt.Errorf("invalid fec %q: data must be between 1 and %d", value, maxFECDataShards)
+	}
+	parity, err := strconv.ParseUint(parityValue, 10, 8)
+	if err != nil || parity < 1 || parity > maxFECParityShards {
+		return nil, fmt.Errorf("invalid fec %q: parity must be between 1 and %d", value, maxFECParityShards)
+	}
+	return &FECParams{
+		Data:   uint8(data),
+		Parity: uint8(parity),
+	}, nil
+}
+
+// check checks if the params are valid, eg. when received from a peer.
+func (params *FECParams) check() error {
+	switch {
+	case params.Data < 1 || params.Data > maxFECDataShards:
+		return fmt.Errorf("fec data must be between 1 and %d", maxFECDataShards)
+	case params.Parity < 1 || params.Parity > maxFECParityShards:
+		return fmt.Errorf("fec parity must be between 1 and %d", maxFECParityShards)
+	}
+	return nil
+}
+
+// String returns the params in the peering URL format.
+func (params *FECParams) String() string {
+	return fmt.Sprintf("%d:%d", params.Data, params.Parity)
+}
+
+// isFECParityRecord returns whether the given record is a parity record.
+func isFECParityRecord(record []byte) bool {
+	return len(record) > 2 && record[2] == fecParityVersion
+}
+
+// fecEncoder creates parity records for sent link frames.
+type fecEncoder struct {
+	params FECParams
+	// group is the sequence number of the first link frame of the current group.
+	group uint32
+	// shards holds the sent link frames of the current group at their slot.
+	shards [][]byte
+	added  int
+
+	// offset and overhead are the transport margins reserved around every
+	// parity record.
+	offset   int
+	overhead int
+}
+
+func newFECEncoder(params FECParams) *fecEncoder {
+	return &fecEncoder{
+		params: params,
+		shards: make([][]byte, params.Data),
+	}
+}
+
+// fecGroup returns the sequence number of the first link frame of the group
+// of the given sequence number, and the slot within the group.
+func fecGroup(params FECParams, seqNum uint32) (group uint32, slot int) {
+	slot = int(seqNum % uint32(params.Data))
+	return seqNum - uint32(slot), slot
+}
+
+// add adds a sent and sealed link frame to its group.
+// It returns the parity records to send when the group is complete.
+func (enc *fecEncoder) add(record []byte) [][]byte {
+	group, slot := fecGroup(enc.params, LinkFrame(record).SequenceNum())
+	if group != enc.group {
+		// Incomplete groups, eg. at the start, are not protected.
+		enc.group = group
+		enc.added = 0
+		clear(enc.shards)
+	}
+	if enc.shards[slot] == nil {
+		enc.added++
+	}
+	enc.shards[slot] = slices.Clone(record)
+	if enc.added < int(enc.params.Data) {
+		return nil
+	}
+	defer func() {
+		enc.added = 0
+		clear(enc.shards)
+	}()
+
+	// Get shard size.
+	var size int
+	for _, shard := range enc.shards {
+		size = max(size, len(shard))
+	}
+	if fecParityHeaderSize+size > 0xFFFF {
+		// Group cannot be protected.
+		return nil
+	}
+
+	// Create parity records.
+	records := make([][]byte, enc.params.Parity)
+	for i := range records {
+		withMargins := make([]byte, enc.offset+fecParityHeaderSize+size+enc.overhead)
+		record := withMargins[enc.offset : len(withMargins)-enc.overhead]
+		m.PutUint16(record[0:2], uint16(len(record)))
+		record[2] = fecParityVersion
+		record[3] = uint8(i)
+		m.PutUint32(record[4:8], enc.group)
+
+		parity := record[fecParityHeaderSize:]
+		for j, shard := range enc.shards {
+			gfMulAdd(parity, shard, fecCoefficient(enc.params, i, j))
+		}
+		records[i] = withMargins
+	}
+	return records
+}
+
+// fecDecoder recovers lost or damaged link frames using parity records.
+// Link frames are placed into groups by their sequence number, so that
+// reordered or lost link frames do not shift the groups.
+type fecDecoder struct {
+	params FECParams
+	// group is the sequence number of the first link frame of the current group.
+	group uint32
+
+	// data holds the received link frames of the current group at their slot.
+	// Lost link frames are nil.
+	data [][]byte
+	// parity holds the received parity shards of the current group.
+	parity [][]byte
+
+	// recovered holds recovered link frames that were not read yet.
+	recovered [][]byte
+}
+
+func newFECDecoder(params FECParams) *fecDecoder {
+	return &fecDecoder{
+		params: params,
+		data:   make([][]byte, params.Data),
+		parity: make([][]byte, params.Parity),
+	}
+}
+
+// addData adds a received link frame to its group.
+// The record must be a copy of the link frame before it was decrypted and
+// must only be added after the link frame was authenticated, as its sequence
+// number is trusted. Link frames of previous groups are ignored.
+func (dec *fecDecoder) addData(record []byte) {
+	group, slot := fecGroup(dec.params, LinkFrame(record).SequenceNum())
+	if !dec.seek(group) {
+		return
+	}
+	dec.data[slot] = record
+}
+
+// seek switches to the given group, if it is newer than the current group.
+// It returns false if the group is older than the current group.
+func (dec *fecDecoder) seek(group uint32) bool {
+	switch diff := int32(group - dec.group); {
+	case diff == 0:
+		return true
+	case diff > 0:
+		dec.group = group
+		clear(dec.data)
+		clear(dec.parity)
+		return true
+	default:
+		return false
+	}
+}
+
+// addParity adds a received parity record and recovers lost link frames,
+// if enough shards are available.
+func (dec *fecDecoder) addParity(record []byte) error {
+	if len(record) <= fecParityHeaderSize || !isFECParityRecord(record) {
+		return ErrFECInvalid
+	}
+	index := int(record[3])
+	group := m.GetUint32(record[4:8])
+	switch {
+	case index >= len(dec.parity):
+		return ErrFECInvalid
+	case group%uint32(dec.params.Data) != 0:
+		return ErrFECInvalid
+	case !dec.seek(group):
+		return ErrFECOutOfSync
+	}
+	dec.parity[index] = slices.Clone(record[fecParityHeaderSize:])
+
+	// Check if we can recover.
+	var missing, available int
+	for _, shard := range dec.data {
+		if shard == nil {
+			missing++
+		}
+	}
+	for _, shard := range dec.parity {
+		if shard != nil {
+			available++
+		}
+	}
+	if missing == 0 || available < missing {
+		return nil
+	}
+
+	// Recover lost link frames.
+	recovered, err := fecReconstruct(dec.params, dec.data, dec.parity)
+	if err != nil {
+		return err
+	}
+	for i, record := range recovered {
+		if record == nil {
+			continue
+		}
+		dec.data[i] = record
+		dec.recovered = append(dec.recovered, record)
+	}
+	return nil
+}
+
+// hasRecovered returns whether there are recovered link frames to read.
+func (dec *fecDecoder) hasRecovered() bool {
+	return dec != nil && len(dec.recovered) > 0
+}
+
+// nextRecovered returns the next recovered link frame, if available.
+func (dec *fecDecoder) nextRecovered() []byte {
+	if dec == nil || len(dec.recovered) == 0 {
+		return nil
+	}
+	record := dec.recovered[0]
+	dec.recovered = dec.recovered[1:]
+	return record
+}
+
+// fecReconstruct recovers the missing data shards using the available parity
+// shards. It returns the recovered link frames at their index.
+func fecReconstruct(params FECParams, data, parity [][]byte) ([][]byte, error) {
+	k := int(params.Data)
+
+	// Select k available shards and build the matching rows of the encoding
+	// matrix. Data shards have identity rows.
+	var size int
+	for _, shard := range parity {
+		size = max(size, len(shard))
+	}
+	matrix := make([][]byte, 0, k)
+	shards := make([][]byte, 0, k)
+	for j, shard := range data {
+		if shard == nil {
+			continue
+		}
+		if len(shard) > size {
+			return nil, ErrFECInvalid
+		}
+		row := make([]byte, k)
+		row[j] = 1
+		matrix = append(matrix, row)
+		shards = append(shards, shard)
+	}
+	for i, shard := range parity {
+		if len(matrix) == k {
+			break
+		}
+		if shard == nil {
+			continue
+		}
+		row := make([]byte, k)
+		for j := range row {
+			row[j] = fecCoefficient(params, i, j)
+		}
+		matrix = append(matrix, row)
+		shards = append(shards, shard)
+	}
+	if len(matrix) < k {
+		return nil, errors.New("not enough shards to recover")
+	}
+
+	inverse, err := gfInvertMatrix(matrix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compute missing data shards.
+	recovered := make([][]byte, k)
+	for j, shard := range data {
+		if shard != nil {
+			continue
+		}
+		out := make([]byte, size)
+		for l, src := range shards {
+			gfMulAdd(out, src, inverse[j][l])
+		}
+
+		// Trim padding using the record length.
+		length := int(m.GetUint16(out[0:2]))
+		if length <= 3 || length > size {
+			return nil, ErrFECInvalid
+		}
+		recovered[j] = out[:length]
+	}
+	return recovered, nil
+}
+
+// fecCoefficient returns the coefficient of the given data shard for the given
+// parity shard. Parity rows form a Cauchy matrix, so that any combination of
+// data and parity shards can recover the group.
+func fecCoefficient(params FECParams, parityIndex, dataIndex int) byte {
+	x := byte(int(params.Data) + parityIndex)
+	y := byte(dataIndex)
+	return gfInv(x ^ y)
+}
+
+// Galois field GF(2^8) arithmetic with the polynomial 0x11d.
+
+var gfExp, gfLog = makeGFTables()
+
+func makeGFTables() (exp [510]byte, log [256]byte) {
+	x := 1
+	for i := range 255 {
+		exp[i] = byte(x)
+		exp[i+255] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// gfInv returns the multiplicative inverse. The input must not be zero.
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd adds src multiplied by c to dst.
+// Dst must be at least as long as src.
+func gfMulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	logC := int(gfLog[c])
+	for i, v := range src {
+		if v != 0 {
+			dst[i] ^= gfExp[logC+int(gfLog[v])]
+		}
+	}
+}
+
+// gfInvertMatrix inverts the given square matrix using Gauss-Jordan
+// elimination. The input matrix is modified.
+func gfInvertMatrix(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+	inverse := make([][]byte, n)
+	for i := range inverse {
+		inverse[i] = make([]byte, n)
+		inverse[i][i] = 1
+	}
+
+	for col := range n {
+		// Find pivot.
+		pivot := -1
+		for row := col; row < n; row++ {
+			if matrix[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, errors.New("matrix is singular")
+		}
+		matrix[col], matrix[pivot] = matrix[pivot], matrix[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+
+		// Normalize pivot row.
+		if c := matrix[col][col]; c != 1 {
+			cInv := gfInv(c)
+			for i := range n {
+				matrix[col][i] = gfMul(matrix[col][i], cInv)
+				inverse[col][i] = gfMul(inverse[col][i], cInv)
+			}
+		}
+
+		// Eliminate column in other rows.
+		for row := range n {
+			if row == col || matrix[row][col] == 0 {
+				continue
+			}
+			c := matrix[row][col]
+			gfMulAdd(matrix[row], matrix[col], c)
+			gfMulAdd(inverse[row], inverse[col], c)
+		}
+	}
+	return inverse, nil
+}
@@ -0,0 +1,169 @@
+package peering
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFEC(t *testing.T) {
+	t.Parallel()
+
+	params := FECParams{Data: 8, Parity: 3}
+	enc := newFECEncoder(params)
+	dec := newFECDecoder(params)
+
+	for group := range 10 {
+		// Create group of records with random sizes.
+		records := make([][]byte, params.Data)
+		var parity [][]byte
+		for i := range records {
+			record := make([]byte, 20+rand.IntN(1000)) //nolint:gosec
+			for j := range record {
+				record[j] = byte(rand.IntN(256)) //nolint:gosec
+			}
+			lf := LinkFrame(record)
+			lf.SetLength(uint16(len(record)))
+			lf.SetSequenceNum(uint32((group+1)*int(params.Data) + i))
+			records[i] = record
+			parity = enc.add(record)
+		}
+		require.Len(t, parity, int(params.Parity), "group %d", group)
+
+		// Lose up to parity records and reorder the others.
+		lost := make(map[int]bool)
+		for range group % (int(params.Parity) + 1) {
+			lost[rand.IntN(int(params.Data))] = true //nolint:gosec
+		}
+		for _, i := range rand.Perm(len(records)) { //nolint:gosec
+			if !lost[i] {
+				dec.addData(slices.Clone(records[i]))
+			}
+		}
+		for _, record := range parity {
+			require.NoError(t, dec.addParity(record), "group %d", group)
+		}
+
+		// Check recovered records.
+		var recovered int
+		for i := range records {
+			if !lost[i] {
+				continue
+			}
+			recovered++
+			assert.Equal(t, records[i], dec.nextRecovered(), "group %d record %d", group, i)
+		}
+		assert.Len(t, lost, recovered)
+		assert.False(t, dec.hasRecovered(), "group %d", group)
+	}
+}
+
+func TestFECTooManyLost(t *testing.T) {
+	t.Parallel()
+
+	params := FECParams{Data: 4, Parity: 1}
+	enc := newFECEncoder(params)
+	dec := newFECDecoder(params)
+
+	var parity [][]byte
+	for i := range int(params.Data) {
+		record := newTestFECRecord(uint32(params.Data) + uint32(i))
+		parity = enc.add(record)
+		if i >= 2 {
+			dec.addData(record)
+		}
+	}
+	require.NoError(t, dec.addParity(parity[0]))
+	assert.False(t, dec.hasRecovered(), "two lost records cannot be recovered with one parity")
+
+	// Parity of an invalid group must be rejected.
+	parity[0][7]++
+	assert.ErrorIs(t, dec.addParity(parity[0]), ErrFECInvalid)
+}
+
+func TestFECGroups(t *testing.T) {
+	t.Parallel()
+
+	params := FECParams{Data: 4, Parity: 1}
+	enc := newFECEncoder(params)
+	dec := newFECDecoder(params)
+
+	// The first group is incomplete, as sequence numbers start at 1.
+	for seq := range uint32(12) {
+		if seq == 0 {
+			continue
+		}
+		parity := enc.add(newTestFECRecord(seq))
+		if seq%4 == 3 && seq > 3 {
+			assert.Len(t, parity, 1, "complete group must be protected")
+		} else {
+			assert.Empty(t, parity, "seq %d", seq)
+		}
+	}
+
+	// Create parity of two groups.
+	var first, second [][]byte
+	records := make(map[uint32][]byte)
+	for seq := uint32(12); seq < 20; seq++ {
+		records[seq] = newTestFECRecord(seq)
+		if parity := enc.add(records[seq]); parity != nil {
+			if first == nil {
+				first = parity
+			} else {
+				second = parity
+			}
+		}
+	}
+
+	// Lose a link frame of the first group and receive the others reordered.
+	// The lost link frame must be recovered in its slot.
+	dec.addData(slices.Clone(records[15]))
+	dec.addData(slices.Clone(records[12]))
+	dec.addData(slices.Clone(records[14]))
+	require.NoError(t, dec.addParity(first[0]))
+	assert.Equal(t, records[13], dec.nextRecovered())
+
+	// Link frames and parity of previous groups are rejected.
+	dec.addData(slices.Clone(records[16]))
+	dec.addData(slices.Clone(records[13]))
+	assert.ErrorIs(t, dec.addParity(first[0]), ErrFECOutOfSync)
+	assert.False(t, dec.hasRecovered())
+
+	// A group with too many lost link frames is not recovered wrongly.
+	dec.addData(slices.Clone(records[18]))
+	require.NoError(t, dec.addParity(second[0]))
+	assert.False(t, dec.hasRecovered(), "two lost records cannot be recovered with one parity")
+}
+
+func newTestFECRecord(seq uint32) []byte {
+	record := make([]byte, 100)
+	for i := FrameOffset; i < len(record); i++ {
+		record[i] = byte(rand.IntN(256)) //nolint:gosec
+	}
+	lf := LinkFrame(record)
+	lf.SetLength(uint16(len(record)))
+	lf.SetVersion(1)
+	lf.SetSequenceNum(seq)
+	return record
+}
+
+func TestParseFECParams(t *testing.T) {
+	t.Parallel()
+
+	params, err := parseFECParams("")
+	require.NoError(t, err)
+	assert.Nil(t, params)
+
+	params, err = parseFECParams("8:2")
+	require.NoError(t, err)
+	assert.Equal(t, &FECParams{Data: 8, Parity: 2}, params)
+	assert.Equal(t, "8:2", params.String())
+
+	for _, value := range []string{"8", "0:2", "8:0", "65:2", "8:17", "a:b"} {
+		_, err = parseFECParams(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,95 @@
+package peering
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/geoip"
+)
+
+// loadGeoVerifier loads the configured GeoIP database for verifying the geo
+// markers of peers. Verification is optional, so errors only disable it.
+func (p *Peering) loadGeoVerifier() {
+	path := p.instance.Config().Router.GeoIPDatabase
+	if path == "" {
+		return
+	}
+
+	db, err := geoip.Open(path)
+	if err != nil {
+		p.mgr.Warn(
+			"failed to load geoip database, geo marker verification is disabled",
+			"path", path,
+			"err", err,
+		)
+		return
+	}
+	p.geoVerifier = geoip.NewVerifier(db)
+	p.mgr.Info(
+		"loaded geoip database for geo marker verification",
+		"path", path,
+		"type", db.DatabaseType,
+	)
+}
+
+// verifyGeoMarker verifies the claimed geo marker of the peer of a new link
+// against the location of its underlay address and warns about large
+// mismatches. Geo markers are chosen freely by routers, so a router could
+// claim to be elsewhere in order to attract traffic.
+func (p *Peering) verifyGeoMarker(link Link) {
+	if p.geoVerifier == nil {
+		return
+	}
+
+	// Get underlay IP. Links over UNIX sockets have none.
+	addrPort, err := netip.ParseAddrPort(link.RemoteAddr().String())
+	if err != nil {
+		return
+	}
+
+	result, ok, err := p.geoVerifier.Verify(link.Peer(), addrPort.Addr())
+	switch {
+	case err != nil:
+		p.mgr.Warn(
+			"failed to verify geo marker of peer",
+			"router", link.Peer(),
+			"address", addrPort.Addr(),
+			"err", err,
+		)
+	case !ok:
+		// Not verifiable.
+	case result.Flagged():
+		p.mgr.Warn(
+			"geo marker of peer does not match location of its address",
+			"router", link.Peer(),
+			"address", addrPort.Addr(),
+			"claimed", result.Claimed,
+			"located", result.Located,
+			"mismatch", result.Mismatch,
+		)
+	}
+}
+
+// GeoMismatchPenalty returns the delay that is added to routes through the
+// given peer, if it was flagged for a large geo marker mismatch.
+func (p *Peering) GeoMismatchPenalty(peer netip.Addr) time.Duration {
+	penalty := p.instance.Config().Router.GeoMismatchPenalty
+	if penalty == 0 || p.geoVerifier == nil || !p.geoVerifier.Flagged(peer) {
+		return 0
+	}
+	return time.Duration(penalty) * time.Millisecond
+}
+
+// GeoVerifications returns the geo marker verification results of connected
+// peers, by router. Returns nil if verification is disabled.
+func (p *Peering) GeoVerifications() map[netip.Addr]geoip.Verification {
+	if p.geoVerifier == nil {
+		return nil
+	}
+
+	results := make(map[netip.Addr]geoip.Verification)
+	for _, result := range p.geoVerifier.Results() {
+		results[result.Router] = result
+	}
+	return results
+}
@@ -17,8 +17,10 @@ import (
 
 // Peering Errors.
 var (
-	ErrUnsupportedVersion  = errors.New("unsupported version")
-	ErrRemoteDeniedPeering = errors.New("remote denied peering")
+	ErrUnsupportedVersion  = m.NewError(m.CodeVersionMismatch, "unsupported version")
+	ErrRemoteDeniedPeering = m.NewError(m.CodePeeringDenied, "remote denied peering")
+	ErrUniverseMismatch    = m.NewError(m.CodeUniverseMismatch, "universe mismatch")
+	ErrAlreadyConnected    = errors.New("already connected to this router")
 )
 
 const (
@@ -43,9 +45,32 @@ type peeringRequestState struct { //nolint:maligned
 	remoteVersion string
 	remoteLite    bool
 	challenge     []byte
+
+	// remoteCapabilities holds the protocol features the remote router
+	// supports.
+	remoteCapabilities m.Capabilities
+
+	// fecOut and fecIn hold the negotiated forward error correction.
+	fecOut *FECParams
+	fecIn  *FECParams
+
+	// clockSkew holds how far the clock of the remote router is ahead,
+	// derived from the signed sequence time of its peering request.
+	clockSkew time.Duration
+
+	// remoteAddr is the underlay address the remote router connects from, as
+	// seen by this router. It is reported back to the remote router.
+	remoteAddr netip.AddrPort
+	// observedAddr is the underlay address of this router, as seen by the
+	// remote router.
+	observedAddr netip.AddrPort
 }
 
-type peeringRequest struct {
+// HandshakeRequest is the first message both routers send when peering.
+type HandshakeRequest struct {
+	// SchemaVersion is the version of the peering message schema.
+	SchemaVersion uint8 `cbor:"sv,omitempty" json:"sv,omitempty"`
+
 	RouterVersion string `cbor:"v,omitempty"  json:"v,omitempty"`
 	Universe      string `cbor:"u,omitempty"  json:"u,omitempty"`
 	LiteMode      bool   `cbor:"lm,omitempty" json:"lm,omitempty"`
@@ -55,30 +80,62 @@ type peeringRequest struct {
 
 	LinkVersion int `cbor:"lv,omitempty"   json:"lv,omitempty"`
 	TunMTU      int `cbor:"tmtu,omitempty" json:"tmtu,omitempty"`
+
+	// Bonding signals that the router accepts multiple links.
+	Bonding bool `cbor:"bond,omitempty" json:"bond,omitempty"`
+
+	// FEC holds the forward error correction the router will send with, if the
+	// remote router supports it.
+	FEC *FECParams `cbor:"fec,omitempty" json:"fec,omitempty"`
+	// FECSupport signals that the router can receive forward error correction.
+	// Superseded by m.CapFEC, but still sent for older routers.
+	FECSupport bool `cbor:"fecs,omitempty" json:"fecs,omitempty"`
+
+	// Capabilities holds the protocol features the router supports.
+	Capabilities m.Capabilities `cbor:"cap,omitempty" json:"cap,omitempty"`
 }
 
-type peeringResponse struct {
+// HandshakeResponse answers the challenge of the peering request.
+type HandshakeResponse struct {
+	// SchemaVersion is the version of the peering message schema.
+	SchemaVersion uint8 `cbor:"sv,omitempty" json:"sv,omitempty"`
+
 	Challenge       []byte `cbor:"c,omitempty"   json:"c,omitempty"`
 	UniverseAuth    []byte `cbor:"ua,omitempty"  json:"ua,omitempty"`
 	KeyExchange     []byte `cbor:"kx,omitempty"  json:"kx,omitempty"`
 	KeyExchangeType string `cbor:"kxt,omitempty" json:"kxt,omitempty"`
 
-	Err string `cbor:"err,omitempty" json:"err,omitempty"`
+	// ObservedAddr is the underlay address the receiving router connects
+	// from, as seen by the sending router.
+	ObservedAddr string `cbor:"oa,omitempty" json:"oa,omitempty"`
+
+	Err     string      `cbor:"err,omitempty" json:"err,omitempty"`
+	ErrCode m.ErrorCode `cbor:"ec,omitempty"  json:"ec,omitempty"`
 }
 
-type peeringAck struct {
+// HandshakeAck acknowledges the peering response and completes the key
+// exchange.
+type HandshakeAck struct {
+	// SchemaVersion is the version of the peering message schema.
+	SchemaVersion uint8 `cbor:"sv,omitempty" json:"sv,omitempty"`
+
 	Ack             bool   `cbor:"ack,omitempty" json:"ack,omitempty"`
 	KeyExchange     []byte `cbor:"kx,omitempty"  json:"kx,omitempty"`
 	KeyExchangeType string `cbor:"kxt,omitempty" json:"kxt,omitempty"`
 
-	Err string `cbor:"err,omitempty" json:"err,omitempty"`
+	Err     string      `cbor:"err,omitempty" json:"err,omitempty"`
+	ErrCode m.ErrorCode `cbor:"ec,omitempty"  json:"ec,omitempty"`
 }
 
+// peeringErr is sent instead of a response or ack if peering failed.
+// The error code allows the remote router to tell apart failures, such as a
+// universe mismatch, without matching the error message.
 type peeringErr struct {
-	Err string `cbor:"err,omitempty" json:"err,omitempty"`
+	Err     string      `cbor:"err,omitempty" json:"err,omitempty"`
+	ErrCode m.ErrorCode `cbor:"ec,omitempty"  json:"ec,omitempty"`
 }
 
-func (p *Peering) createPeeringRequest(client bool) (*peeringRequestState, frame.Frame, error) {
+func (p *Peering) createPeeringRequest(client bool, fec *FECParams) (*peeringRequestState, frame.Frame, error) {
 	challenge := make([]byte, challengeSize)
 	_, err := rand.Read(challenge)
 	if err != nil {
@@ -86,7 +143,8 @@ func (p *Peering) createPeeringRequest(client bool) (*peeringRequestState, frame
 	}
 
 	// Create request.
-	r := &peeringRequest{
+	r := &HandshakeRequest{
+		SchemaVersion: m.SchemaVersionPeering,
 		RouterVersion: p.instance.Version(),
 		Universe:      p.instance.Config().Router.Universe,
 		LiteMode:      p.instance.Config().Router.Lite,
@@ -94,6 +152,10 @@ func (p *Peering) createPeeringRequest(client bool) (*peeringRequestState, frame
 		Challenge:     challenge,
 		LinkVersion:   1,
 		TunMTU:        p.instance.Config().TunMTU(),
+		Bonding:       p.instance.Config().Router.Bonding,
+		FEC:           fec,
+		FECSupport:    true,
+		Capabilities:  m.LocalCapabilities,
 	}
 	msg, err := cbor.Marshal(r)
 	if err != nil {
@@ -123,6 +185,7 @@ func (p *Peering) createPeeringRequest(client bool) (*peeringRequestState, frame
 		peering:   p,
 		challenge: challenge,
 		client:    client,
+		fecOut:    fec,
 		step:      1,
 	}, f, nil
 }
@@ -141,7 +204,10 @@ func (state *peeringRequestState) handle(in frame.Frame) (response frame.Frame,
 
 	// Create default error response.
 	if err != nil && response == nil && !errors.Is(err, ErrRemoteDeniedPeering) {
-		data, respErr := cbor.Marshal(&peeringErr{Err: err.Error()})
+		data, respErr := cbor.Marshal(&peeringErr{
+			Err:     err.Error(),
+			ErrCode: m.ErrorCodeOf(err),
+		})
 		if respErr != nil {
 			goto done
 		}
@@ -171,11 +237,14 @@ func (state *peeringRequestState) handlePeeringRequest(in frame.Frame) (frame.Fr
 	}
 
 	// Unmarshal request.
-	r := new(peeringRequest)
-	err := cbor.Unmarshal(in.MessageData(), r)
+	r := new(HandshakeRequest)
+	err := m.UnmarshalControlMsg(in.MessageData(), r)
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal peering request: %w", err)
 	}
+	if err := m.CheckSchemaVersion(r.SchemaVersion, m.SchemaVersionPeering); err != nil {
+		return nil, fmt.Errorf("peering request: %w", err)
+	}
 	if in.MessageType() != frame.RouterPing {
 		return nil, fmt.Errorf("unexpected frame message type: %s", in.MessageType())
 	}
@@ -190,8 +259,10 @@ func (state *peeringRequestState) handlePeeringRequest(in frame.Frame) (frame.Fr
 	}
 
 	// Check if we already have a connection to this router.
-	if state.peering.GetLink(r.Address.IP) != nil {
-		return nil, errors.New("already connected to this router")
+	// Additional links are bonded, if both routers enabled bonding.
+	if state.peering.GetLink(r.Address.IP) != nil &&
+		(!r.Bonding || !state.peering.instance.Config().Router.Bonding) {
+		return nil, ErrAlreadyConnected
 	}
 
 	// Get session and add router if necessary.
@@ -214,7 +285,7 @@ func (state *peeringRequestState) handlePeeringRequest(in frame.Frame) (frame.Fr
 
 	// Check link version.
 	if r.LinkVersion != 1 {
-		return nil, errors.New("unsupported link version")
+		return nil, fmt.Errorf("%w: link version %d", ErrUnsupportedVersion, r.LinkVersion)
 	}
 
 	// Apply metadata.
@@ -226,17 +297,33 @@ func (state *peeringRequestState) handlePeeringRequest(in frame.Frame) (frame.Fr
 	state.remoteIP = r.Address.IP
 	state.remoteVersion = r.RouterVersion
 	state.remoteLite = r.LiteMode
+	state.remoteCapabilities = r.Capabilities
+	state.clockSkew = in.SequenceTime().Sub(state.peering.instance.Config().Clock().Now()).Round(time.Second)
+
+	// Negotiate forward error correction.
+	if r.FEC != nil {
+		if err := r.FEC.check(); err != nil {
+			return nil, fmt.Errorf("invalid fec: %w", err)
+		}
+		state.fecIn = r.FEC
+	}
+	if !r.FECSupport && !r.Capabilities.Has(m.CapFEC) {
+		state.fecOut = nil
+	}
 
 	// Start building response.
-	resp := &peeringResponse{}
+	resp := &HandshakeResponse{SchemaVersion: m.SchemaVersionPeering}
+	if state.remoteAddr.IsValid() {
+		resp.ObservedAddr = state.remoteAddr.String()
+	}
 
 	// Check universe.
 	if r.Universe != state.peering.instance.Config().Router.Universe {
-		return nil, errors.New("universe mismatch")
+		return nil, ErrUniverseMismatch
 	}
 	// Add universe auth, if set.
 	if r.Universe != "" && state.peering.instance.Config().Router.UniverseSecret != "" {
-		resp.UniverseAuth = makeUniverseAuth(
+		resp.UniverseAuth = MakeUniverseAuth(
 			r.Universe,
 			state.peering.instance.Config().Router.UniverseSecret,
 			r.Challenge,
@@ -300,15 +387,18 @@ func (state *peeringRequestState) handlePeeringResponse(in frame.Frame) (frame.F
 	}
 
 	// Unmarshal request.
-	r := new(peeringResponse)
-	err := cbor.Unmarshal(in.MessageData(), r)
+	r := new(HandshakeResponse)
+	err := m.UnmarshalControlMsg(in.MessageData(), r)
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal peering response: %w", err)
 	}
+	if err := m.CheckSchemaVersion(r.SchemaVersion, m.SchemaVersionPeering); err != nil {
+		return nil, fmt.Errorf("peering response: %w", err)
+	}
 
 	// Check for error.
 	if r.Err != "" {
-		return nil, fmt.Errorf("%w: %s", ErrRemoteDeniedPeering, r.Err)
+		return nil, m.WithCode(remoteErrCode(r.ErrCode), fmt.Errorf("%w: %s", ErrRemoteDeniedPeering, r.Err))
 	}
 
 	// Check challenge value.
@@ -316,12 +406,19 @@ func (state *peeringRequestState) handlePeeringResponse(in frame.Frame) (frame.F
 		return nil, errors.New("challenge mismatch")
 	}
 
+	// Save observed address, it is informational only.
+	if r.ObservedAddr != "" {
+		if observed, err := netip.ParseAddrPort(r.ObservedAddr); err == nil {
+			state.observedAddr = netip.AddrPortFrom(observed.Addr().Unmap(), observed.Port())
+		}
+	}
+
 	// Check universe auth.
 	if state.peering.instance.Config().Router.UniverseSecret != "" {
 		if len(r.UniverseAuth) == 0 {
-			return nil, errors.New("universe auth missing")
+			return nil, fmt.Errorf("%w: universe auth missing", ErrUniverseMismatch)
 		}
-		universeCheckAuth := makeUniverseAuth(
+		universeCheckAuth := MakeUniverseAuth(
 			state.peering.instance.Config().Router.Universe,
 			state.peering.instance.Config().Router.UniverseSecret,
 			state.challenge,
@@ -329,12 +426,12 @@ func (state *peeringRequestState) handlePeeringResponse(in frame.Frame) (frame.F
 			state.remoteIP,
 		)
 		if subtle.ConstantTimeCompare(r.UniverseAuth, universeCheckAuth) == 0 {
-			return nil, errors.New("universe auth failed")
+			return nil, fmt.Errorf("%w: universe auth failed", ErrUniverseMismatch)
 		}
 	}
 
 	// Start building response.
-	resp := &peeringAck{}
+	resp := &HandshakeAck{SchemaVersion: m.SchemaVersionPeering}
 
 	// Process key exchange.
 	if !state.client {
@@ -386,15 +483,18 @@ func (state *peeringRequestState) handlePeeringAck(in frame.Frame) error {
 	}
 
 	// Unmarshal request.
-	r := new(peeringAck)
-	err := cbor.Unmarshal(in.MessageData(), r)
+	r := new(HandshakeAck)
+	err := m.UnmarshalControlMsg(in.MessageData(), r)
 	if err != nil {
 		return fmt.Errorf("unmarshal peering ack: %w", err)
 	}
+	if err := m.CheckSchemaVersion(r.SchemaVersion, m.SchemaVersionPeering); err != nil {
+		return fmt.Errorf("peering ack: %w", err)
+	}
 
 	// Check for error.
 	if r.Err != "" {
-		return fmt.Errorf("%w: %s", ErrRemoteDeniedPeering, r.Err)
+		return m.WithCode(remoteErrCode(r.ErrCode), fmt.Errorf("%w: %s", ErrRemoteDeniedPeering, r.Err))
 	}
 
 	// Complete key exchange, if on client.
@@ -413,11 +513,17 @@ func (state *peeringRequestState) handlePeeringAck(in frame.Frame) error {
 func (state *peeringRequestState) finalize() (*state.EncryptionSession, error) {
 	// Clean up exchange keys when done.
 	defer state.session.Encryption().InitCleanup()
+	// Keep a ticket for resuming the router session.
+	if err := state.peering.instance.State().SaveResumptionTicket(state.remoteIP, state.session.Encryption()); err != nil {
+		return nil, fmt.Errorf("save resumption ticket: %w", err)
+	}
 	// Derive link layer encryption session.
 	return state.session.Encryption().DeriveSessionFromKX(state.client, "link layer crypt")
 }
 
-func makeUniverseAuth(universe, secret string, challenge []byte, remoteIP, idIP netip.Addr) []byte {
+// MakeUniverseAuth returns the proof that the router knows the secret of the
+// universe, bound to the challenge of the remote router and both addresses.
+func MakeUniverseAuth(universe, secret string, challenge []byte, remoteIP, idIP netip.Addr) []byte {
 	// Convert to slices.
 	universeData := []byte(universe)
 	secretData := []byte(secret)
@@ -433,3 +539,12 @@ func makeUniverseAuth(universe, secret string, challenge []byte, remoteIP, idIP
 	// Hash and return.
 	return m.BLAKE3.Digest(authData)
 }
+
+// remoteErrCode returns the error code received from another router, if it
+// is a known code.
+func remoteErrCode(code m.ErrorCode) m.ErrorCode {
+	if !code.Known() {
+		return ""
+	}
+	return code
+}
@@ -2,14 +2,18 @@ package peering
 
 import (
 	"context"
+	"net/netip"
 	"testing"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
 	"github.com/mycoria/mycoria/tun"
 )
 
@@ -33,18 +37,21 @@ func TestPeeringInit(t *testing.T) {
 
 	instA := getTestInstance(t, cA)
 	instB := getTestInstance(t, cB)
-	peeringA := New(instA, nil)
-	peeringB := New(instB, nil)
+	peeringA := New(instA, nil, nil)
+	peeringB := New(instB, nil, nil)
 
 	// Initialize connection.
-	stateA, msgFromA, err := peeringA.createPeeringRequest(true)
+	fecA := &FECParams{Data: 4, Parity: 2}
+	stateA, msgFromA, err := peeringA.createPeeringRequest(true, fecA)
 	if err != nil {
 		t.Fatal(err)
 	}
-	stateB, msgFromB, err := peeringB.createPeeringRequest(false)
+	stateB, msgFromB, err := peeringB.createPeeringRequest(false, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
+	stateA.remoteAddr = netip.MustParseAddrPort("198.51.100.2:47369")
+	stateB.remoteAddr = netip.MustParseAddrPort("192.0.2.1:50000")
 
 	for {
 		newMsgFromA, err := stateA.handle(msgFromB)
@@ -64,6 +71,19 @@ func TestPeeringInit(t *testing.T) {
 		}
 	}
 
+	// Check negotiated forward error correction.
+	assert.Equal(t, fecA, stateA.fecOut, "fec must be sent by A")
+	assert.Equal(t, fecA, stateB.fecIn, "fec must be received by B")
+	assert.Nil(t, stateB.fecOut, "fec must not be sent by B")
+
+	// Check observed addresses.
+	assert.Equal(t, stateB.remoteAddr, stateA.observedAddr, "A must learn its address as seen by B")
+	assert.Equal(t, stateA.remoteAddr, stateB.observedAddr, "B must learn its address as seen by A")
+
+	// Check capabilities.
+	assert.Equal(t, m.LocalCapabilities, stateA.remoteCapabilities, "A must learn capabilities of B")
+	assert.Equal(t, m.LocalCapabilities, stateB.remoteCapabilities, "B must learn capabilities of A")
+
 	// Derive encryption session for link layer.
 	linkEncA, err := stateA.finalize()
 	if err != nil {
@@ -97,6 +117,52 @@ func TestPeeringInit(t *testing.T) {
 	assert.Equal(t, testData, testFrame.LinkData(), "link data must match")
 }
 
+func TestPeeringMessageSchema(t *testing.T) {
+	t.Parallel()
+
+	instA := getTestInstance(t, config.MakeTestConfig(config.Store{}))
+	instB := getTestInstance(t, config.MakeTestConfig(config.Store{}))
+	peeringB := New(instB, nil, nil)
+
+	// Messages of newer routers with unknown fields must be accepted.
+	data, err := cbor.Marshal(map[string]any{
+		"sv":     m.SchemaVersionPeering,
+		"c":      []byte("challenge"),
+		"kx":     []byte("key exchange"),
+		"future": map[string]any{"metrics": []int{1, 2, 3}},
+	})
+	require.NoError(t, err)
+	resp := &HandshakeResponse{}
+	require.NoError(t, m.UnmarshalControlMsg(data, resp))
+	assert.Equal(t, []byte("challenge"), resp.Challenge)
+	assert.Equal(t, []byte("key exchange"), resp.KeyExchange)
+
+	// Messages of routers without schema versioning must be accepted.
+	data, err = cbor.Marshal(&HandshakeAck{Ack: true})
+	require.NoError(t, err)
+	ack := &HandshakeAck{}
+	require.NoError(t, m.UnmarshalControlMsg(data, ack))
+	assert.True(t, ack.Ack)
+	assert.NoError(t, m.CheckSchemaVersion(ack.SchemaVersion, m.SchemaVersionPeering))
+
+	// Messages with an unsupported schema version must be refused.
+	data, err = cbor.Marshal(map[string]any{
+		"sv": m.SchemaVersionPeering + 1,
+		"a":  instA.Identity().PublicAddress,
+		"lv": 1,
+	})
+	require.NoError(t, err)
+	f, err := instA.FrameBuilder().NewFrameV1(
+		instA.Identity().IP, instB.Identity().IP,
+		frame.RouterPing, nil, data, nil,
+	)
+	require.NoError(t, err)
+	stateB, _, err := peeringB.createPeeringRequest(false, nil)
+	require.NoError(t, err)
+	_, err = stateB.handle(f)
+	assert.ErrorIs(t, err, m.ErrUnsupportedSchema)
+}
+
 func getTestInstance(t *testing.T, c *config.Config) instance {
 	t.Helper()
 
@@ -110,8 +176,9 @@ func getTestInstance(t *testing.T, c *config.Config) instance {
 		IdentityStub:     id,
 		FrameBuilderStub: frame.NewFrameBuilder(),
 		RoutingTableStub: m.NewRoutingTable(m.RoutingTableConfig{}),
+		StorageStub:      storage.NewMemStorage(),
 	}
-	stateMgr := state.New(instance, nil)
+	stateMgr := state.New(instance, instance.StorageStub)
 	instance.StateStub = stateMgr
 
 	// Set margins.
@@ -125,6 +192,7 @@ type testInstance struct {
 	ConfigStub       *config.Config
 	IdentityStub     *m.Address
 	StateStub        *state.State
+	StorageStub      storage.Storage
 	TunDeviceStub    *tun.Device
 	FrameBuilderStub *frame.Builder
 	RoutingTableStub *m.RoutingTable
@@ -152,6 +220,11 @@ func (stub *testInstance) State() *state.State {
 	return stub.StateStub
 }
 
+// Storage returns the storage.
+func (stub *testInstance) Storage() storage.Storage {
+	return stub.StorageStub
+}
+
 // TunDevice returns the tun device.
 func (stub *testInstance) TunDevice() *tun.Device {
 	return stub.TunDeviceStub
@@ -6,16 +6,35 @@ import (
 	"io"
 	"net"
 	"net/netip"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
+
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
 	"github.com/mycoria/mycoria/state"
 )
 
+// Priority budget of a link.
+// Priority frames received above the budget are handled as regular frames, so
+// that a single peer cannot crowd out the control plane of other peers.
+const (
+	prioBudgetRate  = 500  // Frames per second.
+	prioBudgetBurst = 2000 // Frames.
+)
+
+// Write batching.
+// The writer writes all waiting frames with a single syscall. When the link is
+// busy, it waits a moment for more frames to fill the batch.
+const (
+	maxWriteBatch        = 64
+	writeBatchFlushDelay = 200 * time.Microsecond
+)
+
 // Errors.
 var (
 	ErrNetworkReadError  = errors.New("read i/o error")
@@ -32,6 +51,10 @@ type Link interface {
 	// SwitchLabel returns the switch label of the link.
 	SwitchLabel() m.SwitchLabel
 
+	// SetSwitchLabel sets a new switch label for the link.
+	// It must only be used by the peering manager, which tracks the labels.
+	SetSwitchLabel(label m.SwitchLabel)
+
 	// GeoMark returns geo location of the peer, based on the router address.
 	GeoMark() string
 
@@ -69,6 +92,21 @@ type Link interface {
 	// calculates and sets the new average.
 	AddMeasuredLatency(latency time.Duration)
 
+	// AvgLatency returns the average of all latencies measured during the
+	// lifetime of the link in milliseconds.
+	AvgLatency() uint16
+
+	// ClockSkew returns how far the clock of the peer is ahead of the local
+	// clock, as estimated during the link setup.
+	ClockSkew() time.Duration
+
+	// ObservedAddr returns the underlay address of this router, as seen by
+	// the peer during the link setup.
+	ObservedAddr() netip.AddrPort
+
+	// Capabilities returns the protocol features the peer supports.
+	Capabilities() m.Capabilities
+
 	// BytesIn returns the total amount of bytes received via the link.
 	BytesIn() uint64
 
@@ -82,26 +120,48 @@ type Link interface {
 	// IsClosing returns whether the link is closing or has closed.
 	IsClosing() bool
 
-	// Close closes the link.
-	Close(log func())
+	// CloseReason returns the reason the link was closed with.
+	// It must only be called after the link was closed.
+	CloseReason() string
+
+	// Close closes the link with the given reason.
+	// The log function is only called if the link was not yet closing.
+	Close(reason string, log func())
 }
 
 // LinkBase implements common functions to comply with the Link interface.
 type LinkBase struct { //nolint:maligned
 	// conn is the actual underlying connection.
 	conn net.Conn
+	// transportOffset and transportOverhead are the margins the transport
+	// requires before and after every record written to the connection.
+	// Written data includes this space for the transport to fill in.
+	transportOffset   int
+	transportOverhead int
 	// encSession is the encryption session.
 	encSession *state.EncryptionSession
+	// fecOut creates parity records for sent link frames, if enabled.
+	fecOut *fecEncoder
+	// fecIn recovers lost link frames from parity records, if enabled.
+	fecIn *fecDecoder
 
 	// sendQueuePrio is the send queue for priority messages.
 	sendQueuePrio chan frame.Frame
 	// sendQueueRegl is the send queue for regular messages.
 	sendQueueRegl chan frame.Frame
+	// sendQueueRelay is the send queue for relayed messages, if they are
+	// limited by the relay budget.
+	sendQueueRelay chan frame.Frame
+	// relayBudget limits relayed messages, if configured.
+	relayBudget *relayBudget
+	// prioBudget limits the received frames that are handled with priority.
+	prioBudget *rate.Limiter
 
 	// peer is the mycoria identity IP of the peer.
 	peer netip.Addr
 	// switchLabel is the switch ID for this link.
-	switchLabel m.SwitchLabel
+	// It may change during the lifetime of the link.
+	switchLabel atomic.Uint32
 	// geoMark holds geo location info based on the geo geomarked router address.
 	geoMark string
 
@@ -114,9 +174,19 @@ type LinkBase struct { //nolint:maligned
 
 	// started holds the time when the link was created.
 	started time.Time
+	// clockSkew holds how far the clock of the peer is ahead.
+	clockSkew time.Duration
+	// observedAddr holds the underlay address of this router, as seen by
+	// the peer.
+	observedAddr netip.AddrPort
+	// capabilities holds the protocol features the peer supports.
+	capabilities m.Capabilities
 
 	// closing specifies if the link is being closed
 	closing atomic.Bool
+	// closeReason holds the reason the link was closed with.
+	// It is set once before the link is removed from the peering manager.
+	closeReason string
 
 	// peering references back to the peering manager.
 	peering *Peering
@@ -132,6 +202,10 @@ type LinkBase struct { //nolint:maligned
 	measuredLatencies [10]time.Duration
 	// measuredLatenciesNext holds the next index to use of measuredLatencies.
 	measuredLatenciesNext int
+	// measuredLatencyTotal and measuredLatencyCnt hold the sum and amount of
+	// all measured latencies.
+	measuredLatencyTotal time.Duration
+	measuredLatencyCnt   int64
 
 	// bytesIn records the total amount of bytes received via this connection.
 	bytesIn atomic.Uint64
@@ -147,15 +221,24 @@ func newLinkBase(
 	outgoing bool,
 	peering *Peering,
 ) *LinkBase {
+	queueSize := peering.instance.Config().Limits.QueueSize
 	link := &LinkBase{
 		conn:          conn,
-		sendQueuePrio: make(chan frame.Frame, 100),
-		sendQueueRegl: make(chan frame.Frame, 1000),
+		sendQueuePrio: make(chan frame.Frame, queueSize/10),
+		sendQueueRegl: make(chan frame.Frame, queueSize),
+		prioBudget:    rate.NewLimiter(prioBudgetRate, prioBudgetBurst),
+		relayBudget:   peering.newRelayBudget(),
 		peeringURL:    peeringURL,
 		outgoing:      outgoing,
 		started:       time.Now(),
 		peering:       peering,
 	}
+	if link.relayBudget != nil {
+		link.sendQueueRelay = make(chan frame.Frame, queueSize)
+	}
+	if peeringURL != nil {
+		link.transportOffset, link.transportOverhead = peering.transportMargins(peeringURL.Protocol)
+	}
 	link.latency = link.getFallbackLatency()
 
 	return link
@@ -184,7 +267,13 @@ func (link *LinkBase) SwitchLabel() m.SwitchLabel {
 	if link == nil {
 		return 0
 	}
-	return link.switchLabel
+	return m.SwitchLabel(link.switchLabel.Load())
+}
+
+// SetSwitchLabel sets a new switch label for the link.
+// It must only be used by the peering manager, which tracks the labels.
+func (link *LinkBase) SetSwitchLabel(label m.SwitchLabel) {
+	link.switchLabel.Store(uint32(label))
 }
 
 // GeoMark returns geo location of the peer, based on the router address.
@@ -227,9 +316,16 @@ func (link *LinkBase) SendPriority(f frame.Frame) error {
 }
 
 // Send sends a frame to the peer.
+// If the relay budget is configured, relayed frames are queued separately
+// and are only sent when no other frames are waiting.
 func (link *LinkBase) Send(f frame.Frame) error {
+	queue := link.sendQueueRegl
+	if link.relayBudget != nil && link.relayBudget.isRelayed(f) {
+		queue = link.sendQueueRelay
+	}
+
 	select {
-	case link.sendQueueRegl <- f:
+	case queue <- f:
 	default:
 	}
 	return nil
@@ -262,6 +358,8 @@ func (link *LinkBase) AddMeasuredLatency(latency time.Duration) {
 	// Add latency to measured latencies.
 	link.measuredLatencies[link.measuredLatenciesNext] = latency
 	link.measuredLatenciesNext = (link.measuredLatenciesNext + 1) % 10
+	link.measuredLatencyTotal += latency
+	link.measuredLatencyCnt++
 
 	// Calculate new average.
 	var (
@@ -283,6 +381,37 @@ func (link *LinkBase) AddMeasuredLatency(latency time.Duration) {
 	}
 }
 
+// AvgLatency returns the average of all latencies measured during the
+// lifetime of the link in milliseconds. It returns the current latency, if no
+// latency was measured yet.
+func (link *LinkBase) AvgLatency() uint16 {
+	link.lock.RLock()
+	defer link.lock.RUnlock()
+
+	if link.measuredLatencyCnt == 0 {
+		return link.latency
+	}
+	avgLatency := (link.measuredLatencyTotal / time.Duration(link.measuredLatencyCnt)).Round(time.Millisecond)
+	return max(uint16(avgLatency/time.Millisecond), 1)
+}
+
+// ClockSkew returns how far the clock of the peer is ahead of the local
+// clock, as estimated during the link setup.
+func (link *LinkBase) ClockSkew() time.Duration {
+	return link.clockSkew
+}
+
+// ObservedAddr returns the underlay address of this router, as seen by the
+// peer during the link setup.
+func (link *LinkBase) ObservedAddr() netip.AddrPort {
+	return link.observedAddr
+}
+
+// Capabilities returns the protocol features the peer supports.
+func (link *LinkBase) Capabilities() m.Capabilities {
+	return link.capabilities
+}
+
 // BytesIn returns the total amount of bytes received via the link.
 func (link *LinkBase) BytesIn() uint64 {
 	return link.bytesIn.Load()
@@ -297,6 +426,9 @@ func (link *LinkBase) BytesOut() uint64 {
 // pressure on the sending queue of this link.
 func (link *LinkBase) FlowControlIndicator() frame.FlowControlFlag {
 	percent := len(link.sendQueueRegl) * 100 / cap(link.sendQueueRegl)
+	if link.sendQueueRelay != nil {
+		percent = max(percent, len(link.sendQueueRelay)*100/cap(link.sendQueueRelay))
+	}
 	switch {
 	case percent >= 70: // Send queue is over 70% full.
 		return frame.FlowControlFlagDecreaseFlow
@@ -312,13 +444,21 @@ func (link *LinkBase) IsClosing() bool {
 	return link.closing.Load()
 }
 
-// Close closes the link.
-func (link *LinkBase) Close(log func()) {
+// CloseReason returns the reason the link was closed with.
+// It must only be called after the link was closed.
+func (link *LinkBase) CloseReason() string {
+	return link.closeReason
+}
+
+// Close closes the link with the given reason.
+// The log function is only called if the link was not yet closing.
+func (link *LinkBase) Close(reason string, log func()) {
 	if link == nil {
 		return
 	}
 
 	if link.closing.CompareAndSwap(false, true) {
+		link.closeReason = reason
 		if log != nil {
 			log()
 		}
@@ -328,8 +468,14 @@ func (link *LinkBase) Close(log func()) {
 	}
 }
 
+// withinPrioBudget reports whether a received priority frame may be handled
+// with priority.
+func (link *LinkBase) withinPrioBudget() bool {
+	return link.prioBudget == nil || link.prioBudget.Allow()
+}
+
 func (link *LinkBase) reader(w *mgr.WorkerCtx) error {
-	defer link.Close(func() {
+	defer link.Close("reader stopped", func() {
 		w.Info(
 			"closing link (by reader)",
 			"router", link.peer,
@@ -340,24 +486,41 @@ func (link *LinkBase) reader(w *mgr.WorkerCtx) error {
 	var (
 		builder           = link.peering.instance.FrameBuilder()
 		upstream          = link.peering.frameHandler
+		prioUpstream      = link.peering.prioFrameHandler
 		consecutiveErrors int
 	)
+	if prioUpstream == nil {
+		prioUpstream = upstream
+	}
 	for {
-		f, err := link.readFrame(builder)
+		// Read frame, recovering from panics caused by malformed frames.
+		var f frame.Frame
+		err := w.Guard(func() (err error) {
+			f, err = link.readFrame(builder)
+			return err
+		})
 		if err == nil {
 			consecutiveErrors = 0
+
+			// Hand priority frames to the priority queue, within budget.
+			submitTo := upstream
+			if f.MessageType().IsPriority() && link.withinPrioBudget() {
+				submitTo = prioUpstream
+			}
+			w.Busy()
 			select {
-			case upstream <- f:
+			case submitTo <- f:
 			case <-w.Done():
 				return nil
 			}
+			w.Idle()
 			continue
 		}
 
 		// Close link in case of a network error.
 		if errors.Is(err, ErrNetworkReadError) {
 			if errors.Is(err, io.EOF) {
-				link.Close(func() {
+				link.Close("closed by remote", func() {
 					w.Info(
 						"closing link (by remote)",
 						"router", link.peer,
@@ -367,7 +530,7 @@ func (link *LinkBase) reader(w *mgr.WorkerCtx) error {
 				return nil
 			}
 
-			link.Close(func() {
+			link.Close("read i/o error: "+err.Error(), func() {
 				w.Warn(
 					"read i/o error, closing link",
 					"router", link.peer,
@@ -381,7 +544,7 @@ func (link *LinkBase) reader(w *mgr.WorkerCtx) error {
 		// Log read error, close after 100 consecutive errors.
 		consecutiveErrors++
 		if consecutiveErrors >= 100 {
-			link.Close(func() {
+			link.Close("too many read errors", func() {
 				w.Warn(
 					"closing link after 100 consecutive read errors",
 					"router", link.peer,
@@ -402,7 +565,7 @@ func (link *LinkBase) reader(w *mgr.WorkerCtx) error {
 }
 
 func (link *LinkBase) writer(w *mgr.WorkerCtx) error {
-	defer link.Close(func() {
+	defer link.Close("writer stopped", func() {
 		w.Info(
 			"closing link (by writer)",
 			"router", link.peer,
@@ -411,35 +574,61 @@ func (link *LinkBase) writer(w *mgr.WorkerCtx) error {
 	})
 
 	var (
-		f                 frame.Frame
+		batch             = make([]frame.Frame, 0, maxWriteBatch)
+		buffers           = make(net.Buffers, 0, maxWriteBatch)
 		consecutiveErrors int
+		relay             = link.newRelayScheduler()
 	)
+	defer relay.stop()
 	for {
-		// Get next frame to write.
+		// Wait for next frame to write.
+		var f frame.Frame
 		select {
 		case f = <-link.sendQueuePrio:
 		default:
 			select {
 			case f = <-link.sendQueuePrio:
 			case f = <-link.sendQueueRegl:
-			case <-w.Done():
-				return nil
+			default:
+				// Relayed frames are only sent when no other frames are waiting.
+				select {
+				case f = <-link.sendQueuePrio:
+				case f = <-link.sendQueueRegl:
+				case f = <-relay.next():
+					if f != nil && !relay.admit(f) {
+						continue
+					}
+				case <-relay.ready():
+					f = relay.release()
+				case <-w.Done():
+					return nil
+				}
 			}
 		}
 		if f == nil {
 			return nil
 		}
 
-		// Write frame.
-		err := link.writeFrame(f)
-		if err == nil {
+		// Add waiting frames to the batch.
+		var ok bool
+		batch, ok = link.collectBatch(append(batch[:0], f))
+
+		// Write frames.
+		w.Busy()
+		err := link.writeFrames(batch, buffers[:0])
+		w.Idle()
+		clear(batch)
+		switch {
+		case !ok:
+			return nil
+		case err == nil:
 			consecutiveErrors = 0
 			continue
 		}
 
 		// Close link in case of a network error.
 		if errors.Is(err, ErrNetworkWriteError) {
-			link.Close(func() {
+			link.Close("write i/o error: "+err.Error(), func() {
 				w.Warn(
 					"write i/o error, closing link",
 					"router", link.peer,
@@ -453,7 +642,7 @@ func (link *LinkBase) writer(w *mgr.WorkerCtx) error {
 		// Log write error, close after 100 consecutive errors.
 		consecutiveErrors++
 		if consecutiveErrors >= 100 {
-			link.Close(func() {
+			link.Close("too many write errors", func() {
 				w.Warn(
 					"closing link after 100 consecutive write errors",
 					"router", link.peer,
@@ -473,33 +662,145 @@ func (link *LinkBase) writer(w *mgr.WorkerCtx) error {
 	}
 }
 
+// collectBatch adds waiting frames to the batch, preferring priority frames.
+// If more than one frame was waiting, the link is busy and it waits a moment
+// for more frames to fill the batch.
+// Returns false if the writer should stop after writing the batch.
+func (link *LinkBase) collectBatch(batch []frame.Frame) (_ []frame.Frame, ok bool) {
+	var flush <-chan time.Time
+	for len(batch) < maxWriteBatch {
+		var f frame.Frame
+		select {
+		case f = <-link.sendQueuePrio:
+		default:
+			select {
+			case f = <-link.sendQueuePrio:
+			case f = <-link.sendQueueRegl:
+			default:
+				// No frames waiting.
+				if len(batch) < 2 || flush != nil {
+					return batch, true
+				}
+				flush = time.After(writeBatchFlushDelay)
+				select {
+				case f = <-link.sendQueuePrio:
+				case f = <-link.sendQueueRegl:
+				case <-flush:
+					return batch, true
+				}
+			}
+		}
+		if f == nil {
+			return batch, false
+		}
+		batch = append(batch, f)
+	}
+	return batch, true
+}
+
+// writeFrames writes the frames to the connection with as few syscalls as
+// possible and returns them to the pool. Frames that fail to encode are
+// skipped. The buffers are used for the vectored write.
+func (link *LinkBase) writeFrames(frames []frame.Frame, buffers net.Buffers) error {
+	// Return frames to pool when done writing.
+	defer func() {
+		for _, f := range frames {
+			f.ReturnToPool()
+		}
+	}()
+
+	// Encode frames.
+	var encodeErr error
+	for _, f := range frames {
+		data, parity, err := link.encodeFrame(f)
+		if err != nil {
+			encodeErr = err
+			continue
+		}
+		buffers = append(buffers, data)
+		buffers = append(buffers, parity...)
+	}
+
+	// Write all frames at once.
+	// net.Buffers uses writev, if supported by the connection.
+	if len(buffers) > 0 {
+		n, err := buffers.WriteTo(link.conn)
+		link.bytesOut.Add(uint64(n))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrNetworkWriteError, err)
+		}
+	}
+	return encodeErr
+}
+
 func (link *LinkBase) readFrame(b *frame.Builder) (frame.Frame, error) {
-	data, err := link.readLengthAndData()
-	if err != nil {
-		return nil, fmt.Errorf("read frame: %w", err)
+	// Return link frames recovered by FEC first.
+	if recovered := link.fecIn.nextRecovered(); recovered != nil {
+		data := b.GetPooledSlice(len(recovered))
+		if len(data) < len(recovered) {
+			return nil, errors.New("recovered link frame too big for slice")
+		}
+		copy(data, recovered)
+		return link.parseLinkFrame(b, data[:len(recovered)])
 	}
-	link.bytesIn.Add(uint64(len(data)))
 
-	// Parse LinkFrame.
-	if link.encSession != nil {
-		// Unseal linked frame.
-		lf := LinkFrame(data)
-		if err := lf.Unseal(link.encSession); err != nil {
-			return nil, fmt.Errorf("unseal link frame: %w", err)
+	for {
+		data, err := link.readLengthAndData()
+		if err != nil {
+			return nil, fmt.Errorf("read frame: %w", err)
+		}
+		link.bytesIn.Add(uint64(len(data)))
+
+		// Handle FEC parity records.
+		if link.fecIn != nil {
+			if isFECParityRecord(data) {
+				err := link.fecIn.addParity(data)
+				b.ReturnPooledSlice(data)
+				if err != nil {
+					return nil, fmt.Errorf("add fec parity: %w", err)
+				}
+				if link.fecIn.hasRecovered() {
+					return link.readFrame(b)
+				}
+				continue
+			}
+		}
+
+		// Parse LinkFrame.
+		if link.encSession != nil {
+			// Keep a copy of the link frame for FEC, as it is decrypted in place.
+			var record []byte
+			if link.fecIn != nil {
+				record = slices.Clone(data)
+			}
+			f, err := link.parseLinkFrame(b, data)
+			if err == nil && record != nil {
+				link.fecIn.addData(record)
+			}
+			return f, err
 		}
-		// Parse Frame.
-		f, err := b.ParseFrame(lf.LinkData(), data[:cap(data)], FrameOffset)
+
+		// Parse Frame directly.
+		f, err := b.ParseFrame(data[2:], data[:cap(data)], 2)
 		if err != nil {
-			return nil, fmt.Errorf("parse frame (from link frame): %w", err)
+			return nil, fmt.Errorf("parse frame: %w", err)
 		}
 		f.SetRecvLink(link)
 		return f, nil
 	}
+}
 
-	// Parse Frame directly.
-	f, err := b.ParseFrame(data[2:], data[:cap(data)], 2)
+// parseLinkFrame unseals the given link frame and parses the contained frame.
+func (link *LinkBase) parseLinkFrame(b *frame.Builder, data []byte) (frame.Frame, error) {
+	// Unseal linked frame.
+	lf := LinkFrame(data)
+	if err := lf.Unseal(link.encSession); err != nil {
+		return nil, fmt.Errorf("unseal link frame: %w", err)
+	}
+	// Parse Frame.
+	f, err := b.ParseFrame(lf.LinkData(), data[:cap(data)], FrameOffset)
 	if err != nil {
-		return nil, fmt.Errorf("parse frame: %w", err)
+		return nil, fmt.Errorf("parse frame (from link frame): %w", err)
 	}
 	f.SetRecvLink(link)
 	return f, nil
@@ -509,35 +810,57 @@ func (link *LinkBase) writeFrame(f frame.Frame) error {
 	// Return frame to pool when done writing.
 	defer f.ReturnToPool()
 
+	data, parity, err := link.encodeFrame(f)
+	if err != nil {
+		return err
+	}
+	if err := link.writeData(data); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	for _, record := range parity {
+		if err := link.writeData(record); err != nil {
+			return fmt.Errorf("write fec parity: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeFrame prepares the frame for writing to the connection and returns
+// the data to write, which is part of the frame. If FEC is enabled, parity
+// records that must be written after the frame are returned too.
+func (link *LinkBase) encodeFrame(f frame.Frame) (data []byte, parity [][]byte, err error) {
+	transportOffset, transportOverhead := link.transportOffset, link.transportOverhead
+
 	// If link encryption is enabled, wrap the frame in a link frame.
 	if link.encSession != nil {
-		data, err := f.FrameDataWithMargins(FrameOffset, FrameOverhead)
+		offset, overhead := FrameOffset+transportOffset, FrameOverhead+transportOverhead
+		data, err := f.FrameDataWithMargins(offset, overhead)
 		if err != nil {
-			return fmt.Errorf("frame with margins %d,%d: %w", FrameOffset, FrameOverhead, err)
+			return nil, nil, fmt.Errorf("frame with margins %d,%d: %w", offset, overhead, err)
 		}
-		lf := LinkFrame(data)
+		lf := LinkFrame(data[transportOffset : len(data)-transportOverhead])
 		if err := lf.Seal(link.encSession); err != nil {
-			return fmt.Errorf("seal link frame: %w", err)
+			return nil, nil, fmt.Errorf("seal link frame: %w", err)
 		}
-		if err := link.writeData(data); err != nil {
-			return fmt.Errorf("write: %w", err)
+
+		// Create FEC parity records, when a group is complete.
+		if link.fecOut != nil {
+			parity = link.fecOut.add(lf)
 		}
-		return nil
+		return data, parity, nil
 	}
 
 	// Otherwise, just write the frame directly.
-	data, err := f.FrameDataWithMargins(2, 0)
+	data, err = f.FrameDataWithMargins(2+transportOffset, transportOverhead)
 	if err != nil {
-		return fmt.Errorf("frame with margins 2,0: %w", err)
-	}
-	if len(data) > 0xFFFF {
-		return fmt.Errorf("frame is too big (%d bytes)", len(data))
+		return nil, nil, fmt.Errorf("frame with margins %d,%d: %w", 2+transportOffset, transportOverhead, err)
 	}
-	m.PutUint16(data[:2], uint16(len(data)))
-	if err := link.writeData(data); err != nil {
-		return fmt.Errorf("write: %w", err)
+	record := data[transportOffset : len(data)-transportOverhead]
+	if len(record) > 0xFFFF {
+		return nil, nil, fmt.Errorf("frame is too big (%d bytes)", len(record))
 	}
-	return nil
+	m.PutUint16(record[:2], uint16(len(record)))
+	return data, nil, nil
 }
 
 func (link *LinkBase) readLengthAndData() ([]byte, error) {
@@ -610,10 +933,16 @@ func (link *LinkBase) setupWorker(w *mgr.WorkerCtx) error {
 	if err == nil {
 		link.encSession, err = peeringState.finalize()
 	}
+	if err == nil {
+		link.setupFEC(peeringState)
+	}
 	if err == nil {
 		// Assign peer and geomarked country.
 		link.peer = peeringState.session.Address().IP
 		link.lite = peeringState.remoteLite
+		link.clockSkew = peeringState.clockSkew
+		link.observedAddr = peeringState.observedAddr
+		link.capabilities = peeringState.remoteCapabilities
 		cml, cmlErr := m.LookupCountryMarker(link.peer)
 		if cmlErr == nil && cml != nil {
 			link.geoMark = fmt.Sprintf("%s (%s)", cml.Country, cml.Continent)
@@ -626,7 +955,7 @@ func (link *LinkBase) setupWorker(w *mgr.WorkerCtx) error {
 		err = link.peering.AddLink(link)
 	}
 	if err != nil {
-		link.Close(func() {
+		link.Close("setup failed", func() {
 			w.Warn(
 				"link setup failed",
 				"remote", link.RemoteAddr(),
@@ -645,6 +974,8 @@ func (link *LinkBase) setupWorker(w *mgr.WorkerCtx) error {
 		"peeringURL", link.peeringURL,
 		"outgoing", link.outgoing,
 	)
+	link.peering.checkClockSkew(link)
+	link.peering.verifyGeoMarker(link)
 	link.startWorkers()
 	return nil
 }
@@ -654,10 +985,16 @@ func (link *LinkBase) handleSetup(mgr *mgr.Manager) (*LinkBase, error) {
 	if err == nil {
 		link.encSession, err = peeringState.finalize()
 	}
+	if err == nil {
+		link.setupFEC(peeringState)
+	}
 	if err == nil {
 		// Assign peer and geomarked country.
 		link.peer = peeringState.session.Address().IP
 		link.lite = peeringState.remoteLite
+		link.clockSkew = peeringState.clockSkew
+		link.observedAddr = peeringState.observedAddr
+		link.capabilities = peeringState.remoteCapabilities
 		cml, cmlErr := m.LookupCountryMarker(link.peer)
 		if cmlErr == nil && cml != nil {
 			link.geoMark = fmt.Sprintf("%s (%s)", cml.Country, cml.Continent)
@@ -670,7 +1007,7 @@ func (link *LinkBase) handleSetup(mgr *mgr.Manager) (*LinkBase, error) {
 		err = link.peering.AddLink(link)
 	}
 	if err != nil {
-		link.Close(nil)
+		link.Close("setup failed", nil)
 		return nil, err
 	}
 
@@ -682,6 +1019,8 @@ func (link *LinkBase) handleSetup(mgr *mgr.Manager) (*LinkBase, error) {
 		"peeringURL", link.peeringURL,
 		"outgoing", link.outgoing,
 	)
+	link.peering.checkClockSkew(link)
+	link.peering.verifyGeoMarker(link)
 	link.startWorkers()
 	return link, nil
 }
@@ -689,11 +1028,22 @@ func (link *LinkBase) handleSetup(mgr *mgr.Manager) (*LinkBase, error) {
 func (link *LinkBase) handleSetupMessages(client bool) (*peeringRequestState, error) {
 	builder := link.peering.instance.FrameBuilder()
 
+	// Get forward error correction to send with.
+	var fec *FECParams
+	if link.peeringURL != nil {
+		var err error
+		fec, err = parseFECParams(link.peeringURL.Param(m.PeeringURLParamFEC))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Initialize connection.
-	state, f, err := link.peering.createPeeringRequest(client)
+	state, f, err := link.peering.createPeeringRequest(client, fec)
 	if err != nil {
 		return nil, fmt.Errorf("create peering request (1): %w", err)
 	}
+	state.remoteAddr, _ = underlayAddr(link.RemoteAddr())
 	err = link.writeFrame(f)
 	if err != nil {
 		return nil, fmt.Errorf("write peering request (1): %w", err)
@@ -730,35 +1080,25 @@ func (link *LinkBase) handleSetupMessages(client bool) (*peeringRequestState, er
 	return nil, errors.New("too much setup")
 }
 
-func (link *LinkBase) assignSwitchLabel() error {
-	// Derive label from address.
-	label, ok := m.DeriveSwitchLabelFromIP(link.peer)
-	if ok && label != 0 && link.peering.GetLinkByLabel(label) == nil {
-		link.switchLabel = label
-		return nil
-	}
-
-	// Try 100 times to generate a random short label for routable addresses.
-	if m.RoutingAddressPrefix.Contains(link.peer) {
-		for i := 0; i < 100; i++ {
-			label, ok := m.GetRandomSwitchLabel(true)
-			if ok && label != 0 && link.peering.GetLinkByLabel(label) == nil {
-				link.switchLabel = label
-				return nil
-			}
-		}
+// setupFEC sets up forward error correction as negotiated.
+func (link *LinkBase) setupFEC(state *peeringRequestState) {
+	if state.fecOut != nil {
+		link.fecOut = newFECEncoder(*state.fecOut)
+		link.fecOut.offset = link.transportOffset
+		link.fecOut.overhead = link.transportOverhead
 	}
-
-	// Then try 1000 time for a longer one.
-	for i := 0; i < 1000; i++ {
-		label, ok := m.GetRandomSwitchLabel(false)
-		if ok && label != 0 && link.peering.GetLinkByLabel(label) == nil {
-			link.switchLabel = label
-			return nil
-		}
+	if state.fecIn != nil {
+		link.fecIn = newFECDecoder(*state.fecIn)
 	}
+}
 
-	return errors.New("no suitable switch label found")
+func (link *LinkBase) assignSwitchLabel() error {
+	label, err := link.peering.findFreeSwitchLabel(link.peer)
+	if err != nil {
+		return err
+	}
+	link.SetSwitchLabel(label)
+	return nil
 }
 
 func (link *LinkBase) getFallbackLatency() uint16 {
@@ -770,6 +1110,8 @@ func (link *LinkBase) getFallbackLatency() uint16 {
 		remoteIP = v.IP
 	case *net.IPAddr:
 		remoteIP = v.IP
+	case *net.UnixAddr:
+		return 1
 	default:
 		return 50
 	}
@@ -0,0 +1,110 @@
+package peering
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestLinkWriteBatch(t *testing.T) {
+	t.Parallel()
+
+	b := frame.NewFrameBuilder()
+	b.SetFrameMargins(FrameOffset, FrameOverhead)
+	newFrame := func(data string) frame.Frame {
+		t.Helper()
+
+		f, err := b.NewFrameV1(
+			netip.IPv6LinkLocalAllNodes(),
+			netip.IPv6LinkLocalAllRouters(),
+			frame.NetworkTraffic,
+			nil,
+			[]byte(data),
+			nil,
+		)
+		require.NoError(t, err)
+		return f
+	}
+
+	local, remote := net.Pipe()
+	link := &LinkBase{
+		conn:          local,
+		sendQueuePrio: make(chan frame.Frame, 10),
+		sendQueueRegl: make(chan frame.Frame, 10),
+	}
+
+	// Queue frames and collect batch.
+	require.NoError(t, link.Send(newFrame("regular-1")))
+	require.NoError(t, link.Send(newFrame("regular-2")))
+	require.NoError(t, link.SendPriority(newFrame("priority")))
+	batch, ok := link.collectBatch([]frame.Frame{newFrame("first")})
+	require.True(t, ok)
+	require.Len(t, batch, 4)
+
+	// Priority frames must be preferred.
+	assert.Equal(t, []byte("first"), batch[0].MessageData())
+	assert.Equal(t, []byte("priority"), batch[1].MessageData())
+	assert.Equal(t, []byte("regular-1"), batch[2].MessageData())
+	assert.Equal(t, []byte("regular-2"), batch[3].MessageData())
+
+	// Write batch and read frames from the other side.
+	go func() {
+		assert.NoError(t, link.writeFrames(batch, nil))
+	}()
+	reader := &LinkBase{
+		conn:    remote,
+		peering: &Peering{instance: &testInstance{FrameBuilderStub: b}},
+	}
+	for _, expected := range []string{"first", "priority", "regular-1", "regular-2"} {
+		f, err := reader.readFrame(b)
+		require.NoError(t, err)
+		assert.Equal(t, []byte(expected), f.MessageData())
+		f.ReturnToPool()
+	}
+}
+
+func TestLinkTransportMargins(t *testing.T) {
+	t.Parallel()
+
+	// Register transport margins via the protocol.
+	b := frame.NewFrameBuilder()
+	b.SetFrameMargins(FrameOffset, FrameOverhead)
+	p := &Peering{
+		instance:  &testInstance{FrameBuilderStub: b},
+		protocols: make(map[string]Protocol),
+	}
+	prot := NewProtocol("test", nil, nil).WithTransportMargins(8, 4)
+	require.NoError(t, p.AddProtocol("test", prot))
+	offset, overhead := b.FrameMargins()
+	assert.Equal(t, FrameOffset+8, offset)
+	assert.Equal(t, FrameOverhead+4, overhead)
+
+	// Encode frame with transport margins.
+	f, err := b.NewFrameV1(
+		netip.IPv6LinkLocalAllNodes(),
+		netip.IPv6LinkLocalAllRouters(),
+		frame.NetworkTraffic,
+		nil,
+		[]byte("margins"),
+		nil,
+	)
+	require.NoError(t, err)
+	link := &LinkBase{}
+	link.transportOffset, link.transportOverhead = p.transportMargins("test")
+	data, _, err := link.encodeFrame(f)
+	require.NoError(t, err)
+	record := data[8 : len(data)-4]
+	assert.Equal(t, len(record), int(m.GetUint16(record[:2])))
+
+	// Removing the protocol margins restores the link frame margins.
+	require.NoError(t, p.AddProtocol("test", NewProtocol("test", nil, nil)))
+	offset, overhead = b.FrameMargins()
+	assert.Equal(t, FrameOffset, offset)
+	assert.Equal(t, FrameOverhead, overhead)
+}
@@ -0,0 +1,71 @@
+package peering
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/storage"
+)
+
+// recordLinkSession saves the finished session of the given link to the
+// link history.
+func (p *Peering) recordLinkSession(link Link) {
+	session := makeLinkSession(link, time.Now())
+	session.Reason = link.CloseReason()
+
+	if err := p.instance.Storage().AddLinkSession(session); err != nil && p.mgr != nil {
+		p.mgr.Warn(
+			"failed to record link session",
+			"router", link.Peer(),
+			"err", err,
+		)
+	}
+}
+
+// GetLinkHistory returns the link sessions with the given peer that ended
+// after since, sorted by connect time. Currently active links are included as
+// active sessions. If peer is invalid, sessions of all peers are returned.
+func (p *Peering) GetLinkHistory(peer netip.Addr, since time.Time) ([]storage.StoredLinkSession, error) {
+	sessions, err := p.instance.Storage().QueryLinkSessions(peer, since)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add active links.
+	now := time.Now()
+	for _, link := range p.GetLinks() {
+		if peer.IsValid() && link.Peer() != peer {
+			continue
+		}
+
+		// Bonded links are recorded separately.
+		links := LinkMembers(link)
+		for _, link := range links {
+			session := makeLinkSession(link, now)
+			session.Active = true
+			sessions = append(sessions, session)
+		}
+	}
+
+	slices.SortStableFunc[[]storage.StoredLinkSession, storage.StoredLinkSession](sessions, func(a, b storage.StoredLinkSession) int {
+		return a.Connected.Compare(b.Connected)
+	})
+	return sessions, nil
+}
+
+func makeLinkSession(link Link, end time.Time) storage.StoredLinkSession {
+	session := storage.StoredLinkSession{
+		Peer:         link.Peer(),
+		Outgoing:     link.Outgoing(),
+		Connected:    link.Started(),
+		Disconnected: end,
+		AvgLatency:   link.AvgLatency(),
+		BytesIn:      link.BytesIn(),
+		BytesOut:     link.BytesOut(),
+	}
+	if link.PeeringURL() != nil {
+		session.PeeringURL = link.PeeringURL().String()
+	}
+	return session
+}
@@ -0,0 +1,63 @@
+package peering
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestLinkHistory(t *testing.T) {
+	t.Parallel()
+
+	p := New(getTestInstance(t, config.MakeTestConfig(config.Store{})), nil, nil)
+	p.mgr = mgr.New("peering")
+	since := time.Now().Add(-time.Hour)
+
+	// Add two links and remove one.
+	linkA := addTestLink(t, p)
+	linkB := addTestLink(t, p)
+	linkA.started = time.Now().Add(-10 * time.Minute)
+	linkB.started = time.Now().Add(-time.Minute)
+	linkA.bytesIn.Store(100)
+	linkA.closeReason = "closed by remote"
+	for _, latency := range []time.Duration{10 * time.Millisecond, 30 * time.Millisecond} {
+		for range 10 {
+			linkA.AddMeasuredLatency(latency)
+		}
+	}
+	assert.Equal(t, uint16(30), linkA.Latency())
+	p.RemoveLink(linkA)
+
+	// Removing again must not record another session.
+	p.RemoveLink(linkA)
+
+	// Check history of removed link.
+	sessions, err := p.GetLinkHistory(linkA.Peer(), since)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.False(t, sessions[0].Active)
+	assert.Equal(t, "closed by remote", sessions[0].Reason)
+	assert.Equal(t, uint64(100), sessions[0].BytesIn)
+	assert.Equal(t, uint16(20), sessions[0].AvgLatency, "latency must be averaged over the whole session")
+	assert.InDelta(t, 10*time.Minute, sessions[0].Duration(), float64(time.Second))
+
+	// Check history of all peers, including the active link.
+	sessions, err = p.GetLinkHistory(netip.Addr{}, since)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, linkB.Peer(), sessions[1].Peer)
+	assert.True(t, sessions[1].Active)
+
+	// Check summary.
+	summary := storage.SummarizeLinkSessions(linkA.Peer(), sessions[:1], since)
+	assert.Equal(t, 1, summary.Sessions)
+	assert.InDelta(t, 10.0/60.0, summary.Availability, 0.01)
+	assert.Equal(t, "closed by remote", summary.LastReason)
+}
@@ -27,8 +27,10 @@ type Listener interface {
 type ListenerBase struct {
 	id string
 
-	// listener is the actual underlying listener.
-	listener net.Listener
+	// listeners are the actual underlying listeners.
+	// Multiple listeners share the same address using SO_REUSEPORT and each
+	// have their own accept loop.
+	listeners []net.Listener
 
 	// peeringURL holds the used peering URL.
 	peeringURL *m.PeeringURL
@@ -43,20 +45,24 @@ var _ Listener = &ListenerBase{}
 
 func newListenerBase(
 	id string,
-	listener net.Listener,
+	listeners []net.Listener,
 	peeringURL *m.PeeringURL,
 	peering *Peering,
 ) *ListenerBase {
 	return &ListenerBase{
 		id:         id,
-		listener:   listener,
+		listeners:  listeners,
 		peeringURL: peeringURL,
 		peering:    peering,
 	}
 }
 
 func (ln *ListenerBase) startWorkers() {
-	ln.peering.mgr.Go("listener", ln.listenWorker)
+	for _, listener := range ln.listeners {
+		ln.peering.mgr.Go("listener", func(w *mgr.WorkerCtx) error {
+			return ln.listenWorker(w, listener)
+		})
+	}
 }
 
 // ID returns the listener ID.
@@ -71,7 +77,12 @@ func (ln *ListenerBase) PeeringURL() *m.PeeringURL {
 
 // ListenAddress returns the listen address.
 func (ln *ListenerBase) ListenAddress() net.Addr {
-	return ln.listener.Addr()
+	return ln.listeners[0].Addr()
+}
+
+// Sockets returns the amount of listening sockets.
+func (ln *ListenerBase) Sockets() int {
+	return len(ln.listeners)
 }
 
 // Close closes the listener.
@@ -86,11 +97,13 @@ func (ln *ListenerBase) Close(log func()) {
 		}
 
 		ln.peering.RemoveListener(ln.id)
-		_ = ln.listener.Close()
+		for _, listener := range ln.listeners {
+			_ = listener.Close()
+		}
 	}
 }
 
-func (ln *ListenerBase) listenWorker(w *mgr.WorkerCtx) error {
+func (ln *ListenerBase) listenWorker(w *mgr.WorkerCtx, listener net.Listener) error {
 	defer ln.Close(func() {
 		w.Info(
 			"closing listener (by listener)",
@@ -100,7 +113,7 @@ func (ln *ListenerBase) listenWorker(w *mgr.WorkerCtx) error {
 	})
 
 	for {
-		conn, err := ln.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			ln.Close(func() {
 				w.Warn(
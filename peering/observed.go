@@ -0,0 +1,157 @@
+package peering
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// Peers report back the underlay address that a connection appears to come
+// from during the link setup. This reveals the external address of the
+// router and whether it is behind a NAT, without external STUN services.
+// Observed addresses are only informational, as peers could report anything.
+
+// NATType describes how a NAT changes the underlay address of connections.
+type NATType string
+
+// NAT types.
+const (
+	// NATTypeUnknown is used when there are no observed addresses.
+	NATTypeUnknown NATType = "unknown"
+	// NATTypeNone is used when peers see a local address.
+	NATTypeNone NATType = "none"
+	// NATTypePortPreserving is used when the address is translated, but the
+	// port is kept. Incoming connections usually work with port forwarding.
+	NATTypePortPreserving NATType = "port-preserving"
+	// NATTypePortTranslating is used when the address and the port are
+	// translated.
+	NATTypePortTranslating NATType = "port-translating"
+	// NATTypeInconsistent is used when peers see different external
+	// addresses, eg. with multiple uplinks or a carrier-grade NAT pool.
+	NATTypeInconsistent NATType = "inconsistent"
+)
+
+// ObservedAddress is the underlay address of this router, as seen by a peer.
+type ObservedAddress struct {
+	Peer     netip.Addr
+	Observed netip.AddrPort
+	Local    netip.AddrPort
+	Outgoing bool
+}
+
+// ObservedAddresses returns the underlay addresses of this router, as seen by
+// the connected peers.
+func (p *Peering) ObservedAddresses() []ObservedAddress {
+	links := p.GetLinks()
+	observed := make([]ObservedAddress, 0, len(links))
+	for _, link := range links {
+		if !link.ObservedAddr().IsValid() {
+			continue
+		}
+		local, _ := underlayAddr(link.LocalAddr())
+		observed = append(observed, ObservedAddress{
+			Peer:     link.Peer(),
+			Observed: link.ObservedAddr(),
+			Local:    local,
+			Outgoing: link.Outgoing(),
+		})
+	}
+	return observed
+}
+
+// NATTypes returns the detected NAT types for IPv4 and IPv6.
+func (p *Peering) NATTypes() (ipv4, ipv6 NATType) {
+	observed := p.ObservedAddresses()
+	local := localAddrs()
+	return detectNATType(observed, local, true), detectNATType(observed, local, false)
+}
+
+// detectNATType detects the NAT type of the IPv4 or IPv6 underlay from the
+// observed addresses and the addresses of the local network interfaces.
+func detectNATType(observed []ObservedAddress, local []netip.Addr, ipv4 bool) NATType {
+	var (
+		externalIPs   []netip.Addr
+		seen          int
+		portPreserved = true
+	)
+	for _, obs := range observed {
+		ip := obs.Observed.Addr()
+		if ip.Is4() != ipv4 || !obs.Local.IsValid() {
+			continue
+		}
+
+		// Without NAT, peers see a local address. Peers in the same private
+		// network see a local address too, but this does not tell anything
+		// about the reachability from the Internet.
+		if slices.Contains(local, ip) || obs.Local.Addr() == ip {
+			if m.IsPublicIP(ip) {
+				seen++
+			}
+			continue
+		}
+		seen++
+		if !slices.Contains(externalIPs, ip) {
+			externalIPs = append(externalIPs, ip)
+		}
+		if obs.Observed.Port() != obs.Local.Port() {
+			portPreserved = false
+		}
+	}
+
+	switch {
+	case seen == 0:
+		return NATTypeUnknown
+	case len(externalIPs) == 0:
+		return NATTypeNone
+	case len(externalIPs) > 1:
+		return NATTypeInconsistent
+	case portPreserved:
+		return NATTypePortPreserving
+	default:
+		return NATTypePortTranslating
+	}
+}
+
+// minObservedConfirmations defines by how many peers an address must be
+// observed before it is announced, so that a single peer cannot make other
+// routers connect to an arbitrary address.
+const minObservedConfirmations = 2
+
+// observedPublicIPs returns the distinct public IPs of this router that were
+// observed by enough peers, most often seen first.
+func observedPublicIPs(observed []ObservedAddress) []netip.Addr {
+	counts := make(map[netip.Addr]int)
+	ips := make([]netip.Addr, 0, len(observed))
+	for _, obs := range observed {
+		ip := obs.Observed.Addr()
+		if !m.IsPublicIP(ip) {
+			continue
+		}
+		if counts[ip] == 0 {
+			ips = append(ips, ip)
+		}
+		counts[ip]++
+	}
+	ips = slices.DeleteFunc(ips, func(ip netip.Addr) bool {
+		return counts[ip] < minObservedConfirmations
+	})
+	slices.SortStableFunc(ips, func(a, b netip.Addr) int {
+		return counts[b] - counts[a]
+	})
+	return ips
+}
+
+// underlayAddr returns the IP address and port of the given network address.
+// Returns false for network addresses without IP, eg. of UNIX sockets.
+func underlayAddr(addr net.Addr) (netip.AddrPort, bool) {
+	if addr == nil {
+		return netip.AddrPort{}, false
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port()), true
+}
@@ -0,0 +1,68 @@
+package peering
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectNATType(t *testing.T) {
+	t.Parallel()
+
+	obs := func(observed, local string) ObservedAddress {
+		return ObservedAddress{
+			Observed: netip.MustParseAddrPort(observed),
+			Local:    netip.MustParseAddrPort(local),
+		}
+	}
+	local := []netip.Addr{netip.MustParseAddr("192.168.1.10"), netip.MustParseAddr("2001:db8::10")}
+
+	assert.Equal(t, NATTypeUnknown, detectNATType(nil, local, true))
+	assert.Equal(t, NATTypeNone, detectNATType([]ObservedAddress{
+		obs("[2001:db8::10]:50000", "[2001:db8::10]:50000"),
+	}, local, false))
+	assert.Equal(t, NATTypeUnknown, detectNATType([]ObservedAddress{
+		obs("[2001:db8::10]:50000", "[2001:db8::10]:50000"),
+	}, local, true), "IPv6 observations must not affect IPv4")
+
+	assert.Equal(t, NATTypeUnknown, detectNATType([]ObservedAddress{
+		obs("192.168.1.10:47369", "192.168.1.10:47369"),
+		obs("[fd12::10]:50000", "[fd12::10]:50000"),
+	}, local, true), "peers in the same private network must not indicate public reachability")
+	assert.Equal(t, NATTypeUnknown, detectNATType([]ObservedAddress{
+		obs("[fd12::10]:50000", "[fd12::10]:50000"),
+	}, local, false))
+	assert.Equal(t, NATTypePortPreserving, detectNATType([]ObservedAddress{
+		obs("198.51.100.1:47369", "192.168.1.10:47369"),
+		obs("198.51.100.1:50000", "192.168.1.10:50000"),
+	}, local, true))
+	assert.Equal(t, NATTypePortTranslating, detectNATType([]ObservedAddress{
+		obs("198.51.100.1:47369", "192.168.1.10:47369"),
+		obs("198.51.100.1:61234", "192.168.1.10:50000"),
+	}, local, true))
+	assert.Equal(t, NATTypeInconsistent, detectNATType([]ObservedAddress{
+		obs("198.51.100.1:47369", "192.168.1.10:47369"),
+		obs("198.51.100.2:47369", "192.168.1.10:47369"),
+	}, local, true))
+
+	// Only addresses confirmed by multiple peers must be announced.
+	hints := makeReachabilityHints(local, nil)
+	applyObservedAddresses(hints, []ObservedAddress{
+		obs("198.51.100.1:47369", "192.168.1.10:47369"),
+		obs("198.51.100.1:50000", "192.168.1.10:50000"),
+		obs("198.51.100.2:50001", "192.168.1.10:50001"),
+	}, local)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("198.51.100.1")}, hints.Observed)
+	assert.True(t, hints.BehindNAT)
+
+	// Private or shared addresses seen by peers are not public.
+	for _, ip := range []string{"192.168.1.10", "100.64.1.10"} {
+		hints := makeReachabilityHints([]netip.Addr{netip.MustParseAddr(ip)}, nil)
+		applyObservedAddresses(hints, []ObservedAddress{
+			obs(ip+":47369", ip+":47369"),
+		}, local)
+		assert.False(t, hints.PublicIPv4, ip)
+		assert.True(t, hints.BehindNAT, ip)
+	}
+}
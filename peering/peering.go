@@ -7,34 +7,62 @@ import (
 	"slices"
 	"sync"
 
+	"golang.org/x/time/rate"
+
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/geoip"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
 	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
 	"github.com/mycoria/mycoria/tun"
 )
 
 // Peering is a peering manager.
 type Peering struct {
-	instance       instance
-	mgr            *mgr.Manager
-	frameHandler   chan frame.Frame
-	triggerPeering chan struct{}
+	instance         instance
+	mgr              *mgr.Manager
+	frameHandler     chan frame.Frame
+	prioFrameHandler chan frame.Frame
+	triggerPeering   chan struct{}
+	listenTrigger    chan struct{}
 
 	links        map[netip.Addr]Link
 	linksByLabel map[m.SwitchLabel]Link
 	linksLock    sync.RWMutex
 
+	// drainingLinks holds the links that are outside of their schedule.
+	drainingLinks map[Link]struct{}
+
+	// retiredLabels holds old switch labels of relabeled links.
+	// They are also in linksByLabel until their grace period ends.
+	retiredLabels map[m.SwitchLabel]retiredLabel
+
 	listeners     map[string]Listener
 	listenersLock sync.RWMutex
 
 	protocols     map[string]Protocol
 	protocolsLock sync.RWMutex
 
+	// connectFailures holds the failing connections to configured peers by
+	// peering URL.
+	connectFailures     map[string]*ConnectFailure
+	connectFailuresLock sync.Mutex
+
+	// geoVerifier verifies the geo markers of peers, if configured.
+	geoVerifier *geoip.Verifier
+
+	// relayLimiter limits the relayed frames of all links.
+	relayLimiter *rate.Limiter
+
 	PeeringEvents *mgr.EventMgr[*EventPeering]
 }
 
+// ErrTooManyPeers is returned when a link to a new peer is added, but the
+// maximum amount of peers is reached.
+var ErrTooManyPeers = m.NewError(m.CodePeerLimit, "too many peers")
+
 // instance is an interface subset of inst.Ance.
 type instance interface {
 	Version() string
@@ -43,21 +71,30 @@ type instance interface {
 	FrameBuilder() *frame.Builder
 
 	State() *state.State
+	Storage() storage.Storage
 
 	TunDevice() *tun.Device
 	RoutingTable() *m.RoutingTable
 }
 
 // New returns a new peering manager.
-func New(instance instance, frameHandler chan frame.Frame) *Peering {
+// Received frames are submitted to the frame handler. Priority frames are
+// submitted to the priority frame handler instead, if set.
+func New(instance instance, frameHandler, prioFrameHandler chan frame.Frame) *Peering {
 	p := &Peering{
-		instance:       instance,
-		frameHandler:   frameHandler,
-		triggerPeering: make(chan struct{}, 1),
-		links:          make(map[netip.Addr]Link),
-		linksByLabel:   make(map[m.SwitchLabel]Link),
-		listeners:      make(map[string]Listener),
-		protocols:      make(map[string]Protocol),
+		instance:         instance,
+		frameHandler:     frameHandler,
+		prioFrameHandler: prioFrameHandler,
+		triggerPeering:   make(chan struct{}, 1),
+		listenTrigger:    make(chan struct{}, 1),
+		links:            make(map[netip.Addr]Link),
+		linksByLabel:     make(map[m.SwitchLabel]Link),
+		retiredLabels:    make(map[m.SwitchLabel]retiredLabel),
+		listeners:        make(map[string]Listener),
+		protocols:        make(map[string]Protocol),
+		connectFailures:  make(map[string]*ConnectFailure),
+		PeeringEvents:    mgr.NewEventMgr[*EventPeering]("peering", nil),
+		relayLimiter:     newRelayLimiter(),
 	}
 
 	return p
@@ -68,10 +105,13 @@ func New(instance instance, frameHandler chan frame.Frame) *Peering {
 // - Connects to configured peers.
 func (p *Peering) Start(m *mgr.Manager) error {
 	p.mgr = m
-	p.PeeringEvents = mgr.NewEventMgr[*EventPeering]("peering", p.mgr)
+	p.PeeringEvents.SetManager(p.mgr)
+	p.loadGeoVerifier()
 
 	p.mgr.Go("listen manager", p.listenMgr)
 	p.mgr.Go("connect manager", p.connectMgr)
+	p.mgr.Go("switch label manager", p.switchLabelWorker)
+	p.mgr.Go("schedule manager", p.scheduleMgr)
 
 	return nil
 }
@@ -143,10 +183,42 @@ func (p *Peering) GetLinks() []Link {
 }
 
 // AddLink adds the link to the peering list.
+// If there already is a link to the same peer, the links are bonded.
 func (p *Peering) AddLink(link Link) error {
 	p.linksLock.Lock()
 	defer p.linksLock.Unlock()
 
+	// Bond with existing link to the same peer.
+	if existing, ok := p.links[link.Peer()]; ok && unwrapChaos(existing) != link && !existing.IsClosing() {
+		bond, isBond := unwrapChaos(existing).(*LinkBond)
+		if !isBond {
+			bond = newLinkBond(unwrapChaos(existing))
+			wrapped := rewrapChaos(existing, bond)
+			p.links[bond.Peer()] = wrapped
+			p.linksByLabel[bond.SwitchLabel()] = wrapped
+		}
+		bond.add(link)
+		p.PeeringEvents.Submit(&EventPeering{
+			Peer:  link.Peer(),
+			State: EventStateBonded,
+		})
+		return nil
+	}
+
+	// Check if the peer limit is reached.
+	if maxPeers := p.instance.Config().Limits.MaxPeers; maxPeers > 0 && len(p.links) >= maxPeers {
+		return ErrTooManyPeers
+	}
+
+	// Check if the switch label was taken in the meantime.
+	label := link.SwitchLabel()
+	if existing, ok := p.linksByLabel[label]; ok {
+		if _, retired := p.retiredLabels[label]; !retired && existing.Peer() != link.Peer() {
+			return ErrSwitchLabelInUse
+		}
+		delete(p.retiredLabels, label)
+	}
+
 	_, err := p.instance.RoutingTable().AddRoute(m.RoutingTableEntry{
 		DstIP:   link.Peer(),
 		NextHop: link.Peer(),
@@ -157,19 +229,90 @@ func (p *Peering) AddLink(link Link) error {
 	}
 
 	p.links[link.Peer()] = link
-	p.linksByLabel[link.SwitchLabel()] = link
+	p.linksByLabel[label] = link
+	p.PeeringEvents.Submit(&EventPeering{
+		Peer:  link.Peer(),
+		State: EventStateUp,
+	})
 	return nil
 }
 
 // RemoveLink removes the link from the peering list.
+// If the link is a member of a bond, it is only removed from the bond, until
+// the last member is removed.
 // The link is not closed by this function!
 func (p *Peering) RemoveLink(link Link) {
 	p.linksLock.Lock()
 	defer p.linksLock.Unlock()
 
+	// Links with fault injection are stored wrapped, but callers pass the
+	// inner link.
+	stored := p.links[link.Peer()]
+	current := unwrapChaos(stored)
+	switch {
+	case current == nil:
+		// Link is not active.
+		p.removeRetiredLabelsLocked(link)
+		return
+
+	case current == link, stored == link:
+		// Remove below.
+
+	default:
+		// Check if the link is a member of a bond.
+		bond, isBond := current.(*LinkBond)
+		if !isBond || !bond.remove(link) {
+			// Link was replaced or never added.
+			p.removeRetiredLabelsOfLinkLocked(link)
+			return
+		}
+		p.recordLinkSession(link)
+		p.removeRetiredLabelsOfLinkLocked(link)
+
+		// Keep the bond while there are other members.
+		members := bond.Members()
+		switch len(members) {
+		case 0:
+			// Remove bond below.
+			link = bond
+		case 1:
+			// Unwrap the remaining link.
+			remaining := rewrapChaos(stored, members[0])
+			p.links[bond.Peer()] = remaining
+			p.linksByLabel[bond.SwitchLabel()] = remaining
+			p.PeeringEvents.Submit(&EventPeering{
+				Peer:  link.Peer(),
+				State: EventStateUnbonded,
+			})
+			return
+		default:
+			p.PeeringEvents.Submit(&EventPeering{
+				Peer:  link.Peer(),
+				State: EventStateUnbonded,
+			})
+			return
+		}
+	}
+
 	delete(p.links, link.Peer())
 	delete(p.linksByLabel, link.SwitchLabel())
+	p.removeRetiredLabelsLocked(link)
 	p.instance.RoutingTable().RemoveNextHop(link.Peer())
+	if p.geoVerifier != nil {
+		p.geoVerifier.Forget(link.Peer())
+	}
+	p.PeeringEvents.Submit(&EventPeering{
+		Peer:  link.Peer(),
+		State: EventStateDown,
+	})
+	if bond, isBond := link.(*LinkBond); isBond {
+		// Record remaining members, as they are not active anymore.
+		for _, member := range bond.Members() {
+			p.recordLinkSession(member)
+		}
+	} else {
+		p.recordLinkSession(link)
+	}
 
 	// If we reach zero links, trigger peering.
 	if len(p.links) == 0 && !p.mgr.IsDone() {
@@ -188,7 +331,7 @@ func (p *Peering) CloseLink(ip netip.Addr) {
 	}()
 
 	if link != nil {
-		link.Close(func() {
+		link.Close("closed by manager", func() {
 			p.mgr.Info(
 				"closing link (by manager)",
 				"peer", link.Peer(),
@@ -202,7 +345,7 @@ func (p *Peering) CloseLink(ip netip.Addr) {
 func (p *Peering) closeAllLinks() {
 	for _, l := range p.copyLinksWithLocking() {
 		link := l
-		link.Close(func() {
+		link.Close("router stopped", func() {
 			p.mgr.Info(
 				"closing link (by manager)",
 				"peer", link.Peer(),
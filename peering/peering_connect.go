@@ -63,9 +63,10 @@ func (p *Peering) checkConnect(w *mgr.WorkerCtx, connected map[string]netip.Addr
 	}
 
 	// Connect
+	now := time.Now()
 	for _, peeringURL := range p.instance.Config().Router.Connect {
 		// Check if we are already connected.
-		if ip, ok := connected[peeringURL]; ok && p.GetLink(ip) != nil {
+		if ip, ok := connected[peeringURL]; ok && p.isConnectedVia(ip, peeringURL) {
 			continue
 		}
 
@@ -77,22 +78,37 @@ func (p *Peering) checkConnect(w *mgr.WorkerCtx, connected map[string]netip.Addr
 				"peeringURL", peeringURL,
 				"err", err,
 			)
+			p.recordConnectFailure(peeringURL, ConnectFailureConfig, err)
+			continue
+		}
+		if !inSchedule(u, now) {
+			p.clearConnectFailure(peeringURL)
 			continue
 		}
 
 		// Connect to router.
 		newLink, err := p.PeerWith(u, netip.Addr{})
+		if errors.Is(err, ErrAlreadyConnected) {
+			// The peer connected to us.
+			p.clearConnectFailure(peeringURL)
+			continue
+		}
 		if err != nil {
+			reason := classifyConnectError(err)
 			w.Warn(
 				"failed to connect",
 				"peeringURL", peeringURL,
+				"reason", reason,
+				"hint", reason.Hint(),
 				"err", err,
 			)
+			p.recordConnectFailure(peeringURL, reason, err)
 			continue
 		}
 
 		// Add connection to state map.
 		connected[peeringURL] = newLink.Peer()
+		p.clearConnectFailure(peeringURL)
 	}
 
 	// Connect to the two nearest routers in the address space.
@@ -115,6 +131,7 @@ func (p *Peering) checkConnect(w *mgr.WorkerCtx, connected map[string]netip.Addr
 			)
 		} else {
 			var connectedCnt int
+			canIPv4, canIPv6 := usableAddressFamilies(localAddrs())
 
 		connectToNearest:
 			for _, near := range nearest {
@@ -139,7 +156,8 @@ func (p *Peering) checkConnect(w *mgr.WorkerCtx, connected map[string]netip.Addr
 					}
 				}
 
-				// Attempt to connect.
+				// Attempt to connect, trying the hosts most likely to work first.
+				hosts := near.PublicInfo.Reachability.OrderHosts(near.PublicInfo.IANA, canIPv4, canIPv6)
 				for _, listener := range near.PublicInfo.Listeners {
 					u, err := m.ParsePeeringURL(listener)
 					if err != nil {
@@ -151,10 +169,14 @@ func (p *Peering) checkConnect(w *mgr.WorkerCtx, connected map[string]netip.Addr
 						)
 						continue connectToNearest
 					}
+					if u.IsLocal() {
+						// Never connect to local sockets advertised by others.
+						continue
+					}
 
 					// Try to connect on all available Domains/IPs.
-					for _, iana := range near.PublicInfo.IANA {
-						u.Domain = iana
+					for _, host := range hosts {
+						u.Domain = host
 						_, err = p.PeerWith(u, netip.Addr{})
 						if err == nil {
 							// Connected!
@@ -195,6 +217,9 @@ func (p *Peering) checkConnect(w *mgr.WorkerCtx, connected map[string]netip.Addr
 				)
 				continue
 			}
+			if !inSchedule(u, now) {
+				continue
+			}
 
 			// Connect to router.
 			_, err = p.PeerWith(u, netip.Addr{})
@@ -212,3 +237,28 @@ func (p *Peering) checkConnect(w *mgr.WorkerCtx, connected map[string]netip.Addr
 		}
 	}
 }
+
+// isConnectedVia returns whether there is a link to the given peer.
+// With bonding enabled, the link must also use the given peering URL, as
+// there may be multiple links to the same peer.
+func (p *Peering) isConnectedVia(ip netip.Addr, peeringURL string) bool {
+	link := p.GetLink(ip)
+	switch {
+	case link == nil:
+		return false
+	case !p.instance.Config().Router.Bonding:
+		return true
+	}
+
+	u, err := m.ParsePeeringURL(peeringURL)
+	if err != nil {
+		return false
+	}
+	links := LinkMembers(link)
+	for _, link := range links {
+		if link.PeeringURL() != nil && link.PeeringURL().String() == u.String() {
+			return true
+		}
+	}
+	return false
+}
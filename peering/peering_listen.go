@@ -8,6 +8,14 @@ import (
 	"github.com/mycoria/mycoria/mgr"
 )
 
+// triggerListen triggers checking and starting listeners.
+func (p *Peering) triggerListen() {
+	select {
+	case p.listenTrigger <- struct{}{}:
+	default:
+	}
+}
+
 func (p *Peering) listenMgr(w *mgr.WorkerCtx) error {
 	listening := make(map[string]string)
 	p.checkListen(w, listening)
@@ -19,11 +27,15 @@ func (p *Peering) listenMgr(w *mgr.WorkerCtx) error {
 			return nil
 		case <-ticker.C:
 			p.checkListen(w, listening)
+		case <-p.listenTrigger:
+			p.checkListen(w, listening)
 		}
 	}
 }
 
 func (p *Peering) checkListen(w *mgr.WorkerCtx, listening map[string]string) {
+	now := time.Now()
+
 	// Start listeners.
 	for _, listenURL := range p.instance.Config().Router.Listen {
 		// Check if we are already connected.
@@ -41,13 +53,16 @@ func (p *Peering) checkListen(w *mgr.WorkerCtx, listening map[string]string) {
 			)
 			continue
 		}
+		if !inSchedule(u, now) {
+			continue
+		}
 
 		// Start listener.
 		ln, err := p.StartListener(u, netip.Addr{})
 		if err != nil {
 			w.Warn(
 				"failed to listen",
-				"listenURL", ln.ID(),
+				"listenURL", listenURL,
 				"err", err,
 			)
 			continue
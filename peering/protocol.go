@@ -2,6 +2,7 @@ package peering
 
 import (
 	"errors"
+	"fmt"
 	"net/netip"
 
 	"github.com/mycoria/mycoria/m"
@@ -17,6 +18,16 @@ type Protocol interface {
 	StartListener(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Listener, error)
 }
 
+// TransportMargins is implemented by protocols that need space before or after
+// every record they send, eg. for their own headers or authentication data.
+// Frames are built with this space reserved, so that the protocol can fill it
+// in without copying. Records passed to the connection include the margins.
+type TransportMargins interface {
+	// TransportMargins returns the bytes required before and after every
+	// record.
+	TransportMargins() (offset, overhead int)
+}
+
 // GetProtocol adds a new protocol.
 func (p *Peering) GetProtocol(id string) Protocol {
 	p.protocolsLock.RLock()
@@ -26,11 +37,40 @@ func (p *Peering) GetProtocol(id string) Protocol {
 }
 
 // AddProtocol adds a new protocol.
-func (p *Peering) AddProtocol(id string, prot Protocol) {
+// If the protocol requires transport margins, they are registered with the
+// frame builder.
+func (p *Peering) AddProtocol(id string, prot Protocol) error {
 	p.protocolsLock.Lock()
 	defer p.protocolsLock.Unlock()
 
+	// Register transport margins on top of the link frame margins.
+	var offset, overhead int
+	if tm, ok := prot.(TransportMargins); ok {
+		offset, overhead = tm.TransportMargins()
+	}
+	marginsName := "transport " + id
+	switch {
+	case offset < 0 || overhead < 0:
+		return fmt.Errorf("protocol %s has invalid transport margins %d,%d", id, offset, overhead)
+	case offset > 0 || overhead > 0:
+		err := p.instance.FrameBuilder().RegisterFrameMargins(marginsName, FrameOffset+offset, FrameOverhead+overhead)
+		if err != nil {
+			return fmt.Errorf("register transport margins of protocol %s: %w", id, err)
+		}
+	default:
+		p.instance.FrameBuilder().UnregisterFrameMargins(marginsName)
+	}
+
 	p.protocols[id] = prot
+	return nil
+}
+
+// transportMargins returns the transport margins of the given protocol.
+func (p *Peering) transportMargins(id string) (offset, overhead int) {
+	if tm, ok := p.GetProtocol(id).(TransportMargins); ok {
+		return tm.TransportMargins()
+	}
+	return 0, 0
 }
 
 // PeerWith establishes a connection with the given peering URL.
@@ -61,6 +101,9 @@ type ProtocolFunctions struct {
 	name          string
 	peerWith      func(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Link, error)
 	startListener func(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Listener, error)
+
+	marginOffset   int
+	marginOverhead int
 }
 
 // NewProtocol returns a new protocol using the given functions.
@@ -76,6 +119,19 @@ func NewProtocol(
 	}
 }
 
+// WithTransportMargins sets the transport margins the protocol requires and
+// returns the protocol for chaining.
+func (p *ProtocolFunctions) WithTransportMargins(offset, overhead int) *ProtocolFunctions {
+	p.marginOffset = offset
+	p.marginOverhead = overhead
+	return p
+}
+
+// TransportMargins returns the bytes required before and after every record.
+func (p *ProtocolFunctions) TransportMargins() (offset, overhead int) {
+	return p.marginOffset, p.marginOverhead
+}
+
 // Name returns the protocol name/scheme.
 func (p *ProtocolFunctions) Name() string {
 	return p.name
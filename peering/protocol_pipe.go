@@ -54,7 +54,7 @@ func (pipe *protocolPipe) StartListener(peering *Peering, peeringURL *m.PeeringU
 	// Start listener.
 	newListener := newListenerBase(
 		peeringURL.FormatWith(ip.String()),
-		pipe,
+		[]net.Listener{pipe},
 		peeringURL,
 		peering,
 	)
@@ -32,6 +32,16 @@ func tcpPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Lin
 		return nil, errors.New("host not specified")
 	}
 	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
+	tcpOpts, err := parseTCPOptions(peeringURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseBondWeight(peeringURL.Param(m.PeeringURLParamWeight)); err != nil {
+		return nil, err
+	}
+	if _, err := parseFECParams(peeringURL.Param(m.PeeringURLParamFEC)); err != nil {
+		return nil, err
+	}
 
 	// Connect.
 	dialer := &net.Dialer{
@@ -39,10 +49,25 @@ func tcpPeerWith(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr) (Lin
 		FallbackDelay: -1, // Disables Fast Fallback from IPv6 to IPv4.
 		KeepAlive:     -1, // Disable keep-alive.
 	}
+	if binding, ok := peering.outgoingBinding(peeringURL); ok {
+		if err := binding.applyToDialer(dialer, "tcp"); err != nil {
+			return nil, fmt.Errorf("bind to %s: %w", binding, err)
+		}
+	}
 	conn, err := dialer.DialContext(peering.mgr.Ctx(), "tcp", address)
 	if err != nil {
 		return nil, fmt.Errorf("connect to %s: %w", address, err)
 	}
+	if tcpOpts != nil {
+		// Options are best effort.
+		if err := tcpOpts.apply(conn); err != nil {
+			peering.mgr.Warn(
+				"failed to apply tcp options to connection",
+				"address", address,
+				"err", err,
+			)
+		}
+	}
 
 	// Start link setup.
 	newLink := newLinkBase(
@@ -65,18 +90,53 @@ func tcpStartListener(peering *Peering, peeringURL *m.PeeringURL, ip netip.Addr)
 	default:
 		host = ""
 	}
+
+	// Apply binding.
+	var lc net.ListenConfig
+	if bind := peeringURL.Param(m.PeeringURLParamBind); bind != "" {
+		binding := parseSocketBinding(bind)
+		if binding.ip.IsValid() {
+			host = binding.ip.String()
+		}
+		if err := binding.applyToListenConfig(&lc); err != nil {
+			return nil, fmt.Errorf("bind to %s: %w", binding, err)
+		}
+	}
 	address := net.JoinHostPort(host, strconv.FormatUint(uint64(peeringURL.Port), 10))
 
-	// Bind listener.
-	ln, err := net.Listen("tcp", address)
+	// Bind listeners.
+	sockets, err := parseListenSockets(peeringURL.Param(m.PeeringURLParamSockets))
+	if err != nil {
+		return nil, err
+	}
+	tcpOpts, err := parseTCPOptions(peeringURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseBondWeight(peeringURL.Param(m.PeeringURLParamWeight)); err != nil {
+		return nil, err
+	}
+	if _, err := parseFECParams(peeringURL.Param(m.PeeringURLParamFEC)); err != nil {
+		return nil, err
+	}
+	listeners, err := listenSockets(peering.mgr.Ctx(), lc, "tcp", address, sockets)
 	if err != nil {
 		return nil, fmt.Errorf("listen: %w", err)
 	}
+	if tcpOpts != nil {
+		for i, ln := range listeners {
+			listeners[i] = &tuningListener{
+				Listener: ln,
+				opts:     tcpOpts,
+				peering:  peering,
+			}
+		}
+	}
 
 	// Start listener.
 	newListener := newListenerBase(
 		peeringURL.FormatWith(host),
-		ln,
+		listeners,
 		peeringURL,
 		peering,
 	)
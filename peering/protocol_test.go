@@ -31,8 +31,8 @@ func TestProtocol(t *testing.T) {
 	})
 	i1 := getTestInstance(t, c)
 	i2 := getTestInstance(t, c)
-	p1 := New(i1, make(chan frame.Frame))
-	p2 := New(i2, make(chan frame.Frame))
+	p1 := New(i1, make(chan frame.Frame), nil)
+	p2 := New(i2, make(chan frame.Frame), nil)
 
 	err := p1.Start(mgr.New("peering1"))
 	if err != nil {
@@ -56,8 +56,12 @@ func TestProtocol(t *testing.T) {
 
 	// Add pipe protocol for testing.
 	pipe1, pipe2 := NewConnectedPipeStacks()
-	p1.AddProtocol("pipe", pipe1)
-	p2.AddProtocol("pipe", pipe2)
+	if err := p1.AddProtocol("pipe", pipe1); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2.AddProtocol("pipe", pipe2); err != nil {
+		t.Fatal(err)
+	}
 
 	// Start listener.
 	_, err = p1.StartListener(&m.PeeringURL{Protocol: "pipe"}, netip.IPv4Unspecified())
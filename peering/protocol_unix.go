@@ -0,0 +1,131 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ProtocolUnix uses UNIX sockets for peering on the same host.
+var ProtocolUnix = NewProtocol(
+	m.PeeringProtocolUnix,
+	unixPeerWith,
+	unixStartListener,
+)
+
+var _ Protocol = ProtocolUnix
+
+func unixPeerWith(peering *Peering, peeringURL *m.PeeringURL, _ netip.Addr) (Link, error) {
+	path := peeringURL.SocketPath()
+	if err := checkUnixPeeringURL(peeringURL); err != nil {
+		return nil, err
+	}
+
+	// Connect.
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+	}
+	conn, err := dialer.DialContext(peering.mgr.Ctx(), "unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", path, err)
+	}
+
+	// Start link setup.
+	newLink := newLinkBase(
+		conn,
+		peeringURL,
+		true,
+		peering,
+	)
+	return newLink.handleSetup(peering.mgr)
+}
+
+func unixStartListener(peering *Peering, peeringURL *m.PeeringURL, _ netip.Addr) (Listener, error) {
+	path := peeringURL.SocketPath()
+	if err := checkUnixPeeringURL(peeringURL); err != nil {
+		return nil, err
+	}
+
+	// Remove socket left over from an unclean shutdown.
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	// Listen.
+	var lc net.ListenConfig
+	listener, err := lc.Listen(peering.mgr.Ctx(), "unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	// Start listener.
+	newListener := newListenerBase(
+		peeringURL.FormatWith(""),
+		[]net.Listener{listener},
+		peeringURL,
+		peering,
+	)
+	newListener.startWorkers()
+
+	// Add to peering manager and return.
+	peering.AddListener(newListener.id, newListener)
+	return newListener, nil
+}
+
+// checkUnixPeeringURL checks the query parameters of a unix peering URL.
+// Socket options do not apply to UNIX sockets.
+func checkUnixPeeringURL(peeringURL *m.PeeringURL) error {
+	for _, key := range []string{
+		m.PeeringURLParamBind,
+		m.PeeringURLParamSockets,
+		m.PeeringURLParamNoDelay,
+		m.PeeringURLParamKeepAlive,
+		m.PeeringURLParamUserTimeout,
+		m.PeeringURLParamReadBuffer,
+		m.PeeringURLParamWriteBuffer,
+		m.PeeringURLParamCongestion,
+	} {
+		if peeringURL.Param(key) != "" {
+			return fmt.Errorf("%s is not supported on unix sockets", key)
+		}
+	}
+	if _, err := parseBondWeight(peeringURL.Param(m.PeeringURLParamWeight)); err != nil {
+		return err
+	}
+	if _, err := parseFECParams(peeringURL.Param(m.PeeringURLParamFEC)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// removeStaleSocket removes the socket at the given path, if it exists and
+// nobody is listening on it anymore.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("check socket: %w", err)
+	case info.Mode().Type() != fs.ModeSocket:
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	// Check if the socket is still in use.
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+	return nil
+}
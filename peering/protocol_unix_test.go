@@ -0,0 +1,64 @@
+package peering
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestProtocolUnix(t *testing.T) {
+	t.Parallel()
+
+	// Build peering instances.
+	c := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Universe:       "test",
+			UniverseSecret: "password",
+		},
+	})
+	i1 := getTestInstance(t, c)
+	i2 := getTestInstance(t, c)
+	p1 := New(i1, make(chan frame.Frame), nil)
+	p2 := New(i2, make(chan frame.Frame), nil)
+	require.NoError(t, p1.Start(mgr.New("peering1")))
+	require.NoError(t, p2.Start(mgr.New("peering2")))
+	require.NoError(t, p1.AddProtocol("unix", ProtocolUnix))
+	require.NoError(t, p2.AddProtocol("unix", ProtocolUnix))
+
+	// Start listener and connect.
+	// Also use FEC to test it on a real link.
+	u, err := m.ParsePeeringURL("unix://" + filepath.Join(t.TempDir(), "peering.sock") + "?fec=2:1")
+	require.NoError(t, err)
+	_, err = p1.StartListener(u, netip.Addr{})
+	require.NoError(t, err)
+	link, err := p2.PeerWith(u, netip.Addr{})
+	require.NoError(t, err)
+
+	// Send messages.
+	for range 5 {
+		testFrame, err := i2.FrameBuilder().NewFrameV1(
+			m.RouterAddress,
+			m.RouterAddress,
+			frame.NetworkTraffic,
+			nil,
+			[]byte(testRequest),
+			nil,
+		)
+		require.NoError(t, err)
+		require.NoError(t, link.Send(testFrame))
+
+		f := <-p1.frameHandler
+		assert.Equal(t, testRequest, string(f.MessageData()), "result must match")
+	}
+
+	require.NoError(t, p1.Stop(p1.mgr))
+	require.NoError(t, p2.Stop(p2.mgr))
+}
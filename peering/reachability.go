@@ -0,0 +1,119 @@
+package peering
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ReachabilityHints returns hints on how the listeners of this router can be
+// reached. Returns nil if the router has no public listeners.
+func (p *Peering) ReachabilityHints() *m.ReachabilityHints {
+	info := p.instance.Config().GetRouterInfo()
+	if len(info.Listeners) == 0 {
+		return nil
+	}
+
+	hints := makeReachabilityHints(localAddrs(), info.IANA)
+	applyObservedAddresses(hints, p.ObservedAddresses(), localAddrs())
+	if hints.IsEmpty() {
+		return nil
+	}
+	return hints
+}
+
+// makeReachabilityHints derives reachability hints from the addresses of the
+// local network interfaces and the configured IANA hosts.
+func makeReachabilityHints(local []netip.Addr, iana []string) *m.ReachabilityHints {
+	hints := &m.ReachabilityHints{}
+
+	// Check local addresses.
+	var privateIPv4 bool
+	for _, ip := range local {
+		switch {
+		case m.IsPublicIP(ip) && ip.Is4():
+			hints.PublicIPv4 = true
+		case m.IsPublicIP(ip):
+			hints.PublicIPv6 = true
+		case ip.Is4() && (ip.IsPrivate() || m.SharedAddressSpace.Contains(ip)):
+			privateIPv4 = true
+		}
+	}
+	hints.BehindNAT = !hints.PublicIPv4 && privateIPv4
+
+	// Configured IANA IPs are reachable, eg. via port forwarding.
+	for _, host := range iana {
+		ip, err := netip.ParseAddr(host)
+		if err != nil || !m.IsPublicIP(ip) {
+			continue
+		}
+		if ip.Unmap().Is4() {
+			hints.PublicIPv4 = true
+		} else {
+			hints.PublicIPv6 = true
+		}
+	}
+
+	return hints
+}
+
+// applyObservedAddresses adds the addresses observed by peers to the hints.
+// Observations take precedence over the guesses from the local addresses.
+func applyObservedAddresses(hints *m.ReachabilityHints, observed []ObservedAddress, local []netip.Addr) {
+	hints.Observed = observedPublicIPs(observed)
+	if len(hints.Observed) > m.MaxObservedAddresses {
+		hints.Observed = hints.Observed[:m.MaxObservedAddresses]
+	}
+
+	switch detectNATType(observed, local, true) {
+	case NATTypeUnknown:
+	case NATTypeNone:
+		hints.BehindNAT = false
+		hints.PublicIPv4 = true
+	default:
+		hints.BehindNAT = true
+	}
+	if detectNATType(observed, local, false) == NATTypeNone {
+		hints.PublicIPv6 = true
+	}
+}
+
+// localAddrs returns the addresses of the local network interfaces.
+func localAddrs() []netip.Addr {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	ips := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			if ip, ok := netip.AddrFromSlice(ipNet.IP); ok {
+				ips = append(ips, ip.Unmap())
+			}
+		}
+	}
+	return ips
+}
+
+// usableAddressFamilies returns which address families can be used for
+// outgoing connections, based on the addresses of the local network
+// interfaces. If the interfaces are unknown, both are assumed to be usable.
+func usableAddressFamilies(local []netip.Addr) (canIPv4, canIPv6 bool) {
+	if len(local) == 0 {
+		return true, true
+	}
+
+	for _, ip := range local {
+		switch {
+		case ip.IsLoopback() || ip.IsLinkLocalUnicast():
+		case ip.Is4():
+			canIPv4 = true
+		case m.IsPublicIP(ip):
+			// Private IPv6 addresses, including our own, do not reach the internet.
+			canIPv6 = true
+		}
+	}
+	return canIPv4, canIPv6
+}
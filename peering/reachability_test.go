@@ -0,0 +1,46 @@
+package peering
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeReachabilityHints(t *testing.T) {
+	t.Parallel()
+
+	addrs := func(ips ...string) []netip.Addr {
+		list := make([]netip.Addr, 0, len(ips))
+		for _, ip := range ips {
+			list = append(list, netip.MustParseAddr(ip))
+		}
+		return list
+	}
+
+	// Home router: private IPv4, public IPv6.
+	hints := makeReachabilityHints(addrs("127.0.0.1", "192.168.1.10", "2001:db8::10", "fe80::1"), nil)
+	assert.False(t, hints.PublicIPv4)
+	assert.True(t, hints.PublicIPv6)
+	assert.True(t, hints.BehindNAT)
+
+	// Port forwarding configured with the IANA IP.
+	hints = makeReachabilityHints(addrs("192.168.1.10"), []string{"198.51.100.1", "example.com"})
+	assert.True(t, hints.PublicIPv4)
+	assert.False(t, hints.PublicIPv6)
+	assert.True(t, hints.BehindNAT)
+
+	// Server with public addresses.
+	hints = makeReachabilityHints(addrs("198.51.100.1", "2001:db8::1"), nil)
+	assert.True(t, hints.PublicIPv4)
+	assert.True(t, hints.PublicIPv6)
+	assert.False(t, hints.BehindNAT)
+
+	// Usable address families.
+	canIPv4, canIPv6 := usableAddressFamilies(addrs("127.0.0.1", "::1", "192.168.1.10", "fd12::1"))
+	assert.True(t, canIPv4)
+	assert.False(t, canIPv6)
+	canIPv4, canIPv6 = usableAddressFamilies(nil)
+	assert.True(t, canIPv4)
+	assert.True(t, canIPv6)
+}
@@ -0,0 +1,158 @@
+package peering
+
+import (
+	"net/netip"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+)
+
+// relayBudgetMinBurst is the minimum burst of relay budgets in bytes, so that
+// the biggest frames always fit.
+const relayBudgetMinBurst = 1 << 16
+
+// newRelayLimiter returns a rate limiter for relayed frames, which is
+// unlimited until its limit is set.
+func newRelayLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Inf, relayBudgetMinBurst)
+}
+
+// setRelayLimit sets the bandwidth of the rate limiter in bytes per second,
+// if it changed. Zero means unlimited.
+func setRelayLimit(limiter *rate.Limiter, bandwidth uint64) {
+	limit := rate.Inf
+	if bandwidth > 0 {
+		limit = rate.Limit(bandwidth)
+	}
+	if limiter.Limit() == limit {
+		return
+	}
+	limiter.SetBurst(max(int(bandwidth/10), relayBudgetMinBurst))
+	limiter.SetLimit(limit)
+}
+
+// relayBudget limits the bandwidth of relayed frames sent on a link.
+// The limits are read from the config on use, so that changes are applied
+// to existing links.
+type relayBudget struct {
+	// router is the IP of this router. Frames from other routers are relayed.
+	router netip.Addr
+	// config returns the current relay budget config. Nil means unlimited.
+	config func() *config.RelayBudget
+	// total limits the relayed frames of all links.
+	total *rate.Limiter
+	// perPeer limits the relayed frames of the link.
+	perPeer *rate.Limiter
+}
+
+// newRelayBudget returns the relay budget for a new link.
+// Returns nil if relayed frames are not limited when the link is created.
+func (p *Peering) newRelayBudget() *relayBudget {
+	if p.instance.Config().GetRelayBudget() == nil {
+		return nil
+	}
+	return &relayBudget{
+		router:  p.instance.Identity().IP,
+		config:  p.instance.Config().GetRelayBudget,
+		total:   p.relayLimiter,
+		perPeer: newRelayLimiter(),
+	}
+}
+
+// isRelayed returns whether the frame is relayed for another router.
+func (rb *relayBudget) isRelayed(f frame.Frame) bool {
+	return f.SrcIP() != rb.router
+}
+
+// reserve takes the size of the frame from the budget and returns how long to
+// wait until the frame may be sent.
+func (rb *relayBudget) reserve(f frame.Frame) time.Duration {
+	now := time.Now()
+	size := frame.Size(f)
+
+	// Apply the current limits.
+	var total, perPeer uint64
+	if cfg := rb.config(); cfg != nil {
+		total, perPeer = cfg.Total, cfg.PerPeer
+	}
+	setRelayLimit(rb.total, total)
+	setRelayLimit(rb.perPeer, perPeer)
+
+	var delay time.Duration
+	for _, limiter := range []*rate.Limiter{rb.total, rb.perPeer} {
+		delay = max(delay, limiter.ReserveN(now, size).DelayFrom(now))
+	}
+	return delay
+}
+
+// relayScheduler holds back relayed frames of a link writer until they are
+// within the relay budget. Only one frame is held back at a time, so that
+// the others wait in the send queue.
+type relayScheduler struct {
+	budget  *relayBudget
+	queue   <-chan frame.Frame
+	waiting frame.Frame
+	timer   *time.Timer
+}
+
+func (link *LinkBase) newRelayScheduler() *relayScheduler {
+	return &relayScheduler{
+		budget: link.relayBudget,
+		queue:  link.sendQueueRelay,
+	}
+}
+
+// next returns the queue of relayed frames, if no frame is held back.
+// Returns nil otherwise or if relayed frames are not limited.
+func (rs *relayScheduler) next() <-chan frame.Frame {
+	if rs.waiting != nil {
+		return nil
+	}
+	return rs.queue
+}
+
+// ready returns a channel that fires when the held back frame may be sent.
+func (rs *relayScheduler) ready() <-chan time.Time {
+	if rs.waiting == nil {
+		return nil
+	}
+	return rs.timer.C
+}
+
+// admit returns whether the relayed frame may be sent now. Otherwise, the
+// frame is held back until it is released.
+func (rs *relayScheduler) admit(f frame.Frame) bool {
+	delay := rs.budget.reserve(f)
+	if delay <= 0 {
+		return true
+	}
+
+	rs.waiting = f
+	if rs.timer == nil {
+		rs.timer = time.NewTimer(delay)
+	} else {
+		rs.timer.Reset(delay)
+	}
+	return false
+}
+
+// release returns the held back frame after it became ready.
+func (rs *relayScheduler) release() frame.Frame {
+	f := rs.waiting
+	rs.waiting = nil
+	return f
+}
+
+// stop stops the scheduler and discards the held back frame.
+func (rs *relayScheduler) stop() {
+	if rs.timer != nil {
+		rs.timer.Stop()
+	}
+	if rs.waiting != nil {
+		rs.waiting.ReturnToPool()
+		rs.waiting = nil
+	}
+}
@@ -0,0 +1,115 @@
+package peering
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+)
+
+func TestRelayBudget(t *testing.T) {
+	t.Parallel()
+
+	router := netip.MustParseAddr("fd00::1")
+	other := netip.MustParseAddr("fd00::2")
+
+	b := frame.NewFrameBuilder()
+	b.SetFrameMargins(FrameOffset, FrameOverhead)
+	newFrame := func(src netip.Addr) frame.Frame {
+		t.Helper()
+
+		f, err := b.NewFrameV1(src, netip.IPv6LinkLocalAllRouters(), frame.NetworkTraffic, nil, make([]byte, 100), nil)
+		require.NoError(t, err)
+		return f
+	}
+
+	// Allow a single frame per second.
+	size := frame.Size(newFrame(other))
+	perPeer := rate.NewLimiter(rate.Limit(size), size)
+	link := &LinkBase{
+		sendQueuePrio:  make(chan frame.Frame, 10),
+		sendQueueRegl:  make(chan frame.Frame, 10),
+		sendQueueRelay: make(chan frame.Frame, 10),
+		relayBudget: &relayBudget{
+			router: router,
+			config: func() *config.RelayBudget {
+				return &config.RelayBudget{PerPeer: uint64(size)}
+			},
+			total:   newRelayLimiter(),
+			perPeer: perPeer,
+		},
+	}
+
+	// Relayed frames must be queued separately.
+	require.NoError(t, link.Send(newFrame(router)))
+	require.NoError(t, link.Send(newFrame(other)))
+	require.NoError(t, link.Send(newFrame(other)))
+	assert.Len(t, link.sendQueueRegl, 1)
+	assert.Len(t, link.sendQueueRelay, 2)
+
+	// First relayed frame is within budget.
+	relay := link.newRelayScheduler()
+	defer relay.stop()
+	f := <-relay.next()
+	assert.True(t, relay.admit(f))
+	assert.Nil(t, relay.ready())
+
+	// Second relayed frame must be held back.
+	f = <-relay.next()
+	assert.False(t, relay.admit(f))
+	assert.Nil(t, relay.next(), "no further frames while holding back")
+	<-relay.ready()
+	assert.Equal(t, f, relay.release())
+	assert.NotNil(t, relay.next())
+}
+
+func TestRelayBudgetDisabled(t *testing.T) {
+	t.Parallel()
+
+	link := &LinkBase{
+		sendQueueRegl: make(chan frame.Frame, 10),
+	}
+	relay := link.newRelayScheduler()
+	assert.Nil(t, relay.next())
+	assert.Nil(t, relay.ready())
+	relay.stop()
+}
+
+func TestRelayBudgetReload(t *testing.T) {
+	t.Parallel()
+
+	b := frame.NewFrameBuilder()
+	b.SetFrameMargins(FrameOffset, FrameOverhead)
+	f, err := b.NewFrameV1(netip.MustParseAddr("fd00::2"), netip.IPv6LinkLocalAllRouters(), frame.NetworkTraffic, nil, make([]byte, 100), nil)
+	require.NoError(t, err)
+
+	var budget *config.RelayBudget
+	rb := &relayBudget{
+		router:  netip.MustParseAddr("fd00::1"),
+		config:  func() *config.RelayBudget { return budget },
+		total:   newRelayLimiter(),
+		perPeer: newRelayLimiter(),
+	}
+
+	// Without a budget, frames are never held back.
+	for range 100 {
+		assert.Zero(t, rb.reserve(f))
+	}
+
+	// Changed limits are applied on use.
+	budget = &config.RelayBudget{Total: 1000}
+	assert.Zero(t, rb.reserve(f), "burst must allow the first frames")
+	assert.Equal(t, rate.Limit(1000), rb.total.Limit())
+	assert.Equal(t, relayBudgetMinBurst, rb.total.Burst())
+	assert.Equal(t, rate.Inf, rb.perPeer.Limit())
+	budget = &config.RelayBudget{PerPeer: 10_000_000}
+	assert.Zero(t, rb.reserve(f))
+	assert.Equal(t, rate.Inf, rb.total.Limit())
+	assert.Equal(t, rate.Limit(10_000_000), rb.perPeer.Limit())
+	assert.Equal(t, 1_000_000, rb.perPeer.Burst())
+}
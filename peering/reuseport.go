@@ -0,0 +1,64 @@
+package peering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+)
+
+// maxListenSockets is the maximum amount of listening sockets per listener.
+const maxListenSockets = 64
+
+// ErrReusePortUnsupported is returned when multiple listening sockets are
+// requested on a platform without SO_REUSEPORT support.
+var ErrReusePortUnsupported = errors.New("multiple listening sockets (SO_REUSEPORT) are not supported on this platform")
+
+// parseListenSockets parses the sockets parameter of a peering URL.
+func parseListenSockets(value string) (int, error) {
+	switch value {
+	case "":
+		return 1, nil
+	case "auto":
+		return min(runtime.NumCPU(), maxListenSockets), nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxListenSockets {
+		return 0, fmt.Errorf("invalid sockets parameter %q: must be \"auto\" or between 1 and %d", value, maxListenSockets)
+	}
+	return n, nil
+}
+
+// listenSockets opens the given amount of listening sockets on the same
+// address. Multiple sockets use SO_REUSEPORT, so that the kernel distributes
+// incoming connections between them.
+func listenSockets(ctx context.Context, lc net.ListenConfig, network, address string, count int) ([]net.Listener, error) {
+	if count > 1 {
+		control, err := reusePort()
+		if err != nil {
+			return nil, err
+		}
+		lc.Control = chainSocketControl(lc.Control, control)
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for range count {
+		ln, err := lc.Listen(ctx, network, address)
+		if err != nil {
+			for _, ln := range listeners {
+				_ = ln.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+
+		// Use the actual address for additional sockets, in case the port was
+		// chosen automatically.
+		address = ln.Addr().String()
+	}
+
+	return listeners, nil
+}
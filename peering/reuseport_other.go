@@ -0,0 +1,8 @@
+//go:build !linux
+
+package peering
+
+// reusePort is not supported on this platform.
+func reusePort() (socketControl, error) {
+	return nil, ErrReusePortUnsupported
+}
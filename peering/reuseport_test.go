@@ -0,0 +1,39 @@
+package peering
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenSockets(t *testing.T) {
+	t.Parallel()
+
+	// Check parameter parsing.
+	n, err := parseListenSockets("")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = parseListenSockets("auto")
+	require.NoError(t, err)
+	assert.Positive(t, n)
+	_, err = parseListenSockets("0")
+	assert.Error(t, err)
+	_, err = parseListenSockets("65")
+	assert.Error(t, err)
+
+	// Open multiple sockets on the same address.
+	listeners, err := listenSockets(context.Background(), net.ListenConfig{}, "tcp", "127.0.0.1:0", 4)
+	if errors.Is(err, ErrReusePortUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	require.Len(t, listeners, 4)
+	for _, ln := range listeners {
+		assert.Equal(t, listeners[0].Addr().String(), ln.Addr().String())
+		_ = ln.Close()
+	}
+}
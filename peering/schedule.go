@@ -0,0 +1,201 @@
+package peering
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// scheduleCheckInterval defines how often peering schedules are checked.
+	scheduleCheckInterval = 10 * time.Second
+	// scheduleDrainTimeout defines how long links outside of their schedule
+	// may drain before they are closed.
+	scheduleDrainTimeout = 1 * time.Minute
+	// scheduleDrainIdle defines below how many bytes per check interval a
+	// draining link is considered idle and is closed early.
+	scheduleDrainIdle = 4096
+)
+
+// inSchedule returns whether the peering URL may be used at the given time.
+func inSchedule(u *m.PeeringURL, now time.Time) bool {
+	schedule, err := u.Schedule()
+	if err != nil || schedule == nil {
+		// Schedules are checked when parsing the config.
+		return true
+	}
+	return schedule.Active(now)
+}
+
+// drainState tracks a link that is drained, as it is outside of its schedule.
+type drainState struct {
+	started time.Time
+	bytes   uint64
+}
+
+// done returns whether the link has finished draining and updates the state.
+func (d *drainState) done(now time.Time, bytes uint64) bool {
+	idle := bytes-d.bytes < scheduleDrainIdle
+	d.bytes = bytes
+	return idle || now.Sub(d.started) >= scheduleDrainTimeout
+}
+
+// scheduleMgr applies the schedules of peering URLs. When a schedule window
+// ends, listeners are closed and the links are drained: traffic is diverted
+// from them and they are closed when idle or after a timeout at the latest.
+func (p *Peering) scheduleMgr(w *mgr.WorkerCtx) error {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	active := make(map[string]bool)
+	draining := make(map[Link]*drainState)
+	for {
+		p.checkSchedules(w, active, draining)
+
+		select {
+		case <-ticker.C:
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+func (p *Peering) checkSchedules(w *mgr.WorkerCtx, active map[string]bool, draining map[Link]*drainState) {
+	now := time.Now()
+	cfg := p.instance.Config().Router
+
+	// Check schedule windows of configured peering URLs.
+	var opened bool
+	for _, peeringURL := range slices.Concat(cfg.Connect, cfg.Listen) {
+		u, err := m.ParsePeeringURL(peeringURL)
+		if err != nil || u.Param(m.PeeringURLParamSchedule) == "" {
+			continue
+		}
+
+		isActive := inSchedule(u, now)
+		wasActive, known := active[peeringURL]
+		active[peeringURL] = isActive
+		switch {
+		case known && isActive == wasActive:
+			continue
+		case isActive:
+			w.Info("peering schedule window started", "peeringURL", peeringURL)
+			opened = true
+		default:
+			w.Info("peering schedule window ended", "peeringURL", peeringURL)
+		}
+	}
+	if opened {
+		p.TriggerPeering()
+		p.triggerListen()
+	}
+
+	// Close listeners outside of their schedule.
+	for id, ln := range p.copyListenersWithLocking() {
+		if inSchedule(ln.PeeringURL(), now) {
+			continue
+		}
+		ln.Close(func() {
+			w.Info(
+				"closing listener outside of peering schedule",
+				"bind", ln.ID(),
+			)
+		})
+		p.RemoveListener(id)
+	}
+
+	// Drain links outside of their schedule.
+	seen := make(map[Link]struct{}, len(draining))
+	drainingPeers := make(map[Link]struct{})
+	for _, peerLink := range p.GetLinks() {
+		links := LinkMembers(peerLink)
+		var drainingMembers int
+		for _, link := range links {
+			if link.PeeringURL() == nil || inSchedule(link.PeeringURL(), now) || link.IsClosing() {
+				continue
+			}
+			seen[link] = struct{}{}
+			drainingMembers++
+			bytes := link.BytesIn() + link.BytesOut()
+
+			// Start draining.
+			state, ok := draining[link]
+			if !ok {
+				draining[link] = &drainState{started: now, bytes: bytes}
+				w.Info(
+					"draining link outside of peering schedule",
+					"router", link.Peer(),
+					"peeringURL", link.PeeringURL(),
+				)
+				continue
+			}
+
+			// Close when done.
+			if state.done(now, bytes) {
+				link.Close("outside of peering schedule", func() {
+					w.Info(
+						"closing link outside of peering schedule",
+						"router", link.Peer(),
+						"peeringURL", link.PeeringURL(),
+						"drained", now.Sub(state.started).Round(time.Second),
+					)
+				})
+			}
+		}
+
+		// Divert traffic from the peer when all its links are draining.
+		if drainingMembers == len(links) {
+			drainingPeers[peerLink] = struct{}{}
+		}
+	}
+	for _, link := range p.setDrainingLinks(drainingPeers) {
+		w.Info(
+			"diverting traffic from peer outside of peering schedule",
+			"router", link.Peer(),
+		)
+		p.PeeringEvents.Submit(&EventPeering{
+			Peer:  link.Peer(),
+			State: EventStateDraining,
+		})
+	}
+
+	// Forget links that are closed or back in their schedule.
+	for link := range draining {
+		if _, ok := seen[link]; !ok {
+			delete(draining, link)
+		}
+	}
+}
+
+// setDrainingLinks sets the draining links and returns the links that started
+// draining.
+func (p *Peering) setDrainingLinks(links map[Link]struct{}) (started []Link) {
+	p.linksLock.Lock()
+	defer p.linksLock.Unlock()
+
+	for link := range links {
+		if _, ok := p.drainingLinks[link]; !ok {
+			started = append(started, link)
+		}
+	}
+	p.drainingLinks = links
+	return started
+}
+
+// IsDraining returns whether the link to the given peer is draining, as it is
+// outside of its peering schedule. Traffic must not be routed via draining
+// links anymore.
+func (p *Peering) IsDraining(peer netip.Addr) bool {
+	p.linksLock.RLock()
+	defer p.linksLock.RUnlock()
+
+	link, ok := p.links[peer]
+	if !ok {
+		return false
+	}
+	_, draining := p.drainingLinks[link]
+	return draining
+}
@@ -0,0 +1,79 @@
+package peering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestInSchedule(t *testing.T) {
+	t.Parallel()
+
+	night := time.Date(2024, 6, 3, 23, 0, 0, 0, time.UTC)
+	day := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	scheduled, err := m.ParsePeeringURL("tcp://192.0.2.1:47369?schedule=daily+22:00-06:00")
+	require.NoError(t, err)
+	assert.True(t, inSchedule(scheduled, night))
+	assert.False(t, inSchedule(scheduled, day))
+
+	plain, err := m.ParsePeeringURL("tcp://192.0.2.1:47369")
+	require.NoError(t, err)
+	assert.True(t, inSchedule(plain, night))
+	assert.True(t, inSchedule(plain, day))
+}
+
+func TestDrainState(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 6, 3, 6, 0, 0, 0, time.UTC)
+
+	// Busy link is drained until timeout.
+	state := &drainState{started: start, bytes: 1000}
+	assert.False(t, state.done(start.Add(scheduleCheckInterval), 1_000_000))
+	assert.False(t, state.done(start.Add(2*scheduleCheckInterval), 2_000_000))
+	assert.True(t, state.done(start.Add(scheduleDrainTimeout), 3_000_000))
+
+	// Idle link is closed early.
+	state = &drainState{started: start, bytes: 1000}
+	assert.False(t, state.done(start.Add(scheduleCheckInterval), 1_000_000))
+	assert.True(t, state.done(start.Add(2*scheduleCheckInterval), 1_000_100))
+}
+
+func TestDrainingLinks(t *testing.T) {
+	t.Parallel()
+
+	p := New(getTestInstance(t, config.MakeTestConfig(config.Store{})), nil, nil)
+	p.mgr = mgr.New("peering")
+	linkA := addTestLink(t, p)
+	linkB := addTestLink(t, p)
+
+	// Only newly draining links are reported.
+	started := p.setDrainingLinks(map[Link]struct{}{linkA: {}})
+	assert.Equal(t, []Link{linkA}, started)
+	assert.True(t, p.IsDraining(linkA.Peer()))
+	assert.False(t, p.IsDraining(linkB.Peer()))
+	started = p.setDrainingLinks(map[Link]struct{}{linkA: {}, linkB: {}})
+	assert.Equal(t, []Link{linkB}, started)
+
+	// Links back in their schedule stop draining.
+	assert.Empty(t, p.setDrainingLinks(map[Link]struct{}{linkB: {}}))
+	assert.False(t, p.IsDraining(linkA.Peer()))
+	assert.True(t, p.IsDraining(linkB.Peer()))
+
+	// A new link to the same peer does not inherit the draining state.
+	p.RemoveLink(linkB)
+	linkC := &LinkBase{
+		peer:    linkB.Peer(),
+		peering: p,
+	}
+	require.NoError(t, linkC.assignSwitchLabel())
+	require.NoError(t, p.AddLink(linkC))
+	assert.False(t, p.IsDraining(linkC.Peer()))
+}
@@ -0,0 +1,222 @@
+package peering
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// Switch labels are local to this router and are learned by other routers
+// through announcements, which store them in their switch paths. When a
+// link is relabeled, the old label is kept as an alias for a grace period,
+// so that switch blocks still in use by other routers continue to work until
+// their routes are refreshed with the new label.
+
+const (
+	// relabelGracePeriod defines how long an old switch label continues to
+	// forward to its link after relabeling. This must be longer than the
+	// validity of announcements, so that all routes using the old label have
+	// been refreshed or expired.
+	relabelGracePeriod = 15 * time.Minute
+
+	// compactLabelsInterval defines how often links with long switch labels
+	// are checked if they can be relabeled with a shorter label.
+	compactLabelsInterval = 10 * time.Minute
+)
+
+// Switch label errors.
+var (
+	ErrSwitchLabelInUse     = errors.New("switch label already in use")
+	ErrSwitchLabelExhausted = errors.New("no suitable switch label found")
+)
+
+// retiredLabel is an old switch label still forwarding to its link.
+type retiredLabel struct {
+	link    Link
+	expires time.Time
+}
+
+// findFreeSwitchLabel returns a free switch label for a link to the given
+// peer. Short labels are preferred for routable addresses.
+func (p *Peering) findFreeSwitchLabel(peer netip.Addr) (m.SwitchLabel, error) {
+	p.linksLock.Lock()
+	defer p.linksLock.Unlock()
+
+	// Try a few times, then reclaim retired labels and try again.
+	for range 2 {
+		if label, ok := p.findFreeSwitchLabelLocked(peer); ok {
+			return label, nil
+		}
+		if len(p.retiredLabels) == 0 {
+			break
+		}
+		p.mgr.Warn(
+			"switch labels exhausted, reclaiming retired labels",
+			"retired", len(p.retiredLabels),
+		)
+		p.clearRetiredLabelsLocked(time.Time{})
+	}
+
+	return 0, ErrSwitchLabelExhausted
+}
+
+// findFreeSwitchLabelLocked searches for a free switch label.
+// The links lock must be held.
+func (p *Peering) findFreeSwitchLabelLocked(peer netip.Addr) (m.SwitchLabel, bool) {
+	free := func(label m.SwitchLabel) bool {
+		_, taken := p.linksByLabel[label]
+		return label != 0 && !taken
+	}
+
+	// Derive label from address.
+	label, ok := m.DeriveSwitchLabelFromIP(peer)
+	if ok && free(label) {
+		return label, true
+	}
+
+	// Try 100 times to generate a random short label for routable addresses.
+	routable := m.RoutingAddressPrefix.Contains(peer)
+	if routable {
+		for range 100 {
+			label, ok := m.GetRandomSwitchLabel(true)
+			if ok && free(label) {
+				return label, true
+			}
+		}
+	}
+
+	// Then try 1000 time for a longer one.
+	for range 1000 {
+		label, ok := m.GetRandomSwitchLabel(false)
+		if ok && free(label) {
+			return label, true
+		}
+	}
+
+	// Finally, search all labels, as random tries may fail with many links.
+	if routable {
+		for label := m.SwitchLabel(1); label <= m.MaxRoutableSwitchLabel; label++ {
+			if free(label) {
+				return label, true
+			}
+		}
+	}
+	for label := m.SwitchLabel(m.MaxRoutableSwitchLabel + 1); label <= m.MaxPrivateSwitchLabel; label++ {
+		if free(label) {
+			return label, true
+		}
+	}
+
+	return 0, false
+}
+
+// relabelLocked sets the new label on the link and retires the old one.
+// The links lock must be held.
+func (p *Peering) relabelLocked(link Link, label m.SwitchLabel) {
+	oldLabel := link.SwitchLabel()
+
+	// Retire old label and set new label.
+	p.retiredLabels[oldLabel] = retiredLabel{
+		link:    link,
+		expires: time.Now().Add(relabelGracePeriod),
+	}
+	delete(p.retiredLabels, label)
+	link.SetSwitchLabel(label)
+	p.linksByLabel[label] = link
+
+	p.mgr.Info(
+		"relabeled link",
+		"router", link.Peer(),
+		"old", oldLabel,
+		"new", label,
+	)
+	p.PeeringEvents.Submit(&EventPeering{
+		Peer:  link.Peer(),
+		State: EventStateRelabeled,
+	})
+}
+
+// clearRetiredLabelsLocked removes retired labels that expired before the
+// given time. If the given time is zero, all retired labels are removed.
+// The links lock must be held.
+func (p *Peering) clearRetiredLabelsLocked(before time.Time) {
+	for label, retired := range p.retiredLabels {
+		if before.IsZero() || retired.expires.Before(before) {
+			delete(p.retiredLabels, label)
+			if p.linksByLabel[label] == retired.link {
+				delete(p.linksByLabel, label)
+			}
+		}
+	}
+}
+
+// removeRetiredLabelsLocked removes all retired labels of the given link.
+// The links lock must be held.
+func (p *Peering) removeRetiredLabelsLocked(link Link) {
+	for label, retired := range p.retiredLabels {
+		if retired.link == link || retired.link.Peer() == link.Peer() {
+			delete(p.retiredLabels, label)
+			if p.linksByLabel[label] == retired.link {
+				delete(p.linksByLabel, label)
+			}
+		}
+	}
+}
+
+// removeRetiredLabelsOfLinkLocked removes the retired labels that point to
+// the given link, but keeps the retired labels of other links to the peer.
+// The links lock must be held.
+func (p *Peering) removeRetiredLabelsOfLinkLocked(link Link) {
+	for label, retired := range p.retiredLabels {
+		if retired.link == link {
+			delete(p.retiredLabels, label)
+			if p.linksByLabel[label] == retired.link {
+				delete(p.linksByLabel, label)
+			}
+		}
+	}
+}
+
+// compactLabels relabels links to routable addresses that have a long
+// switch label with a short one, if available.
+func (p *Peering) compactLabels() {
+	p.linksLock.Lock()
+	defer p.linksLock.Unlock()
+
+	for _, link := range p.links {
+		if link.SwitchLabel() <= m.MaxRoutableSwitchLabel ||
+			!m.RoutingAddressPrefix.Contains(link.Peer()) {
+			continue
+		}
+
+		// Search for a free short label.
+		for label := m.SwitchLabel(1); label <= m.MaxRoutableSwitchLabel; label++ {
+			if _, taken := p.linksByLabel[label]; !taken {
+				p.relabelLocked(link, label)
+				break
+			}
+		}
+	}
+}
+
+func (p *Peering) switchLabelWorker(w *mgr.WorkerCtx) error {
+	ticker := time.NewTicker(compactLabelsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.linksLock.Lock()
+			p.clearRetiredLabelsLocked(time.Now())
+			p.linksLock.Unlock()
+
+			p.compactLabels()
+
+		case <-w.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package peering
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestCompactLabels(t *testing.T) {
+	t.Parallel()
+
+	p := New(getTestInstance(t, config.MakeTestConfig(config.Store{})), nil, nil)
+	p.mgr = mgr.New("peering")
+
+	// Add a link to a routable address with a long label and another link.
+	id, _, err := m.GenerateRoutableAddress(context.Background(), []netip.Prefix{
+		m.MustPrefix([]byte{m.BaseNet, m.TypeRoutingAddress | m.ContinentEurope}, 12),
+	})
+	require.NoError(t, err)
+	linkA := &LinkBase{
+		peer:    id.IP,
+		peering: p,
+	}
+	oldLabel := m.SwitchLabel(m.MaxRoutableSwitchLabel + 1)
+	linkA.SetSwitchLabel(oldLabel)
+	require.NoError(t, p.AddLink(linkA))
+	linkB := addTestLink(t, p)
+
+	// Compacting relabels the link with a short label.
+	events := p.PeeringEvents.Subscribe("test", 10)
+	defer events.Cancel()
+	p.compactLabels()
+	newLabel := linkA.SwitchLabel()
+	assert.LessOrEqual(t, newLabel, m.SwitchLabel(m.MaxRoutableSwitchLabel))
+	assert.NotEqual(t, linkB.SwitchLabel(), newLabel, "labels must differ")
+	select {
+	case event := <-events.Events():
+		assert.Equal(t, EventState(EventStateRelabeled), event.State)
+		assert.Equal(t, linkA.Peer(), event.Peer)
+	default:
+		t.Error("relabeling must be announced")
+	}
+
+	// Old label must still forward during the grace period.
+	assert.Equal(t, Link(linkA), p.GetLinkByLabel(oldLabel))
+	assert.Equal(t, Link(linkA), p.GetLinkByLabel(newLabel))
+
+	// Old label must be removed after the grace period.
+	p.linksLock.Lock()
+	p.clearRetiredLabelsLocked(time.Now().Add(relabelGracePeriod + time.Second))
+	p.linksLock.Unlock()
+	assert.Nil(t, p.GetLinkByLabel(oldLabel))
+	assert.Equal(t, Link(linkA), p.GetLinkByLabel(newLabel))
+
+	// Retired labels must be removed with the link.
+	p.linksLock.Lock()
+	p.relabelLocked(linkA, oldLabel)
+	p.linksLock.Unlock()
+	p.RemoveLink(linkA)
+	assert.Empty(t, p.retiredLabels)
+	assert.Len(t, p.linksByLabel, 1)
+}
+
+func addTestLink(t *testing.T, p *Peering) *LinkBase {
+	t.Helper()
+
+	id, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	link := &LinkBase{
+		peer:    id.IP,
+		peering: p,
+	}
+	require.NoError(t, link.assignSwitchLabel())
+	require.NoError(t, p.AddLink(link))
+	return link
+}
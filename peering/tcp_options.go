@@ -0,0 +1,179 @@
+package peering
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// ErrTCPOptionUnsupported is returned when a TCP option is not supported on
+// the current platform.
+var ErrTCPOptionUnsupported = errors.New("tcp option is not supported on this platform")
+
+// maxSocketBuffer is the maximum socket buffer size that may be configured.
+const maxSocketBuffer = 64 * 1024 * 1024
+
+// tcpOptions holds TCP tuning options from the query parameters of a peering URL.
+// Unset options keep the system or Go defaults.
+type tcpOptions struct {
+	noDelay     *bool
+	keepAlive   *time.Duration
+	userTimeout time.Duration
+	readBuffer  int
+	writeBuffer int
+	congestion  string
+}
+
+// parseTCPOptions parses the TCP tuning options of the given peering URL.
+// It returns nil if no options are set.
+func parseTCPOptions(peeringURL *m.PeeringURL) (*tcpOptions, error) {
+	var (
+		opts tcpOptions
+		set  bool
+	)
+
+	if value := peeringURL.Param(m.PeeringURLParamNoDelay); value != "" {
+		noDelay, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", m.PeeringURLParamNoDelay, err)
+		}
+		opts.noDelay = &noDelay
+		set = true
+	}
+	if value := peeringURL.Param(m.PeeringURLParamKeepAlive); value != "" {
+		keepAlive, err := parseOptionDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", m.PeeringURLParamKeepAlive, err)
+		}
+		opts.keepAlive = &keepAlive
+		set = true
+	}
+	if value := peeringURL.Param(m.PeeringURLParamUserTimeout); value != "" {
+		userTimeout, err := parseOptionDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", m.PeeringURLParamUserTimeout, err)
+		}
+		opts.userTimeout = userTimeout
+		set = true
+	}
+	if value := peeringURL.Param(m.PeeringURLParamReadBuffer); value != "" {
+		size, err := parseOptionBuffer(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", m.PeeringURLParamReadBuffer, err)
+		}
+		opts.readBuffer = size
+		set = true
+	}
+	if value := peeringURL.Param(m.PeeringURLParamWriteBuffer); value != "" {
+		size, err := parseOptionBuffer(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", m.PeeringURLParamWriteBuffer, err)
+		}
+		opts.writeBuffer = size
+		set = true
+	}
+	if value := peeringURL.Param(m.PeeringURLParamCongestion); value != "" {
+		opts.congestion = value
+		set = true
+	}
+
+	if !set {
+		return nil, nil //nolint:nilnil // No options is not an error.
+	}
+	return &opts, nil
+}
+
+func parseOptionDuration(value string) (time.Duration, error) {
+	if value == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second {
+		return 0, errors.New("must be at least 1s")
+	}
+	return d, nil
+}
+
+func parseOptionBuffer(value string) (int, error) {
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if size <= 0 || size > maxSocketBuffer {
+		return 0, fmt.Errorf("must be between 1 and %d bytes", maxSocketBuffer)
+	}
+	return size, nil
+}
+
+// apply applies the options to the given connection.
+// All options are attempted, even if one fails.
+func (opts *tcpOptions) apply(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return fmt.Errorf("not a tcp connection: %T", conn)
+	}
+
+	var errs []error
+	if opts.noDelay != nil {
+		errs = append(errs, tcpConn.SetNoDelay(*opts.noDelay))
+	}
+	if opts.keepAlive != nil {
+		if *opts.keepAlive > 0 {
+			errs = append(errs,
+				tcpConn.SetKeepAlive(true),
+				tcpConn.SetKeepAlivePeriod(*opts.keepAlive),
+			)
+		} else {
+			errs = append(errs, tcpConn.SetKeepAlive(false))
+		}
+	}
+	if opts.readBuffer > 0 {
+		errs = append(errs, tcpConn.SetReadBuffer(opts.readBuffer))
+	}
+	if opts.writeBuffer > 0 {
+		errs = append(errs, tcpConn.SetWriteBuffer(opts.writeBuffer))
+	}
+	if opts.userTimeout > 0 {
+		errs = append(errs, setTCPUserTimeout(tcpConn, opts.userTimeout))
+	}
+	if opts.congestion != "" {
+		errs = append(errs, setTCPCongestion(tcpConn, opts.congestion))
+	}
+
+	return errors.Join(errs...)
+}
+
+// tuningListener applies TCP options to all accepted connections.
+type tuningListener struct {
+	net.Listener
+
+	opts    *tcpOptions
+	peering *Peering
+	warned  atomic.Bool
+}
+
+// Accept waits for and returns the next connection to the listener.
+func (ln *tuningListener) Accept() (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err != nil {
+		return conn, err
+	}
+
+	// Options are best effort, only warn once per listener.
+	if err := ln.opts.apply(conn); err != nil && ln.warned.CompareAndSwap(false, true) {
+		ln.peering.mgr.Warn(
+			"failed to apply tcp options to accepted connection",
+			"bind", ln.Addr(),
+			"err", err,
+		)
+	}
+	return conn, nil
+}
@@ -0,0 +1,35 @@
+package peering
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func setTCPUserTimeout(conn *net.TCPConn, timeout time.Duration) error {
+	return setTCPSockopt(conn, func(fd int) error {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, int(timeout.Milliseconds()))
+	})
+}
+
+func setTCPCongestion(conn *net.TCPConn, algorithm string) error {
+	return setTCPSockopt(conn, func(fd int) error {
+		return unix.SetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION, algorithm)
+	})
+}
+
+func setTCPSockopt(conn *net.TCPConn, fn func(fd int) error) error {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockErr = fn(int(fd))
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package peering
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+func setTCPUserTimeout(conn *net.TCPConn, timeout time.Duration) error {
+	return fmt.Errorf("user timeout: %w", ErrTCPOptionUnsupported)
+}
+
+func setTCPCongestion(conn *net.TCPConn, algorithm string) error {
+	return fmt.Errorf("congestion control: %w", ErrTCPOptionUnsupported)
+}
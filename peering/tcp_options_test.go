@@ -0,0 +1,57 @@
+package peering
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestTCPOptions(t *testing.T) {
+	t.Parallel()
+
+	// No options.
+	opts, err := parseTCPOptions(&m.PeeringURL{Protocol: "tcp", Port: 47369})
+	require.NoError(t, err)
+	assert.Nil(t, opts)
+
+	// Invalid options.
+	for _, query := range []string{
+		"nodelay=maybe",
+		"keepalive=10ms",
+		"usertimeout=soon",
+		"rcvbuf=0",
+		"sndbuf=1000000000",
+	} {
+		_, err := parseTCPOptions(&m.PeeringURL{Protocol: "tcp", Port: 47369, Path: "/?" + query})
+		assert.Error(t, err, query)
+	}
+
+	// Parse options.
+	query := "/?nodelay=false&keepalive=30s&rcvbuf=1048576&sndbuf=1048576"
+	if runtime.GOOS == "linux" {
+		query += "&usertimeout=2m&congestion=reno"
+	}
+	opts, err = parseTCPOptions(&m.PeeringURL{Protocol: "tcp", Port: 47369, Path: query})
+	require.NoError(t, err)
+	require.NotNil(t, opts.noDelay)
+	assert.False(t, *opts.noDelay)
+	require.NotNil(t, opts.keepAlive)
+	assert.Equal(t, 30*time.Second, *opts.keepAlive)
+	assert.Equal(t, 1048576, opts.readBuffer)
+
+	// Apply options to a connection.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close() //nolint:errcheck
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	assert.NoError(t, opts.apply(conn))
+}
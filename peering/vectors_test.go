@@ -0,0 +1,97 @@
+package peering
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandshakeVectors checks that the peering messages encode exactly like
+// the published golden vectors. The vectors package cannot be imported here,
+// as it depends on the router.
+func TestHandshakeVectors(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("../vectors/golden.json")
+	require.NoError(t, err)
+	var golden struct {
+		Routers []struct {
+			Name    string `json:"name"`
+			Address struct {
+				IP string `json:"ip"`
+			} `json:"address"`
+		} `json:"routers"`
+		Handshakes []struct {
+			Name           string `json:"name"`
+			Client         string `json:"client"`
+			Server         string `json:"server"`
+			Universe       string `json:"universe"`
+			UniverseSecret string `json:"universeSecret"`
+			Steps          []struct {
+				Name    string `json:"name"`
+				Message string `json:"message"`
+			} `json:"steps"`
+		} `json:"handshakes"`
+	}
+	require.NoError(t, json.Unmarshal(data, &golden))
+	routerIP := func(name string) netip.Addr {
+		for _, r := range golden.Routers {
+			if r.Name == name {
+				return netip.MustParseAddr(r.Address.IP)
+			}
+		}
+		t.Fatalf("router %s not found", name)
+		return netip.Addr{}
+	}
+	require.NotEmpty(t, golden.Handshakes)
+
+	for _, hs := range golden.Handshakes {
+		require.Len(t, hs.Steps, 6, hs.Name)
+
+		messages := make([][]byte, len(hs.Steps))
+		for i, step := range hs.Steps {
+			messages[i], err = hex.DecodeString(step.Message)
+			require.NoError(t, err, hs.Name)
+		}
+		reencode := func(i int, v any) {
+			t.Helper()
+
+			require.NoError(t, cbor.Unmarshal(messages[i], v), hs.Name)
+			encoded, err := cbor.Marshal(v)
+			require.NoError(t, err, hs.Name)
+			assert.Equal(t, messages[i], encoded, "%s: %s should encode the same", hs.Name, hs.Steps[i].Name)
+		}
+
+		// Requests.
+		clientReq := &HandshakeRequest{}
+		reencode(0, clientReq)
+		reencode(1, &HandshakeRequest{})
+		assert.Equal(t, routerIP(hs.Client), clientReq.Address.IP, hs.Name)
+		assert.NoError(t, clientReq.Address.VerifyAddress(), hs.Name)
+		assert.NoError(t, clientReq.FEC.check(), hs.Name)
+
+		// Responses.
+		reencode(2, &HandshakeResponse{})
+		serverResp := &HandshakeResponse{}
+		reencode(3, serverResp)
+		if hs.UniverseSecret != "" {
+			assert.Equal(t,
+				MakeUniverseAuth(hs.Universe, hs.UniverseSecret, clientReq.Challenge, routerIP(hs.Client), routerIP(hs.Server)),
+				serverResp.UniverseAuth,
+				hs.Name,
+			)
+		}
+
+		// Acks.
+		reencode(4, &HandshakeAck{})
+		serverAck := &HandshakeAck{}
+		reencode(5, serverAck)
+		assert.NotEmpty(t, serverAck.KeyExchange, hs.Name)
+	}
+}
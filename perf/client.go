@@ -0,0 +1,292 @@
+package perf
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	probeInterval = 100 * time.Millisecond
+	probeTimeout  = 1 * time.Second
+	idleProbes    = 10
+)
+
+// Result is the result of a throughput test.
+type Result struct {
+	// Idle is the latency before the test.
+	Idle Latency
+	// Up is the direction from the client to the responder.
+	Up Direction
+	// Down is the direction from the responder to the client.
+	Down Direction
+}
+
+// Direction is the result of a test in one direction.
+type Direction struct {
+	Bytes    uint64
+	Duration time.Duration
+	// Latency is the latency under load.
+	Latency Latency
+}
+
+// BitsPerSecond returns the measured throughput.
+func (d Direction) BitsPerSecond() float64 {
+	if d.Duration <= 0 {
+		return 0
+	}
+	return float64(d.Bytes*8) / d.Duration.Seconds()
+}
+
+// Latency holds latency and loss measured by probes.
+type Latency struct {
+	Min time.Duration
+	Avg time.Duration
+	Max time.Duration
+
+	Sent     int
+	Received int
+}
+
+// Loss returns the share of lost probes.
+func (l Latency) Loss() float64 {
+	if l.Sent == 0 {
+		return 0
+	}
+	return float64(l.Sent-l.Received) / float64(l.Sent)
+}
+
+// Run runs a throughput test against the responder at dst and tests each
+// direction for the given duration.
+func Run(ctx context.Context, dst netip.AddrPort, duration time.Duration) (*Result, error) {
+	duration = min(max(duration, MinDuration), MaxDuration)
+
+	// Start prober.
+	p, err := newProber(dst)
+	if err != nil {
+		return nil, err
+	}
+	defer p.close()
+
+	result := &Result{}
+
+	// Measure idle latency.
+	p.start()
+	select {
+	case <-time.After(idleProbes * probeInterval):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	result.Idle = p.stop()
+
+	// Test upload.
+	p.start()
+	result.Up, err = runDirection(ctx, dst, DirectionUp, duration)
+	result.Up.Latency = p.stop()
+	if err != nil {
+		return nil, fmt.Errorf("upload: %w", err)
+	}
+
+	// Test download.
+	p.start()
+	result.Down, err = runDirection(ctx, dst, DirectionDown, duration)
+	result.Down.Latency = p.stop()
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+
+	return result, nil
+}
+
+func runDirection(ctx context.Context, dst netip.AddrPort, direction string, duration time.Duration) (Direction, error) {
+	// Connect to responder.
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", dst.String())
+	if err != nil {
+		return Direction{}, err
+	}
+	defer conn.Close() //nolint:errcheck
+	stopCancel := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stopCancel()
+
+	// Send request.
+	data, err := json.Marshal(request{
+		Direction: direction,
+		Duration:  duration,
+	})
+	if err != nil {
+		return Direction{}, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return Direction{}, fmt.Errorf("send request: %w", err)
+	}
+
+	switch direction {
+	case DirectionUp:
+		// Send data, then read the result from the responder.
+		_ = conn.SetDeadline(time.Now().Add(duration + ioGrace))
+		if err := send(conn, duration); err != nil {
+			return Direction{}, err
+		}
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			_ = tcpConn.CloseWrite()
+		}
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+		if err != nil {
+			return Direction{}, fmt.Errorf("read result: %w", err)
+		}
+		var result upResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			return Direction{}, fmt.Errorf("parse result: %w", err)
+		}
+		if result.Err != "" {
+			return Direction{}, errors.New(result.Err)
+		}
+		return Direction{
+			Bytes:    result.Bytes,
+			Duration: result.Duration,
+		}, nil
+
+	default:
+		// Receive data until the responder closes the connection.
+		_ = conn.SetDeadline(time.Now().Add(duration + ioGrace))
+		bytes, took, err := receive(conn)
+		if err != nil {
+			return Direction{}, err
+		}
+		return Direction{
+			Bytes:    bytes,
+			Duration: took,
+		}, nil
+	}
+}
+
+// prober measures latency and loss with UDP probes.
+type prober struct {
+	conn *net.UDPConn
+
+	lock   sync.Mutex
+	seq    uint32
+	sent   map[uint32]time.Time
+	rtts   []time.Duration
+	stopC  chan struct{}
+	doneWG sync.WaitGroup
+}
+
+func newProber(dst netip.AddrPort) (*prober, error) {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(dst))
+	if err != nil {
+		return nil, fmt.Errorf("connect probes: %w", err)
+	}
+	p := &prober{
+		conn: conn,
+		sent: make(map[uint32]time.Time),
+	}
+	go p.receiver()
+	return p, nil
+}
+
+// start starts sending probes.
+func (p *prober) start() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	clear(p.sent)
+	p.rtts = p.rtts[:0]
+	p.stopC = make(chan struct{})
+
+	p.doneWG.Add(1)
+	go p.sender(p.stopC)
+}
+
+// stop stops sending probes and returns the results after waiting for
+// outstanding probes.
+func (p *prober) stop() Latency {
+	close(p.stopC)
+	p.doneWG.Wait()
+	time.Sleep(probeTimeout)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	l := Latency{
+		Sent:     len(p.sent),
+		Received: len(p.rtts),
+	}
+	if len(p.rtts) == 0 {
+		return l
+	}
+	var total time.Duration
+	l.Min = p.rtts[0]
+	for _, rtt := range p.rtts {
+		l.Min = min(l.Min, rtt)
+		l.Max = max(l.Max, rtt)
+		total += rtt
+	}
+	l.Avg = total / time.Duration(len(p.rtts))
+	return l
+}
+
+func (p *prober) close() {
+	_ = p.conn.Close()
+}
+
+func (p *prober) sender(stop chan struct{}) {
+	defer p.doneWG.Done()
+
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+
+	probe := make([]byte, len(probeMagic)+4)
+	copy(probe, probeMagic)
+	for {
+		p.lock.Lock()
+		p.seq++
+		binary.BigEndian.PutUint32(probe[len(probeMagic):], p.seq)
+		p.sent[p.seq] = time.Now()
+		p.lock.Unlock()
+		_, _ = p.conn.Write(probe)
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (p *prober) receiver() {
+	buf := make([]byte, maxProbeSize+1)
+	for {
+		n, err := p.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if !isProbe(buf[:n]) {
+			continue
+		}
+		seq := binary.BigEndian.Uint32(buf[len(probeMagic):])
+
+		p.lock.Lock()
+		// Answered probes are kept with a zero time to count them as sent.
+		if sent := p.sent[seq]; !sent.IsZero() {
+			if rtt := time.Since(sent); rtt <= probeTimeout {
+				p.rtts = append(p.rtts, rtt)
+			}
+			p.sent[seq] = time.Time{}
+		}
+		p.lock.Unlock()
+	}
+}
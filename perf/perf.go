@@ -0,0 +1,257 @@
+package perf
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// Throughput tests run over TCP and measure one direction at a time. During
+// the tests, small UDP probes are echoed by the responder on the same port in
+// order to measure latency and loss under load.
+
+const (
+	// MinDuration is the minimum duration of a test direction.
+	MinDuration = 100 * time.Millisecond
+	// MaxDuration is the maximum duration of a test direction.
+	MaxDuration = 30 * time.Second
+
+	bufSize      = 32 * 1024
+	maxProbeSize = 64
+	ioGrace      = 10 * time.Second
+)
+
+// Test directions.
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
+
+// probeMagic prefixes all UDP probes.
+var probeMagic = []byte("mycoperf")
+
+// request is sent by the client to start a test.
+type request struct {
+	Direction string        `json:"direction"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// upResult is sent by the responder after receiving an upload.
+type upResult struct {
+	Bytes    uint64        `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	Err      string        `json:"err,omitempty"`
+}
+
+// Responder answers throughput tests of other routers.
+// Access is controlled by the service policy of the perf service.
+type Responder struct {
+	instance instance
+	mgr      *mgr.Manager
+
+	tcpListener net.Listener
+	udpConn     net.PacketConn
+}
+
+// instance is an interface subset of inst.Ance.
+type instance interface {
+	Config() *config.Config
+	Identity() *m.Address
+}
+
+// New returns a new throughput test responder.
+func New(instance instance) *Responder {
+	return &Responder{
+		instance: instance,
+	}
+}
+
+// Start starts the responder.
+func (r *Responder) Start(mgr *mgr.Manager) error {
+	r.mgr = mgr
+
+	port := r.instance.Config().PerfPort
+	if err := r.listen(netip.AddrPortFrom(r.instance.Identity().IP, port)); err != nil {
+		return err
+	}
+	r.startWorkers()
+
+	mgr.Info(
+		"throughput test responder enabled",
+		"port", port,
+	)
+	return nil
+}
+
+// Stop stops the responder.
+func (r *Responder) Stop(mgr *mgr.Manager) error {
+	if r.tcpListener != nil {
+		_ = r.tcpListener.Close()
+	}
+	if r.udpConn != nil {
+		_ = r.udpConn.Close()
+	}
+	return nil
+}
+
+func (r *Responder) listen(addr netip.AddrPort) error {
+	ln, err := net.Listen("tcp", addr.String())
+	if err != nil {
+		return fmt.Errorf("listen on tcp %s: %w", addr, err)
+	}
+	// Use the same port for UDP, even if it was chosen automatically.
+	addr = netip.MustParseAddrPort(ln.Addr().String())
+	conn, err := net.ListenPacket("udp", addr.String())
+	if err != nil {
+		_ = ln.Close()
+		return fmt.Errorf("listen on udp %s: %w", addr, err)
+	}
+
+	r.tcpListener = ln
+	r.udpConn = conn
+	return nil
+}
+
+func (r *Responder) startWorkers() {
+	r.mgr.Go("perf tcp listener", r.tcpWorker)
+	r.mgr.Go("perf udp echo", r.udpWorker)
+}
+
+func (r *Responder) tcpWorker(w *mgr.WorkerCtx) error {
+	for {
+		conn, err := r.tcpListener.Accept()
+		if err != nil {
+			if w.IsDone() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+
+		r.mgr.Go("perf test", func(w *mgr.WorkerCtx) error {
+			defer conn.Close() //nolint:errcheck
+
+			if err := r.handleTest(conn); err != nil {
+				w.Debug(
+					"throughput test failed",
+					"remote", conn.RemoteAddr(),
+					"err", err,
+				)
+			}
+			return nil
+		})
+	}
+}
+
+func (r *Responder) handleTest(conn net.Conn) error {
+	// Read request.
+	_ = conn.SetReadDeadline(time.Now().Add(ioGrace))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("read request: %w", err)
+	}
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return fmt.Errorf("parse request: %w", err)
+	}
+	duration := min(max(req.Duration, MinDuration), MaxDuration)
+
+	switch req.Direction {
+	case DirectionUp:
+		// Receive data and report the result.
+		_ = conn.SetReadDeadline(time.Now().Add(duration + ioGrace))
+		bytes, took, err := receive(reader)
+		result := upResult{
+			Bytes:    bytes,
+			Duration: took,
+		}
+		if err != nil {
+			result.Err = err.Error()
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(ioGrace))
+		_, err = conn.Write(append(data, '\n'))
+		return err
+
+	case DirectionDown:
+		_ = conn.SetWriteDeadline(time.Now().Add(duration + ioGrace))
+		return send(conn, duration)
+
+	default:
+		return fmt.Errorf("unknown direction %q", req.Direction)
+	}
+}
+
+func (r *Responder) udpWorker(w *mgr.WorkerCtx) error {
+	buf := make([]byte, maxProbeSize+1)
+	for {
+		n, addr, err := r.udpConn.ReadFrom(buf)
+		if err != nil {
+			if w.IsDone() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("read probe: %w", err)
+		}
+
+		// Echo valid probes only.
+		if !isProbe(buf[:n]) {
+			continue
+		}
+		_, _ = r.udpConn.WriteTo(buf[:n], addr)
+	}
+}
+
+// send writes data to the writer for the given duration.
+func send(w io.Writer, duration time.Duration) error {
+	buf := make([]byte, bufSize)
+	end := time.Now().Add(duration)
+	for time.Now().Before(end) {
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receive reads data from the reader until EOF and returns the amount of
+// bytes read and the time from the first byte until EOF.
+func receive(r io.Reader) (bytes uint64, took time.Duration, err error) {
+	buf := make([]byte, bufSize)
+	var started time.Time
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if started.IsZero() {
+				started = time.Now()
+			}
+			bytes += uint64(n)
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			if started.IsZero() {
+				return 0, 0, nil
+			}
+			return bytes, time.Since(started), nil
+		case err != nil:
+			return bytes, time.Since(started), err
+		}
+	}
+}
+
+func isProbe(data []byte) bool {
+	return len(data) <= maxProbeSize &&
+		len(data) >= len(probeMagic)+4 &&
+		string(data[:len(probeMagic)]) == string(probeMagic)
+}
@@ -0,0 +1,46 @@
+package perf
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestPerf(t *testing.T) {
+	t.Parallel()
+
+	// Start responder on localhost.
+	r := &Responder{
+		mgr: mgr.New("perf"),
+	}
+	require.NoError(t, r.listen(netip.MustParseAddrPort("127.0.0.1:0")))
+	r.startWorkers()
+	defer func() {
+		_ = r.Stop(r.mgr)
+		r.mgr.Cancel()
+	}()
+
+	// Run test.
+	dst := netip.MustParseAddrPort(r.tcpListener.Addr().String())
+	result, err := Run(context.Background(), dst, 200*time.Millisecond)
+	require.NoError(t, err)
+
+	// Check results.
+	for name, direction := range map[string]Direction{
+		DirectionUp:   result.Up,
+		DirectionDown: result.Down,
+	} {
+		assert.Positive(t, direction.Bytes, name+": bytes")
+		assert.Positive(t, direction.BitsPerSecond(), name+": throughput")
+		assert.Positive(t, direction.Latency.Sent, name+": probes")
+		assert.Positive(t, direction.Latency.Received, name+": answered probes")
+	}
+	assert.GreaterOrEqual(t, result.Idle.Sent, idleProbes, "idle probes")
+	assert.Positive(t, result.Idle.Avg, "idle latency")
+}
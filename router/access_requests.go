@@ -0,0 +1,176 @@
+package router
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+const (
+	maxAccessRequests  = 100
+	accessRequestsTTL  = 24 * time.Hour
+	accessRequestsKeep = 1 * time.Hour
+)
+
+// ErrAccessRequestNotFound is returned when an access request does not exist.
+var ErrAccessRequestNotFound = errors.New("access request not found")
+
+type accessRequestKey struct {
+	router  netip.Addr
+	service string
+}
+
+// AccessRequest is a recorded attempt of a router to access a non-public service.
+type AccessRequest struct {
+	Router   netip.Addr
+	Service  string
+	Protocol uint8
+	Port     uint16
+
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Attempts  int
+}
+
+// recordAccessRequest records an access request, if the service that was
+// denied access to has access requests enabled.
+func (r *Router) recordAccessRequest(connKey connStateKey) (recorded bool) {
+	// Check if service accepts access requests.
+	svc, ok := r.instance.Config().GetServiceByPolicy(connKey.protocol, connKey.localPort)
+	if !ok || !svc.AccessRequests {
+		return false
+	}
+
+	r.accessRequestsLock.Lock()
+	defer r.accessRequestsLock.Unlock()
+
+	// Update existing request.
+	key := accessRequestKey{
+		router:  connKey.remoteIP,
+		service: svc.Name,
+	}
+	now := r.clock.Now()
+	if req, ok := r.accessRequests[key]; ok {
+		req.LastSeen = now
+		req.Attempts++
+		return true
+	}
+
+	// Check if we have space for another request.
+	if len(r.accessRequests) >= maxAccessRequests {
+		return false
+	}
+
+	// Add new request.
+	r.accessRequests[key] = &AccessRequest{
+		Router:    connKey.remoteIP,
+		Service:   svc.Name,
+		Protocol:  connKey.protocol,
+		Port:      connKey.localPort,
+		FirstSeen: now,
+		LastSeen:  now,
+		Attempts:  1,
+	}
+	return true
+}
+
+// ExportAccessRequests returns all pending access requests.
+func (r *Router) ExportAccessRequests() []AccessRequest {
+	r.accessRequestsLock.Lock()
+	defer r.accessRequestsLock.Unlock()
+
+	export := make([]AccessRequest, 0, len(r.accessRequests))
+	for _, req := range r.accessRequests {
+		export = append(export, *req)
+	}
+
+	// Sort.
+	slices.SortFunc[[]AccessRequest, AccessRequest](export, func(a, b AccessRequest) int {
+		return -a.LastSeen.Compare(b.LastSeen) // Newer first.
+	})
+
+	return export
+}
+
+// ApproveAccessRequest approves the access request of the given router to the
+// given service and adds the router to the allowed routers of the service.
+func (r *Router) ApproveAccessRequest(router netip.Addr, service string) error {
+	key := accessRequestKey{
+		router:  router,
+		service: service,
+	}
+
+	// Check if request exists.
+	r.accessRequestsLock.Lock()
+	_, ok := r.accessRequests[key]
+	r.accessRequestsLock.Unlock()
+	if !ok {
+		return ErrAccessRequestNotFound
+	}
+
+	// Allow access in config.
+	if err := r.instance.Config().AllowServiceAccess(service, router); err != nil {
+		return err
+	}
+
+	// Remove request and reset connection states so that the policy is re-evaluated.
+	r.accessRequestsLock.Lock()
+	delete(r.accessRequests, key)
+	r.accessRequestsLock.Unlock()
+	r.resetInboundConnStates(router)
+
+	return nil
+}
+
+// DismissAccessRequest removes the access request of the given router to the
+// given service without taking any further action.
+func (r *Router) DismissAccessRequest(router netip.Addr, service string) error {
+	r.accessRequestsLock.Lock()
+	defer r.accessRequestsLock.Unlock()
+
+	key := accessRequestKey{
+		router:  router,
+		service: service,
+	}
+	if _, ok := r.accessRequests[key]; !ok {
+		return ErrAccessRequestNotFound
+	}
+	delete(r.accessRequests, key)
+
+	return nil
+}
+
+func (r *Router) cleanAccessRequests() {
+	removeThreshold := r.clock.Now().Add(-accessRequestsTTL)
+	inactiveThreshold := r.clock.Now().Add(-accessRequestsKeep)
+
+	r.accessRequestsLock.Lock()
+	defer r.accessRequestsLock.Unlock()
+
+	for key, req := range r.accessRequests {
+		switch {
+		case req.FirstSeen.Before(removeThreshold):
+			delete(r.accessRequests, key)
+		case req.Attempts <= 1 && req.LastSeen.Before(inactiveThreshold):
+			// Remove single attempts earlier, as they are likely just scans.
+			delete(r.accessRequests, key)
+		}
+	}
+}
+
+func (r *Router) resetInboundConnStates(remoteIP netip.Addr) {
+	r.connStatesLock.Lock()
+	defer r.connStatesLock.Unlock()
+
+	for key, entry := range r.connStates {
+		if entry.inbound && key.remoteIP == remoteIP {
+			delete(r.connStates, key)
+		}
+	}
+}
+
+// ProtocolName returns the protocol name, if available.
+func (req *AccessRequest) ProtocolName() string {
+	return (&ExportedConnection{Protocol: req.Protocol}).ProtocolName()
+}
@@ -0,0 +1,67 @@
+package router
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestAccessRequests(t *testing.T) {
+	t.Parallel()
+
+	remote := netip.MustParseAddr("fd12:3456::1")
+	cfg := config.MakeTestConfig(config.Store{
+		ServiceConfigs: []config.ServiceConfig{
+			{Name: "ssh", URL: "tcp://:22", Friends: true, AccessRequests: true},
+			{Name: "web", URL: "http://:80", Friends: true},
+		},
+	})
+	r := &Router{
+		clock:          m.NewVirtualClock(time.Now()),
+		connStates:     make(map[connStateKey]*connStateEntry),
+		accessRequests: make(map[accessRequestKey]*AccessRequest),
+		instance:       &deniedTestInstance{config: cfg},
+	}
+	sshKey := connStateKey{remoteIP: remote, protocol: 6, localPort: 22, remotePort: 50000}
+
+	// Only services with access requests record them.
+	assert.False(t, r.recordAccessRequest(connStateKey{remoteIP: remote, protocol: 6, localPort: 80}))
+	assert.True(t, r.recordAccessRequest(sshKey))
+	assert.True(t, r.recordAccessRequest(sshKey))
+	requests := r.ExportAccessRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "ssh", requests[0].Service)
+	assert.Equal(t, 2, requests[0].Attempts)
+
+	// Approving allows access while services are read concurrently.
+	services := cfg.GetServices()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			for _, svc := range cfg.GetServices() {
+				_ = len(svc.For)
+			}
+		}
+	}()
+	require.NoError(t, r.ApproveAccessRequest(remote, "ssh"))
+	wg.Wait()
+	assert.True(t, cfg.CheckInboundTrafficPolicy(6, 22, remote))
+	assert.Empty(t, r.ExportAccessRequests())
+	assert.Empty(t, services[0].For, "previously returned services must not change")
+	assert.ErrorIs(t, r.ApproveAccessRequest(remote, "ssh"), ErrAccessRequestNotFound)
+
+	// Dismissing removes the request only.
+	assert.True(t, r.recordAccessRequest(connStateKey{remoteIP: netip.MustParseAddr("fd12:3456::2"), protocol: 6, localPort: 22}))
+	require.NoError(t, r.DismissAccessRequest(netip.MustParseAddr("fd12:3456::2"), "ssh"))
+	assert.False(t, cfg.CheckInboundTrafficPolicy(6, 22, netip.MustParseAddr("fd12:3456::2")))
+	assert.ErrorIs(t, r.DismissAccessRequest(remote, "ssh"), ErrAccessRequestNotFound)
+}
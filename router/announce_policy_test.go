@@ -0,0 +1,64 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+func TestAnnouncePolicy(t *testing.T) {
+	t.Parallel()
+
+	friend := netip.MustParseAddr("fd12:3456::1")
+	transit := netip.MustParseAddr("fd12:3456::2")
+	stranger := netip.MustParseAddr("fd12:3456::3")
+	cfg := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			AnnouncePolicy: []config.AnnounceRuleConfig{
+				{Peers: transit.String(), Announce: "full"},
+				{Peers: "friends", Announce: "peer"},
+				{Peers: "lite", Announce: "none"},
+				{Peers: "all", Announce: "minimal"},
+			},
+		},
+		FriendConfigs: []config.FriendConfig{
+			{Name: "friend", IP: friend.String()},
+		},
+	})
+
+	assert.Equal(t, config.AnnounceFull, cfg.AnnounceLevelFor(transit, true), "explicit peer should match first")
+	assert.Equal(t, config.AnnouncePeer, cfg.AnnounceLevelFor(friend, true), "friends should match before lite")
+	assert.Equal(t, config.AnnounceNone, cfg.AnnounceLevelFor(stranger, true))
+	assert.Equal(t, config.AnnounceMinimal, cfg.AnnounceLevelFor(stranger, false))
+
+	// Without policy, everything is announced.
+	assert.Equal(t, config.AnnounceFull, config.MakeTestConfig(config.Store{}).AnnounceLevelFor(stranger, false))
+
+	// Invisible routers ignore the policy.
+	invisible := config.MakeTestConfig(config.Store{
+		Router: config.Router{
+			Invisible: true,
+			AnnouncePolicy: []config.AnnounceRuleConfig{
+				{Peers: "all", Announce: "full"},
+			},
+		},
+	})
+	assert.Equal(t, config.AnnounceNone, invisible.AnnounceLevelFor(transit, false))
+}
+
+func TestAnnouncePingMsgFlags(t *testing.T) {
+	t.Parallel()
+
+	data, err := cbor.Marshal(&AnnouncePingMsg{PeerOnly: true, Minimal: true})
+	require.NoError(t, err)
+	msg := &AnnouncePingMsg{}
+	require.NoError(t, cbor.Unmarshal(data, msg))
+	assert.True(t, msg.PeerOnly)
+	assert.True(t, msg.Minimal)
+	assert.Nil(t, msg.Info)
+}
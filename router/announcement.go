@@ -0,0 +1,140 @@
+package router
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// AnnounceValidity is how long announcements are valid after they were sent.
+// Routers announce themselves in an interval of 5 minutes, so an
+// announcement is valid until after the second next announcement.
+const AnnounceValidity = 2*announceInterval + 10*time.Second
+
+// ReceivedAnnouncement is an announcement received via a link.
+// It holds the routing logic of announcements, which is shared with the
+// routing simulation.
+type ReceivedAnnouncement struct {
+	// Router is the receiving router.
+	Router netip.Addr
+	// Peer is the peer the announcement was received from.
+	Peer netip.Addr
+	// Delay is the latency to the peer in milliseconds.
+	Delay uint16
+	// Label is the switch label of the link to the peer.
+	Label m.SwitchLabel
+
+	// Src is the announcing router.
+	Src netip.Addr
+	// ReturnLabel is the switch label of the link of the announcing router.
+	ReturnLabel m.SwitchLabel
+	// Stub signifies that the announcing router is a dead end.
+	Stub bool
+	// Hops holds the attachments of the forwarding routers, the most recent
+	// one first.
+	Hops []m.SwitchHop
+}
+
+// Looping returns whether the announcement already passed the receiving
+// router or passed a router twice.
+func (a *ReceivedAnnouncement) Looping() bool {
+	for i, hop := range a.Hops {
+		if announceHopIsLooping(a.Router, a.Src, a.Hops[:i], hop.Router) {
+			return true
+		}
+	}
+	return false
+}
+
+// announceHopIsLooping returns whether the next hop of an announcement is
+// the receiving router or was already passed by the announcement.
+func announceHopIsLooping(self, src netip.Addr, hops []m.SwitchHop, next netip.Addr) bool {
+	return next == self || next == src || slices.ContainsFunc(hops, func(hop m.SwitchHop) bool {
+		return hop.Router == next
+	})
+}
+
+// Route returns the routing table entry for the announcement.
+// The caller sets the expiry and announcement time.
+func (a *ReceivedAnnouncement) Route() m.RoutingTableEntry {
+	switchPath := m.SwitchPath{
+		Hops: make([]m.SwitchHop, 0, len(a.Hops)+2),
+	}
+	// Add own entry as first.
+	switchPath.Hops = append(switchPath.Hops, m.SwitchHop{
+		Router:       a.Router,
+		Delay:        a.Delay,
+		ForwardLabel: a.Label,
+		ReturnLabel:  0,
+	})
+	// Add stacked hops.
+	switchPath.Hops = append(switchPath.Hops, a.Hops...)
+	// Add announcing router as last.
+	switchPath.Hops = append(switchPath.Hops, m.SwitchHop{
+		Router:       a.Src,
+		Delay:        0,
+		ForwardLabel: 0,
+		ReturnLabel:  a.ReturnLabel,
+	})
+	switchPath.CalculateTotals()
+
+	// Create table entry.
+	rte := m.RoutingTableEntry{
+		DstIP:   a.Src,
+		NextHop: a.Peer,
+		Path:    switchPath,
+		Stub:    a.Stub,
+		Source:  m.RouteSourcePeer,
+	}
+	if len(a.Hops) > 0 {
+		rte.Source = m.RouteSourceGossip
+	}
+	return rte
+}
+
+// ForwardTo returns whether the announcement may be forwarded to the given
+// peer, which is not the case for the announcing router, the peer it was
+// received from and all routers it already passed.
+func (a *ReceivedAnnouncement) ForwardTo(peer netip.Addr) bool {
+	return peer != a.Src && peer != a.Peer && !slices.ContainsFunc(a.Hops, func(hop m.SwitchHop) bool {
+		return hop.Router == peer
+	})
+}
+
+// ForwardHop returns the attachment of the receiving router when forwarding
+// the announcement via the link with the given switch label.
+func (a *ReceivedAnnouncement) ForwardHop(sendLabel m.SwitchLabel) m.SwitchHop {
+	return m.SwitchHop{
+		Router:       a.Router,
+		Delay:        a.Delay,
+		ForwardLabel: a.Label,
+		ReturnLabel:  sendLabel,
+	}
+}
+
+// RoutablePrefixes returns the routable prefixes of the routing table of the
+// given router. Zero routes per destination uses the default of the table.
+func RoutablePrefixes(routerIP netip.Addr, routesPerDst int) ([]m.RoutablePrefix, error) {
+	// Get default prefix.
+	routerPrefix := netip.PrefixFrom(routerIP, m.RegionPrefixBits)
+	// Make prefix more precise by looking up the country marker.
+	marker, err := m.LookupCountryMarker(routerIP)
+	if err == nil {
+		routerPrefix = marker.Prefix
+	}
+	if !routerPrefix.Contains(routerIP) {
+		return nil, errors.New("internal error: failed to derive router IP prefix")
+	}
+
+	// Get routable prefixes and apply routes per destination.
+	routablePrefixes := m.GetRoutablePrefixesFor(routerIP, routerPrefix)
+	if routesPerDst > 0 {
+		for i := range routablePrefixes {
+			routablePrefixes[i].RoutesPerDestination = routesPerDst
+		}
+	}
+	return routablePrefixes, nil
+}
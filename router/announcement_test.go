@@ -0,0 +1,64 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestReceivedAnnouncement(t *testing.T) {
+	t.Parallel()
+
+	var (
+		self  = netip.MustParseAddr("fd12:3456::1")
+		peer  = netip.MustParseAddr("fd12:3456::2")
+		relay = netip.MustParseAddr("fd12:3456::3")
+		src   = netip.MustParseAddr("fd12:3456::4")
+		other = netip.MustParseAddr("fd12:3456::5")
+	)
+	a := &ReceivedAnnouncement{
+		Router:      self,
+		Peer:        peer,
+		Delay:       10,
+		Label:       1,
+		Src:         src,
+		ReturnLabel: 4,
+		Hops: []m.SwitchHop{
+			{Router: peer, Delay: 20, ForwardLabel: 2, ReturnLabel: 3},
+			{Router: relay, Delay: 30, ForwardLabel: 5, ReturnLabel: 6},
+		},
+	}
+	assert.False(t, a.Looping())
+
+	// Route via the stacked hops.
+	rte := a.Route()
+	assert.Equal(t, src, rte.DstIP)
+	assert.Equal(t, peer, rte.NextHop)
+	assert.Equal(t, m.RouteSourceGossip, rte.Source)
+	hops := make([]netip.Addr, 0, len(rte.Path.Hops))
+	for _, hop := range rte.Path.Hops {
+		hops = append(hops, hop.Router)
+	}
+	assert.Equal(t, []netip.Addr{self, peer, relay, src}, hops)
+	assert.Equal(t, uint8(3), rte.Path.TotalHops)
+
+	// Forward only to routers the announcement did not pass.
+	assert.True(t, a.ForwardTo(other))
+	for _, ip := range []netip.Addr{peer, relay, src} {
+		assert.False(t, a.ForwardTo(ip), ip)
+	}
+	assert.Equal(t, m.SwitchHop{Router: self, Delay: 10, ForwardLabel: 1, ReturnLabel: 7}, a.ForwardHop(7))
+
+	// Announcements from peers have no hops.
+	direct := &ReceivedAnnouncement{Router: self, Peer: src, Src: src}
+	assert.Equal(t, m.RouteSourcePeer, direct.Route().Source)
+
+	// Announcements that passed a router twice or the receiving router loop.
+	a.Hops = append(a.Hops, m.SwitchHop{Router: self})
+	assert.True(t, a.Looping())
+	a.Hops[2].Router = peer
+	assert.True(t, a.Looping())
+}
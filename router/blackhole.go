@@ -0,0 +1,251 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+const (
+	// blackholeReplyRate limits the error pings sent to a blackholed router,
+	// so that an attacker cannot use the router to amplify its traffic.
+	blackholeReplyRate  = 1
+	blackholeReplyBurst = 5
+	// blackholeReplyTTL defines how long idle reply limits are kept.
+	blackholeReplyTTL = 1 * time.Minute
+	// maxBlackholeReplies limits the amount of tracked reply limits.
+	maxBlackholeReplies = 1024
+)
+
+// Blackhole errors.
+var (
+	ErrBlackholeNotFound = errors.New("blackhole not found")
+	ErrInvalidBlackhole  = errors.New("invalid blackhole")
+)
+
+// BlackholeAction defines how traffic to and from blackholed routers is
+// answered.
+type BlackholeAction string
+
+// Blackhole actions.
+const (
+	// BlackholeDrop silently drops traffic.
+	BlackholeDrop BlackholeAction = "drop"
+	// BlackholeProhibited answers with "administratively prohibited".
+	BlackholeProhibited BlackholeAction = "prohibited"
+	// BlackholeUnreachable answers with "address unreachable".
+	BlackholeUnreachable BlackholeAction = "unreachable"
+)
+
+// Blackhole drops all traffic to and from the routers in a prefix. It is used
+// during incident response, eg. when a remote router attacks a local service.
+type Blackhole struct {
+	Prefix  netip.Prefix
+	Action  BlackholeAction
+	Reason  string
+	Created time.Time
+	// Expires is zero if the blackhole does not expire.
+	Expires time.Time
+	// Dropped is the amount of dropped packets.
+	Dropped uint64
+}
+
+type blackholeEntry struct {
+	Blackhole
+	dropped atomic.Uint64
+}
+
+type blackholeReply struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// AddBlackhole installs a blackhole for the given prefix. An existing
+// blackhole for the same prefix is replaced. A zero duration means that the
+// blackhole does not expire. Blackholes are lost on restart.
+func (r *Router) AddBlackhole(prefix netip.Prefix, action BlackholeAction, reason string, duration time.Duration) (*Blackhole, error) {
+	// Check input.
+	prefix = prefix.Masked()
+	switch action {
+	case BlackholeDrop, BlackholeProhibited, BlackholeUnreachable:
+	case "":
+		action = BlackholeDrop
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidBlackhole, action)
+	}
+	switch {
+	case !prefix.IsValid() || !m.BaseNetPrefix.Contains(prefix.Addr()) || prefix.Bits() < m.BaseNetPrefix.Bits():
+		return nil, fmt.Errorf("%w: %s is not within %s", ErrInvalidBlackhole, prefix, m.BaseNetPrefix)
+	case duration < 0:
+		return nil, fmt.Errorf("%w: negative duration", ErrInvalidBlackhole)
+	}
+
+	entry := &blackholeEntry{
+		Blackhole: Blackhole{
+			Prefix:  prefix,
+			Action:  action,
+			Reason:  reason,
+			Created: r.clock.Now(),
+		},
+	}
+	if duration > 0 {
+		entry.Expires = entry.Created.Add(duration)
+	}
+
+	r.blackholesLock.Lock()
+	defer r.blackholesLock.Unlock()
+
+	// Replace existing or add new, keeping the most specific prefixes first.
+	r.blackholes = slices.DeleteFunc(r.blackholes, func(existing *blackholeEntry) bool {
+		return existing.Prefix == prefix
+	})
+	r.blackholes = append(r.blackholes, entry)
+	slices.SortStableFunc(r.blackholes, func(a, b *blackholeEntry) int {
+		return b.Prefix.Bits() - a.Prefix.Bits()
+	})
+
+	r.mgr.Warn(
+		"installed blackhole",
+		"prefix", prefix,
+		"action", action,
+		"reason", reason,
+		"expires", entry.Expires,
+	)
+	blackhole := entry.Blackhole
+	return &blackhole, nil
+}
+
+// RemoveBlackhole removes the blackhole of the given prefix.
+func (r *Router) RemoveBlackhole(prefix netip.Prefix) error {
+	prefix = prefix.Masked()
+
+	r.blackholesLock.Lock()
+	defer r.blackholesLock.Unlock()
+
+	index := slices.IndexFunc(r.blackholes, func(entry *blackholeEntry) bool {
+		return entry.Prefix == prefix
+	})
+	if index < 0 {
+		return ErrBlackholeNotFound
+	}
+	r.blackholes = slices.Delete(r.blackholes, index, index+1)
+
+	r.mgr.Info(
+		"removed blackhole",
+		"prefix", prefix,
+	)
+	return nil
+}
+
+// GetBlackholes returns a copy of all active blackholes.
+func (r *Router) GetBlackholes() []Blackhole {
+	r.blackholesLock.RLock()
+	defer r.blackholesLock.RUnlock()
+
+	now := r.clock.Now()
+	list := make([]Blackhole, 0, len(r.blackholes))
+	for _, entry := range r.blackholes {
+		if entry.expired(now) {
+			continue
+		}
+		blackhole := entry.Blackhole
+		blackhole.Dropped = entry.dropped.Load()
+		list = append(list, blackhole)
+	}
+	slices.SortFunc(list, func(a, b Blackhole) int {
+		return a.Prefix.Addr().Compare(b.Prefix.Addr())
+	})
+	return list
+}
+
+// checkBlackhole returns the action of the most specific active blackhole
+// that contains the given remote router and counts the packet as dropped.
+func (r *Router) checkBlackhole(remote netip.Addr) (action BlackholeAction, blackholed bool) {
+	r.blackholesLock.RLock()
+	defer r.blackholesLock.RUnlock()
+
+	if len(r.blackholes) == 0 {
+		return "", false
+	}
+	now := r.clock.Now()
+	for _, entry := range r.blackholes {
+		if entry.Prefix.Contains(remote) && !entry.expired(now) {
+			entry.dropped.Add(1)
+			return entry.Action, true
+		}
+	}
+	return "", false
+}
+
+// allowBlackholeReply returns whether an error ping may be sent to the given
+// blackholed router. Replies are rate limited per router.
+func (r *Router) allowBlackholeReply(remote netip.Addr) bool {
+	now := r.clock.Now()
+
+	r.blackholeRepliesLock.Lock()
+	defer r.blackholeRepliesLock.Unlock()
+
+	reply, ok := r.blackholeReplies[remote]
+	if !ok {
+		// Make room for new router.
+		if len(r.blackholeReplies) >= maxBlackholeReplies {
+			r.cleanBlackholeReplies(now)
+		}
+		if len(r.blackholeReplies) >= maxBlackholeReplies {
+			// Drop silently when too many routers are tracked.
+			return false
+		}
+
+		reply = &blackholeReply{
+			limiter: rate.NewLimiter(blackholeReplyRate, blackholeReplyBurst),
+		}
+		r.blackholeReplies[remote] = reply
+	}
+	reply.lastSeen = now
+	return reply.limiter.AllowN(now, 1)
+}
+
+// cleanBlackholeReplies removes idle reply limits.
+// Must be called with the lock held.
+func (r *Router) cleanBlackholeReplies(now time.Time) {
+	for remote, reply := range r.blackholeReplies {
+		if now.Sub(reply.lastSeen) > blackholeReplyTTL {
+			delete(r.blackholeReplies, remote)
+		}
+	}
+}
+
+// cleanBlackholes removes expired blackholes and idle reply limits.
+func (r *Router) cleanBlackholes() {
+	now := r.clock.Now()
+
+	r.blackholeRepliesLock.Lock()
+	r.cleanBlackholeReplies(now)
+	r.blackholeRepliesLock.Unlock()
+
+	r.blackholesLock.Lock()
+	defer r.blackholesLock.Unlock()
+
+	r.blackholes = slices.DeleteFunc(r.blackholes, func(entry *blackholeEntry) bool {
+		if entry.expired(now) {
+			r.mgr.Info(
+				"blackhole expired",
+				"prefix", entry.Prefix,
+				"dropped", entry.dropped.Load(),
+			)
+			return true
+		}
+		return false
+	})
+}
+
+func (entry *blackholeEntry) expired(now time.Time) bool {
+	return !entry.Expires.IsZero() && now.After(entry.Expires)
+}
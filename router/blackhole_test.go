@@ -0,0 +1,80 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestBlackholes(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		mgr:              mgr.New("test"),
+		clock:            clock,
+		blackholeReplies: make(map[netip.Addr]*blackholeReply),
+	}
+	prefix, err := m.GetCountryPrefix("AT")
+	require.NoError(t, err)
+	attacker := prefix.Addr().Next()
+	neighbor := attacker.Next()
+
+	// Blackhole the country and the attacker.
+	_, err = r.AddBlackhole(prefix, BlackholeUnreachable, "", 0)
+	require.NoError(t, err)
+	_, err = r.AddBlackhole(netip.PrefixFrom(attacker, 128), "", "attack", time.Hour)
+	require.NoError(t, err)
+
+	// The most specific blackhole applies.
+	action, blackholed := r.checkBlackhole(attacker)
+	assert.True(t, blackholed)
+	assert.Equal(t, BlackholeDrop, action)
+	action, blackholed = r.checkBlackhole(neighbor)
+	assert.True(t, blackholed)
+	assert.Equal(t, BlackholeUnreachable, action)
+	other, err := m.GetCountryPrefix("DE")
+	require.NoError(t, err)
+	_, blackholed = r.checkBlackhole(other.Addr().Next())
+	assert.False(t, blackholed)
+
+	list := r.GetBlackholes()
+	require.Len(t, list, 2)
+	for _, blackhole := range list {
+		assert.Equal(t, uint64(1), blackhole.Dropped)
+	}
+
+	// Replies are rate limited per router.
+	for range blackholeReplyBurst {
+		assert.True(t, r.allowBlackholeReply(attacker))
+	}
+	assert.False(t, r.allowBlackholeReply(attacker))
+	assert.True(t, r.allowBlackholeReply(neighbor), "other routers must not be limited")
+	clock.Advance(time.Second)
+	assert.True(t, r.allowBlackholeReply(attacker))
+
+	// Blackholes expire.
+	clock.Advance(2 * time.Hour)
+	r.cleanBlackholes()
+	assert.Empty(t, r.blackholeReplies, "idle reply limits must be removed")
+	action, blackholed = r.checkBlackhole(attacker)
+	assert.True(t, blackholed)
+	assert.Equal(t, BlackholeUnreachable, action, "only the country blackhole must remain")
+
+	// Remove blackhole.
+	require.NoError(t, r.RemoveBlackhole(prefix))
+	assert.ErrorIs(t, r.RemoveBlackhole(prefix), ErrBlackholeNotFound)
+	assert.Empty(t, r.GetBlackholes())
+
+	// Invalid blackholes are rejected.
+	_, err = r.AddBlackhole(netip.MustParsePrefix("2001:db8::/32"), BlackholeDrop, "", 0)
+	assert.ErrorIs(t, err, ErrInvalidBlackhole)
+	_, err = r.AddBlackhole(prefix, "explode", "", 0)
+	assert.ErrorIs(t, err, ErrInvalidBlackhole)
+}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"net/netip"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// RemoteCapabilities returns the protocol features the given router supports.
+// The capabilities of peers are taken from the link setup, the ones of other
+// routers from their announced router info.
+// Returns zero if they are unknown, see m.Capabilities.Known.
+func (r *Router) RemoteCapabilities(ip netip.Addr) m.Capabilities {
+	if link := r.instance.Peering().GetLink(ip); link != nil && link.Capabilities().Known() {
+		return link.Capabilities()
+	}
+	return r.instance.State().RouterCapabilities(ip)
+}
+
+// lacksCapability returns whether the given router is known to not support
+// the given capabilities. Routers with unknown capabilities are assumed to
+// support them, as they predate capabilities.
+func (r *Router) lacksCapability(ip netip.Addr, capabilities m.Capabilities) bool {
+	remote := r.RemoteCapabilities(ip)
+	return remote.Known() && !remote.Has(capabilities)
+}
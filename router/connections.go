@@ -1,6 +1,7 @@
 package router
 
 import (
+	"cmp"
 	"net/netip"
 	"slices"
 	"strconv"
@@ -22,13 +23,17 @@ type connStateEntry struct {
 	firstSeen int64
 	lastSeen  atomic.Int64
 
-	inbound    bool
-	shortLived bool
-	status     atomic.Uint32
-	notify     chan connStatus
+	inbound      bool
+	guestExpires int64
+	status       atomic.Uint32
+	notify       chan connStatus
+	tcpSeen      atomic.Uint32
 
 	dataIn  atomic.Uint64
 	dataOut atomic.Uint64
+
+	// svcStats is set for allowed inbound connections to a service.
+	svcStats *serviceStats
 }
 
 type connStatus uint32
@@ -40,6 +45,7 @@ const (
 	connStatusProhibited  // Denied locally.
 	connStatusDenied      // Denied by remote.
 	connStatusRejected    // Technical or operational issue.
+	connStatusPending     // Waiting for a decision by the user.
 )
 
 func (r *Router) getConnState(key connStateKey) (*connStateEntry, bool) {
@@ -54,44 +60,142 @@ func (r *Router) setConnState(key connStateKey, entry *connStateEntry) {
 	r.connStatesLock.Lock()
 	defer r.connStatesLock.Unlock()
 
+	if _, ok := r.connStates[key]; !ok && r.maxConnStates > 0 && len(r.connStates) >= r.maxConnStates {
+		r.evictConnStates()
+	}
 	r.connStates[key] = entry
 }
 
-func (r *Router) checkPolicy(w *mgr.WorkerCtx, inbound bool, connKey connStateKey, dataLength int) (status connStatus, statusUpdate chan connStatus) {
+// Connection state timeouts.
+const (
+	connTimeoutICMP           = 10 * time.Second
+	connTimeoutUDP            = 3 * time.Minute
+	connTimeoutTCP            = 2 * time.Minute
+	connTimeoutTCPEstablished = 1 * time.Hour
+	connTimeoutTCPClosed      = 10 * time.Second
+	connTimeoutDefault        = 10 * time.Minute
+
+	// connEvictFraction defines which fraction of the connection states is
+	// evicted at once when the table is full, so that eviction does not run
+	// for every new connection.
+	connEvictFraction = 20
+)
+
+// timeout returns after which time of inactivity the connection state is
+// removed. Closed TCP connections are kept shortly, so that late packets are
+// still matched.
+func (entry *connStateEntry) timeout(protocol uint8) time.Duration {
+	switch protocol {
+	case 1, 58: // ICMP, ICMPv6
+		return connTimeoutICMP
+	case 17: // UDP
+		return connTimeoutUDP
+	case 6: // TCP
+		switch entry.tcpState() { //nolint:exhaustive
+		case tcpStateEstablished:
+			if connStatus(entry.status.Load()) == connStatusAllowed {
+				return connTimeoutTCPEstablished
+			}
+		case tcpStateClosed:
+			return connTimeoutTCPClosed
+		}
+		return connTimeoutTCP
+	default:
+		return connTimeoutDefault
+	}
+}
+
+func (r *Router) cleanConnStates() {
+	now := r.clock.Now().Unix()
+
+	r.connStatesLock.Lock()
+	defer r.connStatesLock.Unlock()
+
+	for key, entry := range r.connStates {
+		if now-entry.lastSeen.Load() > int64(entry.timeout(key.protocol)/time.Second) {
+			delete(r.connStates, key)
+		}
+	}
+}
+
+// evictConnStates removes the least recently seen connection states.
+// The connection states lock must be held.
+func (r *Router) evictConnStates() {
+	type lastSeenKey struct {
+		key      connStateKey
+		lastSeen int64
+	}
+	entries := make([]lastSeenKey, 0, len(r.connStates))
+	for key, entry := range r.connStates {
+		entries = append(entries, lastSeenKey{key: key, lastSeen: entry.lastSeen.Load()})
+	}
+	slices.SortFunc(entries, func(a, b lastSeenKey) int {
+		return cmp.Compare(a.lastSeen, b.lastSeen)
+	})
+
+	evict := max(len(entries)/connEvictFraction, 1)
+	for _, entry := range entries[:evict] {
+		delete(r.connStates, entry.key)
+	}
+	r.connStatesEvicted.Add(uint64(evict))
+}
+
+// ConnTableStats holds the occupancy of the connection state table.
+type ConnTableStats struct {
+	Entries int
+	Max     int
+	Evicted uint64
+}
+
+// ConnTableStats returns the occupancy of the connection state table.
+func (r *Router) ConnTableStats() ConnTableStats {
+	r.connStatesLock.RLock()
+	defer r.connStatesLock.RUnlock()
+
+	return ConnTableStats{
+		Entries: len(r.connStates),
+		Max:     r.maxConnStates,
+		Evicted: r.connStatesEvicted.Load(),
+	}
+}
+
+func (r *Router) checkPolicy(w *mgr.WorkerCtx, inbound bool, connKey connStateKey, dataLength int, tcpFlags uint8) (status connStatus, statusUpdate chan connStatus) {
 	// Check if we have seen this connection before.
 	connState, ok := r.getConnState(connKey)
 	if ok {
 		// Update last seen.
-		connState.lastSeen.Store(time.Now().Unix())
+		connState.lastSeen.Store(r.clock.Now().Unix())
+		if connKey.protocol == 6 {
+			connState.updateTCPState(inbound, tcpFlags)
+		}
+		// Revoke access if guest access expired.
+		if connState.guestExpires != 0 && r.clock.Now().Unix() > connState.guestExpires {
+			connState.status.CompareAndSwap(uint32(connStatusAllowed), uint32(connStatusDenied))
+		}
 		// Update traffic stats.
 		if inbound {
 			connState.dataIn.Add(uint64(dataLength))
 		} else {
 			connState.dataOut.Add(uint64(dataLength))
 		}
+		if connState.svcStats != nil {
+			connState.svcStats.addData(inbound, dataLength)
+		}
 		// Return status and status update channel.
 		return connStatus(connState.status.Load()), connState.notify
 	}
 
 	// If not, set up state record.
-
-	// Check if the protocol is short-lived.
-	var shortLived bool
-	switch connKey.protocol {
-	case 1: // ICMP
-		shortLived = true
-	case 58: // ICMPv6
-		shortLived = true
-	}
-	// Create state entry.
 	connState = &connStateEntry{
-		inbound:    inbound,
-		shortLived: shortLived,
-		firstSeen:  time.Now().Unix(),
-		notify:     make(chan connStatus),
+		inbound:   inbound,
+		firstSeen: r.clock.Now().Unix(),
+		notify:    make(chan connStatus),
 	}
 	// Update last seen.
-	connState.lastSeen.Store(time.Now().Unix())
+	connState.lastSeen.Store(r.clock.Now().Unix())
+	if connKey.protocol == 6 {
+		connState.updateTCPState(inbound, tcpFlags)
+	}
 	// Update traffic stats.
 	if inbound {
 		connState.dataIn.Add(uint64(dataLength))
@@ -104,35 +208,110 @@ func (r *Router) checkPolicy(w *mgr.WorkerCtx, inbound bool, connKey connStateKe
 
 	if inbound {
 		// Check inbound policy.
-		if r.instance.Config().CheckInboundTrafficPolicy(connKey.protocol, connKey.localPort, connKey.remoteIP) {
-			connState.status.Store(uint32(connStatusAllowed))
+		decision := r.decideInbound(connKey.remoteIP, connKey.protocol, connKey.localPort)
+		connState.status.Store(uint32(decision.status))
+		switch decision.rule { //nolint:exhaustive
+		case PolicyRuleOutsideSchedule:
+			w.Debug(
+				"incoming connection to service outside of schedule denied",
+				"router", connKey.remoteIP,
+				"protocol", connKey.protocol,
+				"port", connKey.localPort,
+			)
+			r.trackDeniedConn(w, connKey)
+
+		case PolicyRuleHiddenService:
+			w.Debug(
+				"incoming connection to hidden service ignored",
+				"router", connKey.remoteIP,
+				"protocol", connKey.protocol,
+				"port", connKey.localPort,
+			)
+			r.trackDeniedConn(w, connKey)
+			r.recordDeniedAttempt(w, connKey)
+
+		case PolicyRulePublicService, PolicyRuleFriends, PolicyRuleAllowedRouter:
+			if decision.isSvc {
+				connState.svcStats = r.recordServiceConn(connKey)
+				connState.svcStats.addData(inbound, dataLength)
+			}
+			r.recordInbound(connKey)
 			w.Debug(
 				"incoming connection allowed",
 				"router", connKey.remoteIP,
 				"protocol", connKey.protocol,
 				"port", connKey.localPort,
 			)
-		} else {
-			connState.status.Store(uint32(connStatusDenied))
+
+		case PolicyRuleGuestAccess:
+			connState.guestExpires = decision.guestExpires.Unix()
+			if decision.isSvc {
+				connState.svcStats = r.recordServiceConn(connKey)
+				connState.svcStats.addData(inbound, dataLength)
+			}
+			r.recordInbound(connKey)
+			w.Debug(
+				"incoming connection allowed by guest access",
+				"router", connKey.remoteIP,
+				"protocol", connKey.protocol,
+				"port", connKey.localPort,
+				"expires", decision.guestExpires,
+			)
+
+		default:
 			w.Warn(
 				"incoming connection denied",
 				"router", connKey.remoteIP,
 				"protocol", connKey.protocol,
 				"port", connKey.localPort,
 			)
+			r.trackDeniedConn(w, connKey)
+			r.recordDeniedAttempt(w, connKey)
+			// Record access request, if enabled for service.
+			if r.recordAccessRequest(connKey) {
+				w.Info(
+					"access request recorded",
+					"router", connKey.remoteIP,
+					"protocol", connKey.protocol,
+					"port", connKey.localPort,
+				)
+			}
 		}
 	} else {
 		// Check outbound policy.
-		if r.outboundAllowedTo(connKey.remoteIP) {
-			connState.status.Store(uint32(connStatusAllowed))
+		decision := r.decideOutbound(connKey.remoteIP)
+		if decision.status == connStatusPending {
+			created, ok := r.recordOutboundPrompt(connKey)
+			switch {
+			case !ok:
+				// Too many open prompts.
+				decision.status = connStatusProhibited
+			case created:
+				w.Info(
+					"outgoing connection awaits decision",
+					"router", connKey.remoteIP,
+					"protocol", connKey.protocol,
+					"port", connKey.remotePort,
+				)
+			}
+		}
+		connState.status.Store(uint32(decision.status))
+		switch decision.status { //nolint:exhaustive
+		case connStatusAllowed:
 			w.Debug(
 				"outgoing connection allowed",
 				"router", connKey.remoteIP,
 				"protocol", connKey.protocol,
 				"port", connKey.remotePort,
 			)
-		} else {
-			connState.status.Store(uint32(connStatusProhibited))
+		case connStatusPending:
+			w.Debug(
+				"outgoing connection held until decision",
+				"router", connKey.remoteIP,
+				"protocol", connKey.protocol,
+				"port", connKey.remotePort,
+			)
+		default:
 			w.Warn(
 				"outgoing connection prohibited",
 				"router", connKey.remoteIP,
@@ -154,7 +333,7 @@ func (r *Router) checkSimilarOutboundStatus(w *mgr.WorkerCtx, connKey connStateK
 	r.connStatesLock.RLock()
 	defer r.connStatesLock.RUnlock()
 
-	mustBeNewerThan := time.Now().Add(-errorRecvCooldown).Unix()
+	mustBeNewerThan := r.clock.Now().Add(-errorRecvCooldown).Unix()
 stateSearch:
 	for key, state := range r.connStates {
 		switch {
@@ -209,17 +388,6 @@ stateSearch:
 	return connStatus(connState.status.Load())
 }
 
-func (r *Router) outboundAllowedTo(dst netip.Addr) bool {
-	// Check if router is isolated.
-	if !r.instance.Config().Router.Isolate {
-		return true
-	}
-
-	// Check if dst is a friend.
-	_, ok := r.instance.Config().FriendsByIP[dst]
-	return ok
-}
-
 func (r *Router) markRouter(status connStatus, dst netip.Addr) {
 	r.connStatesLock.RLock()
 	defer r.connStatesLock.RUnlock()
@@ -278,10 +446,50 @@ type ExportedConnection struct {
 	FirstSeen   time.Time
 	LastSeen    time.Time
 
+	// TCPState is the state of TCP connections, if known.
+	TCPState string
+	// Active is set for open TCP connections and for other connections that
+	// recently had traffic.
+	Active bool
+
 	DataIn  uint64
 	DataOut uint64
 }
 
+// connActiveThreshold defines until when connections without state are
+// regarded as active after the last packet.
+const connActiveThreshold = 30 * time.Second
+
+// active returns whether the connection is active.
+func (entry *connStateEntry) active(protocol uint8, now int64) bool {
+	if connStatus(entry.status.Load()) != connStatusAllowed {
+		return false
+	}
+	if protocol == 6 {
+		switch entry.tcpState() {
+		case tcpStateConnecting, tcpStateEstablished, tcpStateClosing:
+			return true
+		case tcpStateClosed:
+			return false
+		case tcpStateUnknown:
+		}
+	}
+	return now-entry.lastSeen.Load() <= int64(connActiveThreshold/time.Second)
+}
+
+// CountConnections returns the amount of active and recent, but inactive,
+// connections.
+func CountConnections(conns []ExportedConnection) (active, recent int) {
+	for _, conn := range conns {
+		if conn.Active {
+			active++
+		} else {
+			recent++
+		}
+	}
+	return active, recent
+}
+
 // ExportConnections returns an exported version of the connections.
 func (r *Router) ExportConnections(maxAge time.Duration) []ExportedConnection {
 	// Export connections.
@@ -306,10 +514,13 @@ func (r *Router) exportConnsRaw(maxAge time.Duration) []ExportedConnection {
 	defer r.connStatesLock.RUnlock()
 
 	export := make([]ExportedConnection, 0, len(r.connStates))
-	ignoreOlderThan := time.Now().Add(-maxAge).Unix()
+	now := r.clock.Now().Unix()
+	ignoreOlderThan := r.clock.Now().Add(-maxAge).Unix()
 
 	for key, entry := range r.connStates {
-		if entry.lastSeen.Load() < ignoreOlderThan {
+		// Always include active connections, even if idle.
+		active := entry.active(key.protocol, now)
+		if !active && entry.lastSeen.Load() < ignoreOlderThan {
 			continue
 		}
 
@@ -327,6 +538,9 @@ func (r *Router) exportConnsRaw(maxAge time.Duration) []ExportedConnection {
 			FirstSeen:   time.Unix(entry.firstSeen, 0),
 			LastSeen:    time.Unix(entry.lastSeen.Load(), 0),
 
+			TCPState: entry.tcpState().Name(),
+			Active:   active,
+
 			DataIn:  entry.dataIn.Load(),
 			DataOut: entry.dataOut.Load(),
 		})
@@ -413,6 +627,8 @@ func (status connStatus) Name() string {
 		return "access denied"
 	case connStatusRejected:
 		return "rejected"
+	case connStatusPending:
+		return "pending"
 	case connStatusUnknown:
 		fallthrough
 	default:
@@ -434,6 +650,8 @@ func (status connStatus) ColorName() string {
 		return "danger"
 	case connStatusRejected:
 		return "warning"
+	case connStatusPending:
+		return "info"
 	case connStatusUnknown:
 		fallthrough
 	default:
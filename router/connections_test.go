@@ -0,0 +1,136 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestConnStateCleaning(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock:         clock,
+		connStates:    make(map[connStateKey]*connStateEntry),
+		maxConnStates: 100,
+	}
+	remote := netip.MustParseAddr("fd12:3456::1")
+	addConn := func(protocol uint8, port uint16, established bool) connStateKey {
+		key := connStateKey{remoteIP: remote, protocol: protocol, remotePort: port}
+		entry := &connStateEntry{}
+		entry.status.Store(uint32(connStatusAllowed))
+		entry.lastSeen.Store(clock.Now().Unix())
+		if established {
+			entry.updateTCPState(false, tcpFlagSYN)
+			entry.updateTCPState(true, tcpFlagSYN|tcpFlagACK)
+			entry.updateTCPState(false, tcpFlagACK)
+		}
+		r.setConnState(key, entry)
+		return key
+	}
+
+	icmp := addConn(58, 0, false)
+	udp := addConn(17, 53, false)
+	tcpAttempt := addConn(6, 80, false)
+	tcpEstablished := addConn(6, 443, true)
+
+	// ICMP is removed first.
+	clock.Advance(connTimeoutICMP + time.Second)
+	r.cleanConnStates()
+	assert.NotContains(t, r.connStates, icmp)
+	assert.Contains(t, r.connStates, tcpAttempt)
+
+	// Then TCP connection attempts and UDP.
+	clock.Advance(connTimeoutUDP)
+	r.cleanConnStates()
+	assert.NotContains(t, r.connStates, tcpAttempt)
+	assert.NotContains(t, r.connStates, udp)
+	assert.Contains(t, r.connStates, tcpEstablished)
+
+	// Established TCP connections are kept longest.
+	clock.Advance(connTimeoutTCPEstablished)
+	r.cleanConnStates()
+	assert.Empty(t, r.connStates)
+
+	// Least recently seen are evicted when full.
+	oldest := addConn(17, 1, false)
+	clock.Advance(time.Second)
+	for i := range r.maxConnStates {
+		addConn(17, uint16(100+i), false)
+	}
+	stats := r.ConnTableStats()
+	assert.Equal(t, r.maxConnStates+1-r.maxConnStates/connEvictFraction, stats.Entries)
+	assert.Equal(t, uint64(r.maxConnStates/connEvictFraction), stats.Evicted)
+	assert.NotContains(t, r.connStates, oldest)
+}
+
+func TestTCPState(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Unix()
+	entry := &connStateEntry{}
+	entry.status.Store(uint32(connStatusAllowed))
+	entry.lastSeen.Store(now)
+
+	// Handshake.
+	entry.updateTCPState(false, tcpFlagSYN)
+	assert.Equal(t, tcpStateConnecting, entry.tcpState())
+	entry.updateTCPState(true, tcpFlagSYN|tcpFlagACK)
+	assert.Equal(t, tcpStateConnecting, entry.tcpState())
+	entry.updateTCPState(false, tcpFlagACK)
+	assert.Equal(t, tcpStateEstablished, entry.tcpState())
+	assert.Equal(t, connTimeoutTCPEstablished, entry.timeout(6))
+
+	// Idle established connections stay active.
+	assert.True(t, entry.active(6, now+int64(time.Hour/time.Second)))
+
+	// Close from both sides.
+	entry.updateTCPState(false, tcpFlagFIN|tcpFlagACK)
+	assert.Equal(t, tcpStateClosing, entry.tcpState())
+	assert.True(t, entry.active(6, now))
+	entry.updateTCPState(true, tcpFlagFIN|tcpFlagACK)
+	assert.Equal(t, tcpStateClosed, entry.tcpState())
+	assert.Equal(t, connTimeoutTCPClosed, entry.timeout(6))
+	assert.False(t, entry.active(6, now))
+
+	// Reset.
+	reset := &connStateEntry{}
+	reset.updateTCPState(true, tcpFlagACK)
+	assert.Equal(t, tcpStateEstablished, reset.tcpState(), "picked up mid-stream")
+	reset.updateTCPState(false, tcpFlagRST)
+	assert.Equal(t, tcpStateClosed, reset.tcpState())
+
+	// Other protocols are active when recently seen.
+	assert.True(t, entry.active(17, now+10))
+	assert.False(t, entry.active(17, now+int64(connActiveThreshold/time.Second)+1))
+}
+
+func TestActiveRemotes(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock:      clock,
+		connStates: make(map[connStateKey]*connStateEntry),
+	}
+	addConn := func(remote netip.Addr) {
+		entry := &connStateEntry{}
+		entry.lastSeen.Store(clock.Now().Unix())
+		r.setConnState(connStateKey{remoteIP: remote, protocol: 6, remotePort: 443}, entry)
+	}
+	idle := netip.MustParseAddr("fd00::a")
+	active := netip.MustParseAddr("fd00::b")
+	addConn(idle)
+	clock.Advance(10 * time.Minute)
+	addConn(active)
+
+	assert.Equal(t,
+		map[netip.Addr]struct{}{active: {}},
+		r.ActiveRemotes(clock.Now().Add(-5*time.Minute)),
+	)
+}
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+)
+
+// maxRoutingDecisions defines how many sampled routing decisions are kept.
+const maxRoutingDecisions = 100
+
+// RoutingDecision is a sampled decision of how a frame was routed.
+type RoutingDecision struct {
+	Time time.Time  `json:"time"`
+	Src  netip.Addr `json:"src"`
+	Dst  netip.Addr `json:"dst"`
+	// From is the peer the frame was received from. Empty for own frames.
+	From netip.Addr `json:"from,omitempty"`
+
+	// Reason is why the route was chosen.
+	Reason RoutingReason `json:"reason"`
+	// Route is the destination of the chosen routing table entry.
+	Route   netip.Addr `json:"route,omitempty"`
+	NextHop netip.Addr `json:"nextHop,omitempty"`
+	Source  string     `json:"source,omitempty"`
+	Hops    uint8      `json:"hops,omitempty"`
+	Delay   uint16     `json:"delay,omitempty"` // In milliseconds.
+	Stub    bool       `json:"stub,omitempty"`
+	Penalty uint16     `json:"penalty,omitempty"` // In milliseconds.
+	// Weight is the configured route preference weight of the next hop.
+	Weight int `json:"weight,omitempty"`
+	// Candidates is the amount of routes to the destination of the chosen
+	// entry. The best of them is used.
+	Candidates int `json:"candidates"`
+
+	// Err is set if the frame could not be forwarded.
+	Err string `json:"err,omitempty"`
+}
+
+// RoutingReason describes why a route was chosen.
+type RoutingReason string
+
+// Routing reasons.
+const (
+	// RoutingReasonLeaf is used when all frames are sent to the only peer.
+	RoutingReasonLeaf RoutingReason = "leaf"
+	// RoutingReasonDestination is used when there is a route to the destination.
+	RoutingReasonDestination RoutingReason = "destination"
+	// RoutingReasonNearest is used when the route to the router nearest to
+	// the destination is used.
+	RoutingReasonNearest RoutingReason = "nearest"
+	// RoutingReasonNearestNonStub is used when the nearest router is a stub
+	// and the route to the nearest router that is not a stub is used.
+	RoutingReasonNearestNonStub RoutingReason = "nearest-non-stub"
+	// RoutingReasonNoRoute is used when the routing table is empty.
+	RoutingReasonNoRoute RoutingReason = "no-route"
+)
+
+// sampleRoutingDecision returns whether the current routing decision should
+// be recorded.
+func (r *Router) sampleRoutingDecision() bool {
+	sampling := r.instance.Config().RoutingDecisionSampling
+	if sampling <= 0 {
+		return false
+	}
+	return r.routingDecisionCnt.Add(1)%uint64(sampling) == 0
+}
+
+// newRoutingDecision creates a routing decision for the given frame and
+// chosen route. It must be called before the frame is forwarded.
+func (r *Router) newRoutingDecision(f frame.Frame, rte *m.RoutingTableEntry, isDestination bool) *RoutingDecision {
+	decision := &RoutingDecision{
+		Time: r.clock.Now(),
+		Src:  f.SrcIP(),
+		Dst:  f.DstIP(),
+	}
+	if f.RecvLink() != nil {
+		decision.From = f.RecvLink().Peer()
+	}
+	r.describeRoute(decision, rte, isDestination)
+	return decision
+}
+
+// describeRoute adds the chosen route and the reason for it to the decision.
+func (r *Router) describeRoute(decision *RoutingDecision, rte *m.RoutingTableEntry, isDestination bool) {
+	switch {
+	case rte == nil:
+		decision.Reason = RoutingReasonNoRoute
+		return
+	case isDestination:
+		decision.Reason = RoutingReasonDestination
+	default:
+		decision.Reason = RoutingReasonNearest
+		if nearest, _ := r.table.LookupNearest(decision.Dst); nearest != nil && nearest.DstIP != rte.DstIP {
+			decision.Reason = RoutingReasonNearestNonStub
+		}
+	}
+	decision.Route = rte.DstIP
+	decision.NextHop = rte.NextHop
+	decision.Source = rte.Source.String()
+	decision.Hops = rte.Path.TotalHops
+	decision.Delay = rte.Path.TotalDelay
+	decision.Stub = rte.Stub
+	decision.Penalty = rte.DelayPenalty
+	if rte.NextHop != rte.DstIP {
+		decision.Weight = r.instance.Config().GetPeerWeight(rte.NextHop)
+	}
+	decision.Candidates = r.table.CountRoutes(rte.DstIP)
+}
+
+// recordRoutingDecision records the given routing decision and the error of
+// forwarding the frame.
+func (r *Router) recordRoutingDecision(decision *RoutingDecision, err error) {
+	if err != nil {
+		decision.Err = err.Error()
+	}
+
+	r.routingDecisionsLock.Lock()
+	defer r.routingDecisionsLock.Unlock()
+
+	if len(r.routingDecisions) < maxRoutingDecisions {
+		r.routingDecisions = append(r.routingDecisions, *decision)
+		return
+	}
+	r.routingDecisions[r.routingDecisionsNext] = *decision
+	r.routingDecisionsNext = (r.routingDecisionsNext + 1) % maxRoutingDecisions
+}
+
+// RoutingDecisions returns the recorded routing decisions, newest first.
+func (r *Router) RoutingDecisions() []RoutingDecision {
+	r.routingDecisionsLock.Lock()
+	defer r.routingDecisionsLock.Unlock()
+
+	decisions := make([]RoutingDecision, 0, len(r.routingDecisions))
+	for i := range r.routingDecisions {
+		index := (r.routingDecisionsNext - 1 - i + 2*len(r.routingDecisions)) % len(r.routingDecisions)
+		decisions = append(decisions, r.routingDecisions[index])
+	}
+	return decisions
+}
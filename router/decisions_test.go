@@ -0,0 +1,88 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestRoutingDecisions(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	self := netip.MustParseAddr("fd00::1")
+	r := &Router{
+		clock: clock,
+		table: m.NewRoutingTable(m.RoutingTableConfig{
+			RoutablePrefixes: m.GetRoutablePrefixesFor(self, netip.Prefix{}),
+			RouterIP:         self,
+			Clock:            clock,
+		}),
+		instance: &deniedTestInstance{
+			config: config.MakeTestConfig(config.Store{
+				Router: config.Router{RoutingDecisionSampling: 3},
+			}),
+		},
+	}
+
+	// Only every third decision must be sampled.
+	var sampled int
+	for range 9 {
+		if r.sampleRoutingDecision() {
+			sampled++
+		}
+	}
+	assert.Equal(t, 3, sampled)
+
+	// Describe routes.
+	nextHop := netip.MustParseAddr("fd00::2")
+	dst := netip.MustParseAddr("fd00::a")
+	for delay, nextHop := range map[uint16]netip.Addr{10: nextHop, 20: netip.MustParseAddr("fd00::3")} {
+		added, err := r.table.AddRoute(m.RoutingTableEntry{
+			DstIP:   dst,
+			NextHop: nextHop,
+			Path: m.SwitchPath{Hops: []m.SwitchHop{
+				{Router: self, Delay: delay, ForwardLabel: 1},
+				{Router: nextHop, Delay: delay, ForwardLabel: 2, ReturnLabel: 1},
+				{Router: dst, ReturnLabel: 2},
+			}},
+			Source:  m.RouteSourceDiscovered,
+			Expires: clock.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+	rte, isDestination := r.table.LookupNearestRoute(dst)
+	decision := &RoutingDecision{Dst: dst}
+	r.describeRoute(decision, rte, isDestination)
+	assert.Equal(t, RoutingReasonDestination, decision.Reason)
+	assert.Equal(t, nextHop, decision.NextHop)
+	assert.Equal(t, "discovered", decision.Source)
+	assert.Equal(t, 2, decision.Candidates)
+
+	nearby := netip.MustParseAddr("fd00::b")
+	rte, isDestination = r.table.LookupNearestRoute(nearby)
+	decision = &RoutingDecision{Dst: nearby}
+	r.describeRoute(decision, rte, isDestination)
+	assert.Equal(t, RoutingReasonNearest, decision.Reason)
+	assert.Equal(t, dst, decision.Route)
+
+	decision = &RoutingDecision{Dst: nearby}
+	r.describeRoute(decision, nil, false)
+	assert.Equal(t, RoutingReasonNoRoute, decision.Reason)
+
+	// Only the newest decisions must be kept, newest first.
+	for i := range maxRoutingDecisions + 10 {
+		r.recordRoutingDecision(&RoutingDecision{Hops: uint8(i)}, nil)
+	}
+	decisions := r.RoutingDecisions()
+	require.Len(t, decisions, maxRoutingDecisions)
+	assert.Equal(t, uint8(maxRoutingDecisions+9), decisions[0].Hops)
+	assert.Equal(t, uint8(10), decisions[maxRoutingDecisions-1].Hops)
+}
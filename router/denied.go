@@ -0,0 +1,165 @@
+package router
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// deniedNotifyThreshold defines after how many denied attempts within the
+	// window the operator is notified.
+	deniedNotifyThreshold = 5
+	// deniedWindow defines the time window in which denied attempts are
+	// aggregated.
+	deniedWindow = 1 * time.Hour
+	// maxDeniedAttempts limits the amount of aggregated denied attempts.
+	maxDeniedAttempts = 1000
+	// maxDeniedRouters limits the amount of routers counted per aggregation.
+	maxDeniedRouters = 1000
+)
+
+// EventDenied is emitted when access to a service is denied repeatedly.
+type EventDenied struct {
+	Service  string
+	Country  string
+	Attempts int
+	Routers  int
+	Since    time.Time
+}
+
+func newDeniedEventMgr() *mgr.EventMgr[*EventDenied] {
+	return mgr.NewEventMgr[*EventDenied]("denied attempts", nil)
+}
+
+type deniedKey struct {
+	service string
+	country string
+}
+
+// DeniedAttempts holds the denied attempts to access a service from routers
+// of a country within the current window. Remote routers are only counted,
+// so that repeated attempts become visible without tracking who made them.
+type DeniedAttempts struct {
+	Service string `json:"service"`
+	// Country is the country code of the geo marker of the remote routers.
+	// It is empty for privacy addresses.
+	Country string `json:"country,omitempty"`
+
+	Attempts  int       `json:"attempts"`
+	Routers   int       `json:"routers"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+
+	// Notified is set when the attempts reached the notification threshold.
+	Notified bool `json:"notified,omitempty"`
+}
+
+type deniedTracker struct {
+	DeniedAttempts
+	routers map[netip.Addr]struct{}
+}
+
+// recordDeniedAttempt records a denied inbound connection, if the service
+// that was denied access to has notifications enabled.
+func (r *Router) recordDeniedAttempt(w *mgr.WorkerCtx, connKey connStateKey) {
+	svc, ok := r.instance.Config().GetServiceByPolicy(connKey.protocol, connKey.localPort)
+	if !ok || !svc.NotifyDenied {
+		return
+	}
+	key := deniedKey{
+		service: svc.Name,
+	}
+	if marker, err := m.LookupCountryMarker(connKey.remoteIP); err == nil {
+		key.country = marker.Country
+	}
+
+	r.deniedLock.Lock()
+	defer r.deniedLock.Unlock()
+
+	// Get or create tracker.
+	now := r.clock.Now()
+	tracker, ok := r.denied[key]
+	if !ok || now.Sub(tracker.FirstSeen) > deniedWindow {
+		if !ok && len(r.denied) >= maxDeniedAttempts {
+			return
+		}
+		tracker = &deniedTracker{
+			DeniedAttempts: DeniedAttempts{
+				Service:   key.service,
+				Country:   key.country,
+				FirstSeen: now,
+			},
+			routers: make(map[netip.Addr]struct{}),
+		}
+		r.denied[key] = tracker
+	}
+
+	// Count attempt.
+	tracker.Attempts++
+	tracker.LastSeen = now
+	if len(tracker.routers) < maxDeniedRouters {
+		tracker.routers[connKey.remoteIP] = struct{}{}
+	}
+	tracker.Routers = len(tracker.routers)
+
+	// Notify once per window.
+	if tracker.Notified || tracker.Attempts < deniedNotifyThreshold {
+		return
+	}
+	tracker.Notified = true
+	w.Info(
+		"repeated denied access attempts to service",
+		"service", tracker.Service,
+		"country", tracker.Country,
+		"attempts", tracker.Attempts,
+		"routers", tracker.Routers,
+	)
+	if r.DeniedEvents != nil {
+		r.DeniedEvents.Submit(&EventDenied{
+			Service:  tracker.Service,
+			Country:  tracker.Country,
+			Attempts: tracker.Attempts,
+			Routers:  tracker.Routers,
+			Since:    tracker.FirstSeen,
+		})
+	}
+}
+
+// ExportDeniedAttempts returns the denied attempts of the current windows,
+// with the most attempts first.
+func (r *Router) ExportDeniedAttempts() []DeniedAttempts {
+	r.deniedLock.Lock()
+	defer r.deniedLock.Unlock()
+
+	export := make([]DeniedAttempts, 0, len(r.denied))
+	for _, tracker := range r.denied {
+		export = append(export, tracker.DeniedAttempts)
+	}
+
+	// Sort.
+	slices.SortFunc(export, func(a, b DeniedAttempts) int {
+		if diff := b.Attempts - a.Attempts; diff != 0 {
+			return diff
+		}
+		return -a.LastSeen.Compare(b.LastSeen) // Newer first.
+	})
+
+	return export
+}
+
+func (r *Router) cleanDeniedAttempts() {
+	threshold := r.clock.Now().Add(-deniedWindow)
+
+	r.deniedLock.Lock()
+	defer r.deniedLock.Unlock()
+
+	for key, tracker := range r.denied {
+		if tracker.FirstSeen.Before(threshold) {
+			delete(r.denied, key)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+type deniedTestInstance struct {
+	instance
+	config *config.Config
+}
+
+func (i *deniedTestInstance) Config() *config.Config { return i.config }
+
+func TestDeniedAttempts(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock:  clock,
+		denied: make(map[deniedKey]*deniedTracker),
+		instance: &deniedTestInstance{
+			config: config.MakeTestConfig(config.Store{
+				ServiceConfigs: []config.ServiceConfig{
+					{Name: "notify", URL: "tcp://:22", Friends: true, NotifyDenied: true},
+					{Name: "silent", URL: "tcp://:23", Friends: true},
+				},
+			}),
+		},
+	}
+	prefix, err := m.GetCountryPrefix("AT")
+	require.NoError(t, err)
+	remoteA := prefix.Addr().Next()
+	remoteB := remoteA.Next()
+
+	err = mgr.New("test").Do("test", func(w *mgr.WorkerCtx) error {
+		// Denied attempts to services without notifications are ignored.
+		r.recordDeniedAttempt(w, connStateKey{remoteIP: remoteA, protocol: 6, localPort: 23})
+		assert.Empty(t, r.ExportDeniedAttempts())
+
+		// Attempts are aggregated by country.
+		for i := range deniedNotifyThreshold - 1 {
+			remote := remoteA
+			if i%2 == 1 {
+				remote = remoteB
+			}
+			r.recordDeniedAttempt(w, connStateKey{remoteIP: remote, protocol: 6, localPort: 22})
+		}
+		denied := r.ExportDeniedAttempts()
+		require.Len(t, denied, 1)
+		assert.Equal(t, "notify", denied[0].Service)
+		assert.Equal(t, "AT", denied[0].Country)
+		assert.Equal(t, deniedNotifyThreshold-1, denied[0].Attempts)
+		assert.Equal(t, 2, denied[0].Routers)
+		assert.False(t, denied[0].Notified)
+
+		// Reaching the threshold notifies.
+		r.recordDeniedAttempt(w, connStateKey{remoteIP: remoteA, protocol: 6, localPort: 22})
+		assert.True(t, r.ExportDeniedAttempts()[0].Notified)
+
+		// Attempts are forgotten after the window.
+		clock.Advance(deniedWindow + time.Second)
+		r.cleanDeniedAttempts()
+		assert.Empty(t, r.ExportDeniedAttempts())
+		return nil
+	})
+	require.NoError(t, err)
+}
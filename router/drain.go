@@ -0,0 +1,45 @@
+package router
+
+import (
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/peering"
+)
+
+// Links outside of their peering schedule are drained before they are closed.
+// Traffic is diverted from draining links by removing the routes via them and
+// asking the peer to do the same, so that only traffic to the peer itself
+// remains on the link.
+
+func (r *Router) drainWorker(w *mgr.WorkerCtx) error {
+	// Subscribe to peering events.
+	sub := r.instance.Peering().PeeringEvents.Subscribe("drain links", 10)
+	defer sub.Cancel()
+
+	for {
+		select {
+		case event := <-sub.Events():
+			if event.State != peering.EventStateDraining {
+				continue
+			}
+
+			// Stop routing via the peer.
+			removed := r.table.RemoveTransit(event.Peer)
+			w.Info(
+				"removed routes via draining peer",
+				"router", event.Peer,
+				"removed", removed,
+			)
+
+			// Withdraw routes via this router from the peer.
+			if err := r.AnnouncePing.Send(event.Peer); err != nil {
+				w.Warn(
+					"failed to announce draining link",
+					"router", event.Peer,
+					"err", err,
+				)
+			}
+		case <-w.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestEventMgrsBeforeStart(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	r, err := New(&announceTestInstance{
+		config:   config.MakeTestConfig(config.Store{}),
+		identity: identity,
+		builder:  frame.NewFrameBuilder(),
+	}, Config{})
+	require.NoError(t, err)
+
+	// Event managers must exist before the router is started, eg. on a
+	// standby router, and must not be replaced on restart.
+	assert.NotNil(t, r.ScanEvents)
+	assert.NotNil(t, r.DeniedEvents)
+	assert.NotNil(t, r.ErrorEvents)
+	assert.NotNil(t, r.InboundEvents)
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"net/netip"
+	"time"
+)
+
+const (
+	// fragmentTimeout is how long the first fragment of a packet is remembered.
+	// This matches the reassembly timeout of RFC 8200.
+	fragmentTimeout = 60 * time.Second
+	// maxTrackedFragments limits the amount of tracked fragmented packets, so
+	// that floods of first fragments cannot exhaust memory.
+	maxTrackedFragments = 4096
+)
+
+// fragmentKey identifies a fragmented packet, as per RFC 8200.
+type fragmentKey struct {
+	src netip.Addr
+	dst netip.Addr
+	id  uint32
+}
+
+// trackedFragment holds the upper layer information of the first fragment of
+// a packet, which the following fragments do not contain.
+type trackedFragment struct {
+	protocol uint8
+	srcPort  uint16
+	dstPort  uint16
+	expires  time.Time
+}
+
+// trackFirstFragment remembers the ports of the given first fragment, after it
+// was allowed by the policy.
+func (r *Router) trackFirstFragment(src, dst netip.Addr, info packetInfo) {
+	if !info.fragmented || !info.firstFragment() || !info.moreFragments {
+		return
+	}
+
+	r.fragmentsLock.Lock()
+	defer r.fragmentsLock.Unlock()
+
+	key := fragmentKey{src: src, dst: dst, id: info.fragmentID}
+	if _, ok := r.fragments[key]; !ok && len(r.fragments) >= maxTrackedFragments {
+		return
+	}
+	r.fragments[key] = &trackedFragment{
+		protocol: info.protocol,
+		srcPort:  info.srcPort,
+		dstPort:  info.dstPort,
+		expires:  r.clock.Now().Add(fragmentTimeout),
+	}
+}
+
+// resolveFragment fills in the ports of a following fragment from its first
+// fragment. It returns false if the first fragment was not seen or not allowed,
+// in which case the fragment must be dropped, as it cannot be checked against
+// the policy.
+func (r *Router) resolveFragment(src, dst netip.Addr, info *packetInfo) bool {
+	if !info.fragmented || info.firstFragment() {
+		return true
+	}
+
+	r.fragmentsLock.Lock()
+	defer r.fragmentsLock.Unlock()
+
+	tracked, ok := r.fragments[fragmentKey{src: src, dst: dst, id: info.fragmentID}]
+	if !ok || tracked.protocol != info.protocol || r.clock.Now().After(tracked.expires) {
+		return false
+	}
+	info.srcPort = tracked.srcPort
+	info.dstPort = tracked.dstPort
+	return true
+}
+
+func (r *Router) cleanFragments() {
+	now := r.clock.Now()
+
+	r.fragmentsLock.Lock()
+	defer r.fragmentsLock.Unlock()
+
+	for key, tracked := range r.fragments {
+		if now.After(tracked.expires) {
+			delete(r.fragments, key)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestFragmentTracking(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock:     clock,
+		fragments: make(map[fragmentKey]*trackedFragment),
+	}
+	src := netip.MustParseAddr("fd12:3456::1")
+	dst := netip.MustParseAddr("fd12:3456::2")
+
+	first := packetInfo{
+		protocol:      17,
+		srcPort:       1234,
+		dstPort:       53,
+		fragmented:    true,
+		fragmentID:    7,
+		moreFragments: true,
+	}
+	following := packetInfo{
+		protocol:       17,
+		fragmented:     true,
+		fragmentOffset: 100,
+		fragmentID:     7,
+	}
+
+	// Unfragmented and first fragments always pass.
+	assert.True(t, r.resolveFragment(src, dst, &packetInfo{protocol: 17}))
+	assert.True(t, r.resolveFragment(src, dst, &first))
+
+	// Following fragments need a tracked first fragment.
+	info := following
+	assert.False(t, r.resolveFragment(src, dst, &info))
+	r.trackFirstFragment(src, dst, first)
+	assert.True(t, r.resolveFragment(src, dst, &info))
+	assert.Equal(t, uint16(1234), info.srcPort)
+	assert.Equal(t, uint16(53), info.dstPort)
+
+	// Other packets are not matched.
+	info = following
+	assert.False(t, r.resolveFragment(dst, src, &info), "reverse direction")
+	info.fragmentID = 8
+	assert.False(t, r.resolveFragment(src, dst, &info), "other fragment ID")
+	info = following
+	info.protocol = 6
+	assert.False(t, r.resolveFragment(src, dst, &info), "other protocol")
+
+	// Tracking expires.
+	clock.Advance(fragmentTimeout + time.Second)
+	info = following
+	assert.False(t, r.resolveFragment(src, dst, &info))
+	r.cleanFragments()
+	assert.Empty(t, r.fragments)
+
+	// Tracking is limited.
+	for i := range maxTrackedFragments + 10 {
+		first.fragmentID = uint32(i)
+		r.trackFirstFragment(src, dst, first)
+	}
+	assert.Len(t, r.fragments, maxTrackedFragments)
+}
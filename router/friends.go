@@ -0,0 +1,127 @@
+package router
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// reloadConfigInterval defines how often the config file is checked for
+// changed friends and peer weights.
+const reloadConfigInterval = 10 * time.Second
+
+// AddFriend adds a friend to the running config and makes sure that the
+// policies are re-evaluated for the new friend.
+func (r *Router) AddFriend(friend config.Friend) error {
+	if err := r.instance.Config().AddFriend(friend); err != nil {
+		return err
+	}
+	r.pinFriend(friend)
+	r.resetConnStates(friend.IP)
+	return nil
+}
+
+// RemoveFriend removes a friend from the running config and makes sure that
+// the policies are re-evaluated for the former friend.
+func (r *Router) RemoveFriend(name string) error {
+	friend, ok := r.instance.Config().GetFriendByName(name)
+	if err := r.instance.Config().RemoveFriend(name); err != nil {
+		return err
+	}
+	if ok {
+		r.resetConnStates(friend.IP)
+	}
+	return nil
+}
+
+// reloadConfigWorker applies changes to the friends, peer weights and stub
+// setting in the config file, so that they can be managed from the command
+// line without a restart.
+func (r *Router) reloadConfigWorker(w *mgr.WorkerCtx) error {
+	// Pin keys of configured friends.
+	for _, friend := range r.instance.Config().GetFriends() {
+		r.pinFriend(friend)
+	}
+
+	ticker := r.clock.NewTicker(reloadConfigInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			// Remember friends to reset their connection states after the reload.
+			before := r.instance.Config().GetFriends()
+
+			result, err := r.instance.Config().Reload()
+			if result.PeerWeightsChanged {
+				r.table.SetNextHopWeights(r.instance.Config().GetPeerWeights())
+				w.Info("reloaded peer weights from config")
+			}
+			if result.StubChanged {
+				r.triggerLeafCheck()
+				r.TriggerAnnounce()
+				w.Info(
+					"reloaded stub setting from config",
+					"stub", r.instance.Config().IsStub(),
+				)
+			}
+			if err != nil {
+				w.Warn(
+					"failed to reload config",
+					"err", err,
+				)
+				continue
+			}
+			if result.AddedFriends == 0 && result.RemovedFriends == 0 {
+				continue
+			}
+
+			for _, friend := range before {
+				r.resetConnStates(friend.IP)
+			}
+			for _, friend := range r.instance.Config().GetFriends() {
+				r.pinFriend(friend)
+				r.resetConnStates(friend.IP)
+			}
+			w.Info(
+				"reloaded friends from config",
+				"added", result.AddedFriends,
+				"removed", result.RemovedFriends,
+			)
+
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+// pinFriend adds the pinned address of the friend to the state, so that the
+// friend can be contacted before it is learned from the network.
+func (r *Router) pinFriend(friend config.Friend) {
+	if friend.Address == nil {
+		return
+	}
+	if err := r.instance.State().AddRouter(friend.Address); err != nil {
+		r.mgr.Warn(
+			"failed to pin friend address",
+			"friend", friend.Name,
+			"router", friend.IP,
+			"err", err,
+		)
+	}
+}
+
+// resetConnStates removes all connection states of the given remote IP, so
+// that the policy is re-evaluated.
+func (r *Router) resetConnStates(remoteIP netip.Addr) {
+	r.connStatesLock.Lock()
+	defer r.connStatesLock.Unlock()
+
+	for key := range r.connStates {
+		if key.remoteIP == remoteIP {
+			delete(r.connStates, key)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// implausiblePathPenalty is the delay in milliseconds that is added to
+	// routes with physically impossible delays between geo markers.
+	implausiblePathPenalty = 500
+	// implausiblePathLogInterval defines how often implausible paths to the
+	// same destination are logged.
+	implausiblePathLogInterval = 1 * time.Hour
+	// maxImplausiblePaths limits the amount of tracked implausible paths.
+	maxImplausiblePaths = 1000
+)
+
+// checkGeoDelays checks the path of a new route for delays that are too low
+// for the distance between the geo markers on the path. Such routes are
+// flagged and de-prioritized, as a router on the path most likely has a
+// misconfigured or spoofed geo marker.
+func (r *Router) checkGeoDelays(w *mgr.WorkerCtx, rte *m.RoutingTableEntry) {
+	implausible := rte.Path.CheckGeoDelays()
+	if implausible == nil {
+		return
+	}
+
+	rte.Implausible = true
+	rte.DelayPenalty = uint16(min(uint(rte.DelayPenalty)+implausiblePathPenalty, 65534))
+
+	// Log once per interval and destination.
+	r.implausiblePathsLock.Lock()
+	defer r.implausiblePathsLock.Unlock()
+
+	now := r.clock.Now()
+	if logged, ok := r.implausiblePaths[rte.DstIP]; ok && now.Sub(logged) < implausiblePathLogInterval {
+		return
+	}
+	if len(r.implausiblePaths) >= maxImplausiblePaths {
+		return
+	}
+	r.implausiblePaths[rte.DstIP] = now
+	w.Warn(
+		"route has implausible delay for geo markers, de-prioritizing",
+		"dst", rte.DstIP,
+		"nexthop", rte.NextHop,
+		"from", implausible.From,
+		"to", implausible.To,
+		"delay", implausible.Delay,
+		"minDelay", implausible.MinDelay,
+	)
+}
+
+func (r *Router) cleanImplausiblePaths() {
+	threshold := r.clock.Now().Add(-implausiblePathLogInterval)
+
+	r.implausiblePathsLock.Lock()
+	defer r.implausiblePathsLock.Unlock()
+
+	for dst, logged := range r.implausiblePaths {
+		if logged.Before(threshold) {
+			delete(r.implausiblePaths, dst)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/time/rate"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+)
+
+const (
+	// icmpErrorMaxBody is the maximum size of the invoking packet included in
+	// ICMP error messages, so that they do not exceed the minimum IPv6 MTU.
+	icmpErrorMaxBody = 1280 - ipv6.HeaderLen - 8
+)
+
+var errICMPRateLimited = errors.New("icmp rate limited")
+
+func newICMPRateLimiter() *rate.Limiter {
+	return rate.NewLimiter(m.ICMPRateLimit, m.ICMPRateBurst)
+}
+
+// mayRespondWithICMPError checks if an ICMP error may be sent in response to
+// the given packet. As per RFC 4443, Section 2.4 (e), no errors may be sent in
+// response to other ICMP errors or to multicast packets.
+func mayRespondWithICMPError(packetData []byte) bool {
+	if len(packetData) < ipv6.HeaderLen {
+		return false
+	}
+	info, err := parsePacketInfo(packetData)
+	switch {
+	case packetData[24] == 0xFF:
+		// Destination is multicast.
+		return false
+	case err != nil:
+		// Do not respond to packets we cannot parse.
+		return false
+	case info.protocol == 58 &&
+		(!info.hasUpperLayerData(packetData, 58) || packetData[info.offset] < 128):
+		// Packet is (or may be) an ICMP error message.
+		return false
+	default:
+		return true
+	}
+}
+
+// isEchoRequest returns whether the given packet is an ICMPv6 echo request.
+// Fragmented echo requests are not reassembled and are therefore not answered.
+func isEchoRequest(packetData []byte) bool {
+	info, err := parsePacketInfo(packetData)
+	return err == nil &&
+		!info.fragmented &&
+		info.hasUpperLayerData(packetData, 58) &&
+		packetData[info.offset] == byte(ipv6.ICMPTypeEchoRequest)
+}
+
+// replyToEchoRequest answers the given echo request on behalf of the router.
+// This is used when there is no tun device that could answer instead.
+func (r *Router) replyToEchoRequest(session *state.Session, packetData []byte) error {
+	// Check rate limit.
+	if !r.icmpLimiter.Allow() {
+		return errICMPRateLimited
+	}
+
+	// Parse request.
+	src := netip.AddrFrom16([16]byte(packetData[8:24]))
+	dst := netip.AddrFrom16([16]byte(packetData[24:40]))
+	info, err := parsePacketInfo(packetData)
+	if err != nil {
+		return fmt.Errorf("parse echo request: %w", err)
+	}
+	request, err := icmp.ParseMessage(58, packetData[info.offset:])
+	if err != nil {
+		return fmt.Errorf("parse echo request: %w", err)
+	}
+	echo, ok := request.Body.(*icmp.Echo)
+	if !ok {
+		return errors.New("invalid echo request")
+	}
+
+	// Build echo reply.
+	icmpData, err := (&icmp.Message{
+		Type: ipv6.ICMPTypeEchoReply,
+		Body: echo,
+	}).Marshal(icmp.IPv6PseudoHeader(dst.AsSlice(), src.AsSlice()))
+	if err != nil {
+		return fmt.Errorf("build echo reply: %w", err)
+	}
+	replyData := make([]byte, ipv6.HeaderLen+len(icmpData))
+	copy(replyData[ipv6.HeaderLen:], icmpData)
+	header := replyData[:ipv6.HeaderLen]
+	header[0] = 6 << 4 // IP Version
+	m.PutUint16(header[4:6], uint16(len(icmpData)))
+	header[6] = 58 // Next Header
+	header[7] = 64 // Hop Limit
+	copy(header[8:24], packetData[24:40])
+	copy(header[24:40], packetData[8:24])
+
+	// Make, seal and send frame.
+	f, err := r.instance.FrameBuilder().NewFrameV1(
+		dst, src,
+		frame.NetworkTraffic,
+		nil, replyData, nil,
+	)
+	if err != nil {
+		return fmt.Errorf("build frame: %w", err)
+	}
+	if err := f.Seal(session); err != nil {
+		f.ReturnToPool()
+		return fmt.Errorf("seal frame: %w", err)
+	}
+	if err := r.RouteFrame(f); err != nil {
+		f.ReturnToPool()
+		return fmt.Errorf("route frame: %w", err)
+	}
+
+	return nil
+}
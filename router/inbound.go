@@ -0,0 +1,51 @@
+package router
+
+import (
+	"net/netip"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// maxKnownInbound limits the amount of remembered routers that connected to
+// this router.
+const maxKnownInbound = 10_000
+
+// EventInbound is emitted when a router connects to this router for the
+// first time since start.
+type EventInbound struct {
+	Router netip.Addr
+	// Service is the name of the connected service, if it is one.
+	Service  string
+	Protocol uint8
+	Port     uint16
+}
+
+func newInboundEventMgr() *mgr.EventMgr[*EventInbound] {
+	return mgr.NewEventMgr[*EventInbound]("inbound connections", nil)
+}
+
+// recordInbound records an allowed inbound connection and emits an event, if
+// the remote router did not connect before.
+func (r *Router) recordInbound(connKey connStateKey) {
+	r.knownInboundLock.Lock()
+	_, known := r.knownInbound[connKey.remoteIP]
+	full := len(r.knownInbound) >= maxKnownInbound
+	if !known && !full {
+		r.knownInbound[connKey.remoteIP] = struct{}{}
+	}
+	r.knownInboundLock.Unlock()
+
+	// Do not emit events for untracked routers, as they would repeat.
+	if known || full || r.InboundEvents == nil {
+		return
+	}
+	event := &EventInbound{
+		Router:   connKey.remoteIP,
+		Protocol: connKey.protocol,
+		Port:     connKey.localPort,
+	}
+	if svc, ok := r.instance.Config().GetServiceByPolicy(connKey.protocol, connKey.localPort); ok {
+		event.Service = svc.Name
+	}
+	r.InboundEvents.Submit(event)
+}
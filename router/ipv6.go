@@ -0,0 +1,134 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/ipv6"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// IPv6 extension headers, see RFC 8200 and the IANA IPv6 Extension Header Types.
+const (
+	ipv6HopByHop    = 0
+	ipv6Routing     = 43
+	ipv6Fragment    = 44
+	ipv6AuthHeader  = 51
+	ipv6DestOptions = 60
+	ipv6Mobility    = 135
+	ipv6HIP         = 139
+	ipv6Shim6       = 140
+
+	// ipv6MaxExtHeaders limits how many extension headers are walked, so that
+	// crafted packets cannot make us walk long header chains.
+	ipv6MaxExtHeaders = 8
+)
+
+var errInvalidHeaderChain = errors.New("invalid IPv6 header chain")
+
+// packetInfo holds the transport layer information of an IPv6 packet.
+type packetInfo struct {
+	// protocol is the upper layer protocol after all extension headers.
+	protocol uint8
+	// offset is the offset of the upper layer header in the packet.
+	offset int
+
+	srcPort uint16
+	dstPort uint16
+	// tcpFlags holds the flags of TCP packets.
+	tcpFlags uint8
+
+	// fragmented is set if the packet has a fragment header.
+	fragmented     bool
+	fragmentOffset uint16
+	fragmentID     uint32
+	moreFragments  bool
+}
+
+// firstFragment returns whether the packet holds the start of the upper layer
+// data, which is the case for all unfragmented packets.
+func (info packetInfo) firstFragment() bool {
+	return info.fragmentOffset == 0
+}
+
+// parsePacketInfo walks the IPv6 extension header chain of the given packet
+// and returns the upper layer protocol and ports. Ports are only available for
+// TCP and UDP packets that contain the start of the upper layer data.
+func parsePacketInfo(packetData []byte) (info packetInfo, err error) {
+	if len(packetData) < ipv6.HeaderLen {
+		return info, fmt.Errorf("%w: packet too small", errInvalidHeaderChain)
+	}
+	nextHeader := packetData[6]
+	offset := ipv6.HeaderLen
+
+	for range ipv6MaxExtHeaders {
+		switch nextHeader {
+		case ipv6HopByHop, ipv6Routing, ipv6DestOptions, ipv6Mobility, ipv6HIP, ipv6Shim6:
+			// Length is in 8-octet units, not including the first 8 octets.
+			if len(packetData) < offset+8 {
+				return info, fmt.Errorf("%w: truncated extension header %d", errInvalidHeaderChain, nextHeader)
+			}
+			nextHeader, offset = packetData[offset], offset+8+int(packetData[offset+1])*8
+
+		case ipv6AuthHeader:
+			// Length is in 4-octet units, minus 2.
+			if len(packetData) < offset+8 {
+				return info, fmt.Errorf("%w: truncated authentication header", errInvalidHeaderChain)
+			}
+			nextHeader, offset = packetData[offset], offset+(int(packetData[offset+1])+2)*4
+
+		case ipv6Fragment:
+			// Fragment header has a fixed size of 8 octets.
+			if len(packetData) < offset+8 {
+				return info, fmt.Errorf("%w: truncated fragment header", errInvalidHeaderChain)
+			}
+			if info.fragmented {
+				return info, fmt.Errorf("%w: multiple fragment headers", errInvalidHeaderChain)
+			}
+			info.fragmented = true
+			info.fragmentOffset = m.GetUint16(packetData[offset+2:offset+4]) >> 3
+			info.moreFragments = packetData[offset+3]&0x01 != 0
+			info.fragmentID = m.GetUint32(packetData[offset+4 : offset+8])
+			nextHeader, offset = packetData[offset], offset+8
+
+			// Following fragments only hold data, no further headers.
+			if !info.firstFragment() {
+				info.protocol = nextHeader
+				info.offset = offset
+				return info, nil
+			}
+
+		default:
+			// Reached upper layer protocol or the end of the chain.
+			info.protocol = nextHeader
+			info.offset = offset
+			if offset > len(packetData) {
+				return info, fmt.Errorf("%w: extension headers exceed packet", errInvalidHeaderChain)
+			}
+
+			// Get ports from TCP and UDP.
+			if (nextHeader == 6 || nextHeader == 17) && info.firstFragment() {
+				if len(packetData) < offset+4 {
+					return info, fmt.Errorf("%w: truncated transport header", errInvalidHeaderChain)
+				}
+				info.srcPort = m.GetUint16(packetData[offset : offset+2])
+				info.dstPort = m.GetUint16(packetData[offset+2 : offset+4])
+			}
+			if nextHeader == 6 && info.firstFragment() && len(packetData) >= offset+14 {
+				info.tcpFlags = packetData[offset+13]
+			}
+			return info, nil
+		}
+	}
+
+	return info, fmt.Errorf("%w: more than %d extension headers", errInvalidHeaderChain, ipv6MaxExtHeaders)
+}
+
+// hasUpperLayerData returns whether the packet has data of the given protocol
+// at the parsed offset.
+func (info packetInfo) hasUpperLayerData(packetData []byte, protocol uint8) bool {
+	return info.protocol == protocol &&
+		info.firstFragment() &&
+		info.offset < len(packetData)
+}
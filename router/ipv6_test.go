@@ -0,0 +1,93 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv6"
+)
+
+func buildTestPacket(nextHeader uint8, extHeaders ...[]byte) []byte {
+	packet := make([]byte, ipv6.HeaderLen)
+	packet[0] = 6 << 4
+	packet[6] = nextHeader
+	for _, ext := range extHeaders {
+		packet = append(packet, ext...)
+	}
+	return packet
+}
+
+func TestParsePacketInfo(t *testing.T) {
+	t.Parallel()
+
+	udp := []byte{0x04, 0xD2, 0x00, 0x35, 0, 8, 0, 0} // 1234 -> 53
+
+	// Plain UDP.
+	info, err := parsePacketInfo(buildTestPacket(17, udp))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(17), info.protocol)
+	assert.Equal(t, ipv6.HeaderLen, info.offset)
+	assert.Equal(t, uint16(1234), info.srcPort)
+	assert.Equal(t, uint16(53), info.dstPort)
+
+	// Hop-by-hop (16 bytes), dest options (8 bytes), then UDP.
+	hopByHop := []byte{60, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	destOpts := []byte{17, 0, 0, 0, 0, 0, 0, 0}
+	info, err = parsePacketInfo(buildTestPacket(ipv6HopByHop, hopByHop, destOpts, udp))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(17), info.protocol)
+	assert.Equal(t, ipv6.HeaderLen+24, info.offset)
+	assert.Equal(t, uint16(1234), info.srcPort)
+	assert.Equal(t, uint16(53), info.dstPort)
+	assert.False(t, info.fragmented)
+
+	// First fragment of TCP.
+	tcp := []byte{0x1F, 0x90, 0x00, 0x50, 0, 0, 0, 0} // 8080 -> 80
+	firstFragment := []byte{6, 0, 0x00, 0x01, 0, 0, 0, 42}
+	info, err = parsePacketInfo(buildTestPacket(ipv6Routing, []byte{ipv6Fragment, 0, 0, 0, 0, 0, 0, 0}, firstFragment, tcp))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(6), info.protocol)
+	assert.True(t, info.fragmented)
+	assert.True(t, info.moreFragments)
+	assert.Equal(t, uint32(42), info.fragmentID)
+	assert.True(t, info.firstFragment())
+	assert.Equal(t, uint16(80), info.dstPort)
+
+	// Later fragment has no ports.
+	laterFragment := []byte{6, 0, 0x00, 0xA0, 0, 0, 0, 42} // Offset 20, last.
+	info, err = parsePacketInfo(buildTestPacket(ipv6Fragment, laterFragment, tcp))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(6), info.protocol)
+	assert.Equal(t, uint16(20), info.fragmentOffset)
+	assert.False(t, info.moreFragments)
+	assert.False(t, info.firstFragment())
+	assert.Zero(t, info.dstPort)
+
+	// Data of later fragments is not parsed as extension headers.
+	laterOptions := []byte{ipv6DestOptions, 0, 0x00, 0xA0, 0, 0, 0, 42}
+	info, err = parsePacketInfo(buildTestPacket(ipv6Fragment, laterOptions, []byte{17, 0xFF, 0, 0, 0, 0, 0, 0}))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(ipv6DestOptions), info.protocol)
+	assert.Equal(t, ipv6.HeaderLen+8, info.offset)
+	assert.False(t, info.firstFragment())
+
+	// Echo request behind extension header.
+	echo := buildTestPacket(ipv6DestOptions, []byte{58, 0, 0, 0, 0, 0, 0, 0}, []byte{byte(ipv6.ICMPTypeEchoRequest), 0, 0, 0})
+	assert.True(t, isEchoRequest(echo))
+	assert.True(t, mayRespondWithICMPError(echo))
+
+	// Invalid chains.
+	_, err = parsePacketInfo(buildTestPacket(ipv6HopByHop, []byte{17, 4, 0, 0, 0, 0, 0, 0}, udp))
+	require.ErrorIs(t, err, errInvalidHeaderChain, "header length exceeds packet")
+	_, err = parsePacketInfo(buildTestPacket(17, udp[:2]))
+	require.ErrorIs(t, err, errInvalidHeaderChain, "truncated udp header")
+	_, err = parsePacketInfo(buildTestPacket(ipv6Fragment, []byte{ipv6Fragment, 0, 0, 0, 0, 0, 0, 1}, []byte{17, 0, 0, 0, 0, 0, 0, 1}, udp))
+	require.ErrorIs(t, err, errInvalidHeaderChain, "multiple fragment headers")
+	loop := make([][]byte, ipv6MaxExtHeaders+1)
+	for i := range loop {
+		loop[i] = []byte{ipv6DestOptions, 0, 0, 0, 0, 0, 0, 0}
+	}
+	_, err = parsePacketInfo(buildTestPacket(ipv6DestOptions, loop...))
+	require.ErrorIs(t, err, errInvalidHeaderChain, "too many headers")
+}
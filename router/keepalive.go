@@ -41,18 +41,22 @@ func clockTimeSince(t time.Time) time.Duration {
 }
 
 func (r *Router) keepAlivePeers(w *mgr.WorkerCtx, fastCheck bool) {
-	for _, link := range r.instance.Peering().GetLinks() {
-		// Skip closing connections.
-		if link.IsClosing() {
-			continue
-		}
+	for _, peerLink := range r.instance.Peering().GetLinks() {
+		// Check members of link bonds individually, so that dead members are
+		// closed even if the other members keep the peer alive.
+		for _, link := range peering.LinkMembers(peerLink) {
+			// Skip closing connections.
+			if link.IsClosing() {
+				continue
+			}
 
-		// Keep alive peer.
-		r.keepAlivePeer(w, link, fastCheck)
+			// Keep alive peer.
+			r.keepAlivePeer(w, link, fastCheck)
 
-		// Check if worker is canceled.
-		if w.IsDone() {
-			return
+			// Check if worker is canceled.
+			if w.IsDone() {
+				return
+			}
 		}
 	}
 }
@@ -86,7 +90,7 @@ func (r *Router) keepAlivePeer(w *mgr.WorkerCtx, link peering.Link, fastCheck bo
 			}
 
 			// Link is down, close it.
-			link.Close(func() {
+			link.Close("keep-alive failed", func() {
 				w.Warn(
 					"link seems down, closing",
 					"router", link.Peer(),
@@ -97,7 +101,7 @@ func (r *Router) keepAlivePeer(w *mgr.WorkerCtx, link peering.Link, fastCheck bo
 		}
 
 		// Send keep-alive.
-		notify, pingID, err = r.PingPong.Send(link.Peer(), true, pingID)
+		notify, pingID, err = r.PingPong.SendOnLink(link, pingID)
 		if err != nil {
 			// Abort silently if the link is closing.
 			if link.IsClosing() {
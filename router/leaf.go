@@ -0,0 +1,76 @@
+package router
+
+import (
+	"net/netip"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// Leaf routers are stub routers with a single peer. As all traffic has to go
+// through that peer anyway, they do not keep any routes learned from gossip
+// and instead send everything to their peer, without looking up the routing
+// table or discovering routes. The router info of other routers is still
+// learned from announcements.
+
+// leafPeer returns the only peer of the router, if it is a leaf router.
+func (r *Router) leafPeer() (peer netip.Addr, ok bool) {
+	if leaf := r.leaf.Load(); leaf != nil {
+		return *leaf, true
+	}
+	return netip.Addr{}, false
+}
+
+// updateLeafPeer checks whether the router is a leaf router and updates the
+// cached peer. Returns the peer, if it is a leaf router.
+func (r *Router) updateLeafPeer() (peer netip.Addr, ok bool) {
+	if !r.instance.Config().IsStub() {
+		r.leaf.Store(nil)
+		return netip.Addr{}, false
+	}
+
+	links := r.instance.Peering().GetLinks()
+	if len(links) != 1 {
+		r.leaf.Store(nil)
+		return netip.Addr{}, false
+	}
+	peer = links[0].Peer()
+	r.leaf.Store(&peer)
+	return peer, true
+}
+
+// triggerLeafCheck triggers checking whether the router is a leaf router,
+// eg. after the stub setting changed.
+func (r *Router) triggerLeafCheck() {
+	select {
+	case r.triggerLeaf <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Router) leafWorker(w *mgr.WorkerCtx) error {
+	// Subscribe to peering events.
+	sub := r.instance.Peering().PeeringEvents.Subscribe("leaf routing", 10)
+	defer sub.Cancel()
+
+	for {
+		// Drop all gossip routes when becoming a leaf router.
+		if peer, ok := r.updateLeafPeer(); ok {
+			removed := r.table.RemoveSource(m.RouteSourceGossip)
+			if removed > 0 {
+				w.Info(
+					"became leaf router, sending everything to peer",
+					"router", peer,
+					"removed", removed,
+				)
+			}
+		}
+
+		select {
+		case <-sub.Events():
+		case <-r.triggerLeaf:
+		case <-w.Done():
+			return nil
+		}
+	}
+}
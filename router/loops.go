@@ -0,0 +1,276 @@
+package router
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// loopStatsTTL defines how long loop statistics are kept after the last
+	// expired frame.
+	loopStatsTTL = 1 * time.Hour
+	// maxLoopStats limits the amount of destinations loop statistics are kept
+	// for, as destinations are chosen by the senders of frames.
+	maxLoopStats = 1000
+
+	// loopProbeInterval defines how often suspected loops are probed.
+	loopProbeInterval = 1 * time.Minute
+	// loopProbeSettle defines how long to wait after a topology change before
+	// probing suspected loops.
+	loopProbeSettle = 10 * time.Second
+	// loopProbeTimeout defines how long to wait for the response to a probe.
+	loopProbeTimeout = 5 * time.Second
+	// loopSuspicionWindow defines how recently frames must have expired for a
+	// destination to be probed.
+	loopSuspicionWindow = 5 * time.Minute
+	// maxLoopProbes limits the amount of probes per run.
+	maxLoopProbes = 10
+)
+
+// LoopStat holds routing loop suspicion statistics for a destination.
+// Frames only expire when they are relayed more often than their TTL allows,
+// which almost always means that they are caught in a routing loop.
+type LoopStat struct {
+	Dst netip.Addr `json:"dst"`
+
+	// Expired counts frames to the destination that were dropped by this
+	// router, because their TTL expired.
+	Expired uint64 `json:"expired,omitempty"`
+	// Reported counts TTL expiry notifications received from other routers
+	// for frames sent by this router to the destination.
+	Reported uint64 `json:"reported,omitempty"`
+	// LastReporter is the router that last reported an expired frame.
+	LastReporter netip.Addr `json:"lastReporter,omitempty"`
+
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+
+	// LastProbe is when the route to the destination was last probed.
+	LastProbe time.Time `json:"lastProbe,omitempty"`
+	// Looping is set when the last probe confirmed a routing loop.
+	Looping bool `json:"looping,omitempty"`
+}
+
+// handleTTLExpired is called by the switch for every frame that is dropped
+// because its TTL expired.
+func (r *Router) handleTTLExpired(f frame.Frame) {
+	r.recordLoopSuspicion(f.DstIP(), netip.Addr{})
+
+	// Notify the source, if enabled.
+	// Do not notify ourselves or unroutable sources.
+	src := f.SrcIP()
+	if !r.instance.Config().Router.TTLExpiryNotifications ||
+		src == r.instance.Identity().IP ||
+		!m.RoutingAddressPrefix.Contains(src) {
+		return
+	}
+	if err := r.ErrorPing.SendTTLExpired(src, f.DstIP()); err != nil {
+		r.mgr.Debug(
+			"failed to send TTL expired error",
+			"router", src,
+			"dst", f.DstIP(),
+			"err", err,
+		)
+	}
+}
+
+// recordLoopSuspicion records an expired frame to the given destination.
+// If the reporter is valid, the frame was reported by another router.
+func (r *Router) recordLoopSuspicion(dst, reporter netip.Addr) {
+	r.loopStatsLock.Lock()
+	defer r.loopStatsLock.Unlock()
+
+	now := r.clock.Now()
+	stat, ok := r.loopStats[dst]
+	if !ok {
+		if len(r.loopStats) >= maxLoopStats {
+			return
+		}
+		stat = &LoopStat{
+			Dst:       dst,
+			FirstSeen: now,
+		}
+		r.loopStats[dst] = stat
+	}
+
+	if reporter.IsValid() {
+		stat.Reported++
+		stat.LastReporter = reporter
+	} else {
+		stat.Expired++
+	}
+	stat.LastSeen = now
+}
+
+// LoopStats returns the routing loop suspicion statistics of all
+// destinations, with the most expired frames first.
+func (r *Router) LoopStats() []LoopStat {
+	r.loopStatsLock.Lock()
+	defer r.loopStatsLock.Unlock()
+
+	stats := make([]LoopStat, 0, len(r.loopStats))
+	for _, stat := range r.loopStats {
+		stats = append(stats, *stat)
+	}
+	slices.SortFunc(stats, func(a, b LoopStat) int {
+		if c := cmp.Compare(b.Expired+b.Reported, a.Expired+a.Reported); c != 0 {
+			return c
+		}
+		return a.Dst.Compare(b.Dst)
+	})
+	return stats
+}
+
+// loopCount returns the amount of expired frames to the given destination.
+func (r *Router) loopCount(dst netip.Addr) uint64 {
+	r.loopStatsLock.Lock()
+	defer r.loopStatsLock.Unlock()
+
+	stat, ok := r.loopStats[dst]
+	if !ok {
+		return 0
+	}
+	return stat.Expired + stat.Reported
+}
+
+// setLoopProbeResult records the result of a loop probe.
+func (r *Router) setLoopProbeResult(dst netip.Addr, looping bool) {
+	r.loopStatsLock.Lock()
+	defer r.loopStatsLock.Unlock()
+
+	if stat, ok := r.loopStats[dst]; ok {
+		stat.LastProbe = r.clock.Now()
+		stat.Looping = looping
+	}
+}
+
+// loopProbeWorker probes the routes to destinations with recently expired
+// frames, regularly and after topology changes. Routes that are confirmed to
+// loop are removed, so that the next best route is used.
+func (r *Router) loopProbeWorker(w *mgr.WorkerCtx) error {
+	// Subscribe to peering events.
+	sub := r.instance.Peering().PeeringEvents.Subscribe("loop probes", 10)
+	defer sub.Cancel()
+
+	ticker := r.clock.NewTicker(loopProbeInterval)
+	defer ticker.Stop()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-sub.Events():
+			// Wait for the topology to settle before probing.
+			if settled == nil {
+				settled = r.clock.After(loopProbeSettle)
+			}
+		case <-settled:
+			settled = nil
+			r.probeSuspectedLoops(w)
+		case <-ticker.C():
+			r.probeSuspectedLoops(w)
+		case <-w.Done():
+			return nil
+		}
+	}
+}
+
+// probeSuspectedLoops probes the routes to destinations with frames that
+// expired since the last probe.
+func (r *Router) probeSuspectedLoops(w *mgr.WorkerCtx) {
+	since := r.clock.Now().Add(-loopSuspicionWindow)
+
+	var probed int
+	for _, stat := range r.LoopStats() {
+		switch {
+		case probed >= maxLoopProbes:
+			return
+		case stat.LastSeen.Before(since):
+			// No recent expired frames.
+			continue
+		case stat.LastProbe.After(stat.LastSeen):
+			// Already probed after the last expired frame.
+			continue
+		}
+
+		probed++
+		if !r.probeLoop(w, stat.Dst) {
+			return
+		}
+	}
+}
+
+// probeLoop sends a ping to the destination via the routing table.
+// If it is not answered, but frames to the destination expired in the
+// meantime, the route is looping and is removed.
+// Returns false if the worker is done.
+func (r *Router) probeLoop(w *mgr.WorkerCtx, dst netip.Addr) (ok bool) {
+	// Get route that is currently used.
+	rte, _ := r.table.LookupNearestRoute(dst)
+	switch {
+	case rte == nil:
+		return true
+	case rte.Source == m.RouteSourcePeer && rte.DstIP == dst:
+		// Frames to peers cannot loop.
+		r.setLoopProbeResult(dst, false)
+		return true
+	}
+	routeDst, nextHop := rte.DstIP, rte.NextHop
+
+	// Send probe.
+	before := r.loopCount(dst)
+	notify, _, err := r.PingPong.Send(dst, false, 0)
+	if err != nil {
+		w.Debug(
+			"failed to send loop probe",
+			"dst", dst,
+			"err", err,
+		)
+		return true
+	}
+
+	// Wait for response.
+	var looping bool
+	select {
+	case <-notify:
+	case <-r.clock.After(loopProbeTimeout):
+		looping = r.loopCount(dst) > before
+	case <-w.Done():
+		return false
+	}
+	r.setLoopProbeResult(dst, looping)
+	if !looping {
+		return true
+	}
+
+	// Remove looping route.
+	removed := r.table.RemoveRoute(routeDst, nextHop)
+	w.Warn(
+		"routing loop detected, removed route",
+		"dst", dst,
+		"route", routeDst,
+		"nexthop", nextHop,
+		"removed", removed,
+	)
+	return true
+}
+
+// cleanLoopStats removes loop statistics of destinations that have not seen
+// any expired frames for a while.
+func (r *Router) cleanLoopStats() {
+	threshold := r.clock.Now().Add(-loopStatsTTL)
+
+	r.loopStatsLock.Lock()
+	defer r.loopStatsLock.Unlock()
+
+	for dst, stat := range r.loopStats {
+		if stat.LastSeen.Before(threshold) {
+			delete(r.loopStats, dst)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestLoopStats(t *testing.T) {
+	t.Parallel()
+
+	r := &Router{
+		clock:     m.SystemClock,
+		loopStats: make(map[netip.Addr]*LoopStat),
+	}
+	dstA := netip.MustParseAddr("fd00::a")
+	dstB := netip.MustParseAddr("fd00::b")
+	reporter := netip.MustParseAddr("fd00::1")
+
+	r.recordLoopSuspicion(dstA, netip.Addr{})
+	r.recordLoopSuspicion(dstB, netip.Addr{})
+	r.recordLoopSuspicion(dstB, reporter)
+
+	// Destinations with most expired frames come first.
+	stats := r.LoopStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, dstB, stats[0].Dst)
+	assert.Equal(t, uint64(1), stats[0].Expired)
+	assert.Equal(t, uint64(1), stats[0].Reported)
+	assert.Equal(t, reporter, stats[0].LastReporter)
+	assert.Equal(t, dstA, stats[1].Dst)
+
+	// Recent stats must survive cleaning.
+	r.cleanLoopStats()
+	assert.Len(t, r.LoopStats(), 2)
+
+	// New destinations must be ignored when the limit is reached.
+	for i := range maxLoopStats {
+		r.recordLoopSuspicion(netip.AddrFrom16([16]byte{0xfd, 1, 14: byte(i >> 8), 15: byte(i)}), netip.Addr{})
+	}
+	assert.Len(t, r.LoopStats(), maxLoopStats)
+}
@@ -0,0 +1,177 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+const (
+	// nameQueryRegionRouters defines how many routers in the region of a
+	// domain are asked.
+	nameQueryRegionRouters = 3
+	// maxNameQueryFriends limits how many friends are asked.
+	maxNameQueryFriends = 8
+	// minUnverifiedNameAnswers defines how many routers must agree on an
+	// answer that cannot be verified with the router info of the claimed
+	// router. Answers of friends are trusted on their own.
+	minUnverifiedNameAnswers = 2
+)
+
+// Names of public services are only known to routers that received the
+// announcement of the advertising router, which are usually in the same
+// region. In order to resolve names beyond that, routers in the region of the
+// domain and friends are asked for the router the domain belongs to.
+
+// NamePrefix returns the prefix of the region the given domain belongs to.
+// The region is taken from the last label before the TLD, if it is a country
+// code, eg. "wiki.de.myco" or "shop.us-ca.myco".
+func NamePrefix(domain string) (netip.Prefix, bool) {
+	name, ok := strings.CutSuffix(domain, config.DefaultDotTLD)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return netip.Prefix{}, false
+	}
+	prefix, err := m.GetCountryPrefix(strings.ToUpper(labels[len(labels)-1]))
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
+
+// LookupName looks up the router the given domain belongs to over the mesh.
+// Routers in the region of the domain and friends are asked at the same time.
+// Answers are checked against the router info of the claimed router, if it is
+// known. An answer confirmed by it is preferred. Otherwise, all answers must
+// agree and come from a friend or from multiple routers.
+func (r *Router) LookupName(ctx context.Context, domain string) (*NameAnswer, error) {
+	// Check what we know ourselves first.
+	router, err := r.NameQuery.lookupLocal(domain)
+	switch {
+	case err == nil:
+		return &NameAnswer{
+			Domain:   domain,
+			Router:   router,
+			Answerer: r.instance.Identity().PublicAddress,
+			Time:     r.clock.Now(),
+		}, nil
+	case !errors.Is(err, ErrNameNotFound):
+		return nil, err
+	}
+
+	targets := r.nameQueryTargets(domain)
+	if len(targets) == 0 {
+		return nil, ErrNameNotFound
+	}
+
+	// Ask all targets at the same time.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		answer *NameAnswer
+		err    error
+	}
+	results := make(chan result, len(targets))
+	for _, target := range targets {
+		go func() {
+			answer, err := r.NameQuery.Query(ctx, domain, target)
+			results <- result{answer: answer, err: err}
+		}()
+	}
+
+	var answers []*NameAnswer
+	for range targets {
+		res := <-results
+		if res.err != nil {
+			continue
+		}
+		advertises, known := r.NameQuery.Advertises(res.answer.Router, domain)
+		switch {
+		case advertises:
+			// The claimed router advertises the domain itself.
+			return res.answer, nil
+		case known:
+			// The claimed router does not advertise the domain.
+			continue
+		}
+		answers = append(answers, res.answer)
+	}
+
+	// Without a confirmed answer, all answers must agree.
+	if len(answers) == 0 {
+		return nil, ErrNameNotFound
+	}
+	var fromFriend bool
+	for _, answer := range answers {
+		if answer.Router != answers[0].Router {
+			return nil, ErrNameConflict
+		}
+		if _, ok := r.instance.Config().GetFriendByIP(answer.Answerer.IP); ok {
+			fromFriend = true
+		}
+	}
+	if !fromFriend && len(answers) < minUnverifiedNameAnswers {
+		return nil, ErrNameNotFound
+	}
+	return answers[0], nil
+}
+
+// nameQueryTargets returns the routers to ask for the given domain: The known
+// routers nearest to the region of the domain and friends.
+func (r *Router) nameQueryTargets(domain string) []netip.Addr {
+	self := r.instance.Identity().IP
+	seen := make(map[netip.Addr]struct{})
+	var targets []netip.Addr
+	add := func(ip netip.Addr) bool {
+		if _, ok := seen[ip]; ok || ip == self || r.lacksCapability(ip, m.CapNameQuery) {
+			return false
+		}
+		seen[ip] = struct{}{}
+		targets = append(targets, ip)
+		return true
+	}
+
+	// Add routers in the region of the domain.
+	if prefix, ok := NamePrefix(domain); ok {
+		// Start with the nearest entry, as it is not included in the
+		// possible paths.
+		var entries []*m.RoutingTableEntry
+		if nearest, _ := r.table.LookupNearest(prefix.Addr()); nearest != nil {
+			entries = append(entries, nearest)
+		}
+		entries = append(entries, r.table.LookupPossiblePaths(
+			prefix.Addr(), nameQueryRegionRouters*m.DefaultRoutesPerDestination,
+			m.AddrDistance{}, false, nil,
+		)...)
+
+		var added int
+		for _, rte := range entries {
+			if prefix.Contains(rte.DstIP) && add(rte.DstIP) {
+				added++
+				if added >= nameQueryRegionRouters {
+					break
+				}
+			}
+		}
+	}
+
+	// Add friends.
+	var added int
+	for _, friend := range r.instance.Config().GetFriends() {
+		if added >= maxNameQueryFriends {
+			break
+		}
+		if add(friend.IP) {
+			added++
+		}
+	}
+
+	return targets
+}
@@ -0,0 +1,213 @@
+package router
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	maxOutboundPrompts = 100
+	// outboundTimeoutDecisionTTL defines how long the decision taken on a
+	// prompt timeout is kept, before asking again.
+	outboundTimeoutDecisionTTL = 1 * time.Hour
+)
+
+// ErrOutboundPromptNotFound is returned when an outbound prompt does not exist.
+var ErrOutboundPromptNotFound = errors.New("outbound prompt not found")
+
+// OutboundPrompt is a new outgoing connection to a router that waits for a
+// decision by the user.
+type OutboundPrompt struct {
+	Router netip.Addr `json:"router"`
+	// Protocol and Port are taken from the first connection.
+	Protocol uint8  `json:"protocol"`
+	Port     uint16 `json:"port"`
+
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// Connections is the amount of held connections.
+	Connections int `json:"connections"`
+
+	// Expires defines when the timeout action is taken.
+	Expires time.Time `json:"expires"`
+	// TimedOut is set when the timeout action was taken. The prompt stays
+	// until it is asked again, so that the decision can still be changed.
+	TimedOut bool `json:"timedOut,omitempty"`
+}
+
+type outboundDecision struct {
+	allowed bool
+	// expires is zero for decisions by the user.
+	expires time.Time
+}
+
+// outboundDecision returns the decision on outgoing connections to dst, if any.
+func (r *Router) outboundDecision(dst netip.Addr) (allowed, decided bool) {
+	r.outboundPromptsLock.Lock()
+	defer r.outboundPromptsLock.Unlock()
+
+	decision, ok := r.outboundDecisions[dst]
+	if !ok || (!decision.expires.IsZero() && r.clock.Now().After(decision.expires)) {
+		return false, false
+	}
+	return decision.allowed, true
+}
+
+// recordOutboundPrompt records a prompt for a new outgoing connection.
+// Returns false if there are too many open prompts.
+func (r *Router) recordOutboundPrompt(connKey connStateKey) (created, ok bool) {
+	r.outboundPromptsLock.Lock()
+	defer r.outboundPromptsLock.Unlock()
+
+	// Update existing prompt.
+	now := r.clock.Now()
+	prompt, exists := r.outboundPrompts[connKey.remoteIP]
+	if exists && !prompt.TimedOut {
+		prompt.LastSeen = now
+		prompt.Connections++
+		return false, true
+	}
+
+	// Check if we have space for another prompt.
+	if !exists && len(r.outboundPrompts) >= maxOutboundPrompts {
+		return false, false
+	}
+
+	// Add new prompt, replacing a timed out prompt with an expired decision.
+	delete(r.outboundDecisions, connKey.remoteIP)
+	r.outboundPrompts[connKey.remoteIP] = &OutboundPrompt{
+		Router:      connKey.remoteIP,
+		Protocol:    connKey.protocol,
+		Port:        connKey.remotePort,
+		FirstSeen:   now,
+		LastSeen:    now,
+		Connections: 1,
+		Expires:     now.Add(r.instance.Config().OutboundPrompts.Timeout),
+	}
+	return true, true
+}
+
+// ExportOutboundPrompts returns all open and timed out outbound prompts.
+func (r *Router) ExportOutboundPrompts() []OutboundPrompt {
+	r.outboundPromptsLock.Lock()
+	defer r.outboundPromptsLock.Unlock()
+
+	export := make([]OutboundPrompt, 0, len(r.outboundPrompts))
+	for _, prompt := range r.outboundPrompts {
+		export = append(export, *prompt)
+	}
+
+	// Sort.
+	slices.SortFunc(export, func(a, b OutboundPrompt) int {
+		return -a.FirstSeen.Compare(b.FirstSeen) // Newer first.
+	})
+
+	return export
+}
+
+// AllowOutbound allows outgoing connections to the prompted router until the
+// next restart and releases its held connections.
+func (r *Router) AllowOutbound(router netip.Addr) error {
+	return r.decideOutboundPrompt(router, true)
+}
+
+// DenyOutbound denies outgoing connections to the prompted router until the
+// next restart.
+func (r *Router) DenyOutbound(router netip.Addr) error {
+	return r.decideOutboundPrompt(router, false)
+}
+
+func (r *Router) decideOutboundPrompt(router netip.Addr, allow bool) error {
+	r.outboundPromptsLock.Lock()
+	prompt, ok := r.outboundPrompts[router]
+	if ok {
+		delete(r.outboundPrompts, router)
+		r.outboundDecisions[router] = outboundDecision{allowed: allow}
+	}
+	r.outboundPromptsLock.Unlock()
+
+	switch {
+	case !ok:
+		return ErrOutboundPromptNotFound
+	case prompt.TimedOut:
+		// Re-evaluate connections decided by the timeout action.
+		r.resetOutboundConnStatesTo(router)
+	default:
+		r.resolvePendingConnStates(router, allow)
+	}
+	return nil
+}
+
+// resolvePendingConnStates updates the status of all held connections to the
+// given router.
+func (r *Router) resolvePendingConnStates(dst netip.Addr, allow bool) {
+	status := connStatusProhibited
+	if allow {
+		status = connStatusAllowed
+	}
+
+	r.connStatesLock.RLock()
+	defer r.connStatesLock.RUnlock()
+
+	for key, entry := range r.connStates {
+		if !entry.inbound && key.remoteIP == dst {
+			entry.status.CompareAndSwap(uint32(connStatusPending), uint32(status))
+		}
+	}
+}
+
+func (r *Router) resetOutboundConnStatesTo(dst netip.Addr) {
+	r.connStatesLock.Lock()
+	defer r.connStatesLock.Unlock()
+
+	for key, entry := range r.connStates {
+		if !entry.inbound && key.remoteIP == dst {
+			delete(r.connStates, key)
+		}
+	}
+}
+
+// cleanOutboundPrompts takes the timeout action on expired prompts and
+// removes expired decisions together with their prompts.
+func (r *Router) cleanOutboundPrompts(w *mgr.WorkerCtx) {
+	now := r.clock.Now()
+	allow := r.instance.Config().OutboundPrompts.TimeoutAllow
+
+	r.outboundPromptsLock.Lock()
+	var timedOut []netip.Addr
+	for dst, prompt := range r.outboundPrompts {
+		if !prompt.TimedOut && now.After(prompt.Expires) {
+			prompt.TimedOut = true
+			r.outboundDecisions[dst] = outboundDecision{
+				allowed: allow,
+				expires: now.Add(outboundTimeoutDecisionTTL),
+			}
+			timedOut = append(timedOut, dst)
+		}
+	}
+	for dst, decision := range r.outboundDecisions {
+		if !decision.expires.IsZero() && now.After(decision.expires) {
+			delete(r.outboundDecisions, dst)
+			delete(r.outboundPrompts, dst)
+		}
+	}
+	r.outboundPromptsLock.Unlock()
+
+	for _, dst := range timedOut {
+		r.resolvePendingConnStates(dst, allow)
+		w.Info(
+			"outbound prompt timed out",
+			"router", dst,
+			"allowed", allow,
+		)
+	}
+}
+
+// ProtocolName returns the protocol name, if available.
+func (prompt *OutboundPrompt) ProtocolName() string {
+	return (&ExportedConnection{Protocol: prompt.Protocol}).ProtocolName()
+}
@@ -0,0 +1,82 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestOutboundPrompts(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	friend := netip.MustParseAddr("fd12:3456::1")
+	remoteA := netip.MustParseAddr("fd12:3456::2")
+	remoteB := netip.MustParseAddr("fd12:3456::3")
+	r := &Router{
+		clock:             clock,
+		connStates:        make(map[connStateKey]*connStateEntry),
+		outboundPrompts:   make(map[netip.Addr]*OutboundPrompt),
+		outboundDecisions: make(map[netip.Addr]outboundDecision),
+		instance: &deniedTestInstance{
+			config: config.MakeTestConfig(config.Store{
+				Router: config.Router{PromptOutbound: true},
+				FriendConfigs: []config.FriendConfig{
+					{Name: "friend", IP: friend.String()},
+				},
+			}),
+		},
+	}
+	keyA := connStateKey{remoteIP: remoteA, protocol: 6, localPort: 50000, remotePort: 443}
+	keyB := connStateKey{remoteIP: remoteB, protocol: 6, localPort: 50001, remotePort: 443}
+
+	err := mgr.New("test").Do("test", func(w *mgr.WorkerCtx) error {
+		// Friends are allowed.
+		status, _ := r.checkPolicy(w, false, connStateKey{remoteIP: friend, protocol: 6, remotePort: 443}, 0, 0)
+		assert.Equal(t, connStatusAllowed, status)
+
+		// Other routers are held.
+		status, _ = r.checkPolicy(w, false, keyA, 0, 0)
+		assert.Equal(t, connStatusPending, status)
+		status, _ = r.checkPolicy(w, false, keyB, 0, 0)
+		assert.Equal(t, connStatusPending, status)
+		prompts := r.ExportOutboundPrompts()
+		require.Len(t, prompts, 2)
+		assert.Equal(t, uint16(443), prompts[0].Port)
+
+		// Allowing releases held connections.
+		require.NoError(t, r.AllowOutbound(remoteA))
+		status, _ = r.checkPolicy(w, false, keyA, 0, 0)
+		assert.Equal(t, connStatusAllowed, status)
+		assert.ErrorIs(t, r.DenyOutbound(remoteA), ErrOutboundPromptNotFound)
+
+		// Timeout action denies by default.
+		clock.Advance(config.DefaultPromptTimeout + time.Second)
+		r.cleanOutboundPrompts(w)
+		status, _ = r.checkPolicy(w, false, keyB, 0, 0)
+		assert.Equal(t, connStatusProhibited, status)
+		prompts = r.ExportOutboundPrompts()
+		require.Len(t, prompts, 1)
+		assert.True(t, prompts[0].TimedOut)
+
+		// Timed out prompts can still be decided.
+		require.NoError(t, r.AllowOutbound(remoteB))
+		status, _ = r.checkPolicy(w, false, keyB, 0, 0)
+		assert.Equal(t, connStatusAllowed, status)
+		assert.Empty(t, r.ExportOutboundPrompts())
+
+		// Decisions of the user are kept.
+		clock.Advance(2 * outboundTimeoutDecisionTTL)
+		r.cleanOutboundPrompts(w)
+		assert.Equal(t, PolicyRuleAllowedDestination, r.EvaluatePolicy(false, remoteA, 6, 443).Rule)
+		return nil
+	})
+	require.NoError(t, err)
+}
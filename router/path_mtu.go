@@ -0,0 +1,318 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"slices"
+	"time"
+
+	"golang.org/x/net/ipv6"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+)
+
+const (
+	// minPathMTU is the minimum MTU of IPv6 links.
+	minPathMTU = 1280
+	// pathMTUTTL defines how long a learned path MTU is used, before the MTU
+	// announced by the destination is tried again. See RFC 8201.
+	pathMTUTTL = 10 * time.Minute
+	// maxPathMTUs limits the amount of destinations with a learned path MTU.
+	maxPathMTUs = 1000
+
+	// pathMTUProbeTimeout defines how long to wait for the response to a
+	// single path MTU probe.
+	pathMTUProbeTimeout = 1 * time.Second
+	// pathMTUProbePrecision defines when to stop narrowing down the path MTU.
+	pathMTUProbePrecision = 64
+
+	// tcpMSSOverhead is the size of the IPv6 and TCP headers, which are not
+	// part of the TCP maximum segment size.
+	tcpMSSOverhead = ipv6.HeaderLen + 20
+)
+
+// ErrPathMTUProbeFailed is returned when no path MTU probe was answered.
+var ErrPathMTUProbeFailed = errors.New("no path mtu probe was answered")
+
+// The destination announces the MTU of its tun device, but the effective MTU
+// of the path to it may be lower. Lower path MTUs are learned from ICMPv6
+// "packet too big" messages of the destination and from padded ping probes.
+// Packets above the path MTU are answered with "packet too big" and the
+// maximum segment size of TCP connections is clamped to fit the path MTU, so
+// that connections work even if ICMP errors are dropped by the host.
+
+// PathMTUSource describes how a path MTU was learned.
+type PathMTUSource string
+
+// Path MTU sources.
+const (
+	// PathMTUSourceAnnounced is used when the MTU announced by the
+	// destination is used.
+	PathMTUSourceAnnounced PathMTUSource = "announced"
+	// PathMTUSourceTooBig is used when the path MTU was learned from an
+	// ICMPv6 "packet too big" message.
+	PathMTUSourceTooBig PathMTUSource = "too-big"
+	// PathMTUSourceProbe is used when the path MTU was measured with probes.
+	PathMTUSourceProbe PathMTUSource = "probe"
+)
+
+// PathMTU is the effective MTU of the path to a destination.
+type PathMTU struct {
+	Dst netip.Addr `json:"dst"`
+	// MTU is the effective path MTU.
+	MTU int `json:"mtu"`
+	// Announced is the tun MTU announced by the destination.
+	Announced int           `json:"announced,omitempty"`
+	Source    PathMTUSource `json:"source"`
+	Updated   time.Time     `json:"updated,omitempty"`
+}
+
+// pathMTUEntry is a learned path MTU.
+type pathMTUEntry struct {
+	mtu     int
+	source  PathMTUSource
+	updated time.Time
+}
+
+// learnPathMTU records the path MTU to the given destination.
+// Path MTUs from "packet too big" messages may only lower the path MTU.
+func (r *Router) learnPathMTU(dst netip.Addr, mtu int, source PathMTUSource) {
+	mtu = max(mtu, minPathMTU)
+
+	r.pathMTUsLock.Lock()
+	defer r.pathMTUsLock.Unlock()
+
+	entry, ok := r.pathMTUs[dst]
+	switch {
+	case ok && source == PathMTUSourceTooBig && entry.mtu <= mtu:
+		return
+	case !ok && len(r.pathMTUs) >= maxPathMTUs:
+		return
+	}
+	r.pathMTUs[dst] = &pathMTUEntry{
+		mtu:     mtu,
+		source:  source,
+		updated: r.clock.Now(),
+	}
+}
+
+// pathMTU returns the effective MTU of the path to the given destination.
+// Returns zero if it is unknown.
+func (r *Router) pathMTU(dst netip.Addr, session *state.Session) int {
+	mtu := session.TunMTU()
+
+	r.pathMTUsLock.Lock()
+	defer r.pathMTUsLock.Unlock()
+
+	if entry, ok := r.pathMTUs[dst]; ok && (mtu == 0 || entry.mtu < mtu) {
+		mtu = entry.mtu
+	}
+	return mtu
+}
+
+// PathMTUs returns the effective path MTUs of all destinations with a session.
+func (r *Router) PathMTUs() []PathMTU {
+	sessions := r.instance.State().GetSessions()
+
+	r.pathMTUsLock.Lock()
+	defer r.pathMTUsLock.Unlock()
+
+	list := make([]PathMTU, 0, len(sessions))
+	for _, session := range sessions {
+		pmtu := PathMTU{
+			Dst:       session.For(),
+			MTU:       session.TunMTU(),
+			Announced: session.TunMTU(),
+			Source:    PathMTUSourceAnnounced,
+		}
+		if entry, ok := r.pathMTUs[pmtu.Dst]; ok && (pmtu.MTU == 0 || entry.mtu < pmtu.MTU) {
+			pmtu.MTU = entry.mtu
+			pmtu.Source = entry.source
+			pmtu.Updated = entry.updated
+		}
+		if pmtu.MTU > 0 {
+			list = append(list, pmtu)
+		}
+	}
+	slices.SortFunc(list, func(a, b PathMTU) int {
+		return a.Dst.Compare(b.Dst)
+	})
+	return list
+}
+
+// cleanPathMTUs removes learned path MTUs after their TTL, so that a higher
+// path MTU is discovered again.
+func (r *Router) cleanPathMTUs() {
+	threshold := r.clock.Now().Add(-pathMTUTTL)
+
+	r.pathMTUsLock.Lock()
+	defer r.pathMTUsLock.Unlock()
+
+	for dst, entry := range r.pathMTUs {
+		if entry.updated.Before(threshold) {
+			delete(r.pathMTUs, dst)
+		}
+	}
+}
+
+// ProbePathMTU measures the MTU of the path to the given destination with
+// padded pings, between the IPv6 minimum and the MTU announced by the
+// destination. Lost probes are taken as too big, so the result may be lower
+// than the actual path MTU on lossy paths.
+func (r *Router) ProbePathMTU(dst netip.Addr) (*PathMTU, error) {
+	session := r.instance.State().GetSession(dst)
+	if session == nil || session.TunMTU() == 0 {
+		return nil, fmt.Errorf("no session with %s", dst)
+	}
+
+	// Probe the announced MTU first, as it usually works.
+	announced := session.TunMTU()
+	ok, err := r.probePathMTU(dst, announced)
+	if err != nil {
+		return nil, err
+	}
+	low := announced
+	if !ok {
+		// Check the minimum, then narrow down.
+		ok, err := r.probePathMTU(dst, minPathMTU)
+		switch {
+		case err != nil:
+			return nil, err
+		case !ok:
+			return nil, ErrPathMTUProbeFailed
+		}
+
+		high := announced
+		low = minPathMTU
+		for high-low > pathMTUProbePrecision {
+			size := (low + high) / 2
+			ok, err := r.probePathMTU(dst, size)
+			switch {
+			case err != nil:
+				return nil, err
+			case ok:
+				low = size
+			default:
+				high = size
+			}
+		}
+	}
+
+	r.learnPathMTU(dst, low, PathMTUSourceProbe)
+	return &PathMTU{
+		Dst:       dst,
+		MTU:       low,
+		Announced: announced,
+		Source:    PathMTUSourceProbe,
+		Updated:   r.clock.Now(),
+	}, nil
+}
+
+// probePathMTU sends a probe of the given size and returns whether it was
+// answered.
+func (r *Router) probePathMTU(dst netip.Addr, size int) (ok bool, err error) {
+	notify, _, err := r.PingPong.SendPadded(dst, size)
+	if err != nil {
+		return false, fmt.Errorf("send probe: %w", err)
+	}
+	select {
+	case <-notify:
+		return true, nil
+	case <-r.clock.After(pathMTUProbeTimeout):
+		return false, nil
+	}
+}
+
+// learnFromPacketTooBig learns the path MTU from an ICMPv6 "packet too big"
+// message received from the given router. Only the path MTU to the sending
+// router itself is learned, so that it cannot lower the path MTU to others.
+func (r *Router) learnFromPacketTooBig(src netip.Addr, packetData []byte, info packetInfo) {
+	if info.protocol != 58 || info.fragmented {
+		return
+	}
+
+	// Check ICMP type and the destination of the original packet.
+	icmpData := packetData[info.offset:]
+	if len(icmpData) < 8+ipv6.HeaderLen ||
+		icmpData[0] != byte(ipv6.ICMPTypePacketTooBig) {
+		return
+	}
+	originalDst := netip.AddrFrom16([16]byte(icmpData[8+24 : 8+40]))
+	if originalDst != src {
+		return
+	}
+
+	r.learnPathMTU(src, int(m.GetUint32(icmpData[4:8])), PathMTUSourceTooBig)
+}
+
+// clampTCPMSS lowers the maximum segment size option of TCP SYN packets to
+// fit the given MTU. Returns whether the packet was changed.
+func clampTCPMSS(packetData []byte, info packetInfo, mtu int) (clamped bool) {
+	if info.protocol != 6 || !info.firstFragment() || info.tcpFlags&tcpFlagSYN == 0 {
+		return false
+	}
+	maxMSS := mtu - tcpMSSOverhead
+	if mtu <= 0 || maxMSS <= 0 {
+		return false
+	}
+
+	// Get TCP options.
+	tcpHeader := packetData[info.offset:]
+	if len(tcpHeader) < 20 {
+		return false
+	}
+	headerLen := int(tcpHeader[12]>>4) * 4
+	if headerLen < 20 || headerLen > len(tcpHeader) {
+		return false
+	}
+
+	// Find MSS option.
+	for i := 20; i < headerLen; {
+		switch tcpHeader[i] {
+		case 0: // End of options.
+			return false
+		case 1: // No operation.
+			i++
+			continue
+		}
+		if i+1 >= headerLen {
+			return false
+		}
+		optionLen := int(tcpHeader[i+1])
+		if optionLen < 2 || i+optionLen > headerLen {
+			return false
+		}
+		if tcpHeader[i] != 2 || optionLen != 4 {
+			i += optionLen
+			continue
+		}
+
+		// Lower MSS and update checksum.
+		mss := m.GetUint16(tcpHeader[i+2 : i+4])
+		if int(mss) <= maxMSS {
+			return false
+		}
+		m.PutUint16(tcpHeader[i+2:i+4], uint16(maxMSS))
+		oldValue, newValue := mss, uint16(maxMSS)
+		if (i+2)%2 != 0 {
+			// Values at odd offsets add to the checksum with swapped bytes.
+			oldValue, newValue = bits.ReverseBytes16(oldValue), bits.ReverseBytes16(newValue)
+		}
+		checksum := updateChecksum(m.GetUint16(tcpHeader[16:18]), oldValue, newValue)
+		m.PutUint16(tcpHeader[16:18], checksum)
+		return true
+	}
+	return false
+}
+
+// updateChecksum incrementally updates an internet checksum when a 16-bit
+// value is changed. See RFC 1624.
+func updateChecksum(checksum, oldValue, newValue uint16) uint16 {
+	sum := uint32(^checksum) + uint32(^oldValue) + uint32(newValue)
+	sum = (sum & 0xFFFF) + (sum >> 16)
+	sum = (sum & 0xFFFF) + (sum >> 16)
+	return ^uint16(sum)
+}
@@ -0,0 +1,187 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+)
+
+// buildTestSYN builds a TCP SYN packet with the given options and a valid
+// checksum, leaving out the pseudo header.
+func buildTestSYN(options ...byte) []byte {
+	tcp := make([]byte, 20, 20+len(options))
+	tcp = append(tcp, options...)
+	tcp[12] = byte(len(tcp)/4) << 4
+	tcp[13] = tcpFlagSYN
+	m.PutUint16(tcp[16:18], ^testChecksumSum(tcp))
+	return buildTestPacket(6, tcp)
+}
+
+// testChecksumSum returns the one's complement sum of the given data.
+func testChecksumSum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(data); i += 2 {
+		word := uint32(data[i]) << 8
+		if i+1 < len(data) {
+			word |= uint32(data[i+1])
+		}
+		sum += word
+	}
+	for sum > 0xFFFF {
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	return uint16(sum)
+}
+
+func TestClampTCPMSS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options []byte
+		mtu     int
+		clamped bool
+		mss     int
+		offset  int
+	}{
+		{
+			name:    "mss above path mtu",
+			options: []byte{2, 4, 0x23, 0x0C, 1, 1, 1, 0}, // MSS 8972
+			mtu:     1400,
+			clamped: true,
+			mss:     1340,
+			offset:  22,
+		},
+		{
+			name:    "mss at odd offset",
+			options: []byte{1, 2, 4, 0x23, 0x0C, 1, 1, 0}, // NOP, MSS 8972
+			mtu:     1400,
+			clamped: true,
+			mss:     1340,
+			offset:  23,
+		},
+		{
+			name:    "mss after other options",
+			options: []byte{4, 2, 3, 3, 7, 2, 4, 0x05, 0xB4, 0, 0, 0}, // SACK, WS, MSS 1460
+			mtu:     1280,
+			clamped: true,
+			mss:     1220,
+			offset:  27,
+		},
+		{
+			name:    "mss below path mtu",
+			options: []byte{2, 4, 0x04, 0xC4, 1, 1, 1, 0}, // MSS 1220
+			mtu:     1400,
+			offset:  22,
+			mss:     1220,
+		},
+		{
+			name:    "no mss option",
+			options: []byte{1, 1, 1, 0},
+			mtu:     1400,
+		},
+		{
+			name:    "truncated option",
+			options: []byte{1, 1, 1, 2},
+			mtu:     1400,
+		},
+	}
+	for _, test := range tests {
+		packet := buildTestSYN(test.options...)
+		info, err := parsePacketInfo(packet)
+		require.NoError(t, err, test.name)
+
+		assert.Equal(t, test.clamped, clampTCPMSS(packet, info, test.mtu), test.name)
+		assert.Equal(t, uint16(0xFFFF), testChecksumSum(packet[info.offset:]), "%s: checksum must stay valid", test.name)
+		if test.mss != 0 {
+			tcpHeader := packet[info.offset:]
+			assert.Equal(t, test.mss, int(m.GetUint16(tcpHeader[test.offset:test.offset+2])), test.name)
+		}
+	}
+
+	// Only SYN packets are clamped.
+	packet := buildTestSYN(2, 4, 0x23, 0x0C)
+	info, err := parsePacketInfo(packet)
+	require.NoError(t, err)
+	info.tcpFlags = tcpFlagACK
+	assert.False(t, clampTCPMSS(packet, info, 1280))
+}
+
+func TestPathMTU(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock:    clock,
+		pathMTUs: make(map[netip.Addr]*pathMTUEntry),
+	}
+	dst := netip.MustParseAddr("fd00::a")
+	session := &state.Session{}
+	session.SetTunMTU(9000)
+
+	// Announced MTU is used by default.
+	assert.Equal(t, 9000, r.pathMTU(dst, session))
+
+	// Packet too big lowers the path MTU, but never below the minimum.
+	r.learnPathMTU(dst, 1400, PathMTUSourceTooBig)
+	assert.Equal(t, 1400, r.pathMTU(dst, session))
+	r.learnPathMTU(dst, 1500, PathMTUSourceTooBig)
+	assert.Equal(t, 1400, r.pathMTU(dst, session))
+	r.learnPathMTU(dst, 500, PathMTUSourceTooBig)
+	assert.Equal(t, minPathMTU, r.pathMTU(dst, session))
+
+	// Probes may raise the path MTU again.
+	r.learnPathMTU(dst, 4000, PathMTUSourceProbe)
+	assert.Equal(t, 4000, r.pathMTU(dst, session))
+
+	// Learned MTUs above the announced MTU are not used.
+	session.SetTunMTU(2000)
+	assert.Equal(t, 2000, r.pathMTU(dst, session))
+	session.SetTunMTU(9000)
+
+	// Learned MTUs expire.
+	clock.Advance(pathMTUTTL + time.Second)
+	r.cleanPathMTUs()
+	assert.Equal(t, 9000, r.pathMTU(dst, session))
+}
+
+func TestLearnFromPacketTooBig(t *testing.T) {
+	t.Parallel()
+
+	r := &Router{
+		clock:    m.NewVirtualClock(time.Now()),
+		pathMTUs: make(map[netip.Addr]*pathMTUEntry),
+	}
+	src := netip.MustParseAddr("fd00::a")
+	other := netip.MustParseAddr("fd00::b")
+	session := &state.Session{}
+	session.SetTunMTU(9000)
+
+	buildTooBig := func(originalDst netip.Addr, mtu uint32) ([]byte, packetInfo) {
+		icmpData := make([]byte, 8+40)
+		icmpData[0] = 2 // Packet too big.
+		m.PutUint32(icmpData[4:8], mtu)
+		dstData := originalDst.As16()
+		copy(icmpData[8+24:8+40], dstData[:])
+		packet := buildTestPacket(58, icmpData)
+		info, err := parsePacketInfo(packet)
+		require.NoError(t, err)
+		return packet, info
+	}
+
+	// Packet too big about packets to others is ignored.
+	packet, info := buildTooBig(other, 1400)
+	r.learnFromPacketTooBig(src, packet, info)
+	assert.Equal(t, 9000, r.pathMTU(src, session))
+
+	// Packet too big about packets to the sender is learned.
+	packet, info = buildTooBig(src, 1400)
+	r.learnFromPacketTooBig(src, packet, info)
+	assert.Equal(t, 1400, r.pathMTU(src, session))
+}
@@ -0,0 +1,146 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+const (
+	// DefaultPathProbePaths is the default amount of paths to probe.
+	DefaultPathProbePaths = 3
+	// MaxPathProbePaths limits the amount of paths to probe.
+	MaxPathProbePaths = 16
+	// DefaultPathProbeCount is the default amount of probes per path.
+	DefaultPathProbeCount = 3
+	// MaxPathProbeCount limits the amount of probes per path.
+	MaxPathProbeCount = 10
+
+	// pathProbeTimeout defines how long to wait for the response to a probe.
+	pathProbeTimeout = 1 * time.Second
+	// pathProbeInterval defines the minimum interval between the probes of a
+	// path.
+	pathProbeInterval = 100 * time.Millisecond
+)
+
+// ErrNoPathsToProbe is returned when there are no known paths to probe.
+var ErrNoPathsToProbe = m.NewError(m.CodeNoRoute, "no known paths to destination")
+
+// PathProbe is the result of probing a path to a destination.
+// Probes are sent along the path, but the destination answers on the path
+// it chooses, so that the round trip time also includes the return path.
+type PathProbe struct {
+	// Via holds the routers of the path, excluding this router.
+	Via []netip.Addr `json:"via"`
+	// Source is the source of the route, or "pinned".
+	Source string `json:"source"`
+	// Delay is the total delay of the path in milliseconds, as announced.
+	Delay uint16 `json:"delay"`
+
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss"` // From 0 to 1.
+
+	MinRTT time.Duration `json:"minRTT,omitempty"`
+	AvgRTT time.Duration `json:"avgRTT,omitempty"`
+	MaxRTT time.Duration `json:"maxRTT,omitempty"`
+}
+
+// ProbePaths probes the given amount of candidate paths to the destination
+// with the given amount of pings each and returns the measured round trip
+// times and loss per path. The pinned route is always probed first, if set.
+// No user traffic is sent, so this can be used to check connectivity before
+// it is needed.
+func (r *Router) ProbePaths(dst netip.Addr, paths, count int) ([]PathProbe, error) {
+	switch {
+	case !dst.IsValid():
+		return nil, errors.New("invalid destination")
+	case paths < 1 || paths > MaxPathProbePaths:
+		return nil, fmt.Errorf("paths must be between 1 and %d", MaxPathProbePaths)
+	case count < 1 || count > MaxPathProbeCount:
+		return nil, fmt.Errorf("count must be between 1 and %d", MaxPathProbeCount)
+	}
+
+	// Collect candidate paths.
+	candidates := make([]*m.SwitchPath, 0, paths)
+	probes := make([]PathProbe, 0, paths)
+	if path := r.getPinnedPath(dst); path != nil {
+		candidates = append(candidates, path)
+		probes = append(probes, makePathProbe(path, "pinned"))
+	}
+	entries := r.table.LookupPossiblePaths(dst, paths, m.AddrDistance{}, false, nil)
+	for _, rte := range entries {
+		if len(candidates) >= paths {
+			break
+		}
+		path := rte.Path
+		candidates = append(candidates, &path)
+		probes = append(probes, makePathProbe(&path, rte.Source.String()))
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoPathsToProbe
+	}
+
+	// Probe all paths at the same time.
+	var wg sync.WaitGroup
+	for i, path := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.probePath(dst, path, count, &probes[i])
+		}()
+	}
+	wg.Wait()
+
+	return probes, nil
+}
+
+func makePathProbe(path *m.SwitchPath, source string) PathProbe {
+	probe := PathProbe{
+		Via:    make([]netip.Addr, 0, len(path.Hops)),
+		Source: source,
+		Delay:  path.TotalDelay,
+	}
+	for _, hop := range path.Hops[1:] {
+		probe.Via = append(probe.Via, hop.Router)
+	}
+	return probe
+}
+
+// probePath sends the given amount of probes along the path and records the
+// results in the probe.
+func (r *Router) probePath(dst netip.Addr, path *m.SwitchPath, count int, probe *PathProbe) {
+	var total time.Duration
+	for range count {
+		started := time.Now()
+		probe.Sent++
+		notify, _, err := r.PingPong.SendVia(dst, path)
+		if err == nil {
+			select {
+			case <-notify:
+				rtt := time.Since(started)
+				probe.Received++
+				total += rtt
+				if probe.MinRTT == 0 || rtt < probe.MinRTT {
+					probe.MinRTT = rtt
+				}
+				probe.MaxRTT = max(probe.MaxRTT, rtt)
+			case <-time.After(pathProbeTimeout):
+			}
+		}
+
+		// Wait a little between probes.
+		if wait := pathProbeInterval - time.Since(started); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+
+	if probe.Received > 0 {
+		probe.AvgRTT = total / time.Duration(probe.Received)
+	}
+	probe.Loss = float64(probe.Sent-probe.Received) / float64(probe.Sent)
+}
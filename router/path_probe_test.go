@@ -0,0 +1,59 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestProbePathsChecks(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	self := netip.MustParseAddr("fd00::1")
+	r := &Router{
+		clock: clock,
+		table: m.NewRoutingTable(m.RoutingTableConfig{
+			RoutablePrefixes: m.GetRoutablePrefixesFor(self, netip.Prefix{}),
+			RouterIP:         self,
+			Clock:            clock,
+		}),
+	}
+	dst := netip.MustParseAddr("fd00::a")
+
+	// Check arguments.
+	_, err := r.ProbePaths(netip.Addr{}, 1, 1)
+	require.Error(t, err)
+	_, err = r.ProbePaths(dst, 0, 1)
+	require.Error(t, err)
+	_, err = r.ProbePaths(dst, 1, MaxPathProbeCount+1)
+	require.Error(t, err)
+
+	// Without routes, there is nothing to probe.
+	_, err = r.ProbePaths(dst, DefaultPathProbePaths, DefaultPathProbeCount)
+	require.ErrorIs(t, err, ErrNoPathsToProbe)
+}
+
+func TestMakePathProbe(t *testing.T) {
+	t.Parallel()
+
+	self := netip.MustParseAddr("fd00::1")
+	relay := netip.MustParseAddr("fd00::2")
+	dst := netip.MustParseAddr("fd00::a")
+	probe := makePathProbe(&m.SwitchPath{
+		Hops: []m.SwitchHop{
+			{Router: self, ForwardLabel: 1},
+			{Router: relay, ForwardLabel: 2, ReturnLabel: 1},
+			{Router: dst, ReturnLabel: 2},
+		},
+		TotalDelay: 30,
+	}, "gossip")
+	assert.Equal(t, []netip.Addr{relay, dst}, probe.Via)
+	assert.Equal(t, "gossip", probe.Source)
+	assert.Equal(t, uint16(30), probe.Delay)
+}
@@ -0,0 +1,139 @@
+package router
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// pendingMaxPackets is the maximum amount of packets queued per destination.
+	pendingMaxPackets = 32
+	// pendingMaxBytes is the maximum amount of bytes queued per destination.
+	pendingMaxBytes = 64 * 1024
+	// pendingMaxDestinations is the maximum amount of destinations with queued packets.
+	pendingMaxDestinations = 256
+	// pendingTimeout defines how long packets are queued while waiting for
+	// encryption to be set up.
+	pendingTimeout = 5 * time.Second
+)
+
+// pendingQueue holds packets from the tun device waiting for a session to be set up.
+type pendingQueue struct {
+	packets [][]byte
+	size    int
+}
+
+// queuePendingPacket queues a copy of the given packet until the session to
+// dst is set up. If a new queue is created, the caller must start sending the
+// pending packets.
+func (r *Router) queuePendingPacket(dst netip.Addr, packetData []byte) (created, queued bool) {
+	r.pendingLock.Lock()
+	defer r.pendingLock.Unlock()
+
+	// Get or create queue.
+	queue, ok := r.pending[dst]
+	if !ok {
+		if len(r.pending) >= pendingMaxDestinations {
+			return false, false
+		}
+		queue = &pendingQueue{}
+		r.pending[dst] = queue
+		created = true
+	}
+
+	// Check limits.
+	if len(queue.packets) >= pendingMaxPackets ||
+		queue.size+len(packetData) > pendingMaxBytes {
+		return created, false
+	}
+
+	// Add copy of packet, as the packet data is returned to the pool.
+	queue.packets = append(queue.packets, slices.Clone(packetData))
+	queue.size += len(packetData)
+	return created, true
+}
+
+// takePendingPackets removes and returns all pending packets of dst.
+func (r *Router) takePendingPackets(dst netip.Addr) [][]byte {
+	r.pendingLock.Lock()
+	defer r.pendingLock.Unlock()
+
+	queue, ok := r.pending[dst]
+	if !ok {
+		return nil
+	}
+	delete(r.pending, dst)
+	return queue.packets
+}
+
+// sendPendingPackets waits for the session to dst to be set up and then sends
+// all pending packets in order.
+func (r *Router) sendPendingPackets(
+	w *mgr.WorkerCtx,
+	src, dst netip.Addr,
+	notify <-chan struct{},
+	statusUpdate chan connStatus,
+) {
+	// Wait for hello ping to finish.
+	select {
+	case <-notify:
+		// Continue
+
+	case status := <-statusUpdate:
+		// Connection status changed.
+		r.dropPendingPackets(w, src, r.takePendingPackets(dst), status)
+		return
+
+	case <-r.clock.After(pendingTimeout):
+		dropped := r.takePendingPackets(dst)
+		backoff := r.markUnreachable(dst)
+		w.Debug(
+			"timed out setting up encryption, dropping pending packets",
+			"dst", dst,
+			"packets", len(dropped),
+			"backoff", backoff,
+		)
+		r.dropPendingPackets(w, src, dropped, connStatusUnreachable)
+		return
+
+	case <-w.Done():
+		return
+	}
+
+	// Get session.
+	packets := r.takePendingPackets(dst)
+	session := r.instance.State().GetSession(dst)
+	if session == nil || !session.Encryption().IsSetUp() {
+		backoff := r.markUnreachable(dst)
+		w.Debug(
+			"no session after hello ping, dropping pending packets",
+			"dst", dst,
+			"packets", len(packets),
+			"backoff", backoff,
+		)
+		r.dropPendingPackets(w, src, packets, connStatusUnreachable)
+		return
+	}
+
+	// Send pending packets.
+	r.clearUnreachable(dst)
+	for _, packetData := range packets {
+		r.sendTunPacket(w, src, dst, session, packetData)
+	}
+}
+
+// dropPendingPackets answers the given pending packets with an ICMP error of
+// the given status.
+func (r *Router) dropPendingPackets(w *mgr.WorkerCtx, src netip.Addr, packets [][]byte, status connStatus) {
+	for _, packetData := range packets {
+		if err := r.respondWithError(src, packetData, status); err != nil {
+			w.Debug(
+				"failed to send icmp error",
+				"err", err,
+			)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv6"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
+	"github.com/mycoria/mycoria/tun"
+)
+
+type pendingTestInstance struct {
+	announceTestInstance
+	tun *tun.Device
+}
+
+func (i *pendingTestInstance) TunDevice() *tun.Device { return i.tun }
+
+func TestPendingPackets(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	inst := &pendingTestInstance{
+		announceTestInstance: announceTestInstance{
+			config:   config.MakeTestConfig(config.Store{}),
+			identity: identity,
+		},
+		tun: &tun.Device{SendRaw: make(chan []byte, 10)},
+	}
+	inst.state = state.New(inst, storage.NewMemStorage())
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		instance:    inst,
+		clock:       clock,
+		pending:     make(map[netip.Addr]*pendingQueue),
+		unreachable: make(map[netip.Addr]*unreachableEntry),
+		icmpLimiter: newICMPRateLimiter(),
+	}
+	src := identity.IP
+	dst := netip.MustParseAddr("fd12:3456::1")
+	packet := buildTestPacket(17, []byte{0x04, 0xD2, 0x00, 0x35, 0, 8, 0, 0})
+
+	err = mgr.New("test").Do("test", func(w *mgr.WorkerCtx) error {
+		// Packets are answered when there is no session after the hello ping.
+		created, queued := r.queuePendingPacket(dst, packet)
+		require.True(t, created)
+		require.True(t, queued)
+		notify := make(chan struct{})
+		close(notify)
+		r.sendPendingPackets(w, src, dst, notify, nil)
+		require.Len(t, inst.tun.SendRaw, 1)
+		icmpPacket := <-inst.tun.SendRaw
+		assert.Equal(t, byte(ipv6.ICMPTypeDestinationUnreachable), icmpPacket[ipv6.HeaderLen])
+		assert.True(t, r.isUnreachable(dst))
+
+		// Packets are answered when setting up the session times out.
+		r.clearUnreachable(dst)
+		_, queued = r.queuePendingPacket(dst, packet)
+		require.True(t, queued)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.sendPendingPackets(w, src, dst, make(chan struct{}), nil)
+		}()
+		// Advance the clock until the waiting timer fired.
+		for {
+			clock.Advance(pendingTimeout)
+			select {
+			case <-done:
+			case <-time.After(10 * time.Millisecond):
+				continue
+			}
+			break
+		}
+		require.Len(t, inst.tun.SendRaw, 1)
+		assert.True(t, r.isUnreachable(dst))
+		assert.Empty(t, r.pending)
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/peering"
 	"github.com/mycoria/mycoria/state"
 )
 
@@ -34,6 +35,8 @@ var pingTypeRegex = regexp.MustCompile(`^[a-z0-9\.]+$`)
 
 // PingHeader is the header used for every ping message.
 type PingHeader struct {
+	SchemaVersion uint8 `cbor:"sv,omitempty" json:"sv,omitempty"`
+
 	PingID    uint64            `cbor:"i,omitempty" json:"i,omitempty"`
 	PingType  string            `cbor:"t,omitempty" json:"t,omitempty"`
 	PingCode  uint8             `cbor:"c,omitempty" json:"c,omitempty"`
@@ -118,6 +121,15 @@ type sendPingOpts struct { //nolint:maligned
 	pingData []byte
 	// Define this message is a response or follow up.
 	followUp bool
+	// Send via the given switch path instead of routing.
+	// Only valid with dst.
+	switchPath *m.SwitchPath
+	// Send a message to all routers via the given peer only.
+	// Only valid with dst m.RouterAddress.
+	viaPeer netip.Addr
+	// Send to the peer via the given link, eg. a member of a link bond.
+	// Only valid with peer.
+	viaLink peering.Link
 }
 
 func (opts sendPingOpts) validate() error {
@@ -133,6 +145,12 @@ func (opts sendPingOpts) validate() error {
 		return errors.New("ping type is mandatory")
 	case len(opts.pingData) == 0:
 		return errors.New("ping data is mandatory")
+	case opts.switchPath != nil && !opts.dst.IsValid():
+		return errors.New("switch path requires dst")
+	case opts.viaPeer.IsValid() && opts.dst != m.RouterAddress:
+		return errors.New("via peer requires dst to be all routers")
+	case opts.viaLink != nil && opts.viaLink.Peer() != opts.peer:
+		return errors.New("via link requires peer of the link")
 	default:
 		return nil
 	}
@@ -151,13 +169,14 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 
 	// Build and marshal header.
 	hdr := PingHeader{
-		PingID:    opts.pingID,
-		PingType:  opts.pingType,
-		PingCode:  opts.pingCode,
-		FollowUp:  opts.followUp,
-		AddrHash:  r.instance.Identity().Hash,
-		KeyType:   r.instance.Identity().Type,
-		PublicKey: r.instance.Identity().PublicKey,
+		SchemaVersion: m.SchemaVersionPing,
+		PingID:        opts.pingID,
+		PingType:      opts.pingType,
+		PingCode:      opts.pingCode,
+		FollowUp:      opts.followUp,
+		AddrHash:      r.instance.Identity().Hash,
+		KeyType:       r.instance.Identity().Type,
+		PublicKey:     r.instance.Identity().PublicKey,
 	}
 	hdrData, err := cbor.Marshal(&hdr)
 	if err != nil {
@@ -182,9 +201,13 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 		dst = opts.peer
 		sendToPeer = true
 	}
+	switchPath := opts.switchPath
+	if switchPath == nil && !sendToPeer && dst != m.RouterAddress {
+		switchPath = r.getPinnedPath(dst)
+	}
 	f, err := r.instance.FrameBuilder().NewFrameV1(
 		r.instance.Identity().IP, dst, opts.msgType,
-		nil, frameData, nil,
+		switchBlockSpace(switchPath), frameData, nil,
 	)
 	if err != nil {
 		return fmt.Errorf("build frame: %w", err)
@@ -214,6 +237,14 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 		f.SetTTL(32)
 	}
 
+	// Send frame to all routers via the given peer.
+	if opts.viaPeer.IsValid() {
+		if err := r.instance.Switch().ForwardByPeer(f, opts.viaPeer); err != nil {
+			return fmt.Errorf("send ping frame to %s: %w", opts.viaPeer, err)
+		}
+		return nil
+	}
+
 	// Send frame on all links.
 	if f.DstIP() == m.RouterAddress {
 		links := r.instance.Peering().GetLinks()
@@ -238,12 +269,25 @@ func (r *Router) sendPingMsg(opts sendPingOpts) error {
 
 	// Send frame.
 	// Send to peer.
+	if sendToPeer && opts.viaLink != nil {
+		if err := r.instance.Switch().ForwardToLink(f, opts.viaLink); err != nil {
+			return fmt.Errorf("send ping frame to peer link: %w", err)
+		}
+		return nil
+	}
 	if sendToPeer {
 		if err := r.instance.Switch().ForwardByPeer(f, opts.peer); err != nil {
 			return fmt.Errorf("send ping frame to peer: %w", err)
 		}
 		return nil
 	}
+	// Send via switch path.
+	if switchPath != nil {
+		if err := r.sendBySwitchPath(f, switchPath); err != nil {
+			return fmt.Errorf("send ping frame via switch path: %w", err)
+		}
+		return nil
+	}
 	// Route to destination.
 	if err := r.RouteFrame(f); err != nil {
 		return fmt.Errorf("send ping frame: %w", err)
@@ -263,6 +307,7 @@ func (r *Router) parsePingMsg(f frame.Frame) (hdr *PingHeader, body []byte, err
 	}
 
 	// Unseal ping message.
+	size := frame.Size(f)
 	if err := f.Unseal(session); err != nil {
 		switch {
 		case f.MessageType() == frame.RouterHopPingDeprecated &&
@@ -273,11 +318,21 @@ func (r *Router) parsePingMsg(f frame.Frame) (hdr *PingHeader, body []byte, err
 			// Hop pings may have immediate duplicate frames, as the pings hop and
 			// spread and we might receive variants of the same message from different
 			// peers - eg. router announcements.
+			// Exact replays are caught by the replay cache below.
 		default:
 			return nil, nil, fmt.Errorf("unseal: %w", err)
 		}
 	}
 
+	// Check for replays of signed messages.
+	// The time sequence only rejects older messages of the current session.
+	if f.MessageType().Class() == frame.MessageClassSigned {
+		if err := r.checkReplay(f); err != nil {
+			return nil, nil, err
+		}
+	}
+	r.recordVerified(f.SrcIP(), size)
+
 	// Get header.
 	hdr, dataOffset, err := parsePingHeader(f)
 	if err != nil {
@@ -330,9 +385,12 @@ func parsePingHeader(f frame.Frame) (hdr *PingHeader, dataOffset int, err error)
 
 	// Parse header.
 	hdr = &PingHeader{}
-	if err := cbor.Unmarshal(hdrData, hdr); err != nil {
+	if err := m.UnmarshalControlMsg(hdrData, hdr); err != nil {
 		return nil, 0, fmt.Errorf("unmarshal: %w", err)
 	}
+	if err := m.CheckSchemaVersion(hdr.SchemaVersion, m.SchemaVersionPing); err != nil {
+		return nil, 0, err
+	}
 
 	// Check ping type format.
 	if !pingTypeRegex.MatchString(hdr.PingType) {
@@ -354,14 +412,16 @@ func newPingID() uint64 {
 }
 
 func (r *Router) cleanPingHandlersWorker(w *mgr.WorkerCtx) error {
-	ticker := time.NewTicker(1 * time.Minute)
+	ticker := r.clock.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-w.Done():
 			return nil
-		case <-ticker.C:
+		case <-ticker.C():
 			r.cleanPingHandlers(w)
+			r.cleanReplays()
 		}
 	}
 }
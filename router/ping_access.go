@@ -0,0 +1,335 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	accessPingType = "access"
+
+	accessPingTimeout = 10 * time.Second
+)
+
+// AccessPingHandler handles access pings, which are used to redeem guest tokens.
+type AccessPingHandler struct {
+	r *Router
+
+	active     map[uint64]*accessPingState
+	activeLock sync.Mutex
+
+	granted     map[accessRequestKey]time.Time
+	grantedLock sync.RWMutex
+}
+
+// accessPingState is access ping state.
+type accessPingState struct {
+	result  chan *accessPingMsg
+	expires time.Time
+}
+
+var _ PingHandler = &AccessPingHandler{}
+
+// NewAccessPingHandler returns a new access ping handler.
+func NewAccessPingHandler(r *Router) *AccessPingHandler {
+	return &AccessPingHandler{
+		r:       r,
+		active:  make(map[uint64]*accessPingState),
+		granted: make(map[accessRequestKey]time.Time),
+	}
+}
+
+// Type returns the ping type.
+func (h *AccessPingHandler) Type() string {
+	return accessPingType
+}
+
+func (h *AccessPingHandler) setActive(pingID uint64, pingState *accessPingState) {
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	pingState.expires = h.r.clock.Now().Add(accessPingTimeout)
+	h.active[pingID] = pingState
+}
+
+func (h *AccessPingHandler) pluckActive(pingID uint64) *accessPingState {
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	state, ok := h.active[pingID]
+	if !ok {
+		return nil
+	}
+
+	delete(h.active, pingID)
+	return state
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *AccessPingHandler) Clean(w *mgr.WorkerCtx) error {
+	now := h.r.clock.Now()
+
+	h.activeLock.Lock()
+	for pingID, pingState := range h.active {
+		if now.After(pingState.expires) {
+			delete(h.active, pingID)
+		}
+	}
+	h.activeLock.Unlock()
+
+	h.grantedLock.Lock()
+	for key, expires := range h.granted {
+		if now.After(expires) {
+			delete(h.granted, key)
+		}
+	}
+	h.grantedLock.Unlock()
+
+	return nil
+}
+
+// accessPingMsg is an access ping message.
+type accessPingMsg struct {
+	Token   string `cbor:"t,omitempty"   json:"t,omitempty"`
+	Expires int64  `cbor:"e,omitempty"   json:"e,omitempty"`
+	Err     string `cbor:"err,omitempty" json:"err,omitempty"`
+}
+
+// Redeem sends the given guest token to its issuer and returns when the
+// granted access expires.
+func (h *AccessPingHandler) Redeem(token string) (expires time.Time, err error) {
+	// Parse token to find issuer.
+	guestToken, err := m.ParseGuestToken(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	dst := guestToken.Issuer
+	if dst == h.r.instance.Identity().IP {
+		return time.Time{}, errors.New("guest token was issued by this router")
+	}
+
+	// Make sure encryption is set up, as the token is sent encrypted.
+	session := h.r.instance.State().GetSession(dst)
+	if session == nil || !session.Encryption().IsSetUp() {
+		notify, err := h.r.HelloPing.Send(dst)
+		if err != nil && !errors.Is(err, ErrAlreadyActive) {
+			return time.Time{}, fmt.Errorf("send hello ping: %w", err)
+		}
+		select {
+		case <-notify:
+		case <-time.After(accessPingTimeout):
+			return time.Time{}, errors.New("timed out setting up encryption")
+		}
+	}
+
+	// Create message and marshal it.
+	data, err := cbor.Marshal(&accessPingMsg{
+		Token: token,
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("marshal: %w", err)
+	}
+
+	// Send ping.
+	pingID := newPingID()
+	pingState := &accessPingState{
+		result: make(chan *accessPingMsg, 1),
+	}
+	h.setActive(pingID, pingState)
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      dst,
+		msgType:  frame.RouterCtrl,
+		pingID:   pingID,
+		pingType: accessPingType,
+		pingData: data,
+	})
+	if err != nil {
+		h.pluckActive(pingID)
+		return time.Time{}, fmt.Errorf("send ping: %w", err)
+	}
+
+	// Wait for response.
+	select {
+	case response := <-pingState.result:
+		if response.Err != "" {
+			return time.Time{}, fmt.Errorf("access denied by %s: %s", dst, response.Err)
+		}
+		return time.Unix(response.Expires, 0), nil
+	case <-time.After(accessPingTimeout):
+		h.pluckActive(pingID)
+		return time.Time{}, errors.New("timed out waiting for response")
+	}
+}
+
+// Handle handles incoming ping frames.
+func (h *AccessPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	if f.MessageType() != frame.RouterCtrl {
+		return errors.New("access ping must be encrypted")
+	}
+
+	if hdr.FollowUp {
+		return h.handleResponse(w, f, hdr, data)
+	}
+	return h.handleRequest(w, f, hdr, data)
+}
+
+func (h *AccessPingHandler) handleRequest(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	// Parse request.
+	request := accessPingMsg{}
+	if err := cbor.Unmarshal(data, &request); err != nil {
+		return fmt.Errorf("unmarshal request: %w", err)
+	}
+
+	// Check token and grant access.
+	response := accessPingMsg{}
+	expires, err := h.grant(f.SrcIP(), request.Token)
+	if err != nil {
+		response.Err = err.Error()
+		w.Warn(
+			"guest token rejected",
+			"router", f.SrcIP(),
+			"err", err,
+		)
+	} else {
+		response.Expires = expires.Unix()
+		w.Info(
+			"guest access granted",
+			"router", f.SrcIP(),
+			"expires", expires,
+		)
+	}
+
+	// Send response.
+	data, err = cbor.Marshal(&response)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.RouterCtrl,
+		pingID:   hdr.PingID,
+		pingType: accessPingType,
+		pingData: data,
+		followUp: true,
+	})
+	if err != nil {
+		return fmt.Errorf("send access ping response: %w", err)
+	}
+
+	return nil
+}
+
+func (h *AccessPingHandler) handleResponse(_ *mgr.WorkerCtx, _ frame.Frame, hdr *PingHeader, data []byte) error {
+	// Get ping state.
+	pingState := h.pluckActive(hdr.PingID)
+	if pingState == nil {
+		return errors.New("no state")
+	}
+
+	// Parse response and submit to waiter.
+	response := &accessPingMsg{}
+	if err := cbor.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("unmarshal response: %w", err)
+	}
+	pingState.result <- response
+
+	return nil
+}
+
+func (h *AccessPingHandler) grant(guest netip.Addr, token string) (expires time.Time, err error) {
+	// Verify token.
+	guestToken, err := m.VerifyGuestToken(token, &h.r.instance.Identity().PublicAddress, h.r.clock.Now())
+	if err != nil {
+		return time.Time{}, err
+	}
+	if guestToken.Guest.IsValid() && guestToken.Guest != guest {
+		return time.Time{}, errors.New("guest token was issued to another router")
+	}
+
+	// Check service.
+	svc, ok := h.r.instance.Config().GetService(guestToken.Service)
+	switch {
+	case !ok:
+		return time.Time{}, errors.New("service not found")
+	case svc.Public:
+		return time.Time{}, errors.New("service is public")
+	}
+
+	// Grant access.
+	expires = guestToken.ExpiresAt()
+	h.grantedLock.Lock()
+	h.granted[accessRequestKey{
+		router:  guest,
+		service: svc.Name,
+	}] = expires
+	h.grantedLock.Unlock()
+
+	// Reset connection states so that the policy is re-evaluated.
+	h.r.resetInboundConnStates(guest)
+
+	return expires, nil
+}
+
+// guestAccessUntil returns until when the given router has guest access to
+// the service at the given protocol and port.
+func (h *AccessPingHandler) guestAccessUntil(router netip.Addr, protocol uint8, port uint16) (expires time.Time, ok bool) {
+	svc, ok := h.r.instance.Config().GetServiceByPolicy(protocol, port)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	h.grantedLock.RLock()
+	defer h.grantedLock.RUnlock()
+
+	expires, ok = h.granted[accessRequestKey{
+		router:  router,
+		service: svc.Name,
+	}]
+	if !ok || h.r.clock.Now().After(expires) {
+		return time.Time{}, false
+	}
+	return expires, true
+}
+
+// GuestAccess is a temporary access grant to a service.
+type GuestAccess struct {
+	Router  netip.Addr
+	Service string
+	Expires time.Time
+}
+
+// ExportGuestAccess returns all active guest access grants.
+func (h *AccessPingHandler) ExportGuestAccess() []GuestAccess {
+	h.grantedLock.RLock()
+	defer h.grantedLock.RUnlock()
+
+	now := h.r.clock.Now()
+	export := make([]GuestAccess, 0, len(h.granted))
+	for key, expires := range h.granted {
+		if now.After(expires) {
+			continue
+		}
+		export = append(export, GuestAccess{
+			Router:  key.router,
+			Service: key.service,
+			Expires: expires,
+		})
+	}
+
+	// Sort.
+	slices.SortFunc[[]GuestAccess, GuestAccess](export, func(a, b GuestAccess) int {
+		return a.Expires.Compare(b.Expires)
+	})
+
+	return export
+}
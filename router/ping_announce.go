@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net/netip"
+	"sync/atomic"
 	"time"
 
 	"github.com/fxamacker/cbor/v2"
 
+	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
@@ -18,13 +20,45 @@ import (
 const (
 	announcePingType = "announce"
 	announceInterval = 5 * time.Minute
+
+	// maxAnnounceValidity is the maximum validity of an announcement with a
+	// skewed clock.
+	maxAnnounceValidity = 2 * announceInterval
+
+	// maxAnnounceAttachmentSize is the maximum size of a single attachment
+	// including its signature. Attachments are about 160 bytes.
+	maxAnnounceAttachmentSize = 192
 )
 
-var errAnnouncementIsLooping = errors.New("announcement is looping")
+var (
+	errAnnouncementIsLooping  = errors.New("announcement is looping")
+	errAnnouncementIsTooLong  = errors.New("announcement passed too many routers")
+	errAnnouncementIsTooLarge = errors.New("announcement appendix is too large")
+)
 
 // AnnouncePingHandler handles announce pings.
 type AnnouncePingHandler struct {
 	r *Router
+
+	// dropped counts announcements dropped for exceeding the hop limit.
+	dropped atomic.Uint64
+	// stopped counts announcements not forwarded, as they reached the hop limit.
+	stopped atomic.Uint64
+
+	// sigVerifier verifies and caches the signatures of announcements.
+	sigVerifier *m.SigVerifier
+}
+
+// AnnounceStats holds statistics of announcement forwarding.
+type AnnounceStats struct {
+	// MaxHops is how many routers an announcement may pass.
+	MaxHops int
+	// Dropped counts announcements dropped for exceeding the hop limit.
+	Dropped uint64
+	// Stopped counts announcements not forwarded, as they reached the hop limit.
+	Stopped uint64
+	// Sigs holds statistics of the signature verification of announcements.
+	Sigs m.SigVerifierStats
 }
 
 var _ PingHandler = &AnnouncePingHandler{}
@@ -32,7 +66,8 @@ var _ PingHandler = &AnnouncePingHandler{}
 // NewAnnouncePingHandler returns a new announce ping handler.
 func NewAnnouncePingHandler(r *Router) *AnnouncePingHandler {
 	return &AnnouncePingHandler{
-		r: r,
+		r:           r,
+		sigVerifier: m.NewSigVerifier(m.DefaultSigCacheSize, m.DefaultSigCacheTTL),
 	}
 }
 
@@ -48,12 +83,23 @@ func (h *AnnouncePingHandler) Clean(w *mgr.WorkerCtx) error {
 
 // AnnouncePingMsg is an announce ping message.
 type AnnouncePingMsg struct {
+	SchemaVersion uint8 `cbor:"sv,omitempty" json:"sv,omitempty"`
+
 	Info        *m.RouterInfo `cbor:"i,omitempty" json:"i,omitempty"`
 	ReturnLabel m.SwitchLabel `cbor:"b,omitempty" json:"b,omitempty"`
 	// Stub signifies that the router is a dead end:
 	// It only has 1 peer or only lite peers.
 	Stub    bool      `cbor:"s,omitempty" json:"s,omitempty"`
 	Expires time.Time `cbor:"e,omitempty" json:"e,omitempty"`
+	// PeerOnly signifies that the announcement is meant for the receiving
+	// peer only and must not be forwarded.
+	PeerOnly bool `cbor:"po,omitempty" json:"po,omitempty"`
+	// Minimal signifies that the announcing router does not reveal its
+	// router info. Known router info must not be replaced.
+	Minimal bool `cbor:"mi,omitempty" json:"mi,omitempty"`
+	// Draining signifies that the link to the announcing router is draining.
+	// The receiving peer must not route to other routers via it anymore.
+	Draining bool `cbor:"dr,omitempty" json:"dr,omitempty"`
 }
 
 // AnnouncePingAttachment is an announce ping attachment.
@@ -66,7 +112,8 @@ type AnnouncePingAttachment struct {
 	NextAttachment []byte `cbor:"n,omitempty" json:"n,omitempty"`
 }
 
-// Send sends a hello message to the given destination.
+// Send announces the router to the network via the given peer, as defined by
+// the announce policy.
 func (h *AnnouncePingHandler) Send(peer netip.Addr) error {
 	// Get link of peer where to send announcement to.
 	link := h.r.instance.Peering().GetLink(peer)
@@ -74,13 +121,32 @@ func (h *AnnouncePingHandler) Send(peer netip.Addr) error {
 		return errors.New("peer link not found")
 	}
 
+	// Check what to announce to the peer.
+	level := h.r.instance.Config().AnnounceLevelFor(peer, link.Lite())
+	if level == config.AnnouncePeer && !h.r.RemoteCapabilities(peer).Has(m.CapPeerAnnounce) {
+		// The peer would forward the announcement.
+		level = config.AnnounceNone
+	}
+	if level == config.AnnounceNone {
+		return nil
+	}
+
 	// Get info to announce and marshal.
-	msg := AnnouncePingMsg{}
-	msg.Info = h.r.instance.Config().GetRouterInfo()
-	msg.Info.Version = h.r.instance.Version()
+	msg := AnnouncePingMsg{SchemaVersion: m.SchemaVersionAnnounce}
+	if level == config.AnnounceMinimal {
+		msg.Minimal = true
+	} else {
+		msg.Info = h.r.instance.Config().GetRouterInfo()
+		msg.Info.Version = h.r.instance.Version()
+		msg.Info.Groups = h.r.GroupPing.Groups()
+		msg.Info.Reachability = h.r.instance.Peering().ReachabilityHints()
+		msg.Info.Capabilities = m.LocalCapabilities
+	}
+	msg.PeerOnly = level == config.AnnouncePeer
+	msg.Draining = h.r.instance.Peering().IsDraining(peer)
 	msg.ReturnLabel = link.SwitchLabel()
-	msg.Expires = time.Now().Add(announceInterval*2 + 10*time.Second)
-	msg.Stub = h.r.instance.Config().Router.Stub || h.r.instance.Peering().IsStub()
+	msg.Expires = h.r.clock.Now().Add(AnnounceValidity)
+	msg.Stub = h.r.instance.Config().IsStub() || h.r.instance.Peering().IsStub()
 	data, err := cbor.Marshal(&msg)
 	if err != nil {
 		return fmt.Errorf("marshal: %w", err)
@@ -89,6 +155,7 @@ func (h *AnnouncePingHandler) Send(peer netip.Addr) error {
 	// Send announcement.
 	err = h.r.sendPingMsg(sendPingOpts{
 		dst:      m.RouterAddress,
+		viaPeer:  peer,
 		msgType:  frame.RouterHopPingDeprecated,
 		pingType: announcePingType,
 		pingData: data,
@@ -108,6 +175,12 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 		return errors.New("announce ping requires recv link for handling")
 	}
 
+	// Drop announcements that are too large before verifying the attachments.
+	if len(f.AppendixData()) > h.maxHops()*maxAnnounceAttachmentSize {
+		h.dropped.Add(1)
+		return fmt.Errorf("%w: %d bytes", errAnnouncementIsTooLarge, len(f.AppendixData()))
+	}
+
 	// Parse announement ping, including appendix data.
 	msg, hops, err := h.parseAnnouncePing(f, data)
 	if err != nil {
@@ -115,6 +188,9 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 		if errors.Is(err, errAnnouncementIsLooping) {
 			return nil
 		}
+		if errors.Is(err, errAnnouncementIsTooLong) {
+			h.dropped.Add(1)
+		}
 
 		return fmt.Errorf("parse announce ping: %w", err)
 	}
@@ -129,59 +205,78 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 		return errors.New("last announce ping attachment does not match peer")
 	}
 
+	// Do not route via draining links.
+	switch {
+	case len(hops) > 0 && h.r.instance.Peering().IsDraining(recvLink.Peer()):
+		return nil
+	case len(hops) == 0 && msg.Draining:
+		if removed := h.r.table.RemoveTransit(recvLink.Peer()); removed > 0 {
+			w.Info(
+				"removed routes via draining peer",
+				"router", recvLink.Peer(),
+				"removed", removed,
+			)
+		}
+	}
+
 	// Add router info to state.
-	err = h.r.instance.State().AddPublicRouterInfo(f.SrcIP(), msg.Info)
-	if err != nil {
-		w.Error(
-			"failed to save public router info",
-			"router", f.SrcIP(),
-			"err", err,
-		)
+	// Minimal announcements must not replace router info received otherwise.
+	if !msg.Minimal {
+		if msg.Info != nil {
+			msg.Info.Clean()
+		}
+		err = h.r.instance.State().AddPublicRouterInfo(f.SrcIP(), msg.Info)
+		if err != nil {
+			w.Error(
+				"failed to save public router info",
+				"router", f.SrcIP(),
+				"err", err,
+			)
+		}
+	}
+
+	// Leaf routers do not keep gossip routes, but still need the router info
+	// of other routers, eg. for their capabilities.
+	if len(hops) > 0 {
+		if _, ok := h.r.leafPeer(); ok {
+			return nil
+		}
 	}
 
 	// Add route to routing table.
-	switchPath := m.SwitchPath{
-		Hops: make([]m.SwitchHop, 0, len(hops)+2),
-	}
-	// Add own entry as first.
-	switchPath.Hops = append(switchPath.Hops, m.SwitchHop{
-		Router:       h.r.instance.Identity().IP,
-		Delay:        recvLink.Latency(),
-		ForwardLabel: recvLink.SwitchLabel(),
-		ReturnLabel:  0,
-	})
-	// Add stacked hops in reverse order.
-	for _, hop := range hops {
-		switchPath.Hops = append(switchPath.Hops, m.SwitchHop{
-			Router:       hop.Router,
-			Delay:        hop.Delay,
-			ForwardLabel: hop.ForwardLabel,
-			ReturnLabel:  hop.ReturnLabel,
-		})
+	announcement := &ReceivedAnnouncement{
+		Router:      h.r.instance.Identity().IP,
+		Peer:        recvLink.Peer(),
+		Delay:       recvLink.Latency(),
+		Label:       recvLink.SwitchLabel(),
+		Src:         f.SrcIP(),
+		ReturnLabel: msg.ReturnLabel,
+		Stub:        msg.Stub,
+		Hops:        hops,
 	}
-	// Add announcing router as last.
-	switchPath.Hops = append(switchPath.Hops, m.SwitchHop{
-		Router:       f.SrcIP(),
-		Delay:        0,
-		ForwardLabel: 0,
-		ReturnLabel:  msg.ReturnLabel,
-	})
-	switchPath.CalculateTotals()
-	// Create table entry.
-	rte := m.RoutingTableEntry{
-		DstIP:   f.SrcIP(),
-		NextHop: recvLink.Peer(),
-		Path:    switchPath,
-		Stub:    msg.Stub,
-		Source:  m.RouteSourcePeer,
+	rte := announcement.Route()
+	rte.Announced = f.SequenceTime()
+	// Down-score routes through peers with a large geo marker mismatch.
+	if penalty := h.r.instance.Peering().GeoMismatchPenalty(recvLink.Peer()); penalty > 0 {
+		rte.DelayPenalty = uint16(penalty.Milliseconds())
 	}
+	// Flag and de-prioritize routes with physically impossible delays.
+	h.r.checkGeoDelays(w, &rte)
 	if len(hops) > 0 {
-		rte.Source = m.RouteSourceGossip
-		rte.Expires = msg.Expires
+		rte.Expires = h.announceExpiry(f, msg)
 	}
 	// Add to table.
 	added, err := h.r.table.AddRoute(rte)
 	switch {
+	case errors.Is(err, m.ErrRouteHeldDown):
+		// Stale announcement of a withdrawn route.
+		// Do not forward.
+		w.Debug(
+			"ignoring announcement of held down route",
+			"router", f.SrcIP(),
+			"nexthop", recvLink.Peer(),
+		)
+		return nil
 	case err != nil:
 		w.Warn(
 			"failed to add entry to routing table",
@@ -193,7 +288,7 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 			"updated routing entry",
 			"router", f.SrcIP(),
 			"nexthop", recvLink.Peer(),
-			"hops", switchPath.TotalHops,
+			"hops", rte.Path.TotalHops,
 		)
 	default:
 		// Not added to routing table.
@@ -201,8 +296,15 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 		return nil
 	}
 
-	// Never forward if router is a stub.
-	if h.r.instance.Config().Router.Stub {
+	// Never forward if router is a stub or invisible, or the announcement is
+	// for us only.
+	if h.r.instance.Config().IsStub() || h.r.instance.Config().Router.Invisible || msg.PeerOnly {
+		return nil
+	}
+
+	// Do not forward if receivers would drop the announcement.
+	if len(hops) >= h.maxHops() {
+		h.stopped.Add(1)
 		return nil
 	}
 
@@ -222,7 +324,7 @@ func (h *AnnouncePingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingH
 
 	// Forward to all peers, except where it came from.
 	apx := f.AppendixData()
-	signingContext := h.signingContext(f)
+	signingContext := AnnounceSigningContext(f)
 forwardToPeers:
 	for _, sendLink := range forwardTo {
 		// Check if the announcement should be forwarded to this link.
@@ -237,32 +339,26 @@ forwardToPeers:
 			// Except, when this router is in lite mode too.
 			continue forwardToPeers
 
-		case sendLink.Peer() == f.SrcIP():
-			// Do not send to announcing router.
+		case !announcement.ForwardTo(sendLink.Peer()):
+			// Do not send to announcing router, back to link where it came
+			// from or to peers which are already in the hops.
 			continue forwardToPeers
 
-		case sendLink.Peer() == recvLink.Peer():
-			// Do not send back to link where it came from.
+		case h.r.instance.Peering().IsDraining(sendLink.Peer()):
+			// Do not offer routes to peers on draining links.
 			continue forwardToPeers
-
-		default:
-			// Do not send to peers which are already in the hops.
-			for _, hop := range hops {
-				if sendLink.Peer() == hop.Router {
-					continue forwardToPeers
-				}
-			}
 		}
 
 		// Clone frame.
 		fwd := f.Clone()
 
 		// Marshal attachment.
+		hop := announcement.ForwardHop(sendLink.SwitchLabel())
 		attach := AnnouncePingAttachment{
 			Router:         h.r.instance.Identity().PublicAddress,
-			Delay:          recvLink.Latency(),
-			ForwardLabel:   recvLink.SwitchLabel(),
-			ReturnLabel:    sendLink.SwitchLabel(),
+			Delay:          hop.Delay,
+			ForwardLabel:   hop.ForwardLabel,
+			ReturnLabel:    hop.ReturnLabel,
 			NextAttachment: apx,
 		}
 		attachData, err := cbor.Marshal(attach)
@@ -295,7 +391,42 @@ forwardToPeers:
 	return nil
 }
 
-func (h *AnnouncePingHandler) signingContext(f frame.Frame) []byte {
+// announceExpiry returns the expiry of the announcement in local time.
+// If the clock of the announcing router is skewed, the expiry is adjusted
+// using the signed sequence time of the frame, which is set by the same
+// clock as the expiry.
+func (h *AnnouncePingHandler) announceExpiry(f frame.Frame, msg *AnnouncePingMsg) time.Time {
+	now := h.r.clock.Now()
+	if f.SequenceTime().Sub(now).Abs() <= m.ClockSkewTolerance {
+		return msg.Expires
+	}
+
+	validFor := msg.Expires.Sub(f.SequenceTime())
+	validFor = min(max(validFor, 0), maxAnnounceValidity)
+	return now.Add(validFor)
+}
+
+// maxHops returns how many routers an announcement may pass.
+func (h *AnnouncePingHandler) maxHops() int {
+	if maxHops := h.r.instance.Config().MaxAnnounceHops; maxHops > 0 {
+		return maxHops
+	}
+	return config.DefaultMaxAnnounceHops
+}
+
+// Stats returns statistics of announcement forwarding.
+func (h *AnnouncePingHandler) Stats() AnnounceStats {
+	return AnnounceStats{
+		MaxHops: h.maxHops(),
+		Dropped: h.dropped.Load(),
+		Stopped: h.stopped.Load(),
+		Sigs:    h.sigVerifier.Stats(),
+	}
+}
+
+// AnnounceSigningContext returns the context that the attachments of the
+// given announce frame are signed with.
+func AnnounceSigningContext(f frame.Frame) []byte {
 	context := make([]byte,
 		16+ // Source IP
 			8+ // Ping Timestamp
@@ -312,24 +443,24 @@ func (h *AnnouncePingHandler) signingContext(f frame.Frame) []byte {
 func (h *AnnouncePingHandler) parseAnnouncePing(f frame.Frame, pingData []byte) (*AnnouncePingMsg, []m.SwitchHop, error) {
 	// Parse announce msg.
 	msg := &AnnouncePingMsg{}
-	err := cbor.Unmarshal(pingData, msg)
+	err := m.UnmarshalControlMsg(pingData, msg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unmarshal message data: %w", err)
 	}
+	if err := m.CheckSchemaVersion(msg.SchemaVersion, m.SchemaVersionAnnounce); err != nil {
+		return nil, nil, err
+	}
 
 	// Parse switch path.
 	hops := make([]m.SwitchHop, 0, 10) // TODO: Can we estimate this better?
+	sigChecks := make([]m.SigCheck, 0, 10)
 	apx := f.AppendixData()
-	signingContext := h.signingContext(f)
-	for i := 1; i <= 100; i++ {
-		// Check if there is data left.
-		if len(apx) == 0 {
-			break
-		}
-
-		// Stop at some point.
-		if i == 100 {
-			return nil, nil, errors.New("max recursion of 100 reached")
+	signingContext := AnnounceSigningContext(f)
+	maxHops := h.maxHops()
+	for i := 1; len(apx) > 0; i++ {
+		// Stop at the hop limit.
+		if i > maxHops {
+			return nil, nil, fmt.Errorf("%w: limit is %d", errAnnouncementIsTooLong, maxHops)
 		}
 
 		// Check size of appendix data.
@@ -339,13 +470,16 @@ func (h *AnnouncePingHandler) parseAnnouncePing(f frame.Frame, pingData []byte)
 
 		// Parse attachment.
 		attached := AnnouncePingAttachment{}
-		err := cbor.Unmarshal(apx[:len(apx)-64], &attached)
+		err := m.UnmarshalControlMsg(apx[:len(apx)-64], &attached)
 		if err != nil {
 			return nil, nil, fmt.Errorf("unmarshal announce attachment at layer %d: %w", i, err)
 		}
+		if len(apx)-len(attached.NextAttachment) > maxAnnounceAttachmentSize {
+			return nil, nil, fmt.Errorf("%w: attachment at layer %d has %d bytes", errAnnouncementIsTooLarge, i, len(apx)-len(attached.NextAttachment))
+		}
 
-		// Check if this us.
-		if attached.Router.IP == h.r.instance.Identity().IP {
+		// Check if this is us or the announcement already passed this router.
+		if announceHopIsLooping(h.r.instance.Identity().IP, f.SrcIP(), hops, attached.Router.IP) {
 			return nil, nil, errAnnouncementIsLooping
 		}
 
@@ -355,12 +489,14 @@ func (h *AnnouncePingHandler) parseAnnouncePing(f frame.Frame, pingData []byte)
 			return nil, nil, fmt.Errorf("get session for %s at layer %d: %w", attached.Router.IP, i, err)
 		}
 
-		// Verify signature.
+		// Queue signature for verification.
 		sigStart := len(apx) - 64
-		err = session.Address().VerifySigWithContext(apx[:sigStart], apx[sigStart:], signingContext)
-		if err != nil {
-			return nil, nil, fmt.Errorf("verify attachment of %s at layer %d: %w", attached.Router.IP, i, err)
-		}
+		sigChecks = append(sigChecks, m.SigCheck{
+			PublicKey: session.Address().PublicKey,
+			Data:      apx[:sigStart],
+			Sig:       apx[sigStart:],
+			Context:   signingContext,
+		})
 
 		// Add hop to list.
 		hops = append(hops, m.SwitchHop{
@@ -374,6 +510,17 @@ func (h *AnnouncePingHandler) parseAnnouncePing(f frame.Frame, pingData []byte)
 		apx = attached.NextAttachment
 	}
 
+	// Verify all signatures, cached ones are skipped.
+	// Announcements arriving over multiple peers share most of them.
+	var batchErr *m.SigBatchError
+	err = h.sigVerifier.VerifyBatch(sigChecks)
+	switch {
+	case errors.As(err, &batchErr):
+		return nil, nil, fmt.Errorf("verify attachment of %s at layer %d: %w", hops[batchErr.Index].Router, batchErr.Index+1, err)
+	case err != nil:
+		return nil, nil, fmt.Errorf("verify attachments: %w", err)
+	}
+
 	return msg, hops, nil
 }
 
@@ -403,20 +550,35 @@ func (h *AnnouncePingHandler) sessionFromAnnouncePingAttachment(a *AnnouncePingA
 
 func (r *Router) announceWorker(w *mgr.WorkerCtx) error {
 	// Try to announce first time 5 seconds after start.
-	time.Sleep(5 * time.Second)
+	select {
+	case <-w.Done():
+		return nil
+	case <-r.clock.After(5 * time.Second):
+	}
 	r.announceRouter(w)
 
-	ticker := time.NewTicker(announceInterval)
+	ticker := r.clock.NewTicker(announceInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-w.Done():
 			return nil
-		case <-ticker.C:
+		case <-ticker.C():
+			r.announceRouter(w)
+		case <-r.triggerAnnounce:
 			r.announceRouter(w)
 		}
 	}
 }
 
+// TriggerAnnounce triggers announcing the router to all peers.
+func (r *Router) TriggerAnnounce() {
+	select {
+	case r.triggerAnnounce <- struct{}{}:
+	default:
+	}
+}
+
 func (r *Router) announceRouter(w *mgr.WorkerCtx) {
 	for _, link := range r.instance.Peering().GetLinks() {
 		if err := r.AnnouncePing.Send(link.Peer()); err != nil {
@@ -0,0 +1,86 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
+)
+
+type announceTestInstance struct {
+	instance
+	config   *config.Config
+	identity *m.Address
+	state    *state.State
+	builder  *frame.Builder
+}
+
+func (i *announceTestInstance) Config() *config.Config { return i.config }
+func (i *announceTestInstance) Identity() *m.Address   { return i.identity }
+func (i *announceTestInstance) State() *state.State    { return i.state }
+func (i *announceTestInstance) FrameBuilder() *frame.Builder {
+	return i.builder
+}
+
+func TestAnnounceHopLimit(t *testing.T) {
+	t.Parallel()
+
+	newAddress := func() *m.Address {
+		t.Helper()
+
+		addr, _, err := m.GeneratePrivacyAddress(context.Background())
+		require.NoError(t, err)
+		return addr
+	}
+	inst := &announceTestInstance{
+		config: config.MakeTestConfig(config.Store{
+			Router: config.Router{MaxAnnounceHops: 3},
+		}),
+		identity: newAddress(),
+		builder:  frame.NewFrameBuilder(),
+	}
+	inst.state = state.New(inst, storage.NewMemStorage())
+	h := NewAnnouncePingHandler(&Router{instance: inst})
+
+	// Create announcement.
+	origin := newAddress()
+	pingData, err := cbor.Marshal(&AnnouncePingMsg{})
+	require.NoError(t, err)
+	b := frame.NewFrameBuilder()
+	f, err := b.NewFrameV1(origin.IP, m.RouterAddress, frame.RouterHopPing, nil, pingData, nil)
+	require.NoError(t, err)
+	signingContext := AnnounceSigningContext(f)
+
+	// Add hops until the limit is exceeded.
+	var apx []byte
+	for hop := 1; hop <= 4; hop++ {
+		forwarder := newAddress()
+		attachData, err := cbor.Marshal(&AnnouncePingAttachment{
+			Router:         forwarder.PublicAddress,
+			NextAttachment: apx,
+		})
+		require.NoError(t, err)
+		sig, err := forwarder.SignWithContext(attachData, signingContext)
+		require.NoError(t, err)
+		apx = append(attachData, sig...) //nolint:gocritic
+		assert.LessOrEqual(t, len(apx), hop*maxAnnounceAttachmentSize, "attachments should fit the size limit")
+		f, err := b.NewFrameV1(origin.IP, m.RouterAddress, frame.RouterHopPing, nil, pingData, apx)
+		require.NoError(t, err)
+
+		_, hops, err := h.parseAnnouncePing(f, pingData)
+		if hop <= 3 {
+			require.NoError(t, err)
+			assert.Len(t, hops, hop)
+		} else {
+			assert.ErrorIs(t, err, errAnnouncementIsTooLong)
+		}
+	}
+}
@@ -110,8 +110,10 @@ func (h *DisconnectPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *Pin
 		msg.Disconnected = nil
 	}
 
-	// Remove any applicable routes.
+	// Remove any applicable routes and hold them down, so that they are not
+	// re-learned from stale announcements.
 	removed := h.r.table.RemoveDisconnected(f.SrcIP(), nil)
+	h.r.table.HoldDown(f.SrcIP(), f.SequenceTime())
 
 	// If nothing was removed, do not process further.
 	if removed == 0 {
@@ -125,8 +127,8 @@ func (h *DisconnectPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *Pin
 		"count", removed,
 	)
 
-	// Never forward if router is a stub.
-	if h.r.instance.Config().Router.Stub {
+	// Never forward if router is a stub or invisible.
+	if h.r.instance.Config().IsStub() || h.r.instance.Config().Router.Invisible {
 		return nil
 	}
 
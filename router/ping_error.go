@@ -42,6 +42,20 @@ type routerErrorState struct {
 
 var _ PingHandler = &ErrorPingHandler{}
 
+// EventError is emitted when another router reports an error via an error
+// ping.
+type EventError struct {
+	// Router is the router that reported the error.
+	Router netip.Addr
+	Code   m.ErrorCode
+	// Dst is the destination the error is about, if known.
+	Dst netip.Addr
+}
+
+func newErrorEventMgr() *mgr.EventMgr[*EventError] {
+	return mgr.NewEventMgr[*EventError]("error pings", nil)
+}
+
 // NewErrorPingHandler returns a new announce ping handler.
 func NewErrorPingHandler(r *Router) *ErrorPingHandler {
 	return &ErrorPingHandler{
@@ -63,7 +77,7 @@ func (h *ErrorPingHandler) getOrCreateState(remote netip.Addr) *routerErrorState
 	state, ok := h.routerStates[remote]
 	if ok {
 		// Update last activity and return.
-		state.lastActivity = time.Now()
+		state.lastActivity = h.r.clock.Now()
 		return state
 	}
 
@@ -71,7 +85,7 @@ func (h *ErrorPingHandler) getOrCreateState(remote netip.Addr) *routerErrorState
 	state = &routerErrorState{
 		sent:         make(map[errCode]time.Time),
 		rcvd:         make(map[errCode]time.Time),
-		lastActivity: time.Now(),
+		lastActivity: h.r.clock.Now(),
 	}
 	h.routerStates[remote] = state
 	return state
@@ -84,13 +98,13 @@ func (h *ErrorPingHandler) maySend(errCode errCode, remote netip.Addr) bool {
 
 	// Check if we have a record for this error.
 	lastSent, ok := state.sent[errCode]
-	if ok && time.Since(lastSent) < errorSendCooldown {
+	if ok && h.r.clock.Now().Sub(lastSent) < errorSendCooldown {
 		// If within cooldown, don't send again.
 		return false
 	}
 
 	// If not sent or outside of cooldown, update timestamp and allow sending.
-	state.sent[errCode] = time.Now()
+	state.sent[errCode] = h.r.clock.Now()
 	return true
 }
 
@@ -101,13 +115,13 @@ func (h *ErrorPingHandler) mayRecv(errCode errCode, remote netip.Addr) bool {
 
 	// Check if we have a record for this error.
 	lastRcvd, ok := state.rcvd[errCode]
-	if ok && time.Since(lastRcvd) < errorRecvCooldown {
+	if ok && h.r.clock.Now().Sub(lastRcvd) < errorRecvCooldown {
 		// If within cooldown, don't receive again.
 		return false
 	}
 
 	// If not received or outside of cooldown, update timestamp and allow sending.
-	state.rcvd[errCode] = time.Now()
+	state.rcvd[errCode] = h.r.clock.Now()
 	return true
 }
 
@@ -116,7 +130,7 @@ func (h *ErrorPingHandler) Clean(w *mgr.WorkerCtx) error {
 	h.routerStatesLock.Lock()
 	defer h.routerStatesLock.Unlock()
 
-	deleteOlderThan := time.Now().Add(-errorCleanup)
+	deleteOlderThan := h.r.clock.Now().Add(-errorCleanup)
 	for remote, state := range h.routerStates {
 		if state.lastActivity.Before(deleteOlderThan) {
 			delete(h.routerStates, remote)
@@ -147,6 +161,10 @@ const (
 	// Rejected for technical or operational reason.
 	// Reply with ICMP error 1.6: "reject route to destination".
 	pingCodeErrorRejected errCode = 4
+
+	// Frame was dropped by a relay, because its TTL expired.
+	// Indicates a routing loop towards the destination.
+	pingCodeErrorTTLExpired errCode = 5
 )
 
 type unreachableMsg struct {
@@ -159,6 +177,10 @@ type accessDeniedMsg struct {
 	DstPort  uint16     `cbor:"p,omitempty" json:"p,omitempty"`
 }
 
+type ttlExpiredMsg struct {
+	DstIP netip.Addr `cbor:"d,omitempty" json:"d,omitempty"`
+}
+
 // SendGeneric sends a generic error.
 func (h *ErrorPingHandler) SendGeneric(to netip.Addr, text string) error {
 	return h.sendError(to, frame.RouterPing, pingCodeErrorGeneric, text)
@@ -194,6 +216,13 @@ func (h *ErrorPingHandler) SendRejected(to netip.Addr, dstIP netip.Addr, protoco
 	})
 }
 
+// SendTTLExpired sends a TTL expired error.
+func (h *ErrorPingHandler) SendTTLExpired(to netip.Addr, dstIP netip.Addr) error {
+	return h.sendError(to, frame.RouterPing, pingCodeErrorTTLExpired, &ttlExpiredMsg{
+		DstIP: dstIP,
+	})
+}
+
 // Send sends a hello message to the given destination.
 func (h *ErrorPingHandler) sendError(to netip.Addr, msgType frame.MessageType, errCode errCode, data any) error {
 	// Check if we may send.
@@ -255,6 +284,7 @@ func (h *ErrorPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHead
 			return fmt.Errorf("unmarshal: %w", err)
 		}
 		h.r.markRouter(connStatusUnreachable, msg.Unreachable)
+		h.submitEvent(f.SrcIP(), errCode(hdr.PingCode), msg.Unreachable)
 		w.Debug(
 			"received unreachable error",
 			"router", f.SrcIP(),
@@ -266,6 +296,10 @@ func (h *ErrorPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHead
 		// router to setup up new encryption keys.
 		// Error is only returned when router has no session.
 		_ = h.r.instance.State().SetEncryptionSession(f.SrcIP(), nil)
+		// The router also does not hold a matching resumption ticket.
+		_ = h.r.instance.State().DeleteResumptionTicket(f.SrcIP())
+		h.r.HelloPing.abortResume(f.SrcIP())
+		h.submitEvent(f.SrcIP(), errCode(hdr.PingCode), netip.Addr{})
 		w.Debug(
 			"received no encryption keys error",
 			"router", f.SrcIP(),
@@ -278,6 +312,7 @@ func (h *ErrorPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHead
 		if err != nil {
 			return fmt.Errorf("unmarshal: %w", err)
 		}
+		h.submitEvent(f.SrcIP(), errCode(hdr.PingCode), msg.DstIP)
 		if errCode(hdr.PingCode) == pingCodeErrorAccessDenied {
 			h.r.markConnectionDst(connStatusDenied, msg.DstIP, msg.Protocol, msg.DstPort)
 			w.Debug(
@@ -298,6 +333,24 @@ func (h *ErrorPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHead
 			)
 		}
 
+	case pingCodeErrorTTLExpired:
+		// Parse error message.
+		msg := &ttlExpiredMsg{}
+		err := cbor.Unmarshal(data, msg)
+		if err != nil {
+			return fmt.Errorf("unmarshal: %w", err)
+		}
+		if !msg.DstIP.IsValid() {
+			return nil
+		}
+		h.r.recordLoopSuspicion(msg.DstIP, f.SrcIP())
+		h.submitEvent(f.SrcIP(), errCode(hdr.PingCode), msg.DstIP)
+		w.Debug(
+			"received TTL expired error, route might be looping",
+			"router", f.SrcIP(),
+			"dst", msg.DstIP,
+		)
+
 	default:
 		w.Debug(
 			"received unknown error ping",
@@ -310,6 +363,34 @@ func (h *ErrorPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHead
 	return nil
 }
 
+func (h *ErrorPingHandler) submitEvent(router netip.Addr, errCode errCode, dst netip.Addr) {
+	if h.r.ErrorEvents != nil {
+		h.r.ErrorEvents.Submit(&EventError{
+			Router: router,
+			Code:   errCode.Code(),
+			Dst:    dst,
+		})
+	}
+}
+
+// Code returns the error code of the error ping code.
+func (errCode errCode) Code() m.ErrorCode {
+	switch errCode {
+	case pingCodeErrorUnreachable:
+		return m.CodeNoRoute
+	case pingCodeErrorNoEncryptionKeys:
+		return m.CodeNoEncryptionKeys
+	case pingCodeErrorAccessDenied:
+		return m.CodePolicyDenied
+	case pingCodeErrorRejected:
+		return m.CodeRejected
+	case pingCodeErrorTTLExpired:
+		return m.CodeTTLExpired
+	default:
+		return ""
+	}
+}
+
 func (errCode errCode) String() string {
 	switch errCode {
 	case pingCodeErrorGeneric:
@@ -322,6 +403,8 @@ func (errCode errCode) String() string {
 		return "access denied"
 	case pingCodeErrorRejected:
 		return "rejected"
+	case pingCodeErrorTTLExpired:
+		return "TTL expired"
 	default:
 		return "unknown"
 	}
@@ -0,0 +1,397 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/storage"
+)
+
+const (
+	groupPingType = "group"
+
+	// MaxGroupMessageSize is the maximum size of a group message.
+	MaxGroupMessageSize = 512
+	// maxGroupMembers is the maximum amount of members a message is delivered to.
+	maxGroupMembers = 64
+	// groupFanout is the amount of members every router forwards a message to.
+	groupFanout = 4
+	// groupMsgValidity defines how long a group message is accepted after it
+	// was published.
+	groupMsgValidity = 2 * time.Minute
+)
+
+// Group errors.
+var (
+	ErrGroupInvalid    = errors.New("invalid group")
+	ErrGroupConfigured = errors.New("group is joined in the config")
+	ErrGroupLimit      = errors.New("too many groups")
+	ErrGroupTooBig     = errors.New("group message is too big")
+)
+
+var groupSigContext = []byte("mycoria group message")
+
+// GroupPingHandler handles group pings, which deliver messages published to
+// a group to its members.
+// Messages are delivered along a tree: The publisher sends the message to a
+// few members, which forward it to a part of the remaining members each.
+type GroupPingHandler struct {
+	r *Router
+
+	joined map[string]struct{}
+	seen   map[groupMsgKey]time.Time
+	lock   sync.Mutex
+
+	// Events receives all messages published to joined groups.
+	Events *mgr.EventMgr[*GroupMessage]
+}
+
+var _ PingHandler = &GroupPingHandler{}
+
+// GroupMessage is a message published to a group.
+type GroupMessage struct {
+	Group     string     `json:"group"`
+	Publisher netip.Addr `json:"publisher"`
+	ID        uint64     `json:"id"`
+	Time      time.Time  `json:"time"`
+	Data      []byte     `json:"data"`
+}
+
+type groupMsgKey struct {
+	publisher netip.Addr
+	id        uint64
+}
+
+// groupPingMsg is a group ping message.
+type groupPingMsg struct {
+	// Msg is the marshaled groupMsg, signed by the publisher.
+	Msg []byte `cbor:"m"`
+	Sig []byte `cbor:"s"`
+	// Forward holds the members the receiving router forwards the message to.
+	Forward []netip.Addr `cbor:"f,omitempty"`
+}
+
+// groupMsg is a message published to a group.
+type groupMsg struct {
+	Group     string          `cbor:"g"`
+	Publisher m.PublicAddress `cbor:"p"`
+	ID        uint64          `cbor:"i"`
+	Time      time.Time       `cbor:"t"`
+	Data      []byte          `cbor:"d,omitempty"`
+}
+
+// NewGroupPingHandler returns a new group ping handler.
+func NewGroupPingHandler(r *Router) *GroupPingHandler {
+	return &GroupPingHandler{
+		r:      r,
+		joined: make(map[string]struct{}),
+		seen:   make(map[groupMsgKey]time.Time),
+		Events: mgr.NewEventMgr[*GroupMessage]("group messages", nil),
+	}
+}
+
+// Type returns the ping type.
+func (h *GroupPingHandler) Type() string {
+	return groupPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *GroupPingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := h.r.clock.Now()
+	for key, expires := range h.seen {
+		if now.After(expires) {
+			delete(h.seen, key)
+		}
+	}
+
+	return nil
+}
+
+// Groups returns all joined groups, including the groups from the config.
+func (h *GroupPingHandler) Groups() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	groups := slices.Clone(h.r.instance.Config().Router.Groups)
+	for group := range h.joined {
+		if !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	slices.Sort(groups)
+	return groups
+}
+
+// IsMember returns whether the router is a member of the given group.
+func (h *GroupPingHandler) IsMember(group string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	_, joined := h.joined[group]
+	return joined || slices.Contains(h.r.instance.Config().Router.Groups, group)
+}
+
+// Join joins the given group until the next restart.
+// Other routers learn about the membership with the next announcement.
+func (h *GroupPingHandler) Join(group string) error {
+	if err := m.CheckGroupName(group); err != nil {
+		return fmt.Errorf("%w: %w", ErrGroupInvalid, err)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	configured := h.r.instance.Config().Router.Groups
+	if slices.Contains(configured, group) {
+		return nil
+	}
+	if len(h.joined)+len(configured) >= m.MaxRouterGroups {
+		return ErrGroupLimit
+	}
+	h.joined[group] = struct{}{}
+	return nil
+}
+
+// Leave leaves the given group. Groups joined in the config cannot be left.
+func (h *GroupPingHandler) Leave(group string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if slices.Contains(h.r.instance.Config().Router.Groups, group) {
+		return ErrGroupConfigured
+	}
+	delete(h.joined, group)
+	return nil
+}
+
+// Members returns the known members of the given group, nearest first.
+// The router itself is not included.
+func (h *GroupPingHandler) Members(group string) ([]netip.Addr, error) {
+	self := h.r.instance.Identity().IP
+	q := storage.NewRouterQuery(
+		func(a *storage.StoredRouter) bool {
+			return !a.Offline &&
+				a.Address.IP != self &&
+				a.PublicInfo != nil &&
+				slices.Contains(a.PublicInfo.Groups, group) &&
+				a.Universe == h.r.instance.Config().Router.Universe
+		},
+		func(a, b *storage.StoredRouter) int {
+			aDist := m.IPDistance(self, a.Address.IP)
+			bDist := m.IPDistance(self, b.Address.IP)
+			return aDist.Compare(bDist)
+		},
+		maxGroupMembers,
+	)
+	if err := h.r.instance.State().QueryRouters(q); err != nil {
+		return nil, err
+	}
+
+	members := make([]netip.Addr, 0, len(q.Result()))
+	for _, member := range q.Result() {
+		members = append(members, member.Address.IP)
+	}
+	return members, nil
+}
+
+// Publish publishes the given data to all known members of the group.
+// Messages are delivered on a best effort basis.
+// Returns the amount of members the message is sent to.
+func (h *GroupPingHandler) Publish(group string, data []byte) (members int, err error) {
+	if err := m.CheckGroupName(group); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrGroupInvalid, err)
+	}
+	if len(data) > MaxGroupMessageSize {
+		return 0, ErrGroupTooBig
+	}
+
+	// Create and sign message.
+	identity := h.r.instance.Identity()
+	msg := groupMsg{
+		Group:     group,
+		Publisher: identity.PublicAddress,
+		ID:        newPingID(),
+		Time:      h.r.clock.Now(),
+		Data:      data,
+	}
+	msgData, sig, err := h.sign(&msg)
+	if err != nil {
+		return 0, err
+	}
+	h.markSeen(msg.Publisher.IP, msg.ID)
+
+	// Send to members.
+	recipients, err := h.Members(group)
+	if err != nil {
+		return 0, fmt.Errorf("get members: %w", err)
+	}
+	if err := h.forward(msgData, sig, recipients); err != nil {
+		return 0, err
+	}
+	return len(recipients), nil
+}
+
+// forward sends the message to the first member of each branch, which in
+// turn forward it to the rest of their branch.
+func (h *GroupPingHandler) forward(msgData, sig []byte, recipients []netip.Addr) error {
+	var errs []error
+	branches := groupBranches(recipients)
+	for _, branch := range branches {
+		data, err := cbor.Marshal(&groupPingMsg{
+			Msg:     msgData,
+			Sig:     sig,
+			Forward: branch[1:],
+		})
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+		err = h.r.sendPingMsg(sendPingOpts{
+			dst:      branch[0],
+			msgType:  frame.RouterPing,
+			pingType: groupPingType,
+			pingData: data,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("send to %s: %w", branch[0], err))
+		}
+	}
+	// Only fail if no branch could be sent to.
+	if len(errs) > 0 && len(errs) == len(branches) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// groupBranches splits the recipients into up to groupFanout branches.
+// As recipients are sorted by distance, branches consist of nearby routers.
+func groupBranches(recipients []netip.Addr) [][]netip.Addr {
+	if len(recipients) == 0 {
+		return nil
+	}
+	size := (len(recipients) + groupFanout - 1) / groupFanout
+	branches := make([][]netip.Addr, 0, groupFanout)
+	for len(recipients) > 0 {
+		n := min(size, len(recipients))
+		branches = append(branches, recipients[:n])
+		recipients = recipients[n:]
+	}
+	return branches
+}
+
+// Handle handles incoming ping frames.
+func (h *GroupPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	if hdr.FollowUp {
+		return errors.New("group pings have no follow up")
+	}
+
+	// Parse and verify message.
+	ping := groupPingMsg{}
+	if err := cbor.Unmarshal(data, &ping); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+	if len(ping.Forward) > maxGroupMembers {
+		return fmt.Errorf("group message from %s has too many members to forward to", f.SrcIP())
+	}
+	msg, err := h.verify(&ping)
+	if err != nil {
+		return fmt.Errorf("invalid group message from %s: %w", f.SrcIP(), err)
+	}
+	if !h.markSeen(msg.Publisher.IP, msg.ID) {
+		return nil
+	}
+
+	// Forward to own branch, but only to known members, so that the tree
+	// cannot be abused to send messages to arbitrary routers.
+	if len(ping.Forward) > 0 {
+		known, err := h.Members(msg.Group)
+		if err != nil {
+			return fmt.Errorf("get members: %w", err)
+		}
+		forward := slices.DeleteFunc(slices.Clone(ping.Forward), func(ip netip.Addr) bool {
+			return ip == msg.Publisher.IP || !slices.Contains(known, ip)
+		})
+		if err := h.forward(ping.Msg, ping.Sig, forward); err != nil {
+			w.Debug(
+				"failed to forward group message",
+				"group", msg.Group,
+				"publisher", msg.Publisher.IP,
+				"err", err,
+			)
+		}
+	}
+
+	// Deliver locally.
+	if h.IsMember(msg.Group) {
+		h.Events.Submit(&GroupMessage{
+			Group:     msg.Group,
+			Publisher: msg.Publisher.IP,
+			ID:        msg.ID,
+			Time:      msg.Time,
+			Data:      msg.Data,
+		})
+	}
+	return nil
+}
+
+// sign marshals and signs the given group message.
+func (h *GroupPingHandler) sign(msg *groupMsg) (msgData, sig []byte, err error) {
+	msgData, err = cbor.Marshal(msg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal: %w", err)
+	}
+	sig, err = h.r.instance.Identity().SignWithContext(msgData, groupSigContext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sign: %w", err)
+	}
+	return msgData, sig, nil
+}
+
+// verify parses and verifies the group message of the ping.
+func (h *GroupPingHandler) verify(ping *groupPingMsg) (*groupMsg, error) {
+	msg := &groupMsg{}
+	if err := cbor.Unmarshal(ping.Msg, msg); err != nil {
+		return nil, fmt.Errorf("unmarshal group message: %w", err)
+	}
+	if err := m.CheckGroupName(msg.Group); err != nil {
+		return nil, err
+	}
+	if len(msg.Data) > MaxGroupMessageSize {
+		return nil, ErrGroupTooBig
+	}
+	now := h.r.clock.Now()
+	if msg.Time.Before(now.Add(-groupMsgValidity)) || msg.Time.After(now.Add(groupMsgValidity)) {
+		return nil, errors.New("message expired or from the future")
+	}
+	if err := msg.Publisher.VerifyAddress(); err != nil {
+		return nil, fmt.Errorf("invalid publisher: %w", err)
+	}
+	if err := msg.Publisher.VerifySigWithContext(ping.Msg, ping.Sig, groupSigContext); err != nil {
+		return nil, errors.New("invalid signature")
+	}
+	return msg, nil
+}
+
+// markSeen marks the message as seen and returns whether it is new.
+func (h *GroupPingHandler) markSeen(publisher netip.Addr, id uint64) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := groupMsgKey{publisher: publisher, id: id}
+	if _, ok := h.seen[key]; ok {
+		return false
+	}
+	h.seen[key] = h.r.clock.Now().Add(2 * groupMsgValidity)
+	return true
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+type groupTestInstance struct {
+	deniedTestInstance
+	identity *m.Address
+}
+
+func (i *groupTestInstance) Identity() *m.Address { return i.identity }
+
+func TestGroupBranches(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, groupBranches(nil))
+
+	recipients := make([]netip.Addr, 10)
+	ip := netip.MustParseAddr("fd00::1")
+	for i := range recipients {
+		recipients[i] = ip
+		ip = ip.Next()
+	}
+	branches := groupBranches(recipients)
+	require.Len(t, branches, groupFanout)
+	var covered []netip.Addr
+	for _, branch := range branches {
+		covered = append(covered, branch...)
+	}
+	assert.Equal(t, recipients, covered, "every recipient must be in exactly one branch")
+}
+
+func TestGroupMessages(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock: clock,
+		instance: &groupTestInstance{
+			deniedTestInstance: deniedTestInstance{
+				config: config.MakeTestConfig(config.Store{
+					Router: config.Router{Groups: []string{"configured"}},
+				}),
+			},
+			identity: identity,
+		},
+	}
+	h := NewGroupPingHandler(r)
+
+	// Memberships.
+	require.NoError(t, h.Join("joined"))
+	assert.Error(t, h.Join("not valid"))
+	assert.Equal(t, []string{"configured", "joined"}, h.Groups())
+	assert.True(t, h.IsMember("joined"))
+	assert.ErrorIs(t, h.Leave("configured"), ErrGroupConfigured)
+	require.NoError(t, h.Leave("joined"))
+	assert.False(t, h.IsMember("joined"))
+
+	// Signed messages are verified.
+	msg := &groupMsg{
+		Group:     "configured",
+		Publisher: identity.PublicAddress,
+		ID:        1,
+		Time:      clock.Now(),
+		Data:      []byte("hello"),
+	}
+	msgData, sig, err := h.sign(msg)
+	require.NoError(t, err)
+	verified, err := h.verify(&groupPingMsg{Msg: msgData, Sig: sig})
+	require.NoError(t, err)
+	assert.Equal(t, msg.Data, verified.Data)
+	assert.Equal(t, identity.IP, verified.Publisher.IP)
+
+	// Tampered messages are rejected.
+	tampered := append([]byte(nil), msgData...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = h.verify(&groupPingMsg{Msg: tampered, Sig: sig})
+	assert.Error(t, err)
+
+	// Old messages are rejected.
+	clock.Advance(groupMsgValidity + time.Second)
+	_, err = h.verify(&groupPingMsg{Msg: msgData, Sig: sig})
+	assert.Error(t, err)
+
+	// Messages are only handled once.
+	assert.True(t, h.markSeen(identity.IP, 1))
+	assert.False(t, h.markSeen(identity.IP, 1))
+}
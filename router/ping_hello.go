@@ -11,11 +11,18 @@ import (
 	"github.com/fxamacker/cbor/v2"
 
 	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
 	"github.com/mycoria/mycoria/state"
 )
 
-const helloPingType = "hello"
+const (
+	helloPingType = "hello"
+
+	// helloResumeTimeout defines how long to wait for the acknowledgement of
+	// a session resumption.
+	helloResumeTimeout = 10 * time.Second
+)
 
 // HelloPingHandler handles hello pings.
 type HelloPingHandler struct {
@@ -31,6 +38,9 @@ type HelloPingHandler struct {
 type helloPingState struct {
 	pingID     uint64
 	encSession *state.EncryptionSession
+	// resume is set if encSession is a resumed session, which is only used
+	// after the router acknowledged the resumption.
+	resume bool
 
 	done    atomic.Bool
 	notify  chan struct{}
@@ -92,6 +102,12 @@ type HelloPingRequest struct {
 	KeyExchangeType string `cbor:"kxt,omitempty" json:"kxt,omitempty"`
 
 	MTU int `cbor:"mtu,omitempty" json:"mtu,omitempty"`
+
+	// ResumeTicket and ResumeNonce request to resume the previous session with
+	// a resumption ticket instead of a key exchange. The response acknowledges
+	// the resumption with Resumed or reports an error.
+	ResumeTicket []byte `cbor:"rt,omitempty" json:"rt,omitempty"`
+	ResumeNonce  []byte `cbor:"rn,omitempty" json:"rn,omitempty"`
 }
 
 // HelloPingResponse is a hello ping response.
@@ -101,6 +117,9 @@ type HelloPingResponse struct {
 
 	MTU int `cbor:"mtu,omitempty" json:"mtu,omitempty"`
 
+	// Resumed acknowledges a session resumption.
+	Resumed bool `cbor:"res,omitempty" json:"res,omitempty"`
+
 	Err string `cbor:"err,omitempty" json:"err,omitempty"`
 }
 
@@ -114,16 +133,31 @@ func (h *HelloPingHandler) Send(dstIP netip.Addr) (notify <-chan struct{}, err e
 	if pingState := h.getActive(dstIP); pingState != nil {
 		return pingState.notify, ErrAlreadyActive
 	}
+
+	// Resume previous session instead, if possible.
+	if pingState := h.resume(dstIP); pingState != nil {
+		return pingState.notify, nil
+	}
+
 	pingState := &helloPingState{
-		pingID: newPingID(),
 		notify: make(chan struct{}),
 	}
+	if err := h.sendKeyExchange(dstIP, pingState); err != nil {
+		return nil, err
+	}
+	return pingState.notify, nil
+}
+
+// sendKeyExchange sends a hello ping with a key exchange and sets the given
+// state as active.
+func (h *HelloPingHandler) sendKeyExchange(dstIP netip.Addr, pingState *helloPingState) error {
+	pingState.pingID = newPingID()
 
 	// Initialize encryption session decoupled, as destination may not be known.
 	pingState.encSession = state.NewEncryptionSession()
 	kxKey, kxType, err := pingState.encSession.InitKeyClientStart()
 	if err != nil {
-		return nil, fmt.Errorf("init key exchange: %w", err)
+		return fmt.Errorf("init key exchange: %w", err)
 	}
 
 	// Create request and send it.
@@ -134,7 +168,7 @@ func (h *HelloPingHandler) Send(dstIP netip.Addr) (notify <-chan struct{}, err e
 	}
 	data, err := cbor.Marshal(&request)
 	if err != nil {
-		return nil, fmt.Errorf("marshal: %w", err)
+		return fmt.Errorf("marshal: %w", err)
 	}
 
 	// Send new ping.
@@ -146,7 +180,7 @@ func (h *HelloPingHandler) Send(dstIP netip.Addr) (notify <-chan struct{}, err e
 		pingData: data,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("send ping: %w", err)
+		return fmt.Errorf("send ping: %w", err)
 	}
 
 	h.r.mgr.Debug(
@@ -157,7 +191,106 @@ func (h *HelloPingHandler) Send(dstIP netip.Addr) (notify <-chan struct{}, err e
 	// Ping is sent, add expiry and save to state.
 	pingState.expires = time.Now().Add(30 * time.Second)
 	h.setActive(dstIP, pingState)
-	return pingState.notify, nil
+	return nil
+}
+
+// Resume starts resuming the encrypted session with the given router using a
+// stored resumption ticket. Returns whether a resumption or another hello
+// ping with the router is in progress.
+func (h *HelloPingHandler) Resume(dstIP netip.Addr) bool {
+	h.sendLock.Lock()
+	defer h.sendLock.Unlock()
+
+	if h.getActive(dstIP) != nil {
+		return true
+	}
+	return h.resume(dstIP) != nil
+}
+
+// resume sends a request to resume the session with the given router and
+// returns the active ping state. Returns nil if the session cannot be resumed.
+func (h *HelloPingHandler) resume(dstIP netip.Addr) *helloPingState {
+	// Only resume with routers that keep resumption tickets.
+	if !h.r.instance.State().RouterCapabilities(dstIP).Has(m.CapSessionResumption) {
+		return nil
+	}
+
+	// Prepare resumption.
+	pingState, request, err := h.prepareResume(dstIP)
+	if err != nil {
+		if !errors.Is(err, state.ErrNoResumptionTicket) {
+			h.r.mgr.Debug(
+				"failed to resume session",
+				"router", dstIP,
+				"err", err,
+			)
+		}
+		return nil
+	}
+
+	// Send request.
+	data, err := cbor.Marshal(request)
+	if err == nil {
+		err = h.r.sendPingMsg(sendPingOpts{
+			dst:      dstIP,
+			msgType:  frame.RouterPing,
+			pingID:   pingState.pingID,
+			pingType: helloPingType,
+			pingData: data,
+		})
+	}
+	if err != nil {
+		// The ticket was not used, fall back to a key exchange.
+		h.r.mgr.Debug(
+			"failed to send resume hello ping",
+			"router", dstIP,
+			"err", err,
+		)
+		return nil
+	}
+
+	h.r.mgr.Debug(
+		"requested session resumption",
+		"router", dstIP,
+	)
+	h.setActive(dstIP, pingState)
+	return pingState
+}
+
+// prepareResume prepares the ping state and request for resuming the session
+// with the given router. The current session and ticket are kept until the
+// router acknowledges the resumption.
+func (h *HelloPingHandler) prepareResume(dstIP netip.Addr) (*helloPingState, *HelloPingRequest, error) {
+	ticketID, nonce, encSession, err := h.r.instance.State().ResumeSession(dstIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pingState := &helloPingState{
+		pingID:     newPingID(),
+		encSession: encSession,
+		resume:     true,
+		notify:     make(chan struct{}),
+		expires:    time.Now().Add(helloResumeTimeout),
+	}
+	request := &HelloPingRequest{
+		MTU:          h.r.instance.Config().TunMTU(),
+		ResumeTicket: ticketID,
+		ResumeNonce:  nonce,
+	}
+	return pingState, request, nil
+}
+
+// abortResume drops a pending resumption with the given router, so that the
+// next hello ping does a key exchange.
+func (h *HelloPingHandler) abortResume(remote netip.Addr) {
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	if pingState := h.active[remote]; pingState != nil &&
+		pingState.resume && !pingState.done.Load() {
+		delete(h.active, remote)
+	}
 }
 
 // Handle handles incoming ping frames.
@@ -175,6 +308,11 @@ func (h *HelloPingHandler) handlePingHelloRequest(w *mgr.WorkerCtx, f frame.Fram
 		return fmt.Errorf("unmarshal request: %w", err)
 	}
 
+	// Resume session, if requested.
+	if len(request.ResumeTicket) > 0 {
+		return h.handleResumeRequest(w, f, hdr, &request)
+	}
+
 	// Do key exchange.
 	session := h.r.instance.State().GetSession(f.SrcIP())
 	if session == nil {
@@ -184,6 +322,13 @@ func (h *HelloPingHandler) handlePingHelloRequest(w *mgr.WorkerCtx, f frame.Fram
 	if err != nil {
 		return fmt.Errorf("server key exchange: %w", err)
 	}
+	if err := h.r.instance.State().SaveResumptionTicket(f.SrcIP(), session.Encryption()); err != nil {
+		w.Debug(
+			"failed to save resumption ticket",
+			"router", f.SrcIP(),
+			"err", err,
+		)
+	}
 	if request.MTU > 0 {
 		session.SetTunMTU(request.MTU)
 	}
@@ -239,12 +384,23 @@ func (h *HelloPingHandler) handlePingHelloResponse(w *mgr.WorkerCtx, f frame.Fra
 		return errors.New("hello response already processed")
 	}
 
+	if pingState.resume {
+		return h.handleResumeResponse(w, f.SrcIP(), pingState, &response)
+	}
+
 	// Finalize key exchange and set it.
 	err := pingState.encSession.InitKeyClientComplete(response.KeyExchange, response.KeyExchangeType)
 	if err != nil {
 		return fmt.Errorf("complete client key exchange: %w", err)
 	}
 	pingState.encSession.InitCleanup()
+	if err := h.r.instance.State().SaveResumptionTicket(f.SrcIP(), pingState.encSession); err != nil {
+		w.Debug(
+			"failed to save resumption ticket",
+			"router", f.SrcIP(),
+			"err", err,
+		)
+	}
 
 	// Save to session.
 	session := h.r.instance.State().GetSession(f.SrcIP())
@@ -267,3 +423,111 @@ func (h *HelloPingHandler) handlePingHelloResponse(w *mgr.WorkerCtx, f frame.Fra
 	)
 	return nil
 }
+
+func (h *HelloPingHandler) handleResumeRequest(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, request *HelloPingRequest) error {
+	// Resume session and acknowledge, or let the router fall back to a key
+	// exchange.
+	response, resumeErr := h.acceptResume(f.SrcIP(), request)
+	data, err := cbor.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.RouterPing,
+		pingID:   hdr.PingID,
+		pingType: helloPingType,
+		pingData: data,
+		followUp: true,
+	})
+	if err != nil {
+		return fmt.Errorf("send resume response: %w", err)
+	}
+	if resumeErr != nil {
+		return fmt.Errorf("resume session: %w", resumeErr)
+	}
+
+	w.Debug(
+		"resumed session (server)",
+		"router", f.SrcIP(),
+	)
+	return nil
+}
+
+// acceptResume resumes the session with the router as requested and returns
+// the response to send.
+func (h *HelloPingHandler) acceptResume(src netip.Addr, request *HelloPingRequest) (*HelloPingResponse, error) {
+	err := h.r.instance.State().AcceptResumption(src, request.ResumeTicket, request.ResumeNonce)
+	if err != nil {
+		return &HelloPingResponse{
+			Err: "cannot resume session",
+		}, err
+	}
+	if request.MTU > 0 {
+		if session := h.r.instance.State().GetSession(src); session != nil {
+			session.SetTunMTU(request.MTU)
+		}
+	}
+
+	return &HelloPingResponse{
+		MTU:     h.r.instance.Config().TunMTU(),
+		Resumed: true,
+	}, nil
+}
+
+func (h *HelloPingHandler) handleResumeResponse(w *mgr.WorkerCtx, src netip.Addr, pingState *helloPingState, response *HelloPingResponse) error {
+	// Fall back to a key exchange, if the router cannot resume the session.
+	if !response.Resumed {
+		_ = h.r.instance.State().DeleteResumptionTicket(src)
+		w.Debug(
+			"session resumption rejected, falling back to key exchange",
+			"router", src,
+			"err", response.Err,
+		)
+
+		h.sendLock.Lock()
+		defer h.sendLock.Unlock()
+
+		// Notify the waiters of the resumption when the key exchange is done.
+		fallback := &helloPingState{
+			notify: pingState.notify,
+		}
+		if err := h.sendKeyExchange(src, fallback); err != nil {
+			h.activeLock.Lock()
+			delete(h.active, src)
+			h.activeLock.Unlock()
+			return fmt.Errorf("fall back to key exchange: %w", err)
+		}
+		return nil
+	}
+
+	// Switch to the resumed session.
+	if err := h.completeResume(src, pingState, response); err != nil {
+		return err
+	}
+
+	w.Debug(
+		"resumed session (client)",
+		"router", src,
+	)
+	return nil
+}
+
+// completeResume switches to the resumed session, after the router
+// acknowledged the resumption.
+func (h *HelloPingHandler) completeResume(src netip.Addr, pingState *helloPingState, response *HelloPingResponse) error {
+	if err := h.r.instance.State().CompleteResumption(src, pingState.encSession); err != nil {
+		return fmt.Errorf("complete resumption: %w", err)
+	}
+	if response.MTU > 0 {
+		if session := h.r.instance.State().GetSession(src); session != nil {
+			session.SetTunMTU(response.MTU)
+		}
+	}
+
+	// Notify waiters, set cooldown (to block too quick requests) and save.
+	close(pingState.notify)
+	pingState.expires = time.Now().Add(5 * time.Second)
+	h.setActive(src, pingState)
+	return nil
+}
@@ -0,0 +1,109 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestHelloResume(t *testing.T) {
+	t.Parallel()
+
+	// Create two routers that know each other.
+	newRouter := func() (*announceTestInstance, *HelloPingHandler) {
+		t.Helper()
+
+		identity, _, err := m.GeneratePrivacyAddress(context.Background())
+		require.NoError(t, err)
+		inst := &announceTestInstance{
+			config:   config.MakeTestConfig(config.Store{}),
+			identity: identity,
+			builder:  frame.NewFrameBuilder(),
+		}
+		inst.state = state.New(inst, storage.NewMemStorage())
+		return inst, NewHelloPingHandler(&Router{instance: inst, clock: m.SystemClock})
+	}
+	a, helloA := newRouter()
+	b, helloB := newRouter()
+	require.NoError(t, a.state.AddRouter(&b.identity.PublicAddress))
+	require.NoError(t, b.state.AddRouter(&a.identity.PublicAddress))
+	sessionA := a.state.GetSession(b.identity.IP)
+	sessionB := b.state.GetSession(a.identity.IP)
+
+	// Set up encryption with key exchange.
+	kxKey, kxType, err := sessionA.Encryption().InitKeyClientStart()
+	require.NoError(t, err)
+	kxKey, kxType, err = sessionB.Encryption().InitKeyServer(kxKey, kxType)
+	require.NoError(t, err)
+	require.NoError(t, sessionA.Encryption().InitKeyClientComplete(kxKey, kxType))
+	sessionA.Encryption().InitCleanup()
+	sessionB.Encryption().InitCleanup()
+	require.NoError(t, a.state.SaveResumptionTicket(b.identity.IP, sessionA.Encryption()))
+	require.NoError(t, b.state.SaveResumptionTicket(a.identity.IP, sessionB.Encryption()))
+
+	// send seals a frame on one router and unseals it on the other.
+	send := func(from, to *announceTestInstance) error {
+		t.Helper()
+
+		f, err := from.builder.NewFrameV1(from.identity.IP, to.identity.IP, frame.SessionData, nil, []byte("hello"), nil)
+		require.NoError(t, err)
+		require.NoError(t, f.Seal(from.state.GetSession(to.identity.IP)))
+		return f.Unseal(to.state.GetSession(from.identity.IP))
+	}
+	require.NoError(t, send(a, b))
+	require.NoError(t, send(b, a))
+
+	// A lost resume request does not change anything.
+	_, _, err = helloA.prepareResume(b.identity.IP)
+	require.NoError(t, err)
+	require.NoError(t, send(a, b))
+	require.NoError(t, send(b, a))
+
+	// The session is resumed with the same ticket, but only used by the
+	// client when the router acknowledges it.
+	pingState, request, err := helloA.prepareResume(b.identity.IP)
+	require.NoError(t, err)
+	response, err := helloB.acceptResume(a.identity.IP, request)
+	require.NoError(t, err)
+	assert.True(t, response.Resumed)
+	require.ErrorIs(t, send(a, b), frame.ErrDecryptionFailed, "client must keep old keys until acknowledged")
+	require.NoError(t, helloA.completeResume(b.identity.IP, pingState, response))
+	require.NoError(t, send(a, b))
+	require.NoError(t, send(b, a))
+
+	// If the acknowledgement is lost, the keys differ and repeated decryption
+	// failures are detected.
+	_, request, err = helloA.prepareResume(b.identity.IP)
+	require.NoError(t, err)
+	_, err = helloB.acceptResume(a.identity.IP, request)
+	require.NoError(t, err)
+	var fallback bool
+	for range 10 {
+		err := send(a, b)
+		require.ErrorIs(t, err, frame.ErrDecryptionFailed)
+		if sessionB.DecryptionFailed() {
+			fallback = true
+			break
+		}
+	}
+	assert.True(t, fallback, "repeated decryption failures must trigger a key exchange")
+
+	// Resuming again with the old ticket is rejected, so that the client falls
+	// back to a key exchange.
+	_, request, err = helloA.prepareResume(b.identity.IP)
+	require.NoError(t, err)
+	response, err = helloB.acceptResume(a.identity.IP, request)
+	require.Error(t, err)
+	assert.False(t, response.Resumed)
+	assert.NotEmpty(t, response.Err)
+	_, _, _, err = b.state.ResumeSession(a.identity.IP)
+	require.ErrorIs(t, err, state.ErrNoResumptionTicket, "mismatching ticket must be deleted")
+}
@@ -0,0 +1,154 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	knockPingType = "knock"
+
+	// knockValidity defines how long a knock opens a hidden service for new
+	// connections of the knocking router.
+	knockValidity = 5 * time.Minute
+)
+
+// KnockPingHandler handles knock pings, which are used to open hidden services.
+// Knock pings are never answered, so that hidden services stay hidden.
+type KnockPingHandler struct {
+	r *Router
+
+	knocked     map[accessRequestKey]time.Time
+	knockedLock sync.RWMutex
+}
+
+var _ PingHandler = &KnockPingHandler{}
+
+// NewKnockPingHandler returns a new knock ping handler.
+func NewKnockPingHandler(r *Router) *KnockPingHandler {
+	return &KnockPingHandler{
+		r:       r,
+		knocked: make(map[accessRequestKey]time.Time),
+	}
+}
+
+// Type returns the ping type.
+func (h *KnockPingHandler) Type() string {
+	return knockPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *KnockPingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.knockedLock.Lock()
+	defer h.knockedLock.Unlock()
+
+	now := h.r.clock.Now()
+	for key, expires := range h.knocked {
+		if now.After(expires) {
+			delete(h.knocked, key)
+		}
+	}
+
+	return nil
+}
+
+// knockPingMsg is a knock ping message.
+type knockPingMsg struct {
+	Protocol uint8  `cbor:"p,omitempty" json:"p,omitempty"`
+	Port     uint16 `cbor:"o,omitempty" json:"o,omitempty"`
+}
+
+// Send sends a knock ping for the given protocol and port to the given destination.
+func (h *KnockPingHandler) Send(dstIP netip.Addr, protocol uint8, port uint16) error {
+	// Create message and marshal it.
+	data, err := cbor.Marshal(&knockPingMsg{
+		Protocol: protocol,
+		Port:     port,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	// Send ping.
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      dstIP,
+		msgType:  frame.RouterPing,
+		pingType: knockPingType,
+		pingData: data,
+	})
+	if err != nil {
+		return fmt.Errorf("send ping: %w", err)
+	}
+
+	return nil
+}
+
+// Handle handles incoming ping frames.
+func (h *KnockPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	if hdr.FollowUp {
+		return errors.New("knock pings have no follow up")
+	}
+
+	// Parse request.
+	msg := knockPingMsg{}
+	if err := cbor.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+
+	// Check if there is a hidden service.
+	svc, ok := h.r.instance.Config().GetServiceByPolicy(msg.Protocol, msg.Port)
+	if !ok || !svc.Hidden {
+		return nil
+	}
+
+	// Check if remote is allowed to access the service at all.
+	if !h.r.instance.Config().CheckInboundTrafficPolicy(msg.Protocol, msg.Port, f.SrcIP()) {
+		if _, ok := h.r.AccessPing.guestAccessUntil(f.SrcIP(), msg.Protocol, msg.Port); !ok {
+			w.Debug(
+				"ignoring knock from unauthorized router",
+				"router", f.SrcIP(),
+				"protocol", msg.Protocol,
+				"port", msg.Port,
+			)
+			return nil
+		}
+	}
+
+	// Open hidden service for remote.
+	h.knockedLock.Lock()
+	h.knocked[accessRequestKey{
+		router:  f.SrcIP(),
+		service: svc.Name,
+	}] = h.r.clock.Now().Add(knockValidity)
+	h.knockedLock.Unlock()
+
+	// Reset connection states so that the policy is re-evaluated.
+	h.r.resetInboundConnStates(f.SrcIP())
+
+	w.Debug(
+		"hidden service opened by knock",
+		"router", f.SrcIP(),
+		"service", svc.Name,
+	)
+	return nil
+}
+
+// hasKnocked returns whether the given router knocked on the given service recently.
+func (h *KnockPingHandler) hasKnocked(router netip.Addr, service string) bool {
+	h.knockedLock.RLock()
+	defer h.knockedLock.RUnlock()
+
+	expires, ok := h.knocked[accessRequestKey{
+		router:  router,
+		service: service,
+	}]
+	return ok && h.r.clock.Now().Before(expires)
+}
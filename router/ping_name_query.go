@@ -0,0 +1,363 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/storage"
+)
+
+const (
+	nameQueryPingType = "namequery"
+
+	// nameQueryTimeout defines how long name query state is kept.
+	nameQueryTimeout = 30 * time.Second
+	// nameAnswerValidity defines how long a signed name answer is accepted
+	// after it was made.
+	nameAnswerValidity = 2 * time.Minute
+	// nameAdvertisedMaxAge defines how recently a router must have been
+	// updated for its advertised domains to be used in answers.
+	nameAdvertisedMaxAge = 24 * time.Hour
+	// maxNameAdvertisingRouters limits the amount of routers checked for
+	// advertised domains.
+	maxNameAdvertisingRouters = 10_000
+)
+
+// Name query errors.
+var (
+	ErrNameNotFound = errors.New("name not found")
+	ErrNameConflict = errors.New("name is claimed by multiple routers")
+)
+
+var nameSigContext = []byte("mycoria name answer")
+
+// NameQueryPingHandler handles name query pings, which ask a router which
+// router a .myco domain belongs to. Routers answer with their own advertised
+// services and with the ones advertised by other routers they know of.
+// Answers are signed by the answering router.
+type NameQueryPingHandler struct {
+	r *Router
+
+	active     map[uint64]*nameQueryState
+	activeLock sync.Mutex
+}
+
+type nameQueryState struct {
+	router  netip.Addr
+	answer  chan *nameQueryMsg
+	expires time.Time
+}
+
+var _ PingHandler = &NameQueryPingHandler{}
+
+// NameAnswer is an answer to a name query.
+type NameAnswer struct {
+	Domain string `cbor:"n"`
+	// Router is the router the domain belongs to.
+	Router netip.Addr `cbor:"r"`
+	// Answerer is the router that answered the query.
+	Answerer m.PublicAddress `cbor:"a"`
+	// Time is when the answer was made.
+	Time time.Time `cbor:"t"`
+}
+
+// Authoritative returns whether the answer was given by the router the
+// domain belongs to. This is only a claim of the answering router and must be
+// verified, see NameQueryPingHandler.Advertises.
+func (a *NameAnswer) Authoritative() bool {
+	return a.Router == a.Answerer.IP
+}
+
+// nameQueryMsg is a name query or answer.
+type nameQueryMsg struct {
+	// Domain is the queried domain.
+	Domain string `cbor:"n,omitempty"`
+	// Answer is the marshaled NameAnswer, signed by the answering router.
+	// Empty if the answering router does not know the domain.
+	Answer []byte `cbor:"a,omitempty"`
+	Sig    []byte `cbor:"s,omitempty"`
+}
+
+// NewNameQueryPingHandler returns a new name query ping handler.
+func NewNameQueryPingHandler(r *Router) *NameQueryPingHandler {
+	return &NameQueryPingHandler{
+		r:      r,
+		active: make(map[uint64]*nameQueryState),
+	}
+}
+
+// Type returns the ping type.
+func (h *NameQueryPingHandler) Type() string {
+	return nameQueryPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *NameQueryPingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	now := h.r.clock.Now()
+	for pingID, state := range h.active {
+		if now.After(state.expires) {
+			delete(h.active, pingID)
+		}
+	}
+
+	return nil
+}
+
+// Query asks the given router which router the domain belongs to.
+// Returns ErrNameNotFound if the router does not know the domain.
+func (h *NameQueryPingHandler) Query(ctx context.Context, domain string, router netip.Addr) (*NameAnswer, error) {
+	// Create message and marshal it.
+	data, err := cbor.Marshal(&nameQueryMsg{
+		Domain: domain,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	// Create state and send query.
+	pingID := newPingID()
+	state := &nameQueryState{
+		router:  router,
+		answer:  make(chan *nameQueryMsg, 1),
+		expires: h.r.clock.Now().Add(nameQueryTimeout),
+	}
+	h.activeLock.Lock()
+	h.active[pingID] = state
+	h.activeLock.Unlock()
+	defer func() {
+		h.activeLock.Lock()
+		defer h.activeLock.Unlock()
+		delete(h.active, pingID)
+	}()
+
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      router,
+		msgType:  frame.RouterPing,
+		pingID:   pingID,
+		pingType: nameQueryPingType,
+		pingData: data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send ping: %w", err)
+	}
+
+	// Wait for answer.
+	var msg *nameQueryMsg
+	select {
+	case msg = <-state.answer:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if len(msg.Answer) == 0 {
+		return nil, ErrNameNotFound
+	}
+
+	// Check answer.
+	answer, err := h.verify(msg)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case answer.Domain != domain:
+		return nil, errors.New("name answer is for another domain")
+	case answer.Answerer.IP != router:
+		return nil, errors.New("name answer is signed by another router")
+	}
+	return answer, nil
+}
+
+// Handle handles incoming ping frames.
+func (h *NameQueryPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	msg := nameQueryMsg{}
+	if err := m.UnmarshalControlMsg(data, &msg); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+
+	if hdr.FollowUp {
+		return h.handleAnswer(f, hdr, &msg)
+	}
+	return h.handleQuery(w, f, hdr, &msg)
+}
+
+func (h *NameQueryPingHandler) handleQuery(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, msg *nameQueryMsg) error {
+	// Invisible routers do not reveal what they know.
+	if h.r.instance.Config().Router.Invisible {
+		return nil
+	}
+	domain, ok := config.CleanDomain(msg.Domain)
+	if !ok || domain != msg.Domain {
+		return fmt.Errorf("queried domain %q is invalid", msg.Domain)
+	}
+
+	// Answer with the router of the domain, if we know it.
+	answer := nameQueryMsg{
+		Domain: domain,
+	}
+	router, err := h.lookupLocal(domain)
+	switch {
+	case err == nil:
+		answer.Answer, answer.Sig, err = h.sign(&NameAnswer{
+			Domain:   domain,
+			Router:   router,
+			Answerer: h.r.instance.Identity().PublicAddress,
+			Time:     h.r.clock.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	case errors.Is(err, ErrNameNotFound), errors.Is(err, ErrNameConflict):
+		// Answer without a router.
+	default:
+		return fmt.Errorf("look up name: %w", err)
+	}
+	data, err := cbor.Marshal(&answer)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.RouterPing,
+		pingID:   hdr.PingID,
+		pingType: nameQueryPingType,
+		pingData: data,
+		followUp: true,
+	})
+	if err != nil {
+		return fmt.Errorf("send name query answer: %w", err)
+	}
+
+	w.Debug(
+		"answered name query",
+		"router", f.SrcIP(),
+		"domain", domain,
+		"answer", router,
+	)
+	return nil
+}
+
+func (h *NameQueryPingHandler) handleAnswer(f frame.Frame, hdr *PingHeader, msg *nameQueryMsg) error {
+	h.activeLock.Lock()
+	state, ok := h.active[hdr.PingID]
+	if ok && state.router == f.SrcIP() {
+		delete(h.active, hdr.PingID)
+	}
+	h.activeLock.Unlock()
+	switch {
+	case !ok:
+		return errors.New("no state")
+	case state.router != f.SrcIP():
+		return errors.New("name answer from unexpected router")
+	}
+
+	state.answer <- msg
+	return nil
+}
+
+// lookupLocal returns the router the domain belongs to, as far as this
+// router knows: Either it is advertised by this router itself, or by
+// exactly one router that was updated recently.
+func (h *NameQueryPingHandler) lookupLocal(domain string) (netip.Addr, error) {
+	cfg := h.r.instance.Config()
+	if cfg.AdvertisesDomain(domain) {
+		return h.r.instance.Identity().IP, nil
+	}
+
+	self := h.r.instance.Identity().IP
+	newerThan := h.r.clock.Now().Add(-nameAdvertisedMaxAge)
+	q := storage.NewRouterQuery(
+		func(a *storage.StoredRouter) bool {
+			if a.Offline ||
+				a.Address == nil ||
+				a.Address.IP == self ||
+				a.PublicInfo == nil ||
+				a.Universe != cfg.Router.Universe ||
+				!a.UpdatedAt.After(newerThan) {
+				return false
+			}
+			for _, svc := range a.PublicInfo.PublicServices {
+				if cleaned, ok := config.CleanDomain(svc.Domain); ok && cleaned == domain {
+					return true
+				}
+			}
+			return false
+		},
+		nil,
+		maxNameAdvertisingRouters,
+	)
+	if err := h.r.instance.State().QueryRouters(q); err != nil {
+		return netip.Addr{}, err
+	}
+
+	switch result := q.Result(); len(result) {
+	case 0:
+		return netip.Addr{}, ErrNameNotFound
+	case 1:
+		return result[0].Address.IP, nil
+	default:
+		return netip.Addr{}, ErrNameConflict
+	}
+}
+
+// Advertises returns whether the router advertises the domain in its signed
+// public router info, as received with its announcements. The result is only
+// valid if known is true.
+func (h *NameQueryPingHandler) Advertises(router netip.Addr, domain string) (advertises, known bool) {
+	info := h.r.instance.State().RouterPublicInfo(router)
+	if info == nil {
+		return false, false
+	}
+	for _, svc := range info.PublicServices {
+		if cleaned, ok := config.CleanDomain(svc.Domain); ok && cleaned == domain {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// sign marshals and signs the given answer.
+func (h *NameQueryPingHandler) sign(answer *NameAnswer) (answerData, sig []byte, err error) {
+	answerData, err = cbor.Marshal(answer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal: %w", err)
+	}
+	sig, err = h.r.instance.Identity().SignWithContext(answerData, nameSigContext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sign: %w", err)
+	}
+	return answerData, sig, nil
+}
+
+// verify parses and verifies the answer of the message.
+func (h *NameQueryPingHandler) verify(msg *nameQueryMsg) (*NameAnswer, error) {
+	answer := &NameAnswer{}
+	if err := cbor.Unmarshal(msg.Answer, answer); err != nil {
+		return nil, fmt.Errorf("unmarshal name answer: %w", err)
+	}
+	if !m.RoutingAddressPrefix.Contains(answer.Router) {
+		return nil, fmt.Errorf("answered router %s is not routable", answer.Router)
+	}
+	now := h.r.clock.Now()
+	if answer.Time.Before(now.Add(-nameAnswerValidity)) || answer.Time.After(now.Add(nameAnswerValidity)) {
+		return nil, errors.New("name answer expired or from the future")
+	}
+	if err := answer.Answerer.VerifyAddress(); err != nil {
+		return nil, fmt.Errorf("invalid answerer: %w", err)
+	}
+	if err := answer.Answerer.VerifySigWithContext(msg.Answer, msg.Sig, nameSigContext); err != nil {
+		return nil, errors.New("invalid signature")
+	}
+	return answer, nil
+}
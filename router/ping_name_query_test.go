@@ -0,0 +1,121 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestNamePrefix(t *testing.T) {
+	t.Parallel()
+
+	de, err := m.GetCountryPrefix("DE")
+	require.NoError(t, err)
+	prefix, ok := NamePrefix("wiki.de.myco")
+	require.True(t, ok)
+	assert.Equal(t, de, prefix)
+	prefix, ok = NamePrefix("a.b.wiki.de.myco")
+	require.True(t, ok)
+	assert.Equal(t, de, prefix)
+
+	for _, domain := range []string{"de.myco", "wiki.myco", "wiki.zz.myco", "wiki.de.com"} {
+		_, ok := NamePrefix(domain)
+		assert.False(t, ok, domain)
+	}
+}
+
+func TestNameAnswers(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock: clock,
+		instance: &groupTestInstance{
+			deniedTestInstance: deniedTestInstance{
+				config: config.MakeTestConfig(config.Store{}),
+			},
+			identity: identity,
+		},
+	}
+	h := NewNameQueryPingHandler(r)
+	de, err := m.GetCountryPrefix("DE")
+	require.NoError(t, err)
+	router := de.Addr().Next()
+
+	// Signed answers are verified.
+	answer := &NameAnswer{
+		Domain:   "wiki.de.myco",
+		Router:   router,
+		Answerer: identity.PublicAddress,
+		Time:     clock.Now(),
+	}
+	answerData, sig, err := h.sign(answer)
+	require.NoError(t, err)
+	verified, err := h.verify(&nameQueryMsg{Domain: answer.Domain, Answer: answerData, Sig: sig})
+	require.NoError(t, err)
+	assert.Equal(t, router, verified.Router)
+	assert.False(t, verified.Authoritative())
+
+	// Tampered answers are rejected.
+	tampered := append([]byte{}, answerData...)
+	tampered[len(tampered)-1] ^= 0xFF
+	_, err = h.verify(&nameQueryMsg{Answer: tampered, Sig: sig})
+	require.Error(t, err)
+
+	// Answers with privacy addresses are rejected, as they cannot be routed to.
+	answer.Router = identity.IP
+	answerData, sig, err = h.sign(answer)
+	require.NoError(t, err)
+	_, err = h.verify(&nameQueryMsg{Answer: answerData, Sig: sig})
+	require.Error(t, err)
+
+	// Old answers are rejected.
+	answer.Router = router
+	answerData, sig, err = h.sign(answer)
+	require.NoError(t, err)
+	clock.Advance(nameAnswerValidity + time.Second)
+	_, err = h.verify(&nameQueryMsg{Answer: answerData, Sig: sig})
+	require.Error(t, err)
+}
+
+func TestNameAdvertises(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	inst := &announceTestInstance{
+		config:   config.MakeTestConfig(config.Store{}),
+		identity: identity,
+	}
+	inst.state = state.New(inst, storage.NewMemStorage())
+	h := NewNameQueryPingHandler(&Router{instance: inst, clock: m.SystemClock})
+
+	owner, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+
+	// Unknown routers cannot be verified.
+	_, known := h.Advertises(owner.IP, "wiki.de.myco")
+	assert.False(t, known)
+
+	// Known routers are checked against their router info.
+	require.NoError(t, inst.state.AddRouter(&owner.PublicAddress))
+	require.NoError(t, inst.state.AddPublicRouterInfo(owner.IP, &m.RouterInfo{
+		PublicServices: []m.RouterService{{Name: "wiki", Domain: "Wiki.de.myco"}},
+	}))
+	advertises, known := h.Advertises(owner.IP, "wiki.de.myco")
+	assert.True(t, known)
+	assert.True(t, advertises)
+	advertises, known = h.Advertises(owner.IP, "bank.de.myco")
+	assert.True(t, known)
+	assert.False(t, advertises)
+}
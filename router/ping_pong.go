@@ -10,7 +10,9 @@ import (
 	"github.com/fxamacker/cbor/v2"
 
 	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/peering"
 )
 
 const pingPongPingType = "pong"
@@ -92,10 +94,33 @@ func (h *PingPongHandler) Clean(w *mgr.WorkerCtx) error {
 // pingPongMsg is a ping pong message.
 type pingPongMsg struct {
 	Msg string `cbor:"msg,omitempty" json:"msg,omitempty"`
+	// Pad is ignored and only used to increase the size of path MTU probes.
+	Pad []byte `cbor:"pad,omitempty" json:"pad,omitempty"`
 }
 
 // Send sends a pong message to the given destination.
 func (h *PingPongHandler) Send(dstIP netip.Addr, peer bool, retryPingID uint64) (notify <-chan struct{}, pingID uint64, err error) {
+	return h.send(dstIP, peer, retryPingID, nil, nil, 0)
+}
+
+// SendOnLink sends a pong message to the peer of the given link, using only
+// the given link. It is used to check members of link bonds individually.
+func (h *PingPongHandler) SendOnLink(link peering.Link, retryPingID uint64) (notify <-chan struct{}, pingID uint64, err error) {
+	return h.send(link.Peer(), true, retryPingID, nil, link, 0)
+}
+
+// SendVia sends a pong message to the given destination using the given switch path.
+func (h *PingPongHandler) SendVia(dstIP netip.Addr, path *m.SwitchPath) (notify <-chan struct{}, pingID uint64, err error) {
+	return h.send(dstIP, false, 0, path, nil, 0)
+}
+
+// SendPadded sends a pong message to the given destination that is padded to
+// be at least the given size in bytes. It is used to probe the path MTU.
+func (h *PingPongHandler) SendPadded(dstIP netip.Addr, size int) (notify <-chan struct{}, pingID uint64, err error) {
+	return h.send(dstIP, false, 0, nil, nil, size)
+}
+
+func (h *PingPongHandler) send(dstIP netip.Addr, peer bool, retryPingID uint64, path *m.SwitchPath, link peering.Link, size int) (notify <-chan struct{}, pingID uint64, err error) {
 	pingID = retryPingID
 
 	// Create message and marshal it.
@@ -106,6 +131,14 @@ func (h *PingPongHandler) Send(dstIP netip.Addr, peer bool, retryPingID uint64)
 	if err != nil {
 		return nil, 0, fmt.Errorf("marshal: %w", err)
 	}
+	if size > len(data) {
+		// The ping header is not accounted for, so the message is a bit bigger.
+		msg.Pad = make([]byte, size-len(data))
+		data, err = cbor.Marshal(&msg)
+		if err != nil {
+			return nil, 0, fmt.Errorf("marshal: %w", err)
+		}
+	}
 
 	// Get or create state.
 	var pingState *pingPongState
@@ -124,13 +157,15 @@ func (h *PingPongHandler) Send(dstIP netip.Addr, peer bool, retryPingID uint64)
 		pingID = newPingID()
 	}
 	opts := sendPingOpts{
-		msgType:  frame.RouterPing,
-		pingID:   pingID,
-		pingType: pingPongPingType,
-		pingData: data,
+		msgType:    frame.RouterPing,
+		pingID:     pingID,
+		pingType:   pingPongPingType,
+		pingData:   data,
+		switchPath: path,
 	}
 	if peer {
 		opts.peer = dstIP
+		opts.viaLink = link
 	} else {
 		opts.dst = dstIP
 	}
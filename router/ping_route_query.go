@@ -0,0 +1,239 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"golang.org/x/time/rate"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	routeQueryPingType = "routequery"
+
+	// routeQueryTimeout defines how long route query state is kept.
+	routeQueryTimeout = 30 * time.Second
+
+	// routeQueryRate limits how many route queries are answered per second.
+	// Queries are only sent by discoveries, which are limited in themselves.
+	routeQueryRate  = 10
+	routeQueryBurst = 50
+)
+
+// ErrNoRouteAnswer is returned when the queried router has no route to the
+// destination.
+var ErrNoRouteAnswer = errors.New("queried router has no route")
+
+// RouteQueryPingHandler handles route query pings, which ask a router for its
+// best route to a destination. They are used to discover routes.
+type RouteQueryPingHandler struct {
+	r *Router
+
+	active     map[uint64]*routeQueryState
+	activeLock sync.Mutex
+
+	limiter *rate.Limiter
+}
+
+type routeQueryState struct {
+	router  netip.Addr
+	answer  chan *routeQueryMsg
+	expires time.Time
+}
+
+var _ PingHandler = &RouteQueryPingHandler{}
+
+// NewRouteQueryPingHandler returns a new route query ping handler.
+func NewRouteQueryPingHandler(r *Router) *RouteQueryPingHandler {
+	return &RouteQueryPingHandler{
+		r:       r,
+		active:  make(map[uint64]*routeQueryState),
+		limiter: rate.NewLimiter(routeQueryRate, routeQueryBurst),
+	}
+}
+
+// Type returns the ping type.
+func (h *RouteQueryPingHandler) Type() string {
+	return routeQueryPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *RouteQueryPingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.activeLock.Lock()
+	defer h.activeLock.Unlock()
+
+	now := h.r.clock.Now()
+	for pingID, state := range h.active {
+		if now.After(state.expires) {
+			delete(h.active, pingID)
+		}
+	}
+
+	return nil
+}
+
+// routeQueryMsg is a route query or answer.
+type routeQueryMsg struct {
+	// Dst is the destination the route is queried for.
+	Dst netip.Addr `cbor:"d,omitempty"`
+	// Hops holds the path of the answer, starting with the answering router.
+	Hops []m.SwitchHop `cbor:"h,omitempty"`
+}
+
+// Query asks the router at the end of the given path for its best route to
+// the destination. It returns the path of the route, starting with the
+// queried router, and whether it ends at the destination. Otherwise, the
+// path ends at the router nearest to the destination that the queried router
+// knows of.
+func (h *RouteQueryPingHandler) Query(ctx context.Context, dst netip.Addr, via *m.SwitchPath) (path *m.SwitchPath, exact bool, err error) {
+	if via == nil || len(via.Hops) < 2 {
+		return nil, false, errors.New("missing or incomplete switch path")
+	}
+	queried := via.Hops[len(via.Hops)-1].Router
+
+	// Create message and marshal it.
+	data, err := cbor.Marshal(&routeQueryMsg{
+		Dst: dst,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("marshal: %w", err)
+	}
+
+	// Create state and send query.
+	pingID := newPingID()
+	state := &routeQueryState{
+		router:  queried,
+		answer:  make(chan *routeQueryMsg, 1),
+		expires: h.r.clock.Now().Add(routeQueryTimeout),
+	}
+	h.activeLock.Lock()
+	h.active[pingID] = state
+	h.activeLock.Unlock()
+	defer func() {
+		h.activeLock.Lock()
+		defer h.activeLock.Unlock()
+		delete(h.active, pingID)
+	}()
+
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:        queried,
+		msgType:    frame.RouterPing,
+		pingID:     pingID,
+		pingType:   routeQueryPingType,
+		pingData:   data,
+		switchPath: via,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("send ping: %w", err)
+	}
+
+	// Wait for answer.
+	var answer *routeQueryMsg
+	select {
+	case answer = <-state.answer:
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+
+	// Check answer.
+	switch {
+	case len(answer.Hops) < 2:
+		return nil, false, ErrNoRouteAnswer
+	case answer.Hops[0].Router != queried:
+		return nil, false, errors.New("route answer does not start at queried router")
+	}
+	path = &m.SwitchPath{Hops: answer.Hops}
+	if path.HasLoop() {
+		return nil, false, errors.New("route answer contains a router more than once")
+	}
+	path.CalculateTotals()
+	return path, answer.Hops[len(answer.Hops)-1].Router == dst, nil
+}
+
+// Handle handles incoming ping frames.
+func (h *RouteQueryPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	msg := routeQueryMsg{}
+	if err := m.UnmarshalControlMsg(data, &msg); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+
+	if hdr.FollowUp {
+		return h.handleAnswer(f, hdr, &msg)
+	}
+	return h.handleQuery(w, f, hdr, &msg)
+}
+
+func (h *RouteQueryPingHandler) handleQuery(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, msg *routeQueryMsg) error {
+	// Invisible routers do not reveal their routes.
+	if h.r.instance.Config().Router.Invisible {
+		return nil
+	}
+	if !m.RoutingAddressPrefix.Contains(msg.Dst) {
+		return fmt.Errorf("queried dst %s is not routable", msg.Dst)
+	}
+	// Do not let routers use us to map the network.
+	if !h.limiter.AllowN(h.r.clock.Now(), 1) {
+		w.Debug(
+			"route query rate limit reached",
+			"router", f.SrcIP(),
+		)
+		return nil
+	}
+
+	// Answer with the best route we have.
+	answer := routeQueryMsg{
+		Dst: msg.Dst,
+	}
+	if rte, _ := h.r.table.LookupNearestRoute(msg.Dst); rte != nil && len(rte.Path.Hops) >= 2 {
+		answer.Hops = rte.Path.Hops
+	}
+	data, err := cbor.Marshal(&answer)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      f.SrcIP(),
+		msgType:  frame.RouterPing,
+		pingID:   hdr.PingID,
+		pingType: routeQueryPingType,
+		pingData: data,
+		followUp: true,
+	})
+	if err != nil {
+		return fmt.Errorf("send route query answer: %w", err)
+	}
+
+	w.Debug(
+		"answered route query",
+		"router", f.SrcIP(),
+		"dst", msg.Dst,
+		"hops", len(answer.Hops),
+	)
+	return nil
+}
+
+func (h *RouteQueryPingHandler) handleAnswer(f frame.Frame, hdr *PingHeader, msg *routeQueryMsg) error {
+	h.activeLock.Lock()
+	state, ok := h.active[hdr.PingID]
+	if ok && state.router == f.SrcIP() {
+		delete(h.active, hdr.PingID)
+	}
+	h.activeLock.Unlock()
+	switch {
+	case !ok:
+		return errors.New("no state")
+	case state.router != f.SrcIP():
+		return errors.New("route answer from unexpected router")
+	}
+
+	state.answer <- msg
+	return nil
+}
@@ -0,0 +1,132 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const scanPingType = "scan"
+
+// ScanPingHandler handles scan pings, which share blocks of detected scanners
+// with friends. Reported scanners are not reported further, so a block only
+// spreads to the friends of the router that detected the scanner.
+type ScanPingHandler struct {
+	r *Router
+}
+
+var _ PingHandler = &ScanPingHandler{}
+
+// NewScanPingHandler returns a new scan ping handler.
+func NewScanPingHandler(r *Router) *ScanPingHandler {
+	return &ScanPingHandler{
+		r: r,
+	}
+}
+
+// Type returns the ping type.
+func (h *ScanPingHandler) Type() string {
+	return scanPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *ScanPingHandler) Clean(w *mgr.WorkerCtx) error {
+	return nil
+}
+
+// scanPingMsg is a scan ping message.
+type scanPingMsg struct {
+	Router netip.Addr `cbor:"r,omitempty" json:"r,omitempty"`
+	Ports  int        `cbor:"p,omitempty" json:"p,omitempty"`
+	// BlockFor is relative, so that it does not depend on synced clocks.
+	BlockFor time.Duration `cbor:"b,omitempty" json:"b,omitempty"`
+}
+
+// Report reports the given scanner to all friends.
+func (h *ScanPingHandler) Report(w *mgr.WorkerCtx, scanner netip.Addr, ports int, blockFor time.Duration) {
+	// Create message and marshal it.
+	data, err := cbor.Marshal(&scanPingMsg{
+		Router:   scanner,
+		Ports:    ports,
+		BlockFor: blockFor,
+	})
+	if err != nil {
+		w.Error("failed to marshal scan report", "err", err)
+		return
+	}
+
+	// Send to all friends.
+	for _, friend := range h.r.instance.Config().GetFriends() {
+		err = h.r.sendPingMsg(sendPingOpts{
+			dst:      friend.IP,
+			msgType:  frame.RouterPing,
+			pingType: scanPingType,
+			pingData: data,
+		})
+		if err != nil {
+			w.Debug(
+				"failed to report scanner to friend",
+				"router", scanner,
+				"friend", friend.IP,
+				"err", err,
+			)
+		}
+	}
+}
+
+// Handle handles incoming ping frames.
+func (h *ScanPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	if hdr.FollowUp {
+		return errors.New("scan pings have no follow up")
+	}
+
+	// Parse report.
+	msg := scanPingMsg{}
+	if err := cbor.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+
+	return h.handleReport(w, f.SrcIP(), &msg)
+}
+
+func (h *ScanPingHandler) handleReport(w *mgr.WorkerCtx, reporter netip.Addr, msg *scanPingMsg) error {
+	cfg := h.r.instance.Config()
+	settings := cfg.ScanDetection
+
+	// Only accept reports from friends, if enabled.
+	if !settings.Share {
+		return nil
+	}
+	if _, ok := cfg.GetFriendByIP(reporter); !ok {
+		w.Debug(
+			"ignoring scan report from non-friend",
+			"router", reporter,
+		)
+		return nil
+	}
+
+	// Check report.
+	switch {
+	case !msg.Router.IsValid():
+		return errors.New("scan report has no router")
+	case msg.BlockFor <= 0:
+		return nil
+	case msg.Router == reporter || msg.Router == h.r.instance.Identity().IP:
+		return fmt.Errorf("scan report for invalid router %s", msg.Router)
+	}
+
+	// Never block friends.
+	if _, ok := cfg.GetFriendByIP(msg.Router); ok {
+		return nil
+	}
+
+	// Block scanner, but not for longer than configured.
+	h.r.blockScanner(w, msg.Router, msg.Ports, min(msg.BlockFor, settings.BlockDuration), reporter)
+	return nil
+}
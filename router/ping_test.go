@@ -0,0 +1,105 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestPingSchema(t *testing.T) {
+	t.Parallel()
+
+	origin, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	b := frame.NewFrameBuilder()
+	pingFrame := func(hdr any, body []byte) frame.Frame {
+		t.Helper()
+
+		hdrData, err := cbor.Marshal(hdr)
+		require.NoError(t, err)
+		data := append([]byte{1, byte(len(hdrData))}, hdrData...)
+		f, err := b.NewFrameV1(origin.IP, m.RouterAddress, frame.RouterPing, nil, append(data, body...), nil)
+		require.NoError(t, err)
+		return f
+	}
+
+	// Ping headers of newer routers with unknown fields must be accepted.
+	f := pingFrame(map[string]any{
+		"sv":     m.SchemaVersionPing,
+		"i":      42,
+		"t":      "test",
+		"future": []byte("unknown"),
+	}, []byte("body"))
+	hdr, offset, err := parsePingHeader(f)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), hdr.PingID)
+	assert.Equal(t, "test", hdr.PingType)
+	assert.Equal(t, []byte("body"), f.MessageData()[offset:])
+
+	// Ping headers without schema version must be accepted.
+	_, _, err = parsePingHeader(pingFrame(map[string]any{"t": "test"}, nil))
+	require.NoError(t, err)
+
+	// Ping headers with an unsupported schema version must be refused.
+	_, _, err = parsePingHeader(pingFrame(map[string]any{
+		"sv": m.SchemaVersionPing + 1,
+		"t":  "test",
+	}, nil))
+	assert.ErrorIs(t, err, m.ErrUnsupportedSchema)
+}
+
+func TestAnnounceSchema(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	origin, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	inst := &announceTestInstance{
+		config:   config.MakeTestConfig(config.Store{}),
+		identity: identity,
+		builder:  frame.NewFrameBuilder(),
+	}
+	inst.state = state.New(inst, storage.NewMemStorage())
+	h := NewAnnouncePingHandler(&Router{instance: inst})
+	b := frame.NewFrameBuilder()
+	parse := func(msg any) (*AnnouncePingMsg, error) {
+		t.Helper()
+
+		pingData, err := cbor.Marshal(msg)
+		require.NoError(t, err)
+		f, err := b.NewFrameV1(origin.IP, m.RouterAddress, frame.RouterHopPing, nil, pingData, nil)
+		require.NoError(t, err)
+		parsed, _, err := h.parseAnnouncePing(f, pingData)
+		return parsed, err
+	}
+
+	// Announcements of newer routers with unknown fields must be accepted.
+	msg, err := parse(map[string]any{
+		"sv":     m.SchemaVersionAnnounce,
+		"i":      map[string]any{"v": "v9.9.9", "future": 1},
+		"s":      true,
+		"future": map[string]any{"metrics": []int{1, 2, 3}},
+	})
+	require.NoError(t, err)
+	assert.True(t, msg.Stub)
+	require.NotNil(t, msg.Info)
+	assert.Equal(t, "v9.9.9", msg.Info.Version)
+
+	// Announcements without schema version must be accepted.
+	_, err = parse(&AnnouncePingMsg{Stub: true})
+	require.NoError(t, err)
+
+	// Announcements with an unsupported schema version must be refused.
+	_, err = parse(map[string]any{"sv": m.SchemaVersionAnnounce + 1})
+	assert.ErrorIs(t, err, m.ErrUnsupportedSchema)
+}
@@ -0,0 +1,751 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/zeebo/blake3"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	transferPingType = "transfer"
+
+	// MaxTransferSize is the maximum size of a transferred file.
+	MaxTransferSize = 8 << 20 // 8 MiB
+	// MaxTransferMessageSize is the maximum size of a message.
+	MaxTransferMessageSize = 4096
+	maxTransferNameLength  = 255
+
+	maxIncomingTransfers = 32
+	maxOutgoingTransfers = 32
+	// maxIncomingTransferBytes limits the data of incoming transfers held in
+	// memory until it is taken.
+	maxIncomingTransferBytes = 4 * MaxTransferSize
+
+	// transferChunkSize is the size of the data in a single ping.
+	transferChunkSize = 1024
+	// transferWindow is the maximum amount of requested, but not yet received
+	// chunks.
+	transferWindow = 64
+	// transferChunkTimeout defines after which time a chunk is requested again.
+	transferChunkTimeout = 2 * time.Second
+	// transferStallTimeout defines after which time without progress a
+	// transfer fails.
+	transferStallTimeout = 30 * time.Second
+	// transferTTL defines how long transfers are kept without activity.
+	// Received data is kept until it is taken or expires.
+	transferTTL = 1 * time.Hour
+	// transferSetupTimeout defines how long to wait for encryption.
+	transferSetupTimeout = 10 * time.Second
+)
+
+// Transfer errors.
+var (
+	ErrTransferNotFound    = errors.New("transfer not found")
+	ErrTransferNotFriend   = errors.New("transfers are only possible between friends")
+	ErrTransferTooBig      = errors.New("transfer too big")
+	ErrTransferInvalidName = errors.New("invalid name")
+	ErrTransferLimit       = errors.New("too many transfers")
+	ErrTransferState       = errors.New("transfer is not in the required state")
+	ErrTransferUnsupported = errors.New("router does not support transfers")
+)
+
+// TransferKind is the kind of a transfer.
+type TransferKind string
+
+// Transfer kinds.
+const (
+	TransferKindMessage TransferKind = "message"
+	TransferKindFile    TransferKind = "file"
+)
+
+// TransferStatus is the status of a transfer.
+type TransferStatus string
+
+// Transfer statuses.
+const (
+	TransferOffered  TransferStatus = "offered"
+	TransferActive   TransferStatus = "active"
+	TransferComplete TransferStatus = "complete"
+	TransferDeclined TransferStatus = "declined"
+	TransferFailed   TransferStatus = "failed"
+)
+
+// Final returns whether the status does not change anymore.
+func (status TransferStatus) Final() bool {
+	switch status {
+	case TransferComplete, TransferDeclined, TransferFailed:
+		return true
+	case TransferOffered, TransferActive:
+		return false
+	default:
+		return false
+	}
+}
+
+// Transfer is a message or file transfer between friends.
+// The receiver must accept a transfer before any data is sent.
+type Transfer struct {
+	ID       string         `json:"id"`
+	Router   netip.Addr     `json:"router"`
+	Friend   string         `json:"friend,omitempty"`
+	Incoming bool           `json:"incoming"`
+	Kind     TransferKind   `json:"kind"`
+	Name     string         `json:"name,omitempty"`
+	Size     int            `json:"size"`
+	Done     int            `json:"done"`
+	Status   TransferStatus `json:"status"`
+	Err      string         `json:"err,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+type transferState struct {
+	Transfer
+
+	id   uint64
+	hash []byte
+	data []byte
+
+	// Receiving only.
+	received  []bool
+	requested []time.Time
+	progress  time.Time
+}
+
+type transferKey struct {
+	router netip.Addr
+	id     uint64
+}
+
+// TransferPingHandler handles transfer pings, which transfer messages and
+// files between friends.
+type TransferPingHandler struct {
+	r *Router
+
+	incoming map[transferKey]*transferState
+	outgoing map[uint64]*transferState
+	lock     sync.Mutex
+}
+
+var _ PingHandler = &TransferPingHandler{}
+
+// NewTransferPingHandler returns a new transfer ping handler.
+func NewTransferPingHandler(r *Router) *TransferPingHandler {
+	return &TransferPingHandler{
+		r:        r,
+		incoming: make(map[transferKey]*transferState),
+		outgoing: make(map[uint64]*transferState),
+	}
+}
+
+// Type returns the ping type.
+func (h *TransferPingHandler) Type() string {
+	return transferPingType
+}
+
+// Clean cleans any internal state of the ping handler.
+func (h *TransferPingHandler) Clean(w *mgr.WorkerCtx) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	threshold := h.r.clock.Now().Add(-transferTTL)
+	for key, state := range h.incoming {
+		if state.Updated.Before(threshold) {
+			delete(h.incoming, key)
+		}
+	}
+	for id, state := range h.outgoing {
+		if state.Updated.Before(threshold) {
+			delete(h.outgoing, id)
+		}
+	}
+
+	return nil
+}
+
+// Transfer ping operations.
+const (
+	transferOpOffer   = "offer"
+	transferOpAccept  = "accept"
+	transferOpDecline = "decline"
+	transferOpGet     = "get"
+	transferOpData    = "data"
+	transferOpDone    = "done"
+	transferOpErr     = "err"
+)
+
+// transferPingMsg is a transfer ping message.
+type transferPingMsg struct {
+	Op     string `cbor:"o,omitempty" json:"o,omitempty"`
+	ID     uint64 `cbor:"i,omitempty" json:"i,omitempty"`
+	Kind   string `cbor:"k,omitempty" json:"k,omitempty"`
+	Name   string `cbor:"n,omitempty" json:"n,omitempty"`
+	Size   int    `cbor:"s,omitempty" json:"s,omitempty"`
+	Hash   []byte `cbor:"h,omitempty" json:"h,omitempty"`
+	Offset int    `cbor:"f,omitempty" json:"f,omitempty"`
+	Data   []byte `cbor:"d,omitempty" json:"d,omitempty"`
+	Err    string `cbor:"e,omitempty" json:"e,omitempty"`
+}
+
+// Offer offers a message or file to the given friend.
+func (h *TransferPingHandler) Offer(dst netip.Addr, kind TransferKind, name string, data []byte) (Transfer, error) {
+	// Check transfer.
+	friend, ok := h.r.instance.Config().GetFriendByIP(dst)
+	if !ok {
+		return Transfer{}, ErrTransferNotFriend
+	}
+	if err := checkTransfer(kind, name, len(data)); err != nil {
+		return Transfer{}, err
+	}
+	if h.r.lacksCapability(dst, m.CapTransfers) {
+		return Transfer{}, ErrTransferUnsupported
+	}
+
+	// Make sure encryption is set up, as transfers are sent encrypted.
+	if err := h.setupEncryption(dst); err != nil {
+		return Transfer{}, err
+	}
+
+	// Create state.
+	now := h.r.clock.Now()
+	hash := blake3.Sum256(data)
+	id := newPingID()
+	state := &transferState{
+		Transfer: Transfer{
+			ID:      formatTransferID(id),
+			Router:  dst,
+			Friend:  friend.Name,
+			Kind:    kind,
+			Name:    name,
+			Size:    len(data),
+			Status:  TransferOffered,
+			Created: now,
+			Updated: now,
+		},
+		id:   id,
+		hash: hash[:],
+		data: data,
+	}
+	h.lock.Lock()
+	if len(h.outgoing) >= maxOutgoingTransfers {
+		h.lock.Unlock()
+		return Transfer{}, ErrTransferLimit
+	}
+	h.outgoing[id] = state
+	transfer := state.Transfer
+	h.lock.Unlock()
+
+	// Send offer.
+	err := h.send(dst, &transferPingMsg{
+		Op:   transferOpOffer,
+		ID:   id,
+		Kind: string(kind),
+		Name: name,
+		Size: len(data),
+		Hash: hash[:],
+	})
+	if err != nil {
+		h.lock.Lock()
+		delete(h.outgoing, id)
+		h.lock.Unlock()
+		return Transfer{}, err
+	}
+
+	return transfer, nil
+}
+
+// Accept accepts the incoming transfer with the given ID and starts receiving it.
+func (h *TransferPingHandler) Accept(id string) error {
+	key, err := h.decide(id, TransferActive)
+	if err != nil {
+		return err
+	}
+
+	if err := h.setupEncryption(key.router); err != nil {
+		h.fail(key, err.Error(), false)
+		return err
+	}
+	if err := h.send(key.router, &transferPingMsg{Op: transferOpAccept, ID: key.id}); err != nil {
+		h.fail(key, err.Error(), false)
+		return err
+	}
+
+	h.r.mgr.Go("receive transfer", func(w *mgr.WorkerCtx) error {
+		h.receive(w, key)
+		return nil
+	})
+	return nil
+}
+
+// Decline declines the incoming transfer with the given ID.
+func (h *TransferPingHandler) Decline(id string) error {
+	key, err := h.decide(id, TransferDeclined)
+	if err != nil {
+		return err
+	}
+	return h.send(key.router, &transferPingMsg{Op: transferOpDecline, ID: key.id})
+}
+
+func (h *TransferPingHandler) decide(id string, status TransferStatus) (transferKey, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key, state := h.findIncoming(id)
+	switch {
+	case state == nil:
+		return key, ErrTransferNotFound
+	case state.Status != TransferOffered:
+		return key, ErrTransferState
+	}
+
+	if status == TransferActive && h.incomingBytes()+state.Size > maxIncomingTransferBytes {
+		return key, fmt.Errorf("%w: too much data buffered, take received data first", ErrTransferLimit)
+	}
+
+	now := h.r.clock.Now()
+	state.Status = status
+	state.Updated = now
+	state.progress = now
+	if status == TransferActive {
+		chunks := (state.Size + transferChunkSize - 1) / transferChunkSize
+		state.data = make([]byte, state.Size)
+		state.received = make([]bool, chunks)
+		state.requested = make([]time.Time, chunks)
+	}
+	return key, nil
+}
+
+// incomingBytes returns the amount of data buffered for incoming transfers.
+// The lock must be held.
+func (h *TransferPingHandler) incomingBytes() (size int) {
+	for _, state := range h.incoming {
+		size += len(state.data)
+	}
+	return size
+}
+
+// findIncoming returns the incoming transfer with the given ID.
+// The lock must be held.
+func (h *TransferPingHandler) findIncoming(id string) (transferKey, *transferState) {
+	for key, state := range h.incoming {
+		if state.ID == id {
+			return key, state
+		}
+	}
+	return transferKey{}, nil
+}
+
+// TakeData returns the data of the completed incoming transfer with the
+// given ID and removes the transfer.
+func (h *TransferPingHandler) TakeData(id string) (Transfer, []byte, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key, state := h.findIncoming(id)
+	switch {
+	case state == nil:
+		return Transfer{}, nil, ErrTransferNotFound
+	case state.Status != TransferComplete:
+		return Transfer{}, nil, ErrTransferState
+	}
+	delete(h.incoming, key)
+	return state.Transfer, state.data, nil
+}
+
+// Export returns all incoming and outgoing transfers.
+func (h *TransferPingHandler) Export() []Transfer {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	export := make([]Transfer, 0, len(h.incoming)+len(h.outgoing))
+	for _, state := range h.incoming {
+		export = append(export, state.Transfer)
+	}
+	for _, state := range h.outgoing {
+		export = append(export, state.Transfer)
+	}
+
+	// Sort.
+	slices.SortFunc(export, func(a, b Transfer) int {
+		return -a.Created.Compare(b.Created) // Newer first.
+	})
+
+	return export
+}
+
+// Handle handles incoming ping frames.
+func (h *TransferPingHandler) Handle(w *mgr.WorkerCtx, f frame.Frame, hdr *PingHeader, data []byte) error {
+	if f.MessageType() != frame.RouterCtrl {
+		return errors.New("transfer ping must be encrypted")
+	}
+
+	// Parse message.
+	msg := transferPingMsg{}
+	if err := cbor.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("unmarshal msg: %w", err)
+	}
+
+	switch msg.Op {
+	case transferOpOffer:
+		return h.handleOffer(w, f.SrcIP(), &msg)
+	case transferOpData:
+		h.handleData(f.SrcIP(), &msg)
+		return nil
+	case transferOpGet:
+		return h.handleGet(f.SrcIP(), &msg)
+	case transferOpAccept, transferOpDecline, transferOpDone:
+		h.handleSenderUpdate(w, f.SrcIP(), &msg)
+		return nil
+	case transferOpErr:
+		h.handleErr(f.SrcIP(), &msg)
+		return nil
+	default:
+		return fmt.Errorf("unknown transfer operation %q", msg.Op)
+	}
+}
+
+func (h *TransferPingHandler) handleOffer(w *mgr.WorkerCtx, src netip.Addr, msg *transferPingMsg) error {
+	// Check offer.
+	friend, ok := h.r.instance.Config().GetFriendByIP(src)
+	if !ok {
+		w.Debug(
+			"rejected transfer from non-friend",
+			"router", src,
+		)
+		return h.send(src, &transferPingMsg{Op: transferOpErr, ID: msg.ID, Err: ErrTransferNotFriend.Error()})
+	}
+	kind := TransferKind(msg.Kind)
+	if err := checkTransfer(kind, msg.Name, msg.Size); err != nil {
+		return h.send(src, &transferPingMsg{Op: transferOpErr, ID: msg.ID, Err: err.Error()})
+	}
+	if len(msg.Hash) != 32 {
+		return h.send(src, &transferPingMsg{Op: transferOpErr, ID: msg.ID, Err: "invalid hash"})
+	}
+
+	// Add transfer.
+	h.lock.Lock()
+	key := transferKey{router: src, id: msg.ID}
+	if _, ok := h.incoming[key]; ok {
+		h.lock.Unlock()
+		return nil
+	}
+	if len(h.incoming) >= maxIncomingTransfers {
+		h.lock.Unlock()
+		return h.send(src, &transferPingMsg{Op: transferOpErr, ID: msg.ID, Err: ErrTransferLimit.Error()})
+	}
+	now := h.r.clock.Now()
+	h.incoming[key] = &transferState{
+		Transfer: Transfer{
+			ID:       formatTransferID(msg.ID),
+			Router:   src,
+			Friend:   friend.Name,
+			Incoming: true,
+			Kind:     kind,
+			Name:     msg.Name,
+			Size:     msg.Size,
+			Status:   TransferOffered,
+			Created:  now,
+			Updated:  now,
+		},
+		id:   msg.ID,
+		hash: msg.Hash,
+	}
+	h.lock.Unlock()
+
+	w.Info(
+		"transfer offered",
+		"friend", friend.Name,
+		"kind", kind,
+		"name", msg.Name,
+		"size", msg.Size,
+	)
+	return nil
+}
+
+func (h *TransferPingHandler) handleSenderUpdate(w *mgr.WorkerCtx, src netip.Addr, msg *transferPingMsg) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	state, ok := h.outgoing[msg.ID]
+	if !ok || state.Router != src || state.Status.Final() {
+		return
+	}
+	state.Updated = h.r.clock.Now()
+
+	switch msg.Op {
+	case transferOpAccept:
+		state.Status = TransferActive
+	case transferOpDecline:
+		state.Status = TransferDeclined
+		state.data = nil
+	case transferOpDone:
+		state.Status = TransferComplete
+		state.Done = state.Size
+		state.data = nil
+	}
+	w.Debug(
+		"transfer updated",
+		"friend", state.Friend,
+		"name", state.Name,
+		"status", state.Status,
+	)
+}
+
+func (h *TransferPingHandler) handleGet(src netip.Addr, msg *transferPingMsg) error {
+	h.lock.Lock()
+	state, ok := h.outgoing[msg.ID]
+	if !ok || state.Router != src || state.Status != TransferActive ||
+		msg.Offset < 0 || msg.Offset >= len(state.data) || msg.Offset%transferChunkSize != 0 {
+		h.lock.Unlock()
+		return nil
+	}
+	end := min(msg.Offset+transferChunkSize, len(state.data))
+	chunk := state.data[msg.Offset:end]
+	state.Done = max(state.Done, end)
+	state.Updated = h.r.clock.Now()
+	h.lock.Unlock()
+
+	return h.send(src, &transferPingMsg{
+		Op:     transferOpData,
+		ID:     msg.ID,
+		Offset: msg.Offset,
+		Data:   chunk,
+	})
+}
+
+func (h *TransferPingHandler) handleData(src netip.Addr, msg *transferPingMsg) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	state, ok := h.incoming[transferKey{router: src, id: msg.ID}]
+	if !ok || state.Status != TransferActive ||
+		msg.Offset < 0 || msg.Offset >= len(state.data) || msg.Offset%transferChunkSize != 0 {
+		return
+	}
+	chunk := msg.Offset / transferChunkSize
+	if state.received[chunk] {
+		return
+	}
+	if len(msg.Data) != min(transferChunkSize, len(state.data)-msg.Offset) {
+		return
+	}
+
+	copy(state.data[msg.Offset:], msg.Data)
+	state.received[chunk] = true
+	state.Done += len(msg.Data)
+	state.progress = h.r.clock.Now()
+	state.Updated = state.progress
+}
+
+func (h *TransferPingHandler) handleErr(src netip.Addr, msg *transferPingMsg) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	// The error may concern either direction.
+	if state, ok := h.outgoing[msg.ID]; ok && state.Router == src && !state.Status.Final() {
+		state.Status = TransferFailed
+		state.Err = msg.Err
+		state.Updated = h.r.clock.Now()
+		state.data = nil
+	}
+	if state, ok := h.incoming[transferKey{router: src, id: msg.ID}]; ok && !state.Status.Final() {
+		state.Status = TransferFailed
+		state.Err = msg.Err
+		state.Updated = h.r.clock.Now()
+		state.data = nil
+	}
+}
+
+// receive requests the missing chunks of an incoming transfer until it is
+// complete or stalls.
+func (h *TransferPingHandler) receive(w *mgr.WorkerCtx, key transferKey) {
+	ticker := h.r.clock.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.Done():
+			return
+		case <-ticker.C():
+		}
+
+		offsets, finished := h.nextChunks(w, key)
+		if finished {
+			return
+		}
+		for _, offset := range offsets {
+			err := h.send(key.router, &transferPingMsg{Op: transferOpGet, ID: key.id, Offset: offset})
+			if err != nil {
+				w.Debug(
+					"failed to request transfer chunk",
+					"router", key.router,
+					"err", err,
+				)
+				break
+			}
+		}
+	}
+}
+
+// nextChunks returns the offsets of the chunks to request next and finishes
+// the transfer when it is complete or stalled.
+func (h *TransferPingHandler) nextChunks(w *mgr.WorkerCtx, key transferKey) (offsets []int, finished bool) {
+	h.lock.Lock()
+	state, ok := h.incoming[key]
+	if !ok || state.Status != TransferActive {
+		h.lock.Unlock()
+		return nil, true
+	}
+
+	// Check if complete.
+	now := h.r.clock.Now()
+	if !slices.Contains(state.received, false) {
+		hash := blake3.Sum256(state.data)
+		if !bytes.Equal(hash[:], state.hash) {
+			h.lock.Unlock()
+			h.fail(key, "data does not match hash", true)
+			return nil, true
+		}
+		state.Status = TransferComplete
+		state.Updated = now
+		h.lock.Unlock()
+
+		w.Info(
+			"transfer received",
+			"friend", state.Friend,
+			"kind", state.Kind,
+			"name", state.Name,
+			"size", state.Size,
+		)
+		if err := h.send(key.router, &transferPingMsg{Op: transferOpDone, ID: key.id}); err != nil {
+			w.Debug(
+				"failed to send transfer completion",
+				"router", key.router,
+				"err", err,
+			)
+		}
+		return nil, true
+	}
+
+	// Check if stalled.
+	if now.Sub(state.progress) > transferStallTimeout {
+		h.lock.Unlock()
+		h.fail(key, "transfer stalled", true)
+		return nil, true
+	}
+
+	// Request missing chunks within the window.
+	var inFlight int
+	for i, requested := range state.requested {
+		if !state.received[i] && now.Sub(requested) < transferChunkTimeout {
+			inFlight++
+		}
+	}
+	for i, requested := range state.requested {
+		if inFlight >= transferWindow {
+			break
+		}
+		if !state.received[i] && now.Sub(requested) >= transferChunkTimeout {
+			state.requested[i] = now
+			offsets = append(offsets, i*transferChunkSize)
+			inFlight++
+		}
+	}
+	h.lock.Unlock()
+
+	return offsets, false
+}
+
+// fail marks the incoming transfer as failed and optionally notifies the sender.
+func (h *TransferPingHandler) fail(key transferKey, reason string, notify bool) {
+	h.lock.Lock()
+	if state, ok := h.incoming[key]; ok {
+		state.Status = TransferFailed
+		state.Err = reason
+		state.Updated = h.r.clock.Now()
+		state.data = nil
+	}
+	h.lock.Unlock()
+
+	if notify {
+		_ = h.send(key.router, &transferPingMsg{Op: transferOpErr, ID: key.id, Err: reason})
+	}
+}
+
+func (h *TransferPingHandler) setupEncryption(dst netip.Addr) error {
+	session := h.r.instance.State().GetSession(dst)
+	if session != nil && session.Encryption().IsSetUp() {
+		return nil
+	}
+
+	notify, err := h.r.HelloPing.Send(dst)
+	if err != nil && !errors.Is(err, ErrAlreadyActive) {
+		return fmt.Errorf("send hello ping: %w", err)
+	}
+	timer := time.NewTimer(transferSetupTimeout)
+	defer timer.Stop()
+	select {
+	case <-notify:
+		return nil
+	case <-timer.C:
+		return errors.New("timed out setting up encryption")
+	}
+}
+
+func (h *TransferPingHandler) send(dst netip.Addr, msg *transferPingMsg) error {
+	data, err := cbor.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = h.r.sendPingMsg(sendPingOpts{
+		dst:      dst,
+		msgType:  frame.RouterCtrl,
+		pingType: transferPingType,
+		pingData: data,
+	})
+	if err != nil {
+		return fmt.Errorf("send ping: %w", err)
+	}
+	return nil
+}
+
+func checkTransfer(kind TransferKind, name string, size int) error {
+	switch kind {
+	case TransferKindMessage:
+		if size > MaxTransferMessageSize {
+			return ErrTransferTooBig
+		}
+	case TransferKindFile:
+		if size > MaxTransferSize {
+			return ErrTransferTooBig
+		}
+		if name == "" || len(name) > maxTransferNameLength ||
+			name != filepath.Base(name) || name == "." || name == ".." {
+			return ErrTransferInvalidName
+		}
+	default:
+		return fmt.Errorf("unknown transfer kind %q", kind)
+	}
+	if size <= 0 {
+		return errors.New("transfer is empty")
+	}
+	return nil
+}
+
+func formatTransferID(id uint64) string {
+	return strconv.FormatUint(id, 16)
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/blake3"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestCheckTransfer(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, checkTransfer(TransferKindMessage, "", 10))
+	assert.ErrorIs(t, checkTransfer(TransferKindMessage, "", MaxTransferMessageSize+1), ErrTransferTooBig)
+	assert.Error(t, checkTransfer(TransferKindMessage, "", 0))
+
+	assert.NoError(t, checkTransfer(TransferKindFile, "photo.jpg", 1000))
+	assert.ErrorIs(t, checkTransfer(TransferKindFile, "photo.jpg", MaxTransferSize+1), ErrTransferTooBig)
+	assert.ErrorIs(t, checkTransfer(TransferKindFile, "", 1000), ErrTransferInvalidName)
+	assert.ErrorIs(t, checkTransfer(TransferKindFile, "../photo.jpg", 1000), ErrTransferInvalidName)
+	assert.ErrorIs(t, checkTransfer(TransferKindFile, "..", 1000), ErrTransferInvalidName)
+
+	assert.Error(t, checkTransfer("other", "", 10))
+}
+
+func TestTransferReceive(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	friend := netip.MustParseAddr("fd12:3456::1")
+	r := &Router{
+		clock: clock,
+		instance: &deniedTestInstance{
+			config: config.MakeTestConfig(config.Store{}),
+		},
+	}
+	h := NewTransferPingHandler(r)
+
+	// Add offered transfer.
+	data := make([]byte, transferWindow*transferChunkSize+100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	hash := blake3.Sum256(data)
+	key := transferKey{router: friend, id: 1}
+	h.incoming[key] = &transferState{
+		Transfer: Transfer{
+			ID:       formatTransferID(1),
+			Router:   friend,
+			Incoming: true,
+			Kind:     TransferKindFile,
+			Name:     "test.bin",
+			Size:     len(data),
+			Status:   TransferOffered,
+		},
+		id:   1,
+		hash: hash[:],
+	}
+
+	// Data is only accepted after accepting the transfer.
+	h.handleData(friend, &transferPingMsg{Op: transferOpData, ID: 1, Data: data[:transferChunkSize]})
+	assert.Zero(t, h.Export()[0].Done)
+	_, err := h.decide(formatTransferID(1), TransferActive)
+	require.NoError(t, err)
+	_, err = h.decide(formatTransferID(1), TransferActive)
+	assert.ErrorIs(t, err, ErrTransferState)
+
+	err = mgr.New("test").Do("test", func(w *mgr.WorkerCtx) error {
+		// Chunks are requested within the window.
+		offsets, finished := h.nextChunks(w, key)
+		assert.False(t, finished)
+		assert.Len(t, offsets, transferWindow)
+		offsets, _ = h.nextChunks(w, key)
+		assert.Empty(t, offsets)
+
+		// Invalid chunks are ignored.
+		h.handleData(friend, &transferPingMsg{Op: transferOpData, ID: 1, Offset: 1, Data: data[1 : transferChunkSize+1]})
+		h.handleData(friend, &transferPingMsg{Op: transferOpData, ID: 1, Offset: 0, Data: data[:10]})
+		h.handleData(friend, &transferPingMsg{Op: transferOpData, ID: 1, Offset: len(data), Data: data[:10]})
+		h.handleData(netip.MustParseAddr("fd12:3456::2"), &transferPingMsg{Op: transferOpData, ID: 1, Data: data[:transferChunkSize]})
+		assert.Zero(t, h.Export()[0].Done)
+
+		// Received chunks make room in the window.
+		h.handleData(friend, &transferPingMsg{Op: transferOpData, ID: 1, Offset: 0, Data: data[:transferChunkSize]})
+		h.handleData(friend, &transferPingMsg{Op: transferOpData, ID: 1, Offset: 0, Data: data[:transferChunkSize]})
+		assert.Equal(t, transferChunkSize, h.Export()[0].Done)
+		offsets, _ = h.nextChunks(w, key)
+		assert.Equal(t, []int{transferWindow * transferChunkSize}, offsets)
+
+		// Missing chunks are requested again.
+		clock.Advance(transferChunkTimeout)
+		offsets, _ = h.nextChunks(w, key)
+		assert.Len(t, offsets, transferWindow)
+		assert.NotContains(t, offsets, 0)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Incomplete data cannot be taken.
+	_, _, err = h.TakeData(formatTransferID(1))
+	assert.ErrorIs(t, err, ErrTransferState)
+}
+
+func TestTransferBufferLimit(t *testing.T) {
+	t.Parallel()
+
+	friend := netip.MustParseAddr("fd12:3456::1")
+	h := NewTransferPingHandler(&Router{clock: m.NewVirtualClock(time.Now())})
+	offer := func(id uint64) string {
+		h.incoming[transferKey{router: friend, id: id}] = &transferState{
+			Transfer: Transfer{
+				ID:       formatTransferID(id),
+				Router:   friend,
+				Incoming: true,
+				Kind:     TransferKindFile,
+				Name:     "test.bin",
+				Size:     MaxTransferSize,
+				Status:   TransferOffered,
+			},
+			id: id,
+		}
+		return formatTransferID(id)
+	}
+
+	// Accept transfers until the buffer is full.
+	for id := range uint64(maxIncomingTransferBytes / MaxTransferSize) {
+		_, err := h.decide(offer(id+1), TransferActive)
+		require.NoError(t, err)
+	}
+	full := offer(100)
+	_, err := h.decide(full, TransferActive)
+	require.ErrorIs(t, err, ErrTransferLimit)
+	assert.Equal(t, TransferOffered, h.incoming[transferKey{router: friend, id: 100}].Status, "rejected transfer must stay offered")
+
+	// Taking data frees the buffer.
+	h.incoming[transferKey{router: friend, id: 1}].Status = TransferComplete
+	_, _, err = h.TakeData(formatTransferID(1))
+	require.NoError(t, err)
+	_, err = h.decide(full, TransferActive)
+	require.NoError(t, err)
+}
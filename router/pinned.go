@@ -0,0 +1,270 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+)
+
+// pinProbeTimeout defines how long to wait for the probe of a new pinned route.
+const pinProbeTimeout = 5 * time.Second
+
+// Pinned route errors.
+var (
+	ErrRouteNotPinned = errors.New("route is not pinned")
+	ErrPinProbeFailed = errors.New("probe via pinned route failed")
+)
+
+// PinnedRoute is a manually defined route to a destination. It overrides the
+// automatic route selection, as long as the first relay is connected.
+type PinnedRoute struct {
+	Dst     netip.Addr
+	Via     []netip.Addr
+	Path    m.SwitchPath
+	Latency time.Duration
+	Pinned  time.Time
+}
+
+// GetPinnedRoutes returns a copy of all pinned routes.
+func (r *Router) GetPinnedRoutes() []PinnedRoute {
+	pinned := r.getPinned()
+	list := make([]PinnedRoute, 0, len(pinned))
+	for _, pin := range pinned {
+		list = append(list, *pin)
+	}
+	slices.SortFunc[[]PinnedRoute, PinnedRoute](list, func(a, b PinnedRoute) int {
+		return a.Dst.Compare(b.Dst)
+	})
+	return list
+}
+
+// PinRoute builds a switch path to dst through the given relays, checks it
+// with a probe and then pins it for the destination.
+// The first relay must be a peer. The switch labels of all following relays
+// must be known from routes learned from the network.
+func (r *Router) PinRoute(dst netip.Addr, via []netip.Addr) (*PinnedRoute, error) {
+	path, err := r.buildSwitchPath(dst, via)
+	if err != nil {
+		return nil, err
+	}
+
+	// Probe path.
+	started := time.Now()
+	notify, _, err := r.PingPong.SendVia(dst, path)
+	if err != nil {
+		return nil, fmt.Errorf("send probe: %w", err)
+	}
+	select {
+	case <-notify:
+	case <-time.After(pinProbeTimeout):
+		return nil, ErrPinProbeFailed
+	}
+
+	// Pin route.
+	pin := &PinnedRoute{
+		Dst:     dst,
+		Via:     slices.Clone[[]netip.Addr](via),
+		Path:    *path,
+		Latency: time.Since(started),
+		Pinned:  time.Now(),
+	}
+	r.updatePinned(func(pinned map[netip.Addr]*PinnedRoute) {
+		pinned[dst] = pin
+	})
+
+	r.mgr.Info(
+		"pinned route",
+		"dst", dst,
+		"via", via,
+		"latency", pin.Latency,
+	)
+	return pin, nil
+}
+
+// UnpinRoute removes the pinned route of the given destination.
+func (r *Router) UnpinRoute(dst netip.Addr) error {
+	var found bool
+	r.updatePinned(func(pinned map[netip.Addr]*PinnedRoute) {
+		_, found = pinned[dst]
+		delete(pinned, dst)
+	})
+	if !found {
+		return ErrRouteNotPinned
+	}
+
+	r.mgr.Info(
+		"unpinned route",
+		"dst", dst,
+	)
+	return nil
+}
+
+// getPinnedPath returns the switch path of the pinned route to dst.
+// It returns nil if there is no pinned route or it is currently unusable.
+func (r *Router) getPinnedPath(dst netip.Addr) *m.SwitchPath {
+	pin, ok := r.getPinned()[dst]
+	if !ok {
+		return nil
+	}
+
+	// Check if the first relay is still connected with the same label.
+	link := r.instance.Peering().GetLink(pin.Via[0])
+	if link == nil {
+		return nil
+	}
+	if link.SwitchLabel() == pin.Path.Hops[0].ForwardLabel {
+		return &pin.Path
+	}
+
+	// Link was relabeled, rebuild path.
+	path := m.SwitchPath{
+		Hops: slices.Clone[[]m.SwitchHop](pin.Path.Hops),
+	}
+	path.Hops[0].ForwardLabel = link.SwitchLabel()
+	if err := path.BuildBlocks(); err != nil {
+		return nil
+	}
+	path.CalculateTotals()
+
+	r.updatePinned(func(pinned map[netip.Addr]*PinnedRoute) {
+		if pinned[dst] == pin {
+			updated := *pin
+			updated.Path = path
+			pinned[dst] = &updated
+		}
+	})
+	return &path
+}
+
+// getPinned returns the current pinned routes. The map must not be modified.
+func (r *Router) getPinned() map[netip.Addr]*PinnedRoute {
+	pinned := r.pinned.Load()
+	if pinned == nil {
+		return nil
+	}
+	return *pinned
+}
+
+// updatePinned calls fn with a copy of the pinned routes and then replaces
+// the pinned routes with the copy.
+func (r *Router) updatePinned(fn func(pinned map[netip.Addr]*PinnedRoute)) {
+	r.pinnedLock.Lock()
+	defer r.pinnedLock.Unlock()
+
+	pinned := maps.Clone(r.getPinned())
+	if pinned == nil {
+		pinned = make(map[netip.Addr]*PinnedRoute)
+	}
+	fn(pinned)
+	r.pinned.Store(&pinned)
+}
+
+// hopLink is a directed link between two routers.
+type hopLink struct {
+	from netip.Addr
+	to   netip.Addr
+}
+
+// buildSwitchPath builds a switch path from this router to dst via the given
+// relays using the switch labels learned from the routing table.
+func (r *Router) buildSwitchPath(dst netip.Addr, via []netip.Addr) (*m.SwitchPath, error) {
+	self := r.instance.Identity().IP
+
+	// Check input.
+	routers := make([]netip.Addr, 0, len(via)+2)
+	routers = append(routers, self)
+	routers = append(routers, via...)
+	routers = append(routers, dst)
+	switch {
+	case len(via) == 0:
+		return nil, errors.New("at least one relay is required")
+	case !m.RoutingAddressPrefix.Contains(dst):
+		return nil, fmt.Errorf("destination %s is not routable", dst)
+	}
+	for i, router := range routers {
+		if slices.Contains[[]netip.Addr](routers[i+1:], router) {
+			return nil, fmt.Errorf("%s is in the path more than once", router)
+		}
+	}
+
+	// The first relay must be a peer.
+	link := r.instance.Peering().GetLink(via[0])
+	if link == nil {
+		return nil, fmt.Errorf("first relay %s is not a peer", via[0])
+	}
+
+	// Collect switch labels between routers from all known paths.
+	labels := make(map[hopLink]m.SwitchLabel)
+	for _, rte := range r.table.Export() {
+		hops := rte.Path.Hops
+		for i := 0; i < len(hops)-1; i++ {
+			if hops[i].ForwardLabel != 0 {
+				labels[hopLink{hops[i].Router, hops[i+1].Router}] = hops[i].ForwardLabel
+			}
+			if hops[i+1].ReturnLabel != 0 {
+				labels[hopLink{hops[i+1].Router, hops[i].Router}] = hops[i+1].ReturnLabel
+			}
+		}
+	}
+	labels[hopLink{self, via[0]}] = link.SwitchLabel()
+
+	// Build path.
+	path := &m.SwitchPath{
+		Hops: make([]m.SwitchHop, len(routers)),
+	}
+	for i, router := range routers {
+		hop := m.SwitchHop{
+			Router: router,
+		}
+		if i < len(routers)-1 {
+			label, ok := labels[hopLink{router, routers[i+1]}]
+			if !ok {
+				return nil, fmt.Errorf("no known link from %s to %s", router, routers[i+1])
+			}
+			hop.ForwardLabel = label
+		}
+		if i > 0 {
+			label, ok := labels[hopLink{router, routers[i-1]}]
+			if !ok {
+				return nil, fmt.Errorf("no known link from %s to %s", router, routers[i-1])
+			}
+			hop.ReturnLabel = label
+		}
+		path.Hops[i] = hop
+	}
+	path.Hops[0].Delay = link.Latency()
+
+	if err := path.BuildBlocks(); err != nil {
+		return nil, fmt.Errorf("build switch blocks: %w", err)
+	}
+	path.CalculateTotals()
+	return path, nil
+}
+
+// switchBlockSpace returns empty space for the switch block of the given path.
+// The space is filled in by sendBySwitchPath after sealing the frame.
+func switchBlockSpace(path *m.SwitchPath) []byte {
+	if path == nil {
+		return nil
+	}
+	return make([]byte, len(path.ForwardBlock))
+}
+
+// sendBySwitchPath sets the switch block of the given path on the sealed frame
+// and sends it to the first hop.
+func (r *Router) sendBySwitchPath(f frame.Frame, path *m.SwitchPath) error {
+	if err := f.SetSwitchBlock(path.ForwardBlock); err != nil {
+		return fmt.Errorf("set switch block: %w", err)
+	}
+	nextHop, err := m.NextRotateSwitchBlock(f.SwitchBlock(), 0)
+	if err != nil {
+		return fmt.Errorf("rotate switch block: %w", err)
+	}
+	return r.instance.Switch().ForwardByLabel(f, nextHop)
+}
@@ -0,0 +1,41 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestPinnedRoutes(t *testing.T) {
+	t.Parallel()
+
+	r := &Router{
+		mgr: mgr.New("test"),
+	}
+	a := netip.MustParseAddr("fd00::a")
+	b := netip.MustParseAddr("fd00::b")
+	assert.Empty(t, r.GetPinnedRoutes())
+	require.ErrorIs(t, r.UnpinRoute(a), ErrRouteNotPinned)
+
+	// Pin routes.
+	r.updatePinned(func(pinned map[netip.Addr]*PinnedRoute) {
+		pinned[b] = &PinnedRoute{Dst: b}
+		pinned[a] = &PinnedRoute{Dst: a}
+	})
+	routes := r.GetPinnedRoutes()
+	require.Len(t, routes, 2)
+	assert.Equal(t, a, routes[0].Dst, "routes must be sorted")
+	assert.Equal(t, b, routes[1].Dst, "routes must be sorted")
+
+	// Changes do not affect readers of the previous routes.
+	snapshot := r.getPinned()
+	require.NoError(t, r.UnpinRoute(a))
+	assert.Contains(t, snapshot, a)
+	assert.NotContains(t, r.getPinned(), a)
+	require.ErrorIs(t, r.UnpinRoute(a), ErrRouteNotPinned)
+	assert.Len(t, r.GetPinnedRoutes(), 1)
+}
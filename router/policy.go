@@ -0,0 +1,151 @@
+package router
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+// PolicyRule describes which rule decided on a connection.
+type PolicyRule string
+
+// Policy rules.
+const (
+	PolicyRuleOutsideSchedule    PolicyRule = "service is outside of its schedule"
+	PolicyRuleHiddenService      PolicyRule = "hidden service, router has not knocked"
+	PolicyRulePublicService      PolicyRule = "public service"
+	PolicyRuleFriends            PolicyRule = "service is shared with friends"
+	PolicyRuleAllowedRouter      PolicyRule = "router is allowed by service"
+	PolicyRuleGuestAccess        PolicyRule = "guest access"
+	PolicyRuleNotAllowed         PolicyRule = "router is not allowed by service"
+	PolicyRuleNoService          PolicyRule = "no service on port"
+	PolicyRuleNotIsolated        PolicyRule = "outgoing connections are allowed"
+	PolicyRuleIsolatedFriend     PolicyRule = "router is isolated, destination is a friend"
+	PolicyRuleIsolated           PolicyRule = "router is isolated, destination is not a friend"
+	PolicyRuleFriendDestination  PolicyRule = "destination is a friend"
+	PolicyRuleAllowedDestination PolicyRule = "destination was allowed"
+	PolicyRuleDeniedDestination  PolicyRule = "destination was denied"
+	PolicyRulePromptDestination  PolicyRule = "destination awaits decision"
+)
+
+// policyDecision is the result of evaluating the policy for a connection.
+type policyDecision struct {
+	status       connStatus
+	rule         PolicyRule
+	svc          config.Service
+	isSvc        bool
+	guestExpires time.Time
+}
+
+// decideInbound evaluates the inbound policy for a connection without any
+// side effects.
+func (r *Router) decideInbound(remoteIP netip.Addr, protocol uint8, localPort uint16) policyDecision {
+	var (
+		cfg                   = r.instance.Config()
+		svc, isSvc            = cfg.GetServiceByPolicy(protocol, localPort)
+		guestExpires, isGuest = r.AccessPing.guestAccessUntil(remoteIP, protocol, localPort)
+		decision              = policyDecision{svc: svc, isSvc: isSvc}
+	)
+	switch {
+	case isSvc && svc.Schedule != nil && !svc.Schedule.Active(r.clock.Now()):
+		decision.status = connStatusDenied
+		decision.rule = PolicyRuleOutsideSchedule
+
+	case isSvc && svc.Hidden && !r.KnockPing.hasKnocked(remoteIP, svc.Name):
+		decision.status = connStatusDenied
+		decision.rule = PolicyRuleHiddenService
+
+	case cfg.CheckInboundTrafficPolicy(protocol, localPort, remoteIP):
+		decision.status = connStatusAllowed
+		_, isFriend := cfg.GetFriendByIP(remoteIP)
+		switch {
+		case svc.Public:
+			decision.rule = PolicyRulePublicService
+		case svc.Friends && isFriend:
+			decision.rule = PolicyRuleFriends
+		default:
+			decision.rule = PolicyRuleAllowedRouter
+		}
+
+	case isGuest:
+		decision.status = connStatusAllowed
+		decision.rule = PolicyRuleGuestAccess
+		decision.guestExpires = guestExpires
+
+	case isSvc:
+		decision.status = connStatusDenied
+		decision.rule = PolicyRuleNotAllowed
+
+	default:
+		decision.status = connStatusDenied
+		decision.rule = PolicyRuleNoService
+	}
+	return decision
+}
+
+// decideOutbound evaluates the outbound policy for a connection without any
+// side effects.
+func (r *Router) decideOutbound(remoteIP netip.Addr) policyDecision {
+	cfg := r.instance.Config()
+	_, isFriend := cfg.GetFriendByIP(remoteIP)
+	switch {
+	case r.isolated() && isFriend:
+		return policyDecision{status: connStatusAllowed, rule: PolicyRuleIsolatedFriend}
+	case r.isolated():
+		return policyDecision{status: connStatusProhibited, rule: PolicyRuleIsolated}
+	case !cfg.OutboundPrompts.Enabled:
+		return policyDecision{status: connStatusAllowed, rule: PolicyRuleNotIsolated}
+	case isFriend:
+		return policyDecision{status: connStatusAllowed, rule: PolicyRuleFriendDestination}
+	}
+
+	// Check for decision on prompt.
+	allowed, decided := r.outboundDecision(remoteIP)
+	switch {
+	case !decided:
+		return policyDecision{status: connStatusPending, rule: PolicyRulePromptDestination}
+	case allowed:
+		return policyDecision{status: connStatusAllowed, rule: PolicyRuleAllowedDestination}
+	default:
+		return policyDecision{status: connStatusProhibited, rule: PolicyRuleDeniedDestination}
+	}
+}
+
+// PolicyEvaluation is the result of a policy dry-run.
+type PolicyEvaluation struct {
+	Allowed bool
+	Status  string
+	Rule    PolicyRule
+	Service string
+
+	// GuestExpires is set when access is granted by guest access.
+	GuestExpires time.Time
+	// AccessRequest is set when a denied connection would be recorded as an
+	// access request.
+	AccessRequest bool
+}
+
+// EvaluatePolicy evaluates the policy for a hypothetical connection, without
+// affecting any state. For inbound connections, port is the local port,
+// for outbound connections, it is the remote port.
+func (r *Router) EvaluatePolicy(inbound bool, remoteIP netip.Addr, protocol uint8, port uint16) PolicyEvaluation {
+	var decision policyDecision
+	if inbound {
+		decision = r.decideInbound(remoteIP, protocol, port)
+	} else {
+		decision = r.decideOutbound(remoteIP)
+	}
+
+	eval := PolicyEvaluation{
+		Allowed:      decision.status == connStatusAllowed,
+		Status:       decision.status.Name(),
+		Rule:         decision.rule,
+		GuestExpires: decision.guestExpires,
+	}
+	if decision.isSvc {
+		eval.Service = decision.svc.Name
+		eval.AccessRequest = decision.rule == PolicyRuleNotAllowed && decision.svc.AccessRequests
+	}
+	return eval
+}
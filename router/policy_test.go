@@ -0,0 +1,77 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestEvaluatePolicy(t *testing.T) {
+	t.Parallel()
+
+	friend := netip.MustParseAddr("fd12:3456::1")
+	allowed := netip.MustParseAddr("fd12:3456::2")
+	stranger := netip.MustParseAddr("fd12:3456::3")
+	r := &Router{
+		clock: m.NewVirtualClock(time.Now()),
+		instance: &deniedTestInstance{
+			config: config.MakeTestConfig(config.Store{
+				Router: config.Router{Isolate: true},
+				FriendConfigs: []config.FriendConfig{
+					{Name: "friend", IP: friend.String()},
+				},
+				ServiceConfigs: []config.ServiceConfig{
+					{Name: "web", URL: "http://:80", Public: true},
+					{Name: "ssh", URL: "tcp://:22", Friends: true, For: []string{allowed.String()}, AccessRequests: true},
+					{Name: "secret", URL: "tcp://:2222", Friends: true, Hidden: true},
+				},
+			}),
+		},
+	}
+	r.AccessPing = NewAccessPingHandler(r)
+	r.KnockPing = NewKnockPingHandler(r)
+
+	// Inbound.
+	eval := r.EvaluatePolicy(true, stranger, 6, 80)
+	assert.True(t, eval.Allowed)
+	assert.Equal(t, PolicyRulePublicService, eval.Rule)
+	assert.Equal(t, "web", eval.Service)
+
+	eval = r.EvaluatePolicy(true, friend, 6, 22)
+	assert.True(t, eval.Allowed)
+	assert.Equal(t, PolicyRuleFriends, eval.Rule)
+
+	eval = r.EvaluatePolicy(true, allowed, 6, 22)
+	assert.True(t, eval.Allowed)
+	assert.Equal(t, PolicyRuleAllowedRouter, eval.Rule)
+
+	eval = r.EvaluatePolicy(true, stranger, 6, 22)
+	assert.False(t, eval.Allowed)
+	assert.Equal(t, PolicyRuleNotAllowed, eval.Rule)
+	assert.True(t, eval.AccessRequest)
+
+	eval = r.EvaluatePolicy(true, friend, 6, 2222)
+	assert.False(t, eval.Allowed)
+	assert.Equal(t, PolicyRuleHiddenService, eval.Rule)
+
+	eval = r.EvaluatePolicy(true, friend, 6, 8080)
+	assert.False(t, eval.Allowed)
+	assert.Equal(t, PolicyRuleNoService, eval.Rule)
+	assert.Empty(t, eval.Service)
+
+	// Outbound in isolation.
+	eval = r.EvaluatePolicy(false, friend, 6, 443)
+	assert.True(t, eval.Allowed)
+	assert.Equal(t, PolicyRuleIsolatedFriend, eval.Rule)
+	eval = r.EvaluatePolicy(false, stranger, 6, 443)
+	assert.False(t, eval.Allowed)
+	assert.Equal(t, PolicyRuleIsolated, eval.Rule)
+
+	// Evaluation has no side effects.
+	assert.Empty(t, r.connStates)
+}
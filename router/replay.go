@@ -0,0 +1,163 @@
+package router
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/mycoria/mycoria/frame"
+)
+
+const (
+	// replayWindow defines how long signed router messages are remembered.
+	// It covers the maximum validity of announcements, so that a captured
+	// announcement cannot be replayed while it is valid, even if the session
+	// of the source was reset in the meantime.
+	replayWindow = maxAnnounceValidity
+	// maxReplays limits the amount of messages remembered of all sources.
+	maxReplays = 100_000
+	// maxReplaysPerSource limits the amount of messages remembered per source.
+	maxReplaysPerSource = 1024
+	// maxReplayVariants limits the amount of variants accepted per message.
+	// Hop pings spread through the network and arrive over different paths,
+	// which are distinct routes to the source.
+	maxReplayVariants = 16
+)
+
+// ErrReplayedFrame is returned when a signed frame was already received.
+var ErrReplayedFrame = errors.New("replayed frame")
+
+// replayKey identifies a signed frame.
+type replayKey [16]byte
+
+// replayEntry holds a remembered signed frame.
+type replayEntry struct {
+	expires time.Time
+	// variants holds the appendix keys of the received variants.
+	variants []replayKey
+}
+
+// replayKeyOf returns the replay key of the given signed frame, which is
+// derived from the signature only, as it covers the sequence time and
+// message. The variant is derived from the appendix, which holds the signed
+// attachments of the hops.
+func replayKeyOf(f frame.Frame) (key, variant replayKey) {
+	return hashReplayKey(f.AuthData()), hashReplayKey(f.AppendixData())
+}
+
+func hashReplayKey(data []byte) (key replayKey) {
+	sum := blake3.Sum256(data)
+	copy(key[:], sum[:])
+	return key
+}
+
+// checkReplay checks if the signed frame was already received from the source
+// and remembers it otherwise.
+// Must only be called with verified frames.
+func (r *Router) checkReplay(f frame.Frame) error {
+	key, variant := replayKeyOf(f)
+	return r.checkReplayKey(f.SrcIP(), key, variant)
+}
+
+func (r *Router) checkReplayKey(src netip.Addr, key, variant replayKey) error {
+	now := r.clock.Now()
+
+	r.replaysLock.Lock()
+	defer r.replaysLock.Unlock()
+
+	seen, ok := r.replays[src]
+	if !ok {
+		seen = make(map[replayKey]*replayEntry)
+		r.replays[src] = seen
+	}
+
+	// Check if already seen.
+	// Only a limited amount of variants is accepted, so that the appendix
+	// cannot be used to replay messages.
+	if entry, ok := seen[key]; ok && now.Before(entry.expires) {
+		if slices.Contains(entry.variants, variant) || len(entry.variants) >= maxReplayVariants {
+			return ErrReplayedFrame
+		}
+		entry.variants = append(entry.variants, variant)
+		return nil
+	}
+
+	// Make room for new message, evicting the oldest of the source if necessary.
+	if len(seen) >= maxReplaysPerSource {
+		var (
+			oldest        replayKey
+			oldestExpires time.Time
+		)
+		for k, entry := range seen {
+			if !now.Before(entry.expires) {
+				r.deleteReplayLocked(seen, k)
+				continue
+			}
+			if oldestExpires.IsZero() || entry.expires.Before(oldestExpires) {
+				oldest, oldestExpires = k, entry.expires
+			}
+		}
+		if len(seen) >= maxReplaysPerSource {
+			r.deleteReplayLocked(seen, oldest)
+		}
+	}
+
+	// Make room in the cache, evicting other sources if necessary.
+	if _, ok := seen[key]; !ok && r.replayCnt >= maxReplays {
+		r.cleanReplaysLocked(now)
+		for evict, evictSeen := range r.replays {
+			if r.replayCnt < maxReplays {
+				break
+			}
+			if evict == src {
+				continue
+			}
+			for k := range evictSeen {
+				r.deleteReplayLocked(evictSeen, k)
+			}
+			delete(r.replays, evict)
+		}
+		r.replays[src] = seen
+	}
+
+	if _, ok := seen[key]; !ok {
+		r.replayCnt++
+	}
+	seen[key] = &replayEntry{
+		expires:  now.Add(replayWindow),
+		variants: []replayKey{variant},
+	}
+	return nil
+}
+
+// deleteReplayLocked removes the message from the replay cache.
+func (r *Router) deleteReplayLocked(seen map[replayKey]*replayEntry, key replayKey) {
+	if _, ok := seen[key]; ok {
+		delete(seen, key)
+		r.replayCnt--
+	}
+}
+
+// cleanReplays removes expired messages from the replay cache.
+func (r *Router) cleanReplays() {
+	r.replaysLock.Lock()
+	defer r.replaysLock.Unlock()
+
+	r.cleanReplaysLocked(r.clock.Now())
+}
+
+func (r *Router) cleanReplaysLocked(now time.Time) {
+	for src, seen := range r.replays {
+		for key, entry := range seen {
+			if !now.Before(entry.expires) {
+				r.deleteReplayLocked(seen, key)
+			}
+		}
+		if len(seen) == 0 {
+			delete(r.replays, src)
+		}
+	}
+}
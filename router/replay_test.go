@@ -0,0 +1,67 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestReplayCache(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock:   clock,
+		replays: make(map[netip.Addr]map[replayKey]*replayEntry),
+	}
+	src1 := netip.MustParseAddr("fd12:3456::1")
+	src2 := netip.MustParseAddr("fd12:3456::2")
+	msg1 := replayKey{1}
+	msg2 := replayKey{2}
+	variant := replayKey{}
+
+	// First receipt is accepted, replays are not.
+	assert.NoError(t, r.checkReplayKey(src1, msg1, variant))
+	assert.ErrorIs(t, r.checkReplayKey(src1, msg1, variant), ErrReplayedFrame)
+	assert.NoError(t, r.checkReplayKey(src1, msg2, variant))
+	assert.NoError(t, r.checkReplayKey(src2, msg1, variant), "sources should be separate")
+
+	// Only a limited amount of variants is accepted.
+	for i := 1; i < maxReplayVariants; i++ {
+		assert.NoError(t, r.checkReplayKey(src1, msg1, replayKey{byte(i)}))
+	}
+	assert.ErrorIs(t, r.checkReplayKey(src1, msg1, replayKey{0xFF}), ErrReplayedFrame)
+	assert.ErrorIs(t, r.checkReplayKey(src1, msg1, replayKey{1}), ErrReplayedFrame)
+
+	// Messages are forgotten after the replay window.
+	clock.Advance(replayWindow)
+	r.cleanReplays()
+	assert.Empty(t, r.replays)
+	assert.Zero(t, r.replayCnt)
+	assert.NoError(t, r.checkReplayKey(src1, msg1, variant))
+
+	// Sources cannot grow the cache beyond the limit.
+	for i := range maxReplaysPerSource + 10 {
+		assert.NoError(t, r.checkReplayKey(src2, replayKey{byte(i), byte(i >> 8), 1}, variant))
+	}
+	assert.Len(t, r.replays[src2], maxReplaysPerSource)
+	assert.Equal(t, maxReplaysPerSource+1, r.replayCnt)
+
+	// All sources together cannot grow the cache beyond the limit.
+	for i := range maxReplays / maxReplaysPerSource * 2 {
+		src := netip.AddrFrom16([16]byte{0xfd, 1, byte(i), byte(i >> 8)})
+		for j := range maxReplaysPerSource {
+			_ = r.checkReplayKey(src, replayKey{byte(j), byte(j >> 8)}, variant)
+		}
+		assert.LessOrEqual(t, r.replayCnt, maxReplays)
+	}
+	cnt := 0
+	for _, seen := range r.replays {
+		cnt += len(seen)
+	}
+	assert.Equal(t, r.replayCnt, cnt)
+}
@@ -0,0 +1,64 @@
+package router
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// Routes are discovered by the discovery module, which uses the router to
+// query other routers and to probe the found paths.
+
+// SetRouteMissHandler sets a function that is called with the destination of
+// own frames that are routed without a route to the destination itself, but
+// only to the nearest known router. It is called on the hot path and must not
+// block.
+func (r *Router) SetRouteMissHandler(fn func(dst netip.Addr)) {
+	r.routeMissHandler.Store(&fn)
+}
+
+func (r *Router) routeMiss(dst netip.Addr) {
+	if fn := r.routeMissHandler.Load(); fn != nil {
+		(*fn)(dst)
+	}
+}
+
+// QueryRoute asks the router at the end of the given path for its best route
+// to the destination, see RouteQueryPingHandler.Query.
+func (r *Router) QueryRoute(ctx context.Context, dst netip.Addr, via *m.SwitchPath) (path *m.SwitchPath, exact bool, err error) {
+	return r.RouteQuery.Query(ctx, dst, via)
+}
+
+// ProbePath sends a ping to the destination via the given path and waits for
+// the response.
+func (r *Router) ProbePath(ctx context.Context, dst netip.Addr, path *m.SwitchPath) error {
+	notify, _, err := r.PingPong.SendVia(dst, path)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-notify:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ActiveRemotes returns the remote IPs of all connections with traffic since
+// the given time.
+func (r *Router) ActiveRemotes(since time.Time) map[netip.Addr]struct{} {
+	r.connStatesLock.RLock()
+	defer r.connStatesLock.RUnlock()
+
+	sinceUnix := since.Unix()
+	active := make(map[netip.Addr]struct{})
+	for key, entry := range r.connStates {
+		if entry.lastSeen.Load() >= sinceUnix {
+			active[key.remoteIP] = struct{}{}
+		}
+	}
+	return active
+}
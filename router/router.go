@@ -9,6 +9,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
+
 	"github.com/mycoria/mycoria/api/httpapi"
 	"github.com/mycoria/mycoria/api/netstack"
 	"github.com/mycoria/mycoria/config"
@@ -17,6 +19,7 @@ import (
 	"github.com/mycoria/mycoria/mgr"
 	"github.com/mycoria/mycoria/peering"
 	"github.com/mycoria/mycoria/state"
+	"github.com/mycoria/mycoria/streams"
 	"github.com/mycoria/mycoria/switchr"
 	"github.com/mycoria/mycoria/tun"
 )
@@ -27,21 +30,116 @@ type Router struct {
 
 	routerConfig  Config
 	input         chan frame.Frame
+	inputPrio     chan frame.Frame
 	handleTraffic atomic.Bool
 
+	triggerAnnounce chan struct{}
+	triggerLeaf     chan struct{}
+
+	// routeMissHandler is called when own frames are sent without a route
+	// to their destination.
+	routeMissHandler atomic.Pointer[func(dst netip.Addr)]
+
+	// leaf holds the only peer of the router, if it is a leaf router.
+	leaf atomic.Pointer[netip.Addr]
+
+	frameStats *frame.Stats
+
 	table *m.RoutingTable
+	clock m.Clock
 
 	pingHandlers     map[string]PingHandler
 	pingHandlersLock sync.RWMutex
 
-	connStates     map[connStateKey]*connStateEntry
-	connStatesLock sync.RWMutex
+	connStates        map[connStateKey]*connStateEntry
+	connStatesLock    sync.RWMutex
+	maxConnStates     int
+	connStatesEvicted atomic.Uint64
+
+	accessRequests     map[accessRequestKey]*AccessRequest
+	accessRequestsLock sync.Mutex
+
+	pending     map[netip.Addr]*pendingQueue
+	pendingLock sync.Mutex
+
+	unreachable     map[netip.Addr]*unreachableEntry
+	unreachableLock sync.RWMutex
+
+	// pinned holds the pinned routes. It is replaced on change, so that it
+	// can be read without locking for every packet.
+	pinned     atomic.Pointer[map[netip.Addr]*PinnedRoute]
+	pinnedLock sync.Mutex
+
+	blackholes     []*blackholeEntry
+	blackholesLock sync.RWMutex
+
+	blackholeReplies     map[netip.Addr]*blackholeReply
+	blackholeRepliesLock sync.Mutex
+
+	replays     map[netip.Addr]map[replayKey]*replayEntry
+	replayCnt   int
+	replaysLock sync.Mutex
+
+	loopStats     map[netip.Addr]*LoopStat
+	loopStatsLock sync.Mutex
+
+	pathMTUs     map[netip.Addr]*pathMTUEntry
+	pathMTUsLock sync.Mutex
+
+	routingDecisions     []RoutingDecision
+	routingDecisionsNext int
+	routingDecisionsLock sync.Mutex
+	routingDecisionCnt   atomic.Uint64
+
+	serviceStats     map[string]*serviceStats
+	serviceStatsLock sync.RWMutex
+
+	implausiblePaths     map[netip.Addr]time.Time
+	implausiblePathsLock sync.Mutex
+
+	fragments     map[fragmentKey]*trackedFragment
+	fragmentsLock sync.Mutex
+
+	scheduleStates     map[string]bool
+	scheduleStatesLock sync.Mutex
+
+	outboundPrompts     map[netip.Addr]*OutboundPrompt
+	outboundDecisions   map[netip.Addr]outboundDecision
+	outboundPromptsLock sync.Mutex
+
+	icmpLimiter *rate.Limiter
+
+	scanTrackers    map[netip.Addr]*scanTracker
+	blockedScanners map[netip.Addr]time.Time
+	scanLock        sync.RWMutex
+	ScanEvents      *mgr.EventMgr[*EventScan]
+
+	denied       map[deniedKey]*deniedTracker
+	deniedLock   sync.Mutex
+	DeniedEvents *mgr.EventMgr[*EventDenied]
+
+	// ErrorEvents holds errors reported by other routers via error pings.
+	ErrorEvents *mgr.EventMgr[*EventError]
+
+	knownInbound     map[netip.Addr]struct{}
+	knownInboundLock sync.Mutex
+	InboundEvents    *mgr.EventMgr[*EventInbound]
 
 	HelloPing      *HelloPingHandler
 	PingPong       *PingPongHandler
 	ErrorPing      *ErrorPingHandler
 	AnnouncePing   *AnnouncePingHandler
 	DisconnectPing *DisconnectPingHandler
+	AccessPing     *AccessPingHandler
+	KnockPing      *KnockPingHandler
+	TransferPing   *TransferPingHandler
+	GroupPing      *GroupPingHandler
+	RouteQuery     *RouteQueryPingHandler
+	NameQuery      *NameQueryPingHandler
+	ScanPing       *ScanPingHandler
+
+	// Streams holds all streams to other routers.
+	Streams *streams.Mux
 
 	instance instance
 }
@@ -70,31 +168,64 @@ type Config struct {
 // New returns a new router.
 func New(instance instance, routerConfig Config) (*Router, error) {
 	// Setup routing table.
-	// Get router IP and default prefix.
 	routerIP := instance.Identity().IP
-	routerPrefix := netip.PrefixFrom(routerIP, m.RegionPrefixBits)
-	// Make prefix more precise by looking up the country marker.
-	marker, err := m.LookupCountryMarker(routerIP)
-	if err == nil {
-		routerPrefix = marker.Prefix
-	}
-	if !routerPrefix.Contains(routerIP) {
-		return nil, errors.New("internal error: failed to derive router IP prefix")
+	routablePrefixes, err := RoutablePrefixes(routerIP, instance.Config().Router.RoutesPerDestination)
+	if err != nil {
+		return nil, err
 	}
 	// Create routing table.
+	clock := instance.Config().Clock()
 	tbl := m.NewRoutingTable(m.RoutingTableConfig{
-		RoutablePrefixes: m.GetRoutablePrefixesFor(routerIP, routerPrefix),
+		RoutablePrefixes: routablePrefixes,
 		RouterIP:         routerIP,
+		Clock:            clock,
+		MaxEntries:       instance.Config().Limits.MaxRoutes,
+		NextHopWeights:   instance.Config().GetPeerWeights(),
 	})
 
 	// Create router.
 	r := &Router{
-		routerConfig: routerConfig,
-		input:        make(chan frame.Frame),
-		table:        tbl,
-		pingHandlers: make(map[string]PingHandler),
-		connStates:   make(map[connStateKey]*connStateEntry),
-		instance:     instance,
+		routerConfig:    routerConfig,
+		input:           make(chan frame.Frame),
+		inputPrio:       make(chan frame.Frame, instance.Config().Limits.QueueSize),
+		triggerAnnounce: make(chan struct{}, 1),
+		triggerLeaf:     make(chan struct{}, 1),
+		frameStats:      frame.NewStats(clock.Now()),
+		table:           tbl,
+		clock:           clock,
+		pingHandlers:    make(map[string]PingHandler),
+		connStates:      make(map[connStateKey]*connStateEntry),
+		maxConnStates:   instance.Config().Limits.MaxConnections,
+		instance:        instance,
+
+		accessRequests: make(map[accessRequestKey]*AccessRequest),
+		pending:        make(map[netip.Addr]*pendingQueue),
+		unreachable:    make(map[netip.Addr]*unreachableEntry),
+		replays:        make(map[netip.Addr]map[replayKey]*replayEntry),
+		loopStats:      make(map[netip.Addr]*LoopStat),
+		pathMTUs:       make(map[netip.Addr]*pathMTUEntry),
+		serviceStats:   make(map[string]*serviceStats),
+		icmpLimiter:    newICMPRateLimiter(),
+
+		blackholeReplies: make(map[netip.Addr]*blackholeReply),
+
+		implausiblePaths:  make(map[netip.Addr]time.Time),
+		fragments:         make(map[fragmentKey]*trackedFragment),
+		scheduleStates:    make(map[string]bool),
+		outboundPrompts:   make(map[netip.Addr]*OutboundPrompt),
+		outboundDecisions: make(map[netip.Addr]outboundDecision),
+
+		scanTrackers:    make(map[netip.Addr]*scanTracker),
+		blockedScanners: make(map[netip.Addr]time.Time),
+		denied:          make(map[deniedKey]*deniedTracker),
+		knownInbound:    make(map[netip.Addr]struct{}),
+
+		// Event managers are created once, so that subscriptions survive
+		// restarts of the router.
+		ScanEvents:    newScanEventMgr(),
+		DeniedEvents:  newDeniedEventMgr(),
+		ErrorEvents:   newErrorEventMgr(),
+		InboundEvents: newInboundEventMgr(),
 	}
 	if r.instance.Config().System.DisableTun {
 		r.handleTraffic.Store(false)
@@ -123,6 +254,35 @@ func New(instance instance, routerConfig Config) (*Router, error) {
 	if err := r.RegisterPingHandler(r.DisconnectPing); err != nil {
 		return nil, err
 	}
+	r.AccessPing = NewAccessPingHandler(r)
+	if err := r.RegisterPingHandler(r.AccessPing); err != nil {
+		return nil, err
+	}
+	r.KnockPing = NewKnockPingHandler(r)
+	if err := r.RegisterPingHandler(r.KnockPing); err != nil {
+		return nil, err
+	}
+	r.TransferPing = NewTransferPingHandler(r)
+	if err := r.RegisterPingHandler(r.TransferPing); err != nil {
+		return nil, err
+	}
+	r.GroupPing = NewGroupPingHandler(r)
+	if err := r.RegisterPingHandler(r.GroupPing); err != nil {
+		return nil, err
+	}
+	r.RouteQuery = NewRouteQueryPingHandler(r)
+	if err := r.RegisterPingHandler(r.RouteQuery); err != nil {
+		return nil, err
+	}
+	r.NameQuery = NewNameQueryPingHandler(r)
+	if err := r.RegisterPingHandler(r.NameQuery); err != nil {
+		return nil, err
+	}
+	r.ScanPing = NewScanPingHandler(r)
+	if err := r.RegisterPingHandler(r.ScanPing); err != nil {
+		return nil, err
+	}
+	r.Streams = streams.New(instance.Identity().IP, r)
 
 	return r, nil
 }
@@ -130,14 +290,27 @@ func New(instance instance, routerConfig Config) (*Router, error) {
 // Start starts the router.
 func (r *Router) Start(mgr *mgr.Manager) error {
 	r.mgr = mgr
+	r.ScanEvents.SetManager(mgr)
+	r.DeniedEvents.SetManager(mgr)
+	r.ErrorEvents.SetManager(mgr)
+	r.InboundEvents.SetManager(mgr)
+	// Re-enable traffic handling, as the router may be restarted.
+	r.handleTraffic.Store(!r.instance.Config().System.DisableTun)
+	r.instance.Switch().SetTTLExpiredHandler(r.handleTTLExpired)
+	r.instance.Switch().SetRelayHandler(r.recordRelayed)
 
 	mgr.Go("announce router", r.announceWorker)
 	mgr.Go("accounce disconnects", r.disconnectWorker)
+	mgr.Go("leaf routing", r.leafWorker)
+	mgr.Go("drain links", r.drainWorker)
+	mgr.Go("reload config", r.reloadConfigWorker)
 	mgr.Go("keep-alive peers", r.keepAliveWorker)
+	mgr.Go("probe loops", r.loopProbeWorker)
 
 	mgr.Go("clean conn states", r.cleanConnStatesWorker)
 	mgr.Go("clean ping handlers", r.cleanPingHandlersWorker)
 	mgr.Go("clean routing table", r.cleanRoutingTableWorker)
+	mgr.Go("streams", r.Streams.Worker)
 
 	for i := 0; i < runtime.NumCPU(); i++ {
 		mgr.Go("router", r.frameHandler)
@@ -175,6 +348,12 @@ func (r *Router) Input() chan frame.Frame {
 	return r.input
 }
 
+// PriorityInput returns the router input channel for priority frames, which
+// are handled before any frames of the regular input.
+func (r *Router) PriorityInput() chan frame.Frame {
+	return r.inputPrio
+}
+
 // Table returns the routing table.
 func (r *Router) Table() *m.RoutingTable {
 	return r.table
@@ -182,21 +361,35 @@ func (r *Router) Table() *m.RoutingTable {
 
 func (r *Router) frameHandler(w *mgr.WorkerCtx) error {
 	for {
+		// Handle waiting priority frames first.
+		var f frame.Frame
 		select {
-		case f := <-r.input:
-			if err := r.handleFrame(w, f); err != nil {
-				w.Debug(
-					"failed to handle frame",
-					"router", f.SrcIP(),
-					"dst", f.DstIP(),
-					"msgtype", f.MessageType(),
-					"err", err,
-				)
-				f.ReturnToPool()
+		case f = <-r.inputPrio:
+		default:
+			select {
+			case f = <-r.inputPrio:
+			case f = <-r.input:
+			case <-w.Done():
+				return nil
 			}
-		case <-w.Done():
-			return nil
 		}
+
+		w.Busy()
+		err := w.Guard(func() error {
+			return r.handleFrame(w, f)
+		})
+		// Frames that caused a panic are dropped and not returned to the pool.
+		if err != nil && !errors.Is(err, mgr.ErrPanic) {
+			w.Debug(
+				"failed to handle frame",
+				"router", f.SrcIP(),
+				"dst", f.DstIP(),
+				"msgtype", f.MessageType(),
+				"err", err,
+			)
+			f.ReturnToPool()
+		}
+		w.Idle()
 	}
 }
 
@@ -204,12 +397,14 @@ func (r *Router) handleFrame(w *mgr.WorkerCtx, f frame.Frame) error {
 	switch {
 	case f.DstIP() == r.instance.Identity().IP:
 		// If the frame is destined to us, handle as incoming frame.
+		r.frameStats.Record(f.MessageType(), frame.Size(f), false)
 		return r.handleIncomingFrame(w, f)
 
 	case f.MessageType() == frame.RouterHopPingDeprecated:
 		fallthrough
 	case f.MessageType() == frame.RouterHopPing:
 		// If the frame is a hop ping, handle as incoming frame.
+		r.frameStats.Record(f.MessageType(), frame.Size(f), false)
 		return r.handleIncomingFrame(w, f)
 
 	default:
@@ -218,6 +413,29 @@ func (r *Router) handleFrame(w *mgr.WorkerCtx, f frame.Frame) error {
 	}
 }
 
+// recordRelayed records a frame relayed by the switch.
+func (r *Router) recordRelayed(msgType frame.MessageType, src netip.Addr, size int) {
+	r.frameStats.Record(msgType, size, true)
+
+	// The source of relayed frames is not verified, so only count them for
+	// routers that are known from verified announcements.
+	if r.table.CountRoutes(src) > 0 {
+		r.frameStats.RecordRemote(src, size, true, r.clock.Now())
+	}
+}
+
+// recordVerified records a frame terminated at this router after its source
+// was verified.
+func (r *Router) recordVerified(src netip.Addr, size int) {
+	r.frameStats.RecordRemote(src, size, false, r.clock.Now())
+}
+
+// FrameStats returns the frame statistics of all frames received from other
+// routers.
+func (r *Router) FrameStats() *frame.Stats {
+	return r.frameStats
+}
+
 func (r *Router) handleIncomingFrame(w *mgr.WorkerCtx, f frame.Frame) error {
 	switch f.MessageType() {
 	case frame.RouterPing, frame.RouterCtrl, frame.RouterHopPing, frame.RouterHopPingDeprecated:
@@ -226,11 +444,8 @@ func (r *Router) handleIncomingFrame(w *mgr.WorkerCtx, f frame.Frame) error {
 	case frame.NetworkTraffic:
 		return r.handleIncomingTraffic(w, f)
 
-	case frame.SessionCtrl:
-		return errors.New("not yet supported")
-
-	case frame.SessionData:
-		return errors.New("not yet supported")
+	case frame.SessionCtrl, frame.SessionData:
+		return r.handleIncomingSessionMsg(w, f)
 
 	default:
 		return fmt.Errorf("unknown message type: %d", f.MessageType())
@@ -238,10 +453,14 @@ func (r *Router) handleIncomingFrame(w *mgr.WorkerCtx, f frame.Frame) error {
 }
 
 func (r *Router) handleUnsolicitedFrame(f frame.Frame) error {
+	// Get frame details first, as the frame is handed over when routing.
+	msgType, src, size := f.MessageType(), f.SrcIP(), frame.Size(f)
+
 	// For now, just forward.
 	err := r.RouteFrame(f)
 	switch {
 	case err == nil:
+		r.recordRelayed(msgType, src, size)
 		return nil
 	case errors.Is(err, ErrWouldLoop):
 		if err := r.ErrorPing.SendUnreachable(f.SrcIP(), f.DstIP()); err != nil {
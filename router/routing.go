@@ -31,41 +31,69 @@ var (
 
 	// ErrTableEmpty is returned when a packet cannot be routed because the
 	// routing table is empty.
-	ErrTableEmpty = errors.New("not routing: table empty")
+	ErrTableEmpty = m.NewError(m.CodeNoRoute, "not routing: table empty")
 )
 
 // RouteFrame forwards the given frame to the next hop based on the destination IP.
-func (r *Router) RouteFrame(f frame.Frame) error {
+func (r *Router) RouteFrame(f frame.Frame) (err error) {
 	// Check if destination is routable.
 	if !m.RoutingAddressPrefix.Contains(f.DstIP()) {
 		return fmt.Errorf("dst IP %s is not routable", f.DstIP())
 	}
 
-	// Lookup routing table for best next hop.
-	rte, _ := r.table.LookupNearestRoute(f.DstIP())
-	if rte == nil {
-		return ErrTableEmpty
+	// Leaf routers send everything to their only peer.
+	var decision *RoutingDecision
+	nextHop, ok := r.leafPeer()
+	if ok {
+		if r.sampleRoutingDecision() {
+			decision = r.newRoutingDecision(f, nil, false)
+			decision.Reason = RoutingReasonLeaf
+			decision.NextHop = nextHop
+		}
+	} else {
+		// Lookup routing table for best next hop.
+		rte, isDestination := r.table.LookupNearestRoute(f.DstIP())
+		if r.sampleRoutingDecision() {
+			decision = r.newRoutingDecision(f, rte, isDestination)
+		}
+		if rte == nil {
+			err = ErrTableEmpty
+		} else {
+			nextHop = rte.NextHop
+		}
+		if !isDestination && f.SrcIP() == r.instance.Identity().IP {
+			r.routeMiss(f.DstIP())
+		}
+	}
+	if decision != nil {
+		defer func() {
+			r.recordRoutingDecision(decision, err)
+		}()
+	}
+	if err != nil {
+		return err
 	}
 
 	// Check if this returns the frame back to where it came from.
-	if f.RecvLink() != nil && rte.NextHop == f.RecvLink().Peer() {
+	if f.RecvLink() != nil && nextHop == f.RecvLink().Peer() {
 		return ErrWouldLoop
 	}
 
 	// Forward to peer.
-	if err := r.instance.Switch().ForwardByPeer(f, rte.NextHop); err != nil {
+	if err := r.instance.Switch().ForwardByPeer(f, nextHop); err != nil {
 		return fmt.Errorf("forward: %w", err)
 	}
 	return nil
 }
 
 func (r *Router) cleanRoutingTableWorker(w *mgr.WorkerCtx) error {
-	ticker := time.NewTicker(10 * time.Minute)
+	ticker := r.clock.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-w.Done():
 			return nil
-		case <-ticker.C:
+		case <-ticker.C():
 			r.table.Clean()
 		}
 	}
@@ -0,0 +1,188 @@
+package router
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// EventScan is a scan detection event.
+type EventScan struct {
+	Router       netip.Addr
+	Ports        int
+	BlockedUntil time.Time
+	// ReportedBy is the friend that detected the scanner, if the block was
+	// shared.
+	ReportedBy netip.Addr
+}
+
+func newScanEventMgr() *mgr.EventMgr[*EventScan] {
+	return mgr.NewEventMgr[*EventScan]("scan detection", nil)
+}
+
+// scanTracker tracks denied connections of a remote router.
+type scanTracker struct {
+	started time.Time
+	ports   map[uint32]struct{}
+}
+
+// BlockedScanner is a router that was detected scanning and is blocked.
+type BlockedScanner struct {
+	Router       netip.Addr
+	BlockedUntil time.Time
+}
+
+// trackDeniedConn tracks a denied incoming connection for scan detection.
+// If the remote router exceeds the threshold, it is blocked.
+func (r *Router) trackDeniedConn(w *mgr.WorkerCtx, connKey connStateKey) {
+	settings := r.instance.Config().ScanDetection
+	if settings.Threshold <= 0 {
+		return
+	}
+
+	// Never block friends.
+	if _, ok := r.instance.Config().GetFriendByIP(connKey.remoteIP); ok {
+		return
+	}
+
+	ports, detected := r.trackScanPort(connKey)
+	if !detected {
+		return
+	}
+
+	// Block scanner and report to friends.
+	blockedUntil := r.blockScanner(w, connKey.remoteIP, ports, settings.BlockDuration, netip.Addr{})
+	if settings.Share {
+		r.ScanPing.Report(w, connKey.remoteIP, ports, blockedUntil.Sub(r.clock.Now()))
+	}
+}
+
+// trackScanPort adds the local port of the given connection to the scan
+// tracker of the remote router and returns whether the threshold was reached.
+func (r *Router) trackScanPort(connKey connStateKey) (ports int, detected bool) {
+	settings := r.instance.Config().ScanDetection
+
+	r.scanLock.Lock()
+	defer r.scanLock.Unlock()
+
+	// Get or create tracker.
+	now := r.clock.Now()
+	tracker, ok := r.scanTrackers[connKey.remoteIP]
+	if !ok || now.Sub(tracker.started) > settings.Window {
+		tracker = &scanTracker{
+			started: now,
+			ports:   make(map[uint32]struct{}),
+		}
+		r.scanTrackers[connKey.remoteIP] = tracker
+	}
+
+	// Add port and check threshold.
+	tracker.ports[uint32(connKey.protocol)<<16|uint32(connKey.localPort)] = struct{}{}
+	if len(tracker.ports) < settings.Threshold {
+		return len(tracker.ports), false
+	}
+	delete(r.scanTrackers, connKey.remoteIP)
+	return len(tracker.ports), true
+}
+
+// blockScanner blocks the given router for the given duration and returns
+// until when it is blocked. An existing longer block is kept.
+func (r *Router) blockScanner(w *mgr.WorkerCtx, remote netip.Addr, ports int, duration time.Duration, reportedBy netip.Addr) time.Time {
+	r.scanLock.Lock()
+	blockedUntil := r.clock.Now().Add(duration)
+	if existing, ok := r.blockedScanners[remote]; ok && existing.After(blockedUntil) {
+		blockedUntil = existing
+	}
+	r.blockedScanners[remote] = blockedUntil
+	r.scanLock.Unlock()
+
+	if reportedBy.IsValid() {
+		w.Warn(
+			"scan reported by friend, blocking router",
+			"router", remote,
+			"ports", ports,
+			"until", blockedUntil,
+			"friend", reportedBy,
+		)
+	} else {
+		w.Warn(
+			"scan detected, blocking router",
+			"router", remote,
+			"ports", ports,
+			"until", blockedUntil,
+		)
+	}
+	if r.ScanEvents != nil {
+		r.ScanEvents.Submit(&EventScan{
+			Router:       remote,
+			Ports:        ports,
+			BlockedUntil: blockedUntil,
+			ReportedBy:   reportedBy,
+		})
+	}
+
+	return blockedUntil
+}
+
+// isBlockedScanner returns whether the given router is currently blocked
+// because it was detected scanning.
+func (r *Router) isBlockedScanner(remote netip.Addr) bool {
+	r.scanLock.RLock()
+	defer r.scanLock.RUnlock()
+
+	blockedUntil, ok := r.blockedScanners[remote]
+	return ok && r.clock.Now().Before(blockedUntil)
+}
+
+// UnblockScanner removes the block of the given router.
+func (r *Router) UnblockScanner(remote netip.Addr) {
+	r.scanLock.Lock()
+	defer r.scanLock.Unlock()
+
+	delete(r.blockedScanners, remote)
+}
+
+// ExportBlockedScanners returns all currently blocked scanners.
+func (r *Router) ExportBlockedScanners() []BlockedScanner {
+	r.scanLock.Lock()
+	defer r.scanLock.Unlock()
+
+	now := r.clock.Now()
+	export := make([]BlockedScanner, 0, len(r.blockedScanners))
+	for remote, blockedUntil := range r.blockedScanners {
+		if now.Before(blockedUntil) {
+			export = append(export, BlockedScanner{
+				Router:       remote,
+				BlockedUntil: blockedUntil,
+			})
+		}
+	}
+
+	// Sort.
+	slices.SortFunc[[]BlockedScanner, BlockedScanner](export, func(a, b BlockedScanner) int {
+		return -a.BlockedUntil.Compare(b.BlockedUntil) // Latest first.
+	})
+
+	return export
+}
+
+func (r *Router) cleanScanTrackers() {
+	now := r.clock.Now()
+	window := r.instance.Config().ScanDetection.Window
+
+	r.scanLock.Lock()
+	defer r.scanLock.Unlock()
+
+	for remote, tracker := range r.scanTrackers {
+		if now.Sub(tracker.started) > window {
+			delete(r.scanTrackers, remote)
+		}
+	}
+	for remote, blockedUntil := range r.blockedScanners {
+		if now.After(blockedUntil) {
+			delete(r.blockedScanners, remote)
+		}
+	}
+}
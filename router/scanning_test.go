@@ -0,0 +1,95 @@
+package router
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestScanDetection(t *testing.T) {
+	t.Parallel()
+
+	identity, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	friend := netip.MustParseAddr("fd12:3456::1")
+	otherFriend := netip.MustParseAddr("fd12:3456::5")
+	scanner := netip.MustParseAddr("fd12:3456::2")
+	reported := netip.MustParseAddr("fd12:3456::3")
+	clock := m.NewVirtualClock(time.Now())
+	r := &Router{
+		clock:           clock,
+		scanTrackers:    make(map[netip.Addr]*scanTracker),
+		blockedScanners: make(map[netip.Addr]time.Time),
+		ScanEvents:      newScanEventMgr(),
+		instance: &groupTestInstance{
+			deniedTestInstance: deniedTestInstance{
+				config: config.MakeTestConfig(config.Store{
+					Router: config.Router{
+						ScanThreshold:     3,
+						ScanBlockDuration: "1h",
+						ShareScanBlocks:   true,
+					},
+					FriendConfigs: []config.FriendConfig{
+						{Name: "friend", IP: friend.String()},
+						{Name: "other", IP: otherFriend.String()},
+					},
+				}),
+			},
+			identity: identity,
+		},
+	}
+	h := NewScanPingHandler(r)
+
+	err = mgr.New("test").Do("test", func(w *mgr.WorkerCtx) error {
+		// Scanners are detected by the amount of different ports.
+		for range 2 {
+			_, detected := r.trackScanPort(connStateKey{remoteIP: scanner, protocol: 6, localPort: 22})
+			assert.False(t, detected)
+		}
+		_, detected := r.trackScanPort(connStateKey{remoteIP: scanner, protocol: 6, localPort: 23})
+		assert.False(t, detected)
+		ports, detected := r.trackScanPort(connStateKey{remoteIP: scanner, protocol: 17, localPort: 22})
+		assert.True(t, detected)
+		assert.Equal(t, 3, ports)
+
+		// Reports of friends are applied, but not longer than configured.
+		require.NoError(t, h.handleReport(w, friend, &scanPingMsg{
+			Router:   reported,
+			Ports:    10,
+			BlockFor: 24 * time.Hour,
+		}))
+		assert.True(t, r.isBlockedScanner(reported))
+		blocked := r.ExportBlockedScanners()
+		require.Len(t, blocked, 1)
+		assert.Equal(t, clock.Now().Add(time.Hour), blocked[0].BlockedUntil)
+
+		// Reports of non-friends and reports about friends are ignored.
+		require.NoError(t, h.handleReport(w, scanner, &scanPingMsg{
+			Router:   netip.MustParseAddr("fd12:3456::4"),
+			BlockFor: time.Hour,
+		}))
+		require.NoError(t, h.handleReport(w, friend, &scanPingMsg{
+			Router:   otherFriend,
+			BlockFor: time.Hour,
+		}))
+		require.Error(t, h.handleReport(w, friend, &scanPingMsg{
+			Router:   friend,
+			BlockFor: time.Hour,
+		}))
+		assert.Len(t, r.ExportBlockedScanners(), 1)
+
+		// Blocks expire.
+		clock.Advance(2 * time.Hour)
+		assert.False(t, r.isBlockedScanner(reported))
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"slices"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// isolated returns whether outgoing traffic is currently constrained to
+// friends.
+func (r *Router) isolated() bool {
+	cfg := r.instance.Config()
+	if !cfg.Router.Isolate {
+		return false
+	}
+	return cfg.IsolateSchedule == nil || cfg.IsolateSchedule.Active(r.clock.Now())
+}
+
+// isolationScheduleKey is the key of the isolation schedule in the schedule
+// states. Service names cannot be empty.
+const isolationScheduleKey = ""
+
+// applySchedules checks if any schedule changed its state and resets the
+// affected connection states, so that the policy is re-evaluated for
+// connections that were decided before the change. The schedules are always
+// evaluated from the clock, so no state is needed across restarts or reloads.
+func (r *Router) applySchedules(w *mgr.WorkerCtx) {
+	cfg := r.instance.Config()
+	now := r.clock.Now()
+
+	r.scheduleStatesLock.Lock()
+	defer r.scheduleStatesLock.Unlock()
+
+	// Check services.
+	for _, svc := range cfg.GetServices() {
+		if svc.Schedule == nil {
+			continue
+		}
+		active := svc.Schedule.Active(now)
+		if previous, ok := r.scheduleStates[svc.Name]; ok && previous != active {
+			r.resetServiceConnStates(svc)
+			w.Info(
+				"service schedule changed",
+				"service", svc.Name,
+				"schedule", svc.Schedule,
+				"reachable", active,
+			)
+		}
+		r.scheduleStates[svc.Name] = active
+	}
+
+	// Check isolation.
+	if cfg.IsolateSchedule != nil {
+		active := cfg.IsolateSchedule.Active(now)
+		if previous, ok := r.scheduleStates[isolationScheduleKey]; ok && previous != active {
+			r.resetOutboundConnStates()
+			w.Info(
+				"isolation schedule changed",
+				"schedule", cfg.IsolateSchedule,
+				"isolated", active,
+			)
+		}
+		r.scheduleStates[isolationScheduleKey] = active
+	}
+}
+
+// resetServiceConnStates removes all inbound connection states to the given
+// service, so that the policy is re-evaluated.
+func (r *Router) resetServiceConnStates(svc config.Service) {
+	policyKeys := svc.PolicyKeys()
+
+	r.connStatesLock.Lock()
+	defer r.connStatesLock.Unlock()
+
+	for key, entry := range r.connStates {
+		if entry.inbound && slices.Contains(policyKeys, config.MakePolicyKey(key.protocol, key.localPort)) {
+			delete(r.connStates, key)
+		}
+	}
+}
+
+// resetOutboundConnStates removes all outbound connection states, so that the
+// policy is re-evaluated.
+func (r *Router) resetOutboundConnStates() {
+	r.connStatesLock.Lock()
+	defer r.connStatesLock.Unlock()
+
+	for key, entry := range r.connStates {
+		if !entry.inbound {
+			delete(r.connStates, key)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+func TestSchedules(t *testing.T) {
+	t.Parallel()
+
+	// Monday morning.
+	clock := m.NewVirtualClock(time.Date(2026, 10, 12, 8, 0, 0, 0, time.Local))
+	friend := netip.MustParseAddr("fd12:3456::1")
+	stranger := netip.MustParseAddr("fd12:3456::2")
+	r := &Router{
+		clock:          clock,
+		connStates:     make(map[connStateKey]*connStateEntry),
+		scheduleStates: make(map[string]bool),
+		instance: &deniedTestInstance{
+			config: config.MakeTestConfig(config.Store{
+				Router: config.Router{Isolate: true, IsolateSchedule: "weekdays 18:00-07:00"},
+				FriendConfigs: []config.FriendConfig{
+					{Name: "friend", IP: friend.String()},
+				},
+				ServiceConfigs: []config.ServiceConfig{
+					{Name: "web", URL: "http://:80", Public: true, Schedule: "weekdays 09:00-17:00"},
+				},
+			}),
+		},
+	}
+	r.AccessPing = NewAccessPingHandler(r)
+	r.KnockPing = NewKnockPingHandler(r)
+
+	inboundKey := connStateKey{remoteIP: stranger, protocol: 6, localPort: 80, remotePort: 50000}
+	outboundKey := connStateKey{remoteIP: stranger, protocol: 6, localPort: 50001, remotePort: 443}
+
+	err := mgr.New("test").Do("test", func(w *mgr.WorkerCtx) error {
+		// Service is outside of schedule, router is not isolated.
+		eval := r.EvaluatePolicy(true, stranger, 6, 80)
+		assert.False(t, eval.Allowed)
+		assert.Equal(t, PolicyRuleOutsideSchedule, eval.Rule)
+		eval = r.EvaluatePolicy(false, stranger, 6, 443)
+		assert.True(t, eval.Allowed)
+		assert.Equal(t, PolicyRuleNotIsolated, eval.Rule)
+		r.applySchedules(w)
+
+		// Service is within schedule.
+		clock.Advance(2 * time.Hour)
+		eval = r.EvaluatePolicy(true, stranger, 6, 80)
+		assert.True(t, eval.Allowed)
+		assert.Equal(t, PolicyRulePublicService, eval.Rule)
+		r.applySchedules(w)
+
+		// Add connection states.
+		r.connStates[inboundKey] = &connStateEntry{inbound: true}
+		r.connStates[outboundKey] = &connStateEntry{}
+
+		// Service schedule ends, router becomes isolated.
+		clock.Advance(10 * time.Hour)
+		eval = r.EvaluatePolicy(true, stranger, 6, 80)
+		assert.False(t, eval.Allowed)
+		eval = r.EvaluatePolicy(false, stranger, 6, 443)
+		assert.False(t, eval.Allowed)
+		assert.Equal(t, PolicyRuleIsolated, eval.Rule)
+		eval = r.EvaluatePolicy(false, friend, 6, 443)
+		assert.True(t, eval.Allowed)
+
+		// Connection states are reset on change.
+		r.applySchedules(w)
+		assert.Empty(t, r.connStates)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestSchedulesWithAccessChanges(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Date(2026, 10, 12, 8, 0, 0, 0, time.Local))
+	cfg := config.MakeTestConfig(config.Store{
+		ServiceConfigs: []config.ServiceConfig{
+			{Name: "game", URL: "udp://:27015", AccessRequests: true, Schedule: "weekdays 09:00-17:00"},
+		},
+	})
+	r := &Router{
+		clock:          clock,
+		connStates:     make(map[connStateKey]*connStateEntry),
+		scheduleStates: make(map[string]bool),
+		instance:       &deniedTestInstance{config: cfg},
+	}
+
+	// Services may be changed while schedules are applied.
+	// Run with -race to check.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			ip := netip.AddrFrom16([16]byte{0xfd, 0x12, 0x34, 0x56, 15: byte(i)})
+			assert.NoError(t, cfg.AllowServiceAccess("game", ip))
+		}
+	}()
+	err := mgr.New("test").Do("test", func(w *mgr.WorkerCtx) error {
+		for range 100 {
+			clock.Advance(time.Hour)
+			r.applySchedules(w)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	<-done
+
+	svc, ok := cfg.GetService("game")
+	require.True(t, ok)
+	assert.Len(t, svc.For, 100)
+}
@@ -0,0 +1,238 @@
+package router
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+const (
+	// serviceUsagePeriod defines the length of a service usage history period.
+	serviceUsagePeriod = 1 * time.Hour
+	// serviceUsageHistory defines how many periods of service usage are kept.
+	serviceUsageHistory = 24
+	// maxServiceUsageRemotes limits the amount of unique remote routers tracked
+	// per service, as they are chosen by others.
+	maxServiceUsageRemotes = 10_000
+)
+
+// serviceStats aggregates the usage of a service, identified by its policy
+// key. Traffic is counted with atomics, as it is updated for every packet.
+type serviceStats struct {
+	connections atomic.Uint64
+	dataIn      atomic.Uint64
+	dataOut     atomic.Uint64
+
+	lock          sync.Mutex
+	since         time.Time
+	lastUsed      time.Time
+	remotes       map[netip.Addr]struct{}
+	periodStart   time.Time
+	periodBase    ServiceUsagePeriod
+	periodRemotes map[netip.Addr]struct{}
+	history       []ServiceUsagePeriod
+}
+
+// ServiceUsage holds the usage statistics of a service for a policy key.
+type ServiceUsage struct {
+	Service   string `json:"service"`
+	PolicyKey string `json:"policyKey"`
+	Protocol  uint8  `json:"protocol"`
+	Port      uint16 `json:"port"`
+
+	Since    time.Time `json:"since"`
+	LastUsed time.Time `json:"lastUsed,omitempty"`
+
+	// Connections counts allowed inbound connections.
+	Connections uint64 `json:"connections"`
+	// Remotes counts unique remote routers, up to a limit.
+	Remotes uint64 `json:"remotes"`
+	DataIn  uint64 `json:"dataIn"`
+	DataOut uint64 `json:"dataOut"`
+
+	// History holds the usage of past periods, newest first.
+	// The current period is not included.
+	History []ServiceUsagePeriod `json:"history,omitempty"`
+}
+
+// ServiceUsagePeriod holds the usage of a service in a period.
+type ServiceUsagePeriod struct {
+	Start       time.Time `json:"start"`
+	Connections uint64    `json:"connections"`
+	Remotes     uint64    `json:"remotes"`
+	DataIn      uint64    `json:"dataIn"`
+	DataOut     uint64    `json:"dataOut"`
+}
+
+// Used returns whether there was any usage.
+func (usage ServiceUsage) Used() bool {
+	return usage.Connections > 0
+}
+
+// ProtocolName returns the protocol name, if available.
+func (usage ServiceUsage) ProtocolName() string {
+	return (&ExportedConnection{Protocol: usage.Protocol}).ProtocolName()
+}
+
+// getServiceStats returns the usage stats for the given policy key and
+// creates them if needed.
+func (r *Router) getServiceStats(policyKey string) *serviceStats {
+	r.serviceStatsLock.RLock()
+	stats, ok := r.serviceStats[policyKey]
+	r.serviceStatsLock.RUnlock()
+	if ok {
+		return stats
+	}
+
+	r.serviceStatsLock.Lock()
+	defer r.serviceStatsLock.Unlock()
+
+	// Check again, as stats might have been created in the meantime.
+	stats, ok = r.serviceStats[policyKey]
+	if !ok {
+		now := r.clock.Now()
+		stats = &serviceStats{
+			since:         now,
+			remotes:       make(map[netip.Addr]struct{}),
+			periodStart:   now.Truncate(serviceUsagePeriod),
+			periodRemotes: make(map[netip.Addr]struct{}),
+		}
+		r.serviceStats[policyKey] = stats
+	}
+	return stats
+}
+
+// recordServiceConn records a new allowed inbound connection to a service.
+// The returned stats must be used to record the traffic of the connection.
+func (r *Router) recordServiceConn(connKey connStateKey) *serviceStats {
+	stats := r.getServiceStats(config.MakePolicyKey(connKey.protocol, connKey.localPort))
+	stats.connections.Add(1)
+
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	stats.lastUsed = r.clock.Now()
+	if len(stats.remotes) < maxServiceUsageRemotes {
+		stats.remotes[connKey.remoteIP] = struct{}{}
+	}
+	if len(stats.periodRemotes) < maxServiceUsageRemotes {
+		stats.periodRemotes[connKey.remoteIP] = struct{}{}
+	}
+	return stats
+}
+
+// addData records traffic of a connection to the service.
+func (stats *serviceStats) addData(inbound bool, dataLength int) {
+	if inbound {
+		stats.dataIn.Add(uint64(dataLength))
+	} else {
+		stats.dataOut.Add(uint64(dataLength))
+	}
+}
+
+// totals returns the total usage since the stats were created.
+// Must be called with the lock held.
+func (stats *serviceStats) totals() ServiceUsagePeriod {
+	return ServiceUsagePeriod{
+		Start:       stats.since,
+		Connections: stats.connections.Load(),
+		Remotes:     uint64(len(stats.remotes)),
+		DataIn:      stats.dataIn.Load(),
+		DataOut:     stats.dataOut.Load(),
+	}
+}
+
+// rotate closes the current period, if it has ended.
+// Must be called with the lock held.
+func (stats *serviceStats) rotate(now time.Time) {
+	if now.Before(stats.periodStart.Add(serviceUsagePeriod)) {
+		return
+	}
+
+	// Save usage of the ended period as the difference to its start.
+	totals := stats.totals()
+	stats.history = append(stats.history, ServiceUsagePeriod{
+		Start:       stats.periodStart,
+		Connections: totals.Connections - stats.periodBase.Connections,
+		Remotes:     uint64(len(stats.periodRemotes)),
+		DataIn:      totals.DataIn - stats.periodBase.DataIn,
+		DataOut:     totals.DataOut - stats.periodBase.DataOut,
+	})
+	if len(stats.history) > serviceUsageHistory {
+		stats.history = slices.Delete(stats.history, 0, len(stats.history)-serviceUsageHistory)
+	}
+
+	// Start new period.
+	stats.periodStart = now.Truncate(serviceUsagePeriod)
+	stats.periodBase = totals
+	clear(stats.periodRemotes)
+}
+
+// rotateServiceStats closes ended usage periods and removes the stats of
+// services that are not configured anymore.
+func (r *Router) rotateServiceStats() {
+	configured := make(map[string]struct{})
+	for _, svc := range r.instance.Config().GetServices() {
+		for _, policyKey := range svc.PolicyKeys() {
+			configured[policyKey] = struct{}{}
+		}
+	}
+	now := r.clock.Now()
+
+	r.serviceStatsLock.Lock()
+	defer r.serviceStatsLock.Unlock()
+
+	for policyKey, stats := range r.serviceStats {
+		if _, ok := configured[policyKey]; !ok {
+			delete(r.serviceStats, policyKey)
+			continue
+		}
+
+		stats.lock.Lock()
+		stats.rotate(now)
+		stats.lock.Unlock()
+	}
+}
+
+// ServiceUsage returns the usage statistics of all configured services, per
+// policy key. Services that were not used are included.
+func (r *Router) ServiceUsage() []ServiceUsage {
+	started := r.instance.Config().Started()
+	services := r.instance.Config().GetServices()
+
+	usage := make([]ServiceUsage, 0, len(services))
+	for _, svc := range services {
+		for _, policyKey := range svc.PolicyKeys() {
+			svcUsage := ServiceUsage{
+				Service:   svc.Name,
+				PolicyKey: policyKey,
+				Since:     started,
+			}
+			svcUsage.Protocol, svcUsage.Port, _ = config.ParsePolicyKey(policyKey)
+
+			r.serviceStatsLock.RLock()
+			stats, ok := r.serviceStats[policyKey]
+			r.serviceStatsLock.RUnlock()
+			if ok {
+				stats.lock.Lock()
+				totals := stats.totals()
+				svcUsage.Since = stats.since
+				svcUsage.LastUsed = stats.lastUsed
+				svcUsage.Connections = totals.Connections
+				svcUsage.Remotes = totals.Remotes
+				svcUsage.DataIn = totals.DataIn
+				svcUsage.DataOut = totals.DataOut
+				svcUsage.History = slices.Clone(stats.history)
+				stats.lock.Unlock()
+				slices.Reverse(svcUsage.History)
+			}
+
+			usage = append(usage, svcUsage)
+		}
+	}
+	return usage
+}
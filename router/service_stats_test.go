@@ -0,0 +1,82 @@
+package router
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestServiceStats(t *testing.T) {
+	t.Parallel()
+
+	clock := m.NewVirtualClock(time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC))
+	r := &Router{
+		clock:        clock,
+		serviceStats: make(map[string]*serviceStats),
+	}
+	remoteA := netip.MustParseAddr("fd00::a")
+	remoteB := netip.MustParseAddr("fd00::b")
+	connA := connStateKey{remoteIP: remoteA, protocol: 6, localPort: 80, remotePort: 1000}
+	connB := connStateKey{remoteIP: remoteB, protocol: 6, localPort: 80, remotePort: 1000}
+
+	// Record connections to the same service.
+	r.recordServiceConn(connA).addData(true, 100)
+	r.recordServiceConn(connA).addData(false, 1000)
+	r.recordServiceConn(connB).addData(true, 50)
+	stats := r.getServiceStats("6-80")
+	require.Len(t, r.serviceStats, 1)
+
+	stats.lock.Lock()
+	totals := stats.totals()
+	stats.lock.Unlock()
+	assert.Equal(t, uint64(3), totals.Connections)
+	assert.Equal(t, uint64(2), totals.Remotes)
+	assert.Equal(t, uint64(150), totals.DataIn)
+	assert.Equal(t, uint64(1000), totals.DataOut)
+
+	// Period must not be closed early.
+	stats.lock.Lock()
+	stats.rotate(clock.Now())
+	stats.lock.Unlock()
+	assert.Empty(t, stats.history)
+
+	// Close period and record usage in the next one.
+	clock.Advance(serviceUsagePeriod)
+	stats.lock.Lock()
+	stats.rotate(clock.Now())
+	stats.lock.Unlock()
+	r.recordServiceConn(connB).addData(true, 10)
+	clock.Advance(serviceUsagePeriod)
+	stats.lock.Lock()
+	stats.rotate(clock.Now())
+	stats.lock.Unlock()
+
+	require.Len(t, stats.history, 2)
+	assert.Equal(t, ServiceUsagePeriod{
+		Start:       time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Connections: 3,
+		Remotes:     2,
+		DataIn:      150,
+		DataOut:     1000,
+	}, stats.history[0])
+	assert.Equal(t, ServiceUsagePeriod{
+		Start:       time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+		Connections: 1,
+		Remotes:     1,
+		DataIn:      10,
+	}, stats.history[1])
+
+	// History is limited.
+	for range serviceUsageHistory {
+		clock.Advance(serviceUsagePeriod)
+		stats.lock.Lock()
+		stats.rotate(clock.Now())
+		stats.lock.Unlock()
+	}
+	assert.Len(t, stats.history, serviceUsageHistory)
+}
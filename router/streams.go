@@ -0,0 +1,126 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/state"
+)
+
+// SetupSession sets up an encrypted session with the given router.
+func (r *Router) SetupSession(ctx context.Context, dst netip.Addr) error {
+	session := r.instance.State().GetSession(dst)
+	if session != nil && session.Encryption().IsSetUp() {
+		return nil
+	}
+
+	notify, err := r.HelloPing.Send(dst)
+	if err != nil && !errors.Is(err, ErrAlreadyActive) {
+		return fmt.Errorf("send hello ping: %w", err)
+	}
+	select {
+	case <-notify:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for encryption: %w", ctx.Err())
+	}
+}
+
+// SendSessionMsg sends data to the given router in an encrypted session frame.
+// The session must be set up.
+func (r *Router) SendSessionMsg(dst netip.Addr, msgType frame.MessageType, data []byte) error {
+	if msgType != frame.SessionCtrl && msgType != frame.SessionData {
+		return fmt.Errorf("invalid session message type: %s", msgType)
+	}
+	session := r.instance.State().GetSession(dst)
+	if session == nil || !session.Encryption().IsSetUp() {
+		return state.ErrEncryptionNotSetUp
+	}
+
+	// Make frame.
+	switchPath := r.getPinnedPath(dst)
+	f, err := r.instance.FrameBuilder().NewFrameV1(
+		r.instance.Identity().IP, dst,
+		msgType,
+		switchBlockSpace(switchPath), data, nil,
+	)
+	if err != nil {
+		return fmt.Errorf("build frame: %w", err)
+	}
+
+	// Seal.
+	if err := f.Seal(session); err != nil {
+		f.ReturnToPool()
+		return fmt.Errorf("seal frame: %w", err)
+	}
+
+	// Send via pinned route or route frame.
+	if switchPath != nil {
+		err = r.sendBySwitchPath(f, switchPath)
+	} else {
+		err = r.RouteFrame(f)
+	}
+	if err != nil {
+		f.ReturnToPool()
+		return fmt.Errorf("send frame: %w", err)
+	}
+	return nil
+}
+
+func (r *Router) handleIncomingSessionMsg(w *mgr.WorkerCtx, f frame.Frame) error {
+	// Get session.
+	src := f.SrcIP()
+	session := r.instance.State().GetSession(src)
+	if session == nil {
+		return fmt.Errorf("unknown src router: %s", src)
+	}
+
+	// Unseal.
+	size := frame.Size(f)
+	if err := f.Unseal(session); err != nil {
+		// Resume session or send error ping if encryption is not set up.
+		if errors.Is(err, state.ErrEncryptionNotSetUp) {
+			if r.HelloPing.Resume(src) {
+				f.ReturnToPool()
+				return nil
+			}
+			f.ReturnToPool()
+			if err := r.ErrorPing.SendNoEncryptionKeys(src); err != nil {
+				w.Debug(
+					"failed to send error ping no encryption keys",
+					"router", src,
+					"err", err,
+				)
+			}
+			return nil
+		}
+		if errors.Is(err, frame.ErrDecryptionFailed) && session.DecryptionFailed() {
+			// The keys differ, let the router fall back to a key exchange.
+			if err := r.ErrorPing.SendNoEncryptionKeys(src); err != nil {
+				w.Debug(
+					"failed to send error ping no encryption keys",
+					"router", src,
+					"err", err,
+				)
+			}
+		}
+		return fmt.Errorf("unseal: %w", err)
+	}
+	session.DecryptionSucceeded()
+	r.recordVerified(src, size)
+
+	// Hand to streams, which copy the data they keep.
+	defer f.ReturnToPool()
+	if err := r.Streams.Handle(src, f.MessageData()); err != nil {
+		w.Debug(
+			"invalid stream message",
+			"router", src,
+			"err", err,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package router
+
+// TCP flags.
+const (
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagACK = 0x10
+)
+
+// Observed TCP events of a connection, stored as bits in the connection state.
+const (
+	tcpSeenSYN uint32 = 1 << iota
+	tcpSeenSYNACK
+	tcpSeenACK
+	tcpSeenFINIn
+	tcpSeenFINOut
+	tcpSeenRST
+)
+
+type tcpState uint8
+
+// TCP states, as far as needed for connection tracking.
+const (
+	tcpStateUnknown tcpState = iota
+	tcpStateConnecting
+	tcpStateEstablished
+	tcpStateClosing
+	tcpStateClosed
+)
+
+// updateTCPState records the TCP flags of a packet.
+func (entry *connStateEntry) updateTCPState(inbound bool, flags uint8) {
+	var seen uint32
+	switch {
+	case flags&tcpFlagRST != 0:
+		seen |= tcpSeenRST
+	case flags&tcpFlagSYN != 0 && flags&tcpFlagACK != 0:
+		seen |= tcpSeenSYNACK
+	case flags&tcpFlagSYN != 0:
+		seen |= tcpSeenSYN
+	case flags&tcpFlagACK != 0:
+		seen |= tcpSeenACK
+	}
+	if flags&tcpFlagFIN != 0 {
+		if inbound {
+			seen |= tcpSeenFINIn
+		} else {
+			seen |= tcpSeenFINOut
+		}
+	}
+	if seen == 0 {
+		return
+	}
+
+	for {
+		old := entry.tcpSeen.Load()
+		if old&seen == seen || entry.tcpSeen.CompareAndSwap(old, old|seen) {
+			return
+		}
+	}
+}
+
+// tcpState returns the TCP state of the connection.
+func (entry *connStateEntry) tcpState() tcpState {
+	seen := entry.tcpSeen.Load()
+	switch {
+	case seen&tcpSeenRST != 0,
+		seen&tcpSeenFINIn != 0 && seen&tcpSeenFINOut != 0:
+		return tcpStateClosed
+	case seen&(tcpSeenFINIn|tcpSeenFINOut) != 0:
+		return tcpStateClosing
+	case seen&tcpSeenSYNACK != 0 && seen&tcpSeenACK != 0:
+		return tcpStateEstablished
+	case seen&tcpSeenSYN == 0 && seen&tcpSeenACK != 0:
+		// Connection was picked up after the handshake, eg. after a restart.
+		return tcpStateEstablished
+	case seen&(tcpSeenSYN|tcpSeenSYNACK) != 0:
+		return tcpStateConnecting
+	default:
+		return tcpStateUnknown
+	}
+}
+
+// Name returns the name of the TCP state.
+func (state tcpState) Name() string {
+	switch state {
+	case tcpStateConnecting:
+		return "connecting"
+	case tcpStateEstablished:
+		return "established"
+	case tcpStateClosing:
+		return "closing"
+	case tcpStateClosed:
+		return "closed"
+	case tcpStateUnknown:
+		fallthrough
+	default:
+		return ""
+	}
+}
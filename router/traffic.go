@@ -6,6 +6,8 @@ import (
 	"net/netip"
 	"time"
 
+	"golang.org/x/net/ipv6"
+
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
@@ -20,37 +22,59 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 	}
 
 	// Unseal.
+	size := frame.Size(f)
 	if err := f.Unseal(session); err != nil {
-		// Send error ping if encryption is not set up.
+		// Resume session or send error ping if encryption is not set up.
 		if errors.Is(err, state.ErrEncryptionNotSetUp) {
+			if r.HelloPing.Resume(f.SrcIP()) {
+				return nil
+			}
 			if err := r.ErrorPing.SendNoEncryptionKeys(f.SrcIP()); err != nil {
 				return fmt.Errorf("send error ping no encryption keys: %w", err)
 			}
 			return nil // TODO: Do we need to return the frame to pool here?
 		}
+		if errors.Is(err, frame.ErrDecryptionFailed) && session.DecryptionFailed() {
+			// The keys differ, let the router fall back to a key exchange.
+			if err := r.ErrorPing.SendNoEncryptionKeys(f.SrcIP()); err != nil {
+				return fmt.Errorf("send error ping no encryption keys: %w", err)
+			}
+		}
 		return fmt.Errorf("unseal: %w", err)
 	}
+	session.DecryptionSucceeded()
+	r.recordVerified(f.SrcIP(), size)
 
 	// Get packet metadata.
 	packetData := f.MessageData()
-	if len(packetData) < 44 {
+	if len(packetData) < ipv6.HeaderLen {
 		return fmt.Errorf("packet too small: %d bytes", len(packetData))
 	}
 	src := netip.AddrFrom16([16]byte(packetData[8:24]))
 	dst := netip.AddrFrom16([16]byte(packetData[24:40]))
-	var (
-		srcPort uint16
-		dstPort uint16
-	)
-	protocol := packetData[6]
-	if protocol == 6 || protocol == 17 {
-		// TODO: Handle additional IPv6 headers.
-		srcPort = m.GetUint16(packetData[40:42])
-		dstPort = m.GetUint16(packetData[42:44])
+	info, err := parsePacketInfo(packetData)
+	if err != nil {
+		f.ReturnToPool()
+		return fmt.Errorf("invalid packet: %w", err)
 	}
+	protocol, srcPort, dstPort := info.protocol, info.srcPort, info.dstPort
 
 	// Check if handling is enabled or
 	if !r.handleTraffic.Load() {
+		// Answer pings to the router itself, if there is no tun device to do so.
+		// Routers without tun device do not offer any services, but should still
+		// be reachable for diagnostics.
+		if r.instance.Config().System.DisableTun &&
+			dst == r.instance.Identity().IP &&
+			isEchoRequest(packetData) {
+			defer f.ReturnToPool()
+			if err := r.replyToEchoRequest(session, packetData); err != nil &&
+				!errors.Is(err, errICMPRateLimited) {
+				return fmt.Errorf("reply to echo request: %w", err)
+			}
+			return nil
+		}
+
 		if err := r.ErrorPing.SendRejected(src, dst, protocol, dstPort); err != nil {
 			return fmt.Errorf("send rejected ping: %w", err)
 		}
@@ -71,6 +95,37 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 		f.ReturnToPool()
 		return errors.New("invalid packet: dst IP is internal range")
 	}
+	// Silently drop traffic from blocked scanners.
+	if r.isBlockedScanner(src) {
+		f.ReturnToPool()
+		return nil
+	}
+	// Drop traffic from blackholed routers.
+	if action, blackholed := r.checkBlackhole(src); blackholed {
+		f.ReturnToPool()
+		if action == BlackholeDrop || !r.allowBlackholeReply(src) {
+			return nil
+		}
+		switch action {
+		case BlackholeProhibited:
+			if err := r.ErrorPing.SendAccessDenied(src, dst, protocol, dstPort); err != nil {
+				return fmt.Errorf("send access denied ping: %w", err)
+			}
+		case BlackholeUnreachable:
+			if err := r.ErrorPing.SendRejected(src, dst, protocol, dstPort); err != nil {
+				return fmt.Errorf("send rejected ping: %w", err)
+			}
+		case BlackholeDrop:
+		}
+		return nil
+	}
+	// Drop following fragments of packets that were not allowed.
+	if !r.resolveFragment(src, dst, &info) {
+		f.ReturnToPool()
+		return nil
+	}
+	srcPort, dstPort = info.srcPort, info.dstPort
+
 	// Check policy.
 	status, _ := r.checkPolicy(w, true, connStateKey{
 		localIP:    dst,
@@ -78,16 +133,27 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 		protocol:   protocol,
 		localPort:  dstPort,
 		remotePort: srcPort,
-	}, len(packetData))
+	}, len(packetData), info.tcpFlags)
 	if status != connStatusAllowed {
 		// Packet may not be received.
 		f.ReturnToPool()
+		// Do not acknowledge hidden services in any way.
+		if svc, ok := r.instance.Config().GetServiceByPolicy(protocol, dstPort); ok && svc.Hidden {
+			return nil
+		}
 		if err := r.ErrorPing.SendAccessDenied(src, dst, protocol, dstPort); err != nil {
 			return fmt.Errorf("send access denied ping: %w", err)
 		}
 
 		return nil
 	}
+	r.trackFirstFragment(src, dst, info)
+
+	// Learn path MTU and clamp TCP MSS to it.
+	r.learnFromPacketTooBig(src, packetData, info)
+	if !r.instance.Config().System.DisableMSSClamping {
+		clampTCPMSS(packetData, info, r.pathMTU(src, session))
+	}
 
 	// Hand frame to tun device.
 	select {
@@ -103,34 +169,26 @@ func (r *Router) handleIncomingTraffic(w *mgr.WorkerCtx, f frame.Frame) error {
 }
 
 func (r *Router) cleanConnStatesWorker(w *mgr.WorkerCtx) error {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := r.clock.NewTicker(10 * time.Second)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-w.Done():
 			return nil
-		case <-ticker.C:
+		case <-ticker.C():
 			r.cleanConnStates()
-		}
-	}
-}
-
-func (r *Router) cleanConnStates() {
-	removeThreshold := time.Now().Add(-10 * time.Minute).Unix()
-	shortRemoveThreshold := time.Now().Add(-10 * time.Second).Unix()
-
-	r.connStatesLock.Lock()
-	defer r.connStatesLock.Unlock()
-
-	for key, entry := range r.connStates {
-		switch {
-		case entry.shortLived:
-			if entry.lastSeen.Load() < shortRemoveThreshold {
-				delete(r.connStates, key)
-			}
-		default:
-			if entry.lastSeen.Load() < removeThreshold {
-				delete(r.connStates, key)
-			}
+			r.cleanAccessRequests()
+			r.cleanScanTrackers()
+			r.cleanBlackholes()
+			r.cleanDeniedAttempts()
+			r.cleanUnreachable()
+			r.cleanLoopStats()
+			r.cleanPathMTUs()
+			r.rotateServiceStats()
+			r.cleanImplausiblePaths()
+			r.cleanFragments()
+			r.applySchedules(w)
+			r.cleanOutboundPrompts(w)
 		}
 	}
 }
@@ -4,15 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"net/netip"
-	"time"
 
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv6"
 
+	"github.com/mycoria/mycoria/api/netstack"
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/frame"
 	"github.com/mycoria/mycoria/m"
 	"github.com/mycoria/mycoria/mgr"
+	"github.com/mycoria/mycoria/state"
 )
 
 func (r *Router) handleTun(w *mgr.WorkerCtx) error {
@@ -49,7 +50,7 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 	case ipVersion != 6:
 		w.Warn("ignoring packet with unknown IP version")
 		return
-	case len(packetData) < 44:
+	case len(packetData) < ipv6.HeaderLen:
 		w.Warn("ignoring too small packet", "packetSize", len(packetData))
 		return
 	}
@@ -57,25 +58,29 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 	// Parse important fields.
 	src := netip.AddrFrom16([16]byte(packetData[8:24]))
 	dst := netip.AddrFrom16([16]byte(packetData[24:40]))
-	var (
-		srcPort uint16
-		dstPort uint16
-	)
-	protocol := packetData[6]
-	if protocol == 6 || protocol == 17 {
-		// TODO: Handle additional IPv6 headers.
-		srcPort = m.GetUint16(packetData[40:42])
-		dstPort = m.GetUint16(packetData[42:44])
-	}
 
-	// DEBUG:
-	// prot := packetData[6]
-	// fmt.Printf("packet: %s %s %d\n", src, dst, prot)
+	// Walk extension headers to get the upper layer protocol and ports.
+	info, err := parsePacketInfo(packetData)
+	if err != nil {
+		w.Debug("ignoring invalid packet", "err", err)
+		r.instance.FrameBuilder().ReturnPooledSlice(packetData)
+		return
+	}
+	protocol, srcPort, dstPort := info.protocol, info.srcPort, info.dstPort
 
 	// Raw packet handling.
 	if dst == config.DefaultAPIAddress {
 		// Submit packet to API if going to API IP.
-		r.instance.NetStack().SubmitPacket(packetData)
+		// Return packet data to pool, if the API is overloaded.
+		if !r.instance.NetStack().SubmitPacket(packetData, netstack.PacketInfo{
+			Src:      src,
+			Protocol: protocol,
+			SrcPort:  srcPort,
+			DstPort:  dstPort,
+			TCPFlags: info.tcpFlags,
+		}) {
+			r.instance.FrameBuilder().ReturnPooledSlice(packetData)
+		}
 		return
 	}
 
@@ -99,6 +104,12 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 			"dropping packet with dst outside of mycoria",
 			"dst", dst,
 		)
+		if err := r.respondWithNoRoute(src, packetData); err != nil {
+			w.Debug(
+				"failed to send icmp error",
+				"err", err,
+			)
+		}
 		return
 
 	case src != routerIP:
@@ -109,6 +120,34 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 		)
 		return
 	}
+	// Drop traffic to blackholed routers.
+	if action, blackholed := r.checkBlackhole(dst); blackholed {
+		var err error
+		switch action {
+		case BlackholeProhibited:
+			err = r.respondWithError(src, packetData, connStatusProhibited)
+		case BlackholeUnreachable:
+			err = r.respondWithError(src, packetData, connStatusUnreachable)
+		case BlackholeDrop:
+		}
+		if err != nil {
+			w.Debug(
+				"failed to send icmp error",
+				"err", err,
+			)
+		}
+		return
+	}
+	// Drop following fragments of packets that were not allowed.
+	if !r.resolveFragment(src, dst, &info) {
+		w.Debug(
+			"dropping fragment of unknown packet",
+			"dst", dst,
+		)
+		return
+	}
+	srcPort, dstPort = info.srcPort, info.dstPort
+
 	// Check policy.
 	key := connStateKey{
 		localIP:    src,
@@ -117,7 +156,7 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 		localPort:  srcPort,
 		remotePort: dstPort,
 	}
-	status, statusUpdate := r.checkPolicy(w, false, key, len(packetData))
+	status, statusUpdate := r.checkPolicy(w, false, key, len(packetData), info.tcpFlags)
 	// Check for similar status to reduce network clutter.
 	// Also, error pings are heavily rate limited.
 	// This ensure more reliable and stable network response.
@@ -134,68 +173,69 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 		}
 		return
 	}
+	r.trackFirstFragment(src, dst, info)
 
 	// Get session.
 	session := r.instance.State().GetSession(dst)
 	if session == nil || !session.Encryption().IsSetUp() {
-		// Setup encryption with hello ping.
-		notify, err := r.HelloPing.Send(dst)
-		if err != nil {
-			switch {
-			case errors.Is(err, ErrTableEmpty):
-				// Ignore packets if we can't route them.
-			case errors.Is(err, ErrAlreadyActive):
+		// Answer immediately if the destination recently failed to be reached.
+		if r.isUnreachable(dst) {
+			if err := r.respondWithError(src, packetData, connStatusUnreachable); err != nil {
 				w.Debug(
-					"hello ping already active, dropping additional packet",
-					"dst", dst,
-				)
-			default:
-				w.Warn(
-					"hello ping failed",
-					"dst", dst,
+					"failed to send icmp error",
 					"err", err,
 				)
 			}
 			return
 		}
 
-		// Wait for hello ping to finish.
-		select {
-		case <-notify:
-			// Continue
+		// Setup encryption with hello ping.
+		notify, err := r.HelloPing.Send(dst)
+		switch {
+		case err == nil || errors.Is(err, ErrAlreadyActive):
+			// Queue packet until encryption is set up.
+			created, queued := r.queuePendingPacket(dst, packetData)
+			if !queued {
+				w.Debug(
+					"pending packet queue full, dropping packet",
+					"dst", dst,
+				)
+			}
+			if created {
+				r.mgr.Go("send pending packets", func(w *mgr.WorkerCtx) error {
+					r.sendPendingPackets(w, src, dst, notify, statusUpdate)
+					return nil
+				})
+			}
 
-		case status = <-statusUpdate:
-			// Connection status changed.
-			if err := r.respondWithError(src, packetData, status); err != nil {
+		case errors.Is(err, ErrTableEmpty):
+			r.markUnreachable(dst)
+			// Notify OS that we can't route packets.
+			if err := r.respondWithNoRoute(src, packetData); err != nil {
 				w.Debug(
 					"failed to send icmp error",
 					"err", err,
 				)
 			}
-			return
 
-		case <-time.After(200 * time.Millisecond):
-			// Wait for 200ms in hot path, blocking one worker.
-			// TODO: Is this a good idea?
-			return
-
-		case <-w.Done():
-			return
-		}
-
-		session = r.instance.State().GetSession(dst)
-		if session == nil {
+		default:
 			w.Warn(
-				"internal error: no session after hello ping",
-				"router", dst,
+				"hello ping failed",
 				"dst", dst,
+				"err", err,
 			)
-			return
 		}
+		return
 	}
 
+	r.sendTunPacket(w, src, dst, session, packetData)
+}
+
+// sendTunPacket sends the given packet from the tun device to dst using the
+// given session.
+func (r *Router) sendTunPacket(w *mgr.WorkerCtx, src, dst netip.Addr, session *state.Session, packetData []byte) {
 	// Check MTU.
-	dstMTU := session.TunMTU()
+	dstMTU := r.pathMTU(dst, session)
 	if dstMTU != 0 && len(packetData) > dstMTU {
 		// Packet is too big for MTU, notify OS.
 		if err := r.sendICMP6PacketTooBig(src, dstMTU, packetData); err != nil {
@@ -207,12 +247,20 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 		return
 	}
 
+	// Clamp TCP MSS to path MTU.
+	if !r.instance.Config().System.DisableMSSClamping {
+		if info, err := parsePacketInfo(packetData); err == nil {
+			clampTCPMSS(packetData, info, dstMTU)
+		}
+	}
+
 	// Make new frame from data.
 	// TODO: Stop copying data. (Don't forget about the ReturnPooledSlice above!)
+	switchPath := r.getPinnedPath(dst)
 	f, err := r.instance.FrameBuilder().NewFrameV1(
 		r.instance.Identity().IP, dst,
 		frame.NetworkTraffic,
-		nil, packetData, nil,
+		switchBlockSpace(switchPath), packetData, nil,
 	)
 	if err != nil {
 		w.Warn(
@@ -234,14 +282,37 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 		return
 	}
 
+	// Send via pinned route.
+	if switchPath != nil {
+		if err := r.sendBySwitchPath(f, switchPath); err != nil {
+			f.ReturnToPool()
+			w.Warn(
+				"failed to send frame via pinned route",
+				"dst", dst,
+				"err", err,
+			)
+		}
+		return
+	}
+
 	// Send the frame along its way!
 	if err := r.RouteFrame(f); err != nil {
+		f.ReturnToPool()
+		if errors.Is(err, ErrTableEmpty) {
+			// Notify OS that we can't route packets.
+			if err := r.respondWithNoRoute(src, packetData); err != nil {
+				w.Debug(
+					"failed to send icmp error",
+					"err", err,
+				)
+			}
+			return
+		}
 		w.Warn(
 			"failed to route frame ",
 			"dst", dst,
 			"err", err,
 		)
-		f.ReturnToPool()
 		return
 	}
 }
@@ -249,6 +320,11 @@ func (r *Router) handleTunPacket(w *mgr.WorkerCtx, packetData []byte) { //nolint
 func (r *Router) respondWithError(to netip.Addr, packetData []byte, status connStatus) error {
 	// Note: packetData must be copied!
 
+	// Check if we may respond at all.
+	if !mayRespondWithICMPError(packetData) {
+		return nil
+	}
+
 	switch status {
 	case connStatusUnreachable:
 		// Reply with ICMP error 1.3: "address unreachable".
@@ -273,7 +349,7 @@ func (r *Router) respondWithError(to netip.Addr, packetData []byte, status connS
 		// r.mgr.Debug("sent icmp error 1.6 reject route")
 		return r.sendICMP6Unreachable(to, 6, packetData)
 
-	case connStatusUnknown, connStatusAllowed:
+	case connStatusUnknown, connStatusAllowed, connStatusPending:
 		fallthrough
 	default:
 		// Drop packet.
@@ -281,10 +357,22 @@ func (r *Router) respondWithError(to netip.Addr, packetData []byte, status connS
 	}
 }
 
+func (r *Router) respondWithNoRoute(to netip.Addr, packetData []byte) error {
+	// Note: packetData must be copied!
+
+	// Check if we may respond at all.
+	if !mayRespondWithICMPError(packetData) {
+		return nil
+	}
+
+	// Reply with ICMP error 1.0: "no route to destination".
+	return r.sendICMP6Unreachable(to, 0, packetData)
+}
+
 func (r *Router) sendICMP6Unreachable(to netip.Addr, code int, packetData []byte) error {
 	packetBody := packetData
-	if len(packetBody) > 48 {
-		packetBody = packetBody[:48]
+	if len(packetBody) > icmpErrorMaxBody {
+		packetBody = packetBody[:icmpErrorMaxBody]
 	}
 
 	return r.sendICMP6(to, icmp.Message{
@@ -298,8 +386,8 @@ func (r *Router) sendICMP6Unreachable(to netip.Addr, code int, packetData []byte
 
 func (r *Router) sendICMP6PacketTooBig(to netip.Addr, mtu int, packetData []byte) error {
 	packetBody := packetData
-	if len(packetBody) > 48 {
-		packetBody = packetBody[:48]
+	if len(packetBody) > icmpErrorMaxBody {
+		packetBody = packetBody[:icmpErrorMaxBody]
 	}
 
 	return r.sendICMP6(to, icmp.Message{
@@ -312,6 +400,11 @@ func (r *Router) sendICMP6PacketTooBig(to netip.Addr, mtu int, packetData []byte
 }
 
 func (r *Router) sendICMP6(to netip.Addr, icmpMsg icmp.Message) error {
+	// Check rate limit.
+	if !r.icmpLimiter.Allow() {
+		return errICMPRateLimited
+	}
+
 	// Build ICMP packet.
 	icmpData, err := icmpMsg.Marshal(
 		icmp.IPv6PseudoHeader(config.DefaultAPIAddress.AsSlice(), to.AsSlice()),
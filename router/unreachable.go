@@ -0,0 +1,78 @@
+package router
+
+import (
+	"net/netip"
+	"time"
+)
+
+const (
+	// unreachableMinBackoff is the backoff after the first failure to reach a destination.
+	unreachableMinBackoff = 1 * time.Second
+	// unreachableMaxBackoff is the maximum backoff for unreachable destinations.
+	unreachableMaxBackoff = 5 * time.Minute
+)
+
+// unreachableEntry is a negative cache entry for a destination that could
+// not be reached.
+type unreachableEntry struct {
+	failures int
+	until    time.Time
+}
+
+// markUnreachable records a failure to reach the given destination.
+// Subsequent packets to the destination are answered immediately until the
+// backoff, which doubles with every consecutive failure, has passed.
+func (r *Router) markUnreachable(dst netip.Addr) (backoff time.Duration) {
+	r.unreachableLock.Lock()
+	defer r.unreachableLock.Unlock()
+
+	entry, ok := r.unreachable[dst]
+	if !ok {
+		entry = &unreachableEntry{}
+		r.unreachable[dst] = entry
+	}
+	entry.failures++
+
+	// Calculate exponential backoff.
+	backoff = unreachableMinBackoff
+	for i := 1; i < entry.failures && backoff < unreachableMaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, unreachableMaxBackoff)
+	entry.until = r.clock.Now().Add(backoff)
+
+	return backoff
+}
+
+// clearUnreachable removes the given destination from the negative cache.
+func (r *Router) clearUnreachable(dst netip.Addr) {
+	r.unreachableLock.Lock()
+	defer r.unreachableLock.Unlock()
+
+	delete(r.unreachable, dst)
+}
+
+// isUnreachable returns whether the given destination recently failed to be
+// reached and is still within its backoff.
+func (r *Router) isUnreachable(dst netip.Addr) bool {
+	r.unreachableLock.RLock()
+	defer r.unreachableLock.RUnlock()
+
+	entry, ok := r.unreachable[dst]
+	return ok && r.clock.Now().Before(entry.until)
+}
+
+// cleanUnreachable removes negative cache entries that have not failed for a
+// while, which resets their backoff.
+func (r *Router) cleanUnreachable() {
+	threshold := r.clock.Now().Add(-unreachableMaxBackoff)
+
+	r.unreachableLock.Lock()
+	defer r.unreachableLock.Unlock()
+
+	for dst, entry := range r.unreachable {
+		if entry.until.Before(threshold) {
+			delete(r.unreachable, dst)
+		}
+	}
+}
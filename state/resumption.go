@@ -0,0 +1,129 @@
+package state
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/storage"
+)
+
+// ResumptionTicketTTL defines how long a session can be resumed after the
+// last key exchange or resumption.
+const ResumptionTicketTTL = 24 * time.Hour
+
+const resumptionNonceSize = 16
+
+// Resumption Errors.
+var (
+	ErrNoResumptionTicket       = errors.New("no resumption ticket")
+	ErrResumptionTicketMismatch = errors.New("resumption ticket mismatch")
+)
+
+// SaveResumptionTicket saves a ticket for resuming the given encryption
+// session with the router, eg. after a restart.
+// If the ticket cannot be saved, the ticket of the previous session is
+// deleted, as it would not match the ticket of the router anymore.
+func (state *State) SaveResumptionTicket(ip netip.Addr, encSession *EncryptionSession) error {
+	secret := encSession.ResumptionSecret()
+	if len(secret) == 0 {
+		_ = state.storage.DeleteResumptionTicket(ip)
+		return ErrNoResumptionTicket
+	}
+
+	err := state.storage.SaveResumptionTicket(&storage.StoredResumptionTicket{
+		Router:  ip,
+		Secret:  secret,
+		Expires: time.Now().Add(ResumptionTicketTTL),
+	})
+	if err != nil {
+		_ = state.storage.DeleteResumptionTicket(ip)
+		return err
+	}
+	return nil
+}
+
+// DeleteResumptionTicket deletes the resumption ticket of the router.
+func (state *State) DeleteResumptionTicket(ip netip.Addr) error {
+	return state.storage.DeleteResumptionTicket(ip)
+}
+
+// ResumeSession derives a resumed encryption session with the router from
+// the stored resumption ticket. It returns the ticket ID and nonce, which must
+// be sent to the router in order for it to resume the session too.
+// The current session and ticket are kept until the router acknowledges the
+// resumption and the resumed session is set with CompleteResumption.
+func (state *State) ResumeSession(ip netip.Addr) (ticketID, nonce []byte, encSession *EncryptionSession, err error) {
+	// Get ticket.
+	ticket, err := state.storage.GetResumptionTicket(ip)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, nil, ErrNoResumptionTicket
+		}
+		return nil, nil, nil, fmt.Errorf("get resumption ticket: %w", err)
+	}
+
+	// Resume encryption session with new nonce.
+	nonce = make([]byte, resumptionNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	encSession, err = ResumeEncryptionSession(ticket.Secret, nonce, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return ResumptionTicketID(ticket.Secret), nonce, encSession, nil
+}
+
+// CompleteResumption sets the resumed encryption session returned by
+// ResumeSession, after the router acknowledged the resumption.
+func (state *State) CompleteResumption(ip netip.Addr, encSession *EncryptionSession) error {
+	session := state.GetSession(ip)
+	if session == nil {
+		return fmt.Errorf("no session for %s", ip)
+	}
+	if err := state.SaveResumptionTicket(ip, encSession); err != nil {
+		return fmt.Errorf("save resumption ticket: %w", err)
+	}
+	session.SetEncryptionSession(encSession)
+
+	return nil
+}
+
+// AcceptResumption resumes the encryption session with the router, as
+// requested by it. If the ticket does not match, it is deleted, as the router
+// will fall back to a key exchange.
+func (state *State) AcceptResumption(ip netip.Addr, ticketID, nonce []byte) error {
+	// Get ticket and session.
+	ticket, err := state.storage.GetResumptionTicket(ip)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrNoResumptionTicket
+		}
+		return fmt.Errorf("get resumption ticket: %w", err)
+	}
+	if subtle.ConstantTimeCompare(ResumptionTicketID(ticket.Secret), ticketID) == 0 {
+		_ = state.storage.DeleteResumptionTicket(ip)
+		return ErrResumptionTicketMismatch
+	}
+	session := state.GetSession(ip)
+	if session == nil {
+		return fmt.Errorf("no session for %s", ip)
+	}
+
+	// Resume encryption session with given nonce.
+	encSession, err := ResumeEncryptionSession(ticket.Secret, nonce, false)
+	if err != nil {
+		return err
+	}
+	if err := state.SaveResumptionTicket(ip, encSession); err != nil {
+		return fmt.Errorf("save resumption ticket: %w", err)
+	}
+	session.SetEncryptionSession(encSession)
+
+	return nil
+}
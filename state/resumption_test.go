@@ -0,0 +1,88 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/storage"
+)
+
+func TestSessionResumption(t *testing.T) {
+	t.Parallel()
+
+	// Create two routers that know each other.
+	newRouter := func(store storage.Storage, id *m.Address, other *m.Address) *State {
+		t.Helper()
+
+		state := New(&instanceStub{
+			IdentityStub: id,
+			ConfigStub:   &config.Config{},
+		}, store)
+		require.NoError(t, state.AddRouter(&other.PublicAddress))
+		return state
+	}
+	idA, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	idB, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	storeA := storage.NewMemStorage()
+	stateA := newRouter(storeA, idA, idB)
+	stateB := newRouter(storage.NewMemStorage(), idB, idA)
+
+	// Set up encryption with key exchange.
+	encA := stateA.GetSession(idB.IP).Encryption()
+	encB := stateB.GetSession(idA.IP).Encryption()
+	kxKey, kxType, err := encA.InitKeyClientStart()
+	require.NoError(t, err)
+	kxKey, kxType, err = encB.InitKeyServer(kxKey, kxType)
+	require.NoError(t, err)
+	require.NoError(t, encA.InitKeyClientComplete(kxKey, kxType))
+	encA.InitCleanup()
+	encB.InitCleanup()
+	require.NoError(t, stateA.SaveResumptionTicket(idB.IP, encA))
+	require.NoError(t, stateB.SaveResumptionTicket(idA.IP, encB))
+
+	// Restart router A and resume.
+	stateA = newRouter(storeA, idA, idB)
+	assert.False(t, stateA.GetSession(idB.IP).Encryption().IsSetUp())
+	ticketID, nonce, resumed, err := stateA.ResumeSession(idB.IP)
+	require.NoError(t, err)
+	assert.False(t, stateA.GetSession(idB.IP).Encryption().IsSetUp(), "resumed session must only be used when acknowledged")
+	require.NoError(t, stateB.AcceptResumption(idA.IP, ticketID, nonce))
+	require.NoError(t, stateA.CompleteResumption(idB.IP, resumed))
+	checkEncryption(t, stateA.GetSession(idB.IP).Encryption(), stateB.GetSession(idA.IP).Encryption())
+
+	// Tickets must only be usable once.
+	assert.ErrorIs(t, stateB.AcceptResumption(idA.IP, ticketID, nonce), ErrResumptionTicketMismatch)
+	_, _, _, err = stateB.ResumeSession(idA.IP)
+	assert.ErrorIs(t, err, ErrNoResumptionTicket, "mismatching ticket should be deleted")
+
+	// Router A can resume again with the rotated ticket, but B cannot anymore.
+	ticketID, nonce, _, err = stateA.ResumeSession(idB.IP)
+	require.NoError(t, err)
+	assert.ErrorIs(t, stateB.AcceptResumption(idA.IP, ticketID, nonce), ErrNoResumptionTicket)
+}
+
+func checkEncryption(t *testing.T, client, server *EncryptionSession) {
+	t.Helper()
+
+	require.True(t, client.IsSetUp())
+	require.True(t, server.IsSetUp())
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+
+	sealed := client.outCipher.Seal(nil, nonce, testData, nil)
+	opened, err := server.inCipher.Open(nil, nonce, sealed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, testData, opened)
+
+	sealed = server.outCipher.Seal(nil, nonce, testData, nil)
+	opened, err = client.inCipher.Open(nil, nonce, sealed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, testData, opened)
+}
@@ -25,6 +25,11 @@ var (
 	ErrEncryptionNotSetUp = errors.New("encryption is not set up")
 )
 
+// maxDecryptFailures defines after how many frames failing to decrypt in a
+// row the encryption keys are regarded as out of sync. Single failures may be
+// caused by frames that were sent before the keys changed.
+const maxDecryptFailures = 8
+
 // Session is a logical session with another router.
 type Session struct {
 	id      netip.Addr
@@ -36,10 +41,27 @@ type Session struct {
 	encryption *EncryptionSession
 	mtu        atomic.Int32
 
+	// decryptFailures counts the frames that failed to decrypt in a row.
+	decryptFailures atomic.Int32
+
 	lock  sync.Mutex
 	state *State
 }
 
+// NewSession returns a session with the given router that is not managed by
+// the state. As it cannot create signing and encryption sessions by itself,
+// they must be supplied. It is used to build frames outside of a router, eg.
+// for test vectors.
+func NewSession(address *m.PublicAddress, signing *SigningSession, encryption *EncryptionSession) *Session {
+	return &Session{
+		id:           address.IP,
+		address:      address,
+		lastActivity: time.Now(),
+		signing:      signing,
+		encryption:   encryption,
+	}
+}
+
 // For returns who this session is for.
 func (s *Session) For() netip.Addr {
 	return s.id
@@ -72,6 +94,26 @@ func (s *Session) SetEncryptionSession(encSession *EncryptionSession) {
 	defer s.lock.Unlock()
 
 	s.encryption = encSession
+	s.decryptFailures.Store(0)
+}
+
+// DecryptionFailed records that a frame of the router failed to decrypt.
+// It returns true when frames failed to decrypt repeatedly, which means that
+// the encryption keys of the routers differ, eg. after a failed resumption.
+// The count is then reset.
+func (s *Session) DecryptionFailed() bool {
+	if s.decryptFailures.Add(1) < maxDecryptFailures {
+		return false
+	}
+	s.decryptFailures.Store(0)
+	return true
+}
+
+// DecryptionSucceeded records that a frame of the router was decrypted.
+func (s *Session) DecryptionSucceeded() {
+	if s.decryptFailures.Load() != 0 {
+		s.decryptFailures.Store(0)
+	}
 }
 
 // Encryption returns the encryption session.
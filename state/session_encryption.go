@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"math/bits"
 	"sync"
 	"sync/atomic"
@@ -32,6 +33,11 @@ type EncryptionSession struct {
 	kxRemotePublic  *ecdh.PublicKey
 	inKey           []byte
 	outKey          []byte
+	// kxKeys, if set, replaces the random source of private exchange keys.
+	kxKeys io.Reader
+
+	// resumptionSecret allows to resume the session without a key exchange.
+	resumptionSecret []byte
 
 	// Active ciphers.
 	inCipher  cipher.AEAD
@@ -51,6 +57,16 @@ func NewEncryptionSession() *EncryptionSession {
 	}
 }
 
+// NewDeterministicEncryptionSession returns a new encryption session that
+// reads its private exchange keys from the given source instead of
+// crypto/rand, so that sessions can be reproduced, eg. for test vectors.
+// Every key reads 32 bytes. It must never be used for live traffic.
+func NewDeterministicEncryptionSession(kxKeys io.Reader) *EncryptionSession {
+	s := NewEncryptionSession()
+	s.kxKeys = kxKeys
+	return s
+}
+
 // IsSetUp returns whether the encryption is set up and ready to use.
 func (s *EncryptionSession) IsSetUp() bool {
 	s.lock.Lock()
@@ -65,7 +81,7 @@ func (s *EncryptionSession) InitKeyClientStart() (kxKey []byte, kxType string, e
 	defer s.lock.Unlock()
 
 	// Generate new private key.
-	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	private, err := s.generateKXKey()
 	if err != nil {
 		return nil, "", fmt.Errorf("generate key: %w", err)
 	}
@@ -75,6 +91,18 @@ func (s *EncryptionSession) InitKeyClientStart() (kxKey []byte, kxType string, e
 	return s.kxRouterPrivate.PublicKey().Bytes(), defaultKXType, nil
 }
 
+// generateKXKey generates a new private exchange key.
+func (s *EncryptionSession) generateKXKey() (*ecdh.PrivateKey, error) {
+	if s.kxKeys != nil {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(s.kxKeys, key); err != nil {
+			return nil, err
+		}
+		return ecdh.X25519().NewPrivateKey(key)
+	}
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
 // InitKeyServer takes the exchange key of the client and generates exchange keys on the server.
 // It already uses that information to finalize the encryption keys.
 // Call InitCleanup() when done with key setup.
@@ -95,7 +123,7 @@ func (s *EncryptionSession) InitKeyServer(kxKey []byte, kxType string) (returnKx
 	s.kxRemotePublic = public
 
 	// Generate new private key.
-	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	private, err := s.generateKXKey()
 	if err != nil {
 		return nil, "", fmt.Errorf("generate key: %w", err)
 	}
@@ -135,10 +163,17 @@ func (s *EncryptionSession) InitKeyClientComplete(kxKey []byte, kxType string) e
 }
 
 const (
-	kxBaseContext     = "mycoria key exch"
-	kxSetupContext    = " - initial setup"
-	kxExtraContext    = " - extra keys - "
-	kxRolloverContext = " - key rollover "
+	kxBaseContext       = "mycoria key exch"
+	kxSetupContext      = " - initial setup"
+	kxExtraContext      = " - extra keys - "
+	kxRolloverContext   = " - key rollover "
+	kxResumeContext     = " - resumed keys "
+	kxResumptionContext = " - resume secret"
+	kxTicketIDContext   = " - resume ticket"
+
+	resumptionSecretSize   = 32
+	resumptionTicketSize   = 16
+	minResumptionNonceSize = 16
 )
 
 func (s *EncryptionSession) initFinalize(reverse bool, keyContext string) error {
@@ -152,9 +187,21 @@ func (s *EncryptionSession) initFinalize(reverse bool, keyContext string) error
 		return fmt.Errorf("compute shared key: %w", err)
 	}
 
+	// Derive resumption secret for initial setup only.
+	if keyContext == kxSetupContext {
+		s.resumptionSecret = make([]byte, resumptionSecretSize)
+		blake3.DeriveKey(kxBaseContext+kxResumptionContext, sharedKey, s.resumptionSecret)
+	}
+
+	return s.setKeys(sharedKey, keyContext, reverse)
+}
+
+// setKeys derives the keys from the given secret and context and sets up the
+// ciphers.
+func (s *EncryptionSession) setKeys(secret []byte, keyContext string, reverse bool) error {
 	// Derive keys.
 	keys := make([]byte, chacha20poly1305.KeySize*2)
-	blake3.DeriveKey(kxBaseContext+keyContext, sharedKey, keys)
+	blake3.DeriveKey(kxBaseContext+keyContext, secret, keys)
 	key1 := keys[:chacha20poly1305.KeySize]
 	key2 := keys[chacha20poly1305.KeySize:]
 	keys = nil //nolint:wastedassign // Maintainability.
@@ -194,6 +241,53 @@ func (s *EncryptionSession) initFinalize(reverse bool, keyContext string) error
 	return nil
 }
 
+// ResumptionSecret returns the secret for resuming the session without a key
+// exchange. It is only available for sessions that were set up with a key
+// exchange or resumed.
+func (s *EncryptionSession) ResumptionSecret() []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.resumptionSecret
+}
+
+// ResumeEncryptionSession returns a new encryption session derived from the
+// resumption secret of a previous session and a nonce chosen by the resuming
+// router, which must set client.
+// The new session has a new resumption secret, so that every secret is only
+// used once.
+func ResumeEncryptionSession(secret, nonce []byte, client bool) (*EncryptionSession, error) {
+	if len(secret) != resumptionSecretSize {
+		return nil, errors.New("invalid resumption secret")
+	}
+	if len(nonce) < minResumptionNonceSize {
+		return nil, errors.New("resumption nonce too short")
+	}
+
+	// Combine secret and nonce.
+	resumed := make([]byte, 0, len(secret)+len(nonce))
+	resumed = append(resumed, secret...)
+	resumed = append(resumed, nonce...)
+
+	// Derive keys and next resumption secret.
+	s := NewEncryptionSession()
+	if err := s.setKeys(resumed, kxResumeContext, client); err != nil {
+		return nil, fmt.Errorf("set keys: %w", err)
+	}
+	s.resumptionSecret = make([]byte, resumptionSecretSize)
+	blake3.DeriveKey(kxBaseContext+kxResumptionContext, resumed, s.resumptionSecret)
+
+	return s, nil
+}
+
+// ResumptionTicketID returns the public ID of the given resumption secret.
+// It allows routers to check if they hold the same secret.
+func ResumptionTicketID(secret []byte) []byte {
+	id := make([]byte, resumptionTicketSize)
+	blake3.DeriveKey(kxBaseContext+kxTicketIDContext, secret, id)
+	return id
+}
+
 // InitCleanup cleans up the exchange keys after the initial setup.
 func (s *EncryptionSession) InitCleanup() {
 	s.kxRemotePublic = nil
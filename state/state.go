@@ -116,7 +116,7 @@ func (state *State) QueryNearestRouters(ip netip.Addr, max int) ([]*storage.Stor
 		func(a *storage.StoredRouter) bool {
 			return !a.Offline &&
 				a.PublicInfo != nil &&
-				len(a.PublicInfo.IANA) > 0 &&
+				(len(a.PublicInfo.IANA) > 0 || (a.PublicInfo.Reachability != nil && len(a.PublicInfo.Reachability.Observed) > 0)) &&
 				len(a.PublicInfo.Listeners) > 0 &&
 				a.Universe == state.instance.Config().Router.Universe
 		},
@@ -172,6 +172,26 @@ func (state *State) AddPublicRouterInfo(id netip.Addr, info *m.RouterInfo) error
 	return nil
 }
 
+// RouterCapabilities returns the protocol features the router announced in
+// its public router info. Returns zero if they are unknown.
+func (state *State) RouterCapabilities(id netip.Addr) m.Capabilities {
+	stored, err := state.storage.GetRouter(id)
+	if err != nil || stored.PublicInfo == nil {
+		return 0
+	}
+	return stored.PublicInfo.Capabilities
+}
+
+// RouterPublicInfo returns the public router info the router announced.
+// Returns nil if it is unknown.
+func (state *State) RouterPublicInfo(id netip.Addr) *m.RouterInfo {
+	stored, err := state.storage.GetRouter(id)
+	if err != nil || stored.Universe != state.instance.Config().Router.Universe {
+		return nil
+	}
+	return stored.PublicInfo
+}
+
 // MarkRouterOffline marks that the router has announced it is going offline.
 func (state *State) MarkRouterOffline(id netip.Addr) error {
 	// Check if we already have that router.
@@ -242,6 +262,19 @@ func (state *State) GetSession(ip netip.Addr) *Session {
 	return s
 }
 
+// GetSessions returns all current sessions.
+// Sessions are not marked as in use.
+func (state *State) GetSessions() []*Session {
+	state.sessionsLock.Lock()
+	defer state.sessionsLock.Unlock()
+
+	sessions := make([]*Session, 0, len(state.sessions))
+	for _, s := range state.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
 func (state *State) sessionCleanerWorker(w *mgr.WorkerCtx) error {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"net/netip"
+	"time"
+)
+
+// StoredApp is the format used to store local applications registered with
+// the API. Only the hash of the token is stored.
+type StoredApp struct {
+	Name      string
+	TokenHash []byte
+	Created   time.Time
+
+	// OutboundFriends allows the app to open streams to friends.
+	OutboundFriends bool
+	// OutboundRouters holds further routers the app may open streams to.
+	OutboundRouters []netip.Addr
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"net/netip"
+	"time"
+)
+
+const (
+	// LinkHistoryRetention defines how long link sessions are kept.
+	LinkHistoryRetention = 90 * 24 * time.Hour
+
+	// maxLinkSessionsPerPeer defines how many link sessions are kept per peer.
+	maxLinkSessionsPerPeer = 1000
+)
+
+// StoredLinkSession is the format used to store finished link sessions.
+type StoredLinkSession struct {
+	Peer         netip.Addr
+	PeeringURL   string `json:",omitempty"`
+	Outgoing     bool
+	Connected    time.Time
+	Disconnected time.Time
+	Reason       string `json:",omitempty"`
+	// Active is set for the currently active session, which is not stored.
+	// Its disconnect time is the time of the query.
+	Active bool `json:",omitempty"`
+	// AvgLatency is the average latency (one direction) in milliseconds.
+	AvgLatency uint16
+	BytesIn    uint64
+	BytesOut   uint64
+}
+
+// Duration returns how long the session lasted.
+func (s StoredLinkSession) Duration() time.Duration {
+	return s.Disconnected.Sub(s.Connected)
+}
+
+// LinkSessionSummary summarizes the link sessions with a peer over a period.
+type LinkSessionSummary struct {
+	Peer     netip.Addr
+	Sessions int
+	// Uptime is the total time the link was up within the period.
+	Uptime time.Duration
+	// Availability is the share of the period the link was up.
+	Availability float64
+	// AvgLatency is the average latency (one direction) in milliseconds,
+	// weighted by session duration.
+	AvgLatency uint16
+	BytesIn    uint64
+	BytesOut   uint64
+	// Longest is the duration of the longest session.
+	Longest    time.Duration
+	LastReason string
+	LastSeen   time.Time
+}
+
+// SummarizeLinkSessions summarizes the given sessions of a single peer for
+// the period from since until now.
+// Sessions must be sorted by connect time.
+func SummarizeLinkSessions(peer netip.Addr, sessions []StoredLinkSession, since time.Time) LinkSessionSummary {
+	summary := LinkSessionSummary{
+		Peer:     peer,
+		Sessions: len(sessions),
+	}
+	if len(sessions) == 0 {
+		return summary
+	}
+
+	var weightedLatency float64
+	for _, session := range sessions {
+		// Only count uptime within the period.
+		start := session.Connected
+		if start.Before(since) {
+			start = since
+		}
+		if up := session.Disconnected.Sub(start); up > 0 {
+			summary.Uptime += up
+			weightedLatency += float64(session.AvgLatency) * up.Seconds()
+		}
+		summary.Longest = max(summary.Longest, session.Duration())
+		summary.BytesIn += session.BytesIn
+		summary.BytesOut += session.BytesOut
+	}
+
+	last := sessions[len(sessions)-1]
+	summary.LastReason = last.Reason
+	summary.LastSeen = last.Disconnected
+	if summary.Uptime > 0 {
+		summary.AvgLatency = uint16(weightedLatency / summary.Uptime.Seconds())
+	}
+	if period := time.Since(since); period > 0 {
+		summary.Availability = min(float64(summary.Uptime)/float64(period), 1)
+	}
+
+	return summary
+}
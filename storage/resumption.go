@@ -0,0 +1,15 @@
+package storage
+
+import (
+	"net/netip"
+	"time"
+)
+
+// StoredResumptionTicket is the format used to store session resumption
+// tickets. The secret allows to resume an encrypted session with the router
+// without a new key exchange, eg. after a restart.
+type StoredResumptionTicket struct {
+	Router  netip.Addr
+	Secret  []byte
+	Expires time.Time
+}
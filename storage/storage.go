@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"net/netip"
+	"time"
 
 	"github.com/mycoria/mycoria/mgr"
 )
@@ -17,6 +18,9 @@ type Storage interface {
 	DatabaseModule
 	RouterStorage
 	DomainMappingStorage
+	LinkHistoryStorage
+	ResumptionTicketStorage
+	AppStorage
 }
 
 // DatabaseModule is an interface to a managed storage backend.
@@ -42,3 +46,35 @@ type DomainMappingStorage interface {
 	SaveMapping(domain string, router netip.Addr) error
 	DeleteMapping(domain string) error
 }
+
+// LinkHistoryStorage is an interface to a link session history storage.
+type LinkHistoryStorage interface {
+	AddLinkSession(session StoredLinkSession) error
+	// QueryLinkSessions returns the sessions with the given peer that ended
+	// after since, sorted by connect time. If peer is invalid, sessions of all
+	// peers are returned.
+	QueryLinkSessions(peer netip.Addr, since time.Time) ([]StoredLinkSession, error)
+}
+
+// ResumptionTicketStorage is an interface to a session resumption ticket
+// storage. Tickets hold secrets and must not be shared.
+type ResumptionTicketStorage interface {
+	// GetResumptionTicket returns the ticket for the given router.
+	// Expired tickets are not returned.
+	GetResumptionTicket(router netip.Addr) (*StoredResumptionTicket, error)
+	// QueryResumptionTickets returns all tickets that are not expired,
+	// sorted by expiry, latest first.
+	QueryResumptionTickets() ([]StoredResumptionTicket, error)
+	SaveResumptionTicket(ticket *StoredResumptionTicket) error
+	DeleteResumptionTicket(router netip.Addr) error
+}
+
+// AppStorage is an interface to a storage of local applications registered
+// with the API.
+type AppStorage interface {
+	GetApp(name string) (*StoredApp, error)
+	// QueryApps returns all apps, sorted by name.
+	QueryApps() ([]StoredApp, error)
+	SaveApp(app *StoredApp) error
+	DeleteApp(name string) error
+}
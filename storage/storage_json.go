@@ -20,8 +20,12 @@ type JSONFileStorage struct {
 
 // JSONStorageFormat is the format in which the JSONFileStorage stores the state.
 type JSONStorageFormat struct {
-	Routers  map[netip.Addr]*StoredRouter `json:"routers,omitempty"  yaml:"routers,omitempty"`
-	Mappings map[string]StoredMapping     `json:"mappings,omitempty" yaml:"mappings,omitempty"`
+	Routers      map[netip.Addr]*StoredRouter       `json:"routers,omitempty"      yaml:"routers,omitempty"`
+	Mappings     map[string]StoredMapping           `json:"mappings,omitempty"     yaml:"mappings,omitempty"`
+	LinkSessions map[netip.Addr][]StoredLinkSession `json:"linkSessions,omitempty" yaml:"linkSessions,omitempty"`
+
+	ResumptionTickets map[netip.Addr]*StoredResumptionTicket `json:"resumptionTickets,omitempty" yaml:"resumptionTickets,omitempty"`
+	Apps              map[string]*StoredApp                  `json:"apps,omitempty"              yaml:"apps,omitempty"`
 }
 
 // NewJSONFileStorage loads the json file at the given location and returns a new storage.
@@ -39,6 +43,9 @@ func NewJSONFileStorage(filename string) (*JSONFileStorage, error) {
 		}
 		s.routers = stored.Routers
 		s.mappings = stored.Mappings
+		s.linkSessions = stored.LinkSessions
+		s.resumptionTickets = stored.ResumptionTickets
+		s.apps = stored.Apps
 
 	case errors.Is(err, os.ErrNotExist):
 		// File does not exist, start empty.
@@ -54,20 +61,46 @@ func NewJSONFileStorage(filename string) (*JSONFileStorage, error) {
 	if s.mappings == nil {
 		s.mappings = make(map[string]StoredMapping)
 	}
+	if s.linkSessions == nil {
+		s.linkSessions = make(map[netip.Addr][]StoredLinkSession)
+	}
+	if s.resumptionTickets == nil {
+		s.resumptionTickets = make(map[netip.Addr]*StoredResumptionTicket)
+	}
+	if s.apps == nil {
+		s.apps = make(map[string]*StoredApp)
+	}
 
 	return s, nil
 }
 
 // Stop writes to storage to file.
 func (s *JSONFileStorage) Stop(mgr *mgr.Manager) error {
+	s.pruneResumptionTickets()
+
+	s.linkSessionsLock.RLock()
+	s.resumptionTicketsLock.RLock()
+	s.appsLock.RLock()
 	data, err := json.Marshal(&JSONStorageFormat{
-		Routers:  s.routers,
-		Mappings: s.mappings,
+		Routers:           s.routers,
+		Mappings:          s.mappings,
+		LinkSessions:      s.linkSessions,
+		ResumptionTickets: s.resumptionTickets,
+		Apps:              s.apps,
 	})
+	s.appsLock.RUnlock()
+	s.resumptionTicketsLock.RUnlock()
+	s.linkSessionsLock.RUnlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal json storage: %w", err)
 	}
-	err = os.WriteFile(s.filename, data, 0o0644) //nolint:gosec // no secrets
+	// Resumption tickets and app tokens are secret, only the owner may read
+	// the file.
+	// Restrict existing files before writing.
+	if err := os.Chmod(s.filename, 0o600); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to restrict permissions of %s: %w", s.filename, err)
+	}
+	err = os.WriteFile(s.filename, data, 0o600)
 	if err != nil {
 		return fmt.Errorf("failed to write json storage to %s: %w", s.filename, err)
 	}
@@ -17,13 +17,26 @@ type MemStorage struct {
 
 	mappings     map[string]StoredMapping
 	mappingsLock sync.RWMutex
+
+	linkSessions     map[netip.Addr][]StoredLinkSession
+	linkSessionsLock sync.RWMutex
+
+	resumptionTickets     map[netip.Addr]*StoredResumptionTicket
+	resumptionTicketsLock sync.RWMutex
+
+	apps     map[string]*StoredApp
+	appsLock sync.RWMutex
 }
 
 // NewMemStorage returns an empty storage.
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		routers:  make(map[netip.Addr]*StoredRouter),
-		mappings: make(map[string]StoredMapping),
+		routers:      make(map[netip.Addr]*StoredRouter),
+		mappings:     make(map[string]StoredMapping),
+		linkSessions: make(map[netip.Addr][]StoredLinkSession),
+
+		resumptionTickets: make(map[netip.Addr]*StoredResumptionTicket),
+		apps:              make(map[string]*StoredApp),
 	}
 }
 
@@ -105,6 +118,8 @@ func (s *MemStorage) Size() int {
 
 // Prune prunes the storage down to the specified amount of entries.
 func (s *MemStorage) Prune(keep int) {
+	s.pruneResumptionTickets()
+
 	s.routersLock.Lock()
 	defer s.routersLock.Unlock()
 
@@ -135,6 +150,19 @@ func (s *MemStorage) Prune(keep int) {
 	// TODO: Add more pruning steps.
 }
 
+// pruneResumptionTickets removes expired resumption tickets.
+func (s *MemStorage) pruneResumptionTickets() {
+	s.resumptionTicketsLock.Lock()
+	defer s.resumptionTicketsLock.Unlock()
+
+	now := time.Now()
+	for ip, ticket := range s.resumptionTickets {
+		if now.After(ticket.Expires) {
+			delete(s.resumptionTickets, ip)
+		}
+	}
+}
+
 // GetMapping returns a domain mapping from the storage.
 func (s *MemStorage) GetMapping(domain string) (router netip.Addr, err error) {
 	s.mappingsLock.RLock()
@@ -190,3 +218,150 @@ func (s *MemStorage) DeleteMapping(domain string) error {
 
 	return nil
 }
+
+// AddLinkSession adds a finished link session to the history.
+// Sessions older than LinkHistoryRetention are removed from the peer's history.
+func (s *MemStorage) AddLinkSession(session StoredLinkSession) error {
+	s.linkSessionsLock.Lock()
+	defer s.linkSessionsLock.Unlock()
+
+	// Remove expired and excess sessions.
+	sessions := s.linkSessions[session.Peer]
+	expired := time.Now().Add(-LinkHistoryRetention)
+	sessions = slices.DeleteFunc(sessions, func(ls StoredLinkSession) bool {
+		return ls.Disconnected.Before(expired)
+	})
+	if len(sessions) >= maxLinkSessionsPerPeer {
+		sessions = slices.Delete(sessions, 0, len(sessions)-maxLinkSessionsPerPeer+1)
+	}
+
+	session.Active = false
+	s.linkSessions[session.Peer] = append(sessions, session)
+	return nil
+}
+
+// QueryLinkSessions returns the sessions with the given peer that ended after
+// since, sorted by connect time. If peer is invalid, sessions of all peers are
+// returned.
+func (s *MemStorage) QueryLinkSessions(peer netip.Addr, since time.Time) ([]StoredLinkSession, error) {
+	s.linkSessionsLock.RLock()
+	defer s.linkSessionsLock.RUnlock()
+
+	result := make([]StoredLinkSession, 0, 16)
+	for ip, sessions := range s.linkSessions {
+		if peer.IsValid() && ip != peer {
+			continue
+		}
+		for _, session := range sessions {
+			if session.Disconnected.After(since) {
+				result = append(result, session)
+			}
+		}
+	}
+
+	slices.SortFunc[[]StoredLinkSession, StoredLinkSession](result, func(a, b StoredLinkSession) int {
+		return a.Connected.Compare(b.Connected)
+	})
+
+	return result, nil
+}
+
+// GetResumptionTicket returns the resumption ticket for the given router.
+func (s *MemStorage) GetResumptionTicket(router netip.Addr) (*StoredResumptionTicket, error) {
+	s.resumptionTicketsLock.RLock()
+	defer s.resumptionTicketsLock.RUnlock()
+
+	ticket, ok := s.resumptionTickets[router]
+	if !ok || time.Now().After(ticket.Expires) {
+		return nil, ErrNotFound
+	}
+	return ticket, nil
+}
+
+// QueryResumptionTickets returns all tickets that are not expired, sorted by
+// expiry, latest first.
+func (s *MemStorage) QueryResumptionTickets() ([]StoredResumptionTicket, error) {
+	s.resumptionTicketsLock.RLock()
+	defer s.resumptionTicketsLock.RUnlock()
+
+	now := time.Now()
+	result := make([]StoredResumptionTicket, 0, len(s.resumptionTickets))
+	for _, ticket := range s.resumptionTickets {
+		if now.Before(ticket.Expires) {
+			result = append(result, *ticket)
+		}
+	}
+
+	slices.SortFunc[[]StoredResumptionTicket, StoredResumptionTicket](result, func(a, b StoredResumptionTicket) int {
+		return b.Expires.Compare(a.Expires)
+	})
+
+	return result, nil
+}
+
+// SaveResumptionTicket saves a resumption ticket to the storage.
+// It replaces any existing ticket for the same router.
+func (s *MemStorage) SaveResumptionTicket(ticket *StoredResumptionTicket) error {
+	s.resumptionTicketsLock.Lock()
+	defer s.resumptionTicketsLock.Unlock()
+
+	s.resumptionTickets[ticket.Router] = ticket
+	return nil
+}
+
+// DeleteResumptionTicket deletes the resumption ticket of the given router.
+func (s *MemStorage) DeleteResumptionTicket(router netip.Addr) error {
+	s.resumptionTicketsLock.Lock()
+	defer s.resumptionTicketsLock.Unlock()
+
+	delete(s.resumptionTickets, router)
+	return nil
+}
+
+// GetApp returns the app with the given name.
+func (s *MemStorage) GetApp(name string) (*StoredApp, error) {
+	s.appsLock.RLock()
+	defer s.appsLock.RUnlock()
+
+	app, ok := s.apps[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return app, nil
+}
+
+// QueryApps returns all apps, sorted by name.
+func (s *MemStorage) QueryApps() ([]StoredApp, error) {
+	s.appsLock.RLock()
+	defer s.appsLock.RUnlock()
+
+	result := make([]StoredApp, 0, len(s.apps))
+	for _, app := range s.apps {
+		result = append(result, *app)
+	}
+
+	slices.SortFunc[[]StoredApp, StoredApp](result, func(a, b StoredApp) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result, nil
+}
+
+// SaveApp saves an app to the storage.
+// It replaces any existing app with the same name.
+func (s *MemStorage) SaveApp(app *StoredApp) error {
+	s.appsLock.Lock()
+	defer s.appsLock.Unlock()
+
+	s.apps[app.Name] = app
+	return nil
+}
+
+// DeleteApp deletes the app with the given name.
+func (s *MemStorage) DeleteApp(name string) error {
+	s.appsLock.Lock()
+	defer s.appsLock.Unlock()
+
+	delete(s.apps, name)
+	return nil
+}
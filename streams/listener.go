@@ -0,0 +1,100 @@
+package streams
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// Listener accepts streams to a service.
+// It implements net.Listener.
+type Listener struct {
+	mx      *Mux
+	service string
+	allow   func(router netip.Addr) bool
+
+	queue     chan *Stream
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Addr is the address of a stream.
+type Addr struct {
+	Router  netip.Addr
+	Service string
+}
+
+// Network returns the network name.
+func (a Addr) Network() string {
+	return "mycoria-stream"
+}
+
+// String returns the address as router/service.
+func (a Addr) String() string {
+	return a.Router.String() + "/" + a.Service
+}
+
+// Accept waits for and returns the next stream.
+func (l *Listener) Accept() (net.Conn, error) {
+	return l.AcceptStream(context.Background())
+}
+
+// AcceptStream waits for and returns the next stream.
+func (l *Listener) AcceptStream(ctx context.Context) (*Stream, error) {
+	select {
+	case s := <-l.queue:
+		return s, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops listening and resets all streams waiting to be accepted.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		l.mx.lock.Lock()
+		if l.mx.listeners[l.service] == l {
+			delete(l.mx.listeners, l.service)
+		}
+		l.mx.lock.Unlock()
+		close(l.closed)
+
+		for {
+			select {
+			case s := <-l.queue:
+				s.lock.Lock()
+				s.reset(ErrListenerClosed)
+				s.lock.Unlock()
+				l.mx.remove(s.key)
+				l.mx.sendReset(s.key, ErrListenerClosed)
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Closed returns whether the listener is closed.
+// Listeners are closed when the router stops.
+func (l *Listener) Closed() bool {
+	select {
+	case <-l.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Addr returns the address of the listener.
+func (l *Listener) Addr() net.Addr {
+	return Addr{Router: l.mx.localIP, Service: l.service}
+}
+
+// Service returns the service name of the listener.
+func (l *Listener) Service() string {
+	return l.service
+}
@@ -0,0 +1,93 @@
+package streams
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mycoria/mycoria/frame"
+)
+
+// Stream message operations.
+const (
+	opSYN uint8 = iota + 1
+	opSYNACK
+	opDATA
+	opACK
+	opFIN
+	opRST
+
+	// flagOpener marks messages sent by the router that opened the stream.
+	// This allows both routers to pick stream IDs independently.
+	flagOpener uint8 = 0x80
+)
+
+// headerSize is the size of the message header:
+// op (1) + stream ID (4) + offset (8) + window (4).
+const headerSize = 17
+
+// message is a stream message.
+// The meaning of offset and window depends on the operation:
+//   - SYN: window is the receive window of the opener, payload is the service.
+//   - SYNACK: window is the receive window of the accepting router.
+//   - DATA: offset is the stream offset of the payload.
+//   - ACK: offset is the next expected offset, window the receive window from there.
+//   - FIN: offset is the final stream offset.
+//   - RST: payload is the reason.
+type message struct {
+	op      uint8
+	opener  bool
+	id      uint32
+	offset  uint64
+	window  uint32
+	payload []byte
+}
+
+func (msg *message) marshal() []byte {
+	data := make([]byte, headerSize+len(msg.payload))
+	data[0] = msg.op
+	if msg.opener {
+		data[0] |= flagOpener
+	}
+	binary.BigEndian.PutUint32(data[1:5], msg.id)
+	binary.BigEndian.PutUint64(data[5:13], msg.offset)
+	binary.BigEndian.PutUint32(data[13:17], msg.window)
+	copy(data[headerSize:], msg.payload)
+	return data
+}
+
+// parseMessage parses a message. The payload references the given data.
+func parseMessage(data []byte) (*message, error) {
+	if len(data) < headerSize {
+		return nil, errors.New("message too short")
+	}
+	msg := &message{
+		op:      data[0] &^ flagOpener,
+		opener:  data[0]&flagOpener != 0,
+		id:      binary.BigEndian.Uint32(data[1:5]),
+		offset:  binary.BigEndian.Uint64(data[5:13]),
+		window:  binary.BigEndian.Uint32(data[13:17]),
+		payload: data[headerSize:],
+	}
+	if msg.op < opSYN || msg.op > opRST {
+		return nil, fmt.Errorf("unknown operation %d", msg.op)
+	}
+	return msg, nil
+}
+
+// packet is a marshaled message ready to be sent.
+type packet struct {
+	msgType frame.MessageType
+	data    []byte
+}
+
+func (msg *message) packet() packet {
+	msgType := frame.SessionCtrl
+	if msg.op == opDATA {
+		msgType = frame.SessionData
+	}
+	return packet{
+		msgType: msgType,
+		data:    msg.marshal(),
+	}
+}
@@ -0,0 +1,376 @@
+// Package streams provides reliable and ordered streams between routers on
+// top of encrypted sessions, multiplexed by service name. This allows
+// applications to talk router-to-router without using the tun interface.
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// maxSegmentSize is the maximum amount of data in a single message.
+	maxSegmentSize = 1024
+	// receiveWindow is the maximum amount of received data buffered per stream.
+	receiveWindow = 256 * 1024
+	// sendBufferSize is the maximum amount of unacknowledged data per stream.
+	sendBufferSize = 256 * 1024
+
+	// MaxServiceNameLength is the maximum length of a service name.
+	MaxServiceNameLength = 64
+	// maxStreams is the maximum amount of streams of a router.
+	maxStreams = 1024
+	// maxStreamsPerRouter is the maximum amount of streams with another router.
+	maxStreamsPerRouter = 64
+	// acceptQueueSize is the amount of streams that may wait to be accepted.
+	acceptQueueSize = 16
+
+	initialRTO = 1 * time.Second
+	minRTO     = 200 * time.Millisecond
+	maxRTO     = 10 * time.Second
+
+	tickInterval    = 50 * time.Millisecond
+	openTimeout     = 15 * time.Second
+	streamTimeout   = 30 * time.Second
+	setupSessionMax = 10 * time.Second
+
+	// streamIdleTimeout closes streams that did not send or receive anything
+	// for this long. Applications must send keep-alives for longer pauses.
+	streamIdleTimeout = 10 * time.Minute
+)
+
+// Errors.
+var (
+	ErrStreamReset     = errors.New("stream reset")
+	ErrStreamTimeout   = errors.New("stream timed out")
+	ErrStreamIdle      = errors.New("stream was idle for too long")
+	ErrInvalidService  = errors.New("invalid service name")
+	ErrServiceInUse    = errors.New("service is already in use")
+	ErrTooManyStreams  = errors.New("too many streams")
+	ErrListenerClosed  = errors.New("listener closed")
+	ErrMuxNotRunning   = errors.New("streams are not running")
+	errUnknownStream   = errors.New("unknown stream")
+	errNoService       = errors.New("no such service")
+	errNotAllowed      = errors.New("not allowed")
+	errAcceptQueueFull = errors.New("accept queue full")
+)
+
+// Transport sends stream messages to other routers.
+type Transport interface {
+	// SetupSession sets up an encrypted session with the given router.
+	SetupSession(ctx context.Context, dst netip.Addr) error
+	// SendSessionMsg sends data to the given router in an encrypted session frame.
+	SendSessionMsg(dst netip.Addr, msgType frame.MessageType, data []byte) error
+}
+
+// Mux multiplexes streams to other routers.
+type Mux struct {
+	localIP   netip.Addr
+	transport Transport
+
+	streams   map[streamKey]*Stream
+	listeners map[string]*Listener
+	nextID    uint32
+	lock      sync.Mutex
+}
+
+// streamKey identifies a stream.
+type streamKey struct {
+	router netip.Addr
+	id     uint32
+	// local is set if the stream was opened by this router.
+	local bool
+}
+
+// New returns a new stream multiplexer.
+func New(localIP netip.Addr, transport Transport) *Mux {
+	return &Mux{
+		localIP:   localIP,
+		transport: transport,
+		streams:   make(map[streamKey]*Stream),
+		listeners: make(map[string]*Listener),
+	}
+}
+
+// Open opens a stream to the given service on the given router.
+func (mx *Mux) Open(ctx context.Context, dst netip.Addr, service string) (*Stream, error) {
+	if err := checkServiceName(service); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, openTimeout)
+	defer cancel()
+
+	// Set up encryption first, so that the SYN is not lost.
+	setupCtx, setupCancel := context.WithTimeout(ctx, setupSessionMax)
+	defer setupCancel()
+	if err := mx.transport.SetupSession(setupCtx, dst); err != nil {
+		return nil, fmt.Errorf("set up session: %w", err)
+	}
+
+	// Register new stream.
+	mx.lock.Lock()
+	if !mx.canAddStreamLocked(dst) {
+		mx.lock.Unlock()
+		return nil, ErrTooManyStreams
+	}
+	key := streamKey{router: dst, local: true}
+	for {
+		mx.nextID++
+		key.id = mx.nextID
+		if _, ok := mx.streams[key]; !ok {
+			break
+		}
+	}
+	s := newStream(mx, key, service)
+	mx.streams[key] = s
+	mx.lock.Unlock()
+
+	// Send SYN and wait for the stream to be accepted.
+	s.lock.Lock()
+	mx.send(dst, []packet{s.synMsg()})
+	for {
+		switch s.state {
+		case stateOpen:
+			s.lock.Unlock()
+			return s, nil
+		case stateReset:
+			err := s.err
+			s.lock.Unlock()
+			mx.remove(key)
+			return nil, err
+		case stateOpening, stateDone:
+		}
+
+		changed := s.changed
+		s.lock.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			s.lock.Lock()
+			s.reset(ctx.Err())
+			s.lock.Unlock()
+			mx.remove(key)
+			mx.send(dst, []packet{s.msg(opRST, 0, []byte(ctx.Err().Error())).packet()})
+			return nil, ctx.Err()
+		}
+		s.lock.Lock()
+	}
+}
+
+// Listen listens for streams to the given service.
+// If allow is set, only streams from routers it allows are accepted.
+func (mx *Mux) Listen(service string, allow func(router netip.Addr) bool) (*Listener, error) {
+	if err := checkServiceName(service); err != nil {
+		return nil, err
+	}
+
+	mx.lock.Lock()
+	defer mx.lock.Unlock()
+
+	if _, ok := mx.listeners[service]; ok {
+		return nil, ErrServiceInUse
+	}
+	l := &Listener{
+		mx:      mx,
+		service: service,
+		allow:   allow,
+		queue:   make(chan *Stream, acceptQueueSize),
+		closed:  make(chan struct{}),
+	}
+	mx.listeners[service] = l
+	return l, nil
+}
+
+// Handle handles a stream message from the given router.
+// The data is copied where needed.
+func (mx *Mux) Handle(src netip.Addr, data []byte) error {
+	msg, err := parseMessage(data)
+	if err != nil {
+		return err
+	}
+	key := streamKey{router: src, id: msg.id, local: !msg.opener}
+
+	mx.lock.Lock()
+	s, ok := mx.streams[key]
+	mx.lock.Unlock()
+
+	switch {
+	case ok:
+		pkts := s.handle(msg, time.Now())
+		if msg.op == opRST {
+			mx.remove(key)
+		}
+		mx.send(src, pkts)
+		return nil
+
+	case msg.op == opSYN && msg.opener:
+		return mx.accept(key, msg)
+
+	case msg.op == opRST:
+		return nil
+
+	default:
+		mx.sendReset(key, errUnknownStream)
+		return nil
+	}
+}
+
+func (mx *Mux) accept(key streamKey, msg *message) error {
+	service := string(msg.payload)
+
+	mx.lock.Lock()
+	l, ok := mx.listeners[service]
+	var err error
+	switch {
+	case !ok:
+		err = errNoService
+	case l.allow != nil && !l.allow(key.router):
+		err = errNotAllowed
+	case !mx.canAddStreamLocked(key.router):
+		err = ErrTooManyStreams
+	}
+	if err != nil {
+		mx.lock.Unlock()
+		mx.sendReset(key, err)
+		return nil
+	}
+	s := newStream(mx, key, service)
+	s.state = stateOpen
+	s.sendWindow = uint64(msg.window)
+	mx.streams[key] = s
+
+	// Queue for accepting.
+	select {
+	case l.queue <- s:
+	default:
+		delete(mx.streams, key)
+		mx.lock.Unlock()
+		mx.sendReset(key, errAcceptQueueFull)
+		return nil
+	}
+	mx.lock.Unlock()
+
+	s.lock.Lock()
+	pkt := s.synAckMsg()
+	s.lock.Unlock()
+	mx.send(key.router, []packet{pkt})
+	return nil
+}
+
+// Worker handles retransmissions and timeouts of all streams.
+func (mx *Mux) Worker(w *mgr.WorkerCtx) error {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.Done():
+			mx.closeAll()
+			return nil
+		case now := <-ticker.C:
+			mx.tick(now)
+		}
+	}
+}
+
+func (mx *Mux) tick(now time.Time) {
+	mx.lock.Lock()
+	streams := make([]*Stream, 0, len(mx.streams))
+	for _, s := range mx.streams {
+		streams = append(streams, s)
+	}
+	mx.lock.Unlock()
+
+	for _, s := range streams {
+		pkts, done := s.tick(now)
+		if done {
+			mx.remove(s.key)
+		}
+		mx.send(s.key.router, pkts)
+	}
+}
+
+// closeAll resets all streams and closes all listeners.
+func (mx *Mux) closeAll() {
+	mx.lock.Lock()
+	streams := mx.streams
+	listeners := mx.listeners
+	mx.streams = make(map[streamKey]*Stream)
+	mx.listeners = make(map[string]*Listener)
+	mx.lock.Unlock()
+
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+	for key, s := range streams {
+		s.lock.Lock()
+		s.reset(ErrMuxNotRunning)
+		s.lock.Unlock()
+		mx.sendReset(key, ErrMuxNotRunning)
+	}
+}
+
+// canAddStreamLocked returns whether another stream with the given router may
+// be added. Must be called with the lock held.
+func (mx *Mux) canAddStreamLocked(router netip.Addr) bool {
+	if len(mx.streams) >= maxStreams {
+		return false
+	}
+	var cnt int
+	for key := range mx.streams {
+		if key.router == router {
+			cnt++
+		}
+	}
+	return cnt < maxStreamsPerRouter
+}
+
+func (mx *Mux) remove(key streamKey) {
+	mx.lock.Lock()
+	defer mx.lock.Unlock()
+
+	delete(mx.streams, key)
+}
+
+func (mx *Mux) sendReset(key streamKey, reason error) {
+	msg := &message{
+		op:      opRST,
+		opener:  key.local,
+		id:      key.id,
+		payload: []byte(reason.Error()),
+	}
+	mx.send(key.router, []packet{msg.packet()})
+}
+
+// send sends the given packets. Lost packets are retransmitted by the
+// streams, so errors are ignored.
+func (mx *Mux) send(dst netip.Addr, pkts []packet) {
+	for _, pkt := range pkts {
+		_ = mx.transport.SendSessionMsg(dst, pkt.msgType, pkt.data)
+	}
+}
+
+func checkServiceName(service string) error {
+	if service == "" || len(service) > MaxServiceNameLength {
+		return ErrInvalidService
+	}
+	for _, c := range service {
+		switch {
+		case c >= 'a' && c <= 'z',
+			c >= 'A' && c <= 'Z',
+			c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.':
+		default:
+			return ErrInvalidService
+		}
+	}
+	return nil
+}
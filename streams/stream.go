@@ -0,0 +1,612 @@
+package streams
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+type streamState uint8
+
+const (
+	stateOpening streamState = iota
+	stateOpen
+	stateDone
+	stateReset
+)
+
+// Stream is a reliable and ordered stream to another router.
+// It implements net.Conn.
+type Stream struct {
+	mx      *Mux
+	key     streamKey
+	service string
+
+	lock sync.Mutex
+	// changed is closed and replaced whenever the stream changes.
+	changed chan struct{}
+	state   streamState
+	err     error
+
+	// Sending.
+	// sendBuf holds all unacknowledged data, starting at sendAcked.
+	sendBuf    []byte
+	sendAcked  uint64
+	sendNext   uint64
+	sendWindow uint64
+	sendClosed bool
+	finSent    bool
+	finAcked   bool
+	dupAcks    int
+	lastSent   time.Time
+	lastHeard  time.Time
+	rto        time.Duration
+	srtt       time.Duration
+	rttOffset  uint64
+	rttStart   time.Time
+
+	// Receiving.
+	recvBuf    []byte
+	recvNext   uint64
+	outOfOrder map[uint64][]byte
+	// outOfOrderSize is the amount of data in outOfOrder.
+	outOfOrderSize int
+	finRecv        bool
+	finOffset      uint64
+	eof            bool
+	readClosed     bool
+	ackPending     bool
+	unackedSegs    int
+	advertisedTo   uint64
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newStream(mx *Mux, key streamKey, service string) *Stream {
+	now := time.Now()
+	return &Stream{
+		mx:         mx,
+		key:        key,
+		service:    service,
+		changed:    make(chan struct{}),
+		lastSent:   now,
+		lastHeard:  now,
+		rto:        initialRTO,
+		outOfOrder: make(map[uint64][]byte),
+	}
+}
+
+// Service returns the service name of the stream.
+func (s *Stream) Service() string {
+	return s.service
+}
+
+// Router returns the IP of the other router.
+func (s *Stream) Router() netip.Addr {
+	return s.key.router
+}
+
+// LocalAddr returns the local address of the stream.
+func (s *Stream) LocalAddr() net.Addr {
+	return Addr{Router: s.mx.localIP, Service: s.service}
+}
+
+// RemoteAddr returns the remote address of the stream.
+func (s *Stream) RemoteAddr() net.Addr {
+	return Addr{Router: s.key.router, Service: s.service}
+}
+
+// Read reads data from the stream.
+func (s *Stream) Read(p []byte) (int, error) {
+	s.lock.Lock()
+	for {
+		switch {
+		case s.readClosed:
+			s.lock.Unlock()
+			return 0, net.ErrClosed
+
+		case len(s.recvBuf) > 0:
+			n := copy(p, s.recvBuf)
+			s.recvBuf = s.recvBuf[n:]
+			// Send window update when enough space opened up.
+			var pkts []packet
+			if s.recvNext+s.recvWindow()-s.advertisedTo >= receiveWindow/4 {
+				pkts = append(pkts, s.ackMsg())
+			}
+			s.lock.Unlock()
+			s.mx.send(s.key.router, pkts)
+			return n, nil
+
+		case s.eof:
+			s.lock.Unlock()
+			return 0, io.EOF
+
+		case s.err != nil:
+			err := s.err
+			s.lock.Unlock()
+			return 0, err
+		}
+
+		if err := s.wait(s.readDeadline); err != nil {
+			s.lock.Unlock()
+			return 0, err
+		}
+	}
+}
+
+// Write writes data to the stream.
+// It blocks while the send buffer is full.
+func (s *Stream) Write(p []byte) (int, error) {
+	var written int
+	s.lock.Lock()
+	for len(p) > 0 {
+		switch {
+		case s.sendClosed:
+			s.lock.Unlock()
+			return written, net.ErrClosed
+		case s.err != nil:
+			err := s.err
+			s.lock.Unlock()
+			return written, err
+		}
+
+		space := sendBufferSize - len(s.sendBuf)
+		if space <= 0 {
+			if err := s.wait(s.writeDeadline); err != nil {
+				s.lock.Unlock()
+				return written, err
+			}
+			continue
+		}
+
+		n := min(space, len(p))
+		s.sendBuf = append(s.sendBuf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		pkts := s.flush(time.Now())
+		s.lock.Unlock()
+		s.mx.send(s.key.router, pkts)
+		s.lock.Lock()
+	}
+	s.lock.Unlock()
+	return written, nil
+}
+
+// CloseWrite closes the sending side of the stream.
+// Buffered data is still delivered. The other router reads io.EOF.
+func (s *Stream) CloseWrite() error {
+	s.lock.Lock()
+	if s.sendClosed || s.err != nil {
+		s.lock.Unlock()
+		return nil
+	}
+	s.sendClosed = true
+	pkts := s.flush(time.Now())
+	s.signal()
+	s.lock.Unlock()
+
+	s.mx.send(s.key.router, pkts)
+	return nil
+}
+
+// Close closes the stream. Buffered data is still delivered, any received
+// data is discarded.
+func (s *Stream) Close() error {
+	s.lock.Lock()
+	s.readClosed = true
+	s.recvBuf = nil
+	s.signal()
+	s.lock.Unlock()
+
+	return s.CloseWrite()
+}
+
+// SetDeadline sets the read and write deadline.
+func (s *Stream) SetDeadline(t time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.readDeadline = t
+	s.writeDeadline = t
+	s.signal()
+	return nil
+}
+
+// SetReadDeadline sets the read deadline.
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.readDeadline = t
+	s.signal()
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline.
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.writeDeadline = t
+	s.signal()
+	return nil
+}
+
+// signal wakes up everyone waiting for a change.
+// Must be called with the lock held.
+func (s *Stream) signal() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait waits for a change or until the deadline is reached.
+// Must be called with the lock held and returns with the lock held.
+func (s *Stream) wait(deadline time.Time) error {
+	changed := s.changed
+	s.lock.Unlock()
+	defer s.lock.Lock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-changed:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// recvWindow returns how much data may be received after recvNext.
+func (s *Stream) recvWindow() uint64 {
+	if len(s.recvBuf) >= receiveWindow {
+		return 0
+	}
+	return uint64(receiveWindow - len(s.recvBuf))
+}
+
+func (s *Stream) msg(op uint8, offset uint64, payload []byte) *message {
+	return &message{
+		op:      op,
+		opener:  s.key.local,
+		id:      s.key.id,
+		offset:  offset,
+		payload: payload,
+	}
+}
+
+func (s *Stream) synMsg() packet {
+	msg := s.msg(opSYN, 0, []byte(s.service))
+	msg.window = uint32(s.recvWindow())
+	return msg.packet()
+}
+
+func (s *Stream) synAckMsg() packet {
+	msg := s.msg(opSYNACK, 0, nil)
+	msg.window = uint32(s.recvWindow())
+	return msg.packet()
+}
+
+func (s *Stream) ackMsg() packet {
+	msg := s.msg(opACK, s.recvNext, nil)
+	msg.window = uint32(s.recvWindow())
+	s.advertisedTo = s.recvNext + uint64(msg.window)
+	s.ackPending = false
+	s.unackedSegs = 0
+	return msg.packet()
+}
+
+func (s *Stream) dataMsg(offset uint64, size uint64) packet {
+	start := offset - s.sendAcked
+	return s.msg(opDATA, offset, s.sendBuf[start:start+size]).packet()
+}
+
+func (s *Stream) finMsg() packet {
+	return s.msg(opFIN, s.sendAcked+uint64(len(s.sendBuf)), nil).packet()
+}
+
+// outstanding returns whether sent data or the FIN is waiting to be acknowledged.
+func (s *Stream) outstanding() bool {
+	return s.sendNext > s.sendAcked || (s.finSent && !s.finAcked)
+}
+
+// flush sends new data within the send window of the other router.
+// Must be called with the lock held.
+func (s *Stream) flush(now time.Time) (pkts []packet) {
+	if s.state != stateOpen {
+		return nil
+	}
+
+	end := s.sendAcked + uint64(len(s.sendBuf))
+	limit := min(end, s.sendAcked+s.sendWindow)
+	for s.sendNext < limit {
+		if !s.outstanding() {
+			s.lastSent = now
+			s.lastHeard = now
+		}
+		size := min(limit-s.sendNext, maxSegmentSize)
+		pkts = append(pkts, s.dataMsg(s.sendNext, size))
+		if s.rttOffset == 0 {
+			s.rttOffset = s.sendNext + size
+			s.rttStart = now
+		}
+		s.sendNext += size
+	}
+
+	// Send FIN when all data was sent.
+	if s.sendClosed && !s.finSent && s.sendNext == end {
+		if !s.outstanding() {
+			s.lastSent = now
+			s.lastHeard = now
+		}
+		s.finSent = true
+		pkts = append(pkts, s.finMsg())
+	}
+
+	return pkts
+}
+
+// retransmit sends the first unacknowledged segment or the FIN again.
+func (s *Stream) retransmit(now time.Time) packet {
+	s.lastSent = now
+	s.rttOffset = 0
+	if s.sendNext > s.sendAcked {
+		return s.dataMsg(s.sendAcked, min(s.sendNext-s.sendAcked, maxSegmentSize))
+	}
+	return s.finMsg()
+}
+
+// handle handles a message for the stream.
+func (s *Stream) handle(msg *message, now time.Time) (pkts []packet) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastHeard = now
+
+	switch msg.op {
+	case opSYN:
+		// The SYNACK was lost.
+		if s.state == stateOpen && !s.key.local {
+			pkts = append(pkts, s.synAckMsg())
+		}
+
+	case opSYNACK:
+		if s.state == stateOpening && s.key.local {
+			s.state = stateOpen
+			s.sendWindow = uint64(msg.window)
+			s.signal()
+		}
+
+	case opDATA:
+		if s.state == stateOpen {
+			pkts = s.handleData(msg)
+		}
+
+	case opACK:
+		if s.state == stateOpen {
+			pkts = s.handleAck(msg, now)
+		}
+
+	case opFIN:
+		if s.state == stateOpen {
+			pkts = s.handleFin(msg)
+		}
+
+	case opRST:
+		s.reset(fmt.Errorf("%w: %s", ErrStreamReset, msg.payload))
+	}
+
+	return pkts
+}
+
+func (s *Stream) handleData(msg *message) []packet {
+	offset, data := msg.offset, msg.payload
+	end := offset + uint64(len(data))
+	windowEnd := s.recvNext + s.recvWindow()
+	switch {
+	case s.finRecv && end > s.finOffset:
+		// Data after the end of the stream.
+		return nil
+
+	case end <= s.recvNext, offset >= windowEnd:
+		// Duplicate or outside of window, acknowledge immediately.
+		return []packet{s.ackMsg()}
+
+	case offset > s.recvNext:
+		// Out of order, buffer and acknowledge immediately to signal the gap.
+		// Buffered data is limited by the receive window, as overlapping
+		// segments could otherwise use up any amount of memory.
+		segment := data[:min(end, windowEnd)-offset]
+		if _, ok := s.outOfOrder[offset]; !ok &&
+			s.outOfOrderSize+len(segment) <= int(s.recvWindow()) {
+			s.outOfOrder[offset] = append([]byte(nil), segment...)
+			s.outOfOrderSize += len(segment)
+		}
+		return []packet{s.ackMsg()}
+	}
+
+	// In order.
+	s.receive(data[s.recvNext-offset : min(end, windowEnd)-offset])
+	for progress := true; progress; {
+		progress = false
+		for segOffset, segData := range s.outOfOrder {
+			if segOffset > s.recvNext {
+				continue
+			}
+			delete(s.outOfOrder, segOffset)
+			s.outOfOrderSize -= len(segData)
+			if segEnd := segOffset + uint64(len(segData)); segEnd > s.recvNext {
+				s.receive(segData[s.recvNext-segOffset:])
+			}
+			progress = true
+		}
+	}
+	s.checkFin()
+	s.signal()
+
+	// Acknowledge every second segment immediately.
+	s.unackedSegs++
+	if s.unackedSegs >= 2 || s.eof {
+		return []packet{s.ackMsg()}
+	}
+	s.ackPending = true
+	return nil
+}
+
+// receive adds in-order data to the receive buffer.
+func (s *Stream) receive(data []byte) {
+	s.recvNext += uint64(len(data))
+	// Discard data when the stream is closed for reading.
+	if !s.readClosed {
+		s.recvBuf = append(s.recvBuf, data...)
+	}
+}
+
+func (s *Stream) handleFin(msg *message) []packet {
+	if !s.finRecv {
+		s.finRecv = true
+		s.finOffset = msg.offset
+		s.checkFin()
+		s.signal()
+	}
+	return []packet{s.ackMsg()}
+}
+
+// checkFin marks the stream as ended when all data up to the FIN was received.
+// The FIN itself takes up one offset in order to be acknowledged.
+func (s *Stream) checkFin() {
+	if s.finRecv && !s.eof && s.recvNext == s.finOffset {
+		s.eof = true
+		s.recvNext++
+	}
+}
+
+func (s *Stream) handleAck(msg *message, now time.Time) []packet {
+	end := s.sendAcked + uint64(len(s.sendBuf))
+	maxAck := s.sendNext
+	if s.finSent {
+		maxAck = end + 1
+	}
+	switch {
+	case msg.offset > maxAck, msg.offset < s.sendAcked:
+		// Invalid or old acknowledgement.
+		return nil
+
+	case msg.offset > s.sendAcked:
+		acked := min(msg.offset, end) - s.sendAcked
+		s.sendBuf = s.sendBuf[acked:]
+		s.sendAcked += acked
+		if msg.offset == end+1 {
+			s.finAcked = true
+		}
+
+		// Update round trip time.
+		if s.rttOffset != 0 && msg.offset >= s.rttOffset {
+			rtt := now.Sub(s.rttStart)
+			if s.srtt == 0 {
+				s.srtt = rtt
+			} else {
+				s.srtt = (7*s.srtt + rtt) / 8
+			}
+			s.rttOffset = 0
+		}
+		s.rto = min(max(2*s.srtt, minRTO), maxRTO)
+		s.lastSent = now
+		s.dupAcks = 0
+		s.signal()
+
+	case s.outstanding():
+		// Duplicate acknowledgement, retransmit on the third.
+		s.dupAcks++
+		if s.dupAcks == 3 {
+			s.sendWindow = uint64(msg.window)
+			return append([]packet{s.retransmit(now)}, s.flush(now)...)
+		}
+	}
+
+	s.sendWindow = uint64(msg.window)
+	return s.flush(now)
+}
+
+// tick handles retransmissions, delayed acknowledgements and timeouts.
+func (s *Stream) tick(now time.Time) (pkts []packet, done bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch s.state {
+	case stateOpening:
+		if now.Sub(s.lastSent) > s.rto {
+			s.lastSent = now
+			s.rto = min(2*s.rto, maxRTO)
+			pkts = append(pkts, s.synMsg())
+		}
+		return pkts, false
+
+	case stateOpen:
+	default:
+		return nil, true
+	}
+
+	if s.ackPending {
+		pkts = append(pkts, s.ackMsg())
+	}
+
+	blocked := s.sendNext < s.sendAcked+uint64(len(s.sendBuf)) && s.sendWindow == 0
+	switch {
+	case (s.outstanding() || blocked) && now.Sub(s.lastHeard) > streamTimeout:
+		s.reset(ErrStreamTimeout)
+		return append(pkts, s.msg(opRST, 0, []byte(ErrStreamTimeout.Error())).packet()), true
+
+	case now.Sub(s.lastHeard) > streamIdleTimeout && now.Sub(s.lastSent) > streamIdleTimeout:
+		// Nothing was sent or received for a long time.
+		s.reset(ErrStreamIdle)
+		return append(pkts, s.msg(opRST, 0, []byte(ErrStreamIdle.Error())).packet()), true
+
+	case s.outstanding() && now.Sub(s.lastSent) > s.rto:
+		s.rto = min(2*s.rto, maxRTO)
+		pkts = append(pkts, s.retransmit(now))
+
+	case blocked && now.Sub(s.lastSent) > s.rto:
+		// Probe the window of the other router with a single byte.
+		s.lastSent = now
+		s.rto = min(2*s.rto, maxRTO)
+		pkts = append(pkts, s.dataMsg(s.sendNext, 1))
+	}
+
+	// The stream is done when both sides finished, or when the stream is
+	// closed locally and everything was delivered.
+	if s.finAcked && (s.eof || s.readClosed) {
+		s.state = stateDone
+		s.signal()
+		return pkts, true
+	}
+	return pkts, false
+}
+
+// reset fails the stream with the given error.
+// Must be called with the lock held.
+func (s *Stream) reset(err error) {
+	if s.state == stateReset || s.state == stateDone {
+		return
+	}
+	s.state = stateReset
+	s.err = err
+	s.sendBuf = nil
+	s.outOfOrder = nil
+	s.outOfOrderSize = 0
+	s.signal()
+}
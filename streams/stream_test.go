@@ -0,0 +1,248 @@
+package streams
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	mrand "math/rand"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mycoria/mycoria/frame"
+)
+
+// testTransport delivers messages to another mux, dropping and reordering
+// some of them.
+type testTransport struct {
+	src  netip.Addr
+	dst  *Mux
+	loss float64
+
+	lock sync.Mutex
+	rng  *mrand.Rand
+}
+
+func (tt *testTransport) SetupSession(ctx context.Context, dst netip.Addr) error {
+	return nil
+}
+
+func (tt *testTransport) SendSessionMsg(dst netip.Addr, msgType frame.MessageType, data []byte) error {
+	tt.lock.Lock()
+	drop := tt.rng.Float64() < tt.loss
+	delay := time.Duration(tt.rng.Intn(5)) * time.Millisecond
+	tt.lock.Unlock()
+	if drop {
+		return nil
+	}
+
+	data = bytes.Clone(data)
+	go func() {
+		time.Sleep(delay)
+		_ = tt.dst.Handle(tt.src, data)
+	}()
+	return nil
+}
+
+func newTestMuxes(t *testing.T, loss float64) (a, b *Mux) {
+	t.Helper()
+
+	ipA := netip.MustParseAddr("fd00::a")
+	ipB := netip.MustParseAddr("fd00::b")
+	transportA := &testTransport{src: ipA, loss: loss, rng: mrand.New(mrand.NewSource(1))} //nolint:gosec
+	transportB := &testTransport{src: ipB, loss: loss, rng: mrand.New(mrand.NewSource(2))} //nolint:gosec
+	a = New(ipA, transportA)
+	b = New(ipB, transportB)
+	transportA.dst = b
+	transportB.dst = a
+
+	// Tick both muxes.
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				a.tick(now)
+				b.tick(now)
+			}
+		}
+	}()
+
+	return a, b
+}
+
+func TestStreams(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		loss float64
+		size int
+	}{
+		{name: "lossless", loss: 0, size: 1_000_000},
+		{name: "lossy", loss: 0.1, size: 50_000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			a, b := newTestMuxes(t, tc.loss)
+			l, err := b.Listen("echo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Echo back everything that is received.
+			go func() {
+				s, err := l.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				_, _ = io.Copy(s, s)
+				_ = s.Close()
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			s, err := a.Open(ctx, b.localIP, "echo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = s.SetDeadline(time.Now().Add(30 * time.Second))
+
+			data := make([]byte, tc.size)
+			_, _ = rand.Read(data)
+			go func() {
+				_, _ = s.Write(data)
+				_ = s.CloseWrite()
+			}()
+			received, err := io.ReadAll(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, received) {
+				t.Fatalf("received %d bytes that differ from the %d sent bytes", len(received), len(data))
+			}
+			_ = s.Close()
+
+			// Both streams must finish.
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				a.lock.Lock()
+				aStreams := len(a.streams)
+				a.lock.Unlock()
+				b.lock.Lock()
+				bStreams := len(b.streams)
+				b.lock.Unlock()
+				if aStreams == 0 && bStreams == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("streams did not finish: %d and %d left", aStreams, bStreams)
+				}
+				time.Sleep(tickInterval)
+			}
+		})
+	}
+}
+
+func TestStreamRejects(t *testing.T) {
+	t.Parallel()
+
+	a, b := newTestMuxes(t, 0)
+	ctx := context.Background()
+
+	// No service.
+	if _, err := a.Open(ctx, b.localIP, "missing"); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("expected reset for missing service, got %v", err)
+	}
+
+	// Not allowed.
+	_, err := b.Listen("private", func(router netip.Addr) bool {
+		return router != a.localIP
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Open(ctx, b.localIP, "private"); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("expected reset for disallowed router, got %v", err)
+	}
+
+	// Service in use and invalid names.
+	if _, err := b.Listen("private", nil); !errors.Is(err, ErrServiceInUse) {
+		t.Errorf("expected service in use, got %v", err)
+	}
+	if _, err := a.Open(ctx, b.localIP, "no spaces"); !errors.Is(err, ErrInvalidService) {
+		t.Errorf("expected invalid service, got %v", err)
+	}
+
+	// Closed listener.
+	l, err := b.Listen("closed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Close()
+	if _, err := l.AcceptStream(ctx); !errors.Is(err, ErrListenerClosed) {
+		t.Errorf("expected listener closed, got %v", err)
+	}
+	if _, err := a.Open(ctx, b.localIP, "closed"); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("expected reset for closed listener, got %v", err)
+	}
+}
+
+func TestStreamLimits(t *testing.T) {
+	t.Parallel()
+
+	a, b := newTestMuxes(t, 0)
+	s := newStream(a, streamKey{router: b.localIP, id: 1}, "test")
+	s.state = stateOpen
+
+	// Out of order data is limited by the receive window, even if segments
+	// overlap.
+	segment := make([]byte, 64*1024)
+	for offset := uint64(1); offset < 100; offset++ {
+		s.handle(&message{op: opDATA, offset: offset, payload: segment}, time.Now())
+	}
+	if s.outOfOrderSize > receiveWindow {
+		t.Fatalf("out of order data exceeds receive window: %d", s.outOfOrderSize)
+	}
+	s.handle(&message{op: opDATA, offset: 0, payload: segment[:1]}, time.Now())
+	if len(s.outOfOrder) != 0 || s.outOfOrderSize != 0 {
+		t.Fatalf("out of order data was not delivered: %d segments with %d bytes", len(s.outOfOrder), s.outOfOrderSize)
+	}
+
+	// Idle streams are closed.
+	if _, done := s.tick(time.Now()); done {
+		t.Fatal("active stream must not be closed")
+	}
+	if _, done := s.tick(time.Now().Add(streamIdleTimeout + time.Second)); !done {
+		t.Fatal("idle stream must be closed")
+	}
+	if !errors.Is(s.err, ErrStreamIdle) {
+		t.Fatalf("expected idle error, got %v", s.err)
+	}
+
+	// Streams are limited per router.
+	a.lock.Lock()
+	for id := range uint32(maxStreamsPerRouter) {
+		key := streamKey{router: b.localIP, id: id, local: true}
+		a.streams[key] = newStream(a, key, "test")
+	}
+	a.lock.Unlock()
+	if _, err := a.Open(context.Background(), b.localIP, "test"); !errors.Is(err, ErrTooManyStreams) {
+		t.Errorf("expected too many streams, got %v", err)
+	}
+	a.lock.Lock()
+	canAdd := a.canAddStreamLocked(netip.MustParseAddr("fd00::c"))
+	a.lock.Unlock()
+	if !canAdd {
+		t.Error("other routers must not be limited")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/netip"
 	"runtime"
+	"sync/atomic"
 
 	"github.com/mycoria/mycoria/config"
 	"github.com/mycoria/mycoria/frame"
@@ -14,10 +15,18 @@ import (
 	"github.com/mycoria/mycoria/state"
 )
 
+// ErrTTLExpired is returned when a frame is dropped because its TTL expired.
+var ErrTTLExpired = errors.New("TTL expired")
+
 // Switch handles packets based on switch labels.
 type Switch struct {
-	input       chan frame.Frame
-	routerInput chan frame.Frame
+	input           chan frame.Frame
+	inputPrio       chan frame.Frame
+	routerInput     chan frame.Frame
+	routerInputPrio chan frame.Frame
+
+	ttlExpiredHandler atomic.Pointer[func(f frame.Frame)]
+	relayHandler      atomic.Pointer[func(msgType frame.MessageType, src netip.Addr, size int)]
 
 	instance instance
 }
@@ -32,11 +41,15 @@ type instance interface {
 }
 
 // New returns a new switch.
-func New(instance instance, upstreamHandler chan frame.Frame) *Switch {
+// Frames for this router are handed to the upstream handlers. Priority frames
+// are handed to the priority upstream handler.
+func New(instance instance, upstreamHandler, prioUpstreamHandler chan frame.Frame) *Switch {
 	return &Switch{
-		input:       make(chan frame.Frame),
-		routerInput: upstreamHandler,
-		instance:    instance,
+		input:           make(chan frame.Frame),
+		inputPrio:       make(chan frame.Frame, instance.Config().Limits.QueueSize),
+		routerInput:     upstreamHandler,
+		routerInputPrio: prioUpstreamHandler,
+		instance:        instance,
 	}
 }
 
@@ -53,25 +66,57 @@ func (s *Switch) Stop(mgr *mgr.Manager) error {
 	return nil
 }
 
+// SetTTLExpiredHandler sets a function that is called with every frame that
+// is dropped because its TTL expired. It is called on the hot path and must
+// not block.
+func (s *Switch) SetTTLExpiredHandler(fn func(f frame.Frame)) {
+	s.ttlExpiredHandler.Store(&fn)
+}
+
+// SetRelayHandler sets a function that is called with every frame that was
+// relayed by its switch label. It is called on the hot path and must not
+// block.
+func (s *Switch) SetRelayHandler(fn func(msgType frame.MessageType, src netip.Addr, size int)) {
+	s.relayHandler.Store(&fn)
+}
+
 // Input returns the input channel for the switch.
 func (s *Switch) Input() chan frame.Frame {
 	return s.input
 }
 
+// PriorityInput returns the input channel for priority frames, which are
+// handled before any frames of the regular input.
+func (s *Switch) PriorityInput() chan frame.Frame {
+	return s.inputPrio
+}
+
 func (s *Switch) handler(w *mgr.WorkerCtx) error {
 	for {
+		// Handle waiting priority frames first.
+		var f frame.Frame
 		select {
-		case f := <-s.input:
-			if err := s.handleFrame(f); err != nil {
-				w.Debug(
-					"failed to handle frame",
-					"router", f.SrcIP(),
-					"err", err,
-				)
+		case f = <-s.inputPrio:
+		default:
+			select {
+			case f = <-s.inputPrio:
+			case f = <-s.input:
+			case <-w.Done():
+				return nil
 			}
-		case <-w.Done():
-			return nil
 		}
+
+		w.Busy()
+		if err := w.Guard(func() error {
+			return s.handleFrame(f)
+		}); err != nil {
+			w.Debug(
+				"failed to handle frame",
+				"router", f.SrcIP(),
+				"err", err,
+			)
+		}
+		w.Idle()
 	}
 }
 
@@ -105,12 +150,25 @@ func (s *Switch) handleFrame(f frame.Frame) error {
 	}
 
 	// Forward frame to next hop.
-	return s.ForwardByLabel(f, nextHopLabel)
+	// Get frame details first, as the frame is handed over when forwarding.
+	msgType, src, size := f.MessageType(), f.SrcIP(), frame.Size(f)
+	if err := s.ForwardByLabel(f, nextHopLabel); err != nil {
+		return err
+	}
+	if fn := s.relayHandler.Load(); fn != nil {
+		(*fn)(msgType, src, size)
+	}
+	return nil
 }
 
 func (s *Switch) escalateFrame(f frame.Frame) error {
+	upstream := s.routerInput
+	if f.MessageType().IsPriority() && s.routerInputPrio != nil {
+		upstream = s.routerInputPrio
+	}
+
 	select {
-	case s.routerInput <- f:
+	case upstream <- f:
 	default:
 	}
 	return nil
@@ -138,11 +196,20 @@ func (s *Switch) ForwardByPeer(f frame.Frame, peerIP netip.Addr) error {
 	return s.forwardToLink(f, link)
 }
 
+// ForwardToLink forwards the frame to the given link.
+// It is used to send frames via a specific member of a link bond.
+func (s *Switch) ForwardToLink(f frame.Frame, link peering.Link) error {
+	return s.forwardToLink(f, link)
+}
+
 func (s *Switch) forwardToLink(f frame.Frame, link peering.Link) error {
 	// Decrease and check TTL.
 	f.ReduceTTL(1)
 	if f.TTL() == 0 {
-		return errors.New("TTL expired")
+		if fn := s.ttlExpiredHandler.Load(); fn != nil {
+			(*fn)(f)
+		}
+		return ErrTTLExpired
 	}
 
 	// Add flow control flag.
@@ -0,0 +1,137 @@
+package sim
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/router"
+)
+
+// announcement is a simulated announce ping.
+type announcement struct {
+	src         netip.Addr
+	returnLabel m.SwitchLabel
+	stub        bool
+	expires     time.Time
+
+	// hops holds the stacked attachments, with the most recent one first.
+	hops []m.SwitchHop
+}
+
+// Announce makes the router announce itself to all its peers.
+func (r *Router) Announce() {
+	stub := r.Stub || len(r.links) <= 1
+	expires := r.net.clock.Now().Add(router.AnnounceValidity)
+	for _, link := range r.links {
+		r.net.deliver(link, &announcement{
+			src:         r.IP,
+			returnLabel: link.Label,
+			stub:        stub,
+			expires:     expires,
+		})
+	}
+}
+
+// AnnounceAll makes all routers in the network announce themselves.
+func (n *Network) AnnounceAll() {
+	for _, r := range n.Routers {
+		r.Announce()
+	}
+}
+
+// deliver schedules delivery of the announcement via the given link.
+func (n *Network) deliver(sendLink *Link, msg *announcement) {
+	to := sendLink.Peer
+	recvLink := to.linksByIP[sendLink.owner.IP]
+
+	n.Schedule(sendLink.Latency, func() {
+		to.handleAnnouncement(recvLink, msg)
+	})
+}
+
+// handleAnnouncement handles an announcement like router/ping_announce.go,
+// using the same routing logic.
+func (r *Router) handleAnnouncement(recvLink *Link, msg *announcement) {
+	n := r.net
+	n.stats.Announcements++
+
+	received := &router.ReceivedAnnouncement{
+		Router:      r.IP,
+		Peer:        recvLink.Peer.IP,
+		Delay:       latencyMillis(recvLink.Latency),
+		Label:       recvLink.Label,
+		Src:         msg.src,
+		ReturnLabel: msg.returnLabel,
+		Stub:        msg.stub,
+		Hops:        msg.hops,
+	}
+
+	// Ignore looping announcements.
+	if received.Looping() {
+		n.stats.Loops++
+		return
+	}
+
+	// Add to table.
+	rte := received.Route()
+	if len(msg.hops) > 0 {
+		rte.Expires = msg.expires
+	}
+	added, err := r.Table.AddRoute(rte)
+	switch {
+	case err != nil:
+		n.stats.TableErrors++
+		return
+	case !added:
+		// Not added to routing table.
+		// Do not forward.
+		return
+	}
+	n.stats.TableUpdates++
+	n.lastChange = n.now
+
+	// Never forward if router is a stub.
+	if r.Stub {
+		return
+	}
+
+	// Do not forward if receivers would drop the announcement.
+	if len(msg.hops) >= config.DefaultMaxAnnounceHops {
+		return
+	}
+
+	// Forward to all peers, except where it came from.
+	for _, sendLink := range r.links {
+		if !received.ForwardTo(sendLink.Peer.IP) {
+			continue
+		}
+
+		// Stack own attachment on top.
+		hops := make([]m.SwitchHop, 0, len(msg.hops)+1)
+		hops = append(hops, received.ForwardHop(sendLink.Label))
+		hops = append(hops, msg.hops...)
+
+		n.stats.Forwarded++
+		n.deliver(sendLink, &announcement{
+			src:         msg.src,
+			returnLabel: msg.returnLabel,
+			stub:        msg.stub,
+			expires:     msg.expires,
+			hops:        hops,
+		})
+	}
+}
+
+func latencyMillis(latency time.Duration) uint16 {
+	ms := latency.Milliseconds()
+	switch {
+	case ms < 1:
+		return 1
+	case ms > 0xFFFF:
+		return 0xFFFF
+	default:
+		return uint16(ms)
+	}
+}
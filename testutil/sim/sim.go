@@ -0,0 +1,443 @@
+// Package sim provides an in-memory simulation of mycoria routers for testing
+// routing table and gossip behavior at scale. Routers are connected by
+// simulated links with synthetic latencies and do not use any real sockets.
+// Time is virtual: events are processed in order of their simulated delivery
+// time, so large networks converge within milliseconds of real time.
+package sim
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/router"
+)
+
+// DefaultMaxEvents is the default maximum amount of events processed by Run.
+const DefaultMaxEvents = 10_000_000
+
+// Errors.
+var (
+	ErrRouterExists    = errors.New("router already exists")
+	ErrAlreadyLinked   = errors.New("routers are already linked")
+	ErrMaxEvents       = errors.New("maximum amount of events reached")
+	ErrNoLabels        = errors.New("no free switch label")
+	ErrUnknownRouter   = errors.New("unknown router")
+	ErrCannotLinkSelf  = errors.New("cannot link router to itself")
+	ErrInvalidLatency  = errors.New("link latency must be between 1ms and 65s")
+	ErrInvalidRouterIP = errors.New("router IP is not in the mycoria range")
+)
+
+// Network is a simulated network of routers.
+type Network struct {
+	// Routers holds all routers in the order they were added.
+	Routers []*Router
+	routers map[netip.Addr]*Router
+
+	// MaxEvents limits the amount of events processed by Run.
+	MaxEvents int
+
+	// RoutesPerDestination is applied to the routing tables of routers added
+	// afterwards. Zero uses the default of the routing table.
+	RoutesPerDestination int
+
+	rng   *rand.Rand
+	clock *m.VirtualClock
+
+	queue eventQueue
+	seq   uint64
+
+	now        time.Duration
+	lastChange time.Duration
+
+	stats Stats
+}
+
+// Stats holds statistics about a simulation run.
+type Stats struct {
+	// Announcements is the amount of announcements received by routers.
+	Announcements int
+	// Forwarded is the amount of announcements forwarded to other routers.
+	Forwarded int
+	// Loops is the amount of announcements dropped because they were looping.
+	Loops int
+	// TableUpdates is the amount of routes added or updated in routing tables.
+	TableUpdates int
+	// TableErrors is the amount of routes rejected by routing tables.
+	TableErrors int
+}
+
+// NewNetwork returns a new, empty simulated network.
+// The seed is used for all random decisions, so that simulations are reproducible.
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		routers:   make(map[netip.Addr]*Router),
+		MaxEvents: DefaultMaxEvents,
+		rng:       rand.New(rand.NewSource(seed)), //nolint:gosec // Reproducibility is required.
+		clock:     m.NewVirtualClock(time.Now()),
+	}
+}
+
+// Router is a simulated router.
+type Router struct {
+	IP    netip.Addr
+	Table *m.RoutingTable
+
+	// Stub defines whether the router is a stub router.
+	// Stub routers do not forward announcements.
+	Stub bool
+
+	// links holds all links in the order they were added, in order to keep
+	// simulations reproducible.
+	links      []*Link
+	linksByIP  map[netip.Addr]*Link
+	linkLabels map[m.SwitchLabel]*Link
+
+	net *Network
+}
+
+// Link is a simulated link from one router to a peer.
+type Link struct {
+	Peer    *Router
+	Latency time.Duration
+	Label   m.SwitchLabel
+
+	owner *Router
+}
+
+// AddRouter adds a router with the given IP to the network.
+func (n *Network) AddRouter(ip netip.Addr) (*Router, error) {
+	if !m.BaseNetPrefix.Contains(ip) {
+		return nil, ErrInvalidRouterIP
+	}
+	if _, ok := n.routers[ip]; ok {
+		return nil, ErrRouterExists
+	}
+
+	// Use the routable prefixes of the real router.
+	routablePrefixes, err := router.RoutablePrefixes(ip, n.RoutesPerDestination)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Router{
+		IP: ip,
+		Table: m.NewRoutingTable(m.RoutingTableConfig{
+			RoutablePrefixes: routablePrefixes,
+			RouterIP:         ip,
+			Clock:            n.clock,
+		}),
+		linksByIP:  make(map[netip.Addr]*Link),
+		linkLabels: make(map[m.SwitchLabel]*Link),
+		net:        n,
+	}
+	n.Routers = append(n.Routers, r)
+	n.routers[ip] = r
+	return r, nil
+}
+
+// AddRandomRouters adds the given amount of routers with random IPs within
+// the given prefix to the network.
+func (n *Network) AddRandomRouters(prefix netip.Prefix, amount int) ([]*Router, error) {
+	added := make([]*Router, 0, amount)
+	for len(added) < amount {
+		r, err := n.AddRouter(n.randomIP(prefix))
+		switch {
+		case errors.Is(err, ErrRouterExists):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		added = append(added, r)
+	}
+	return added, nil
+}
+
+// GetRouter returns the router with the given IP.
+func (n *Network) GetRouter(ip netip.Addr) *Router {
+	return n.routers[ip]
+}
+
+// Connect links the two given routers with the given one-way latency.
+func (n *Network) Connect(a, b *Router, latency time.Duration) error {
+	switch {
+	case a == b:
+		return ErrCannotLinkSelf
+	case n.routers[a.IP] != a || n.routers[b.IP] != b:
+		return ErrUnknownRouter
+	case latency < time.Millisecond || latency > 65*time.Second:
+		return ErrInvalidLatency
+	case a.linksByIP[b.IP] != nil:
+		return ErrAlreadyLinked
+	}
+
+	labelA, err := a.assignSwitchLabel(b.IP)
+	if err != nil {
+		return fmt.Errorf("%s: %w", a.IP, err)
+	}
+	labelB, err := b.assignSwitchLabel(a.IP)
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.IP, err)
+	}
+
+	linkA := &Link{Peer: b, Latency: latency, Label: labelA, owner: a}
+	a.links = append(a.links, linkA)
+	a.linksByIP[b.IP] = linkA
+	a.linkLabels[labelA] = linkA
+	linkB := &Link{Peer: a, Latency: latency, Label: labelB, owner: b}
+	b.links = append(b.links, linkB)
+	b.linksByIP[a.IP] = linkB
+	b.linkLabels[labelB] = linkB
+
+	return nil
+}
+
+// ConnectRandom connects every router to at least minPeers random other
+// routers. The routers are first connected in a ring to guarantee that the
+// network is connected. Latencies are randomly chosen within the given range.
+func (n *Network) ConnectRandom(minPeers int, minLatency, maxLatency time.Duration) error {
+	if len(n.Routers) < 2 {
+		return nil
+	}
+	minPeers = min(minPeers, len(n.Routers)-1)
+
+	// Connect in a ring.
+	for i, r := range n.Routers {
+		next := n.Routers[(i+1)%len(n.Routers)]
+		if r.linksByIP[next.IP] != nil {
+			continue
+		}
+		if err := n.Connect(r, next, n.randomLatency(minLatency, maxLatency)); err != nil {
+			return err
+		}
+	}
+
+	// Add random links.
+	for _, r := range n.Routers {
+		for len(r.links) < minPeers {
+			peer := n.Routers[n.rng.Intn(len(n.Routers))]
+			if peer == r || r.linksByIP[peer.IP] != nil {
+				continue
+			}
+			if err := n.Connect(r, peer, n.randomLatency(minLatency, maxLatency)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Links returns all links of the router.
+func (r *Router) Links() []*Link {
+	return slices.Clone(r.links)
+}
+
+// GetLink returns the link to the given peer.
+func (r *Router) GetLink(peer netip.Addr) *Link {
+	return r.linksByIP[peer]
+}
+
+// Now returns the current virtual time of the simulation.
+func (n *Network) Now() time.Duration {
+	return n.now
+}
+
+// Clock returns the virtual clock of the simulation, which is also used by
+// the routing tables of the routers.
+func (n *Network) Clock() *m.VirtualClock {
+	return n.clock
+}
+
+// Stats returns the statistics of the simulation.
+func (n *Network) Stats() Stats {
+	return n.stats
+}
+
+// Run processes all pending events and returns the virtual time at which the
+// last routing table change occurred, which is the convergence time.
+func (n *Network) Run() (converged time.Duration, err error) {
+	var processed int
+	for n.queue.Len() > 0 {
+		if n.MaxEvents > 0 && processed >= n.MaxEvents {
+			return n.lastChange, ErrMaxEvents
+		}
+		processed++
+
+		e := heap.Pop(&n.queue).(*event) //nolint:forcetypeassert // Only events are in the queue.
+		n.advanceTo(e.at)
+		e.fn()
+	}
+
+	return n.lastChange, nil
+}
+
+// RunFor processes all events scheduled within the given virtual duration.
+func (n *Network) RunFor(d time.Duration) error {
+	until := n.now + d
+	var processed int
+	for n.queue.Len() > 0 && n.queue[0].at <= until {
+		if n.MaxEvents > 0 && processed >= n.MaxEvents {
+			return ErrMaxEvents
+		}
+		processed++
+
+		e := heap.Pop(&n.queue).(*event) //nolint:forcetypeassert // Only events are in the queue.
+		n.advanceTo(e.at)
+		e.fn()
+	}
+	n.advanceTo(until)
+
+	return nil
+}
+
+func (n *Network) advanceTo(at time.Duration) {
+	if at > n.now {
+		n.clock.Advance(at - n.now)
+		n.now = at
+	}
+}
+
+// Schedule schedules the given function to be executed after the given
+// virtual delay.
+func (n *Network) Schedule(delay time.Duration, fn func()) {
+	n.seq++
+	heap.Push(&n.queue, &event{
+		at:  n.now + delay,
+		seq: n.seq,
+		fn:  fn,
+	})
+}
+
+// CleanTables cleans the routing tables of all routers.
+func (n *Network) CleanTables() {
+	for _, r := range n.Routers {
+		r.Table.Clean()
+	}
+}
+
+// TableSizes returns the minimum, maximum and average routing table size of
+// all routers.
+func (n *Network) TableSizes() (minSize, maxSize int, avgSize float64) {
+	if len(n.Routers) == 0 {
+		return 0, 0, 0
+	}
+
+	minSize = n.Routers[0].Table.Size()
+	var total int
+	for _, r := range n.Routers {
+		size := r.Table.Size()
+		minSize = min(minSize, size)
+		maxSize = max(maxSize, size)
+		total += size
+	}
+	return minSize, maxSize, float64(total) / float64(len(n.Routers))
+}
+
+// Unreachable returns the amount of router pairs where the first router has
+// no direct route to the second.
+func (n *Network) Unreachable() (unreachable int) {
+	for _, r := range n.Routers {
+		for _, dst := range n.Routers {
+			if r == dst {
+				continue
+			}
+			if _, isDst := r.Table.LookupNearestRoute(dst.IP); !isDst {
+				unreachable++
+			}
+		}
+	}
+	return unreachable
+}
+
+func (r *Router) assignSwitchLabel(peer netip.Addr) (m.SwitchLabel, error) {
+	// Derive label from address.
+	label, ok := m.DeriveSwitchLabelFromIP(peer)
+	if ok && r.linkLabels[label] == nil {
+		return label, nil
+	}
+
+	// Try to find a short random label for routable addresses.
+	if m.RoutingAddressPrefix.Contains(peer) {
+		for range 100 {
+			label := m.SwitchLabel(r.net.rng.Intn(m.MaxRoutableSwitchLabel) + 1)
+			if r.linkLabels[label] == nil {
+				return label, nil
+			}
+		}
+	}
+
+	// Then try a longer one.
+	for range 1000 {
+		label := m.SwitchLabel(r.net.rng.Intn(m.MaxPrivateSwitchLabel-m.MaxRoutableSwitchLabel) + m.MaxRoutableSwitchLabel + 1)
+		if r.linkLabels[label] == nil {
+			return label, nil
+		}
+	}
+
+	return 0, ErrNoLabels
+}
+
+func (n *Network) randomIP(prefix netip.Prefix) netip.Addr {
+	var buf [16]byte
+	_, _ = n.rng.Read(buf[:])
+
+	// Copy prefix to buf.
+	prefixBuf := prefix.Masked().Addr().As16()
+	bits := prefix.Bits()
+	for i := 0; i < bits/8; i++ {
+		buf[i] = prefixBuf[i]
+	}
+	if remainingBits := bits % 8; remainingBits > 0 {
+		index := bits / 8
+		buf[index] = prefixBuf[index] | (buf[index] >> remainingBits)
+	}
+
+	return netip.AddrFrom16(buf)
+}
+
+func (n *Network) randomLatency(minLatency, maxLatency time.Duration) time.Duration {
+	if maxLatency <= minLatency {
+		return minLatency
+	}
+	latency := minLatency + time.Duration(n.rng.Int63n(int64(maxLatency-minLatency)))
+	return latency.Round(time.Millisecond)
+}
+
+// Event queue.
+
+type event struct {
+	at  time.Duration
+	seq uint64
+	fn  func()
+}
+
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) {
+	*q = append(*q, x.(*event)) //nolint:forcetypeassert // Only events are in the queue.
+}
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
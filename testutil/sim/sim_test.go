@@ -0,0 +1,187 @@
+package sim
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestConvergence(t *testing.T) {
+	t.Parallel()
+
+	prefix, err := m.GetCountryPrefix("DE")
+	require.NoError(t, err)
+
+	// Create network.
+	routerCnt := 200
+	n := NewNetwork(1)
+	_, err = n.AddRandomRouters(prefix, routerCnt)
+	require.NoError(t, err)
+	require.NoError(t, n.ConnectRandom(3, 5*time.Millisecond, 50*time.Millisecond))
+
+	// Announce and run until converged.
+	n.AnnounceAll()
+	converged, err := n.Run()
+	require.NoError(t, err)
+	stats := n.Stats()
+	minSize, maxSize, avgSize := n.TableSizes()
+	t.Logf(
+		"converged after %s: stats=%+v tables=%d/%d/%.1f",
+		converged, stats, minSize, maxSize, avgSize,
+	)
+
+	// Check results.
+	assert.Positive(t, converged, "convergence time must be positive")
+	assert.Less(t, converged, 2*time.Second, "convergence should be fast")
+	assert.Zero(t, stats.TableErrors, "no routes should be rejected")
+	assert.Zero(t, n.Unreachable(), "all routers should be reachable")
+	assert.GreaterOrEqual(t, minSize, routerCnt-1, "every router needs a route to every other router")
+	assert.LessOrEqual(t, maxSize, 3*(routerCnt-1), "tables must hold at most 3 routes per destination")
+}
+
+func TestStubRouter(t *testing.T) {
+	t.Parallel()
+
+	prefix, err := m.GetCountryPrefix("AT")
+	require.NoError(t, err)
+
+	// Create network with a stub router connected to two routers.
+	n := NewNetwork(2)
+	_, err = n.AddRandomRouters(prefix, 50)
+	require.NoError(t, err)
+	require.NoError(t, n.ConnectRandom(3, 5*time.Millisecond, 50*time.Millisecond))
+	stubs, err := n.AddRandomRouters(prefix, 1)
+	require.NoError(t, err)
+	stub := stubs[0]
+	stub.Stub = true
+	require.NoError(t, n.Connect(stub, n.Routers[0], 10*time.Millisecond))
+	require.NoError(t, n.Connect(stub, n.Routers[1], 10*time.Millisecond))
+
+	// Announce and run until converged.
+	n.AnnounceAll()
+	_, err = n.Run()
+	require.NoError(t, err)
+
+	// Everyone must be able to reach the stub router.
+	assert.Zero(t, n.Unreachable(), "all routers should be reachable")
+
+	// Routes must not go through the stub router.
+	for _, r := range n.Routers {
+		if r == stub {
+			continue
+		}
+		for _, dst := range n.Routers {
+			if dst == r || dst == stub {
+				continue
+			}
+			rte, _ := r.Table.LookupNearestRoute(dst.IP)
+			require.NotNil(t, rte)
+			assert.NotEqual(t, stub.IP, rte.NextHop, "stub router must not be used as a transit")
+		}
+	}
+}
+
+func TestRouteExpiry(t *testing.T) {
+	t.Parallel()
+
+	prefix, err := m.GetCountryPrefix("CH")
+	require.NoError(t, err)
+
+	// Create network and converge.
+	n := NewNetwork(3)
+	_, err = n.AddRandomRouters(prefix, 50)
+	require.NoError(t, err)
+	require.NoError(t, n.ConnectRandom(3, 5*time.Millisecond, 50*time.Millisecond))
+	n.AnnounceAll()
+	_, err = n.Run()
+	require.NoError(t, err)
+	require.Zero(t, n.Unreachable(), "all routers should be reachable")
+
+	// Fast-forward without announcements: only peer routes may remain.
+	require.NoError(t, n.RunFor(3*time.Hour))
+	n.CleanTables()
+	for _, r := range n.Routers {
+		assert.Len(t, r.Links(), r.Table.Size(), "gossip routes must expire")
+	}
+
+	// Announce again and check that the network recovers.
+	n.AnnounceAll()
+	_, err = n.Run()
+	require.NoError(t, err)
+	assert.Zero(t, n.Unreachable(), "all routers should be reachable again")
+}
+
+func TestRoutesPerDestination(t *testing.T) {
+	t.Parallel()
+
+	prefix, err := m.GetCountryPrefix("FR")
+	require.NoError(t, err)
+
+	// Create network that keeps more routes per destination.
+	routerCnt := 50
+	routesPerDst := 6
+	n := NewNetwork(4)
+	n.RoutesPerDestination = routesPerDst
+	_, err = n.AddRandomRouters(prefix, routerCnt)
+	require.NoError(t, err)
+	require.NoError(t, n.ConnectRandom(5, 5*time.Millisecond, 50*time.Millisecond))
+	n.AnnounceAll()
+	_, err = n.Run()
+	require.NoError(t, err)
+
+	// Check that tables hold more than the default, but not more than configured.
+	_, maxSize, _ := n.TableSizes()
+	assert.Greater(t, maxSize, m.DefaultRoutesPerDestination*(routerCnt-1), "tables should hold more routes than the default")
+	for _, r := range n.Routers {
+		for _, dst := range n.Routers {
+			if r != dst {
+				assert.LessOrEqual(t, r.Table.CountRoutes(dst.IP), max(routesPerDst, len(r.Links())))
+			}
+		}
+	}
+}
+
+func TestTableSnapshot(t *testing.T) {
+	t.Parallel()
+
+	prefix, err := m.GetCountryPrefix("DE")
+	require.NoError(t, err)
+
+	// Create a converged network.
+	n := NewNetwork(3)
+	routers, err := n.AddRandomRouters(prefix, 30)
+	require.NoError(t, err)
+	require.NoError(t, n.ConnectRandom(3, 5*time.Millisecond, 50*time.Millisecond))
+	n.AnnounceAll()
+	_, err = n.Run()
+	require.NoError(t, err)
+
+	// Export a table and load it into another simulation.
+	path := filepath.Join(t.TempDir(), "table.json")
+	data, err := json.Marshal(routers[0].Table.Snapshot())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	snap, err := LoadTableSnapshot(path)
+	require.NoError(t, err)
+
+	other := NewNetwork(4)
+	restored, err := other.AddRouterFromSnapshot(snap)
+	require.NoError(t, err)
+	assert.Equal(t, routers[0].Table.Size(), restored.Table.Size())
+
+	// Route selection must be identical.
+	for _, dst := range routers[1:] {
+		want, _ := routers[0].Table.LookupNearestRoute(dst.IP)
+		got, _ := restored.Table.LookupNearestRoute(dst.IP)
+		require.NotNil(t, got)
+		assert.Equal(t, want.NextHop, got.NextHop)
+		assert.Equal(t, want.Path.Hops, got.Path.Hops)
+	}
+}
@@ -0,0 +1,46 @@
+package sim
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+// LoadTableSnapshot loads a routing table snapshot, as exported by
+// "mycoria debug table export", from the given file.
+func LoadTableSnapshot(path string) (*m.TableSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return m.ParseTableSnapshot(data)
+}
+
+// AddRouterFromSnapshot adds a router with the routing table of the given
+// snapshot to the network, so that route selection can be reproduced.
+// Route expiry is shifted to the virtual time of the simulation.
+// The router has no links, as the peers of the snapshot are not part of the
+// network.
+func (n *Network) AddRouterFromSnapshot(snap *m.TableSnapshot) (*Router, error) {
+	if _, ok := n.routers[snap.Router]; ok {
+		return nil, ErrRouterExists
+	}
+
+	table, err := m.NewRoutingTableFromSnapshot(snap, n.clock)
+	if err != nil {
+		return nil, fmt.Errorf("restore routing table: %w", err)
+	}
+
+	r := &Router{
+		IP:         snap.Router,
+		Table:      table,
+		linksByIP:  make(map[netip.Addr]*Link),
+		linkLabels: make(map[m.SwitchLabel]*Link),
+		net:        n,
+	}
+	n.Routers = append(n.Routers, r)
+	n.routers[snap.Router] = r
+	return r, nil
+}
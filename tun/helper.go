@@ -0,0 +1,101 @@
+package tun
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+// The tun helper is a small privileged process that creates and configures
+// the tun device and passes it to the unprivileged router via a unix socket.
+// This allows running the router without root or CAP_NET_ADMIN.
+
+// ErrHelperUnsupported is returned when the tun helper is not supported on
+// the current platform.
+var ErrHelperUnsupported = errors.New("tun helper is not supported on this platform")
+
+// Tun helper commands.
+const (
+	helperCmdOpen            = "open"
+	helperCmdRepair          = "repair"
+	helperCmdEnablePrimary   = "enable"
+	helperCmdDisablePrimary  = "disable"
+	helperCmdApplyWorkaround = "workarounds"
+)
+
+// Tun helper replies.
+const (
+	helperReplyOK      = "ok"
+	helperReplyMissing = "missing"
+	helperReplyError   = "error"
+)
+
+const (
+	// helperTimeout defines how long a request to the tun helper may take.
+	helperTimeout = 10 * time.Second
+	// maxHelperMsgSize limits the size of tun helper messages.
+	maxHelperMsgSize = 1024
+)
+
+// helperClient requests privileged operations from the tun helper.
+type helperClient struct {
+	socketPath string
+}
+
+// request sends a command to the tun helper and returns the reply detail.
+func (hc *helperClient) request(cmd string, prefix netip.Prefix) (detail string, err error) {
+	reply, fd, err := hc.exchange(cmd + " " + prefix.String())
+	if err != nil {
+		return "", err
+	}
+	if fd >= 0 {
+		closeFD(fd)
+	}
+	return parseHelperReply(reply)
+}
+
+// parseHelperReply parses a reply of the tun helper.
+func parseHelperReply(reply string) (detail string, err error) {
+	status, detail, _ := strings.Cut(reply, " ")
+	switch status {
+	case helperReplyOK:
+		return detail, nil
+	case helperReplyMissing:
+		return "", errInterfaceMissing
+	case helperReplyError:
+		return "", fmt.Errorf("tun helper: %s", detail)
+	default:
+		return "", fmt.Errorf("tun helper: invalid reply %q", reply)
+	}
+}
+
+// parseHelperRequest parses a request to the tun helper.
+func parseHelperRequest(request string) (cmd string, prefix netip.Prefix, err error) {
+	cmd, arg, _ := strings.Cut(strings.TrimSpace(request), " ")
+	prefix, err = netip.ParsePrefix(arg)
+	if err != nil {
+		return "", netip.Prefix{}, fmt.Errorf("invalid primary address: %w", err)
+	}
+
+	// Only allow addresses that could be a primary address.
+	if prefix.Bits() != m.BaseNetPrefix.Bits() || !m.BaseNetPrefix.Contains(prefix.Addr()) {
+		return "", netip.Prefix{}, fmt.Errorf("invalid primary address %s", prefix)
+	}
+	return cmd, prefix, nil
+}
+
+// helperInstance provides the config to the device of the tun helper.
+type helperInstance struct {
+	instance
+
+	cfg *config.Config
+}
+
+func (hi *helperInstance) Config() *config.Config {
+	return hi.cfg
+}
@@ -0,0 +1,365 @@
+package tun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/tun"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+// exchange sends a request to the tun helper and returns the reply and a
+// passed file descriptor, or -1 if none was passed.
+func (hc *helperClient) exchange(request string) (reply string, fd int, err error) {
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: hc.socketPath, Net: "unixpacket"})
+	if err != nil {
+		return "", -1, fmt.Errorf("connect to tun helper: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+	if err := conn.SetDeadline(time.Now().Add(helperTimeout)); err != nil {
+		return "", -1, err
+	}
+
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return "", -1, fmt.Errorf("send request to tun helper: %w", err)
+	}
+	buf := make([]byte, maxHelperMsgSize)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return "", -1, fmt.Errorf("read reply from tun helper: %w", err)
+	}
+
+	// Get passed file descriptor.
+	fd = -1
+	if oobn > 0 {
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return "", -1, fmt.Errorf("parse control message from tun helper: %w", err)
+		}
+		for _, msg := range msgs {
+			fds, err := unix.ParseUnixRights(&msg)
+			if err != nil {
+				continue
+			}
+			for _, passed := range fds {
+				if fd < 0 {
+					fd = passed
+				} else {
+					closeFD(passed)
+				}
+			}
+		}
+	}
+
+	return string(buf[:n]), fd, nil
+}
+
+// open requests the tun device from the tun helper.
+func (hc *helperClient) open(prefix netip.Prefix) (tun.Device, error) {
+	reply, fd, err := hc.exchange(helperCmdOpen + " " + prefix.String())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseHelperReply(reply); err != nil {
+		if fd >= 0 {
+			closeFD(fd)
+		}
+		return nil, err
+	}
+	if fd < 0 {
+		return nil, errors.New("tun helper did not pass tun device")
+	}
+
+	// The interface is monitored by the tun helper, as changing the MTU is
+	// not permitted without privileges.
+	t, _, err := tun.CreateUnmonitoredTUNFromFD(fd)
+	if err != nil {
+		closeFD(fd)
+		return nil, fmt.Errorf("use tun device from tun helper: %w", err)
+	}
+	return t, nil
+}
+
+func closeFD(fd int) {
+	_ = unix.Close(fd)
+}
+
+// Helper is the privileged tun helper, which creates and configures the tun
+// device on behalf of the unprivileged router.
+type Helper struct {
+	mgr *mgr.Manager
+	ln  *net.UnixListener
+
+	// allowedUID is the user that may use the tun helper, in addition to root.
+	allowedUID int
+
+	dev  *Device
+	lock sync.Mutex
+}
+
+// NewHelper returns a new tun helper listening on the given socket path.
+// The socket is owned by the given user and group, which the unprivileged
+// router runs as.
+func NewHelper(c *config.Config, socketPath string, uid, gid int) (*Helper, error) {
+	linkName := c.System.TunName
+	if linkName == "" {
+		linkName = DefaultTunName
+	}
+
+	// Listen on socket.
+	_ = os.Remove(socketPath)
+	ln, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: socketPath, Net: "unixpacket"})
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chown(socketPath, uid, gid); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("set owner of socket: %w", err)
+	}
+	if err := os.Chmod(socketPath, 0o0660); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("set permissions of socket: %w", err)
+	}
+
+	h := &Helper{
+		mgr:        mgr.New("tun helper"),
+		ln:         ln,
+		allowedUID: uid,
+	}
+	h.dev = &Device{
+		mgr:      h.mgr,
+		linkName: linkName,
+		instance: &helperInstance{cfg: c},
+	}
+	return h, nil
+}
+
+// Serve handles requests until the context is canceled.
+func (h *Helper) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		_ = h.ln.Close()
+	}()
+
+	for {
+		conn, err := h.ln.AcceptUnix()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+		// Handle every client separately, so that a stuck client does not
+		// block others. Requests are serialized by the lock.
+		go h.handleConn(conn)
+	}
+}
+
+// Close removes the socket and closes the tun device.
+func (h *Helper) Close() error {
+	_ = h.ln.Close()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.mgr.Cancel()
+	if h.dev.tun != nil {
+		return h.dev.tun.Close()
+	}
+	return nil
+}
+
+func (h *Helper) handleConn(conn *net.UnixConn) {
+	defer conn.Close() //nolint:errcheck
+	if err := conn.SetDeadline(time.Now().Add(helperTimeout)); err != nil {
+		return
+	}
+
+	// Check peer.
+	uid, err := peerUID(conn)
+	if err != nil {
+		h.mgr.Warn("failed to get tun helper client", "err", err)
+		return
+	}
+	if uid != 0 && uid != h.allowedUID {
+		h.mgr.Warn("denied tun helper client", "uid", uid)
+		_, _ = conn.Write([]byte(helperReplyError + " permission denied"))
+		return
+	}
+
+	// Read request.
+	buf := make([]byte, maxHelperMsgSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		h.mgr.Warn("failed to read tun helper request", "err", err)
+		return
+	}
+	cmd, prefix, err := parseHelperRequest(string(buf[:n]))
+	if err != nil {
+		_, _ = conn.Write([]byte(helperReplyError + " " + err.Error()))
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	// Handle request.
+	var detail string
+	switch cmd {
+	case helperCmdOpen:
+		err = h.open(prefix)
+		if err == nil {
+			err = h.sendTun(conn)
+			if err != nil {
+				h.mgr.Warn("failed to pass tun device", "err", err)
+			}
+			return
+		}
+	case helperCmdRepair:
+		h.setPrimaryAddress(prefix)
+		detail, err = h.dev.repairInterface()
+		if err == nil && detail != "" {
+			h.mgr.Warn("repaired interface", "repaired", detail)
+		}
+	case helperCmdEnablePrimary:
+		h.setPrimaryAddress(prefix)
+		err = h.dev.SetPrimaryAddress(true)
+	case helperCmdDisablePrimary:
+		h.setPrimaryAddress(prefix)
+		err = h.dev.SetPrimaryAddress(false)
+	case helperCmdApplyWorkaround:
+		h.dev.CheckWorkarounds()
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+
+	// Send reply.
+	var reply string
+	switch {
+	case errors.Is(err, errInterfaceMissing):
+		reply = helperReplyMissing
+	case err != nil:
+		reply = helperReplyError + " " + err.Error()
+	default:
+		reply = helperReplyOK + " " + detail
+	}
+	if _, err := conn.Write([]byte(reply)); err != nil {
+		h.mgr.Warn("failed to reply to tun helper client", "err", err)
+	}
+}
+
+// setPrimaryAddress sets the primary address requested by the router, which
+// may change on restart, eg. in invisible mode. The previous primary address
+// is removed. Must be called with the lock held.
+func (h *Helper) setPrimaryAddress(prefix netip.Prefix) {
+	if h.dev.primaryAddress == prefix {
+		return
+	}
+	if h.dev.primaryAddress.IsValid() && h.dev.tun != nil {
+		_ = h.dev.RemoveAddress(h.dev.primaryAddress)
+	}
+	h.dev.primaryAddress = prefix
+}
+
+// open creates and configures the tun device, or checks the existing one.
+// Must be called with the lock held.
+func (h *Helper) open(prefix netip.Prefix) error {
+	h.setPrimaryAddress(prefix)
+
+	// Reuse existing interface, if it still exists.
+	if h.dev.tun != nil {
+		repaired, err := h.dev.repairInterface()
+		switch {
+		case err == nil:
+			if repaired != "" {
+				h.mgr.Warn("repaired interface", "repaired", repaired)
+			}
+			return nil
+		case !errors.Is(err, errInterfaceMissing):
+			return err
+		}
+		_ = h.dev.tun.Close()
+		h.dev.tun = nil
+	}
+
+	// Create interface.
+	if err := Preflight(h.dev.linkName, prefix); err != nil {
+		return err
+	}
+	h.dev.PrepTUN()
+	t, err := tun.CreateTUN(h.dev.linkName, h.dev.instance.Config().TunMTU())
+	if err != nil {
+		return err
+	}
+	h.dev.tun = t
+	if err := h.dev.InitInterface(prefix); err != nil {
+		return fmt.Errorf("failed to add primary address %v: %w", prefix, err)
+	}
+	if h.dev.primaryDisabled.Load() {
+		if err := h.dev.RemoveAddress(prefix); err != nil {
+			return fmt.Errorf("remove disabled primary address: %w", err)
+		}
+	}
+	if err := h.dev.StartInterface(); err != nil {
+		return err
+	}
+	h.dev.CheckWorkarounds()
+
+	h.mgr.Info("created interface", "name", h.dev.linkName, "primary", prefix)
+	return nil
+}
+
+// sendTun passes the file descriptor of the tun device to the client.
+// Must be called with the lock held.
+func (h *Helper) sendTun(conn *net.UnixConn) error {
+	f, ok := h.dev.tun.(interface{ File() *os.File })
+	if !ok {
+		return errors.New("tun device does not provide file")
+	}
+	// Use the raw connection in order not to set the file to blocking mode.
+	raw, err := f.File().SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sendErr error
+	err = raw.Control(func(fd uintptr) {
+		_, _, sendErr = conn.WriteMsgUnix([]byte(helperReplyOK), unix.UnixRights(int(fd)), nil)
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// peerUID returns the user ID of the process on the other end of the
+// connection.
+func peerUID(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		cred    *unix.Ucred
+		credErr error
+	)
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+	return int(cred.Uid), nil
+}
@@ -0,0 +1,74 @@
+package tun
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHelperRequest(t *testing.T) {
+	t.Parallel()
+
+	cmd, prefix, err := parseHelperRequest("open fd12:3456::1/8\n")
+	require.NoError(t, err)
+	assert.Equal(t, helperCmdOpen, cmd)
+	assert.Equal(t, netip.MustParsePrefix("fd12:3456::1/8"), prefix)
+
+	// Unknown commands are rejected when handling the request.
+	cmd, _, err = parseHelperRequest("unknown fd12:3456::1/8")
+	require.NoError(t, err)
+	assert.Equal(t, "unknown", cmd)
+
+	for _, request := range []string{
+		"",
+		" ",
+		"open",
+		"open ",
+		"fd12:3456::1/8",
+		"open fd12:3456::1",
+		"open fd12:3456::1/8 extra",
+		"open fd12:3456::1/16",
+		"open fd12:3456::1/128",
+		"open 2001:db8::1/8",
+		"open 10.0.0.1/8",
+		"open ::ffff:10.0.0.1/8",
+		"open fd12:3456::1%eth0/8",
+		"open fd12:3456::1/-1",
+		"open fd12:3456::1/" + strings.Repeat("8", maxHelperMsgSize),
+		"open \x00fd12:3456::1/8",
+	} {
+		_, _, err := parseHelperRequest(request)
+		assert.Error(t, err, "request %q must be rejected", request)
+	}
+}
+
+func TestParseHelperReply(t *testing.T) {
+	t.Parallel()
+
+	detail, err := parseHelperReply("ok")
+	require.NoError(t, err)
+	assert.Empty(t, detail)
+	detail, err = parseHelperReply("ok address re-added")
+	require.NoError(t, err)
+	assert.Equal(t, "address re-added", detail)
+
+	_, err = parseHelperReply("missing")
+	require.ErrorIs(t, err, errInterfaceMissing)
+	_, err = parseHelperReply("error permission denied")
+	require.ErrorContains(t, err, "permission denied")
+
+	for _, reply := range []string{
+		"",
+		" ok",
+		"OK",
+		"okay",
+		"\x00ok",
+		strings.Repeat("x", maxHelperMsgSize),
+	} {
+		_, err := parseHelperReply(reply)
+		assert.Error(t, err, "reply %q must be rejected", reply)
+	}
+}
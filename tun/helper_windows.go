@@ -0,0 +1,39 @@
+package tun
+
+import (
+	"context"
+	"net/netip"
+
+	"golang.zx2c4.com/wireguard/tun"
+
+	"github.com/mycoria/mycoria/config"
+)
+
+func (hc *helperClient) exchange(request string) (reply string, fd int, err error) {
+	return "", -1, ErrHelperUnsupported
+}
+
+func (hc *helperClient) open(prefix netip.Prefix) (tun.Device, error) {
+	return nil, ErrHelperUnsupported
+}
+
+func closeFD(fd int) {}
+
+// Helper is the privileged tun helper, which creates and configures the tun
+// device on behalf of the unprivileged router.
+type Helper struct{}
+
+// NewHelper returns a new tun helper listening on the given socket path.
+func NewHelper(c *config.Config, socketPath string, uid, gid int) (*Helper, error) {
+	return nil, ErrHelperUnsupported
+}
+
+// Serve handles requests until the context is canceled.
+func (h *Helper) Serve(ctx context.Context) error {
+	return ErrHelperUnsupported
+}
+
+// Close removes the socket and closes the tun device.
+func (h *Helper) Close() error {
+	return nil
+}
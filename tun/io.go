@@ -3,13 +3,19 @@ package tun
 import (
 	"errors"
 	"runtime"
+	"time"
 
 	"golang.zx2c4.com/wireguard/tun"
 
 	"github.com/mycoria/mycoria/mgr"
 )
 
-const readSegments = 32
+const (
+	readSegments = 32
+	// readErrorBackoff defines how long to wait after a failed read, so that
+	// a broken device does not cause a busy loop until it is recovered.
+	readErrorBackoff = 100 * time.Millisecond
+)
 
 func (d *Device) tunReader(w *mgr.WorkerCtx) error {
 	builder := d.instance.FrameBuilder()
@@ -48,6 +54,13 @@ func (d *Device) tunReader(w *mgr.WorkerCtx) error {
 
 			default:
 				w.Error("failed to read packet", "err", err)
+				// The interface may have disappeared.
+				d.TriggerCheck()
+				select {
+				case <-time.After(readErrorBackoff):
+				case <-w.Done():
+					return nil
+				}
 			}
 
 		}
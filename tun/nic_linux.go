@@ -2,7 +2,9 @@ package tun
 
 import (
 	"fmt"
+	"net"
 	"net/netip"
+	"strings"
 
 	"github.com/vishvananda/netlink"
 	"go4.org/netipx"
@@ -10,7 +12,7 @@ import (
 
 func (d *Device) netLink() (netlink.Link, error) {
 	// Get link by index and check if the name matches.
-	nl, err := netlink.LinkByIndex(d.linkIndex)
+	nl, err := netlink.LinkByIndex(int(d.linkIndex.Load()))
 	if err == nil && nl.Attrs().Name == d.linkName {
 		return nl, nil
 	}
@@ -20,7 +22,7 @@ func (d *Device) netLink() (netlink.Link, error) {
 	if err != nil {
 		return nil, fmt.Errorf("get link %q by name: %w", d.linkName, err)
 	}
-	d.linkIndex = nl.Attrs().Index
+	d.linkIndex.Store(int64(nl.Attrs().Index))
 
 	return nl, nil
 }
@@ -104,7 +106,7 @@ func (d *Device) AddRoute(prefix netip.Prefix, highPrio bool) error {
 	}
 
 	return netlink.RouteAdd(&netlink.Route{
-		LinkIndex: d.linkIndex,
+		LinkIndex: int(d.linkIndex.Load()),
 		Dst:       netipx.PrefixIPNet(prefix),
 		Priority:  metric,
 		Family:    netlink.FAMILY_V6,
@@ -114,9 +116,45 @@ func (d *Device) AddRoute(prefix netip.Prefix, highPrio bool) error {
 // RemoveRoute removes a route to the interface.
 func (d *Device) RemoveRoute(prefix netip.Prefix) error {
 	return netlink.RouteDel(&netlink.Route{
-		LinkIndex: d.linkIndex,
+		LinkIndex: int(d.linkIndex.Load()),
 		Dst:       netipx.PrefixIPNet(prefix),
 		Priority:  0,
 		Family:    netlink.FAMILY_V6,
 	})
 }
+
+// repairInterface brings the interface up and adds the primary address, if
+// necessary. It returns what was repaired or errInterfaceMissing, if the
+// interface must be recreated.
+func (d *Device) repairInterface() (repaired string, err error) {
+	nl, err := d.netLink()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInterfaceMissing, err)
+	}
+
+	// Bring interface up.
+	if nl.Attrs().Flags&net.FlagUp == 0 {
+		if err := netlink.LinkSetUp(nl); err != nil {
+			return "", fmt.Errorf("set link to up: %w", err)
+		}
+		repaired = "link down"
+	}
+
+	// Add primary address.
+	if d.primaryDisabled.Load() {
+		return repaired, nil
+	}
+	addrs, err := netlink.AddrList(nl, netlink.FAMILY_V6)
+	if err != nil {
+		return repaired, fmt.Errorf("list addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		if prefix, ok := netipx.FromStdIPNet(addr.IPNet); ok && prefix == d.primaryAddress {
+			return repaired, nil
+		}
+	}
+	if err := d.AddAddress(d.primaryAddress); err != nil {
+		return repaired, fmt.Errorf("add primary address: %w", err)
+	}
+	return strings.TrimPrefix(repaired+", primary address missing", ", "), nil
+}
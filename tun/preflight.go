@@ -0,0 +1,71 @@
+package tun
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// ErrPreflightFailed is returned when the system is not ready for creating
+// the tun device.
+var ErrPreflightFailed = errors.New("pre-flight check failed")
+
+// PreflightError describes a failed pre-flight check and how to fix it.
+type PreflightError struct {
+	Check   string
+	Problem string
+	Fix     string
+}
+
+func (pe *PreflightError) Error() string {
+	return fmt.Sprintf("%s %q: %s - fix: %s", ErrPreflightFailed, pe.Check, pe.Problem, pe.Fix)
+}
+
+// Unwrap returns ErrPreflightFailed.
+func (pe *PreflightError) Unwrap() error {
+	return ErrPreflightFailed
+}
+
+// Preflight checks if the system is ready for creating the tun device with
+// the given name and primary address. Returns a *PreflightError describing
+// the first failed check.
+func Preflight(linkName string, primaryAddress netip.Prefix) error {
+	if err := platformPreflight(); err != nil {
+		return err
+	}
+	return checkConflictingAddress(linkName, primaryAddress.Addr())
+}
+
+// checkConflictingAddress checks if the router address is already in use by
+// another interface, eg. by another instance of mycoria.
+func checkConflictingAddress(linkName string, ip netip.Addr) error {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		// Do not fail on systems where interfaces cannot be listed.
+		return nil //nolint:nilerr
+	}
+	for _, iface := range ifaces {
+		if iface.Name == linkName {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ifIP, ok := netip.AddrFromSlice(ipNet.IP); ok && ifIP.Unmap() == ip {
+				return &PreflightError{
+					Check:   "address conflict",
+					Problem: fmt.Sprintf("router address %s is already used by interface %q", ip, iface.Name),
+					Fix:     "stop other instances using the same identity or remove the address from the interface",
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package tun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	tunDevicePath   = "/dev/net/tun"
+	ipv6DisablePath = "/proc/sys/net/ipv6/conf/all/disable_ipv6"
+	ipv6AddrsPath   = "/proc/net/if_inet6"
+)
+
+func platformPreflight() error {
+	// Check for permission to configure network interfaces.
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var caps [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &caps[0]); err == nil &&
+		caps[0].Effective&(1<<unix.CAP_NET_ADMIN) == 0 {
+		return &PreflightError{
+			Check:   "CAP_NET_ADMIN",
+			Problem: "missing permission to configure network interfaces",
+			Fix:     "run as root, grant the capability with \"setcap cap_net_admin+ep <binary>\" or set AmbientCapabilities=CAP_NET_ADMIN in the systemd unit",
+		}
+	}
+
+	// Check for tun device.
+	if _, err := os.Stat(tunDevicePath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &PreflightError{
+				Check:   tunDevicePath,
+				Problem: "tun device is missing",
+				Fix:     "load the kernel module with \"modprobe tun\", or in a container pass the device with \"--device /dev/net/tun\"",
+			}
+		}
+		return &PreflightError{
+			Check:   tunDevicePath,
+			Problem: fmt.Sprintf("cannot access tun device: %s", err),
+			Fix:     "check the permissions of " + tunDevicePath,
+		}
+	}
+
+	// Check if IPv6 is enabled.
+	if _, err := os.Stat(ipv6AddrsPath); errors.Is(err, os.ErrNotExist) {
+		return &PreflightError{
+			Check:   "IPv6",
+			Problem: "IPv6 is disabled in the kernel",
+			Fix:     "remove \"ipv6.disable=1\" from the kernel command line and reboot",
+		}
+	}
+	if data, err := os.ReadFile(ipv6DisablePath); err == nil && strings.TrimSpace(string(data)) == "1" {
+		return &PreflightError{
+			Check:   "IPv6",
+			Problem: "IPv6 is disabled via sysctl",
+			Fix:     "enable it with \"sysctl -w net.ipv6.conf.all.disable_ipv6=0\" and persist it in /etc/sysctl.conf",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package tun
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+func platformPreflight() error {
+	// Check for permission to configure network interfaces.
+	if !windows.GetCurrentProcessToken().IsElevated() {
+		return &PreflightError{
+			Check:   "administrator",
+			Problem: "missing permission to create network interfaces",
+			Fix:     "run as administrator or install mycoria as a service",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package tun
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.zx2c4.com/wireguard/tun"
+
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// interfaceCheckInterval defines how often the interface is checked.
+	interfaceCheckInterval = 10 * time.Second
+	// suspendThreshold defines how much longer than the check interval the
+	// time between two checks may be before the system is considered to have
+	// been suspended.
+	suspendThreshold = 3 * interfaceCheckInterval
+)
+
+// errInterfaceMissing is returned when the interface does not exist anymore.
+var errInterfaceMissing = errors.New("interface missing")
+
+// SetRecoveryHandler sets a function that is called when the interface was
+// recovered or the system resumed from suspend, so that connectivity can be
+// restored, eg. by re-announcing the router.
+// Must be called before Start.
+func (d *Device) SetRecoveryHandler(fn func()) {
+	d.recoveryHandler = fn
+}
+
+// TriggerCheck triggers checking the interface.
+func (d *Device) TriggerCheck() {
+	select {
+	case d.checkNow <- struct{}{}:
+	default:
+	}
+}
+
+// recoveryWorker regularly checks that the interface exists, is up and has
+// its addresses, and repairs it otherwise. Interfaces may disappear or lose
+// their addresses when the system is suspended or when other software
+// reconfigures the network, eg. NetworkManager.
+func (d *Device) recoveryWorker(w *mgr.WorkerCtx) error {
+	ticker := time.NewTicker(interfaceCheckInterval)
+	defer ticker.Stop()
+
+	lastCheck := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.checkNow:
+		case <-w.Done():
+			return nil
+		}
+
+		// Detect suspend by a jump of the wall clock.
+		now := time.Now()
+		resumed := now.Round(0).Sub(lastCheck.Round(0)) > suspendThreshold
+		lastCheck = now
+		if resumed {
+			w.Info("system resumed from suspend, checking interface")
+		}
+
+		// Check and repair interface.
+		recovered, err := d.recoverInterface(w)
+		if err != nil {
+			w.Warn("failed to recover interface", "err", err)
+			continue
+		}
+
+		// Restore connectivity.
+		if (recovered || resumed) && d.recoveryHandler != nil {
+			d.recoveryHandler()
+		}
+	}
+}
+
+// recoverInterface checks the interface and repairs it, if necessary.
+// It returns whether anything was repaired.
+func (d *Device) recoverInterface(w *mgr.WorkerCtx) (recovered bool, err error) {
+	var repaired string
+	if d.helper != nil {
+		repaired, err = d.helper.request(helperCmdRepair, d.primaryAddress)
+	} else {
+		repaired, err = d.repairInterface()
+	}
+	switch {
+	case err == nil && repaired == "":
+		return false, nil
+	case err == nil:
+		w.Warn("repaired interface", "repaired", repaired)
+		d.CheckWorkarounds()
+		return true, nil
+	case !errors.Is(err, errInterfaceMissing):
+		return false, err
+	}
+
+	// Recreate interface.
+	w.Warn("interface disappeared, recreating it", "err", err)
+	if err := d.recreate(); err != nil {
+		return false, fmt.Errorf("recreate interface: %w", err)
+	}
+	w.Info("recreated interface")
+	d.CheckWorkarounds()
+	return true, nil
+}
+
+// recreate creates a new tun device and replaces the current one.
+func (d *Device) recreate() error {
+	if d.helper != nil {
+		return d.recreateWithHelper()
+	}
+
+	d.PrepTUN()
+	t, err := tun.CreateTUN(d.linkName, d.instance.Config().TunMTU())
+	if err != nil {
+		return err
+	}
+	if err := d.InitInterface(d.primaryAddress); err != nil {
+		_ = t.Close()
+		return fmt.Errorf("add primary address: %w", err)
+	}
+	if d.primaryDisabled.Load() {
+		if err := d.RemoveAddress(d.primaryAddress); err != nil {
+			_ = t.Close()
+			return fmt.Errorf("remove disabled primary address: %w", err)
+		}
+	}
+	if err := d.StartInterface(); err != nil {
+		_ = t.Close()
+		return err
+	}
+
+	d.replace(t)
+	return nil
+}
+
+// recreateWithHelper requests a new tun device from the helper and replaces
+// the current one.
+func (d *Device) recreateWithHelper() error {
+	t, err := d.helper.open(d.primaryAddress)
+	if err != nil {
+		return err
+	}
+	if d.primaryDisabled.Load() {
+		if _, err := d.helper.request(helperCmdDisablePrimary, d.primaryAddress); err != nil {
+			_ = t.Close()
+			return fmt.Errorf("remove disabled primary address: %w", err)
+		}
+	}
+
+	d.replace(t)
+	return nil
+}
+
+// replace replaces the current tun device and closes the old one.
+func (d *Device) replace(t tun.Device) {
+	d.tunLock.Lock()
+	old := d.tun
+	d.tun = t
+	d.tunLock.Unlock()
+	_ = old.Close()
+
+	// Notify event handler.
+	select {
+	case d.replaced <- struct{}{}:
+	default:
+	}
+}
@@ -1,10 +1,14 @@
 package tun
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/netip"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"golang.zx2c4.com/wireguard/tun"
 
@@ -22,13 +26,28 @@ const DefaultTunName = "mycoria"
 type Device struct {
 	mgr *mgr.Manager
 
-	linkName  string
-	linkIndex int //nolint:structcheck,unused // Used on linux.
+	linkName string
+	// linkIndex caches the index of the link. It is atomic, as the recovery
+	// worker looks up the link concurrently to address and route changes.
+	linkIndex atomic.Int64 //nolint:structcheck,unused // Used on linux.
 
-	tun tun.Device
+	tun     tun.Device
+	tunLock sync.RWMutex
 
-	primaryAddress netip.Prefix
-	secondaryIPs   []netip.Prefix
+	// helper creates and configures the interface, if set.
+	helper *helperClient
+
+	primaryAddress  netip.Prefix
+	primaryDisabled atomic.Bool
+	secondaryIPs    []netip.Prefix
+
+	// workaroundDenied is set when applying workarounds is not permitted.
+	workaroundDenied atomic.Bool
+
+	// recoveryHandler is called when the interface was recovered.
+	recoveryHandler func()
+	checkNow        chan struct{}
+	replaced        chan struct{}
 
 	RecvRaw   chan []byte
 	SendRaw   chan []byte
@@ -61,17 +80,36 @@ func Create(instance instance) (*Device, error) {
 	}
 
 	// Create device struct.
+	queueSize := instance.Config().Limits.QueueSize
 	d := &Device{
 		linkName:       linkName,
 		primaryAddress: primaryAddress,
 		secondaryIPs:   make([]netip.Prefix, 0, 2),
-		RecvRaw:        make(chan []byte, 1000),
-		SendRaw:        make(chan []byte, 1000),
-		SendFrame:      make(chan frame.Frame, 1000),
+		RecvRaw:        make(chan []byte, queueSize),
+		SendRaw:        make(chan []byte, queueSize),
+		SendFrame:      make(chan frame.Frame, queueSize),
 		sendRawOffset:  10,
+		checkNow:       make(chan struct{}, 1),
+		replaced:       make(chan struct{}, 1),
 		instance:       instance,
 	}
 
+	// Get tun device from privileged helper.
+	if socketPath := instance.Config().System.TunHelper; socketPath != "" {
+		d.helper = &helperClient{socketPath: socketPath}
+		t, err := d.helper.open(primaryAddress)
+		if err != nil {
+			return nil, err
+		}
+		d.tun = t
+		return d, nil
+	}
+
+	// Check if the system is ready.
+	if err := Preflight(linkName, primaryAddress); err != nil {
+		return nil, err
+	}
+
 	// Prep.
 	d.PrepTUN()
 
@@ -95,14 +133,18 @@ func Create(instance instance) (*Device, error) {
 func (d *Device) Start(mgr *mgr.Manager) error {
 	d.mgr = mgr
 
-	if err := d.StartInterface(); err != nil {
-		return err
+	// The helper already started the interface.
+	if d.helper == nil {
+		if err := d.StartInterface(); err != nil {
+			return err
+		}
 	}
 	d.CheckWorkarounds()
 
 	mgr.Go("read packets", d.tunReader)
 	mgr.Go("write packets", d.tunWriter)
 	mgr.Go("handle tun events", d.handleTunEvents)
+	mgr.Go("recover interface", d.recoveryWorker)
 	return nil
 }
 
@@ -112,6 +154,25 @@ func (d *Device) Stop(mgr *mgr.Manager) error {
 	return d.Close()
 }
 
+// SetPrimaryAddress adds or removes the primary address of the interface,
+// and with it the route to the network. This is used to fail over between
+// the routers of a high availability pair.
+func (d *Device) SetPrimaryAddress(enabled bool) error {
+	d.primaryDisabled.Store(!enabled)
+	if d.helper != nil {
+		cmd := helperCmdDisablePrimary
+		if enabled {
+			cmd = helperCmdEnablePrimary
+		}
+		_, err := d.helper.request(cmd, d.primaryAddress)
+		return err
+	}
+	if enabled {
+		return d.AddAddress(d.primaryAddress)
+	}
+	return d.RemoveAddress(d.primaryAddress)
+}
+
 // CheckWorkarounds may be called to make sure any workarounds are correctly
 // applied after the network or related resources have changed.
 func (d *Device) CheckWorkarounds() {
@@ -120,6 +181,17 @@ func (d *Device) CheckWorkarounds() {
 		return
 	}
 
+	// Let the helper apply workarounds.
+	if d.helper != nil {
+		if _, err := d.helper.request(helperCmdApplyWorkaround, d.primaryAddress); err != nil {
+			d.mgr.Warn(
+				"failed to apply workarounds via tun helper",
+				"err", err,
+			)
+		}
+		return
+	}
+
 	// Apply Chromium workaround.
 	if err := d.applyChromiumWorkaround(d.mgr); err != nil {
 		d.mgr.Warn(
@@ -139,7 +211,7 @@ func (d *Device) applyChromiumWorkaround(mgr *mgr.Manager) error {
 	// TL;DR: `ip -6 route get 2001:4860:4860::8888` must succeed.
 
 	// Check if disabled.
-	if d.instance.Config().System.DisableChromiumWorkaround {
+	if d.instance.Config().System.DisableChromiumWorkaround || d.workaroundDenied.Load() {
 		return nil
 	}
 
@@ -158,6 +230,11 @@ func (d *Device) applyChromiumWorkaround(mgr *mgr.Manager) error {
 	case strings.Contains(err.Error(), "unreachable"):
 		// If not route exists, fake it.
 		if err := d.AddRoute(workaroundNet, false); err != nil {
+			// Stop trying when not permitted, eg. by AppArmor or SELinux.
+			if errors.Is(err, os.ErrPermission) {
+				d.workaroundDenied.Store(true)
+				return fmt.Errorf("add route (not permitted, disabling workaround): %w", err)
+			}
 			return fmt.Errorf("add route: %w", err)
 		}
 		mgr.Debug(
@@ -181,7 +258,7 @@ func (d *Device) applyChromiumWorkaround(mgr *mgr.Manager) error {
 // A nonzero offset can be used to instruct the Device on where to begin
 // reading into each element of the bufs slice.
 func (d *Device) Read(bufs [][]byte, sizes []int, offset int) (n int, err error) {
-	return d.tun.Read(bufs, sizes, offset)
+	return d.device().Read(bufs, sizes, offset)
 }
 
 // Write one or more packets to the device (without any additional headers).
@@ -189,24 +266,33 @@ func (d *Device) Read(bufs [][]byte, sizes []int, offset int) (n int, err error)
 // offset can be used to instruct the Device on where to begin writing from
 // each packet contained within the bufs slice.
 func (d *Device) Write(bufs [][]byte, offset int) (int, error) {
-	return d.tun.Write(bufs, offset)
+	return d.device().Write(bufs, offset)
 }
 
 // TunEvents returns a channel of type Event, which is fed Device events.
 func (d *Device) TunEvents() <-chan tun.Event {
-	return d.tun.Events()
+	return d.device().Events()
 }
 
 // Close stops the Device and closes the Event channel.
 func (d *Device) Close() error {
-	return d.tun.Close()
+	return d.device().Close()
 }
 
 // BatchSize returns the preferred/max number of packets that can be read or
 // written in a single read/write call. BatchSize must not change over the
 // lifetime of a Device.
 func (d *Device) BatchSize() int {
-	return d.tun.BatchSize()
+	return d.device().BatchSize()
+}
+
+// device returns the current tun device, which is replaced when the
+// interface is recreated.
+func (d *Device) device() tun.Device {
+	d.tunLock.RLock()
+	defer d.tunLock.RUnlock()
+
+	return d.tun
 }
 
 // SendRawOffset returns the required offset of packets submitted via SendRaw.
@@ -235,14 +321,19 @@ func (d *Device) handleTunEvents(w *mgr.WorkerCtx) error {
 			switch event {
 			case 0:
 				w.Info("tun interface event", "event", "closed", "eventID", event)
-				return nil
+				// Continue with the new device, if the interface is recreated.
+				select {
+				case <-d.replaced:
+				case <-w.Done():
+					return nil
+				}
 			case tun.EventUp:
 				w.Info("tun interface event", "event", "EventUp", "eventID", event)
 			case tun.EventDown:
 				w.Info("tun interface event", "event", "EventDown", "eventID", event)
 			case tun.EventMTUUpdate:
 				// TODO: What is being updated here? How can we use this information?
-				mtu, err := d.tun.MTU()
+				mtu, err := d.device().MTU()
 				if err != nil {
 					w.Warn("failed to get tun mtu", "err", err)
 				} else {
@@ -109,3 +109,27 @@ func (d *Device) RemoveRoute(prefix netip.Prefix) error {
 
 	return luid.DeleteRoute(prefix, config.DefaultAPIAddress)
 }
+
+// repairInterface adds the primary address, if necessary. It returns what was
+// repaired or errInterfaceMissing, if the interface must be recreated.
+func (d *Device) repairInterface() (repaired string, err error) {
+	luid, err := d.LUID()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInterfaceMissing, err)
+	}
+	if _, err := luid.Interface(); err != nil {
+		return "", fmt.Errorf("%w: %w", errInterfaceMissing, err)
+	}
+
+	// Add primary address.
+	if d.primaryDisabled.Load() {
+		return "", nil
+	}
+	if _, err := luid.IPAddress(d.primaryAddress.Addr()); err == nil {
+		return "", nil
+	}
+	if err := luid.AddIPAddress(d.primaryAddress); err != nil {
+		return "", fmt.Errorf("add primary address: %w", err)
+	}
+	return "primary address missing", nil
+}
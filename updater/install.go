@@ -0,0 +1,102 @@
+package updater
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ErrHashMismatch is returned when a downloaded binary does not match the
+// hash in the release manifest.
+var ErrHashMismatch = errors.New("binary does not match the release manifest")
+
+// download downloads the binary from the given URL to the given path and
+// verifies its size and hash. The file is removed if verification fails.
+func (u *Updater) download(ctx context.Context, binURL string, bin *Binary, path string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, installTimeout)
+	defer cancel()
+
+	// Request binary.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, binURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download binary: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download binary: %s", resp.Status)
+	}
+
+	// Write to file while hashing.
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755) //nolint:gosec // Executable.
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("write file: %w", closeErr)
+		}
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+	hash := BinaryHash.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(resp.Body, bin.Size+1))
+	if err != nil {
+		return fmt.Errorf("download binary: %w", err)
+	}
+
+	// Verify.
+	expected, err := hex.DecodeString(bin.Hash)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: invalid hash", ErrManifestInvalid)
+	case n != bin.Size:
+		return fmt.Errorf("%w: size is %d instead of %d bytes", ErrHashMismatch, n, bin.Size)
+	case subtle.ConstantTimeCompare(hash.Sum(nil), expected) != 1:
+		return ErrHashMismatch
+	}
+	return nil
+}
+
+// executablePath returns the path of the running executable.
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("find executable: %w", err)
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return "", fmt.Errorf("find executable: %w", err)
+	}
+	return exe, nil
+}
+
+// replaceFile replaces the target with the staged file. The target is kept
+// with an ".old" suffix, so that the update can be rolled back manually.
+// Replacing the executable of a running process works on all supported
+// platforms, as files are moved instead of overwritten.
+func replaceFile(target, staged string) error {
+	previous := target + ".old"
+	if err := os.Remove(previous); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove previous backup: %w", err)
+	}
+	if err := os.Rename(target, previous); err != nil {
+		return fmt.Errorf("move current executable: %w", err)
+	}
+	if err := os.Rename(staged, target); err != nil {
+		// Try to restore current executable.
+		_ = os.Rename(previous, target)
+		return fmt.Errorf("move new executable: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package updater
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+var manifestSigningContext = []byte("release manifest")
+
+// Manifest errors.
+var (
+	ErrManifestInvalid   = errors.New("invalid release manifest")
+	ErrManifestUntrusted = errors.New("release manifest is not signed by a trusted router")
+)
+
+// BinaryHash is the hash algorithm of release binaries.
+const BinaryHash = m.BLAKE3
+
+// Manifest describes a release.
+type Manifest struct {
+	Version  string    `cbor:"v,omitempty" json:"version"`
+	Released time.Time `cbor:"t,omitempty" json:"released,omitempty"`
+	Notes    string    `cbor:"n,omitempty" json:"notes,omitempty"`
+	Binaries []Binary  `cbor:"b,omitempty" json:"binaries"`
+
+	// Signer is the router that signed the manifest.
+	Signer netip.Addr `cbor:"-" json:"signer,omitempty"`
+}
+
+// Binary is a release binary for a platform.
+type Binary struct {
+	OS   string `cbor:"o,omitempty" json:"os"`
+	Arch string `cbor:"a,omitempty" json:"arch"`
+	// URL is the download URL. It may be relative to the manifest URL.
+	URL  string `cbor:"u,omitempty" json:"url"`
+	Size int64  `cbor:"s,omitempty" json:"size"`
+	// Hash is the hex encoded BLAKE3 hash of the binary.
+	Hash string `cbor:"h,omitempty" json:"hash"`
+}
+
+// signedManifest is the serialized and signed form of a release manifest.
+type signedManifest struct {
+	Manifest []byte          `cbor:"m,omitempty"`
+	Signer   m.PublicAddress `cbor:"r,omitempty"`
+	Sig      []byte          `cbor:"s,omitempty"`
+}
+
+// Check checks if the manifest is complete.
+func (mf *Manifest) Check() error {
+	if _, ok := parseVersion(mf.Version); !ok {
+		return fmt.Errorf("invalid version %q", mf.Version)
+	}
+	for _, bin := range mf.Binaries {
+		switch {
+		case bin.OS == "" || bin.Arch == "":
+			return errors.New("binary is missing os or arch")
+		case bin.URL == "":
+			return fmt.Errorf("binary for %s/%s is missing the url", bin.OS, bin.Arch)
+		case bin.Size <= 0:
+			return fmt.Errorf("binary for %s/%s is missing the size", bin.OS, bin.Arch)
+		}
+		hash, err := hex.DecodeString(bin.Hash)
+		if err != nil || len(hash) != BinaryHash.New().Size() {
+			return fmt.Errorf("binary for %s/%s has an invalid hash", bin.OS, bin.Arch)
+		}
+	}
+	return nil
+}
+
+// Binary returns the binary for the given platform.
+func (mf *Manifest) Binary(goos, goarch string) (*Binary, bool) {
+	for i, bin := range mf.Binaries {
+		if bin.OS == goos && bin.Arch == goarch {
+			return &mf.Binaries[i], true
+		}
+	}
+	return nil, false
+}
+
+// SignManifest signs the release manifest with the given router address.
+func SignManifest(signer *m.Address, mf *Manifest) ([]byte, error) {
+	if err := mf.Check(); err != nil {
+		return nil, err
+	}
+	manifestData, err := cbor.Marshal(mf)
+	if err != nil {
+		return nil, fmt.Errorf("marshal release manifest: %w", err)
+	}
+	sig, err := signer.SignWithContext(manifestData, manifestSigningContext)
+	if err != nil {
+		return nil, fmt.Errorf("sign release manifest: %w", err)
+	}
+	return cbor.Marshal(&signedManifest{
+		Manifest: manifestData,
+		Signer:   signer.PublicAddress,
+		Sig:      sig,
+	})
+}
+
+// ParseSignedManifest parses the given signed release manifest and verifies
+// that it is signed by one of the trusted routers.
+func ParseSignedManifest(data []byte, trusted []netip.Addr) (*Manifest, error) {
+	// Unpack.
+	signed := &signedManifest{}
+	if err := cbor.Unmarshal(data, signed); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrManifestInvalid, err)
+	}
+
+	// Verify signer and signature.
+	if !slices.Contains(trusted, signed.Signer.IP) {
+		return nil, fmt.Errorf("%w: signed by %s", ErrManifestUntrusted, signed.Signer.IP)
+	}
+	if err := signed.Signer.VerifyAddress(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrManifestInvalid, err)
+	}
+	if err := signed.Signer.VerifySigWithContext(signed.Manifest, signed.Sig, manifestSigningContext); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrManifestInvalid, err)
+	}
+
+	// Unpack and check manifest.
+	mf := &Manifest{}
+	if err := cbor.Unmarshal(signed.Manifest, mf); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrManifestInvalid, err)
+	}
+	if err := mf.Check(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrManifestInvalid, err)
+	}
+	mf.Signer = signed.Signer.IP
+	return mf, nil
+}
+
+// version is a parsed release version.
+type version struct {
+	parts [3]int
+	// pre is the pre-release suffix, eg. "rc1".
+	pre string
+}
+
+// parseVersion parses versions like "v1.2.3" or "1.2.3-rc1".
+// Development builds cannot be parsed.
+func parseVersion(s string) (v version, ok bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, v.pre, _ = strings.Cut(s, "-")
+	fields := strings.Split(s, ".")
+	if len(fields) != len(v.parts) {
+		return version{}, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return version{}, false
+		}
+		v.parts[i] = n
+	}
+	return v, true
+}
+
+// CompareVersions compares the release versions a and b like cmp.Compare.
+// Pre-releases are older than their release. Returns false if either version
+// cannot be parsed, eg. for development builds.
+func CompareVersions(a, b string) (result int, ok bool) {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+
+	if c := slices.Compare(va.parts[:], vb.parts[:]); c != 0 {
+		return c, true
+	}
+	switch {
+	case va.pre == vb.pre:
+		return 0, true
+	case va.pre == "":
+		return 1, true
+	case vb.pre == "":
+		return -1, true
+	default:
+		return strings.Compare(va.pre, vb.pre), true
+	}
+}
@@ -0,0 +1,90 @@
+package updater
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/m"
+)
+
+func TestSignedManifest(t *testing.T) {
+	t.Parallel()
+
+	signer, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+	other, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+
+	mf := &Manifest{
+		Version: "v1.2.3",
+		Notes:   "Test release.",
+		Binaries: []Binary{{
+			OS:   "linux",
+			Arch: "amd64",
+			URL:  "mycoria_linux_amd64",
+			Size: 1,
+			Hash: strings.Repeat("00", 32),
+		}},
+	}
+
+	// Sign and parse.
+	signed, err := SignManifest(signer, mf)
+	require.NoError(t, err)
+	parsed, err := ParseSignedManifest(signed, []netip.Addr{signer.IP})
+	require.NoError(t, err)
+	assert.Equal(t, signer.IP, parsed.Signer)
+	assert.Equal(t, mf.Version, parsed.Version)
+	bin, ok := parsed.Binary("linux", "amd64")
+	require.True(t, ok)
+	assert.Equal(t, "mycoria_linux_amd64", bin.URL)
+	_, ok = parsed.Binary("windows", "amd64")
+	assert.False(t, ok)
+
+	// Untrusted signer.
+	_, err = ParseSignedManifest(signed, []netip.Addr{other.IP})
+	require.ErrorIs(t, err, ErrManifestUntrusted)
+
+	// Forged signature.
+	forgedSigner := *signer
+	forgedSigner.PrivateKey = other.PrivateKey
+	forged, err := SignManifest(&forgedSigner, mf)
+	require.NoError(t, err)
+	_, err = ParseSignedManifest(forged, []netip.Addr{signer.IP})
+	require.ErrorIs(t, err, ErrManifestInvalid)
+
+	// Incomplete manifests are not signed.
+	mf.Binaries[0].Hash = "00"
+	_, err = SignManifest(signer, mf)
+	require.Error(t, err)
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b   string
+		result int
+		ok     bool
+	}{
+		{"v1.2.3", "1.2.3", 0, true},
+		{"1.2.4", "1.2.3", 1, true},
+		{"1.10.0", "1.9.9", 1, true},
+		{"0.9.0", "1.0.0", -1, true},
+		{"1.0.0-rc1", "1.0.0", -1, true},
+		{"1.0.0", "1.0.0-rc2", 1, true},
+		{"1.0.0-rc2", "1.0.0-rc1", 1, true},
+		{"1.0.0", "dev build", 0, false},
+		{"1.0", "1.0.0", 0, false},
+		{"1.0.0 dev build", "1.0.0", 0, false},
+	}
+	for _, test := range tests {
+		result, ok := CompareVersions(test.a, test.b)
+		assert.Equal(t, test.ok, ok, "%s vs %s", test.a, test.b)
+		assert.Equal(t, test.result, result, "%s vs %s", test.a, test.b)
+	}
+}
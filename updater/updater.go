@@ -0,0 +1,289 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/mgr"
+)
+
+const (
+	// firstCheckDelay defines how long to wait after start before checking
+	// for updates, so that the router is connected to the network.
+	firstCheckDelay = 2 * time.Minute
+	// checkTimeout defines how long a check for updates may take.
+	checkTimeout = 1 * time.Minute
+	// installTimeout defines how long downloading an update may take.
+	installTimeout = 10 * time.Minute
+	// maxManifestSize limits the size of release manifests.
+	maxManifestSize = 1 << 20 // 1MB
+)
+
+// Updater errors.
+var (
+	ErrDisabled       = errors.New("updates are not configured")
+	ErrNoUpdate       = errors.New("no update available")
+	ErrNoBinary       = errors.New("release has no binary for this platform")
+	ErrUnknownVersion = errors.New("version of this build is unknown")
+	ErrInstalled      = errors.New("update is already installed, restart to complete")
+)
+
+// Updater checks a signed release manifest for software updates and
+// installs them, if enabled. Installing replaces the executable and requests
+// a restart, which is performed by the caller of the router.
+type Updater struct {
+	instance instance
+	mgr      *mgr.Manager
+	client   *http.Client
+
+	status     Status
+	statusLock sync.Mutex
+
+	installLock sync.Mutex
+
+	restart     chan struct{}
+	restartOnce sync.Once
+}
+
+// instance is an interface subset of inst.Ance.
+type instance interface {
+	Version() string
+	Config() *config.Config
+}
+
+// Status is the update status of the router.
+type Status struct {
+	// Enabled is set if a release manifest is configured.
+	Enabled    bool   `json:"enabled"`
+	AutoUpdate bool   `json:"autoUpdate,omitempty"`
+	Current    string `json:"current"`
+
+	// Latest is the version in the release manifest.
+	Latest    string    `json:"latest,omitempty"`
+	Released  time.Time `json:"released,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	Available bool      `json:"available"`
+
+	// Installed is the version that was installed and waits for a restart.
+	Installed string `json:"installed,omitempty"`
+
+	Checked time.Time `json:"checked,omitempty"`
+	Err     string    `json:"err,omitempty"`
+}
+
+// New returns a new updater.
+func New(instance instance) *Updater {
+	return &Updater{
+		instance: instance,
+		client:   &http.Client{Timeout: installTimeout},
+		status: Status{
+			Enabled:    instance.Config().Updates.ManifestURL != nil,
+			AutoUpdate: instance.Config().Updates.AutoUpdate,
+			Current:    instance.Version(),
+		},
+		restart: make(chan struct{}),
+	}
+}
+
+// Start starts the updater.
+func (u *Updater) Start(mgr *mgr.Manager) error {
+	u.mgr = mgr
+	if u.instance.Config().Updates.ManifestURL != nil {
+		u.mgr.Go("check for updates", u.checkWorker)
+	}
+	return nil
+}
+
+// Stop stops the updater.
+func (u *Updater) Stop(mgr *mgr.Manager) error {
+	return nil
+}
+
+// Status returns the current update status.
+func (u *Updater) Status() Status {
+	u.statusLock.Lock()
+	defer u.statusLock.Unlock()
+
+	return u.status
+}
+
+// RestartRequested returns a channel that is closed when an update was
+// installed and the router should be restarted.
+func (u *Updater) RestartRequested() <-chan struct{} {
+	return u.restart
+}
+
+func (u *Updater) checkWorker(w *mgr.WorkerCtx) error {
+	timer := time.NewTimer(firstCheckDelay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-w.Done():
+			return nil
+		}
+		timer.Reset(u.instance.Config().Updates.CheckInterval)
+
+		// Check for update.
+		status, mf, err := u.check(w.Ctx())
+		switch {
+		case err != nil:
+			w.Warn("failed to check for updates", "err", err)
+			continue
+		case !status.Available:
+			w.Debug("no update available", "current", status.Current, "latest", status.Latest)
+			continue
+		}
+		w.Info(
+			"update available",
+			"current", status.Current,
+			"latest", status.Latest,
+			"signer", mf.Signer,
+		)
+
+		// Install update, if enabled.
+		if !u.instance.Config().Updates.AutoUpdate || status.Installed != "" {
+			continue
+		}
+		if err := u.install(w.Ctx(), mf); err != nil {
+			w.Error("failed to install update", "version", mf.Version, "err", err)
+			continue
+		}
+		w.Info("installed update, restarting", "version", mf.Version)
+	}
+}
+
+// Check checks the release manifest for an update.
+func (u *Updater) Check(ctx context.Context) (Status, error) {
+	status, _, err := u.check(ctx)
+	return status, err
+}
+
+// Install checks the release manifest for an update and installs it.
+// The router must be restarted to complete the update, which is requested via
+// RestartRequested.
+func (u *Updater) Install(ctx context.Context) (Status, error) {
+	status, mf, err := u.check(ctx)
+	switch {
+	case err != nil:
+		return status, err
+	case status.Installed != "":
+		return status, ErrInstalled
+	case !status.Available:
+		return status, ErrNoUpdate
+	}
+
+	if err := u.install(ctx, mf); err != nil {
+		return status, err
+	}
+	return u.Status(), nil
+}
+
+// check fetches the release manifest and updates the status.
+func (u *Updater) check(ctx context.Context) (Status, *Manifest, error) {
+	mf, err := u.fetchManifest(ctx)
+
+	u.statusLock.Lock()
+	defer u.statusLock.Unlock()
+
+	u.status.Checked = time.Now()
+	if err != nil {
+		u.status.Err = err.Error()
+		return u.status, nil, err
+	}
+	u.status.Err = ""
+	u.status.Latest = mf.Version
+	u.status.Released = mf.Released
+	u.status.Notes = mf.Notes
+
+	// Compare to current version.
+	newer, ok := CompareVersions(mf.Version, u.status.Current)
+	if !ok {
+		u.status.Available = false
+		u.status.Err = ErrUnknownVersion.Error()
+		return u.status, mf, ErrUnknownVersion
+	}
+	u.status.Available = newer > 0
+	return u.status, mf, nil
+}
+
+// fetchManifest fetches and verifies the release manifest.
+func (u *Updater) fetchManifest(ctx context.Context) (*Manifest, error) {
+	updates := u.instance.Config().Updates
+	if updates.ManifestURL == nil {
+		return nil, ErrDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, updates.ManifestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch manifest: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch manifest: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("fetch manifest: %w", err)
+	case len(data) > maxManifestSize:
+		return nil, fmt.Errorf("fetch manifest: %w: too big", ErrManifestInvalid)
+	}
+
+	return ParseSignedManifest(data, updates.Signers)
+}
+
+// install downloads and verifies the binary of the release and replaces the
+// executable with it.
+func (u *Updater) install(ctx context.Context, mf *Manifest) error {
+	u.installLock.Lock()
+	defer u.installLock.Unlock()
+
+	bin, ok := mf.Binary(runtime.GOOS, runtime.GOARCH)
+	if !ok {
+		return ErrNoBinary
+	}
+	binURL, err := u.instance.Config().Updates.ManifestURL.Parse(bin.URL)
+	if err != nil {
+		return fmt.Errorf("invalid binary url: %w", err)
+	}
+	if err := config.CheckUpdateURL(binURL); err != nil {
+		return fmt.Errorf("invalid binary url: %w", err)
+	}
+
+	// Download, verify and swap.
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	staged := exe + ".new"
+	if err := u.download(ctx, binURL.String(), bin, staged); err != nil {
+		return err
+	}
+	if err := replaceFile(exe, staged); err != nil {
+		return err
+	}
+
+	// Request restart.
+	u.statusLock.Lock()
+	u.status.Installed = mf.Version
+	u.statusLock.Unlock()
+	u.restartOnce.Do(func() {
+		close(u.restart)
+	})
+	return nil
+}
@@ -0,0 +1,117 @@
+package updater
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/config"
+	"github.com/mycoria/mycoria/m"
+)
+
+type testInstance struct {
+	version string
+	config  *config.Config
+}
+
+func (i *testInstance) Version() string        { return i.version }
+func (i *testInstance) Config() *config.Config { return i.config }
+
+func TestCheckAndDownload(t *testing.T) {
+	t.Parallel()
+
+	signer, _, err := m.GeneratePrivacyAddress(context.Background())
+	require.NoError(t, err)
+
+	// Create release.
+	binData := []byte("new mycoria binary")
+	hash := BinaryHash.New()
+	_, _ = hash.Write(binData)
+	signed, err := SignManifest(signer, &Manifest{
+		Version: "v1.1.0",
+		Binaries: []Binary{{
+			OS:   runtime.GOOS,
+			Arch: runtime.GOARCH,
+			URL:  "mycoria",
+			Size: int64(len(binData)),
+			Hash: hex.EncodeToString(hash.Sum(nil)),
+		}},
+	})
+	require.NoError(t, err)
+
+	// Serve release.
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/release/manifest":
+			_, _ = w.Write(signed)
+		case "/release/mycoria":
+			_, _ = w.Write(binData)
+		case "/release/tampered":
+			_, _ = w.Write([]byte("evil mycoria binary"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u := New(&testInstance{
+		version: "v1.0.0",
+		config: config.MakeTestConfig(config.Store{System: config.System{
+			UpdateManifestURL: server.URL + "/release/manifest",
+			UpdateSigners:     []string{signer.IP.String()},
+		}}),
+	})
+	u.client = server.Client()
+
+	// Check for update.
+	status, mf, err := u.check(context.Background())
+	require.NoError(t, err)
+	assert.True(t, status.Available)
+	assert.Equal(t, "v1.1.0", status.Latest)
+	assert.Equal(t, signer.IP, mf.Signer)
+
+	// Download and verify binary.
+	bin, ok := mf.Binary(runtime.GOOS, runtime.GOARCH)
+	require.True(t, ok)
+	dir := t.TempDir()
+	staged := filepath.Join(dir, "mycoria.new")
+	require.NoError(t, u.download(context.Background(), server.URL+"/release/mycoria", bin, staged))
+	data, err := os.ReadFile(staged)
+	require.NoError(t, err)
+	assert.Equal(t, binData, data)
+
+	// Tampered binaries are removed.
+	tampered := filepath.Join(dir, "tampered")
+	err = u.download(context.Background(), server.URL+"/release/tampered", bin, tampered)
+	require.ErrorIs(t, err, ErrHashMismatch)
+	assert.NoFileExists(t, tampered)
+
+	// Replace executable.
+	exe := filepath.Join(dir, "mycoria")
+	require.NoError(t, os.WriteFile(exe, []byte("old mycoria binary"), 0o600))
+	require.NoError(t, replaceFile(exe, staged))
+	data, err = os.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(t, binData, data)
+	assert.FileExists(t, exe+".old")
+	assert.NoFileExists(t, staged)
+
+	// No update for the same or newer versions.
+	u.status.Current = "v1.1.0"
+	status, _, err = u.check(context.Background())
+	require.NoError(t, err)
+	assert.False(t, status.Available)
+
+	// Development builds are not updated.
+	u.status.Current = "dev build"
+	_, _, err = u.check(context.Background())
+	require.ErrorIs(t, err, ErrUnknownVersion)
+}
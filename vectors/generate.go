@@ -0,0 +1,521 @@
+package vectors
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/zeebo/blake3"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/router"
+	"github.com/mycoria/mycoria/state"
+)
+
+const (
+	sourceContext       = "mycoria test vectors"
+	maxIdentityTries    = 100_000
+	announcePingType    = "announce"
+	announcePingID      = 0x6d79636f72696101
+	linkLayerPurpose    = "link layer crypt"
+	vectorRouterVersion = "0.0.0-vectors"
+)
+
+// vectorTime is the base time of all vectors.
+var vectorTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var testData = []byte("The quick brown fox jumps over the lazy dog. ")
+
+type generator struct {
+	set     *Set
+	builder *frame.Builder
+	routers map[string]*m.Address
+
+	// sessions holds the router sessions established by the handshakes,
+	// by handshake name and router name.
+	sessions map[string]map[string]*state.EncryptionSession
+}
+
+// Generate generates the test vectors.
+// The output is deterministic and must match the golden vectors.
+func Generate() (*Set, error) {
+	g := &generator{
+		set:      &Set{Version: FormatVersion},
+		builder:  frame.NewDeterministicFrameBuilder(source("frame nonces")),
+		routers:  make(map[string]*m.Address),
+		sessions: make(map[string]map[string]*state.EncryptionSession),
+	}
+
+	// Create identities.
+	for _, name := range []string{"alpha", "bravo", "charlie"} {
+		addr, err := makeIdentity(name)
+		if err != nil {
+			return nil, fmt.Errorf("make identity %s: %w", name, err)
+		}
+		g.routers[name] = addr
+		g.set.Routers = append(g.set.Routers, Router{
+			Name:    name,
+			Address: addr.Store(),
+		})
+	}
+
+	// Announcements.
+	if err := g.announce(
+		"announce-direct",
+		"announcement as sent by the announcing router",
+		"alpha",
+	); err != nil {
+		return nil, err
+	}
+	if err := g.announce(
+		"announce-one-hop",
+		"announcement with one attachment",
+		"alpha", "bravo",
+	); err != nil {
+		return nil, err
+	}
+	if err := g.announce(
+		"announce-two-hops",
+		"announcement with two nested attachments",
+		"alpha", "bravo", "charlie",
+	); err != nil {
+		return nil, err
+	}
+
+	// Handshakes.
+	if err := g.handshake(
+		"peering",
+		"peering handshake without universe",
+		"alpha", "bravo", "", "",
+	); err != nil {
+		return nil, err
+	}
+	if err := g.handshake(
+		"peering-universe",
+		"peering handshake in a private universe",
+		"charlie", "alpha", "vectors", "correct horse battery staple",
+	); err != nil {
+		return nil, err
+	}
+
+	// Sealed frames.
+	if err := g.seal(
+		"sealed-router-ctrl",
+		"priority encrypted router control frame from the client",
+		"peering", "alpha", "bravo", frame.RouterCtrl, 0,
+	); err != nil {
+		return nil, err
+	}
+	if err := g.seal(
+		"sealed-network-traffic",
+		"encrypted network traffic from the server, later in the session",
+		"peering", "bravo", "alpha", frame.NetworkTraffic, 1000,
+	); err != nil {
+		return nil, err
+	}
+	if err := g.seal(
+		"sealed-session-data",
+		"encrypted session data in a private universe",
+		"peering-universe", "charlie", "alpha", frame.SessionData, 0,
+	); err != nil {
+		return nil, err
+	}
+
+	return g.set, nil
+}
+
+func (g *generator) announce(name, description, announcer string, hops ...string) error {
+	src := g.routers[announcer]
+
+	// Build announce message.
+	msg := router.AnnouncePingMsg{
+		SchemaVersion: m.SchemaVersionAnnounce,
+		Info: &m.RouterInfo{
+			Version:      vectorRouterVersion,
+			Listeners:    []string{"tcp:47369"},
+			Capabilities: m.CapFEC,
+		},
+		ReturnLabel: 11,
+		Expires:     vectorTime.Add(time.Hour),
+	}
+	msgData, err := cbor.Marshal(&msg)
+	if err != nil {
+		return fmt.Errorf("%s: marshal message: %w", name, err)
+	}
+
+	// Build ping frame.
+	hdrData, err := cbor.Marshal(&router.PingHeader{
+		SchemaVersion: m.SchemaVersionPing,
+		PingID:        announcePingID,
+		PingType:      announcePingType,
+		AddrHash:      src.Hash,
+		KeyType:       src.Type,
+		PublicKey:     src.PublicKey,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: marshal ping header: %w", name, err)
+	}
+	frameData := make([]byte, 0, 2+len(hdrData)+len(msgData))
+	frameData = append(frameData, 1, uint8(len(hdrData)))
+	frameData = append(frameData, hdrData...)
+	frameData = append(frameData, msgData...)
+	f, err := g.builder.NewFrameV1(src.IP, m.RouterAddress, frame.RouterHopPingDeprecated, nil, frameData, nil)
+	if err != nil {
+		return fmt.Errorf("%s: build frame: %w", name, err)
+	}
+	if err := signFrame(f, src, vectorTime, 32); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	// Attach hops.
+	if len(hops) > 0 {
+		signingContext := router.AnnounceSigningContext(f)
+		var apx []byte
+		for i, hop := range hops {
+			hopAddr := g.routers[hop]
+			attachData, err := cbor.Marshal(router.AnnouncePingAttachment{
+				Router:         hopAddr.PublicAddress,
+				Delay:          uint16(10 * (i + 1)),
+				ForwardLabel:   m.SwitchLabel(20 + i),
+				ReturnLabel:    m.SwitchLabel(30 + i),
+				NextAttachment: apx,
+			})
+			if err != nil {
+				return fmt.Errorf("%s: marshal attachment of %s: %w", name, hop, err)
+			}
+			sig, err := hopAddr.SignWithContext(attachData, signingContext)
+			if err != nil {
+				return fmt.Errorf("%s: sign attachment of %s: %w", name, hop, err)
+			}
+			apx = append(attachData, sig...)
+		}
+		if err := f.SetAppendixData(apx); err != nil {
+			return fmt.Errorf("%s: set appendix: %w", name, err)
+		}
+	}
+
+	frameBytes, err := frameBytes(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	g.set.Announces = append(g.set.Announces, Announce{
+		Name:        name,
+		Description: description,
+		Router:      announcer,
+		Hops:        hops,
+		Message:     msgData,
+		Frame:       frameBytes,
+	})
+	return nil
+}
+
+func (g *generator) handshake(name, description, client, server, universe, secret string) error {
+	clientAddr := g.routers[client]
+	serverAddr := g.routers[server]
+	hs := Handshake{
+		Name:              name,
+		Description:       description,
+		Client:            client,
+		Server:            server,
+		Universe:          universe,
+		UniverseSecret:    secret,
+		ClientExchangeKey: readBytes(name+" client kx", 32),
+		ServerExchangeKey: readBytes(name+" server kx", 32),
+	}
+	clientChallenge := readBytes(name+" client challenge", 32)
+	serverChallenge := readBytes(name+" server challenge", 32)
+	clientObserved := netip.MustParseAddrPort("192.0.2.1:50000")
+	serverObserved := netip.MustParseAddrPort("198.51.100.2:47369")
+
+	kx, err := exchangeKeys(hs.ClientExchangeKey, hs.ServerExchangeKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	seqTime := vectorTime
+	addStep := func(stepName string, from, to *m.Address, msg any) error {
+		msgData, err := cbor.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("%s: marshal %s: %w", name, stepName, err)
+		}
+
+		// Requests are sent before the routers know each other and are
+		// addressed to the link. Everything else is sealed with the session.
+		dst := to.IP
+		ttl := uint8(32)
+		if _, ok := msg.(*peering.HandshakeRequest); ok {
+			dst = m.RouterAddress
+			ttl = 1
+		}
+		f, err := g.builder.NewFrameV1(from.IP, dst, frame.RouterPing, nil, msgData, nil)
+		if err != nil {
+			return fmt.Errorf("%s: build %s: %w", name, stepName, err)
+		}
+		seqTime = seqTime.Add(time.Second)
+		if err := signFrame(f, from, seqTime, ttl); err != nil {
+			return fmt.Errorf("%s: %s: %w", name, stepName, err)
+		}
+		frameBytes, err := frameBytes(f)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", name, stepName, err)
+		}
+
+		hs.Steps = append(hs.Steps, HandshakeStep{
+			Name:    stepName,
+			From:    routerName(g.routers, from),
+			To:      routerName(g.routers, to),
+			Message: msgData,
+			Frame:   frameBytes,
+		})
+		return nil
+	}
+	request := func(addr *m.Address, challenge []byte, fec *peering.FECParams) *peering.HandshakeRequest {
+		return &peering.HandshakeRequest{
+			SchemaVersion: m.SchemaVersionPeering,
+			RouterVersion: vectorRouterVersion,
+			Universe:      universe,
+			Address:       addr.PublicAddress,
+			Challenge:     challenge,
+			LinkVersion:   1,
+			TunMTU:        1258,
+			FEC:           fec,
+			FECSupport:    true,
+			Capabilities:  m.CapFEC,
+		}
+	}
+	var clientUniverseAuth, serverUniverseAuth []byte
+	if universe != "" && secret != "" {
+		clientUniverseAuth = peering.MakeUniverseAuth(universe, secret, serverChallenge, serverAddr.IP, clientAddr.IP)
+		serverUniverseAuth = peering.MakeUniverseAuth(universe, secret, clientChallenge, clientAddr.IP, serverAddr.IP)
+	}
+
+	// Both routers send their request when connected.
+	// The client proposes forward error correction.
+	if err := addStep("client request", clientAddr, serverAddr,
+		request(clientAddr, clientChallenge, &peering.FECParams{Data: 4, Parity: 2}),
+	); err != nil {
+		return err
+	}
+	if err := addStep("server request", serverAddr, clientAddr,
+		request(serverAddr, serverChallenge, nil),
+	); err != nil {
+		return err
+	}
+
+	// Both routers respond to the request.
+	// The client starts the key exchange.
+	if err := addStep("client response", clientAddr, serverAddr, &peering.HandshakeResponse{
+		SchemaVersion:   m.SchemaVersionPeering,
+		Challenge:       serverChallenge,
+		UniverseAuth:    clientUniverseAuth,
+		KeyExchange:     kx.clientKey,
+		KeyExchangeType: kx.clientType,
+		ObservedAddr:    serverObserved.String(),
+	}); err != nil {
+		return err
+	}
+	if err := addStep("server response", serverAddr, clientAddr, &peering.HandshakeResponse{
+		SchemaVersion: m.SchemaVersionPeering,
+		Challenge:     clientChallenge,
+		UniverseAuth:  serverUniverseAuth,
+		ObservedAddr:  clientObserved.String(),
+	}); err != nil {
+		return err
+	}
+
+	// Both routers acknowledge the response.
+	// The server completes the key exchange.
+	if err := addStep("client ack", clientAddr, serverAddr, &peering.HandshakeAck{SchemaVersion: m.SchemaVersionPeering}); err != nil {
+		return err
+	}
+	if err := addStep("server ack", serverAddr, clientAddr, &peering.HandshakeAck{
+		SchemaVersion:   m.SchemaVersionPeering,
+		KeyExchange:     kx.serverKey,
+		KeyExchangeType: kx.serverType,
+	}); err != nil {
+		return err
+	}
+
+	// Derive link sessions.
+	clientLink, err := kx.client.DeriveSessionFromKX(true, linkLayerPurpose)
+	if err != nil {
+		return fmt.Errorf("%s: derive client link session: %w", name, err)
+	}
+	serverLink, err := kx.server.DeriveSessionFromKX(false, linkLayerPurpose)
+	if err != nil {
+		return fmt.Errorf("%s: derive server link session: %w", name, err)
+	}
+	hs.RouterKeys = SessionKeys{
+		ClientOut: (&state.EncryptionSessionTestHelper{EncryptionSession: kx.client}).OutKey(),
+		ServerOut: (&state.EncryptionSessionTestHelper{EncryptionSession: kx.server}).OutKey(),
+	}
+	hs.LinkKeys = SessionKeys{
+		ClientOut: (&state.EncryptionSessionTestHelper{EncryptionSession: clientLink}).OutKey(),
+		ServerOut: (&state.EncryptionSessionTestHelper{EncryptionSession: serverLink}).OutKey(),
+	}
+	kx.client.InitCleanup()
+	kx.server.InitCleanup()
+	g.sessions[name] = map[string]*state.EncryptionSession{
+		client: kx.client,
+		server: kx.server,
+	}
+
+	g.set.Handshakes = append(g.set.Handshakes, hs)
+	return nil
+}
+
+// keyExchange holds the sessions and messages of a key exchange.
+type keyExchange struct {
+	client *state.EncryptionSession
+	server *state.EncryptionSession
+
+	clientKey  []byte
+	clientType string
+	serverKey  []byte
+	serverType string
+}
+
+// exchangeKeys sets up the sessions of both routers with the key exchange of
+// the handshake, using the given private exchange keys.
+func exchangeKeys(clientKey, serverKey []byte) (*keyExchange, error) {
+	kx := &keyExchange{
+		client: state.NewDeterministicEncryptionSession(bytes.NewReader(clientKey)),
+		server: state.NewDeterministicEncryptionSession(bytes.NewReader(serverKey)),
+	}
+	var err error
+	kx.clientKey, kx.clientType, err = kx.client.InitKeyClientStart()
+	if err != nil {
+		return nil, fmt.Errorf("start client key exchange: %w", err)
+	}
+	kx.serverKey, kx.serverType, err = kx.server.InitKeyServer(kx.clientKey, kx.clientType)
+	if err != nil {
+		return nil, fmt.Errorf("server key exchange: %w", err)
+	}
+	if err := kx.client.InitKeyClientComplete(kx.serverKey, kx.serverType); err != nil {
+		return nil, fmt.Errorf("complete client key exchange: %w", err)
+	}
+	return kx, nil
+}
+
+func (g *generator) seal(
+	name, description, handshake, from, to string,
+	msgType frame.MessageType, startSeq uint32,
+) error {
+	src := g.routers[from]
+	dst := g.routers[to]
+	enc := g.sessions[handshake][from]
+	if enc == nil {
+		return fmt.Errorf("%s: no session for %s in handshake %s", name, from, handshake)
+	}
+
+	// Set sequence number.
+	helper := &state.EncryptionSessionTestHelper{EncryptionSession: enc}
+	if msgType.Class() == frame.MessageClassPriorityEncrypted {
+		helper.PrioSetOut(startSeq)
+	} else {
+		helper.ReglSetOut(startSeq)
+	}
+
+	// Build and seal frame.
+	f, err := g.builder.NewFrameV1(src.IP, dst.IP, msgType, nil, testData, nil)
+	if err != nil {
+		return fmt.Errorf("%s: build frame: %w", name, err)
+	}
+	if err := f.Seal(state.NewSession(&dst.PublicAddress, nil, enc)); err != nil {
+		return fmt.Errorf("%s: seal: %w", name, err)
+	}
+	frameBytes, err := frameBytes(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	g.set.Sealed = append(g.set.Sealed, Sealed{
+		Name:        name,
+		Description: description,
+		From:        from,
+		To:          to,
+		Handshake:   handshake,
+		MessageType: msgType,
+		SequenceNum: f.SequenceNum(),
+		Plaintext:   testData,
+		Frame:       frameBytes,
+	})
+	return nil
+}
+
+// signFrame signs the frame like a session would, but with the given
+// sequence time.
+func signFrame(f *frame.FrameV1, addr *m.Address, seqTime time.Time, ttl uint8) error {
+	f.SetTTL(0)
+	f.SetSequenceTime(seqTime)
+	if err := f.SignRaw(addr.PrivateKey); err != nil {
+		return fmt.Errorf("sign frame: %w", err)
+	}
+	f.SetTTL(ttl)
+	return nil
+}
+
+func frameBytes(f frame.Frame) ([]byte, error) {
+	data, err := f.FrameDataWithMargins(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("get frame data: %w", err)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func routerName(routers map[string]*m.Address, addr *m.Address) string {
+	for name, r := range routers {
+		if r == addr {
+			return name
+		}
+	}
+	return ""
+}
+
+// makeIdentity derives a routable address from the given name.
+func makeIdentity(name string) (*m.Address, error) {
+	for i := range maxIdentityTries {
+		seed := readBytes(fmt.Sprintf("identity %s %d", name, i), ed25519.SeedSize)
+		privKey := ed25519.NewKeyFromSeed(seed)
+		pubKey := privKey.Public().(ed25519.PublicKey) //nolint:forcetypeassert
+
+		ip, err := m.DigestToAddress(m.AddressDigestAlg, m.AddressKeyToolID, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		if !m.RoutingAddressPrefix.Contains(ip) || m.SpecialPrefix.Contains(ip) {
+			continue
+		}
+
+		return &m.Address{
+			PublicAddress: m.PublicAddress{
+				IP:        ip,
+				Hash:      m.AddressDigestAlg,
+				Type:      m.AddressKeyToolID,
+				PublicKey: pubKey,
+			},
+			PrivateKey: privKey,
+		}, nil
+	}
+	return nil, errors.New("no matching address found")
+}
+
+// source returns a deterministic stream of bytes for the given label.
+func source(label string) io.Reader {
+	h := blake3.NewDeriveKey(sourceContext)
+	_, _ = h.WriteString(label)
+	return h.Digest()
+}
+
+func readBytes(label string, n int) []byte {
+	data := make([]byte, n)
+	_, _ = io.ReadFull(source(label), data)
+	return data
+}
@@ -0,0 +1,206 @@
+// Package vectors provides golden test vectors for the mycoria protocol.
+//
+// The vectors hold signed announce frames with nested attachments, the frames
+// of a complete peering handshake and sealed frames, together with all keys
+// required to reproduce them. They are generated deterministically, so that
+// alternative implementations and refactors can verify byte-exact
+// interoperability against the published golden file.
+package vectors
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+)
+
+// FormatVersion is the version of the vector file format.
+const FormatVersion = 1
+
+//go:embed golden.json
+var goldenData []byte
+
+// Set is a complete set of test vectors.
+type Set struct {
+	Version int `json:"version"`
+
+	// Routers holds the identities used in the vectors, including their
+	// private keys.
+	Routers []Router `json:"routers"`
+
+	Announces  []Announce  `json:"announces"`
+	Handshakes []Handshake `json:"handshakes"`
+	Sealed     []Sealed    `json:"sealed"`
+}
+
+// Router is a router identity used in the vectors.
+type Router struct {
+	Name    string           `json:"name"`
+	Address m.AddressStorage `json:"address"`
+}
+
+// Announce is a signed announce frame, as sent by the last router that
+// forwarded it.
+type Announce struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Router is the name of the announcing router.
+	Router string `json:"router"`
+	// Hops holds the names of the routers that attached their signed
+	// attachment, in forwarding order.
+	Hops []string `json:"hops,omitempty"`
+
+	// Message is the CBOR encoded announce message.
+	Message Hex `json:"message"`
+	// Frame is the complete frame.
+	Frame Hex `json:"frame"`
+}
+
+// Handshake is a complete peering handshake between a client and a server.
+type Handshake struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	Client         string `json:"client"`
+	Server         string `json:"server"`
+	Universe       string `json:"universe,omitempty"`
+	UniverseSecret string `json:"universeSecret,omitempty"`
+
+	// ClientExchangeKey and ServerExchangeKey are the private X25519 keys
+	// used for the key exchange.
+	ClientExchangeKey Hex `json:"clientExchangeKey"`
+	ServerExchangeKey Hex `json:"serverExchangeKey"`
+
+	// Steps holds all handshake frames in the order they are sent.
+	Steps []HandshakeStep `json:"steps"`
+
+	// RouterKeys are the keys of the resulting router session.
+	RouterKeys SessionKeys `json:"routerKeys"`
+	// LinkKeys are the keys of the resulting link layer session.
+	LinkKeys SessionKeys `json:"linkKeys"`
+}
+
+// HandshakeStep is a single frame of a peering handshake.
+type HandshakeStep struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Message is the CBOR encoded handshake message.
+	Message Hex `json:"message"`
+	// Frame is the complete frame.
+	Frame Hex `json:"frame"`
+}
+
+// SessionKeys holds the symmetric keys of an encryption session.
+// The outgoing key of one side is the incoming key of the other.
+type SessionKeys struct {
+	ClientOut Hex `json:"clientOut"`
+	ServerOut Hex `json:"serverOut"`
+}
+
+// Sealed is an encrypted frame.
+type Sealed struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Handshake is the name of the handshake the router session keys are
+	// taken from.
+	Handshake string `json:"handshake"`
+
+	MessageType frame.MessageType `json:"messageType"`
+	SequenceNum uint32            `json:"sequenceNum"`
+
+	// Plaintext is the message data before encryption.
+	Plaintext Hex `json:"plaintext"`
+	// Frame is the complete encrypted frame.
+	Frame Hex `json:"frame"`
+}
+
+// Hex is binary data that is hex encoded in JSON.
+type Hex []byte
+
+// MarshalText implements encoding.TextMarshaler.
+func (h Hex) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (h *Hex) UnmarshalText(text []byte) error {
+	data, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*h = data
+	return nil
+}
+
+// Golden returns the published golden test vectors.
+func Golden() (*Set, error) {
+	return Parse(goldenData)
+}
+
+// Load loads test vectors from the given file.
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses test vectors.
+func Parse(data []byte) (*Set, error) {
+	set := &Set{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	if set.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported format version %d", set.Version)
+	}
+	return set, nil
+}
+
+// Marshal returns the test vectors in the file format.
+func (set *Set) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Address returns the address of the router with the given name.
+func (set *Set) Address(name string) (*m.Address, error) {
+	for _, r := range set.Routers {
+		if r.Name == name {
+			return m.AddressFromStorage(r.Address)
+		}
+	}
+	return nil, fmt.Errorf("router %q not found", name)
+}
+
+// Handshake returns the handshake with the given name.
+func (set *Set) Handshake(name string) (*Handshake, error) {
+	for i := range set.Handshakes {
+		if set.Handshakes[i].Name == name {
+			return &set.Handshakes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("handshake %q not found", name)
+}
+
+// ParseFrame parses the given frame data.
+// The data is copied, so that the vector is not modified.
+func ParseFrame(data []byte) (*frame.FrameV1, error) {
+	copied := bytes.Clone(data)
+	return frame.NewFrameBuilder().ParseFrameV1(copied, copied, 0)
+}
@@ -0,0 +1,200 @@
+package vectors
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mycoria/mycoria/frame"
+	"github.com/mycoria/mycoria/m"
+	"github.com/mycoria/mycoria/peering"
+	"github.com/mycoria/mycoria/router"
+	"github.com/mycoria/mycoria/state"
+)
+
+var update = flag.Bool("update", false, "update the golden vectors")
+
+func TestGolden(t *testing.T) {
+	t.Parallel()
+
+	set, err := Generate()
+	require.NoError(t, err)
+	data, err := set.Marshal()
+	require.NoError(t, err)
+
+	if *update {
+		require.NoError(t, os.WriteFile("golden.json", data, 0o644)) //nolint:gosec
+		return
+	}
+
+	// Generation must be deterministic and match the published vectors.
+	again, err := Generate()
+	require.NoError(t, err)
+	againData, err := again.Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(againData), "generation should be deterministic")
+	assert.Equal(t, string(goldenData), string(data), "golden vectors should match, run with -update if the change is intended")
+
+	golden, err := Golden()
+	require.NoError(t, err)
+	assert.Len(t, golden.Routers, 3)
+	assert.Len(t, golden.Announces, 3)
+	assert.Len(t, golden.Handshakes, 2)
+	assert.Len(t, golden.Sealed, 3)
+}
+
+func TestAnnounceVectors(t *testing.T) {
+	t.Parallel()
+
+	set, err := Golden()
+	require.NoError(t, err)
+
+	for _, v := range set.Announces {
+		announcer, err := set.Address(v.Router)
+		require.NoError(t, err, v.Name)
+		f, err := ParseFrame(v.Frame)
+		require.NoError(t, err, v.Name)
+
+		// Check frame signature.
+		assert.Equal(t, frame.RouterHopPingDeprecated, f.MessageType(), v.Name)
+		assert.Equal(t, announcer.IP, f.SrcIP(), v.Name)
+		assert.Equal(t, m.RouterAddress, f.DstIP(), v.Name)
+		verifyFrame(t, f, announcer, v.Name)
+
+		// Check message.
+		data := f.MessageData()
+		require.Equal(t, uint8(1), data[0], v.Name)
+		hdr := router.PingHeader{}
+		require.NoError(t, cbor.Unmarshal(data[2:2+int(data[1])], &hdr), v.Name)
+		assert.Equal(t, announcePingType, hdr.PingType, v.Name)
+		assert.Equal(t, []byte(v.Message), data[2+int(data[1]):], v.Name)
+		msg := router.AnnouncePingMsg{}
+		require.NoError(t, cbor.Unmarshal(v.Message, &msg), v.Name)
+		assert.Equal(t, vectorRouterVersion, msg.Info.Version, v.Name)
+
+		// Check attachments, from the last hop to the first.
+		signingContext := router.AnnounceSigningContext(f)
+		apx := f.AppendixData()
+		for i := len(v.Hops) - 1; i >= 0; i-- {
+			hop, err := set.Address(v.Hops[i])
+			require.NoError(t, err, v.Name)
+			require.Greater(t, len(apx), 64, v.Name)
+
+			attached := router.AnnouncePingAttachment{}
+			require.NoError(t, cbor.Unmarshal(apx[:len(apx)-64], &attached), v.Name)
+			assert.Equal(t, hop.IP, attached.Router.IP, v.Name)
+			require.NoError(t, attached.Router.VerifyAddress(), v.Name)
+			assert.NoError(t, attached.Router.VerifySigWithContext(apx[:len(apx)-64], apx[len(apx)-64:], signingContext), v.Name)
+
+			apx = attached.NextAttachment
+		}
+		assert.Empty(t, apx, v.Name)
+	}
+}
+
+func TestHandshakeVectors(t *testing.T) {
+	t.Parallel()
+
+	set, err := Golden()
+	require.NoError(t, err)
+
+	for _, hs := range set.Handshakes {
+		require.Len(t, hs.Steps, 6, hs.Name)
+		for _, step := range hs.Steps {
+			from, err := set.Address(step.From)
+			require.NoError(t, err, hs.Name)
+			f, err := ParseFrame(step.Frame)
+			require.NoError(t, err, hs.Name)
+
+			assert.Equal(t, frame.RouterPing, f.MessageType(), hs.Name)
+			assert.Equal(t, from.IP, f.SrcIP(), hs.Name)
+			assert.Equal(t, []byte(step.Message), f.MessageData(), hs.Name)
+			verifyFrame(t, f, from, hs.Name+" "+step.Name)
+		}
+
+		// Check universe auth.
+		if hs.Universe != "" {
+			client, err := set.Address(hs.Client)
+			require.NoError(t, err)
+			server, err := set.Address(hs.Server)
+			require.NoError(t, err)
+
+			clientReq := peering.HandshakeRequest{}
+			require.NoError(t, cbor.Unmarshal(hs.Steps[0].Message, &clientReq))
+			serverResp := peering.HandshakeResponse{}
+			require.NoError(t, cbor.Unmarshal(hs.Steps[3].Message, &serverResp))
+			assert.Equal(t,
+				peering.MakeUniverseAuth(hs.Universe, hs.UniverseSecret, clientReq.Challenge, client.IP, server.IP),
+				serverResp.UniverseAuth,
+				hs.Name,
+			)
+		}
+
+		// Check that the exchanged keys result in the session keys.
+		clientResp := peering.HandshakeResponse{}
+		require.NoError(t, cbor.Unmarshal(hs.Steps[2].Message, &clientResp))
+		serverAck := peering.HandshakeAck{}
+		require.NoError(t, cbor.Unmarshal(hs.Steps[5].Message, &serverAck))
+		kx := testExchangeKeys(t, &hs)
+		assert.Equal(t, kx.clientKey, clientResp.KeyExchange, hs.Name)
+		assert.Equal(t, kx.serverKey, serverAck.KeyExchange, hs.Name)
+
+		session := &state.EncryptionSessionTestHelper{EncryptionSession: kx.client}
+		assert.Equal(t, []byte(hs.RouterKeys.ClientOut), session.OutKey(), hs.Name)
+		assert.Equal(t, []byte(hs.RouterKeys.ServerOut), session.InKey(), hs.Name)
+	}
+}
+
+func TestSealedVectors(t *testing.T) {
+	t.Parallel()
+
+	set, err := Golden()
+	require.NoError(t, err)
+
+	for _, v := range set.Sealed {
+		hs, err := set.Handshake(v.Handshake)
+		require.NoError(t, err, v.Name)
+		from, err := set.Address(v.From)
+		require.NoError(t, err, v.Name)
+
+		// Set up the receiving side of the session.
+		kx := testExchangeKeys(t, hs)
+		recv := kx.server
+		if v.To == hs.Client {
+			recv = kx.client
+		}
+
+		// Decrypt.
+		f, err := ParseFrame(v.Frame)
+		require.NoError(t, err, v.Name)
+		assert.Equal(t, v.MessageType, f.MessageType(), v.Name)
+		assert.Equal(t, v.SequenceNum, f.SequenceNum(), v.Name)
+		require.NoError(t, f.Unseal(state.NewSession(&from.PublicAddress, nil, recv)), v.Name)
+		assert.Equal(t, []byte(v.Plaintext), f.MessageData(), v.Name)
+	}
+}
+
+// testExchangeKeys sets up the sessions of the handshake from its exchange
+// keys.
+func testExchangeKeys(t *testing.T, hs *Handshake) *keyExchange {
+	t.Helper()
+
+	kx, err := exchangeKeys(hs.ClientExchangeKey, hs.ServerExchangeKey)
+	require.NoError(t, err, hs.Name)
+	return kx
+}
+
+func verifyFrame(t *testing.T, f *frame.FrameV1, addr *m.Address, name string) {
+	t.Helper()
+
+	ttl := f.TTL()
+	f.SetTTL(0)
+	defer f.SetTTL(ttl)
+	assert.NoError(t, f.VerifyRaw(addr.PublicKey), name)
+	assert.False(t, bytes.Equal(f.AuthData(), make([]byte, 64)), name)
+}